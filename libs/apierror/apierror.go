@@ -0,0 +1,127 @@
+// Package apierror is the error envelope shared by the Go services. Handlers
+// return an *Error (or any error) and the Fiber or net/http adapters render
+// it as
+//
+//	{"code": "not_found", "message": "user not found", "details": {...}}
+//
+// Messages of 5xx errors are never sent to clients; they are logged under a
+// correlation ID that is returned instead.
+package apierror
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Code is a stable, machine-readable error identifier. Clients branch on the
+// code; the message is for humans and may change.
+type Code string
+
+// Catalogue of codes shared by every service. Services may define more
+// specific codes of their own (e.g. "class_full") on top of these.
+const (
+	CodeBadRequest      Code = "bad_request"
+	CodeValidation      Code = "validation_failed"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeVersionConflict Code = "version_conflict"
+	CodePayloadTooLarge Code = "payload_too_large"
+	CodeRateLimited     Code = "rate_limited"
+	CodeInternal        Code = "internal_error"
+	CodeUnavailable     Code = "service_unavailable"
+)
+
+// Error is an error with the status and body it should be rendered with.
+// Err is the underlying cause; it is logged but never rendered.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Details map[string]interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode replaces the generic code with a more specific one
+func (e *Error) WithCode(code Code) *Error {
+	e.Code = code
+	return e
+}
+
+// WithDetail adds a key to the details object
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+// FieldError describes one invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Validation reports invalid fields with 422; they are listed under
+// details.fields
+func Validation(fields ...FieldError) *Error {
+	return New(http.StatusUnprocessableEntity, CodeValidation, "request validation failed").
+		WithDetail("fields", fields)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// PayloadTooLarge rejects a request body over limit bytes with 413
+func PayloadTooLarge(limit int) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "request body is too large").
+		WithDetail("limit_bytes", limit)
+}
+
+// Internal wraps an unexpected error. Clients only ever see a generic message.
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// As returns err as an *Error, treating anything that is not one as internal
+func As(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Internal(err)
+}
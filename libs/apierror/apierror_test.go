@@ -0,0 +1,120 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type pgError struct{ code string }
+
+func (e pgError) Error() string    { return "pg error " + e.code }
+func (e pgError) SQLState() string { return e.code }
+
+func TestFromRepository(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		status int
+		code   Code
+	}{
+		{gorm.ErrRecordNotFound, http.StatusNotFound, CodeNotFound},
+		{fmt.Errorf("create: %w", pgError{"23505"}), http.StatusConflict, CodeConflict},
+		{gorm.ErrForeignKeyViolated, http.StatusConflict, CodeConflict},
+		{pgError{"22P02"}, http.StatusBadRequest, CodeBadRequest},
+		{errors.New("connection reset"), http.StatusInternalServerError, CodeInternal},
+		{Forbidden("no"), http.StatusForbidden, CodeForbidden},
+	} {
+		apiErr := As(FromRepository(c.err, "user"))
+		if apiErr.Status != c.status || apiErr.Code != c.code {
+			t.Errorf("%v: got %d %s, want %d %s", c.err, apiErr.Status, apiErr.Code, c.status, c.code)
+		}
+	}
+	if FromRepository(nil, "user") != nil {
+		t.Error("nil error was wrapped")
+	}
+}
+
+func render(t *testing.T, handler fiber.Handler, requestID string) (*http.Response, Envelope) {
+	t.Helper()
+	app := fiber.New(fiber.Config{ErrorHandler: FiberErrorHandler})
+	app.Get("/thing", handler)
+	req := httptest.NewRequest("GET", "/thing", nil)
+	if requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body Envelope
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestFiberErrorHandlerRendersEnvelope(t *testing.T) {
+	resp, body := render(t, func(c *fiber.Ctx) error {
+		return Validation(FieldError{Field: "email", Message: "is required"})
+	}, "")
+	if resp.StatusCode != http.StatusUnprocessableEntity || body.Code != CodeValidation {
+		t.Fatalf("validation error: got %d %+v", resp.StatusCode, body)
+	}
+	fields, _ := body.Details["fields"].([]interface{})
+	if len(fields) != 1 || fields[0].(map[string]interface{})["field"] != "email" {
+		t.Errorf("validation details = %+v, want the email field", body.Details)
+	}
+
+	resp, body = render(t, func(c *fiber.Ctx) error {
+		return fiber.ErrNotFound
+	}, "")
+	if resp.StatusCode != http.StatusNotFound || body.Code != CodeNotFound {
+		t.Errorf("fiber's own 404: got %d %+v", resp.StatusCode, body)
+	}
+}
+
+func TestInternalErrorsHideTheirCause(t *testing.T) {
+	resp, body := render(t, func(c *fiber.Ctx) error {
+		return errors.New("pq: password authentication failed for user \"identity\"")
+	}, "req-123")
+	if resp.StatusCode != http.StatusInternalServerError || body.Code != CodeInternal {
+		t.Fatalf("unexpected error: got %d %+v", resp.StatusCode, body)
+	}
+	if body.Message != "Internal Server Error" || len(body.Details) != 1 {
+		t.Errorf("5xx body leaks more than a correlation ID: %+v", body)
+	}
+	if body.Details["correlation_id"] != "req-123" || resp.Header.Get(RequestIDHeader) != "req-123" {
+		t.Errorf("correlation ID = %v / %q, want the incoming request ID", body.Details["correlation_id"], resp.Header.Get(RequestIDHeader))
+	}
+
+	// Without an incoming ID one is made up and returned in both places
+	resp, body = render(t, func(c *fiber.Ctx) error { return errors.New("boom") }, "")
+	if id, _ := body.Details["correlation_id"].(string); id == "" || resp.Header.Get(RequestIDHeader) != id {
+		t.Errorf("generated correlation ID = %q, header %q", id, resp.Header.Get(RequestIDHeader))
+	}
+}
+
+func TestHandlerFuncRendersOnNetHTTP(t *testing.T) {
+	h := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return NotFound("session not found")
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/sessions/x", nil))
+
+	var body Envelope
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotFound || body.Code != CodeNotFound || body.Message != "session not found" {
+		t.Errorf("got %d %+v", rec.Code, body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
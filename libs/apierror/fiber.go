@@ -0,0 +1,49 @@
+package apierror
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FiberErrorHandler renders errors returned by handlers, for use as
+// fiber.Config.ErrorHandler. Fiber's own errors (unknown route, body too
+// large, ...) keep their status.
+func FiberErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		err = fromStatus(fiberErr.Code, fiberErr.Message)
+	}
+
+	status, body := envelope(err, c.Method(), c.Path(), c.Get(RequestIDHeader))
+	if id, ok := body.Details["correlation_id"].(string); ok {
+		c.Set(RequestIDHeader, id)
+	}
+	return c.Status(status).JSON(body)
+}
+
+// fromStatus gives a bare status the code the catalogue uses for it
+func fromStatus(status int, message string) *Error {
+	code := CodeInternal
+	switch {
+	case status == fiber.StatusUnauthorized:
+		code = CodeUnauthorized
+	case status == fiber.StatusForbidden:
+		code = CodeForbidden
+	case status == fiber.StatusNotFound:
+		code = CodeNotFound
+	case status == fiber.StatusConflict:
+		code = CodeConflict
+	case status == fiber.StatusRequestEntityTooLarge:
+		code = CodePayloadTooLarge
+	case status == fiber.StatusUnprocessableEntity:
+		code = CodeValidation
+	case status == fiber.StatusTooManyRequests:
+		code = CodeRateLimited
+	case status == fiber.StatusServiceUnavailable:
+		code = CodeUnavailable
+	case status < fiber.StatusInternalServerError:
+		code = CodeBadRequest
+	}
+	return New(status, code, message)
+}
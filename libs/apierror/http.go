@@ -0,0 +1,27 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// WriteHTTP renders err on a net/http response
+func WriteHTTP(w http.ResponseWriter, r *http.Request, err error) {
+	status, body := envelope(err, r.Method, r.URL.Path, r.Header.Get(RequestIDHeader))
+	if id, ok := body.Details["correlation_id"].(string); ok {
+		w.Header().Set(RequestIDHeader, id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// HandlerFunc adapts a handler that returns an error to net/http, rendering
+// the error with WriteHTTP
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f(w, r); err != nil {
+		WriteHTTP(w, r, err)
+	}
+}
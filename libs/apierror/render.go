@@ -0,0 +1,36 @@
+package apierror
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the correlation ID of a request. An incoming value
+// is reused so one ID can follow a request across services.
+const RequestIDHeader = "X-Request-ID"
+
+// Envelope is the JSON body of every error response
+type Envelope struct {
+	Code    Code                   `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// envelope turns err into the status and body to send. For 5xx errors the
+// cause is logged under requestID and the body only carries the ID.
+func envelope(err error, method, path, requestID string) (int, Envelope) {
+	apiErr := As(err)
+	body := Envelope{Code: apiErr.Code, Message: apiErr.Message, Details: apiErr.Details}
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		log.Printf("[apierror] %s %s failed (correlation_id=%s): %v", method, path, requestID, err)
+		body.Message = http.StatusText(apiErr.Status)
+		body.Details = map[string]interface{}{"correlation_id": requestID}
+	}
+	return apiErr.Status, body
+}
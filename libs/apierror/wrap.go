@@ -0,0 +1,52 @@
+package apierror
+
+import (
+	"errors"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Postgres SQLSTATE codes the wrappers recognise
+const (
+	sqlStateUniqueViolation     = "23505"
+	sqlStateForeignKeyViolation = "23503"
+	sqlStateInvalidText         = "22P02"
+)
+
+// FromRepository maps a repository error about resource (e.g. "user") to an
+// *Error: missing rows become 404, unique violations 409, malformed IDs 400
+// and anything else an internal error. Errors that already are an *Error
+// pass through unchanged.
+func FromRepository(err error, resource string) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: resource + " not found", Err: err}
+	case errors.Is(err, gorm.ErrDuplicatedKey) || sqlState(err) == sqlStateUniqueViolation:
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: resource + " already exists", Err: err}
+	case errors.Is(err, gorm.ErrForeignKeyViolated) || sqlState(err) == sqlStateForeignKeyViolation:
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: resource + " is referenced by or references a missing record", Err: err}
+	case sqlState(err) == sqlStateInvalidText:
+		return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "invalid " + resource + " identifier", Err: err}
+	}
+	return Internal(err)
+}
+
+// sqlState returns the SQLSTATE of a database driver error, or "". Drivers
+// such as pgx expose it through a SQLState method, which avoids depending on
+// one driver here.
+func sqlState(err error) string {
+	var withState interface{ SQLState() string }
+	if errors.As(err, &withState) {
+		return withState.SQLState()
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+// Package authorize enforces the permissions routes declare in the Go
+// services. It identifies the caller by an authn access token or, on
+// internal requests, by the gateway's headers, and asks the authz service
+// about permissions the token does not carry, caching allow decisions.
+package authorize
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/gofiber/fiber/v2"
+)
+
+// callerKey is the fiber.Ctx Locals key the caller is stored under
+const callerKey = "authorize.caller"
+
+var (
+	errMissingToken         = errors.New("Missing bearer token")
+	errInvalidToken         = errors.New("Invalid or expired token")
+	errInvalidInternalToken = errors.New("Invalid internal token")
+)
+
+// Caller is the user a request is made by
+type Caller struct {
+	UserID string
+	Role   string
+	// Permissions are the access token's permissions claim; nil for
+	// callers identified by gateway headers
+	Permissions []string
+	// ImpersonatorID is the system admin acting as the user in a support
+	// session, from the token's impersonator claim or the
+	// X-Impersonator-Id header
+	ImpersonatorID string
+}
+
+// Authorizer enforces the permission each route declares. Callers are
+// identified by a bearer access token or, on requests carrying a valid
+// X-Internal-Token, by the X-User-Id and X-User-Role headers set by the
+// gateway or calling service. Internal requests without X-User-Id come from
+// another service acting on its own behalf and are let through.
+type Authorizer struct {
+	verifier      *jwtauth.Verifier
+	authz         Client
+	internalToken string
+}
+
+func NewAuthorizer(verifier *jwtauth.Verifier, authzClient Client, internalToken string) *Authorizer {
+	return &Authorizer{
+		verifier:      verifier,
+		authz:         authzClient,
+		internalToken: internalToken,
+	}
+}
+
+// Require allows a request only if the caller holds permission, a
+// "resource.action" name as known to the authz service. A permission in the
+// token's claim is enough; otherwise the authz service decides, and a failed
+// check denies the request.
+func (a *Authorizer) Require(permission string) fiber.Handler {
+	resource, action, ok := strings.Cut(permission, ".")
+	if !ok {
+		panic("authorize: permission " + permission + " is not of the form resource.action")
+	}
+
+	return func(c *fiber.Ctx) error {
+		caller, internal, err := a.identify(c)
+		if errors.Is(err, jwtauth.ErrAcceptanceRequired) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		if caller == nil && internal {
+			return c.Next()
+		}
+		c.Locals(callerKey, caller)
+		if caller.ImpersonatorID != "" && c.Method() != fiber.MethodGet {
+			log.Printf("%s %s by admin %s as user %s (impersonation)", c.Method(), c.Path(), caller.ImpersonatorID, caller.UserID)
+		}
+
+		allowed, err := a.allows(c, caller, permission, resource, action)
+		if err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+		}
+		if !allowed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Next()
+	}
+}
+
+// Allows reports whether the caller of a request Require has let through
+// also holds permission, for handlers whose behaviour depends on more than
+// one permission. Internal requests made without a user hold every
+// permission.
+func (a *Authorizer) Allows(c *fiber.Ctx, permission string) (bool, error) {
+	resource, action, ok := strings.Cut(permission, ".")
+	if !ok {
+		return false, errors.New("permission " + permission + " is not of the form resource.action")
+	}
+	caller := CallerFrom(c)
+	if caller == nil {
+		return true, nil
+	}
+	return a.allows(c, caller, permission, resource, action)
+}
+
+func (a *Authorizer) allows(c *fiber.Ctx, caller *Caller, permission, resource, action string) (bool, error) {
+	if slices.Contains(caller.Permissions, permission) {
+		return true, nil
+	}
+	allowed, err := a.authz.Check(c.UserContext(), caller.UserID, caller.Role, resource, action)
+	if err != nil {
+		log.Printf("Authorization check of %s for user %s failed: %v", permission, caller.UserID, err)
+	}
+	return allowed, err
+}
+
+// identify returns the caller and whether the request carries a valid
+// internal token. The caller is nil for internal requests made without a user.
+func (a *Authorizer) identify(c *fiber.Ctx) (*Caller, bool, error) {
+	if token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer "); ok && token != "" {
+		claims, err := a.verifier.Verify(c.UserContext(), token)
+		if errors.Is(err, jwtauth.ErrAcceptanceRequired) {
+			return nil, false, err
+		}
+		if err != nil {
+			return nil, false, errInvalidToken
+		}
+		return &Caller{
+			UserID:         claims.UserID,
+			Role:           claims.Role,
+			Permissions:    claims.Permissions,
+			ImpersonatorID: claims.Impersonator,
+		}, false, nil
+	}
+
+	internalToken := c.Get("X-Internal-Token")
+	if internalToken == "" {
+		return nil, false, errMissingToken
+	}
+	if subtle.ConstantTimeCompare([]byte(internalToken), []byte(a.internalToken)) != 1 {
+		return nil, false, errInvalidInternalToken
+	}
+	if userID := c.Get("X-User-Id"); userID != "" {
+		return &Caller{UserID: userID, Role: c.Get("X-User-Role"), ImpersonatorID: c.Get(jwtauth.ImpersonatorHeader)}, true, nil
+	}
+	return nil, true, nil
+}
+
+// CallerFrom returns the caller stored by Require, or nil for requests made
+// by another service without a user
+func CallerFrom(c *fiber.Ctx) *Caller {
+	caller, _ := c.Locals(callerKey).(*Caller)
+	return caller
+}
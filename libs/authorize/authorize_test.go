@@ -0,0 +1,130 @@
+package authorize
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testInternalToken = "test-internal-token"
+
+// fakeAuthz is an authz service that allows the permissions in grants,
+// keyed by role, and counts the checks it answers
+type fakeAuthz struct {
+	grants map[string][]string
+	checks atomic.Int64
+}
+
+func (f *fakeAuthz) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/internal/authz/check" || r.Header.Get("X-Internal-Token") != testInternalToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Subject, Role, Resource, Action string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.checks.Add(1)
+	allowed := false
+	for _, permission := range f.grants[req.Role] {
+		allowed = allowed || permission == req.Resource+"."+req.Action
+	}
+	_ = json.NewEncoder(w).Encode(map[string]bool{"allowed": allowed})
+}
+
+// newTestApp serves one route requiring permission, authorized against the
+// authz service at authzURL
+func newTestApp(t *testing.T, authzURL, permission string, ttl time.Duration) *fiber.App {
+	t.Helper()
+	t.Setenv("AUTHZ_SERVICE_URL", authzURL)
+	t.Setenv("INTERNAL_SECRET", testInternalToken)
+	authorizer := NewAuthorizer(nil, NewCachedClient(NewClient(), ttl), testInternalToken)
+
+	app := fiber.New()
+	app.Get("/", authorizer.Require(permission), func(c *fiber.Ctx) error {
+		if caller := CallerFrom(c); caller != nil {
+			return c.SendString(caller.UserID)
+		}
+		return c.SendString("service")
+	})
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, headers map[string]string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func asUser(userID, role string) map[string]string {
+	return map[string]string{"X-Internal-Token": testInternalToken, "X-User-Id": userID, "X-User-Role": role}
+}
+
+func TestRequireAsksAuthz(t *testing.T) {
+	authz := &fakeAuthz{grants: map[string][]string{"instructor": {"submission.grade"}}}
+	server := httptest.NewServer(authz)
+	defer server.Close()
+	app := newTestApp(t, server.URL, "submission.grade", time.Minute)
+
+	// Roles are sent lower-cased, as authz names them
+	if code := get(t, app, asUser("user-1", "INSTRUCTOR")); code != fiber.StatusOK {
+		t.Fatalf("granted role = %d, want 200", code)
+	}
+	if code := get(t, app, asUser("user-2", "STUDENT")); code != fiber.StatusForbidden {
+		t.Fatalf("role without the permission = %d, want 403", code)
+	}
+}
+
+func TestRequireDeniesWhenAuthzUnreachable(t *testing.T) {
+	server := httptest.NewServer(&fakeAuthz{})
+	url := server.URL
+	server.Close()
+	app := newTestApp(t, url, "submission.grade", time.Minute)
+
+	if code := get(t, app, asUser("user-1", "INSTRUCTOR")); code != fiber.StatusServiceUnavailable {
+		t.Fatalf("authz unreachable = %d, want 503", code)
+	}
+}
+
+func TestRequireIdentifiesCaller(t *testing.T) {
+	authz := &fakeAuthz{}
+	server := httptest.NewServer(authz)
+	defer server.Close()
+	app := newTestApp(t, server.URL, "submission.grade", time.Minute)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"no credentials", nil, fiber.StatusUnauthorized},
+		{"wrong internal token", map[string]string{"X-Internal-Token": "guess", "X-User-Id": "user-1"}, fiber.StatusUnauthorized},
+		{"service without a user", map[string]string{"X-Internal-Token": testInternalToken}, fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := get(t, app, tt.headers); code != tt.want {
+				t.Fatalf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+	if n := authz.checks.Load(); n != 0 {
+		t.Fatalf("authz asked %d times, want never", n)
+	}
+}
@@ -0,0 +1,61 @@
+package authorize
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cachedClient remembers allow decisions for ttl so a busy user does not cost
+// an authz round trip per request. Denies and errors are not cached, so a new
+// grant takes effect at once while a revoked one may be honoured for up to ttl.
+type cachedClient struct {
+	Client
+	ttl time.Duration
+
+	mu        sync.Mutex
+	allowed   map[string]time.Time // decision key -> expiry
+	nextSweep time.Time
+}
+
+// NewCachedClient wraps client with a cache of its allow decisions
+func NewCachedClient(client Client, ttl time.Duration) Client {
+	return &cachedClient{
+		Client:  client,
+		ttl:     ttl,
+		allowed: make(map[string]time.Time),
+	}
+}
+
+// Check answers from the cache when an unexpired allow is held for the user,
+// role and permission, and asks the authz service otherwise
+func (c *cachedClient) Check(ctx context.Context, userID, role, resource, action string) (bool, error) {
+	key := userID + "\x00" + role + "\x00" + resource + "." + action
+	now := time.Now()
+
+	c.mu.Lock()
+	expiry, ok := c.allowed[key]
+	c.mu.Unlock()
+	if ok && now.Before(expiry) {
+		return true, nil
+	}
+
+	allowed, err := c.Client.Check(ctx, userID, role, resource, action)
+	if err != nil || !allowed {
+		return allowed, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Drop expired decisions now and then so the map only holds active users
+	if now.After(c.nextSweep) {
+		for k, exp := range c.allowed {
+			if now.After(exp) {
+				delete(c.allowed, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.allowed[key] = now.Add(c.ttl)
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package authorize
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubClient answers every check with allowed and err, counting the calls
+type stubClient struct {
+	allowed atomic.Bool
+	err     error
+	calls   atomic.Int64
+}
+
+func (s *stubClient) Check(ctx context.Context, userID, role, resource, action string) (bool, error) {
+	s.calls.Add(1)
+	return s.allowed.Load(), s.err
+}
+
+func TestCachedClientRemembersAllowsUntilTTL(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	stub := &stubClient{}
+	stub.allowed.Store(true)
+	client := NewCachedClient(stub, ttl)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if allowed, err := client.Check(ctx, "user-1", "instructor", "submission", "grade"); err != nil || !allowed {
+			t.Fatalf("check %d = %v, %v; want allowed", i, allowed, err)
+		}
+	}
+	if n := stub.calls.Load(); n != 1 {
+		t.Fatalf("authz asked %d times, want once", n)
+	}
+
+	// Revoked: still allowed from the cache until the decision expires
+	stub.allowed.Store(false)
+	if allowed, _ := client.Check(ctx, "user-1", "instructor", "submission", "grade"); !allowed {
+		t.Fatal("cached allow was not used")
+	}
+	time.Sleep(ttl + 10*time.Millisecond)
+	if allowed, _ := client.Check(ctx, "user-1", "instructor", "submission", "grade"); allowed {
+		t.Fatal("expired allow was still used")
+	}
+	if n := stub.calls.Load(); n != 2 {
+		t.Fatalf("authz asked %d times, want twice", n)
+	}
+}
+
+func TestCachedClientKeysByUserRoleAndPermission(t *testing.T) {
+	stub := &stubClient{}
+	stub.allowed.Store(true)
+	client := NewCachedClient(stub, time.Minute)
+	ctx := context.Background()
+
+	_, _ = client.Check(ctx, "user-1", "instructor", "submission", "grade")
+	_, _ = client.Check(ctx, "user-2", "instructor", "submission", "grade")
+	_, _ = client.Check(ctx, "user-1", "student", "submission", "grade")
+	_, _ = client.Check(ctx, "user-1", "instructor", "grade", "release")
+	if n := stub.calls.Load(); n != 4 {
+		t.Fatalf("authz asked %d times, want once per decision", n)
+	}
+}
+
+func TestCachedClientDoesNotCacheDeniesOrErrors(t *testing.T) {
+	ctx := context.Background()
+
+	deny := &stubClient{}
+	client := NewCachedClient(deny, time.Minute)
+	_, _ = client.Check(ctx, "user-1", "student", "submission", "grade")
+	_, _ = client.Check(ctx, "user-1", "student", "submission", "grade")
+	if n := deny.calls.Load(); n != 2 {
+		t.Fatalf("deny asked %d times, want every time", n)
+	}
+
+	failing := &stubClient{err: errors.New("authz down")}
+	client = NewCachedClient(failing, time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, err := client.Check(ctx, "user-1", "instructor", "submission", "grade"); err == nil {
+			t.Fatal("error was not returned")
+		}
+	}
+	if n := failing.calls.Load(); n != 2 {
+		t.Fatalf("failing authz asked %d times, want every time", n)
+	}
+}
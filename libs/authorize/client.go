@@ -0,0 +1,81 @@
+package authorize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Client defines the calls a service makes to the authz service
+type Client interface {
+	Check(ctx context.Context, userID, role, resource, action string) (bool, error)
+}
+
+type httpClient struct {
+	baseURL       string
+	internalToken string
+	httpClient    *http.Client
+}
+
+// NewClient creates an authz service client from AUTHZ_SERVICE_URL and
+// INTERNAL_SECRET
+func NewClient() Client {
+	baseURL := os.Getenv("AUTHZ_SERVICE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8004"
+	}
+	token := os.Getenv("INTERNAL_SECRET")
+	if token == "" {
+		token = "insecure-secret-for-dev"
+	}
+	return &httpClient{
+		baseURL:       baseURL,
+		internalToken: token,
+		httpClient:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Check asks whether the user may perform action on resource
+func (c *httpClient) Check(ctx context.Context, userID, role, resource, action string) (bool, error) {
+	// Tokens carry the identity user type (e.g. INSTRUCTOR) while authz role
+	// names are lower case
+	payload, err := json.Marshal(map[string]string{
+		"subject":  userID,
+		"role":     strings.ToLower(role),
+		"resource": resource,
+		"action":   action,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/internal/authz/check", bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", c.internalToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to reach authz service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("authz service returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Allowed bool `json:"allowed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode authz response: %w", err)
+	}
+	return result.Allowed, nil
+}
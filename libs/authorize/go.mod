@@ -0,0 +1,31 @@
+module github.com/4yrg/gradeloop-core/libs/authorize
+
+go 1.25.6
+
+require (
+	github.com/4yrg/gradeloop-core/services/go/authn v0.0.0
+	github.com/gofiber/fiber/v2 v2.52.11
+)
+
+require (
+	github.com/4yrg/gradeloop-core/libs/jwks v0.0.0 // indirect
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/golang-jwt/jwt/v5 v5.3.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/mattn/go-runewidth v0.0.16 // indirect
+	github.com/redis/go-redis/v9 v9.17.3 // indirect
+	github.com/rivo/uniseg v0.2.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.51.0 // indirect
+	github.com/valyala/tcplisten v1.0.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
+
+replace github.com/4yrg/gradeloop-core/services/go/authn => ../../services/go/authn
+
+replace github.com/4yrg/gradeloop-core/libs/jwks => ../jwks
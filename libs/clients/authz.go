@@ -0,0 +1,154 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// AuthZ calls the authz service
+type AuthZ struct {
+	c *Client
+}
+
+func NewAuthZ(cfg Config) *AuthZ {
+	return &AuthZ{c: NewClient("authz", cfg)}
+}
+
+type CheckRequest struct {
+	Subject  string `json:"subject"`
+	Role     string `json:"role"`
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	// Scope is the resource instance being accessed, e.g. "course:<id>"
+	Scope      string             `json:"scope,omitempty"`
+	Institutes []InstituteBinding `json:"institutes,omitempty"`
+}
+
+type ResolveRequest struct {
+	UserID     string             `json:"user_id"`
+	Role       string             `json:"role"`
+	Institutes []InstituteBinding `json:"institutes,omitempty"`
+}
+
+// ResolvedPermission is one permission and where it came from
+type ResolvedPermission struct {
+	Name      string     `json:"name"`
+	Source    string     `json:"source"`
+	Scope     string     `json:"scope,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type ResolvedPermissions struct {
+	Permissions []string             `json:"permissions"`
+	Sources     []ResolvedPermission `json:"sources,omitempty"`
+}
+
+// AuditEvent is recorded in authz's audit log. Context is any JSON value.
+type AuditEvent struct {
+	Subject  string      `json:"subject"`
+	Resource string      `json:"resource"`
+	Action   string      `json:"action"`
+	Decision string      `json:"decision"`
+	Context  interface{} `json:"context,omitempty"`
+}
+
+// Check reports whether the subject may perform the action
+func (a *AuthZ) Check(ctx context.Context, req CheckRequest) (bool, error) {
+	var result struct {
+		Allowed bool `json:"allowed"`
+	}
+	err := a.c.Do(ctx, Request{Method: http.MethodPost, Path: "/internal/authz/check", Body: req, Idempotent: true}, &result)
+	return result.Allowed, err
+}
+
+// MaxBatchChecks is the most checks authz decides in one batch call
+const MaxBatchChecks = 50
+
+// PermissionCheck is one resource and action of a batch check
+type PermissionCheck struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+// CheckBatchRequest asks for several decisions for one subject and role
+type CheckBatchRequest struct {
+	Subject    string             `json:"subject"`
+	Role       string             `json:"role"`
+	Scope      string             `json:"scope,omitempty"`
+	Institutes []InstituteBinding `json:"institutes,omitempty"`
+	Checks     []PermissionCheck  `json:"checks"`
+}
+
+// CheckBatch decides up to MaxBatchChecks checks in one call, returning the
+// decisions in the order of req.Checks
+func (a *AuthZ) CheckBatch(ctx context.Context, req CheckBatchRequest) ([]bool, error) {
+	var result struct {
+		Decisions []struct {
+			Allowed bool `json:"allowed"`
+		} `json:"decisions"`
+	}
+	err := a.c.Do(ctx, Request{Method: http.MethodPost, Path: "/internal/authz/check-batch", Body: req, Idempotent: true}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Decisions) != len(req.Checks) {
+		return nil, fmt.Errorf("authz: %d decisions for %d checks", len(result.Decisions), len(req.Checks))
+	}
+	allowed := make([]bool, len(result.Decisions))
+	for i, d := range result.Decisions {
+		allowed[i] = d.Allowed
+	}
+	return allowed, nil
+}
+
+// CheckAll decides any number of checks, in order. One or two are checked
+// one by one; more go in batch calls of up to MaxBatchChecks.
+func (a *AuthZ) CheckAll(ctx context.Context, req CheckBatchRequest) ([]bool, error) {
+	allowed := make([]bool, 0, len(req.Checks))
+	if len(req.Checks) <= 2 {
+		for _, c := range req.Checks {
+			ok, err := a.Check(ctx, CheckRequest{
+				Subject:    req.Subject,
+				Role:       req.Role,
+				Resource:   c.Resource,
+				Action:     c.Action,
+				Scope:      req.Scope,
+				Institutes: req.Institutes,
+			})
+			if err != nil {
+				return nil, err
+			}
+			allowed = append(allowed, ok)
+		}
+		return allowed, nil
+	}
+
+	checks := req.Checks
+	for len(checks) > 0 {
+		batch := req
+		batch.Checks = checks[:min(MaxBatchChecks, len(checks))]
+		checks = checks[len(batch.Checks):]
+		decisions, err := a.CheckBatch(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		allowed = append(allowed, decisions...)
+	}
+	return allowed, nil
+}
+
+// ResolvePermissions returns every permission the user holds
+func (a *AuthZ) ResolvePermissions(ctx context.Context, req ResolveRequest) (*ResolvedPermissions, error) {
+	var resolved ResolvedPermissions
+	err := a.c.Do(ctx, Request{Method: http.MethodPost, Path: "/internal/authz/resolve", Body: req, Idempotent: true}, &resolved)
+	if err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+func (a *AuthZ) RecordAuditEvent(ctx context.Context, event AuditEvent) error {
+	return a.c.Do(ctx, Request{Method: http.MethodPost, Path: "/internal/authz/audit-logs", Body: event}, nil)
+}
@@ -0,0 +1,78 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckAllBatchesInOrder(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string][]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A check is allowed when its action is even
+		allowed := func(action string) bool { return (len(action) % 2) == 0 }
+		switch r.URL.Path {
+		case "/internal/authz/check":
+			var req CheckRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			calls[r.URL.Path] = append(calls[r.URL.Path], 1)
+			mu.Unlock()
+			_ = json.NewEncoder(w).Encode(map[string]bool{"allowed": allowed(req.Action)})
+		case "/internal/authz/check-batch":
+			var req CheckBatchRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			mu.Lock()
+			calls[r.URL.Path] = append(calls[r.URL.Path], len(req.Checks))
+			mu.Unlock()
+			decisions := []map[string]bool{}
+			for _, c := range req.Checks {
+				decisions = append(decisions, map[string]bool{"allowed": allowed(c.Action)})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"decisions": decisions})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	authz := NewAuthZ(Config{BaseURL: srv.URL})
+
+	for _, tc := range []struct {
+		checks         int
+		single, chunks []int
+	}{
+		{checks: 2, single: []int{1, 1}},
+		{checks: 3, chunks: []int{3}},
+		{checks: 60, chunks: []int{50, 10}},
+	} {
+		calls = map[string][]int{}
+		req := CheckBatchRequest{Subject: "u1", Role: "ta"}
+		for i := 0; i < tc.checks; i++ {
+			req.Checks = append(req.Checks, PermissionCheck{Resource: "course", Action: strings.Repeat("a", i+1)})
+		}
+		allowed, err := authz.CheckAll(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(allowed) != tc.checks {
+			t.Fatalf("%d checks: got %d decisions", tc.checks, len(allowed))
+		}
+		for i, ok := range allowed {
+			if want := (i+1)%2 == 0; ok != want {
+				t.Errorf("%d checks: decision %d = %v, want %v", tc.checks, i, ok, want)
+			}
+		}
+		if got := calls["/internal/authz/check"]; len(got) != len(tc.single) {
+			t.Errorf("%d checks: %d single calls, want %d", tc.checks, len(got), len(tc.single))
+		}
+		if got := calls["/internal/authz/check-batch"]; !reflect.DeepEqual(got, tc.chunks) {
+			t.Errorf("%d checks: batches of %v, want %v", tc.checks, got, tc.chunks)
+		}
+	}
+}
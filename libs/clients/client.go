@@ -0,0 +1,277 @@
+// Package clients holds typed clients for the internal APIs of the Go
+// services. Every client sends the internal token, bounds each call with a
+// timeout, retries where that is safe and reports non-2xx responses as an
+// *Error carrying the downstream status and error envelope.
+//
+//	identity := clients.NewIdentity(clients.Config{
+//	    BaseURL:       "http://identity-service:8001",
+//	    InternalToken: secret,
+//	})
+//	user, err := identity.GetUser(ctx, id)
+//	if clients.StatusCode(err) == http.StatusNotFound { ... }
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// InternalTokenHeader authenticates calls between services
+const InternalTokenHeader = "X-Internal-Token"
+
+// UserIDHeader and ImpersonatorHeader carry the user a call is made for, and
+// the admin impersonating them, so the service called can attribute what it
+// does to them. Set them for a call with WithActor.
+const (
+	UserIDHeader       = "X-User-Id"
+	ImpersonatorHeader = "X-Impersonator-Id"
+)
+
+type actorKey struct{}
+
+type actor struct {
+	userID, impersonatorID string
+}
+
+// WithActor returns a copy of ctx under which calls are made for userID, and
+// for the admin impersonating them if impersonatorID is set. Calls made
+// without one act as the calling service itself.
+func WithActor(ctx context.Context, userID, impersonatorID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{userID: userID, impersonatorID: impersonatorID})
+}
+
+// Defaults for unset Config fields
+const (
+	DefaultTimeout    = 5 * time.Second
+	DefaultMaxRetries = 2
+)
+
+// Doer sends HTTP requests. *http.Client is one; services can pass their own
+// to share a connection pool or watch call outcomes.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Config is what every client needs to reach its service
+type Config struct {
+	// BaseURL is the service's address, e.g. http://identity-service:8001
+	BaseURL       string
+	InternalToken string
+	// Timeout bounds one call, retries included (DefaultTimeout when zero).
+	// A shorter deadline on the call's context wins.
+	Timeout time.Duration
+	// MaxRetries is how often a failed idempotent call is repeated
+	// (DefaultMaxRetries when zero, none when negative)
+	MaxRetries int
+	// HTTPClient sends the requests; a plain *http.Client when nil
+	HTTPClient Doer
+}
+
+// Client sends JSON requests to one service. The typed clients wrap it; it
+// is exported for endpoints they do not cover yet.
+type Client struct {
+	service    string
+	baseURL    string
+	token      string
+	timeout    time.Duration
+	maxRetries int
+	http       Doer
+}
+
+// NewClient returns a client for the named service; the name only appears in
+// errors
+func NewClient(service string, cfg Config) *Client {
+	c := &Client{
+		service:    service,
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		token:      cfg.InternalToken,
+		timeout:    cfg.Timeout,
+		maxRetries: cfg.MaxRetries,
+		http:       cfg.HTTPClient,
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = DefaultMaxRetries
+	} else if c.maxRetries < 0 {
+		c.maxRetries = 0
+	}
+	if c.http == nil {
+		c.http = &http.Client{}
+	}
+	return c
+}
+
+// Request is one call to the service
+type Request struct {
+	Method string
+	Path   string
+	// Body is encoded as JSON; nil sends no body
+	Body interface{}
+	// Idempotent calls may be repeated after a timeout, a dropped connection
+	// or a 502, 503 or 504. GETs always are.
+	Idempotent bool
+}
+
+// Error is a call that got a response outside 2xx. Code and Message come
+// from the response's error envelope, either the shared
+// {"code", "message", "details"} one or a plain {"error": "..."}.
+type Error struct {
+	Service    string
+	Method     string
+	Path       string
+	StatusCode int
+	Code       string
+	Message    string
+	Details    map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("%s %s %s: status %d: %s", e.Service, e.Method, e.Path, e.StatusCode, msg)
+}
+
+// StatusCode returns the status of the response err reports, or 0 if err did
+// not come from a response (e.g. the service could not be reached)
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// Do sends req and decodes a 2xx response body into out, unless out is nil.
+// Other responses return an *Error.
+func (c *Client) Do(ctx context.Context, req Request, out interface{}) error {
+	var payload []byte
+	if req.Body != nil {
+		var err error
+		if payload, err = json.Marshal(req.Body); err != nil {
+			return err
+		}
+	}
+	idempotent := req.Idempotent || req.Method == http.MethodGet
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, payload)
+		if err == nil {
+			err = c.read(resp, req, out)
+		}
+		if err == nil || !c.retryable(err, idempotent, attempt) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff(attempt)):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req Request, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, c.baseURL+req.Path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set(InternalTokenHeader, c.token)
+	if a, ok := ctx.Value(actorKey{}).(actor); ok {
+		httpReq.Header.Set(UserIDHeader, a.userID)
+		if a.impersonatorID != "" {
+			httpReq.Header.Set(ImpersonatorHeader, a.impersonatorID)
+		}
+	}
+	return c.http.Do(httpReq)
+}
+
+func (c *Client) read(resp *http.Response, req Request, out interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return c.responseError(resp, req)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s %s: decoding response: %w", c.service, req.Method, req.Path, err)
+	}
+	return nil
+}
+
+func (c *Client) responseError(resp *http.Response, req Request) *Error {
+	apiErr := &Error{Service: c.service, Method: req.Method, Path: req.Path, StatusCode: resp.StatusCode}
+	var envelope struct {
+		Code    string                 `json:"code"`
+		Message string                 `json:"message"`
+		Details map[string]interface{} `json:"details"`
+		Error   string                 `json:"error"`
+	}
+	if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&envelope) == nil {
+		apiErr.Code = envelope.Code
+		apiErr.Message = envelope.Message
+		apiErr.Details = envelope.Details
+		if apiErr.Message == "" {
+			apiErr.Message = envelope.Error
+		}
+	}
+	return apiErr
+}
+
+// retryable reports whether a failed attempt may be repeated. A call that
+// could not connect never reached the service, so it is retried whatever its
+// method until the timeout; that rides out a service restarting. Anything
+// else is only retried for idempotent calls, at most maxRetries times.
+func (c *Client) retryable(err error, idempotent bool, attempt int) bool {
+	if isDialError(err) {
+		return true
+	}
+	if !idempotent || attempt >= c.maxRetries {
+		return false
+	}
+	switch StatusCode(err) {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case 0:
+		// Transport failures; a cancelled or expired context is final
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return false
+}
+
+// backoff is the wait before the retry following attempt: exponential from
+// 50ms, capped at 1s, with full jitter so callers do not retry in lockstep
+func backoff(attempt int) time.Duration {
+	ceiling := min(50*time.Millisecond<<attempt, time.Second)
+	return time.Duration(rand.Int64N(int64(ceiling)) + 1)
+}
+
+// isDialError reports whether err happened while connecting, before any of
+// the request was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
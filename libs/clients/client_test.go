@@ -0,0 +1,135 @@
+package clients
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closedURL returns the URL of a local port nothing listens on
+func closedURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return "http://" + addr
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	for name, body := range map[string]string{
+		"shared": `{"code":"NOT_FOUND","message":"user not found","details":{"id":"u-1"}}`,
+		"plain":  `{"error":"user not found"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get(InternalTokenHeader) != "secret" {
+					t.Errorf("internal token = %q", r.Header.Get(InternalTokenHeader))
+				}
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, body)
+			}))
+			defer srv.Close()
+
+			_, err := NewIdentity(Config{BaseURL: srv.URL, InternalToken: "secret"}).GetUser(context.Background(), "u-1")
+			if StatusCode(err) != http.StatusNotFound {
+				t.Fatalf("err = %v, want a 404 *Error", err)
+			}
+			if apiErr := err.(*Error); apiErr.Message != "user not found" {
+				t.Errorf("message = %q", apiErr.Message)
+			}
+		})
+	}
+}
+
+func TestOnlyIdempotentCallsAreRetried(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c := NewClient("test", Config{BaseURL: srv.URL, MaxRetries: 2})
+
+	if err := c.Do(context.Background(), Request{Method: http.MethodGet, Path: "/"}, nil); StatusCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("GET = %v, want the 503", err)
+	}
+	if n := calls.Swap(0); n != 3 {
+		t.Errorf("GET sent %d times, want once plus 2 retries", n)
+	}
+
+	if err := c.Do(context.Background(), Request{Method: http.MethodPost, Path: "/"}, nil); err == nil {
+		t.Fatal("POST to an unavailable service succeeded")
+	}
+	if n := calls.Swap(0); n != 1 {
+		t.Errorf("POST sent %d times, want no retries", n)
+	}
+}
+
+func TestCallRetriesUntilServiceIsUp(t *testing.T) {
+	target := closedURL(t)
+	var body string
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	})}
+	defer srv.Close()
+	go func() {
+		// Comes up a few retries into the call, as after a restart
+		time.Sleep(200 * time.Millisecond)
+		l, err := net.Listen("tcp", strings.TrimPrefix(target, "http://"))
+		if err != nil {
+			return
+		}
+		_ = srv.Serve(l)
+	}()
+
+	// Not idempotent, but a call that could not connect never arrived
+	c := NewClient("test", Config{BaseURL: target, Timeout: 3 * time.Second})
+	err := c.Do(context.Background(), Request{Method: http.MethodPost, Path: "/users", Body: map[string]string{"email": "a@example.com"}}, nil)
+	if err != nil {
+		t.Fatalf("call across the restart failed: %v", err)
+	}
+	if body != `{"email":"a@example.com"}` {
+		t.Errorf("body after retries = %q, want it resent in full", body)
+	}
+}
+
+func TestCallsCarryTheActor(t *testing.T) {
+	var user, impersonator atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user.Store(r.Header.Get(UserIDHeader))
+		impersonator.Store(r.Header.Get(ImpersonatorHeader))
+		_, _ = io.WriteString(w, `{"id":"u-1"}`)
+	}))
+	defer srv.Close()
+	identity := NewIdentity(Config{BaseURL: srv.URL, InternalToken: "secret"})
+
+	for _, tc := range []struct {
+		name               string
+		ctx                context.Context
+		user, impersonator string
+	}{
+		{"no actor", context.Background(), "", ""},
+		{"actor", WithActor(context.Background(), "admin-1", ""), "admin-1", ""},
+		{"impersonated", WithActor(context.Background(), "admin-1", "sysadmin-1"), "admin-1", "sysadmin-1"},
+	} {
+		if _, err := identity.GetUser(tc.ctx, "u-1"); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := user.Load(); got != tc.user {
+			t.Errorf("%s: %s = %q, want %q", tc.name, UserIDHeader, got, tc.user)
+		}
+		if got := impersonator.Load(); got != tc.impersonator {
+			t.Errorf("%s: %s = %q, want %q", tc.name, ImpersonatorHeader, got, tc.impersonator)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Email calls the email service
+type Email struct {
+	c *Client
+}
+
+func NewEmail(cfg Config) *Email {
+	return &Email{c: NewClient("email", cfg)}
+}
+
+// Categories of templated mail; only transactional mail ignores unsubscribes
+const (
+	CategoryTransactional = "transactional"
+	CategoryNotification  = "notification"
+	CategoryMarketing     = "marketing"
+)
+
+// TemplateRequest queues a templated email, to Recipient or to each of
+// Recipients
+type TemplateRequest struct {
+	TemplateName string              `json:"template_name"`
+	Recipient    string              `json:"recipient,omitempty"`
+	Recipients   []TemplateRecipient `json:"recipients,omitempty"`
+	Category     string              `json:"category,omitempty"` // transactional when empty
+	// Locale is the recipient's preferred locale and DefaultLocale their
+	// institute's; the template falls back from one to the other, then to en
+	Locale        string `json:"locale,omitempty"`
+	DefaultLocale string `json:"default_locale,omitempty"`
+	// InstituteID brands the email with the institute's logo and footer
+	InstituteID string                 `json:"institute_id,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	// SendAt schedules the email; one less than a minute ahead is sent now
+	SendAt *time.Time `json:"send_at,omitempty"`
+}
+
+// TemplateRecipient is one recipient of a batch; Data is merged over the
+// request's and Locale replaces it when set
+type TemplateRecipient struct {
+	Email  string                 `json:"email"`
+	Locale string                 `json:"locale,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// RecipientResult is whether one recipient of a batch was queued
+type RecipientResult struct {
+	Recipient string `json:"recipient"`
+	Status    string `json:"status"` // queued, scheduled or failed
+	Error     string `json:"error,omitempty"`
+	LogID     uint   `json:"log_id,omitempty"` // set when scheduled
+}
+
+// Send delivers a plain email right away
+func (e *Email) Send(ctx context.Context, to, subject, body string) error {
+	return e.c.Do(ctx, Request{
+		Method: http.MethodPost,
+		Path:   "/internal/email/send",
+		Body:   map[string]string{"to": to, "subject": subject, "body": body},
+	}, nil)
+}
+
+// SendTemplate queues a templated email. For a batch the result of each
+// recipient is returned; a batch nobody could be queued for is an *Error.
+func (e *Email) SendTemplate(ctx context.Context, req TemplateRequest) ([]RecipientResult, error) {
+	var resp struct {
+		Results []RecipientResult `json:"results"`
+	}
+	err := e.c.Do(ctx, Request{Method: http.MethodPost, Path: "/internal/email/send-template", Body: req}, &resp)
+	return resp.Results, err
+}
@@ -0,0 +1,89 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultFlagsTTL is how long Flags reuses an institute's flags when no TTL
+// is given
+const DefaultFlagsTTL = time.Minute
+
+// Flags answers whether a feature flag is on for an institute, asking the
+// identity service at most once per TTL for each institute. A flag changed
+// in identity is therefore seen here within the TTL.
+//
+//	flags := clients.NewFlags(identity, 0)
+//	if flags.IsEnabled(ctx, instituteID, "group_submissions") { ... }
+type Flags struct {
+	identity *Identity
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]flagsEntry // institute ID -> its flags
+}
+
+type flagsEntry struct {
+	features map[string]bool
+	expiry   time.Time
+}
+
+// NewFlags returns a flag cache in front of identity; a ttl of zero or less
+// means DefaultFlagsTTL
+func NewFlags(identity *Identity, ttl time.Duration) *Flags {
+	if ttl <= 0 {
+		ttl = DefaultFlagsTTL
+	}
+	return &Flags{
+		identity: identity,
+		ttl:      ttl,
+		entries:  make(map[string]flagsEntry),
+	}
+}
+
+// Features returns whether each flag is on for the institute. When identity
+// cannot be asked, the flags fetched last are kept for another TTL; the
+// error is only returned if there are none, or the institute is not found.
+func (f *Flags) Features(ctx context.Context, instituteID string) (map[string]bool, error) {
+	now := time.Now()
+
+	f.mu.Lock()
+	entry, ok := f.entries[instituteID]
+	f.mu.Unlock()
+	if ok && now.Before(entry.expiry) {
+		return entry.features, nil
+	}
+
+	features, err := f.identity.GetInstituteFeatures(ctx, instituteID)
+	if StatusCode(err) == http.StatusNotFound {
+		// The institute is gone; its old flags are no use
+		f.mu.Lock()
+		delete(f.entries, instituteID)
+		f.mu.Unlock()
+		return nil, err
+	}
+	if err != nil {
+		if !ok {
+			return nil, err
+		}
+		features = entry.features
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[instituteID] = flagsEntry{features: features, expiry: now.Add(f.ttl)}
+	return features, nil
+}
+
+// IsEnabled reports whether the flag is on for the institute. A flag identity
+// does not know is off, and so is every flag when the institute's flags
+// cannot be had.
+func (f *Flags) IsEnabled(ctx context.Context, instituteID, key string) bool {
+	features, err := f.Features(ctx, instituteID)
+	if err != nil {
+		return false
+	}
+	return features[key]
+}
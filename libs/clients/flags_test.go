@@ -0,0 +1,94 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flagServer serves institute features from identity, or the status set in
+// fail, counting the requests it gets
+type flagServer struct {
+	requests atomic.Int64
+	enabled  atomic.Bool
+	fail     atomic.Int64
+}
+
+func (s *flagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	if status := s.fail.Load(); status != 0 {
+		w.WriteHeader(int(status))
+		return
+	}
+	if s.enabled.Load() {
+		_, _ = w.Write([]byte(`{"group_submissions":true}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"group_submissions":false}`))
+}
+
+func newFlags(t *testing.T, ttl time.Duration) (*Flags, *flagServer) {
+	t.Helper()
+	fake := &flagServer{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return NewFlags(NewIdentity(Config{BaseURL: srv.URL, MaxRetries: -1}), ttl), fake
+}
+
+func TestFlagsCachesPerInstitute(t *testing.T) {
+	ctx := context.Background()
+	flags, fake := newFlags(t, 50*time.Millisecond)
+	fake.enabled.Store(true)
+
+	for range 3 {
+		if !flags.IsEnabled(ctx, "inst-1", "group_submissions") {
+			t.Fatal("flag on in identity reads as off")
+		}
+	}
+	if flags.IsEnabled(ctx, "inst-1", "unknown_flag") {
+		t.Error("flag identity does not know reads as on")
+	}
+	if got := fake.requests.Load(); got != 1 {
+		t.Errorf("identity asked %d times within the TTL, want once", got)
+	}
+
+	flags.IsEnabled(ctx, "inst-2", "group_submissions")
+	if got := fake.requests.Load(); got != 2 {
+		t.Errorf("identity asked %d times for two institutes, want twice", got)
+	}
+
+	fake.enabled.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if flags.IsEnabled(ctx, "inst-1", "group_submissions") {
+		t.Error("flag switched off in identity still on after the TTL")
+	}
+}
+
+func TestFlagsKeepLastFlagsWhenIdentityFails(t *testing.T) {
+	ctx := context.Background()
+	flags, fake := newFlags(t, 10*time.Millisecond)
+	fake.enabled.Store(true)
+	flags.IsEnabled(ctx, "inst-1", "group_submissions")
+
+	fake.fail.Store(http.StatusServiceUnavailable)
+	time.Sleep(20 * time.Millisecond)
+	if !flags.IsEnabled(ctx, "inst-1", "group_submissions") {
+		t.Error("flags fetched before identity failed were dropped")
+	}
+	if flags.IsEnabled(ctx, "inst-2", "group_submissions") {
+		t.Error("flag on for an institute whose flags were never fetched")
+	}
+
+	fake.fail.Store(http.StatusNotFound)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := flags.Features(ctx, "inst-1"); StatusCode(err) != http.StatusNotFound {
+		t.Errorf("deleted institute: err = %v, want 404", err)
+	}
+	fake.fail.Store(http.StatusServiceUnavailable)
+	if flags.IsEnabled(ctx, "inst-1", "group_submissions") {
+		t.Error("flags of a deleted institute came back when identity failed")
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/4yrg/gradeloop-core/libs/clients
+
+go 1.25.6
@@ -0,0 +1,402 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Identity calls the identity service
+type Identity struct {
+	c *Client
+}
+
+func NewIdentity(cfg Config) *Identity {
+	return &Identity{c: NewClient("identity", cfg)}
+}
+
+// User is the part of an identity user other services rely on
+type User struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	FullName      string `json:"name"`
+	UserType      string `json:"role"`
+	Status        string `json:"status"` // pending, active or disabled
+	EmailVerified bool   `json:"email_verified"`
+	Version       int    `json:"version"`
+	// Institutes is set for institute admins
+	Institutes []InstituteBinding `json:"institutes,omitempty"`
+	// StudentProfile is set for students by GetUsers
+	StudentProfile *StudentProfile `json:"student_profile,omitempty"`
+}
+
+// StudentProfile is the part of a student's profile other services use
+type StudentProfile struct {
+	EnrollmentNumber string `json:"EnrollmentNumber"`
+}
+
+// InstituteBinding is an institute admin's role (OWNER or ADMIN) in one institute
+type InstituteBinding struct {
+	InstituteID   string `json:"institute_id"`
+	InstituteName string `json:"institute_name,omitempty"`
+	Role          string `json:"role"`
+}
+
+// CreateUserRequest registers a user, pending until they confirm their email
+type CreateUserRequest struct {
+	Email            string `json:"email"`
+	FullName         string `json:"name"`
+	UserType         string `json:"role"`
+	EnrollmentNumber string `json:"enrollment_number,omitempty"` // required for students
+	InstituteID      string `json:"institute_id,omitempty"`
+}
+
+// LookupUser finds a user by email
+func (i *Identity) LookupUser(ctx context.Context, email string) (*User, error) {
+	var user User
+	err := i.c.Do(ctx, Request{
+		Method:     http.MethodPost,
+		Path:       "/internal/identity/users/lookup",
+		Body:       map[string]string{"email": email},
+		Idempotent: true,
+	}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUsers fetches up to 200 users at once; IDs identity does not know are
+// left out of the result
+func (i *Identity) GetUsers(ctx context.Context, ids []string) ([]User, error) {
+	var users []User
+	err := i.c.Do(ctx, Request{
+		Method:     http.MethodPost,
+		Path:       "/internal/identity/users/batch",
+		Body:       map[string][]string{"ids": ids},
+		Idempotent: true,
+	}, &users)
+	return users, err
+}
+
+func (i *Identity) GetUser(ctx context.Context, id string) (*User, error) {
+	var user User
+	if err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: userPath(id)}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserJSON returns the user exactly as identity serves it, profiles included
+func (i *Identity) GetUserJSON(ctx context.Context, id string) (json.RawMessage, error) {
+	var user json.RawMessage
+	err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: userPath(id)}, &user)
+	return user, err
+}
+
+// GetUserEnrollmentsJSON returns the classes a student is enrolled in
+func (i *Identity) GetUserEnrollmentsJSON(ctx context.Context, id string) (json.RawMessage, error) {
+	var enrollments json.RawMessage
+	err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: userPath(id) + "/enrollments"}, &enrollments)
+	return enrollments, err
+}
+
+// Enrollment places a student in a section of a class
+type Enrollment struct {
+	ClassID   string `json:"class_id"`
+	SectionID string `json:"section_id"`
+}
+
+// GetUserEnrollments returns the classes a student is enrolled in
+func (i *Identity) GetUserEnrollments(ctx context.Context, id string) ([]Enrollment, error) {
+	var enrollments []Enrollment
+	err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: userPath(id) + "/enrollments"}, &enrollments)
+	return enrollments, err
+}
+
+// Class is a class with the term it runs in, nil if it has none, and the
+// instructors of its sections
+type Class struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	Term          *Term    `json:"term"`
+	InstructorIDs []string `json:"instructor_ids"`
+}
+
+// Term is an academic term; its dates are inclusive
+type Term struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	StartsOn time.Time `json:"starts_on"`
+	EndsOn   time.Time `json:"ends_on"`
+}
+
+// GetClasses fetches up to 200 classes at once, deleted ones included; IDs
+// identity does not know are left out of the result
+func (i *Identity) GetClasses(ctx context.Context, ids []string) ([]Class, error) {
+	var classes []Class
+	err := i.c.Do(ctx, Request{
+		Method:     http.MethodPost,
+		Path:       "/internal/identity/classes/batch",
+		Body:       map[string][]string{"ids": ids},
+		Idempotent: true,
+	}, &classes)
+	return classes, err
+}
+
+// TokenContext is the org context of a user that authn puts in access tokens
+type TokenContext struct {
+	InstituteIDs []string `json:"institute_ids"`
+	ClassIDs     []string `json:"class_ids"`
+}
+
+// GetTokenContext returns every institute the user belongs to and the
+// classes they are enrolled in
+func (i *Identity) GetTokenContext(ctx context.Context, id string) (*TokenContext, error) {
+	var tc TokenContext
+	if err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: userPath(id) + "/token-context"}, &tc); err != nil {
+		return nil, err
+	}
+	return &tc, nil
+}
+
+// LoginPolicy is what a user's institutes ask of them before they may log in
+type LoginPolicy struct {
+	// RequireVerifiedEmail is set when they may only log in once their
+	// email is verified
+	RequireVerifiedEmail bool `json:"require_verified_email"`
+}
+
+func (i *Identity) GetLoginPolicy(ctx context.Context, id string) (*LoginPolicy, error) {
+	var policy LoginPolicy
+	if err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: userPath(id) + "/login-policy"}, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Institute is the part of an institute other services rely on
+type Institute struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Timezone is the IANA time zone the institute's members see dates in
+	Timezone string `json:"timezone"`
+}
+
+func (i *Identity) GetInstitute(ctx context.Context, id string) (*Institute, error) {
+	var institute Institute
+	if err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: "/orgs/institutes/" + url.PathEscape(id)}, &institute); err != nil {
+		return nil, err
+	}
+	return &institute, nil
+}
+
+// GetInstituteJSON returns an institute as identity serves it
+func (i *Identity) GetInstituteJSON(ctx context.Context, id string) (json.RawMessage, error) {
+	var institute json.RawMessage
+	err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: "/orgs/institutes/" + url.PathEscape(id)}, &institute)
+	return institute, err
+}
+
+// GetInstituteFeatures returns whether each feature flag is on for the
+// institute, by flag key. Flags wraps it with a cache.
+func (i *Identity) GetInstituteFeatures(ctx context.Context, id string) (map[string]bool, error) {
+	var features map[string]bool
+	path := "/internal/identity/institutes/" + url.PathEscape(id) + "/features"
+	if err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: path}, &features); err != nil {
+		return nil, err
+	}
+	return features, nil
+}
+
+// InstituteBranding is how an institute's pages and emails look. Fields the
+// institute has not set are empty.
+type InstituteBranding struct {
+	InstituteID     string `json:"institute_id"`
+	LogoURL         string `json:"logo_url"`
+	PrimaryColor    string `json:"primary_color"`
+	SecondaryColor  string `json:"secondary_color"`
+	EmailFooterHTML string `json:"email_footer_html"` // sanitized by identity
+	SupportEmail    string `json:"support_email"`
+}
+
+func (i *Identity) GetInstituteBranding(ctx context.Context, id string) (*InstituteBranding, error) {
+	var branding InstituteBranding
+	path := "/internal/identity/institutes/" + url.PathEscape(id) + "/branding"
+	if err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: path}, &branding); err != nil {
+		return nil, err
+	}
+	return &branding, nil
+}
+
+// SelfRegistration is the institute, and its default class if it has one,
+// that a student signing themselves up joins
+type SelfRegistration struct {
+	InstituteID    string `json:"institute_id"`
+	DefaultClassID string `json:"default_class_id,omitempty"`
+}
+
+// ResolveSelfRegistration finds the institute that lets the owner of email
+// self-register. It fails with status 403 when none does.
+func (i *Identity) ResolveSelfRegistration(ctx context.Context, email string) (*SelfRegistration, error) {
+	var reg SelfRegistration
+	err := i.c.Do(ctx, Request{
+		Method:     http.MethodPost,
+		Path:       "/internal/identity/self-registrations/resolve",
+		Body:       map[string]string{"email": email},
+		Idempotent: true,
+	}, &reg)
+	if err != nil {
+		return nil, err
+	}
+	return &reg, nil
+}
+
+func (i *Identity) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	var user User
+	err := i.c.Do(ctx, Request{Method: http.MethodPost, Path: "/internal/identity/users", Body: req}, &user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ConfirmEmail activates a pending user
+func (i *Identity) ConfirmEmail(ctx context.Context, id string) error {
+	return i.c.Do(ctx, Request{
+		Method:     http.MethodPost,
+		Path:       userPath(id) + "/confirm-email",
+		Idempotent: true,
+	}, nil)
+}
+
+// LoginEvent is a successful login, for the user's last login and history
+type LoginEvent struct {
+	LoggedInAt time.Time `json:"logged_in_at"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// RecordLogin reports a login. Identity keeps the latest 50 per user.
+func (i *Identity) RecordLogin(ctx context.Context, id string, event LoginEvent) error {
+	return i.c.Do(ctx, Request{Method: http.MethodPost, Path: userPath(id) + "/login-event", Body: event}, nil)
+}
+
+// PolicyDocument is a current terms of service or privacy policy version,
+// without its text
+type PolicyDocument struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Version     string    `json:"version"`
+	URL         string    `json:"url,omitempty"`
+	EffectiveAt time.Time `json:"effective_at"`
+}
+
+// PolicyStatus lists the current policy documents the user has not accepted
+type PolicyStatus struct {
+	NeedsAcceptance []PolicyDocument `json:"needs_acceptance"`
+}
+
+// PolicyAcceptance is a user accepting policy documents from ClientIP
+type PolicyAcceptance struct {
+	DocumentIDs []string `json:"document_ids"`
+	ClientIP    string   `json:"client_ip,omitempty"`
+}
+
+// GetPolicyStatus returns the current policy documents the user still has to
+// accept
+func (i *Identity) GetPolicyStatus(ctx context.Context, id string) (*PolicyStatus, error) {
+	var status PolicyStatus
+	if err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: userPath(id) + "/policy-status"}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// AcceptPolicies records the user accepting current policy documents and
+// returns what they still have to accept
+func (i *Identity) AcceptPolicies(ctx context.Context, id string, acceptance PolicyAcceptance) (*PolicyStatus, error) {
+	var status PolicyStatus
+	err := i.c.Do(ctx, Request{Method: http.MethodPost, Path: userPath(id) + "/policy-acceptances", Body: acceptance}, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// TwoFactor is a user's TOTP enrollment. Secret is as the caller stored it,
+// encrypted; identity does not read it.
+type TwoFactor struct {
+	Secret            string     `json:"secret"`
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+}
+
+// TwoFactorSetup starts a TOTP enrollment; it is not enforced until enabled
+type TwoFactorSetup struct {
+	Secret             string   `json:"secret"`
+	RecoveryCodeHashes []string `json:"recovery_code_hashes"`
+}
+
+// GetTwoFactor returns the user's TOTP enrollment. A user who has never set
+// one up is a 404.
+func (i *Identity) GetTwoFactor(ctx context.Context, id string) (*TwoFactor, error) {
+	var tf TwoFactor
+	if err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: userPath(id) + "/two-factor"}, &tf); err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// SetUpTwoFactor replaces the user's unconfirmed enrollment. One already
+// enabled is a 409.
+func (i *Identity) SetUpTwoFactor(ctx context.Context, id string, setup TwoFactorSetup) error {
+	return i.c.Do(ctx, Request{Method: http.MethodPut, Path: userPath(id) + "/two-factor", Body: setup, Idempotent: true}, nil)
+}
+
+// EnableTwoFactor confirms the user's enrollment, so logins ask for a code
+func (i *Identity) EnableTwoFactor(ctx context.Context, id string) error {
+	return i.c.Do(ctx, Request{Method: http.MethodPost, Path: userPath(id) + "/two-factor/enable"}, nil)
+}
+
+// DisableTwoFactor removes the user's enrollment and recovery codes
+func (i *Identity) DisableTwoFactor(ctx context.Context, id string) error {
+	return i.c.Do(ctx, Request{Method: http.MethodDelete, Path: userPath(id) + "/two-factor"}, nil)
+}
+
+// UseRecoveryCode spends the user's recovery code with the hash. A code that
+// is unknown or already used is a 404.
+func (i *Identity) UseRecoveryCode(ctx context.Context, id, codeHash string) error {
+	body := map[string]string{"code_hash": codeHash}
+	return i.c.Do(ctx, Request{Method: http.MethodPost, Path: userPath(id) + "/two-factor/recovery-codes/use", Body: body}, nil)
+}
+
+// GetGuardianStudents returns the students the guardian has an active link
+// to. Revoking a link takes effect at once, so callers should not cache it.
+func (i *Identity) GetGuardianStudents(ctx context.Context, guardianID string) ([]User, error) {
+	var students []User
+	path := "/internal/identity/guardians/" + url.PathEscape(guardianID) + "/students"
+	err := i.c.Do(ctx, Request{Method: http.MethodGet, Path: path}, &students)
+	return students, err
+}
+
+// IsGuardianOf reports whether the guardian has an active link to the student
+func (i *Identity) IsGuardianOf(ctx context.Context, guardianID, studentID string) (bool, error) {
+	students, err := i.GetGuardianStudents(ctx, guardianID)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range students {
+		if s.ID == studentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func userPath(id string) string {
+	return "/internal/identity/users/" + url.PathEscape(id)
+}
@@ -0,0 +1,151 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Session calls the session service
+type Session struct {
+	c *Client
+}
+
+func NewSession(cfg Config) *Session {
+	return &Session{c: NewClient("session", cfg)}
+}
+
+type CreateSessionRequest struct {
+	UserID    string `json:"user_id"`
+	UserRole  string `json:"user_role"`
+	UserAgent string `json:"user_agent,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+}
+
+type CreatedSession struct {
+	SessionID    string    `json:"session_id"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	// AccessExpiresAt is the exp to give the access token, per the user's role
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+	// EvictedSessionIDs were revoked to keep the user within the session cap
+	EvictedSessionIDs []string `json:"evicted_session_ids,omitempty"`
+}
+
+// ImpersonationSessionRequest opens a support session for an admin acting
+// as the user
+type ImpersonationSessionRequest struct {
+	CreateSessionRequest
+	ImpersonatorID string `json:"impersonator_id"`
+}
+
+type RefreshedSession struct {
+	SessionID       string    `json:"session_id"`
+	NewRefreshToken string    `json:"new_refresh_token"`
+	UserID          string    `json:"user_id"`
+	UserRole        string    `json:"user_role"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+}
+
+// SessionInfo is a session as the session service lists it
+type SessionInfo struct {
+	ID              string     `json:"id"`
+	UserID          string     `json:"user_id"`
+	UserRole        string     `json:"user_role"`
+	UserAgent       string     `json:"user_agent"`
+	ClientIP        string     `json:"client_ip"`
+	RotationCounter int        `json:"rotation_counter"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	AccessExpiresAt time.Time  `json:"access_expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	IsImpersonated  bool       `json:"is_impersonated"`
+	ImpersonatorID  string     `json:"impersonator_id,omitempty"`
+	// The client of the latest refresh, unset until the first one
+	LastRefreshedAt      *time.Time `json:"last_refreshed_at,omitempty"`
+	LastRefreshIP        string     `json:"last_refresh_ip,omitempty"`
+	LastRefreshUserAgent string     `json:"last_refresh_user_agent,omitempty"`
+}
+
+// CreateSession opens a session. The service answers 409 when the user is at
+// the session cap and older sessions may not be evicted.
+func (s *Session) CreateSession(ctx context.Context, req CreateSessionRequest) (*CreatedSession, error) {
+	var session CreatedSession
+	err := s.c.Do(ctx, Request{Method: http.MethodPost, Path: "/internal/sessions", Body: req}, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CreateImpersonationSession opens a session without a refresh token
+func (s *Session) CreateImpersonationSession(ctx context.Context, req ImpersonationSessionRequest) (*CreatedSession, error) {
+	var session CreatedSession
+	err := s.c.Do(ctx, Request{Method: http.MethodPost, Path: "/internal/sessions/impersonation", Body: req}, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RefreshSession rotates the session's refresh token. The client IP and
+// user agent of the refresh are recorded in the session's refresh history.
+func (s *Session) RefreshSession(ctx context.Context, sessionID, refreshToken, clientIP, userAgent string) (*RefreshedSession, error) {
+	var session RefreshedSession
+	err := s.c.Do(ctx, Request{
+		Method: http.MethodPost,
+		Path:   "/internal/sessions/refresh",
+		Body: map[string]string{
+			"session_id":    sessionID,
+			"refresh_token": refreshToken,
+			"client_ip":     clientIP,
+			"user_agent":    userAgent,
+		},
+	}, &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *Session) GetSession(ctx context.Context, id string) (*SessionInfo, error) {
+	var session SessionInfo
+	if err := s.c.Do(ctx, Request{Method: http.MethodGet, Path: sessionPath(id)}, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionJSON returns the session exactly as the service serves it
+func (s *Session) GetSessionJSON(ctx context.Context, id string) (json.RawMessage, error) {
+	var session json.RawMessage
+	err := s.c.Do(ctx, Request{Method: http.MethodGet, Path: sessionPath(id)}, &session)
+	return session, err
+}
+
+func (s *Session) RevokeSession(ctx context.Context, id string) error {
+	return s.c.Do(ctx, Request{Method: http.MethodPost, Path: sessionPath(id) + "/revoke", Idempotent: true}, nil)
+}
+
+// ListUserSessions returns every session of the user, revoked and expired ones included
+func (s *Session) ListUserSessions(ctx context.Context, userID string) ([]SessionInfo, error) {
+	var sessions []SessionInfo
+	err := s.c.Do(ctx, Request{Method: http.MethodGet, Path: userSessionsPath(userID)}, &sessions)
+	return sessions, err
+}
+
+// RevokeUserSessions revokes the user's sessions, impersonated ones excepted
+func (s *Session) RevokeUserSessions(ctx context.Context, userID string) error {
+	return s.c.Do(ctx, Request{Method: http.MethodPost, Path: userSessionsPath(userID) + "/revoke", Idempotent: true}, nil)
+}
+
+func sessionPath(id string) string {
+	return "/internal/sessions/" + url.PathEscape(id)
+}
+
+func userSessionsPath(userID string) string {
+	return "/internal/users/" + url.PathEscape(userID) + "/sessions"
+}
@@ -0,0 +1,249 @@
+// Package config loads service configuration from environment variables into
+// a struct described by field tags:
+//
+//	type Config struct {
+//		Port        string        `env:"PORT" default:"8002"`
+//		DatabaseURL string        `env:"SESSION_DATABASE_URL,DATABASE_URL" required:"true" secret:"true"`
+//		SessionTTL  time.Duration `env:"SESSION_TTL" default:"168h" min:"0s"`
+//		Workers     int           `env:"WORKERS" default:"5" min:"1"`
+//		Policy      string        `env:"POLICY" default:"reject" oneof:"reject,evict_oldest"`
+//	}
+//
+// env lists the variable names to read, first set wins, so a renamed variable
+// can keep its old name as a fallback. Supported field types are string,
+// bool, int, float64, time.Duration, []string (comma-separated) and nested
+// structs. Every missing or invalid variable is collected and reported in a
+// single *Error, so a misconfigured service fails at startup with the full
+// list rather than on whichever value happens to be used first.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problem is one missing or invalid variable
+type Problem struct {
+	Variable string
+	Message  string
+}
+
+// Error lists every problem found while loading a config
+type Error struct {
+	Problems []Problem
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("invalid configuration (%d problems):", len(e.Problems)))
+	for _, p := range e.Problems {
+		lines = append(lines, fmt.Sprintf("  %s: %s", p.Variable, p.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Problems collects validation failures. Configs that need checks the tags
+// cannot express implement Validator and report them here.
+type Problems struct {
+	list []Problem
+}
+
+// Add records a problem with variable
+func (p *Problems) Add(variable, format string, args ...interface{}) {
+	p.list = append(p.list, Problem{Variable: variable, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns the collected problems as an *Error, or nil if there are none
+func (p *Problems) Err() error {
+	if len(p.list) == 0 {
+		return nil
+	}
+	return &Error{Problems: p.list}
+}
+
+// Validator is implemented by configs with checks beyond the field tags, such
+// as values that depend on each other. Validate runs after every field has
+// been loaded.
+type Validator interface {
+	Validate(p *Problems)
+}
+
+// Load fills the struct cfg points to from the environment, then validates it
+func Load(cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Load needs a pointer to a struct")
+	}
+
+	var problems Problems
+	if err := walk(v.Elem(), func(f field) {
+		loadField(f, &problems)
+	}); err != nil {
+		return err
+	}
+	if validator, ok := cfg.(Validator); ok {
+		validator.Validate(&problems)
+	}
+	return problems.Err()
+}
+
+// field is a tagged struct field together with its value
+type field struct {
+	value reflect.Value
+	tag   reflect.StructTag
+	names []string
+}
+
+func (f field) name() string {
+	return f.names[0]
+}
+
+// lookup returns the first of the field's variables that is set
+func (f field) lookup() (string, string, bool) {
+	for _, name := range f.names {
+		if value, ok := os.LookupEnv(name); ok {
+			return name, value, true
+		}
+	}
+	return f.name(), "", false
+}
+
+// walk calls fn for every field with an env tag, descending into nested structs
+func walk(v reflect.Value, fn func(field)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag, ok := sf.Tag.Lookup("env")
+		if !ok {
+			if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+				if err := walk(v.Field(i), fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		names := make([]string, 0, 1)
+		for _, name := range strings.Split(tag, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("config: field %s has an empty env tag", sf.Name)
+		}
+		fn(field{value: v.Field(i), tag: sf.Tag, names: names})
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func loadField(f field, problems *Problems) {
+	name, raw, set := f.lookup()
+	if !set || raw == "" {
+		if f.tag.Get("required") == "true" {
+			problems.Add(strings.Join(f.names, " or "), "is required")
+			return
+		}
+		def, hasDefault := f.tag.Lookup("default")
+		if !hasDefault {
+			return
+		}
+		raw = def
+	}
+
+	if err := setValue(f.value, raw); err != nil {
+		problems.Add(name, "%v (got %q)", err, raw)
+		return
+	}
+	if msg := checkValue(f, raw); msg != "" {
+		problems.Add(name, "%s (got %q)", msg, raw)
+	}
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return errors.New("must be a duration such as 30s or 15m")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", v.Type())
+		}
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// checkValue applies the min and oneof tags to an already set field
+func checkValue(f field, raw string) string {
+	if min, ok := f.tag.Lookup("min"); ok {
+		bound := reflect.New(f.value.Type()).Elem()
+		if err := setValue(bound, min); err != nil {
+			return fmt.Sprintf("invalid min tag %q", min)
+		}
+		switch f.value.Kind() {
+		case reflect.Int, reflect.Int64:
+			if f.value.Int() < bound.Int() {
+				return "must be at least " + min
+			}
+		case reflect.Float64:
+			if f.value.Float() < bound.Float() {
+				return "must be at least " + min
+			}
+		}
+	}
+	if oneof, ok := f.tag.Lookup("oneof"); ok {
+		allowed := strings.Split(oneof, ",")
+		for _, option := range allowed {
+			if raw == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(allowed, ", ")
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DotEnvFiles returns every .env file from the working directory up to the
+// filesystem root, nearest first. Loading them in that order lets a service's
+// own .env override the one at the repository root.
+func DotEnvFiles() []string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+
+	files := make([]string, 0)
+	for {
+		path := filepath.Join(dir, ".env")
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return files
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// mask replaces every secret value in the dump
+const mask = "********"
+
+// Dump returns one "NAME=value" line per variable of a loaded config, for
+// logging at startup. Fields tagged secret:"true" are masked, as is the
+// password of any URL with credentials.
+func Dump(cfg interface{}) []string {
+	v := reflect.ValueOf(cfg)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	lines := make([]string, 0)
+	_ = walk(v, func(f field) {
+		name, _, _ := f.lookup()
+		lines = append(lines, name+"="+display(f))
+	})
+	return lines
+}
+
+func display(f field) string {
+	var value string
+	if f.value.Kind() == reflect.Slice {
+		items := make([]string, f.value.Len())
+		for i := range items {
+			items[i] = f.value.Index(i).String()
+		}
+		value = strings.Join(items, ",")
+	} else {
+		value = fmt.Sprint(f.value.Interface())
+	}
+
+	if value == "" {
+		return ""
+	}
+	if f.tag.Get("secret") == "true" {
+		return mask
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
@@ -0,0 +1,150 @@
+// Package database opens a service's GORM connection with a bounded pool
+// and slow-query logging, both configured from the environment.
+//
+// Every service connects to the same Postgres server, so each one's pool has
+// to stay well below its max_connections. Variables are read with the
+// service's prefix first and unprefixed as a fallback, so one .env can set a
+// shared default and override it per service:
+//
+//	IDENTITY_DB_MAX_OPEN_CONNS=20
+//	DB_MAX_OPEN_CONNS=10
+package database
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/config"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// PoolConfig bounds a service's connection pool and sets when a query is
+// logged as slow
+type PoolConfig struct {
+	MaxOpenConns       int           // DB_MAX_OPEN_CONNS, default 10
+	MaxIdleConns       int           // DB_MAX_IDLE_CONNS, default 5
+	ConnMaxLifetime    time.Duration // DB_CONN_MAX_LIFETIME, default 30m
+	ConnMaxIdleTime    time.Duration // DB_CONN_MAX_IDLE_TIME, default 5m
+	SlowQueryThreshold time.Duration // DB_SLOW_QUERY_THRESHOLD, default 500ms; 0 disables the log
+}
+
+// DefaultPoolConfig keeps six services at their maximum within Postgres'
+// default limit of 100 connections
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:       10,
+	MaxIdleConns:       5,
+	ConnMaxLifetime:    30 * time.Minute,
+	ConnMaxIdleTime:    5 * time.Minute,
+	SlowQueryThreshold: 500 * time.Millisecond,
+}
+
+// LoadPoolConfig reads the pool settings of the service whose variables
+// start with prefix, e.g. "IDENTITY". Unset variables keep their default.
+func LoadPoolConfig(prefix string) (PoolConfig, error) {
+	cfg := DefaultPoolConfig
+	var problems config.Problems
+	env := envReader{prefix: strings.TrimSuffix(prefix, "_") + "_", problems: &problems}
+
+	env.int("DB_MAX_OPEN_CONNS", &cfg.MaxOpenConns, 1)
+	env.int("DB_MAX_IDLE_CONNS", &cfg.MaxIdleConns, 0)
+	env.duration("DB_CONN_MAX_LIFETIME", &cfg.ConnMaxLifetime)
+	env.duration("DB_CONN_MAX_IDLE_TIME", &cfg.ConnMaxIdleTime)
+	env.duration("DB_SLOW_QUERY_THRESHOLD", &cfg.SlowQueryThreshold)
+
+	if cfg.MaxIdleConns > cfg.MaxOpenConns {
+		problems.Add(env.prefix+"DB_MAX_IDLE_CONNS", "must not be greater than DB_MAX_OPEN_CONNS (%d)", cfg.MaxOpenConns)
+	}
+	return cfg, problems.Err()
+}
+
+// Open connects through dialector with the pool and logger cfg describes
+func Open(dialector gorm.Dialector, cfg PoolConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: NewLogger(cfg.SlowQueryThreshold)})
+	if err != nil {
+		return nil, err
+	}
+	if err := Configure(db, cfg); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Configure applies the pool settings of cfg to an open connection
+func Configure(db *gorm.DB, cfg PoolConfig) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return nil
+}
+
+// NewLogger logs failed queries and, at WARN, queries taking longer than
+// slowThreshold, with their duration and SQL. Parameters are left out of the
+// SQL so user data does not end up in the logs.
+func NewLogger(slowThreshold time.Duration) gormLogger.Interface {
+	return gormLogger.New(
+		log.New(os.Stdout, "\r\n", log.LstdFlags),
+		gormLogger.Config{
+			SlowThreshold:             slowThreshold,
+			LogLevel:                  gormLogger.Warn,
+			IgnoreRecordNotFoundError: true,
+			ParameterizedQueries:      true,
+		},
+	)
+}
+
+// envReader reads prefixed variables, falling back to the unprefixed name
+type envReader struct {
+	prefix   string
+	problems *config.Problems
+}
+
+func (e envReader) lookup(name string) (string, string, bool) {
+	if value, ok := os.LookupEnv(e.prefix + name); ok {
+		return e.prefix + name, value, true
+	}
+	value, ok := os.LookupEnv(name)
+	return name, value, ok
+}
+
+func (e envReader) int(name string, dst *int, min int) {
+	variable, value, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.problems.Add(variable, "must be an integer, got %q", value)
+		return
+	}
+	if n < min {
+		e.problems.Add(variable, "must be at least %d, got %d", min, n)
+		return
+	}
+	*dst = n
+}
+
+func (e envReader) duration(name string, dst *time.Duration) {
+	variable, value, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		e.problems.Add(variable, "must be a duration such as 30s or 5m, got %q", value)
+		return
+	}
+	if d < 0 {
+		e.problems.Add(variable, "must not be negative, got %s", value)
+		return
+	}
+	*dst = d
+}
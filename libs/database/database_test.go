@@ -0,0 +1,64 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/config"
+)
+
+func TestLoadPoolConfig(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "8")
+	t.Setenv("DB_MAX_IDLE_CONNS", "4")
+	t.Setenv("IDENTITY_DB_MAX_OPEN_CONNS", "20")
+	t.Setenv("IDENTITY_DB_SLOW_QUERY_THRESHOLD", "0")
+
+	identity, err := LoadPoolConfig("IDENTITY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultPoolConfig
+	want.MaxOpenConns, want.MaxIdleConns, want.SlowQueryThreshold = 20, 4, 0
+	if identity != want {
+		t.Errorf("identity pool = %+v, want %+v", identity, want)
+	}
+
+	// Without its own variables a service gets the shared ones
+	session, err := LoadPoolConfig("SESSION_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.MaxOpenConns != 8 || session.SlowQueryThreshold != 500*time.Millisecond {
+		t.Errorf("session pool = %+v, want the shared limit and default threshold", session)
+	}
+}
+
+func TestLoadPoolConfigReportsEveryProblem(t *testing.T) {
+	t.Setenv("EMAIL_DB_MAX_OPEN_CONNS", "0")
+	t.Setenv("EMAIL_DB_CONN_MAX_LIFETIME", "forever")
+	t.Setenv("EMAIL_DB_CONN_MAX_IDLE_TIME", "-1m")
+
+	_, err := LoadPoolConfig("EMAIL")
+	var cfgErr *config.Error
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("got %v, want a *config.Error", err)
+	}
+	got := map[string]bool{}
+	for _, p := range cfgErr.Problems {
+		got[p.Variable] = true
+	}
+	for _, variable := range []string{"EMAIL_DB_MAX_OPEN_CONNS", "EMAIL_DB_CONN_MAX_LIFETIME", "EMAIL_DB_CONN_MAX_IDLE_TIME"} {
+		if !got[variable] {
+			t.Errorf("no problem reported for %s in %v", variable, cfgErr.Problems)
+		}
+	}
+
+	t.Setenv("EMAIL_DB_MAX_OPEN_CONNS", "2")
+	t.Setenv("EMAIL_DB_CONN_MAX_LIFETIME", "1h")
+	t.Setenv("EMAIL_DB_CONN_MAX_IDLE_TIME", "1m")
+	t.Setenv("EMAIL_DB_MAX_IDLE_CONNS", "3")
+	if _, err := LoadPoolConfig("EMAIL"); err == nil {
+		t.Error("more idle than open connections was accepted")
+	}
+}
@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Usage describes the arguments Command takes
+const Usage = `usage: migrate <command>
+
+  up          apply every pending migration
+  down [n]    revert the latest n migrations (default 1)
+  down all    revert every migration
+  status      list migrations and when they were applied`
+
+// Command runs the migrate command line of a service's cmd/migrate, writing
+// its report to out
+func Command(ctx context.Context, r *Runner, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", Usage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := r.Up(ctx)
+		for _, mig := range applied {
+			fmt.Fprintf(out, "applied  %d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintf(out, "schema is up to date at version %d\n", r.Latest())
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = 0
+			} else if n, err := strconv.Atoi(args[1]); err == nil && n > 0 {
+				steps = n
+			} else {
+				return fmt.Errorf("down takes a positive number or all, got %q", args[1])
+			}
+		}
+		reverted, err := r.Down(ctx, steps)
+		for _, mig := range reverted {
+			fmt.Fprintf(out, "reverted %d_%s\n", mig.Version, mig.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := r.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.UTC().Format("2006-01-02 15:04:05Z")
+			}
+			if s.Unknown {
+				applied += " (not in this build)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], Usage)
+}
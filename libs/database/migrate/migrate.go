@@ -0,0 +1,349 @@
+// Package migrate applies a service's versioned SQL migrations to Postgres.
+//
+// Migrations are pairs of files named by version, e.g.
+// 0002_add_login_events.up.sql and 0002_add_login_events.down.sql, usually
+// embedded into the service:
+//
+//	//go:embed *.sql
+//	var FS embed.FS
+//
+// Each migration runs in its own transaction together with the row recording
+// it in schema_migrations, so a failed migration leaves nothing behind.
+// Runners hold an advisory lock while they work, so replicas starting at the
+// same time apply every migration once.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// table records the applied migrations
+const table = "schema_migrations"
+
+// lockKey is the advisory lock taken by runners; locks are per database, so
+// services sharing a server do not block each other
+const lockKey = "schema_migrations"
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned change to the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	// Down reverts Up; empty if the migration cannot be reverted
+	Down string
+}
+
+// Load reads the migrations in the top directory of fsys, ordered by version.
+// Every version needs an up file; the down file is optional.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: version must be a positive number", entry.Name())
+		}
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Status is a migration known to the runner or recorded in the database
+type Status struct {
+	Version int
+	Name    string
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time
+	// Unknown is set for applied migrations this build does not have, e.g.
+	// after rolling back to an older release
+	Unknown bool
+}
+
+// Runner applies one service's migrations to its database
+type Runner struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New loads the migrations in fsys for db
+func New(db *sql.DB, fsys fs.FS) (*Runner, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{db: db, migrations: migrations}, nil
+}
+
+// Latest is the version the schema is at once every migration is applied
+func (r *Runner) Latest() int {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+// Status lists every known migration and every applied one, by version
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range r.migrations {
+			status := Status{Version: mig.Version, Name: mig.Name}
+			if a, ok := applied[mig.Version]; ok {
+				status.AppliedAt = &a.at
+				delete(applied, mig.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		for version, a := range applied {
+			statuses = append(statuses, Status{Version: version, Name: a.name, AppliedAt: &a.at, Unknown: true})
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+// Pending returns the known migrations that are not applied yet
+func (r *Runner) Pending(ctx context.Context) ([]Migration, error) {
+	var pending []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		pending, err = r.pending(ctx, conn)
+		return err
+	})
+	return pending, err
+}
+
+// Up applies every pending migration in version order and returns them. It
+// stops at the first that fails; the ones before it stay applied.
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		pending, err := r.pending(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range pending {
+			err := inTx(ctx, conn, mig.Up,
+				"INSERT INTO "+table+" (version, name, applied_at) VALUES ($1, $2, now())", mig.Version, mig.Name)
+			if err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and returns
+// them. steps <= 0 reverts all of them.
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	known := make(map[int]Migration, len(r.migrations))
+	for _, mig := range r.migrations {
+		known[mig.Version] = mig
+	}
+
+	var done []Migration
+	err := r.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+		if steps > 0 && steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		for _, version := range versions {
+			mig, ok := known[version]
+			if !ok {
+				return fmt.Errorf("migration %d_%s is applied but unknown to this build; revert it with the release that added it", version, applied[version].name)
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted", mig.Version, mig.Name)
+			}
+			if err := inTx(ctx, conn, mig.Down, "DELETE FROM "+table+" WHERE version = $1", mig.Version); err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Mode is how a server treats pending migrations at startup
+type Mode string
+
+const (
+	// ModeAuto applies pending migrations before serving
+	ModeAuto Mode = "auto"
+	// ModeOff leaves the schema alone and refuses to start while it is behind,
+	// for deployments that run cmd/migrate as a separate step
+	ModeOff Mode = "off"
+)
+
+// ErrSchemaBehind is returned at startup in ModeOff while migrations are pending
+var ErrSchemaBehind = errors.New("database schema is behind this build")
+
+// Boot brings the schema up to date as mode says, logging through logf
+func (r *Runner) Boot(ctx context.Context, mode Mode, logf func(format string, args ...interface{})) error {
+	switch mode {
+	case ModeAuto:
+		applied, err := r.Up(ctx)
+		for _, mig := range applied {
+			logf("Applied migration %d_%s", mig.Version, mig.Name)
+		}
+		return err
+	case ModeOff:
+		pending, err := r.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%w: %d migrations pending (first %d_%s); run cmd/migrate up or set RUN_MIGRATIONS=auto",
+				ErrSchemaBehind, len(pending), pending[0].Version, pending[0].Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migration mode %q, want auto or off", mode)
+}
+
+func (r *Runner) pending(ctx context.Context, conn *sql.Conn) ([]Migration, error) {
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, mig := range r.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on one connection holding the advisory lock, creating the
+// migrations table first if needed
+func (r *Runner) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", lockKey); err != nil {
+		return err
+	}
+	defer func() {
+		// The lock belongs to the session, so release it before the
+		// connection goes back to the pool
+		if _, unlockErr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", lockKey); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+type appliedMigration struct {
+	name string
+	at   time.Time
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM "+table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.at); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// inTx runs the migration script and then the bookkeeping statement in one
+// transaction. The script is sent without arguments, so it may hold several
+// statements.
+func inTx(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,172 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+)
+
+// SQLite stands in for Postgres: the runner's one connection already
+// serialises the work, so the advisory lock functions do nothing, and now()
+// gives the time in SQLite's text format
+func init() {
+	noop := func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) { return int64(0), nil }
+	gosqlite.MustRegisterScalarFunction("hashtext", 1, noop)
+	gosqlite.MustRegisterScalarFunction("pg_advisory_lock", 1, noop)
+	gosqlite.MustRegisterScalarFunction("pg_advisory_unlock", 1, noop)
+	gosqlite.MustRegisterScalarFunction("now", 0, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format("2006-01-02 15:04:05.999999999-07:00"), nil
+	})
+}
+
+var testMigrations = fstest.MapFS{
+	"0001_users.up.sql":          {Data: []byte("CREATE TABLE users (id integer PRIMARY KEY);")},
+	"0001_users.down.sql":        {Data: []byte("DROP TABLE users;")},
+	"0002_user_names.up.sql":     {Data: []byte("ALTER TABLE users ADD COLUMN name text; CREATE INDEX idx_users_name ON users (name);")},
+	"0002_user_names.down.sql":   {Data: []byte("DROP INDEX idx_users_name; ALTER TABLE users DROP COLUMN name;")},
+	"0010_backfill.up.sql":       {Data: []byte("INSERT INTO users (id, name) VALUES (1, 'ada');")},
+	"README.md":                  {Data: []byte("not a migration")},
+	"0003_ignored/0003_x.up.sql": {Data: []byte("not read")},
+}
+
+func newTestRunner(t *testing.T, fsys fstest.MapFS) (*Runner, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	// The driver only reads back times from columns declared as timestamps,
+	// so the table is made here; the runner then finds it exists
+	if _, err := db.Exec("CREATE TABLE " + table + " (version bigint PRIMARY KEY, name text NOT NULL, applied_at timestamp NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(db, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, db
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, m.Name)
+	}
+	if strings.Join(got, ",") != "users,user_names,backfill" {
+		t.Errorf("loaded %v, want the three migrations by version", got)
+	}
+	if migrations[2].Down != "" {
+		t.Error("migration without a down file got one")
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"no up file": {"0001_users.down.sql": {Data: []byte("DROP TABLE users;")}},
+		"two names":  {"0001_users.up.sql": {Data: []byte("SELECT 1;")}, "0001_people.down.sql": {Data: []byte("SELECT 1;")}},
+		"version 0":  {"0000_users.up.sql": {Data: []byte("SELECT 1;")}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: loaded without an error", name)
+		}
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	r, db := newTestRunner(t, testMigrations)
+	ctx := context.Background()
+
+	applied, err := r.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 || r.Latest() != 10 {
+		t.Fatalf("applied %d migrations up to %d, want 3 up to 10", len(applied), r.Latest())
+	}
+	if again, err := r.Up(ctx); err != nil || len(again) != 0 {
+		t.Fatalf("second up applied %d migrations, %v; want none", len(again), err)
+	}
+
+	// The backfill cannot be reverted, so nothing below it can be either
+	if _, err := r.Down(ctx, 0); err == nil || !strings.Contains(err.Error(), "cannot be reverted") {
+		t.Fatalf("reverting past an irreversible migration = %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM " + table + " WHERE version = 10"); err != nil {
+		t.Fatal(err)
+	}
+
+	reverted, err := r.Down(ctx, 1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("down 1 reverted %v, %v; want version 2", reverted, err)
+	}
+	pending, err := r.Pending(ctx)
+	if err != nil || len(pending) != 2 || pending[0].Version != 2 {
+		t.Fatalf("pending = %v, %v; want versions 2 and 10", pending, err)
+	}
+}
+
+func TestFailedMigrationLeavesNothingBehind(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_users.up.sql":  testMigrations["0001_users.up.sql"],
+		"0002_broken.up.sql": {Data: []byte("CREATE TABLE posts (id integer); INSERT INTO missing VALUES (1);")},
+	}
+	r, db := newTestRunner(t, fsys)
+
+	applied, err := r.Up(context.Background())
+	if err == nil || len(applied) != 1 {
+		t.Fatalf("up = %d applied, %v; want the first applied and the second failed", len(applied), err)
+	}
+	var tables int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'posts'").Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("failed migration left its table behind (%d, %v)", tables, err)
+	}
+	if pending, _ := r.Pending(context.Background()); len(pending) != 1 || pending[0].Version != 2 {
+		t.Errorf("pending = %v, want the failed migration", pending)
+	}
+}
+
+func TestBootOffRefusesWhileBehind(t *testing.T) {
+	r, _ := newTestRunner(t, testMigrations)
+	logf := func(string, ...interface{}) {}
+
+	if err := r.Boot(context.Background(), ModeOff, logf); !errors.Is(err, ErrSchemaBehind) {
+		t.Fatalf("boot off with pending migrations = %v, want ErrSchemaBehind", err)
+	}
+	if err := r.Boot(context.Background(), ModeAuto, logf); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Boot(context.Background(), ModeOff, logf); err != nil {
+		t.Errorf("boot off once up to date = %v", err)
+	}
+}
+
+func TestCommandStatus(t *testing.T) {
+	r, _ := newTestRunner(t, testMigrations)
+	var out bytes.Buffer
+	if err := Command(context.Background(), r, []string{"up"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := Command(context.Background(), r, []string{"down", "0"}, &out); err == nil {
+		t.Error("down 0 was accepted")
+	}
+
+	out.Reset()
+	if err := Command(context.Background(), r, []string{"status"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 4 || strings.Contains(out.String(), "pending") {
+		t.Errorf("status after up =\n%s", out.String())
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PoolStats is a snapshot of a connection pool
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`       // connections waited for
+	WaitDurationMs     int64 `json:"wait_duration_ms"` // total time spent waiting
+	MaxIdleClosed      int64 `json:"max_idle_closed"`  // closed by MaxIdleConns
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+// Stats returns the current state of the pool behind db
+func Stats(db *gorm.DB) (PoolStats, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return PoolStats{}, err
+	}
+	s := sqlDB.Stats()
+	return PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}, nil
+}
+
+// StatsHandler serves Stats as JSON, for mounting at /debug/db. A growing
+// wait_count means the pool is too small for the load.
+func StatsHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		stats, err := Stats(db)
+		if err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(stats)
+	}
+}
+
+// StatsFunc returns Stats of db on each call, or the error reading them, for
+// publishing with expvar
+func StatsFunc(db *gorm.DB) func() any {
+	return func() any {
+		stats, err := Stats(db)
+		if err != nil {
+			return err.Error()
+		}
+		return stats
+	}
+}
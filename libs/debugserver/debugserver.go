@@ -0,0 +1,126 @@
+// Package debugserver serves net/http/pprof profiles and expvar runtime
+// stats on a listener of their own, separate from a service's public port.
+// It is off unless DEBUG_ADDR is set, e.g.
+//
+//	DEBUG_ADDR=127.0.0.1:6060
+//
+// and refuses addresses other than loopback and private ones, so profiles
+// are only reachable from the host or inside the cluster:
+//
+//	go tool pprof http://127.0.0.1:6060/debug/pprof/heap
+package debugserver
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Var is a value published at /debug/vars, computed on every request
+type Var struct {
+	Name  string
+	Value func() any
+}
+
+var (
+	mu   sync.Mutex
+	addr string
+)
+
+// Start listens on DEBUG_ADDR if it is set and does nothing otherwise. An
+// invalid or public address, or one already in use, is an error.
+func Start(vars ...Var) error {
+	a := os.Getenv("DEBUG_ADDR")
+	if a == "" {
+		return nil
+	}
+	ln, err := Listen(a, vars...)
+	if err != nil {
+		return fmt.Errorf("DEBUG_ADDR: %w", err)
+	}
+	log.Printf("Debug server (pprof, expvar) listening on %s", ln.Addr())
+	return nil
+}
+
+// Listen serves the debug endpoints on address until the process exits. The
+// goroutine count is always published next to vars. It can only be called
+// once per process, since expvar names are global.
+func Listen(address string, vars ...Var) (net.Listener, error) {
+	if err := checkInternal(address); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if addr != "" {
+		return nil, fmt.Errorf("debug server already listening on %s", addr)
+	}
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	for _, v := range vars {
+		expvar.Publish(v.Name, expvar.Func(v.Value))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// No write timeout: CPU profiles and traces stream for as long as asked
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Debug server stopped: %v", err)
+		}
+	}()
+
+	addr = ln.Addr().String()
+	return ln, nil
+}
+
+// Addr is where the debug server listens, or empty when it is off, for
+// readiness output
+func Addr() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return addr
+}
+
+// checkInternal accepts localhost and loopback or private IPs. A missing
+// host would listen on every interface, public ones included.
+func checkInternal(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("%q has no host and would listen on every interface", address)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("host %q must be localhost or an IP address", host)
+	}
+	if !ip.IsLoopback() && !ip.IsPrivate() {
+		return fmt.Errorf("%s is not a loopback or private address", address)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package debugserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestStartServesProfilesOnlyWhenEnabled(t *testing.T) {
+	t.Setenv("DEBUG_ADDR", "")
+	if err := Start(); err != nil {
+		t.Fatal(err)
+	}
+	if Addr() != "" {
+		t.Fatalf("debug server listening on %s without DEBUG_ADDR", Addr())
+	}
+
+	t.Setenv("DEBUG_ADDR", "127.0.0.1:0")
+	if err := Start(Var{Name: "db_open_connections", Value: func() any { return 3 }}); err != nil {
+		t.Fatal(err)
+	}
+	if Addr() == "" {
+		t.Fatal("debug server is not listening with DEBUG_ADDR set")
+	}
+
+	resp, err := http.Get("http://" + Addr() + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/debug/pprof/: status %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + Addr() + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var vars map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars["goroutines"] == nil || vars["db_open_connections"] != float64(3) {
+		t.Errorf("/debug/vars lacks the goroutine count or the service's vars: %v", vars)
+	}
+
+	if err := Start(); err == nil {
+		t.Error("a second debug server was started")
+	}
+}
+
+func TestDebugAddressMustBeInternal(t *testing.T) {
+	for address, internal := range map[string]bool{
+		"127.0.0.1:6060": true,
+		"localhost:6060": true,
+		"[::1]:6060":     true,
+		"10.1.2.3:6060":  true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"8.8.8.8:6060":   false,
+		"debug.internal": false,
+	} {
+		if err := checkInternal(address); (err == nil) != internal {
+			t.Errorf("checkInternal(%q) = %v, want internal %v", address, err, internal)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package jwks
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrUnknownKey = errors.New("token signed with unknown key")
+
+// Config configures a Cache. Only URL is required.
+type Config struct {
+	// URL is the key set, e.g. http://authn-service:8003/.well-known/jwks.json
+	URL string
+	// CacheTTL is how long a fetched key set is used before it is refetched
+	CacheTTL time.Duration
+	// MinRefreshInterval limits refetches triggered by unknown key IDs, so
+	// tokens with made-up kids cannot be used to hammer the signer
+	MinRefreshInterval time.Duration
+	HTTPClient         *http.Client
+}
+
+// Cache is a cached copy of a signer's key set
+type Cache struct {
+	cfg Config
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func NewCache(cfg Config) *Cache {
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = 10 * time.Minute
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = 30 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &Cache{cfg: cfg, keys: map[string]*rsa.PublicKey{}}
+}
+
+// Key returns the public key for kid, refetching the key set when it is
+// stale or does not contain kid (the signer may have rotated keys)
+func (c *Cache) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	fresh := time.Since(c.fetchedAt) < c.cfg.CacheTTL
+	c.mu.RUnlock()
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		// Keep serving a stale key rather than failing every request while
+		// the signer is briefly unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (c *Cache) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another request may have refreshed while we waited for the lock
+	if time.Since(c.lastAttempt) < c.cfg.MinRefreshInterval {
+		return nil
+	}
+	c.lastAttempt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Alg != "" && jwk.Alg != Algorithm {
+			continue
+		}
+		pub, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = pub
+	}
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,186 @@
+package jwks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// keyServer serves whichever keys it was last given and counts fetches
+type keyServer struct {
+	*httptest.Server
+	fetches atomic.Int64
+
+	mu   sync.Mutex
+	keys []JWK
+}
+
+func newKeyServer(t *testing.T, keys ...*rsa.PrivateKey) *keyServer {
+	t.Helper()
+	s := &keyServer{}
+	s.publish(keys...)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(JWKS{Keys: s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *keyServer) publish(keys ...*rsa.PrivateKey) {
+	set := []JWK{}
+	for _, key := range keys {
+		set = append(set, PublicJWK(Thumbprint(&key.PublicKey), &key.PublicKey))
+	}
+	s.publishJWKs(set...)
+}
+
+func (s *keyServer) publishJWKs(keys ...JWK) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	key := generateKey(t)
+	kid := Thumbprint(&key.PublicKey)
+	if kid != Thumbprint(&key.PublicKey) || kid == Thumbprint(&generateKey(t).PublicKey) {
+		t.Fatal("thumbprint is not stable per key")
+	}
+	pub, err := PublicJWK(kid, &key.PublicKey).PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(&key.PublicKey) {
+		t.Fatal("decoded key differs from the encoded one")
+	}
+
+	for name, jwk := range map[string]JWK{
+		"not RSA":   {Kty: "EC", Kid: kid, N: "AQAB", E: "AQAB"},
+		"no kid":    {Kty: "RSA", N: "AQAB", E: "AQAB"},
+		"bad n":     {Kty: "RSA", Kid: kid, N: "!", E: "AQAB"},
+		"long e":    {Kty: "RSA", Kid: kid, N: "AQAB", E: "AQIDBAU"},
+		"missing e": {Kty: "RSA", Kid: kid, N: "AQAB"},
+		"missing n": {Kty: "RSA", Kid: kid, E: "AQAB"},
+	} {
+		if _, err := jwk.PublicKey(); !errors.Is(err, ErrInvalidJWK) {
+			t.Errorf("%s: PublicKey() = %v, want ErrInvalidJWK", name, err)
+		}
+	}
+}
+
+func TestCacheFollowsKeyRotation(t *testing.T) {
+	oldKey, newKey := generateKey(t), generateKey(t)
+	oldKid, newKid := Thumbprint(&oldKey.PublicKey), Thumbprint(&newKey.PublicKey)
+	keys := newKeyServer(t, oldKey)
+	c := NewCache(Config{URL: keys.URL, MinRefreshInterval: time.Nanosecond})
+	ctx := context.Background()
+
+	if _, err := c.Key(ctx, oldKid); err != nil {
+		t.Fatalf("key before the rotation = %v", err)
+	}
+	// The signer publishes the new key alongside the old one. The cached
+	// set does not know the new kid yet, so it is refetched.
+	keys.publish(newKey, oldKey)
+	if pub, err := c.Key(ctx, newKid); err != nil || !pub.Equal(&newKey.PublicKey) {
+		t.Fatalf("new key = %v, %v", pub, err)
+	}
+	if _, err := c.Key(ctx, oldKid); err != nil {
+		t.Fatalf("old key during the rotation = %v", err)
+	}
+}
+
+func TestCacheDropsRemovedKeys(t *testing.T) {
+	oldKey, newKey := generateKey(t), generateKey(t)
+	keys := newKeyServer(t, newKey, oldKey)
+	// Every lookup refetches, as one would once CacheTTL has passed
+	c := NewCache(Config{URL: keys.URL, CacheTTL: time.Nanosecond, MinRefreshInterval: time.Nanosecond})
+	ctx := context.Background()
+
+	if _, err := c.Key(ctx, Thumbprint(&oldKey.PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+	keys.publish(newKey)
+	if _, err := c.Key(ctx, Thumbprint(&oldKey.PublicKey)); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("removed key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestCacheSkipsKeysItCannotUse(t *testing.T) {
+	key := generateKey(t)
+	kid := Thumbprint(&key.PublicKey)
+	other := PublicJWK("other", &key.PublicKey)
+	other.Alg = "RS512"
+	broken := PublicJWK("broken", &key.PublicKey)
+	broken.N = ""
+	keys := newKeyServer(t)
+	keys.publishJWKs(other, broken, PublicJWK(kid, &key.PublicKey))
+	c := NewCache(Config{URL: keys.URL, MinRefreshInterval: time.Nanosecond})
+	ctx := context.Background()
+
+	if _, err := c.Key(ctx, kid); err != nil {
+		t.Fatalf("usable key next to unusable ones = %v", err)
+	}
+	for _, kid := range []string{"other", "broken", ""} {
+		if _, err := c.Key(ctx, kid); !errors.Is(err, ErrUnknownKey) {
+			t.Errorf("key %q = %v, want ErrUnknownKey", kid, err)
+		}
+	}
+}
+
+func TestCacheLimitsRefetchesForUnknownKeys(t *testing.T) {
+	key := generateKey(t)
+	keys := newKeyServer(t, key)
+	c := NewCache(Config{URL: keys.URL, MinRefreshInterval: time.Minute})
+	ctx := context.Background()
+
+	if _, err := c.Key(ctx, Thumbprint(&key.PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := c.Key(ctx, "made-up"); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("unknown key = %v, want ErrUnknownKey", err)
+		}
+	}
+	if n := keys.fetches.Load(); n != 1 {
+		t.Fatalf("key set fetched %d times, want once within MinRefreshInterval", n)
+	}
+}
+
+func TestCacheKeepsStaleKeysWhileSignerIsDown(t *testing.T) {
+	key := generateKey(t)
+	kid := Thumbprint(&key.PublicKey)
+	keys := newKeyServer(t, key)
+	c := NewCache(Config{URL: keys.URL, CacheTTL: time.Nanosecond, MinRefreshInterval: time.Nanosecond})
+	ctx := context.Background()
+
+	if _, err := c.Key(ctx, kid); err != nil {
+		t.Fatal(err)
+	}
+	keys.Close()
+	if _, err := c.Key(ctx, kid); err != nil {
+		t.Fatalf("cached key while the key set is unreachable = %v", err)
+	}
+	if _, err := c.Key(ctx, "made-up"); err == nil || errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("unknown key while the key set is unreachable = %v, want the fetch error", err)
+	}
+}
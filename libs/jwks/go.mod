@@ -0,0 +1,3 @@
+module github.com/4yrg/gradeloop-core/libs/jwks
+
+go 1.25.6
@@ -0,0 +1,79 @@
+// Package jwks holds the RSA keys services sign tokens with in JSON Web Key
+// format, as served at GET /.well-known/jwks.json, and the Cache verifiers
+// look them up in. Authn publishes the keys of its access tokens and authz
+// those of its service tokens this way.
+package jwks
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// Algorithm is the only signing algorithm keys are published for
+const Algorithm = "RS256"
+
+var ErrInvalidJWK = errors.New("invalid JWK")
+
+// JWK is a single RSA public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK encodes pub as a signing JWK with the given key ID
+func PublicJWK(kid string, pub *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: Algorithm,
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of pub, which signers
+// use as the key ID so it never has to be configured separately
+func Thumbprint(pub *rsa.PublicKey) string {
+	jwk := PublicJWK("", pub)
+	// Members must be in lexicographic order with no whitespace
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{jwk.E, jwk.Kty, jwk.N})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKey decodes an RSA JWK
+func (k JWK) PublicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" || k.Kid == "" {
+		return nil, ErrInvalidJWK
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, ErrInvalidJWK
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, ErrInvalidJWK
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
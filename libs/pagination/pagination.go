@@ -0,0 +1,116 @@
+// Package pagination implements keyset (cursor) pagination for list
+// endpoints ordered newest first by (created_at, id). Unlike offsets, a
+// cursor keeps its place when rows are inserted between two page requests,
+// so no row is skipped or returned twice.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrInvalidLimit     = errors.New("limit must be a positive integer")
+	ErrInvalidOffset    = errors.New("offset must be a non-negative integer")
+	ErrCursorWithOffset = errors.New("cursor and offset cannot be combined")
+)
+
+// Cursor identifies the last row of a page; the next page starts after it
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// Encode returns the opaque form of the cursor handed to clients
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode parses a cursor produced by Encode
+func Decode(s string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.CreatedAt.IsZero() || c.ID == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Request is a parsed page request. After is set when the client passed a
+// cursor; otherwise Offset applies, which is kept for existing callers.
+type Request struct {
+	Limit  int
+	Offset int
+	After  *Cursor
+}
+
+// Parse reads the cursor, offset and limit query values. An empty limit
+// means defaultLimit and larger limits are capped at maxLimit.
+func Parse(cursor, offset, limit string, defaultLimit, maxLimit int) (Request, error) {
+	req := Request{Limit: defaultLimit}
+
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return Request{}, ErrInvalidLimit
+		}
+		req.Limit = n
+	}
+	if req.Limit > maxLimit {
+		req.Limit = maxLimit
+	}
+
+	if cursor != "" && offset != "" {
+		return Request{}, ErrCursorWithOffset
+	}
+	if cursor != "" {
+		c, err := Decode(cursor)
+		if err != nil {
+			return Request{}, err
+		}
+		req.After = &c
+	}
+	if offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return Request{}, ErrInvalidOffset
+		}
+		req.Offset = n
+	}
+	return req, nil
+}
+
+// Fetch is the number of rows to query: one more than the limit, so the
+// extra row tells whether another page follows
+func (r Request) Fetch() int {
+	return r.Limit + 1
+}
+
+// Page is the response body of a paginated list. NextCursor is null on the
+// last page.
+type Page[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// NewPage builds a page from rows queried with Request.Fetch, dropping the
+// extra row and pointing the cursor at the last row returned
+func NewPage[T any](rows []T, limit int, key func(T) Cursor) Page[T] {
+	if rows == nil {
+		rows = []T{}
+	}
+	if len(rows) <= limit {
+		return Page[T]{Items: rows}
+	}
+	rows = rows[:limit]
+	next := key(rows[limit-1]).Encode()
+	return Page[T]{Items: rows, NextCursor: &next}
+}
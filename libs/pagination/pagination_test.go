@@ -0,0 +1,69 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC), ID: "row-1"}.Encode()
+	tests := []struct {
+		name                  string
+		cursor, offset, limit string
+		want                  Request
+		err                   error
+	}{
+		{"defaults", "", "", "", Request{Limit: 20}, nil},
+		{"limit", "", "", "5", Request{Limit: 5}, nil},
+		{"limit capped", "", "", "500", Request{Limit: 100}, nil},
+		{"offset", "", "40", "", Request{Limit: 20, Offset: 40}, nil},
+		{"zero limit", "", "", "0", Request{}, ErrInvalidLimit},
+		{"negative offset", "", "-1", "", Request{}, ErrInvalidOffset},
+		{"cursor and offset", cursor, "10", "", Request{}, ErrCursorWithOffset},
+		{"garbage cursor", "%%%", "", "", Request{}, ErrInvalidCursor},
+		{"cursor without id", Cursor{CreatedAt: time.Now()}.Encode(), "", "", Request{}, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.cursor, tt.offset, tt.limit, 20, 100)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && (got.Limit != tt.want.Limit || got.Offset != tt.want.Offset || got.After != nil) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	got, err := Parse(cursor, "", "", 20, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.After == nil || got.After.ID != "row-1" || !got.After.CreatedAt.Equal(time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)) {
+		t.Errorf("cursor decoded to %+v", got.After)
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	key := func(n int) Cursor {
+		return Cursor{CreatedAt: time.Unix(int64(n), 0), ID: "row"}
+	}
+
+	page := NewPage([]int{5, 4, 3}, 2, key)
+	if len(page.Items) != 2 || page.NextCursor == nil {
+		t.Fatalf("page = %+v, want two items and a cursor", page)
+	}
+	next, err := Decode(*page.NextCursor)
+	if err != nil || next.CreatedAt.Unix() != 4 {
+		t.Errorf("next cursor = %+v, %v; want the last item returned", next, err)
+	}
+
+	last := NewPage([]int{2, 1}, 2, key)
+	if len(last.Items) != 2 || last.NextCursor != nil {
+		t.Errorf("last page = %+v, want no cursor", last)
+	}
+	if empty := NewPage[int](nil, 2, key); empty.Items == nil {
+		t.Error("empty page has null items")
+	}
+}
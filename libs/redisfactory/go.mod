@@ -0,0 +1,18 @@
+module github.com/4yrg/gradeloop-core/libs/redisfactory
+
+go 1.25.6
+
+require (
+	github.com/4yrg/gradeloop-core/libs/config v0.0.0
+	github.com/alicebob/miniredis/v2 v2.33.0
+	github.com/redis/go-redis/v9 v9.17.3
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
+
+replace github.com/4yrg/gradeloop-core/libs/config => ../config
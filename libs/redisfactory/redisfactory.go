@@ -0,0 +1,206 @@
+// Package redisfactory builds a service's Redis client from the environment,
+// for a single node, a master watched by Sentinel or a Cluster.
+//
+// A single node keeps the variables services have always read:
+//
+//	REDIS_ADDR=redis:6379
+//
+// Sentinel finds the current master, so a failover does not need a restart:
+//
+//	REDIS_MODE=sentinel
+//	REDIS_SENTINEL_MASTER=gradeloop
+//	REDIS_ADDRS=sentinel-1:26379,sentinel-2:26379,sentinel-3:26379
+//
+// A Cluster is reached through any of its nodes:
+//
+//	REDIS_MODE=cluster
+//	REDIS_ADDRS=redis-1:6379,redis-2:6379,redis-3:6379
+//
+// A Cluster stores each key on the node owning its slot, so commands naming
+// several keys fail unless all of them hash to the same slot. Keys used
+// together in such commands share a hash tag; see HashTag.
+package redisfactory
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Modes a client can be built for
+const (
+	ModeSingle   = "single"
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+)
+
+// pingTimeout bounds the ping Connect makes at startup
+const pingTimeout = 5 * time.Second
+
+// Config describes how to reach Redis. It can be nested in a service config
+// loaded with libs/config, or read on its own with LoadConfig.
+type Config struct {
+	Mode string `env:"REDIS_MODE" default:"single" oneof:"single,sentinel,cluster"`
+	// The node in single mode
+	Addr string `env:"REDIS_ADDR" default:"localhost:6379"`
+	// The sentinels in sentinel mode, the seed nodes in cluster mode
+	Addrs []string `env:"REDIS_ADDRS"`
+	// The master the sentinels watch
+	MasterName string `env:"REDIS_SENTINEL_MASTER"`
+
+	Username string `env:"REDIS_USERNAME" default:"default"`
+	Password string `env:"REDIS_PASSWORD" secret:"true"`
+	// Only a single node or a Sentinel master has databases; a Cluster only has 0
+	DB int `env:"REDIS_DB" default:"0" min:"0"`
+
+	// Credentials of the sentinels themselves, if they differ from the master's
+	SentinelUsername string `env:"REDIS_SENTINEL_USERNAME"`
+	SentinelPassword string `env:"REDIS_SENTINEL_PASSWORD" secret:"true"`
+
+	TLS bool `env:"REDIS_TLS" default:"false"`
+	// PEM file of the CA that signed the server certificates; the system
+	// pool is used when empty
+	TLSCAFile     string `env:"REDIS_TLS_CA_FILE"`
+	TLSServerName string `env:"REDIS_TLS_SERVER_NAME"`
+	// For development only: accepts any server certificate
+	TLSInsecureSkipVerify bool `env:"REDIS_TLS_INSECURE_SKIP_VERIFY" default:"false"`
+}
+
+// LoadConfig reads the Redis variables, reporting every missing or invalid
+// one at once
+func LoadConfig() (Config, error) {
+	var cfg Config
+	err := config.Load(&cfg)
+	return cfg, err
+}
+
+// Validate reports settings the mode needs but that are missing, or that it
+// cannot use
+func (c *Config) Validate(p *config.Problems) {
+	switch c.Mode {
+	case ModeSentinel:
+		if c.MasterName == "" {
+			p.Add("REDIS_SENTINEL_MASTER", "is required when REDIS_MODE is sentinel")
+		}
+		if len(c.Addrs) == 0 {
+			p.Add("REDIS_ADDRS", "must list the sentinels when REDIS_MODE is sentinel")
+		}
+	case ModeCluster:
+		if len(c.Addrs) == 0 {
+			p.Add("REDIS_ADDRS", "must list at least one node when REDIS_MODE is cluster")
+		}
+		if c.DB != 0 {
+			p.Add("REDIS_DB", "must be 0 when REDIS_MODE is cluster")
+		}
+	}
+	if c.TLSCAFile != "" && !c.TLS {
+		p.Add("REDIS_TLS_CA_FILE", "is only used when REDIS_TLS is true")
+	}
+}
+
+// New builds the client cfg describes without connecting. Callers use it the
+// same way whatever the mode: a *redis.Client for a single node or a Sentinel
+// master, a *redis.ClusterClient for a Cluster.
+func New(cfg Config) (redis.UniversalClient, error) {
+	var problems config.Problems
+	if cfg.Mode == "" {
+		cfg.Mode = ModeSingle
+	}
+	cfg.Validate(&problems)
+	if err := problems.Err(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every mode honours the caller's context deadline, so a slow Redis
+	// cannot hold a request past it
+	switch cfg.Mode {
+	case ModeSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:                  cfg.Addr,
+			Username:              cfg.Username,
+			Password:              cfg.Password,
+			DB:                    cfg.DB,
+			TLSConfig:             tlsConfig,
+			ContextTimeoutEnabled: true,
+		}), nil
+	case ModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:            cfg.MasterName,
+			SentinelAddrs:         cfg.Addrs,
+			SentinelUsername:      cfg.SentinelUsername,
+			SentinelPassword:      cfg.SentinelPassword,
+			Username:              cfg.Username,
+			Password:              cfg.Password,
+			DB:                    cfg.DB,
+			TLSConfig:             tlsConfig,
+			ContextTimeoutEnabled: true,
+		}), nil
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:                 cfg.Addrs,
+			Username:              cfg.Username,
+			Password:              cfg.Password,
+			TLSConfig:             tlsConfig,
+			ContextTimeoutEnabled: true,
+		}), nil
+	}
+	return nil, fmt.Errorf("redisfactory: unknown mode %q", cfg.Mode)
+}
+
+// Connect builds the client and pings it, so a service that cannot reach
+// Redis fails at startup rather than on its first request
+func Connect(ctx context.Context, cfg Config) (redis.UniversalClient, error) {
+	client, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("redisfactory: ping: %w", err)
+	}
+	return client, nil
+}
+
+// HashTag wraps s in braces. A Cluster hashes only the part of a key inside
+// the first braces, so keys built around the same tag share a slot and can
+// be used together in one command or transaction.
+func HashTag(s string) string {
+	return "{" + s + "}"
+}
+
+func (c Config) tlsConfig() (*tls.Config, error) {
+	if !c.TLS {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("redisfactory: reading REDIS_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("redisfactory: REDIS_TLS_CA_FILE contains no PEM certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
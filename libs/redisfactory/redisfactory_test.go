@@ -0,0 +1,74 @@
+package redisfactory
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoadConfigReportsMissingSentinelSettings(t *testing.T) {
+	t.Setenv("REDIS_MODE", "sentinel")
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("sentinel mode without a master or sentinels loaded")
+	}
+	for _, name := range []string{"REDIS_SENTINEL_MASTER", "REDIS_ADDRS"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %s", err, name)
+		}
+	}
+}
+
+func TestNewBuildsClientForMode(t *testing.T) {
+	for _, tc := range []struct {
+		cfg     Config
+		cluster bool
+	}{
+		{Config{Addr: "localhost:6379"}, false},
+		{Config{Mode: ModeSentinel, MasterName: "gradeloop", Addrs: []string{"sentinel-1:26379"}}, false},
+		{Config{Mode: ModeCluster, Addrs: []string{"redis-1:6379", "redis-2:6379"}}, true},
+	} {
+		client, err := New(tc.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.cfg.Mode, err)
+		}
+		_, isCluster := client.(*redis.ClusterClient)
+		if isCluster != tc.cluster {
+			t.Errorf("%s: built %T", tc.cfg.Mode, client)
+		}
+		_ = client.Close()
+	}
+
+	if _, err := New(Config{Mode: ModeCluster, Addrs: []string{"redis-1:6379"}, DB: 2}); err == nil || !strings.Contains(err.Error(), "REDIS_DB") {
+		t.Errorf("cluster with a database: err = %v, want REDIS_DB reported", err)
+	}
+	if _, err := New(Config{TLS: true, TLSCAFile: "/does/not/exist.pem"}); err == nil {
+		t.Error("missing CA file accepted")
+	}
+}
+
+func TestConnectPings(t *testing.T) {
+	server := miniredis.RunT(t)
+	addr := server.Addr()
+
+	client, err := Connect(context.Background(), Config{Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Set(context.Background(), HashTag("user-1")+":sessions", "1", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !server.Exists("{user-1}:sessions") {
+		t.Error("key was not written through the client")
+	}
+
+	server.Close()
+	if _, err := Connect(context.Background(), Config{Addr: addr}); err == nil {
+		t.Error("Connect succeeded with Redis down")
+	}
+}
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+var validate = newValidator()
+
+// newValidator names fields by their JSON names, so errors point at what
+// the client sent
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	})
+	return v
+}
+
+// Bind wraps a handler that takes a typed request body. The body is decoded
+// into a new T and checked against its validate tags before next runs: one
+// that does not decode is a 400, one that fails validation a 422 listing
+// each offending field.
+func Bind[T any](next func(c *fiber.Ctx, req *T) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := new(T)
+		if err := c.BodyParser(req); err != nil {
+			return apierror.BadRequest("invalid JSON body")
+		}
+		if err := Validate(req); err != nil {
+			return err
+		}
+		return next(c, req)
+	}
+}
+
+// Validate checks a struct against its validate tags, returning an
+// apierror validation error naming every field that fails
+func Validate(v any) error {
+	err := validate.Struct(v)
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	root := reflect.TypeOf(v)
+	fields := make([]apierror.FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		fields = append(fields, apierror.FieldError{Field: fieldPath(root, fe), Message: message(fe)})
+	}
+	return apierror.Validation(fields...)
+}
+
+// fieldPath is the field's path below the request, e.g. admins[0].email.
+// Embedded structs add nothing to it, as their fields are decoded as if
+// they were the outer struct's own.
+func fieldPath(root reflect.Type, fe validator.FieldError) string {
+	names := strings.Split(fe.Namespace(), ".")
+	goNames := strings.Split(fe.StructNamespace(), ".")
+	path := make([]string, 0, len(names))
+	t := root
+	for i := 1; i < len(goNames) && i < len(names); i++ {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			goName, _, _ := strings.Cut(goNames[i], "[")
+			if f, ok := t.FieldByName(goName); ok {
+				t = f.Type
+				if f.Anonymous {
+					continue
+				}
+			}
+		}
+		path = append(path, names[i])
+	}
+	return strings.Join(path, ".")
+}
+
+// message words a failed tag the way the services word their own checks
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_without", "required_with":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit(fe))
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit(fe))
+	case "len":
+		return fmt.Sprintf("must be exactly %s%s", fe.Param(), unit(fe))
+	}
+	return "is invalid"
+}
+
+// unit is what a length bound counts, nothing for numbers
+func unit(fe validator.FieldError) string {
+	var unit string
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " character"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " item"
+	default:
+		return ""
+	}
+	if fe.Param() != "1" {
+		unit += "s"
+	}
+	return unit
+}
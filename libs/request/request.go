@@ -0,0 +1,27 @@
+// Package request guards what Fiber handlers read from request bodies: how
+// large a body may be, and binding and validating it into a typed struct
+// before the handler runs.
+package request
+
+import (
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultBodyLimit is the largest body a JSON API takes, for
+// fiber.Config.BodyLimit. Fiber answers larger ones with 413 before any
+// handler runs, so they are never buffered.
+const DefaultBodyLimit = 1 << 20
+
+// Limit rejects requests whose body is over max bytes with 413. A server
+// whose upload routes take more than DefaultBodyLimit has to raise its
+// BodyLimit to the largest of them, and puts Limit(DefaultBodyLimit) on
+// every other route.
+func Limit(max int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Request().Header.ContentLength() > max || len(c.Request().Body()) > max {
+			return apierror.PayloadTooLarge(max)
+		}
+		return c.Next()
+	}
+}
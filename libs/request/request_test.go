@@ -0,0 +1,90 @@
+package request
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/gofiber/fiber/v2"
+)
+
+type audit struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type addAdmins struct {
+	audit
+	InstituteID string `json:"institute_id" validate:"required,uuid"`
+	Admins      []struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"omitempty,oneof=OWNER ADMIN"`
+	} `json:"admins" validate:"min=1,dive"`
+}
+
+// newApp serves POST / through Bind, echoing the bound request
+func newApp(limit int) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler})
+	app.Post("/", Limit(limit), Bind(func(c *fiber.Ctx, req *addAdmins) error {
+		return c.JSON(req)
+	}))
+	return app
+}
+
+func post(t *testing.T, app *fiber.App, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestBindValidatesBody(t *testing.T) {
+	app := newApp(DefaultBodyLimit)
+
+	status, _ := post(t, app, `{"reason":"onboarding","institute_id":"3f2504e0-4f89-11d3-9a0c-0305e82c3301","admins":[{"email":"a@uni.example.edu","role":"OWNER"}]}`)
+	if status != fiber.StatusOK {
+		t.Errorf("valid body = %d, want 200", status)
+	}
+
+	if status, _ := post(t, app, `{"admins":`); status != fiber.StatusBadRequest {
+		t.Errorf("malformed body = %d, want 400", status)
+	}
+
+	status, body := post(t, app, `{"institute_id":"nope","admins":[{"email":"a@uni.example.edu"},{"email":"not-an-email","role":"ROOT"}]}`)
+	if status != fiber.StatusUnprocessableEntity {
+		t.Fatalf("invalid body = %d, want 422", status)
+	}
+	details, _ := body["details"].(map[string]interface{})
+	fields, _ := details["fields"].([]interface{})
+	got := map[string]string{}
+	for _, f := range fields {
+		field := f.(map[string]interface{})
+		got[field["field"].(string)] = field["message"].(string)
+	}
+	want := map[string]string{
+		"reason":          "is required",
+		"institute_id":    "must be a valid UUID",
+		"admins[1].email": "must be a valid email address",
+		"admins[1].role":  "must be one of OWNER, ADMIN",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("field errors = %v, want %v", got, want)
+	}
+}
+
+func TestLimitRejectsLargeBodies(t *testing.T) {
+	app := newApp(64)
+
+	status, body := post(t, app, `{"reason":"`+strings.Repeat("x", 100)+`"}`)
+	if status != fiber.StatusRequestEntityTooLarge || body["code"] != string(apierror.CodePayloadTooLarge) {
+		t.Errorf("oversized body = %d %v, want 413 payload_too_large", status, body)
+	}
+}
@@ -0,0 +1,47 @@
+package servicetoken
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClaimsKey is the fiber.Ctx Locals key the verified claims are stored under
+const ClaimsKey = "servicetoken.claims"
+
+// Middleware rejects requests without a valid bearer service token and
+// stores the token's claims in c.Locals(ClaimsKey)
+func Middleware(v *Verifier) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing service token"})
+		}
+
+		claims, err := v.Verify(c.UserContext(), token)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired service token"})
+		}
+
+		c.Locals(ClaimsKey, claims)
+		return c.Next()
+	}
+}
+
+// RequirePermission rejects requests whose service token, verified by
+// Middleware, does not carry the named permission
+func RequirePermission(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := ClaimsFrom(c)
+		if claims == nil || !claims.HasPermission(name) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Service token lacks permission " + name})
+		}
+		return c.Next()
+	}
+}
+
+// ClaimsFrom returns the claims stored by Middleware, or nil
+func ClaimsFrom(c *fiber.Ctx) *Claims {
+	claims, _ := c.Locals(ClaimsKey).(*Claims)
+	return claims
+}
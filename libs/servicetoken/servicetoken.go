@@ -0,0 +1,67 @@
+// Package servicetoken issues and verifies the tokens services use to call
+// each other. Authz signs them (RS256) for a service account, with the
+// permissions the account is allowed, and publishes its public keys at
+// GET /.well-known/jwks.json; receiving services verify them locally with a
+// Verifier. Tokens are short-lived and cannot be revoked one by one: a
+// service re-issues its token before it expires, and disabling the account
+// at authz stops that.
+package servicetoken
+
+import (
+	"crypto/rsa"
+	"slices"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/libs/jwks"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithm is the only signing algorithm service tokens use
+const Algorithm = jwks.Algorithm
+
+// Issuer and Audience are the values authz puts in every service token.
+// The audience differs from that of user access tokens, so neither kind of
+// token is accepted in place of the other.
+const (
+	Issuer   = "authz-service"
+	Audience = "gradeloop-internal"
+)
+
+// SubjectPrefix comes before the service account name in the sub claim
+const SubjectPrefix = "service:"
+
+var ErrInvalidJWK = jwks.ErrInvalidJWK
+
+// Claims are the claims of a service token
+type Claims struct {
+	// Permissions are the names of the permissions the calling service holds
+	Permissions []string `json:"permissions"`
+	jwt.RegisteredClaims
+}
+
+// Service returns the name of the service account the token was issued to
+func (c *Claims) Service() string {
+	return strings.TrimPrefix(c.Subject, SubjectPrefix)
+}
+
+// HasPermission reports whether the token carries the named permission
+func (c *Claims) HasPermission(name string) bool {
+	return slices.Contains(c.Permissions, name)
+}
+
+// JWK is a single RSA public key in JSON Web Key format
+type JWK = jwks.JWK
+
+// JWKS is the document authz serves at /.well-known/jwks.json
+type JWKS = jwks.JWKS
+
+// PublicJWK encodes pub as a signing JWK with the given key ID
+func PublicJWK(kid string, pub *rsa.PublicKey) JWK {
+	return jwks.PublicJWK(kid, pub)
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of pub, used as the
+// key ID
+func Thumbprint(pub *rsa.PublicKey) string {
+	return jwks.Thumbprint(pub)
+}
@@ -0,0 +1,79 @@
+package servicetoken
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/jwks"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKey = jwks.ErrUnknownKey
+	// ErrNotServiceToken is returned by Verify for a token whose subject is
+	// not a service account
+	ErrNotServiceToken = errors.New("not a service token")
+)
+
+// Config configures a Verifier. Only JWKSURL is required.
+type Config struct {
+	// JWKSURL is the authz key set, e.g. http://authz-service:8004/.well-known/jwks.json
+	JWKSURL string
+	// CacheTTL is how long a fetched key set is used before it is refetched
+	CacheTTL time.Duration
+	// MinRefreshInterval limits refetches triggered by unknown key IDs, so
+	// tokens with made-up kids cannot be used to hammer authz
+	MinRefreshInterval time.Duration
+	HTTPClient         *http.Client
+}
+
+// Verifier validates service tokens against a cached copy of the authz JWKS
+type Verifier struct {
+	keys *jwks.Cache
+}
+
+func NewVerifier(cfg Config) *Verifier {
+	return &Verifier{keys: jwks.NewCache(jwks.Config{
+		URL:                cfg.JWKSURL,
+		CacheTTL:           cfg.CacheTTL,
+		MinRefreshInterval: cfg.MinRefreshInterval,
+		HTTPClient:         cfg.HTTPClient,
+	})}
+}
+
+// Verify checks the token's signature, expiry, issuer, audience and subject
+// and returns its claims
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	return parse(tokenString, func(kid string) (*rsa.PublicKey, error) {
+		return v.keys.Key(ctx, kid)
+	})
+}
+
+// parse verifies a service token against the public key key returns for
+// its kid
+func parse(tokenString string, key func(kid string) (*rsa.PublicKey, error)) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrUnknownKey
+		}
+		return key(kid)
+	},
+		jwt.WithValidMethods([]string{Algorithm}),
+		jwt.WithIssuer(Issuer),
+		jwt.WithAudience(Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(claims.Subject, SubjectPrefix) || claims.Service() == "" {
+		return nil, ErrNotServiceToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,247 @@
+// Package storage keeps files in a Supabase Storage bucket, for services that
+// store uploads:
+//
+//	files, err := storage.NewSupabase(storage.ConfigFromEnv())
+//	err = files.UploadFileWithType(ctx, "logos/acme.png", "image/png", content)
+//	url := files.GetFileURL("logos/acme.png")
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Client stores files by path within one bucket
+type Client interface {
+	// UploadFile stores content at path as application/octet-stream
+	UploadFile(ctx context.Context, path string, content []byte) error
+	// UploadFileWithType stores content at path, to be served as contentType
+	UploadFileWithType(ctx context.Context, path, contentType string, content []byte) error
+	// UploadStream stores what body yields at path, to be served as
+	// contentType, without holding it all in memory
+	UploadStream(ctx context.Context, path, contentType string, body io.Reader) error
+	DownloadFile(ctx context.Context, path string) (io.ReadCloser, error)
+	MoveFile(ctx context.Context, from, to string) error
+	// GetFileURL returns the public URL of the file at path
+	GetFileURL(path string) string
+	// SignedURL returns a URL the file at path can be downloaded from, public
+	// or not, until expiresIn has passed
+	SignedURL(ctx context.Context, path string, expiresIn time.Duration) (string, error)
+	DeleteFile(ctx context.Context, path string) error
+}
+
+// Config names the Supabase project and bucket files go to
+type Config struct {
+	URL        string
+	ServiceKey string
+	Bucket     string
+}
+
+// ConfigFromEnv reads SUPABASE_URL, SUPABASE_SERVICE_KEY and
+// SUPABASE_STORAGE_BUCKET
+func ConfigFromEnv() Config {
+	return Config{
+		URL:        os.Getenv("SUPABASE_URL"),
+		ServiceKey: os.Getenv("SUPABASE_SERVICE_KEY"),
+		Bucket:     os.Getenv("SUPABASE_STORAGE_BUCKET"),
+	}
+}
+
+// Configured reports whether every setting is present
+func (c Config) Configured() bool {
+	return c.URL != "" && c.ServiceKey != "" && c.Bucket != ""
+}
+
+// Supabase is a Client backed by the Supabase Storage API
+type Supabase struct {
+	url        string
+	serviceKey string
+	bucket     string
+	httpClient *http.Client
+}
+
+// NewSupabase creates a new Supabase storage client
+func NewSupabase(cfg Config) (*Supabase, error) {
+	if !cfg.Configured() {
+		return nil, fmt.Errorf("missing Supabase configuration: SUPABASE_URL, SUPABASE_SERVICE_KEY, or SUPABASE_STORAGE_BUCKET")
+	}
+
+	return &Supabase{
+		url:        cfg.URL,
+		serviceKey: cfg.ServiceKey,
+		bucket:     cfg.Bucket,
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// UploadFile uploads a file to Supabase storage at path
+func (s *Supabase) UploadFile(ctx context.Context, path string, content []byte) error {
+	return s.UploadFileWithType(ctx, path, "application/octet-stream", content)
+}
+
+// UploadFileWithType uploads a file that is served with contentType
+func (s *Supabase) UploadFileWithType(ctx context.Context, path, contentType string, content []byte) error {
+	return s.UploadStream(ctx, path, contentType, bytes.NewReader(content))
+}
+
+// UploadStream uploads a file served with contentType as body yields it.
+// Unless body is a bytes.Reader or similar whose length is known, it is
+// sent chunked.
+func (s *Supabase) UploadStream(ctx context.Context, path, contentType string, body io.Reader) error {
+	// Supabase Storage API endpoint
+	uploadURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.url, s.bucket, path)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// DownloadFile reads a file through the authenticated endpoint, so it works
+// for files that are not public yet. The caller closes the body.
+func (s *Supabase) DownloadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	downloadURL := fmt.Sprintf("%s/storage/v1/object/authenticated/%s/%s", s.url, s.bucket, path)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return resp.Body, nil
+}
+
+// MoveFile moves a file within the bucket
+func (s *Supabase) MoveFile(ctx context.Context, from, to string) error {
+	moveURL := fmt.Sprintf("%s/storage/v1/object/move", s.url)
+	payload, err := json.Marshal(map[string]string{
+		"bucketId":       s.bucket,
+		"sourceKey":      from,
+		"destinationKey": to,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", moveURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create move request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("move failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// GetFileURL returns the public URL for a file
+func (s *Supabase) GetFileURL(path string) string {
+	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.url, s.bucket, path)
+}
+
+// SignedURL asks Supabase to sign a download URL for the file at path
+func (s *Supabase) SignedURL(ctx context.Context, path string, expiresIn time.Duration) (string, error) {
+	signURL := fmt.Sprintf("%s/storage/v1/object/sign/%s/%s", s.url, s.bucket, path)
+	payload, err := json.Marshal(map[string]int64{"expiresIn": int64(expiresIn / time.Second)})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", signURL, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create sign request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("sign failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// The signed URL comes back relative to the storage API
+	var signed struct {
+		SignedURL string `json:"signedURL"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return "", fmt.Errorf("failed to read signed URL: %w", err)
+	}
+	return s.url + "/storage/v1" + signed.SignedURL, nil
+}
+
+// DeleteFile deletes a single file from storage
+func (s *Supabase) DeleteFile(ctx context.Context, path string) error {
+	deleteURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.url, s.bucket, path)
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", deleteURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package userevents
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPublishBuffersAndReplays(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	sub := rdb.Subscribe(ctx, Channel("user-1"))
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := NewPublisher(rdb)
+	for _, score := range []int{7, 8, 9} {
+		if err := publisher.Publish(ctx, "user-1", TypeGradeReleased, map[string]int{"total": score}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg := <-sub.Channel()
+	first, err := Decode(msg.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Type != TypeGradeReleased || string(first.Data) != `{"total":7}` {
+		t.Errorf("first event = %+v", first)
+	}
+
+	missed, err := Since(ctx, rdb, "user-1", first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missed) != 2 || string(missed[0].Data) != `{"total":8}` || string(missed[1].Data) != `{"total":9}` {
+		t.Fatalf("events after the first = %+v", missed)
+	}
+	if !Newer(missed[1].ID, missed[0].ID) || Newer(first.ID, missed[0].ID) || !Newer(first.ID, "") {
+		t.Error("Newer does not follow the order events were published in")
+	}
+	if ttl := server.TTL(bufferKey("user-1")); ttl != BufferTTL {
+		t.Errorf("buffer TTL = %v, want %v", ttl, BufferTTL)
+	}
+
+	if _, err := Since(ctx, rdb, "user-1", "0-0 +"); err == nil {
+		t.Error("Since accepted a malformed event ID")
+	}
+}
+
+func TestNewerComparesNumerically(t *testing.T) {
+	if !Newer("1700000000010-0", "1700000000009-5") {
+		t.Error("a later millisecond is not newer")
+	}
+	if !Newer("1700000000009-10", "1700000000009-9") {
+		t.Error("a later sequence number is not newer")
+	}
+	if Newer("1700000000009-9", "1700000000009-9") {
+		t.Error("an event is newer than itself")
+	}
+}
@@ -0,0 +1,96 @@
+#!/bin/bash
+
+# Checks the gateway's per-user rate limits against the running dev stack
+# (infra/docker/compose.dev.yaml): requests past the limit get 429 with
+# Retry-After, the count is kept per user rather than per token, a token
+# that does not verify spends no user's limit, and the limit resets with the
+# next window. Kong's windows follow the clock, so this takes up to two
+# minutes.
+#
+# Tokens are signed here with JWT_PRIVATE_KEY, the PEM file authn-service
+# runs with; authn's ephemeral development key cannot be used.
+
+# Configuration
+KONG_URL=${KONG_URL:-"http://localhost:8000"}
+JWT_PRIVATE_KEY=${JWT_PRIVATE_KEY:?set JWT_PRIVATE_KEY to the path of authn-service's signing key}
+ROUTE=${ROUTE:-"/users"}
+LIMIT=${LIMIT:-60} # the route's rate-limiting minute in kong.yml
+
+b64url() {
+  openssl base64 -A | tr '+/' '-_' | tr -d '='
+}
+
+# kid KEY: the key ID authn publishes KEY under, its RFC 7638 thumbprint
+kid() {
+  local n e
+  n=$(openssl rsa -in "$1" -noout -modulus | cut -d= -f2 | xxd -r -p | b64url)
+  e=$(printf '%06x' "$(openssl rsa -in "$1" -noout -text | awk '/^publicExponent/ { print $2 }')" | xxd -r -p | b64url)
+  printf '{"e":"%s","kty":"RSA","n":"%s"}' "$e" "$n" | openssl dgst -binary -sha256 | b64url
+}
+
+# token SUB NONCE [KEY]: an access token for user SUB signed with KEY, made
+# distinct from the user's other tokens by NONCE
+token() {
+  local key now header claims signature
+  key=${3:-$JWT_PRIVATE_KEY}
+  now=$(date +%s)
+  header=$(printf '{"alg":"RS256","kid":"%s","typ":"JWT"}' "$(kid "$key")" | b64url)
+  claims=$(printf '{"sub":"%s","jti":"%s","iat":%d,"exp":%d}' "$1" "$2" "$now" $((now + 900)) | b64url)
+  signature=$(printf '%s.%s' "$header" "$claims" | openssl dgst -binary -sha256 -sign "$key" | b64url)
+  echo "$header.$claims.$signature"
+}
+
+# status TOKEN [HEADER]: the HTTP status of one request to ROUTE
+status() {
+  local args=(-s -o /dev/null -w "%{http_code}" -H "Authorization: Bearer $1")
+  [ -n "$2" ] && args+=(-H "$2")
+  curl "${args[@]}" "$KONG_URL$ROUTE"
+}
+
+fail() {
+  echo "FAIL: $1"
+  exit 1
+}
+
+# Waits for the next minute, so the checks run in a fresh window
+next_window() {
+  sleep $((60 - $(date +%s) % 60 + 1))
+}
+
+RUN=$(date +%s)
+WRONG_KEY=$(mktemp)
+trap 'rm -f "$WRONG_KEY"' EXIT
+openssl genrsa -out "$WRONG_KEY" 2048 2>/dev/null
+USER_A="rate-check-a-$RUN"
+USER_B="rate-check-b-$RUN"
+TOKEN_A=$(token "$USER_A" 1)
+
+echo "Waiting for a fresh rate limit window..."
+next_window
+
+echo "Sending $LIMIT requests as $USER_A"
+for i in $(seq 1 "$LIMIT"); do
+  code=$(status "$TOKEN_A")
+  [ "$code" == "429" ] && fail "request $i of $LIMIT was rejected"
+done
+
+RETRY_AFTER=$(curl -s -o /dev/null -D - -H "Authorization: Bearer $TOKEN_A" "$KONG_URL$ROUTE" | tr -d '\r' | awk -F': ' 'tolower($1) == "retry-after" { print $2 }')
+[ -n "$RETRY_AFTER" ] || fail "request past the limit was not rejected with Retry-After"
+echo "OK: request $((LIMIT + 1)) rejected, Retry-After $RETRY_AFTER"
+
+[ "$(status "$(token "$USER_A" 2)")" == "429" ] || fail "a new token for $USER_A got a fresh limit"
+echo "OK: a new token for $USER_A shares its limit"
+
+[ "$(status "$(token "$USER_B" 1)")" != "429" ] || fail "$USER_B was limited by $USER_A's requests"
+echo "OK: $USER_B has its own limit"
+
+[ "$(status "$(token "$USER_A" 3 "$WRONG_KEY")")" != "429" ] || fail "a token with a bad signature spent $USER_A's limit"
+[ "$(status "" "X-RateLimit-User: $USER_A")" != "429" ] || fail "a client's X-RateLimit-User header was trusted"
+echo "OK: unverified tokens and client headers are limited by IP"
+
+echo "Waiting for the next window..."
+next_window
+[ "$(status "$TOKEN_A")" != "429" ] || fail "$USER_A is still limited in the next window"
+echo "OK: the limit reset with the window"
+
+echo "All rate limit checks passed"
@@ -20,8 +20,8 @@ RESPONSE=$(curl -s -o /dev/null -w "%{http_code}" -X POST "$IDENTITY_SERVICE_URL
   -d "{
     \"email\": \"$EMAIL\",
     \"password\": \"$PASSWORD\",
-    \"full_name\": \"$FULL_NAME\",
-    \"user_type\": \"$USER_TYPE\"
+    \"name\": \"$FULL_NAME\",
+    \"role\": \"$USER_TYPE\"
   }")
 
 if [ "$RESPONSE" == "201" ] || [ "$RESPONSE" == "200" ]; then
@@ -35,8 +35,8 @@ else
     -d "{
       \"email\": \"$EMAIL\",
       \"password\": \"$PASSWORD\",
-      \"full_name\": \"$FULL_NAME\",
-      \"user_type\": \"$USER_TYPE\"
+      \"name\": \"$FULL_NAME\",
+      \"role\": \"$USER_TYPE\"
     }"
   exit 1
 fi
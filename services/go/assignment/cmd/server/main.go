@@ -3,15 +3,24 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
+	_ "time/tzdata" // calendar feeds name IANA zones; do not rely on the image having them
 
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/request"
 	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/api"
 	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/repository"
 	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/service"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 func main() {
@@ -23,7 +32,11 @@ func main() {
 	if dsn == "" {
 		log.Fatal("ASSIGNMENT_DATABASE_URL or DATABASE_URL must be set")
 	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	poolCfg, err := database.LoadPoolConfig("ASSIGNMENT")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.Open(postgres.Open(dsn), poolCfg)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -36,15 +49,65 @@ func main() {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
-	svc := service.NewAssignmentService(repo)
-	handler := api.NewHandler(svc)
+	jwksURL := os.Getenv("AUTHN_JWKS_URL")
+	if jwksURL == "" {
+		jwksURL = "http://localhost:8003/.well-known/jwks.json"
+	}
+	verifierCfg := jwtauth.Config{JWKSURL: jwksURL}
+	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
+		// Reject access tokens of sessions revoked before the tokens expire
+		redisDB := 0
+		if v := os.Getenv("REDIS_DB"); v != "" {
+			redisDB, err = strconv.Atoi(v)
+			if err != nil {
+				log.Fatal("Invalid REDIS_DB:", err)
+			}
+		}
+		denyListCacheTTL := 5 * time.Second
+		if v := os.Getenv("TOKEN_DENYLIST_CACHE_TTL"); v != "" {
+			denyListCacheTTL, err = time.ParseDuration(v)
+			if err != nil {
+				log.Fatal("Invalid TOKEN_DENYLIST_CACHE_TTL:", err)
+			}
+		}
+		verifierCfg.DenyList = jwtauth.NewDenyList(redis.NewClient(&redis.Options{
+			Addr:     redisAddr,
+			Username: os.Getenv("REDIS_USERNAME"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       redisDB,
+		}), denyListCacheTTL)
+	}
+	verifier := jwtauth.NewVerifier(verifierCfg)
+
+	authzCacheTTL := 30 * time.Second
+	if v := os.Getenv("AUTHZ_CACHE_TTL"); v != "" {
+		authzCacheTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid AUTHZ_CACHE_TTL:", err)
+		}
+	}
+	internalSecret := os.Getenv("INTERNAL_SECRET")
+	if internalSecret == "" {
+		internalSecret = "insecure-secret-for-dev"
+	}
+	authorizer := authorize.NewAuthorizer(verifier, authorize.NewCachedClient(authorize.NewClient(), authzCacheTTL), internalSecret)
+
+	identityURL := os.Getenv("IDENTITY_SERVICE_URL")
+	if identityURL == "" {
+		identityURL = "http://localhost:8001"
+	}
+	identity := clients.NewIdentity(clients.Config{BaseURL: identityURL, InternalToken: internalSecret})
+	svc := service.NewAssignmentService(repo, identity)
+
+	handler := api.NewHandler(svc, authorizer)
 
 	// 3. Setup Fiber
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler, BodyLimit: request.DefaultBodyLimit})
 	app.Use(logger.New())
 	app.Use(recover.New())
 
 	api.SetupRoutes(app, handler)
+	app.Get("/debug/db", database.StatsHandler(db))
 
 	// 4. Start
 	port := os.Getenv("PORT")
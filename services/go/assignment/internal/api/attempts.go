@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (h *Handler) StartAttempt(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		StudentID string `json:"studentId"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if body.StudentID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId is required"})
+	}
+
+	status, created, err := h.svc.StartAttempt(id, body.StudentID)
+	if err != nil {
+		return attemptError(c, err)
+	}
+
+	if created {
+		return c.Status(fiber.StatusCreated).JSON(status)
+	}
+	return c.JSON(status)
+}
+
+func (h *Handler) GetAttempt(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	studentID := c.Query("studentId")
+	if studentID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId is required"})
+	}
+
+	status, err := h.svc.GetAttempt(id, studentID)
+	if err != nil {
+		return attemptError(c, err)
+	}
+
+	return c.JSON(status)
+}
+
+func (h *Handler) VoidAttempt(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		VoidedBy string `json:"voidedBy"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+		}
+	}
+
+	attempt, err := h.svc.VoidAttempt(id, c.Params("studentId"), body.VoidedBy)
+	if err != nil {
+		return attemptError(c, err)
+	}
+
+	return c.JSON(attempt)
+}
+
+func attemptError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrNoAttempt):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Assignment not found"})
+	case errors.Is(err, service.ErrNotTimed):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAssignmentNotReleased), errors.Is(err, service.ErrAssignmentClosed):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
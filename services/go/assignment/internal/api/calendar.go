@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// RegenerateCalendarToken issues the student a new deadline calendar token
+// and returns the feed's path with it. Users may only manage their own feed.
+func (h *Handler) RegenerateCalendarToken(c *fiber.Ctx) error {
+	studentID := c.Params("id")
+	if !ownsFeed(c, studentID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	token, err := h.svc.RegenerateCalendarToken(studentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token": token,
+		"path":  "/api/v1/students/" + studentID + "/deadlines.ics?token=" + token,
+	})
+}
+
+func (h *Handler) RevokeCalendarToken(c *fiber.Ctx) error {
+	studentID := c.Params("id")
+	if !ownsFeed(c, studentID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	if err := h.svc.RevokeCalendarToken(studentID); err != nil {
+		if errors.Is(err, service.ErrNoCalendarFeed) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetStudentCalendar serves the student's deadlines to calendar apps. The
+// token query parameter authenticates the request in place of an access
+// token, which the apps cannot send.
+func (h *Handler) GetStudentCalendar(c *fiber.Ctx) error {
+	ics, err := h.svc.StudentCalendar(c.UserContext(), c.Params("id"), c.Query("token"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidFeedToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	return c.Send(ics)
+}
+
+// GetStudentDeadlines lists the student's deadlines. Students see their own,
+// guardians those of the students linked to them, and holders of
+// extension.read, such as instructors, anyone's.
+func (h *Handler) GetStudentDeadlines(c *fiber.Ctx) error {
+	studentID := c.Params("id")
+	if _, err := uuid.Parse(studentID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var guardianID string
+	if caller := authorize.CallerFrom(c); caller != nil && caller.UserID != studentID {
+		if caller.Role == "GUARDIAN" {
+			guardianID = caller.UserID
+		} else {
+			staff, err := h.auth.Allows(c, "extension.read")
+			if err != nil {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+			}
+			if !staff {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+			}
+		}
+	}
+
+	deadlines, err := h.svc.StudentDeadlines(c.UserContext(), studentID, guardianID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotGuardian) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(deadlines)
+}
+
+// ownsFeed reports whether the caller may manage the user's calendar feed:
+// the user themselves, or another service acting on its own behalf
+func ownsFeed(c *fiber.Ctx, userID string) bool {
+	caller := authorize.CallerFrom(c)
+	return caller == nil || caller.UserID == userID
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+const testInternalToken = "test-internal-token"
+
+// allowAll lets every caller through the permission checks
+type allowAll struct{}
+
+func (allowAll) Check(context.Context, string, string, string, string) (bool, error) {
+	return true, nil
+}
+
+// calendarService keeps one student's feed token and answers the calendar
+// calls and nothing else
+type calendarService struct {
+	service.AssignmentService
+	token string
+}
+
+func (s *calendarService) RegenerateCalendarToken(string) (string, error) {
+	s.token = "secret-token"
+	return s.token, nil
+}
+
+func (s *calendarService) RevokeCalendarToken(string) error {
+	if s.token == "" {
+		return service.ErrNoCalendarFeed
+	}
+	s.token = ""
+	return nil
+}
+
+func (s *calendarService) StudentCalendar(_ context.Context, _, token string) ([]byte, error) {
+	if s.token == "" || token != s.token {
+		return nil, service.ErrInvalidFeedToken
+	}
+	return []byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"), nil
+}
+
+func TestCalendarFeedIsClosedByRevokingItsToken(t *testing.T) {
+	app := fiber.New()
+	SetupRoutes(app, NewHandler(&calendarService{}, authorize.NewAuthorizer(nil, allowAll{}, testInternalToken)))
+
+	call := func(method, path, userID string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		if userID != "" {
+			req.Header.Set("X-Internal-Token", testInternalToken)
+			req.Header.Set("X-User-Id", userID)
+			req.Header.Set("X-User-Role", "student")
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if code := call(fiber.MethodPost, "/api/v1/students/student-1/calendar-token", "student-2").StatusCode; code != fiber.StatusForbidden {
+		t.Errorf("another student making a token: status %d, want 403", code)
+	}
+	if code := call(fiber.MethodPost, "/api/v1/students/student-1/calendar-token", "student-1").StatusCode; code != fiber.StatusCreated {
+		t.Fatalf("making a token: status %d", code)
+	}
+
+	// Calendar apps fetch the feed with only the token in the URL
+	feed := "/api/v1/students/student-1/deadlines.ics?token=secret-token"
+	resp := call(fiber.MethodGet, feed, "")
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get("Content-Type") != "text/calendar; charset=utf-8" {
+		t.Fatalf("feed: status %d, type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if code := call(fiber.MethodGet, "/api/v1/students/student-1/deadlines.ics?token=guess", "").StatusCode; code != fiber.StatusUnauthorized {
+		t.Errorf("feed with a wrong token: status %d, want 401", code)
+	}
+
+	if code := call(fiber.MethodDelete, "/api/v1/students/student-1/calendar-token", "student-1").StatusCode; code != fiber.StatusNoContent {
+		t.Fatalf("revoking: status %d", code)
+	}
+	if code := call(fiber.MethodGet, feed, "").StatusCode; code != fiber.StatusUnauthorized {
+		t.Errorf("feed after revoking: status %d, want 401", code)
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (h *Handler) GrantExtension(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		DueDate time.Time `json:"dueDate"`
+		Reason  string    `json:"reason"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	var grantedBy string
+	if caller := authorize.CallerFrom(c); caller != nil {
+		grantedBy = caller.UserID
+	}
+	extension, err := h.svc.GrantExtension(id, c.Params("studentId"), body.DueDate, body.Reason, grantedBy)
+	if err != nil {
+		return extensionError(c, err)
+	}
+
+	return c.JSON(extension)
+}
+
+func (h *Handler) RevokeExtension(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	if err := h.svc.RevokeExtension(id, c.Params("studentId")); err != nil {
+		return extensionError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) ListExtensions(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	extensions, err := h.svc.ListExtensions(id)
+	if err != nil {
+		return extensionError(c, err)
+	}
+
+	return c.JSON(extensions)
+}
+
+// GetStudentDeadline returns when the assignment is due for the student in
+// ?studentId, taking their extension into account
+func (h *Handler) GetStudentDeadline(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	studentID := c.Query("studentId")
+	if studentID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId is required"})
+	}
+
+	deadline, err := h.svc.StudentDeadline(id, studentID)
+	if err != nil {
+		return extensionError(c, err)
+	}
+
+	return c.JSON(deadline)
+}
+
+func extensionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrNoExtension):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Assignment not found"})
+	case errors.Is(err, service.ErrInvalidExtension):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
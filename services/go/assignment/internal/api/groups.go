@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (h *Handler) CreateGroup(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		StudentID string `json:"studentId"`
+		Name      string `json:"name"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if body.StudentID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId is required"})
+	}
+
+	group, err := h.svc.CreateGroup(id, body.StudentID, body.Name)
+	if err != nil {
+		return groupError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(group)
+}
+
+func (h *Handler) ListGroups(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	groups, err := h.svc.ListGroups(id)
+	if err != nil {
+		return groupError(c, err)
+	}
+
+	return c.JSON(groups)
+}
+
+func (h *Handler) GetGroup(c *fiber.Ctx) error {
+	id, groupID, err := groupParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	group, err := h.svc.GetGroup(id, groupID)
+	if err != nil {
+		return groupError(c, err)
+	}
+
+	return c.JSON(group)
+}
+
+func (h *Handler) GetStudentGroup(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	studentID := c.Query("studentId")
+	if studentID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId is required"})
+	}
+
+	group, err := h.svc.GetStudentGroup(id, studentID)
+	if err != nil {
+		return groupError(c, err)
+	}
+
+	return c.JSON(group)
+}
+
+func (h *Handler) JoinGroup(c *fiber.Ctx) error {
+	id, groupID, err := groupParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		StudentID string `json:"studentId"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if body.StudentID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId is required"})
+	}
+
+	group, err := h.svc.JoinGroup(id, groupID, body.StudentID)
+	if err != nil {
+		return groupError(c, err)
+	}
+
+	return c.JSON(group)
+}
+
+func (h *Handler) LeaveGroup(c *fiber.Ctx) error {
+	id, groupID, err := groupParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	if err := h.svc.LeaveGroup(id, groupID, c.Params("studentId")); err != nil {
+		return groupError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) LockGroup(c *fiber.Ctx) error {
+	id, groupID, err := groupParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	group, err := h.svc.LockGroup(id, groupID)
+	if err != nil {
+		return groupError(c, err)
+	}
+
+	return c.JSON(group)
+}
+
+func groupParams(c *fiber.Ctx) (uuid.UUID, uuid.UUID, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	groupID, err := uuid.Parse(c.Params("groupId"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	return id, groupID, nil
+}
+
+func groupError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrNoGroup), errors.Is(err, service.ErrNotGroupMember):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Assignment not found"})
+	case errors.Is(err, service.ErrGroupsDisabled):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAlreadyInGroup), errors.Is(err, service.ErrGroupFull), errors.Is(err, service.ErrGroupLocked):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
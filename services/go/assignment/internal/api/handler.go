@@ -1,28 +1,105 @@
 package api
 
 import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
 	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
 	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/service"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
-	svc service.AssignmentService
+	svc  service.AssignmentService
+	auth *authorize.Authorizer
+}
+
+func NewHandler(svc service.AssignmentService, auth *authorize.Authorizer) *Handler {
+	return &Handler{svc: svc, auth: auth}
+}
+
+// route is an endpoint and the permission a caller needs to use it
+type route struct {
+	method     string
+	path       string
+	permission string
+	handler    fiber.Handler
+}
+
+// routes lists every endpoint with its required permission, so who may call
+// what can be reviewed in one place. The only unprotected route is the
+// deadline calendar feed, which checks its own token.
+func (h *Handler) routes() []route {
+	return []route{
+		{fiber.MethodPost, "/", "assignment.create", h.CreateAssignment},
+		{fiber.MethodGet, "/", "assignment.read", h.ListAssignments},
+		{fiber.MethodGet, "/:id", "assignment.read", h.GetAssignment},
+		{fiber.MethodPut, "/:id", "assignment.update", h.UpdateAssignment},
+		{fiber.MethodDelete, "/:id", "assignment.delete", h.DeleteAssignment},
+
+		{fiber.MethodGet, "/:id/rubric", "rubric.read", h.GetRubric},
+		{fiber.MethodPut, "/:id/rubric", "rubric.update", h.SaveRubric},
+		{fiber.MethodDelete, "/:id/rubric", "rubric.delete", h.DeleteRubric},
+
+		{fiber.MethodPost, "/:id/start", "attempt.start", h.StartAttempt},
+		{fiber.MethodGet, "/:id/attempt", "attempt.read", h.GetAttempt},
+		{fiber.MethodPost, "/:id/attempts/:studentId/void", "attempt.void", h.VoidAttempt},
+
+		{fiber.MethodPost, "/:id/groups", "group.join", h.CreateGroup},
+		{fiber.MethodGet, "/:id/groups", "group.read", h.ListGroups},
+		{fiber.MethodGet, "/:id/group", "group.read", h.GetStudentGroup},
+		{fiber.MethodGet, "/:id/groups/:groupId", "group.read", h.GetGroup},
+		{fiber.MethodPost, "/:id/groups/:groupId/members", "group.join", h.JoinGroup},
+		{fiber.MethodDelete, "/:id/groups/:groupId/members/:studentId", "group.join", h.LeaveGroup},
+		{fiber.MethodPost, "/:id/groups/:groupId/lock", "group.lock", h.LockGroup},
+
+		{fiber.MethodGet, "/:id/extensions", "extension.read", h.ListExtensions},
+		{fiber.MethodGet, "/:id/deadline", "extension.read", h.GetStudentDeadline},
+		{fiber.MethodPut, "/:id/extensions/:studentId", "extension.grant", h.GrantExtension},
+		{fiber.MethodDelete, "/:id/extensions/:studentId", "extension.grant", h.RevokeExtension},
+	}
 }
 
-func NewHandler(svc service.AssignmentService) *Handler {
-	return &Handler{svc: svc}
+// classRoutes are the endpoints under /api/v1/assignments/classes, for the
+// weighting of a class's assignments
+func (h *Handler) classRoutes() []route {
+	return []route{
+		{fiber.MethodGet, "/weight-report", "assignment.update", h.WeightReport},
+		{fiber.MethodPost, "/grade-weights", "assignment.read", h.StudentGradeWeights},
+		{fiber.MethodGet, "/:classId/grading-policy", "assignment.read", h.GetGradingPolicy},
+		{fiber.MethodPut, "/:classId/grading-policy", "assignment.update", h.SetGradingPolicy},
+	}
+}
+
+// studentRoutes are the endpoints under /api/v1/students
+func (h *Handler) studentRoutes() []route {
+	return []route{
+		{fiber.MethodPost, "/:id/calendar-token", "calendar.manage", h.RegenerateCalendarToken},
+		{fiber.MethodDelete, "/:id/calendar-token", "calendar.manage", h.RevokeCalendarToken},
+		{fiber.MethodGet, "/:id/deadlines", "deadline.read", h.GetStudentDeadlines},
+	}
 }
 
 func SetupRoutes(app *fiber.App, h *Handler) {
+	// Before the assignment routes so "classes" is not taken as an ID
+	classes := app.Group("/api/v1/assignments/classes")
+	for _, r := range h.classRoutes() {
+		classes.Add(r.method, r.path, h.auth.Require(r.permission), r.handler)
+	}
+
 	api := app.Group("/api/v1/assignments")
+	for _, r := range h.routes() {
+		api.Add(r.method, r.path, h.auth.Require(r.permission), r.handler)
+	}
 
-	api.Post("/", h.CreateAssignment)
-	api.Get("/", h.ListAssignments)
-	api.Get("/:id", h.GetAssignment)
-	api.Put("/:id", h.UpdateAssignment)
-	api.Delete("/:id", h.DeleteAssignment)
+	students := app.Group("/api/v1/students")
+	for _, r := range h.studentRoutes() {
+		students.Add(r.method, r.path, h.auth.Require(r.permission), r.handler)
+	}
+	// Calendar apps cannot send an access token; the feed token stands in
+	students.Get("/:id/deadlines.ics", h.GetStudentCalendar)
 }
 
 func (h *Handler) CreateAssignment(c *fiber.Ctx) error {
@@ -32,6 +109,9 @@ func (h *Handler) CreateAssignment(c *fiber.Ctx) error {
 	}
 
 	if err := h.svc.CreateAssignment(&assignment); err != nil {
+		if errors.Is(err, service.ErrInvalidTiming) || errors.Is(err, service.ErrInvalidGroups) || errors.Is(err, service.ErrInvalidLimit) || errors.Is(err, service.ErrInvalidWeight) || errors.Is(err, service.ErrInvalidLatePenalty) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -54,7 +134,16 @@ func (h *Handler) GetAssignment(c *fiber.Ctx) error {
 
 func (h *Handler) ListAssignments(c *fiber.Ctx) error {
 	courseID := c.Query("courseId")
-	assignments, err := h.svc.ListAssignments(courseID)
+	// Students list with their section to see only what is meant for them
+	var sectionID *uuid.UUID
+	if v := c.Query("sectionId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid sectionId"})
+		}
+		sectionID = &id
+	}
+	assignments, err := h.svc.ListAssignments(courseID, sectionID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -75,6 +164,9 @@ func (h *Handler) UpdateAssignment(c *fiber.Ctx) error {
 	assignment.ID = id
 
 	if err := h.svc.UpdateAssignment(&assignment); err != nil {
+		if errors.Is(err, service.ErrInvalidRubric) || errors.Is(err, service.ErrInvalidTiming) || errors.Is(err, service.ErrInvalidGroups) || errors.Is(err, service.ErrInvalidLimit) || errors.Is(err, service.ErrInvalidWeight) || errors.Is(err, service.ErrInvalidLatePenalty) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -93,3 +185,60 @@ func (h *Handler) DeleteAssignment(c *fiber.Ctx) error {
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+func (h *Handler) GetRubric(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	rubric, err := h.svc.GetRubric(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Rubric not found"})
+	}
+
+	return c.JSON(rubric)
+}
+
+func (h *Handler) SaveRubric(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		Criteria []core.RubricCriterion `json:"criteria"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	rubric, err := h.svc.SaveRubric(id, body.Criteria)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Assignment not found"})
+		case errors.Is(err, service.ErrInvalidRubric):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rubric)
+}
+
+func (h *Handler) DeleteRubric(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	if err := h.svc.DeleteRubric(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Rubric not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// WeightReport lists the classes whose assignment weights do not add up to
+// 100, only those named by courseId parameters if there are any
+func (h *Handler) WeightReport(c *fiber.Ctx) error {
+	var courseIDs []string
+	for _, id := range c.Context().QueryArgs().PeekMulti("courseId") {
+		courseIDs = append(courseIDs, string(id))
+	}
+
+	report, err := h.svc.WeightReport(courseIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(report)
+}
+
+func (h *Handler) GetGradingPolicy(c *fiber.Ctx) error {
+	policy, err := h.svc.GetGradingPolicy(c.Params("classId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(policy)
+}
+
+func (h *Handler) SetGradingPolicy(c *fiber.Ctx) error {
+	var body struct {
+		MissingAsZero *bool `json:"missingAsZero"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if body.MissingAsZero == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "missingAsZero is required"})
+	}
+
+	policy := &core.ClassGradingPolicy{CourseID: c.Params("classId"), MissingAsZero: *body.MissingAsZero}
+	if err := h.svc.SetGradingPolicy(policy); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(policy)
+}
+
+// StudentGradeWeights returns the weighted assignments of a student's
+// classes, for the submission service to build their transcript. Classes
+// are named directly or by an assignment in them, so classes the student
+// has left are found through the assignments they submitted to.
+func (h *Handler) StudentGradeWeights(c *fiber.Ctx) error {
+	var body struct {
+		StudentID     string      `json:"studentId"`
+		CourseIDs     []string    `json:"courseIds"`
+		AssignmentIDs []uuid.UUID `json:"assignmentIds"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if body.StudentID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId is required"})
+	}
+
+	classes, err := h.svc.StudentGradeWeights(body.StudentID, body.CourseIDs, body.AssignmentIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(classes)
+}
@@ -0,0 +1,185 @@
+// Package calendar writes iCalendar (RFC 5545) feeds that calendar apps can
+// subscribe to.
+package calendar
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event is a point in time, such as a deadline, on a calendar
+type Event struct {
+	// UID identifies the event across fetches of the feed, so apps update
+	// it in place rather than adding a copy when it changes
+	UID          string
+	Summary      string
+	Description  string
+	At           time.Time
+	LastModified time.Time
+}
+
+// Calendar is a named list of events shown in one time zone
+type Calendar struct {
+	Name     string
+	Location *time.Location
+	Events   []Event
+}
+
+const (
+	localFormat = "20060102T150405"
+	utcFormat   = "20060102T150405Z"
+	// maxLineOctets is the longest a content line may be before it is folded
+	maxLineOctets = 75
+)
+
+// Encode writes the calendar as an iCalendar object stamped now. Events in
+// a zone other than UTC carry the zone's definition, covering a year either
+// side of them, so apps need not know the zone.
+func (c *Calendar) Encode(now time.Time) []byte {
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var w writer
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//GradeLoop//Assignment Deadlines//EN")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	w.line("X-WR-CALNAME:" + escape(c.Name))
+	if loc != time.UTC {
+		w.line("X-WR-TIMEZONE:" + loc.String())
+		c.writeTimezone(&w, loc, now)
+	}
+	for _, e := range c.Events {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + escape(e.UID))
+		w.line("DTSTAMP:" + now.UTC().Format(utcFormat))
+		if loc == time.UTC {
+			w.line("DTSTART:" + e.At.UTC().Format(utcFormat))
+		} else {
+			w.line("DTSTART;TZID=" + loc.String() + ":" + e.At.In(loc).Format(localFormat))
+		}
+		w.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if !e.LastModified.IsZero() {
+			w.line("LAST-MODIFIED:" + e.LastModified.UTC().Format(utcFormat))
+		}
+		w.line("TRANSP:TRANSPARENT")
+		w.line("END:VEVENT")
+	}
+	w.line("END:VCALENDAR")
+	return w.buf.Bytes()
+}
+
+// writeTimezone writes a VTIMEZONE for loc with an observance for each offset
+// change from a year before the first event, or now, to a year after the last
+func (c *Calendar) writeTimezone(w *writer, loc *time.Location, now time.Time) {
+	from, to := now, now
+	for _, e := range c.Events {
+		if e.At.Before(from) {
+			from = e.At
+		}
+		if e.At.After(to) {
+			to = e.At
+		}
+	}
+	from, to = from.AddDate(-1, 0, 0).In(loc), to.AddDate(1, 0, 0).In(loc)
+
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+	// The offset in effect when the range starts
+	_, offset := from.Zone()
+	writeObservance(w, from, offset)
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if _, o := next.Zone(); o != offset {
+			at := transition(t, next)
+			writeObservance(w, at, offset)
+			_, offset = at.Zone()
+		}
+		t = next
+	}
+	w.line("END:VTIMEZONE")
+}
+
+// transition finds the instant in (before, after] at which the zone's offset
+// changes, to the second
+func transition(before, after time.Time) time.Time {
+	_, offset := before.Zone()
+	for after.Sub(before) > time.Second {
+		mid := before.Add(after.Sub(before) / 2)
+		if _, o := mid.Zone(); o == offset {
+			before = mid
+		} else {
+			after = mid
+		}
+	}
+	return after
+}
+
+// writeObservance writes the zone switching from offsetFrom to the offset in
+// effect at at. Its DTSTART is the local time at which that happens, read
+// with the old offset as RFC 5545 asks.
+func writeObservance(w *writer, at time.Time, offsetFrom int) {
+	kind := "STANDARD"
+	if at.IsDST() {
+		kind = "DAYLIGHT"
+	}
+	name, offsetTo := at.Zone()
+	w.line("BEGIN:" + kind)
+	w.line("DTSTART:" + at.In(time.FixedZone("", offsetFrom)).Format(localFormat))
+	w.line("TZOFFSETFROM:" + formatOffset(offsetFrom))
+	w.line("TZOFFSETTO:" + formatOffset(offsetTo))
+	w.line("TZNAME:" + escape(name))
+	w.line("END:" + kind)
+}
+
+// formatOffset writes seconds east of UTC as +hhmm, with seconds if any
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
+
+// escaper escapes the characters TEXT values cannot hold as they are
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escape writes text as an iCalendar TEXT value
+func escape(text string) string {
+	return escaper.Replace(text)
+}
+
+// writer writes content lines ending in CRLF, folding those longer than 75
+// octets without splitting a UTF-8 character
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) line(s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with the space, which counts
+		limit = maxLineOctets - 1
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
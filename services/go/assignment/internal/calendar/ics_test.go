@@ -0,0 +1,49 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestLongLinesAreFolded(t *testing.T) {
+	summary := strings.Repeat("Übung ", 30)
+	cal := Calendar{Name: "Deadlines", Events: []Event{{UID: "a@test", Summary: summary, At: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}}}
+	ics := string(cal.Encode(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)))
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("fold split a character: %q", line)
+		}
+	}
+	if !strings.Contains(strings.ReplaceAll(ics, "\r\n ", ""), "SUMMARY:"+summary+"\r\n") {
+		t.Errorf("unfolded feed does not hold the summary:\n%s", ics)
+	}
+	if !strings.Contains(ics, "DTSTART:20260301T090000Z\r\n") {
+		t.Errorf("UTC event is not written in UTC:\n%s", ics)
+	}
+}
+
+func TestTimezoneCoversDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := Calendar{Name: "Deadlines", Location: berlin, Events: []Event{{UID: "a@test", Summary: "Lab", At: time.Date(2026, 7, 1, 23, 59, 0, 0, berlin)}}}
+	ics := string(cal.Encode(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)))
+
+	for _, want := range []string{
+		"DTSTART;TZID=Europe/Berlin:20260701T235900\r\n",
+		// Summer time starts at 02:00 local on the last Sunday of March
+		"BEGIN:DAYLIGHT\r\nDTSTART:20260329T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20261025T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("feed lacks %q:\n%s", want, ics)
+		}
+	}
+}
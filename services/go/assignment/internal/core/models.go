@@ -34,6 +34,7 @@ const (
 type Assignment struct {
 	ID                     uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	CourseID               string         `gorm:"index" json:"courseId"`
+	SectionID              *uuid.UUID     `gorm:"type:uuid;index" json:"sectionId,omitempty"` // one section of the class; nil targets the whole class
 	Title                  string         `gorm:"not null" json:"title"`
 	Type                   AssignmentType `json:"type"`
 	Difficulty             Difficulty     `json:"difficulty"`
@@ -47,9 +48,9 @@ type Assignment struct {
 	AutograderPoints       int            `json:"autograderPoints"`
 	AllowManualGrading     bool           `json:"allowManualGrading"`
 	GradingMethod          GradingMethod  `json:"gradingMethod"`
-	TimeLimit              int            `json:"timeLimit"`   // in seconds or minutes (as per UI)
-	MemoryLimit            string         `json:"memoryLimit"` // e.g., "256MB"
-	TotalAttempts          int            `json:"totalAttempts"`
+	TimeLimit              int            `json:"timeLimit"`     // in seconds or minutes (as per UI)
+	MemoryLimit            string         `json:"memoryLimit"`   // e.g., "256MB"
+	TotalAttempts          int            `json:"totalAttempts"` // submissions allowed per student or group; 0 means unlimited
 	EnforceTimeLimit       bool           `json:"enforceTimeLimit"`
 	EnableGroupSubmissions bool           `json:"enableGroupSubmissions"`
 	GroupSizeLimit         int            `json:"groupSizeLimit"`
@@ -58,6 +59,8 @@ type Assignment struct {
 	VivaRequired           bool           `json:"vivaRequired"`
 	VivaWeight             int            `json:"vivaWeight"` // percentage 0-100
 	EnableAiAssistance     bool           `json:"enableAiAssistance"`
+	Timed                  bool           `json:"timed"`           // each student gets DurationMinutes from when they start
+	DurationMinutes        int            `json:"durationMinutes"` // only used when Timed
 	CreatedAt              time.Time      `json:"createdAt"`
 	UpdatedAt              time.Time      `json:"updatedAt"`
 	DeletedAt              gorm.DeletedAt `gorm:"index" json:"-"`
@@ -65,6 +68,62 @@ type Assignment struct {
 	Rubric      []RubricItem           `gorm:"foreignKey:AssignmentID" json:"rubric"`
 	Constraints []AssignmentConstraint `gorm:"foreignKey:AssignmentID" json:"constraints"`
 	Languages   []AssignmentLanguage   `gorm:"foreignKey:AssignmentID" json:"allowedLanguages"`
+
+	// Weight is the percentage of the class grade the assignment is worth,
+	// 0-100. The weights of a class's assignments add up to at most 100.
+	Weight int `gorm:"not null;default:0" json:"weight"`
+
+	// LatePenalty is how grades of late submissions are reduced. LatePolicy
+	// above is only the wording shown to students.
+	LatePenalty LatePenaltyPolicy `gorm:"type:text;serializer:json" json:"latePenalty"`
+}
+
+type LatePenaltyType string
+
+const (
+	LatePenaltyNone             LatePenaltyType = "none"
+	LatePenaltyPercentPerDay    LatePenaltyType = "percent_per_day"
+	LatePenaltyFixedPerInterval LatePenaltyType = "fixed_per_interval"
+	LatePenaltyCutoff           LatePenaltyType = "cutoff"
+)
+
+// LatePenaltyPolicy is applied by the submission service when a late
+// submission is graded. Lateness is counted from the end of GraceMinutes
+// after the student's due date; each parameter only applies to its type.
+type LatePenaltyPolicy struct {
+	Type         LatePenaltyType `json:"type"`
+	GraceMinutes int             `json:"graceMinutes"`
+	// percent_per_day: PercentPerDay of the maximum score per started day,
+	// up to MaxPercent (0 for no cap)
+	PercentPerDay int `json:"percentPerDay,omitempty"`
+	MaxPercent    int `json:"maxPercent,omitempty"`
+	// fixed_per_interval: PointsPerInterval per started IntervalMinutes, up
+	// to MaxPoints (0 for no cap)
+	PointsPerInterval int `json:"pointsPerInterval,omitempty"`
+	IntervalMinutes   int `json:"intervalMinutes,omitempty"`
+	MaxPoints         int `json:"maxPoints,omitempty"`
+	// cutoff: no penalty up to CutoffMinutes late, a score of zero after
+	CutoffMinutes int `json:"cutoffMinutes,omitempty"`
+}
+
+// StudentDeadline is when an assignment is due for one student, with their
+// extension if they have one, and its late penalty
+type StudentDeadline struct {
+	AssignmentID uuid.UUID         `json:"assignmentId"`
+	Title        string            `json:"title"`
+	CourseID     string            `json:"courseId"`
+	StudentID    string            `json:"studentId"`
+	DueDate      time.Time         `json:"dueDate"`
+	Extended     bool              `json:"extended"`
+	LatePenalty  LatePenaltyPolicy `json:"latePenalty"`
+}
+
+// ClosesAt is the hard close date after which nothing may be submitted
+func (a *Assignment) ClosesAt() time.Time {
+	if a.AllowLateSubmissions && a.LateDueDate != nil {
+		return *a.LateDueDate
+	}
+	return a.DueDate
 }
 
 type RubricItem struct {
@@ -85,3 +144,120 @@ type AssignmentLanguage struct {
 	AssignmentID uuid.UUID `gorm:"index" json:"assignmentId"`
 	Language     string    `json:"language"`
 }
+
+// Rubric is the structured grading scheme for an assignment. The max points
+// of its criteria must add up to the assignment's TotalScore.
+type Rubric struct {
+	ID           uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssignmentID uuid.UUID         `gorm:"type:uuid;uniqueIndex" json:"assignmentId"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+	Criteria     []RubricCriterion `gorm:"foreignKey:RubricID;constraint:OnDelete:CASCADE" json:"criteria"`
+}
+
+type RubricCriterion struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	RubricID    uuid.UUID `gorm:"type:uuid;index" json:"rubricId"`
+	Name        string    `gorm:"not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	MaxPoints   int       `gorm:"not null" json:"maxPoints"`
+	Order       int       `gorm:"column:sort_order" json:"order"`
+}
+
+// AssignmentAttempt is a student's run at a timed assignment. A student has at
+// most one attempt that is not voided; voiding one lets them start again.
+type AssignmentAttempt struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssignmentID uuid.UUID  `gorm:"type:uuid;uniqueIndex:idx_active_attempt,where:voided_at IS NULL" json:"assignmentId"`
+	StudentID    string     `gorm:"not null;uniqueIndex:idx_active_attempt,where:voided_at IS NULL" json:"studentId"`
+	StartedAt    time.Time  `gorm:"not null" json:"startedAt"`
+	EndsAt       time.Time  `gorm:"not null" json:"endsAt"`
+	VoidedAt     *time.Time `json:"voidedAt,omitempty"`
+	VoidedBy     string     `json:"voidedBy,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// SubmissionGroup is a team of students handing in one submission for an
+// assignment with group submissions enabled. A student belongs to at most
+// one group per assignment. SubmittedAt is set when the group first submits,
+// after which its membership can no longer change.
+type SubmissionGroup struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssignmentID uuid.UUID  `gorm:"type:uuid;index;not null" json:"assignmentId"`
+	Name         string     `json:"name"`
+	CreatedBy    string     `gorm:"not null" json:"createdBy"`
+	SubmittedAt  *time.Time `json:"submittedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+
+	Members []SubmissionGroupMember `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"members"`
+}
+
+// SubmissionGroupMember places a student in a group. The unique index on
+// assignment and student keeps a student to one group per assignment.
+type SubmissionGroupMember struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	GroupID      uuid.UUID `gorm:"type:uuid;index;not null" json:"groupId"`
+	AssignmentID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_group_member_student;not null" json:"assignmentId"`
+	StudentID    string    `gorm:"not null;uniqueIndex:idx_group_member_student" json:"studentId"`
+	JoinedAt     time.Time `gorm:"not null" json:"joinedAt"`
+}
+
+// DeadlineExtension gives one student a later due date for an assignment. It
+// also keeps a timed assignment open for them until then.
+type DeadlineExtension struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssignmentID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_extension_student;not null" json:"assignmentId"`
+	StudentID    string    `gorm:"not null;uniqueIndex:idx_extension_student" json:"studentId"`
+	DueDate      time.Time `gorm:"not null" json:"dueDate"`
+	Reason       string    `gorm:"type:text" json:"reason,omitempty"`
+	GrantedBy    string    `json:"grantedBy,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// CalendarFeed is the secret that opens a student's deadline calendar to
+// calendar apps, which cannot send an access token. Only a hash of the
+// token is kept.
+type CalendarFeed struct {
+	UserID    string    `gorm:"primaryKey" json:"userId"`
+	TokenHash string    `gorm:"not null" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ClassGradingPolicy is how a class's weighted grade counts an assignment a
+// student never submitted once it has closed for them: as zero, or left out
+// of the total. Classes without one leave such assignments out.
+type ClassGradingPolicy struct {
+	CourseID      string    `gorm:"primaryKey" json:"courseId"`
+	MissingAsZero bool      `gorm:"not null;default:false" json:"missingAsZero"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// ClassWeightTotal is what the weights of a class's assignments add up to
+type ClassWeightTotal struct {
+	CourseID    string `json:"courseId"`
+	TotalWeight int    `json:"totalWeight"`
+	Assignments int    `json:"assignments"`
+}
+
+// ClassGradeWeights is a class's released assignments as they count towards
+// one student's grade, with the class's grading policy
+type ClassGradeWeights struct {
+	CourseID      string             `json:"courseId"`
+	MissingAsZero bool               `json:"missingAsZero"`
+	Assignments   []GradedAssignment `json:"assignments"`
+}
+
+// GradedAssignment is an assignment's weight and points, and when it closes
+// for the student, extension included
+type GradedAssignment struct {
+	ID         uuid.UUID  `json:"id"`
+	SectionID  *uuid.UUID `json:"sectionId,omitempty"`
+	Title      string     `json:"title"`
+	Weight     int        `json:"weight"`
+	TotalScore int        `json:"totalScore"`
+	DueDate    time.Time  `json:"dueDate"`
+	ClosesAt   time.Time  `json:"closesAt"`
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StartAttempt records attempt unless the student already has an active one
+// for the assignment, in which case that one is returned instead. The bool
+// reports whether attempt was created.
+func (r *repository) StartAttempt(attempt *core.AssignmentAttempt) (*core.AssignmentAttempt, bool, error) {
+	// The partial unique index settles concurrent starts; whoever loses the
+	// race reads back the winner's attempt
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "assignment_id"}, {Name: "student_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "voided_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(attempt)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return attempt, true, nil
+	}
+
+	existing, err := r.GetActiveAttempt(attempt.AssignmentID, attempt.StudentID)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+func (r *repository) GetActiveAttempt(assignmentID uuid.UUID, studentID string) (*core.AssignmentAttempt, error) {
+	var attempt core.AssignmentAttempt
+	err := r.db.Where("assignment_id = ? AND student_id = ? AND voided_at IS NULL", assignmentID, studentID).
+		First(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// VoidAttempt voids the student's active attempt so they can start again.
+// Voided attempts are kept for the record.
+func (r *repository) VoidAttempt(assignmentID uuid.UUID, studentID, voidedBy string) (*core.AssignmentAttempt, error) {
+	var attempt core.AssignmentAttempt
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("assignment_id = ? AND student_id = ? AND voided_at IS NULL", assignmentID, studentID).
+			First(&attempt).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		attempt.VoidedAt = &now
+		attempt.VoidedBy = voidedBy
+		return tx.Model(&attempt).Updates(map[string]interface{}{
+			"voided_at": now,
+			"voided_by": voidedBy,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ClassSection is a class and the section of it a student is enrolled in
+type ClassSection struct {
+	ClassID   string
+	SectionID string
+}
+
+// SaveExtension grants the extension, replacing the student's earlier one
+// for the assignment if there is one
+func (r *repository) SaveExtension(extension *core.DeadlineExtension) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "assignment_id"}, {Name: "student_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"due_date", "reason", "granted_by", "updated_at"}),
+	}).Create(extension).Error
+}
+
+func (r *repository) GetExtension(assignmentID uuid.UUID, studentID string) (*core.DeadlineExtension, error) {
+	var extension core.DeadlineExtension
+	err := r.db.Where("assignment_id = ? AND student_id = ?", assignmentID, studentID).First(&extension).Error
+	if err != nil {
+		return nil, err
+	}
+	return &extension, nil
+}
+
+func (r *repository) ListExtensions(assignmentID uuid.UUID) ([]core.DeadlineExtension, error) {
+	var extensions []core.DeadlineExtension
+	err := r.db.Where("assignment_id = ?", assignmentID).Order("student_id").Find(&extensions).Error
+	return extensions, err
+}
+
+// ListStudentExtensions returns the student's extensions for any of the
+// assignments
+func (r *repository) ListStudentExtensions(studentID string, assignmentIDs []uuid.UUID) ([]core.DeadlineExtension, error) {
+	var extensions []core.DeadlineExtension
+	if len(assignmentIDs) == 0 {
+		return extensions, nil
+	}
+	err := r.db.Where("student_id = ? AND assignment_id IN ?", studentID, assignmentIDs).Find(&extensions).Error
+	return extensions, err
+}
+
+// DeleteExtension returns gorm.ErrRecordNotFound if the student has no
+// extension for the assignment
+func (r *repository) DeleteExtension(assignmentID uuid.UUID, studentID string) error {
+	result := r.db.Where("assignment_id = ? AND student_id = ?", assignmentID, studentID).Delete(&core.DeadlineExtension{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListReleasedAssignments returns the assignments released by now that a
+// student of the sections sees: those for the whole class and those for
+// their section. They are in due date order.
+func (r *repository) ListReleasedAssignments(sections []ClassSection, now time.Time) ([]core.Assignment, error) {
+	var assignments []core.Assignment
+	if len(sections) == 0 {
+		return assignments, nil
+	}
+	visible := r.db.Where("course_id = ? AND (section_id IS NULL OR section_id = ?)", sections[0].ClassID, sections[0].SectionID)
+	for _, s := range sections[1:] {
+		visible = visible.Or("course_id = ? AND (section_id IS NULL OR section_id = ?)", s.ClassID, s.SectionID)
+	}
+	err := r.db.Where(visible).Where("release_date <= ?", now).Order("due_date, id").Find(&assignments).Error
+	return assignments, err
+}
+
+// SaveCalendarFeed sets the user's feed token, replacing their old one
+func (r *repository) SaveCalendarFeed(feed *core.CalendarFeed) error {
+	return r.db.Save(feed).Error
+}
+
+func (r *repository) GetCalendarFeed(userID string) (*core.CalendarFeed, error) {
+	var feed core.CalendarFeed
+	if err := r.db.First(&feed, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// DeleteCalendarFeed returns gorm.ErrRecordNotFound if the user has no feed
+func (r *repository) DeleteCalendarFeed(userID string) error {
+	result := r.db.Delete(&core.CalendarFeed{}, "user_id = ?", userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
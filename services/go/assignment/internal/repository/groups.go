@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrAlreadyInGroup = errors.New("student is already in a group for this assignment")
+	ErrGroupFull      = errors.New("group is full")
+	ErrGroupLocked    = errors.New("group has submitted; its members can no longer change")
+	ErrNotGroupMember = errors.New("student is not a member of this group")
+)
+
+// CreateGroup records group with its creator, group.Members[0], as the first
+// member. It fails with ErrAlreadyInGroup if the creator already has a group
+// for the assignment.
+func (r *repository) CreateGroup(group *core.SubmissionGroup) error {
+	members := group.Members
+	group.Members = nil
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].GroupID = group.ID
+			members[i].AssignmentID = group.AssignmentID
+			if err := addMember(tx, &members[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	group.Members = members
+	return err
+}
+
+func (r *repository) GetGroup(assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error) {
+	return getGroup(r.db, assignmentID, groupID)
+}
+
+// GetStudentGroup returns the group the student belongs to for the assignment
+func (r *repository) GetStudentGroup(assignmentID uuid.UUID, studentID string) (*core.SubmissionGroup, error) {
+	var member core.SubmissionGroupMember
+	err := r.db.Where("assignment_id = ? AND student_id = ?", assignmentID, studentID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getGroup(r.db, assignmentID, member.GroupID)
+}
+
+func (r *repository) ListGroups(assignmentID uuid.UUID) ([]core.SubmissionGroup, error) {
+	var groups []core.SubmissionGroup
+	err := preloadMembers(r.db).
+		Where("assignment_id = ?", assignmentID).
+		Order("created_at ASC").
+		Find(&groups).Error
+	return groups, err
+}
+
+// JoinGroup adds the student to the group unless it already has maxSize
+// members or has submitted. The group row is locked while its members are
+// counted, so concurrent joins cannot overfill it; the unique index settles a
+// student joining two groups at once.
+func (r *repository) JoinGroup(assignmentID, groupID uuid.UUID, studentID string, maxSize int) (*core.SubmissionGroup, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		group, err := lockGroup(tx, assignmentID, groupID)
+		if err != nil {
+			return err
+		}
+		if group.SubmittedAt != nil {
+			return ErrGroupLocked
+		}
+
+		var count int64
+		if err := tx.Model(&core.SubmissionGroupMember{}).Where("group_id = ?", groupID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(maxSize) {
+			return ErrGroupFull
+		}
+		return addMember(tx, &core.SubmissionGroupMember{
+			GroupID:      groupID,
+			AssignmentID: assignmentID,
+			StudentID:    studentID,
+			JoinedAt:     time.Now(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetGroup(assignmentID, groupID)
+}
+
+// LeaveGroup removes the student from the group, deleting the group once its
+// last member has left. Members of a group that has submitted cannot leave.
+func (r *repository) LeaveGroup(assignmentID, groupID uuid.UUID, studentID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		group, err := lockGroup(tx, assignmentID, groupID)
+		if err != nil {
+			return err
+		}
+		if group.SubmittedAt != nil {
+			return ErrGroupLocked
+		}
+
+		result := tx.Where("group_id = ? AND student_id = ?", groupID, studentID).Delete(&core.SubmissionGroupMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotGroupMember
+		}
+
+		var remaining int64
+		if err := tx.Model(&core.SubmissionGroupMember{}).Where("group_id = ?", groupID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return tx.Delete(group).Error
+		}
+		return nil
+	})
+}
+
+// LockGroup marks the group as submitted, keeping the time of its first
+// submission, and returns it with its final members
+func (r *repository) LockGroup(assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error) {
+	err := r.db.Model(&core.SubmissionGroup{}).
+		Where("id = ? AND assignment_id = ? AND submitted_at IS NULL", groupID, assignmentID).
+		Update("submitted_at", time.Now()).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.GetGroup(assignmentID, groupID)
+}
+
+// addMember inserts member, returning ErrAlreadyInGroup if the student has a
+// group for the assignment
+func addMember(tx *gorm.DB, member *core.SubmissionGroupMember) error {
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "assignment_id"}, {Name: "student_id"}},
+		DoNothing: true,
+	}).Create(member)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyInGroup
+	}
+	return nil
+}
+
+func getGroup(db *gorm.DB, assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error) {
+	var group core.SubmissionGroup
+	err := preloadMembers(db).First(&group, "id = ? AND assignment_id = ?", groupID, assignmentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// lockGroup loads the group for update, serializing membership changes
+func lockGroup(tx *gorm.DB, assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error) {
+	var group core.SubmissionGroup
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&group, "id = ? AND assignment_id = ?", groupID, assignmentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func preloadMembers(db *gorm.DB) *gorm.DB {
+	return db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("joined_at ASC")
+	})
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -10,9 +12,36 @@ type Repository interface {
 	AutoMigrate() error
 	CreateAssignment(assignment *core.Assignment) error
 	GetAssignmentByID(id uuid.UUID) (*core.Assignment, error)
-	ListAssignments(courseID string) ([]core.Assignment, error)
+	ListAssignments(courseID string, sectionID *uuid.UUID) ([]core.Assignment, error)
 	UpdateAssignment(assignment *core.Assignment) error
 	DeleteAssignment(id uuid.UUID) error
+	GetRubric(assignmentID uuid.UUID) (*core.Rubric, error)
+	SaveRubric(rubric *core.Rubric) error
+	DeleteRubric(assignmentID uuid.UUID) error
+	StartAttempt(attempt *core.AssignmentAttempt) (*core.AssignmentAttempt, bool, error)
+	GetActiveAttempt(assignmentID uuid.UUID, studentID string) (*core.AssignmentAttempt, error)
+	VoidAttempt(assignmentID uuid.UUID, studentID, voidedBy string) (*core.AssignmentAttempt, error)
+	CreateGroup(group *core.SubmissionGroup) error
+	GetGroup(assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error)
+	GetStudentGroup(assignmentID uuid.UUID, studentID string) (*core.SubmissionGroup, error)
+	ListGroups(assignmentID uuid.UUID) ([]core.SubmissionGroup, error)
+	JoinGroup(assignmentID, groupID uuid.UUID, studentID string, maxSize int) (*core.SubmissionGroup, error)
+	LeaveGroup(assignmentID, groupID uuid.UUID, studentID string) error
+	LockGroup(assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error)
+	SaveExtension(extension *core.DeadlineExtension) error
+	GetExtension(assignmentID uuid.UUID, studentID string) (*core.DeadlineExtension, error)
+	ListExtensions(assignmentID uuid.UUID) ([]core.DeadlineExtension, error)
+	ListStudentExtensions(studentID string, assignmentIDs []uuid.UUID) ([]core.DeadlineExtension, error)
+	DeleteExtension(assignmentID uuid.UUID, studentID string) error
+	ListReleasedAssignments(sections []ClassSection, now time.Time) ([]core.Assignment, error)
+	SaveCalendarFeed(feed *core.CalendarFeed) error
+	GetCalendarFeed(userID string) (*core.CalendarFeed, error)
+	DeleteCalendarFeed(userID string) error
+	SumClassWeights(courseID string, excludeID uuid.UUID) (int, error)
+	ListUnbalancedWeights(courseIDs []string) ([]core.ClassWeightTotal, error)
+	SaveGradingPolicy(policy *core.ClassGradingPolicy) error
+	ListGradingPolicies(courseIDs []string) ([]core.ClassGradingPolicy, error)
+	ListGradedAssignments(courseIDs []string, assignmentIDs []uuid.UUID, now time.Time) ([]core.Assignment, error)
 }
 
 type repository struct {
@@ -29,6 +58,14 @@ func (r *repository) AutoMigrate() error {
 		&core.RubricItem{},
 		&core.AssignmentConstraint{},
 		&core.AssignmentLanguage{},
+		&core.Rubric{},
+		&core.RubricCriterion{},
+		&core.AssignmentAttempt{},
+		&core.SubmissionGroup{},
+		&core.SubmissionGroupMember{},
+		&core.DeadlineExtension{},
+		&core.CalendarFeed{},
+		&core.ClassGradingPolicy{},
 	)
 }
 
@@ -45,12 +82,19 @@ func (r *repository) GetAssignmentByID(id uuid.UUID) (*core.Assignment, error) {
 	return &assignment, nil
 }
 
-func (r *repository) ListAssignments(courseID string) ([]core.Assignment, error) {
+// ListAssignments returns the assignments of a course, or of every course if
+// courseID is empty. With a sectionID only those a student of that section
+// sees are returned: the ones for the whole class and the ones for the
+// section.
+func (r *repository) ListAssignments(courseID string, sectionID *uuid.UUID) ([]core.Assignment, error) {
 	var assignments []core.Assignment
 	query := r.db.Preload("Rubric").Preload("Constraints").Preload("Languages")
 	if courseID != "" {
 		query = query.Where("course_id = ?", courseID)
 	}
+	if sectionID != nil {
+		query = query.Where("section_id IS NULL OR section_id = ?", *sectionID)
+	}
 	err := query.Find(&assignments).Error
 	return assignments, err
 }
@@ -62,3 +106,66 @@ func (r *repository) UpdateAssignment(assignment *core.Assignment) error {
 func (r *repository) DeleteAssignment(id uuid.UUID) error {
 	return r.db.Delete(&core.Assignment{}, "id = ?", id).Error
 }
+
+func (r *repository) GetRubric(assignmentID uuid.UUID) (*core.Rubric, error) {
+	var rubric core.Rubric
+	err := r.db.Preload("Criteria", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order ASC")
+	}).First(&rubric, "assignment_id = ?", assignmentID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rubric, nil
+}
+
+// SaveRubric creates the assignment's rubric or replaces the criteria of the
+// existing one
+func (r *repository) SaveRubric(rubric *core.Rubric) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var existing core.Rubric
+		result := tx.Where("assignment_id = ?", rubric.AssignmentID).Limit(1).Find(&existing)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		criteria := rubric.Criteria
+		rubric.Criteria = nil
+		if result.RowsAffected > 0 {
+			rubric.ID = existing.ID
+			rubric.CreatedAt = existing.CreatedAt
+			if err := tx.Where("rubric_id = ?", existing.ID).Delete(&core.RubricCriterion{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Save(rubric).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Create(rubric).Error; err != nil {
+			return err
+		}
+
+		for i := range criteria {
+			criteria[i].ID = uuid.Nil
+			criteria[i].RubricID = rubric.ID
+		}
+		if len(criteria) > 0 {
+			if err := tx.Create(&criteria).Error; err != nil {
+				return err
+			}
+		}
+		rubric.Criteria = criteria
+		return nil
+	})
+}
+
+func (r *repository) DeleteRubric(assignmentID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var rubric core.Rubric
+		if err := tx.First(&rubric, "assignment_id = ?", assignmentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("rubric_id = ?", rubric.ID).Delete(&core.RubricCriterion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&rubric).Error
+	})
+}
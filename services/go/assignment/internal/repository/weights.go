@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// SumClassWeights returns what the weights of the class's assignments add up
+// to, leaving out the assignment with excludeID
+func (r *repository) SumClassWeights(courseID string, excludeID uuid.UUID) (int, error) {
+	var sum int
+	err := r.db.Model(&core.Assignment{}).
+		Select("COALESCE(SUM(weight), 0)").
+		Where("course_id = ? AND id <> ?", courseID, excludeID).
+		Scan(&sum).Error
+	return sum, err
+}
+
+// ListUnbalancedWeights returns the classes, of courseIDs or of every class
+// if it is empty, whose assignment weights do not add up to 100
+func (r *repository) ListUnbalancedWeights(courseIDs []string) ([]core.ClassWeightTotal, error) {
+	totals := []core.ClassWeightTotal{}
+	query := r.db.Model(&core.Assignment{}).
+		Select("course_id, SUM(weight) AS total_weight, COUNT(*) AS assignments").
+		Group("course_id").
+		Having("SUM(weight) <> 100").
+		Order("course_id")
+	if len(courseIDs) > 0 {
+		query = query.Where("course_id IN ?", courseIDs)
+	}
+	err := query.Scan(&totals).Error
+	return totals, err
+}
+
+// SaveGradingPolicy sets the class's grading policy, replacing its old one
+func (r *repository) SaveGradingPolicy(policy *core.ClassGradingPolicy) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "course_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"missing_as_zero", "updated_at"}),
+	}).Create(policy).Error
+}
+
+// ListGradingPolicies returns the policies set for any of the classes;
+// classes without one are left out
+func (r *repository) ListGradingPolicies(courseIDs []string) ([]core.ClassGradingPolicy, error) {
+	var policies []core.ClassGradingPolicy
+	if len(courseIDs) == 0 {
+		return policies, nil
+	}
+	err := r.db.Where("course_id IN ?", courseIDs).Find(&policies).Error
+	return policies, err
+}
+
+// ListGradedAssignments returns the assignments released by now of the
+// classes, and of the classes any of assignmentIDs belongs to, in due date
+// order
+func (r *repository) ListGradedAssignments(courseIDs []string, assignmentIDs []uuid.UUID, now time.Time) ([]core.Assignment, error) {
+	var assignments []core.Assignment
+	if len(courseIDs) == 0 && len(assignmentIDs) == 0 {
+		return assignments, nil
+	}
+	// IN with an empty list is not valid SQL, so the one never matching
+	// stands in
+	if len(courseIDs) == 0 {
+		courseIDs = []string{""}
+	}
+	if len(assignmentIDs) == 0 {
+		assignmentIDs = []uuid.UUID{uuid.Nil}
+	}
+	ofAssignments := r.db.Model(&core.Assignment{}).Select("course_id").Where("id IN ?", assignmentIDs)
+	err := r.db.Where("course_id IN ? OR course_id IN (?)", courseIDs, ofAssignments).
+		Where("release_date <= ?", now).
+		Order("course_id, due_date, id").
+		Find(&assignments).Error
+	return assignments, err
+}
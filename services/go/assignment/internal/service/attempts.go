@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotTimed              = errors.New("assignment is not timed")
+	ErrAssignmentNotReleased = errors.New("assignment has not been released yet")
+	ErrAssignmentClosed      = errors.New("assignment is closed")
+	ErrNoAttempt             = errors.New("no active attempt")
+)
+
+// AttemptStatus is an attempt along with how much of it is left, for the
+// frontend's countdown
+type AttemptStatus struct {
+	*core.AssignmentAttempt
+	RemainingSeconds int64 `json:"remainingSeconds"`
+	Expired          bool  `json:"expired"`
+}
+
+func newAttemptStatus(attempt *core.AssignmentAttempt, now time.Time) *AttemptStatus {
+	remaining := attempt.EndsAt.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &AttemptStatus{
+		AssignmentAttempt: attempt,
+		RemainingSeconds:  int64(remaining / time.Second),
+		Expired:           remaining == 0,
+	}
+}
+
+// StartAttempt starts the student's clock on a timed assignment. Starting
+// again returns the attempt already running rather than resetting it; the
+// bool reports whether a new attempt was started. An attempt never runs past
+// the assignment's close date, or the student's extended due date.
+func (s *assignmentService) StartAttempt(assignmentID uuid.UUID, studentID string) (*AttemptStatus, bool, error) {
+	assignment, err := s.repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !assignment.Timed {
+		return nil, false, ErrNotTimed
+	}
+
+	now := time.Now()
+	// An attempt that is already running can still be resumed after the close
+	if existing, err := s.repo.GetActiveAttempt(assignmentID, studentID); err == nil {
+		return newAttemptStatus(existing, now), false, nil
+	}
+
+	if now.Before(assignment.ReleaseDate) {
+		return nil, false, ErrAssignmentNotReleased
+	}
+	closesAt := s.studentClosesAt(assignment, studentID)
+	if !now.Before(closesAt) {
+		return nil, false, ErrAssignmentClosed
+	}
+
+	endsAt := now.Add(time.Duration(assignment.DurationMinutes) * time.Minute)
+	if endsAt.After(closesAt) {
+		endsAt = closesAt
+	}
+	attempt, created, err := s.repo.StartAttempt(&core.AssignmentAttempt{
+		AssignmentID: assignmentID,
+		StudentID:    studentID,
+		StartedAt:    now,
+		EndsAt:       endsAt,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return newAttemptStatus(attempt, now), created, nil
+}
+
+// GetAttempt returns the student's active attempt at a timed assignment
+func (s *assignmentService) GetAttempt(assignmentID uuid.UUID, studentID string) (*AttemptStatus, error) {
+	assignment, err := s.repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if !assignment.Timed {
+		return nil, ErrNotTimed
+	}
+
+	attempt, err := s.repo.GetActiveAttempt(assignmentID, studentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoAttempt
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newAttemptStatus(attempt, time.Now()), nil
+}
+
+// VoidAttempt lets the student start the assignment again, e.g. after a
+// technical problem during their attempt
+func (s *assignmentService) VoidAttempt(assignmentID uuid.UUID, studentID, voidedBy string) (*core.AssignmentAttempt, error) {
+	attempt, err := s.repo.VoidAttempt(assignmentID, studentID, voidedBy)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoAttempt
+	}
+	return attempt, err
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+)
+
+// createTimedAssignment stores a timed assignment released an hour ago and
+// closing at closesIn from now
+func createTimedAssignment(t *testing.T, svc AssignmentService, duration int, closesIn time.Duration) *core.Assignment {
+	t.Helper()
+	now := time.Now()
+	assignment := &core.Assignment{
+		Title:           "Quiz",
+		Type:            core.AssignmentTypeLab,
+		TotalScore:      10,
+		Timed:           true,
+		DurationMinutes: duration,
+		ReleaseDate:     now.Add(-time.Hour),
+		DueDate:         now.Add(closesIn),
+	}
+	if err := svc.CreateAssignment(assignment); err != nil {
+		t.Fatal(err)
+	}
+	return assignment
+}
+
+func TestStartAttemptResumesInsteadOfRestarting(t *testing.T) {
+	svc, _ := newTestService(t)
+	assignment := createTimedAssignment(t, svc, 30, 24*time.Hour)
+
+	first, created, err := svc.StartAttempt(assignment.ID, "student-1")
+	if err != nil || !created {
+		t.Fatalf("first start: %+v, %v, %v", first, created, err)
+	}
+	if got := first.EndsAt.Sub(first.StartedAt); got != 30*time.Minute {
+		t.Errorf("attempt runs for %v, want the 30 minute duration", got)
+	}
+	again, created, err := svc.StartAttempt(assignment.ID, "student-1")
+	if err != nil || created || again.ID != first.ID || !again.EndsAt.Equal(first.EndsAt) {
+		t.Fatalf("starting again: %+v, created %v, %v; want the running attempt back", again, created, err)
+	}
+	if other, created, err := svc.StartAttempt(assignment.ID, "student-2"); err != nil || !created || other.ID == first.ID {
+		t.Errorf("another student's start: %+v, %v, %v", other, created, err)
+	}
+
+	// Voiding lets the student start over with a fresh clock
+	if _, err := svc.VoidAttempt(assignment.ID, "student-1", "instructor-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetAttempt(assignment.ID, "student-1"); !errors.Is(err, ErrNoAttempt) {
+		t.Errorf("attempt after voiding: got %v, want ErrNoAttempt", err)
+	}
+	restarted, created, err := svc.StartAttempt(assignment.ID, "student-1")
+	if err != nil || !created || restarted.ID == first.ID {
+		t.Errorf("restart after voiding: %+v, %v, %v", restarted, created, err)
+	}
+	if _, err := svc.VoidAttempt(assignment.ID, "student-3", "instructor-1"); !errors.Is(err, ErrNoAttempt) {
+		t.Errorf("voiding a missing attempt: got %v, want ErrNoAttempt", err)
+	}
+}
+
+func TestAttemptIsCappedAtTheCloseDate(t *testing.T) {
+	svc, _ := newTestService(t)
+	assignment := createTimedAssignment(t, svc, 60, 10*time.Minute)
+
+	attempt, _, err := svc.StartAttempt(assignment.ID, "student-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !attempt.EndsAt.Equal(assignment.DueDate) {
+		t.Errorf("attempt ends at %v, want the close date %v", attempt.EndsAt, assignment.DueDate)
+	}
+	if attempt.RemainingSeconds > 600 || attempt.Expired {
+		t.Errorf("remaining %ds, expired %v; want at most the 10 minutes to the close", attempt.RemainingSeconds, attempt.Expired)
+	}
+}
+
+func TestStartAttemptOutsideTheWindow(t *testing.T) {
+	svc, _ := newTestService(t)
+
+	closed := createTimedAssignment(t, svc, 30, -time.Minute)
+	if _, _, err := svc.StartAttempt(closed.ID, "student-1"); !errors.Is(err, ErrAssignmentClosed) {
+		t.Errorf("closed assignment: got %v, want ErrAssignmentClosed", err)
+	}
+
+	unreleased := &core.Assignment{Title: "Later", Type: core.AssignmentTypeLab, TotalScore: 10, Timed: true, DurationMinutes: 30,
+		ReleaseDate: time.Now().Add(time.Hour), DueDate: time.Now().Add(2 * time.Hour)}
+	if err := svc.CreateAssignment(unreleased); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.StartAttempt(unreleased.ID, "student-1"); !errors.Is(err, ErrAssignmentNotReleased) {
+		t.Errorf("unreleased assignment: got %v, want ErrAssignmentNotReleased", err)
+	}
+
+	untimed := createAssignment(t, svc, 10)
+	if _, _, err := svc.StartAttempt(untimed.ID, "student-1"); !errors.Is(err, ErrNotTimed) {
+		t.Errorf("untimed assignment: got %v, want ErrNotTimed", err)
+	}
+
+	if err := svc.CreateAssignment(&core.Assignment{Title: "Bad", Timed: true}); !errors.Is(err, ErrInvalidTiming) {
+		t.Errorf("timed assignment without a duration: got %v, want ErrInvalidTiming", err)
+	}
+}
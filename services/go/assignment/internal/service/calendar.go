@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/calendar"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidFeedToken = errors.New("invalid calendar token")
+	ErrNoCalendarFeed   = errors.New("no calendar feed")
+	ErrNotGuardian      = errors.New("not a guardian of this student")
+)
+
+// deadlineFormat is how dates are written in event descriptions
+const deadlineFormat = "Mon 2 Jan 2006 15:04 MST"
+
+// RegenerateCalendarToken issues the user a new token for their deadline
+// calendar. Feed URLs with the old one stop working.
+func (s *assignmentService) RegenerateCalendarToken(userID string) (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	if err := s.repo.SaveCalendarFeed(&core.CalendarFeed{UserID: userID, TokenHash: hashFeedToken(token)}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeCalendarToken turns the user's deadline calendar off until they
+// generate a new token
+func (s *assignmentService) RevokeCalendarToken(userID string) error {
+	err := s.repo.DeleteCalendarFeed(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoCalendarFeed
+	}
+	return err
+}
+
+// StudentCalendar returns the deadlines of the assignments released in the
+// student's classes as an iCalendar feed, if token is their current feed
+// token. Each event is at the student's due date, extensions included, in
+// the time zone of their institute.
+func (s *assignmentService) StudentCalendar(ctx context.Context, studentID, token string) ([]byte, error) {
+	feed, err := s.repo.GetCalendarFeed(studentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidFeedToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashFeedToken(token)), []byte(feed.TokenHash)) != 1 {
+		return nil, ErrInvalidFeedToken
+	}
+
+	now := time.Now()
+	assignments, extended, err := s.releasedDeadlines(ctx, studentID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := s.studentLocation(ctx, studentID)
+	cal := calendar.Calendar{Name: "GradeLoop deadlines", Location: loc}
+	for _, a := range assignments {
+		cal.Events = append(cal.Events, deadlineEvent(a, extended, loc))
+	}
+	return cal.Encode(now), nil
+}
+
+// StudentDeadlines returns the student's deadlines on the assignments
+// released in their classes, in due date order, extensions included. With
+// guardianID set the caller is that guardian, who needs an active link to
+// the student; it is checked on every request, so a revoked link cuts
+// access at once.
+func (s *assignmentService) StudentDeadlines(ctx context.Context, studentID, guardianID string) ([]core.StudentDeadline, error) {
+	if guardianID != "" {
+		linked, err := s.identity.IsGuardianOf(ctx, guardianID, studentID)
+		if err != nil {
+			return nil, fmt.Errorf("students of guardian %s: %w", guardianID, err)
+		}
+		if !linked {
+			return nil, ErrNotGuardian
+		}
+	}
+
+	assignments, extended, err := s.releasedDeadlines(ctx, studentID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	deadlines := make([]core.StudentDeadline, len(assignments))
+	for i, a := range assignments {
+		deadlines[i] = core.StudentDeadline{
+			AssignmentID: a.ID,
+			Title:        a.Title,
+			CourseID:     a.CourseID,
+			StudentID:    studentID,
+			DueDate:      a.DueDate,
+			LatePenalty:  a.LatePenalty,
+		}
+		if deadlines[i].LatePenalty.Type == "" {
+			deadlines[i].LatePenalty.Type = core.LatePenaltyNone
+		}
+		if e, ok := extended[a.ID]; ok && e.DueDate.After(a.DueDate) {
+			deadlines[i].DueDate = e.DueDate
+			deadlines[i].Extended = true
+		}
+	}
+	sort.SliceStable(deadlines, func(i, j int) bool { return deadlines[i].DueDate.Before(deadlines[j].DueDate) })
+	return deadlines, nil
+}
+
+// releasedDeadlines returns the assignments released by now in the
+// student's classes, in due date order, and the student's extensions on
+// them by assignment
+func (s *assignmentService) releasedDeadlines(ctx context.Context, studentID string, now time.Time) ([]core.Assignment, map[uuid.UUID]core.DeadlineExtension, error) {
+	enrollments, err := s.identity.GetUserEnrollments(ctx, studentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("enrollments of %s: %w", studentID, err)
+	}
+	sections := make([]repository.ClassSection, len(enrollments))
+	for i, e := range enrollments {
+		sections[i] = repository.ClassSection{ClassID: e.ClassID, SectionID: e.SectionID}
+	}
+	assignments, err := s.repo.ListReleasedAssignments(sections, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]uuid.UUID, len(assignments))
+	for i, a := range assignments {
+		ids[i] = a.ID
+	}
+	extensions, err := s.repo.ListStudentExtensions(studentID, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	extended := make(map[uuid.UUID]core.DeadlineExtension, len(extensions))
+	for _, e := range extensions {
+		extended[e.AssignmentID] = e
+	}
+	return assignments, extended, nil
+}
+
+// deadlineEvent is the assignment's due date for a student, moved to their
+// extension's if they have one
+func deadlineEvent(a core.Assignment, extended map[uuid.UUID]core.DeadlineExtension, loc *time.Location) calendar.Event {
+	event := calendar.Event{
+		// Stable across fetches so apps move the event when the date changes
+		UID:          "assignment-" + a.ID.String() + "@gradeloop",
+		Summary:      "Due: " + a.Title,
+		Description:  string(a.Type),
+		At:           a.DueDate,
+		LastModified: a.UpdatedAt,
+	}
+	if e, ok := extended[a.ID]; ok {
+		event.At = e.DueDate
+		event.Description = fmt.Sprintf("%s. Extended, originally due %s", a.Type, a.DueDate.In(loc).Format(deadlineFormat))
+		if e.UpdatedAt.After(event.LastModified) {
+			event.LastModified = e.UpdatedAt
+		}
+	} else if a.AllowLateSubmissions && a.LateDueDate != nil {
+		event.Description = fmt.Sprintf("%s. Late submissions accepted until %s", a.Type, a.LateDueDate.In(loc).Format(deadlineFormat))
+	}
+	return event
+}
+
+// studentLocation is the time zone of the student's institute. UTC is used
+// when it cannot be found, so the feed still serves correct times.
+func (s *assignmentService) studentLocation(ctx context.Context, studentID string) *time.Location {
+	tc, err := s.identity.GetTokenContext(ctx, studentID)
+	if err != nil {
+		log.Printf("Institute of student %s not found, using UTC for their calendar: %v", studentID, err)
+		return time.UTC
+	}
+	if len(tc.InstituteIDs) == 0 {
+		return time.UTC
+	}
+	institute, err := s.identity.GetInstitute(ctx, tc.InstituteIDs[0])
+	if err != nil {
+		log.Printf("Institute %s not found, using UTC for the calendar of student %s: %v", tc.InstituteIDs[0], studentID, err)
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(institute.Timezone)
+	if err != nil || institute.Timezone == "" {
+		return time.UTC
+	}
+	return loc
+}
+
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/repository"
+)
+
+// newCalendarService returns an AssignmentService whose identity service
+// enrolls every student in the class "algo101" of an institute in Berlin and
+// links each of the guardians to a student. Guardians can be unlinked while
+// the service runs.
+func newCalendarService(t *testing.T, guardians map[string]string) AssignmentService {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /internal/identity/guardians/{id}/students", func(w http.ResponseWriter, r *http.Request) {
+		students := []clients.User{}
+		if student, ok := guardians[r.PathValue("id")]; ok {
+			students = append(students, clients.User{ID: student})
+		}
+		_ = json.NewEncoder(w).Encode(students)
+	})
+	mux.HandleFunc("GET /internal/identity/users/{id}/enrollments", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]clients.Enrollment{{ClassID: "algo101"}})
+	})
+	mux.HandleFunc("GET /internal/identity/users/{id}/token-context", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(clients.TokenContext{InstituteIDs: []string{"inst-1"}, ClassIDs: []string{"algo101"}})
+	})
+	mux.HandleFunc("GET /orgs/institutes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(clients.Institute{ID: r.PathValue("id"), Timezone: "Europe/Berlin"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	_, db := newTestService(t)
+	identity := clients.NewIdentity(clients.Config{BaseURL: server.URL, MaxRetries: -1})
+	return NewAssignmentService(repository.NewRepository(db), identity)
+}
+
+// vevent is the properties of one event of a feed
+type vevent map[string]string
+
+// parseICS unfolds a feed's lines and checks that its components nest and
+// close, returning its events keyed by UID
+func parseICS(t *testing.T, feed []byte) map[string]vevent {
+	t.Helper()
+	text := string(feed)
+	if !strings.HasSuffix(text, "\r\n") || strings.Contains(strings.ReplaceAll(text, "\r\n", ""), "\n") {
+		t.Fatalf("feed lines do not all end in CRLF:\n%s", text)
+	}
+	events := map[string]vevent{}
+	var open []string
+	var event vevent
+	for _, line := range strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n ", ""), "\r\n"), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			t.Fatalf("content line without a value: %q", line)
+		}
+		switch name {
+		case "BEGIN":
+			open = append(open, value)
+			if value == "VEVENT" {
+				event = vevent{}
+			}
+		case "END":
+			if len(open) == 0 || open[len(open)-1] != value {
+				t.Fatalf("END:%s closes %v", value, open)
+			}
+			open = open[:len(open)-1]
+			if value == "VEVENT" {
+				events[event["UID"]] = event
+				event = nil
+			}
+		default:
+			if event != nil {
+				event[name] = value
+			}
+		}
+	}
+	if len(open) != 0 {
+		t.Fatalf("components left open: %v", open)
+	}
+	return events
+}
+
+func createDeadline(t *testing.T, svc AssignmentService, title string, courseID string, release, due time.Time) *core.Assignment {
+	t.Helper()
+	a := &core.Assignment{CourseID: courseID, Title: title, Type: core.AssignmentTypeLab, ReleaseDate: release, DueDate: due}
+	if err := svc.CreateAssignment(a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestDeadlineCalendarFeed(t *testing.T) {
+	svc := newCalendarService(t, nil)
+	ctx := context.Background()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	lab := createDeadline(t, svc, "Sorting lab", "algo101", now.Add(-time.Hour), now.Add(48*time.Hour))
+	exam := createDeadline(t, svc, "Midterm, part 1; graphs", "algo101", now.Add(-time.Hour), now.Add(96*time.Hour))
+	createDeadline(t, svc, "Not released", "algo101", now.Add(time.Hour), now.Add(72*time.Hour))
+	createDeadline(t, svc, "Other class", "db201", now.Add(-time.Hour), now.Add(72*time.Hour))
+
+	extended := now.Add(120 * time.Hour)
+	if _, err := svc.GrantExtension(lab.ID, "student-1", extended, "illness", "instructor-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := svc.RegenerateCalendarToken("student-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := svc.StudentCalendar(ctx, "student-1", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(feed), "BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin") {
+		t.Errorf("feed does not define the institute's zone:\n%s", feed)
+	}
+	events := parseICS(t, feed)
+	if len(events) != 2 {
+		t.Fatalf("feed has %d events, want the 2 released in the student's class", len(events))
+	}
+	labUID, examUID := "assignment-"+lab.ID.String()+"@gradeloop", "assignment-"+exam.ID.String()+"@gradeloop"
+	if got, want := events[labUID]["DTSTART;TZID=Europe/Berlin"], extended.In(berlin).Format("20060102T150405"); got != want {
+		t.Errorf("extended lab is at %s, want the extension's %s", got, want)
+	}
+	if got := events[examUID]["SUMMARY"]; got != `Due: Midterm\, part 1\; graphs` {
+		t.Errorf("exam summary = %q, want it escaped", got)
+	}
+
+	// A new token shuts the old feed URL; the events keep their UIDs, so
+	// apps move a rescheduled deadline rather than add it again
+	newToken, err := svc.RegenerateCalendarToken("student-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.StudentCalendar(ctx, "student-1", token); !errors.Is(err, ErrInvalidFeedToken) {
+		t.Errorf("feed with the replaced token: got %v, want ErrInvalidFeedToken", err)
+	}
+	exam.DueDate = exam.DueDate.Add(24 * time.Hour)
+	if err := svc.UpdateAssignment(exam); err != nil {
+		t.Fatal(err)
+	}
+	feed, err = svc.StudentCalendar(ctx, "student-1", newToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = parseICS(t, feed)
+	if got, want := events[examUID]["DTSTART;TZID=Europe/Berlin"], exam.DueDate.In(berlin).Format("20060102T150405"); got != want {
+		t.Errorf("rescheduled exam under its UID is at %q, want %s", got, want)
+	}
+	if len(events) != 2 {
+		t.Errorf("feed has %d events after rescheduling, want the same 2", len(events))
+	}
+
+	if err := svc.RevokeCalendarToken("student-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.StudentCalendar(ctx, "student-1", newToken); !errors.Is(err, ErrInvalidFeedToken) {
+		t.Errorf("feed after revoking: got %v, want ErrInvalidFeedToken", err)
+	}
+	if err := svc.RevokeCalendarToken("student-1"); !errors.Is(err, ErrNoCalendarFeed) {
+		t.Errorf("revoking twice: got %v, want ErrNoCalendarFeed", err)
+	}
+}
+
+func TestGuardianSeesOnlyALinkedStudentsDeadlines(t *testing.T) {
+	guardians := map[string]string{"guardian-1": "student-1"}
+	svc := newCalendarService(t, guardians)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	lab := createDeadline(t, svc, "Sorting lab", "algo101", now.Add(-time.Hour), now.Add(48*time.Hour))
+	exam := createDeadline(t, svc, "Midterm", "algo101", now.Add(-time.Hour), now.Add(24*time.Hour))
+	createDeadline(t, svc, "Not released", "algo101", now.Add(time.Hour), now.Add(72*time.Hour))
+	extended := now.Add(96 * time.Hour)
+	if _, err := svc.GrantExtension(lab.ID, "student-1", extended, "illness", "instructor-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadlines, err := svc.StudentDeadlines(ctx, "student-1", "guardian-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deadlines) != 2 || deadlines[0].AssignmentID != exam.ID || deadlines[1].AssignmentID != lab.ID {
+		t.Fatalf("deadlines = %+v, want the released exam then the lab", deadlines)
+	}
+	if !deadlines[1].Extended || !deadlines[1].DueDate.Equal(extended) {
+		t.Errorf("lab is due %s (extended %v), want the extension's %s", deadlines[1].DueDate, deadlines[1].Extended, extended)
+	}
+
+	if _, err := svc.StudentDeadlines(ctx, "student-2", "guardian-1"); !errors.Is(err, ErrNotGuardian) {
+		t.Errorf("another student's deadlines: got %v, want ErrNotGuardian", err)
+	}
+
+	// Revoking the link cuts access on the next request
+	delete(guardians, "guardian-1")
+	if _, err := svc.StudentDeadlines(ctx, "student-1", "guardian-1"); !errors.Is(err, ErrNotGuardian) {
+		t.Errorf("after the link was revoked: got %v, want ErrNotGuardian", err)
+	}
+}
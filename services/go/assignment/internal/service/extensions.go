@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidExtension = errors.New("invalid extension")
+	ErrNoExtension      = errors.New("no extension")
+)
+
+// GrantExtension moves the assignment's due date for one student, replacing
+// any extension they already have. The new date must be later than the
+// assignment's own.
+func (s *assignmentService) GrantExtension(assignmentID uuid.UUID, studentID string, dueDate time.Time, reason, grantedBy string) (*core.DeadlineExtension, error) {
+	assignment, err := s.repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if dueDate.IsZero() {
+		return nil, fmt.Errorf("%w: dueDate is required", ErrInvalidExtension)
+	}
+	if !dueDate.After(assignment.DueDate) {
+		return nil, fmt.Errorf("%w: dueDate must be after the assignment's due date", ErrInvalidExtension)
+	}
+
+	err = s.repo.SaveExtension(&core.DeadlineExtension{
+		AssignmentID: assignmentID,
+		StudentID:    studentID,
+		DueDate:      dueDate,
+		Reason:       strings.TrimSpace(reason),
+		GrantedBy:    grantedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetExtension(assignmentID, studentID)
+}
+
+// RevokeExtension puts the student back on the assignment's due date
+func (s *assignmentService) RevokeExtension(assignmentID uuid.UUID, studentID string) error {
+	err := s.repo.DeleteExtension(assignmentID, studentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoExtension
+	}
+	return err
+}
+
+func (s *assignmentService) ListExtensions(assignmentID uuid.UUID) ([]core.DeadlineExtension, error) {
+	if _, err := s.repo.GetAssignmentByID(assignmentID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListExtensions(assignmentID)
+}
+
+// StudentDeadline returns when the assignment is due for the student, which
+// their extension moves, and its late penalty, so late submissions can be
+// penalised from the right date
+func (s *assignmentService) StudentDeadline(assignmentID uuid.UUID, studentID string) (*core.StudentDeadline, error) {
+	assignment, err := s.repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	deadline := &core.StudentDeadline{
+		AssignmentID: assignment.ID,
+		Title:        assignment.Title,
+		CourseID:     assignment.CourseID,
+		StudentID:    studentID,
+		DueDate:      assignment.DueDate,
+		LatePenalty:  assignment.LatePenalty,
+	}
+	if deadline.LatePenalty.Type == "" {
+		deadline.LatePenalty.Type = core.LatePenaltyNone
+	}
+	extension, err := s.repo.GetExtension(assignmentID, studentID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if extension != nil && extension.DueDate.After(deadline.DueDate) {
+		deadline.DueDate = extension.DueDate
+		deadline.Extended = true
+	}
+	return deadline, nil
+}
+
+// studentClosesAt is when the assignment closes for the student, taking
+// their extension into account
+func (s *assignmentService) studentClosesAt(assignment *core.Assignment, studentID string) time.Time {
+	closesAt := assignment.ClosesAt()
+	if extension, err := s.repo.GetExtension(assignment.ID, studentID); err == nil && extension.DueDate.After(closesAt) {
+		closesAt = extension.DueDate
+	}
+	return closesAt
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrGroupsDisabled = errors.New("assignment does not allow group submissions")
+	ErrNoGroup        = errors.New("student is not in a group for this assignment")
+	ErrGroupNotFound  = repository.ErrGroupNotFound
+	ErrAlreadyInGroup = repository.ErrAlreadyInGroup
+	ErrGroupFull      = repository.ErrGroupFull
+	ErrGroupLocked    = repository.ErrGroupLocked
+	ErrNotGroupMember = repository.ErrNotGroupMember
+)
+
+// CreateGroup starts a group for a group assignment with the student as its
+// first member
+func (s *assignmentService) CreateGroup(assignmentID uuid.UUID, studentID, name string) (*core.SubmissionGroup, error) {
+	if _, err := s.groupAssignment(assignmentID); err != nil {
+		return nil, err
+	}
+
+	group := &core.SubmissionGroup{
+		AssignmentID: assignmentID,
+		Name:         strings.TrimSpace(name),
+		CreatedBy:    studentID,
+		Members:      []core.SubmissionGroupMember{{StudentID: studentID, JoinedAt: time.Now()}},
+	}
+	if err := s.repo.CreateGroup(group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// JoinGroup adds the student to a group that has room for them and has not
+// submitted yet
+func (s *assignmentService) JoinGroup(assignmentID, groupID uuid.UUID, studentID string) (*core.SubmissionGroup, error) {
+	assignment, err := s.groupAssignment(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.JoinGroup(assignmentID, groupID, studentID, assignment.GroupSizeLimit)
+}
+
+// LeaveGroup takes the student out of a group that has not submitted yet
+func (s *assignmentService) LeaveGroup(assignmentID, groupID uuid.UUID, studentID string) error {
+	return s.repo.LeaveGroup(assignmentID, groupID, studentID)
+}
+
+func (s *assignmentService) GetGroup(assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error) {
+	return s.repo.GetGroup(assignmentID, groupID)
+}
+
+// GetStudentGroup returns the group the student belongs to for the assignment
+func (s *assignmentService) GetStudentGroup(assignmentID uuid.UUID, studentID string) (*core.SubmissionGroup, error) {
+	group, err := s.repo.GetStudentGroup(assignmentID, studentID)
+	if errors.Is(err, repository.ErrGroupNotFound) {
+		return nil, ErrNoGroup
+	}
+	return group, err
+}
+
+func (s *assignmentService) ListGroups(assignmentID uuid.UUID) ([]core.SubmissionGroup, error) {
+	if _, err := s.repo.GetAssignmentByID(assignmentID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListGroups(assignmentID)
+}
+
+// LockGroup is called by the Submission Service when a group submits. From
+// then on nobody can join or leave the group, so the grade of its submission
+// applies to exactly the members returned.
+func (s *assignmentService) LockGroup(assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error) {
+	return s.repo.LockGroup(assignmentID, groupID)
+}
+
+// groupAssignment loads the assignment, failing unless it takes group
+// submissions
+func (s *assignmentService) groupAssignment(assignmentID uuid.UUID) (*core.Assignment, error) {
+	assignment, err := s.repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if !assignment.EnableGroupSubmissions {
+		return nil, ErrGroupsDisabled
+	}
+	return assignment, nil
+}
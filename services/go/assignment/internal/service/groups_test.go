@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+)
+
+func createGroupAssignment(t *testing.T, svc AssignmentService, groups bool, sizeLimit int) *core.Assignment {
+	t.Helper()
+	now := time.Now()
+	assignment := &core.Assignment{
+		Title:                  "Project",
+		Type:                   core.AssignmentTypeLab,
+		TotalScore:             10,
+		EnableGroupSubmissions: groups,
+		GroupSizeLimit:         sizeLimit,
+		ReleaseDate:            now.Add(-time.Hour),
+		DueDate:                now.Add(24 * time.Hour),
+	}
+	if err := svc.CreateAssignment(assignment); err != nil {
+		t.Fatal(err)
+	}
+	return assignment
+}
+
+func TestGroupMembership(t *testing.T) {
+	svc, _ := newTestService(t)
+	assignment := createGroupAssignment(t, svc, true, 2)
+
+	group, err := svc.CreateGroup(assignment.ID, "ada", " Team A ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.Name != "Team A" || len(group.Members) != 1 || group.Members[0].StudentID != "ada" {
+		t.Fatalf("created %+v, want the creator as first member", group)
+	}
+	if _, err := svc.CreateGroup(assignment.ID, "ada", "Team B"); !errors.Is(err, ErrAlreadyInGroup) {
+		t.Errorf("second group for the same student = %v, want ErrAlreadyInGroup", err)
+	}
+
+	if group, err = svc.JoinGroup(assignment.ID, group.ID, "bob"); err != nil || len(group.Members) != 2 {
+		t.Fatalf("join = %+v, %v", group, err)
+	}
+	if _, err := svc.JoinGroup(assignment.ID, group.ID, "cy"); !errors.Is(err, ErrGroupFull) {
+		t.Errorf("joining a full group = %v, want ErrGroupFull", err)
+	}
+	if got, err := svc.GetStudentGroup(assignment.ID, "bob"); err != nil || got.ID != group.ID {
+		t.Errorf("bob's group = %v, %v", got, err)
+	}
+	if _, err := svc.GetStudentGroup(assignment.ID, "cy"); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("group of a student without one = %v, want ErrNoGroup", err)
+	}
+
+	// The last member leaving deletes the group
+	if err := svc.LeaveGroup(assignment.ID, group.ID, "cy"); !errors.Is(err, ErrNotGroupMember) {
+		t.Errorf("non-member leaving = %v, want ErrNotGroupMember", err)
+	}
+	for _, student := range []string{"ada", "bob"} {
+		if err := svc.LeaveGroup(assignment.ID, group.ID, student); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.GetGroup(assignment.ID, group.ID); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("group after everyone left = %v, want ErrGroupNotFound", err)
+	}
+}
+
+func TestSubmittedGroupIsLocked(t *testing.T) {
+	svc, _ := newTestService(t)
+	assignment := createGroupAssignment(t, svc, true, 3)
+	group, err := svc.CreateGroup(assignment.ID, "ada", "Team A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.JoinGroup(assignment.ID, group.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	locked, err := svc.LockGroup(assignment.ID, group.ID)
+	if err != nil || locked.SubmittedAt == nil || len(locked.Members) != 2 {
+		t.Fatalf("lock = %+v, %v; want the submitted group with both members", locked, err)
+	}
+	first := *locked.SubmittedAt
+	if again, err := svc.LockGroup(assignment.ID, group.ID); err != nil || !again.SubmittedAt.Equal(first) {
+		t.Errorf("locking again = %v, %v; want the first submission time kept", again.SubmittedAt, err)
+	}
+
+	if _, err := svc.JoinGroup(assignment.ID, group.ID, "cy"); !errors.Is(err, ErrGroupLocked) {
+		t.Errorf("joining a submitted group = %v, want ErrGroupLocked", err)
+	}
+	if err := svc.LeaveGroup(assignment.ID, group.ID, "bob"); !errors.Is(err, ErrGroupLocked) {
+		t.Errorf("leaving a submitted group = %v, want ErrGroupLocked", err)
+	}
+}
+
+func TestGroupsNeedGroupAssignment(t *testing.T) {
+	svc, _ := newTestService(t)
+	assignment := createGroupAssignment(t, svc, false, 0)
+	if _, err := svc.CreateGroup(assignment.ID, "ada", "Team A"); !errors.Is(err, ErrGroupsDisabled) {
+		t.Errorf("group for an individual assignment = %v, want ErrGroupsDisabled", err)
+	}
+}
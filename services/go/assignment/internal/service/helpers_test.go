@@ -0,0 +1,95 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/repository"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an in-memory SQLite database with the tables of models.
+// The models default their IDs to Postgres' gen_random_uuid(), which SQLite
+// lacks, so the default is left out of the tables and IDs are filled in
+// before each create instead.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if strings.Contains(field.DefaultValue, "gen_random_uuid") {
+				field.HasDefaultValue, field.DefaultValue = false, ""
+			}
+		}
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Callback().Create().Before("gorm:create").Register("test:uuid", func(tx *gorm.DB) {
+		if tx.Statement.Schema == nil || tx.Statement.Schema.PrioritizedPrimaryField == nil {
+			return
+		}
+		field := tx.Statement.Schema.PrioritizedPrimaryField
+		if field.FieldType != reflect.TypeOf(uuid.UUID{}) {
+			return
+		}
+		fill := func(rv reflect.Value) {
+			if _, zero := field.ValueOf(tx.Statement.Context, rv); zero {
+				_ = field.Set(tx.Statement.Context, rv, uuid.New())
+			}
+		}
+		switch rv := tx.Statement.ReflectValue; rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				fill(reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			fill(rv)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestService returns an AssignmentService over an in-memory database
+// with the assignment, rubric, attempt, group and calendar tables. It has
+// no identity client; see newCalendarService.
+func newTestService(t *testing.T) (AssignmentService, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t,
+		&core.Assignment{},
+		&core.RubricItem{},
+		&core.AssignmentConstraint{},
+		&core.AssignmentLanguage{},
+		&core.Rubric{},
+		&core.RubricCriterion{},
+		&core.AssignmentAttempt{},
+		&core.SubmissionGroup{},
+		&core.SubmissionGroupMember{},
+		&core.DeadlineExtension{},
+		&core.CalendarFeed{},
+	)
+	return NewAssignmentService(repository.NewRepository(db), nil), db
+}
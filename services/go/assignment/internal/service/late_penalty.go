@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+)
+
+var ErrInvalidLatePenalty = errors.New("invalid late penalty")
+
+// validateLatePenalty checks the assignment's late penalty makes sense,
+// defaulting an unset type to none. Parameters of other types must be left
+// out, so a policy never reads as stricter or milder than it is.
+func validateLatePenalty(assignment *core.Assignment) error {
+	p := &assignment.LatePenalty
+	if p.Type == "" {
+		p.Type = core.LatePenaltyNone
+	}
+	if p.GraceMinutes < 0 {
+		return fmt.Errorf("%w: graceMinutes must be 0 or more", ErrInvalidLatePenalty)
+	}
+
+	percent := p.PercentPerDay != 0 || p.MaxPercent != 0
+	fixed := p.PointsPerInterval != 0 || p.IntervalMinutes != 0 || p.MaxPoints != 0
+	cutoff := p.CutoffMinutes != 0
+
+	switch p.Type {
+	case core.LatePenaltyNone:
+		if percent || fixed || cutoff || p.GraceMinutes != 0 {
+			return fmt.Errorf("%w: a none policy takes no parameters", ErrInvalidLatePenalty)
+		}
+	case core.LatePenaltyPercentPerDay:
+		if fixed || cutoff {
+			return fmt.Errorf("%w: percent_per_day only takes percentPerDay and maxPercent", ErrInvalidLatePenalty)
+		}
+		if p.PercentPerDay < 1 || p.PercentPerDay > 100 {
+			return fmt.Errorf("%w: percentPerDay must be between 1 and 100", ErrInvalidLatePenalty)
+		}
+		if p.MaxPercent < 0 || p.MaxPercent > 100 {
+			return fmt.Errorf("%w: maxPercent must be between 0 (no cap) and 100", ErrInvalidLatePenalty)
+		}
+	case core.LatePenaltyFixedPerInterval:
+		if percent || cutoff {
+			return fmt.Errorf("%w: fixed_per_interval only takes pointsPerInterval, intervalMinutes and maxPoints", ErrInvalidLatePenalty)
+		}
+		if p.PointsPerInterval < 1 || p.IntervalMinutes < 1 {
+			return fmt.Errorf("%w: pointsPerInterval and intervalMinutes must be at least 1", ErrInvalidLatePenalty)
+		}
+		if p.MaxPoints < 0 {
+			return fmt.Errorf("%w: maxPoints must be 0 (no cap) or more", ErrInvalidLatePenalty)
+		}
+		if p.PointsPerInterval > assignment.TotalScore || p.MaxPoints > assignment.TotalScore {
+			return fmt.Errorf("%w: pointsPerInterval and maxPoints cannot exceed totalScore", ErrInvalidLatePenalty)
+		}
+	case core.LatePenaltyCutoff:
+		if percent || fixed {
+			return fmt.Errorf("%w: cutoff only takes cutoffMinutes", ErrInvalidLatePenalty)
+		}
+		if p.CutoffMinutes < 0 {
+			return fmt.Errorf("%w: cutoffMinutes must be 0 or more", ErrInvalidLatePenalty)
+		}
+	default:
+		return fmt.Errorf("%w: type must be none, percent_per_day, fixed_per_interval or cutoff", ErrInvalidLatePenalty)
+	}
+	return nil
+}
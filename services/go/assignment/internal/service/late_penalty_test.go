@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+)
+
+func TestLatePenaltyIsValidated(t *testing.T) {
+	svc, _ := newTestService(t)
+	now := time.Now().Truncate(time.Second)
+	create := func(penalty core.LatePenaltyPolicy) (*core.Assignment, error) {
+		a := &core.Assignment{CourseID: "algo101", Title: "Sorting lab", Type: core.AssignmentTypeLab,
+			ReleaseDate: now, DueDate: now.Add(48 * time.Hour), TotalScore: 100, LatePenalty: penalty}
+		return a, svc.CreateAssignment(a)
+	}
+
+	for name, penalty := range map[string]core.LatePenaltyPolicy{
+		"unknown type":             {Type: "halve"},
+		"negative grace":           {Type: core.LatePenaltyCutoff, GraceMinutes: -1},
+		"none with a grace period": {Type: core.LatePenaltyNone, GraceMinutes: 10},
+		"none with parameters":     {PercentPerDay: 10},
+		"no percent per day":       {Type: core.LatePenaltyPercentPerDay},
+		"over 100 percent per day": {Type: core.LatePenaltyPercentPerDay, PercentPerDay: 101},
+		"cap over 100 percent":     {Type: core.LatePenaltyPercentPerDay, PercentPerDay: 10, MaxPercent: 101},
+		"percent with an interval": {Type: core.LatePenaltyPercentPerDay, PercentPerDay: 10, IntervalMinutes: 60},
+		"no interval":              {Type: core.LatePenaltyFixedPerInterval, PointsPerInterval: 5},
+		"no points per interval":   {Type: core.LatePenaltyFixedPerInterval, IntervalMinutes: 60},
+		"points over the total":    {Type: core.LatePenaltyFixedPerInterval, PointsPerInterval: 101, IntervalMinutes: 60},
+		"cap over the total":       {Type: core.LatePenaltyFixedPerInterval, PointsPerInterval: 5, IntervalMinutes: 60, MaxPoints: 101},
+		"negative cap":             {Type: core.LatePenaltyFixedPerInterval, PointsPerInterval: 5, IntervalMinutes: 60, MaxPoints: -1},
+		"cutoff with a percent":    {Type: core.LatePenaltyCutoff, CutoffMinutes: 60, PercentPerDay: 10},
+		"negative cutoff":          {Type: core.LatePenaltyCutoff, CutoffMinutes: -1},
+	} {
+		if _, err := create(penalty); !errors.Is(err, ErrInvalidLatePenalty) {
+			t.Errorf("%s: create = %v, want ErrInvalidLatePenalty", name, err)
+		}
+	}
+
+	for name, penalty := range map[string]core.LatePenaltyPolicy{
+		"percent per day":    {Type: core.LatePenaltyPercentPerDay, GraceMinutes: 15, PercentPerDay: 10, MaxPercent: 50},
+		"fixed per interval": {Type: core.LatePenaltyFixedPerInterval, PointsPerInterval: 5, IntervalMinutes: 60, MaxPoints: 100},
+		"cutoff":             {Type: core.LatePenaltyCutoff, CutoffMinutes: 3 * 24 * 60},
+		"cutoff at the date": {Type: core.LatePenaltyCutoff},
+	} {
+		if _, err := create(penalty); err != nil {
+			t.Errorf("%s: create = %v", name, err)
+		}
+	}
+
+	a, err := create(core.LatePenaltyPolicy{})
+	if err != nil || a.LatePenalty.Type != core.LatePenaltyNone {
+		t.Errorf("no late penalty: create = %v with type %q, want none", err, a.LatePenalty.Type)
+	}
+}
+
+func TestStudentDeadlineFollowsExtensions(t *testing.T) {
+	svc, _ := newTestService(t)
+	now := time.Now().Truncate(time.Second)
+	penalty := core.LatePenaltyPolicy{Type: core.LatePenaltyPercentPerDay, PercentPerDay: 10, MaxPercent: 50}
+	a := &core.Assignment{CourseID: "algo101", Title: "Sorting lab", Type: core.AssignmentTypeLab,
+		ReleaseDate: now, DueDate: now.Add(48 * time.Hour), TotalScore: 100, LatePenalty: penalty}
+	if err := svc.CreateAssignment(a); err != nil {
+		t.Fatal(err)
+	}
+	extended := now.Add(96 * time.Hour)
+	if _, err := svc.GrantExtension(a.ID, "student-1", extended, "illness", "instructor-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline, err := svc.StudentDeadline(a.ID, "student-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deadline.Extended || !deadline.DueDate.Equal(extended) || deadline.LatePenalty != penalty {
+		t.Errorf("extended student's deadline = %+v, want the extension's %s and the assignment's penalty", deadline, extended)
+	}
+
+	deadline, err = svc.StudentDeadline(a.ID, "student-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deadline.Extended || !deadline.DueDate.Equal(a.DueDate) || deadline.LatePenalty != penalty {
+		t.Errorf("other student's deadline = %+v, want the assignment's %s", deadline, a.DueDate)
+	}
+
+	if err := svc.RevokeExtension(a.ID, "student-1"); err != nil {
+		t.Fatal(err)
+	}
+	if deadline, err = svc.StudentDeadline(a.ID, "student-1"); err != nil || deadline.Extended {
+		t.Errorf("deadline after revoking the extension = %+v, %v, want the assignment's", deadline, err)
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+)
+
+func createAssignment(t *testing.T, svc AssignmentService, totalScore int) *core.Assignment {
+	t.Helper()
+	assignment := &core.Assignment{Title: "Lab 1", Type: core.AssignmentTypeLab, TotalScore: totalScore}
+	if err := svc.CreateAssignment(assignment); err != nil {
+		t.Fatal(err)
+	}
+	return assignment
+}
+
+func TestRubricCriteriaMustAddUpToTotal(t *testing.T) {
+	svc, _ := newTestService(t)
+	assignment := createAssignment(t, svc, 100)
+
+	tests := []struct {
+		name     string
+		criteria []core.RubricCriterion
+		valid    bool
+	}{
+		{"under the total", []core.RubricCriterion{{Name: "Correctness", MaxPoints: 60}, {Name: "Style", MaxPoints: 30}}, false},
+		{"over the total", []core.RubricCriterion{{Name: "Correctness", MaxPoints: 80}, {Name: "Style", MaxPoints: 30}}, false},
+		{"no criteria", nil, false},
+		{"unnamed criterion", []core.RubricCriterion{{Name: " ", MaxPoints: 100}}, false},
+		{"zero points", []core.RubricCriterion{{Name: "Correctness", MaxPoints: 100}, {Name: "Style", MaxPoints: 0}}, false},
+		{"exactly the total", []core.RubricCriterion{{Name: "Correctness", MaxPoints: 70}, {Name: "Style", MaxPoints: 30}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.SaveRubric(assignment.ID, tt.criteria)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidRubric) {
+				t.Fatalf("got %v, want ErrInvalidRubric", err)
+			}
+		})
+	}
+
+	rubric, err := svc.GetRubric(assignment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rubric.Criteria) != 2 || rubric.Criteria[0].Name != "Correctness" || rubric.Criteria[0].Order != 1 || rubric.Criteria[1].Order != 2 {
+		t.Fatalf("stored criteria %+v", rubric.Criteria)
+	}
+}
+
+func TestRubricReplacesCriteria(t *testing.T) {
+	svc, _ := newTestService(t)
+	assignment := createAssignment(t, svc, 10)
+
+	if _, err := svc.SaveRubric(assignment.ID, []core.RubricCriterion{{Name: "A", MaxPoints: 5}, {Name: "B", MaxPoints: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SaveRubric(assignment.ID, []core.RubricCriterion{{Name: "Only", MaxPoints: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	rubric, err := svc.GetRubric(assignment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rubric.Criteria) != 1 || rubric.Criteria[0].Name != "Only" {
+		t.Fatalf("criteria after replacing %+v", rubric.Criteria)
+	}
+}
+
+func TestChangingTotalMustKeepRubricBalanced(t *testing.T) {
+	svc, _ := newTestService(t)
+	assignment := createAssignment(t, svc, 10)
+	if _, err := svc.SaveRubric(assignment.ID, []core.RubricCriterion{{Name: "A", MaxPoints: 10}}); err != nil {
+		t.Fatal(err)
+	}
+
+	assignment.TotalScore = 20
+	if err := svc.UpdateAssignment(assignment); !errors.Is(err, ErrInvalidRubric) {
+		t.Fatalf("raising the total past the rubric: got %v, want ErrInvalidRubric", err)
+	}
+}
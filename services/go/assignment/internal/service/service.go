@@ -1,6 +1,14 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
 	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
 	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/repository"
 	"github.com/google/uuid"
@@ -9,21 +17,68 @@ import (
 type AssignmentService interface {
 	CreateAssignment(assignment *core.Assignment) error
 	GetAssignment(id uuid.UUID) (*core.Assignment, error)
-	ListAssignments(courseID string) ([]core.Assignment, error)
+	ListAssignments(courseID string, sectionID *uuid.UUID) ([]core.Assignment, error)
 	UpdateAssignment(assignment *core.Assignment) error
 	DeleteAssignment(id uuid.UUID) error
+	GetRubric(assignmentID uuid.UUID) (*core.Rubric, error)
+	SaveRubric(assignmentID uuid.UUID, criteria []core.RubricCriterion) (*core.Rubric, error)
+	DeleteRubric(assignmentID uuid.UUID) error
+	StartAttempt(assignmentID uuid.UUID, studentID string) (*AttemptStatus, bool, error)
+	GetAttempt(assignmentID uuid.UUID, studentID string) (*AttemptStatus, error)
+	VoidAttempt(assignmentID uuid.UUID, studentID, voidedBy string) (*core.AssignmentAttempt, error)
+	CreateGroup(assignmentID uuid.UUID, studentID, name string) (*core.SubmissionGroup, error)
+	JoinGroup(assignmentID, groupID uuid.UUID, studentID string) (*core.SubmissionGroup, error)
+	LeaveGroup(assignmentID, groupID uuid.UUID, studentID string) error
+	GetGroup(assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error)
+	GetStudentGroup(assignmentID uuid.UUID, studentID string) (*core.SubmissionGroup, error)
+	ListGroups(assignmentID uuid.UUID) ([]core.SubmissionGroup, error)
+	LockGroup(assignmentID, groupID uuid.UUID) (*core.SubmissionGroup, error)
+	GrantExtension(assignmentID uuid.UUID, studentID string, dueDate time.Time, reason, grantedBy string) (*core.DeadlineExtension, error)
+	RevokeExtension(assignmentID uuid.UUID, studentID string) error
+	ListExtensions(assignmentID uuid.UUID) ([]core.DeadlineExtension, error)
+	StudentDeadline(assignmentID uuid.UUID, studentID string) (*core.StudentDeadline, error)
+	RegenerateCalendarToken(userID string) (string, error)
+	RevokeCalendarToken(userID string) error
+	StudentCalendar(ctx context.Context, studentID, token string) ([]byte, error)
+	StudentDeadlines(ctx context.Context, studentID, guardianID string) ([]core.StudentDeadline, error)
+	WeightReport(courseIDs []string) ([]core.ClassWeightTotal, error)
+	GetGradingPolicy(courseID string) (*core.ClassGradingPolicy, error)
+	SetGradingPolicy(policy *core.ClassGradingPolicy) error
+	StudentGradeWeights(studentID string, courseIDs []string, assignmentIDs []uuid.UUID) ([]core.ClassGradeWeights, error)
 }
 
+var (
+	ErrInvalidRubric = errors.New("invalid rubric")
+	ErrInvalidTiming = errors.New("invalid timing")
+	ErrInvalidGroups = errors.New("invalid group settings")
+	ErrInvalidLimit  = errors.New("invalid attempt limit")
+)
+
 type assignmentService struct {
-	repo repository.Repository
+	repo     repository.Repository
+	identity *clients.Identity
 }
 
-func NewAssignmentService(repo repository.Repository) AssignmentService {
-	return &assignmentService{repo: repo}
+func NewAssignmentService(repo repository.Repository, identity *clients.Identity) AssignmentService {
+	return &assignmentService{repo: repo, identity: identity}
 }
 
 func (s *assignmentService) CreateAssignment(assignment *core.Assignment) error {
-	// Add any business validation here
+	if err := validateTiming(assignment); err != nil {
+		return err
+	}
+	if err := validateGroups(assignment); err != nil {
+		return err
+	}
+	if assignment.TotalAttempts < 0 {
+		return fmt.Errorf("%w: totalAttempts must be 0 (unlimited) or more", ErrInvalidLimit)
+	}
+	if err := validateLatePenalty(assignment); err != nil {
+		return err
+	}
+	if err := s.validateWeight(assignment); err != nil {
+		return err
+	}
 	return s.repo.CreateAssignment(assignment)
 }
 
@@ -31,14 +86,103 @@ func (s *assignmentService) GetAssignment(id uuid.UUID) (*core.Assignment, error
 	return s.repo.GetAssignmentByID(id)
 }
 
-func (s *assignmentService) ListAssignments(courseID string) ([]core.Assignment, error) {
-	return s.repo.ListAssignments(courseID)
+func (s *assignmentService) ListAssignments(courseID string, sectionID *uuid.UUID) ([]core.Assignment, error) {
+	return s.repo.ListAssignments(courseID, sectionID)
 }
 
 func (s *assignmentService) UpdateAssignment(assignment *core.Assignment) error {
+	if err := validateTiming(assignment); err != nil {
+		return err
+	}
+	if err := validateGroups(assignment); err != nil {
+		return err
+	}
+	if assignment.TotalAttempts < 0 {
+		return fmt.Errorf("%w: totalAttempts must be 0 (unlimited) or more", ErrInvalidLimit)
+	}
+	if err := validateLatePenalty(assignment); err != nil {
+		return err
+	}
+	if err := s.validateWeight(assignment); err != nil {
+		return err
+	}
+	// Changing the total would leave an existing rubric out of balance
+	if rubric, err := s.repo.GetRubric(assignment.ID); err == nil {
+		if err := validateRubricTotal(rubric.Criteria, assignment.TotalScore); err != nil {
+			return err
+		}
+	}
 	return s.repo.UpdateAssignment(assignment)
 }
 
 func (s *assignmentService) DeleteAssignment(id uuid.UUID) error {
 	return s.repo.DeleteAssignment(id)
 }
+
+func (s *assignmentService) GetRubric(assignmentID uuid.UUID) (*core.Rubric, error) {
+	return s.repo.GetRubric(assignmentID)
+}
+
+func (s *assignmentService) SaveRubric(assignmentID uuid.UUID, criteria []core.RubricCriterion) (*core.Rubric, error) {
+	assignment, err := s.repo.GetAssignmentByID(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(criteria) == 0 {
+		return nil, fmt.Errorf("%w: at least one criterion is required", ErrInvalidRubric)
+	}
+	for i := range criteria {
+		criteria[i].Name = strings.TrimSpace(criteria[i].Name)
+		if criteria[i].Name == "" {
+			return nil, fmt.Errorf("%w: criterion %d has no name", ErrInvalidRubric, i+1)
+		}
+		if criteria[i].MaxPoints <= 0 {
+			return nil, fmt.Errorf("%w: criterion %q must be worth more than 0 points", ErrInvalidRubric, criteria[i].Name)
+		}
+	}
+	if err := validateRubricTotal(criteria, assignment.TotalScore); err != nil {
+		return nil, err
+	}
+
+	// Keep the submitted order stable unless explicit orders were given
+	sort.SliceStable(criteria, func(i, j int) bool { return criteria[i].Order < criteria[j].Order })
+	for i := range criteria {
+		criteria[i].Order = i + 1
+	}
+
+	rubric := &core.Rubric{AssignmentID: assignmentID, Criteria: criteria}
+	if err := s.repo.SaveRubric(rubric); err != nil {
+		return nil, err
+	}
+	return rubric, nil
+}
+
+func (s *assignmentService) DeleteRubric(assignmentID uuid.UUID) error {
+	return s.repo.DeleteRubric(assignmentID)
+}
+
+func validateRubricTotal(criteria []core.RubricCriterion, totalScore int) error {
+	sum := 0
+	for _, c := range criteria {
+		sum += c.MaxPoints
+	}
+	if sum != totalScore {
+		return fmt.Errorf("%w: criteria max points add up to %d but the assignment is worth %d", ErrInvalidRubric, sum, totalScore)
+	}
+	return nil
+}
+
+func validateTiming(assignment *core.Assignment) error {
+	if assignment.Timed && assignment.DurationMinutes <= 0 {
+		return fmt.Errorf("%w: timed assignments need a durationMinutes greater than 0", ErrInvalidTiming)
+	}
+	return nil
+}
+
+func validateGroups(assignment *core.Assignment) error {
+	if assignment.EnableGroupSubmissions && assignment.GroupSizeLimit < 2 {
+		return fmt.Errorf("%w: group submissions need a groupSizeLimit of at least 2", ErrInvalidGroups)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/google/uuid"
+)
+
+func TestStudentListsOnlyTheirSectionsAssignments(t *testing.T) {
+	svc, _ := newTestService(t)
+	sectionA, sectionB := uuid.New(), uuid.New()
+	for _, a := range []*core.Assignment{
+		{CourseID: "phy101", Title: "Whole class"},
+		{CourseID: "phy101", Title: "Section A lab", SectionID: &sectionA},
+		{CourseID: "phy101", Title: "Section B lab", SectionID: &sectionB},
+		{CourseID: "chem101", Title: "Other course"},
+	} {
+		if err := svc.CreateAssignment(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	titles := func(sectionID *uuid.UUID) []string {
+		t.Helper()
+		assignments, err := svc.ListAssignments("phy101", sectionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, a := range assignments {
+			out = append(out, a.Title)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	if got := titles(&sectionA); len(got) != 2 || got[0] != "Section A lab" || got[1] != "Whole class" {
+		t.Errorf("section A sees %v, want its lab and the whole class's assignment", got)
+	}
+	if got := titles(nil); len(got) != 3 {
+		t.Errorf("the course lists %v, want all 3 of its assignments", got)
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/assignment/internal/core"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidWeight = errors.New("invalid weight")
+
+// validateWeight checks the assignment's weight is a percentage and that,
+// with it, the weights of its class add up to at most 100. Classes are
+// weighted one assignment at a time, so falling short of 100 is allowed;
+// WeightReport lists the classes that do.
+func (s *assignmentService) validateWeight(assignment *core.Assignment) error {
+	if assignment.Weight < 0 || assignment.Weight > 100 {
+		return fmt.Errorf("%w: weight must be between 0 and 100", ErrInvalidWeight)
+	}
+	if assignment.Weight == 0 {
+		return nil
+	}
+	others, err := s.repo.SumClassWeights(assignment.CourseID, assignment.ID)
+	if err != nil {
+		return err
+	}
+	if others+assignment.Weight > 100 {
+		return fmt.Errorf("%w: the class's other assignments already weigh %d, so this one can weigh at most %d", ErrInvalidWeight, others, 100-others)
+	}
+	return nil
+}
+
+// WeightReport returns the classes, of courseIDs or of every class if it is
+// empty, whose assignment weights do not add up to 100
+func (s *assignmentService) WeightReport(courseIDs []string) ([]core.ClassWeightTotal, error) {
+	return s.repo.ListUnbalancedWeights(courseIDs)
+}
+
+// GetGradingPolicy returns the class's grading policy, the default one if
+// it has not been set
+func (s *assignmentService) GetGradingPolicy(courseID string) (*core.ClassGradingPolicy, error) {
+	policies, err := s.repo.ListGradingPolicies([]string{courseID})
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return &core.ClassGradingPolicy{CourseID: courseID}, nil
+	}
+	return &policies[0], nil
+}
+
+func (s *assignmentService) SetGradingPolicy(policy *core.ClassGradingPolicy) error {
+	return s.repo.SaveGradingPolicy(policy)
+}
+
+// StudentGradeWeights returns, for the classes and the classes any of
+// assignmentIDs belongs to, the released assignments with their weights as
+// they count towards the student's grade, and each class's grading policy.
+// Whether the student sees a section's assignments is left to the caller,
+// which knows their sections.
+func (s *assignmentService) StudentGradeWeights(studentID string, courseIDs []string, assignmentIDs []uuid.UUID) ([]core.ClassGradeWeights, error) {
+	assignments, err := s.repo.ListGradedAssignments(courseIDs, assignmentIDs, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	classes := []core.ClassGradeWeights{}
+	byCourse := make(map[string]int)
+	for _, id := range courseIDs {
+		if _, ok := byCourse[id]; !ok {
+			byCourse[id] = len(classes)
+			classes = append(classes, core.ClassGradeWeights{CourseID: id, Assignments: []core.GradedAssignment{}})
+		}
+	}
+	ids := make([]uuid.UUID, len(assignments))
+	for i, a := range assignments {
+		ids[i] = a.ID
+		if _, ok := byCourse[a.CourseID]; !ok {
+			byCourse[a.CourseID] = len(classes)
+			classes = append(classes, core.ClassGradeWeights{CourseID: a.CourseID, Assignments: []core.GradedAssignment{}})
+		}
+	}
+
+	extensions, err := s.repo.ListStudentExtensions(studentID, ids)
+	if err != nil {
+		return nil, err
+	}
+	extended := make(map[uuid.UUID]time.Time, len(extensions))
+	for _, e := range extensions {
+		extended[e.AssignmentID] = e.DueDate
+	}
+	for _, a := range assignments {
+		closesAt := a.ClosesAt()
+		if dueDate, ok := extended[a.ID]; ok && dueDate.After(closesAt) {
+			closesAt = dueDate
+		}
+		class := &classes[byCourse[a.CourseID]]
+		class.Assignments = append(class.Assignments, core.GradedAssignment{
+			ID:         a.ID,
+			SectionID:  a.SectionID,
+			Title:      a.Title,
+			Weight:     a.Weight,
+			TotalScore: a.TotalScore,
+			DueDate:    a.DueDate,
+			ClosesAt:   closesAt,
+		})
+	}
+
+	courses := make([]string, len(classes))
+	for i, class := range classes {
+		courses[i] = class.CourseID
+	}
+	policies, err := s.repo.ListGradingPolicies(courses)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range policies {
+		classes[byCourse[p.CourseID]].MissingAsZero = p.MissingAsZero
+	}
+	return classes, nil
+}
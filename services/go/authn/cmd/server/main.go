@@ -1,13 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 
-	"github.com/4yrg/gradeloop-core/services/go/authn/internal/api"
-	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
-	"github.com/4yrg/gradeloop-core/services/go/authn/internal/service"
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/4yrg/gradeloop-core/libs/debugserver"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/server"
 	"github.com/joho/godotenv"
 )
 
@@ -16,28 +14,33 @@ func main() {
 	_ = godotenv.Load(".env", "../.env", "../../.env", "../../../.env", "../../../../.env", "../../../../../.env")
 
 	// 1. Config
-	cfg := config.Load()
+	cfg := server.LoadConfig()
 
-	// 2. Service
-	svc := service.NewAuthNService(cfg)
+	// 2. Service and routes
+	srv, err := server.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize AuthN service: %v", err)
+	}
 
 	// Test Redis connection
-	if err := svc.PingRedis(); err != nil {
+	if err := srv.Service.PingRedis(); err != nil {
 		log.Printf("Warning: Redis connection failed: %v", err)
 	} else {
 		log.Println("Redis connected successfully")
 	}
 
-	handler := api.NewAuthNHandler(svc)
+	// Downstreams are probed in the background; authn starts even if some
+	// are down and reports them on /health/ready until they recover
+	go srv.Service.WatchDownstreams(context.Background())
 
 	// 3. Server
-	app := fiber.New()
-	app.Use(logger.New())
-
-	handler.RegisterRoutes(app)
+	// Profiling and runtime stats on DEBUG_ADDR, off unless it is set
+	if err := debugserver.Start(); err != nil {
+		log.Fatalf("Failed to start debug server: %v", err)
+	}
 
 	log.Printf("AuthN service starting on port %s", cfg.Port)
-	if err := app.Listen(":" + cfg.Port); err != nil {
+	if err := srv.App.Listen(":" + cfg.Port); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
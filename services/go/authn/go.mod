@@ -3,19 +3,37 @@ module github.com/4yrg/gradeloop-core/services/go/authn
 go 1.25.6
 
 require (
+	github.com/4yrg/gradeloop-core/libs/apierror v0.0.0
+	github.com/4yrg/gradeloop-core/libs/clients v0.0.0
+	github.com/4yrg/gradeloop-core/libs/debugserver v0.0.0
+	github.com/4yrg/gradeloop-core/libs/jwks v0.0.0
+	github.com/4yrg/gradeloop-core/libs/redisfactory v0.0.0
+	github.com/4yrg/gradeloop-core/libs/request v0.0.0
+	github.com/4yrg/gradeloop-core/libs/rpc v0.0.0
+	github.com/alicebob/miniredis/v2 v2.33.0
 	github.com/gofiber/fiber/v2 v2.52.10
 	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/joho/godotenv v1.5.1
 	github.com/redis/go-redis/v9 v9.17.3
-	golang.org/x/net v0.17.0
+	golang.org/x/sync v0.15.0
+	google.golang.org/grpc v1.75.1
 )
 
 require (
+	github.com/4yrg/gradeloop-core/libs/config v0.0.0 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/andybalholm/brotli v1.1.0 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/gabriel-vasile/mimetype v1.4.8 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/go-playground/validator/v10 v10.26.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/leodido/go-urn v1.4.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
@@ -23,5 +41,28 @@ require (
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasthttp v1.51.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/crypto v0.39.0 // indirect
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250707201910-8d1bb00bc6a7 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+	gorm.io/gorm v1.31.1 // indirect
 )
+
+replace github.com/4yrg/gradeloop-core/libs/clients => ../../../libs/clients
+
+replace github.com/4yrg/gradeloop-core/libs/rpc => ../../../libs/rpc
+
+replace github.com/4yrg/gradeloop-core/libs/redisfactory => ../../../libs/redisfactory
+
+replace github.com/4yrg/gradeloop-core/libs/config => ../../../libs/config
+
+replace github.com/4yrg/gradeloop-core/libs/apierror => ../../../libs/apierror
+
+replace github.com/4yrg/gradeloop-core/libs/request => ../../../libs/request
+
+replace github.com/4yrg/gradeloop-core/libs/debugserver => ../../../libs/debugserver
+
+replace github.com/4yrg/gradeloop-core/libs/jwks => ../../../libs/jwks
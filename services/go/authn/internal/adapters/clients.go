@@ -1,246 +0,0 @@
-package adapters
-
-import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"net/http"
-	"os"
-	"time"
-)
-
-type HTTPClient struct {
-	client     *http.Client
-	internalKey string
-}
-
-func NewHTTPClient() *HTTPClient {
-	secret := os.Getenv("INTERNAL_SECRET")
-	if secret == "" {
-		secret = "insecure-secret-for-dev"
-	}
-	return &HTTPClient{
-		client:     &http.Client{Timeout: 10 * time.Second},
-		internalKey: secret,
-	}
-}
-
-func (c *HTTPClient) Post(url string, body interface{}, headers map[string]string) (*http.Response, error) {
-	data, err := json.Marshal(body)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Internal-Token", c.internalKey)
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
-
-	return c.client.Do(req)
-}
-
-// Service Clients
-
-type IdentityClient struct {
-	baseURL string
-	http    *HTTPClient
-}
-
-func NewIdentityClient(url string) *IdentityClient {
-	return &IdentityClient{baseURL: url, http: NewHTTPClient()}
-}
-
-type CheckCredsRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
-type CheckCredsResponse struct {
-	Valid  bool   `json:"valid"`
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
-}
-
-func (c *IdentityClient) ValidateCredentials(email, password string) (*CheckCredsResponse, error) {
-	// Assuming Identity service has this endpoint or similar.
-	// If not, we might need to adjust based on Identity service implementation.
-	// For now, let's assume POST /internal/identity/validate
-	// Wait, the user prompt said "Validate credentials via Identity Service"
-	// Looking at existing identity service code might be good, but strict mode says "Call Identity Service"
-	// Let's assume a standard endpoint or existing one.
-	
-	// Actually, let's look at identity service briefly in next step if this fails, 
-	// but for now implementing based on assumption/standard practice for this task.
-	
-	resp, err := c.http.Post(c.baseURL+"/internal/identity/validate", CheckCredsRequest{Email: email, Password: password}, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("invalid credentials or identity service error")
-	}
-
-	var res CheckCredsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
-	}
-	return &res, nil
-}
-
-func (c *IdentityClient) CreateUser(email, password, firstName, lastName string) (string, error) {
-	req := map[string]string{
-		"email":      email,
-		"password":   password,
-		"first_name": firstName,
-		"last_name":  lastName,
-		"role":       "student", // Default role
-	}
-	
-	resp, err := c.http.Post(c.baseURL+"/internal/users", req, nil)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("failed to create user, status: %d", resp.StatusCode)
-	}
-	
-	// Assuming response contains ID
-	var res map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return "", nil // Created but failed to parse ID?
-	}
-	
-	if id, ok := res["id"].(string); ok {
-		return id, nil
-	}
-	return "", nil
-}
-
-type SessionClient struct {
-	baseURL string
-	http    *HTTPClient
-}
-
-func NewSessionClient(url string) *SessionClient {
-	return &SessionClient{baseURL: url, http: NewHTTPClient()}
-}
-
-func (c *SessionClient) CreateSession(userID, role, ip, userAgent string) (string, string, error) {
-	req := map[string]string{
-		"user_id":    userID,
-		"user_role":  role,
-		"client_ip":  ip,
-		"user_agent": userAgent,
-	}
-
-	resp, err := c.http.Post(c.baseURL+"/internal/sessions", req, nil)
-	if err != nil {
-		return "", "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		return "", "", errors.New("failed to create session")
-	}
-
-	var res struct {
-		SessionID    string `json:"session_id"`
-		RefreshToken string `json:"refresh_token"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return "", "", err
-	}
-	return res.SessionID, res.RefreshToken, nil
-}
-
-func (c *SessionClient) RefreshSession(sessionID, refreshToken string) (string, error) {
-	req := map[string]string{
-		"session_id":    sessionID,
-		"refresh_token": refreshToken,
-	}
-
-	resp, err := c.http.Post(c.baseURL+"/internal/sessions/refresh", req, nil)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.New("failed to refresh session")
-	}
-
-	var res struct {
-		NewRefreshToken string `json:"new_refresh_token"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return "", err
-	}
-	return res.NewRefreshToken, nil
-}
-
-
-type AuthZClient struct {
-	baseURL string
-	http    *HTTPClient
-}
-
-func NewAuthZClient(url string) *AuthZClient {
-	return &AuthZClient{baseURL: url, http: NewHTTPClient()}
-}
-
-func (c *AuthZClient) ResolvePermissions(userID, role string) ([]string, error) {
-	req := map[string]string{
-		"user_id": userID,
-		"role":    role,
-	}
-
-	resp, err := c.http.Post(c.baseURL+"/internal/authz/resolve", req, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to resolve permissions")
-	}
-
-	var res struct {
-		Permissions []string `json:"permissions"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		return nil, err
-	}
-	return res.Permissions, nil
-}
-
-type EmailClient struct {
-	baseURL string
-	http    *HTTPClient
-}
-
-func NewEmailClient(url string) *EmailClient {
-	return &EmailClient{baseURL: url, http: NewHTTPClient()}
-}
-
-func (c *EmailClient) SendEmail(to, subject, body string) error {
-	req := map[string]string{
-		"to":      to,
-		"subject": subject,
-		"body":    body,
-	}
-	// Fire and forget usually means inside the service logic we don't wait?
-	// But client should just perform request. Service will ignore error.
-	_, err := c.http.Post(c.baseURL+"/internal/email/send", req, nil)
-	return err
-}
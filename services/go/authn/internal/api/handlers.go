@@ -1,11 +1,16 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"strings"
+	"time"
 
+	"github.com/4yrg/gradeloop-core/libs/debugserver"
 	"github.com/4yrg/gradeloop-core/services/go/authn/internal/middleware"
 	"github.com/4yrg/gradeloop-core/services/go/authn/internal/service"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -40,7 +45,7 @@ func (h *AuthNHandler) ConsumeMagicLink(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	tokens, err := h.svc.ConsumeMagicLink(c.Context(), req.Token)
+	tokens, err := h.svc.ConsumeMagicLink(c.Context(), req.Token, loginClient(c))
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -50,9 +55,11 @@ func (h *AuthNHandler) ConsumeMagicLink(c *fiber.Ctx) error {
 
 func (h *AuthNHandler) Register(c *fiber.Ctx) error {
 	var req struct {
-		Email    string `json:"email"`
-		FullName string `json:"full_name"`
-		UserType string `json:"user_type"`
+		Email            string `json:"email"`
+		FullName         string `json:"full_name"`
+		UserType         string `json:"user_type"`
+		EnrollmentNumber string `json:"enrollment_number"`
+		InstituteID      string `json:"institute_id"`
 		// Frontend fields
 		Name string `json:"name"`
 		Role string `json:"role"`
@@ -70,12 +77,18 @@ func (h *AuthNHandler) Register(c *fiber.Ctx) error {
 	}
 
 	svcReq := service.RegistrationRequest{
-		Email:    req.Email,
-		FullName: req.FullName,
-		UserType: req.UserType,
+		Email:            req.Email,
+		FullName:         req.FullName,
+		UserType:         req.UserType,
+		EnrollmentNumber: req.EnrollmentNumber,
+		InstituteID:      req.InstituteID,
 	}
 
-	if err := h.svc.RequestEmailConfirmation(c.Context(), svcReq); err != nil {
+	err := h.svc.RequestEmailConfirmation(c.Context(), svcReq)
+	if errors.Is(err, service.ErrRegistrationClosed) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -90,7 +103,7 @@ func (h *AuthNHandler) VerifyEmail(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	tokens, err := h.svc.ConsumeConfirmationToken(c.Context(), req.Token)
+	tokens, err := h.svc.ConsumeConfirmationToken(c.Context(), req.Token, loginClient(c))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -107,7 +120,7 @@ func (h *AuthNHandler) RefreshToken(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	tokens, err := h.svc.RefreshToken(c.Context(), req.RefreshToken)
+	tokens, err := h.svc.RefreshToken(c.Context(), req.RefreshToken, loginClient(c))
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
 	}
@@ -129,6 +142,19 @@ func (h *AuthNHandler) Logout(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusOK)
 }
 
+// validateResponse is the token's claims with how long it has left
+type validateResponse struct {
+	*service.UserClaims
+	ExpiresInSeconds    int64 `json:"expires_in_seconds"`
+	RefreshAfterSeconds int64 `json:"refresh_after_seconds"`
+	SessionValid        bool  `json:"session_valid"`
+}
+
+// ValidateToken returns the token's claims, when it expires and when the
+// client should refresh it. A token whose session has ended is rejected
+// with 401 even if it has not expired. The TTL is also sent in the
+// jwtauth.ExpiresInHeader and jwtauth.RefreshAfterHeader headers, which are
+// all a HEAD request gets.
 func (h *AuthNHandler) ValidateToken(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
@@ -136,27 +162,113 @@ func (h *AuthNHandler) ValidateToken(c *fiber.Ctx) error {
 	}
 
 	token := strings.TrimPrefix(authHeader, "Bearer ")
+	st, err := h.svc.TokenStatus(c.Context(), token)
+	if errors.Is(err, jwtauth.ErrAcceptanceRequired) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, service.ErrSessionEnded) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	st.TTL.SetHeaders(c)
+	if c.Method() == fiber.MethodHead {
+		return c.SendStatus(fiber.StatusOK)
+	}
+	return c.JSON(validateResponse{
+		UserClaims:          st.Claims,
+		ExpiresInSeconds:    int64(st.ExpiresIn / time.Second),
+		RefreshAfterSeconds: int64(st.RefreshAfter / time.Second),
+		SessionValid:        st.SessionValid,
+	})
+}
+
+// Bootstrap returns the caller's profile, permissions, institute, enrollments
+// and session in one response. Sections that failed are listed under "errors";
+// only a failed profile fails the request.
+func (h *AuthNHandler) Bootstrap(c *fiber.Ctx) error {
+	token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+	}
 	claims, err := h.svc.ValidateToken(c.Context(), token)
+	if errors.Is(err, jwtauth.ErrAcceptanceRequired) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
 	}
 
-	return c.JSON(claims)
+	doc, err := h.svc.Bootstrap(c.UserContext(), claims)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+	return c.JSON(doc)
+}
+
+// JWKS serves the public signing keys so other services can verify access
+// tokens without calling /auth/validate
+func (h *AuthNHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.svc.JWKS())
 }
 
 func (h *AuthNHandler) LogoutAll(c *fiber.Ctx) error {
-	userID := c.Locals("user_id").(string)
-	if userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+	}
+	claims, err := h.svc.ValidateToken(c.Context(), token)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	if claims.Impersonator != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed while impersonating a user"})
 	}
 
-	if err := h.svc.LogoutAll(c.Context(), userID); err != nil {
+	if err := h.svc.LogoutAll(c.Context(), claims.UserID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
 
+// AcceptPolicy records the caller accepting the policy documents in the body.
+// It takes the restricted token issued while documents are outstanding and,
+// once none are, returns a full access token for the session.
+func (h *AuthNHandler) AcceptPolicy(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+	}
+
+	var req struct {
+		DocumentIDs []string `json:"document_ids"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	resp, err := h.svc.AcceptPolicies(c.UserContext(), token, req.DocumentIDs, loginClient(c).ClientIP)
+	switch {
+	case errors.Is(err, service.ErrInvalidAcceptance):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAcceptanceForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidToken):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	case err != nil:
+		fmt.Printf("[AuthN] AcceptPolicy failed: %v\n", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "failed to record policy acceptance"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(resp)
+}
+
 // RequestMagicLink replaces Login, but we keep generic naming
 // ForgotPassword and ResetPassword removed
 
@@ -177,12 +289,116 @@ func (h *AuthNHandler) IssueToken(c *fiber.Ctx) error {
 	return c.JSON(token)
 }
 
+// ResendVerification emails a user a new confirmation link on behalf of
+// the admin whose token is in the Authorization header
+func (h *AuthNHandler) ResendVerification(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+	}
+
+	err := h.svc.ResendVerification(c.UserContext(), token, c.Params("id"))
+	switch {
+	case errors.Is(err, service.ErrResendVerificationForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailAlreadyVerified), errors.Is(err, service.ErrUserDisabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		fmt.Printf("[AuthN] Resend verification to %s failed: %v\n", c.Params("id"), err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "failed to resend verification email"})
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// Impersonate starts a support session in which the system admin whose
+// token is in the Authorization header acts as another user
+func (h *AuthNHandler) Impersonate(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+	}
+
+	var req struct {
+		UserID    string `json:"user_id"`
+		Reason    string `json:"reason"`
+		ClientIP  string `json:"client_ip"`
+		UserAgent string `json:"user_agent"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	resp, err := h.svc.Impersonate(c.UserContext(), token, service.ImpersonationRequest{
+		TargetUserID: req.UserID,
+		Reason:       strings.TrimSpace(req.Reason),
+		ClientIP:     req.ClientIP,
+		UserAgent:    req.UserAgent,
+	})
+	switch {
+	case errors.Is(err, service.ErrInvalidImpersonation):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrImpersonationForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		fmt.Printf("[AuthN] Impersonate %s failed: %v\n", req.UserID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "failed to start impersonation"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// loginClient describes where a login comes from. Behind the gateway the
+// browser is the first X-Forwarded-For address.
+func loginClient(c *fiber.Ctx) service.LoginClient {
+	ip := c.IP()
+	if forwarded := c.IPs(); len(forwarded) > 0 && net.ParseIP(forwarded[0]) != nil {
+		ip = forwarded[0]
+	}
+	return service.LoginClient{ClientIP: ip, UserAgent: c.Get(fiber.HeaderUserAgent)}
+}
+
+// Live only says the process is serving; it does not depend on anything else
+func (h *AuthNHandler) Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Ready reports each dependency and answers 503 until the ones needed to log
+// in are reachable. debug_addr tells operators the debug server is on.
+func (h *AuthNHandler) Ready(c *fiber.Ctx) error {
+	statuses, ready := h.svc.Readiness(c.UserContext())
+	body := fiber.Map{"status": "ready", "dependencies": statuses}
+	if addr := debugserver.Addr(); addr != "" {
+		body["debug_addr"] = addr
+	}
+	if !ready {
+		body["status"] = "degraded"
+		return c.Status(fiber.StatusServiceUnavailable).JSON(body)
+	}
+	return c.JSON(body)
+}
+
 func (h *AuthNHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/health/live", h.Live)
+	app.Get("/health/ready", h.Ready)
+	app.Get("/.well-known/jwks.json", h.JWKS)
+	app.Get("/api/v1/me/bootstrap", h.Bootstrap)
+
 	auth := app.Group("/auth")
 
 	// Magic Link Flow
 	auth.Post("/login", h.RequestMagicLink)              // Initiates flow
-	auth.Post("/magic-link/consume", h.ConsumeMagicLink) // Completes flow
+	auth.Post("/magic-link/consume", h.ConsumeMagicLink) // Completes flow, or asks for a 2FA code
+
+	// TOTP two-factor; setup, verify-setup and disable take the caller's access token
+	auth.Post("/2fa/setup", h.SetUpTwoFactor)
+	auth.Post("/2fa/verify-setup", h.VerifyTwoFactorSetup)
+	auth.Post("/2fa/disable", h.DisableTwoFactor)
+	auth.Post("/2fa/challenge", h.TwoFactorChallenge) // Completes a login held back for a code
 
 	auth.Post("/register", h.Register)
 	auth.Post("/verify-email", h.VerifyEmail) // Completes registration
@@ -191,9 +407,12 @@ func (h *AuthNHandler) RegisterRoutes(app *fiber.App) {
 	auth.Post("/logout", h.Logout)
 	auth.Post("/logout-all", h.LogoutAll)
 
-	auth.Get("/validate", h.ValidateToken)
+	auth.Get("/validate", h.ValidateToken) // HEAD too, for the TTL headers only
+	auth.Post("/accept-policy", h.AcceptPolicy)
 
 	// Apply internal auth middleware to internal endpoints
 	internal := app.Group("/internal/authn", middleware.InternalAuth())
 	internal.Post("/issue-token", h.IssueToken)
+	internal.Post("/impersonate", h.Impersonate)
+	internal.Post("/users/:id/resend-verification", h.ResendVerification)
 }
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// SetUpTwoFactor starts TOTP enrollment for the caller and returns the
+// secret, its otpauth:// URI and the recovery codes, once
+func (h *AuthNHandler) SetUpTwoFactor(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+	}
+
+	setup, err := h.svc.SetUpTwoFactor(c.UserContext(), token)
+	if err != nil {
+		return twoFactorError(c, err, fiber.StatusBadRequest)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(setup)
+}
+
+// VerifyTwoFactorSetup enables two-factor for the caller with a code from
+// the authenticator app they just set up
+func (h *AuthNHandler) VerifyTwoFactorSetup(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+	}
+	var req twoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	if err := h.svc.VerifyTwoFactorSetup(c.UserContext(), token, req.Code); err != nil {
+		return twoFactorError(c, err, fiber.StatusBadRequest)
+	}
+	return c.JSON(fiber.Map{"message": "Two-factor authentication enabled"})
+}
+
+// DisableTwoFactor turns two-factor off for the caller, given a current code
+// or a recovery code
+func (h *AuthNHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
+	}
+	var req twoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	if err := h.svc.DisableTwoFactor(c.UserContext(), token, req.Code); err != nil {
+		return twoFactorError(c, err, fiber.StatusBadRequest)
+	}
+	return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// TwoFactorChallenge completes a login held back for a two-factor code,
+// returning the tokens the magic link would have
+func (h *AuthNHandler) TwoFactorChallenge(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"two_factor_token"`
+		Code  string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	tokens, err := h.svc.CompleteTwoFactorLogin(c.UserContext(), req.Token, req.Code, loginClient(c))
+	if errors.Is(err, service.ErrSessionLimitReached) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return twoFactorError(c, err, fiber.StatusUnauthorized)
+	}
+	return c.JSON(tokens)
+}
+
+// twoFactorError answers a failed two-factor request; badCode is the status
+// for a wrong code
+func twoFactorError(c *fiber.Ctx, err error, badCode int) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		return c.Status(badCode).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidToken):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	case errors.Is(err, service.ErrTwoFactorForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrTwoFactorEnabled),
+		errors.Is(err, service.ErrTwoFactorNotSetUp):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrTwoFactorLocked):
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	}
+	fmt.Printf("[AuthN] Two-factor request failed: %v\n", err)
+	return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "two-factor authentication failed"})
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+	sessionv1 "github.com/4yrg/gradeloop-core/libs/rpc/session/v1"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/service"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSessionRPC is the session service's gRPC API, with the sessions in
+// ended reported revoked and every other one live
+type fakeSessionRPC struct {
+	sessionv1.UnimplementedSessionServiceServer
+	mu     sync.Mutex
+	ended  map[string]bool
+	checks int
+}
+
+func (f *fakeSessionRPC) ValidateSession(_ context.Context, req *sessionv1.ValidateSessionRequest) (*sessionv1.ValidateSessionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks++
+	if f.ended[req.SessionId] {
+		return nil, status.Error(codes.Unauthenticated, "session revoked")
+	}
+	return &sessionv1.ValidateSessionResponse{Session: &sessionv1.Session{Id: req.SessionId}}, nil
+}
+
+// newValidateApp returns authn's routes over the fake session service, and
+// a token service signing with authn's key
+func newValidateApp(t *testing.T, sessions *fakeSessionRPC) (*fiber.App, *service.TokenService) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	sessionv1.RegisterSessionServiceServer(server, sessions)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		JWTPrivateKey:        string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		Redis:                redisfactory.Config{Mode: "single", Addr: miniredis.RunT(t).Addr()},
+		SessionGRPCAddr:      lis.Addr().String(),
+		InternalToken:        "test",
+		DownstreamTimeout:    time.Second,
+		SessionCheckCacheTTL: time.Minute,
+	}
+	svc, err := service.NewAuthNService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := service.NewTokenService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	NewAuthNHandler(svc).RegisterRoutes(app)
+	return app, tokens
+}
+
+// validate sends the token to /auth/validate with method, returning the
+// response and its body
+func validate(t *testing.T, app *fiber.App, method, token string) (*http.Response, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/auth/validate", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestValidateReturnsTheTokensTTL(t *testing.T) {
+	sessions := &fakeSessionRPC{}
+	app, tokens := newValidateApp(t, sessions)
+	token, err := tokens.GenerateAccessToken("user-1", "session-1", "STUDENT", nil, nil, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, raw := validate(t, app, fiber.MethodGet, token)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatal(err)
+	}
+	expiresIn, _ := body["expires_in_seconds"].(float64)
+	refreshAfter, _ := body["refresh_after_seconds"].(float64)
+	if expiresIn < 599 || expiresIn > 600 || refreshAfter < 479 || refreshAfter > 480 {
+		t.Errorf("expires in %vs, refresh after %vs; want about 600 and 80%% of it", expiresIn, refreshAfter)
+	}
+	if body["session_valid"] != true || body["sub"] != "user-1" {
+		t.Errorf("body = %v, want user-1's claims with a valid session", body)
+	}
+
+	// Polling again within the cache TTL does not ask the session service
+	validate(t, app, fiber.MethodGet, token)
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	if sessions.checks != 1 {
+		t.Errorf("session service checked %d times for two validations, want 1", sessions.checks)
+	}
+}
+
+func TestValidateRejectsATokenWhoseSessionEnded(t *testing.T) {
+	app, tokens := newValidateApp(t, &fakeSessionRPC{ended: map[string]bool{"session-1": true}})
+	// Signed by authn and unexpired, but its session was revoked
+	token, err := tokens.GenerateAccessToken("user-1", "session-1", "STUDENT", nil, nil, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range []string{fiber.MethodGet, fiber.MethodHead} {
+		if resp, _ := validate(t, app, method, token); resp.StatusCode != fiber.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", method, resp.StatusCode)
+		}
+	}
+}
+
+func TestValidateHeadSendsOnlyTheTTLHeaders(t *testing.T) {
+	app, tokens := newValidateApp(t, &fakeSessionRPC{})
+	token, err := tokens.GenerateAccessToken("user-1", "session-1", "STUDENT", nil, nil, time.Now().Add(10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := validate(t, app, fiber.MethodHead, token)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header.Get(jwtauth.ExpiresInHeader); got != "599" && got != "600" {
+		t.Errorf("%s = %q, want about 600", jwtauth.ExpiresInHeader, got)
+	}
+	if got := resp.Header.Get(jwtauth.RefreshAfterHeader); got != "479" && got != "480" {
+		t.Errorf("%s = %q, want about 480", jwtauth.RefreshAfterHeader, got)
+	}
+	if len(body) != 0 {
+		t.Errorf("HEAD returned a body: %s", body)
+	}
+
+	if resp, _ := validate(t, app, fiber.MethodHead, "not-a-token"); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("HEAD with a bad token: status %d, want 401", resp.StatusCode)
+	}
+}
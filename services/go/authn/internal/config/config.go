@@ -1,38 +1,107 @@
 package config
 
 import (
-	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
 )
 
 type Config struct {
-	Port               string
-	RedisAddr          string
-	RedisPassword      string
-	RedisUsername      string
-	RedisDB            int
+	Port string
+	// REDIS_ADDR alone still describes a single node; see libs/redisfactory
+	// for Sentinel, Cluster and TLS
+	Redis              redisfactory.Config
 	IdentityServiceURL string
 	SessionServiceURL  string
+	SessionGRPCAddr    string
 	EmailServiceURL    string
 	AuthZServiceURL    string
 	InternalToken      string
 	WebURL             string
+
+	// RS256 signing keys, as PEM contents or file paths. The previous key
+	// stays in the JWKS after a rotation until its tokens have expired.
+	JWTPrivateKey         string
+	JWTPreviousPrivateKey string
+
+	// GET /api/v1/me/bootstrap: per-call downstream deadline and cache lifetime
+	BootstrapTimeout  time.Duration
+	BootstrapCacheTTL time.Duration
+
+	// Calls to identity, session, email and authz: per-call deadline and how
+	// often their reachability is probed for /health/ready
+	DownstreamTimeout       time.Duration
+	DownstreamProbeInterval time.Duration
+
+	// Deadline for reporting a login to identity, which happens after the
+	// login has completed
+	LoginEventTimeout time.Duration
+
+	// How long a session found not to be deny-listed is trusted before
+	// Redis is asked again
+	DenyListCacheTTL time.Duration
+
+	// How long /auth/validate trusts a session the session service reported
+	// live before asking again
+	SessionCheckCacheTTL time.Duration
+
+	// Limits on the ctx claim of access tokens: how many enrolled classes it
+	// lists, and how large it may get before it is left out altogether
+	TokenContextMaxClasses int
+	TokenContextMaxBytes   int
+
+	// Two-factor authentication: the base64 AES-256 key TOTP secrets are
+	// encrypted with, the issuer authenticator apps show, how long a login
+	// waits for its code, and how many wrong codes lock a user out for how long
+	TwoFactorKey         string
+	TwoFactorIssuer      string
+	TwoFactorPendingTTL  time.Duration
+	TwoFactorMaxAttempts int
+	TwoFactorLockout     time.Duration
 }
 
 func Load() *Config {
+	redisCfg, err := redisfactory.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	return &Config{
 		Port:               getEnv("PORT", "8003"),
-		RedisAddr:          getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisPassword:      getEnv("REDIS_PASSWORD", ""),
-		RedisUsername:      getEnv("REDIS_USERNAME", "default"),
-		RedisDB:            getEnvInt("REDIS_DB", 0),
+		Redis:              redisCfg,
 		IdentityServiceURL: getEnv("IDENTITY_SERVICE_URL", "http://localhost:8001"),
 		SessionServiceURL:  getEnv("SESSION_SERVICE_URL", "http://localhost:8002"),
+		SessionGRPCAddr:    getEnv("SESSION_GRPC_ADDR", "localhost:9002"),
 		EmailServiceURL:    getEnv("EMAIL_SERVICE_URL", "http://localhost:5005"),
 		AuthZServiceURL:    getEnv("AUTHZ_SERVICE_URL", "http://localhost:8004"),
 		InternalToken:      getEnv("INTERNAL_SECRET", "insecure-secret-for-dev"),
 		WebURL:             getEnv("WEB_URL", "http://localhost:3000"),
+
+		JWTPrivateKey:         os.Getenv("JWT_PRIVATE_KEY"),
+		JWTPreviousPrivateKey: os.Getenv("JWT_PREVIOUS_PRIVATE_KEY"),
+
+		BootstrapTimeout:  getEnvDuration("BOOTSTRAP_TIMEOUT", 2*time.Second),
+		BootstrapCacheTTL: getEnvDuration("BOOTSTRAP_CACHE_TTL", 30*time.Second),
+
+		DownstreamTimeout:       getEnvDuration("DOWNSTREAM_TIMEOUT", 5*time.Second),
+		DownstreamProbeInterval: getEnvDuration("DOWNSTREAM_PROBE_INTERVAL", 10*time.Second),
+
+		LoginEventTimeout: getEnvDuration("LOGIN_EVENT_TIMEOUT", 2*time.Second),
+
+		DenyListCacheTTL:     getEnvDuration("TOKEN_DENYLIST_CACHE_TTL", 5*time.Second),
+		SessionCheckCacheTTL: getEnvDuration("VALIDATE_SESSION_CACHE_TTL", 10*time.Second),
+
+		TokenContextMaxClasses: getEnvInt("TOKEN_CONTEXT_MAX_CLASSES", 50),
+		TokenContextMaxBytes:   getEnvInt("TOKEN_CONTEXT_MAX_BYTES", 1024),
+
+		TwoFactorKey:         os.Getenv("TWO_FACTOR_ENCRYPTION_KEY"),
+		TwoFactorIssuer:      getEnv("TWO_FACTOR_ISSUER", "GradeLoop"),
+		TwoFactorPendingTTL:  getEnvDuration("TWO_FACTOR_PENDING_TTL", 5*time.Minute),
+		TwoFactorMaxAttempts: getEnvInt("TWO_FACTOR_MAX_ATTEMPTS", 5),
+		TwoFactorLockout:     getEnvDuration("TWO_FACTOR_LOCKOUT", 15*time.Minute),
 	}
 }
 
@@ -44,12 +113,20 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	log.Printf("Using default value for %s: %s", key, fallback)
+	return fallback
+}
+
 func getEnvInt(key string, fallback int) int {
 	if value, exists := os.LookupEnv(key); exists {
-		var i int
-		_, err := fmt.Sscanf(value, "%d", &i)
-		if err == nil {
-			return i
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
 		}
 	}
 	log.Printf("Using default value for %s: %d", key, fallback)
@@ -1,11 +1,7 @@
 package service
 
 import (
-	"bytes"
-	"crypto/rand"
 	"encoding/base64"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -14,29 +10,103 @@ import (
 
 	"context"
 
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+	"github.com/4yrg/gradeloop-core/libs/rpc"
+	sessionv1 "github.com/4yrg/gradeloop-core/libs/rpc/session/v1"
 	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
 	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 type AuthNService struct {
-	cfg   *config.Config
-	redis *redis.Client
-	token *TokenService
+	cfg         *config.Config
+	redis       redis.UniversalClient
+	token       *TokenService
+	downstreams *Downstreams
+	denyList    *jwtauth.DenyList
+
+	identity *clients.Identity
+	session  *clients.Session
+	authz    *clients.AuthZ
+	email    *clients.Email
+	// sessionRPC is the session service's gRPC API, used on the refresh path
+	// and to check sessions on /auth/validate
+	sessionRPC sessionv1.SessionServiceClient
+	// liveSessions are sessions /auth/validate recently found live
+	liveSessions *sessionCache
+
+	magicLinks    *tokenStore
+	confirmations *tokenStore
+
+	// twoFactor encrypts TOTP secrets; twoFactorPending holds logins waiting
+	// for a code
+	twoFactor        *secretBox
+	twoFactorPending *tokenStore
 }
 
-func NewAuthNService(cfg *config.Config) *AuthNService {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisAddr,
-		Username: cfg.RedisUsername,
-		Password: cfg.RedisPassword,
-		DB:       cfg.RedisDB,
-	})
+func NewAuthNService(cfg *config.Config) (*AuthNService, error) {
+	token, err := NewTokenService(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	return &AuthNService{
-		cfg:   cfg,
-		redis: rdb,
-		token: NewTokenService(),
+	// Not pinged here: authn starts without Redis and reports it on
+	// /health/ready until it is reachable
+	rdb, err := redisfactory.New(cfg.Redis)
+	if err != nil {
+		return nil, fmt.Errorf("redis client: %w", err)
+	}
+
+	twoFactor, err := newTwoFactorBox(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	downstreams := NewDownstreams(cfg)
+	clientConfig := func(baseURL string) clients.Config {
+		return clients.Config{
+			BaseURL:       baseURL,
+			InternalToken: cfg.InternalToken,
+			Timeout:       cfg.DownstreamTimeout,
+			HTTPClient:    downstreams,
+		}
 	}
+
+	// Connects lazily, so authn starts while the session service is down
+	sessionConn, err := grpc.NewClient(cfg.SessionGRPCAddr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(rpc.InternalToken(cfg.InternalToken)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("session gRPC client: %w", err)
+	}
+
+	return &AuthNService{
+		cfg:         cfg,
+		redis:       rdb,
+		token:       token,
+		downstreams: downstreams,
+		denyList:    jwtauth.NewDenyList(rdb, cfg.DenyListCacheTTL),
+
+		identity: clients.NewIdentity(clientConfig(cfg.IdentityServiceURL)),
+		session:  clients.NewSession(clientConfig(cfg.SessionServiceURL)),
+		authz:    clients.NewAuthZ(clientConfig(cfg.AuthZServiceURL)),
+		email:    clients.NewEmail(clientConfig(cfg.EmailServiceURL)),
+
+		sessionRPC:   sessionv1.NewSessionServiceClient(sessionConn),
+		liveSessions: newSessionCache(),
+
+		magicLinks:    newTokenStore(rdb, "magic_link:", 15*time.Minute),
+		confirmations: newTokenStore(rdb, "confirm_email:", 24*time.Hour),
+
+		twoFactor:        twoFactor,
+		twoFactorPending: newTokenStore(rdb, "two_factor_pending:", cfg.TwoFactorPendingTTL),
+	}, nil
 }
 
 // Data models for external services
@@ -45,9 +115,11 @@ type LoginRequest struct {
 }
 
 type RegistrationRequest struct {
-	Email    string `json:"email"`
-	FullName string `json:"full_name"`
-	UserType string `json:"user_type"`
+	Email            string `json:"email"`
+	FullName         string `json:"full_name"`
+	UserType         string `json:"user_type"`
+	EnrollmentNumber string `json:"enrollment_number,omitempty"` // Required by identity for students
+	InstituteID      string `json:"institute_id,omitempty"`
 }
 
 type TokenResponse struct {
@@ -57,63 +129,66 @@ type TokenResponse struct {
 	Email        string `json:"email"`
 	UserID       string `json:"user_id"`
 	FullName     string `json:"full_name"`
+	// Institutes are the institutes an institute admin manages and their role in each
+	Institutes []InstituteBinding `json:"institutes,omitempty"`
+	// EvictedSessions is how many older sessions were signed out to make room for this one
+	EvictedSessions int `json:"evicted_sessions,omitempty"`
+	// NeedsAcceptance lists the policy documents the user has to accept
+	// before AccessToken works anywhere but /auth/accept-policy
+	NeedsAcceptance []PolicyDocument `json:"needs_acceptance,omitempty"`
+	// TwoFactorRequired replaces the tokens with TwoFactorToken, which
+	// POST /auth/2fa/challenge exchanges for them along with a code
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	TwoFactorToken    string `json:"two_factor_token,omitempty"`
 	// ForceReset removed
 }
 
-// Internal Service Response Models
-type IdentityVerifyResponse struct {
-	Valid    bool   `json:"valid"` // Still used? Maybe check user existence
-	UserID   string `json:"id"`
-	Role     string `json:"user_type"`
-	Email    string `json:"email"`
-	FullName string `json:"full_name"`
-	Status   string `json:"status"` // pending, active
+// LoginClient is the browser or app a login comes from
+type LoginClient struct {
+	ClientIP  string
+	UserAgent string
 }
 
-type SessionCreateResponse struct {
-	SessionID    string `json:"session_id"`
-	RefreshToken string `json:"refresh_token"`
-}
+// InstituteBinding is an institute admin's role (OWNER or ADMIN) in one institute
+type InstituteBinding = clients.InstituteBinding
 
-type AuthZresolveResponse struct {
-	Permissions []string `json:"permissions"`
-}
+var ErrSessionLimitReached = errors.New("maximum number of active sessions reached, log out of another device and try again")
+
+// ErrRegistrationClosed rejects signing up with an email no institute lets
+// self-register. It is the same whether or not the domain belongs to an
+// institute, so it gives away nothing about which ones exist.
+var ErrRegistrationClosed = errors.New("registration is not open for this email address, ask your institute for an invitation")
 
 // Login Orchestration - Magic Link Flow
 
 // RequestMagicLink initiates the login flow
 func (s *AuthNService) RequestMagicLink(ctx context.Context, email string) error {
 	// 1. Lookup User via Identity Service
-	lookupPayload := map[string]string{
-		"email": email,
-	}
-	resp, err := s.postJson(s.cfg.IdentityServiceURL+"/internal/identity/users/lookup", lookupPayload)
+	user, err := s.identity.LookupUser(ctx, email)
 	if err != nil {
 		fmt.Printf("[AuthN] User lookup error for %s: %v\n", email, err)
 		return nil // Return success to avoid email enumeration
 	}
-	defer resp.Body.Close()
-
-	var user IdentityVerifyResponse
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil
-	}
 
 	if user.Status == "disabled" {
 		return nil
 	}
 
-	// 2. Generate Magic Link Token
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return err
+	// An institute can require a verified email to log in. Until the user
+	// has one they are sent a confirmation link, which logs them in too.
+	if !user.EmailVerified {
+		policy, err := s.identity.GetLoginPolicy(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if policy.RequireVerifiedEmail {
+			return s.sendConfirmation(ctx, user, "Confirm your email to log in to GradeLoop",
+				"Your institute asks you to confirm your email address before logging in. Click here to confirm it and log in:")
+		}
 	}
-	token := hex.EncodeToString(tokenBytes)
 
-	// 3. Store in Redis (15 min expiry)
-	redisKey := "magic_link:" + token
-	// Store UserID as value. Could store JSON if need more context.
-	err = s.redis.Set(ctx, redisKey, user.UserID, 15*time.Minute).Err()
+	// 2-3. Generate Magic Link Token and store it in Redis (15 min expiry)
+	token, err := s.magicLinks.Issue(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -127,253 +202,220 @@ func (s *AuthNService) RequestMagicLink(ctx context.Context, email string) error
 	magicLink := fmt.Sprintf("%s/verify?token=%s&type=login", authUrl, token)
 	fmt.Printf("[AuthN-DEV] Magic Link for %s: %s\n", email, magicLink)
 
-	emailPayload := map[string]string{
-		"to":      email,
-		"subject": "Log in to GradeLoop",
-		"body":    fmt.Sprintf("Click here to log in:\n%s\n\nThis link expires in 15 minutes.", magicLink),
-		// "template": "magic_login", // If using templates
-		// "link": magicLink,
-	}
-
-	resp, err = s.postJson(s.cfg.EmailServiceURL+"/internal/email/send", emailPayload)
-	if err != nil {
+	body := fmt.Sprintf("Click here to log in:\n%s\n\nThis link expires in 15 minutes.", magicLink)
+	if err := s.email.Send(ctx, email, "Log in to GradeLoop", body); err != nil {
 		fmt.Printf("[AuthN] Failed to send magic link email to %s: %v\n", email, err)
 		return fmt.Errorf("failed to send email: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("[AuthN] Email service returned status %d for %s\n", resp.StatusCode, email)
-		return fmt.Errorf("email service error: status %d", resp.StatusCode)
-	}
 
 	fmt.Printf("[AuthN] Successfully initiated magic link email for %s\n", email)
 	return nil
 }
 
 // ConsumeMagicLink validates the token and logs the user in
-func (s *AuthNService) ConsumeMagicLink(ctx context.Context, token string) (*TokenResponse, error) {
-	// 1. Validate Token from Redis
-	redisKey := "magic_link:" + token
-	userID, err := s.redis.Get(ctx, redisKey).Result()
-	if err != nil {
+func (s *AuthNService) ConsumeMagicLink(ctx context.Context, token string, client LoginClient) (*TokenResponse, error) {
+	// 1. Consume Token from Redis (single use, even under concurrent requests)
+	userID, err := s.magicLinks.Consume(ctx, token)
+	if errors.Is(err, errTokenNotFound) {
 		return nil, errors.New("invalid or expired magic link")
 	}
-
-	// Delete token immediately (single use)
-	s.redis.Del(ctx, redisKey)
-
-	// 2. Get User Details from Identity Service
-	resp, err := s.Get(s.cfg.IdentityServiceURL + "/internal/identity/users/" + userID)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var user IdentityVerifyResponse
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, err
-	}
-
-	// 3. Create Session via Session Service
-	sessionPayload := map[string]string{
-		"user_id":   user.UserID,
-		"user_role": user.Role,
-	}
-	resp, err = s.postJson(s.cfg.SessionServiceURL+"/internal/sessions", sessionPayload)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusCreated {
-		return nil, errors.New("failed to create session")
+		return nil, fmt.Errorf("failed to consume magic link: %w", err)
 	}
 
-	var sessionResp SessionCreateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&sessionResp); err != nil {
-		return nil, err
-	}
-
-	// 4. Get Permissions via AuthZ Service
-	authzPayload := map[string]string{
-		"user_id": user.UserID,
-		"role":    user.Role,
-	}
-	resp, err = s.postJson(s.cfg.AuthZServiceURL+"/internal/authz/resolve", authzPayload)
+	// 2. Get User Details from Identity Service
+	user, err := s.identity.GetUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	var authzResp AuthZresolveResponse
-	if resp.StatusCode == http.StatusOK {
-		_ = json.NewDecoder(resp.Body).Decode(&authzResp)
-	}
-
-	// 5. Generate Tokens
-	accessToken, err := s.token.GenerateAccessToken(user.UserID, sessionResp.SessionID, user.Role, authzResp.Permissions)
-	if err != nil {
+	if err := s.verifyEmail(ctx, user); err != nil {
 		return nil, err
 	}
 
-	combinedToken := sessionResp.SessionID + ":" + sessionResp.RefreshToken
-	encodedRefreshToken := base64.StdEncoding.EncodeToString([]byte(combinedToken))
-
-	return &TokenResponse{
-		AccessToken:  accessToken,
-		RefreshToken: encodedRefreshToken,
-		Role:         user.Role,
-		Email:        user.Email,
-		UserID:       user.UserID,
-		FullName:     user.FullName,
-	}, nil
+	// 3-5. Create the session, resolve permissions and sign the tokens, or
+	// hold the login back for a two-factor code
+	return s.loginWithTwoFactor(ctx, user, client)
 }
 
-// RequestEmailConfirmation initiates registration flow
+// RequestEmailConfirmation initiates registration flow. Only students sign
+// themselves up, and only with an email domain an institute allows; the
+// student is attached to that institute and joins its default class, if it
+// has one, on confirming their email.
 func (s *AuthNService) RequestEmailConfirmation(ctx context.Context, req RegistrationRequest) error {
-	// 1. Create User in Identity Service (Status=pending)
-	// RegistrationRequest matches CreateUserRequest mostly
-	resp, err := s.postJson(s.cfg.IdentityServiceURL+"/internal/identity/users", req)
-	if err != nil {
-		return err
+	if req.UserType == "" {
+		req.UserType = "STUDENT"
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return errors.New("failed to create user in identity service")
+	if req.UserType != "STUDENT" {
+		return ErrRegistrationClosed
 	}
 
-	// Parse response to get ID
-	var user struct {
-		ID string `json:"id"`
+	// 1. Find the institute the email's domain lets self-register
+	reg, err := s.identity.ResolveSelfRegistration(ctx, req.Email)
+	if clients.StatusCode(err) == http.StatusForbidden {
+		return ErrRegistrationClosed
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+	if err != nil {
 		return err
 	}
+	req.InstituteID = reg.InstituteID
 
-	// 2. Generate Confirmation Token
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return err
+	// 2. Create User in Identity Service (Status=pending)
+	user, err := s.identity.CreateUser(ctx, clients.CreateUserRequest(req))
+	if clients.StatusCode(err) != 0 {
+		return errors.New("failed to create user in identity service")
 	}
-	token := hex.EncodeToString(tokenBytes)
-
-	// 3. Store in Redis
-	redisKey := "confirm_email:" + token
-	err = s.redis.Set(ctx, redisKey, user.ID, 24*time.Hour).Err()
 	if err != nil {
 		return err
 	}
 
-	// 4. Send Confirmation Email via Email Service
-	authUrl := s.cfg.WebURL
-	if authUrl == "" {
-		authUrl = "http://localhost:3000"
-	}
-	confirmLink := fmt.Sprintf("%s/verify?token=%s&type=confirm", authUrl, token)
-	fmt.Printf("[AuthN-DEV] Confirmation Link for %s: %s\n", req.Email, confirmLink)
-
-	emailPayload := map[string]string{
-		"to":      req.Email,
-		"subject": "Welcome to GradeLoop - Confirm your email",
-		"body":    fmt.Sprintf("Welcome " + req.FullName + "!\n\nPlease confirm your email by clicking here:\n" + confirmLink),
+	// 3-5. Generate a Confirmation Token and email it
+	err = s.sendConfirmation(ctx, user, "Welcome to GradeLoop - Confirm your email",
+		fmt.Sprintf("Welcome %s!\n\nPlease confirm your email by clicking here:", req.FullName))
+	if err != nil && !errors.Is(err, errEmailNotSent) {
+		return err
 	}
-	_, _ = s.postJson(s.cfg.EmailServiceURL+"/internal/email/send", emailPayload)
-
+	// The user can ask for a new link, so registration still succeeds
 	return nil
 }
 
 // ConsumeConfirmationToken confirms email
-func (s *AuthNService) ConsumeConfirmationToken(ctx context.Context, token string) (*TokenResponse, error) {
-	// 1. Validate Token
-	redisKey := "confirm_email:" + token
-	userID, err := s.redis.Get(ctx, redisKey).Result()
-	if err != nil {
+func (s *AuthNService) ConsumeConfirmationToken(ctx context.Context, token string, client LoginClient) (*TokenResponse, error) {
+	// 1. Consume Token (single use)
+	userID, err := s.confirmations.Consume(ctx, token)
+	if errors.Is(err, errTokenNotFound) {
 		return nil, errors.New("invalid or expired confirmation link")
 	}
-	s.redis.Del(ctx, redisKey) // Single use
-
-	// 2. Call Identity Service to Update Status
-	resp, err := s.postJson(s.cfg.IdentityServiceURL+"/internal/identity/users/"+userID+"/confirm-email", nil)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to consume confirmation link: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	// 2. Call Identity Service to Update Status
+	err = s.identity.ConfirmEmail(ctx, userID)
+	if clients.StatusCode(err) != 0 {
 		return nil, errors.New("failed to confirm user email in identity service")
 	}
-
-	// 3. Proceed to Login (Generate tokens)
-	// We can reuse ConsumeMagicLink logic by storing a magic token or refactoring.
-	// Or just generate tokens here.
-
-	// Retrieve user details
-	resp, err = s.Get(s.cfg.IdentityServiceURL + "/internal/identity/users/" + userID)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var user IdentityVerifyResponse
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+	// 3. Proceed to Login (Generate tokens), unless the user has since
+	// turned on two-factor authentication and a code is needed first
+	user, err := s.identity.GetUser(ctx, userID)
+	if err != nil {
 		return nil, err
 	}
+	return s.loginWithTwoFactor(ctx, user, client)
+}
 
-	// Create Session
-	sessionPayload := map[string]string{
-		"user_id":   user.UserID,
-		"user_role": user.Role,
+// login opens a session for the user, signs its tokens and reports the
+// login to identity
+func (s *AuthNService) login(ctx context.Context, user *clients.User, client LoginClient) (*TokenResponse, error) {
+	// Create Session via Session Service
+	session, err := s.session.CreateSession(ctx, clients.CreateSessionRequest{
+		UserID:    user.ID,
+		UserRole:  user.UserType,
+		UserAgent: client.UserAgent,
+		ClientIP:  client.ClientIP,
+	})
+	if clients.StatusCode(err) == http.StatusConflict {
+		return nil, ErrSessionLimitReached
 	}
-	resp, err = s.postJson(s.cfg.SessionServiceURL+"/internal/sessions", sessionPayload)
-	if err != nil {
-		return nil, err
+	if clients.StatusCode(err) != 0 {
+		return nil, errors.New("failed to create session")
 	}
-	defer resp.Body.Close()
-
-	var sessionResp SessionCreateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&sessionResp); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
-	// Get Permissions
-	authzPayload := map[string]string{
-		"user_id": user.UserID,
-		"role":    user.Role,
-	}
-	resp, err = s.postJson(s.cfg.AuthZServiceURL+"/internal/authz/resolve", authzPayload)
+	// Users with policies to accept get a token only good for accepting them
+	pending, err := s.pendingPolicies(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var authzResp AuthZresolveResponse
-	if resp.StatusCode == http.StatusOK {
-		_ = json.NewDecoder(resp.Body).Decode(&authzResp)
-	}
+	var accessToken string
+	if len(pending) > 0 {
+		accessToken, err = s.token.GenerateRestrictedToken(user.ID, session.SessionID, user.UserType, session.AccessExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Get Permissions via AuthZ Service
+		permissions, err := s.loginPermissions(ctx, clients.ResolveRequest{
+			UserID:     user.ID,
+			Role:       user.UserType,
+			Institutes: user.Institutes,
+		})
+		if err != nil {
+			return nil, err
+		}
 
-	accessToken, err := s.token.GenerateAccessToken(user.UserID, sessionResp.SessionID, user.Role, authzResp.Permissions)
-	if err != nil {
-		return nil, err
+		// Generate Tokens
+		orgContext := s.tokenContext(ctx, user.ID, user.UserType)
+		accessToken, err = s.token.GenerateAccessToken(user.ID, session.SessionID, user.UserType, permissions, orgContext, session.AccessExpiresAt)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	combinedToken := sessionResp.SessionID + ":" + sessionResp.RefreshToken
-	encodedRefreshToken := base64.StdEncoding.EncodeToString([]byte(combinedToken))
+	s.recordLogin(user.ID, client)
 
 	return &TokenResponse{
 		AccessToken:  accessToken,
-		RefreshToken: encodedRefreshToken,
-		Role:         user.Role,
+		RefreshToken: encodeRefreshToken(session.SessionID, session.RefreshToken),
+		Role:         user.UserType,
 		Email:        user.Email,
-		UserID:       user.UserID,
+		UserID:       user.ID,
 		FullName:     user.FullName,
+		Institutes:   user.Institutes,
+
+		EvictedSessions: len(session.EvictedSessionIDs),
+		NeedsAcceptance: pending,
 	}, nil
 }
 
+// recordLogin reports the login for the user's last login and history. It
+// runs in the background under its own short deadline, so a slow or failing
+// identity never delays or fails the login; a lost report is only logged.
+func (s *AuthNService) recordLogin(userID string, client LoginClient) {
+	event := clients.LoginEvent{
+		LoggedInAt: time.Now().UTC(),
+		ClientIP:   client.ClientIP,
+		UserAgent:  client.UserAgent,
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.LoginEventTimeout)
+		defer cancel()
+		if err := s.identity.RecordLogin(ctx, userID, event); err != nil {
+			fmt.Printf("[AuthN] Recording login of user %s failed: %v\n", userID, err)
+		}
+	}()
+}
+
+// loginPermissions resolves the permissions put in an access token. If authz
+// answers with an error the token is issued without permissions rather than
+// failing the login; only an unreachable authz is an error.
+func (s *AuthNService) loginPermissions(ctx context.Context, req clients.ResolveRequest) ([]string, error) {
+	resolved, err := s.authz.ResolvePermissions(ctx, req)
+	if clients.StatusCode(err) != 0 {
+		fmt.Printf("[AuthN] Resolving permissions of user %s failed: %v\n", req.UserID, err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resolved.Permissions, nil
+}
+
+// encodeRefreshToken packs the session ID with its refresh token, as
+// RefreshToken expects them back
+func encodeRefreshToken(sessionID, refreshToken string) string {
+	return base64.StdEncoding.EncodeToString([]byte(sessionID + ":" + refreshToken))
+}
+
 func (s *AuthNService) IssueToken(ctx context.Context, userID, role string, permissions []string) (*TokenResponse, error) {
 	// For delegated token issuance, we don't have a session, so use empty string
-	accessToken, err := s.token.GenerateAccessToken(userID, "", role, permissions)
+	accessToken, err := s.token.GenerateAccessToken(userID, "", role, permissions, nil, time.Time{})
 	if err != nil {
 		return nil, err
 	}
@@ -384,26 +426,8 @@ func (s *AuthNService) IssueToken(ctx context.Context, userID, role string, perm
 	}, nil
 }
 
-// Helper for generic HTTP post with internal token
-func (s *AuthNService) postJson(url string, data interface{}) (*http.Response, error) {
-	payload, _ := json.Marshal(data)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Internal-Token", s.cfg.InternalToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("[AuthN] HTTP POST error to %s: %v\n", url, err)
-	}
-	return resp, err
-}
-
 // RefreshToken refreshes the access token using a refresh token
-func (s *AuthNService) RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+func (s *AuthNService) RefreshToken(ctx context.Context, refreshToken string, client LoginClient) (*TokenResponse, error) {
 	// 1. Decode refresh token to get SessionID
 	// The refresh token is base64 encoded "sessionID:refreshToken"
 	decodedBytes, err := base64.StdEncoding.DecodeString(refreshToken)
@@ -417,100 +441,97 @@ func (s *AuthNService) RefreshToken(ctx context.Context, refreshToken string) (*
 	sessionID := parts[0]
 	actualRefreshToken := parts[1]
 
-	// 2. Validate with Session Service
-	payload := map[string]string{
-		"refresh_token": actualRefreshToken,
-	}
-	resp, err := s.postJson(s.cfg.SessionServiceURL+"/internal/sessions/"+sessionID+"/refresh", payload)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
+	// 2. Look the session up over gRPC first; a revoked, expired or
+	// impersonated session is turned away from the session cache without
+	// going through the rotation
+	if !s.sessionRefreshable(ctx, sessionID) {
 		return nil, errors.New("invalid or expired refresh token")
 	}
 
-	var sessionResp SessionCreateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&sessionResp); err != nil {
-		return nil, err
-	}
-
-	// 3. Get User Details (to regenerate claims)
-	// We need to look up the session to get the user ID, or generic refresh might return it.
-	// Assuming Session Service refresh returns the new tokens but we need to sign the JWT.
-	// Wait, the session service manages the refresh token rotation, but WE manage the JWT (Access Token).
-	// We need the UserID and Role to generate a new Access Token.
-	// Let's assume the Session Service returns the UserID in the refresh response or we need to fetch it.
-	// For now let's query the session details or trust the session service to have validated it.
-	// IF the session service doesn't return user details, we might need to store them in the session or fetch them.
-
-	// Let's fetch the Session details first to get UserID if needed.
-	// Actually, let's check what SessionCreateResponse contains. It has SessionID and RefreshToken.
-	// We might need to ask Session Service for the user_id associated with this session.
-
-	// Let's try to get session details.
-	sessResp, err := s.Get(s.cfg.SessionServiceURL + "/internal/sessions/" + sessionID)
-	if err != nil {
-		return nil, errors.New("failed to retrieve session details")
-	}
-	defer sessResp.Body.Close()
-
-	if sessResp.StatusCode != http.StatusOK {
-		return nil, errors.New("session not found")
-	}
-
-	var session struct {
-		UserID   string `json:"user_id"`
-		UserRole string `json:"user_role"`
-		// ...
-	}
-	if err := json.NewDecoder(sessResp.Body).Decode(&session); err != nil {
-		return nil, err
-	}
-
-	// 4. Get latest permissions
-	authzPayload := map[string]string{
-		"user_id": session.UserID,
-		"role":    session.UserRole,
+	// 3. Rotate the refresh token with Session Service, which also tells
+	// whose session it is
+	session, err := s.session.RefreshSession(ctx, sessionID, actualRefreshToken, client.ClientIP, client.UserAgent)
+	if clients.StatusCode(err) != 0 {
+		return nil, errors.New("invalid or expired refresh token")
 	}
-	azResp, err := s.postJson(s.cfg.AuthZServiceURL+"/internal/authz/resolve", authzPayload)
 	if err != nil {
 		return nil, err
 	}
-	defer azResp.Body.Close()
 
-	var authzResp AuthZresolveResponse
-	if azResp.StatusCode == http.StatusOK {
-		_ = json.NewDecoder(azResp.Body).Decode(&authzResp)
+	// 4. Get user details, for the response and for the institutes whose
+	// roles add to the user's permissions; the tokens are valid without them
+	user, userErr := s.identity.GetUser(ctx, session.UserID)
+	var institutes []clients.InstituteBinding
+	if userErr == nil {
+		institutes = user.Institutes
 	}
 
-	// 5. Generate New Access Token
-	accessToken, err := s.token.GenerateAccessToken(session.UserID, sessionResp.SessionID, session.UserRole, authzResp.Permissions)
+	// 5. A policy version published since the last token restricts the
+	// new one until it is accepted
+	pending, err := s.pendingPolicies(ctx, session.UserID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Encode new refresh token
-	combinedToken := sessionResp.SessionID + ":" + sessionResp.RefreshToken
-	encodedRefreshToken := base64.StdEncoding.EncodeToString([]byte(combinedToken))
+	var accessToken string
+	if len(pending) > 0 {
+		accessToken, err = s.token.GenerateRestrictedToken(session.UserID, session.SessionID, session.UserRole, session.AccessExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// 6. Get latest permissions
+		permissions, err := s.loginPermissions(ctx, clients.ResolveRequest{
+			UserID:     session.UserID,
+			Role:       session.UserRole,
+			Institutes: institutes,
+		})
+		if err != nil {
+			return nil, err
+		}
 
-	// We need User details for the response
-	userResp, err := s.Get(s.cfg.IdentityServiceURL + "/internal/identity/users/" + session.UserID)
-	var user IdentityVerifyResponse
-	if err == nil && userResp.StatusCode == http.StatusOK {
-		_ = json.NewDecoder(userResp.Body).Decode(&user)
-		userResp.Body.Close()
+		// 7. Generate New Access Token, with the org context as it is now
+		orgContext := s.tokenContext(ctx, session.UserID, session.UserRole)
+		accessToken, err = s.token.GenerateAccessToken(session.UserID, session.SessionID, session.UserRole, permissions, orgContext, session.AccessExpiresAt)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return &TokenResponse{
+	resp := &TokenResponse{
 		AccessToken:  accessToken,
-		RefreshToken: encodedRefreshToken,
+		RefreshToken: encodeRefreshToken(session.SessionID, session.NewRefreshToken),
 		Role:         session.UserRole,
-		Email:        user.Email,
 		UserID:       session.UserID,
-		FullName:     user.FullName,
-	}, nil
+
+		NeedsAcceptance: pending,
+	}
+	if userErr == nil {
+		resp.Email = user.Email
+		resp.FullName = user.FullName
+		resp.Institutes = user.Institutes
+	}
+	return resp, nil
+}
+
+// sessionRefreshable asks the session service over gRPC whether the session
+// can be refreshed. Only a definite no is reported: when the gRPC API cannot
+// be reached the refresh goes ahead, since the session service checks the
+// session again when rotating its token.
+func (s *AuthNService) sessionRefreshable(ctx context.Context, sessionID string) bool {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.DownstreamTimeout)
+	defer cancel()
+
+	resp, err := s.sessionRPC.ValidateSession(ctx, &sessionv1.ValidateSessionRequest{SessionId: sessionID})
+	switch status.Code(err) {
+	case codes.OK:
+		// Impersonated sessions have no refresh token
+		return !resp.GetSession().GetIsImpersonated()
+	case codes.Unauthenticated, codes.InvalidArgument:
+		return false
+	}
+	fmt.Printf("[AuthN] gRPC session lookup for %s failed, refreshing without it: %v\n", sessionID, err)
+	return true
 }
 
 func (s *AuthNService) Logout(ctx context.Context, tokenString string) error {
@@ -520,10 +541,21 @@ func (s *AuthNService) Logout(ctx context.Context, tokenString string) error {
 		return nil // Already invalid
 	}
 
-	// 2. Revoke session in Session Service
+	s.invalidateBootstrap(ctx, claims.UserID, claims.SessionID)
+
+	// 2. Reject the access token from now on, not only once it expires
+	if claims.SessionID != "" && claims.ExpiresAt != nil {
+		if err := s.denyList.Revoke(ctx, claims.SessionID, claims.ExpiresAt.Time); err != nil {
+			fmt.Printf("[AuthN] Failed to deny-list session %s: %v\n", claims.SessionID, err)
+		}
+	}
+
+	// 3. Revoke session in Session Service
+	// An error status (e.g. already revoked) still logs the user out; only
+	// an unreachable Session Service is reported
 	if claims.SessionID != "" {
-		_, err := s.postJson(s.cfg.SessionServiceURL+"/internal/sessions/"+claims.SessionID+"/revoke", nil)
-		if err != nil {
+		err := s.session.RevokeSession(ctx, claims.SessionID)
+		if err != nil && clients.StatusCode(err) == 0 {
 			fmt.Printf("[AuthN] Failed to revoke session %s: %v\n", claims.SessionID, err)
 			return err
 		}
@@ -531,31 +563,92 @@ func (s *AuthNService) Logout(ctx context.Context, tokenString string) error {
 	return nil
 }
 
+// LogoutAll signs the user out everywhere. The access tokens of every active
+// session are deny-listed before the sessions are revoked. Impersonated
+// sessions are left alone, as the Session Service does when revoking.
 func (s *AuthNService) LogoutAll(ctx context.Context, userID string) error {
-	// 1. Call Session Service to revoke all sessions for user
-	_, err := s.postJson(s.cfg.SessionServiceURL+"/internal/sessions/user/"+userID+"/revoke-all", nil)
+	s.invalidateBootstrap(ctx, userID, "")
+
+	// 1. Deny-list the access tokens of the user's active sessions
+	sessions, err := s.session.ListUserSessions(ctx, userID)
 	if err != nil {
 		return err
 	}
-	return nil
+	now := time.Now()
+	for _, session := range sessions {
+		if session.RevokedAt != nil || session.IsImpersonated || !session.ExpiresAt.After(now) {
+			continue
+		}
+		until := session.AccessExpiresAt
+		if until.IsZero() {
+			until = session.ExpiresAt
+		}
+		if err := s.denyList.Revoke(ctx, session.ID, until); err != nil {
+			fmt.Printf("[AuthN] Failed to deny-list session %s: %v\n", session.ID, err)
+		}
+	}
+
+	// 2. Call Session Service to revoke all sessions for user
+	return s.session.RevokeUserSessions(ctx, userID)
 }
 
+// ValidateToken verifies the token and rejects it if its session has been
+// deny-listed. If Redis cannot be reached the token is accepted, as other
+// services verifying it locally would. Like jwtauth.Verify, it rejects a token
+// restricted to accepting policy documents.
 func (s *AuthNService) ValidateToken(ctx context.Context, tokenString string) (*UserClaims, error) {
-	return s.token.ValidateToken(tokenString)
+	claims, err := s.validateSession(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.NeedsAcceptance {
+		return nil, jwtauth.ErrAcceptanceRequired
+	}
+	return claims, nil
+}
+
+// validateSession is ValidateToken without the policy acceptance check
+func (s *AuthNService) validateSession(ctx context.Context, tokenString string) (*UserClaims, error) {
+	claims, err := s.token.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := s.denyList.IsRevoked(ctx, claims.SessionID)
+	if err != nil {
+		fmt.Printf("[AuthN] Deny list check for session %s failed: %v\n", claims.SessionID, err)
+	}
+	if revoked {
+		return nil, jwtauth.ErrRevoked
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys downstream services verify access tokens with
+func (s *AuthNService) JWKS() jwtauth.JWKS {
+	return s.token.JWKS()
 }
 
 func (s *AuthNService) PingRedis() error {
 	return s.redis.Ping(context.Background()).Err()
 }
 
-func (s *AuthNService) Get(url string) (*http.Response, error) {
+// WatchDownstreams keeps the downstream statuses used by Readiness fresh
+// until ctx is cancelled
+func (s *AuthNService) WatchDownstreams(ctx context.Context) {
+	s.downstreams.Run(ctx)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("X-Internal-Token", s.cfg.InternalToken)
+// Readiness reports Redis and every downstream service. authn is ready when
+// Redis and the services needed to log in are reachable; email and authz
+// being down only degrades it.
+func (s *AuthNService) Readiness(ctx context.Context) (map[string]DownstreamStatus, bool) {
+	statuses, ready := s.downstreams.Status()
 
-	client := &http.Client{}
-	return client.Do(req)
+	redisStatus := DownstreamStatus{Ready: true, CheckedAt: time.Now()}
+	if err := s.redis.Ping(ctx).Err(); err != nil {
+		redisStatus = DownstreamStatus{Error: err.Error(), CheckedAt: redisStatus.CheckedAt}
+		ready = false
+	}
+	statuses["redis"] = redisStatus
+	return statuses, ready
 }
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+)
+
+// newTestAuthN returns an AuthNService whose identity, session, email and
+// authz services are all served by handlers, keyed by method and path
+// pattern
+func newTestAuthN(t *testing.T, handlers map[string]http.HandlerFunc) *AuthNService {
+	t.Helper()
+	mux := http.NewServeMux()
+	for pattern, handler := range handlers {
+		mux.HandleFunc(pattern, handler)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	svc, err := NewAuthNService(&config.Config{
+		IdentityServiceURL: server.URL,
+		SessionServiceURL:  server.URL,
+		EmailServiceURL:    server.URL,
+		AuthZServiceURL:    server.URL,
+		InternalToken:      "test",
+		JWTPrivateKey:      newPEMKey(t),
+		DownstreamTimeout:  5 * time.Second,
+		LoginEventTimeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestRefreshKeepsInstituteBindings(t *testing.T) {
+	bindings := []InstituteBinding{{InstituteID: "inst-1", Role: "OWNER"}, {InstituteID: "inst-2", Role: "ADMIN"}}
+	var resolved []InstituteBinding
+	svc := newTestAuthN(t, map[string]http.HandlerFunc{
+		"POST /internal/sessions/refresh": func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				SessionID string `json:"session_id"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			writeJSON(w, clients.RefreshedSession{SessionID: req.SessionID, NewRefreshToken: "rotated", UserID: "admin-1", UserRole: "INSTITUTE_ADMIN"})
+		},
+		"GET /internal/identity/users/{id}": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, clients.User{ID: r.PathValue("id"), UserType: "INSTITUTE_ADMIN", Institutes: bindings})
+		},
+		"POST /internal/authz/resolve": func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Institutes []InstituteBinding `json:"institutes"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			resolved = req.Institutes
+			writeJSON(w, clients.ResolvedPermissions{Permissions: []string{"grade.history"}})
+		},
+	})
+
+	refreshToken := base64.StdEncoding.EncodeToString([]byte("session-1:original"))
+	resp, err := svc.RefreshToken(context.Background(), refreshToken, LoginClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(resolved, bindings) {
+		t.Errorf("permissions resolved for institutes %+v, want %+v", resolved, bindings)
+	}
+	if !reflect.DeepEqual(resp.Institutes, bindings) {
+		t.Errorf("refresh returned institutes %+v, want %+v", resp.Institutes, bindings)
+	}
+	claims, err := svc.token.ValidateToken(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(claims.Permissions, []string{"grade.history"}) {
+		t.Errorf("refreshed token permissions = %v", claims.Permissions)
+	}
+}
+
+func TestLoginReportedWithoutWaiting(t *testing.T) {
+	reported := make(chan clients.LoginEvent, 1)
+	release := make(chan struct{})
+	svc := newTestAuthN(t, map[string]http.HandlerFunc{
+		"POST /internal/identity/users/{id}/login-event": func(w http.ResponseWriter, r *http.Request) {
+			var event clients.LoginEvent
+			_ = json.NewDecoder(r.Body).Decode(&event)
+			<-release // identity is slow
+			reported <- event
+		},
+	})
+
+	start := time.Now()
+	svc.recordLogin("user-1", LoginClient{ClientIP: "203.0.113.9", UserAgent: "test"})
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("recording the login took %v, it must not hold up the login", waited)
+	}
+	close(release)
+
+	select {
+	case event := <-reported:
+		if event.ClientIP != "203.0.113.9" || event.UserAgent != "test" || event.LoggedInAt.IsZero() {
+			t.Errorf("reported %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("login was never reported")
+	}
+}
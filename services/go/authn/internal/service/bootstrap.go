@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+// Bootstrap is everything the web app needs on page load. Sections that could
+// not be loaded are left out and their error is reported under Errors.
+type Bootstrap struct {
+	User        json.RawMessage   `json:"user"`
+	Permissions []string          `json:"permissions,omitempty"`
+	Institute   json.RawMessage   `json:"institute,omitempty"`
+	Enrollments json.RawMessage   `json:"enrollments,omitempty"`
+	Session     json.RawMessage   `json:"session,omitempty"`
+	Errors      map[string]string `json:"errors,omitempty"`
+}
+
+// ErrBootstrapProfile means the user's profile could not be loaded, without
+// which the rest of the bootstrap document is useless
+var ErrBootstrapProfile = errors.New("failed to load user profile")
+
+// bootstrapProfile is the part of the identity user needed to find the institute
+type bootstrapProfile struct {
+	StudentProfile *struct {
+		InstituteID *string `json:"InstituteID"`
+	} `json:"student_profile"`
+	Institutes []InstituteBinding `json:"institutes"`
+}
+
+// instituteID is the student's institute, or for an admin of several
+// institutes the first by name
+func (p bootstrapProfile) instituteID() string {
+	if p.StudentProfile != nil && p.StudentProfile.InstituteID != nil {
+		return *p.StudentProfile.InstituteID
+	}
+	if len(p.Institutes) > 0 {
+		return p.Institutes[0].InstituteID
+	}
+	return ""
+}
+
+// A user's bootstrap documents and the set of their session IDs share the
+// user's hash tag, so all of them can be dropped in one DEL on a Cluster
+func bootstrapCacheKey(userID, sessionID string) string {
+	return "bootstrap:" + redisfactory.HashTag(userID) + ":" + sessionID
+}
+
+func bootstrapSessionsKey(userID string) string {
+	return "bootstrap_sessions:" + redisfactory.HashTag(userID)
+}
+
+// Bootstrap loads the caller's profile, institute, enrollments, permissions
+// and session concurrently. Complete documents are cached per session for
+// BootstrapCacheTTL; partial ones are not, so the next call retries.
+func (s *AuthNService) Bootstrap(ctx context.Context, claims *UserClaims) (*Bootstrap, error) {
+	key := bootstrapCacheKey(claims.UserID, claims.SessionID)
+	if cached, err := s.redis.Get(ctx, key).Bytes(); err == nil {
+		var doc Bootstrap
+		if json.Unmarshal(cached, &doc) == nil {
+			return &doc, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.BootstrapTimeout)
+	defer cancel()
+
+	doc := &Bootstrap{}
+	var mu sync.Mutex
+	errs := map[string]string{}
+	fail := func(section string, err error) {
+		// Keep internal URLs out of the response
+		fmt.Printf("[AuthN] Bootstrap %s for user %s failed: %v\n", section, claims.UserID, err)
+		msg := "unavailable"
+		if errors.Is(err, context.DeadlineExceeded) {
+			msg = "timed out"
+		}
+		mu.Lock()
+		errs[section] = msg
+		mu.Unlock()
+	}
+
+	// Only a profile failure is returned to the group, which cancels the
+	// other calls since their results would be discarded anyway
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		user, err := s.identity.GetUserJSON(gctx, claims.UserID)
+		if err != nil {
+			fmt.Printf("[AuthN] Bootstrap profile for user %s failed: %v\n", claims.UserID, err)
+			return ErrBootstrapProfile
+		}
+		doc.User = user
+
+		var profile bootstrapProfile
+		_ = json.Unmarshal(user, &profile)
+		if id := profile.instituteID(); id != "" {
+			if institute, err := s.identity.GetInstituteJSON(gctx, id); err != nil {
+				fail("institute", err)
+			} else {
+				doc.Institute = institute
+			}
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		enrollments, err := s.identity.GetUserEnrollmentsJSON(gctx, claims.UserID)
+		if err != nil {
+			fail("enrollments", err)
+			return nil
+		}
+		doc.Enrollments = enrollments
+		return nil
+	})
+
+	g.Go(func() error {
+		resolved, err := s.authz.ResolvePermissions(gctx, clients.ResolveRequest{UserID: claims.UserID, Role: claims.Role})
+		if err != nil {
+			fail("permissions", err)
+			return nil
+		}
+		doc.Permissions = resolved.Permissions
+		return nil
+	})
+
+	if claims.SessionID != "" {
+		g.Go(func() error {
+			session, err := s.session.GetSessionJSON(gctx, claims.SessionID)
+			if err != nil {
+				fail("session", err)
+				return nil
+			}
+			doc.Session = session
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if len(errs) > 0 {
+		doc.Errors = errs
+		return doc, nil
+	}
+
+	if data, err := json.Marshal(doc); err == nil {
+		index := bootstrapSessionsKey(claims.UserID)
+		s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, s.cfg.BootstrapCacheTTL)
+			pipe.SAdd(ctx, index, claims.SessionID)
+			pipe.Expire(ctx, index, s.cfg.BootstrapCacheTTL)
+			return nil
+		})
+	}
+	return doc, nil
+}
+
+// invalidateBootstrap drops the cached bootstrap document for one session,
+// or for every session of the user when sessionID is empty
+func (s *AuthNService) invalidateBootstrap(ctx context.Context, userID, sessionID string) {
+	if sessionID != "" {
+		s.redis.Del(ctx, bootstrapCacheKey(userID, sessionID))
+		return
+	}
+	index := bootstrapSessionsKey(userID)
+	sessionIDs, err := s.redis.SMembers(ctx, index).Result()
+	if err != nil {
+		return
+	}
+	keys := []string{index}
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, bootstrapCacheKey(userID, sessionID))
+	}
+	s.redis.Del(ctx, keys...)
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// bootstrapUpstreams fakes identity, authz and session for the bootstrap
+// calls and logout. A route listed in slow hangs until the caller gives up;
+// one listed in failing answers 500.
+type bootstrapUpstreams struct {
+	slow, failing map[string]bool
+	calls         atomic.Int32
+}
+
+func (u *bootstrapUpstreams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.calls.Add(1)
+	if r.Header.Get("X-Internal-Token") != "internal" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	route := r.Method + " " + r.URL.Path
+	if u.slow[route] {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return
+	}
+	if u.failing[route] {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch route {
+	case "GET /internal/identity/users/user-1":
+		_, _ = w.Write([]byte(`{"id":"user-1","student_profile":{"InstituteID":"inst-1"}}`))
+	case "GET /orgs/institutes/inst-1":
+		_, _ = w.Write([]byte(`{"id":"inst-1","name":"Institute"}`))
+	case "GET /internal/identity/users/user-1/enrollments":
+		_, _ = w.Write([]byte(`[{"class_id":"class-1"}]`))
+	case "POST /internal/authz/resolve":
+		_, _ = w.Write([]byte(`{"permissions":["submission.create"]}`))
+	case "GET /internal/sessions/session-1":
+		_, _ = w.Write([]byte(`{"id":"session-1"}`))
+	case "GET /internal/users/user-1/sessions":
+		_, _ = w.Write([]byte(`[]`))
+	case "POST /internal/users/user-1/sessions/revoke":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newBootstrapService(t *testing.T, upstreams *bootstrapUpstreams) (*AuthNService, *miniredis.Miniredis) {
+	t.Helper()
+	server := httptest.NewServer(upstreams)
+	t.Cleanup(server.Close)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	cfg := &config.Config{
+		InternalToken:      "internal",
+		IdentityServiceURL: server.URL,
+		AuthZServiceURL:    server.URL,
+		SessionServiceURL:  server.URL,
+		BootstrapTimeout:   200 * time.Millisecond,
+		BootstrapCacheTTL:  time.Minute,
+	}
+	upstream := clients.Config{BaseURL: server.URL, InternalToken: cfg.InternalToken}
+	return &AuthNService{
+		cfg:      cfg,
+		redis:    rdb,
+		identity: clients.NewIdentity(upstream),
+		session:  clients.NewSession(upstream),
+		authz:    clients.NewAuthZ(upstream),
+	}, mr
+}
+
+var bootstrapClaims = &UserClaims{UserID: "user-1", SessionID: "session-1", Role: "STUDENT"}
+
+func TestBootstrapReportsSectionsThatTimedOut(t *testing.T) {
+	svc, mr := newBootstrapService(t, &bootstrapUpstreams{slow: map[string]bool{"GET /internal/sessions/session-1": true}})
+
+	start := time.Now()
+	doc, err := svc.Bootstrap(context.Background(), bootstrapClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("bootstrap took %s, want it cut off by the 200ms budget", elapsed)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shape map[string]json.RawMessage
+	if err := json.Unmarshal(data, &shape); err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range []string{"user", "permissions", "institute", "enrollments", "errors"} {
+		if _, ok := shape[section]; !ok {
+			t.Errorf("response %s has no %q", data, section)
+		}
+	}
+	if _, ok := shape["session"]; ok {
+		t.Errorf("response %s has the session that timed out", data)
+	}
+	if len(doc.Errors) != 1 || doc.Errors["session"] != "timed out" {
+		t.Errorf("errors = %v, want only the session, timed out", doc.Errors)
+	}
+	if len(doc.Permissions) != 1 || doc.Permissions[0] != "submission.create" {
+		t.Errorf("permissions = %v", doc.Permissions)
+	}
+
+	// A partial document is not cached, so the next page load retries
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("cached %v after a partial bootstrap", keys)
+	}
+}
+
+func TestBootstrapFailsWithoutTheProfile(t *testing.T) {
+	svc, _ := newBootstrapService(t, &bootstrapUpstreams{failing: map[string]bool{"GET /internal/identity/users/user-1": true}})
+
+	if _, err := svc.Bootstrap(context.Background(), bootstrapClaims); !errors.Is(err, ErrBootstrapProfile) {
+		t.Fatalf("got %v, want ErrBootstrapProfile", err)
+	}
+}
+
+func TestBootstrapIsCachedUntilLogout(t *testing.T) {
+	upstreams := &bootstrapUpstreams{}
+	svc, _ := newBootstrapService(t, upstreams)
+	ctx := context.Background()
+
+	first, err := svc.Bootstrap(ctx, bootstrapClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Errors != nil {
+		t.Fatalf("errors = %v, want a complete document", first.Errors)
+	}
+	calls := upstreams.calls.Load()
+
+	cached, err := svc.Bootstrap(ctx, bootstrapClaims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upstreams.calls.Load() != calls {
+		t.Errorf("second bootstrap called the services again")
+	}
+	if string(cached.Session) != string(first.Session) || string(cached.User) != string(first.User) {
+		t.Errorf("cached document %+v differs from %+v", cached, first)
+	}
+
+	if err := svc.LogoutAll(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	calls = upstreams.calls.Load()
+	if _, err := svc.Bootstrap(ctx, bootstrapClaims); err != nil {
+		t.Fatal(err)
+	}
+	if upstreams.calls.Load() == calls {
+		t.Errorf("bootstrap after logout was served from the cache")
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+)
+
+// Downstream service names as reported by /health/ready
+const (
+	DownstreamIdentity = "identity"
+	DownstreamSession  = "session"
+	DownstreamEmail    = "email"
+	DownstreamAuthZ    = "authz"
+)
+
+// criticalDownstreams are the services without which nobody can log in
+var criticalDownstreams = []string{DownstreamIdentity, DownstreamSession}
+
+// DownstreamStatus is the last known reachability of one downstream
+type DownstreamStatus struct {
+	Ready     bool      `json:"ready"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type downstream struct {
+	name    string
+	baseURL string
+	addr    string // host:port dialed by the probe
+}
+
+// Downstreams owns the pooled HTTP client used for every call to the other
+// services and tracks whether each of them is reachable. Reachability is
+// probed in the background and updated by the outcome of real calls, so
+// authn starts even when a downstream is down and recovers once it is back.
+type Downstreams struct {
+	client   *http.Client
+	timeout  time.Duration
+	interval time.Duration
+	targets  []downstream
+
+	mu     sync.RWMutex
+	status map[string]DownstreamStatus
+}
+
+func NewDownstreams(cfg *config.Config) *Downstreams {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.DownstreamTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	d := &Downstreams{
+		client:   &http.Client{Transport: transport, Timeout: cfg.DownstreamTimeout},
+		timeout:  cfg.DownstreamTimeout,
+		interval: cfg.DownstreamProbeInterval,
+		status:   map[string]DownstreamStatus{},
+	}
+	for name, baseURL := range map[string]string{
+		DownstreamIdentity: cfg.IdentityServiceURL,
+		DownstreamSession:  cfg.SessionServiceURL,
+		DownstreamEmail:    cfg.EmailServiceURL,
+		DownstreamAuthZ:    cfg.AuthZServiceURL,
+	} {
+		d.targets = append(d.targets, downstream{name: name, baseURL: baseURL, addr: hostPort(baseURL)})
+		d.status[name] = DownstreamStatus{Error: "not checked yet"}
+	}
+	return d
+}
+
+// hostPort turns a base URL into the address to dial, defaulting the port
+// from the scheme
+func hostPort(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// Run probes every downstream until ctx is cancelled
+func (d *Downstreams) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Downstreams) probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, target := range d.targets {
+		wg.Add(1)
+		go func(target downstream) {
+			defer wg.Done()
+			dialer := net.Dialer{Timeout: d.timeout}
+			conn, err := dialer.DialContext(ctx, "tcp", target.addr)
+			if err == nil {
+				conn.Close()
+			}
+			d.record(target.name, err)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func (d *Downstreams) record(name string, err error) {
+	status := DownstreamStatus{Ready: err == nil, CheckedAt: time.Now()}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	prev := d.status[name]
+	d.status[name] = status
+	d.mu.Unlock()
+
+	if prev.Ready != status.Ready && !prev.CheckedAt.IsZero() {
+		if status.Ready {
+			fmt.Printf("[AuthN] Downstream %s is reachable again\n", name)
+		} else {
+			fmt.Printf("[AuthN] Downstream %s is unreachable: %v\n", name, err)
+		}
+	}
+}
+
+// Status returns the last known status of every downstream and whether all
+// critical ones are ready
+func (d *Downstreams) Status() (map[string]DownstreamStatus, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	out := make(map[string]DownstreamStatus, len(d.status))
+	for name, status := range d.status {
+		out[name] = status
+	}
+	ready := true
+	for _, name := range criticalDownstreams {
+		ready = ready && out[name].Ready
+	}
+	return out, ready
+}
+
+// Do sends req with the pooled client and records the outcome as the
+// downstream's status. It is the HTTP client of the service clients, which
+// handle retries.
+func (d *Downstreams) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.client.Do(req)
+	if name := d.nameFor(req.URL.String()); name != "" {
+		d.record(name, err)
+	}
+	return resp, err
+}
+
+func (d *Downstreams) nameFor(rawURL string) string {
+	for _, target := range d.targets {
+		if target.baseURL != "" && strings.HasPrefix(rawURL, target.baseURL) {
+			return target.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+)
+
+// closedURL returns the URL of a local port nothing listens on
+func closedURL(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return "http://" + addr
+}
+
+func TestDownstreamReadiness(t *testing.T) {
+	up := httptest.NewServer(http.NotFoundHandler())
+	defer up.Close()
+
+	d := NewDownstreams(&config.Config{
+		IdentityServiceURL: up.URL,
+		SessionServiceURL:  up.URL,
+		EmailServiceURL:    closedURL(t),
+		AuthZServiceURL:    up.URL,
+		DownstreamTimeout:  time.Second,
+	})
+	if _, ready := d.Status(); ready {
+		t.Fatal("ready before any probe")
+	}
+
+	d.probe(context.Background())
+	statuses, ready := d.Status()
+	if !ready {
+		t.Fatalf("not ready with identity and session up: %+v", statuses)
+	}
+	if statuses[DownstreamEmail].Ready || statuses[DownstreamEmail].Error == "" {
+		t.Errorf("email status = %+v, want unreachable with the error", statuses[DownstreamEmail])
+	}
+
+	// A failed real call marks its downstream down until it succeeds again
+	d.record(DownstreamSession, &net.OpError{Op: "dial", Err: io.EOF})
+	if _, ready := d.Status(); ready {
+		t.Error("still ready after session became unreachable")
+	}
+}
+
+func TestDownstreamDoRecordsOutcome(t *testing.T) {
+	target := closedURL(t)
+	d := NewDownstreams(&config.Config{IdentityServiceURL: target, DownstreamTimeout: time.Second})
+
+	req, err := http.NewRequest("GET", target+"/users/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Do(req); err == nil {
+		t.Fatal("call to a closed port succeeded")
+	}
+	if statuses, _ := d.Status(); statuses[DownstreamIdentity].Ready || statuses[DownstreamIdentity].Error == "" {
+		t.Errorf("identity status = %+v, want unreachable with the error", statuses[DownstreamIdentity])
+	}
+}
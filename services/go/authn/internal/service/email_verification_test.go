@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// verificationFixture is an AuthNService whose identity knows one user, with
+// the emails it sends and the emails identity was asked to confirm
+type verificationFixture struct {
+	svc       *AuthNService
+	user      clients.User
+	policy    clients.LoginPolicy
+	sent      []sentEmail
+	confirmed []string
+}
+
+type sentEmail struct{ To, Subject, Body string }
+
+func newVerificationFixture(t *testing.T, user clients.User) *verificationFixture {
+	t.Helper()
+	f := &verificationFixture{user: user}
+	f.svc = newTestAuthN(t, map[string]http.HandlerFunc{
+		"POST /internal/identity/users/lookup": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, f.user)
+		},
+		"GET /internal/identity/users/{id}": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, f.user)
+		},
+		"GET /internal/identity/users/{id}/login-policy": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, f.policy)
+		},
+		"POST /internal/identity/users/{id}/confirm-email": func(w http.ResponseWriter, r *http.Request) {
+			f.confirmed = append(f.confirmed, r.PathValue("id"))
+		},
+		"GET /internal/identity/users/{id}/two-factor": func(w http.ResponseWriter, r *http.Request) {
+			// Logins stop at the code, so no session is needed
+			writeJSON(w, clients.TwoFactor{Secret: "sealed", Enabled: true})
+		},
+		"POST /internal/email/send": func(w http.ResponseWriter, r *http.Request) {
+			var email sentEmail
+			_ = json.NewDecoder(r.Body).Decode(&email)
+			f.sent = append(f.sent, email)
+		},
+		"POST /internal/authz/check": func(w http.ResponseWriter, r *http.Request) {
+			var req clients.CheckRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			writeJSON(w, map[string]bool{"allowed": req.Subject == "admin-1" && req.Action == "update"})
+		},
+	})
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	f.svc.redis = rdb
+	f.svc.denyList = jwtauth.NewDenyList(rdb, time.Minute)
+	f.svc.magicLinks = newTokenStore(rdb, "magic_link:", 15*time.Minute)
+	f.svc.confirmations = newTokenStore(rdb, "confirm_email:", 24*time.Hour)
+	f.svc.twoFactorPending = newTokenStore(rdb, "two_factor_pending:", time.Minute)
+	return f
+}
+
+// link returns the token of the link of type kind in the last email sent
+func (f *verificationFixture) link(t *testing.T, kind string) string {
+	t.Helper()
+	if len(f.sent) == 0 {
+		t.Fatal("no email was sent")
+	}
+	body := f.sent[len(f.sent)-1].Body
+	start := strings.Index(body, "token=")
+	end := strings.Index(body, "&type="+kind)
+	if start < 0 || end < start {
+		t.Fatalf("the last email has no %s link: %q", kind, body)
+	}
+	return body[start+len("token=") : end]
+}
+
+func TestUnverifiedLoginUnderPolicyGetsAConfirmationLink(t *testing.T) {
+	f := newVerificationFixture(t, clients.User{ID: testUserID, Email: "ada@example.edu", Status: "pending"})
+	f.policy.RequireVerifiedEmail = true
+	ctx := context.Background()
+
+	if err := f.svc.RequestMagicLink(ctx, "ada@example.edu"); err != nil {
+		t.Fatal(err)
+	}
+	token := f.link(t, "confirm")
+	if userID, err := f.svc.confirmations.Peek(ctx, token); err != nil || userID != testUserID {
+		t.Fatalf("the emailed link is not a confirmation for the user: %q, %v", userID, err)
+	}
+	if _, err := f.svc.magicLinks.Peek(ctx, token); !errors.Is(err, errTokenNotFound) {
+		t.Errorf("a magic link was issued under the policy: %v", err)
+	}
+
+	// Once verified, the policy no longer stands in the way
+	f.user.EmailVerified = true
+	if err := f.svc.RequestMagicLink(ctx, "ada@example.edu"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.magicLinks.Peek(ctx, f.link(t, "login")); err != nil {
+		t.Errorf("a verified user got no magic link: %v", err)
+	}
+}
+
+func TestUnverifiedLoginWithoutPolicyGetsAMagicLink(t *testing.T) {
+	f := newVerificationFixture(t, clients.User{ID: testUserID, Email: "ada@example.edu", Status: "pending"})
+	ctx := context.Background()
+
+	if err := f.svc.RequestMagicLink(ctx, "ada@example.edu"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.magicLinks.Peek(ctx, f.link(t, "login")); err != nil {
+		t.Fatalf("no magic link was issued: %v", err)
+	}
+}
+
+func TestMagicLinkVerifiesEmail(t *testing.T) {
+	f := newVerificationFixture(t, clients.User{ID: testUserID, Email: "ada@example.edu", Status: "pending"})
+	ctx := context.Background()
+
+	link, err := f.svc.magicLinks.Issue(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.ConsumeMagicLink(ctx, link, LoginClient{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.confirmed) != 1 || f.confirmed[0] != testUserID {
+		t.Fatalf("confirmed %v, want the user's email confirmed", f.confirmed)
+	}
+
+	// Verified users are not confirmed again
+	f.user.EmailVerified = true
+	link, err = f.svc.magicLinks.Issue(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.svc.ConsumeMagicLink(ctx, link, LoginClient{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.confirmed) != 1 {
+		t.Errorf("a verified email was confirmed again")
+	}
+}
+
+func TestResendVerificationReplacesTheLink(t *testing.T) {
+	f := newVerificationFixture(t, clients.User{ID: testUserID, Email: "ada@example.edu", Status: "pending"})
+	ctx := context.Background()
+	adminToken, err := f.svc.token.GenerateAccessToken("admin-1", "session-1", "INSTITUTE_ADMIN", nil, nil, time.Now().Add(15*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.svc.ResendVerification(ctx, adminToken, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	first := f.link(t, "confirm")
+	if err := f.svc.ResendVerification(ctx, adminToken, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	second := f.link(t, "confirm")
+	if first == second || f.sent[1].To != "ada@example.edu" {
+		t.Fatalf("resending sent %+v", f.sent)
+	}
+	if _, err := f.svc.confirmations.Peek(ctx, first); !errors.Is(err, errTokenNotFound) {
+		t.Errorf("the first link still works after a resend: %v", err)
+	}
+	if userID, err := f.svc.confirmations.Peek(ctx, second); err != nil || userID != testUserID {
+		t.Errorf("the resent link = %q, %v; want it to confirm the user", userID, err)
+	}
+
+	student, err := f.svc.token.GenerateAccessToken(testUserID, "session-2", "STUDENT", nil, nil, time.Now().Add(15*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.svc.ResendVerification(ctx, student, testUserID); !errors.Is(err, ErrResendVerificationForbidden) {
+		t.Errorf("resend without user.update = %v, want ErrResendVerificationForbidden", err)
+	}
+	f.user.EmailVerified = true
+	if err := f.svc.ResendVerification(ctx, adminToken, testUserID); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Errorf("resend to a verified user = %v, want ErrEmailAlreadyVerified", err)
+	}
+}
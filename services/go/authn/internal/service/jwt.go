@@ -1,64 +1,199 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// signingKey is an RSA key identified by the thumbprint of its public half
+type signingKey struct {
+	kid     string
+	private *rsa.PrivateKey
+}
+
+// TokenService signs access tokens with the current key. The previous key,
+// if configured, is still published and accepted so tokens issued before a
+// rotation stay valid until they expire.
 type TokenService struct {
-	signingKey []byte
+	current  signingKey
+	previous *signingKey
 }
 
-func NewTokenService() *TokenService {
-	key := os.Getenv("JWT_SIGNING_KEY")
-	if key == "" {
-		key = "insecure-default-key-for-dev"
+func NewTokenService(cfg *config.Config) (*TokenService, error) {
+	var current *rsa.PrivateKey
+	if cfg.JWTPrivateKey == "" {
+		// Fine for a single dev instance; every restart invalidates all
+		// access tokens and replicas would not accept each other's tokens
+		log.Println("Warning: JWT_PRIVATE_KEY is not set, generating an ephemeral signing key")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		current = key
+	} else {
+		key, err := loadPrivateKey(cfg.JWTPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY: %w", err)
+		}
+		current = key
 	}
-	return &TokenService{
-		signingKey: []byte(key),
+
+	s := &TokenService{current: newSigningKey(current)}
+	if cfg.JWTPreviousPrivateKey != "" {
+		key, err := loadPrivateKey(cfg.JWTPreviousPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_PREVIOUS_PRIVATE_KEY: %w", err)
+		}
+		previous := newSigningKey(key)
+		s.previous = &previous
 	}
+	return s, nil
 }
 
-type UserClaims struct {
-	UserID      string   `json:"sub"`
-	SessionID   string   `json:"session_id"`
-	Role        string   `json:"role"`
-	Permissions []string `json:"permissions"`
-	jwt.RegisteredClaims
+func newSigningKey(key *rsa.PrivateKey) signingKey {
+	return signingKey{kid: jwtauth.Thumbprint(&key.PublicKey), private: key}
+}
+
+// loadPrivateKey accepts either PEM contents or a path to a PEM file, in
+// PKCS#1 or PKCS#8 form
+func loadPrivateKey(value string) (*rsa.PrivateKey, error) {
+	data := []byte(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		var err error
+		data, err = os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+	return key, nil
 }
 
-func (s *TokenService) GenerateAccessToken(userID, sessionID, role string, permissions []string) (string, error) {
-	claims := UserClaims{
+type UserClaims = jwtauth.Claims
+
+// defaultAccessTokenTTL is used when the session service did not say when
+// the access token should expire
+const defaultAccessTokenTTL = 15 * time.Minute
+
+// GenerateAccessToken signs an access token that expires at expiresAt, or
+// after defaultAccessTokenTTL if expiresAt is zero. orgContext becomes the
+// ctx claim; nil leaves it out.
+func (s *TokenService) GenerateAccessToken(userID, sessionID, role string, permissions []string, orgContext *jwtauth.Context, expiresAt time.Time) (string, error) {
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(defaultAccessTokenTTL)
+	}
+	return s.sign(UserClaims{
 		UserID:      userID,
 		SessionID:   sessionID,
 		Role:        role,
 		Permissions: permissions,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "authn-service",
-			Audience:  []string{"gradeloop-services"},
-		},
+	}, orgContext, expiresAt)
+}
+
+// GenerateRestrictedToken signs an access token for a user who has policy
+// documents to accept. It holds no permissions or org context, and other
+// services reject it; authn only takes it for accepting the documents.
+func (s *TokenService) GenerateRestrictedToken(userID, sessionID, role string, expiresAt time.Time) (string, error) {
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(defaultAccessTokenTTL)
 	}
+	return s.sign(UserClaims{
+		UserID:          userID,
+		SessionID:       sessionID,
+		Role:            role,
+		NeedsAcceptance: true,
+	}, nil, expiresAt)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.signingKey)
+// GenerateImpersonationToken signs an access token for userID that names
+// impersonatorID as the admin actually using it
+func (s *TokenService) GenerateImpersonationToken(userID, sessionID, role string, permissions []string, orgContext *jwtauth.Context, impersonatorID string, expiresAt time.Time) (string, error) {
+	return s.sign(UserClaims{
+		UserID:       userID,
+		SessionID:    sessionID,
+		Role:         role,
+		Permissions:  permissions,
+		Impersonator: impersonatorID,
+	}, orgContext, expiresAt)
 }
 
-func (s *TokenService) ValidateToken(tokenString string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return s.signingKey, nil
-	})
+func (s *TokenService) sign(claims UserClaims, orgContext *jwtauth.Context, expiresAt time.Time) (string, error) {
+	if orgContext != nil {
+		raw, err := json.Marshal(orgContext)
+		if err != nil {
+			return "", err
+		}
+		claims.Ctx = raw
+	}
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    jwtauth.Issuer,
+		Audience:  []string{jwtauth.Audience},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.current.kid
+	return token.SignedString(s.current.private)
+}
 
+func (s *TokenService) ValidateToken(tokenString string) (*UserClaims, error) {
+	claims := &UserClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, key := range s.keys() {
+			if key.kid == kid {
+				return &key.private.PublicKey, nil
+			}
+		}
+		return nil, jwtauth.ErrUnknownKey
+	}, jwt.WithValidMethods([]string{jwtauth.Algorithm}))
 	if err != nil {
 		return nil, err
 	}
+	return claims, nil
+}
 
-	if claims, ok := token.Claims.(*UserClaims); ok && token.Valid {
-		return claims, nil
+// JWKS returns the public keys tokens may currently be signed with
+func (s *TokenService) JWKS() jwtauth.JWKS {
+	set := jwtauth.JWKS{Keys: []jwtauth.JWK{}}
+	for _, key := range s.keys() {
+		set.Keys = append(set.Keys, jwtauth.PublicJWK(key.kid, &key.private.PublicKey))
 	}
+	return set
+}
 
-	return nil, jwt.ErrTokenInvalidId
+func (s *TokenService) keys() []signingKey {
+	if s.previous == nil {
+		return []signingKey{s.current}
+	}
+	return []signingKey{s.current, *s.previous}
 }
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newPEMKey returns a new RSA key as JWT_PRIVATE_KEY takes it
+func newPEMKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func newTestTokenService(t *testing.T, current, previous string) *TokenService {
+	t.Helper()
+	s, err := NewTokenService(&config.Config{JWTPrivateKey: current, JWTPreviousPrivateKey: previous})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &UserClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestTokenServiceKeyRotation(t *testing.T) {
+	oldKey, newKey := newPEMKey(t), newPEMKey(t)
+	expiresAt := time.Now().Add(15 * time.Minute)
+
+	before := newTestTokenService(t, oldKey, "")
+	oldToken, err := before.GenerateAccessToken("user-1", "session-1", "STUDENT", nil, nil, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotated: signs with the new key, still accepts and publishes the old
+	rotated := newTestTokenService(t, newKey, oldKey)
+	if _, err := rotated.ValidateToken(oldToken); err != nil {
+		t.Fatalf("token signed before the rotation = %v", err)
+	}
+	newToken, err := rotated.GenerateAccessToken("user-1", "session-1", "STUDENT", nil, nil, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenKid(t, newToken) == tokenKid(t, oldToken) {
+		t.Fatal("token signed after the rotation names the old key")
+	}
+	set := rotated.JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].Kid != tokenKid(t, newToken) || set.Keys[1].Kid != tokenKid(t, oldToken) {
+		t.Fatalf("JWKS during the rotation has %d keys, want the new and the old one", len(set.Keys))
+	}
+
+	// Old key dropped
+	after := newTestTokenService(t, newKey, "")
+	if _, err := after.ValidateToken(oldToken); !errors.Is(err, jwtauth.ErrUnknownKey) {
+		t.Fatalf("token signed with a dropped key = %v, want ErrUnknownKey", err)
+	}
+	if _, err := after.ValidateToken(newToken); err != nil {
+		t.Fatalf("token signed with the current key = %v", err)
+	}
+	if set := after.JWKS(); len(set.Keys) != 1 {
+		t.Fatalf("JWKS after the rotation has %d keys, want 1", len(set.Keys))
+	}
+}
+
+func TestTokenServiceKeyIDIsStable(t *testing.T) {
+	key := newPEMKey(t)
+	// Two replicas with the same key must name it the same way
+	a, b := newTestTokenService(t, key, ""), newTestTokenService(t, key, "")
+	if a.JWKS().Keys[0].Kid != b.JWKS().Keys[0].Kid {
+		t.Fatal("the same key got different key IDs")
+	}
+	token, err := a.GenerateAccessToken("user-1", "session-1", "STUDENT", nil, nil, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ValidateToken(token); err != nil {
+		t.Fatalf("token from another replica = %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeSessions is the session service's internal API for one user's
+// sessions, recording the revocations it receives
+type fakeSessions struct {
+	sessions []clients.SessionInfo
+
+	mu      sync.Mutex
+	revoked []string
+}
+
+func (f *fakeSessions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet:
+		_ = json.NewEncoder(w).Encode(f.sessions)
+	case r.Method == http.MethodPost:
+		f.mu.Lock()
+		f.revoked = append(f.revoked, r.URL.Path)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newLogoutFixture(t *testing.T, sessions ...clients.SessionInfo) (*AuthNService, *fakeSessions, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	fake := &fakeSessions{sessions: sessions}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	return &AuthNService{
+		cfg:      &config.Config{},
+		redis:    rdb,
+		token:    newTestTokenService(t, newPEMKey(t), ""),
+		denyList: jwtauth.NewDenyList(rdb, time.Minute),
+		session:  clients.NewSession(clients.Config{BaseURL: srv.URL, MaxRetries: -1}),
+	}, fake, mr
+}
+
+func accessToken(t *testing.T, s *AuthNService, sessionID string) string {
+	t.Helper()
+	token, err := s.token.GenerateAccessToken(testUserID, sessionID, "STUDENT", nil, nil, time.Now().Add(15*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestLogoutRejectsAccessTokenImmediately(t *testing.T) {
+	s, fake, mr := newLogoutFixture(t)
+	ctx := context.Background()
+	token := accessToken(t, s, "session-1")
+
+	if _, err := s.ValidateToken(ctx, token); err != nil {
+		t.Fatalf("token before logout = %v", err)
+	}
+	if err := s.Logout(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ValidateToken(ctx, token); !errors.Is(err, jwtauth.ErrRevoked) {
+		t.Fatalf("token right after logout = %v, want ErrRevoked", err)
+	}
+	if len(fake.revoked) != 1 || fake.revoked[0] != "/internal/sessions/session-1/revoke" {
+		t.Fatalf("session service got revocations %v, want session-1's", fake.revoked)
+	}
+
+	// The entry goes once the token would have expired anyway
+	mr.FastForward(15 * time.Minute)
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Fatalf("Redis still holds %v after the token expired", keys)
+	}
+}
+
+func TestLogoutAllRejectsEveryActiveSession(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Hour)
+	s, fake, _ := newLogoutFixture(t,
+		clients.SessionInfo{ID: "active-1", ExpiresAt: now.Add(time.Hour), AccessExpiresAt: now.Add(15 * time.Minute)},
+		clients.SessionInfo{ID: "active-2", ExpiresAt: now.Add(time.Hour)},
+		clients.SessionInfo{ID: "revoked", ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt},
+		clients.SessionInfo{ID: "support", ExpiresAt: now.Add(time.Hour), IsImpersonated: true},
+	)
+	ctx := context.Background()
+	tokens := map[string]string{}
+	for _, id := range []string{"active-1", "active-2", "support"} {
+		tokens[id] = accessToken(t, s, id)
+		if _, err := s.ValidateToken(ctx, tokens[id]); err != nil {
+			t.Fatalf("token of %s before logout = %v", id, err)
+		}
+	}
+
+	if err := s.LogoutAll(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"active-1", "active-2"} {
+		if _, err := s.ValidateToken(ctx, tokens[id]); !errors.Is(err, jwtauth.ErrRevoked) {
+			t.Errorf("token of %s after logout everywhere = %v, want ErrRevoked", id, err)
+		}
+	}
+	// An admin's support session is not the user's to end
+	if _, err := s.ValidateToken(ctx, tokens["support"]); err != nil {
+		t.Errorf("token of the impersonated session = %v, want it still valid", err)
+	}
+	if len(fake.revoked) != 1 || fake.revoked[0] != "/internal/users/"+testUserID+"/sessions/revoke" {
+		t.Fatalf("session service got revocations %v, want the user's sessions", fake.revoked)
+	}
+}
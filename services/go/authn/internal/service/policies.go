@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+)
+
+var (
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrInvalidAcceptance = errors.New("document_ids must be policy documents currently in effect")
+	// ErrAcceptanceForbidden keeps an admin impersonating a user from
+	// accepting policies on their behalf
+	ErrAcceptanceForbidden = errors.New("policies cannot be accepted while impersonating a user")
+)
+
+// PolicyDocument is a current policy version the user has not accepted
+type PolicyDocument = clients.PolicyDocument
+
+// AcceptPolicyResponse lists what the user still has to accept. Once nothing
+// is left it carries a new access token for the same session that is no
+// longer restricted.
+type AcceptPolicyResponse struct {
+	NeedsAcceptance []PolicyDocument `json:"needs_acceptance"`
+	AccessToken     string           `json:"access_token,omitempty"`
+}
+
+// pendingPolicies returns the current policy documents the user has not
+// accepted. If identity answers with an error the user is let through
+// rather than locked out; only an unreachable identity is an error.
+func (s *AuthNService) pendingPolicies(ctx context.Context, userID string) ([]PolicyDocument, error) {
+	status, err := s.identity.GetPolicyStatus(ctx, userID)
+	if clients.StatusCode(err) != 0 {
+		fmt.Printf("[AuthN] Policy status of user %s failed: %v\n", userID, err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return status.NeedsAcceptance, nil
+}
+
+// AcceptPolicies records the user of the access token accepting policy
+// documents from clientIP. The token may be one restricted to doing this.
+func (s *AuthNService) AcceptPolicies(ctx context.Context, tokenString string, documentIDs []string, clientIP string) (*AcceptPolicyResponse, error) {
+	claims, err := s.validateSession(ctx, tokenString)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Impersonator != "" {
+		return nil, ErrAcceptanceForbidden
+	}
+
+	status, err := s.identity.AcceptPolicies(ctx, claims.UserID, clients.PolicyAcceptance{
+		DocumentIDs: documentIDs,
+		ClientIP:    clientIP,
+	})
+	switch code := clients.StatusCode(err); {
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+		return nil, ErrInvalidAcceptance
+	case err != nil:
+		return nil, err
+	}
+
+	resp := &AcceptPolicyResponse{NeedsAcceptance: status.NeedsAcceptance}
+	if len(resp.NeedsAcceptance) > 0 || !claims.NeedsAcceptance {
+		return resp, nil
+	}
+
+	// Swap the restricted token for a full one expiring at the same time
+	permissions, err := s.loginPermissions(ctx, clients.ResolveRequest{
+		UserID: claims.UserID,
+		Role:   claims.Role,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	orgContext := s.tokenContext(ctx, claims.UserID, claims.Role)
+	resp.AccessToken, err = s.token.GenerateAccessToken(claims.UserID, claims.SessionID, claims.Role, permissions, orgContext, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
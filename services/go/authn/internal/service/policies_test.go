@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestTokenRestrictedUntilPoliciesAccepted(t *testing.T) {
+	tos := PolicyDocument{ID: "tos-2", Type: "tos", Version: "2"}
+	var mu sync.Mutex
+	pending := []PolicyDocument{tos}
+	var accepted clients.PolicyAcceptance
+	svc := newTestAuthN(t, map[string]http.HandlerFunc{
+		"POST /internal/sessions/refresh": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, clients.RefreshedSession{SessionID: "session-1", NewRefreshToken: "rotated", UserID: "user-1", UserRole: "STUDENT"})
+		},
+		"GET /internal/identity/users/{id}": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, clients.User{ID: r.PathValue("id"), UserType: "STUDENT"})
+		},
+		"GET /internal/identity/users/{id}/policy-status": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			writeJSON(w, clients.PolicyStatus{NeedsAcceptance: pending})
+		},
+		"POST /internal/identity/users/{id}/policy-acceptances": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			_ = json.NewDecoder(r.Body).Decode(&accepted)
+			if len(accepted.DocumentIDs) != 1 || accepted.DocumentIDs[0] != tos.ID {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			pending = nil
+			writeJSON(w, clients.PolicyStatus{NeedsAcceptance: []PolicyDocument{}})
+		},
+		"POST /internal/authz/resolve": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, clients.ResolvedPermissions{Permissions: []string{"course.read"}})
+		},
+	})
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	svc.denyList = jwtauth.NewDenyList(rdb, time.Minute)
+	ctx := context.Background()
+
+	refreshToken := base64.StdEncoding.EncodeToString([]byte("session-1:original"))
+	resp, err := svc.RefreshToken(ctx, refreshToken, LoginClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.NeedsAcceptance) != 1 || resp.NeedsAcceptance[0].ID != tos.ID {
+		t.Fatalf("needs_acceptance = %+v, want the new terms", resp.NeedsAcceptance)
+	}
+	restricted, err := svc.token.ValidateToken(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restricted.NeedsAcceptance || len(restricted.Permissions) != 0 {
+		t.Fatalf("token with terms outstanding: %+v, want it restricted and without permissions", restricted)
+	}
+
+	if _, err := svc.AcceptPolicies(ctx, resp.AccessToken, []string{"tos-1"}, "203.0.113.7"); !errors.Is(err, ErrInvalidAcceptance) {
+		t.Errorf("accepting a superseded version: got %v, want ErrInvalidAcceptance", err)
+	}
+	done, err := svc.AcceptPolicies(ctx, resp.AccessToken, []string{tos.ID}, "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted.ClientIP != "203.0.113.7" {
+		t.Errorf("acceptance recorded from %q, want the client IP", accepted.ClientIP)
+	}
+	if len(done.NeedsAcceptance) != 0 || done.AccessToken == "" {
+		t.Fatalf("accepting everything returned %+v, want a new token", done)
+	}
+	full, err := svc.token.ValidateToken(done.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.NeedsAcceptance || full.SessionID != "session-1" || len(full.Permissions) != 1 {
+		t.Errorf("token after accepting: %+v, want a full token for the same session", full)
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+)
+
+func TestRegistrationClosed(t *testing.T) {
+	var resolved []string
+	created := 0
+	svc := newTestAuthN(t, map[string]http.HandlerFunc{
+		"POST /internal/identity/self-registrations/resolve": func(w http.ResponseWriter, r *http.Request) {
+			resolved = append(resolved, r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]string{"code": "registration_closed"})
+		},
+		"POST /internal/identity/users": func(w http.ResponseWriter, r *http.Request) {
+			created++
+			writeJSON(w, clients.User{ID: "user-1"})
+		},
+	})
+
+	err := svc.RequestEmailConfirmation(context.Background(), RegistrationRequest{Email: "ta@uni.example.edu", FullName: "TA", UserType: "INSTRUCTOR"})
+	if !errors.Is(err, ErrRegistrationClosed) {
+		t.Errorf("instructor sign-up: err = %v, want ErrRegistrationClosed", err)
+	}
+	if len(resolved) != 0 {
+		t.Error("identity asked about an instructor signing themselves up")
+	}
+
+	err = svc.RequestEmailConfirmation(context.Background(), RegistrationRequest{Email: "someone@elsewhere.example.com", FullName: "Someone"})
+	if !errors.Is(err, ErrRegistrationClosed) {
+		t.Errorf("sign-up with a closed domain: err = %v, want ErrRegistrationClosed", err)
+	}
+	if created != 0 {
+		t.Errorf("created %d users for closed sign-ups", created)
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+)
+
+// tokenContext fetches the user's org context from identity for the ctx
+// claim of their access token. Services fall back to identity without the
+// claim, so a failure only leaves it out.
+func (s *AuthNService) tokenContext(ctx context.Context, userID, role string) *jwtauth.Context {
+	tc, err := s.identity.GetTokenContext(ctx, userID)
+	if err != nil {
+		fmt.Printf("[AuthN] Fetching the token context of user %s failed: %v\n", userID, err)
+		return nil
+	}
+	return buildTokenContext(role, tc, s.cfg.TokenContextMaxClasses, s.cfg.TokenContextMaxBytes)
+}
+
+// buildTokenContext lays out the ctx claim. Every user gets their
+// institutes; students also get up to maxClasses of their enrolled classes,
+// with Truncated set if there are more. A claim over maxBytes once encoded
+// loses its classes, and if it is still too large there is no claim.
+func buildTokenContext(role string, tc *clients.TokenContext, maxClasses, maxBytes int) *jwtauth.Context {
+	x := &jwtauth.Context{Version: jwtauth.ContextVersion, Institutes: tc.InstituteIDs}
+	if role == "STUDENT" {
+		classes := tc.ClassIDs
+		if len(classes) > maxClasses {
+			classes = classes[:max(maxClasses, 0)]
+			x.Truncated = true
+		}
+		for _, id := range classes {
+			x.Classes = append(x.Classes, jwtauth.ClassRef(id))
+		}
+	}
+
+	if contextSize(x) <= maxBytes {
+		return x
+	}
+	if len(x.Classes) > 0 {
+		x.Classes = nil
+		x.Truncated = true
+		if contextSize(x) <= maxBytes {
+			return x
+		}
+	}
+	return nil
+}
+
+func contextSize(x *jwtauth.Context) int {
+	data, _ := json.Marshal(x)
+	return len(data)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+)
+
+func classIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+	}
+	return ids
+}
+
+func TestBuildTokenContext(t *testing.T) {
+	tc := &clients.TokenContext{InstituteIDs: []string{"inst-1"}, ClassIDs: classIDs(3)}
+
+	x := buildTokenContext("STUDENT", tc, 10, 4096)
+	if x == nil || x.Version != jwtauth.ContextVersion || len(x.Classes) != 3 || x.Truncated {
+		t.Fatalf("student context = %+v, want all three classes", x)
+	}
+	if enrolled, known := x.Enrolled(tc.ClassIDs[1]); !enrolled || !known {
+		t.Errorf("student not enrolled in a class of their own")
+	}
+
+	if x := buildTokenContext("INSTRUCTOR", tc, 10, 4096); x == nil || len(x.Classes) != 0 || !x.InInstitute("inst-1") {
+		t.Errorf("instructor context = %+v, want institutes only", x)
+	}
+
+	x = buildTokenContext("STUDENT", tc, 2, 4096)
+	if len(x.Classes) != 2 || !x.Truncated {
+		t.Errorf("context over the class limit = %+v, want two classes, truncated", x)
+	}
+	if _, known := x.Enrolled(tc.ClassIDs[2]); known {
+		t.Error("truncated context claims to know about a class it dropped")
+	}
+}
+
+func TestBuildTokenContextSizeLimit(t *testing.T) {
+	tc := &clients.TokenContext{InstituteIDs: []string{"inst-1"}, ClassIDs: classIDs(50)}
+
+	x := buildTokenContext("STUDENT", tc, 100, 64)
+	if x == nil || len(x.Classes) != 0 || !x.Truncated || !x.InInstitute("inst-1") {
+		t.Errorf("oversized context = %+v, want its classes dropped", x)
+	}
+
+	many := &clients.TokenContext{InstituteIDs: classIDs(20)}
+	if x := buildTokenContext("STUDENT", many, 100, 64); x != nil {
+		t.Errorf("context too large without classes = %+v, want none", x)
+	}
+}
+
+func TestAccessTokenCarriesContext(t *testing.T) {
+	s := newTestTokenService(t, newPEMKey(t), "")
+	x := &jwtauth.Context{Version: jwtauth.ContextVersion, Institutes: []string{"inst-1"}, Classes: []string{jwtauth.ClassRef("class-1")}}
+
+	token, err := s.GenerateAccessToken("user-1", "session-1", "STUDENT", nil, x, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := claims.OrgContext()
+	if got == nil || !got.InInstitute("inst-1") {
+		t.Fatalf("context = %+v, want the one signed", got)
+	}
+	if enrolled, _ := got.Enrolled("class-1"); !enrolled {
+		t.Error("signed class missing from the token's context")
+	}
+
+	bare, err := s.GenerateAccessToken("user-1", "session-1", "STUDENT", nil, nil, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := s.ValidateToken(bare); err != nil || claims.OrgContext() != nil {
+		t.Errorf("token without context = %v, %v", claims, err)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// errTokenNotFound is returned by Consume for a token that was never issued,
+// has expired or was already consumed
+var errTokenNotFound = errors.New("token not found")
+
+// tokenStore keeps single-use tokens, such as magic links, in Redis under
+// prefix. Each token maps to the ID of the user it was issued for.
+type tokenStore struct {
+	redis  redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func newTokenStore(rdb redis.UniversalClient, prefix string, ttl time.Duration) *tokenStore {
+	return &tokenStore{redis: rdb, prefix: prefix, ttl: ttl}
+}
+
+// Issue stores a new random token for userID and returns it
+func (s *tokenStore) Issue(ctx context.Context, userID string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.Set(ctx, s.prefix+token, userID, s.ttl).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Reissue stores a new random token for userID, like Issue, and deletes the
+// last token Reissue gave them, so only the newest one can be consumed
+func (s *tokenStore) Reissue(ctx context.Context, userID string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.Set(ctx, s.prefix+token, userID, s.ttl).Err(); err != nil {
+		return "", err
+	}
+	previous, err := s.redis.SetArgs(ctx, s.prefix+"user:"+userID, token, redis.SetArgs{TTL: s.ttl, Get: true}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+	if previous != "" {
+		if err := s.redis.Del(ctx, s.prefix+previous).Err(); err != nil {
+			return "", err
+		}
+	}
+	return token, nil
+}
+
+func newToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
+
+// Consume deletes the token and returns the user ID it was issued for. The
+// read and delete are one GETDEL, so of concurrent requests with the same
+// token exactly one gets the user ID and the others errTokenNotFound.
+func (s *tokenStore) Consume(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", errTokenNotFound
+	}
+	userID, err := s.redis.GetDel(ctx, s.prefix+token).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", errTokenNotFound
+	}
+	return userID, err
+}
+
+// Peek returns the user ID the token was issued for without consuming it
+func (s *tokenStore) Peek(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", errTokenNotFound
+	}
+	userID, err := s.redis.Get(ctx, s.prefix+token).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", errTokenNotFound
+	}
+	return userID, err
+}
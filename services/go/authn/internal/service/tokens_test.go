@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testUserID = "8a3c1f0e-5a52-4d55-9d4a-0f2e3c6a9b10"
+
+func newTestTokenStore(t *testing.T, ttl time.Duration) (*tokenStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return newTokenStore(rdb, "magic_link:", ttl), mr
+}
+
+func TestTokenConsumedOnce(t *testing.T) {
+	s, mr := newTestTokenStore(t, 15*time.Minute)
+	ctx := context.Background()
+
+	token, err := s.Issue(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID, err := s.Consume(ctx, token); err != nil || userID != testUserID {
+		t.Fatalf("Consume = %q, %v; want %q", userID, err, testUserID)
+	}
+	if _, err := s.Consume(ctx, token); !errors.Is(err, errTokenNotFound) {
+		t.Fatalf("second Consume = %v, want errTokenNotFound", err)
+	}
+
+	expired, err := s.Issue(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(15 * time.Minute)
+	if _, err := s.Consume(ctx, expired); !errors.Is(err, errTokenNotFound) {
+		t.Fatalf("Consume after the TTL = %v, want errTokenNotFound", err)
+	}
+}
+
+func TestTokenConsumedInParallelOnce(t *testing.T) {
+	s, _ := newTestTokenStore(t, 15*time.Minute)
+	ctx := context.Background()
+	token, err := s.Issue(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 50
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		successes int
+	)
+	start := make(chan struct{})
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			userID, err := s.Consume(ctx, token)
+			switch {
+			case err == nil:
+				if userID != testUserID {
+					t.Errorf("Consume = %q, want %q", userID, testUserID)
+				}
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			case !errors.Is(err, errTokenNotFound):
+				t.Errorf("Consume = %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if successes != 1 {
+		t.Fatalf("%d of %d requests consumed the token, want exactly 1", successes, requests)
+	}
+}
+
+func TestTokenReissueRevokesPrevious(t *testing.T) {
+	s, _ := newTestTokenStore(t, 15*time.Minute)
+	ctx := context.Background()
+
+	first, err := s.Reissue(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Reissue(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Consume(ctx, first); !errors.Is(err, errTokenNotFound) {
+		t.Fatalf("Consume of the replaced token = %v, want errTokenNotFound", err)
+	}
+	if userID, err := s.Consume(ctx, second); err != nil || userID != testUserID {
+		t.Fatalf("Consume of the newest token = %q, %v; want %q", userID, err, testUserID)
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238), the defaults every authenticator app supports
+const (
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 6
+	totpSecretSize = 20 // bytes, the size of a SHA-1 output as RFC 4226 advises
+	// totpSkew is how many steps either side of now a code is accepted from,
+	// for clocks that are slightly off
+	totpSkew = 1
+)
+
+// recoveryCodeCount is how many recovery codes a setup hands out
+const recoveryCodeCount = 10
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newTOTPSecret returns a random secret, base32 encoded as apps expect it
+func newTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// totpCode is the code for the secret in the given time step (RFC 4226
+// HOTP with the step as counter)
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP checks code against the base32 secret at now, allowing totpSkew
+// steps either way, and returns the step it matched
+func verifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod/time.Second)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// provisioningURI is the otpauth:// URI authenticator apps import, usually
+// from a QR code
+func provisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod / time.Second))},
+	}
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// newRecoveryCodes returns recoveryCodeCount random codes like 3f9a2-c71de
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode drops what users tend to add or change when typing
+// a code back in
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// secretBox encrypts TOTP secrets with AES-256-GCM before they are stored in
+// Identity, so the database alone does not give them away. It also keys the
+// hashes of recovery codes.
+type secretBox struct {
+	aead    cipher.AEAD
+	hashKey []byte
+}
+
+// newSecretBox derives separate keys for encryption and hashing from key
+func newSecretBox(key []byte) (*secretBox, error) {
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(deriveKey(key, "totp-secret"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead, hashKey: deriveKey(key, "recovery-code")}, nil
+}
+
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Seal encrypts plaintext to base64 of the nonce followed by the ciphertext
+func (b *secretBox) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts what Seal returned
+func (b *secretBox) Open(sealed string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < b.aead.NonceSize() {
+		return "", errors.New("sealed secret too short")
+	}
+	nonce, ciphertext := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// HashRecoveryCode is the keyed hash a recovery code is stored and looked up
+// by. Keying it keeps the short codes from being guessed offline from a copy
+// of the database.
+func (b *secretBox) HashRecoveryCode(code string) string {
+	mac := hmac.New(sha256.New, b.hashKey)
+	mac.Write([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotSetUp    = errors.New("two-factor authentication is not set up")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorLocked      = errors.New("too many invalid two-factor codes, try again later")
+	// ErrTwoFactorForbidden keeps an admin impersonating a user from changing
+	// the user's two-factor settings
+	ErrTwoFactorForbidden = errors.New("two-factor settings cannot be changed while impersonating a user")
+)
+
+// TwoFactorSetup is what a user needs to add GradeLoop to an authenticator
+// app, and the recovery codes to keep in case they lose it. It is only ever
+// shown once.
+type TwoFactorSetup struct {
+	Secret          string   `json:"secret"`
+	ProvisioningURI string   `json:"provisioning_uri"`
+	RecoveryCodes   []string `json:"recovery_codes"`
+}
+
+// newTwoFactorBox returns the secretBox for TWO_FACTOR_ENCRYPTION_KEY
+func newTwoFactorBox(cfg *config.Config) (*secretBox, error) {
+	if cfg.TwoFactorKey == "" {
+		// Fine for dev; in production the key must not be derivable from a
+		// secret every service holds
+		log.Println("Warning: TWO_FACTOR_ENCRYPTION_KEY is not set, deriving it from INTERNAL_SECRET")
+		sum := sha256.Sum256([]byte("two-factor:" + cfg.InternalToken))
+		return newSecretBox(sum[:])
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.TwoFactorKey)
+	if err != nil {
+		return nil, fmt.Errorf("TWO_FACTOR_ENCRYPTION_KEY: %w", err)
+	}
+	box, err := newSecretBox(key)
+	if err != nil {
+		return nil, fmt.Errorf("TWO_FACTOR_ENCRYPTION_KEY: %w", err)
+	}
+	return box, nil
+}
+
+// SetUpTwoFactor starts TOTP enrollment for the user of the access token. It
+// replaces an earlier enrollment they did not confirm; logins only ask for a
+// code once VerifyTwoFactorSetup confirms this one.
+func (s *AuthNService) SetUpTwoFactor(ctx context.Context, tokenString string) (*TwoFactorSetup, error) {
+	claims, err := s.twoFactorUser(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.identity.GetUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.twoFactor.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = s.twoFactor.HashRecoveryCode(code)
+	}
+
+	err = s.identity.SetUpTwoFactor(ctx, user.ID, clients.TwoFactorSetup{Secret: sealed, RecoveryCodeHashes: hashes})
+	if clients.StatusCode(err) == http.StatusConflict {
+		return nil, ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: provisioningURI(s.cfg.TwoFactorIssuer, user.Email, secret),
+		RecoveryCodes:   codes,
+	}, nil
+}
+
+// VerifyTwoFactorSetup enables two-factor for the user of the access token
+// once they show a code from the secret SetUpTwoFactor gave them
+func (s *AuthNService) VerifyTwoFactorSetup(ctx context.Context, tokenString, code string) error {
+	claims, err := s.twoFactorUser(ctx, tokenString)
+	if err != nil {
+		return err
+	}
+	tf, err := s.twoFactorOf(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if tf == nil {
+		return ErrTwoFactorNotSetUp
+	}
+	if tf.Enabled {
+		return ErrTwoFactorEnabled
+	}
+	if err := s.checkTwoFactorCode(ctx, claims.UserID, tf, code, false); err != nil {
+		return err
+	}
+
+	err = s.identity.EnableTwoFactor(ctx, claims.UserID)
+	switch clients.StatusCode(err) {
+	case http.StatusConflict:
+		return ErrTwoFactorEnabled
+	case http.StatusNotFound:
+		return ErrTwoFactorNotSetUp
+	}
+	return err
+}
+
+// DisableTwoFactor turns two-factor off for the user of the access token.
+// Once it is enabled that takes a current code or a recovery code.
+func (s *AuthNService) DisableTwoFactor(ctx context.Context, tokenString, code string) error {
+	claims, err := s.twoFactorUser(ctx, tokenString)
+	if err != nil {
+		return err
+	}
+	tf, err := s.twoFactorOf(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if tf == nil {
+		return ErrTwoFactorNotSetUp
+	}
+	if tf.Enabled {
+		if err := s.checkTwoFactorCode(ctx, claims.UserID, tf, code, true); err != nil {
+			return err
+		}
+	}
+
+	err = s.identity.DisableTwoFactor(ctx, claims.UserID)
+	if clients.StatusCode(err) == http.StatusNotFound {
+		return ErrTwoFactorNotSetUp
+	}
+	return err
+}
+
+// CompleteTwoFactorLogin finishes a login ConsumeMagicLink held back for a
+// two-factor code. A wrong code leaves the pending token usable, until it
+// expires or the user is locked out, so the user can try again.
+func (s *AuthNService) CompleteTwoFactorLogin(ctx context.Context, pendingToken, code string, client LoginClient) (*TokenResponse, error) {
+	userID, err := s.twoFactorPending.Peek(ctx, pendingToken)
+	if errors.Is(err, errTokenNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	tf, err := s.twoFactorOf(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil || !tf.Enabled {
+		// Turned off since the magic link was used; start over
+		return nil, ErrInvalidToken
+	}
+	if err := s.checkTwoFactorCode(ctx, userID, tf, code, true); err != nil {
+		return nil, err
+	}
+
+	// Spent only now, and with GETDEL, so one pending token makes one login
+	if _, err := s.twoFactorPending.Consume(ctx, pendingToken); err != nil {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.identity.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.login(ctx, user, client)
+}
+
+// loginWithTwoFactor logs the user in, unless they have two-factor enabled;
+// then the response only holds a pending token for CompleteTwoFactorLogin
+func (s *AuthNService) loginWithTwoFactor(ctx context.Context, user *clients.User, client LoginClient) (*TokenResponse, error) {
+	tf, err := s.twoFactorOf(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil || !tf.Enabled {
+		return s.login(ctx, user, client)
+	}
+	pending, err := s.twoFactorPending.Issue(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{TwoFactorRequired: true, TwoFactorToken: pending}, nil
+}
+
+// twoFactorUser returns the claims of a full access token of the user
+// themselves, who is changing their two-factor settings
+func (s *AuthNService) twoFactorUser(ctx context.Context, tokenString string) (*UserClaims, error) {
+	claims, err := s.ValidateToken(ctx, tokenString)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Impersonator != "" {
+		return nil, ErrTwoFactorForbidden
+	}
+	return claims, nil
+}
+
+// twoFactorOf returns the user's enrollment, or nil if they have none. Any
+// other answer from identity is an error, so a login never skips the code
+// because the enrollment could not be read.
+func (s *AuthNService) twoFactorOf(ctx context.Context, userID string) (*clients.TwoFactor, error) {
+	tf, err := s.identity.GetTwoFactor(ctx, userID)
+	if clients.StatusCode(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("two-factor status of user %s: %w", userID, err)
+	}
+	return tf, nil
+}
+
+// takeTwoFactorAttempt counts an attempt against KEYS[1] and returns the
+// count. The first attempt starts the lockout window, so the key cannot
+// outlive it even if the service stops right after the INCR.
+var takeTwoFactorAttempt = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// checkTwoFactorCode accepts a TOTP code from tf's secret or, if
+// allowRecovery is set, one of the user's recovery codes, which is used up.
+// Each TOTP code works once. Every code counts as an attempt before it is
+// checked, so concurrent guesses cannot all slip in under the limit; after
+// TwoFactorMaxAttempts the user is locked out until TwoFactorLockout has
+// passed since the first. A valid code clears the count.
+func (s *AuthNService) checkTwoFactorCode(ctx context.Context, userID string, tf *clients.TwoFactor, code string, allowRecovery bool) error {
+	attemptsKey := "two_factor_attempts:" + userID
+	attempts, err := takeTwoFactorAttempt.Run(ctx, s.redis, []string{attemptsKey}, s.cfg.TwoFactorLockout.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if attempts > s.cfg.TwoFactorMaxAttempts {
+		return ErrTwoFactorLocked
+	}
+
+	valid, err := s.twoFactorCodeValid(ctx, userID, tf, strings.TrimSpace(code), allowRecovery)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return ErrInvalidTwoFactorCode
+	}
+	if err := s.redis.Del(ctx, attemptsKey).Err(); err != nil {
+		fmt.Printf("[AuthN] Failed to reset two-factor attempts of user %s: %v\n", userID, err)
+	}
+	return nil
+}
+
+func (s *AuthNService) twoFactorCodeValid(ctx context.Context, userID string, tf *clients.TwoFactor, code string, allowRecovery bool) (bool, error) {
+	if len(code) == totpDigits {
+		secret, err := s.twoFactor.Open(tf.Secret)
+		if err != nil {
+			return false, fmt.Errorf("two-factor secret of user %s: %w", userID, err)
+		}
+		step, ok := verifyTOTP(secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		// Remembered for as long as the code is accepted, so it cannot be
+		// replayed by someone who saw it used
+		return s.redis.SetNX(ctx, fmt.Sprintf("two_factor_used:%s:%d", userID, step), 1, (2*totpSkew+1)*totpPeriod).Result()
+	}
+	if !allowRecovery || code == "" {
+		return false, nil
+	}
+	err := s.identity.UseRecoveryCode(ctx, userID, s.twoFactor.HashRecoveryCode(code))
+	if clients.StatusCode(err) == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTwoFactorFixture is an AuthNService with only what checking codes
+// needs: Redis and the secret box. The user's TOTP secret is returned
+// unsealed so tests can make codes from it.
+func newTwoFactorFixture(t *testing.T, maxAttempts int) (*AuthNService, *clients.TwoFactor, []byte, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	box, err := newSecretBox(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &AuthNService{
+		cfg:       &config.Config{TwoFactorMaxAttempts: maxAttempts, TwoFactorLockout: 15 * time.Minute},
+		redis:     rdb,
+		twoFactor: box,
+	}
+	return s, &clients.TwoFactor{Secret: sealed, Enabled: true}, key, mr
+}
+
+func currentCode(key []byte) string {
+	return totpCode(key, time.Now().Unix()/int64(totpPeriod/time.Second))
+}
+
+// wrongCode is a six digit code that is not valid for key right now
+func wrongCode(key []byte) string {
+	now := time.Now().Unix() / int64(totpPeriod/time.Second)
+	valid := map[string]bool{}
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		valid[totpCode(key, step)] = true
+	}
+	for _, code := range []string{"000000", "111111", "222222", "333333"} {
+		if !valid[code] {
+			return code
+		}
+	}
+	panic("no wrong code")
+}
+
+func TestTwoFactorLockoutAfterMaxAttempts(t *testing.T) {
+	s, tf, key, mr := newTwoFactorFixture(t, 3)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := s.checkTwoFactorCode(ctx, testUserID, tf, wrongCode(key), false); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("wrong code %d = %v, want ErrInvalidTwoFactorCode", i+1, err)
+		}
+	}
+	// Locked out, even with the right code
+	if err := s.checkTwoFactorCode(ctx, testUserID, tf, currentCode(key), false); !errors.Is(err, ErrTwoFactorLocked) {
+		t.Fatalf("right code while locked out = %v, want ErrTwoFactorLocked", err)
+	}
+	if ttl := mr.TTL("two_factor_attempts:" + testUserID); ttl <= 0 || ttl > 15*time.Minute {
+		t.Fatalf("attempts expire in %s, want within the 15m lockout", ttl)
+	}
+
+	// The window is counted from the first attempt and does not grow
+	mr.FastForward(15 * time.Minute)
+	if err := s.checkTwoFactorCode(ctx, testUserID, tf, currentCode(key), false); err != nil {
+		t.Fatalf("right code after the lockout = %v, want nil", err)
+	}
+}
+
+func TestTwoFactorValidCodeResetsAttempts(t *testing.T) {
+	s, tf, key, mr := newTwoFactorFixture(t, 3)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_ = s.checkTwoFactorCode(ctx, testUserID, tf, wrongCode(key), false)
+	}
+	if err := s.checkTwoFactorCode(ctx, testUserID, tf, currentCode(key), false); err != nil {
+		t.Fatalf("right code = %v, want nil", err)
+	}
+	if mr.Exists("two_factor_attempts:" + testUserID) {
+		t.Fatal("attempts were not reset by a right code")
+	}
+	// Each code works once
+	if err := s.checkTwoFactorCode(ctx, testUserID, tf, currentCode(key), false); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("replayed code = %v, want ErrInvalidTwoFactorCode", err)
+	}
+}
+
+func TestTwoFactorConcurrentGuessesRespectLimit(t *testing.T) {
+	const maxAttempts, guesses = 5, 50
+	s, tf, key, _ := newTwoFactorFixture(t, maxAttempts)
+	ctx := context.Background()
+	code := wrongCode(key)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		checked int
+		locked  int
+	)
+	start := make(chan struct{})
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			err := s.checkTwoFactorCode(ctx, testUserID, tf, code, false)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrInvalidTwoFactorCode):
+				checked++
+			case errors.Is(err, ErrTwoFactorLocked):
+				locked++
+			default:
+				t.Errorf("guess = %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if checked != maxAttempts || locked != guesses-maxAttempts {
+		t.Fatalf("%d guesses checked and %d locked out, want %d and %d", checked, locked, maxAttempts, guesses-maxAttempts)
+	}
+}
+
+func TestConfirmationLinkAsksForTwoFactorCode(t *testing.T) {
+	var sessions int
+	svc := newTestAuthN(t, map[string]http.HandlerFunc{
+		"POST /internal/identity/users/{id}/confirm-email": func(w http.ResponseWriter, r *http.Request) {},
+		"GET /internal/identity/users/{id}": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, clients.User{ID: r.PathValue("id"), Email: "ada@example.com", UserType: "STUDENT"})
+		},
+		// The user turned two-factor on after the link was mailed
+		"GET /internal/identity/users/{id}/two-factor": func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, clients.TwoFactor{Secret: "sealed", Enabled: true})
+		},
+		"POST /internal/sessions": func(w http.ResponseWriter, r *http.Request) {
+			sessions++
+		},
+	})
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	svc.confirmations = newTokenStore(rdb, "confirm_email:", time.Hour)
+	svc.twoFactorPending = newTokenStore(rdb, "two_factor_pending:", time.Minute)
+
+	ctx := context.Background()
+	link, err := svc.confirmations.Issue(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := svc.ConsumeConfirmationToken(ctx, link, LoginClient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.TwoFactorRequired || resp.TwoFactorToken == "" || resp.AccessToken != "" {
+		t.Fatalf("confirming returned %+v, want a login held back for a code", resp)
+	}
+	if sessions != 0 {
+		t.Errorf("%d sessions opened before the code was given", sessions)
+	}
+}
@@ -0,0 +1,80 @@
+package jwtauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// ContextVersion is the layout of the ctx claim this package reads and authn
+// writes. Tokens whose ctx claim has another version, or none, are still
+// valid; they just have no context, so services look the caller up instead.
+const ContextVersion = 1
+
+// Context is the caller's org context, carried in access tokens so services
+// need not ask identity on every request. A service that finds what it
+// needs missing from it must fall back to identity: the context is a
+// snapshot from login or refresh, and may be incomplete.
+type Context struct {
+	Version int `json:"v"`
+	// Institutes are the institutes the caller administers, heads a unit of
+	// or studies at
+	Institutes []string `json:"inst,omitempty"`
+	// Classes are the classes a student is enrolled in, as ClassRefs
+	Classes []string `json:"cls,omitempty"`
+	// Truncated is set when Classes does not list every enrollment
+	Truncated bool `json:"trunc,omitempty"`
+}
+
+// ClassRef shortens a class ID for the ctx claim: the first 8 bytes of its
+// SHA-256, base64url encoded. The ID is lowercased first, so any spelling of
+// a UUID gives the same ref.
+func ClassRef(classID string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(classID)))
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// InInstitute reports whether the context lists the institute. False means
+// the institute is not listed, not that the caller has nothing to do with
+// it; check with identity if that matters.
+func (x *Context) InInstitute(instituteID string) bool {
+	if x == nil {
+		return false
+	}
+	for _, id := range x.Institutes {
+		if strings.EqualFold(id, instituteID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enrolled reports whether the context says the caller is enrolled in the
+// class. known is false when the context cannot tell, because there is
+// none or its class list was truncated; ask identity then.
+func (x *Context) Enrolled(classID string) (enrolled, known bool) {
+	if x == nil {
+		return false, false
+	}
+	ref := ClassRef(classID)
+	for _, listed := range x.Classes {
+		if listed == ref {
+			return true, true
+		}
+	}
+	return false, !x.Truncated
+}
+
+// parseContext decodes a ctx claim, returning nil for one that is missing,
+// malformed or of a layout other than ContextVersion
+func parseContext(raw json.RawMessage) *Context {
+	if len(raw) == 0 {
+		return nil
+	}
+	var x Context
+	if err := json.Unmarshal(raw, &x); err != nil || x.Version != ContextVersion {
+		return nil
+	}
+	return &x
+}
@@ -0,0 +1,60 @@
+package jwtauth
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestClassRefIgnoresCase(t *testing.T) {
+	id := "3F2504E0-4F89-11D3-9A0C-0305E82C3301"
+	if ClassRef(id) != ClassRef(strings.ToLower(id)) {
+		t.Error("upper and lower case spellings of a class ID give different refs")
+	}
+	if len(ClassRef(id)) != 11 {
+		t.Errorf("ref %q is not 8 bytes base64url encoded", ClassRef(id))
+	}
+}
+
+func TestContextEnrolled(t *testing.T) {
+	x := &Context{Version: ContextVersion, Classes: []string{ClassRef("class-1")}}
+	if enrolled, known := x.Enrolled("CLASS-1"); !enrolled || !known {
+		t.Errorf("listed class = %v, %v; want enrolled and known", enrolled, known)
+	}
+	if enrolled, known := x.Enrolled("class-2"); enrolled || !known {
+		t.Errorf("unlisted class = %v, %v; want known not enrolled", enrolled, known)
+	}
+
+	x.Truncated = true
+	if enrolled, known := x.Enrolled("class-2"); enrolled || known {
+		t.Errorf("unlisted class of a truncated list = %v, %v; want unknown", enrolled, known)
+	}
+
+	var none *Context
+	if _, known := none.Enrolled("class-1"); known || none.InInstitute("inst-1") {
+		t.Error("a missing context claims to know the caller")
+	}
+}
+
+func TestClaimsOrgContextVersions(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		raw  string
+		want bool
+	}{
+		{"current", `{"v":1,"inst":["inst-1"]}`, true},
+		{"other version", `{"v":2,"inst":["inst-1"]}`, false},
+		{"no version", `{"inst":["inst-1"]}`, false},
+		{"malformed", `"inst-1"`, false},
+		{"missing", ``, false},
+	} {
+		claims := Claims{Ctx: json.RawMessage(tc.raw)}
+		x := claims.OrgContext()
+		if (x != nil) != tc.want {
+			t.Errorf("%s: context = %+v, want one: %v", tc.name, x, tc.want)
+		}
+		if x != nil && !x.InInstitute("INST-1") {
+			t.Errorf("%s: institute inst-1 not found in %+v", tc.name, x)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrRevoked is returned by Verify for a token whose session was revoked
+// before the token expired
+var ErrRevoked = errors.New("token revoked")
+
+// revokedSessionPrefix is the Redis key prefix of deny-listed session IDs.
+// Every service sharing the deny list must use the same Redis database.
+const revokedSessionPrefix = "jwtauth:revoked_session:"
+
+// maxNegativeEntries bounds the negative cache; past it, expired entries
+// are swept before another is added
+const maxNegativeEntries = 10000
+
+// DenyList holds the sessions whose access tokens must be rejected before
+// they expire. Entries live in Redis until the last access token of the
+// session would have expired, so the list never outgrows the tokens it
+// blocks. Sessions found not to be revoked are remembered in memory for
+// negativeTTL, so most checks cost no Redis call; a revocation therefore
+// reaches other processes within negativeTTL.
+type DenyList struct {
+	redis       redis.UniversalClient
+	negativeTTL time.Duration
+
+	mu         sync.Mutex
+	notRevoked map[string]time.Time // session ID -> when the entry goes stale
+}
+
+func NewDenyList(rdb redis.UniversalClient, negativeTTL time.Duration) *DenyList {
+	return &DenyList{
+		redis:       rdb,
+		negativeTTL: negativeTTL,
+		notRevoked:  make(map[string]time.Time),
+	}
+}
+
+// Revoke rejects the session's tokens until until, the expiry of the last
+// access token issued for it. Nothing is stored if that has already passed.
+func (d *DenyList) Revoke(ctx context.Context, sessionID string, until time.Time) error {
+	if sessionID == "" {
+		return nil
+	}
+	d.mu.Lock()
+	delete(d.notRevoked, sessionID)
+	d.mu.Unlock()
+
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return d.redis.Set(ctx, revokedSessionPrefix+sessionID, 1, ttl).Err()
+}
+
+// IsRevoked reports whether the session is on the deny list
+func (d *DenyList) IsRevoked(ctx context.Context, sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	now := time.Now()
+	d.mu.Lock()
+	staleAt, ok := d.notRevoked[sessionID]
+	d.mu.Unlock()
+	if ok && now.Before(staleAt) {
+		return false, nil
+	}
+
+	err := d.redis.Get(ctx, revokedSessionPrefix+sessionID).Err()
+	if errors.Is(err, redis.Nil) {
+		d.remember(sessionID, now)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *DenyList) remember(sessionID string, now time.Time) {
+	if d.negativeTTL <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.notRevoked) >= maxNegativeEntries {
+		for id, staleAt := range d.notRevoked {
+			if !now.Before(staleAt) {
+				delete(d.notRevoked, id)
+			}
+		}
+		if len(d.notRevoked) >= maxNegativeEntries {
+			return
+		}
+	}
+	d.notRevoked[sessionID] = now.Add(d.negativeTTL)
+}
@@ -0,0 +1,96 @@
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (redis.UniversalClient, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb, mr
+}
+
+func TestDenyListRejectsTokenRightAfterRevoke(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	key := generateKey(t)
+	deny := NewDenyList(rdb, time.Minute)
+	v := NewVerifier(Config{JWKSURL: newJWKSServer(t, key).URL, DenyList: deny})
+	ctx := context.Background()
+
+	token := signToken(t, key, "session-1")
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Fatalf("token before logout = %v", err)
+	}
+	// The check above cached the session as not revoked; revoking here
+	// drops that at once
+	if err := deny.Revoke(ctx, "session-1", time.Now().Add(15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(ctx, token); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("token after logout = %v, want ErrRevoked", err)
+	}
+	if _, err := v.Verify(ctx, signToken(t, key, "session-2")); err != nil {
+		t.Fatalf("token of another session = %v", err)
+	}
+}
+
+func TestDenyListEntriesExpireWithTheToken(t *testing.T) {
+	rdb, mr := newTestRedis(t)
+	deny := NewDenyList(rdb, 0)
+	ctx := context.Background()
+
+	if err := deny.Revoke(ctx, "session-1", time.Now().Add(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(revokedSessionPrefix + "session-1"); ttl <= 9*time.Minute || ttl > 10*time.Minute {
+		t.Fatalf("entry expires in %s, want with the token in 10m", ttl)
+	}
+	mr.FastForward(10 * time.Minute)
+	if revoked, err := deny.IsRevoked(ctx, "session-1"); err != nil || revoked {
+		t.Fatalf("IsRevoked after the token expired = %v, %v; want the entry gone", revoked, err)
+	}
+
+	// Nothing is stored for tokens that have already expired
+	if err := deny.Revoke(ctx, "session-2", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(revokedSessionPrefix + "session-2") {
+		t.Fatal("deny-listed a session whose tokens had already expired")
+	}
+}
+
+func TestDenyListNegativeCache(t *testing.T) {
+	rdb, mr := newTestRedis(t)
+	ctx := context.Background()
+	// Two processes sharing Redis
+	here := NewDenyList(rdb, 50*time.Millisecond)
+	there := NewDenyList(rdb, 50*time.Millisecond)
+
+	if revoked, err := here.IsRevoked(ctx, "session-1"); err != nil || revoked {
+		t.Fatalf("IsRevoked = %v, %v; want false", revoked, err)
+	}
+	if err := there.Revoke(ctx, "session-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the negative TTL, the other process answers from memory without
+	// asking Redis
+	mr.SetError("redis down")
+	if revoked, err := here.IsRevoked(ctx, "session-1"); err != nil || revoked {
+		t.Fatalf("IsRevoked within the negative TTL = %v, %v; want the cached false", revoked, err)
+	}
+	mr.SetError("")
+
+	time.Sleep(50 * time.Millisecond)
+	if revoked, err := here.IsRevoked(ctx, "session-1"); err != nil || !revoked {
+		t.Fatalf("IsRevoked after the negative TTL = %v, %v; want true", revoked, err)
+	}
+}
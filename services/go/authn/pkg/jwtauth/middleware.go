@@ -0,0 +1,68 @@
+package jwtauth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ClaimsKey is the fiber.Ctx Locals key the verified claims are stored under
+const ClaimsKey = "jwtauth.claims"
+
+// ContextKey is the fiber.Ctx Locals key the token's parsed org context is
+// stored under
+const ContextKey = "jwtauth.context"
+
+// ImpersonatorHeader carries the impersonating admin's user ID on calls
+// made for an impersonated user, so services further down can tell support
+// access apart from the user acting themselves
+const ImpersonatorHeader = "X-Impersonator-Id"
+
+// Middleware rejects requests without a valid bearer access token and
+// stores the token's claims in c.Locals(ClaimsKey), its org context in
+// c.Locals(ContextKey) and its TTL in c.Locals(TTLKey). Tokens restricted until their user accepts the
+// current policies are rejected with 403. ImpersonatorHeader on
+// the request is replaced with the token's impersonator, so a client
+// cannot set it itself.
+func Middleware(v *Verifier) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		token, ok := strings.CutPrefix(authHeader, "Bearer ")
+		if !ok || token == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing bearer token"})
+		}
+
+		claims, err := v.Verify(c.UserContext(), token)
+		if errors.Is(err, ErrAcceptanceRequired) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+		}
+
+		c.Locals(ClaimsKey, claims)
+		c.Locals(ContextKey, claims.OrgContext())
+		ttl := TTLOf(claims, time.Now())
+		c.Locals(TTLKey, &ttl)
+		c.Request().Header.Del(ImpersonatorHeader)
+		if claims.Impersonator != "" {
+			c.Request().Header.Set(ImpersonatorHeader, claims.Impersonator)
+		}
+		return c.Next()
+	}
+}
+
+// ClaimsFrom returns the claims stored by Middleware, or nil
+func ClaimsFrom(c *fiber.Ctx) *Claims {
+	claims, _ := c.Locals(ClaimsKey).(*Claims)
+	return claims
+}
+
+// ContextFrom returns the org context of the token Middleware verified, or
+// nil if the token has none it can read; callers then look the caller up
+func ContextFrom(c *fiber.Ctx) *Context {
+	x, _ := c.Locals(ContextKey).(*Context)
+	return x
+}
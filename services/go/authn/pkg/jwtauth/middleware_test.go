@@ -0,0 +1,52 @@
+package jwtauth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMiddlewareRejectsTokensRestrictedToAcceptingPolicies(t *testing.T) {
+	key := generateKey(t)
+	v := NewVerifier(Config{JWKSURL: newJWKSServer(t, key).URL})
+	app := fiber.New()
+	app.Get("/", Middleware(v), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+
+	restricted := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{
+		UserID:          "user-1",
+		SessionID:       "session-1",
+		NeedsAcceptance: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			Issuer:    Issuer,
+			Audience:  []string{Audience},
+		},
+	})
+	restricted.Header["kid"] = Thumbprint(&key.PublicKey)
+	restrictedToken, err := restricted.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		token string
+		want  int
+	}{
+		"restricted": {restrictedToken, fiber.StatusForbidden},
+		"full":       {signToken(t, key, "session-1"), fiber.StatusNoContent},
+		"garbage":    {"not-a-token", fiber.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s token: status %d, want %d", name, resp.StatusCode, tc.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package jwtauth
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TTLKey is the fiber.Ctx Locals key the verified token's TTL is stored
+// under
+const TTLKey = "jwtauth.ttl"
+
+// Response headers carrying a token's TTL in whole seconds, for clients that
+// schedule their refresh without decoding the token
+const (
+	ExpiresInHeader    = "X-Token-Expires-In"
+	RefreshAfterHeader = "X-Token-Refresh-After"
+)
+
+// refreshAfterShare is the share of a token's remaining life after which
+// clients are told to refresh it
+const refreshAfterShare = 0.8
+
+// TTL is how long a verified token has left
+type TTL struct {
+	// ExpiresIn is the time until the token expires, never negative
+	ExpiresIn time.Duration
+	// RefreshAfter is the time after which the client should refresh the
+	// token: most of ExpiresIn, so the refresh finishes before it lapses
+	RefreshAfter time.Duration
+	// Lifetime is the token's whole life from issue to expiry, or zero if
+	// it carries no issue time
+	Lifetime time.Duration
+}
+
+// TTLOf works out the TTL of a token with claims as of now
+func TTLOf(claims *Claims, now time.Time) TTL {
+	var ttl TTL
+	if claims.ExpiresAt == nil {
+		return ttl
+	}
+	ttl.ExpiresIn = max(claims.ExpiresAt.Sub(now), 0)
+	ttl.RefreshAfter = time.Duration(float64(ttl.ExpiresIn) * refreshAfterShare)
+	if claims.IssuedAt != nil {
+		ttl.Lifetime = max(claims.ExpiresAt.Sub(claims.IssuedAt.Time), 0)
+	}
+	return ttl
+}
+
+// NearlyExpired reports whether less than the last fifth of the token's
+// lifetime is left, the point past which a client that follows RefreshAfter
+// should already have refreshed it
+func (t TTL) NearlyExpired() bool {
+	if t.Lifetime <= 0 {
+		return false
+	}
+	return float64(t.ExpiresIn) < float64(t.Lifetime)*(1-refreshAfterShare)
+}
+
+// SetHeaders sets ExpiresInHeader and RefreshAfterHeader on the response
+func (t TTL) SetHeaders(c *fiber.Ctx) {
+	c.Set(ExpiresInHeader, formatSeconds(t.ExpiresIn))
+	c.Set(RefreshAfterHeader, formatSeconds(t.RefreshAfter))
+}
+
+// TTLFrom returns the TTL of the token Middleware verified, as of when it
+// was verified, or nil
+func TTLFrom(c *fiber.Ctx) *TTL {
+	ttl, _ := c.Locals(TTLKey).(*TTL)
+	return ttl
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
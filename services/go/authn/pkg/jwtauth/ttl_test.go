@@ -0,0 +1,76 @@
+package jwtauth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTTLOf(t *testing.T) {
+	issued := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(issued),
+		ExpiresAt: jwt.NewNumericDate(issued.Add(15 * time.Minute)),
+	}}
+
+	for _, tc := range []struct {
+		at                      time.Duration // after issue
+		expiresIn, refreshAfter time.Duration
+		nearlyExpired           bool
+	}{
+		{at: 0, expiresIn: 15 * time.Minute, refreshAfter: 12 * time.Minute},
+		{at: 10 * time.Minute, expiresIn: 5 * time.Minute, refreshAfter: 4 * time.Minute},
+		// Past the last fifth, 3 of the 15 minutes
+		{at: 12*time.Minute + time.Second, expiresIn: 2*time.Minute + 59*time.Second, refreshAfter: 143200 * time.Millisecond, nearlyExpired: true},
+		{at: 20 * time.Minute, expiresIn: 0, refreshAfter: 0, nearlyExpired: true},
+	} {
+		ttl := TTLOf(claims, issued.Add(tc.at))
+		if ttl.ExpiresIn != tc.expiresIn || ttl.RefreshAfter != tc.refreshAfter || ttl.Lifetime != 15*time.Minute {
+			t.Errorf("at %s: %+v, want expiring in %s, refreshing after %s, over 15m", tc.at, ttl, tc.expiresIn, tc.refreshAfter)
+		}
+		if ttl.NearlyExpired() != tc.nearlyExpired {
+			t.Errorf("at %s: nearly expired = %v, want %v", tc.at, ttl.NearlyExpired(), tc.nearlyExpired)
+		}
+	}
+
+	// Without an issue time the lifetime is unknown, so no token is nearly
+	// expired
+	claims.IssuedAt = nil
+	if ttl := TTLOf(claims, issued.Add(14*time.Minute)); ttl.Lifetime != 0 || ttl.NearlyExpired() {
+		t.Errorf("token without iat: %+v, nearly expired %v", ttl, ttl.NearlyExpired())
+	}
+}
+
+func TestMiddlewareExposesTheTTL(t *testing.T) {
+	key := generateKey(t)
+	v := NewVerifier(Config{JWKSURL: newJWKSServer(t, key).URL})
+	app := fiber.New()
+	app.Get("/", Middleware(v), func(c *fiber.Ctx) error {
+		ttl := TTLFrom(c)
+		if ttl == nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		ttl.SetHeaders(c)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, key, "session-1"))
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("status %d, want the handler to find the TTL", resp.StatusCode)
+	}
+	// signToken's tokens last 15 minutes
+	if got := resp.Header.Get(ExpiresInHeader); got != "899" && got != "900" {
+		t.Errorf("%s = %q, want about 900", ExpiresInHeader, got)
+	}
+	if got := resp.Header.Get(RefreshAfterHeader); got != "719" && got != "720" {
+		t.Errorf("%s = %q, want about 720", RefreshAfterHeader, got)
+	}
+}
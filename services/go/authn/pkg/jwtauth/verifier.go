@@ -0,0 +1,79 @@
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/jwks"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = jwks.ErrUnknownKey
+
+// ErrAcceptanceRequired is returned by Verify for a token whose user still
+// has to accept the current terms of service or privacy policy
+var ErrAcceptanceRequired = errors.New("policy documents must be accepted before this token can be used")
+
+// Config configures a Verifier. Only JWKSURL is required.
+type Config struct {
+	// JWKSURL is the authn key set, e.g. http://authn-service:8003/.well-known/jwks.json
+	JWKSURL string
+	// CacheTTL is how long a fetched key set is used before it is refetched
+	CacheTTL time.Duration
+	// MinRefreshInterval limits refetches triggered by unknown key IDs, so
+	// tokens with made-up kids cannot be used to hammer authn
+	MinRefreshInterval time.Duration
+	HTTPClient         *http.Client
+	// DenyList, when set, rejects tokens of revoked sessions. If it cannot
+	// be reached tokens are accepted, as they would be without it.
+	DenyList *DenyList
+}
+
+// Verifier validates access tokens against a cached copy of the authn JWKS
+type Verifier struct {
+	cfg  Config
+	keys *jwks.Cache
+}
+
+func NewVerifier(cfg Config) *Verifier {
+	return &Verifier{cfg: cfg, keys: jwks.NewCache(jwks.Config{
+		URL:                cfg.JWKSURL,
+		CacheTTL:           cfg.CacheTTL,
+		MinRefreshInterval: cfg.MinRefreshInterval,
+		HTTPClient:         cfg.HTTPClient,
+	})}
+}
+
+// Verify checks the token's signature, expiry, issuer and audience and
+// returns its claims
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{Algorithm}),
+		jwt.WithIssuer(Issuer),
+		jwt.WithAudience(Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if v.cfg.DenyList != nil {
+		revoked, err := v.cfg.DenyList.IsRevoked(ctx, claims.SessionID)
+		if err != nil {
+			log.Printf("jwtauth: deny list check for session %s failed: %v", claims.SessionID, err)
+		}
+		if revoked {
+			return nil, ErrRevoked
+		}
+	}
+	if claims.NeedsAcceptance {
+		return nil, ErrAcceptanceRequired
+	}
+	return claims, nil
+}
@@ -0,0 +1,161 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signToken signs an access token for session with key, the way authn does
+func signToken(t *testing.T, key *rsa.PrivateKey, session string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{
+		UserID:    "user-1",
+		SessionID: session,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			Issuer:    Issuer,
+			Audience:  []string{Audience},
+		},
+	})
+	token.Header["kid"] = Thumbprint(&key.PublicKey)
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// jwksServer serves whichever keys it was last given and counts fetches
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int64
+
+	mu   sync.Mutex
+	keys []*rsa.PrivateKey
+}
+
+func newJWKSServer(t *testing.T, keys ...*rsa.PrivateKey) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		set := JWKS{Keys: []JWK{}}
+		for _, key := range s.keys {
+			set.Keys = append(set.Keys, PublicJWK(Thumbprint(&key.PublicKey), &key.PublicKey))
+		}
+		s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) publish(keys ...*rsa.PrivateKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func TestVerifierAcceptsOldKeyDuringRotation(t *testing.T) {
+	oldKey, newKey := generateKey(t), generateKey(t)
+	jwks := newJWKSServer(t, oldKey)
+	v := NewVerifier(Config{JWKSURL: jwks.URL, MinRefreshInterval: time.Nanosecond})
+	ctx := context.Background()
+
+	oldToken := signToken(t, oldKey, "session-old")
+	if _, err := v.Verify(ctx, oldToken); err != nil {
+		t.Fatalf("token before the rotation = %v", err)
+	}
+
+	// authn starts signing with the new key and still publishes the old one.
+	// The cached set does not know the new kid yet, so it is refetched.
+	jwks.publish(newKey, oldKey)
+	claims, err := v.Verify(ctx, signToken(t, newKey, "session-new"))
+	if err != nil {
+		t.Fatalf("token signed with the new key = %v", err)
+	}
+	if claims.SessionID != "session-new" {
+		t.Fatalf("verified session %q, want session-new", claims.SessionID)
+	}
+	if _, err := v.Verify(ctx, oldToken); err != nil {
+		t.Fatalf("token signed with the old key during the rotation = %v", err)
+	}
+}
+
+func TestVerifierRejectsRemovedKey(t *testing.T) {
+	oldKey, newKey := generateKey(t), generateKey(t)
+	jwks := newJWKSServer(t, newKey, oldKey)
+	// Every check refetches, as one would once CacheTTL has passed
+	v := NewVerifier(Config{JWKSURL: jwks.URL, CacheTTL: time.Nanosecond, MinRefreshInterval: time.Nanosecond})
+	ctx := context.Background()
+
+	oldToken := signToken(t, oldKey, "session-old")
+	if _, err := v.Verify(ctx, oldToken); err != nil {
+		t.Fatalf("token signed with the old key = %v", err)
+	}
+
+	jwks.publish(newKey)
+	if _, err := v.Verify(ctx, oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("token signed with a removed key = %v, want ErrUnknownKey", err)
+	}
+	if _, err := v.Verify(ctx, signToken(t, newKey, "session-new")); err != nil {
+		t.Fatalf("token signed with the remaining key = %v", err)
+	}
+}
+
+func TestVerifierLimitsRefetchesForUnknownKeys(t *testing.T) {
+	key := generateKey(t)
+	jwks := newJWKSServer(t, key)
+	v := NewVerifier(Config{JWKSURL: jwks.URL, MinRefreshInterval: time.Minute})
+	ctx := context.Background()
+
+	if _, err := v.Verify(ctx, signToken(t, key, "session-1")); err != nil {
+		t.Fatal(err)
+	}
+	forged := signToken(t, generateKey(t), "session-1")
+	for i := 0; i < 10; i++ {
+		if _, err := v.Verify(ctx, forged); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("token signed with an unknown key = %v, want ErrUnknownKey", err)
+		}
+	}
+	if n := jwks.fetches.Load(); n != 1 {
+		t.Fatalf("JWKS fetched %d times, want once within MinRefreshInterval", n)
+	}
+}
+
+func TestVerifierKeepsStaleKeysWhileAuthnIsDown(t *testing.T) {
+	key := generateKey(t)
+	jwks := newJWKSServer(t, key)
+	v := NewVerifier(Config{JWKSURL: jwks.URL, CacheTTL: time.Nanosecond, MinRefreshInterval: time.Nanosecond})
+	ctx := context.Background()
+
+	token := signToken(t, key, "session-1")
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	jwks.Close()
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Fatalf("token with a cached key while the JWKS is unreachable = %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Package server builds the authn service the way cmd/server runs it, short
+// of listening, so that tests can serve it in-process.
+package server
+
+import (
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/request"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/api"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/authn/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+)
+
+// Config is the service's configuration, named here so that callers outside
+// the module can adjust one
+type Config = config.Config
+
+// LoadConfig reads the configuration from the environment, as main does
+func LoadConfig() *Config {
+	return config.Load()
+}
+
+// Server is the HTTP API and the service behind it
+type Server struct {
+	// App serves every route of the API
+	App *fiber.App
+	// Service is what the routes call
+	Service *service.AuthNService
+}
+
+// New builds the server from cfg. Redis and the downstreams are not reached
+// until a request needs them.
+func New(cfg *Config) (*Server, error) {
+	svc, err := service.NewAuthNService(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler, BodyLimit: request.DefaultBodyLimit})
+	app.Use(logger.New())
+	api.NewAuthNHandler(svc).RegisterRoutes(app)
+
+	return &Server{App: app, Service: svc}, nil
+}
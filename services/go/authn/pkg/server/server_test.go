@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestServerServesWithoutMain(t *testing.T) {
+	t.Setenv("REDIS_ADDR", miniredis.RunT(t).Addr())
+	srv, err := New(LoadConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := srv.App.Test(httptest.NewRequest("GET", "/health/live", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET /health/live = %d, want 200", resp.StatusCode)
+	}
+
+	resp, err = srv.App.Test(httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set jwtauth.JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].Kid == "" {
+		t.Fatalf("JWKS has %d keys, want the signing key", len(set.Keys))
+	}
+}
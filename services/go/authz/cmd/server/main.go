@@ -2,18 +2,17 @@ package main
 
 import (
 	"log"
+	"net"
 	"os"
-
+	"strconv"
 	"time"
 
-	"github.com/4yrg/gradeloop-core/services/go/authz/internal/api"
-	"github.com/4yrg/gradeloop-core/services/go/authz/internal/repository"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
 	"github.com/4yrg/gradeloop-core/services/go/authz/internal/service"
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/4yrg/gradeloop-core/services/go/authz/pkg/server"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	gormLogger "gorm.io/gorm/logger"
 )
 
 func main() {
@@ -22,6 +21,10 @@ func main() {
 	if port == "" {
 		port = "8004"
 	}
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9004"
+	}
 	dsn := os.Getenv("AUTHZ_DATABASE_URL")
 	if dsn == "" {
 		dsn = os.Getenv("DATABASE_URL")
@@ -30,29 +33,64 @@ func main() {
 		log.Fatal("AUTHZ_DATABASE_URL or DATABASE_URL must be set")
 	}
 
-	// Quiet Logger for Startup
-	newLogger := gormLogger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-		gormLogger.Config{
-			SlowThreshold:             500 * time.Millisecond, // Slow SQL threshold
-			LogLevel:                  gormLogger.Warn,        // Log level
-			IgnoreRecordNotFoundError: true,                   // Ignore ErrRecordNotFound error for logger
-			ParameterizedQueries:      true,                   // Don't include params in the SQL log
-			Colorful:                  true,                   // Disable color
-		},
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: newLogger,
-	})
+	poolCfg, err := database.LoadPoolConfig("AUTHZ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.Open(postgres.Open(dsn), poolCfg)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	serviceTokenTTL := service.DefaultServiceTokenTTL
+	if v := os.Getenv("SERVICE_TOKEN_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid SERVICE_TOKEN_TTL %q", v)
+		}
+		serviceTokenTTL = d
+	}
+	// Admin routes accept user access tokens, verified against authn's keys
+	jwksURL := os.Getenv("AUTHN_JWKS_URL")
+	if jwksURL == "" {
+		jwksURL = "http://localhost:8003/.well-known/jwks.json"
+	}
+	verifierCfg := jwtauth.Config{JWKSURL: jwksURL}
+	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
+		// Reject access tokens of sessions revoked before the tokens expire
+		redisDB := 0
+		if v := os.Getenv("REDIS_DB"); v != "" {
+			redisDB, err = strconv.Atoi(v)
+			if err != nil {
+				log.Fatalf("Invalid REDIS_DB %q", v)
+			}
+		}
+		denyListCacheTTL := 5 * time.Second
+		if v := os.Getenv("TOKEN_DENYLIST_CACHE_TTL"); v != "" {
+			denyListCacheTTL, err = time.ParseDuration(v)
+			if err != nil {
+				log.Fatalf("Invalid TOKEN_DENYLIST_CACHE_TTL %q", v)
+			}
+		}
+		verifierCfg.DenyList = jwtauth.NewDenyList(redis.NewClient(&redis.Options{
+			Addr:     redisAddr,
+			Username: os.Getenv("REDIS_USERNAME"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       redisDB,
+		}), denyListCacheTTL)
+	}
+	verifier := jwtauth.NewVerifier(verifierCfg)
+
 	// 3. DI
-	repo := repository.NewAuthZRepository(db)
-	svc := service.NewAuthZService(repo)
-	handler := api.NewAuthZHandler(svc)
+	srv, err := server.New(server.Config{
+		ServiceTokenPrivateKey: os.Getenv("SERVICE_TOKEN_PRIVATE_KEY"),
+		ServiceTokenTTL:        serviceTokenTTL,
+		Verifier:               verifier,
+	}, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc := srv.Service
 
 	// 4. Init (Migrate + Seed)
 	if err := svc.Init(); err != nil {
@@ -62,14 +100,40 @@ func main() {
 	// For dev simplicity, we'll just try to seed and ignore duplicates (handled by db constraints)
 	_ = svc.SeedDefaults()
 
-	// 5. Server
-	app := fiber.New()
-	app.Use(logger.New())
+	// Expired direct grants are already ignored; this just deletes them
+	cleanupInterval := time.Hour
+	if v := os.Getenv("GRANT_CLEANUP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid GRANT_CLEANUP_INTERVAL %q", v)
+		}
+		cleanupInterval = d
+	}
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := svc.PurgeExpiredGrants()
+			if err != nil {
+				log.Printf("Failed to purge expired grants: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d expired grants", n)
+			}
+		}
+	}()
 
-	handler.RegisterRoutes(app)
+	// 5. Server; the gRPC API shares the service with the HTTP one
+	lis, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		log.Fatalf("failed to listen for gRPC: %v", err)
+	}
+	go func() {
+		log.Printf("AuthZ service gRPC API starting on port %s", grpcPort)
+		log.Fatal(srv.GRPC.Serve(lis))
+	}()
 
 	log.Printf("AuthZ service starting on port %s", port)
-	if err := app.Listen(":" + port); err != nil {
+	if err := srv.App.Listen(":" + port); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
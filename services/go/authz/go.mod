@@ -3,15 +3,38 @@ module github.com/4yrg/gradeloop-core/services/go/authz
 go 1.25.6
 
 require (
+	github.com/4yrg/gradeloop-core/libs/apierror v0.0.0
+	github.com/4yrg/gradeloop-core/libs/database v0.0.0
+	github.com/4yrg/gradeloop-core/libs/pagination v0.0.0
+	github.com/4yrg/gradeloop-core/libs/request v0.0.0
+	github.com/4yrg/gradeloop-core/libs/rpc v0.0.0
+	github.com/4yrg/gradeloop-core/libs/servicetoken v0.0.0
+	github.com/4yrg/gradeloop-core/services/go/authn v0.0.0
+	github.com/alicebob/miniredis/v2 v2.33.0
+	github.com/glebarez/go-sqlite v1.21.2
+	github.com/glebarez/sqlite v1.11.0
 	github.com/gofiber/fiber/v2 v2.52.10
 	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/google/uuid v1.6.0
+	github.com/redis/go-redis/v9 v9.17.3
+	google.golang.org/grpc v1.75.1
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/postgres v1.6.0
 	gorm.io/gorm v1.31.1
 )
 
 require (
+	github.com/4yrg/gradeloop-core/libs/config v0.0.0 // indirect
+	github.com/4yrg/gradeloop-core/libs/jwks v0.0.0 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/gabriel-vasile/mimetype v1.4.8 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/go-playground/validator/v10 v10.26.0 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/pgx/v5 v5.6.0 // indirect
@@ -19,15 +42,42 @@ require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/leodido/go-urn v1.4.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasthttp v1.51.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
-	golang.org/x/sync v0.10.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/crypto v0.39.0 // indirect
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/sync v0.15.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250707201910-8d1bb00bc6a7 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+	modernc.org/libc v1.22.5 // indirect
+	modernc.org/mathutil v1.5.0 // indirect
+	modernc.org/memory v1.5.0 // indirect
+	modernc.org/sqlite v1.23.1 // indirect
 )
+
+replace github.com/4yrg/gradeloop-core/libs/config => ../../../libs/config
+
+replace github.com/4yrg/gradeloop-core/libs/database => ../../../libs/database
+
+replace github.com/4yrg/gradeloop-core/libs/pagination => ../../../libs/pagination
+
+replace github.com/4yrg/gradeloop-core/libs/apierror => ../../../libs/apierror
+
+replace github.com/4yrg/gradeloop-core/libs/request => ../../../libs/request
+
+replace github.com/4yrg/gradeloop-core/libs/rpc => ../../../libs/rpc
+
+replace github.com/4yrg/gradeloop-core/libs/servicetoken => ../../../libs/servicetoken
+
+replace github.com/4yrg/gradeloop-core/libs/jwks => ../../../libs/jwks
+replace github.com/4yrg/gradeloop-core/services/go/authn => ../authn
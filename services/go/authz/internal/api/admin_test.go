@@ -0,0 +1,407 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/middleware"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/service"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testInternalToken = "insecure-secret-for-dev"
+
+// adminFixture is the authz HTTP API over an in-memory seeded database,
+// with an authn stand-in signing user access tokens
+type adminFixture struct {
+	app      *fiber.App
+	db       *gorm.DB
+	svc      *service.AuthZService
+	denyList *jwtauth.DenyList
+	userKey  *rsa.PrivateKey
+}
+
+func newAdminFixture(t *testing.T) *adminFixture {
+	t.Helper()
+	t.Setenv("INTERNAL_SECRET", testInternalToken)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One connection keeps the in-memory database shared and its writes,
+	// including the asynchronous audit ones, serialised
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	tokenSvc, err := service.NewServiceTokenService("", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewAuthZService(repository.NewAuthZRepository(db), tokenSvc)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SeedDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	userKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwtauth.JWKS{Keys: []jwtauth.JWK{jwtauth.PublicJWK("test", &userKey.PublicKey)}})
+	}))
+	t.Cleanup(jwks.Close)
+
+	mr := miniredis.RunT(t)
+	denyList := jwtauth.NewDenyList(redis.NewClient(&redis.Options{Addr: mr.Addr()}), 0)
+	verifier := jwtauth.NewVerifier(jwtauth.Config{JWKSURL: jwks.URL, DenyList: denyList})
+
+	app := fiber.New()
+	NewAuthZHandler(svc).RegisterRoutes(app, middleware.NewAdmin(svc, verifier))
+	return &adminFixture{app: app, db: db, svc: svc, denyList: denyList, userKey: userKey}
+}
+
+// userToken signs an access token for userID, as authn would
+func (f *adminFixture) userToken(t *testing.T, userID, sessionID string) string {
+	t.Helper()
+	return f.roleToken(t, userID, sessionID, "")
+}
+
+// roleToken signs an access token for userID of the identity user type role
+func (f *adminFixture) roleToken(t *testing.T, userID, sessionID, role string) string {
+	t.Helper()
+	claims := jwtauth.Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		Role:      role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Issuer:    jwtauth.Issuer,
+			Audience:  jwt.ClaimStrings{jwtauth.Audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(f.userKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// serviceToken creates an active service account allowed perms and returns
+// a token issued to it through /service-token
+func (f *adminFixture) serviceToken(t *testing.T, name string, perms ...string) string {
+	t.Helper()
+	account, err := f.svc.CreateServiceAccount(service.ServiceAccountRequest{Name: name, Permissions: &perms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body := f.do(t, http.MethodPost, "/internal/authz/service-token", "",
+		`{"service_name":"`+name+`","client_secret":"`+account.ClientSecret+`"}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("service-token: got %d %s", status, body)
+	}
+	var issued service.IssuedServiceToken
+	if err := json.Unmarshal([]byte(body), &issued); err != nil {
+		t.Fatal(err)
+	}
+	return issued.Token
+}
+
+func (f *adminFixture) do(t *testing.T, method, path, bearer, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", testInternalToken)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := f.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(raw)
+}
+
+// grant gives userID the named permission directly
+func (f *adminFixture) grant(t *testing.T, userID, permission string) {
+	t.Helper()
+	if _, err := f.svc.GrantUserPermission(userID, permission, "", nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// adminAudits returns the audit entries recorded for admin API changes
+func (f *adminFixture) adminAudits(t *testing.T) []domain.AuditLog {
+	t.Helper()
+	var logs []domain.AuditLog
+	if err := f.db.Where("resource = ?", service.AdminActionResource).Order("timestamp").Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	return logs
+}
+
+func TestAdminRoutesRejectMissingAndInvalidTokens(t *testing.T) {
+	f := newAdminFixture(t)
+
+	for name, bearer := range map[string]string{"missing": "", "invalid": "not-a-token"} {
+		t.Run(name, func(t *testing.T) {
+			if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", bearer, ""); status != fiber.StatusUnauthorized {
+				t.Fatalf("got %d %s, want 401", status, body)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesNeedInternalToken(t *testing.T) {
+	f := newAdminFixture(t)
+	admin := uuid.NewString()
+	f.grant(t, admin, service.AdminReadPermission)
+	token := f.userToken(t, admin, "session-1")
+
+	req := httptest.NewRequest(http.MethodGet, "/internal/authz/permissions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := f.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("got %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestAdminRoutesUserToken(t *testing.T) {
+	f := newAdminFixture(t)
+
+	reader := uuid.NewString()
+	f.grant(t, reader, service.AdminReadPermission)
+	admin := uuid.NewString()
+	f.grant(t, admin, service.AdminReadPermission)
+	f.grant(t, admin, service.AdminManagePermission)
+
+	t.Run("without permission", func(t *testing.T) {
+		token := f.userToken(t, uuid.NewString(), "session-1")
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusForbidden {
+			t.Fatalf("got %d %s, want 403", status, body)
+		}
+		if status, body := f.do(t, http.MethodPost, "/internal/authz/permissions", token, `{"name":"x.read","resource":"x","action":"read"}`); status != fiber.StatusForbidden {
+			t.Fatalf("got %d %s, want 403", status, body)
+		}
+		if logs := f.adminAudits(t); len(logs) != 0 {
+			t.Fatalf("refused calls were audited: %+v", logs)
+		}
+	})
+
+	t.Run("read but not manage", func(t *testing.T) {
+		token := f.userToken(t, reader, "session-2")
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusOK {
+			t.Fatalf("read: got %d %s, want 200", status, body)
+		}
+		if status, body := f.do(t, http.MethodDelete, "/internal/authz/permissions/authz.read", token, ""); status != fiber.StatusForbidden {
+			t.Fatalf("manage: got %d %s, want 403", status, body)
+		}
+	})
+
+	t.Run("with permission", func(t *testing.T) {
+		token := f.userToken(t, admin, "session-3")
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusOK {
+			t.Fatalf("read: got %d %s, want 200", status, body)
+		}
+		if status, body := f.do(t, http.MethodPost, "/internal/authz/permissions", token, `{"name":"report.read","resource":"report","action":"read"}`); status != fiber.StatusCreated {
+			t.Fatalf("manage: got %d %s, want 201", status, body)
+		}
+
+		logs := f.adminAudits(t)
+		if len(logs) != 1 {
+			t.Fatalf("got %d admin audit entries, want 1 for the change only: %+v", len(logs), logs)
+		}
+		if logs[0].Subject != admin || logs[0].Action != "post" || logs[0].Decision != "ALLOW" {
+			t.Fatalf("unexpected audit entry %+v", logs[0])
+		}
+		var ctx map[string]interface{}
+		if err := json.Unmarshal([]byte(logs[0].Context), &ctx); err != nil {
+			t.Fatal(err)
+		}
+		if ctx["route"] != "/internal/authz/permissions" || ctx["status"] != float64(fiber.StatusCreated) {
+			t.Fatalf("unexpected audit context %v", ctx)
+		}
+	})
+
+	t.Run("through the system admin role", func(t *testing.T) {
+		// The token carries the user type; the seeded role is lower case
+		token := f.roleToken(t, uuid.NewString(), "session-5", "SYSTEM_ADMIN")
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusOK {
+			t.Fatalf("read: got %d %s, want 200", status, body)
+		}
+		if status, body := f.do(t, http.MethodPost, "/internal/authz/permissions", token, `{"name":"audit.read","resource":"audit","action":"read"}`); status != fiber.StatusCreated {
+			t.Fatalf("manage: got %d %s, want 201", status, body)
+		}
+		token = f.roleToken(t, uuid.NewString(), "session-6", "STUDENT")
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusForbidden {
+			t.Fatalf("student: got %d %s, want 403", status, body)
+		}
+	})
+
+	t.Run("revoked session", func(t *testing.T) {
+		token := f.userToken(t, admin, "session-4")
+		if err := f.denyList.Revoke(context.Background(), "session-4", time.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusUnauthorized {
+			t.Fatalf("got %d %s, want 401", status, body)
+		}
+	})
+}
+
+func TestAdminRoutesServiceToken(t *testing.T) {
+	f := newAdminFixture(t)
+
+	t.Run("read only", func(t *testing.T) {
+		token := f.serviceToken(t, "reporting", service.AdminReadPermission)
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusOK {
+			t.Fatalf("read: got %d %s, want 200", status, body)
+		}
+		if status, body := f.do(t, http.MethodDelete, "/internal/authz/permissions/authz.read", token, ""); status != fiber.StatusForbidden {
+			t.Fatalf("manage: got %d %s, want 403", status, body)
+		}
+	})
+
+	t.Run("manage", func(t *testing.T) {
+		token := f.serviceToken(t, "provisioner", service.AdminManagePermission)
+		user := uuid.NewString()
+		if status, body := f.do(t, http.MethodPost, "/internal/authz/users/"+user+"/permissions", token, `{"permission_name":"authz.read"}`); status != fiber.StatusCreated {
+			t.Fatalf("got %d %s, want 201", status, body)
+		}
+
+		logs := f.adminAudits(t)
+		if len(logs) != 1 || logs[0].Subject != "service:provisioner" || logs[0].Action != "post" {
+			t.Fatalf("unexpected admin audit entries %+v", logs)
+		}
+		var grant domain.UserPermission
+		if err := f.db.Where("user_id = ?", user).First(&grant).Error; err != nil {
+			t.Fatal(err)
+		}
+		if grant.GrantedBy != "service:provisioner" {
+			t.Fatalf("grant recorded as granted by %q", grant.GrantedBy)
+		}
+	})
+
+	t.Run("account disabled after issue", func(t *testing.T) {
+		token := f.serviceToken(t, "retired", service.AdminReadPermission)
+		active := false
+		if _, err := f.svc.UpdateServiceAccount("retired", service.ServiceAccountRequest{Active: &active}); err != nil {
+			t.Fatal(err)
+		}
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusUnauthorized {
+			t.Fatalf("got %d %s, want 401", status, body)
+		}
+	})
+
+	t.Run("account deleted after issue", func(t *testing.T) {
+		token := f.serviceToken(t, "removed", service.AdminReadPermission)
+		if _, err := f.svc.DeleteServiceAccount("removed"); err != nil {
+			t.Fatal(err)
+		}
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusUnauthorized {
+			t.Fatalf("got %d %s, want 401", status, body)
+		}
+	})
+
+	t.Run("permission removed after issue", func(t *testing.T) {
+		token := f.serviceToken(t, "narrowed", service.AdminReadPermission)
+		none := []string{}
+		if _, err := f.svc.UpdateServiceAccount("narrowed", service.ServiceAccountRequest{Permissions: &none}); err != nil {
+			t.Fatal(err)
+		}
+		if status, body := f.do(t, http.MethodGet, "/internal/authz/permissions", token, ""); status != fiber.StatusForbidden {
+			t.Fatalf("got %d %s, want 403", status, body)
+		}
+	})
+}
+
+func TestServiceTokenNeedsClientSecret(t *testing.T) {
+	f := newAdminFixture(t)
+	perms := []string{service.AdminManagePermission}
+	account, err := f.svc.CreateServiceAccount(service.ServiceAccountRequest{Name: "ci", Permissions: &perms})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, body := range map[string]string{
+		"no secret":       `{"service_name":"ci"}`,
+		"wrong secret":    `{"service_name":"ci","client_secret":"guess"}`,
+		"unknown account": `{"service_name":"nobody","client_secret":"` + account.ClientSecret + `"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if status, resp := f.do(t, http.MethodPost, "/internal/authz/service-token", "", body); status != fiber.StatusUnauthorized {
+				t.Fatalf("got %d %s, want 401", status, resp)
+			}
+		})
+	}
+
+	t.Run("rotated secret", func(t *testing.T) {
+		rotated, err := f.svc.RotateServiceAccountSecret("ci")
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := `{"service_name":"ci","client_secret":"` + account.ClientSecret + `"}`
+		if status, resp := f.do(t, http.MethodPost, "/internal/authz/service-token", "", old); status != fiber.StatusUnauthorized {
+			t.Fatalf("old secret: got %d %s, want 401", status, resp)
+		}
+		current := `{"service_name":"ci","client_secret":"` + rotated.ClientSecret + `"}`
+		if status, resp := f.do(t, http.MethodPost, "/internal/authz/service-token", "", current); status != fiber.StatusOK {
+			t.Fatalf("new secret: got %d %s, want 200", status, resp)
+		}
+	})
+}
+
+func TestBootstrapAccountSeededDisabled(t *testing.T) {
+	f := newAdminFixture(t)
+
+	account, err := f.svc.GetServiceAccount(service.BootstrapServiceAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Active {
+		t.Fatal("bootstrap service account is seeded active")
+	}
+
+	// Even with its secret, a disabled account gets no token
+	rotated, err := f.svc.RotateServiceAccountSecret(service.BootstrapServiceAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"service_name":"bootstrap","client_secret":"` + rotated.ClientSecret + `"}`
+	if status, resp := f.do(t, http.MethodPost, "/internal/authz/service-token", "", body); status != fiber.StatusForbidden {
+		t.Fatalf("got %d %s, want 403", status, resp)
+	}
+}
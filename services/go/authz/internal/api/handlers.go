@@ -1,10 +1,19 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
 	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
 	"github.com/4yrg/gradeloop-core/services/go/authz/internal/middleware"
 	"github.com/4yrg/gradeloop-core/services/go/authz/internal/service"
 	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
 )
 
 type AuthZHandler struct {
@@ -20,6 +29,12 @@ type CheckRequest struct {
 	Role     string `json:"role"`
 	Resource string `json:"resource"`
 	Action   string `json:"action"`
+	// Scope is the resource instance being accessed, e.g. "course:<id>",
+	// matched against scoped direct grants
+	Scope string `json:"scope,omitempty"`
+	// Institutes are the subject's per-institute roles; the one for the
+	// institute in Scope ("institute:<id>") applies too
+	Institutes []service.InstituteBinding `json:"institutes,omitempty"`
 }
 
 type CheckResponse struct {
@@ -32,7 +47,7 @@ func (h *AuthZHandler) CheckPermission(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	allowed, err := h.svc.CheckPermission(req.Subject, req.Role, req.Resource, req.Action)
+	allowed, err := h.svc.CheckPermission(req.Subject, req.Role, req.Resource, req.Action, req.Scope, req.Institutes)
 	if err != nil {
 		// Log error but return false for security
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -41,11 +56,48 @@ func (h *AuthZHandler) CheckPermission(c *fiber.Ctx) error {
 	return c.JSON(CheckResponse{Allowed: allowed})
 }
 
+// CheckBatchRequest asks for several decisions for one subject and role
+type CheckBatchRequest struct {
+	Subject    string                     `json:"subject"`
+	Role       string                     `json:"role"`
+	Scope      string                     `json:"scope,omitempty"`
+	Institutes []service.InstituteBinding `json:"institutes,omitempty"`
+	Checks     []service.PermissionCheck  `json:"checks"`
+}
+
+// CheckBatchResponse lists the decisions in the order of the checks
+type CheckBatchResponse struct {
+	BatchID   string          `json:"batch_id"`
+	Decisions []CheckResponse `json:"decisions"`
+}
+
+func (h *AuthZHandler) CheckPermissionBatch(c *fiber.Ctx) error {
+	var req CheckBatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	allowed, batchID, err := h.svc.CheckPermissions(req.Subject, req.Role, req.Scope, req.Institutes, req.Checks)
+	if errors.Is(err, service.ErrEmptyBatch) || errors.Is(err, service.ErrBatchTooLarge) || errors.Is(err, service.ErrMixedSubjects) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	resp := CheckBatchResponse{BatchID: batchID.String(), Decisions: make([]CheckResponse, len(allowed))}
+	for i, a := range allowed {
+		resp.Decisions[i] = CheckResponse{Allowed: a}
+	}
+	return c.JSON(resp)
+}
+
 func (h *AuthZHandler) CreateRole(c *fiber.Ctx) error {
 	var req struct {
 		Name        string       `json:"name"`
 		Scope       domain.Scope `json:"scope"`
 		Description string       `json:"description"`
+		Inherits    []string     `json:"inherits"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
@@ -54,6 +106,11 @@ func (h *AuthZHandler) CreateRole(c *fiber.Ctx) error {
 	if err := h.svc.CreateRole(req.Name, req.Scope, req.Description); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	if req.Inherits != nil {
+		if err := h.svc.SetRoleInherits(req.Name, req.Inherits); err != nil {
+			return inheritError(c, err)
+		}
+	}
 
 	return c.SendStatus(fiber.StatusCreated)
 }
@@ -66,6 +123,28 @@ func (h *AuthZHandler) GetRoles(c *fiber.Ctx) error {
 	return c.JSON(roles)
 }
 
+func (h *AuthZHandler) GetRole(c *fiber.Ctx) error {
+	role, err := h.svc.GetRole(c.Params("name"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Role not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(role)
+}
+
+// inheritError maps errors from changing a role's parents
+func inheritError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrInheritanceCycle) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
 func (h *AuthZHandler) CreatePermission(c *fiber.Ctx) error {
 	var req struct {
 		Name        string `json:"name"`
@@ -110,47 +189,115 @@ func (h *AuthZHandler) AssignPermission(c *fiber.Ctx) error {
 
 func (h *AuthZHandler) ResolvePermissions(c *fiber.Ctx) error {
 	var req struct {
-		UserID string `json:"user_id"`
-		Role   string `json:"role"`
+		UserID     string                     `json:"user_id"`
+		Role       string                     `json:"role"`
+		Institutes []service.InstituteBinding `json:"institutes"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	resolved, err := h.svc.ResolvePermissions(req.UserID, req.Role, req.Institutes)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(resolved)
+}
+
+func (h *AuthZHandler) GrantUserPermission(c *fiber.Ctx) error {
+	var req struct {
+		PermissionName string     `json:"permission_name"`
+		Scope          string     `json:"scope"`
+		ExpiresAt      *time.Time `json:"expires_at"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	perms, err := h.svc.ResolvePermissions(req.UserID, req.Role)
+	grantedBy := middleware.PrincipalFrom(c).Subject
+	grant, err := h.svc.GrantUserPermission(c.Params("id"), req.PermissionName, req.Scope, req.ExpiresAt, grantedBy)
 	if err != nil {
-		// If role not found, maybe return valid empty permissions?
-		// For now return error to be safe
+		if errors.Is(err, service.ErrInvalidGrant) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Permission not found"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	return c.Status(fiber.StatusCreated).JSON(grant)
+}
 
-	return c.JSON(fiber.Map{"permissions": perms})
+func (h *AuthZHandler) GetUserPermissions(c *fiber.Ctx) error {
+	grants, err := h.svc.GetUserPermissions(c.Params("id"), c.QueryBool("include_expired"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidGrant) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(grants)
+}
+
+func (h *AuthZHandler) RevokeUserPermission(c *fiber.Ctx) error {
+	var req struct {
+		PermissionName string `json:"permission_name"`
+		Scope          string `json:"scope"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	revoked, err := h.svc.RevokeUserPermission(c.Params("id"), req.PermissionName, req.Scope)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidGrant) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !revoked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Grant not found"})
+	}
+	return c.SendStatus(fiber.StatusOK)
 }
 
 func (h *AuthZHandler) UpdateRole(c *fiber.Ctx) error {
 	name := c.Params("name") // Using name as ID
 	var req struct {
-		Description string `json:"description"`
+		Description *string   `json:"description"`
+		Inherits    *[]string `json:"inherits"` // Replaces the parents; [] removes them all
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
-	if err := h.svc.UpdateRole(name, req.Description); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if req.Description != nil {
+		if err := h.svc.UpdateRole(name, *req.Description); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if req.Inherits != nil {
+		if err := h.svc.SetRoleInherits(name, *req.Inherits); err != nil {
+			return inheritError(c, err)
+		}
 	}
 	return c.SendStatus(fiber.StatusOK)
 }
 
 func (h *AuthZHandler) CreatePolicy(c *fiber.Ctx) error {
 	var req struct {
-		RoleName       string `json:"role_name"`
-		PermissionName string `json:"permission_name"`
+		RoleName       string        `json:"role_name"`
+		PermissionName string        `json:"permission_name"`
+		Effect         domain.Effect `json:"effect"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	if err := h.svc.CreatePolicy(req.RoleName, req.PermissionName); err != nil {
+	if err := h.svc.CreatePolicy(req.RoleName, req.PermissionName, req.Effect); err != nil {
+		if errors.Is(err, service.ErrInvalidPolicy) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.SendStatus(fiber.StatusCreated)
@@ -167,48 +314,172 @@ func (h *AuthZHandler) GetPolicies(c *fiber.Ctx) error {
 func (h *AuthZHandler) DeletePolicy(c *fiber.Ctx) error {
 	id := c.Params("id")
 	if err := h.svc.DeletePolicy(id); err != nil {
+		if errors.Is(err, service.ErrInvalidPolicy) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.SendStatus(fiber.StatusOK)
 }
 
-func (h *AuthZHandler) ServiceToken(c *fiber.Ctx) error {
+// ExportPolicies returns the whole authorization model as a policy document,
+// in JSON or, with ?format=yaml, YAML
+func (h *AuthZHandler) ExportPolicies(c *fiber.Ctx) error {
+	doc, err := h.svc.ExportPolicies()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	switch c.Query("format", "json") {
+	case "json":
+		return c.JSON(doc)
+	case "yaml":
+		out, err := yaml.Marshal(doc)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Set(fiber.HeaderContentType, "application/yaml")
+		return c.Send(out)
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be json or yaml"})
+}
+
+// ImportPolicies applies a policy document sent as JSON or, with a YAML
+// Content-Type, YAML. ?prune=true also deletes what the document leaves out;
+// ?dry_run=true only returns the plan.
+func (h *AuthZHandler) ImportPolicies(c *fiber.Ctx) error {
+	doc, err := decodePolicyDocument(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid policy document: " + err.Error()})
+	}
+
+	dryRun := c.QueryBool("dry_run")
+	plan, err := h.svc.ImportPolicies(doc, c.QueryBool("prune"), dryRun)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDocument) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"dry_run": dryRun, "changed": !plan.Empty(), "plan": plan})
+}
+
+// decodePolicyDocument reads the request body as a policy document, rejecting
+// unknown fields so a misspelt key is not silently ignored
+func decodePolicyDocument(c *fiber.Ctx) (*domain.PolicyDocument, error) {
+	var doc domain.PolicyDocument
+	if strings.Contains(c.Get(fiber.HeaderContentType), "yaml") {
+		dec := yaml.NewDecoder(bytes.NewReader(c.Body()))
+		dec.KnownFields(true)
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		return &doc, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (h *AuthZHandler) ListAuditLogs(c *fiber.Ctx) error {
+	page, err := pagination.Parse(c.Query("cursor"), c.Query("offset"), c.Query("limit"), 50, 500)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	logs, err := h.svc.ListAuditLogs(c.Query("subject"), page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(logs)
+}
+
+// RecordAuditEvent stores an audit event reported by another service.
+// Context is any JSON value and is kept as is.
+func (h *AuthZHandler) RecordAuditEvent(c *fiber.Ctx) error {
 	var req struct {
-		ServiceName string `json:"service_name"`
+		Subject  string          `json:"subject"`
+		Resource string          `json:"resource"`
+		Action   string          `json:"action"`
+		Decision string          `json:"decision"`
+		Context  json.RawMessage `json:"context"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
-	token, err := h.svc.IssueServiceToken(req.ServiceName)
-	if err != nil {
+
+	event := &domain.AuditLog{
+		Subject:  req.Subject,
+		Resource: req.Resource,
+		Action:   req.Action,
+		Decision: req.Decision,
+		Context:  string(req.Context),
+	}
+	if err := h.svc.RecordAuditEvent(event); err != nil {
+		if errors.Is(err, service.ErrInvalidAuditEvent) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-	return c.JSON(fiber.Map{"token": token})
-
+	return c.Status(fiber.StatusCreated).JSON(event)
 }
 
-func (h *AuthZHandler) RegisterRoutes(app *fiber.App) {
+// RegisterRoutes mounts the API under the internal token. The check and
+// resolve endpoints other services call need nothing more; the admin routes
+// also need a user or service token allowed to read or manage authz.
+func (h *AuthZHandler) RegisterRoutes(app *fiber.App, admin *middleware.Admin) {
 	internal := app.Group("/internal/authz", middleware.InternalAuth())
+	read := admin.Require(service.AdminReadPermission)
+	manage := admin.Require(service.AdminManagePermission)
 
 	internal.Post("/check", h.CheckPermission)
+	internal.Post("/check-batch", h.CheckPermissionBatch)
 	internal.Post("/resolve", h.ResolvePermissions)
 
-	internal.Post("/roles", h.CreateRole)
-	internal.Get("/roles", h.GetRoles)
-	internal.Patch("/roles/:name", h.UpdateRole)
-	internal.Delete("/roles/:name", h.DeleteRole)
-
-	internal.Post("/permissions", h.CreatePermission)
-	internal.Get("/permissions", h.GetPermissions)
-	internal.Delete("/permissions/:name", h.DeletePermission)
-	internal.Post("/permissions/assign", h.AssignPermission)
-	internal.Post("/permissions/revoke", h.RevokePermission)
-
-	internal.Post("/policies", h.CreatePolicy)
-	internal.Get("/policies", h.GetPolicies)
-	internal.Delete("/policies/:id", h.DeletePolicy)
-
+	internal.Post("/roles", manage, h.CreateRole)
+	internal.Get("/roles", read, h.GetRoles)
+	internal.Get("/roles/:name", read, h.GetRole)
+	internal.Patch("/roles/:name", manage, h.UpdateRole)
+	internal.Delete("/roles/:name", manage, h.DeleteRole)
+
+	internal.Post("/permissions", manage, h.CreatePermission)
+	internal.Get("/permissions", read, h.GetPermissions)
+	internal.Delete("/permissions/:name", manage, h.DeletePermission)
+	internal.Post("/permissions/assign", manage, h.AssignPermission)
+	internal.Post("/permissions/revoke", manage, h.RevokePermission)
+
+	internal.Post("/users/:id/permissions", manage, h.GrantUserPermission)
+	internal.Get("/users/:id/permissions", read, h.GetUserPermissions)
+	internal.Delete("/users/:id/permissions", manage, h.RevokeUserPermission)
+
+	internal.Post("/policies", manage, h.CreatePolicy)
+	internal.Get("/policies", read, h.GetPolicies)
+	internal.Delete("/policies/:id", manage, h.DeletePolicy)
+
+	internal.Get("/export", read, h.ExportPolicies)
+	internal.Post("/import", manage, h.ImportPolicies)
+
+	internal.Get("/audit-logs", read, h.ListAuditLogs)
+	// Services report events such as impersonation starting
+	internal.Post("/audit-logs", h.RecordAuditEvent)
+
+	internal.Post("/service-accounts", manage, h.CreateServiceAccount)
+	internal.Get("/service-accounts", read, h.ListServiceAccounts)
+	internal.Get("/service-accounts/:name", read, h.GetServiceAccount)
+	internal.Patch("/service-accounts/:name", manage, h.UpdateServiceAccount)
+	internal.Delete("/service-accounts/:name", manage, h.DeleteServiceAccount)
+	internal.Post("/service-accounts/:name/secret", manage, h.RotateServiceAccountSecret)
 	internal.Post("/service-token", h.ServiceToken)
+
+	// Public keys, so services can verify service tokens without a secret
+	app.Get("/.well-known/jwks.json", h.ServiceTokenKeys)
 }
 
 func (h *AuthZHandler) DeleteRole(c *fiber.Ctx) error {
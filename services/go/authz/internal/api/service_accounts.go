@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/middleware"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func (h *AuthZHandler) CreateServiceAccount(c *fiber.Ctx) error {
+	var req service.ServiceAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	req.CreatedBy = middleware.PrincipalFrom(c).Subject
+	account, err := h.svc.CreateServiceAccount(req)
+	if err != nil {
+		return serviceAccountError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(account)
+}
+
+func (h *AuthZHandler) ListServiceAccounts(c *fiber.Ctx) error {
+	accounts, err := h.svc.ListServiceAccounts()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(accounts)
+}
+
+func (h *AuthZHandler) GetServiceAccount(c *fiber.Ctx) error {
+	account, err := h.svc.GetServiceAccount(c.Params("name"))
+	if err != nil {
+		return serviceAccountError(c, err)
+	}
+	return c.JSON(account)
+}
+
+func (h *AuthZHandler) UpdateServiceAccount(c *fiber.Ctx) error {
+	var req service.ServiceAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	account, err := h.svc.UpdateServiceAccount(c.Params("name"), req)
+	if err != nil {
+		return serviceAccountError(c, err)
+	}
+	return c.JSON(account)
+}
+
+func (h *AuthZHandler) DeleteServiceAccount(c *fiber.Ctx) error {
+	deleted, err := h.svc.DeleteServiceAccount(c.Params("name"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Service account not found"})
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// RotateServiceAccountSecret issues a new client secret for an account,
+// shown only in this response
+func (h *AuthZHandler) RotateServiceAccountSecret(c *fiber.Ctx) error {
+	account, err := h.svc.RotateServiceAccountSecret(c.Params("name"))
+	if err != nil {
+		return serviceAccountError(c, err)
+	}
+	return c.JSON(account)
+}
+
+// ServiceToken issues a token for a service account, carrying the requested
+// permissions or, if none are requested, all the account is allowed
+func (h *AuthZHandler) ServiceToken(c *fiber.Ctx) error {
+	var req struct {
+		ServiceName  string   `json:"service_name"`
+		ClientSecret string   `json:"client_secret"`
+		Permissions  []string `json:"permissions"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	token, err := h.svc.IssueServiceToken(req.ServiceName, req.ClientSecret, req.Permissions)
+	if err != nil {
+		return serviceAccountError(c, err)
+	}
+	return c.JSON(token)
+}
+
+func (h *AuthZHandler) ServiceTokenKeys(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.svc.ServiceTokenKeys())
+}
+
+func serviceAccountError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Service account not found"})
+	case errors.Is(err, service.ErrInvalidServiceCredentials):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrServiceAccountExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrServiceAccountDisabled), errors.Is(err, service.ErrPermissionNotAllowed):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidServiceAccount), errors.Is(err, service.ErrUnknownPermission):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
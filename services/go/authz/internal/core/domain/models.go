@@ -20,6 +20,7 @@ type Role struct {
 	Scope       Scope          `json:"scope"`
 	Description string         `json:"description"`
 	Permissions []Permission   `gorm:"many2many:role_permissions;" json:"permissions"`
+	Parents     []Role         `gorm:"many2many:role_inherits;joinForeignKey:RoleID;joinReferences:ParentID" json:"-"` // Roles whose allows and denies this role inherits
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
@@ -28,30 +29,95 @@ type Role struct {
 type Permission struct {
 	ID          uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
 	Name        string    `gorm:"uniqueIndex" json:"name"` // e.g., "user.create"
-	Resource    string    `json:"resource"`                // e.g., "user"
-	Action      string    `json:"action"`                  // e.g., "create"
+	Resource    string    `json:"resource"`                // e.g., "user"; a trailing "*" matches by prefix
+	Action      string    `json:"action"`                  // e.g., "create"; "*" matches any action
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Policy is an explicit rule for a role. Allows are normally granted through
+// role_permissions; Policy rows carry denies, which always win over allows.
 type Policy struct {
-	ID           uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
-	RoleID       uuid.UUID `gorm:"type:uuid;index" json:"role_id"`
-	PermissionID uuid.UUID `gorm:"type:uuid;index" json:"permission_id"`
-	Conditions   string    `gorm:"type:text" json:"conditions"` // JSON string for ABAC conditions
+	ID           uuid.UUID   `gorm:"type:uuid;primary_key;" json:"id"`
+	RoleID       uuid.UUID   `gorm:"type:uuid;index;uniqueIndex:idx_policy_rule" json:"role_id"`
+	PermissionID uuid.UUID   `gorm:"type:uuid;index;uniqueIndex:idx_policy_rule" json:"permission_id"`
+	Effect       Effect      `gorm:"type:text;not null;default:'allow';uniqueIndex:idx_policy_rule" json:"effect"`
+	Conditions   string      `gorm:"type:text" json:"conditions"` // JSON string for ABAC conditions
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	Role         *Role       `gorm:"foreignKey:RoleID" json:"-"`
+	Permission   *Permission `gorm:"foreignKey:PermissionID" json:"-"`
+}
+
+// UserPermission grants a permission straight to a user, on top of what their
+// role allows. An empty Scope applies everywhere; otherwise it only applies to
+// checks for that resource scope (e.g. "course:<id>"). Expired grants are
+// ignored and removed by a periodic job.
+type UserPermission struct {
+	ID           uuid.UUID   `gorm:"type:uuid;primary_key;" json:"id"`
+	UserID       uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_user_permission_grant" json:"user_id"`
+	PermissionID uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_user_permission_grant" json:"permission_id"`
+	Scope        string      `gorm:"not null;default:'';uniqueIndex:idx_user_permission_grant" json:"scope,omitempty"`
+	ExpiresAt    *time.Time  `gorm:"index" json:"expires_at,omitempty"`
+	GrantedBy    string      `json:"granted_by,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	Permission   *Permission `gorm:"foreignKey:PermissionID;constraint:OnDelete:CASCADE;" json:"permission,omitempty"`
+}
+
+// Active reports whether the grant has not expired at now
+func (g *UserPermission) Active(now time.Time) bool {
+	return g.ExpiresAt == nil || g.ExpiresAt.After(now)
+}
+
+// ServiceAccount is a service that may get tokens for calling other
+// services. Its tokens carry its allowed permissions, or a subset of them.
+// A disabled account gets no new tokens, and tokens it already has are
+// refused by the authz admin API.
+type ServiceAccount struct {
+	ID          uuid.UUID    `gorm:"type:uuid;primary_key;" json:"id"`
+	Name        string       `gorm:"uniqueIndex;not null" json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `gorm:"many2many:service_account_permissions;constraint:OnDelete:CASCADE;" json:"permissions"`
+	Active      bool         `gorm:"not null" json:"active"`
+	// SecretHash is the SHA-256 of the client secret the account proves
+	// itself with when asking for a token; empty until one is issued
+	SecretHash string `json:"-"`
+	// ClientSecret is only set in the response that creates or rotates the
+	// secret, the one time it is shown
+	ClientSecret string    `gorm:"-" json:"client_secret,omitempty"`
+	CreatedBy    string    `json:"created_by,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// PermissionNames returns the names of the account's allowed permissions
+func (a *ServiceAccount) PermissionNames() []string {
+	names := make([]string, len(a.Permissions))
+	for i, p := range a.Permissions {
+		names[i] = p.Name
+	}
+	return names
+}
+
 type AuditLog struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
-	Subject   string    `json:"subject"`  // Who (User ID or Service Name)
-	Resource  string    `json:"resource"` // What resource
-	Action    string    `json:"action"`   // What action
-	Decision  string    `json:"decision"` // ALLOW or DENY
-	Context   string    `json:"context"`  // JSON context
-	Timestamp time.Time `json:"timestamp"`
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;index:idx_audit_logs_timestamp_id,priority:2" json:"id"`
+	Subject   string    `gorm:"index" json:"subject"` // Who (User ID or Service Name)
+	Resource  string    `json:"resource"`             // What resource
+	Action    string    `json:"action"`               // What action
+	Decision  string    `json:"decision"`             // ALLOW or DENY
+	Context   string    `json:"context"`              // JSON context
+	Timestamp time.Time `gorm:"index:idx_audit_logs_timestamp_id,priority:1" json:"timestamp"`
+	// BatchID is shared by the decisions of one batch check
+	BatchID *uuid.UUID `gorm:"type:uuid;index" json:"batch_id,omitempty"`
 }
 
 // BeforeCreate hooks to set UUIDs
@@ -82,3 +148,17 @@ func (a *AuditLog) BeforeCreate(tx *gorm.DB) (err error) {
 	}
 	return
 }
+
+func (g *UserPermission) BeforeCreate(tx *gorm.DB) (err error) {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	return
+}
+
+func (a *ServiceAccount) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package domain
+
+// PolicyDocument is the declarative form of the whole authorization model,
+// as exported and imported between environments. Direct user grants are not
+// part of it, since user IDs differ from one environment to the next.
+type PolicyDocument struct {
+	Permissions []PermissionSpec `json:"permissions" yaml:"permissions"`
+	Roles       []RoleSpec       `json:"roles" yaml:"roles"`
+}
+
+type PermissionSpec struct {
+	Name        string `json:"name" yaml:"name"`
+	Resource    string `json:"resource" yaml:"resource"`
+	Action      string `json:"action" yaml:"action"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// RoleSpec is a role with the permissions it is allowed and denied and the
+// roles it inherits from, all by name
+type RoleSpec struct {
+	Name        string   `json:"name" yaml:"name"`
+	Scope       Scope    `json:"scope,omitempty" yaml:"scope,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Inherits    []string `json:"inherits,omitempty" yaml:"inherits,omitempty"`
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	Denies      []string `json:"denies,omitempty" yaml:"denies,omitempty"`
+}
+
+// RoleRule links a role to a permission it is allowed or denied
+type RoleRule struct {
+	Role       string `json:"role"`
+	Permission string `json:"permission"`
+}
+
+// RoleParent links a role to a role it inherits from
+type RoleParent struct {
+	Role   string `json:"role"`
+	Parent string `json:"parent"`
+}
+
+// ImportPlan is what importing a PolicyDocument changes. Roles in it carry
+// only their own fields; their rules and parents are listed separately.
+type ImportPlan struct {
+	CreatePermissions []PermissionSpec `json:"create_permissions"`
+	UpdatePermissions []PermissionSpec `json:"update_permissions"`
+	DeletePermissions []string         `json:"delete_permissions"`
+	CreateRoles       []RoleSpec       `json:"create_roles"`
+	UpdateRoles       []RoleSpec       `json:"update_roles"`
+	DeleteRoles       []string         `json:"delete_roles"`
+	AddAssignments    []RoleRule       `json:"add_assignments"`
+	RemoveAssignments []RoleRule       `json:"remove_assignments"`
+	AddDenies         []RoleRule       `json:"add_denies"`
+	RemoveDenies      []RoleRule       `json:"remove_denies"`
+	AddInherits       []RoleParent     `json:"add_inherits"`
+	RemoveInherits    []RoleParent     `json:"remove_inherits"`
+}
+
+// Empty reports whether the plan changes nothing
+func (p *ImportPlan) Empty() bool {
+	return len(p.CreatePermissions) == 0 && len(p.UpdatePermissions) == 0 && len(p.DeletePermissions) == 0 &&
+		len(p.CreateRoles) == 0 && len(p.UpdateRoles) == 0 && len(p.DeleteRoles) == 0 &&
+		len(p.AddAssignments) == 0 && len(p.RemoveAssignments) == 0 &&
+		len(p.AddDenies) == 0 && len(p.RemoveDenies) == 0 &&
+		len(p.AddInherits) == 0 && len(p.RemoveInherits) == 0
+}
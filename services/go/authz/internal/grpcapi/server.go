@@ -0,0 +1,66 @@
+// Package grpcapi serves the authz service's gRPC API, the counterpart of
+// the /internal/authz/check endpoints. Both call the same AuthZService, so a
+// check is decided and audited the same way over either.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	authzv1 "github.com/4yrg/gradeloop-core/libs/rpc/authz/v1"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Server struct {
+	authzv1.UnimplementedAuthorizationServiceServer
+	svc *service.AuthZService
+}
+
+func NewServer(svc *service.AuthZService) *Server {
+	return &Server{svc: svc}
+}
+
+func (s *Server) CheckPermission(ctx context.Context, req *authzv1.CheckPermissionRequest) (*authzv1.CheckPermissionResponse, error) {
+	allowed, err := s.svc.CheckPermission(req.GetSubject(), req.GetRole(), req.GetResource(), req.GetAction(), req.GetScope(), fromProto(req.GetInstitutes()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &authzv1.CheckPermissionResponse{Allowed: allowed}, nil
+}
+
+func (s *Server) CheckPermissionBatch(ctx context.Context, req *authzv1.CheckPermissionBatchRequest) (*authzv1.CheckPermissionBatchResponse, error) {
+	checks := make([]service.PermissionCheck, len(req.GetChecks()))
+	for i, c := range req.GetChecks() {
+		checks[i] = service.PermissionCheck{Subject: c.GetSubject(), Resource: c.GetResource(), Action: c.GetAction()}
+	}
+
+	allowed, batchID, err := s.svc.CheckPermissions(req.GetSubject(), req.GetRole(), req.GetScope(), fromProto(req.GetInstitutes()), checks)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &authzv1.CheckPermissionBatchResponse{BatchId: batchID.String(), Allowed: allowed}, nil
+}
+
+func fromProto(bindings []*authzv1.InstituteBinding) []service.InstituteBinding {
+	if len(bindings) == 0 {
+		return nil
+	}
+	out := make([]service.InstituteBinding, len(bindings))
+	for i, b := range bindings {
+		out[i] = service.InstituteBinding{InstituteID: b.GetInstituteId(), Role: b.GetRole()}
+	}
+	return out
+}
+
+// statusError maps check errors to gRPC status codes as the HTTP handlers
+// map them to statuses
+func statusError(err error) error {
+	if errors.Is(err, service.ErrEmptyBatch) || errors.Is(err, service.ErrBatchTooLarge) || errors.Is(err, service.ErrMixedSubjects) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Printf("gRPC permission check failed: %v", err)
+	return status.Error(codes.Internal, "internal error")
+}
@@ -8,12 +8,18 @@ import (
 	"github.com/gofiber/fiber/v2/log"
 )
 
-func InternalAuth() fiber.Handler {
+// InternalSecret is the internal token expected on HTTP and gRPC calls
+func InternalSecret() string {
 	secret := os.Getenv("INTERNAL_SECRET")
 	if secret == "" {
 		log.Warn("INTERNAL_SECRET is not set, defaulting to 'insecure-secret-for-dev'")
 		secret = "insecure-secret-for-dev"
 	}
+	return secret
+}
+
+func InternalAuth() fiber.Handler {
+	secret := InternalSecret()
 
 	return func(c *fiber.Ctx) error {
 		token := c.Get("X-Internal-Token")
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExportPolicies returns every role and permission as a policy document,
+// sorted by name so exports of the same state compare equal
+func (r *AuthZRepository) ExportPolicies() (*domain.PolicyDocument, error) {
+	return exportPolicies(r.db)
+}
+
+// ImportPolicies works out the changes to make with plan, given the current
+// state as a document, and applies them in one transaction. A dry run only
+// returns the plan.
+func (r *AuthZRepository) ImportPolicies(plan func(current *domain.PolicyDocument) (*domain.ImportPlan, error), dryRun bool) (*domain.ImportPlan, error) {
+	if dryRun {
+		current, err := exportPolicies(r.db)
+		if err != nil {
+			return nil, err
+		}
+		return plan(current)
+	}
+
+	var result *domain.ImportPlan
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Imports change inheritance, so they take the same lock as
+		// SetRoleParents; the plan's cycle check then holds until commit
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "role_inherits").Error; err != nil {
+			return err
+		}
+
+		current, err := exportPolicies(tx)
+		if err != nil {
+			return err
+		}
+		p, err := plan(current)
+		if err != nil {
+			return err
+		}
+		result = p
+		return applyImportPlan(tx, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func exportPolicies(db *gorm.DB) (*domain.PolicyDocument, error) {
+	var perms []domain.Permission
+	if err := db.Order("name").Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	var roles []domain.Role
+	if err := db.Preload("Permissions").Preload("Parents").Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	var denies []domain.RoleRule
+	err := db.Table("policies").
+		Select("roles.name AS role, permissions.name AS permission").
+		Joins("JOIN roles ON roles.id = policies.role_id AND roles.deleted_at IS NULL").
+		Joins("JOIN permissions ON permissions.id = policies.permission_id").
+		Where("policies.effect = ?", domain.EffectDeny).
+		Scan(&denies).Error
+	if err != nil {
+		return nil, err
+	}
+	deniesByRole := make(map[string][]string)
+	for _, d := range denies {
+		deniesByRole[d.Role] = append(deniesByRole[d.Role], d.Permission)
+	}
+
+	doc := &domain.PolicyDocument{
+		Permissions: make([]domain.PermissionSpec, 0, len(perms)),
+		Roles:       make([]domain.RoleSpec, 0, len(roles)),
+	}
+	for _, p := range perms {
+		doc.Permissions = append(doc.Permissions, domain.PermissionSpec{
+			Name:        p.Name,
+			Resource:    p.Resource,
+			Action:      p.Action,
+			Description: p.Description,
+		})
+	}
+	for _, role := range roles {
+		spec := domain.RoleSpec{
+			Name:        role.Name,
+			Scope:       role.Scope,
+			Description: role.Description,
+			Denies:      deniesByRole[role.Name],
+		}
+		for _, parent := range role.Parents {
+			spec.Inherits = append(spec.Inherits, parent.Name)
+		}
+		for _, perm := range role.Permissions {
+			spec.Permissions = append(spec.Permissions, perm.Name)
+		}
+		sort.Strings(spec.Inherits)
+		sort.Strings(spec.Permissions)
+		sort.Strings(spec.Denies)
+		doc.Roles = append(doc.Roles, spec)
+	}
+	return doc, nil
+}
+
+// applyImportPlan makes the changes in plan. Rules and parents are removed
+// before roles and permissions are deleted, and added once the roles and
+// permissions they name exist.
+func applyImportPlan(tx *gorm.DB, plan *domain.ImportPlan) error {
+	for _, spec := range plan.CreatePermissions {
+		perm := &domain.Permission{Name: spec.Name, Resource: spec.Resource, Action: spec.Action, Description: spec.Description}
+		if err := tx.Create(perm).Error; err != nil {
+			return err
+		}
+	}
+	for _, spec := range plan.UpdatePermissions {
+		err := tx.Model(&domain.Permission{}).Where("name = ?", spec.Name).Updates(map[string]interface{}{
+			"resource":    spec.Resource,
+			"action":      spec.Action,
+			"description": spec.Description,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	for _, spec := range plan.CreateRoles {
+		if err := createOrRestoreRole(tx, spec); err != nil {
+			return err
+		}
+	}
+	for _, spec := range plan.UpdateRoles {
+		err := tx.Model(&domain.Role{}).Where("name = ?", spec.Name).Updates(map[string]interface{}{
+			"scope":       spec.Scope,
+			"description": spec.Description,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	roleIDs, err := idsByName(tx, &domain.Role{})
+	if err != nil {
+		return err
+	}
+	permIDs, err := idsByName(tx, &domain.Permission{})
+	if err != nil {
+		return err
+	}
+
+	for _, a := range plan.RemoveAssignments {
+		if err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ? AND permission_id = ?", roleIDs[a.Role], permIDs[a.Permission]).Error; err != nil {
+			return err
+		}
+	}
+	for _, d := range plan.RemoveDenies {
+		err := tx.Where("role_id = ? AND permission_id = ? AND effect = ?", roleIDs[d.Role], permIDs[d.Permission], domain.EffectDeny).
+			Delete(&domain.Policy{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	for _, i := range plan.RemoveInherits {
+		if err := tx.Exec("DELETE FROM role_inherits WHERE role_id = ? AND parent_id = ?", roleIDs[i.Role], roleIDs[i.Parent]).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, a := range plan.AddAssignments {
+		if err := tx.Exec("INSERT INTO role_permissions (role_id, permission_id) VALUES (?, ?)", roleIDs[a.Role], permIDs[a.Permission]).Error; err != nil {
+			return err
+		}
+	}
+	for _, d := range plan.AddDenies {
+		policy := &domain.Policy{RoleID: roleIDs[d.Role], PermissionID: permIDs[d.Permission], Effect: domain.EffectDeny}
+		if err := tx.Create(policy).Error; err != nil {
+			return err
+		}
+	}
+	for _, i := range plan.AddInherits {
+		if err := tx.Exec("INSERT INTO role_inherits (role_id, parent_id) VALUES (?, ?)", roleIDs[i.Role], roleIDs[i.Parent]).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, name := range plan.DeleteRoles {
+		id := roleIDs[name]
+		if err := clearRoleLinks(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM role_inherits WHERE parent_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", id).Delete(&domain.Role{}).Error; err != nil {
+			return err
+		}
+	}
+	for _, name := range plan.DeletePermissions {
+		id := permIDs[name]
+		if err := tx.Exec("DELETE FROM role_permissions WHERE permission_id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("permission_id = ?", id).Delete(&domain.Policy{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("permission_id = ?", id).Delete(&domain.UserPermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", id).Delete(&domain.Permission{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createOrRestoreRole creates a role. Deleted roles keep their name, so one
+// deleted earlier is brought back instead, without the rules it had.
+func createOrRestoreRole(tx *gorm.DB, spec domain.RoleSpec) error {
+	var existing domain.Role
+	err := tx.Unscoped().Where("name = ?", spec.Name).Take(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(&domain.Role{Name: spec.Name, Scope: spec.Scope, Description: spec.Description}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := clearRoleLinks(tx, existing.ID); err != nil {
+		return err
+	}
+	return tx.Unscoped().Model(&domain.Role{}).Where("id = ?", existing.ID).Updates(map[string]interface{}{
+		"scope":       spec.Scope,
+		"description": spec.Description,
+		"deleted_at":  nil,
+	}).Error
+}
+
+// clearRoleLinks removes a role's allows, denies and parents
+func clearRoleLinks(tx *gorm.DB, roleID uuid.UUID) error {
+	if err := tx.Exec("DELETE FROM role_permissions WHERE role_id = ?", roleID).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("role_id = ?", roleID).Delete(&domain.Policy{}).Error; err != nil {
+		return err
+	}
+	return tx.Exec("DELETE FROM role_inherits WHERE role_id = ?", roleID).Error
+}
+
+// idsByName maps the names of the rows of model's table to their IDs
+func idsByName(tx *gorm.DB, model interface{}) (map[string]uuid.UUID, error) {
+	var rows []struct {
+		ID   uuid.UUID
+		Name string
+	}
+	if err := tx.Model(model).Select("id, name").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	ids := make(map[string]uuid.UUID, len(rows))
+	for _, row := range rows {
+		ids[row.Name] = row.ID
+	}
+	return ids, nil
+}
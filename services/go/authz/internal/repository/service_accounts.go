@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrServiceAccountExists = errors.New("service account already exists")
+	ErrUnknownPermission    = errors.New("unknown permission")
+)
+
+// ServiceAccountUpdate holds the fields of a service account to change; nil
+// fields are left alone and Permissions replaces the whole allowlist
+type ServiceAccountUpdate struct {
+	Description *string
+	Active      *bool
+	Permissions *[]string
+	SecretHash  *string
+}
+
+// CreateServiceAccount creates the account with the named permissions as
+// its allowlist
+func (r *AuthZRepository) CreateServiceAccount(account *domain.ServiceAccount, permNames []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		perms, err := permissionsByName(tx, permNames)
+		if err != nil {
+			return err
+		}
+		result := tx.Omit("Permissions").Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoNothing: true,
+		}).Create(account)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrServiceAccountExists
+		}
+		if len(perms) > 0 {
+			if err := tx.Model(account).Association("Permissions").Append(perms); err != nil {
+				return err
+			}
+		}
+		account.Permissions = perms
+		return nil
+	})
+}
+
+// GetServiceAccount fetches an account by name with its allowed permissions
+func (r *AuthZRepository) GetServiceAccount(name string) (*domain.ServiceAccount, error) {
+	var account domain.ServiceAccount
+	err := r.db.Preload("Permissions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name")
+	}).Where("name = ?", name).First(&account).Error
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// ListServiceAccounts returns every account with its allowed permissions
+func (r *AuthZRepository) ListServiceAccounts() ([]domain.ServiceAccount, error) {
+	var accounts []domain.ServiceAccount
+	err := r.db.Preload("Permissions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name")
+	}).Order("name").Find(&accounts).Error
+	return accounts, err
+}
+
+// UpdateServiceAccount applies update to the named account
+func (r *AuthZRepository) UpdateServiceAccount(name string, update ServiceAccountUpdate) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var account domain.ServiceAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ?", name).First(&account).Error; err != nil {
+			return err
+		}
+
+		fields := map[string]interface{}{}
+		if update.Description != nil {
+			fields["description"] = *update.Description
+		}
+		if update.Active != nil {
+			fields["active"] = *update.Active
+		}
+		if update.SecretHash != nil {
+			fields["secret_hash"] = *update.SecretHash
+		}
+		if len(fields) > 0 {
+			if err := tx.Model(&account).Updates(fields).Error; err != nil {
+				return err
+			}
+		}
+
+		if update.Permissions != nil {
+			perms, err := permissionsByName(tx, *update.Permissions)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&account).Association("Permissions").Replace(perms); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteServiceAccount deletes an account and its allowlist and reports
+// whether it existed
+func (r *AuthZRepository) DeleteServiceAccount(name string) (bool, error) {
+	var deleted bool
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var account domain.ServiceAccount
+		err := tx.Where("name = ?", name).First(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		result := tx.Select("Permissions").Delete(&account)
+		deleted = result.RowsAffected > 0
+		return result.Error
+	})
+	return deleted, err
+}
+
+// permissionsByName loads the named permissions, failing with
+// ErrUnknownPermission if any does not exist
+func permissionsByName(db *gorm.DB, names []string) ([]domain.Permission, error) {
+	if len(names) == 0 {
+		return []domain.Permission{}, nil
+	}
+	var perms []domain.Permission
+	if err := db.Where("name IN ?", names).Order("name").Find(&perms).Error; err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !slices.ContainsFunc(perms, func(p domain.Permission) bool { return p.Name == name }) && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, strings.Join(missing, ", "))
+	}
+	return perms, nil
+}
@@ -1,11 +1,24 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
 	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// MaxInheritanceDepth bounds how many levels of parent roles are followed,
+// as a safety net should a cycle ever get into the data
+const MaxInheritanceDepth = 10
+
+// ErrInheritanceCycle means a role would end up inheriting from itself
+var ErrInheritanceCycle = errors.New("role inheritance would create a cycle")
+
 type AuthZRepository struct {
 	db *gorm.DB
 }
@@ -21,25 +34,101 @@ func (r *AuthZRepository) AutoMigrate() error {
 		&domain.Permission{},
 		&domain.Policy{},
 		&domain.AuditLog{},
+		&domain.UserPermission{},
+		&domain.ServiceAccount{},
 	)
 }
 
-// CheckPermission checks if a role has a specific permission
-func (r *AuthZRepository) CheckPermission(roleName string, resource string, action string) (bool, error) {
-	var count int64
-	err := r.db.Table("roles").
-		Joins("JOIN role_permissions ON role_permissions.role_id = roles.id").
-		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
-		Where("roles.name = ?", roleName).
-		Where("permissions.resource = ?", resource).
-		Where("permissions.action = ?", action).
-		Count(&count).Error
+// GetRoleRules returns the permissions a role is allowed and the ones it is
+// explicitly denied, including those inherited from its ancestors
+func (r *AuthZRepository) GetRoleRules(roleName string) ([]domain.Permission, []domain.Permission, error) {
+	var role domain.Role
+	if err := r.db.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return nil, nil, err
+	}
 
+	ids, err := roleClosure(r.db, role.ID)
 	if err != nil {
-		return false, err
+		return nil, nil, err
 	}
 
-	return count > 0, nil
+	var allows []domain.Permission
+	err = r.db.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Where("role_permissions.role_id IN ?", ids).
+		Find(&allows).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var denies []domain.Permission
+	err = r.db.Table("permissions").
+		Joins("JOIN policies ON policies.permission_id = permissions.id").
+		Where("policies.role_id IN ? AND policies.effect = ?", ids, domain.EffectDeny).
+		Find(&denies).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return allows, denies, nil
+}
+
+// roleClosure returns the ID of the role and of every role it inherits from,
+// directly or through other roles, up to MaxInheritanceDepth levels up.
+// Deleted roles are skipped along with everything above them.
+func roleClosure(db *gorm.DB, roleID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := db.Raw(`WITH RECURSIVE ancestors(id, depth) AS (
+			SELECT id, 0 FROM roles WHERE id = ?
+			UNION
+			SELECT ri.parent_id, a.depth + 1 FROM role_inherits ri
+				JOIN ancestors a ON a.id = ri.role_id
+				JOIN roles p ON p.id = ri.parent_id AND p.deleted_at IS NULL
+				WHERE a.depth < ?
+		)
+		SELECT DISTINCT id FROM ancestors`, roleID, MaxInheritanceDepth).Scan(&ids).Error
+	return ids, err
+}
+
+// SetRoleParents replaces the roles a role inherits from. It fails with
+// ErrInheritanceCycle if a parent is the role itself or inherits from it.
+func (r *AuthZRepository) SetRoleParents(roleName string, parentNames []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Serialise inheritance changes so two concurrent updates cannot
+		// each pass the cycle check and together form a cycle
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "role_inherits").Error; err != nil {
+			return err
+		}
+
+		var role domain.Role
+		if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+			return err
+		}
+
+		parents := make([]domain.Role, 0, len(parentNames))
+		for _, name := range parentNames {
+			var parent domain.Role
+			if err := tx.Where("name = ?", name).First(&parent).Error; err != nil {
+				return fmt.Errorf("parent role %q: %w", name, err)
+			}
+
+			ancestors, err := roleClosure(tx, parent.ID)
+			if err != nil {
+				return err
+			}
+			for _, id := range ancestors {
+				if id == role.ID {
+					return fmt.Errorf("%w: %s already inherits from %s", ErrInheritanceCycle, name, roleName)
+				}
+			}
+			parents = append(parents, parent)
+		}
+
+		if len(parents) == 0 {
+			return tx.Model(&role).Association("Parents").Clear()
+		}
+		return tx.Model(&role).Association("Parents").Replace(parents)
+	})
 }
 
 // CreateRole creates a new role uniquely (idempotent)
@@ -60,10 +149,20 @@ func (r *AuthZRepository) GetRoleByName(name string) (*domain.Role, error) {
 	return &role, nil
 }
 
-// GetAllRoles returns all roles
+// GetRole fetches a role by name with its direct permissions and parents
+func (r *AuthZRepository) GetRole(name string) (*domain.Role, error) {
+	var role domain.Role
+	err := r.db.Preload("Permissions").Preload("Parents").Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetAllRoles returns all roles with their direct permissions and parents
 func (r *AuthZRepository) GetAllRoles() ([]domain.Role, error) {
 	var roles []domain.Role
-	err := r.db.Preload("Permissions").Find(&roles).Error
+	err := r.db.Preload("Permissions").Preload("Parents").Order("name").Find(&roles).Error
 	return roles, err
 }
 
@@ -131,3 +230,108 @@ func (r *AuthZRepository) UpdateRole(name string, description string) error {
 func (r *AuthZRepository) LogAudit(log *domain.AuditLog) error {
 	return r.db.Create(log).Error
 }
+
+// LogAudits saves the entries of a batch check together
+func (r *AuthZRepository) LogAudits(logs []domain.AuditLog) error {
+	return r.db.Create(&logs).Error
+}
+
+// ListAuditLogs returns audit entries newest first, ordered by (timestamp,
+// id) so a cursor keeps its place while checks keep being logged. An empty
+// subject lists every subject.
+func (r *AuthZRepository) ListAuditLogs(subject string, page pagination.Request) ([]domain.AuditLog, error) {
+	query := r.db.Order(`"timestamp" DESC, id DESC`).Limit(page.Fetch())
+	if subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+	if page.After != nil {
+		query = query.Where(`("timestamp", id) < (?, ?)`, page.After.CreatedAt, page.After.ID)
+	} else {
+		query = query.Offset(page.Offset)
+	}
+
+	var logs []domain.AuditLog
+	if err := query.Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// CreateDenyPolicy denies a permission (or permission pattern) to a role (idempotent)
+func (r *AuthZRepository) CreateDenyPolicy(roleName string, permName string) (*domain.Policy, error) {
+	role, err := r.GetRoleByName(roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	var perm domain.Permission
+	if err := r.db.Where("name = ?", permName).First(&perm).Error; err != nil {
+		return nil, err
+	}
+
+	policy := &domain.Policy{RoleID: role.ID, PermissionID: perm.ID, Effect: domain.EffectDeny}
+	err = r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role_id"}, {Name: "permission_id"}, {Name: "effect"}},
+		DoNothing: true,
+	}).Create(policy).Error
+	return policy, err
+}
+
+// GetPolicies returns all explicit policies with their role and permission
+func (r *AuthZRepository) GetPolicies() ([]domain.Policy, error) {
+	var policies []domain.Policy
+	err := r.db.Preload("Role").Preload("Permission").Find(&policies).Error
+	return policies, err
+}
+
+// DeletePolicy deletes an explicit policy by ID
+func (r *AuthZRepository) DeletePolicy(id uuid.UUID) error {
+	return r.db.Where("id = ?", id).Delete(&domain.Policy{}).Error
+}
+
+// DeleteRolePermission removes a role-permission assignment by IDs
+func (r *AuthZRepository) DeleteRolePermission(roleID, permID uuid.UUID) error {
+	return r.db.Exec("DELETE FROM role_permissions WHERE role_id = ? AND permission_id = ?", roleID, permID).Error
+}
+
+// GrantUserPermission grants a permission to a user directly. Granting the
+// same permission and scope again updates the expiry.
+func (r *AuthZRepository) GrantUserPermission(grant *domain.UserPermission, permName string) error {
+	var perm domain.Permission
+	if err := r.db.Where("name = ?", permName).First(&perm).Error; err != nil {
+		return err
+	}
+	grant.PermissionID = perm.ID
+	grant.Permission = &perm
+
+	return r.db.Omit("Permission").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "permission_id"}, {Name: "scope"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at", "granted_by", "updated_at"}),
+	}).Create(grant).Error
+}
+
+// GetUserPermissions returns a user's direct grants, leaving out the ones
+// expired at now unless includeExpired is set
+func (r *AuthZRepository) GetUserPermissions(userID uuid.UUID, now time.Time, includeExpired bool) ([]domain.UserPermission, error) {
+	db := r.db.Preload("Permission").Where("user_id = ?", userID)
+	if !includeExpired {
+		db = db.Where("expires_at IS NULL OR expires_at > ?", now)
+	}
+	var grants []domain.UserPermission
+	err := db.Order("created_at").Find(&grants).Error
+	return grants, err
+}
+
+// RevokeUserPermission removes a direct grant and reports whether one existed
+func (r *AuthZRepository) RevokeUserPermission(userID uuid.UUID, permName, scope string) (bool, error) {
+	result := r.db.Where("user_id = ? AND scope = ? AND permission_id IN (?)",
+		userID, scope, r.db.Model(&domain.Permission{}).Select("id").Where("name = ?", permName)).
+		Delete(&domain.UserPermission{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteExpiredUserPermissions removes grants that expired before now
+func (r *AuthZRepository) DeleteExpiredUserPermissions(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Delete(&domain.UserPermission{})
+	return result.RowsAffected, result.Error
+}
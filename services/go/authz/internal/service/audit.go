@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidAuditEvent = errors.New("subject, resource and action are required")
+
+// RecordAuditEvent saves an event another service reports, such as an admin
+// starting to impersonate a user. Unlike permission checks it is written
+// before returning, so the caller knows the event is on record.
+func (s *AuthZService) RecordAuditEvent(event *domain.AuditLog) error {
+	if event.Subject == "" || event.Resource == "" || event.Action == "" {
+		return ErrInvalidAuditEvent
+	}
+	event.ID = uuid.Nil
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	return s.repo.LogAudit(event)
+}
+
+// ListAuditLogs returns a page of permission check decisions, optionally for
+// one subject
+func (s *AuthZService) ListAuditLogs(subject string, page pagination.Request) (pagination.Page[domain.AuditLog], error) {
+	if page.After != nil {
+		if _, err := uuid.Parse(page.After.ID); err != nil {
+			return pagination.Page[domain.AuditLog]{}, pagination.ErrInvalidCursor
+		}
+	}
+	logs, err := s.repo.ListAuditLogs(subject, page)
+	if err != nil {
+		return pagination.Page[domain.AuditLog]{}, err
+	}
+	return pagination.NewPage(logs, page.Limit, func(l domain.AuditLog) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: l.Timestamp, ID: l.ID.String()}
+	}), nil
+}
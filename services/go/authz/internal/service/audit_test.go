@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+)
+
+func TestListAuditLogsPagesBySubject(t *testing.T) {
+	svc, db := newTestService(t)
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		for _, subject := range []string{"u1", "u2"} {
+			entry := &domain.AuditLog{Subject: subject, Resource: "user", Action: "read", Decision: "ALLOW", Timestamp: base.Add(time.Duration(i) * time.Minute)}
+			if err := db.Create(entry).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var got []time.Time
+	page, err := svc.ListAuditLogs("u1", pagination.Request{Limit: 2})
+	for err == nil {
+		for _, l := range page.Items {
+			if l.Subject != "u1" {
+				t.Fatalf("listed an entry for %s", l.Subject)
+			}
+			got = append(got, l.Timestamp)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		var after pagination.Cursor
+		if after, err = pagination.Decode(*page.NextCursor); err == nil {
+			page, err = svc.ListAuditLogs("u1", pagination.Request{Limit: 2, After: &after})
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("listed %d entries, want 5", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if !got[i].Before(got[i-1]) {
+			t.Errorf("entry %d is not older than the one before it", i)
+		}
+	}
+}
@@ -1,21 +1,29 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/4yrg/gradeloop-core/libs/servicetoken"
 	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
 	"github.com/4yrg/gradeloop-core/services/go/authz/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+var ErrInvalidPolicy = errors.New("invalid policy")
+
 type AuthZService struct {
 	repo     *repository.AuthZRepository
 	tokenSvc *ServiceTokenService
 }
 
-func NewAuthZService(repo *repository.AuthZRepository) *AuthZService {
+func NewAuthZService(repo *repository.AuthZRepository, tokenSvc *ServiceTokenService) *AuthZService {
 	return &AuthZService{
 		repo:     repo,
-		tokenSvc: NewServiceTokenService(),
+		tokenSvc: tokenSvc,
 	}
 }
 
@@ -23,8 +31,13 @@ func (s *AuthZService) Init() error {
 	return s.repo.AutoMigrate()
 }
 
-func (s *AuthZService) CheckPermission(subject string, role string, resource string, action string) (bool, error) {
-	allowed, err := s.repo.CheckPermission(role, resource, action)
+// CheckPermission decides whether subject may perform action on resource.
+// The subject's direct grants count as allows alongside its role's; grants
+// with a scope only count when the request carries the same scope. For a
+// check scoped to an institute, the role in institutes bound to that
+// institute applies as well.
+func (s *AuthZService) CheckPermission(subject string, role string, resource string, action string, scope string, institutes []InstituteBinding) (bool, error) {
+	allowed, err := s.check(subject, role, resource, action, scope, institutes)
 
 	decision := "DENY"
 	if allowed {
@@ -45,6 +58,53 @@ func (s *AuthZService) CheckPermission(subject string, role string, resource str
 	return allowed, err
 }
 
+func (s *AuthZService) check(subject, role, resource, action, scope string, institutes []InstituteBinding) (bool, error) {
+	allows, denies, err := s.subjectRules(subject, role, scope, institutes)
+	if err != nil {
+		return false, err
+	}
+	return evaluate(allows, denies, resource, action), nil
+}
+
+// subjectRules gathers every allow and deny that applies to the subject's
+// checks in scope: its role's, its institute role's and its direct grants
+func (s *AuthZService) subjectRules(subject, role, scope string, institutes []InstituteBinding) ([]domain.Permission, []domain.Permission, error) {
+	allows, denies, err := s.roleRules(role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if scope != "" {
+		bindingAllows, bindingDenies, err := s.bindingRules(institutes, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		allows = append(allows, bindingAllows...)
+		denies = append(denies, bindingDenies...)
+	}
+
+	grants, err := s.activeGrants(subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, g := range grants {
+		if g.Permission != nil && (g.Scope == "" || g.Scope == scope) {
+			allows = append(allows, *g.Permission)
+		}
+	}
+
+	return allows, denies, nil
+}
+
+// roleRules returns a role's allows and denies; unknown roles have neither
+func (s *AuthZService) roleRules(role string) ([]domain.Permission, []domain.Permission, error) {
+	allows, denies, err := s.repo.GetRoleRules(role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	return allows, denies, err
+}
+
 func (s *AuthZService) CreateRole(name string, scope domain.Scope, description string) error {
 	role := &domain.Role{
 		Name:        name,
@@ -54,10 +114,6 @@ func (s *AuthZService) CreateRole(name string, scope domain.Scope, description s
 	return s.repo.CreateRole(role)
 }
 
-func (s *AuthZService) GetAllRoles() ([]domain.Role, error) {
-	return s.repo.GetAllRoles()
-}
-
 func (s *AuthZService) CreatePermission(name, resource, action, description string) error {
 	perm := &domain.Permission{
 		Name:        name,
@@ -83,37 +139,250 @@ func (s *AuthZService) SeedDefaults() error {
 	// Seed Institute Admin
 	_ = s.CreateRole("institute_admin", domain.ScopeInstitute, "Institute Administrator")
 
+	// Seed Institute Owner: everything an institute admin can do, plus
+	// managing the institute's admins
+	if err := s.CreateRole("institute_owner", domain.ScopeInstitute, "Institute Owner"); err == nil {
+		_ = s.SetRoleInherits("institute_owner", []string{"institute_admin"})
+	}
+
+	// Seed Instructor
+	_ = s.CreateRole("instructor", domain.ScopeInstitute, "Instructor")
+
+	// Seed Student
+	_ = s.CreateRole("student", domain.ScopeInstitute, "Student")
+
+	// Seed Guardian: a parent or guardian following students they are linked
+	// to in identity
+	_ = s.CreateRole("guardian", domain.ScopeInstitute, "Parent or Guardian")
+
 	// Create some base permissions
 	_ = s.CreatePermission("user.create", "user", "create", "Can create users")
 	_ = s.CreatePermission("user.read", "user", "read", "Can read users")
 	_ = s.CreatePermission("user.update", "user", "update", "Can update users")
 	_ = s.CreatePermission("user.delete", "user", "delete", "Can delete users")
+	_ = s.CreatePermission("grade.history", "grade", "history", "Can view the change history of grades")
+	_ = s.CreatePermission("institute_admin.manage", "institute_admin", "manage", "Can add, remove and change the role of an institute's admins")
+	_ = s.CreatePermission("user_data.export", "user_data", "export", "Can export the data held about any user")
+	_ = s.CreatePermission("comment.delete", "comment", "delete", "Can delete anyone's submission comments at any time")
+	_ = s.CreatePermission("user.impersonate", "user", "impersonate", "Can sign in as another user for support")
+	_ = s.CreatePermission("enrollment.override_term", "enrollment", "override_term", "Can enroll students into classes whose term has ended")
 
 	// Assign permissions to System Admin
 	_ = s.AssignPermission("system_admin", "user.create")
 	_ = s.AssignPermission("system_admin", "user.read")
 	_ = s.AssignPermission("system_admin", "user.update")
 	_ = s.AssignPermission("system_admin", "user.delete")
+	_ = s.AssignPermission("system_admin", "grade.history")
+	_ = s.AssignPermission("system_admin", "user_data.export")
+	_ = s.AssignPermission("system_admin", "comment.delete")
+	_ = s.AssignPermission("system_admin", "user.impersonate")
+	_ = s.AssignPermission("system_admin", "enrollment.override_term")
+
+	_ = s.AssignPermission("institute_owner", "institute_admin.manage")
+
+	// Staff can see how grades changed when handling disputes
+	_ = s.AssignPermission("institute_admin", "grade.history")
+	_ = s.AssignPermission("instructor", "grade.history")
+
+	// Admins moderate submission comment threads
+	_ = s.AssignPermission("institute_admin", "comment.delete")
+
+	// Admins handle late enrollments after a term has ended
+	_ = s.AssignPermission("institute_admin", "enrollment.override_term")
+
+	// Admins have submissions scanned again once virus definitions update
+	_ = s.CreatePermission("submission.rescan", "submission", "rescan", "Can have a submission's files scanned for viruses again")
+	_ = s.AssignPermission("system_admin", "submission.rescan")
+	_ = s.AssignPermission("institute_admin", "submission.rescan")
+
+	// Admins and registrars see students' whole transcripts
+	_ = s.CreatePermission("transcript.read_all", "transcript", "read_all", "Can view every class on any student's transcript")
+	_ = s.AssignPermission("system_admin", "transcript.read_all")
+	_ = s.AssignPermission("institute_admin", "transcript.read_all")
+	_ = s.CreatePermission("submission.archive_all", "submission", "archive_all", "Can download the submissions of any assignment as a zip")
+	_ = s.AssignPermission("system_admin", "submission.archive_all")
+	_ = s.AssignPermission("institute_admin", "submission.archive_all")
+
+	// Staff post announcements; a direct grant scoped to one unit, e.g.
+	// class:<id>, lets anyone else post to just that unit
+	for _, action := range []string{"create", "update", "delete"} {
+		name := "announcement." + action
+		_ = s.CreatePermission(name, "announcement", action, "Can "+action+" announcements to institutes, faculties, departments and classes")
+		_ = s.AssignPermission("system_admin", name)
+		_ = s.AssignPermission("institute_admin", name)
+		_ = s.AssignPermission("instructor", name)
+	}
+
+	// Permissions the assignment and submission services require per route.
+	// Staff get all of them; students only what they need to work on
+	// assignments and see their grades.
+	courseWork := []struct{ name, description string }{
+		{"assignment.create", "Can create assignments"},
+		{"assignment.read", "Can view assignments"},
+		{"assignment.update", "Can update assignments"},
+		{"assignment.delete", "Can delete assignments"},
+		{"rubric.read", "Can view assignment rubrics"},
+		{"rubric.update", "Can create and replace assignment rubrics"},
+		{"rubric.delete", "Can delete assignment rubrics"},
+		{"attempt.start", "Can start a timed assignment"},
+		{"attempt.read", "Can view timed assignment attempts"},
+		{"attempt.void", "Can void a student's timed assignment attempt"},
+		{"group.read", "Can view assignment groups"},
+		{"group.join", "Can create, join and leave assignment groups"},
+		{"group.lock", "Can lock the membership of a group that has submitted"},
+		{"extension.read", "Can view students' deadline extensions"},
+		{"extension.grant", "Can grant and revoke a student's deadline extension"},
+		{"calendar.manage", "Can create and revoke their deadline calendar feed"},
+		{"submission.create", "Can submit assignments"},
+		{"submission.read", "Can view submissions"},
+		{"submission.update", "Can update the status and score of submissions"},
+		{"submission.grade", "Can grade submissions"},
+		{"attempt.grant", "Can grant a student extra submission attempts"},
+		{"grade.read", "Can view grades"},
+		{"grade.release", "Can release grades to students"},
+		{"grade.stats", "Can view score statistics of assignments and classes"},
+		{"comment.create", "Can comment on submissions"},
+		{"comment.read", "Can view submission comments"},
+		{"comment.private", "Can view and post instructors-only submission comments"},
+		{"similarity.run", "Can run similarity checks on an assignment's submissions"},
+		{"submission.archive", "Can have an assignment's submissions zipped for download"},
+		{"similarity.read", "Can view similarity checks and the similar pairs they found"},
+		{"transcript.read", "Can view their own transcript, or the classes they teach on a student's"},
+		{"deadline.read", "Can view a student's assignment deadlines"},
+	}
+	studentWork := map[string]bool{
+		"assignment.read":   true,
+		"rubric.read":       true,
+		"attempt.start":     true,
+		"attempt.read":      true,
+		"group.read":        true,
+		"group.join":        true,
+		"calendar.manage":   true,
+		"submission.create": true,
+		"submission.read":   true,
+		"grade.read":        true,
+		"grade.stats":       true,
+		"comment.create":    true,
+		"comment.read":      true,
+		"transcript.read":   true,
+		"deadline.read":     true,
+	}
+	for _, p := range courseWork {
+		resource, action, _ := strings.Cut(p.name, ".")
+		_ = s.CreatePermission(p.name, resource, action, p.description)
+		_ = s.AssignPermission("system_admin", p.name)
+		_ = s.AssignPermission("institute_admin", p.name)
+		_ = s.AssignPermission("instructor", p.name)
+		if studentWork[p.name] {
+			_ = s.AssignPermission("student", p.name)
+		}
+	}
+
+	// Guardians only read, and only the released grades and deadlines of
+	// the students linked to them; the services check the link on each
+	// request
+	for _, name := range []string{"transcript.read", "deadline.read"} {
+		_ = s.AssignPermission("guardian", name)
+	}
+
+	// The admin API itself: system admins read and manage it, as may the
+	// identity bootstrap CLI through its service account. The account is
+	// seeded disabled, with a secret never shown; an admin enables it and
+	// rotates its secret for as long as the CLI needs it.
+	_ = s.CreatePermission(AdminReadPermission, "authz", "read", "Can view roles, permissions, grants, policies, service accounts and the audit log")
+	_ = s.CreatePermission(AdminManagePermission, "authz", "manage", "Can change roles, permissions, grants, policies and service accounts")
+	_ = s.AssignPermission("system_admin", AdminReadPermission)
+	_ = s.AssignPermission("system_admin", AdminManagePermission)
+	bootstrapPerms := []string{AdminReadPermission, AdminManagePermission}
+	description := "Identity bootstrap CLI"
+	disabled := false
+	_, _ = s.CreateServiceAccount(ServiceAccountRequest{
+		Name:        BootstrapServiceAccount,
+		Description: &description,
+		Permissions: &bootstrapPerms,
+		Active:      &disabled,
+		CreatedBy:   "seed",
+	})
 
 	return nil
 }
 
-func (s *AuthZService) ResolvePermissions(userID string, roleName string) ([]string, error) {
-	// 1. Get Role and its permissions
-	role, err := s.repo.GetRoleByName(roleName)
+// ResolvePermissions returns the effective permissions of a user: every
+// concrete permission matched by an allow of their role or by one of their
+// unexpired direct grants, and not matched by a deny of their role. Each is
+// tagged with where it comes from; a permission both granted and allowed by
+// the role is reported as coming from the role. The roles in institutes add
+// permissions scoped to each institute.
+func (s *AuthZService) ResolvePermissions(userID string, roleName string, institutes []InstituteBinding) (*ResolvedPermissions, error) {
+	allows, denies, err := s.roleRules(roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	type scopedRules struct {
+		scope          string
+		allows, denies []domain.Permission
+	}
+	var bindings []scopedRules
+	for _, b := range institutes {
+		scope := InstituteScope(b.InstituteID)
+		bAllows, bDenies, err := s.bindingRules(institutes, scope)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, scopedRules{scope: scope, allows: bAllows, denies: bDenies})
+	}
+
+	grants, err := s.activeGrants(userID)
 	if err != nil {
-		return nil, err // Return empty if role not found or error
+		return nil, err
 	}
 
-	// 2. Extract Permission Names
-	var permissions []string
-	for _, p := range role.Permissions {
-		permissions = append(permissions, p.Name)
+	all, err := s.repo.GetAllPermissions()
+	if err != nil {
+		return nil, err
 	}
 
-	// 3. (Optional) Evaluate Policies if any (Future scope)
+	resolved := &ResolvedPermissions{
+		Permissions: make([]string, 0),
+		Sources:     make([]ResolvedPermission, 0),
+	}
+	for _, p := range all {
+		if isPattern(p) || matchesAny(denies, p.Resource, p.Action) {
+			continue
+		}
+
+		// Scopes already reported for p; "" is the unscoped permission
+		seen := map[string]bool{}
+		if matchesAny(allows, p.Resource, p.Action) {
+			seen[""] = true
+			resolved.Sources = append(resolved.Sources, ResolvedPermission{Name: p.Name, Source: SourceRole})
+		}
+		for _, g := range grants {
+			if g.Permission == nil || seen[g.Scope] || !matchesAny([]domain.Permission{*g.Permission}, p.Resource, p.Action) {
+				continue
+			}
+			seen[g.Scope] = true
+			resolved.Sources = append(resolved.Sources, ResolvedPermission{
+				Name:      p.Name,
+				Source:    SourceDirect,
+				Scope:     g.Scope,
+				ExpiresAt: g.ExpiresAt,
+			})
+		}
+		for _, b := range bindings {
+			if seen[b.scope] || matchesAny(b.denies, p.Resource, p.Action) || !matchesAny(b.allows, p.Resource, p.Action) {
+				continue
+			}
+			seen[b.scope] = true
+			resolved.Sources = append(resolved.Sources, ResolvedPermission{Name: p.Name, Source: SourceInstitute, Scope: b.scope})
+		}
+		if seen[""] {
+			resolved.Permissions = append(resolved.Permissions, p.Name)
+		}
+	}
 
-	return permissions, nil
+	return resolved, nil
 }
 
 func (s *AuthZService) DeleteRole(name string) error {
@@ -133,16 +402,21 @@ func (s *AuthZService) UpdateRole(name string, description string) error {
 }
 
 // Policy Management
-// Note: In this system, policies are implicit through role-permission assignments.
-// The Policy table is designed for future ABAC (Attribute-Based Access Control) with conditions.
-// For now, we return role-permission mappings as "policies".
-func (s *AuthZService) CreatePolicy(roleName, permissionName string) error {
-	// Creating a "policy" is essentially assigning a permission to a role
-	return s.AssignPermission(roleName, permissionName)
+// Allow policies are role-permission assignments; deny policies are Policy
+// rows. A deny always overrides any allow, including wildcard allows.
+func (s *AuthZService) CreatePolicy(roleName, permissionName string, effect domain.Effect) error {
+	switch effect {
+	case "", domain.EffectAllow:
+		return s.AssignPermission(roleName, permissionName)
+	case domain.EffectDeny:
+		_, err := s.repo.CreateDenyPolicy(roleName, permissionName)
+		return err
+	}
+	return fmt.Errorf("%w: effect must be %q or %q", ErrInvalidPolicy, domain.EffectAllow, domain.EffectDeny)
 }
 
 func (s *AuthZService) GetPolicies() ([]map[string]interface{}, error) {
-	// Return all role-permission assignments as policies
+	// Return all role-permission assignments as allow policies
 	roles, err := s.repo.GetAllRoles()
 	if err != nil {
 		return nil, err
@@ -157,18 +431,54 @@ func (s *AuthZService) GetPolicies() ([]map[string]interface{}, error) {
 				"permission": perm.Name,
 				"resource":   perm.Resource,
 				"action":     perm.Action,
+				"effect":     domain.EffectAllow,
 			})
 		}
 	}
+
+	explicit, err := s.repo.GetPolicies()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range explicit {
+		if p.Role == nil || p.Permission == nil {
+			continue
+		}
+		policies = append(policies, map[string]interface{}{
+			"id":         p.ID.String(),
+			"role":       p.Role.Name,
+			"permission": p.Permission.Name,
+			"resource":   p.Permission.Resource,
+			"action":     p.Permission.Action,
+			"effect":     p.Effect,
+		})
+	}
 	return policies, nil
 }
 
+// DeletePolicy deletes a policy by the ID returned from GetPolicies: either a
+// "roleID:permissionID" assignment or an explicit policy ID
 func (s *AuthZService) DeletePolicy(id string) error {
-	// For now, this is a no-op since we don't have direct policy deletion
-	// In a full ABAC implementation, this would delete a Policy record
-	return nil
+	if roleID, permID, ok := strings.Cut(id, ":"); ok {
+		rid, err := uuid.Parse(roleID)
+		if err != nil {
+			return fmt.Errorf("%w: bad policy id", ErrInvalidPolicy)
+		}
+		pid, err := uuid.Parse(permID)
+		if err != nil {
+			return fmt.Errorf("%w: bad policy id", ErrInvalidPolicy)
+		}
+		return s.repo.DeleteRolePermission(rid, pid)
+	}
+
+	pid, err := uuid.Parse(id)
+	if err != nil {
+		return fmt.Errorf("%w: bad policy id", ErrInvalidPolicy)
+	}
+	return s.repo.DeletePolicy(pid)
 }
 
-func (s *AuthZService) IssueServiceToken(serviceName string) (string, error) {
-	return s.tokenSvc.GenerateServiceToken(serviceName)
+// ServiceTokenKeys returns the key set service tokens are verified against
+func (s *AuthZService) ServiceTokenKeys() servicetoken.JWKS {
+	return s.tokenSvc.JWKS()
 }
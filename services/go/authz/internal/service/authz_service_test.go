@@ -0,0 +1,53 @@
+package service
+
+import "testing"
+
+func TestSimilarityChecksAreForStaff(t *testing.T) {
+	svc, _ := newTestService(t)
+	if err := svc.SeedDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range []string{"instructor", "institute_admin", "system_admin", "student"} {
+		for _, action := range []string{"run", "read"} {
+			allowed, err := svc.CheckPermission(role+"-1", role, "similarity", action, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := role != "student"; allowed != want {
+				t.Errorf("%s similarity.%s: got %v, want %v", role, action, allowed, want)
+			}
+		}
+	}
+}
+
+func TestGuardiansOnlyReadGradesAndDeadlines(t *testing.T) {
+	svc, _ := newTestService(t)
+	if err := svc.SeedDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []struct {
+		resource, action string
+		allowed          bool
+	}{
+		{"transcript", "read", true},
+		{"deadline", "read", true},
+		{"submission", "create", false},
+		{"submission", "read", false},
+		{"submission", "grade", false},
+		{"grade", "release", false},
+		{"comment", "create", false},
+		{"comment", "private", false},
+		{"assignment", "update", false},
+		{"calendar", "manage", false},
+	} {
+		allowed, err := svc.CheckPermission("guardian-1", "guardian", p.resource, p.action, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != p.allowed {
+			t.Errorf("guardian %s.%s: got %v, want %v", p.resource, p.action, allowed, p.allowed)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"github.com/google/uuid"
+)
+
+// MaxBatchChecks is the most checks one CheckPermissions call decides
+const MaxBatchChecks = 50
+
+var (
+	ErrEmptyBatch    = errors.New("at least one check is required")
+	ErrBatchTooLarge = fmt.Errorf("at most %d checks are allowed in a batch", MaxBatchChecks)
+	ErrMixedSubjects = errors.New("every check in a batch must be for the batch's subject")
+)
+
+// PermissionCheck is one resource and action of a batch. Subject may be left
+// out; when set it must be the batch's.
+type PermissionCheck struct {
+	Subject  string `json:"subject,omitempty"`
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+// CheckPermissions decides several checks for one subject and role in one
+// go, returning the decisions in the order of checks. The rules that apply
+// are loaded once and every check is evaluated against them, so each
+// decision is the one CheckPermission would make. The decisions are logged
+// under a shared batch ID, which is returned too.
+func (s *AuthZService) CheckPermissions(subject, role, scope string, institutes []InstituteBinding, checks []PermissionCheck) ([]bool, uuid.UUID, error) {
+	switch {
+	case len(checks) == 0:
+		return nil, uuid.Nil, ErrEmptyBatch
+	case len(checks) > MaxBatchChecks:
+		return nil, uuid.Nil, ErrBatchTooLarge
+	}
+	for _, c := range checks {
+		if c.Subject != "" && c.Subject != subject {
+			return nil, uuid.Nil, ErrMixedSubjects
+		}
+	}
+
+	allowed := make([]bool, len(checks))
+	allows, denies, err := s.subjectRules(subject, role, scope, institutes)
+	if err == nil {
+		for i, c := range checks {
+			allowed[i] = evaluate(allows, denies, c.Resource, c.Action)
+		}
+	}
+
+	batchID := uuid.New()
+	now := time.Now()
+	logs := make([]domain.AuditLog, len(checks))
+	for i, c := range checks {
+		decision := "DENY"
+		if allowed[i] {
+			decision = "ALLOW"
+		}
+		logs[i] = domain.AuditLog{
+			Subject:   subject,
+			Resource:  c.Resource,
+			Action:    c.Action,
+			Decision:  decision,
+			Timestamp: now,
+			BatchID:   &batchID,
+		}
+	}
+
+	// Async audit logging, as for single checks
+	go func() {
+		_ = s.repo.LogAudits(logs)
+	}()
+
+	return allowed, batchID, err
+}
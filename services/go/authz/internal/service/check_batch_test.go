@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+)
+
+func TestCheckPermissionsKeepsInputOrder(t *testing.T) {
+	svc, _ := newTestService(t)
+	createPermissions(t, svc, "course.read", "course.update", "grade.read", "grade.update")
+	createRoles(t, svc, "ta")
+	for _, perm := range []string{"course.read", "grade.update"} {
+		if err := svc.AssignPermission("ta", perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checks := []PermissionCheck{
+		{Resource: "grade", Action: "update"},
+		{Resource: "course", Action: "update"},
+		{Resource: "course", Action: "read"},
+		{Subject: "u1", Resource: "grade", Action: "read"},
+		{Resource: "grade", Action: "update"},
+	}
+	allowed, _, err := svc.CheckPermissions("u1", "ta", "", nil, checks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allowed) != len(checks) {
+		t.Fatalf("got %d decisions for %d checks", len(allowed), len(checks))
+	}
+	for i, c := range checks {
+		single, err := svc.CheckPermission("u1", "ta", c.Resource, c.Action, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed[i] != single {
+			t.Errorf("check %d (%s.%s): batch says %v, a single check %v", i, c.Resource, c.Action, allowed[i], single)
+		}
+	}
+}
+
+func TestCheckPermissionsRejectsBadBatches(t *testing.T) {
+	svc, _ := newTestService(t)
+	tooMany := make([]PermissionCheck, MaxBatchChecks+1)
+	for i := range tooMany {
+		tooMany[i] = PermissionCheck{Resource: "course", Action: "read"}
+	}
+
+	for name, tc := range map[string]struct {
+		checks []PermissionCheck
+		want   error
+	}{
+		"empty":          {nil, ErrEmptyBatch},
+		"over the cap":   {tooMany, ErrBatchTooLarge},
+		"mixed subjects": {[]PermissionCheck{{Resource: "course", Action: "read"}, {Subject: "u2", Resource: "course", Action: "read"}}, ErrMixedSubjects},
+	} {
+		if _, _, err := svc.CheckPermissions("u1", "ta", "", nil, tc.checks); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+	if _, _, err := svc.CheckPermissions("u1", "ta", "", nil, tooMany[:MaxBatchChecks]); err != nil {
+		t.Errorf("a batch at the cap: %v", err)
+	}
+}
+
+func TestBatchDecisionsAreAuditedTogether(t *testing.T) {
+	svc, db := newTestService(t)
+	createPermissions(t, svc, "course.read")
+	createRoles(t, svc, "ta")
+	if err := svc.AssignPermission("ta", "course.read"); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []PermissionCheck{{Resource: "course", Action: "read"}, {Resource: "course", Action: "delete"}, {Resource: "grade", Action: "read"}}
+	_, batchID, err := svc.CheckPermissions("u1", "ta", "", nil, checks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, other, err := svc.CheckPermissions("u1", "ta", "", nil, checks[:1]); err != nil || other == batchID {
+		t.Fatalf("second batch: id %s, %v; want a new batch ID", other, err)
+	}
+
+	var logs []domain.AuditLog
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		logs = nil
+		if err := db.Where("batch_id = ?", batchID).Order("resource, action").Find(&logs).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) == len(checks) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(logs) != len(checks) {
+		t.Fatalf("%d audit entries under the batch ID, want one per check", len(logs))
+	}
+	decisions := map[string]string{}
+	for _, l := range logs {
+		if l.Subject != "u1" {
+			t.Errorf("entry for %s in u1's batch", l.Subject)
+		}
+		decisions[l.Resource+"."+l.Action] = l.Decision
+	}
+	if decisions["course.read"] != "ALLOW" || decisions["course.delete"] != "DENY" || decisions["grade.read"] != "DENY" {
+		t.Errorf("audited decisions = %v", decisions)
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/repository"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService returns an AuthZService over an in-memory database. The
+// one connection keeps the database shared and serialises the writes,
+// including the asynchronous audit ones.
+func newTestService(t *testing.T) (*AuthZService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	svc := NewAuthZService(repository.NewAuthZRepository(db), nil)
+	if err := svc.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return svc, db
+}
+
+// createPermissions creates each permission from its name, split into
+// resource and action at the last dot
+func createPermissions(t *testing.T, svc *AuthZService, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		i := strings.LastIndex(name, ".")
+		if err := svc.CreatePermission(name, name[:i], name[i+1:], ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
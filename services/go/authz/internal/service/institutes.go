@@ -0,0 +1,41 @@
+package service
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+)
+
+// InstituteBinding is an institute admin's role in one institute, as held by
+// the identity service
+type InstituteBinding struct {
+	InstituteID string `json:"institute_id"`
+	Role        string `json:"role"` // OWNER or ADMIN
+}
+
+// instituteRoles maps identity's per-institute roles to the roles holding
+// their permissions here
+var instituteRoles = map[string]string{
+	"OWNER": "institute_owner",
+	"ADMIN": "institute_admin",
+}
+
+// SourceInstitute marks permissions that come from a per-institute role and
+// only apply to checks scoped to that institute
+const SourceInstitute = "institute"
+
+// InstituteScope is the check scope of an institute
+func InstituteScope(instituteID string) string {
+	return "institute:" + instituteID
+}
+
+// bindingRules returns the rules of the institute role bound to scope, if
+// any binding is for that institute
+func (s *AuthZService) bindingRules(bindings []InstituteBinding, scope string) ([]domain.Permission, []domain.Permission, error) {
+	for _, b := range bindings {
+		role, ok := instituteRoles[b.Role]
+		if !ok || InstituteScope(b.InstituteID) != scope {
+			continue
+		}
+		return s.roleRules(role)
+	}
+	return nil, nil, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestInstituteRolesApplyOnlyInTheirInstitute(t *testing.T) {
+	svc, _ := newTestService(t)
+	if err := svc.SeedDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	bindings := []InstituteBinding{{InstituteID: "inst-1", Role: "OWNER"}, {InstituteID: "inst-2", Role: "ADMIN"}}
+
+	for _, tt := range []struct {
+		scope string
+		want  bool
+	}{
+		{InstituteScope("inst-1"), true},
+		{InstituteScope("inst-2"), false}, // only an ADMIN there
+		{InstituteScope("inst-3"), false},
+		{"", false},
+	} {
+		allowed, err := svc.CheckPermission("admin-1", "INSTITUTE_ADMIN", "institute_admin", "manage", tt.scope, bindings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != tt.want {
+			t.Errorf("institute_admin.manage in %q: got %v, want %v", tt.scope, allowed, tt.want)
+		}
+	}
+
+	// The owner role inherits what admins may do
+	if allowed, err := svc.CheckPermission("admin-1", "INSTITUTE_ADMIN", "grade", "history", InstituteScope("inst-1"), bindings); err != nil || !allowed {
+		t.Errorf("owner grade.history: got %v, %v", allowed, err)
+	}
+
+	resolved, err := svc.ResolvePermissions("admin-1", "INSTITUTE_ADMIN", bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopes := map[string]bool{}
+	for _, p := range resolved.Sources {
+		if p.Name == "institute_admin.manage" {
+			scopes[p.Scope] = true
+		}
+	}
+	if len(scopes) != 1 || !scopes[InstituteScope("inst-1")] {
+		t.Errorf("institute_admin.manage resolved for scopes %v, want only inst-1", scopes)
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+)
+
+var ErrInvalidDocument = errors.New("invalid policy document")
+
+// ExportPolicies returns every role, permission, deny and inheritance link
+// as a document ImportPolicies accepts
+func (s *AuthZService) ExportPolicies() (*domain.PolicyDocument, error) {
+	return s.repo.ExportPolicies()
+}
+
+// ImportPolicies brings the roles and permissions in line with doc and
+// returns what changed. Without prune it only creates and updates, leaving
+// alone anything doc does not mention; with prune, roles, permissions, rules
+// and parents missing from doc are deleted too. Importing an export of the
+// current state changes nothing. A dry run returns the plan without applying
+// it.
+func (s *AuthZService) ImportPolicies(doc *domain.PolicyDocument, prune, dryRun bool) (*domain.ImportPlan, error) {
+	return s.repo.ImportPolicies(func(current *domain.PolicyDocument) (*domain.ImportPlan, error) {
+		return planImport(current, doc, prune)
+	}, dryRun)
+}
+
+// planImport works out the changes that turn current into desired
+func planImport(current, desired *domain.PolicyDocument, prune bool) (*domain.ImportPlan, error) {
+	currentPerms := make(map[string]domain.PermissionSpec, len(current.Permissions))
+	for _, p := range current.Permissions {
+		currentPerms[p.Name] = p
+	}
+	currentRoles := make(map[string]domain.RoleSpec, len(current.Roles))
+	for _, r := range current.Roles {
+		currentRoles[r.Name] = r
+	}
+	if err := validateDocument(desired, currentPerms, currentRoles, prune); err != nil {
+		return nil, err
+	}
+
+	plan := &domain.ImportPlan{
+		CreatePermissions: make([]domain.PermissionSpec, 0),
+		UpdatePermissions: make([]domain.PermissionSpec, 0),
+		DeletePermissions: make([]string, 0),
+		CreateRoles:       make([]domain.RoleSpec, 0),
+		UpdateRoles:       make([]domain.RoleSpec, 0),
+		DeleteRoles:       make([]string, 0),
+		AddAssignments:    make([]domain.RoleRule, 0),
+		RemoveAssignments: make([]domain.RoleRule, 0),
+		AddDenies:         make([]domain.RoleRule, 0),
+		RemoveDenies:      make([]domain.RoleRule, 0),
+		AddInherits:       make([]domain.RoleParent, 0),
+		RemoveInherits:    make([]domain.RoleParent, 0),
+	}
+
+	wantPerms := make(map[string]bool, len(desired.Permissions))
+	for _, p := range desired.Permissions {
+		wantPerms[p.Name] = true
+		have, ok := currentPerms[p.Name]
+		if !ok {
+			plan.CreatePermissions = append(plan.CreatePermissions, p)
+		} else if have != p {
+			plan.UpdatePermissions = append(plan.UpdatePermissions, p)
+		}
+	}
+
+	wantRoles := make(map[string]bool, len(desired.Roles))
+	for _, r := range desired.Roles {
+		wantRoles[r.Name] = true
+		fields := domain.RoleSpec{Name: r.Name, Scope: r.Scope, Description: r.Description}
+		have, ok := currentRoles[r.Name]
+		if !ok {
+			plan.CreateRoles = append(plan.CreateRoles, fields)
+		} else if have.Scope != r.Scope || have.Description != r.Description {
+			plan.UpdateRoles = append(plan.UpdateRoles, fields)
+		}
+
+		add, remove := diffNames(have.Permissions, r.Permissions, prune)
+		for _, name := range add {
+			plan.AddAssignments = append(plan.AddAssignments, domain.RoleRule{Role: r.Name, Permission: name})
+		}
+		for _, name := range remove {
+			plan.RemoveAssignments = append(plan.RemoveAssignments, domain.RoleRule{Role: r.Name, Permission: name})
+		}
+		add, remove = diffNames(have.Denies, r.Denies, prune)
+		for _, name := range add {
+			plan.AddDenies = append(plan.AddDenies, domain.RoleRule{Role: r.Name, Permission: name})
+		}
+		for _, name := range remove {
+			plan.RemoveDenies = append(plan.RemoveDenies, domain.RoleRule{Role: r.Name, Permission: name})
+		}
+		add, remove = diffNames(have.Inherits, r.Inherits, prune)
+		for _, name := range add {
+			plan.AddInherits = append(plan.AddInherits, domain.RoleParent{Role: r.Name, Parent: name})
+		}
+		for _, name := range remove {
+			plan.RemoveInherits = append(plan.RemoveInherits, domain.RoleParent{Role: r.Name, Parent: name})
+		}
+	}
+
+	if prune {
+		for _, r := range current.Roles {
+			if !wantRoles[r.Name] {
+				plan.DeleteRoles = append(plan.DeleteRoles, r.Name)
+			}
+		}
+		for _, p := range current.Permissions {
+			if !wantPerms[p.Name] {
+				plan.DeletePermissions = append(plan.DeletePermissions, p.Name)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// validateDocument checks that names are given and unique, and that every
+// permission and parent a role names will exist after the import: listed in
+// doc or, without prune, already there. It also rejects inheritance cycles
+// in the resulting roles.
+func validateDocument(doc *domain.PolicyDocument, currentPerms map[string]domain.PermissionSpec, currentRoles map[string]domain.RoleSpec, prune bool) error {
+	perms := make(map[string]bool)
+	if !prune {
+		for name := range currentPerms {
+			perms[name] = true
+		}
+	}
+	listed := make(map[string]bool, len(doc.Permissions))
+	for _, p := range doc.Permissions {
+		if p.Name == "" {
+			return fmt.Errorf("%w: every permission needs a name", ErrInvalidDocument)
+		}
+		if listed[p.Name] {
+			return fmt.Errorf("%w: permission %q is listed twice", ErrInvalidDocument, p.Name)
+		}
+		listed[p.Name] = true
+		perms[p.Name] = true
+	}
+
+	// The parents each role ends up with
+	parents := make(map[string][]string)
+	if !prune {
+		for name, r := range currentRoles {
+			parents[name] = r.Inherits
+		}
+	}
+	listed = make(map[string]bool, len(doc.Roles))
+	for _, r := range doc.Roles {
+		if r.Name == "" {
+			return fmt.Errorf("%w: every role needs a name", ErrInvalidDocument)
+		}
+		if listed[r.Name] {
+			return fmt.Errorf("%w: role %q is listed twice", ErrInvalidDocument, r.Name)
+		}
+		listed[r.Name] = true
+
+		for _, name := range append(append([]string{}, r.Permissions...), r.Denies...) {
+			if !perms[name] {
+				return fmt.Errorf("%w: role %q names unknown permission %q", ErrInvalidDocument, r.Name, name)
+			}
+		}
+		if prune {
+			parents[r.Name] = r.Inherits
+		} else {
+			add, _ := diffNames(parents[r.Name], r.Inherits, false)
+			parents[r.Name] = append(append([]string{}, parents[r.Name]...), add...)
+		}
+	}
+	for role, names := range parents {
+		for _, name := range names {
+			if _, ok := parents[name]; !ok {
+				return fmt.Errorf("%w: role %q inherits from unknown role %q", ErrInvalidDocument, role, name)
+			}
+		}
+	}
+
+	// Depth-first search for a role reachable from itself
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(parents))
+	var visit func(role string) error
+	visit = func(role string) error {
+		switch state[role] {
+		case visiting:
+			return fmt.Errorf("%w: role inheritance would create a cycle through %q", ErrInvalidDocument, role)
+		case done:
+			return nil
+		}
+		state[role] = visiting
+		for _, parent := range parents[role] {
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		state[role] = done
+		return nil
+	}
+	for role := range parents {
+		if err := visit(role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffNames returns the names in want missing from have and, with prune,
+// the names in have missing from want. Repeated names count once.
+func diffNames(have, want []string, prune bool) (add, remove []string) {
+	haveSet := make(map[string]bool, len(have))
+	for _, name := range have {
+		haveSet[name] = true
+	}
+	wantSet := make(map[string]bool, len(want))
+	for _, name := range want {
+		if !wantSet[name] && !haveSet[name] {
+			add = append(add, name)
+		}
+		wantSet[name] = true
+	}
+	if prune {
+		for _, name := range have {
+			if !wantSet[name] {
+				remove = append(remove, name)
+			}
+		}
+	}
+	return add, remove
+}
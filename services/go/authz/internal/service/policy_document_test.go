@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+)
+
+func TestImportOfExportChangesNothing(t *testing.T) {
+	svc, _ := newTestService(t)
+	createPermissions(t, svc, "course.read", "grade.update")
+	createRoles(t, svc, "viewer", "ta")
+	if err := svc.AssignPermission("viewer", "course.read"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetRoleInherits("ta", []string{"viewer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := svc.ExportPolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := svc.ImportPolicies(doc, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("re-importing the export planned %+v", plan)
+	}
+}
+
+func TestImportPolicies(t *testing.T) {
+	svc, _ := newTestService(t)
+	createPermissions(t, svc, "course.read", "course.delete")
+	createRoles(t, svc, "viewer", "legacy")
+	if err := svc.AssignPermission("viewer", "course.delete"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := svc.ExportPolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &domain.PolicyDocument{
+		Permissions: []domain.PermissionSpec{
+			{Name: "course.read", Resource: "course", Action: "read"},
+			{Name: "grade.update", Resource: "grade", Action: "update"},
+		},
+		Roles: []domain.RoleSpec{
+			{Name: "viewer", Scope: domain.ScopeSystem, Permissions: []string{"course.read"}},
+			{Name: "ta", Scope: domain.ScopeSystem, Inherits: []string{"viewer"}, Permissions: []string{"grade.update"}},
+		},
+	}
+	// Keep the seeded roles, which this document does not mention
+	for _, r := range before.Roles {
+		if r.Name != "viewer" && r.Name != "legacy" {
+			doc.Roles = append(doc.Roles, r)
+		}
+	}
+	for _, p := range before.Permissions {
+		if p.Name != "course.read" && p.Name != "course.delete" {
+			doc.Permissions = append(doc.Permissions, p)
+		}
+	}
+
+	plan, err := svc.ImportPolicies(doc, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan.DeleteRoles, []string{"legacy"}) || !reflect.DeepEqual(plan.DeletePermissions, []string{"course.delete"}) {
+		t.Errorf("dry run deletes roles %v and permissions %v", plan.DeleteRoles, plan.DeletePermissions)
+	}
+	if after, err := svc.ExportPolicies(); err != nil || !reflect.DeepEqual(after, before) {
+		t.Fatalf("dry run changed the policies: %v", err)
+	}
+
+	if _, err := svc.ImportPolicies(doc, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := effective(t, svc, "ta"); !reflect.DeepEqual(got, []string{"course.read", "grade.update"}) {
+		t.Errorf("ta effective permissions = %v", got)
+	}
+	if _, err := svc.GetRole("legacy"); err == nil {
+		t.Error("pruned role still exists")
+	}
+	if got := effective(t, svc, "viewer"); !reflect.DeepEqual(got, []string{"course.read"}) {
+		t.Errorf("viewer effective permissions = %v, want the pruned course.delete gone", got)
+	}
+}
+
+func TestImportRejectsInvalidDocuments(t *testing.T) {
+	svc, _ := newTestService(t)
+	createRoles(t, svc, "viewer")
+
+	for name, doc := range map[string]*domain.PolicyDocument{
+		"unknown permission": {Roles: []domain.RoleSpec{{Name: "viewer", Permissions: []string{"nope.read"}}}},
+		"unknown parent":     {Roles: []domain.RoleSpec{{Name: "viewer", Inherits: []string{"ghost"}}}},
+		"duplicate role":     {Roles: []domain.RoleSpec{{Name: "ta"}, {Name: "ta"}}},
+		"cycle": {Roles: []domain.RoleSpec{
+			{Name: "a", Inherits: []string{"b"}},
+			{Name: "b", Inherits: []string{"a"}},
+		}},
+	} {
+		if _, err := svc.ImportPolicies(doc, false, false); !errors.Is(err, ErrInvalidDocument) {
+			t.Errorf("%s: err = %v, want ErrInvalidDocument", name, err)
+		}
+	}
+}
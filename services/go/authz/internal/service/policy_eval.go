@@ -0,0 +1,59 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+)
+
+// matchPattern reports whether value matches pattern. "*" matches anything
+// and a trailing "*" matches by prefix, so "user.*" matches "user.profile"
+// as well as "user" itself.
+func matchPattern(pattern, value string) bool {
+	if pattern == "*" || pattern == value {
+		return true
+	}
+	if !strings.HasSuffix(pattern, "*") {
+		return false
+	}
+	prefix := strings.TrimSuffix(pattern, "*")
+	if strings.HasPrefix(value, prefix) {
+		return true
+	}
+	return strings.HasSuffix(prefix, ".") && value == strings.TrimSuffix(prefix, ".")
+}
+
+func matchesAny(perms []domain.Permission, resource, action string) bool {
+	for _, p := range perms {
+		if matchPattern(p.Resource, resource) && matchPattern(p.Action, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate decides a request against a role's rules. Denies are checked
+// first and always win; anything not explicitly allowed is denied.
+func evaluate(allows, denies []domain.Permission, resource, action string) bool {
+	if matchesAny(denies, resource, action) {
+		return false
+	}
+	return matchesAny(allows, resource, action)
+}
+
+// isPattern reports whether a permission uses a wildcard
+func isPattern(p domain.Permission) bool {
+	return strings.HasSuffix(p.Resource, "*") || strings.HasSuffix(p.Action, "*")
+}
+
+// effectivePermissions names the concrete permissions in all that the rules
+// allow
+func effectivePermissions(all, allows, denies []domain.Permission) []string {
+	names := make([]string, 0)
+	for _, p := range all {
+		if !isPattern(p) && evaluate(allows, denies, p.Resource, p.Action) {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
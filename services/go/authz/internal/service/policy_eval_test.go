@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+)
+
+func TestEvaluate(t *testing.T) {
+	perm := func(resource, action string) domain.Permission {
+		return domain.Permission{Resource: resource, Action: action}
+	}
+	tests := []struct {
+		name             string
+		allows, denies   []domain.Permission
+		resource, action string
+		want             bool
+	}{
+		{"exact allow", []domain.Permission{perm("user", "read")}, nil, "user", "read", true},
+		{"other action", []domain.Permission{perm("user", "read")}, nil, "user", "delete", false},
+		{"other resource", []domain.Permission{perm("user", "read")}, nil, "grade", "read", false},
+		{"no rules", nil, nil, "user", "read", false},
+		{"any action", []domain.Permission{perm("user", "*")}, nil, "user", "delete", true},
+		{"any resource", []domain.Permission{perm("*", "read")}, nil, "grade", "read", true},
+		{"everything", []domain.Permission{perm("*", "*")}, nil, "grade", "write", true},
+		{"resource prefix", []domain.Permission{perm("user.*", "read")}, nil, "user.profile", "read", true},
+		{"resource prefix covers its root", []domain.Permission{perm("user.*", "read")}, nil, "user", "read", true},
+		{"resource prefix needs the dot", []domain.Permission{perm("user.*", "read")}, nil, "username", "read", false},
+		{"action prefix", []domain.Permission{perm("report", "export*")}, nil, "report", "export_csv", true},
+		{"deny wins over exact allow", []domain.Permission{perm("user", "delete")}, []domain.Permission{perm("user", "delete")}, "user", "delete", false},
+		{"deny wins over wildcard allow", []domain.Permission{perm("user", "*")}, []domain.Permission{perm("user", "delete")}, "user", "delete", false},
+		{"deny leaves the rest of a wildcard", []domain.Permission{perm("user", "*")}, []domain.Permission{perm("user", "delete")}, "user", "update", true},
+		{"wildcard deny", []domain.Permission{perm("user", "read")}, []domain.Permission{perm("*", "*")}, "user", "read", false},
+		{"deny alone allows nothing", nil, []domain.Permission{perm("user", "delete")}, "user", "read", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluate(tt.allows, tt.denies, tt.resource, tt.action); got != tt.want {
+				t.Errorf("evaluate(%s.%s) = %v, want %v", tt.resource, tt.action, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenyPolicyOverridesWildcardAllow(t *testing.T) {
+	svc, _ := newTestService(t)
+	createPermissions(t, svc, "user.read", "user.update", "user.delete", "user.*", "grade.read")
+	if err := svc.CreateRole("support", domain.ScopeSystem, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreatePolicy("support", "user.*", domain.EffectAllow); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreatePolicy("support", "user.delete", domain.EffectDeny); err != nil {
+		t.Fatal(err)
+	}
+
+	for action, want := range map[string]bool{"read": true, "update": true, "delete": false} {
+		allowed, err := svc.CheckPermission("u1", "support", "user", action, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != want {
+			t.Errorf("user.%s: got %v, want %v", action, allowed, want)
+		}
+	}
+	if allowed, err := svc.CheckPermission("u1", "support", "grade", "read", "", nil); err != nil || allowed {
+		t.Errorf("grade.read: got %v, %v, want denied by default", allowed, err)
+	}
+	if allowed, err := svc.CheckPermission("u1", "nobody", "user", "read", "", nil); err != nil || allowed {
+		t.Errorf("unknown role: got %v, %v, want denied", allowed, err)
+	}
+
+	// The effective set is flattened: concrete permissions only, denies removed
+	resolved, err := svc.ResolvePermissions("u1", "support", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perms := resolved.Permissions
+	sort.Strings(perms)
+	if want := []string{"user.read", "user.update"}; !reflect.DeepEqual(perms, want) {
+		t.Errorf("ResolvePermissions = %v, want %v", perms, want)
+	}
+}
+
+func TestCreatePolicyRejectsUnknownEffect(t *testing.T) {
+	svc, _ := newTestService(t)
+	createPermissions(t, svc, "user.read")
+	if err := svc.CreateRole("support", domain.ScopeSystem, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreatePolicy("support", "user.read", "maybe"); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("got %v, want ErrInvalidPolicy", err)
+	}
+}
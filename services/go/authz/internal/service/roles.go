@@ -0,0 +1,76 @@
+package service
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/repository"
+)
+
+// ErrInheritanceCycle means a role would end up inheriting from itself
+var ErrInheritanceCycle = repository.ErrInheritanceCycle
+
+// RoleView is a role as returned by the roles API. Permissions are the ones
+// assigned to the role itself; EffectivePermissions are the concrete
+// permissions it ends up with once allows and denies inherited from its
+// ancestors are applied.
+type RoleView struct {
+	domain.Role
+	Inherits             []string `json:"inherits"`
+	EffectivePermissions []string `json:"effective_permissions"`
+}
+
+func (s *AuthZService) GetAllRoles() ([]RoleView, error) {
+	roles, err := s.repo.GetAllRoles()
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.repo.GetAllPermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]RoleView, 0, len(roles))
+	for _, role := range roles {
+		view, err := s.roleView(role, all)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, *view)
+	}
+	return views, nil
+}
+
+func (s *AuthZService) GetRole(name string) (*RoleView, error) {
+	role, err := s.repo.GetRole(name)
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.repo.GetAllPermissions()
+	if err != nil {
+		return nil, err
+	}
+	return s.roleView(*role, all)
+}
+
+func (s *AuthZService) roleView(role domain.Role, all []domain.Permission) (*RoleView, error) {
+	allows, denies, err := s.repo.GetRoleRules(role.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &RoleView{
+		Role:                 role,
+		Inherits:             make([]string, 0, len(role.Parents)),
+		EffectivePermissions: effectivePermissions(all, allows, denies),
+	}
+	for _, parent := range role.Parents {
+		view.Inherits = append(view.Inherits, parent.Name)
+	}
+	return view, nil
+}
+
+// SetRoleInherits replaces the roles a role inherits from. A role gets every
+// allow and deny of its ancestors; denies still win over allows, wherever
+// either comes from.
+func (s *AuthZService) SetRoleInherits(name string, inherits []string) error {
+	return s.repo.SetRoleParents(name, inherits)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	gosqlite "github.com/glebarez/go-sqlite"
+)
+
+// SetRoleParents serialises inheritance changes with a Postgres advisory
+// lock. The one test connection already serialises them, so the functions
+// do nothing here.
+func init() {
+	gosqlite.MustRegisterScalarFunction("hashtext", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return int64(0), nil
+	})
+	gosqlite.MustRegisterScalarFunction("pg_advisory_xact_lock", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return nil, nil
+	})
+}
+
+// createRoles creates system roles with the given names
+func createRoles(t *testing.T, svc *AuthZService, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := svc.CreateRole(name, domain.ScopeSystem, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func effective(t *testing.T, svc *AuthZService, role string) []string {
+	t.Helper()
+	view, err := svc.GetRole(role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(view.EffectivePermissions)
+	return view.EffectivePermissions
+}
+
+func TestRoleInheritsAncestorPermissions(t *testing.T) {
+	svc, _ := newTestService(t)
+	createPermissions(t, svc, "course.read", "course.update", "grade.read", "grade.update")
+	createRoles(t, svc, "viewer", "ta", "instructor")
+	for role, perm := range map[string]string{"viewer": "course.read", "ta": "grade.read", "instructor": "grade.update"} {
+		if err := svc.AssignPermission(role, perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.SetRoleInherits("ta", []string{"viewer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetRoleInherits("instructor", []string{"ta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"course.read", "grade.read", "grade.update"}
+	if got := effective(t, svc, "instructor"); !reflect.DeepEqual(got, want) {
+		t.Errorf("instructor effective permissions = %v, want %v", got, want)
+	}
+	if allowed, err := svc.CheckPermission("u1", "instructor", "course", "read", "", nil); err != nil || !allowed {
+		t.Errorf("instructor course.read through two levels: got %v, %v", allowed, err)
+	}
+	if got := effective(t, svc, "viewer"); !reflect.DeepEqual(got, []string{"course.read"}) {
+		t.Errorf("viewer effective permissions = %v, parents must not gain their children's", got)
+	}
+
+	view, err := svc.GetRole("instructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(view.Inherits, []string{"ta"}) {
+		t.Errorf("instructor inherits = %v, want only its direct parent", view.Inherits)
+	}
+}
+
+func TestInheritedDenyWinsOverOwnAllow(t *testing.T) {
+	svc, _ := newTestService(t)
+	createPermissions(t, svc, "user.read", "user.delete", "user.*")
+	createRoles(t, svc, "restricted", "support")
+	if err := svc.CreatePolicy("restricted", "user.delete", domain.EffectDeny); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreatePolicy("support", "user.*", domain.EffectAllow); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetRoleInherits("support", []string{"restricted"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := effective(t, svc, "support"); !reflect.DeepEqual(got, []string{"user.read"}) {
+		t.Errorf("support effective permissions = %v, want the inherited deny applied", got)
+	}
+	if allowed, err := svc.CheckPermission("u1", "support", "user", "delete", "", nil); err != nil || allowed {
+		t.Errorf("support user.delete: got %v, %v, want denied", allowed, err)
+	}
+}
+
+func TestRoleInheritanceRejectsCycles(t *testing.T) {
+	svc, _ := newTestService(t)
+	createRoles(t, svc, "a", "b", "c")
+	if err := svc.SetRoleInherits("b", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetRoleInherits("c", []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ role, parent string }{{"a", "a"}, {"a", "b"}, {"a", "c"}} {
+		if err := svc.SetRoleInherits(tt.role, []string{tt.parent}); !errors.Is(err, ErrInheritanceCycle) {
+			t.Errorf("%s inheriting from %s: got %v, want ErrInheritanceCycle", tt.role, tt.parent, err)
+		}
+	}
+	view, err := svc.GetRole("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(view.Inherits) != 0 {
+		t.Errorf("a inherits %v after rejected updates, want nothing", view.Inherits)
+	}
+}
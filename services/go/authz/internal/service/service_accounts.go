@@ -0,0 +1,247 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/servicetoken"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidServiceAccount = errors.New("invalid service account")
+	ErrServiceAccountExists  = repository.ErrServiceAccountExists
+	ErrUnknownPermission     = repository.ErrUnknownPermission
+	// ErrServiceAccountDisabled is returned when a disabled account asks for
+	// a token
+	ErrServiceAccountDisabled = errors.New("service account is disabled")
+	// ErrPermissionNotAllowed is returned when a token is asked for with a
+	// permission outside the account's allowlist
+	ErrPermissionNotAllowed = errors.New("permission is not allowed for this service account")
+	// ErrInvalidServiceCredentials is returned when a token is asked for
+	// with an unknown account or a wrong client secret
+	ErrInvalidServiceCredentials = errors.New("invalid service account credentials")
+)
+
+// serviceAccountName is what account names look like, e.g. "submission-service"
+var serviceAccountName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ServiceAccountRequest creates or updates a service account. On update nil
+// fields are left alone and Permissions replaces the whole allowlist.
+type ServiceAccountRequest struct {
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	Permissions *[]string `json:"permissions"`
+	Active      *bool     `json:"active"`
+	// CreatedBy is the admin API caller creating the account, never read
+	// from the body
+	CreatedBy string `json:"-"`
+}
+
+// IssuedServiceToken is a signed service token with what it carries
+type IssuedServiceToken struct {
+	Token       string    `json:"token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Permissions []string  `json:"permissions"`
+}
+
+// CreateServiceAccount creates an account, active unless req says otherwise,
+// with a new client secret returned in its ClientSecret
+func (s *AuthZService) CreateServiceAccount(req ServiceAccountRequest) (*domain.ServiceAccount, error) {
+	if !serviceAccountName.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: name must be 1-63 lowercase letters, digits, '-' or '_'", ErrInvalidServiceAccount)
+	}
+	secret, hash, err := newClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	account := &domain.ServiceAccount{
+		Name:         req.Name,
+		Active:       req.Active == nil || *req.Active,
+		SecretHash:   hash,
+		ClientSecret: secret,
+		CreatedBy:    req.CreatedBy,
+	}
+	if req.Description != nil {
+		account.Description = *req.Description
+	}
+	var perms []string
+	if req.Permissions != nil {
+		perms = *req.Permissions
+	}
+	if err := s.repo.CreateServiceAccount(account, perms); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (s *AuthZService) GetServiceAccount(name string) (*domain.ServiceAccount, error) {
+	return s.repo.GetServiceAccount(name)
+}
+
+func (s *AuthZService) ListServiceAccounts() ([]domain.ServiceAccount, error) {
+	return s.repo.ListServiceAccounts()
+}
+
+// UpdateServiceAccount changes an account's description, allowlist or
+// active flag. Tokens already issued keep what they carry until they expire.
+func (s *AuthZService) UpdateServiceAccount(name string, req ServiceAccountRequest) (*domain.ServiceAccount, error) {
+	err := s.repo.UpdateServiceAccount(name, repository.ServiceAccountUpdate{
+		Description: req.Description,
+		Active:      req.Active,
+		Permissions: req.Permissions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetServiceAccount(name)
+}
+
+// RotateServiceAccountSecret replaces an account's client secret and returns
+// the account with the new one in ClientSecret. The old secret stops
+// working at once; tokens already issued with it last until they expire.
+func (s *AuthZService) RotateServiceAccountSecret(name string) (*domain.ServiceAccount, error) {
+	secret, hash, err := newClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateServiceAccount(name, repository.ServiceAccountUpdate{SecretHash: &hash}); err != nil {
+		return nil, err
+	}
+	account, err := s.repo.GetServiceAccount(name)
+	if err != nil {
+		return nil, err
+	}
+	account.ClientSecret = secret
+	return account, nil
+}
+
+// DeleteServiceAccount deletes an account and reports whether it existed
+func (s *AuthZService) DeleteServiceAccount(name string) (bool, error) {
+	return s.repo.DeleteServiceAccount(name)
+}
+
+// IssueServiceToken signs a token for an active service account proving
+// itself with its client secret. It carries the requested permissions,
+// which must all be on the account's allowlist, or the whole allowlist if
+// none are requested. Each issue is audited.
+func (s *AuthZService) IssueServiceToken(serviceName, clientSecret string, requested []string) (*IssuedServiceToken, error) {
+	account, err := s.repo.GetServiceAccount(serviceName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.auditTokenIssue(serviceName, "DENY")
+		return nil, ErrInvalidServiceCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !secretMatches(account, clientSecret) {
+		s.auditTokenIssue(serviceName, "DENY")
+		return nil, ErrInvalidServiceCredentials
+	}
+	if !account.Active {
+		s.auditTokenIssue(serviceName, "DENY")
+		return nil, ErrServiceAccountDisabled
+	}
+	perms, err := tokenPermissions(account, requested)
+	if err != nil {
+		s.auditTokenIssue(serviceName, "DENY")
+		return nil, err
+	}
+
+	token, expiresAt, err := s.tokenSvc.GenerateServiceToken(account.Name, perms)
+	if err != nil {
+		return nil, err
+	}
+	s.auditTokenIssue(serviceName, "ALLOW")
+	return &IssuedServiceToken{Token: token, TokenType: "Bearer", ExpiresAt: expiresAt, Permissions: perms}, nil
+}
+
+// tokenPermissions returns the permissions a token for account carries when
+// requested were asked for
+func tokenPermissions(account *domain.ServiceAccount, requested []string) ([]string, error) {
+	allowed := account.PermissionNames()
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	perms := make([]string, 0, len(requested))
+	for _, name := range requested {
+		if !slices.Contains(allowed, name) {
+			return nil, fmt.Errorf("%w: %s", ErrPermissionNotAllowed, name)
+		}
+		if !slices.Contains(perms, name) {
+			perms = append(perms, name)
+		}
+	}
+	return perms, nil
+}
+
+// ServiceTokenAllowed reports whether the account a service token was
+// issued to may still use it for permission: the account must still exist,
+// be active and have the permission on its allowlist. Tokens outlive
+// changes to their account, so callers that must not wait for them to
+// expire check this on top of the token.
+func (s *AuthZService) ServiceTokenAllowed(claims *servicetoken.Claims, permission string) (bool, error) {
+	if !claims.HasPermission(permission) {
+		return false, nil
+	}
+	account, err := s.repo.GetServiceAccount(claims.Service())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, ErrServiceAccountDisabled
+	}
+	if err != nil {
+		return false, err
+	}
+	if !account.Active {
+		return false, ErrServiceAccountDisabled
+	}
+	return slices.Contains(account.PermissionNames(), permission), nil
+}
+
+// newClientSecret returns a random client secret and the hash stored for it
+func newClientSecret() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashClientSecret(secret), nil
+}
+
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretMatches reports whether secret is the account's client secret. An
+// account without one, created before secrets existed, matches nothing
+// until its secret is rotated.
+func secretMatches(account *domain.ServiceAccount, secret string) bool {
+	if account.SecretHash == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(account.SecretHash), []byte(hashClientSecret(secret))) == 1
+}
+
+func (s *AuthZService) auditTokenIssue(serviceName, decision string) {
+	go func() {
+		_ = s.repo.LogAudit(&domain.AuditLog{
+			Subject:   servicetoken.SubjectPrefix + serviceName,
+			Resource:  "service_token",
+			Action:    "issue",
+			Decision:  decision,
+			Timestamp: time.Now(),
+		})
+	}()
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/servicetoken"
+)
+
+// newTokenTestService is newTestService able to sign service tokens, with
+// the authz key set served for verifiers
+func newTokenTestService(t *testing.T) (*AuthZService, *servicetoken.Verifier) {
+	t.Helper()
+	svc, _ := newTestService(t)
+	tokenSvc, err := NewServiceTokenService("", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.tokenSvc = tokenSvc
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(svc.ServiceTokenKeys())
+	}))
+	t.Cleanup(jwks.Close)
+	return svc, servicetoken.NewVerifier(servicetoken.Config{JWKSURL: jwks.URL})
+}
+
+func TestServiceTokenVerifiesWithItsPermissions(t *testing.T) {
+	svc, verifier := newTokenTestService(t)
+	createPermissions(t, svc, "user.read", "user.write", "grade.read")
+	perms := []string{"user.read", "user.write"}
+	account, err := svc.CreateServiceAccount(ServiceAccountRequest{Name: "submission-service", Permissions: &perms})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued, err := svc.IssueServiceToken("submission-service", account.ClientSecret, []string{"user.read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifier.Verify(context.Background(), issued.Token)
+	if err != nil {
+		t.Fatalf("verifying the issued token = %v", err)
+	}
+	if claims.Service() != "submission-service" {
+		t.Errorf("token is for %q, want submission-service", claims.Service())
+	}
+	if !slices.Equal(claims.Permissions, []string{"user.read"}) {
+		t.Errorf("token carries %v, want only the requested user.read", claims.Permissions)
+	}
+	if !claims.ExpiresAt.Time.Equal(issued.ExpiresAt) {
+		t.Errorf("token expires at %s, issued as %s", claims.ExpiresAt.Time, issued.ExpiresAt)
+	}
+
+	// Nothing requested carries the whole allowlist
+	issued, err = svc.IssueServiceToken("submission-service", account.ClientSecret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err = verifier.Verify(context.Background(), issued.Token); err != nil || !slices.Equal(claims.Permissions, perms) {
+		t.Errorf("token for no requested permissions carries %v (%v), want %v", claims, err, perms)
+	}
+
+	if _, err := svc.IssueServiceToken("submission-service", account.ClientSecret, []string{"grade.read"}); !errors.Is(err, ErrPermissionNotAllowed) {
+		t.Errorf("asking for a permission off the allowlist = %v, want ErrPermissionNotAllowed", err)
+	}
+}
+
+func TestServiceTokenNeedsTheCurrentSecret(t *testing.T) {
+	svc, _ := newTokenTestService(t)
+	account, err := svc.CreateServiceAccount(ServiceAccountRequest{Name: "email-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, creds := range map[string][2]string{
+		"a wrong secret":  {"email-service", account.ClientSecret + "x"},
+		"no secret":       {"email-service", ""},
+		"an unknown name": {"grading-service", account.ClientSecret},
+	} {
+		if _, err := svc.IssueServiceToken(creds[0], creds[1], nil); !errors.Is(err, ErrInvalidServiceCredentials) {
+			t.Errorf("issuing with %s = %v, want ErrInvalidServiceCredentials", name, err)
+		}
+	}
+
+	rotated, err := svc.RotateServiceAccountSecret("email-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.IssueServiceToken("email-service", account.ClientSecret, nil); !errors.Is(err, ErrInvalidServiceCredentials) {
+		t.Errorf("issuing with the secret rotated out = %v, want ErrInvalidServiceCredentials", err)
+	}
+	if _, err := svc.IssueServiceToken("email-service", rotated.ClientSecret, nil); err != nil {
+		t.Errorf("issuing with the new secret = %v", err)
+	}
+}
+
+func TestDisabledServiceAccountGetsNoToken(t *testing.T) {
+	svc, verifier := newTokenTestService(t)
+	account, err := svc.CreateServiceAccount(ServiceAccountRequest{Name: "email-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := svc.IssueServiceToken("email-service", account.ClientSecret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disabled := false
+	if _, err := svc.UpdateServiceAccount("email-service", ServiceAccountRequest{Active: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.IssueServiceToken("email-service", account.ClientSecret, nil); !errors.Is(err, ErrServiceAccountDisabled) {
+		t.Fatalf("issuing for a disabled account = %v, want ErrServiceAccountDisabled", err)
+	}
+	// A token issued before stays good until it expires
+	if _, err := verifier.Verify(context.Background(), issued.Token); err != nil {
+		t.Errorf("token issued before disabling = %v, want it still valid", err)
+	}
+
+	// Accounts can also start out disabled
+	report, err := svc.CreateServiceAccount(ServiceAccountRequest{Name: "report-service", Active: &disabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.IssueServiceToken("report-service", report.ClientSecret, nil); !errors.Is(err, ErrServiceAccountDisabled) {
+		t.Errorf("issuing for an account created disabled = %v, want ErrServiceAccountDisabled", err)
+	}
+}
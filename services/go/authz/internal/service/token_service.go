@@ -1,35 +1,67 @@
 package service
 
 import (
-	"os"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"log"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/4yrg/gradeloop-core/libs/servicetoken"
 )
 
+// DefaultServiceTokenTTL is how long service tokens last unless configured.
+// It is kept short as tokens cannot be revoked one by one: disabling an
+// account only stops it getting new ones.
+const DefaultServiceTokenTTL = 15 * time.Minute
+
+// ServiceTokenService signs service tokens with the authz RSA key
 type ServiceTokenService struct {
-	jwtSecret []byte
+	signer *servicetoken.Signer
+	ttl    time.Duration
 }
 
-func NewServiceTokenService() *ServiceTokenService {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "insecure-jwt-secret-for-dev"
+// NewServiceTokenService loads the signing key from privateKey, PEM contents
+// or a path to a PEM file. Tokens expire after ttl.
+func NewServiceTokenService(privateKey string, ttl time.Duration) (*ServiceTokenService, error) {
+	var key *rsa.PrivateKey
+	if privateKey == "" {
+		// Fine for a single dev instance; every restart invalidates all
+		// service tokens and replicas would not accept each other's tokens
+		log.Println("Warning: SERVICE_TOKEN_PRIVATE_KEY is not set, generating an ephemeral signing key")
+		generated, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key = generated
+	} else {
+		loaded, err := servicetoken.LoadPrivateKey(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("SERVICE_TOKEN_PRIVATE_KEY: %w", err)
+		}
+		key = loaded
 	}
-	return &ServiceTokenService{
-		jwtSecret: []byte(secret),
+	if ttl <= 0 {
+		ttl = DefaultServiceTokenTTL
 	}
+	return &ServiceTokenService{signer: servicetoken.NewSigner(key), ttl: ttl}, nil
 }
 
-// GenerateServiceToken creates a long-lived JWT for service-to-service authentication
-func (s *ServiceTokenService) GenerateServiceToken(serviceName string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub":  serviceName,
-		"type": "service",
-		"iat":  time.Now().Unix(),
-		"exp":  time.Now().Add(365 * 24 * time.Hour).Unix(), // 1 year expiration
-	}
+// GenerateServiceToken signs a token for the service account carrying the
+// given permissions and returns it with its expiry
+func (s *ServiceTokenService) GenerateServiceToken(serviceName string, permissions []string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(s.ttl).Truncate(time.Second)
+	token, err := s.signer.Sign(serviceName, permissions, expiresAt)
+	return token, expiresAt, err
+}
+
+// JWKS returns the public keys service tokens are verified against
+func (s *ServiceTokenService) JWKS() servicetoken.JWKS {
+	return s.signer.JWKS()
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtSecret)
+// VerifyServiceToken checks a token this service signed, sent back to authz
+// itself by a caller of its admin API
+func (s *ServiceTokenService) VerifyServiceToken(tokenString string) (*servicetoken.Claims, error) {
+	return s.signer.Verify(tokenString)
 }
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/core/domain"
+	"github.com/google/uuid"
+)
+
+func TestDirectGrantsAddToRolePermissions(t *testing.T) {
+	svc, db := newTestService(t)
+	createPermissions(t, svc, "user.read", "grade.read", "grade.update", "grade.delete")
+	if err := svc.CreateRole("ta", domain.ScopeInstitute, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.AssignPermission("ta", "user.read"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreatePolicy("ta", "grade.delete", domain.EffectDeny); err != nil {
+		t.Fatal(err)
+	}
+
+	user := uuid.NewString()
+	if _, err := svc.GrantUserPermission(user, "grade.read", "", nil, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GrantUserPermission(user, "grade.update", "course:1", nil, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	// A grant cannot lift a deny of the role
+	if _, err := svc.GrantUserPermission(user, "grade.delete", "", nil, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	// Expired grants are ignored; back-date one past its expiry
+	expired, err := svc.GrantUserPermission(user, "grade.update", "course:2", timePtr(time.Now().Add(time.Hour)), "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&domain.UserPermission{}).Where("id = ?", expired.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		subject, resource, action, scope string
+		want                             bool
+	}{
+		{user, "user", "read", "", true},
+		{user, "grade", "read", "", true},
+		{user, "grade", "update", "course:1", true},
+		{user, "grade", "update", "", false},
+		{user, "grade", "update", "course:3", false},
+		{user, "grade", "update", "course:2", false},
+		{user, "grade", "delete", "", false},
+		{uuid.NewString(), "grade", "read", "", false},
+		{"submission-service", "grade", "read", "", false},
+	} {
+		allowed, err := svc.CheckPermission(c.subject, "ta", c.resource, c.action, c.scope, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != c.want {
+			t.Errorf("%s.%s in scope %q: got %v, want %v", c.resource, c.action, c.scope, allowed, c.want)
+		}
+	}
+
+	resolved, err := svc.ResolvePermissions(user, "ta", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]ResolvedPermission{}
+	for _, p := range resolved.Sources {
+		sources[p.Name+"@"+p.Scope] = p
+	}
+	if len(resolved.Permissions) != 2 {
+		t.Errorf("unscoped permissions = %v, want user.read and grade.read", resolved.Permissions)
+	}
+	if sources["user.read@"].Source != SourceRole || sources["grade.read@"].Source != SourceDirect {
+		t.Errorf("sources = %+v, want user.read from the role and grade.read direct", resolved.Sources)
+	}
+	if _, ok := sources["grade.update@course:1"]; !ok {
+		t.Errorf("scoped grant missing from sources: %+v", resolved.Sources)
+	}
+	if _, ok := sources["grade.update@course:2"]; ok {
+		t.Errorf("expired grant reported: %+v", resolved.Sources)
+	}
+
+	if revoked, err := svc.RevokeUserPermission(user, "grade.read", ""); err != nil || !revoked {
+		t.Fatalf("revoke = %v, %v", revoked, err)
+	}
+	if allowed, _ := svc.CheckPermission(user, "ta", "grade", "read", "", nil); allowed {
+		t.Error("grade.read still allowed after its grant was revoked")
+	}
+	if n, err := svc.PurgeExpiredGrants(); err != nil || n != 1 {
+		t.Errorf("purge = %d, %v, want the one expired grant", n, err)
+	}
+}
+
+func TestGrantUserPermissionValidates(t *testing.T) {
+	svc, _ := newTestService(t)
+	createPermissions(t, svc, "grade.read")
+	user := uuid.NewString()
+
+	for name, grant := range map[string]func() error{
+		"bad user id": func() error {
+			_, err := svc.GrantUserPermission("nope", "grade.read", "", nil, "")
+			return err
+		},
+		"no permission": func() error {
+			_, err := svc.GrantUserPermission(user, "", "", nil, "")
+			return err
+		},
+		"past expiry": func() error {
+			_, err := svc.GrantUserPermission(user, "grade.read", "", timePtr(time.Now().Add(-time.Hour)), "")
+			return err
+		},
+	} {
+		if err := grant(); !errors.Is(err, ErrInvalidGrant) {
+			t.Errorf("%s: got %v, want ErrInvalidGrant", name, err)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time { return &t }
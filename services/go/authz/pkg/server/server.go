@@ -0,0 +1,64 @@
+// Package server builds the authz service the way cmd/server runs it, short
+// of opening its database or listening, so that tests can serve it
+// in-process on stand-ins.
+package server
+
+import (
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/request"
+	"github.com/4yrg/gradeloop-core/libs/rpc"
+	authzv1 "github.com/4yrg/gradeloop-core/libs/rpc/authz/v1"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/api"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/grpcapi"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/middleware"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/authz/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+)
+
+// Config is what the server is built from besides its database
+type Config struct {
+	// ServiceTokenPrivateKey signs service tokens, as a PEM or a file path;
+	// empty generates an ephemeral key
+	ServiceTokenPrivateKey string
+	// ServiceTokenTTL is how long a service token is valid
+	ServiceTokenTTL time.Duration
+	// Verifier checks the user access tokens the admin routes accept
+	Verifier *jwtauth.Verifier
+}
+
+// Server is the HTTP and gRPC APIs and the service they share
+type Server struct {
+	// App serves every HTTP route
+	App *fiber.App
+	// GRPC serves the gRPC API, checking the internal token
+	GRPC *grpc.Server
+	// Service is what both APIs call; its Init migrates the schema
+	Service *service.AuthZService
+}
+
+// New builds the server from cfg on db
+func New(cfg Config, db *gorm.DB) (*Server, error) {
+	tokenSvc, err := service.NewServiceTokenService(cfg.ServiceTokenPrivateKey, cfg.ServiceTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	svc := service.NewAuthZService(repository.NewAuthZRepository(db), tokenSvc)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler, BodyLimit: request.DefaultBodyLimit})
+	app.Use(logger.New())
+	api.NewAuthZHandler(svc).RegisterRoutes(app, middleware.NewAdmin(svc, cfg.Verifier))
+	app.Get("/debug/db", database.StatsHandler(db))
+
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(rpc.RequireInternalToken(middleware.InternalSecret())))
+	authzv1.RegisterAuthorizationServiceServer(grpcServer, grpcapi.NewServer(svc))
+
+	return &Server{App: app, GRPC: grpcServer, Service: svc}, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestServerServesWithoutMain(t *testing.T) {
+	t.Setenv("INTERNAL_SECRET", "insecure-secret-for-dev")
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	srv, err := New(Config{ServiceTokenTTL: time.Minute, Verifier: jwtauth.NewVerifier(jwtauth.Config{JWKSURL: "http://127.0.0.1:0"})}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Service.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := srv.App.Test(httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET /.well-known/jwks.json = %d, want 200", resp.StatusCode)
+	}
+
+	req := httptest.NewRequest("POST", "/internal/authz/check", strings.NewReader(`{"subject":"user-1","role":"STUDENT","resource":"assignment","action":"delete"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", "insecure-secret-for-dev")
+	resp, err = srv.App.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var check struct {
+		Allowed *bool `json:"allowed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&check); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || check.Allowed == nil || *check.Allowed {
+		t.Fatalf("POST /internal/authz/check = %d, allowed %v; want 200 and a denial", resp.StatusCode, check.Allowed)
+	}
+}
@@ -1,35 +1,56 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/libs/config"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/debugserver"
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+	"github.com/4yrg/gradeloop-core/libs/request"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/api"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/branding"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/digest"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/queue"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/ratelimit"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/service"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/service/provider"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/webhook"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/worker"
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 func main() {
-	// 0. Load .env
-	_ = godotenv.Load(".env", "../.env", "../../.env", "../../../.env", "../../../../.env", "../../../../../.env")
+	// 0. Load the nearest .env files, without overriding the real environment
+	if files := config.DotEnvFiles(); len(files) > 0 {
+		_ = godotenv.Load(files...)
+	}
 
 	// 1. Load Config
 	cfg, err := core.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	for _, line := range config.Dump(cfg) {
+		log.Printf("config: %s", line)
+	}
 
 	// 2. Setup Database
-	if cfg.DatabaseURL == "" {
-		log.Fatal("EMAIL_DATABASE_URL must be set")
+	poolCfg, err := database.LoadPoolConfig("EMAIL")
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
 	}
-
-	db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
+	db, err := database.Open(postgres.Open(cfg.DatabaseURL), poolCfg)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -44,12 +65,78 @@ func main() {
 	// 3. Setup Services
 	emailProvider := provider.NewSMTPProvider(cfg)
 	templateSvc := service.NewTemplateService(repo)
-	emailSvc := service.NewEmailService(emailProvider, templateSvc, repo)
+	emailQueue := queue.NewDatabaseQueue(repo, cfg.QueuePollInterval, cfg.QueueLease)
+	emailSvc := service.NewEmailService(emailProvider, templateSvc, repo, emailQueue, service.NewScrubber(cfg.LogRedactKeys),
+		service.NewUnsubscribeTokens(cfg.UnsubscribeSecret), cfg.UnsubscribeURL,
+		branding.NewResolver(clients.NewIdentity(clients.Config{BaseURL: cfg.IdentityServiceURL, InternalToken: cfg.InternalToken}), cfg.BrandingCacheTTL))
+	digestSvc := service.NewDigestService(repo, emailSvc, map[string]core.DigestProvider{
+		digest.TypePendingItems: digest.NewPendingItems(
+			clients.Config{BaseURL: cfg.AssignmentServiceURL, InternalToken: cfg.InternalToken},
+			clients.Config{BaseURL: cfg.SubmissionServiceURL, InternalToken: cfg.InternalToken},
+		),
+	}, cfg.DigestConcurrency, cfg.DigestBuildTimeout)
+
+	webhookSources := map[string]core.WebhookSource{}
+	if cfg.SendGridWebhookKey != "" {
+		sendGrid, err := webhook.NewSendGrid(cfg.SendGridWebhookKey)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		webhookSources["sendgrid"] = sendGrid
+	}
+	if cfg.SESTopicARN != "" {
+		webhookSources["ses"] = webhook.NewSES(cfg.SESTopicARN)
+	}
+	webhookSvc := service.NewWebhookService(repo, webhookSources)
+
+	// 3.1 Start Worker Pool
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Pace sends per recipient domain. Without Redis the email is sent rather
+	// than held up, so it is not needed at startup.
+	var limiter worker.Limiter
+	overrides, _ := cfg.DomainRateOverrides()
+	if cfg.DomainRateLimit > 0 || len(overrides) > 0 {
+		rdb, err := redisfactory.New(cfg.Redis)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		limiter = ratelimit.NewDomainLimiter(rdb, cfg.DomainRateLimit, overrides, cfg.DomainRateBurst)
+	}
+
+	emailWorker := worker.NewWorker(emailQueue, emailSvc, limiter, cfg)
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		if err := emailWorker.Start(ctx); err != nil {
+			log.Printf("Email worker stopped with error: %v", err)
+		}
+	}()
+
+	// 3.2 Purge old log payloads
+	if cfg.LogRetentionDays > 0 {
+		go worker.NewRetentionJob(repo, cfg.LogRetentionDays, cfg.LogRetentionInterval).Run(ctx)
+	}
+
+	// 3.3 Send scheduled digests
+	go worker.NewDigestJob(digestSvc, cfg.DigestInterval).Run(ctx)
+
+	// 3.4 Queue scheduled emails once they are due
+	go worker.NewSchedulerJob(emailSvc, cfg.ScheduleInterval, cfg.ScheduleClaimTimeout).Run(ctx)
 
 	// 4. Setup API
-	app := fiber.New()
-	handler := api.NewHandler(emailSvc, templateSvc)
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler, BodyLimit: request.DefaultBodyLimit})
+	handler := api.NewHandler(emailSvc, templateSvc, digestSvc, webhookSvc)
 	api.SetupRoutes(app, handler)
+	app.Get("/debug/db", database.StatsHandler(db))
+	// Profiling and runtime stats on DEBUG_ADDR, off unless it is set
+	if err := debugserver.Start(
+		debugserver.Var{Name: "db_pool", Value: database.StatsFunc(db)},
+		debugserver.Var{Name: "email_deferred_by_domain", Value: func() any { return emailWorker.Deferred() }},
+	); err != nil {
+		log.Fatal(err)
+	}
 
 	// 5. Start Server
 	log.Printf("Starting Email Service on port 5005 (HTTP)...") // Port from requirements?
@@ -58,7 +145,18 @@ func main() {
 	// or reusing 50053 for HTTP since gRPC is avoided.
 	// I'll stick to :8080 generally or 3000 (fiber default) but since it's a microservice, maybe 50053 is intended for the service port regardless of protocol.
 	// I'll use :50053 for now to match the "PORT" concept in .env even if it says GRPC.
-	if err := app.Listen(":5005"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		if err := app.Listen(":5005"); err != nil {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// 6. Graceful Shutdown
+	<-ctx.Done()
+	log.Println("Shutting down Email Service...")
+	if err := app.Shutdown(); err != nil {
+		log.Printf("Failed to shut down server: %v", err)
 	}
+	<-workerDone
+	emailProvider.Close()
 }
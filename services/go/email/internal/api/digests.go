@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) CreateDigest(c *fiber.Ctx) error {
+	var req service.DigestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	sub, err := h.digestSvc.CreateSubscription(req)
+	if err != nil {
+		return digestError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(sub)
+}
+
+func (h *Handler) ListDigests(c *fiber.Ctx) error {
+	subs, err := h.digestSvc.ListSubscriptions(c.Query("user_id"))
+	if err != nil {
+		return digestError(c, err)
+	}
+	return c.JSON(subs)
+}
+
+func (h *Handler) GetDigest(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid digest id"})
+	}
+	sub, err := h.digestSvc.GetSubscription(uint(id))
+	if err != nil {
+		return digestError(c, err)
+	}
+	return c.JSON(sub)
+}
+
+func (h *Handler) UpdateDigest(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid digest id"})
+	}
+	var req service.DigestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	sub, err := h.digestSvc.UpdateSubscription(uint(id), req)
+	if err != nil {
+		return digestError(c, err)
+	}
+	return c.JSON(sub)
+}
+
+func (h *Handler) DeleteDigest(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid digest id"})
+	}
+	if err := h.digestSvc.DeleteSubscription(uint(id)); err != nil {
+		return digestError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) GetDigestOptOut(c *fiber.Ctx) error {
+	optedOut, err := h.digestSvc.OptedOut(c.Params("userId"))
+	if err != nil {
+		return digestError(c, err)
+	}
+	return c.JSON(fiber.Map{"user_id": c.Params("userId"), "opted_out": optedOut})
+}
+
+func (h *Handler) OptOutOfDigests(c *fiber.Ctx) error {
+	if err := h.digestSvc.SetOptOut(c.Params("userId"), true); err != nil {
+		return digestError(c, err)
+	}
+	return c.JSON(fiber.Map{"user_id": c.Params("userId"), "opted_out": true})
+}
+
+func (h *Handler) OptInToDigests(c *fiber.Ctx) error {
+	if err := h.digestSvc.SetOptOut(c.Params("userId"), false); err != nil {
+		return digestError(c, err)
+	}
+	return c.JSON(fiber.Map{"user_id": c.Params("userId"), "opted_out": false})
+}
+
+func digestError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidDigest):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, core.ErrDigestNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, core.ErrDigestExists):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+}
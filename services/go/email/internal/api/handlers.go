@@ -1,28 +1,81 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/service"
 	"github.com/gofiber/fiber/v2"
 )
 
 type Handler struct {
-	emailSvc *service.EmailService
-	tmplSvc  *service.TemplateService
+	emailSvc   *service.EmailService
+	tmplSvc    *service.TemplateService
+	digestSvc  *service.DigestService
+	webhookSvc *service.WebhookService
 }
 
-func NewHandler(emailSvc *service.EmailService, tmplSvc *service.TemplateService) *Handler {
+func NewHandler(emailSvc *service.EmailService, tmplSvc *service.TemplateService, digestSvc *service.DigestService, webhookSvc *service.WebhookService) *Handler {
 	return &Handler{
-		emailSvc: emailSvc,
-		tmplSvc:  tmplSvc,
+		emailSvc:   emailSvc,
+		tmplSvc:    tmplSvc,
+		digestSvc:  digestSvc,
+		webhookSvc: webhookSvc,
 	}
 }
 
+// SendRequest queues a templated email for recipient, or for each of
+// recipients. Only one of the two may be set.
 type SendRequest struct {
-	TemplateName string                 `json:"template_name"`
-	Recipient    string                 `json:"recipient"`
-	Data         map[string]interface{} `json:"data"`
+	TemplateName string                   `json:"template_name"`
+	Recipient    string                   `json:"recipient"`
+	Recipients   []service.BatchRecipient `json:"recipients"`
+	Category     core.Category            `json:"category"` // defaults to transactional
+	// Locale is the recipient's preferred locale and DefaultLocale their
+	// institute's; templates fall back from one to the other and then to
+	// the base locale
+	Locale        string `json:"locale"`
+	DefaultLocale string `json:"default_locale"`
+	// InstituteID brands the email with the institute's logo and footer
+	InstituteID string                 `json:"institute_id"`
+	Data        map[string]interface{} `json:"data"` // shared by all recipients
+	// SendAt schedules the email; it must be an RFC 3339 timestamp with a
+	// time zone
+	SendAt string `json:"send_at"`
+}
+
+// sendAt parses SendAt into UTC, or returns nil if it is not set.
+// Timestamps without a time zone are refused rather than guessed at.
+func (r SendRequest) sendAt() (*time.Time, error) {
+	if r.SendAt == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, r.SendAt)
+	if err != nil {
+		return nil, errors.New("send_at must be an RFC 3339 timestamp with a time zone, e.g. 2026-10-17T08:00:00Z")
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// job is the request as a queued email, without its recipient
+func (r SendRequest) job() core.EmailJob {
+	return core.EmailJob{
+		TemplateName:  r.TemplateName,
+		Category:      r.Category,
+		Locale:        r.Locale,
+		DefaultLocale: r.DefaultLocale,
+		InstituteID:   r.InstituteID,
+		Data:          r.Data,
+	}
 }
 
 func (h *Handler) SendTemplateEmail(c *fiber.Ctx) error {
@@ -31,15 +84,60 @@ func (h *Handler) SendTemplateEmail(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	if req.TemplateName == "" || req.Recipient == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "template_name and recipient are required"})
+	if req.TemplateName == "" || (req.Recipient == "") == (len(req.Recipients) == 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "template_name and either recipient or recipients are required"})
+	}
+	if len(req.Recipients) > service.MaxBatchRecipients {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("at most %d recipients per request", service.MaxBatchRecipients)})
+	}
+	if req.Category == "" {
+		req.Category = core.CategoryTransactional
+	}
+	if !req.Category.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "category must be transactional, notification or marketing"})
+	}
+	sendAt, err := req.sendAt()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if err := h.emailSvc.SendEmail(req.TemplateName, req.Recipient, req.Data); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if len(req.Recipients) > 0 {
+		return h.sendBatch(c, req, sendAt)
 	}
 
-	return c.JSON(fiber.Map{"status": "queued"})
+	if err := service.ValidateRecipient(req.Recipient); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	job := req.job()
+	job.Recipient = strings.TrimSpace(req.Recipient)
+	scheduled, err := h.emailSvc.Dispatch(job, sendAt)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+	if scheduled != nil {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "scheduled", "log_id": scheduled.ID, "send_at": scheduled.SendAt})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "queued"})
+}
+
+// sendBatch answers 202 with a result per recipient if any were queued or
+// scheduled. If none were it answers 400 when every address was invalid,
+// else 503.
+func (h *Handler) sendBatch(c *fiber.Ctx, req SendRequest, sendAt *time.Time) error {
+	results := h.emailSvc.QueueBatch(req.job(), req.Recipients, sendAt)
+
+	status := fiber.StatusBadRequest
+	for _, r := range results {
+		if r.Status != service.RecipientFailed {
+			status = fiber.StatusAccepted
+			break
+		}
+		if !errors.Is(r.Err(), service.ErrInvalidRecipient) {
+			status = fiber.StatusServiceUnavailable
+		}
+	}
+	return c.Status(status).JSON(fiber.Map{"results": results})
 }
 
 func (h *Handler) SendRawEmail(c *fiber.Ctx) error {
@@ -62,9 +160,11 @@ func (h *Handler) SendRawEmail(c *fiber.Ctx) error {
 
 func (h *Handler) CreateTemplate(c *fiber.Ctx) error {
 	var req struct {
-		Name     string `json:"name"`
-		Subject  string `json:"subject"`
-		HTMLBody string `json:"html_body"`
+		Name      string `json:"name"`
+		Locale    string `json:"locale"` // the base locale when empty
+		Subject   string `json:"subject"`
+		HTMLBody  string `json:"html_body"`
+		CreatedBy string `json:"created_by"`
 	}
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
@@ -74,21 +174,181 @@ func (h *Handler) CreateTemplate(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name, subject, and html_body are required"})
 	}
 
-	if err := h.tmplSvc.CreateTemplate(req.Name, req.Subject, req.HTMLBody); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	template, err := h.tmplSvc.CreateTemplate(req.Name, req.Locale, req.Subject, req.HTMLBody, req.CreatedBy)
+	if err != nil {
+		return templateError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(template)
+}
+
+func (h *Handler) ListTemplateLocales(c *fiber.Ctx) error {
+	templates, err := h.tmplSvc.ListLocales(c.Params("name"))
+	if err != nil {
+		return templateError(c, err)
+	}
+	return c.JSON(templates)
+}
+
+// CopyTemplateLocale starts a translation of a template from the active
+// version of another locale
+func (h *Handler) CopyTemplateLocale(c *fiber.Ctx) error {
+	var req struct {
+		From      string `json:"from"` // the base locale when empty
+		Locale    string `json:"locale"`
+		CreatedBy string `json:"created_by"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Locale == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "locale is required"})
+	}
+
+	template, err := h.tmplSvc.CopyLocale(c.Params("name"), req.From, req.Locale, req.CreatedBy)
+	if err != nil {
+		return templateError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(template)
+}
+
+func (h *Handler) ListTemplateVersions(c *fiber.Ctx) error {
+	versions, err := h.tmplSvc.ListVersions(c.Params("name"), c.Query("locale"))
+	if err != nil {
+		return templateError(c, err)
+	}
+	return c.JSON(versions)
+}
+
+func (h *Handler) ActivateTemplateVersion(c *fiber.Ctx) error {
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil || version < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid version"})
+	}
+
+	template, err := h.tmplSvc.ActivateVersion(c.Params("name"), c.Query("locale"), version)
+	if err != nil {
+		return templateError(c, err)
+	}
+	return c.JSON(template)
+}
+
+func (h *Handler) DeleteTemplate(c *fiber.Ctx) error {
+	if err := h.tmplSvc.DeleteTemplate(c.Params("name"), c.Query("locale")); err != nil {
+		return templateError(c, err)
 	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
 
-	return c.SendStatus(fiber.StatusCreated)
+func templateError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, core.ErrTemplateNotFound) || errors.Is(err, core.ErrTemplateVersionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, core.ErrTemplateLocaleExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTemplate) || errors.Is(err, service.ErrInvalidLocale):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrTemplateVariables):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 }
 
+// GetLogs returns a page of the request logs matching the filters in the
+// query, or with ?summary=true how many match by status
 func (h *Handler) GetLogs(c *fiber.Ctx) error {
-	logs, err := h.emailSvc.GetLogs()
+	return h.listLogs(c, repository.LogFilter{Recipient: c.Query("recipient")})
+}
+
+// GetRecipientHistory is GetLogs for every email to one address
+func (h *Handler) GetRecipientHistory(c *fiber.Ctx) error {
+	email, err := url.PathUnescape(c.Params("email"))
+	if err != nil || strings.TrimSpace(email) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid email"})
+	}
+	return h.listLogs(c, repository.LogFilter{Recipient: strings.TrimSpace(email)})
+}
+
+// listLogs answers with the logs matching filter narrowed by the query's
+// filters: status, recipient_domain, template_name, q over error messages,
+// and created_at from (inclusive) and to (exclusive), both RFC 3339
+func (h *Handler) listLogs(c *fiber.Ctx, filter repository.LogFilter) error {
+	filter.Status = core.RequestStatus(c.Query("status"))
+	if filter.Status != "" && !filter.Status.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid status"})
+	}
+	filter.RecipientDomain = strings.TrimPrefix(strings.TrimSpace(c.Query("recipient_domain")), "@")
+	filter.TemplateName = c.Query("template_name")
+	filter.ErrorText = strings.TrimSpace(c.Query("q"))
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if raw := c.Query(name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": name + " must be an RFC 3339 timestamp"})
+			}
+			*t = parsed
+		}
+	}
+
+	if c.QueryBool("summary") {
+		summary, err := h.emailSvc.SummarizeLogs(filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(summary)
+	}
+
+	page, err := pagination.Parse(c.Query("cursor"), c.Query("offset"), c.Query("limit"), 100, 500)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	logs, err := h.emailSvc.GetLogs(filter, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(logs)
 }
 
+func (h *Handler) GetLog(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid log id"})
+	}
+
+	reqLog, err := h.emailSvc.GetLog(uint(id))
+	if errors.Is(err, core.ErrEmailLogNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(reqLog)
+}
+
+// CancelScheduledEmail cancels a scheduled email before the scheduler
+// queues it, answering 409 once it has been
+func (h *Handler) CancelScheduledEmail(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid log id"})
+	}
+
+	err = h.emailSvc.CancelScheduled(uint(id))
+	if errors.Is(err, core.ErrEmailLogNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, core.ErrEmailNotScheduled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 func (h *Handler) ListTemplates(c *fiber.Ctx) error {
 	templates, err := h.tmplSvc.ListTemplates()
 	if err != nil {
@@ -103,9 +363,57 @@ func (h *Handler) GetTemplate(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "template name required"})
 	}
 
-	template, err := h.tmplSvc.GetTemplate(name)
+	// With ?locale= this is the template that mail in that locale would use
+	template, err := h.tmplSvc.GetTemplate(name, c.Query("locale"))
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "template not found"})
 	}
 	return c.JSON(template)
 }
+
+// Unsubscribe is the public target of the link in non-transactional mail.
+// It answers with a short page since it is opened in a browser.
+func (h *Handler) Unsubscribe(c *fiber.Ctx) error {
+	category, err := h.emailSvc.Unsubscribe(c.Query("token"))
+	if errors.Is(err, service.ErrInvalidUnsubscribeToken) {
+		c.Type("html")
+		return c.Status(fiber.StatusBadRequest).SendString("<p>This unsubscribe link is invalid.</p>")
+	}
+	if err != nil {
+		log.Printf("[Email Handler] Failed to unsubscribe: %v", err)
+		c.Type("html")
+		return c.Status(fiber.StatusInternalServerError).SendString("<p>Something went wrong, please try again later.</p>")
+	}
+
+	c.Type("html")
+	return c.SendString("<p>You will no longer receive " + string(category) + " emails from GradeLoop.</p>")
+}
+
+func (h *Handler) ListSuppressions(c *fiber.Ctx) error {
+	category := core.Category(c.Query("category"))
+	if category != "" && !category.Valid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid category"})
+	}
+
+	suppressions, err := h.emailSvc.ListSuppressions(c.Query("email"), category)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(suppressions)
+}
+
+func (h *Handler) DeleteSuppression(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid suppression id"})
+	}
+
+	err = h.emailSvc.RemoveSuppression(uint(id))
+	if errors.Is(err, core.ErrSuppressionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
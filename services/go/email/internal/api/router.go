@@ -6,6 +6,14 @@ import (
 )
 
 func SetupRoutes(app *fiber.App, h *Handler) {
+	// Public: opened from the link in non-transactional mail, authorised by
+	// the signed token alone
+	app.Get("/email/unsubscribe", h.Unsubscribe)
+	// Called by the mail provider, which cannot send the internal token;
+	// authorised by the provider's signature instead. Registered before the
+	// group so its middleware is not reached.
+	app.Post("/internal/email/webhooks/:provider", h.DeliveryWebhook)
+
 	// Apply internal auth middleware to all internal endpoints
 	api := app.Group("/internal/email", middleware.InternalAuth())
 
@@ -14,5 +22,25 @@ func SetupRoutes(app *fiber.App, h *Handler) {
 	api.Post("/templates", h.CreateTemplate)
 	api.Get("/templates", h.ListTemplates)
 	api.Get("/templates/:name", h.GetTemplate) // Added missing endpoint
+	api.Delete("/templates/:name", h.DeleteTemplate)
+	api.Get("/templates/:name/locales", h.ListTemplateLocales)
+	api.Post("/templates/:name/locales", h.CopyTemplateLocale)
+	api.Get("/templates/:name/versions", h.ListTemplateVersions)
+	api.Post("/templates/:name/versions/:version/activate", h.ActivateTemplateVersion)
 	api.Get("/logs", h.GetLogs)
+	api.Get("/logs/:id", h.GetLog)
+	api.Delete("/logs/:id", h.CancelScheduledEmail)
+	api.Get("/logs/:id/events", h.GetLogEvents)
+	api.Get("/recipients/:email/history", h.GetRecipientHistory)
+	api.Get("/suppressions", h.ListSuppressions)
+	api.Delete("/suppressions/:id", h.DeleteSuppression)
+
+	api.Post("/digests", h.CreateDigest)
+	api.Get("/digests", h.ListDigests)
+	api.Get("/digests/:id", h.GetDigest)
+	api.Patch("/digests/:id", h.UpdateDigest)
+	api.Delete("/digests/:id", h.DeleteDigest)
+	api.Get("/digests/users/:userId/opt-out", h.GetDigestOptOut)
+	api.Post("/digests/users/:userId/opt-out", h.OptOutOfDigests)
+	api.Delete("/digests/users/:userId/opt-out", h.OptInToDigests)
 }
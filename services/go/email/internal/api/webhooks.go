@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/service"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/webhook"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeliveryWebhook receives a provider's delivery events. Providers retry on
+// any status other than 2xx, so only requests that could succeed later are
+// failed with 5xx.
+func (h *Handler) DeliveryWebhook(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+	header := func(key string) string { return c.Get(key) }
+	result, err := h.webhookSvc.HandleWebhook(c.UserContext(), provider, header, c.Body())
+	switch {
+	case errors.Is(err, service.ErrUnknownWebhook):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, webhook.ErrInvalidSignature):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, webhook.ErrInvalidPayload):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		log.Printf("[Email Handler] Failed to handle %s webhook: %v", provider, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to record delivery events"})
+	}
+	return c.JSON(result)
+}
+
+func (h *Handler) GetLogEvents(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid log id"})
+	}
+
+	events, err := h.webhookSvc.ListEvents(uint(id))
+	if errors.Is(err, core.ErrEmailLogNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(events)
+}
@@ -0,0 +1,98 @@
+// Package branding adds the branding of the recipient's institute, its logo,
+// colors and footer, to the data emails are rendered with
+package branding
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// Variable is the template variable the branding is added as, e.g.
+// {{.branding.logo_url}}. Emails without an institute, or whose institute's
+// branding cannot be had, go without it, so templates guard it with
+// {{if .branding}}.
+const Variable = "branding"
+
+// Resolver looks up the branding of a job's institute in the identity
+// service, asking at most once per TTL for each institute. A change made in
+// identity is therefore seen here within the TTL.
+type Resolver struct {
+	identity *clients.Identity
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]entry // institute ID -> its branding
+}
+
+type entry struct {
+	branding *clients.InstituteBranding // nil for an institute identity does not know
+	expiry   time.Time
+}
+
+func NewResolver(identity *clients.Identity, ttl time.Duration) *Resolver {
+	return &Resolver{
+		identity: identity,
+		ttl:      ttl,
+		entries:  make(map[string]entry),
+	}
+}
+
+// Resolve returns the branding variable for the job's institute, or nothing
+// for a job without one or an institute identity does not know
+func (r *Resolver) Resolve(ctx context.Context, job core.EmailJob) (map[string]interface{}, error) {
+	if job.InstituteID == "" {
+		return nil, nil
+	}
+	branding, err := r.branding(ctx, job.InstituteID)
+	if err != nil || branding == nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		Variable: map[string]interface{}{
+			"logo_url":        branding.LogoURL,
+			"primary_color":   branding.PrimaryColor,
+			"secondary_color": branding.SecondaryColor,
+			// Identity sanitizes the footer when it is saved
+			"email_footer_html": template.HTML(branding.EmailFooterHTML),
+			"support_email":     branding.SupportEmail,
+		},
+	}, nil
+}
+
+// branding returns the institute's branding, from the cache while it is
+// fresh. When identity cannot be asked, the branding fetched last is kept
+// for another TTL; the error is only returned if there is none.
+func (r *Resolver) branding(ctx context.Context, instituteID string) (*clients.InstituteBranding, error) {
+	now := time.Now()
+
+	r.mu.Lock()
+	cached, ok := r.entries[instituteID]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expiry) {
+		return cached.branding, nil
+	}
+
+	branding, err := r.identity.GetInstituteBranding(ctx, instituteID)
+	if clients.StatusCode(err) == http.StatusNotFound {
+		// Remembered too, so emails to a deleted institute's members do not
+		// each ask again
+		branding, err = nil, nil
+	}
+	if err != nil {
+		if !ok {
+			return nil, err
+		}
+		branding = cached.branding
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[instituteID] = entry{branding: branding, expiry: now.Add(r.ttl)}
+	return branding, nil
+}
@@ -2,40 +2,127 @@ package core
 
 import (
 	"fmt"
-	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/config"
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
 )
 
 type Config struct {
-	DatabaseURL  string
-	DatabaseName string
-	SMTPHost     string
-	SMTPPort     int
-	SMTPUsername string
-	SMTPPassword string
-	SMTPFrom     string
+	DatabaseURL  string `env:"EMAIL_DATABASE_URL" required:"true"`
+	DatabaseName string `env:"EMAIL_DB_NAME" default:"email_db"`
+	SMTPHost     string `env:"SMTP_HOST" default:"localhost"`
+	SMTPPort     int    `env:"SMTP_PORT" default:"587" min:"1"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD" secret:"true"`
+	SMTPFrom     string `env:"SMTP_FROM" default:"no-reply@example.com"`
+
+	// Worker pool settings for the async send queue
+	WorkerConcurrency     int           `env:"EMAIL_WORKER_CONCURRENCY" default:"5" min:"1"`
+	WorkerPrefetch        int           `env:"EMAIL_WORKER_PREFETCH" default:"1" min:"1"`
+	WorkerShutdownTimeout time.Duration `env:"EMAIL_WORKER_SHUTDOWN_TIMEOUT" default:"30s" min:"0s"`
+	QueuePollInterval     time.Duration `env:"EMAIL_QUEUE_POLL_INTERVAL" default:"1s"` // how often idle consumers look for queued emails
+	QueueLease            time.Duration `env:"EMAIL_QUEUE_LEASE" default:"5m"`         // a send unsettled after this is delivered again
+
+	// Sends are paced per recipient domain so providers such as Office365 do
+	// not throttle us. The budgets are kept in Redis and shared by every
+	// replica; see libs/redisfactory for Sentinel, Cluster and TLS.
+	Redis            redisfactory.Config
+	DomainRateLimit  int      `env:"EMAIL_DOMAIN_RATE_LIMIT" default:"600" min:"0"` // messages a minute per domain; 0 turns pacing off
+	DomainRateLimits []string `env:"EMAIL_DOMAIN_RATE_LIMITS"`                      // per-domain overrides, e.g. outlook.com=120
+	DomainRateBurst  int      `env:"EMAIL_DOMAIN_RATE_BURST" default:"20" min:"1"`  // messages a domain may get at once
+
+	// SMTP connections are reused for consecutive messages
+	SMTPMaxMessagesPerConn int           `env:"SMTP_MAX_MESSAGES_PER_CONN" default:"100" min:"1"` // a connection is closed after this many messages
+	SMTPIdleTimeout        time.Duration `env:"SMTP_IDLE_TIMEOUT" default:"30s" min:"0s"`         // idle connections older than this are closed; 0 dials for every message
+
+	// Request log privacy settings
+	LogRedactKeys        []string      `env:"EMAIL_LOG_REDACT_KEYS" default:"password,temp_password,token"` // payload keys whose values are replaced before the log is stored
+	LogRetentionDays     int           `env:"EMAIL_LOG_RETENTION_DAYS" default:"30" min:"0"`                // payloads older than this are purged; 0 keeps them forever
+	LogRetentionInterval time.Duration `env:"EMAIL_LOG_RETENTION_INTERVAL" default:"1h"`                    // how often the purge job runs
+
+	// Unsubscribe links for non-transactional mail
+	UnsubscribeSecret string `env:"EMAIL_UNSUBSCRIBE_SECRET" required:"true" secret:"true"`                  // signs unsubscribe tokens
+	UnsubscribeURL    string `env:"EMAIL_UNSUBSCRIBE_URL" default:"http://localhost:8000/email/unsubscribe"` // public link the token is appended to
+
+	// Scheduled digests
+	DigestInterval     time.Duration `env:"EMAIL_DIGEST_INTERVAL" default:"1m"`           // how often due digests are looked for
+	DigestConcurrency  int           `env:"EMAIL_DIGEST_CONCURRENCY" default:"4" min:"1"` // digests built at once
+	DigestBuildTimeout time.Duration `env:"EMAIL_DIGEST_BUILD_TIMEOUT" default:"30s"`     // time one digest's content may take
+	InternalToken      string        `env:"INTERNAL_SECRET" default:"insecure-secret-for-dev" secret:"true"`
+
+	// Scheduled sends
+	ScheduleInterval     time.Duration `env:"EMAIL_SCHEDULE_INTERVAL" default:"15s"`      // how often due scheduled emails are looked for
+	ScheduleClaimTimeout time.Duration `env:"EMAIL_SCHEDULE_CLAIM_TIMEOUT" default:"30m"` // a claimed email still unsent after this is claimed again
+
+	// Delivery webhooks; a provider's webhook is only accepted when it is configured
+	SendGridWebhookKey string `env:"EMAIL_SENDGRID_WEBHOOK_KEY"` // verification key of SendGrid's signed Event Webhook
+	SESTopicARN        string `env:"EMAIL_SES_TOPIC_ARN"`        // SNS topic SES publishes notifications to
+
+	// Services the pending items digest reads from
+	AssignmentServiceURL string `env:"ASSIGNMENT_SERVICE_URL" default:"http://localhost:8005"`
+	SubmissionServiceURL string `env:"SUBMISSION_SERVICE_URL" default:"http://localhost:8006"`
+
+	// Institute branding, looked up in identity for emails sent to an institute's members
+	IdentityServiceURL string        `env:"IDENTITY_SERVICE_URL" default:"http://localhost:8001"`
+	BrandingCacheTTL   time.Duration `env:"EMAIL_BRANDING_CACHE_TTL" default:"5m" min:"1s"` // how long an institute's branding is reused
 }
 
+// LoadConfig reads the config from the environment, reporting every missing
+// or invalid variable at once
 func LoadConfig() (*Config, error) {
-	port, err := strconv.Atoi(getEnv("SMTP_PORT", "587"))
-	if err != nil {
-		return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
-	}
-
-	return &Config{
-		DatabaseURL:  getEnv("EMAIL_DATABASE_URL", ""),
-		DatabaseName: getEnv("EMAIL_DB_NAME", "email_db"),
-		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
-		SMTPPort:     port,
-		SMTPUsername: getEnv("SMTP_USERNAME", ""),
-		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
-		SMTPFrom:     getEnv("SMTP_FROM", "no-reply@example.com"),
-	}, nil
+	cfg := &Config{}
+	if err := config.Load(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) Validate(p *config.Problems) {
+	if c.LogRetentionInterval <= 0 {
+		p.Add("EMAIL_LOG_RETENTION_INTERVAL", "must be a positive duration")
+	}
+	if c.QueuePollInterval <= 0 {
+		p.Add("EMAIL_QUEUE_POLL_INTERVAL", "must be a positive duration")
+	}
+	if c.QueueLease <= 0 {
+		p.Add("EMAIL_QUEUE_LEASE", "must be a positive duration")
+	}
+	if c.DigestInterval <= 0 {
+		p.Add("EMAIL_DIGEST_INTERVAL", "must be a positive duration")
+	}
+	if c.DigestBuildTimeout <= 0 {
+		p.Add("EMAIL_DIGEST_BUILD_TIMEOUT", "must be a positive duration")
+	}
+	if c.ScheduleInterval <= 0 {
+		p.Add("EMAIL_SCHEDULE_INTERVAL", "must be a positive duration")
+	}
+	if c.ScheduleClaimTimeout <= 0 {
+		p.Add("EMAIL_SCHEDULE_CLAIM_TIMEOUT", "must be a positive duration")
+	}
+	if c.UnsubscribeSecret != "" && len(c.UnsubscribeSecret) < 32 {
+		p.Add("EMAIL_UNSUBSCRIBE_SECRET", "must be at least 32 characters")
+	}
+	if _, err := c.DomainRateOverrides(); err != nil {
+		p.Add("EMAIL_DOMAIN_RATE_LIMITS", "must be domain=limit entries with a limit of 0 or more (%v)", err)
+	}
+	c.Redis.Validate(p)
 }
 
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// DomainRateOverrides parses EMAIL_DOMAIN_RATE_LIMITS into the messages a
+// minute of each domain listed, keyed by lower-cased domain
+func (c *Config) DomainRateOverrides() (map[string]int, error) {
+	overrides := make(map[string]int, len(c.DomainRateLimits))
+	for _, entry := range c.DomainRateLimits {
+		domain, limit, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if !ok || domain == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid entry %q", entry)
+		}
+		overrides[domain] = n
 	}
-	return fallback
+	return overrides, nil
 }
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrDigestNotFound = errors.New("digest subscription not found")
+	ErrDigestExists   = errors.New("user already has a subscription to this digest")
+)
+
+// DigestFrequency is how often a digest is sent
+type DigestFrequency string
+
+const (
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+// Valid reports whether f is a known frequency
+func (f DigestFrequency) Valid() bool {
+	return f == DigestDaily || f == DigestWeekly
+}
+
+// DigestSubscription sends a user a summary of one digest type on a
+// schedule: every day, or every week on Weekday, at Hour in Timezone. Runs
+// follow the local clock, so a digest at 08:00 stays at 08:00 across DST.
+type DigestSubscription struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	UserID     string          `gorm:"uniqueIndex:idx_digest_user_type;not null" json:"user_id"`
+	Email      string          `gorm:"not null" json:"email"`
+	DigestType string          `gorm:"uniqueIndex:idx_digest_user_type;not null" json:"digest_type"`
+	Frequency  DigestFrequency `gorm:"not null" json:"frequency"`
+	Hour       int             `gorm:"not null" json:"hour"`    // 0-23, local time
+	Weekday    int             `gorm:"not null" json:"weekday"` // 0 (Sunday) to 6, weekly digests only
+	Timezone   string          `gorm:"not null;default:'UTC'" json:"timezone"`
+	// CourseIDs are the courses the digest covers, for types that need them
+	CourseIDs []string `gorm:"serializer:json" json:"course_ids"`
+	// LastSentAt is when the latest run was handled, including runs that
+	// had nothing to report. A run is handled once however often the
+	// dispatcher ticks, and across restarts.
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// NextRunAt is filled in when a subscription is returned by the API
+	NextRunAt *time.Time `gorm:"-" json:"next_run_at,omitempty"`
+}
+
+// DigestOptOut stops every digest to a user while keeping their
+// subscriptions, so opting back in restores them
+type DigestOptOut struct {
+	UserID    string    `gorm:"primaryKey" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LastRun returns the latest scheduled run at or before now
+func (s *DigestSubscription) LastRun(now time.Time) (time.Time, error) {
+	return s.findRun(now, -1)
+}
+
+// NextRun returns the first scheduled run after now
+func (s *DigestSubscription) NextRun(now time.Time) (time.Time, error) {
+	return s.findRun(now, 1)
+}
+
+// Due reports whether a run has come up since the subscription was created
+// or last handled, returning that run
+func (s *DigestSubscription) Due(now time.Time) (time.Time, bool, error) {
+	run, err := s.LastRun(now)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	handled := s.CreatedAt
+	if s.LastSentAt != nil {
+		handled = *s.LastSentAt
+	}
+	return run, run.After(handled), nil
+}
+
+// findRun walks day by day from now's local date, backwards or forwards, to
+// the first day with a run on the right side of now. Each run is built from
+// the calendar date and hour, never by adding 24h, so DST changes do not
+// shift it. An hour skipped by DST runs at the first valid time after it.
+func (s *DigestSubscription) findRun(now time.Time, step int) (time.Time, error) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	y, m, d := now.In(loc).Date()
+	for i := 0; i <= 8; i++ {
+		run := time.Date(y, m, d+i*step, s.Hour, 0, 0, 0, loc)
+		if s.Frequency == DigestWeekly && run.Weekday() != time.Weekday(s.Weekday) {
+			continue
+		}
+		if (step < 0 && !run.After(now)) || (step > 0 && run.After(now)) {
+			return run, nil
+		}
+	}
+	return time.Time{}, errors.New("digest schedule has no run within a week")
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestRunsFollowLocalClock(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	sub := &DigestSubscription{Frequency: DigestDaily, Hour: 8, Timezone: "Europe/Berlin"}
+
+	// Clocks go forward on 2026-03-29; the run stays at 08:00 local
+	next, err := sub.NextRun(time.Date(2026, 3, 28, 12, 0, 0, 0, berlin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 3, 29, 8, 0, 0, 0, berlin); !next.Equal(want) {
+		t.Errorf("next run across DST = %v, want %v", next, want)
+	}
+
+	// A DST night: 02:30 does not exist, so the run moves to 03:30
+	sub.Hour = 2
+	next, err = sub.NextRun(time.Date(2026, 3, 29, 0, 0, 0, 0, berlin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.In(berlin).Hour() != 3 || next.In(berlin).Day() != 29 {
+		t.Errorf("run in the skipped hour = %v, want the first valid time after it", next.In(berlin))
+	}
+}
+
+func TestWeeklyDigestDue(t *testing.T) {
+	created := time.Date(2026, 10, 5, 9, 0, 0, 0, time.UTC) // a Monday
+	sub := &DigestSubscription{Frequency: DigestWeekly, Weekday: int(time.Friday), Hour: 17, Timezone: "UTC", CreatedAt: created}
+
+	for _, tc := range []struct {
+		now  time.Time
+		due  bool
+		want time.Time
+	}{
+		{now: time.Date(2026, 10, 9, 16, 59, 0, 0, time.UTC), due: false},
+		{now: time.Date(2026, 10, 9, 17, 0, 0, 0, time.UTC), due: true, want: time.Date(2026, 10, 9, 17, 0, 0, 0, time.UTC)},
+		{now: time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC), due: true, want: time.Date(2026, 10, 9, 17, 0, 0, 0, time.UTC)},
+	} {
+		run, due, err := sub.Due(tc.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if due != tc.due || (due && !run.Equal(tc.want)) {
+			t.Errorf("Due(%v) = %v, %v; want %v, %v", tc.now, run, due, tc.want, tc.due)
+		}
+	}
+
+	handled := time.Date(2026, 10, 9, 17, 0, 1, 0, time.UTC)
+	sub.LastSentAt = &handled
+	if _, due, _ := sub.Due(time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC)); due {
+		t.Error("run already handled is due again")
+	}
+}
@@ -1,39 +1,215 @@
 package core
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
 )
 
-// EmailTemplate represents a stored HTML email template
+var (
+	ErrTemplateNotFound        = errors.New("template not found")
+	ErrTemplateLocaleExists    = errors.New("template already exists in this locale")
+	ErrTemplateVersionNotFound = errors.New("template version not found")
+	ErrEmailLogNotFound        = errors.New("email log not found")
+	ErrSuppressionNotFound     = errors.New("suppression not found")
+	ErrEmailNotScheduled       = errors.New("email is not scheduled; it has already been queued or was cancelled")
+)
+
+// EmailTemplate represents a stored HTML email template in one locale; a
+// template is translated by saving it again under the same name in another
+// locale. Subject and HTMLBody mirror the active version; every save creates
+// a new EmailTemplateVersion.
 type EmailTemplate struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `gorm:"uniqueIndex;not null" json:"name"`
-	Subject   string         `gorm:"not null" json:"subject"`
-	HTMLBody  string         `gorm:"not null" json:"html_body"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	Name          string         `gorm:"uniqueIndex:idx_email_templates_name_locale;not null" json:"name"`
+	Locale        string         `gorm:"uniqueIndex:idx_email_templates_name_locale;not null;default:'en'" json:"locale"`
+	Subject       string         `gorm:"not null" json:"subject"`
+	HTMLBody      string         `gorm:"not null" json:"html_body"`
+	ActiveVersion int            `gorm:"not null;default:0" json:"active_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// EmailTemplateVersion is an immutable snapshot of a template as it was saved
+type EmailTemplateVersion struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TemplateID uint      `gorm:"uniqueIndex:idx_template_version;not null" json:"template_id"`
+	Version    int       `gorm:"uniqueIndex:idx_template_version;not null" json:"version"`
+	Subject    string    `gorm:"not null" json:"subject"`
+	HTMLBody   string    `gorm:"not null" json:"html_body"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // RequestStatus represents the status of an email request
 type RequestStatus string
 
 const (
-	StatusPending RequestStatus = "pending"
-	StatusSent    RequestStatus = "sent"
-	StatusFailed  RequestStatus = "failed"
+	// StatusScheduled emails wait in the database until their SendAt, when
+	// the scheduler moves them on to pending; StatusCancelled ones were
+	// cancelled before that
+	StatusScheduled RequestStatus = "scheduled"
+	StatusCancelled RequestStatus = "cancelled"
+	StatusPending   RequestStatus = "pending"
+	StatusSent      RequestStatus = "sent"
+	StatusFailed    RequestStatus = "failed"
+	// StatusSuppressed means the recipient unsubscribed from the category,
+	// so nothing was sent
+	StatusSuppressed RequestStatus = "suppressed"
+	// The provider's delivery webhooks move a sent email on to one of these
+	StatusDelivered  RequestStatus = "delivered"
+	StatusBounced    RequestStatus = "bounced"
+	StatusComplained RequestStatus = "complained"
+)
+
+// deliveryRank orders the statuses a sent email can reach. Providers do not
+// deliver webhooks in order, so a status only ever moves to a higher rank: a
+// late "delivered" does not hide a bounce or complaint already recorded.
+var deliveryRank = map[RequestStatus]int{
+	StatusSent:       1,
+	StatusDelivered:  2,
+	StatusBounced:    3,
+	StatusComplained: 4,
+}
+
+// Valid reports whether s is a known status
+func (s RequestStatus) Valid() bool {
+	switch s {
+	case StatusScheduled, StatusCancelled, StatusPending, StatusSent, StatusFailed, StatusSuppressed:
+		return true
+	}
+	_, sent := deliveryRank[s]
+	return sent
+}
+
+// Advances reports whether a log with status from should move to s. Logs
+// that were never sent keep their status.
+func (s RequestStatus) Advances(from RequestStatus) bool {
+	current, sent := deliveryRank[from]
+	return sent && deliveryRank[s] > current
+}
+
+// Category says what kind of mail a send is, which decides whether the
+// recipient can unsubscribe from it
+type Category string
+
+const (
+	// CategoryTransactional is mail the user asked for, such as magic links.
+	// It is never suppressed.
+	CategoryTransactional Category = "transactional"
+	CategoryNotification  Category = "notification"
+	CategoryMarketing     Category = "marketing"
 )
 
+// Valid reports whether c is a known category
+func (c Category) Valid() bool {
+	switch c {
+	case CategoryTransactional, CategoryNotification, CategoryMarketing:
+		return true
+	}
+	return false
+}
+
 // EmailRequestLog logs every email attempt
 type EmailRequestLog struct {
-	ID             uint          `gorm:"primaryKey" json:"id"`
+	ID             uint          `gorm:"primaryKey;index:idx_email_request_logs_created_at_id,priority:2" json:"id"`
 	TemplateName   string        `gorm:"index;not null" json:"template_name"`
 	RecipientEmail string        `gorm:"index;not null" json:"recipient_email"`
-	Payload        string        `json:"payload"` // JSON string of the data used for replacement
+	Locale         string        `json:"locale,omitempty"` // the locale the template was rendered in
+	Category       Category      `gorm:"not null;default:'transactional'" json:"category"`
+	Payload        *string       `json:"payload"` // JSON string of the data used for replacement, sensitive keys redacted; nil once purged
 	Status         RequestStatus `gorm:"index;not null;default:'pending'" json:"status"`
 	ErrorMessage   *string       `json:"error_message,omitempty"`
-	CreatedAt      time.Time     `json:"created_at"`
+	CreatedAt      time.Time     `gorm:"index:idx_email_request_logs_created_at_id,priority:1" json:"created_at"`
 	SentAt         *time.Time    `json:"sent_at,omitempty"`
+	// ProviderMessageID is the ID the provider gave the sent email, which its
+	// delivery webhooks refer to it by
+	ProviderMessageID *string `gorm:"index" json:"provider_message_id,omitempty"`
+	// StatusEventAt is when the provider reported the current delivered,
+	// bounced or complained status
+	StatusEventAt *time.Time `json:"status_event_at,omitempty"`
+	// PayloadPurgedAt is set when the retention job removed the payload
+	PayloadPurgedAt *time.Time `json:"payload_purged_at,omitempty"`
+
+	// SendAt is when a scheduled email is due, in UTC, and ClaimedAt when
+	// the scheduler last moved it into the send queue
+	SendAt    *time.Time `gorm:"index" json:"send_at,omitempty"`
+	ClaimedAt *time.Time `json:"claimed_at,omitempty"`
+	// Job is the JSON of a scheduled or queued email's job, data unredacted
+	// since it is still to be rendered. It is cleared once the email is sent,
+	// fails or is cancelled. A pending log with a job is on the send queue.
+	Job *string `json:"-"`
+	// LockedUntil is when the lease of the worker sending a queued email
+	// runs out, and Attempts how many times the email has been leased
+	LockedUntil *time.Time `json:"-"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	// NextRetryAt is when a queued email deferred because its recipient's
+	// domain had used up its rate limit is due again. A deferral is not an
+	// attempt.
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+}
+
+// SuppressionReason says why an address was suppressed
+type SuppressionReason string
+
+const (
+	ReasonUnsubscribed SuppressionReason = "unsubscribed"
+	ReasonBounced      SuppressionReason = "bounced"
+	ReasonComplained   SuppressionReason = "complained"
+)
+
+// EmailSuppression stops non-transactional mail of one category from being
+// sent to an address. Email is stored lower-cased.
+type EmailSuppression struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	Email     string            `gorm:"uniqueIndex:idx_suppression_email_category;not null" json:"email"`
+	Category  Category          `gorm:"uniqueIndex:idx_suppression_email_category;not null" json:"category"`
+	Reason    SuppressionReason `gorm:"not null;default:'unsubscribed'" json:"reason"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// DeliveryEventType is what a provider reported about a sent email
+type DeliveryEventType string
+
+const (
+	EventDelivered  DeliveryEventType = "delivered"
+	EventDeferred   DeliveryEventType = "deferred"
+	EventBounced    DeliveryEventType = "bounced"
+	EventDropped    DeliveryEventType = "dropped"
+	EventComplained DeliveryEventType = "complained"
+)
+
+// Status is the log status the event moves a sent email to, if any.
+// Deferred and dropped events only appear in the timeline.
+func (t DeliveryEventType) Status() (RequestStatus, bool) {
+	switch t {
+	case EventDelivered:
+		return StatusDelivered, true
+	case EventBounced:
+		return StatusBounced, true
+	case EventComplained:
+		return StatusComplained, true
+	}
+	return "", false
+}
+
+// EmailDeliveryEvent is one event from a provider's delivery webhook.
+// ProviderEventID is unique per provider, so an event delivered twice is
+// recorded once.
+type EmailDeliveryEvent struct {
+	ID              uint              `gorm:"primaryKey" json:"id"`
+	RequestLogID    uint              `gorm:"index;not null" json:"request_log_id"`
+	Provider        string            `gorm:"uniqueIndex:idx_delivery_event_provider_id;not null" json:"provider"`
+	ProviderEventID string            `gorm:"uniqueIndex:idx_delivery_event_provider_id;not null" json:"provider_event_id"`
+	Type            DeliveryEventType `gorm:"not null" json:"type"`
+	// HardBounce is set on bounces the provider reports as permanent
+	HardBounce bool      `gorm:"not null;default:false" json:"hard_bounce,omitempty"`
+	Detail     string    `json:"detail,omitempty"` // the provider's reason, e.g. the SMTP response
+	OccurredAt time.Time `gorm:"not null" json:"occurred_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	// MessageID is the provider message ID the event refers to; it is
+	// resolved to RequestLogID and not stored
+	MessageID string `gorm:"-" json:"-"`
 }
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultLocale is the base locale of every template. Translations must use
+// the same variables as it, and mail falls back to it when the recipient's
+// locale has no translation.
+const DefaultLocale = "en"
+
+// localePattern accepts a language with an optional region, e.g. fr or fr-CA
+var localePattern = regexp.MustCompile(`^([A-Za-z]{2,3})(?:[-_]([A-Za-z]{2}|[0-9]{3}))?$`)
+
+// NormalizeLocale writes a locale as a lower-case language and upper-case
+// region (fr_ca becomes fr-CA), reporting false if it is not one
+func NormalizeLocale(locale string) (string, bool) {
+	m := localePattern.FindStringSubmatch(strings.TrimSpace(locale))
+	if m == nil {
+		return "", false
+	}
+	normalized := strings.ToLower(m[1])
+	if m[2] != "" {
+		normalized += "-" + strings.ToUpper(m[2])
+	}
+	return normalized, true
+}
+
+// LocaleFallbacks lists the locales to try, in order, for the given
+// preferences: each one followed by its language alone, then DefaultLocale.
+// Empty and malformed preferences are skipped.
+func LocaleFallbacks(preferred ...string) []string {
+	seen := make(map[string]bool, len(preferred)*2+1)
+	chain := make([]string, 0, len(preferred)*2+1)
+	add := func(locale string) {
+		if !seen[locale] {
+			seen[locale] = true
+			chain = append(chain, locale)
+		}
+	}
+	for _, p := range preferred {
+		locale, ok := NormalizeLocale(p)
+		if !ok {
+			continue
+		}
+		add(locale)
+		if language, _, found := strings.Cut(locale, "-"); found {
+			add(language)
+		}
+	}
+	add(DefaultLocale)
+	return chain
+}
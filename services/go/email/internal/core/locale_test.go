@@ -0,0 +1,29 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	for in, want := range map[string]string{"fr_ca": "fr-CA", " EN ": "en", "es-419": "es-419"} {
+		if got, ok := NormalizeLocale(in); !ok || got != want {
+			t.Errorf("NormalizeLocale(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "french", "fr-CAN", "f"} {
+		if got, ok := NormalizeLocale(in); ok {
+			t.Errorf("NormalizeLocale(%q) = %q, want it rejected", in, got)
+		}
+	}
+}
+
+func TestLocaleFallbacks(t *testing.T) {
+	got := LocaleFallbacks("fr_CA", "", "not a locale", "de")
+	if want := []string{"fr-CA", "fr", "de", "en"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LocaleFallbacks = %v, want %v", got, want)
+	}
+	if got := LocaleFallbacks(); !reflect.DeepEqual(got, []string{DefaultLocale}) {
+		t.Errorf("LocaleFallbacks() = %v, want only the default locale", got)
+	}
+}
@@ -1,12 +1,85 @@
 package core
 
+import (
+	"context"
+	"time"
+)
+
 // EmailProvider defines the interface for sending raw emails
 type EmailProvider interface {
-	SendEmail(to []string, subject string, body string) error
+	// SendEmail returns the ID the provider's delivery webhooks will refer
+	// to the email by
+	SendEmail(to []string, subject string, body string) (string, error)
+}
+
+// WebhookSource verifies and reads the delivery webhooks of one provider
+type WebhookSource interface {
+	// Parse checks the request's signature and returns the events it
+	// reports. header looks up a request header.
+	Parse(ctx context.Context, header func(string) string, body []byte) ([]EmailDeliveryEvent, error)
 }
 
 // TemplateService defines the interface for managing email templates
 type TemplateService interface {
-	GetTemplate(name string) (*EmailTemplate, error)
+	// GetTemplate returns the template in the first of LocaleFallbacks(locales...)
+	// it exists in
+	GetTemplate(name string, locales ...string) (*EmailTemplate, error)
 	Render(template *EmailTemplate, data map[string]interface{}) (string, error)
 }
+
+// VariableResolver adds template data that is looked up when the email is
+// sent rather than passed by the caller, such as the branding of the
+// recipient's institute
+type VariableResolver interface {
+	// Resolve returns the variables to add to the job's data; nil adds none
+	Resolve(ctx context.Context, job EmailJob) (map[string]interface{}, error)
+}
+
+// EmailJob is a templated email waiting in the send queue
+type EmailJob struct {
+	TemplateName string   `json:"template_name"`
+	Recipient    string   `json:"recipient"`
+	Category     Category `json:"category"`
+	// Locale is the recipient's preferred locale and DefaultLocale their
+	// institute's; either may be empty
+	Locale        string `json:"locale,omitempty"`
+	DefaultLocale string `json:"default_locale,omitempty"`
+	// InstituteID is the recipient's institute, whose branding the email
+	// gets; empty for unbranded mail
+	InstituteID string                 `json:"institute_id,omitempty"`
+	Data        map[string]interface{} `json:"data"`
+	// NextRetryAt is set when the send was deferred because the recipient's
+	// domain had used up its rate limit
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+	// LogID is the request log the email is queued and sent under
+	LogID uint `json:"log_id,omitempty"`
+}
+
+// Delivery is a single job handed to a consumer. Every delivery must be
+// settled exactly once with Ack or Nack; unsettled deliveries are redelivered.
+type Delivery interface {
+	Job() EmailJob
+	Ack() error
+	Nack(requeue bool) error
+	// Defer settles the delivery and delivers its job again at until, with
+	// NextRetryAt set. A deferred job has not failed.
+	Defer(until time.Time) error
+}
+
+// MessageQueue defines the interface for the broker backing the send queue
+type MessageQueue interface {
+	Publish(job EmailJob) error
+	// Consume opens a consumer that holds at most prefetch unsettled
+	// deliveries at a time. Calling the returned cancel func stops new
+	// deliveries and closes the channel.
+	Consume(prefetch int) (<-chan Delivery, func(), error)
+}
+
+// DigestProvider builds the content of one digest type
+type DigestProvider interface {
+	// TemplateName is the email template the digest is rendered with
+	TemplateName() string
+	// Build returns the template data of sub's digest as of now, or nil if
+	// there is nothing to report
+	Build(ctx context.Context, sub *DigestSubscription, now time.Time) (map[string]interface{}, error)
+}
@@ -0,0 +1,136 @@
+// Package digest holds the providers that build the content of each digest type
+package digest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// TypePendingItems is the digest type built by PendingItems
+const TypePendingItems = "pending_items"
+
+// closingWindow is how far ahead an assignment's close counts as "closing soon"
+const closingWindow = 24 * time.Hour
+
+// PendingItems tells instructors what needs attention in the subscription's
+// courses: submissions to assignments graded by hand that have no grade yet,
+// and assignments closing within a day. It reads both from the Assignment
+// and Submission services, calling them as a service rather than a user.
+type PendingItems struct {
+	assignments *clients.Client
+	submissions *clients.Client
+}
+
+func NewPendingItems(assignments, submissions clients.Config) *PendingItems {
+	return &PendingItems{
+		assignments: clients.NewClient("assignment", assignments),
+		submissions: clients.NewClient("submission", submissions),
+	}
+}
+
+func (p *PendingItems) TemplateName() string {
+	return "pending_items_digest"
+}
+
+// assignment is the part of an Assignment Service assignment the digest uses
+type assignment struct {
+	ID                   string     `json:"id"`
+	Title                string     `json:"title"`
+	DueDate              time.Time  `json:"dueDate"`
+	AllowLateSubmissions bool       `json:"allowLateSubmissions"`
+	LateDueDate          *time.Time `json:"lateDueDate"`
+	GradingMethod        string     `json:"gradingMethod"`
+}
+
+// closesAt mirrors the Assignment Service: late submissions extend the close
+func (a assignment) closesAt() time.Time {
+	if a.AllowLateSubmissions && a.LateDueDate != nil {
+		return *a.LateDueDate
+	}
+	return a.DueDate
+}
+
+type submission struct {
+	RubricScore *int `json:"rubricScore"`
+}
+
+// Build returns nil when nothing in the subscription's courses is pending
+func (p *PendingItems) Build(ctx context.Context, sub *core.DigestSubscription, now time.Time) (map[string]interface{}, error) {
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		closing       []map[string]interface{}
+		ungraded      []map[string]interface{}
+		ungradedTotal int
+	)
+	for _, courseID := range sub.CourseIDs {
+		var assignments []assignment
+		err := p.assignments.Do(ctx, clients.Request{
+			Method: http.MethodGet,
+			Path:   "/api/v1/assignments?courseId=" + url.QueryEscape(courseID),
+		}, &assignments)
+		if err != nil {
+			return nil, fmt.Errorf("listing assignments of course %s: %w", courseID, err)
+		}
+
+		for _, a := range assignments {
+			if closes := a.closesAt(); closes.After(now) && !closes.After(now.Add(closingWindow)) {
+				closing = append(closing, map[string]interface{}{
+					"title":     a.Title,
+					"closes_at": closes.In(loc).Format("Mon 2 Jan 15:04 MST"),
+				})
+			}
+			if a.GradingMethod == "Auto" {
+				continue
+			}
+
+			var submissions []submission
+			err := p.submissions.Do(ctx, clients.Request{
+				Method: http.MethodGet,
+				Path:   "/api/v1/submissions?assignmentId=" + url.QueryEscape(a.ID),
+			}, &submissions)
+			if err != nil {
+				return nil, fmt.Errorf("listing submissions to assignment %s: %w", a.ID, err)
+			}
+			count := 0
+			for _, s := range submissions {
+				if s.RubricScore == nil {
+					count++
+				}
+			}
+			if count > 0 {
+				ungraded = append(ungraded, map[string]interface{}{"title": a.Title, "count": count})
+				ungradedTotal += count
+			}
+		}
+	}
+
+	if len(closing) == 0 && ungradedTotal == 0 {
+		return nil, nil
+	}
+	// Data stays plain strings, numbers and maps so it survives a JSON queue
+	return map[string]interface{}{
+		"date":           now.In(loc).Format("Monday 2 January 2006"),
+		"summary":        plural(ungradedTotal, "ungraded submission") + ", " + plural(len(closing), "assignment") + " closing in the next day",
+		"ungraded_count": ungradedTotal,
+		"ungraded":       ungraded,
+		"closing_count":  len(closing),
+		"closing":        closing,
+	}, nil
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
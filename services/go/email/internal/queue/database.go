@@ -0,0 +1,218 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+var (
+	ErrAlreadySettled  = errors.New("delivery already acked or nacked")
+	ErrInvalidPrefetch = errors.New("prefetch must be at least 1")
+	ErrNoRequestLog    = errors.New("job has no request log to queue it under")
+	// ErrLeaseLost means the delivery's lease ran out and another consumer
+	// has claimed the email since, so settling it changed nothing
+	ErrLeaseLost = errors.New("lease on queued email ran out")
+)
+
+// Store is the table queued emails are kept in
+type Store interface {
+	EnqueueEmail(id uint, job string) error
+	ClaimQueuedEmail(now time.Time, lease time.Duration) (*core.EmailRequestLog, error)
+	AckQueuedEmail(id uint, attempts int) (bool, error)
+	ReleaseQueuedEmail(id uint, attempts int) (bool, error)
+	DeferQueuedEmail(id uint, attempts int, until time.Time) (bool, error)
+	FailQueuedEmail(id uint, attempts int, msg string) (bool, error)
+}
+
+// DatabaseQueue is a MessageQueue kept in the email request log table. A
+// queued email is its pending log with the job stored on it; consumers lease
+// one at a time, so every replica can consume and nothing queued is lost on
+// restart. An email whose consumer stops before settling it is delivered
+// again once its lease runs out.
+type DatabaseQueue struct {
+	store        Store
+	pollInterval time.Duration
+	lease        time.Duration
+	// wake tells an idle consumer a job was just published, so it need not
+	// wait for the next poll
+	wake chan struct{}
+}
+
+// NewDatabaseQueue builds the queue. Consumers look for new jobs every
+// pollInterval, and hold each one for up to lease before it is redelivered.
+func NewDatabaseQueue(store Store, pollInterval, lease time.Duration) *DatabaseQueue {
+	return &DatabaseQueue{
+		store:        store,
+		pollInterval: pollInterval,
+		lease:        lease,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Publish queues job on its request log, which must be pending
+func (q *DatabaseQueue) Publish(job core.EmailJob) error {
+	if job.LogID == 0 {
+		return ErrNoRequestLog
+	}
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := q.store.EnqueueEmail(job.LogID, string(jobBytes)); err != nil {
+		return err
+	}
+	q.signal()
+	return nil
+}
+
+// signal wakes one idle consumer, if any are waiting
+func (q *DatabaseQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Consume starts a consumer with its own prefetch window
+func (q *DatabaseQueue) Consume(prefetch int) (<-chan core.Delivery, func(), error) {
+	if prefetch < 1 {
+		return nil, nil, ErrInvalidPrefetch
+	}
+
+	out := make(chan core.Delivery)
+	done := make(chan struct{})
+	slots := make(chan struct{}, prefetch)
+
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(q.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			// Wait until this consumer has room for another unsettled delivery
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			d := q.claim(func() { <-slots })
+			if d == nil {
+				<-slots
+				select {
+				case <-q.wake:
+				case <-ticker.C:
+				case <-done:
+					return
+				}
+				continue
+			}
+			// There may be more; let another idle consumer look
+			q.signal()
+
+			select {
+			case out <- d:
+			case <-done:
+				// Never handed to the consumer, let another have it
+				_ = d.Nack(true)
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() { once.Do(func() { close(done) }) }
+	return out, cancel, nil
+}
+
+// claim leases the next queued email, or returns nil if there is none or the
+// claim failed
+func (q *DatabaseQueue) claim(release func()) *databaseDelivery {
+	for {
+		reqLog, err := q.store.ClaimQueuedEmail(time.Now(), q.lease)
+		if err != nil {
+			log.Printf("[Queue] Failed to claim queued email: %v", err)
+			return nil
+		}
+		if reqLog == nil {
+			return nil
+		}
+
+		d := &databaseDelivery{queue: q, id: reqLog.ID, attempts: reqLog.Attempts, release: release}
+		if reqLog.Job == nil || json.Unmarshal([]byte(*reqLog.Job), &d.job) != nil {
+			if _, err := q.store.FailQueuedEmail(reqLog.ID, reqLog.Attempts, "Queued email has no readable job"); err != nil {
+				log.Printf("[Queue] Failed to drop unreadable email %d: %v", reqLog.ID, err)
+				return nil
+			}
+			continue
+		}
+		d.job.LogID = reqLog.ID
+		d.job.NextRetryAt = reqLog.NextRetryAt
+		return d
+	}
+}
+
+// databaseDelivery is one lease on a queued email. Settling it after the
+// lease ran out and the email was claimed again returns ErrLeaseLost.
+type databaseDelivery struct {
+	queue    *DatabaseQueue
+	id       uint
+	attempts int
+	job      core.EmailJob
+	release  func()
+	once     sync.Once
+}
+
+func (d *databaseDelivery) Job() core.EmailJob {
+	return d.job
+}
+
+func (d *databaseDelivery) Ack() error {
+	return d.settle(func() (bool, error) {
+		return d.queue.store.AckQueuedEmail(d.id, d.attempts)
+	})
+}
+
+// Nack with requeue releases the lease so the email is delivered again;
+// without, the email leaves the queue and is marked failed unless its send
+// already recorded why.
+func (d *databaseDelivery) Nack(requeue bool) error {
+	return d.settle(func() (bool, error) {
+		if requeue {
+			return d.queue.store.ReleaseQueuedEmail(d.id, d.attempts)
+		}
+		return d.queue.store.FailQueuedEmail(d.id, d.attempts, "Email could not be sent")
+	})
+}
+
+// Defer stores until as the email's next_retry_at, so it is delivered again
+// then by whichever consumer claims it, without counting this delivery as an
+// attempt
+func (d *databaseDelivery) Defer(until time.Time) error {
+	return d.settle(func() (bool, error) {
+		return d.queue.store.DeferQueuedEmail(d.id, d.attempts, until)
+	})
+}
+
+func (d *databaseDelivery) settle(fn func() (bool, error)) error {
+	settled := false
+	var err error
+	d.once.Do(func() {
+		var held bool
+		held, err = fn()
+		if err == nil && !held {
+			err = ErrLeaseLost
+		}
+		d.release()
+		settled = true
+	})
+	if !settled {
+		return ErrAlreadySettled
+	}
+	return err
+}
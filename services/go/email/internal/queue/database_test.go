@@ -0,0 +1,251 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestQueue is a DatabaseQueue over an in-memory request log table. SQLite
+// has no row locks, so the one connection serialises claims instead.
+func newTestQueue(t *testing.T, lease time.Duration) (*DatabaseQueue, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.EmailRequestLog{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewDatabaseQueue(repository.NewRepository(db), 10*time.Millisecond, lease), db
+}
+
+// publish logs a pending email to recipient and queues it
+func publish(t *testing.T, q *DatabaseQueue, db *gorm.DB, recipient string) uint {
+	t.Helper()
+	reqLog := &core.EmailRequestLog{TemplateName: "welcome", RecipientEmail: recipient, Status: core.StatusPending, CreatedAt: time.Now()}
+	if err := db.Create(reqLog).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Publish(core.EmailJob{TemplateName: "welcome", Recipient: recipient, LogID: reqLog.ID}); err != nil {
+		t.Fatal(err)
+	}
+	return reqLog.ID
+}
+
+func consume(t *testing.T, q *DatabaseQueue) <-chan core.Delivery {
+	t.Helper()
+	deliveries, cancel, err := q.Consume(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cancel)
+	return deliveries
+}
+
+func next(t *testing.T, deliveries <-chan core.Delivery) core.Delivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+		return nil
+	}
+}
+
+func loadLog(t *testing.T, db *gorm.DB, id uint) core.EmailRequestLog {
+	t.Helper()
+	var reqLog core.EmailRequestLog
+	if err := db.First(&reqLog, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return reqLog
+}
+
+func TestDatabaseQueuePublishNeedsRequestLog(t *testing.T) {
+	q, _ := newTestQueue(t, time.Minute)
+	if err := q.Publish(core.EmailJob{Recipient: "a@example.com"}); !errors.Is(err, ErrNoRequestLog) {
+		t.Fatalf("Publish without a log = %v, want ErrNoRequestLog", err)
+	}
+	if err := q.Publish(core.EmailJob{Recipient: "a@example.com", LogID: 42}); !errors.Is(err, core.ErrEmailLogNotFound) {
+		t.Fatalf("Publish to a missing log = %v, want ErrEmailLogNotFound", err)
+	}
+}
+
+func TestDatabaseQueueAckTakesEmailOffQueue(t *testing.T) {
+	q, db := newTestQueue(t, time.Minute)
+	id := publish(t, q, db, "a@example.com")
+
+	d := next(t, consume(t, q))
+	if got := d.Job(); got.LogID != id || got.Recipient != "a@example.com" {
+		t.Fatalf("delivered %+v, want the job queued under log %d", got, id)
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ack(); !errors.Is(err, ErrAlreadySettled) {
+		t.Fatalf("second Ack = %v, want ErrAlreadySettled", err)
+	}
+
+	reqLog := loadLog(t, db, id)
+	if reqLog.Job != nil || reqLog.LockedUntil != nil || reqLog.Attempts != 1 {
+		t.Fatalf("acked log has job %v, lock %v, attempts %d; want no job or lock, 1 attempt", reqLog.Job, reqLog.LockedUntil, reqLog.Attempts)
+	}
+	if claimed, err := repository.NewRepository(db).ClaimQueuedEmail(time.Now(), time.Minute); err != nil || claimed != nil {
+		t.Fatalf("claimed %v, %v after ack; want nothing", claimed, err)
+	}
+}
+
+func TestDatabaseQueueNackRequeues(t *testing.T) {
+	q, db := newTestQueue(t, time.Minute)
+	id := publish(t, q, db, "a@example.com")
+	deliveries := consume(t, q)
+
+	if err := next(t, deliveries).Nack(true); err != nil {
+		t.Fatal(err)
+	}
+	d := next(t, deliveries)
+	if d.Job().LogID != id {
+		t.Fatalf("redelivered log %d, want %d", d.Job().LogID, id)
+	}
+	if err := d.Nack(false); err != nil {
+		t.Fatal(err)
+	}
+
+	reqLog := loadLog(t, db, id)
+	if reqLog.Status != core.StatusFailed || reqLog.Job != nil || reqLog.Attempts != 2 {
+		t.Fatalf("nacked log is %s with job %v after %d attempts; want failed, no job, 2 attempts", reqLog.Status, reqLog.Job, reqLog.Attempts)
+	}
+}
+
+func TestDatabaseQueueNackKeepsRecordedOutcome(t *testing.T) {
+	q, db := newTestQueue(t, time.Minute)
+	id := publish(t, q, db, "a@example.com")
+	d := next(t, consume(t, q))
+
+	// The send itself recorded why it failed
+	msg := "Provider error: 550"
+	db.Model(&core.EmailRequestLog{}).Where("id = ?", id).Updates(map[string]interface{}{"status": core.StatusFailed, "error_message": msg})
+	if err := d.Nack(false); err != nil {
+		t.Fatal(err)
+	}
+	if reqLog := loadLog(t, db, id); reqLog.ErrorMessage == nil || *reqLog.ErrorMessage != msg {
+		t.Fatalf("error message is %v, want %q", reqLog.ErrorMessage, msg)
+	}
+}
+
+func TestDatabaseQueueRedeliversExpiredLease(t *testing.T) {
+	q, db := newTestQueue(t, 50*time.Millisecond)
+	id := publish(t, q, db, "a@example.com")
+
+	// The first consumer stalls past its lease, so the email goes to the
+	// second
+	stale := next(t, consume(t, q))
+	fresh := next(t, consume(t, q))
+	if fresh.Job().LogID != id {
+		t.Fatalf("redelivered log %d, want %d", fresh.Job().LogID, id)
+	}
+	if err := stale.Ack(); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Ack after the lease ran out = %v, want ErrLeaseLost", err)
+	}
+	if reqLog := loadLog(t, db, id); reqLog.Job == nil {
+		t.Fatal("stale ack took the email off the queue")
+	}
+	if err := fresh.Ack(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatabaseQueueConsumersShareEmails(t *testing.T) {
+	q, db := newTestQueue(t, time.Minute)
+	const emails = 20
+	for i := 0; i < emails; i++ {
+		publish(t, q, db, "user@example.com")
+	}
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[uint]int)
+		wg   sync.WaitGroup
+	)
+	for c := 0; c < 4; c++ {
+		deliveries := consume(t, q)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case d := <-deliveries:
+					mu.Lock()
+					seen[d.Job().LogID]++
+					mu.Unlock()
+					if err := d.Ack(); err != nil {
+						t.Error(err)
+					}
+				case <-time.After(200 * time.Millisecond):
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != emails {
+		t.Fatalf("delivered %d emails, want %d", len(seen), emails)
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("log %d delivered %d times, want once", id, n)
+		}
+	}
+}
+
+func TestDatabaseQueueDeferIsNotAnAttempt(t *testing.T) {
+	q, db := newTestQueue(t, time.Minute)
+	id := publish(t, q, db, "a@example.com")
+	deliveries := consume(t, q)
+
+	until := time.Now().Add(300 * time.Millisecond)
+	if err := next(t, deliveries).Defer(until); err != nil {
+		t.Fatal(err)
+	}
+	reqLog := loadLog(t, db, id)
+	if reqLog.Attempts != 0 || reqLog.NextRetryAt == nil || reqLog.Status != core.StatusPending || reqLog.Job == nil {
+		t.Fatalf("deferred log is %s with job %v, next retry %v after %d attempts; want still queued, a next retry and no attempts",
+			reqLog.Status, reqLog.Job, reqLog.NextRetryAt, reqLog.Attempts)
+	}
+
+	// Nothing is delivered until the retry is due
+	select {
+	case <-deliveries:
+		t.Fatal("deferred email delivered before its next_retry_at")
+	case <-time.After(100 * time.Millisecond):
+	}
+	d := next(t, deliveries)
+	if time.Now().Before(until) {
+		t.Fatal("deferred email delivered before its next_retry_at")
+	}
+	if job := d.Job(); job.LogID != id || job.NextRetryAt == nil {
+		t.Fatalf("redelivered %+v, want log %d with its next retry", job, id)
+	}
+	if err := d.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if reqLog := loadLog(t, db, id); reqLog.Attempts != 1 || reqLog.NextRetryAt != nil {
+		t.Fatalf("sent log has %d attempts, next retry %v; want 1 and none", reqLog.Attempts, reqLog.NextRetryAt)
+	}
+}
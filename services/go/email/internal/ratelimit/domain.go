@@ -0,0 +1,82 @@
+// Package ratelimit paces outgoing mail per recipient domain. The budgets are
+// token buckets kept in Redis, so every worker replica draws from the same one.
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeToken refills the bucket for the time since it was last touched and
+// takes a token if there is one. It returns 0 when a token was taken, or the
+// milliseconds until one will be there otherwise; a send that has to wait
+// takes nothing, so it does not eat into the budget of later ones. Redis's
+// clock is used so replicas with skewed clocks agree.
+var takeToken = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local interval = 60000 / rate
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) / interval)
+
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+else
+  wait = math.ceil((1 - tokens) * interval)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * interval) + 1000)
+return wait
+`)
+
+// DomainLimiter allows each recipient domain a number of messages per
+// minute, with bursts of up to burst messages
+type DomainLimiter struct {
+	rdb       redis.UniversalClient
+	perMinute int
+	overrides map[string]int
+	burst     int
+}
+
+// NewDomainLimiter limits every domain to perMinute messages a minute,
+// except those in overrides. A limit of 0 leaves a domain unlimited.
+func NewDomainLimiter(rdb redis.UniversalClient, perMinute int, overrides map[string]int, burst int) *DomainLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &DomainLimiter{rdb: rdb, perMinute: perMinute, overrides: overrides, burst: burst}
+}
+
+// Reserve takes a message to domain from its budget. If the budget is used
+// up it takes nothing and returns how long until there is room.
+func (l *DomainLimiter) Reserve(ctx context.Context, domain string) (time.Duration, error) {
+	domain = strings.ToLower(domain)
+	limit := l.perMinute
+	if n, ok := l.overrides[domain]; ok {
+		limit = n
+	}
+	if limit <= 0 {
+		return 0, nil
+	}
+
+	burst := min(l.burst, limit)
+	wait, err := takeToken.Run(ctx, l.rdb, []string{key(domain)}, limit, burst).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+func key(domain string) string {
+	return "email_rate:" + redisfactory.HashTag(domain)
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLimiter(t *testing.T, perMinute int, overrides map[string]int, burst int) (*DomainLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return NewDomainLimiter(rdb, perMinute, overrides, burst), mr
+}
+
+func reserve(t *testing.T, l *DomainLimiter, domain string) time.Duration {
+	t.Helper()
+	wait, err := l.Reserve(context.Background(), domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wait
+}
+
+func TestBurstToOneDomainIsSpreadOut(t *testing.T) {
+	// 60 a minute is one a second, after a burst of 3
+	l, mr := newTestLimiter(t, 60, nil, 3)
+	mr.SetTime(time.Unix(1_700_000_000, 0))
+
+	for i := 0; i < 3; i++ {
+		if wait := reserve(t, l, "tenant.example"); wait != 0 {
+			t.Fatalf("send %d of the burst waits %s, want none", i+1, wait)
+		}
+	}
+	wait := reserve(t, l, "tenant.example")
+	if wait <= 0 || wait > time.Second {
+		t.Fatalf("send past the burst waits %s, want up to a second", wait)
+	}
+	// Waiting did not use up a token, so the next one waits no longer
+	if again := reserve(t, l, "tenant.example"); again != wait {
+		t.Fatalf("second send past the burst waits %s, want %s", again, wait)
+	}
+
+	mr.SetTime(time.Unix(1_700_000_001, 0))
+	if wait := reserve(t, l, "tenant.example"); wait != 0 {
+		t.Fatalf("send a second later waits %s, want none", wait)
+	}
+}
+
+func TestOtherDomainsAreNotHeldUp(t *testing.T) {
+	l, mr := newTestLimiter(t, 60, nil, 1)
+	mr.SetTime(time.Unix(1_700_000_000, 0))
+
+	reserve(t, l, "tenant.example")
+	if wait := reserve(t, l, "tenant.example"); wait == 0 {
+		t.Fatal("tenant.example was not limited")
+	}
+	if wait := reserve(t, l, "Other.Example"); wait != 0 {
+		t.Fatalf("other.example waits %s behind tenant.example", wait)
+	}
+}
+
+func TestOverridesAndUnlimitedDomains(t *testing.T) {
+	l, mr := newTestLimiter(t, 60, map[string]int{"outlook.com": 1, "internal.example": 0}, 5)
+	mr.SetTime(time.Unix(1_700_000_000, 0))
+
+	// A limit of 1 a minute caps the burst at 1 too
+	reserve(t, l, "outlook.com")
+	if wait := reserve(t, l, "outlook.com"); wait <= time.Second || wait > time.Minute {
+		t.Fatalf("outlook.com waits %s, want most of a minute", wait)
+	}
+	for i := 0; i < 20; i++ {
+		if wait := reserve(t, l, "internal.example"); wait != 0 {
+			t.Fatalf("unlimited domain waits %s", wait)
+		}
+	}
+}
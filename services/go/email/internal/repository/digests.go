@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateDigestSubscription saves sub, or returns core.ErrDigestExists if the
+// user already has one of the same type
+func (r *Repository) CreateDigestSubscription(sub *core.DigestSubscription) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(sub)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return core.ErrDigestExists
+	}
+	return nil
+}
+
+func (r *Repository) GetDigestSubscription(id uint) (*core.DigestSubscription, error) {
+	var sub core.DigestSubscription
+	err := r.db.First(&sub, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, core.ErrDigestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// ListDigestSubscriptions returns subscriptions by ID, optionally only the
+// user's
+func (r *Repository) ListDigestSubscriptions(userID string) ([]core.DigestSubscription, error) {
+	query := r.db.Order("id")
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	subs := []core.DigestSubscription{}
+	if err := query.Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// UpdateDigestSubscription saves the schedule, address and courses of sub,
+// leaving LastSentAt to the dispatcher
+func (r *Repository) UpdateDigestSubscription(sub *core.DigestSubscription) error {
+	result := r.db.Model(sub).Select("email", "frequency", "hour", "weekday", "timezone", "course_ids", "updated_at").Updates(sub)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return core.ErrDigestNotFound
+	}
+	return nil
+}
+
+func (r *Repository) DeleteDigestSubscription(id uint) error {
+	result := r.db.Delete(&core.DigestSubscription{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return core.ErrDigestNotFound
+	}
+	return nil
+}
+
+// ListActiveDigestSubscriptions returns the subscriptions of users who have
+// not opted out of digests
+func (r *Repository) ListActiveDigestSubscriptions() ([]core.DigestSubscription, error) {
+	var subs []core.DigestSubscription
+	err := r.db.Where("user_id NOT IN (?)", r.db.Model(&core.DigestOptOut{}).Select("user_id")).
+		Order("id").Find(&subs).Error
+	return subs, err
+}
+
+// ClaimDigestRun marks the subscription's run as handled at handledAt, unless
+// it already was. Only the caller that gets true may send the digest, so a
+// run is sent once even if dispatchers overlap.
+func (r *Repository) ClaimDigestRun(id uint, run, handledAt time.Time) (bool, error) {
+	result := r.db.Model(&core.DigestSubscription{}).
+		Where("id = ? AND (last_sent_at IS NULL OR last_sent_at < ?)", id, run).
+		UpdateColumn("last_sent_at", handledAt)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReleaseDigestRun undoes a claim whose digest could not be sent, restoring
+// the previous LastSentAt so the run is tried again. A claim taken since is
+// left alone.
+func (r *Repository) ReleaseDigestRun(id uint, handledAt time.Time, previous *time.Time) error {
+	return r.db.Model(&core.DigestSubscription{}).
+		Where("id = ? AND last_sent_at = ?", id, handledAt).
+		UpdateColumn("last_sent_at", previous).Error
+}
+
+// OptOutOfDigests stops every digest to the user. Opting out twice is not an
+// error.
+func (r *Repository) OptOutOfDigests(userID string) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&core.DigestOptOut{UserID: userID}).Error
+}
+
+// OptInToDigests resumes the user's digests
+func (r *Repository) OptInToDigests(userID string) error {
+	return r.db.Where("user_id = ?", userID).Delete(&core.DigestOptOut{}).Error
+}
+
+func (r *Repository) HasOptedOutOfDigests(userID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&core.DigestOptOut{}).Where("user_id = ?", userID).Count(&count).Error
+	return count > 0, err
+}
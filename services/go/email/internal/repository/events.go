@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordDeliveryEvent stores event against the log of the email with its
+// MessageID and moves the log to the status the event implies, if that is a
+// step forward. It returns the log and whether the event was new; an event
+// the provider delivered before is not stored again. The log is locked while
+// its status is compared, so events arriving together cannot move it back.
+func (r *Repository) RecordDeliveryEvent(event *core.EmailDeliveryEvent) (*core.EmailRequestLog, bool, error) {
+	var (
+		log      core.EmailRequestLog
+		recorded bool
+	)
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("provider_message_id = ?", event.MessageID).Limit(1).Find(&log)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return core.ErrEmailLogNotFound
+		}
+
+		event.RequestLogID = log.ID
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+		if result.Error != nil {
+			return result.Error
+		}
+		recorded = result.RowsAffected > 0
+
+		status, ok := event.Type.Status()
+		if !recorded || !ok || !status.Advances(log.Status) {
+			return nil
+		}
+		log.Status = status
+		log.StatusEventAt = &event.OccurredAt
+		return tx.Model(&log).UpdateColumns(map[string]interface{}{
+			"status":          log.Status,
+			"status_event_at": log.StatusEventAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &log, recorded, nil
+}
+
+// ListDeliveryEvents returns the events recorded for a log, oldest first
+func (r *Repository) ListDeliveryEvents(logID uint) ([]core.EmailDeliveryEvent, error) {
+	events := []core.EmailDeliveryEvent{}
+	err := r.db.Where("request_log_id = ?", logID).Order("occurred_at ASC, id ASC").Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"gorm.io/gorm"
+)
+
+// LogFilter narrows the request logs; zero fields match everything
+type LogFilter struct {
+	Status core.RequestStatus
+	// Recipient matches the address exactly, ignoring case
+	Recipient string
+	// RecipientDomain matches addresses at the domain or any of its
+	// subdomains, so example.edu also matches jane@mail.example.edu
+	RecipientDomain string
+	TemplateName    string
+	From            time.Time // inclusive
+	To              time.Time // exclusive
+	// ErrorText is searched for in error messages as words, in any order
+	ErrorText string
+}
+
+// logSearchIndexes back the filters of LogFilter. Recipients are matched
+// lower-cased, and domains as a prefix of the reversed address so the
+// search does not scan every row.
+var logSearchIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_email_request_logs_recipient_created ON email_request_logs (lower(recipient_email), created_at DESC, id DESC)",
+	"CREATE INDEX IF NOT EXISTS idx_email_request_logs_recipient_reversed ON email_request_logs (reverse(lower(recipient_email)) text_pattern_ops)",
+	"CREATE INDEX IF NOT EXISTS idx_email_request_logs_template_created ON email_request_logs (template_name, created_at DESC, id DESC)",
+	"CREATE INDEX IF NOT EXISTS idx_email_request_logs_error_text ON email_request_logs USING gin (to_tsvector('simple', coalesce(error_message, '')))",
+}
+
+func (r *Repository) createLogSearchIndexes() error {
+	for _, stmt := range logSearchIndexes {
+		if err := r.db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEmailLogs retrieves the email request logs matching filter newest
+// first, ordered by (created_at, id) so a cursor keeps its place while new
+// logs are written
+func (r *Repository) GetEmailLogs(filter LogFilter, page pagination.Request) ([]core.EmailRequestLog, error) {
+	query := filterLogs(r.db.Model(&core.EmailRequestLog{}), filter).
+		Order("created_at DESC, id DESC").Limit(page.Fetch())
+	if page.After != nil {
+		id, err := strconv.ParseUint(page.After.ID, 10, 64)
+		if err != nil {
+			return nil, pagination.ErrInvalidCursor
+		}
+		query = query.Where("(created_at, id) < (?, ?)", page.After.CreatedAt, id)
+	} else {
+		query = query.Offset(page.Offset)
+	}
+
+	var logs []core.EmailRequestLog
+	if err := query.Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// CountEmailLogs counts the email request logs matching filter by status.
+// Statuses no log has are left out.
+func (r *Repository) CountEmailLogs(filter LogFilter) (map[core.RequestStatus]int64, error) {
+	var rows []struct {
+		Status core.RequestStatus
+		Count  int64
+	}
+	err := filterLogs(r.db.Model(&core.EmailRequestLog{}), filter).
+		Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[core.RequestStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+func filterLogs(query *gorm.DB, filter LogFilter) *gorm.DB {
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Recipient != "" {
+		query = query.Where("lower(recipient_email) = ?", strings.ToLower(filter.Recipient))
+	}
+	if filter.RecipientDomain != "" {
+		domain := reverse(strings.ToLower(filter.RecipientDomain))
+		query = query.Where(`(reverse(lower(recipient_email)) LIKE ? ESCAPE '\' OR reverse(lower(recipient_email)) LIKE ? ESCAPE '\')`,
+			escapeLike(domain+"@")+"%", escapeLike(domain+".")+"%")
+	}
+	if filter.TemplateName != "" {
+		query = query.Where("template_name = ?", filter.TemplateName)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.ErrorText != "" {
+		query = filterErrorText(query, filter.ErrorText)
+	}
+	return query
+}
+
+// filterErrorText narrows query to the logs whose error message has every
+// word of text. Databases without full text search, like the SQLite of the
+// tests, look for each word as a substring instead.
+func filterErrorText(query *gorm.DB, text string) *gorm.DB {
+	if query.Dialector.Name() == "postgres" {
+		return query.Where("to_tsvector('simple', coalesce(error_message, '')) @@ plainto_tsquery('simple', ?)", text)
+	}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		query = query.Where(`lower(coalesce(error_message, '')) LIKE ? ESCAPE '\'`, "%"+escapeLike(word)+"%")
+	}
+	return query
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// escapeLike makes s match itself in a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newPostgresRepository returns a repository on the throwaway database in
+// EMAIL_TEST_DATABASE_URL, migrated the way a server starts. The search
+// indexes are Postgres', so there is no stand-in.
+func newPostgresRepository(t *testing.T) *Repository {
+	t.Helper()
+	dsn := os.Getenv("EMAIL_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("EMAIL_TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	repo := NewRepository(db)
+	if err := repo.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestLogSearchesUseTheirIndexes(t *testing.T) {
+	repo := newPostgresRepository(t)
+
+	for _, tc := range []struct {
+		filter LogFilter
+		index  string
+	}{
+		{LogFilter{Recipient: "Jane@X.edu"}, "idx_email_request_logs_recipient_created"},
+		{LogFilter{RecipientDomain: "x.edu"}, "idx_email_request_logs_recipient_reversed"},
+		{LogFilter{TemplateName: "welcome"}, "idx_email_request_logs_template_created"},
+		{LogFilter{ErrorText: "mailbox full"}, "idx_email_request_logs_error_text"},
+	} {
+		query := repo.db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			var logs []core.EmailRequestLog
+			return filterLogs(tx.Model(&core.EmailRequestLog{}), tc.filter).Order("created_at DESC, id DESC").Limit(50).Find(&logs)
+		})
+
+		// A near empty test table is cheapest to scan, so scans are ruled
+		// out to see whether the index can serve the filter at all
+		var plan []string
+		err := repo.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SET LOCAL enable_seqscan = off").Error; err != nil {
+				return err
+			}
+			return tx.Raw("EXPLAIN " + query).Scan(&plan).Error
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if explained := strings.Join(plan, "\n"); !strings.Contains(explained, tc.index) {
+			t.Errorf("filter %+v does not use %s:\n%s", tc.filter, tc.index, explained)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// queuedEmailsIndex keeps ClaimQueuedEmail from scanning logs that are not
+// on the send queue, which is nearly all of them
+const queuedEmailsIndex = "CREATE INDEX IF NOT EXISTS idx_email_request_logs_queued ON email_request_logs (id) WHERE status = 'pending' AND job IS NOT NULL"
+
+// EnqueueEmail stores job on the pending log id, which makes it available
+// to ClaimQueuedEmail. It returns core.ErrEmailLogNotFound if there is no
+// pending log id.
+func (r *Repository) EnqueueEmail(id uint, job string) error {
+	result := r.db.Model(&core.EmailRequestLog{}).
+		Where("id = ? AND status = ?", id, core.StatusPending).
+		UpdateColumn("job", job)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return core.ErrEmailLogNotFound
+	}
+	return nil
+}
+
+// ClaimQueuedEmail leases the oldest queued email that is due at now and
+// nobody holds a lease on until now+lease, counting it as an attempt, and
+// returns it; nil if there is none. Rows another claim has locked are skipped, so concurrent claims
+// each get a different email. A lease that runs out without being settled,
+// because its holder stopped, makes the email available again.
+func (r *Repository) ClaimQueuedEmail(now time.Time, lease time.Duration) (*core.EmailRequestLog, error) {
+	var reqLog core.EmailRequestLog
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND job IS NOT NULL AND (locked_until IS NULL OR locked_until <= ?) AND (next_retry_at IS NULL OR next_retry_at <= ?)",
+				core.StatusPending, now, now).
+			Order("id").First(&reqLog).Error
+		if err != nil {
+			return err
+		}
+
+		lockedUntil := now.Add(lease)
+		reqLog.LockedUntil = &lockedUntil
+		reqLog.Attempts++
+		return tx.Model(&core.EmailRequestLog{}).Where("id = ?", reqLog.ID).
+			UpdateColumns(map[string]interface{}{"locked_until": lockedUntil, "attempts": reqLog.Attempts}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reqLog, nil
+}
+
+// AckQueuedEmail takes an email whose send has been recorded off the queue
+func (r *Repository) AckQueuedEmail(id uint, attempts int) (bool, error) {
+	return r.settleQueuedEmail(id, attempts, map[string]interface{}{"job": nil, "locked_until": nil, "next_retry_at": nil})
+}
+
+// ReleaseQueuedEmail gives up the lease of an email that was not sent, so it
+// is claimed again straight away
+func (r *Repository) ReleaseQueuedEmail(id uint, attempts int) (bool, error) {
+	return r.settleQueuedEmail(id, attempts, map[string]interface{}{"locked_until": nil})
+}
+
+// DeferQueuedEmail gives up the lease of an email held back by its domain's
+// rate limit until until, when it is claimed again. The claim that was
+// deferred is not counted as an attempt.
+func (r *Repository) DeferQueuedEmail(id uint, attempts int, until time.Time) (bool, error) {
+	return r.settleQueuedEmail(id, attempts, map[string]interface{}{
+		"locked_until":  nil,
+		"next_retry_at": until,
+		"attempts":      attempts - 1,
+	})
+}
+
+// FailQueuedEmail takes an email that will not be sent off the queue, and
+// marks it failed with msg unless its send already recorded an outcome
+func (r *Repository) FailQueuedEmail(id uint, attempts int, msg string) (bool, error) {
+	return r.settleQueuedEmail(id, attempts, map[string]interface{}{
+		"job":           nil,
+		"locked_until":  nil,
+		"next_retry_at": nil,
+		"status":        gorm.Expr("CASE WHEN status = ? THEN ? ELSE status END", core.StatusPending, core.StatusFailed),
+		"error_message": gorm.Expr("CASE WHEN status = ? THEN ? ELSE error_message END", core.StatusPending, msg),
+	})
+}
+
+// settleQueuedEmail applies fields to the email leased on its attempts-th
+// attempt. It reports false, changing nothing, if the lease ran out and the
+// email has been claimed again since.
+func (r *Repository) settleQueuedEmail(id uint, attempts int, fields map[string]interface{}) (bool, error) {
+	result := r.db.Model(&core.EmailRequestLog{}).
+		Where("id = ? AND attempts = ?", id, attempts).
+		UpdateColumns(fields)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -1,8 +1,12 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -15,20 +19,79 @@ func NewRepository(db *gorm.DB) *Repository {
 
 // AutoMigrate applies schema changes
 func (r *Repository) AutoMigrate() error {
-	return r.db.AutoMigrate(&core.EmailTemplate{}, &core.EmailRequestLog{})
+	if err := r.db.AutoMigrate(&core.EmailTemplate{}, &core.EmailTemplateVersion{}, &core.EmailRequestLog{}, &core.EmailSuppression{},
+		&core.EmailDeliveryEvent{}, &core.DigestSubscription{}, &core.DigestOptOut{}); err != nil {
+		return err
+	}
+	if err := r.db.Exec(queuedEmailsIndex).Error; err != nil {
+		return err
+	}
+	// Names were unique before templates had locales; now the pair is
+	if r.db.Migrator().HasIndex(&core.EmailTemplate{}, "idx_email_templates_name") {
+		if err := r.db.Migrator().DropIndex(&core.EmailTemplate{}, "idx_email_templates_name"); err != nil {
+			return err
+		}
+	}
+	if err := r.createLogSearchIndexes(); err != nil {
+		return err
+	}
+	return r.backfillTemplateVersions()
+}
+
+// backfillTemplateVersions gives templates created before versioning existed
+// a version 1 so that rollback has something to go back to.
+func (r *Repository) backfillTemplateVersions() error {
+	var templates []core.EmailTemplate
+	if err := r.db.Unscoped().Where("active_version = 0").Find(&templates).Error; err != nil {
+		return err
+	}
+	for _, tmpl := range templates {
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			version := &core.EmailTemplateVersion{
+				TemplateID: tmpl.ID,
+				Version:    1,
+				Subject:    tmpl.Subject,
+				HTMLBody:   tmpl.HTMLBody,
+				CreatedBy:  "migration",
+				CreatedAt:  tmpl.UpdatedAt,
+			}
+			if err := tx.Create(version).Error; err != nil {
+				return err
+			}
+			return tx.Model(&core.EmailTemplate{}).Unscoped().Where("id = ?", tmpl.ID).
+				Update("active_version", 1).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// GetTemplateByName fetches a template by its name
-func (r *Repository) GetTemplateByName(name string) (*core.EmailTemplate, error) {
+// GetTemplateByName fetches a template by its name and locale, with Subject
+// and HTMLBody taken from its active version
+func (r *Repository) GetTemplateByName(name, locale string) (*core.EmailTemplate, error) {
 	var tmpl core.EmailTemplate
 	// Use Find to avoid GORM logger "record not found" error being printed
-	result := r.db.Where("name = ?", name).Limit(1).Find(&tmpl)
+	result := r.db.Where("name = ? AND locale = ?", name, locale).Limit(1).Find(&tmpl)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	if result.RowsAffected == 0 {
 		return nil, gorm.ErrRecordNotFound
 	}
+
+	if tmpl.ActiveVersion > 0 {
+		var version core.EmailTemplateVersion
+		result = r.db.Where("template_id = ? AND version = ?", tmpl.ID, tmpl.ActiveVersion).Limit(1).Find(&version)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			tmpl.Subject = version.Subject
+			tmpl.HTMLBody = version.HTMLBody
+		}
+	}
 	return &tmpl, nil
 }
 
@@ -42,25 +105,234 @@ func (r *Repository) UpdateRequestLog(log *core.EmailRequestLog) error {
 	return r.db.Save(log).Error
 }
 
-// ListTemplates returns all templates (for internal API)
+// GetRequestLog returns a single email request log
+func (r *Repository) GetRequestLog(id uint) (*core.EmailRequestLog, error) {
+	var log core.EmailRequestLog
+	err := r.db.First(&log, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, core.ErrEmailLogNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// PurgeRequestLogPayloads clears the payload of logs created before cutoff,
+// leaving status and timestamps in place
+func (r *Repository) PurgeRequestLogPayloads(cutoff time.Time) (int64, error) {
+	result := r.db.Model(&core.EmailRequestLog{}).
+		Where("created_at < ? AND payload IS NOT NULL", cutoff).
+		UpdateColumns(map[string]interface{}{
+			"payload":           nil,
+			"payload_purged_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// ListTemplates returns all templates in every locale (for internal API)
 func (r *Repository) ListTemplates() ([]core.EmailTemplate, error) {
 	var templates []core.EmailTemplate
-	if err := r.db.Find(&templates).Error; err != nil {
+	if err := r.db.Order("name, locale").Find(&templates).Error; err != nil {
 		return nil, err
 	}
 	return templates, nil
 }
 
-// CreateTemplate creates or updates an email template
-func (r *Repository) CreateTemplate(tmpl *core.EmailTemplate) error {
-	return r.db.Save(tmpl).Error
+// ListTemplateLocales returns the named template in each locale it exists in
+func (r *Repository) ListTemplateLocales(name string) ([]core.EmailTemplate, error) {
+	var templates []core.EmailTemplate
+	if err := r.db.Where("name = ?", name).Order("locale").Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, core.ErrTemplateNotFound
+	}
+	return templates, nil
 }
 
-// GetEmailLogs retrieves all email request logs
-func (r *Repository) GetEmailLogs() ([]core.EmailRequestLog, error) {
-	var logs []core.EmailRequestLog
-	if err := r.db.Order("created_at DESC").Limit(100).Find(&logs).Error; err != nil {
+// SaveTemplateVersion stores subject and htmlBody as the next version of the
+// named template in locale and makes it active. The template is created if
+// it does not exist in the locale and restored if it was deleted.
+func (r *Repository) SaveTemplateVersion(name, locale, subject, htmlBody, createdBy string) (*core.EmailTemplate, error) {
+	var tmpl core.EmailTemplate
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("name = ? AND locale = ?", name, locale).Limit(1).Find(&tmpl)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			tmpl = core.EmailTemplate{Name: name, Locale: locale, Subject: subject, HTMLBody: htmlBody}
+			if err := tx.Create(&tmpl).Error; err != nil {
+				return err
+			}
+		}
+
+		var latest int
+		if err := tx.Model(&core.EmailTemplateVersion{}).Where("template_id = ?", tmpl.ID).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+
+		version := &core.EmailTemplateVersion{
+			TemplateID: tmpl.ID,
+			Version:    latest + 1,
+			Subject:    subject,
+			HTMLBody:   htmlBody,
+			CreatedBy:  createdBy,
+		}
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+
+		tmpl.Subject = subject
+		tmpl.HTMLBody = htmlBody
+		tmpl.ActiveVersion = version.Version
+		tmpl.DeletedAt = gorm.DeletedAt{}
+		return tx.Unscoped().Save(&tmpl).Error
+	})
+	if err != nil {
 		return nil, err
 	}
-	return logs, nil
+	return &tmpl, nil
+}
+
+// SeedTemplate saves tmpl as version 1 unless a template with the same name
+// and locale already exists, including a deleted one
+func (r *Repository) SeedTemplate(tmpl *core.EmailTemplate) error {
+	var count int64
+	if err := r.db.Unscoped().Model(&core.EmailTemplate{}).Where("name = ? AND locale = ?", tmpl.Name, tmpl.Locale).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := r.SaveTemplateVersion(tmpl.Name, tmpl.Locale, tmpl.Subject, tmpl.HTMLBody, "system")
+	return err
+}
+
+// ListTemplateVersions returns every version of the named template in
+// locale, newest first. Versions of deleted templates remain available for
+// audit.
+func (r *Repository) ListTemplateVersions(name, locale string) ([]core.EmailTemplateVersion, error) {
+	var tmpl core.EmailTemplate
+	result := r.db.Unscoped().Where("name = ? AND locale = ?", name, locale).Limit(1).Find(&tmpl)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, core.ErrTemplateNotFound
+	}
+
+	var versions []core.EmailTemplateVersion
+	if err := r.db.Where("template_id = ?", tmpl.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// ActivateTemplateVersion points the named template in locale at an
+// existing version
+func (r *Repository) ActivateTemplateVersion(name, locale string, version int) (*core.EmailTemplate, error) {
+	var tmpl core.EmailTemplate
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("name = ? AND locale = ?", name, locale).Limit(1).Find(&tmpl)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return core.ErrTemplateNotFound
+		}
+
+		var v core.EmailTemplateVersion
+		result = tx.Where("template_id = ? AND version = ?", tmpl.ID, version).Limit(1).Find(&v)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return core.ErrTemplateVersionNotFound
+		}
+
+		tmpl.Subject = v.Subject
+		tmpl.HTMLBody = v.HTMLBody
+		tmpl.ActiveVersion = v.Version
+		return tx.Save(&tmpl).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// DeleteTemplate soft-deletes the named template in locale, or in every
+// locale when locale is empty, and keeps its versions
+func (r *Repository) DeleteTemplate(name, locale string) error {
+	query := r.db.Where("name = ?", name)
+	if locale != "" {
+		query = query.Where("locale = ?", locale)
+	}
+	result := query.Delete(&core.EmailTemplate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return core.ErrTemplateNotFound
+	}
+	return nil
+}
+
+// IsSuppressed reports whether email has unsubscribed from category
+func (r *Repository) IsSuppressed(email string, category core.Category) (bool, error) {
+	var count int64
+	err := r.db.Model(&core.EmailSuppression{}).
+		Where("email = ? AND category = ?", email, category).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// AddSuppression stops category being sent to email. Adding an existing
+// suppression is not an error and keeps its original reason.
+func (r *Repository) AddSuppression(email string, category core.Category, reason core.SuppressionReason) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&core.EmailSuppression{Email: email, Category: category, Reason: reason}).Error
+}
+
+// HasBounced reports whether mail to email has hard-bounced
+func (r *Repository) HasBounced(email string) (bool, error) {
+	var count int64
+	err := r.db.Model(&core.EmailSuppression{}).
+		Where("email = ? AND reason = ?", email, core.ReasonBounced).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListSuppressions returns suppressions, newest first, optionally filtered by
+// email and category
+func (r *Repository) ListSuppressions(email string, category core.Category) ([]core.EmailSuppression, error) {
+	query := r.db.Order("created_at DESC")
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	suppressions := []core.EmailSuppression{}
+	if err := query.Find(&suppressions).Error; err != nil {
+		return nil, err
+	}
+	return suppressions, nil
+}
+
+// DeleteSuppression removes a suppression so the address receives that
+// category again
+func (r *Repository) DeleteSuppression(id uint) error {
+	result := r.db.Delete(&core.EmailSuppression{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return core.ErrSuppressionNotFound
+	}
+	return nil
 }
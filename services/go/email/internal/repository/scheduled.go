@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ClaimDueEmails moves up to limit scheduled emails due at now to pending,
+// stamping them claimed at now, and returns them. Emails claimed before
+// staleBefore that are still pending are claimed again: the instance that
+// claimed them stopped before sending them. Rows another claim has locked
+// are skipped, so of concurrent claims each email goes to one.
+func (r *Repository) ClaimDueEmails(now, staleBefore time.Time, limit int) ([]core.EmailRequestLog, error) {
+	var logs []core.EmailRequestLog
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND send_at <= ?) OR (status = ? AND send_at IS NOT NULL AND claimed_at < ?)",
+				core.StatusScheduled, now, core.StatusPending, staleBefore).
+			Order("send_at").Limit(limit).Find(&logs).Error
+		if err != nil || len(logs) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(logs))
+		for i := range logs {
+			ids[i] = logs[i].ID
+			logs[i].Status = core.StatusPending
+			logs[i].ClaimedAt = &now
+		}
+		return tx.Model(&core.EmailRequestLog{}).Where("id IN ?", ids).
+			UpdateColumns(map[string]interface{}{"status": core.StatusPending, "claimed_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// ReleaseClaimedEmail puts an email claimed at claimedAt back to scheduled,
+// for one that could not be queued. A claim taken since is left alone.
+func (r *Repository) ReleaseClaimedEmail(id uint, claimedAt time.Time) error {
+	return r.db.Model(&core.EmailRequestLog{}).
+		Where("id = ? AND status = ? AND claimed_at = ?", id, core.StatusPending, claimedAt).
+		UpdateColumn("status", core.StatusScheduled).Error
+}
+
+// CancelScheduledEmail cancels an email that is still scheduled. It returns
+// core.ErrEmailNotScheduled for one that was claimed, sent or cancelled
+// already, and core.ErrEmailLogNotFound if there is none.
+func (r *Repository) CancelScheduledEmail(id uint) error {
+	result := r.db.Model(&core.EmailRequestLog{}).
+		Where("id = ? AND status = ?", id, core.StatusScheduled).
+		UpdateColumns(map[string]interface{}{"status": core.StatusCancelled, "job": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := r.GetRequestLog(id); err != nil {
+			return err
+		}
+		return core.ErrEmailNotScheduled
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// MaxBatchRecipients caps the recipients of one QueueBatch call
+const MaxBatchRecipients = 100
+
+var ErrInvalidRecipient = errors.New("invalid email address")
+
+// Outcomes of queueing one recipient of a batch
+const (
+	RecipientQueued    = "queued"
+	RecipientScheduled = "scheduled"
+	RecipientFailed    = "failed"
+)
+
+// BatchRecipient is one recipient of a batch send. Data is merged over the
+// batch's shared data, so it only needs the values that differ per person,
+// and Locale replaces the batch's when set.
+type BatchRecipient struct {
+	Email  string                 `json:"email"`
+	Locale string                 `json:"locale,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+type RecipientResult struct {
+	Recipient string `json:"recipient"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	// LogID is the log of a scheduled email, which cancels it
+	LogID uint `json:"log_id,omitempty"`
+
+	err error
+}
+
+// Err is why the recipient failed, or nil if it was queued
+func (r RecipientResult) Err() error {
+	return r.err
+}
+
+// ValidateRecipient rejects addresses that are obviously malformed, so they
+// fail when queued instead of bouncing at the SMTP server later. Only bare
+// addresses are accepted, without a display name.
+func ValidateRecipient(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != strings.TrimSpace(email) {
+		return ErrInvalidRecipient
+	}
+	_, domain, _ := strings.Cut(addr.Address, "@")
+	if domain == "" || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") || strings.Contains(domain, "..") {
+		return ErrInvalidRecipient
+	}
+	return nil
+}
+
+// QueueBatch queues shared, the job without a recipient, for each recipient
+// as its own job, which the worker sends and logs separately, or schedules
+// it as Dispatch does if sendAt is set. A recipient that fails validation or
+// cannot be queued does not stop the others; results are in recipient
+// order.
+func (s *EmailService) QueueBatch(shared core.EmailJob, recipients []BatchRecipient, sendAt *time.Time) []RecipientResult {
+	results := make([]RecipientResult, 0, len(recipients))
+	for _, r := range recipients {
+		email := strings.TrimSpace(r.Email)
+		result := RecipientResult{Recipient: email, Status: RecipientQueued}
+
+		err := ValidateRecipient(email)
+		if err == nil {
+			job := shared
+			job.Recipient = email
+			job.Data = mergeData(shared.Data, r.Data)
+			if r.Locale != "" {
+				job.Locale = r.Locale
+			}
+			var scheduled *core.EmailRequestLog
+			scheduled, err = s.Dispatch(job, sendAt)
+			if scheduled != nil {
+				result.Status = RecipientScheduled
+				result.LogID = scheduled.ID
+			}
+		}
+		if err != nil {
+			result.Status = RecipientFailed
+			result.Error = err.Error()
+			result.err = err
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// mergeData returns shared with overrides applied, leaving both maps untouched
+func mergeData(shared, overrides map[string]interface{}) map[string]interface{} {
+	if len(overrides) == 0 {
+		return shared
+	}
+	out := make(map[string]interface{}, len(shared)+len(overrides))
+	for k, v := range shared {
+		out[k] = v
+	}
+	for k, v := range overrides {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// publishedJobs is a MessageQueue that keeps what is published, failing
+// for the recipients in fail
+type publishedJobs struct {
+	core.MessageQueue
+	mu   sync.Mutex
+	jobs []core.EmailJob
+	fail map[string]bool
+}
+
+func (q *publishedJobs) Publish(job core.EmailJob) error {
+	if q.fail[job.Recipient] {
+		return errors.New("broker unavailable")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func TestValidateRecipient(t *testing.T) {
+	for email, valid := range map[string]bool{
+		"ada@example.com":           true,
+		"ada.lovelace+x@uni.edu":    true,
+		"Ada <ada@example.com>":     false,
+		"ada@":                      false,
+		"ada@example..com":          false,
+		"ada@.example.com":          false,
+		"not an address":            false,
+		"ada@example.com, bob@x.io": false,
+	} {
+		if err := ValidateRecipient(email); (err == nil) != valid {
+			t.Errorf("ValidateRecipient(%q) = %v, want valid %v", email, err, valid)
+		}
+	}
+}
+
+func TestQueueBatchReportsEachRecipient(t *testing.T) {
+	repo, db := newTestRepo(t)
+	queue := &publishedJobs{fail: map[string]bool{"down@example.com": true}}
+	svc := NewEmailService(&recordingProvider{}, NewTemplateService(repo), repo, queue, NewScrubber(nil), NewUnsubscribeTokens("secret"), "")
+
+	results := svc.QueueBatch(core.EmailJob{TemplateName: "invite", Category: core.CategoryNotification, Data: map[string]interface{}{"Institute": "Uni", "Name": "colleague"}}, []BatchRecipient{
+		{Email: " ada@example.com ", Data: map[string]interface{}{"Name": "Ada"}},
+		{Email: "broken@"},
+		{Email: "down@example.com"},
+		{Email: "bob@example.com"},
+	}, nil)
+
+	want := []struct{ recipient, status string }{
+		{"ada@example.com", RecipientQueued},
+		{"broken@", RecipientFailed},
+		{"down@example.com", RecipientFailed},
+		{"bob@example.com", RecipientQueued},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		if results[i].Recipient != w.recipient || results[i].Status != w.status {
+			t.Errorf("result %d = %+v, want %s %s", i, results[i], w.recipient, w.status)
+		}
+	}
+	if !errors.Is(results[1].Err(), ErrInvalidRecipient) {
+		t.Errorf("invalid address failed with %v", results[1].Err())
+	}
+
+	if len(queue.jobs) != 2 {
+		t.Fatalf("published %d jobs, want 2", len(queue.jobs))
+	}
+	if queue.jobs[0].Data["Name"] != "Ada" || queue.jobs[0].Data["Institute"] != "Uni" || queue.jobs[1].Data["Name"] != "colleague" {
+		t.Errorf("job data = %v and %v, want per-recipient values over the shared ones", queue.jobs[0].Data, queue.jobs[1].Data)
+	}
+
+	// The one that could not be published is logged as failed
+	var failed int64
+	db.Model(&core.EmailRequestLog{}).Where("status = ?", core.StatusFailed).Count(&failed)
+	if failed != 1 {
+		t.Errorf("%d failed logs, want 1", failed)
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/branding"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+func TestEmailsCarryTheInstitutesBranding(t *testing.T) {
+	var lookups atomic.Int32
+	var failing atomic.Bool
+	identity := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		switch {
+		case failing.Load():
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.URL.Path == "/internal/identity/institutes/inst-1/branding":
+			_, _ = w.Write([]byte(`{"institute_id":"inst-1","logo_url":"https://files.example.com/logo.png","email_footer_html":"<p>Northfield <b>University</b></p>"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(identity.Close)
+
+	repo, _ := newTestRepo(t, &core.EmailSuppression{})
+	templates := NewTemplateService(repo)
+	body := `{{if .branding}}<img src="{{.branding.logo_url}}">{{.branding.email_footer_html}}{{else}}plain{{end}}`
+	if _, err := templates.CreateTemplate("invite", "", "Invite", body, "admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	const ttl = 50 * time.Millisecond
+	resolver := branding.NewResolver(clients.NewIdentity(clients.Config{BaseURL: identity.URL, MaxRetries: -1}), ttl)
+	provider := &recordingProvider{}
+	svc := NewEmailService(provider, templates, repo, nil, NewScrubber(nil), NewUnsubscribeTokens("secret"), "", resolver)
+	send := func(instituteID string) string {
+		t.Helper()
+		if err := svc.SendEmail(core.EmailJob{TemplateName: "invite", Recipient: "ada@example.com", InstituteID: instituteID}); err != nil {
+			t.Fatal(err)
+		}
+		return provider.sent[len(provider.sent)-1]
+	}
+
+	branded := `<img src="https://files.example.com/logo.png"><p>Northfield <b>University</b></p>`
+	for i := 0; i < 3; i++ {
+		if got := send("inst-1"); got != branded {
+			t.Fatalf("email %d = %q, want %q", i+1, got, branded)
+		}
+	}
+	if got := send(""); got != "plain" {
+		t.Errorf("email without an institute = %q", got)
+	}
+	for i := 0; i < 2; i++ {
+		if got := send("unknown"); got != "plain" {
+			t.Errorf("email to an institute identity does not know = %q", got)
+		}
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("identity was asked %d times, want once for each institute", n)
+	}
+
+	// Once the cache is stale, a failing identity leaves the branding known
+	// last in place
+	time.Sleep(ttl)
+	failing.Store(true)
+	if got := send("inst-1"); got != branded {
+		t.Errorf("email while identity fails = %q, want the cached branding", got)
+	}
+	if n := lookups.Load(); n != 3 {
+		t.Errorf("identity was asked %d times, want once more after the TTL", n)
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+)
+
+var ErrInvalidDigest = errors.New("invalid digest subscription")
+
+// DigestRequest creates a digest subscription, or on update changes the
+// fields that are set
+type DigestRequest struct {
+	UserID     string               `json:"user_id"`
+	Email      string               `json:"email"`
+	DigestType string               `json:"digest_type"`
+	Frequency  core.DigestFrequency `json:"frequency"`
+	Hour       *int                 `json:"hour"`
+	Weekday    *int                 `json:"weekday"`
+	Timezone   string               `json:"timezone"`
+	CourseIDs  []string             `json:"course_ids"`
+}
+
+// DigestService manages digest subscriptions and sends the digests that are
+// due, building each with the provider registered for its type
+type DigestService struct {
+	repo      *repository.Repository
+	emailSvc  *EmailService
+	providers map[string]core.DigestProvider
+	// concurrency bounds the digests built at once; buildTimeout bounds one
+	concurrency  int
+	buildTimeout time.Duration
+}
+
+func NewDigestService(repo *repository.Repository, emailSvc *EmailService, providers map[string]core.DigestProvider, concurrency int, buildTimeout time.Duration) *DigestService {
+	return &DigestService{
+		repo:         repo,
+		emailSvc:     emailSvc,
+		providers:    providers,
+		concurrency:  concurrency,
+		buildTimeout: buildTimeout,
+	}
+}
+
+func (s *DigestService) CreateSubscription(req DigestRequest) (*core.DigestSubscription, error) {
+	sub := &core.DigestSubscription{
+		UserID:     strings.TrimSpace(req.UserID),
+		DigestType: req.DigestType,
+		Frequency:  core.DigestDaily,
+		Timezone:   "UTC",
+	}
+	if sub.UserID == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidDigest)
+	}
+	if _, ok := s.providers[sub.DigestType]; !ok {
+		return nil, fmt.Errorf("%w: unknown digest_type %q", ErrInvalidDigest, sub.DigestType)
+	}
+	if req.Email == "" || req.Hour == nil {
+		return nil, fmt.Errorf("%w: email and hour are required", ErrInvalidDigest)
+	}
+	if err := applyDigestRequest(sub, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateDigestSubscription(sub); err != nil {
+		return nil, err
+	}
+	return s.withNextRun(sub), nil
+}
+
+// UpdateSubscription changes the schedule, address or courses. The user and
+// digest type are fixed.
+func (s *DigestService) UpdateSubscription(id uint, req DigestRequest) (*core.DigestSubscription, error) {
+	sub, err := s.repo.GetDigestSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+	if (req.UserID != "" && req.UserID != sub.UserID) || (req.DigestType != "" && req.DigestType != sub.DigestType) {
+		return nil, fmt.Errorf("%w: user_id and digest_type cannot be changed", ErrInvalidDigest)
+	}
+	if err := applyDigestRequest(sub, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateDigestSubscription(sub); err != nil {
+		return nil, err
+	}
+	return s.withNextRun(sub), nil
+}
+
+func (s *DigestService) GetSubscription(id uint) (*core.DigestSubscription, error) {
+	sub, err := s.repo.GetDigestSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.withNextRun(sub), nil
+}
+
+// ListSubscriptions returns every subscription, or only the user's
+func (s *DigestService) ListSubscriptions(userID string) ([]core.DigestSubscription, error) {
+	subs, err := s.repo.ListDigestSubscriptions(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		s.withNextRun(&subs[i])
+	}
+	return subs, nil
+}
+
+func (s *DigestService) DeleteSubscription(id uint) error {
+	return s.repo.DeleteDigestSubscription(id)
+}
+
+// SetOptOut stops or resumes every digest to the user
+func (s *DigestService) SetOptOut(userID string, optedOut bool) error {
+	if optedOut {
+		return s.repo.OptOutOfDigests(userID)
+	}
+	return s.repo.OptInToDigests(userID)
+}
+
+func (s *DigestService) OptedOut(userID string) (bool, error) {
+	return s.repo.HasOptedOutOfDigests(userID)
+}
+
+func (s *DigestService) withNextRun(sub *core.DigestSubscription) *core.DigestSubscription {
+	if next, err := sub.NextRun(time.Now()); err == nil {
+		sub.NextRunAt = &next
+	}
+	return sub
+}
+
+// applyDigestRequest copies the set fields of req onto sub and checks the
+// resulting schedule
+func applyDigestRequest(sub *core.DigestSubscription, req DigestRequest) error {
+	if req.Email != "" {
+		if err := ValidateRecipient(req.Email); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDigest, err)
+		}
+		sub.Email = strings.TrimSpace(req.Email)
+	}
+	if req.Frequency != "" {
+		if !req.Frequency.Valid() {
+			return fmt.Errorf("%w: frequency must be daily or weekly", ErrInvalidDigest)
+		}
+		sub.Frequency = req.Frequency
+	}
+	if req.Hour != nil {
+		if *req.Hour < 0 || *req.Hour > 23 {
+			return fmt.Errorf("%w: hour must be between 0 and 23", ErrInvalidDigest)
+		}
+		sub.Hour = *req.Hour
+	}
+	if req.Weekday != nil {
+		if *req.Weekday < 0 || *req.Weekday > 6 {
+			return fmt.Errorf("%w: weekday must be between 0 (Sunday) and 6", ErrInvalidDigest)
+		}
+		sub.Weekday = *req.Weekday
+	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return fmt.Errorf("%w: unknown timezone %q", ErrInvalidDigest, req.Timezone)
+		}
+		sub.Timezone = req.Timezone
+	}
+	if req.CourseIDs != nil {
+		sub.CourseIDs = req.CourseIDs
+	}
+	return nil
+}
+
+// DispatchDue sends every digest whose run has come up since it was last
+// handled, returning how many were queued. Each run is claimed before its
+// digest is built, so it is sent once however often this is called. A
+// digest that fails is logged and released to be retried on a later call;
+// it does not hold up the others.
+func (s *DigestService) DispatchDue(ctx context.Context, now time.Time) int {
+	subs, err := s.repo.ListActiveDigestSubscriptions()
+	if err != nil {
+		log.Printf("[Email] Failed to list digest subscriptions: %v", err)
+		return 0
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		queued int
+		slots  = make(chan struct{}, s.concurrency)
+	)
+	for i := range subs {
+		sub := &subs[i]
+		run, due, err := sub.Due(now)
+		if err != nil {
+			log.Printf("[Email] Digest subscription %d has an invalid schedule: %v", sub.ID, err)
+			continue
+		}
+		if !due {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return queued
+		case slots <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			sent, err := s.dispatch(ctx, sub, run, now)
+			if err != nil {
+				log.Printf("[Email] Digest %s for user %s failed: %v", sub.DigestType, sub.UserID, err)
+				return
+			}
+			if sent {
+				mu.Lock()
+				queued++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return queued
+}
+
+// dispatch claims the run, builds the digest and queues it. It reports
+// whether an email was queued; a digest with nothing to report is not sent.
+func (s *DigestService) dispatch(ctx context.Context, sub *core.DigestSubscription, run, now time.Time) (bool, error) {
+	provider, ok := s.providers[sub.DigestType]
+	if !ok {
+		return false, fmt.Errorf("no provider for digest type %q", sub.DigestType)
+	}
+
+	// Postgres keeps microseconds; the claim is matched on this value when released
+	handledAt := now.UTC().Truncate(time.Microsecond)
+	claimed, err := s.repo.ClaimDigestRun(sub.ID, run, handledAt)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	buildCtx, cancel := context.WithTimeout(ctx, s.buildTimeout)
+	defer cancel()
+	data, err := provider.Build(buildCtx, sub, now)
+	if err == nil && data != nil {
+		err = s.emailSvc.QueueEmail(core.EmailJob{
+			TemplateName: provider.TemplateName(),
+			Recipient:    sub.Email,
+			Category:     core.CategoryNotification,
+			Data:         data,
+		})
+	}
+	if err != nil {
+		if releaseErr := s.repo.ReleaseDigestRun(sub.ID, handledAt, sub.LastSentAt); releaseErr != nil {
+			log.Printf("[Email] Failed to release digest run of subscription %d: %v", sub.ID, releaseErr)
+		}
+		return false, err
+	}
+	return data != nil, nil
+}
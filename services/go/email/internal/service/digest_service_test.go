@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// scriptedDigest builds a digest for every user except those in empty,
+// failing while fail is set
+type scriptedDigest struct {
+	mu    sync.Mutex
+	fail  bool
+	empty map[string]bool
+	built int
+}
+
+func (p *scriptedDigest) TemplateName() string { return "pending_items_digest" }
+
+func (p *scriptedDigest) Build(_ context.Context, sub *core.DigestSubscription, _ time.Time) (map[string]interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.built++
+	if p.fail {
+		return nil, errors.New("submission service unavailable")
+	}
+	if p.empty[sub.UserID] {
+		return nil, nil
+	}
+	return map[string]interface{}{"Items": []string{"HW1"}}, nil
+}
+
+func newDigestService(t *testing.T) (*DigestService, *scriptedDigest, *publishedJobs) {
+	t.Helper()
+	repo, _ := newTestRepo(t, &core.EmailSuppression{}, &core.DigestSubscription{}, &core.DigestOptOut{})
+	queue := &publishedJobs{}
+	emailSvc := NewEmailService(&recordingProvider{}, NewTemplateService(repo), repo, queue, NewScrubber(nil), NewUnsubscribeTokens("secret"), "")
+	provider := &scriptedDigest{empty: map[string]bool{}}
+	return NewDigestService(repo, emailSvc, map[string]core.DigestProvider{"pending_items": provider}, 2, time.Second), provider, queue
+}
+
+func subscribe(t *testing.T, svc *DigestService, userID string) *core.DigestSubscription {
+	t.Helper()
+	hour := 8
+	sub, err := svc.CreateSubscription(DigestRequest{UserID: userID, Email: userID + "@example.com", DigestType: "pending_items", Hour: &hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func TestDigestSentOncePerRun(t *testing.T) {
+	svc, provider, queue := newDigestService(t)
+	sub := subscribe(t, svc, "ada")
+	subscribe(t, svc, "bob")
+	provider.empty["bob"] = true
+
+	// The day after subscribing, past the 08:00 run
+	now := time.Date(sub.CreatedAt.Year(), sub.CreatedAt.Month(), sub.CreatedAt.Day()+1, 9, 0, 0, 0, time.UTC)
+	if n := svc.DispatchDue(context.Background(), now); n != 1 {
+		t.Fatalf("queued %d digests, want only the one with something to report", n)
+	}
+	if n := svc.DispatchDue(context.Background(), now.Add(time.Minute)); n != 0 {
+		t.Errorf("queued %d digests on the next tick, want the run handled already", n)
+	}
+	if provider.built != 2 {
+		t.Errorf("built %d digests, want each run built once", provider.built)
+	}
+	if len(queue.jobs) != 1 || queue.jobs[0].Recipient != "ada@example.com" || queue.jobs[0].Category != core.CategoryNotification {
+		t.Errorf("queued %+v", queue.jobs)
+	}
+}
+
+func TestFailedDigestIsRetried(t *testing.T) {
+	svc, provider, queue := newDigestService(t)
+	sub := subscribe(t, svc, "ada")
+	now := time.Date(sub.CreatedAt.Year(), sub.CreatedAt.Month(), sub.CreatedAt.Day()+1, 9, 0, 0, 0, time.UTC)
+
+	provider.fail = true
+	if n := svc.DispatchDue(context.Background(), now); n != 0 {
+		t.Fatalf("queued %d digests while the build fails", n)
+	}
+	provider.fail = false
+	if n := svc.DispatchDue(context.Background(), now.Add(time.Minute)); n != 1 || len(queue.jobs) != 1 {
+		t.Errorf("queued %d digests once the build works, want the released run retried", n)
+	}
+}
+
+func TestOptedOutUserGetsNoDigests(t *testing.T) {
+	svc, _, queue := newDigestService(t)
+	sub := subscribe(t, svc, "ada")
+	if err := svc.SetOptOut("ada", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SetOptOut("ada", true); err != nil {
+		t.Fatalf("opting out twice: %v", err)
+	}
+
+	now := time.Date(sub.CreatedAt.Year(), sub.CreatedAt.Month(), sub.CreatedAt.Day()+1, 9, 0, 0, 0, time.UTC)
+	if n := svc.DispatchDue(context.Background(), now); n != 0 || len(queue.jobs) != 0 {
+		t.Fatalf("queued %d digests to a user who opted out", n)
+	}
+
+	// Opting back in keeps the subscription
+	if err := svc.SetOptOut("ada", false); err != nil {
+		t.Fatal(err)
+	}
+	if n := svc.DispatchDue(context.Background(), now); n != 1 {
+		t.Errorf("queued %d digests after opting back in, want 1", n)
+	}
+}
+
+func TestDigestRequestValidation(t *testing.T) {
+	svc, _, _ := newDigestService(t)
+	hour, badHour, badDay := 8, 24, 7
+	for name, req := range map[string]DigestRequest{
+		"unknown type": {UserID: "ada", Email: "ada@example.com", DigestType: "grades", Hour: &hour},
+		"no hour":      {UserID: "ada", Email: "ada@example.com", DigestType: "pending_items"},
+		"bad hour":     {UserID: "ada", Email: "ada@example.com", DigestType: "pending_items", Hour: &badHour},
+		"bad weekday":  {UserID: "ada", Email: "ada@example.com", DigestType: "pending_items", Hour: &hour, Frequency: core.DigestWeekly, Weekday: &badDay},
+		"bad timezone": {UserID: "ada", Email: "ada@example.com", DigestType: "pending_items", Hour: &hour, Timezone: "Mars/Olympus"},
+		"bad email":    {UserID: "ada", Email: "ada@", DigestType: "pending_items", Hour: &hour},
+	} {
+		if _, err := svc.CreateSubscription(req); !errors.Is(err, ErrInvalidDigest) {
+			t.Errorf("%s: err = %v, want ErrInvalidDigest", name, err)
+		}
+	}
+}
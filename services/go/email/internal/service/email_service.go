@@ -1,11 +1,15 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/4yrg/gradeloop-core/libs/pagination"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
 )
@@ -14,38 +18,131 @@ type EmailService struct {
 	provider    core.EmailProvider
 	templateSvc core.TemplateService
 	repo        *repository.Repository
+	queue       core.MessageQueue
+	scrubber    *Scrubber
+	tokens      *UnsubscribeTokens
+	resolvers   []core.VariableResolver
+	// unsubscribeURL is the public unsubscribe endpoint tokens are appended to
+	unsubscribeURL string
 }
 
-func NewEmailService(provider core.EmailProvider, templateSvc core.TemplateService, repo *repository.Repository) *EmailService {
+func NewEmailService(provider core.EmailProvider, templateSvc core.TemplateService, repo *repository.Repository, queue core.MessageQueue, scrubber *Scrubber, tokens *UnsubscribeTokens, unsubscribeURL string, resolvers ...core.VariableResolver) *EmailService {
 	return &EmailService{
-		provider:    provider,
-		templateSvc: templateSvc,
-		repo:        repo,
+		provider:       provider,
+		templateSvc:    templateSvc,
+		repo:           repo,
+		queue:          queue,
+		scrubber:       scrubber,
+		tokens:         tokens,
+		unsubscribeURL: unsubscribeURL,
+		resolvers:      resolvers,
 	}
 }
 
-func (s *EmailService) SendEmail(templateName string, recipient string, data map[string]interface{}) error {
-	// 1. Log request (pending)
-	payloadBytes, _ := json.Marshal(data)
+// QueueEmail hands a templated email to the worker pool instead of sending
+// inline. The email is logged as pending and queued under that log, unless
+// it already has one, as a scheduled email does.
+func (s *EmailService) QueueEmail(job core.EmailJob) error {
+	if job.Category == "" {
+		job.Category = core.CategoryTransactional
+	}
+	if job.LogID != 0 {
+		return s.queue.Publish(job)
+	}
+
+	payloadBytes, _ := json.Marshal(s.scrubber.Scrub(job.Data))
+	payload := string(payloadBytes)
 	reqLog := &core.EmailRequestLog{
-		TemplateName:   templateName,
-		RecipientEmail: recipient,
-		Payload:        string(payloadBytes),
+		TemplateName:   job.TemplateName,
+		RecipientEmail: job.Recipient,
+		Category:       job.Category,
+		Payload:        &payload,
 		Status:         core.StatusPending,
 		CreatedAt:      time.Now(),
 	}
 	if err := s.repo.CreateRequestLog(reqLog); err != nil {
-		log.Printf("Failed to create request log: %v", err)
-		// Proceed anyway? Or fail? Fail is safer for audit.
-		return fmt.Errorf("failed to log request: %w", err)
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	job.LogID = reqLog.ID
+	if err := s.queue.Publish(job); err != nil {
+		s.failLog(reqLog, fmt.Sprintf("Queue error: %v", err))
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	return nil
+}
+
+// SendEmail renders and sends a templated email in the job's locale, falling
+// back to its default locale and then the base one. Non-transactional mail
+// to a recipient who unsubscribed from its category is dropped without an
+// error and logged as suppressed; otherwise the template gets an
+// unsubscribe_url. A queued or scheduled email is sent under its own log,
+// and not at all if that log shows it was sent already.
+func (s *EmailService) SendEmail(job core.EmailJob) error {
+	templateName, recipient, category, data := job.TemplateName, job.Recipient, job.Category, job.Data
+	if category == "" {
+		category = core.CategoryTransactional
+	}
+	// 1. Log request (pending), with secrets redacted before they reach the DB
+	var reqLog *core.EmailRequestLog
+	if job.LogID != 0 {
+		queued, err := s.repo.GetRequestLog(job.LogID)
+		if err != nil {
+			return fmt.Errorf("failed to load queued email: %w", err)
+		}
+		if queued.Status != core.StatusPending {
+			// Delivered again after an earlier delivery sent it
+			return nil
+		}
+		reqLog = queued
+		reqLog.Job = nil
+	} else {
+		payloadBytes, _ := json.Marshal(s.scrubber.Scrub(data))
+		payload := string(payloadBytes)
+		reqLog = &core.EmailRequestLog{
+			TemplateName:   templateName,
+			RecipientEmail: recipient,
+			Category:       category,
+			Payload:        &payload,
+			Status:         core.StatusPending,
+			CreatedAt:      time.Now(),
+		}
+	}
+
+	if category != core.CategoryTransactional {
+		// Fail closed: better to miss a digest than mail someone who opted out
+		suppressed, err := s.repo.IsSuppressed(normalizeEmail(recipient), category)
+		if err != nil {
+			return fmt.Errorf("failed to check suppression list: %w", err)
+		}
+		if suppressed {
+			reqLog.Status = core.StatusSuppressed
+			if err := s.saveRequestLog(reqLog); err != nil {
+				return fmt.Errorf("failed to log request: %w", err)
+			}
+			return nil
+		}
+		data = s.withUnsubscribeURL(data, recipient, category)
+	} else if bounced, err := s.repo.HasBounced(normalizeEmail(recipient)); err == nil && bounced {
+		// Transactional mail is still sent, but will most likely bounce again
+		log.Printf("[Email] Warning: sending %s to %s, which has hard-bounced before", templateName, recipient)
+	}
+	data = s.withResolvedVariables(job, data)
+
+	if reqLog.ID == 0 {
+		if err := s.repo.CreateRequestLog(reqLog); err != nil {
+			log.Printf("Failed to create request log: %v", err)
+			// Proceed anyway? Or fail? Fail is safer for audit.
+			return fmt.Errorf("failed to log request: %w", err)
+		}
 	}
 
 	// 2. Get Template
-	tmpl, err := s.templateSvc.GetTemplate(templateName)
+	tmpl, err := s.templateSvc.GetTemplate(templateName, job.Locale, job.DefaultLocale)
 	if err != nil {
 		s.failLog(reqLog, fmt.Sprintf("Template error: %v", err))
 		return err
 	}
+	reqLog.Locale = tmpl.Locale
 
 	// 3. Render
 	body, err := s.templateSvc.Render(tmpl, data)
@@ -55,20 +152,68 @@ func (s *EmailService) SendEmail(templateName string, recipient string, data map
 	}
 
 	// 4. Send
-	if err := s.provider.SendEmail([]string{recipient}, tmpl.Subject, body); err != nil {
+	messageID, err := s.provider.SendEmail([]string{recipient}, tmpl.Subject, body)
+	if err != nil {
 		s.failLog(reqLog, fmt.Sprintf("Provider error: %v", err))
 		return err
 	}
 
-	// 5. Update Log (Sent)
+	// 5. Update Log (Sent), keeping the ID delivery webhooks will refer to
 	now := time.Now()
 	reqLog.Status = core.StatusSent
 	reqLog.SentAt = &now
+	reqLog.ProviderMessageID = &messageID
 	s.repo.UpdateRequestLog(reqLog)
 
 	return nil
 }
 
+// withUnsubscribeURL returns a copy of data with the recipient's
+// unsubscribe link added, leaving the caller's map untouched
+func (s *EmailService) withUnsubscribeURL(data map[string]interface{}, recipient string, category core.Category) map[string]interface{} {
+	out := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		out[k] = v
+	}
+	out["unsubscribe_url"] = s.unsubscribeURL + "?token=" + url.QueryEscape(s.tokens.Sign(recipient, category))
+	return out
+}
+
+// withResolvedVariables returns a copy of data with the variables of every
+// resolver added, unless data already has them. A resolver that fails is
+// logged and skipped; the email is still worth sending without, say, the
+// institute's logo.
+func (s *EmailService) withResolvedVariables(job core.EmailJob, data map[string]interface{}) map[string]interface{} {
+	if len(s.resolvers) == 0 {
+		return data
+	}
+	out := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		out[k] = v
+	}
+	for _, resolver := range s.resolvers {
+		vars, err := resolver.Resolve(context.Background(), job)
+		if err != nil {
+			log.Printf("[Email] Failed to resolve template variables of %s to %s: %v", job.TemplateName, job.Recipient, err)
+			continue
+		}
+		for k, v := range vars {
+			if _, ok := out[k]; !ok {
+				out[k] = v
+			}
+		}
+	}
+	return out
+}
+
+// saveRequestLog creates reqLog, or updates it if it is a queued email's
+func (s *EmailService) saveRequestLog(reqLog *core.EmailRequestLog) error {
+	if reqLog.ID == 0 {
+		return s.repo.CreateRequestLog(reqLog)
+	}
+	return s.repo.UpdateRequestLog(reqLog)
+}
+
 func (s *EmailService) failLog(reqLog *core.EmailRequestLog, msg string) {
 	reqLog.Status = core.StatusFailed
 	reqLog.ErrorMessage = &msg
@@ -77,7 +222,7 @@ func (s *EmailService) failLog(reqLog *core.EmailRequestLog, msg string) {
 
 func (s *EmailService) SendRaw(to, subject, body string) error {
 	log.Printf("[Email] Attempting to send email to: %s, subject: %s", to, subject)
-	err := s.provider.SendEmail([]string{to}, subject, body)
+	_, err := s.provider.SendEmail([]string{to}, subject, body)
 	if err != nil {
 		log.Printf("[Email] Failed to send email: %v", err)
 		return err
@@ -86,6 +231,74 @@ func (s *EmailService) SendRaw(to, subject, body string) error {
 	return nil
 }
 
-func (s *EmailService) GetLogs() ([]core.EmailRequestLog, error) {
-	return s.repo.GetEmailLogs()
+// GetLogs returns a page of the request logs matching filter
+func (s *EmailService) GetLogs(filter repository.LogFilter, page pagination.Request) (pagination.Page[core.EmailRequestLog], error) {
+	logs, err := s.repo.GetEmailLogs(filter, page)
+	if err != nil {
+		return pagination.Page[core.EmailRequestLog]{}, err
+	}
+	for i := range logs {
+		s.scrubLog(&logs[i])
+	}
+	return pagination.NewPage(logs, page.Limit, func(l core.EmailRequestLog) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: l.CreatedAt, ID: strconv.FormatUint(uint64(l.ID), 10)}
+	}), nil
+}
+
+// LogSummary counts the request logs matching a filter
+type LogSummary struct {
+	Total    int64                        `json:"total"`
+	ByStatus map[core.RequestStatus]int64 `json:"by_status"`
+}
+
+// SummarizeLogs counts the request logs matching filter, in total and by
+// status
+func (s *EmailService) SummarizeLogs(filter repository.LogFilter) (*LogSummary, error) {
+	counts, err := s.repo.CountEmailLogs(filter)
+	if err != nil {
+		return nil, err
+	}
+	summary := &LogSummary{ByStatus: counts}
+	for _, n := range counts {
+		summary.Total += n
+	}
+	return summary, nil
+}
+
+// GetLog returns a single request log. The payload is scrubbed again on the
+// way out so redacted values are never shown, whoever asks.
+func (s *EmailService) GetLog(id uint) (*core.EmailRequestLog, error) {
+	reqLog, err := s.repo.GetRequestLog(id)
+	if err != nil {
+		return nil, err
+	}
+	s.scrubLog(reqLog)
+	return reqLog, nil
+}
+
+func (s *EmailService) scrubLog(reqLog *core.EmailRequestLog) {
+	if reqLog.Payload != nil {
+		scrubbed := s.scrubber.ScrubJSON(*reqLog.Payload)
+		reqLog.Payload = &scrubbed
+	}
+}
+
+// Unsubscribe adds the recipient in token to the suppression list for the
+// token's category
+func (s *EmailService) Unsubscribe(token string) (core.Category, error) {
+	email, category, err := s.tokens.Verify(token)
+	if err != nil {
+		return "", err
+	}
+	return category, s.repo.AddSuppression(email, category, core.ReasonUnsubscribed)
+}
+
+// ListSuppressions returns suppressions, optionally filtered by email and category
+func (s *EmailService) ListSuppressions(email string, category core.Category) ([]core.EmailSuppression, error) {
+	return s.repo.ListSuppressions(normalizeEmail(email), category)
+}
+
+// RemoveSuppression lets the address receive the suppressed category again
+func (s *EmailService) RemoveSuppression(id uint) error {
+	return s.repo.DeleteSuppression(id)
 }
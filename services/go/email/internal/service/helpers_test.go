@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestRepo returns a repository over an in-memory SQLite database holding
+// the template and request log tables, plus any extra models a test needs
+func newTestRepo(t *testing.T, models ...interface{}) (*repository.Repository, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	tables := []interface{}{&core.EmailTemplate{}, &core.EmailTemplateVersion{}, &core.EmailRequestLog{}}
+	if err := db.AutoMigrate(append(tables, models...)...); err != nil {
+		t.Fatal(err)
+	}
+	return repository.NewRepository(db), db
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"database/sql/driver"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+	gosqlite "github.com/glebarez/go-sqlite"
+)
+
+// Postgres' reverse, which the recipient domain filter matches with
+func init() {
+	gosqlite.MustRegisterDeterministicScalarFunction("reverse", 1, func(_ *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		s, _ := args[0].(string)
+		runes := []rune(s)
+		slices.Reverse(runes)
+		return string(runes), nil
+	})
+}
+
+func TestLogFilters(t *testing.T) {
+	repo, db := newTestRepo(t)
+	svc := NewEmailService(&recordingProvider{}, NewTemplateService(repo), repo, nil, NewScrubber([]string{"password"}), NewUnsubscribeTokens("secret"), "")
+	tuesday := time.Date(2026, 10, 13, 9, 0, 0, 0, time.UTC)
+	text := func(s string) *string { return &s }
+	seeded := []core.EmailRequestLog{
+		{RecipientEmail: "jane@x.edu", TemplateName: "welcome", Status: core.StatusSent, CreatedAt: tuesday.Add(-24 * time.Hour), Payload: text(`{"name":"Jane","password":"hunter2"}`)},
+		{RecipientEmail: "jane@x.edu", TemplateName: "reset", Status: core.StatusFailed, CreatedAt: tuesday, ErrorMessage: text("550 mailbox full")},
+		{RecipientEmail: "JANE@X.EDU", TemplateName: "welcome", Status: core.StatusBounced, CreatedAt: tuesday.Add(time.Hour)},
+		{RecipientEmail: "bob@mail.x.edu", TemplateName: "welcome", Status: core.StatusFailed, CreatedAt: tuesday.Add(2 * time.Hour), ErrorMessage: text("Mailbox unavailable: full")},
+		{RecipientEmail: "amy@notx.edu", TemplateName: "welcome", Status: core.StatusSent, CreatedAt: tuesday.Add(3 * time.Hour)},
+		{RecipientEmail: "carl@x.edu.example.com", TemplateName: "reset", Status: core.StatusFailed, CreatedAt: tuesday.Add(4 * time.Hour), ErrorMessage: text("connection timeout")},
+		{RecipientEmail: "jane@x.edu", TemplateName: "welcome", Status: core.StatusSent, CreatedAt: tuesday.Add(48 * time.Hour)},
+	}
+	for i := range seeded {
+		if err := db.Create(&seeded[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// ids returns the IDs of the seeded logs numbered n, newest first
+	ids := func(n ...int) []uint {
+		var out []uint
+		for _, i := range n {
+			out = append(out, seeded[i-1].ID)
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter repository.LogFilter
+		want   []uint
+	}{
+		{"recipient, any case", repository.LogFilter{Recipient: "Jane@X.edu"}, ids(7, 3, 2, 1)},
+		{"recipient on the day", repository.LogFilter{Recipient: "jane@x.edu", From: tuesday, To: tuesday.Add(24 * time.Hour)}, ids(3, 2)},
+		{"before a time", repository.LogFilter{To: tuesday}, ids(1)},
+		{"domain and its subdomains", repository.LogFilter{RecipientDomain: "X.edu"}, ids(7, 4, 3, 2, 1)},
+		{"subdomain", repository.LogFilter{RecipientDomain: "mail.x.edu"}, ids(4)},
+		{"domain and status", repository.LogFilter{RecipientDomain: "x.edu", Status: core.StatusSent}, ids(7, 1)},
+		{"template and status", repository.LogFilter{TemplateName: "reset", Status: core.StatusFailed}, ids(6, 2)},
+		{"error words in any order", repository.LogFilter{ErrorText: "full Mailbox"}, ids(4, 2)},
+		{"error, domain and template", repository.LogFilter{ErrorText: "full", RecipientDomain: "x.edu", TemplateName: "welcome"}, ids(4)},
+		{"nothing matches", repository.LogFilter{Recipient: "jane@x.edu", Status: core.StatusComplained}, nil},
+	} {
+		page, err := svc.GetLogs(tc.filter, pagination.Request{Limit: 50})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got []uint
+		for _, l := range page.Items {
+			got = append(got, l.ID)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got logs %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// A recipient's history a page at a time, with payloads scrubbed
+	var history []uint
+	page, err := svc.GetLogs(repository.LogFilter{Recipient: "jane@x.edu"}, pagination.Request{Limit: 2})
+	for {
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range page.Items {
+			history = append(history, l.ID)
+			if l.Payload != nil && (strings.Contains(*l.Payload, "hunter2") || !strings.Contains(*l.Payload, Redacted)) {
+				t.Errorf("log %d has payload %s, want the password redacted", l.ID, *l.Payload)
+			}
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		after, decodeErr := pagination.Decode(*page.NextCursor)
+		if decodeErr != nil {
+			t.Fatal(decodeErr)
+		}
+		page, err = svc.GetLogs(repository.LogFilter{Recipient: "jane@x.edu"}, pagination.Request{Limit: 2, After: &after})
+	}
+	if !slices.Equal(history, ids(7, 3, 2, 1)) {
+		t.Errorf("paged through %v, want %v", history, ids(7, 3, 2, 1))
+	}
+}
+
+func TestLogSummaryCountsByStatus(t *testing.T) {
+	repo, db := newTestRepo(t)
+	svc := NewEmailService(&recordingProvider{}, NewTemplateService(repo), repo, nil, NewScrubber(nil), NewUnsubscribeTokens("secret"), "")
+	now := time.Now().UTC()
+	for i, l := range []struct {
+		to     string
+		status core.RequestStatus
+	}{
+		{"a@x.edu", core.StatusSent}, {"b@x.edu", core.StatusSent}, {"c@lab.x.edu", core.StatusSent},
+		{"d@x.edu", core.StatusFailed}, {"e@x.edu", core.StatusBounced},
+		{"f@y.edu", core.StatusFailed},
+	} {
+		reqLog := &core.EmailRequestLog{RecipientEmail: l.to, TemplateName: "welcome", Status: l.status, CreatedAt: now.Add(time.Duration(i) * time.Second)}
+		if err := db.Create(reqLog).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := svc.SummarizeLogs(repository.LogFilter{RecipientDomain: "x.edu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[core.RequestStatus]int64{core.StatusSent: 3, core.StatusFailed: 1, core.StatusBounced: 1}
+	if summary.Total != 5 || len(summary.ByStatus) != len(want) {
+		t.Fatalf("summary = %+v, want 5 in total, %v", summary, want)
+	}
+	for status, n := range want {
+		if summary.ByStatus[status] != n {
+			t.Errorf("%d %s, want %d", summary.ByStatus[status], status, n)
+		}
+	}
+
+	summary, err = svc.SummarizeLogs(repository.LogFilter{Status: core.StatusFailed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 2 || summary.ByStatus[core.StatusFailed] != 2 || len(summary.ByStatus) != 1 {
+		t.Errorf("failed summary = %+v, want the 2 failed only", summary)
+	}
+}
@@ -1,16 +1,41 @@
 package provider
 
 import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
 )
 
+// SMTPProvider keeps idle connections to the SMTP server and reuses them for
+// later sends, so a burst of mail is not a burst of TLS handshakes and
+// logins. A connection is closed once it has sent SMTPMaxMessagesPerConn
+// messages or sat idle for SMTPIdleTimeout. It is safe to share between
+// concurrent workers; each send has a connection to itself.
 type SMTPProvider struct {
 	config *core.Config
 	auth   smtp.Auth
+
+	mu   sync.Mutex
+	idle []*smtpConn
+	// maxIdle bounds the idle connections kept, one per worker
+	maxIdle int
+}
+
+// smtpConn is a connection with the messages it has sent
+type smtpConn struct {
+	client *smtp.Client
+	sent   int
+	idleAt time.Time
 }
 
 func NewSMTPProvider(cfg *core.Config) *SMTPProvider {
@@ -21,22 +46,29 @@ func NewSMTPProvider(cfg *core.Config) *SMTPProvider {
 
 	auth := smtp.PlainAuth("", cfg.SMTPUsername, cleanPass, cfg.SMTPHost)
 	return &SMTPProvider{
-		config: cfg,
-		auth:   auth,
+		config:  cfg,
+		auth:    auth,
+		maxIdle: max(cfg.WorkerConcurrency, 1),
 	}
 }
 
-func (p *SMTPProvider) SendEmail(to []string, subject string, body string) error {
-	addr := fmt.Sprintf("%s:%d", p.config.SMTPHost, p.config.SMTPPort)
-
+// SendEmail returns the Message-ID header it gave the email, without angle
+// brackets. Relays such as SendGrid and SES report it in their delivery
+// webhooks.
+func (p *SMTPProvider) SendEmail(to []string, subject string, body string) (string, error) {
 	contentType := "text/html; charset=\"UTF-8\""
+	messageID, err := p.newMessageID()
+	if err != nil {
+		return "", err
+	}
 
 	msg := []byte(fmt.Sprintf("To: %s\r\n"+
 		"Subject: %s\r\n"+
+		"Message-ID: <%s>\r\n"+
 		"MIME-Version: 1.0\r\n"+
 		"Content-Type: %s\r\n"+
 		"\r\n"+
-		"%s\r\n", to[0], subject, contentType, body))
+		"%s\r\n", to[0], subject, messageID, contentType, body))
 
 	if p.config.SMTPUsername == "" {
 		// If auth is not provided we might want to skip authentication
@@ -45,10 +77,160 @@ func (p *SMTPProvider) SendEmail(to []string, subject string, body string) error
 		// For now keeping consistent behavior with previous valid auth requirement.
 	}
 
-	err := smtp.SendMail(addr, p.auth, p.config.SMTPFrom, to, msg)
+	if err := p.send(to, msg); err != nil {
+		return "", fmt.Errorf("failed to send email via SMTP: %w", err)
+	}
+
+	return messageID, nil
+}
+
+// send sends msg over an idle connection, or a new one if there is none. The
+// server may have dropped an idle connection in the meantime, so if one
+// breaks before the message was handed over it is sent again over a new
+// connection.
+func (p *SMTPProvider) send(to []string, msg []byte) error {
+	if conn := p.take(); conn != nil {
+		sent, err := p.transmit(conn, to, msg)
+		if err == nil || sent || !connectionLost(err) {
+			return err
+		}
+	}
+
+	client, err := p.dial()
 	if err != nil {
-		return fmt.Errorf("failed to send email via SMTP: %w", err)
+		return err
 	}
+	_, err = p.transmit(&smtpConn{client: client}, to, msg)
+	return err
+}
 
+// transmit sends one message over conn, then returns conn to the idle pool
+// or closes it. sent reports whether the server may have taken the message,
+// in which case it must not be sent again.
+func (p *SMTPProvider) transmit(conn *smtpConn, to []string, msg []byte) (sent bool, err error) {
+	c := conn.client
+	if err := c.Mail(p.config.SMTPFrom); err != nil {
+		c.Close()
+		return false, err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			p.release(conn, c.Reset())
+			return false, err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		c.Close()
+		return false, err
+	}
+	if _, err := w.Write(msg); err != nil {
+		c.Close()
+		return true, err
+	}
+	if err := w.Close(); err != nil {
+		c.Close()
+		return true, err
+	}
+
+	conn.sent++
+	p.release(conn, nil)
+	return true, nil
+}
+
+// connectionLost reports whether err means the connection is gone rather
+// than the server refusing the message: an I/O error, or 421, which servers
+// answer with when they close an idle connection
+func connectionLost(err error) bool {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code == 421
+	}
+	return true
+}
+
+// dial opens a connection the way smtp.SendMail does: STARTTLS if the
+// server offers it, then AUTH if it supports it
+func (p *SMTPProvider) dial() (*smtp.Client, error) {
+	c, err := smtp.Dial(fmt.Sprintf("%s:%d", p.config.SMTPHost, p.config.SMTPPort))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Hello("localhost"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: p.config.SMTPHost}); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if ok, _ := c.Extension("AUTH"); ok && p.auth != nil {
+		if err := c.Auth(p.auth); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// take returns the most recently used idle connection that has not timed
+// out, closing any that have
+func (p *SMTPProvider) take() *smtpConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.idle) > 0 {
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if time.Since(conn.idleAt) < p.config.SMTPIdleTimeout {
+			return conn
+		}
+		go conn.client.Quit()
+	}
 	return nil
 }
+
+// release puts conn back in the idle pool unless it failed, is used up or
+// the pool is full, in which case it is closed
+func (p *SMTPProvider) release(conn *smtpConn, err error) {
+	if err != nil || p.config.SMTPIdleTimeout <= 0 || conn.sent >= p.config.SMTPMaxMessagesPerConn {
+		go conn.client.Quit()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) >= p.maxIdle {
+		go conn.client.Quit()
+		return
+	}
+	conn.idleAt = time.Now()
+	p.idle = append(p.idle, conn)
+}
+
+// Close quits every idle connection
+func (p *SMTPProvider) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, conn := range idle {
+		_ = conn.client.Quit()
+	}
+}
+
+// newMessageID returns a random ID in the domain of the sender address
+func (p *SMTPProvider) newMessageID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate message ID: %w", err)
+	}
+	domain := "localhost"
+	if from, err := mail.ParseAddress(p.config.SMTPFrom); err == nil {
+		if _, d, ok := strings.Cut(from.Address, "@"); ok {
+			domain = d
+		}
+	}
+	return hex.EncodeToString(buf) + "@" + domain, nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// MinScheduleLead is how far ahead send_at must be for an email to be
+// scheduled. One due sooner, or in the past, is queued straight away.
+const MinScheduleLead = time.Minute
+
+// scheduleClaimBatch is how many due emails one claim moves to the queue
+const scheduleClaimBatch = 100
+
+// Dispatch queues job now, or stores it to be queued at sendAt if that is at
+// least MinScheduleLead ahead. It returns the log of a scheduled email, and
+// nil for one queued now, which is logged when it is sent.
+func (s *EmailService) Dispatch(job core.EmailJob, sendAt *time.Time) (*core.EmailRequestLog, error) {
+	if sendAt == nil || time.Until(*sendAt) < MinScheduleLead {
+		return nil, s.QueueEmail(job)
+	}
+	return s.ScheduleEmail(job, *sendAt)
+}
+
+// ScheduleEmail stores job to be queued at sendAt and returns its log, with
+// status scheduled. The job is sent under that log rather than a new one.
+func (s *EmailService) ScheduleEmail(job core.EmailJob, sendAt time.Time) (*core.EmailRequestLog, error) {
+	if job.Category == "" {
+		job.Category = core.CategoryTransactional
+	}
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	jobJSON := string(jobBytes)
+	payloadBytes, _ := json.Marshal(s.scrubber.Scrub(job.Data))
+	payload := string(payloadBytes)
+	sendAt = sendAt.UTC()
+
+	reqLog := &core.EmailRequestLog{
+		TemplateName:   job.TemplateName,
+		RecipientEmail: job.Recipient,
+		Category:       job.Category,
+		Payload:        &payload,
+		Status:         core.StatusScheduled,
+		CreatedAt:      time.Now(),
+		SendAt:         &sendAt,
+		Job:            &jobJSON,
+	}
+	if err := s.repo.CreateRequestLog(reqLog); err != nil {
+		return nil, fmt.Errorf("failed to schedule email: %w", err)
+	}
+	return reqLog, nil
+}
+
+// CancelScheduled cancels a scheduled email that has not been queued yet
+func (s *EmailService) CancelScheduled(id uint) error {
+	return s.repo.CancelScheduledEmail(id)
+}
+
+// QueueDueEmails claims the scheduled emails due at now, and those claimed
+// before staleBefore but never sent, and puts them on the send queue. It
+// returns how many were queued. An email that cannot be queued is put back
+// to be claimed on the next run.
+func (s *EmailService) QueueDueEmails(now, staleBefore time.Time) (int, error) {
+	queued := 0
+	for {
+		claimed, err := s.repo.ClaimDueEmails(now, staleBefore, scheduleClaimBatch)
+		if err != nil {
+			return queued, err
+		}
+		for i := range claimed {
+			reqLog := &claimed[i]
+			var job core.EmailJob
+			if reqLog.Job == nil || json.Unmarshal([]byte(*reqLog.Job), &job) != nil {
+				reqLog.Job = nil
+				s.failLog(reqLog, "Scheduled email has no readable job")
+				continue
+			}
+			job.LogID = reqLog.ID
+			if err := s.QueueEmail(job); err != nil {
+				if releaseErr := s.repo.ReleaseClaimedEmail(reqLog.ID, *reqLog.ClaimedAt); releaseErr != nil {
+					log.Printf("[Email] Failed to release scheduled email %d: %v", reqLog.ID, releaseErr)
+				}
+				return queued, err
+			}
+			queued++
+		}
+		if len(claimed) < scheduleClaimBatch {
+			return queued, nil
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+)
+
+// newScheduleService returns an EmailService publishing to its own queue
+// over repo, as one instance of the service
+func newScheduleService(repo *repository.Repository) (*EmailService, *publishedJobs) {
+	queue := &publishedJobs{}
+	return NewEmailService(&recordingProvider{}, NewTemplateService(repo), repo, queue, NewScrubber(nil), NewUnsubscribeTokens("secret"), ""), queue
+}
+
+// schedule stores an email to recipient to be sent at sendAt
+func schedule(t *testing.T, svc *EmailService, recipient string, sendAt time.Time) *core.EmailRequestLog {
+	t.Helper()
+	reqLog, err := svc.ScheduleEmail(core.EmailJob{TemplateName: "announcement", Recipient: recipient}, sendAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reqLog
+}
+
+func status(t *testing.T, repo *repository.Repository, id uint) core.RequestStatus {
+	t.Helper()
+	reqLog, err := repo.GetRequestLog(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reqLog.Status
+}
+
+func TestDispatchSchedulesOnlyWellAhead(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	svc, queue := newScheduleService(repo)
+	job := core.EmailJob{TemplateName: "announcement", Recipient: "ada@example.com"}
+
+	for _, sendAt := range []*time.Time{nil, ptr(time.Now().Add(-time.Hour)), ptr(time.Now().Add(30 * time.Second))} {
+		if reqLog, err := svc.Dispatch(job, sendAt); err != nil || reqLog != nil {
+			t.Fatalf("Dispatch at %v = %+v, %v; want it queued now", sendAt, reqLog, err)
+		}
+	}
+	if len(queue.jobs) != 3 {
+		t.Fatalf("queued %d emails, want 3", len(queue.jobs))
+	}
+
+	reqLog, err := svc.Dispatch(job, ptr(time.Now().Add(2*time.Minute)))
+	if err != nil || reqLog == nil || reqLog.Status != core.StatusScheduled {
+		t.Fatalf("Dispatch 2 minutes ahead = %+v, %v; want it scheduled", reqLog, err)
+	}
+	if len(queue.jobs) != 3 {
+		t.Error("a scheduled email was queued straight away")
+	}
+}
+
+func ptr(t time.Time) *time.Time { return &t }
+
+func TestDueEmailsAreQueuedOnceAcrossInstances(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	first, firstQueue := newScheduleService(repo)
+	second, secondQueue := newScheduleService(repo)
+	sendAt := time.Now().Add(time.Hour)
+	const due = 2*scheduleClaimBatch + 10
+	for i := 0; i < due; i++ {
+		schedule(t, first, "ada@example.com", sendAt)
+	}
+	later := schedule(t, first, "bob@example.com", sendAt.Add(time.Hour))
+
+	now := sendAt.Add(time.Second)
+	var wg sync.WaitGroup
+	for _, svc := range []*EmailService{first, second, first, second} {
+		wg.Add(1)
+		go func(svc *EmailService) {
+			defer wg.Done()
+			if _, err := svc.QueueDueEmails(now, now.Add(-time.Hour)); err != nil {
+				t.Error(err)
+			}
+		}(svc)
+	}
+	wg.Wait()
+
+	queued := make(map[uint]int)
+	for _, job := range append(firstQueue.jobs, secondQueue.jobs...) {
+		queued[job.LogID]++
+		if queued[job.LogID] > 1 {
+			t.Errorf("email %d was queued twice", job.LogID)
+		}
+	}
+	if len(queued) != due {
+		t.Errorf("queued %d emails, want the %d due", len(queued), due)
+	}
+	if queued[later.ID] > 0 || status(t, repo, later.ID) != core.StatusScheduled {
+		t.Error("an email not due yet was queued")
+	}
+}
+
+func TestCancelScheduledEmail(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	svc, queue := newScheduleService(repo)
+	sendAt := time.Now().Add(time.Hour)
+	cancelled := schedule(t, svc, "ada@example.com", sendAt)
+	claimed := schedule(t, svc, "bob@example.com", sendAt)
+
+	if err := svc.CancelScheduled(cancelled.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.QueueDueEmails(sendAt, sendAt.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.jobs) != 1 || queue.jobs[0].LogID != claimed.ID {
+		t.Fatalf("queued %+v, want only the email not cancelled", queue.jobs)
+	}
+	if got := status(t, repo, cancelled.ID); got != core.StatusCancelled {
+		t.Errorf("cancelled email is %s", got)
+	}
+
+	if err := svc.CancelScheduled(claimed.ID); !errors.Is(err, core.ErrEmailNotScheduled) {
+		t.Errorf("cancelling a claimed email = %v, want ErrEmailNotScheduled", err)
+	}
+	if err := svc.CancelScheduled(cancelled.ID); !errors.Is(err, core.ErrEmailNotScheduled) {
+		t.Errorf("cancelling twice = %v, want ErrEmailNotScheduled", err)
+	}
+	if err := svc.CancelScheduled(claimed.ID + 100); !errors.Is(err, core.ErrEmailLogNotFound) {
+		t.Errorf("cancelling an unknown email = %v, want ErrEmailLogNotFound", err)
+	}
+}
+
+func TestClaimsOfAStoppedInstanceAreQueuedAgain(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	crashed, _ := newScheduleService(repo)
+	sendAt := time.Now().Add(time.Hour)
+	unsent := schedule(t, crashed, "ada@example.com", sendAt)
+	sent := schedule(t, crashed, "bob@example.com", sendAt)
+
+	// The instance claims both, sends one and stops
+	claimedAt := sendAt.Add(time.Second)
+	if _, err := crashed.QueueDueEmails(claimedAt, claimedAt.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	sentLog, err := repo.GetRequestLog(sent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentLog.Status = core.StatusSent
+	if err := repo.UpdateRequestLog(sentLog); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, queue := newScheduleService(repo)
+	// Within the claim timeout the claim still stands
+	now := claimedAt.Add(time.Minute)
+	if _, err := restarted.QueueDueEmails(now, claimedAt.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.jobs) != 0 {
+		t.Fatalf("requeued %d emails before their claim timed out", len(queue.jobs))
+	}
+	// After it, the unsent email is queued again, once
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Second)
+		if _, err := restarted.QueueDueEmails(now, claimedAt.Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(queue.jobs) != 1 || queue.jobs[0].LogID != unsent.ID {
+		t.Fatalf("requeued %+v, want only the email never sent", queue.jobs)
+	}
+}
+
+func TestEmailsThatCannotBeQueuedStayScheduled(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	svc, queue := newScheduleService(repo)
+	sendAt := time.Now().Add(time.Hour)
+	reqLog := schedule(t, svc, "down@example.com", sendAt)
+
+	queue.fail = map[string]bool{"down@example.com": true}
+	if _, err := svc.QueueDueEmails(sendAt, sendAt.Add(-time.Hour)); err == nil {
+		t.Fatal("QueueDueEmails succeeded with the broker down")
+	}
+	if got := status(t, repo, reqLog.ID); got != core.StatusScheduled {
+		t.Fatalf("email is %s after the broker failed, want scheduled", got)
+	}
+
+	queue.fail = nil
+	if n, err := svc.QueueDueEmails(sendAt, sendAt.Add(-time.Hour)); err != nil || n != 1 {
+		t.Fatalf("QueueDueEmails = %d, %v; want the email queued once the broker is back", n, err)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Redacted replaces the value of every sensitive key in a stored payload
+const Redacted = "[REDACTED]"
+
+// Scrubber redacts sensitive values from email payloads before they are logged
+type Scrubber struct {
+	keys map[string]struct{}
+}
+
+// NewScrubber builds a Scrubber for the given keys, matched case-insensitively
+func NewScrubber(keys []string) *Scrubber {
+	s := &Scrubber{keys: make(map[string]struct{}, len(keys))}
+	for _, key := range keys {
+		s.keys[strings.ToLower(key)] = struct{}{}
+	}
+	return s
+}
+
+// Scrub returns a deep copy of data with sensitive values redacted at any
+// depth. data itself is left untouched since it is still needed to render.
+func (s *Scrubber) Scrub(data map[string]interface{}) map[string]interface{} {
+	return s.scrubValue(data).(map[string]interface{})
+}
+
+// ScrubJSON redacts a stored JSON payload. Logs written before scrubbing was
+// added go through this on read so their secrets are never served.
+func (s *Scrubber) ScrubJSON(payload string) string {
+	var data interface{}
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		// Not ours to interpret; do not risk echoing a secret back
+		return Redacted
+	}
+	out, err := json.Marshal(s.scrubValue(data))
+	if err != nil {
+		return Redacted
+	}
+	return string(out)
+}
+
+func (s *Scrubber) scrubValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, inner := range v {
+			if _, sensitive := s.keys[strings.ToLower(key)]; sensitive {
+				out[key] = Redacted
+				continue
+			}
+			out[key] = s.scrubValue(inner)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, inner := range v {
+			out[i] = s.scrubValue(inner)
+		}
+		return out
+	}
+	return value
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+	"gorm.io/gorm"
+)
+
+// storedPayloadQueue reads back the stored log of every job published, as
+// the worker would find it
+type storedPayloadQueue struct {
+	db     *gorm.DB
+	stored []string
+	jobs   []core.EmailJob
+}
+
+func (q *storedPayloadQueue) Publish(job core.EmailJob) error {
+	var payload string
+	if err := q.db.Raw("SELECT payload FROM email_request_logs WHERE id = ?", job.LogID).Scan(&payload).Error; err != nil {
+		return err
+	}
+	q.stored = append(q.stored, payload)
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func (q *storedPayloadQueue) Consume(int) (<-chan core.Delivery, func(), error) {
+	return nil, func() {}, nil
+}
+
+func TestPayloadIsRedactedBeforeItIsStored(t *testing.T) {
+	repo, db := newTestRepo(t)
+	queue := &storedPayloadQueue{db: db}
+	svc := NewEmailService(nil, NewTemplateService(repo), repo, queue, NewScrubber([]string{"password", "temp_password", "token"}), NewUnsubscribeTokens("secret"), "")
+
+	data := map[string]interface{}{
+		"Name":     "Ada",
+		"Password": "hunter2",
+		"invite": map[string]interface{}{
+			"temp_password": "s3cret",
+			"links":         []interface{}{map[string]interface{}{"token": "abc123", "url": "https://example.edu"}},
+		},
+	}
+	if err := svc.QueueEmail(core.EmailJob{TemplateName: "welcome", Recipient: "ada@example.edu", Data: data}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queue.stored) != 1 {
+		t.Fatalf("published %d jobs, want 1", len(queue.stored))
+	}
+	stored := queue.stored[0]
+	for _, secret := range []string{"hunter2", "s3cret", "abc123"} {
+		if strings.Contains(stored, secret) {
+			t.Errorf("stored payload %s holds %q", stored, secret)
+		}
+	}
+	for _, kept := range []string{`"Name":"Ada"`, `"url":"https://example.edu"`, `"Password":"` + Redacted + `"`} {
+		if !strings.Contains(stored, kept) {
+			t.Errorf("stored payload %s lacks %s", stored, kept)
+		}
+	}
+
+	// The worker still gets the real values to render the email with
+	if queue.jobs[0].Data["Password"] != "hunter2" {
+		t.Errorf("queued job data = %v, want it unredacted", queue.jobs[0].Data)
+	}
+}
+
+func TestGetLogRedactsPayloadsStoredBeforeScrubbing(t *testing.T) {
+	repo, db := newTestRepo(t)
+	svc := NewEmailService(nil, NewTemplateService(repo), repo, nil, NewScrubber([]string{"password"}), NewUnsubscribeTokens("secret"), "")
+
+	payload := `{"name":"Ada","password":"hunter2"}`
+	old := &core.EmailRequestLog{TemplateName: "welcome", RecipientEmail: "ada@example.edu", Payload: &payload, Status: core.StatusSent, CreatedAt: time.Now()}
+	if err := db.Create(old).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := svc.GetLog(old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Payload == nil || *got.Payload != `{"name":"Ada","password":"`+Redacted+`"}` {
+		t.Errorf("payload = %v, want the password redacted", got.Payload)
+	}
+	page, err := svc.GetLogs(repository.LogFilter{}, pagination.Request{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs := page.Items; len(logs) != 1 || logs[0].Payload == nil || strings.Contains(*logs[0].Payload, "hunter2") {
+		t.Errorf("listed logs %+v, want the one with its password redacted", logs)
+	}
+}
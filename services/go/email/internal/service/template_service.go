@@ -2,15 +2,28 @@ package service
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"text/template/parse"
 
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
 	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidTemplate = errors.New("invalid template")
+	ErrInvalidLocale   = errors.New("invalid locale")
+	// ErrTemplateVariables is returned when a translation does not use
+	// exactly the variables of the template's base locale
+	ErrTemplateVariables = errors.New("template variables differ from the base locale")
 )
 
 type TemplateService struct {
@@ -21,14 +34,21 @@ func NewTemplateService(repo *repository.Repository) *TemplateService {
 	return &TemplateService{repo: repo}
 }
 
-func (s *TemplateService) GetTemplate(name string) (*core.EmailTemplate, error) {
-	// 1. Try DB
-	tmpl, err := s.repo.GetTemplateByName(name)
-	if err == nil {
-		return tmpl, nil
+// GetTemplate returns the named template in the first locale of
+// core.LocaleFallbacks(locales...) it has been translated into
+func (s *TemplateService) GetTemplate(name string, locales ...string) (*core.EmailTemplate, error) {
+	for _, locale := range core.LocaleFallbacks(locales...) {
+		// 1. Try DB
+		tmpl, err := s.repo.GetTemplateByName(name, locale)
+		if err == nil {
+			return tmpl, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
 	}
 
-	// 2. Fallback to Filesystem (for dev/init)
+	// 2. Fallback to Filesystem (for dev/init), which only has the base locale
 	log.Printf("Template '%s' not found in DB, checking filesystem...", name)
 
 	// Assuming templates are stored in "templates/" directory relative to working dir
@@ -46,12 +66,13 @@ func (s *TemplateService) GetTemplate(name string) (*core.EmailTemplate, error)
 
 	newTmpl := &core.EmailTemplate{
 		Name:     name,
+		Locale:   core.DefaultLocale,
 		Subject:  subject,
 		HTMLBody: string(content),
 	}
 
 	// 3. Auto-seed to DB
-	if err := s.repo.CreateTemplate(newTmpl); err != nil {
+	if err := s.repo.SeedTemplate(newTmpl); err != nil {
 		fmt.Printf("Failed to seed template %s: %v\n", name, err)
 		// Proceed returning the FS template even if save failed
 	}
@@ -77,11 +98,209 @@ func (s *TemplateService) ListTemplates() ([]core.EmailTemplate, error) {
 	return s.repo.ListTemplates()
 }
 
-func (s *TemplateService) CreateTemplate(name, subject, htmlBody string) error {
-	template := &core.EmailTemplate{
-		Name:     name,
-		Subject:  subject,
-		HTMLBody: htmlBody,
+// ListLocales returns the named template in every locale it exists in
+func (s *TemplateService) ListLocales(name string) ([]core.EmailTemplate, error) {
+	return s.repo.ListTemplateLocales(name)
+}
+
+// CreateTemplate saves a new version of the template in locale, the base
+// locale when empty, and makes it active. A translation must use the same
+// variables as the base locale, which therefore has to exist first.
+func (s *TemplateService) CreateTemplate(name, locale, subject, htmlBody, createdBy string) (*core.EmailTemplate, error) {
+	locale, err := parseLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := templateVariables(name, htmlBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	if locale != core.DefaultLocale {
+		if err := s.checkVariables(name, vars); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.SaveTemplateVersion(name, locale, subject, htmlBody, createdBy)
+}
+
+// CopyLocale starts a translation of the template by saving its active
+// version in from as the first version in to. It is refused if the template
+// already exists in to.
+func (s *TemplateService) CopyLocale(name, from, to, createdBy string) (*core.EmailTemplate, error) {
+	from, err := parseLocale(from)
+	if err != nil {
+		return nil, err
+	}
+	if to, err = parseLocale(to); err != nil {
+		return nil, err
+	}
+	source, err := s.repo.GetTemplateByName(name, from)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, core.ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.repo.GetTemplateByName(name, to)
+	if err == nil {
+		return nil, core.ErrTemplateLocaleExists
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return s.CreateTemplate(name, to, source.Subject, source.HTMLBody, createdBy)
+}
+
+// checkVariables returns ErrTemplateVariables, naming the differences,
+// unless vars are the variables of the template's base locale
+func (s *TemplateService) checkVariables(name string, vars []string) error {
+	base, err := s.repo.GetTemplateByName(name, core.DefaultLocale)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: template has no %q version to translate", ErrTemplateVariables, core.DefaultLocale)
+	}
+	if err != nil {
+		return err
+	}
+	baseVars, err := templateVariables(name, base.HTMLBody)
+	if err != nil {
+		return err
+	}
+	missing, extra := diffVariables(baseVars, vars)
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+	var details []string
+	if len(missing) > 0 {
+		details = append(details, "missing "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		details = append(details, "unknown "+strings.Join(extra, ", "))
+	}
+	return fmt.Errorf("%w: %s", ErrTemplateVariables, strings.Join(details, "; "))
+}
+
+func (s *TemplateService) ListVersions(name, locale string) ([]core.EmailTemplateVersion, error) {
+	locale, err := parseLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListTemplateVersions(name, locale)
+}
+
+// ActivateVersion rolls the template in locale back (or forward) to an
+// existing version
+func (s *TemplateService) ActivateVersion(name, locale string, version int) (*core.EmailTemplate, error) {
+	locale, err := parseLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ActivateTemplateVersion(name, locale, version)
+}
+
+// DeleteTemplate deletes the template in locale, or in every locale when
+// locale is empty
+func (s *TemplateService) DeleteTemplate(name, locale string) error {
+	if locale != "" {
+		var err error
+		if locale, err = parseLocale(locale); err != nil {
+			return err
+		}
+	}
+	return s.repo.DeleteTemplate(name, locale)
+}
+
+// parseLocale normalizes locale, which is the base locale when empty
+func parseLocale(locale string) (string, error) {
+	if locale == "" {
+		return core.DefaultLocale, nil
+	}
+	normalized, ok := core.NormalizeLocale(locale)
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidLocale, locale)
+	}
+	return normalized, nil
+}
+
+// templateVariables returns the sorted names of the top-level fields
+// htmlBody reads from its data, e.g. name for {{.name}} and {{if .name}}
+func templateVariables(name, htmlBody string) ([]string, error) {
+	t, err := template.New(name).Parse(htmlBody)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			collectVariables(tmpl.Tree.Root, seen)
+		}
+	}
+	vars := make([]string, 0, len(seen))
+	for v := range seen {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	return vars, nil
+}
+
+func collectVariables(node parse.Node, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectVariables(child, seen)
+		}
+	case *parse.ActionNode:
+		collectVariables(n.Pipe, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectVariables(cmd, seen)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectVariables(arg, seen)
+		}
+	case *parse.FieldNode:
+		seen[n.Ident[0]] = true
+	case *parse.ChainNode:
+		collectVariables(n.Node, seen)
+	case *parse.IfNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.RangeNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.WithNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.TemplateNode:
+		collectVariables(n.Pipe, seen)
+	}
+}
+
+func collectBranch(n *parse.BranchNode, seen map[string]bool) {
+	collectVariables(n.Pipe, seen)
+	collectVariables(n.List, seen)
+	collectVariables(n.ElseList, seen)
+}
+
+// diffVariables returns the sorted variables of base missing from vars and
+// those of vars not in base
+func diffVariables(base, vars []string) (missing, extra []string) {
+	in := func(list []string, v string) bool {
+		i := sort.SearchStrings(list, v)
+		return i < len(list) && list[i] == v
+	}
+	for _, v := range base {
+		if !in(vars, v) {
+			missing = append(missing, v)
+		}
+	}
+	for _, v := range vars {
+		if !in(base, v) {
+			extra = append(extra, v)
+		}
 	}
-	return s.repo.CreateTemplate(template)
+	return missing, extra
 }
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+func render(t *testing.T, svc *TemplateService, name string) (subject, body string) {
+	t.Helper()
+	tmpl, err := svc.GetTemplate(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = svc.Render(tmpl, map[string]interface{}{"Name": "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl.Subject, body
+}
+
+func TestTemplateVersionsAndRollback(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	svc := NewTemplateService(repo)
+
+	for i, body := range []string{"<p>Hello {{.Name}}</p>", "<p>Hi {{.Name}}</p>", "<p>Broken {{.Nmae}}</p>"} {
+		tmpl, err := svc.CreateTemplate("welcome", "", "Welcome", body, "admin@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpl.ActiveVersion != i+1 {
+			t.Fatalf("save %d: active version %d", i+1, tmpl.ActiveVersion)
+		}
+	}
+
+	versions, err := svc.ListVersions("welcome", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[0].Version != 3 || versions[2].Version != 1 {
+		t.Fatalf("got versions %+v, want 3, 2, 1", versions)
+	}
+	if versions[0].CreatedBy != "admin@example.com" {
+		t.Errorf("version created by %q", versions[0].CreatedBy)
+	}
+	if _, body := render(t, svc, "welcome"); body != "<p>Broken </p>" {
+		t.Fatalf("rendered %q before rollback", body)
+	}
+
+	if _, err := svc.ActivateVersion("welcome", "", 2); err != nil {
+		t.Fatal(err)
+	}
+	// Rendering picks the activated version up at once
+	if _, body := render(t, svc, "welcome"); body != "<p>Hi Ada</p>" {
+		t.Fatalf("rendered %q after rolling back to version 2", body)
+	}
+
+	// Rolling back keeps every version, and the next save follows the latest
+	tmpl, err := svc.CreateTemplate("welcome", "", "Welcome again", "<p>Welcome {{.Name}}</p>", "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.ActiveVersion != 4 {
+		t.Fatalf("save after rollback: active version %d, want 4", tmpl.ActiveVersion)
+	}
+	if subject, body := render(t, svc, "welcome"); subject != "Welcome again" || body != "<p>Welcome Ada</p>" {
+		t.Fatalf("rendered %q %q after saving version 4", subject, body)
+	}
+
+	if _, err := svc.ActivateVersion("welcome", "", 9); !errors.Is(err, core.ErrTemplateVersionNotFound) {
+		t.Errorf("activating a missing version: got %v", err)
+	}
+	if _, err := svc.ActivateVersion("missing", "", 1); !errors.Is(err, core.ErrTemplateNotFound) {
+		t.Errorf("activating a version of a missing template: got %v", err)
+	}
+}
+
+func TestCreateTemplateRejectsInvalidHTML(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	svc := NewTemplateService(repo)
+
+	if _, err := svc.CreateTemplate("welcome", "", "Welcome", "<p>{{.Name</p>", "admin"); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("got %v, want ErrInvalidTemplate", err)
+	}
+	if _, err := svc.ListVersions("welcome", ""); !errors.Is(err, core.ErrTemplateNotFound) {
+		t.Fatalf("an invalid template was saved: %v", err)
+	}
+}
+
+func TestDeletedTemplateKeepsVersions(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	svc := NewTemplateService(repo)
+
+	for _, body := range []string{"<p>v1</p>", "<p>v2</p>"} {
+		if _, err := svc.CreateTemplate("digest", "", "Digest", body, "admin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.DeleteTemplate("digest", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := svc.ListVersions("digest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("deleted template has %d versions, want 2", len(versions))
+	}
+	if _, err := svc.ActivateVersion("digest", "", 1); !errors.Is(err, core.ErrTemplateNotFound) {
+		t.Errorf("activating a version of a deleted template: got %v", err)
+	}
+
+	// Saving again restores the template under the next version
+	tmpl, err := svc.CreateTemplate("digest", "", "Digest", "<p>v3</p>", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.ActiveVersion != 3 {
+		t.Fatalf("restored template at version %d, want 3", tmpl.ActiveVersion)
+	}
+}
+
+func TestTranslationsUseTheBaseVariables(t *testing.T) {
+	repo, _ := newTestRepo(t)
+	svc := NewTemplateService(repo)
+
+	if _, err := svc.CreateTemplate("welcome", "fr", "Bienvenue", "<p>Bonjour {{.Name}}</p>", "admin@example.com"); !errors.Is(err, ErrTemplateVariables) {
+		t.Fatalf("translation without a base version: got %v, want ErrTemplateVariables", err)
+	}
+	if _, err := svc.CreateTemplate("welcome", "", "Welcome", "<p>Hello {{.Name}}</p>", "admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreateTemplate("welcome", "fr", "Bienvenue", "<p>Bonjour {{.Nom}}</p>", "admin@example.com"); !errors.Is(err, ErrTemplateVariables) {
+		t.Errorf("translation with other variables: got %v, want ErrTemplateVariables", err)
+	}
+	if _, err := svc.CreateTemplate("welcome", "klingon!", "Welcome", "<p>Hello {{.Name}}</p>", "admin@example.com"); !errors.Is(err, ErrInvalidLocale) {
+		t.Errorf("malformed locale: got %v, want ErrInvalidLocale", err)
+	}
+
+	copied, err := svc.CopyLocale("welcome", "", "fr", "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Locale != "fr" || copied.HTMLBody != "<p>Hello {{.Name}}</p>" {
+		t.Errorf("copied %q %q, want the base body in fr", copied.Locale, copied.HTMLBody)
+	}
+	if _, err := svc.CopyLocale("welcome", "", "fr", "admin@example.com"); !errors.Is(err, core.ErrTemplateLocaleExists) {
+		t.Errorf("copying over an existing translation: got %v, want ErrTemplateLocaleExists", err)
+	}
+	if _, err := svc.CreateTemplate("welcome", "fr", "Bienvenue", "<p>Bonjour {{.Name}}</p>", "admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// fr-CA has no translation of its own and falls back to fr, de to en
+	for locale, want := range map[string]string{"fr-CA": "fr", "de": "en", "": "en"} {
+		tmpl, err := svc.GetTemplate("welcome", locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpl.Locale != want {
+			t.Errorf("GetTemplate in %q returned %q, want %q", locale, tmpl.Locale, want)
+		}
+	}
+}
+
+func TestSendEmailInRecipientLocale(t *testing.T) {
+	repo, db := newTestRepo(t, &core.EmailSuppression{})
+	templates := NewTemplateService(repo)
+	// The base locale first, which translations are checked against
+	for _, tr := range [][2]string{{"", "<p>Hello {{.Name}}</p>"}, {"fr", "<p>Bonjour {{.Name}}</p>"}, {"de", "<p>Hallo {{.Name}}</p>"}} {
+		if _, err := templates.CreateTemplate("welcome", tr[0], "Welcome", tr[1], "admin@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider := &recordingProvider{}
+	svc := NewEmailService(provider, templates, repo, nil, NewScrubber(nil), NewUnsubscribeTokens("secret"), "")
+
+	// The recipient's own locale wins over the institute's default, which
+	// wins over the base locale
+	jobs := []core.EmailJob{
+		{Locale: "fr-CA", DefaultLocale: "de"},
+		{Locale: "pt", DefaultLocale: "de"},
+		{Locale: "pt"},
+	}
+	for _, job := range jobs {
+		job.TemplateName, job.Recipient, job.Data = "welcome", "ada@example.com", map[string]interface{}{"Name": "Ada"}
+		if err := svc.SendEmail(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"<p>Bonjour Ada</p>", "<p>Hallo Ada</p>", "<p>Hello Ada</p>"}; !reflect.DeepEqual(provider.sent, want) {
+		t.Errorf("sent %q, want %q", provider.sent, want)
+	}
+	var locales []string
+	db.Model(&core.EmailRequestLog{}).Order("id").Pluck("locale", &locales)
+	if want := []string{"fr", "de", "en"}; !reflect.DeepEqual(locales, want) {
+		t.Errorf("logged locales %v, want %v", locales, want)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// ErrInvalidUnsubscribeToken covers malformed, forged and transactional tokens
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+var tokenEncoding = base64.RawURLEncoding
+
+// UnsubscribeTokens signs and verifies the tokens in unsubscribe links. A
+// token is "<payload>.<signature>" where the payload is the category and the
+// lower-cased recipient, so a link cannot be edited to unsubscribe someone
+// else. Tokens do not expire; an old email should still let people opt out.
+type UnsubscribeTokens struct {
+	secret []byte
+}
+
+func NewUnsubscribeTokens(secret string) *UnsubscribeTokens {
+	return &UnsubscribeTokens{secret: []byte(secret)}
+}
+
+// Sign returns the token for email and category
+func (t *UnsubscribeTokens) Sign(email string, category core.Category) string {
+	payload := tokenEncoding.EncodeToString([]byte(string(category) + "\n" + normalizeEmail(email)))
+	return payload + "." + tokenEncoding.EncodeToString(t.mac(payload))
+}
+
+// Verify returns the email and category a token was signed for
+func (t *UnsubscribeTokens) Verify(token string) (string, core.Category, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+	given, err := tokenEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, t.mac(payload)) {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	raw, err := tokenEncoding.DecodeString(payload)
+	if err != nil {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+	category, email, ok := strings.Cut(string(raw), "\n")
+	if !ok || email == "" || !core.Category(category).Valid() || core.Category(category) == core.CategoryTransactional {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+	return email, core.Category(category), nil
+}
+
+func (t *UnsubscribeTokens) mac(payload string) []byte {
+	h := hmac.New(sha256.New, t.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// recordingProvider keeps the bodies of the emails it is asked to send and
+// gives each a numbered message ID
+type recordingProvider struct {
+	sent []string
+}
+
+func (p *recordingProvider) SendEmail(to []string, subject, body string) (string, error) {
+	p.sent = append(p.sent, body)
+	return fmt.Sprintf("msg-%d", len(p.sent)), nil
+}
+
+func TestUnsubscribeTokens(t *testing.T) {
+	tokens := NewUnsubscribeTokens("secret")
+
+	email, category, err := tokens.Verify(tokens.Sign(" Ada@Example.com ", core.CategoryMarketing))
+	if err != nil || email != "ada@example.com" || category != core.CategoryMarketing {
+		t.Fatalf("Verify = %q, %q, %v; want the lower-cased address and its category", email, category, err)
+	}
+
+	// Ada's signature on a payload naming someone else
+	_, sig, _ := strings.Cut(tokens.Sign("ada@example.com", core.CategoryMarketing), ".")
+	forged := tokenEncoding.EncodeToString([]byte("marketing\nbob@example.com")) + "." + sig
+	for name, token := range map[string]string{
+		"edited recipient": forged,
+		"other secret":     NewUnsubscribeTokens("other").Sign("ada@example.com", core.CategoryMarketing),
+		"transactional":    tokens.Sign("ada@example.com", core.CategoryTransactional),
+		"malformed":        "not-a-token",
+	} {
+		if _, _, err := tokens.Verify(token); !errors.Is(err, ErrInvalidUnsubscribeToken) {
+			t.Errorf("%s: got %v, want ErrInvalidUnsubscribeToken", name, err)
+		}
+	}
+}
+
+func TestUnsubscribedRecipientIsSuppressed(t *testing.T) {
+	repo, db := newTestRepo(t, &core.EmailSuppression{})
+	templates := NewTemplateService(repo)
+	if _, err := templates.CreateTemplate("digest", "", "Digest", `<a href="{{.unsubscribe_url}}">Unsubscribe</a>`, "admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	provider := &recordingProvider{}
+	svc := NewEmailService(provider, templates, repo, nil, NewScrubber(nil), NewUnsubscribeTokens("secret"), "https://example.com/unsubscribe")
+	send := func(category core.Category) {
+		t.Helper()
+		if err := svc.SendEmail(core.EmailJob{TemplateName: "digest", Recipient: "Ada@example.com", Category: category}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(core.CategoryMarketing)
+	if len(provider.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(provider.sent))
+	}
+	link := regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(provider.sent[0])
+	if link == nil {
+		t.Fatalf("no unsubscribe link in %q", provider.sent[0])
+	}
+	u, err := url.Parse(link[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if category, err := svc.Unsubscribe(u.Query().Get("token")); err != nil || category != core.CategoryMarketing {
+		t.Fatalf("Unsubscribe = %q, %v", category, err)
+	}
+
+	send(core.CategoryMarketing)
+	if len(provider.sent) != 1 {
+		t.Error("marketing email sent after the recipient unsubscribed")
+	}
+	var suppressed int64
+	db.Model(&core.EmailRequestLog{}).Where("status = ?", core.StatusSuppressed).Count(&suppressed)
+	if suppressed != 1 {
+		t.Errorf("%d suppressed sends logged, want 1", suppressed)
+	}
+
+	// Other categories are unaffected
+	send(core.CategoryNotification)
+	send(core.CategoryTransactional)
+	if len(provider.sent) != 3 {
+		t.Errorf("sent %d emails, want the notification and transactional ones too", len(provider.sent))
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+)
+
+var ErrUnknownWebhook = errors.New("unknown webhook provider")
+
+// WebhookResult counts what became of the events of one webhook request
+type WebhookResult struct {
+	Recorded   int `json:"recorded"`
+	Duplicates int `json:"duplicates"`
+	Unmatched  int `json:"unmatched"` // events about email this service has no log of
+}
+
+// WebhookService records the delivery events providers report through their
+// webhooks, keyed by provider name
+type WebhookService struct {
+	repo    *repository.Repository
+	sources map[string]core.WebhookSource
+}
+
+func NewWebhookService(repo *repository.Repository, sources map[string]core.WebhookSource) *WebhookService {
+	return &WebhookService{repo: repo, sources: sources}
+}
+
+// HandleWebhook verifies a webhook request from provider and records its
+// events. Events for email without a log are skipped rather than failing the
+// request, which the provider would only retry. A hard bounce or complaint
+// suppresses further non-transactional mail to the address; this is repeated
+// for redelivered events in case it failed the first time.
+func (s *WebhookService) HandleWebhook(ctx context.Context, provider string, header func(string) string, body []byte) (WebhookResult, error) {
+	var result WebhookResult
+	source, ok := s.sources[provider]
+	if !ok {
+		return result, ErrUnknownWebhook
+	}
+	events, err := source.Parse(ctx, header, body)
+	if err != nil {
+		return result, err
+	}
+
+	for i := range events {
+		event := &events[i]
+		event.Provider = provider
+		reqLog, recorded, err := s.repo.RecordDeliveryEvent(event)
+		if errors.Is(err, core.ErrEmailLogNotFound) {
+			log.Printf("[Email] No log for %s %s event about message %q", provider, event.Type, event.MessageID)
+			result.Unmatched++
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if recorded {
+			result.Recorded++
+		} else {
+			result.Duplicates++
+		}
+
+		if reason, ok := suppressionReason(event); ok {
+			if err := s.suppress(reqLog.RecipientEmail, reason); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// ListEvents returns the delivery timeline of a log, oldest first
+func (s *WebhookService) ListEvents(logID uint) ([]core.EmailDeliveryEvent, error) {
+	if _, err := s.repo.GetRequestLog(logID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveryEvents(logID)
+}
+
+// suppress stops every non-transactional category going to email
+func (s *WebhookService) suppress(email string, reason core.SuppressionReason) error {
+	for _, category := range []core.Category{core.CategoryNotification, core.CategoryMarketing} {
+		if err := s.repo.AddSuppression(normalizeEmail(email), category, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func suppressionReason(event *core.EmailDeliveryEvent) (core.SuppressionReason, bool) {
+	switch {
+	case event.Type == core.EventBounced && event.HardBounce:
+		return core.ReasonBounced, true
+	case event.Type == core.EventComplained:
+		return core.ReasonComplained, true
+	}
+	return "", false
+}
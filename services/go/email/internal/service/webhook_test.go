@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// scriptedSource is a WebhookSource that returns copies of its events
+type scriptedSource struct {
+	events []core.EmailDeliveryEvent
+}
+
+func (s *scriptedSource) Parse(context.Context, func(string) string, []byte) ([]core.EmailDeliveryEvent, error) {
+	return append([]core.EmailDeliveryEvent(nil), s.events...), nil
+}
+
+func newWebhookService(t *testing.T, source *scriptedSource) (*WebhookService, *core.EmailRequestLog) {
+	t.Helper()
+	repo, _ := newTestRepo(t, &core.EmailDeliveryEvent{}, &core.EmailSuppression{})
+	messageID := "abc@gradeloop"
+	sentAt := time.Now()
+	reqLog := &core.EmailRequestLog{
+		TemplateName:      "digest",
+		RecipientEmail:    "Ada@Example.com",
+		Category:          core.CategoryNotification,
+		Status:            core.StatusSent,
+		SentAt:            &sentAt,
+		ProviderMessageID: &messageID,
+		CreatedAt:         sentAt,
+	}
+	if err := repo.CreateRequestLog(reqLog); err != nil {
+		t.Fatal(err)
+	}
+	return NewWebhookService(repo, map[string]core.WebhookSource{"sendgrid": source}), reqLog
+}
+
+func TestHandleWebhookRecordsEventsOnce(t *testing.T) {
+	at := time.Now().UTC().Truncate(time.Second)
+	source := &scriptedSource{events: []core.EmailDeliveryEvent{
+		{ProviderEventID: "ev-1", MessageID: "abc@gradeloop", Type: core.EventDeferred, OccurredAt: at},
+		{ProviderEventID: "ev-2", MessageID: "abc@gradeloop", Type: core.EventDelivered, OccurredAt: at.Add(time.Minute)},
+		{ProviderEventID: "ev-3", MessageID: "unknown@gradeloop", Type: core.EventDelivered, OccurredAt: at},
+	}}
+	svc, reqLog := newWebhookService(t, source)
+
+	result, err := svc.HandleWebhook(context.Background(), "sendgrid", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (WebhookResult{Recorded: 2, Unmatched: 1}) {
+		t.Errorf("first delivery = %+v", result)
+	}
+	// Providers redeliver until they see a success
+	result, err = svc.HandleWebhook(context.Background(), "sendgrid", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (WebhookResult{Duplicates: 2, Unmatched: 1}) {
+		t.Errorf("redelivery = %+v", result)
+	}
+
+	events, err := svc.ListEvents(reqLog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Type != core.EventDeferred || events[1].Type != core.EventDelivered {
+		t.Errorf("timeline = %+v, want deferred then delivered", events)
+	}
+	got, err := svc.repo.GetRequestLog(reqLog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != core.StatusDelivered || got.StatusEventAt == nil {
+		t.Errorf("log status = %s at %v, want delivered", got.Status, got.StatusEventAt)
+	}
+
+	if _, err := svc.HandleWebhook(context.Background(), "mailgun", nil, nil); !errors.Is(err, ErrUnknownWebhook) {
+		t.Errorf("unknown provider: err = %v", err)
+	}
+}
+
+func TestLateDeliveryDoesNotHideBounce(t *testing.T) {
+	at := time.Now().UTC()
+	source := &scriptedSource{events: []core.EmailDeliveryEvent{
+		{ProviderEventID: "ev-1", MessageID: "abc@gradeloop", Type: core.EventBounced, HardBounce: true, OccurredAt: at},
+		{ProviderEventID: "ev-2", MessageID: "abc@gradeloop", Type: core.EventDelivered, OccurredAt: at.Add(-time.Minute)},
+	}}
+	svc, reqLog := newWebhookService(t, source)
+
+	if _, err := svc.HandleWebhook(context.Background(), "sendgrid", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := svc.repo.GetRequestLog(reqLog.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != core.StatusBounced {
+		t.Errorf("status = %s, want the bounce to stand", got.Status)
+	}
+
+	// A hard bounce stops everything but transactional mail
+	for category, want := range map[core.Category]bool{
+		core.CategoryNotification:  true,
+		core.CategoryMarketing:     true,
+		core.CategoryTransactional: false,
+	} {
+		suppressed, err := svc.repo.IsSuppressed("ada@example.com", category)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if suppressed != want {
+			t.Errorf("%s suppressed = %v, want %v", category, suppressed, want)
+		}
+	}
+	if bounced, err := svc.repo.HasBounced("ada@example.com"); err != nil || !bounced {
+		t.Errorf("HasBounced = %v, %v; want true", bounced, err)
+	}
+}
+
+func TestSoftBounceDoesNotSuppress(t *testing.T) {
+	source := &scriptedSource{events: []core.EmailDeliveryEvent{
+		{ProviderEventID: "ev-1", MessageID: "abc@gradeloop", Type: core.EventBounced, OccurredAt: time.Now()},
+	}}
+	svc, _ := newWebhookService(t, source)
+
+	if _, err := svc.HandleWebhook(context.Background(), "sendgrid", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	suppressed, err := svc.repo.IsSuppressed("ada@example.com", core.CategoryNotification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suppressed {
+		t.Error("a soft bounce suppressed the address")
+	}
+}
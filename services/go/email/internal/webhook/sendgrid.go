@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+const (
+	sendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	sendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+)
+
+// SendGrid reads SendGrid's signed Event Webhook. Each request is an array
+// of events, signed with ECDSA over the timestamp header and the body.
+type SendGrid struct {
+	key *ecdsa.PublicKey
+}
+
+// NewSendGrid takes the verification key shown in SendGrid's mail settings,
+// a base64 encoded DER public key
+func NewSendGrid(publicKey string) (*SendGrid, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SendGrid webhook key: %w", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SendGrid webhook key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid SendGrid webhook key: not an ECDSA key")
+	}
+	return &SendGrid{key: key}, nil
+}
+
+type sendGridEvent struct {
+	Event     string `json:"event"`
+	EventID   string `json:"sg_event_id"`
+	MessageID string `json:"sg_message_id"`
+	SMTPID    string `json:"smtp-id"`
+	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type"` // "bounce" or "blocked" on bounce events
+	Reason    string `json:"reason"`
+	Response  string `json:"response"`
+}
+
+var sendGridEvents = map[string]core.DeliveryEventType{
+	"delivered":  core.EventDelivered,
+	"deferred":   core.EventDeferred,
+	"bounce":     core.EventBounced,
+	"dropped":    core.EventDropped,
+	"spamreport": core.EventComplained,
+}
+
+// Parse returns the delivery events in the request. Engagement events such
+// as opens and clicks are left out.
+func (s *SendGrid) Parse(_ context.Context, header func(string) string, body []byte) ([]core.EmailDeliveryEvent, error) {
+	sig, err := base64.StdEncoding.DecodeString(header(sendGridSignatureHeader))
+	if err != nil || len(sig) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	digest := sha256.Sum256(append([]byte(header(sendGridTimestampHeader)), body...))
+	if !ecdsa.VerifyASN1(s.key, digest[:], sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	events := make([]core.EmailDeliveryEvent, 0, len(raw))
+	for _, r := range raw {
+		var e sendGridEvent
+		if err := json.Unmarshal(r, &e); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		eventType, ok := sendGridEvents[e.Event]
+		if !ok {
+			continue
+		}
+
+		event := core.EmailDeliveryEvent{
+			ProviderEventID: e.EventID,
+			Type:            eventType,
+			// "blocked" is a temporary refusal by the receiving server
+			HardBounce: eventType == core.EventBounced && e.Type != "blocked",
+			Detail:     e.Reason,
+			OccurredAt: time.Unix(e.Timestamp, 0).UTC(),
+			// smtp-id is the Message-ID header of mail relayed over SMTP;
+			// mail sent through the API is known by sg_message_id, whose
+			// events carry it with a suffix after the first dot
+			MessageID: normalizeMessageID(e.SMTPID),
+		}
+		if event.MessageID == "" {
+			event.MessageID, _, _ = strings.Cut(e.MessageID, ".")
+		}
+		if event.Detail == "" {
+			event.Detail = e.Response
+		}
+		if event.ProviderEventID == "" {
+			event.ProviderEventID = eventID(r)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,309 @@
+package webhook
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// snsHost matches the hosts SNS signing certificates and subscription
+// confirmations are served from
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// SES reads Amazon SES notifications, which arrive through an SNS topic
+// subscribed to the webhook. Each request is one SNS message signed with
+// the certificate at its SigningCertURL; messages from other topics are
+// rejected. The subscription is confirmed when SNS asks.
+type SES struct {
+	topicARN string
+	client   *http.Client
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+	// fetchCert loads a signing certificate; replaced in tests
+	fetchCert func(ctx context.Context, certURL string) (*x509.Certificate, error)
+}
+
+func NewSES(topicARN string) *SES {
+	s := &SES{
+		topicARN: topicARN,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		certs:    make(map[string]*x509.Certificate),
+	}
+	s.fetchCert = s.download
+	return s
+}
+
+type snsMessage struct {
+	Type             string  `json:"Type"`
+	MessageID        string  `json:"MessageId"`
+	Token            string  `json:"Token"`
+	TopicARN         string  `json:"TopicArn"`
+	Subject          *string `json:"Subject"`
+	Message          string  `json:"Message"`
+	SubscribeURL     string  `json:"SubscribeURL"`
+	Timestamp        string  `json:"Timestamp"`
+	SignatureVersion string  `json:"SignatureVersion"`
+	Signature        string  `json:"Signature"`
+	SigningCertURL   string  `json:"SigningCertURL"`
+}
+
+// sesNotification covers both SES notifications (notificationType) and
+// event publishing (eventType)
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Mail             struct {
+		MessageID     string `json:"messageId"`
+		CommonHeaders struct {
+			MessageID string `json:"messageId"`
+		} `json:"commonHeaders"`
+	} `json:"mail"`
+	Bounce *struct {
+		BounceType        string    `json:"bounceType"`
+		BounceSubType     string    `json:"bounceSubType"`
+		Timestamp         time.Time `json:"timestamp"`
+		BouncedRecipients []struct {
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint *struct {
+		Timestamp             time.Time `json:"timestamp"`
+		ComplaintFeedbackType string    `json:"complaintFeedbackType"`
+	} `json:"complaint"`
+	Delivery *struct {
+		Timestamp    time.Time `json:"timestamp"`
+		SMTPResponse string    `json:"smtpResponse"`
+	} `json:"delivery"`
+	DeliveryDelay *struct {
+		Timestamp time.Time `json:"timestamp"`
+		DelayType string    `json:"delayType"`
+	} `json:"deliveryDelay"`
+	Reject *struct {
+		Reason string `json:"reason"`
+	} `json:"reject"`
+}
+
+// Parse verifies the SNS message and returns the event in its SES
+// notification. Subscription confirmations are confirmed and have no events.
+func (s *SES) Parse(ctx context.Context, _ func(string) string, body []byte) ([]core.EmailDeliveryEvent, error) {
+	var msg snsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if msg.TopicARN != s.topicARN {
+		return nil, fmt.Errorf("%w: unexpected topic %q", ErrInvalidSignature, msg.TopicARN)
+	}
+	if err := s.verify(ctx, &msg); err != nil {
+		return nil, err
+	}
+
+	switch msg.Type {
+	case "SubscriptionConfirmation":
+		return nil, s.confirm(ctx, msg.SubscribeURL)
+	case "Notification":
+	default:
+		return nil, nil
+	}
+
+	var n sesNotification
+	if err := json.Unmarshal([]byte(msg.Message), &n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	event := core.EmailDeliveryEvent{
+		ProviderEventID: msg.MessageID,
+		// The Message-ID header we set; mail.messageId is the ID SES gave
+		// the email, which is what its API returns
+		MessageID: normalizeMessageID(n.Mail.CommonHeaders.MessageID),
+	}
+	if event.MessageID == "" {
+		event.MessageID = n.Mail.MessageID
+	}
+
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+	switch {
+	case kind == "Delivery" && n.Delivery != nil:
+		event.Type = core.EventDelivered
+		event.OccurredAt = n.Delivery.Timestamp
+		event.Detail = n.Delivery.SMTPResponse
+	case kind == "Bounce" && n.Bounce != nil:
+		event.Type = core.EventBounced
+		event.OccurredAt = n.Bounce.Timestamp
+		event.HardBounce = n.Bounce.BounceType == "Permanent"
+		event.Detail = n.Bounce.BounceType + "/" + n.Bounce.BounceSubType
+		if len(n.Bounce.BouncedRecipients) > 0 && n.Bounce.BouncedRecipients[0].DiagnosticCode != "" {
+			event.Detail = n.Bounce.BouncedRecipients[0].DiagnosticCode
+		}
+	case kind == "Complaint" && n.Complaint != nil:
+		event.Type = core.EventComplained
+		event.OccurredAt = n.Complaint.Timestamp
+		event.Detail = n.Complaint.ComplaintFeedbackType
+	case kind == "DeliveryDelay" && n.DeliveryDelay != nil:
+		event.Type = core.EventDeferred
+		event.OccurredAt = n.DeliveryDelay.Timestamp
+		event.Detail = n.DeliveryDelay.DelayType
+	case kind == "Reject" && n.Reject != nil:
+		event.Type = core.EventDropped
+		event.Detail = n.Reject.Reason
+	default:
+		// Opens, clicks and the like
+		return nil, nil
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt, _ = time.Parse(time.RFC3339, msg.Timestamp)
+	}
+	return []core.EmailDeliveryEvent{event}, nil
+}
+
+// verify checks the SNS signature over the message's fields
+func (s *SES) verify(ctx context.Context, msg *snsMessage) error {
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("%w: unsupported signature version %q", ErrInvalidSignature, msg.SignatureVersion)
+	}
+	sig, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	cert, err := s.cert(ctx, msg.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: signing certificate has no RSA key", ErrInvalidSignature)
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(msg.stringToSign()))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(msg.stringToSign()))
+		digest = sum[:]
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// stringToSign lists the signed fields of the message type in the order SNS
+// signs them
+func (m *snsMessage) stringToSign() string {
+	var b strings.Builder
+	add := func(name, value string) {
+		b.WriteString(name + "\n" + value + "\n")
+	}
+	add("Message", m.Message)
+	add("MessageId", m.MessageID)
+	if m.Type == "Notification" {
+		if m.Subject != nil {
+			add("Subject", *m.Subject)
+		}
+	} else {
+		add("SubscribeURL", m.SubscribeURL)
+	}
+	add("Timestamp", m.Timestamp)
+	if m.Type != "Notification" {
+		add("Token", m.Token)
+	}
+	add("TopicArn", m.TopicARN)
+	add("Type", m.Type)
+	return b.String()
+}
+
+// cert returns the signing certificate at certURL, which must be served by
+// SNS over HTTPS. Certificates are kept once loaded.
+func (s *SES) cert(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	if !isSNSURL(certURL) || !strings.HasSuffix(certURL, ".pem") {
+		return nil, fmt.Errorf("%w: untrusted signing certificate URL", ErrInvalidSignature)
+	}
+
+	s.mu.Lock()
+	cert, ok := s.certs[certURL]
+	s.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	cert, err := s.fetchCert(ctx, certURL)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.certs[certURL] = cert
+	s.mu.Unlock()
+	return cert, nil
+}
+
+func (s *SES) download(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	body, err := s.get(ctx, certURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch SNS signing certificate: %w", err)
+	}
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, errors.New("SNS signing certificate is not PEM encoded")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// confirm visits the SubscribeURL of a verified subscription confirmation
+func (s *SES) confirm(ctx context.Context, subscribeURL string) error {
+	if !isSNSURL(subscribeURL) {
+		return fmt.Errorf("%w: untrusted subscribe URL", ErrInvalidPayload)
+	}
+	if _, err := s.get(ctx, subscribeURL); err != nil {
+		return fmt.Errorf("failed to confirm SNS subscription: %w", err)
+	}
+	log.Printf("[Email] Confirmed SNS subscription to %s", s.topicARN)
+	return nil
+}
+
+func (s *SES) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func isSNSURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && snsHost.MatchString(u.Host)
+}
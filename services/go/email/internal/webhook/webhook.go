@@ -0,0 +1,28 @@
+// Package webhook verifies and reads the delivery webhooks of the email
+// providers: what became of each email after it was handed over.
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidPayload   = errors.New("invalid webhook payload")
+)
+
+// normalizeMessageID strips the angle brackets around a Message-ID header,
+// which providers report with or without them
+func normalizeMessageID(id string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+}
+
+// eventID stands in for the event ID of a provider that did not send one, so
+// a redelivered event is still recognised
+func eventID(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
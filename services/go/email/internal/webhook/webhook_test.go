@@ -0,0 +1,211 @@
+package webhook
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+func newSendGrid(t *testing.T) (*SendGrid, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSendGrid(base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, key
+}
+
+// signedHeaders signs body the way SendGrid does and returns a header lookup
+func signedHeaders(t *testing.T, key *ecdsa.PrivateKey, timestamp string, body []byte) func(string) string {
+	t.Helper()
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{
+		sendGridSignatureHeader: base64.StdEncoding.EncodeToString(sig),
+		sendGridTimestampHeader: timestamp,
+	}
+	return func(name string) string { return headers[name] }
+}
+
+func TestSendGridParse(t *testing.T) {
+	s, key := newSendGrid(t)
+	body := []byte(`[
+		{"event":"delivered","sg_event_id":"ev-1","smtp-id":"<abc@gradeloop>","timestamp":1700000000,"response":"250 OK"},
+		{"event":"bounce","sg_event_id":"ev-2","sg_message_id":"api-id.filter0001","timestamp":1700000001,"type":"blocked","reason":"try later"},
+		{"event":"bounce","sg_event_id":"ev-3","smtp-id":"<def@gradeloop>","timestamp":1700000002,"type":"bounce","reason":"no such user"},
+		{"event":"open","sg_event_id":"ev-4","smtp-id":"<abc@gradeloop>","timestamp":1700000003},
+		{"event":"spamreport","smtp-id":"<abc@gradeloop>","timestamp":1700000004}
+	]`)
+
+	events, err := s.Parse(context.Background(), signedHeaders(t, key, "1700000005", body), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want the four delivery events without the open", len(events))
+	}
+	if e := events[0]; e.Type != core.EventDelivered || e.MessageID != "abc@gradeloop" || e.Detail != "250 OK" || !e.OccurredAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("delivered event = %+v", e)
+	}
+	if e := events[1]; e.Type != core.EventBounced || e.HardBounce || e.MessageID != "api-id" {
+		t.Errorf("blocked event = %+v, want a soft bounce of the API message", e)
+	}
+	if e := events[2]; !e.HardBounce || e.Detail != "no such user" {
+		t.Errorf("bounce event = %+v, want a hard bounce", e)
+	}
+	if e := events[3]; e.Type != core.EventComplained || e.ProviderEventID == "" {
+		t.Errorf("spam report = %+v, want a complaint with a derived event ID", e)
+	}
+}
+
+func TestSendGridRejectsBadSignature(t *testing.T) {
+	s, key := newSendGrid(t)
+	body := []byte(`[{"event":"delivered","sg_event_id":"ev-1","smtp-id":"<abc@gradeloop>","timestamp":1700000000}]`)
+	headers := signedHeaders(t, key, "1700000005", body)
+
+	tampered := []byte(`[{"event":"delivered","sg_event_id":"ev-1","smtp-id":"<xyz@gradeloop>","timestamp":1700000000}]`)
+	if _, err := s.Parse(context.Background(), headers, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: err = %v, want ErrInvalidSignature", err)
+	}
+	unsigned := func(string) string { return "" }
+	if _, err := s.Parse(context.Background(), unsigned, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unsigned body: err = %v, want ErrInvalidSignature", err)
+	}
+}
+
+const (
+	testTopic   = "arn:aws:sns:eu-west-1:123456789012:ses-events"
+	testCertURL = "https://sns.eu-west-1.amazonaws.com/SimpleNotificationService-test.pem"
+)
+
+// newSES returns an SES source whose signing certificate is served from
+// memory, and the key that signs for it
+func newSES(t *testing.T) (*SES, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSES(testTopic)
+	s.fetchCert = func(_ context.Context, certURL string) (*x509.Certificate, error) {
+		if certURL != testCertURL {
+			t.Errorf("fetched certificate %s", certURL)
+		}
+		return cert, nil
+	}
+	return s, key
+}
+
+// snsBody wraps an SES notification in an SNS message signed with key
+func snsBody(t *testing.T, key *rsa.PrivateKey, notification string) []byte {
+	t.Helper()
+	msg := snsMessage{
+		Type:             "Notification",
+		MessageID:        "sns-1",
+		TopicARN:         testTopic,
+		Message:          notification,
+		Timestamp:        "2026-01-02T03:04:05Z",
+		SignatureVersion: "2",
+		SigningCertURL:   testCertURL,
+	}
+	digest := sha256.Sum256([]byte(msg.stringToSign()))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Signature = base64.StdEncoding.EncodeToString(sig)
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestSESParseBounce(t *testing.T) {
+	s, key := newSES(t)
+	body := snsBody(t, key, `{
+		"notificationType":"Bounce",
+		"mail":{"messageId":"ses-id","commonHeaders":{"messageId":"<abc@gradeloop>"}},
+		"bounce":{"bounceType":"Permanent","bounceSubType":"General","timestamp":"2026-01-02T03:04:00Z",
+			"bouncedRecipients":[{"diagnosticCode":"smtp; 550 5.1.1 user unknown"}]}
+	}`)
+
+	events, err := s.Parse(context.Background(), nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	e := events[0]
+	if e.Type != core.EventBounced || !e.HardBounce || e.MessageID != "abc@gradeloop" || e.ProviderEventID != "sns-1" {
+		t.Errorf("event = %+v, want a hard bounce of abc@gradeloop", e)
+	}
+	if e.Detail != "smtp; 550 5.1.1 user unknown" {
+		t.Errorf("detail = %q, want the diagnostic code", e.Detail)
+	}
+}
+
+func TestSESRejectsForgedMessages(t *testing.T) {
+	s, key := newSES(t)
+	body := snsBody(t, key, `{"notificationType":"Delivery","mail":{"messageId":"ses-id"},"delivery":{"timestamp":"2026-01-02T03:04:00Z"}}`)
+
+	var msg snsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatal(err)
+	}
+	msg.Message = `{"notificationType":"Complaint","mail":{"messageId":"ses-id"},"complaint":{"timestamp":"2026-01-02T03:04:00Z"}}`
+	forged, _ := json.Marshal(msg)
+	if _, err := s.Parse(context.Background(), nil, forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("altered message: err = %v, want ErrInvalidSignature", err)
+	}
+
+	msg.TopicARN = "arn:aws:sns:eu-west-1:999999999999:other"
+	otherTopic, _ := json.Marshal(msg)
+	if _, err := s.Parse(context.Background(), nil, otherTopic); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other topic: err = %v, want ErrInvalidSignature", err)
+	}
+
+	if _, err := s.cert(context.Background(), "https://attacker.example.com/cert.pem"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("certificate outside SNS: err = %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DigestDispatcher sends the digests that are due
+type DigestDispatcher interface {
+	DispatchDue(ctx context.Context, now time.Time) int
+}
+
+// DigestJob looks for due digests every interval. Ticking more often than
+// digests are scheduled is harmless: each run is sent once.
+type DigestJob struct {
+	dispatcher DigestDispatcher
+	interval   time.Duration
+}
+
+func NewDigestJob(dispatcher DigestDispatcher, interval time.Duration) *DigestJob {
+	return &DigestJob{dispatcher: dispatcher, interval: interval}
+}
+
+// Run dispatches once immediately and then every interval until ctx is
+// cancelled
+func (j *DigestJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if queued := j.dispatcher.DispatchDue(ctx, time.Now()); queued > 0 {
+			log.Printf("[Email] Queued %d digests", queued)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
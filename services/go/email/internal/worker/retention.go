@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PayloadPurger clears request log payloads older than a cutoff
+type PayloadPurger interface {
+	PurgeRequestLogPayloads(cutoff time.Time) (int64, error)
+}
+
+// RetentionJob periodically purges email log payloads past the retention
+// period. The log rows themselves are kept for auditing.
+type RetentionJob struct {
+	purger    PayloadPurger
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewRetentionJob(purger PayloadPurger, retentionDays int, interval time.Duration) *RetentionJob {
+	return &RetentionJob{
+		purger:    purger,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+		interval:  interval,
+	}
+}
+
+// Run purges once immediately and then every interval until ctx is cancelled
+func (j *RetentionJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.purge()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *RetentionJob) purge() {
+	purged, err := j.purger.PurgeRequestLogPayloads(time.Now().Add(-j.retention))
+	if err != nil {
+		log.Printf("[Email] Failed to purge old log payloads: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("[Email] Purged payloads of %d email logs", purged)
+	}
+}
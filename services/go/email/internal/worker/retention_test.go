@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/repository"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRetentionJobPurgesOnlyOldPayloads(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.EmailRequestLog{}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sentAt := now.AddDate(0, 0, -40)
+	payload := `{"name":"Ada"}`
+	old := &core.EmailRequestLog{TemplateName: "welcome", RecipientEmail: "old@example.edu", Payload: &payload, Status: core.StatusSent, CreatedAt: now.AddDate(0, 0, -40), SentAt: &sentAt}
+	recent := &core.EmailRequestLog{TemplateName: "welcome", RecipientEmail: "new@example.edu", Payload: &payload, Status: core.StatusFailed, CreatedAt: now.AddDate(0, 0, -2)}
+	for _, l := range []*core.EmailRequestLog{old, recent} {
+		if err := db.Create(l).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Run purges once straight away, before the first tick
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	NewRetentionJob(repository.NewRepository(db), 30, time.Hour).Run(ctx)
+
+	var purged, kept core.EmailRequestLog
+	if err := db.First(&purged, old.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if purged.Payload != nil || purged.PayloadPurgedAt == nil {
+		t.Errorf("40 day old log has payload %v, purged at %v; want it purged", purged.Payload, purged.PayloadPurgedAt)
+	}
+	if purged.Status != core.StatusSent || !purged.CreatedAt.Equal(old.CreatedAt) || purged.SentAt == nil || !purged.SentAt.Equal(sentAt) || purged.RecipientEmail != old.RecipientEmail {
+		t.Errorf("purged log = %+v, want its status, recipient and timestamps kept", purged)
+	}
+
+	if err := db.First(&kept, recent.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if kept.Payload == nil || *kept.Payload != payload || kept.PayloadPurgedAt != nil {
+		t.Errorf("2 day old log has payload %v, purged at %v; want it kept", kept.Payload, kept.PayloadPurgedAt)
+	}
+}
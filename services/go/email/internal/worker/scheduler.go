@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ScheduledQueuer moves due scheduled emails to the send queue
+type ScheduledQueuer interface {
+	QueueDueEmails(now, staleBefore time.Time) (int, error)
+}
+
+// SchedulerJob queues due scheduled emails every interval. The emails are
+// claimed in the database, so replicas running it at once queue each email
+// once, and one claimed by an instance that stopped before sending it is
+// claimed again after claimTimeout.
+type SchedulerJob struct {
+	queuer       ScheduledQueuer
+	interval     time.Duration
+	claimTimeout time.Duration
+}
+
+func NewSchedulerJob(queuer ScheduledQueuer, interval, claimTimeout time.Duration) *SchedulerJob {
+	return &SchedulerJob{queuer: queuer, interval: interval, claimTimeout: claimTimeout}
+}
+
+// Run queues once immediately and then every interval until ctx is cancelled
+func (j *SchedulerJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		queued, err := j.queuer.QueueDueEmails(now, now.Add(-j.claimTimeout))
+		if err != nil {
+			log.Printf("[Email] Failed to queue scheduled emails: %v", err)
+		}
+		if queued > 0 {
+			log.Printf("[Email] Queued %d scheduled emails", queued)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
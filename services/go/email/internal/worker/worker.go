@@ -0,0 +1,240 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// Sender renders and sends a single templated email
+type Sender interface {
+	SendEmail(job core.EmailJob) error
+}
+
+// Limiter paces sends to each recipient domain
+type Limiter interface {
+	// Reserve takes a send to domain from its budget, or returns how long
+	// until there is room for one
+	Reserve(ctx context.Context, domain string) (time.Duration, error)
+}
+
+// limiterTimeout bounds one rate limit check; past it the email is sent
+const limiterTimeout = 2 * time.Second
+
+// Worker drains the email queue with a pool of concurrent consumers
+type Worker struct {
+	queue           core.MessageQueue
+	sender          Sender
+	limiter         Limiter
+	concurrency     int
+	prefetch        int
+	shutdownTimeout time.Duration
+
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	inFlight map[*trackedDelivery]struct{}
+	// deferred counts the sends put off because their domain was over its
+	// rate limit, by domain
+	deferred map[string]int64
+}
+
+// NewWorker builds the consumer pool. limiter may be nil, in which case
+// sends are not paced.
+func NewWorker(queue core.MessageQueue, sender Sender, limiter Limiter, cfg *core.Config) *Worker {
+	concurrency := cfg.WorkerConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	prefetch := cfg.WorkerPrefetch
+	if prefetch < 1 {
+		prefetch = 1
+	}
+
+	return &Worker{
+		queue:           queue,
+		sender:          sender,
+		limiter:         limiter,
+		concurrency:     concurrency,
+		prefetch:        prefetch,
+		shutdownTimeout: cfg.WorkerShutdownTimeout,
+		inFlight:        make(map[*trackedDelivery]struct{}),
+		deferred:        make(map[string]int64),
+	}
+}
+
+// Start runs the consumer pool and blocks until ctx is cancelled and the
+// pool has shut down. On shutdown the consumers stop taking new messages,
+// in-flight sends get up to shutdownTimeout to finish, and anything still
+// running after that is nacked for redelivery.
+func (w *Worker) Start(ctx context.Context) error {
+	cancels := make([]func(), 0, w.concurrency)
+	for i := 0; i < w.concurrency; i++ {
+		deliveries, cancel, err := w.queue.Consume(w.prefetch)
+		if err != nil {
+			for _, c := range cancels {
+				c()
+			}
+			w.wg.Wait()
+			return err
+		}
+		cancels = append(cancels, cancel)
+
+		w.wg.Add(1)
+		go w.consume(i, deliveries)
+	}
+
+	log.Printf("[Worker] Started %d email consumers (prefetch %d)", w.concurrency, w.prefetch)
+
+	<-ctx.Done()
+
+	log.Printf("[Worker] Shutting down, waiting up to %s for in-flight sends", w.shutdownTimeout)
+	for _, cancel := range cancels {
+		cancel()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		log.Println("[Worker] All in-flight sends finished")
+	case <-time.After(w.shutdownTimeout):
+		n := w.nackInFlight()
+		log.Printf("[Worker] Shutdown timeout reached, nacked %d in-flight messages for redelivery", n)
+	}
+
+	return nil
+}
+
+func (w *Worker) consume(id int, deliveries <-chan core.Delivery) {
+	defer w.wg.Done()
+
+	for d := range deliveries {
+		w.handle(id, d)
+	}
+}
+
+func (w *Worker) handle(id int, d core.Delivery) {
+	td := &trackedDelivery{Delivery: d}
+	w.track(td, true)
+	defer w.track(td, false)
+
+	job := d.Job()
+	if job.NextRetryAt != nil && job.NextRetryAt.After(time.Now()) {
+		// Delivered before its time; wait out the rest
+		td.settle(func() error { return d.Defer(*job.NextRetryAt) })
+		return
+	}
+	if domain, wait := w.reserve(job); wait > 0 {
+		// Over the domain's rate limit: try again later, which is not a
+		// failure and leaves no log row
+		w.countDeferred(domain)
+		td.settle(func() error { return d.Defer(time.Now().Add(wait)) })
+		return
+	}
+
+	if err := w.sender.SendEmail(job); err != nil {
+		// The request log already records the failure; don't requeue
+		// template or provider errors forever.
+		log.Printf("[Worker %d] Failed to send %s email to %s: %v", id, job.TemplateName, job.Recipient, err)
+		td.settle(func() error { return d.Nack(false) })
+		return
+	}
+
+	td.settle(d.Ack)
+}
+
+// reserve takes the job's send from its recipient domain's budget, or
+// returns how long until the domain has room. If the limit cannot be checked
+// the email is sent rather than held up.
+func (w *Worker) reserve(job core.EmailJob) (string, time.Duration) {
+	domain := recipientDomain(job.Recipient)
+	if w.limiter == nil || domain == "" {
+		return domain, 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), limiterTimeout)
+	defer cancel()
+	wait, err := w.limiter.Reserve(ctx, domain)
+	if err != nil {
+		log.Printf("[Worker] Rate limit check for %s failed, sending anyway: %v", domain, err)
+		return domain, 0
+	}
+	return domain, wait
+}
+
+func (w *Worker) countDeferred(domain string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deferred[domain]++
+}
+
+// Deferred returns how many sends to each domain have been deferred by its
+// rate limit since the worker started
+func (w *Worker) Deferred() map[string]int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make(map[string]int64, len(w.deferred))
+	for domain, n := range w.deferred {
+		out[domain] = n
+	}
+	return out
+}
+
+// recipientDomain returns the lower-cased domain of an address, or "" if
+// it has none
+func recipientDomain(addr string) string {
+	at := strings.LastIndex(addr, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(addr[at+1:]))
+}
+
+func (w *Worker) track(td *trackedDelivery, active bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if active {
+		w.inFlight[td] = struct{}{}
+	} else {
+		delete(w.inFlight, td)
+	}
+}
+
+func (w *Worker) nackInFlight() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	count := 0
+	for td := range w.inFlight {
+		if td.settle(func() error { return td.Nack(true) }) {
+			count++
+		}
+	}
+	return count
+}
+
+// trackedDelivery makes sure a delivery is settled once even when the
+// shutdown timeout races with a send that finishes late.
+type trackedDelivery struct {
+	core.Delivery
+	once sync.Once
+}
+
+func (td *trackedDelivery) settle(fn func() error) bool {
+	settled := false
+	td.once.Do(func() {
+		if err := fn(); err != nil {
+			log.Printf("[Worker] Failed to settle delivery: %v", err)
+		}
+		settled = true
+	})
+	return settled
+}
@@ -0,0 +1,270 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/email/internal/core"
+)
+
+// fakeQueue hands out the jobs it was built with, one consumer's channel at a
+// time, and records how each delivery was settled
+type fakeQueue struct {
+	jobs chan core.EmailJob
+
+	mu      sync.Mutex
+	settled map[string]string
+}
+
+func newFakeQueue(recipients ...string) *fakeQueue {
+	q := &fakeQueue{jobs: make(chan core.EmailJob, len(recipients)), settled: make(map[string]string)}
+	for _, r := range recipients {
+		q.jobs <- core.EmailJob{TemplateName: "welcome", Recipient: r}
+	}
+	return q
+}
+
+func (q *fakeQueue) Publish(job core.EmailJob) error {
+	q.jobs <- job
+	return nil
+}
+
+func (q *fakeQueue) Consume(prefetch int) (<-chan core.Delivery, func(), error) {
+	out := make(chan core.Delivery)
+	done := make(chan struct{})
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case job := <-q.jobs:
+				select {
+				case out <- &fakeDelivery{queue: q, job: job}:
+				case <-done:
+					q.jobs <- job
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return out, func() { once.Do(func() { close(done) }) }, nil
+}
+
+func (q *fakeQueue) settle(recipient, how string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.settled[recipient] = how
+}
+
+func (q *fakeQueue) settlement(recipient string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.settled[recipient]
+}
+
+type fakeDelivery struct {
+	queue *fakeQueue
+	job   core.EmailJob
+}
+
+func (d *fakeDelivery) Job() core.EmailJob { return d.job }
+func (d *fakeDelivery) Ack() error         { d.queue.settle(d.job.Recipient, "ack"); return nil }
+func (d *fakeDelivery) Defer(time.Time) error {
+	d.queue.settle(d.job.Recipient, "defer")
+	return nil
+}
+func (d *fakeDelivery) Nack(requeue bool) error {
+	if requeue {
+		d.queue.settle(d.job.Recipient, "requeue")
+	} else {
+		d.queue.settle(d.job.Recipient, "nack")
+	}
+	return nil
+}
+
+// blockingSender holds every send until release is closed, reporting each
+// one on started
+type blockingSender struct {
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingSender() *blockingSender {
+	return &blockingSender{started: make(chan string, 100), release: make(chan struct{})}
+}
+
+func (s *blockingSender) SendEmail(job core.EmailJob) error {
+	s.started <- job.Recipient
+	<-s.release
+	return nil
+}
+
+func (s *blockingSender) waitStarted(t *testing.T, n int) []string {
+	t.Helper()
+	var recipients []string
+	for len(recipients) < n {
+		select {
+		case r := <-s.started:
+			recipients = append(recipients, r)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d sends started", len(recipients), n)
+		}
+	}
+	return recipients
+}
+
+func startWorker(t *testing.T, q core.MessageQueue, sender Sender, cfg *core.Config) (context.CancelFunc, <-chan struct{}) {
+	t.Helper()
+	_, cancel, stopped := startLimitedWorker(t, q, sender, nil, cfg)
+	return cancel, stopped
+}
+
+func startLimitedWorker(t *testing.T, q core.MessageQueue, sender Sender, limiter Limiter, cfg *core.Config) (*Worker, context.CancelFunc, <-chan struct{}) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	w := NewWorker(q, sender, limiter, cfg)
+	go func() {
+		defer close(stopped)
+		if err := w.Start(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return w, cancel, stopped
+}
+
+func TestWorkerSendsInParallel(t *testing.T) {
+	q := newFakeQueue("a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com")
+	sender := newBlockingSender()
+	startWorker(t, q, sender, &core.Config{WorkerConcurrency: 3, WorkerPrefetch: 1, WorkerShutdownTimeout: time.Second})
+
+	// Three consumers means three sends under way while none has finished
+	sender.waitStarted(t, 3)
+	select {
+	case r := <-sender.started:
+		t.Fatalf("a fourth send to %s started before any finished", r)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(sender.release)
+	sender.waitStarted(t, 2)
+}
+
+func TestWorkerShutdownWaitsForInFlightSends(t *testing.T) {
+	q := newFakeQueue("a@example.com", "b@example.com")
+	sender := newBlockingSender()
+	cancel, stopped := startWorker(t, q, sender, &core.Config{WorkerConcurrency: 2, WorkerPrefetch: 1, WorkerShutdownTimeout: 5 * time.Second})
+
+	sender.waitStarted(t, 2)
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatal("worker stopped while sends were in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(sender.release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not stop once in-flight sends finished")
+	}
+	for _, r := range []string{"a@example.com", "b@example.com"} {
+		if got := q.settlement(r); got != "ack" {
+			t.Errorf("send to %s settled with %q, want ack", r, got)
+		}
+	}
+}
+
+func TestWorkerShutdownTimeoutRequeuesInFlightSends(t *testing.T) {
+	q := newFakeQueue("a@example.com")
+	sender := newBlockingSender()
+	defer close(sender.release)
+	cancel, stopped := startWorker(t, q, sender, &core.Config{WorkerConcurrency: 1, WorkerPrefetch: 1, WorkerShutdownTimeout: 50 * time.Millisecond})
+
+	sender.waitStarted(t, 1)
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not stop after its shutdown timeout")
+	}
+	if got := q.settlement("a@example.com"); got != "requeue" {
+		t.Errorf("unfinished send settled with %q, want requeue", got)
+	}
+}
+
+// budgetLimiter lets each domain send its budget and then has it wait
+type budgetLimiter struct {
+	mu     sync.Mutex
+	budget map[string]int
+}
+
+func (l *budgetLimiter) Reserve(_ context.Context, domain string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.budget[domain] == 0 {
+		return time.Minute, nil
+	}
+	l.budget[domain]--
+	return 0, nil
+}
+
+func TestWorkerDefersSendsOverDomainLimit(t *testing.T) {
+	q := newFakeQueue("a@tenant.example", "b@tenant.example", "c@tenant.example", "x@other.example", "y@other.example")
+	sender := newBlockingSender()
+	close(sender.release)
+	limiter := &budgetLimiter{budget: map[string]int{"tenant.example": 1, "other.example": 2}}
+	w, _, _ := startLimitedWorker(t, q, sender, limiter, &core.Config{WorkerConcurrency: 2, WorkerPrefetch: 1, WorkerShutdownTimeout: time.Second})
+
+	sent := sender.waitStarted(t, 3)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, r := range []string{"a@tenant.example", "b@tenant.example", "c@tenant.example", "x@other.example", "y@other.example"} {
+		for q.settlement(r) == "" {
+			if time.Now().After(deadline) {
+				t.Fatalf("send to %s was not settled", r)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// One tenant send went out and the rest wait, while the other domain's
+	// mail was not held up by them
+	tenantSent := 0
+	for _, r := range sent {
+		if recipientDomain(r) == "tenant.example" {
+			tenantSent++
+		}
+	}
+	if tenantSent != 1 {
+		t.Errorf("sent %d emails to tenant.example, want its budget of 1", tenantSent)
+	}
+	for _, r := range []string{"x@other.example", "y@other.example"} {
+		if got := q.settlement(r); got != "ack" {
+			t.Errorf("send to %s settled with %q, want ack", r, got)
+		}
+	}
+	deferred := 0
+	for _, r := range []string{"a@tenant.example", "b@tenant.example", "c@tenant.example"} {
+		switch q.settlement(r) {
+		case "defer":
+			deferred++
+		case "nack", "requeue":
+			t.Errorf("send to %s over the limit was nacked, want it deferred", r)
+		}
+	}
+	if deferred != 2 {
+		t.Errorf("deferred %d tenant sends, want 2", deferred)
+	}
+	if got := w.Deferred(); got["tenant.example"] != 2 || got["other.example"] != 0 {
+		t.Errorf("deferred counts %v, want 2 for tenant.example only", got)
+	}
+}
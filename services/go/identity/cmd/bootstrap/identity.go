@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+// systemAdmin creates an active, verified system admin. With force an
+// existing user with the email is made one.
+func (b *bootstrapper) systemAdmin(spec AdminSpec) {
+	const kind = "system_admin"
+	if spec.Email == "" {
+		b.report.add(kind, "(no email)", "", errors.New("email is required"))
+		return
+	}
+	name := spec.FullName
+	if name == "" {
+		name = "System Admin"
+	}
+
+	now := time.Now()
+	existing, err := b.repo.GetUserByEmail(spec.Email)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		b.report.add(kind, spec.Email, "", err)
+		return
+	}
+	if existing != nil {
+		if !b.force {
+			b.report.add(kind, spec.Email, OutcomeSkipped, nil)
+			return
+		}
+		existing.FullName = name
+		existing.UserType = core.UserTypeSystemAdmin
+		existing.IsActive = true
+		existing.Status = "active"
+		existing.EmailVerified = true
+		if existing.EmailVerifiedAt == nil {
+			existing.EmailVerifiedAt = &now
+		}
+		b.report.add(kind, spec.Email, OutcomeUpdated, b.repo.UpdateUser(existing))
+		return
+	}
+
+	err = b.repo.CreateUser(&core.User{
+		Email:           strings.ToLower(strings.TrimSpace(spec.Email)),
+		FullName:        name,
+		UserType:        core.UserTypeSystemAdmin,
+		IsActive:        true,
+		Status:          "active",
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	})
+	b.report.add(kind, spec.Email, OutcomeCreated, err)
+}
+
+// institute creates the institute and its hierarchy. An existing institute
+// is left alone along with everything in it, unless force is set.
+func (b *bootstrapper) institute(spec InstituteSpec) {
+	const kind = "institute"
+
+	institute, err := b.repo.GetInstituteByCode(spec.Code)
+	switch {
+	case errors.Is(err, repository.ErrInstituteNotFound):
+		institute = &core.Institute{
+			Name:         spec.Name,
+			Code:         spec.Code,
+			Domain:       spec.Domain,
+			ContactEmail: spec.ContactEmail,
+			IsActive:     true,
+		}
+		if err := b.repo.CreateInstitute(institute); err != nil {
+			b.report.add(kind, spec.Code, "", err)
+			return
+		}
+		b.report.add(kind, spec.Code, OutcomeCreated, nil)
+	case err != nil:
+		b.report.add(kind, spec.Code, "", err)
+		return
+	case !b.force:
+		b.report.add(kind, spec.Code, OutcomeSkipped, nil)
+		return
+	case institute.Name == spec.Name && institute.Domain == spec.Domain && institute.ContactEmail == spec.ContactEmail:
+		b.report.add(kind, spec.Code, OutcomeSkipped, nil)
+	default:
+		institute.Name = spec.Name
+		institute.Domain = spec.Domain
+		institute.ContactEmail = spec.ContactEmail
+		if err := b.repo.UpdateInstitute(institute); err != nil {
+			b.report.add(kind, spec.Code, "", err)
+			return
+		}
+		b.report.add(kind, spec.Code, OutcomeUpdated, nil)
+	}
+
+	faculties, err := b.repo.GetFacultiesByInstitute(institute.ID.String())
+	if err != nil {
+		b.report.add("faculty", spec.Code+"/*", "", err)
+		return
+	}
+	for _, fs := range spec.Faculties {
+		name := spec.Code + "/" + fs.Name
+		faculty := findByName(faculties, fs.Name, func(f core.Faculty) string { return f.Name })
+		if faculty == nil {
+			faculty = &core.Faculty{InstituteID: institute.ID, Name: fs.Name}
+			if err := b.repo.CreateFaculty(faculty); err != nil {
+				b.report.add("faculty", name, "", err)
+				continue
+			}
+			b.report.add("faculty", name, OutcomeCreated, nil)
+		} else {
+			b.report.add("faculty", name, OutcomeSkipped, nil)
+		}
+		b.departments(faculty, name, fs.Departments)
+	}
+}
+
+func (b *bootstrapper) departments(faculty *core.Faculty, parent string, specs []DepartmentSpec) {
+	existing, err := b.repo.GetDepartmentsByFaculty(faculty.ID.String())
+	if err != nil {
+		b.report.add("department", parent+"/*", "", err)
+		return
+	}
+	for _, ds := range specs {
+		name := parent + "/" + ds.Name
+		dept := findByName(existing, ds.Name, func(d core.Department) string { return d.Name })
+		if dept == nil {
+			dept = &core.Department{FacultyID: faculty.ID, Name: ds.Name}
+			if err := b.repo.CreateDepartment(dept); err != nil {
+				b.report.add("department", name, "", err)
+				continue
+			}
+			b.report.add("department", name, OutcomeCreated, nil)
+		} else {
+			b.report.add("department", name, OutcomeSkipped, nil)
+		}
+		b.classes(dept, name, ds.Classes)
+	}
+}
+
+func (b *bootstrapper) classes(dept *core.Department, parent string, specs []ClassSpec) {
+	existing, err := b.repo.GetClassesByDepartment(dept.ID.String())
+	if err != nil {
+		b.report.add("class", parent+"/*", "", err)
+		return
+	}
+	for _, cs := range specs {
+		name := parent + "/" + cs.Name
+		class := findByName(existing, cs.Name, func(c core.Class) string { return c.Name })
+		switch {
+		case class == nil:
+			err := b.repo.CreateClass(&core.Class{DepartmentID: dept.ID, Name: cs.Name, Capacity: cs.Capacity})
+			b.report.add("class", name, OutcomeCreated, err)
+		case !b.force || sameCapacity(class.Capacity, cs.Capacity):
+			b.report.add("class", name, OutcomeSkipped, nil)
+		default:
+			class.Capacity = cs.Capacity
+			b.report.add("class", name, OutcomeUpdated, b.repo.UpdateClass(class))
+		}
+	}
+}
+
+// findByName returns the first item called name, or nil
+func findByName[T any](items []T, name string, nameOf func(T) string) *T {
+	for i := range items {
+		if nameOf(items[i]) == name {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+func sameCapacity(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
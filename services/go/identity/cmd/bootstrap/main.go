@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/migrations"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/joho/godotenv"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Spec is the bootstrap file. Every section is optional. Items are matched to
+// what already exists by their key: admin email, permission, role and
+// template name, institute code, and unit name within its parent.
+type Spec struct {
+	SystemAdmins   []AdminSpec      `json:"system_admins"`
+	Permissions    []PermissionSpec `json:"permissions"`
+	Roles          []RoleSpec       `json:"roles"` // parents must be listed before roles inheriting from them
+	EmailTemplates []TemplateSpec   `json:"email_templates"`
+	Institutes     []InstituteSpec  `json:"institutes"`
+}
+
+type AdminSpec struct {
+	Email    string `json:"email"`
+	FullName string `json:"full_name"`
+}
+
+type PermissionSpec struct {
+	Name        string `json:"name"`
+	Resource    string `json:"resource"`
+	Action      string `json:"action"`
+	Description string `json:"description"`
+}
+
+type RoleSpec struct {
+	Name        string   `json:"name"`
+	Scope       string   `json:"scope"`
+	Description string   `json:"description"`
+	Inherits    []string `json:"inherits"`
+	Permissions []string `json:"permissions"`
+}
+
+type TemplateSpec struct {
+	Name     string `json:"name"`
+	Subject  string `json:"subject"`
+	HTMLBody string `json:"html_body"`
+	HTMLFile string `json:"html_file"` // read instead of html_body, relative to the bootstrap file
+}
+
+type InstituteSpec struct {
+	Name         string        `json:"name"`
+	Code         string        `json:"code"`
+	Domain       string        `json:"domain"`
+	ContactEmail string        `json:"contact_email"`
+	Faculties    []FacultySpec `json:"faculties"`
+}
+
+type FacultySpec struct {
+	Name        string           `json:"name"`
+	Departments []DepartmentSpec `json:"departments"`
+}
+
+type DepartmentSpec struct {
+	Name    string      `json:"name"`
+	Classes []ClassSpec `json:"classes"`
+}
+
+type ClassSpec struct {
+	Name     string `json:"name"`
+	Capacity *int   `json:"capacity"`
+}
+
+// Outcomes of bootstrapping one item
+const (
+	OutcomeCreated = "created"
+	OutcomeUpdated = "updated"
+	OutcomeSkipped = "skipped" // already there and left as is
+	OutcomeFailed  = "failed"
+)
+
+type Result struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Force   bool     `json:"force"`
+	Results []Result `json:"results"`
+}
+
+func (r *Report) add(kind, name, outcome string, err error) {
+	result := Result{Kind: kind, Name: name, Outcome: outcome}
+	if err != nil {
+		result.Outcome = OutcomeFailed
+		result.Error = err.Error()
+	}
+	r.Results = append(r.Results, result)
+}
+
+func (r *Report) count(outcome string) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: bootstrap [flags] <bootstrap.json>
+
+Creates the system admins, authz permissions and roles, email templates and
+sample institutes described in the file. Anything that already exists is
+left untouched, so the file can be applied again safely; with --force,
+existing items are brought in line with the file instead.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	force := flag.Bool("force", false, "update existing items to match the file")
+	asJSON := flag.Bool("json", false, "write the report as JSON to stdout")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	spec, err := loadSpec(path)
+	if err != nil {
+		log.Fatal("Failed to read bootstrap file: ", err)
+	}
+
+	_ = godotenv.Load(".env", "../.env", "../../.env", "../../../.env", "../../../../.env", "../../../../../.env")
+	cfg := config.Load()
+
+	b := &bootstrapper{
+		force:  *force,
+		report: &Report{Force: *force, Results: make([]Result, 0)},
+		authz:  newServiceClient(cfg.AuthZServiceURL+"/internal/authz", cfg.InternalToken),
+		email:  newServiceClient(cfg.EmailServiceURL+"/internal/email", cfg.InternalToken),
+	}
+
+	if len(spec.Permissions) > 0 || len(spec.Roles) > 0 {
+		// The client secret of authz's bootstrap service account, which an
+		// admin enables and rotates the secret of for the run
+		secret := os.Getenv("AUTHZ_BOOTSTRAP_SECRET")
+		if secret == "" {
+			log.Fatal("AUTHZ_BOOTSTRAP_SECRET must be set to bootstrap permissions or roles")
+		}
+		if err := b.authz.useServiceToken(authzServiceAccount, secret); err != nil {
+			log.Fatal("Failed to get an authz service token: ", err)
+		}
+	}
+
+	if len(spec.SystemAdmins) > 0 || len(spec.Institutes) > 0 {
+		if cfg.DatabaseURL == "" {
+			log.Fatal("IDENTITY_DATABASE_URL or DATABASE_URL must be set")
+		}
+		db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
+		if err != nil {
+			log.Fatal("Failed to connect to database:", err)
+		}
+		b.repo = repository.NewRepository(db)
+		migrator, err := migrations.NewRunner(db)
+		if err != nil {
+			log.Fatal("Failed to load migrations: ", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatal("Failed to migrate database: ", err)
+		}
+	}
+
+	b.run(spec)
+
+	if *asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(b.report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printReport(b.report)
+	}
+
+	if b.report.count(OutcomeFailed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadSpec reads the bootstrap file and the template bodies it points to
+func loadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+
+	for i := range spec.EmailTemplates {
+		tmpl := &spec.EmailTemplates[i]
+		if tmpl.HTMLFile == "" {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(filepath.Dir(path), tmpl.HTMLFile))
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", tmpl.Name, err)
+		}
+		tmpl.HTMLBody = string(body)
+	}
+	return &spec, nil
+}
+
+type bootstrapper struct {
+	force  bool
+	report *Report
+	repo   *repository.Repository
+	authz  *serviceClient
+	email  *serviceClient
+}
+
+// run applies every section of spec. A failed item is reported and the rest
+// carry on; only the items beneath a unit that could not be created are
+// left out.
+func (b *bootstrapper) run(spec *Spec) {
+	for _, admin := range spec.SystemAdmins {
+		b.systemAdmin(admin)
+	}
+	if len(spec.Permissions) > 0 {
+		b.permissions(spec.Permissions)
+	}
+	for _, role := range spec.Roles {
+		b.role(role)
+	}
+	for _, tmpl := range spec.EmailTemplates {
+		b.template(tmpl)
+	}
+	for _, institute := range spec.Institutes {
+		b.institute(institute)
+	}
+}
+
+func printReport(report *Report) {
+	for _, result := range report.Results {
+		line := fmt.Sprintf("%-8s %-12s %s", result.Outcome, result.Kind, result.Name)
+		if result.Error != "" {
+			line += ": " + result.Error
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("\n%d created, %d updated, %d skipped, %d failed\n",
+		report.count(OutcomeCreated), report.count(OutcomeUpdated), report.count(OutcomeSkipped), report.count(OutcomeFailed))
+}
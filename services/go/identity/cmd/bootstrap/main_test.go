@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeServices keeps the authz roles and permissions and the email templates
+// the bootstrap creates, and serves them back the way the services do
+type fakeServices struct {
+	mu          sync.Mutex
+	permissions []named
+	roles       map[string]*fakeRole
+	templates   map[string]map[string]string
+}
+
+type fakeRole struct {
+	Description string   `json:"description"`
+	Inherits    []string `json:"inherits"`
+	Permissions []named  `json:"permissions"`
+}
+
+func (f *fakeServices) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /internal/authz/permissions", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(f.permissions)
+	})
+	mux.HandleFunc("POST /internal/authz/permissions", func(w http.ResponseWriter, r *http.Request) {
+		var p named
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		f.permissions = append(f.permissions, p)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /internal/authz/permissions/assign", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Role string `json:"role_name"`
+			Perm string `json:"perm_name"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		role := f.roles[req.Role]
+		role.Permissions = append(role.Permissions, named{Name: req.Perm})
+	})
+	mux.HandleFunc("GET /internal/authz/roles/{name}", func(w http.ResponseWriter, r *http.Request) {
+		role, ok := f.roles[r.PathValue("name")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(role)
+	})
+	mux.HandleFunc("POST /internal/authz/roles", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+			fakeRole
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.roles[req.Name] = &fakeRole{Description: req.Description, Inherits: req.Inherits}
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("GET /internal/email/templates/{name}", func(w http.ResponseWriter, r *http.Request) {
+		tmpl, ok := f.templates[r.PathValue("name")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(tmpl)
+	})
+	mux.HandleFunc("POST /internal/email/templates", func(w http.ResponseWriter, r *http.Request) {
+		var tmpl map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&tmpl)
+		f.templates[tmpl["name"]] = tmpl
+		w.WriteHeader(http.StatusCreated)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// newTestBootstrapper returns a bootstrapper over an in-memory identity
+// database and the fake services, plus a function making a fresh one over
+// the same state, as a second run of the command would
+func newTestBootstrapper(t *testing.T) (*gorm.DB, func(force bool) *bootstrapper) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.User{}, &core.StudentProfile{}, &core.InstructorProfile{}, &core.InstituteAdminProfile{},
+		&core.Institute{}, &core.Faculty{}, &core.Department{}, &core.Class{}, &core.ClassEnrollment{}, &core.ClassWaitlistEntry{}, &core.OutboxEvent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	services := &fakeServices{roles: map[string]*fakeRole{}, templates: map[string]map[string]string{}}
+	server := httptest.NewServer(services.handler())
+	t.Cleanup(server.Close)
+
+	return db, func(force bool) *bootstrapper {
+		return &bootstrapper{
+			force:  force,
+			report: &Report{Force: force},
+			repo:   repository.NewRepository(db),
+			authz:  newServiceClient(server.URL+"/internal/authz", "test"),
+			email:  newServiceClient(server.URL+"/internal/email", "test"),
+		}
+	}
+}
+
+// outcomes counts the report's results by outcome, failing the test on any
+// failed item
+func outcomes(t *testing.T, report *Report) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for _, r := range report.Results {
+		if r.Outcome == OutcomeFailed {
+			t.Errorf("%s %s failed: %s", r.Kind, r.Name, r.Error)
+		}
+		counts[r.Outcome]++
+	}
+	return counts
+}
+
+func TestBootstrapIsIdempotent(t *testing.T) {
+	spec, err := loadSpec("example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, newBootstrapper := newTestBootstrapper(t)
+
+	first := newBootstrapper(false)
+	first.run(spec)
+	total := len(first.report.Results)
+	if got := outcomes(t, first.report); got[OutcomeCreated] != total {
+		t.Fatalf("first run: %v, want all %d items created", got, total)
+	}
+
+	// The existing institute is skipped along with everything in it
+	second := newBootstrapper(false)
+	second.run(spec)
+	if got := outcomes(t, second.report); got[OutcomeSkipped] != len(second.report.Results) {
+		t.Errorf("second run: %v, want every item skipped", got)
+	}
+
+	var admin core.User
+	if err := db.Where("email = ?", "admin@gradeloop.com").First(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if admin.UserType != core.UserTypeSystemAdmin || !admin.IsActive || !admin.EmailVerified {
+		t.Errorf("system admin = %+v", admin)
+	}
+	var classes int64
+	db.Model(&core.Class{}).Count(&classes)
+	if classes != 1 {
+		t.Errorf("%d classes after two runs, want 1", classes)
+	}
+}
+
+func TestBootstrapForceUpdatesChangedItems(t *testing.T) {
+	spec, err := loadSpec("example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, newBootstrapper := newTestBootstrapper(t)
+	newBootstrapper(false).run(spec)
+
+	capacity := 80
+	spec.Institutes[0].Faculties[0].Departments[0].Classes[0].Capacity = &capacity
+	spec.EmailTemplates[0].Subject = "Welcome aboard"
+
+	unforced := newBootstrapper(false)
+	unforced.run(spec)
+	if got := outcomes(t, unforced.report); got[OutcomeUpdated] != 0 {
+		t.Errorf("run without force updated %d items", got[OutcomeUpdated])
+	}
+
+	forced := newBootstrapper(true)
+	forced.run(spec)
+	updated := map[string]bool{}
+	for _, r := range forced.report.Results {
+		if r.Outcome == OutcomeUpdated {
+			updated[r.Kind] = true
+		}
+	}
+	outcomes(t, forced.report)
+	if !updated["class"] || !updated["email_template"] {
+		t.Errorf("forced run updated %v, want the class and the template", updated)
+	}
+
+	var class core.Class
+	if err := db.First(&class).Error; err != nil {
+		t.Fatal(err)
+	}
+	if class.Capacity == nil || *class.Capacity != 80 {
+		t.Errorf("class capacity = %v, want 80", class.Capacity)
+	}
+}
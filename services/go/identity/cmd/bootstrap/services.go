@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+// named is the part of an authz role or permission the bootstrap matches on
+type named struct {
+	Name string `json:"name"`
+}
+
+func hasName(items []named, name string) bool {
+	return slices.ContainsFunc(items, func(item named) bool { return item.Name == name })
+}
+
+// serviceClient calls the internal API of another service
+type serviceClient struct {
+	baseURL       string
+	internalToken string
+	// bearer is sent as the Authorization token once set, for APIs that
+	// want a service token on top of the internal one
+	bearer     string
+	httpClient *http.Client
+}
+
+func newServiceClient(baseURL, internalToken string) *serviceClient {
+	return &serviceClient{
+		baseURL:       baseURL,
+		internalToken: internalToken,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// do sends body as JSON and decodes a 2xx response into out when it is set.
+// A 404 returns errNotFound.
+func (c *serviceClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", c.internalToken)
+	if c.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s %s returned status %d: %s", method, path, resp.StatusCode, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// authzServiceAccount is the service account authz seeds, disabled, for the
+// bootstrap, allowed to read and manage its roles and permissions
+const authzServiceAccount = "bootstrap"
+
+// useServiceToken gets a token for the authz service account with its
+// client secret and sends it on the client's later calls; the authz admin
+// API wants one
+func (c *serviceClient) useServiceToken(account, secret string) error {
+	var token struct {
+		Token string `json:"token"`
+	}
+	body := map[string]string{"service_name": account, "client_secret": secret}
+	if err := c.do(http.MethodPost, "/service-token", body, &token); err != nil {
+		return err
+	}
+	c.bearer = token.Token
+	return nil
+}
+
+// permissions creates the permissions authz does not have yet. Existing ones
+// are always skipped since authz cannot update a permission.
+func (b *bootstrapper) permissions(specs []PermissionSpec) {
+	const kind = "permission"
+
+	var existing []named
+	if err := b.authz.do(http.MethodGet, "/permissions", nil, &existing); err != nil {
+		b.report.add(kind, "*", "", err)
+		return
+	}
+
+	for _, spec := range specs {
+		if hasName(existing, spec.Name) {
+			b.report.add(kind, spec.Name, OutcomeSkipped, nil)
+			continue
+		}
+		err := b.authz.do(http.MethodPost, "/permissions", spec, nil)
+		b.report.add(kind, spec.Name, OutcomeCreated, err)
+	}
+}
+
+// role creates a role with its parents and permissions. With force an
+// existing role gets the file's description and parents, and any of its
+// permissions it is missing; permissions assigned by hand are kept.
+func (b *bootstrapper) role(spec RoleSpec) {
+	const kind = "role"
+
+	var existing struct {
+		Description string   `json:"description"`
+		Inherits    []string `json:"inherits"`
+		Permissions []named  `json:"permissions"`
+	}
+	err := b.authz.do(http.MethodGet, "/roles/"+url.PathEscape(spec.Name), nil, &existing)
+	switch {
+	case errors.Is(err, errNotFound):
+		create := map[string]interface{}{
+			"name":        spec.Name,
+			"scope":       spec.Scope,
+			"description": spec.Description,
+		}
+		if spec.Inherits != nil {
+			create["inherits"] = spec.Inherits
+		}
+		if err := b.authz.do(http.MethodPost, "/roles", create, nil); err != nil {
+			b.report.add(kind, spec.Name, "", err)
+			return
+		}
+		b.report.add(kind, spec.Name, OutcomeCreated, b.assign(spec.Name, spec.Permissions))
+		return
+	case err != nil:
+		b.report.add(kind, spec.Name, "", err)
+		return
+	case !b.force:
+		b.report.add(kind, spec.Name, OutcomeSkipped, nil)
+		return
+	}
+
+	changed := false
+	update := map[string]interface{}{}
+	if existing.Description != spec.Description {
+		update["description"] = spec.Description
+	}
+	if spec.Inherits != nil && !sameSet(existing.Inherits, spec.Inherits) {
+		update["inherits"] = spec.Inherits
+	}
+	if len(update) > 0 {
+		if err := b.authz.do(http.MethodPatch, "/roles/"+url.PathEscape(spec.Name), update, nil); err != nil {
+			b.report.add(kind, spec.Name, "", err)
+			return
+		}
+		changed = true
+	}
+
+	var missing []string
+	for _, name := range spec.Permissions {
+		if !hasName(existing.Permissions, name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		if err := b.assign(spec.Name, missing); err != nil {
+			b.report.add(kind, spec.Name, "", err)
+			return
+		}
+		changed = true
+	}
+
+	if changed {
+		b.report.add(kind, spec.Name, OutcomeUpdated, nil)
+	} else {
+		b.report.add(kind, spec.Name, OutcomeSkipped, nil)
+	}
+}
+
+func (b *bootstrapper) assign(role string, permissions []string) error {
+	for _, name := range permissions {
+		body := map[string]string{"role_name": role, "perm_name": name}
+		if err := b.authz.do(http.MethodPost, "/permissions/assign", body, nil); err != nil {
+			return fmt.Errorf("assign %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// template creates an email template. With force a template whose subject or
+// body differs from the file gets a new version, so the old one can still be
+// activated again.
+func (b *bootstrapper) template(spec TemplateSpec) {
+	const kind = "email_template"
+
+	var existing struct {
+		Subject  string `json:"subject"`
+		HTMLBody string `json:"html_body"`
+	}
+	err := b.email.do(http.MethodGet, "/templates/"+url.PathEscape(spec.Name), nil, &existing)
+	outcome := OutcomeCreated
+	switch {
+	case errors.Is(err, errNotFound):
+	case err != nil:
+		b.report.add(kind, spec.Name, "", err)
+		return
+	case !b.force || (existing.Subject == spec.Subject && existing.HTMLBody == spec.HTMLBody):
+		b.report.add(kind, spec.Name, OutcomeSkipped, nil)
+		return
+	default:
+		outcome = OutcomeUpdated
+	}
+
+	body := map[string]string{
+		"name":       spec.Name,
+		"subject":    spec.Subject,
+		"html_body":  spec.HTMLBody,
+		"created_by": "bootstrap",
+	}
+	b.report.add(kind, spec.Name, outcome, b.email.do(http.MethodPost, "/templates", body, nil))
+}
+
+// sameSet reports whether a and b hold the same names in any order
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, name := range a {
+		if !slices.Contains(b, name) {
+			return false
+		}
+	}
+	return true
+}
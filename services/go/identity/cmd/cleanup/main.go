@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Issue kinds reported by the cleanup tool
+const (
+	KindOrphanedProfile = "orphaned_profile" // profile row whose user is missing or deleted
+	KindExtraProfile    = "extra_profile"    // profile row that does not match the user's type
+	KindMissingProfile  = "missing_profile"  // user without the profile its type requires
+	KindMissingCohort   = "missing_cohort"   // student with no enrollment year to put them in a cohort
+)
+
+// Issue is a single inconsistency and what the tool does (or would do) about it
+type Issue struct {
+	Kind   string    `json:"kind"`
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email,omitempty"`
+	Table  string    `json:"table"`
+	Action string    `json:"action"`
+	// Manual issues are left for an admin, as the tool lacks what fixing
+	// them takes; fix-all skips them
+	Manual bool   `json:"manual,omitempty"`
+	Fixed  bool   `json:"fixed"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	DryRun bool    `json:"dry_run"`
+	Issues []Issue `json:"issues"`
+	Fixed  int     `json:"fixed"`
+	Failed int     `json:"failed"`
+}
+
+// profileTables maps each profile table to the user type that owns it
+var profileTables = []struct {
+	table    string
+	userType string
+}{
+	{"student_profiles", "STUDENT"},
+	{"instructor_profiles", "INSTRUCTOR"},
+	{"institute_admin_profiles", "INSTITUTE_ADMIN"},
+}
+
+// listPageSize is how many users list-users loads at a time
+const listPageSize = 500
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: cleanup [flags] <command>
+
+Commands:
+  report      list inconsistent identity rows without changing anything
+  fix-all     repair every inconsistency, one transaction per issue
+  list-users  list every user with their type-specific record (-type filters)
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print what would be changed without modifying anything")
+	yes := flag.Bool("yes", false, "apply fixes without asking for confirmation")
+	asJSON := flag.Bool("json", false, "write the report as JSON to stdout")
+	userType := flag.String("type", "", "list-users: only users of this type, e.g. STUDENT")
+	flag.Usage = usage
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if command != "report" && command != "fix-all" && command != "list-users" {
+		usage()
+		os.Exit(2)
+	}
+	if command == "report" {
+		*dryRun = true
+	}
+	if !*dryRun && !*yes && *asJSON {
+		log.Fatal("--json needs --yes or --dry-run since confirmations cannot be answered")
+	}
+
+	_ = godotenv.Load(".env", "../.env", "../../.env", "../../../.env", "../../../../.env", "../../../../../.env")
+
+	dsn := os.Getenv("IDENTITY_DATABASE_URL")
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_URL")
+	}
+	if dsn == "" {
+		log.Fatal("IDENTITY_DATABASE_URL or DATABASE_URL must be set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	repo := repository.NewRepository(db)
+
+	if command == "list-users" {
+		if err := listUsers(repo, core.UserType(strings.ToUpper(*userType)), *asJSON); err != nil {
+			log.Fatal("Failed to list users:", err)
+		}
+		return
+	}
+
+	issues, err := findIssues(db, repo)
+	if err != nil {
+		log.Fatal("Failed to scan for inconsistencies:", err)
+	}
+
+	report := Report{DryRun: *dryRun, Issues: issues}
+	if !*dryRun {
+		confirm := confirmer(*yes)
+		for i := range report.Issues {
+			issue := &report.Issues[i]
+			if issue.Manual || !confirm(issue) {
+				continue
+			}
+			if err := fixIssue(db, issue); err != nil {
+				issue.Error = err.Error()
+				report.Failed++
+				continue
+			}
+			issue.Fixed = true
+			report.Fixed++
+		}
+	}
+
+	if *asJSON {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printReport(report)
+	}
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// findIssues collects every inconsistency without modifying the database
+func findIssues(db *gorm.DB, repo *repository.Repository) ([]Issue, error) {
+	issues := make([]Issue, 0)
+
+	// The same orphans the admin users-with-profiles endpoint reports
+	orphans, err := repo.ListOrphanedProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orphans {
+		issues = append(issues, Issue{
+			Kind:   KindOrphanedProfile,
+			UserID: o.UserID,
+			Table:  o.Table,
+			Action: "delete profile row",
+		})
+	}
+
+	type row struct {
+		UserID uuid.UUID
+		Email  string
+	}
+
+	for _, p := range profileTables {
+		var extras []row
+		err := db.Raw(fmt.Sprintf(`SELECT DISTINCT u.id AS user_id, u.email FROM users u
+			JOIN %s p ON p.user_id = u.id
+			WHERE u.deleted_at IS NULL AND u.user_type <> ?`, p.table), p.userType).Scan(&extras).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range extras {
+			issues = append(issues, Issue{
+				Kind:   KindExtraProfile,
+				UserID: e.UserID,
+				Email:  e.Email,
+				Table:  p.table,
+				Action: "delete profile row",
+			})
+		}
+
+		// Already disabled users are left alone so repeated runs settle
+		var missing []row
+		err = db.Raw(fmt.Sprintf(`SELECT u.id AS user_id, u.email FROM users u
+			LEFT JOIN %s p ON p.user_id = u.id
+			WHERE u.deleted_at IS NULL AND u.user_type = ? AND p.user_id IS NULL
+			AND u.status <> 'disabled'`, p.table), p.userType).Scan(&missing).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range missing {
+			issues = append(issues, Issue{
+				Kind:   KindMissingProfile,
+				UserID: m.UserID,
+				Email:  m.Email,
+				Table:  p.table,
+				Action: "disable user until the profile is recreated",
+			})
+		}
+	}
+
+	// Students the cohort backfill of migration 0020 had no enrollment to
+	// infer a year from, and any registered since without one
+	var uncohorted []row
+	err = db.Raw(`SELECT u.id AS user_id, u.email FROM users u
+		JOIN student_profiles sp ON sp.user_id = u.id
+		WHERE u.deleted_at IS NULL AND u.user_type = ? AND coalesce(sp.enrollment_year, 0) = 0`, core.UserTypeStudent).Scan(&uncohorted).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range uncohorted {
+		issues = append(issues, Issue{
+			Kind:   KindMissingCohort,
+			UserID: m.UserID,
+			Email:  m.Email,
+			Table:  "student_profiles",
+			Action: "set enrollment_year with PATCH /users/:id",
+			Manual: true,
+		})
+	}
+
+	return issues, nil
+}
+
+// listUsers prints every user of userType, or of every type if it is empty,
+// newest first, with their type-specific record. Users are loaded a page at
+// a time with their profiles batched per type, so the number of queries
+// grows with the pages rather than the users.
+func listUsers(repo *repository.Repository, userType core.UserType, asJSON bool) error {
+	enc := json.NewEncoder(os.Stdout)
+	page := pagination.Request{Limit: listPageSize}
+	count := 0
+	for {
+		users, err := repo.ListUsersWithProfiles(page, userType)
+		if err != nil {
+			return err
+		}
+		more := len(users) > page.Limit
+		if more {
+			users = users[:page.Limit]
+		}
+		for _, u := range users {
+			if asJSON {
+				if err := enc.Encode(u); err != nil {
+					return err
+				}
+			} else {
+				fmt.Printf("%s\t%s\t%s\t%s\n", u.ID, u.Email, u.UserType, profileSummary(&u))
+			}
+		}
+		count += len(users)
+		if !more {
+			break
+		}
+		last := users[len(users)-1]
+		page.After = &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID.String()}
+	}
+	if !asJSON {
+		fmt.Printf("\n%d user(s)\n", count)
+	}
+	return nil
+}
+
+// profileSummary describes the user's type-specific record in one line
+func profileSummary(u *core.User) string {
+	switch {
+	case u.ProfileMissing:
+		return "profile missing"
+	case u.StudentProfile != nil:
+		return fmt.Sprintf("enrollment %s (%d)", u.StudentProfile.EnrollmentNumber, u.StudentProfile.EnrollmentYear)
+	case u.InstructorProfile != nil:
+		return "employee " + u.InstructorProfile.EmployeeID
+	case len(u.InstituteAdminProfiles) > 0:
+		institutes := make([]string, len(u.InstituteAdminProfiles))
+		for i, p := range u.InstituteAdminProfiles {
+			institutes[i] = fmt.Sprintf("%s (%s)", p.InstituteName, p.Role)
+		}
+		return "admin of " + strings.Join(institutes, ", ")
+	}
+	return "-"
+}
+
+// fixIssue repairs a single issue inside its own transaction
+func fixIssue(db *gorm.DB, issue *Issue) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		switch issue.Kind {
+		case KindOrphanedProfile, KindExtraProfile:
+			return tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE user_id = ?", issue.Table), issue.UserID).Error
+		case KindMissingProfile:
+			// A profile needs data we do not have (e.g. enrollment number),
+			// so the user is disabled rather than left half-registered.
+			return tx.Exec("UPDATE users SET status = 'disabled', is_active = false, updated_at = ? WHERE id = ?", time.Now(), issue.UserID).Error
+		}
+		return fmt.Errorf("unknown issue kind %q", issue.Kind)
+	})
+}
+
+// confirmer returns a func that asks on stdin before each fix unless yes is set
+func confirmer(yes bool) func(*Issue) bool {
+	if yes {
+		return func(*Issue) bool { return true }
+	}
+	reader := bufio.NewReader(os.Stdin)
+	return func(issue *Issue) bool {
+		fmt.Printf("%s %s (%s): %s? [y/N] ", issue.Kind, issue.UserID, issue.Table, issue.Action)
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+func printReport(report Report) {
+	if len(report.Issues) == 0 {
+		fmt.Println("No inconsistencies found.")
+		return
+	}
+
+	for _, issue := range report.Issues {
+		status := "would " + issue.Action
+		switch {
+		case issue.Manual:
+			status = "left to an admin: " + issue.Action
+		case issue.Fixed:
+			status = "fixed: " + issue.Action
+		case issue.Error != "":
+			status = "failed: " + issue.Error
+		case !report.DryRun:
+			status = "skipped"
+		}
+		who := issue.UserID.String()
+		if issue.Email != "" {
+			who += " <" + issue.Email + ">"
+		}
+		fmt.Printf("- [%s] %s in %s: %s\n", issue.Kind, who, issue.Table, status)
+	}
+
+	fmt.Printf("\n%d issue(s) found", len(report.Issues))
+	if !report.DryRun {
+		fmt.Printf(", %d fixed, %d failed", report.Fixed, report.Failed)
+	}
+	fmt.Println()
+}
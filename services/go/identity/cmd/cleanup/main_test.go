@@ -0,0 +1,157 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// seededDB is an in-memory identity database holding one of each kind of
+// inconsistency next to a consistent user
+type seededDB struct {
+	db                                                   *gorm.DB
+	healthy, orphan, extra, missing, deleted, uncohorted uuid.UUID
+}
+
+func newSeededDB(t *testing.T) *seededDB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.User{}, &core.StudentProfile{}, &core.InstructorProfile{}, &core.InstituteAdminProfile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &seededDB{db: db, healthy: uuid.New(), orphan: uuid.New(), extra: uuid.New(), missing: uuid.New(), deleted: uuid.New(), uncohorted: uuid.New()}
+	create := func(value interface{}) {
+		t.Helper()
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	user := func(id uuid.UUID, userType core.UserType) *core.User {
+		return &core.User{ID: id, Email: id.String() + "@example.com", FullName: "User", UserType: userType, Status: "active", IsActive: true}
+	}
+
+	// A student with their profile
+	create(user(s.healthy, core.UserTypeStudent))
+	create(&core.StudentProfile{UserID: s.healthy, EnrollmentNumber: "E/1", EnrollmentYear: 2024})
+	// A student profile with no user behind it
+	create(&core.StudentProfile{UserID: s.orphan, EnrollmentNumber: "E/2"})
+	// An instructor who also has a student profile
+	create(user(s.extra, core.UserTypeInstructor))
+	create(&core.InstructorProfile{UserID: s.extra, EmployeeID: "T/1"})
+	create(&core.StudentProfile{UserID: s.extra, EnrollmentNumber: "E/3"})
+	// An institute admin without an admin profile
+	create(user(s.missing, core.UserTypeInstituteAdmin))
+	// A deleted student whose profile outlived them
+	create(user(s.deleted, core.UserTypeStudent))
+	create(&core.StudentProfile{UserID: s.deleted, EnrollmentNumber: "E/4"})
+	if err := db.Delete(&core.User{}, "id = ?", s.deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	// A student with no enrollment year to put them in a cohort
+	create(user(s.uncohorted, core.UserTypeStudent))
+	create(&core.StudentProfile{UserID: s.uncohorted, EnrollmentNumber: "E/5"})
+	return s
+}
+
+func TestFindIssuesDetectsInconsistencies(t *testing.T) {
+	s := newSeededDB(t)
+
+	issues, err := findIssues(s.db, repository.NewRepository(s.db))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type key struct {
+		kind  string
+		user  uuid.UUID
+		table string
+	}
+	found := make(map[key]bool, len(issues))
+	for _, issue := range issues {
+		found[key{issue.Kind, issue.UserID, issue.Table}] = true
+	}
+	want := []key{
+		{KindOrphanedProfile, s.orphan, "student_profiles"},
+		{KindOrphanedProfile, s.deleted, "student_profiles"},
+		{KindExtraProfile, s.extra, "student_profiles"},
+		{KindMissingProfile, s.missing, "institute_admin_profiles"},
+		{KindMissingCohort, s.uncohorted, "student_profiles"},
+	}
+	for _, k := range want {
+		if !found[k] {
+			t.Errorf("missing issue %+v", k)
+		}
+	}
+	if len(issues) != len(want) {
+		t.Errorf("got %d issues, want %d: %+v", len(issues), len(want), issues)
+	}
+	for _, issue := range issues {
+		if issue.UserID == s.healthy {
+			t.Errorf("consistent user reported: %+v", issue)
+		}
+	}
+
+	// Finding issues is all a dry run does; nothing has changed
+	var profiles int64
+	s.db.Model(&core.StudentProfile{}).Count(&profiles)
+	if profiles != 5 {
+		t.Fatalf("scanning changed the student profiles: %d left, want 5", profiles)
+	}
+}
+
+func TestFixIssuesResolvesEverything(t *testing.T) {
+	s := newSeededDB(t)
+
+	issues, err := findIssues(s.db, repository.NewRepository(s.db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range issues {
+		if issues[i].Manual {
+			continue
+		}
+		if err := fixIssue(s.db, &issues[i]); err != nil {
+			t.Fatalf("fixing %+v: %v", issues[i], err)
+		}
+	}
+
+	remaining, err := findIssues(s.db, repository.NewRepository(s.db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the students an admin has to give an enrollment year are left
+	if len(remaining) != 1 || remaining[0].Kind != KindMissingCohort || remaining[0].UserID != s.uncohorted || !remaining[0].Manual {
+		t.Fatalf("issues left after fixing: %+v", remaining)
+	}
+
+	var student core.StudentProfile
+	if err := s.db.First(&student, "user_id = ?", s.healthy).Error; err != nil {
+		t.Fatalf("consistent student's profile: %v", err)
+	}
+	var instructor core.InstructorProfile
+	if err := s.db.First(&instructor, "user_id = ?", s.extra).Error; err != nil {
+		t.Fatalf("instructor's own profile was removed: %v", err)
+	}
+	var admin core.User
+	if err := s.db.First(&admin, "id = ?", s.missing).Error; err != nil {
+		t.Fatal(err)
+	}
+	if admin.Status != "disabled" || admin.IsActive {
+		t.Fatalf("admin without a profile left %s", admin.Status)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxBatchSize keeps the widest INSERT, of users, under Postgres's limit of
+// 65535 parameters per statement
+const maxBatchSize = 4500
+
+// prefixPattern keeps institute codes, <PREFIX>-<n>, within the 2-16
+// characters of A-Z, 0-9 and '-' the API allows
+var prefixPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,9}$`)
+
+// Options says how much to generate. Counts of faculties, departments,
+// classes and students are per parent unit.
+type Options struct {
+	Institutes         int
+	Faculties          int
+	Departments        int
+	Classes            int
+	Terms              int
+	Students           int
+	Instructors        int
+	EnrollmentsPerTerm int
+	FirstTerm          time.Time
+	Seed               int64
+	Prefix             string
+	BatchSize          int
+}
+
+func (o Options) validate() error {
+	for _, c := range []struct {
+		flag  string
+		value int
+	}{
+		{"institutes", o.Institutes}, {"faculties", o.Faculties}, {"departments", o.Departments},
+		{"classes", o.Classes}, {"terms", o.Terms}, {"instructors", o.Instructors},
+	} {
+		if c.value < 1 {
+			return fmt.Errorf("--%s must be at least 1", c.flag)
+		}
+	}
+	if o.Students < 0 || o.EnrollmentsPerTerm < 0 {
+		return errors.New("--students and --enrollments must not be negative")
+	}
+	if perTerm := o.Faculties * o.Departments * o.Classes; o.EnrollmentsPerTerm > perTerm {
+		return fmt.Errorf("--enrollments must be at most the %d classes an institute runs per term", perTerm)
+	}
+	if o.BatchSize < 1 || o.BatchSize > maxBatchSize {
+		return fmt.Errorf("--batch-size must be between 1 and %d", maxBatchSize)
+	}
+	if !prefixPattern.MatchString(o.Prefix) {
+		return errors.New("--prefix must be 1-10 characters of a-z, 0-9 and '-'")
+	}
+	return nil
+}
+
+var (
+	firstNames = []string{
+		"Amara", "Ben", "Chen", "Dilan", "Elena", "Farah", "Gabriel", "Hana", "Ivan", "Jaya",
+		"Kofi", "Lena", "Mateo", "Nadia", "Omar", "Priya", "Quinn", "Rosa", "Sami", "Tara",
+		"Umar", "Vera", "Wei", "Ximena", "Yusuf", "Zoe",
+	}
+	lastNames = []string{
+		"Abeysekera", "Brown", "Costa", "Dubois", "Eriksen", "Fernando", "Garcia", "Haddad",
+		"Ito", "Jansen", "Kowalski", "Li", "Mensah", "Nguyen", "Okafor", "Perera", "Rossi",
+		"Silva", "Tanaka", "Usman", "Virtanen", "Weber", "Yilmaz", "Zhang",
+	}
+)
+
+// generator writes the fixtures. Everything it generates, IDs included,
+// comes from one seeded source, so a run is reproducible as long as the
+// calls to rng happen in the same order.
+type generator struct {
+	db   *gorm.DB
+	opts Options
+	rng  *rand.Rand
+}
+
+func newGenerator(db *gorm.DB, opts Options) *generator {
+	return &generator{db: db, opts: opts, rng: rand.New(rand.NewSource(opts.Seed))}
+}
+
+// newID returns the next UUID from the seeded source
+func (g *generator) newID() uuid.UUID {
+	id, err := uuid.NewRandomFromReader(g.rng)
+	if err != nil {
+		// math/rand never fails to read
+		panic(err)
+	}
+	return id
+}
+
+func (g *generator) name() (first, last string) {
+	return firstNames[g.rng.Intn(len(firstNames))], lastNames[g.rng.Intn(len(lastNames))]
+}
+
+// insert writes rows in batches of BatchSize, leaving associations alone
+func (g *generator) insert(tx *gorm.DB, rows any) error {
+	return tx.Omit(clause.Associations).CreateInBatches(rows, g.opts.BatchSize).Error
+}
+
+// Run generates every institute in turn
+func (g *generator) Run() error {
+	for n := 1; n <= g.opts.Institutes; n++ {
+		if err := g.institute(n); err != nil {
+			return fmt.Errorf("institute %d: %w", n, err)
+		}
+	}
+	return nil
+}
+
+// seat is a class students can be enrolled in, through its default section
+type seat struct {
+	classID   uuid.UUID
+	sectionID uuid.UUID
+}
+
+// institute generates institute n: its org units and terms in one
+// transaction, then its students a batch at a time
+func (g *generator) institute(n int) error {
+	domain := fmt.Sprintf("%s-%d.example.edu", g.opts.Prefix, n)
+	inst := core.Institute{
+		ID:                  g.newID(),
+		Name:                fmt.Sprintf("%s Institute %d", g.opts.Prefix, n),
+		Code:                strings.ToUpper(fmt.Sprintf("%s-%d", g.opts.Prefix, n)),
+		Domain:              domain,
+		ContactEmail:        "contact@" + domain,
+		IsActive:            true,
+		AllowedEmailDomains: []string{domain},
+		DefaultLocale:       "en",
+		Timezone:            "UTC",
+		CreatedAt:           g.opts.FirstTerm.AddDate(0, -1, 0),
+	}
+	inst.UpdatedAt = inst.CreatedAt
+
+	terms := make([]core.Term, g.opts.Terms)
+	for t := range terms {
+		starts := g.opts.FirstTerm.AddDate(0, 6*t, 0)
+		terms[t] = core.Term{
+			ID:          g.newID(),
+			InstituteID: inst.ID,
+			Name:        fmt.Sprintf("Term %d", t+1),
+			StartsOn:    starts,
+			EndsOn:      starts.AddDate(0, 5, -1),
+			IsCurrent:   t == len(terms)-1,
+			CreatedAt:   inst.CreatedAt,
+		}
+	}
+
+	var (
+		faculties   []core.Faculty
+		departments []core.Department
+		classes     []core.Class
+		sections    []core.ClassSection
+		seats       = make([][]seat, len(terms)) // per term
+	)
+	for f := 1; f <= g.opts.Faculties; f++ {
+		faculty := core.Faculty{ID: g.newID(), InstituteID: inst.ID, Name: fmt.Sprintf("Faculty %d", f), CreatedAt: inst.CreatedAt}
+		faculties = append(faculties, faculty)
+		for d := 1; d <= g.opts.Departments; d++ {
+			dept := core.Department{ID: g.newID(), FacultyID: faculty.ID, Name: fmt.Sprintf("Department %d.%d", f, d), CreatedAt: inst.CreatedAt}
+			departments = append(departments, dept)
+			for t := range terms {
+				for c := 1; c <= g.opts.Classes; c++ {
+					termID := terms[t].ID
+					class := core.Class{
+						ID:           g.newID(),
+						DepartmentID: dept.ID,
+						Name:         fmt.Sprintf("Class %d.%d.%d (%s)", f, d, c, terms[t].Name),
+						TermID:       &termID,
+						CreatedAt:    terms[t].StartsOn.AddDate(0, 0, -14),
+					}
+					section := core.ClassSection{
+						ID:        g.newID(),
+						ClassID:   class.ID,
+						Name:      repository.DefaultSectionName,
+						IsDefault: true,
+						CreatedAt: class.CreatedAt,
+					}
+					classes = append(classes, class)
+					sections = append(sections, section)
+					seats[t] = append(seats[t], seat{classID: class.ID, sectionID: section.ID})
+				}
+			}
+		}
+	}
+
+	admin, adminProfile := g.admin(inst, domain)
+	instructors, instructorProfiles := g.instructors(inst, domain)
+	for i := range sections {
+		sections[i].InstructorID = &instructors[i%len(instructors)].ID
+	}
+
+	err := g.db.Transaction(func(tx *gorm.DB) error {
+		for _, rows := range []any{
+			&[]core.Institute{inst}, &terms, &faculties, &departments, &classes,
+			&[]core.User{admin}, &[]core.InstituteAdminProfile{adminProfile},
+			&instructors, &instructorProfiles, &sections,
+		} {
+			if err := g.insert(tx, rows); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%s: %d faculties, %d departments, %d terms, %d classes, %d instructors",
+		inst.Code, len(faculties), len(departments), len(terms), len(classes), len(instructors))
+
+	for from := 0; from < g.opts.Students; from += g.opts.BatchSize {
+		to := min(from+g.opts.BatchSize, g.opts.Students)
+		if err := g.students(inst, domain, terms, seats, from, to); err != nil {
+			return err
+		}
+		log.Printf("%s: %d/%d students", inst.Code, to, g.opts.Students)
+	}
+	return nil
+}
+
+// admin returns the institute's owner
+func (g *generator) admin(inst core.Institute, domain string) (core.User, core.InstituteAdminProfile) {
+	first, last := g.name()
+	user := core.User{
+		ID:              g.newID(),
+		Email:           "admin@" + domain,
+		FullName:        first + " " + last,
+		UserType:        core.UserTypeInstituteAdmin,
+		IsActive:        true,
+		Status:          "active",
+		EmailVerified:   true,
+		EmailVerifiedAt: &inst.CreatedAt,
+		CreatedAt:       inst.CreatedAt,
+		UpdatedAt:       inst.CreatedAt,
+	}
+	return user, core.InstituteAdminProfile{UserID: user.ID, InstituteID: inst.ID, Role: core.InstituteRoleOwner}
+}
+
+func (g *generator) instructors(inst core.Institute, domain string) ([]core.User, []core.InstructorProfile) {
+	users := make([]core.User, g.opts.Instructors)
+	profiles := make([]core.InstructorProfile, g.opts.Instructors)
+	for i := range users {
+		first, last := g.name()
+		users[i] = core.User{
+			ID:              g.newID(),
+			Email:           fmt.Sprintf("%s.%s.i%d@%s", strings.ToLower(first), strings.ToLower(last), i+1, domain),
+			FullName:        first + " " + last,
+			UserType:        core.UserTypeInstructor,
+			IsActive:        true,
+			Status:          "active",
+			EmailVerified:   true,
+			EmailVerifiedAt: &inst.CreatedAt,
+			CreatedAt:       inst.CreatedAt,
+			UpdatedAt:       inst.CreatedAt,
+		}
+		profiles[i] = core.InstructorProfile{
+			UserID:     users[i].ID,
+			EmployeeID: fmt.Sprintf("%s-E%05d", inst.Code, i+1),
+		}
+	}
+	return users, profiles
+}
+
+// students generates students from up to to, numbered from zero, with their
+// enrollments, and writes them in one transaction. Each joins in a random
+// term and takes EnrollmentsPerTerm classes in it and every term after.
+func (g *generator) students(inst core.Institute, domain string, terms []core.Term, seats [][]seat, from, to int) error {
+	users := make([]core.User, 0, to-from)
+	profiles := make([]core.StudentProfile, 0, to-from)
+	var enrollments []core.ClassEnrollment
+
+	for k := from; k < to; k++ {
+		joined := g.rng.Intn(len(terms))
+		joinedAt := terms[joined].StartsOn.AddDate(0, 0, -g.rng.Intn(30)-1)
+		first, last := g.name()
+		user := core.User{
+			ID:              g.newID(),
+			Email:           fmt.Sprintf("%s.%s.%d@%s", strings.ToLower(first), strings.ToLower(last), k+1, domain),
+			FullName:        first + " " + last,
+			UserType:        core.UserTypeStudent,
+			IsActive:        true,
+			Status:          "active",
+			EmailVerified:   true,
+			EmailVerifiedAt: &joinedAt,
+			CreatedAt:       joinedAt,
+			UpdatedAt:       joinedAt,
+		}
+		instituteID := inst.ID
+		users = append(users, user)
+		profiles = append(profiles, core.StudentProfile{
+			UserID:           user.ID,
+			InstituteID:      &instituteID,
+			EnrollmentNumber: fmt.Sprintf("S%07d", k+1),
+			EnrollmentYear:   terms[joined].StartsOn.Year(),
+			IntakeSeason:     core.SeasonOf(terms[joined].StartsOn),
+		})
+
+		for t := joined; t < len(terms); t++ {
+			for _, i := range g.pick(len(seats[t]), g.opts.EnrollmentsPerTerm) {
+				enrollments = append(enrollments, core.ClassEnrollment{
+					StudentID:  user.ID,
+					ClassID:    seats[t][i].classID,
+					SectionID:  seats[t][i].sectionID,
+					EnrolledAt: terms[t].StartsOn.Add(time.Duration(g.rng.Intn(14*24)) * time.Hour),
+				})
+			}
+		}
+	}
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if err := g.insert(tx, &users); err != nil {
+			return err
+		}
+		if err := g.insert(tx, &profiles); err != nil {
+			return err
+		}
+		if len(enrollments) == 0 {
+			return nil
+		}
+		return g.insert(tx, &enrollments)
+	})
+}
+
+// pick returns k distinct indexes below n
+func (g *generator) pick(n, k int) []int {
+	picked := make([]int, 0, k)
+	seen := make(map[int]bool, k)
+	for len(picked) < k {
+		i := g.rng.Intn(n)
+		if !seen[i] {
+			seen[i] = true
+			picked = append(picked, i)
+		}
+	}
+	return picked
+}
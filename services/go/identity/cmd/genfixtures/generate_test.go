@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/pkg/server"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newFixtureDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(server.Models()...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+var smallOptions = Options{
+	Institutes:         2,
+	Faculties:          2,
+	Departments:        2,
+	Classes:            2,
+	Terms:              2,
+	Students:           25,
+	Instructors:        3,
+	EnrollmentsPerTerm: 3,
+	FirstTerm:          time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+	Seed:               7,
+	Prefix:             "test",
+	BatchSize:          10,
+}
+
+func TestGeneratedFixturesHoldTogether(t *testing.T) {
+	db := newFixtureDB(t)
+	if empty, err := isEmpty(db); err != nil || !empty {
+		t.Fatalf("new database empty = %v, %v", empty, err)
+	}
+	if err := newGenerator(db, smallOptions).Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := rowCounts(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := map[string]int64{}
+	for _, c := range counts {
+		rows[c.table] = c.rows
+	}
+	o := smallOptions
+	classes := int64(o.Institutes * o.Faculties * o.Departments * o.Classes * o.Terms)
+	if rows["classes"] != classes || rows["class_sections"] != classes {
+		t.Errorf("%d classes and %d sections, want %d of each", rows["classes"], rows["class_sections"], classes)
+	}
+	// Students join in a random term and take EnrollmentsPerTerm classes in
+	// each term from then on
+	students := int64(o.Institutes * o.Students)
+	if n := rows["class_enrollments"]; n < students*int64(o.EnrollmentsPerTerm) || n > students*int64(o.Terms*o.EnrollmentsPerTerm) {
+		t.Errorf("%d enrollments for %d students", n, students)
+	}
+	var unevenTerms int64
+	if err := db.Raw(`SELECT COUNT(*) FROM (
+		SELECT e.student_id, c.term_id FROM class_enrollments e JOIN classes c ON c.id = e.class_id
+		GROUP BY e.student_id, c.term_id HAVING COUNT(*) <> ?) uneven`, o.EnrollmentsPerTerm).Scan(&unevenTerms).Error; err != nil {
+		t.Fatal(err)
+	}
+	if unevenTerms != 0 {
+		t.Errorf("%d student terms without %d classes", unevenTerms, o.EnrollmentsPerTerm)
+	}
+	if want := int64(o.Institutes * (o.Students + o.Instructors + 1)); rows["users"] != want {
+		t.Errorf("%d users, want %d", rows["users"], want)
+	}
+
+	// Every enrollment is of a student in a class and section that exist
+	for name, query := range map[string]string{
+		"without a student": `SELECT COUNT(*) FROM class_enrollments e LEFT JOIN users u ON u.id = e.student_id AND u.user_type = 'STUDENT' WHERE u.id IS NULL`,
+		"without a class":   `SELECT COUNT(*) FROM class_enrollments e LEFT JOIN classes c ON c.id = e.class_id WHERE c.id IS NULL`,
+		"without a section": `SELECT COUNT(*) FROM class_enrollments e LEFT JOIN class_sections s ON s.id = e.section_id AND s.class_id = e.class_id WHERE s.id IS NULL`,
+		"without a term":    `SELECT COUNT(*) FROM classes c LEFT JOIN terms t ON t.id = c.term_id WHERE t.id IS NULL`,
+	} {
+		var n int64
+		if err := db.Raw(query).Scan(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%d rows %s", n, name)
+		}
+	}
+
+	var duplicates int64
+	db.Raw(`SELECT COUNT(*) FROM (SELECT email FROM users GROUP BY email HAVING COUNT(*) > 1) d`).Scan(&duplicates)
+	if duplicates != 0 {
+		t.Errorf("%d emails are used twice", duplicates)
+	}
+	if empty, err := isEmpty(db); err != nil || empty {
+		t.Errorf("filled database empty = %v, %v", empty, err)
+	}
+}
+
+func TestGeneratedFixturesAreReproducible(t *testing.T) {
+	emails := func() []string {
+		db := newFixtureDB(t)
+		if err := newGenerator(db, smallOptions).Run(); err != nil {
+			t.Fatal(err)
+		}
+		var emails []string
+		if err := db.Table("users").Order("id").Pluck("email", &emails).Error; err != nil {
+			t.Fatal(err)
+		}
+		return emails
+	}
+	if first, second := emails(), emails(); !reflect.DeepEqual(first, second) {
+		t.Error("two runs with the same seed generated different users")
+	}
+}
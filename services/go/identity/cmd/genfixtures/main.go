@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/migrations"
+	"github.com/joho/godotenv"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: genfixtures [flags]
+
+Fills an identity database with institutes, their faculties, departments,
+terms and classes, and students enrolled in classes term after term, for
+load tests. Runs with the same flags and seed produce the same data.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	var opts Options
+	flag.IntVar(&opts.Institutes, "institutes", 1, "institutes to create")
+	flag.IntVar(&opts.Faculties, "faculties", 3, "faculties per institute")
+	flag.IntVar(&opts.Departments, "departments", 4, "departments per faculty")
+	flag.IntVar(&opts.Classes, "classes", 5, "classes per department in each term")
+	flag.IntVar(&opts.Terms, "terms", 4, "terms per institute, one after another")
+	flag.IntVar(&opts.Students, "students", 1000, "students per institute")
+	flag.IntVar(&opts.Instructors, "instructors", 20, "instructors per institute, teaching the class sections")
+	flag.IntVar(&opts.EnrollmentsPerTerm, "enrollments", 4, "classes each student is enrolled in per term")
+	flag.Int64Var(&opts.Seed, "seed", 1, "random seed; the same seed gives the same data")
+	flag.StringVar(&opts.Prefix, "prefix", "loadtest", "prefix of institute names, codes and email domains, so runs with different prefixes can share a database")
+	flag.IntVar(&opts.BatchSize, "batch-size", 1000, "rows per INSERT")
+	firstTerm := flag.String("first-term", "2024-01-08", "start date of each institute's first term (YYYY-MM-DD)")
+	dsn := flag.String("dsn", "", "database to fill (default IDENTITY_DATABASE_URL or DATABASE_URL)")
+	allowNonEmpty := flag.Bool("allow-non-empty", false, "run even if the database already holds users or institutes")
+	flag.Usage = usage
+	flag.Parse()
+
+	start, err := time.Parse(time.DateOnly, *firstTerm)
+	if err != nil {
+		log.Fatal("--first-term must be a date like 2024-01-08")
+	}
+	opts.FirstTerm = start
+	if err := opts.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	_ = godotenv.Load(".env", "../.env", "../../.env", "../../../.env", "../../../../.env", "../../../../../.env")
+	if *dsn == "" {
+		*dsn = os.Getenv("IDENTITY_DATABASE_URL")
+	}
+	if *dsn == "" {
+		*dsn = os.Getenv("DATABASE_URL")
+	}
+	if *dsn == "" {
+		log.Fatal("--dsn, IDENTITY_DATABASE_URL or DATABASE_URL must be set")
+	}
+
+	// Statement logging would drown the progress output
+	db, err := gorm.Open(postgres.Open(*dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	migrator, err := migrations.NewRunner(db)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+
+	if !*allowNonEmpty {
+		empty, err := isEmpty(db)
+		if err != nil {
+			log.Fatal("Failed to check the database:", err)
+		}
+		if !empty {
+			log.Fatal("The database already holds users or institutes; pass --allow-non-empty to add fixtures anyway")
+		}
+	}
+
+	began := time.Now()
+	gen := newGenerator(db, opts)
+	if err := gen.Run(); err != nil {
+		log.Fatal("Failed to generate fixtures:", err)
+	}
+	log.Printf("Done in %s", time.Since(began).Round(time.Millisecond))
+
+	counts, err := rowCounts(db)
+	if err != nil {
+		log.Fatal("Failed to count rows:", err)
+	}
+	fmt.Println("\nRows in the database:")
+	for _, c := range counts {
+		fmt.Printf("  %-26s %d\n", c.table, c.rows)
+	}
+}
+
+// isEmpty tells whether the database holds no users or institutes, deleted
+// ones included
+func isEmpty(db *gorm.DB) (bool, error) {
+	for _, table := range []string{"users", "institutes"} {
+		var n int64
+		if err := db.Table(table).Count(&n).Error; err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+type tableCount struct {
+	table string
+	rows  int64
+}
+
+// countedTables are the tables the generator fills
+var countedTables = []string{
+	"institutes", "faculties", "departments", "terms", "classes", "class_sections",
+	"users", "student_profiles", "instructor_profiles", "institute_admin_profiles", "class_enrollments",
+}
+
+func rowCounts(db *gorm.DB) ([]tableCount, error) {
+	counts := make([]tableCount, 0, len(countedTables))
+	for _, table := range countedTables {
+		var n int64
+		if err := db.Table(table).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		counts = append(counts, tableCount{table: table, rows: n})
+	}
+	return counts, nil
+}
@@ -0,0 +1,40 @@
+// Command migrate applies, reverts or lists the identity schema migrations:
+//
+//	go run ./cmd/migrate up
+//	go run ./cmd/migrate down [n|all]
+//	go run ./cmd/migrate status
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/database/migrate"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/migrations"
+	"github.com/joho/godotenv"
+	"gorm.io/driver/postgres"
+)
+
+func main() {
+	_ = godotenv.Load(".env", "../.env", "../../.env", "../../../.env", "../../../../.env", "../../../../../.env")
+
+	cfg := config.Load()
+	if cfg.DatabaseURL == "" {
+		log.Fatal("IDENTITY_DATABASE_URL or DATABASE_URL must be set")
+	}
+	db, err := database.Open(postgres.Open(cfg.DatabaseURL), database.DefaultPoolConfig)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	migrator, err := migrations.NewRunner(db)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+	if err := migrate.Command(context.Background(), migrator, os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
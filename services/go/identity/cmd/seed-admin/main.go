@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"time"
 
 	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/migrations"
 	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -41,19 +44,25 @@ func main() {
 
 	repo := repository.NewRepository(db)
 
-	// 2.5 Auto-Migrate to ensure schema is up to date
-	if err := repo.AutoMigrate(); err != nil {
+	// 2.5 Apply pending migrations to ensure schema is up to date
+	migrator, err := migrations.NewRunner(db)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
 	// 3. User Logic
+	now := time.Now()
 	newUser := &core.User{
-		Email:         email,
-		FullName:      name,
-		UserType:      core.UserTypeSystemAdmin,
-		IsActive:      true,
-		Status:        "active",
-		EmailVerified: true,
+		Email:           email,
+		FullName:        name,
+		UserType:        core.UserTypeSystemAdmin,
+		IsActive:        true,
+		Status:          "active",
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
 	}
 
 	// Check if user exists
@@ -65,6 +74,9 @@ func main() {
 		existingUser.IsActive = true
 		existingUser.Status = "active"
 		existingUser.EmailVerified = true
+		if existingUser.EmailVerifiedAt == nil {
+			existingUser.EmailVerifiedAt = &now
+		}
 
 		if err := repo.UpdateUser(existingUser); err != nil {
 			log.Fatal("Failed to update system admin:", err)
@@ -1,21 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
-	"os"
-	"time"
+	"net"
+	_ "time/tzdata" // office-hours slots name IANA zones; do not rely on the image having them
 
-	"github.com/4yrg/gradeloop-core/services/go/identity/internal/api"
-	"github.com/4yrg/gradeloop-core/services/go/identity/internal/config"
-	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
-	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/database/migrate"
+	"github.com/4yrg/gradeloop-core/libs/debugserver"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/migrations"
+	"github.com/4yrg/gradeloop-core/services/go/identity/pkg/server"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	gormLogger "gorm.io/gorm/logger"
 )
 
 func main() {
@@ -23,67 +21,65 @@ func main() {
 	_ = godotenv.Load(".env", "../.env", "../../.env", "../../../.env", "../../../../.env", "../../../../../.env")
 
 	// 1. Load Configuration
-	cfg := config.Load()
+	cfg := server.LoadConfig()
 	if cfg.DatabaseURL == "" {
 		log.Fatal("IDENTITY_DATABASE_URL or DATABASE_URL must be set")
 	}
 
-	// 2. Setup DB with optimized logger configuration
-	newLogger := gormLogger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags),
-		gormLogger.Config{
-			SlowThreshold:             time.Second,   // Slow SQL threshold increased to 1 second
-			LogLevel:                  gormLogger.Warn, // Only log warnings and errors
-			IgnoreRecordNotFoundError: true,            // Don't log "record not found" as errors
-			ParameterizedQueries:      true,            // Don't include params in SQL log for security
-			Colorful:                  true,            // Enable color for better readability
-		},
-	)
-	
-	db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{
-		Logger: newLogger,
-	})
+	// 2. Setup DB with a bounded pool and slow-query logging
+	poolCfg, err := database.LoadPoolConfig("IDENTITY")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.Open(postgres.Open(cfg.DatabaseURL), poolCfg)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// Configure connection pool for better performance
-	sqlDB, err := db.DB()
+	// Apply pending schema migrations, or refuse to start while any are pending
+	migrator, err := migrations.NewRunner(db)
 	if err != nil {
-		log.Fatal("Failed to get underlying sql.DB:", err)
+		log.Fatal("Failed to load migrations:", err)
 	}
-
-	// Configure connection pool
-	sqlDB.SetMaxIdleConns(10)    // Maximum idle connections
-	sqlDB.SetMaxOpenConns(100)   // Maximum open connections  
-	sqlDB.SetConnMaxLifetime(time.Hour) // Connection max lifetime
-
-	// 3. Setup Components
-	repo := repository.NewRepository(db)
-
-	// Auto-Migrate (Dev only)
-	if err := repo.AutoMigrate(); err != nil {
+	if err := migrator.Boot(context.Background(), migrate.Mode(cfg.RunMigrations), log.Printf); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
-	// Add performance indexes
-	if err := repo.AddPerformanceIndexes(); err != nil {
-		log.Printf("Warning: Failed to add some performance indexes: %v", err)
-		// Don't fail startup for index creation issues
+	debugVars := []debugserver.Var{{Name: "db_pool", Value: database.StatsFunc(db)}}
+
+	// Route heavy read-only queries to the read replica, if there is one
+	var replicaDB *gorm.DB
+	if cfg.ReplicaDatabaseURL != "" {
+		replicaDB, err = database.Open(postgres.Open(cfg.ReplicaDatabaseURL), poolCfg)
+		if err != nil {
+			log.Printf("Warning: Failed to connect to the read replica, reading from the primary only: %v", err)
+			replicaDB = nil
+		} else {
+			debugVars = append(debugVars, debugserver.Var{Name: "db_replica_pool", Value: database.StatsFunc(replicaDB)})
+		}
 	}
 
-	svc := service.NewIdentityService(repo, cfg)
-	handler := api.NewHandler(svc)
+	// 3. Setup Components
+	srv := server.New(cfg, db, replicaDB)
+	srv.Start(context.Background())
 
-	// 4. Setup Fiber
-	app := fiber.New()
-	app.Use(logger.New())
-	app.Use(recover.New())
+	// Profiling and runtime stats on DEBUG_ADDR, off unless it is set
+	if err := debugserver.Start(debugVars...); err != nil {
+		log.Fatal(err)
+	}
 
-	api.SetupRoutes(app, handler)
+	// 4. Start the gRPC API, which shares the service with the HTTP one
+	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		log.Fatalf("failed to listen for gRPC: %v", err)
+	}
+	go func() {
+		log.Printf("Identity Service gRPC API starting on port %s", cfg.GRPCPort)
+		log.Fatal(srv.GRPC.Serve(lis))
+	}()
 
 	// 5. Start
 	log.Printf("Identity Service running on :%s", cfg.Port)
 	log.Printf("Email Service URL: %s", cfg.EmailServiceURL)
-	log.Fatal(app.Listen(":" + cfg.Port))
+	log.Fatal(srv.App.Listen(":" + cfg.Port))
 }
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// actorKey is the fiber.Ctx Locals key identifyActor stores the caller under
+const actorKey = "identity.actor"
+
+// userIDHeader carries the user a calling service acts for on internal calls
+const userIDHeader = "X-User-Id"
+
+// identifyActor notes who is making a change, for the activity log: the user
+// of a valid bearer token or, when trustHeaders is set because the internal
+// token has been checked, the user and impersonator a calling service
+// forwards in X-User-Id and X-Impersonator-Id. Changes with neither are the
+// system's. It never rejects a request; routes that need a user have
+// jwtauth.Middleware for that.
+func identifyActor(v *jwtauth.Verifier, trustHeaders bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			return c.Next()
+		}
+
+		var actor service.Actor
+		if token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer "); ok && token != "" {
+			if claims, err := v.Verify(c.UserContext(), token); err == nil {
+				actor = service.Actor{UserID: claims.UserID, ImpersonatorID: claims.Impersonator}
+			}
+		}
+		if actor.UserID == "" && trustHeaders {
+			actor = service.Actor{UserID: c.Get(userIDHeader), ImpersonatorID: c.Get(jwtauth.ImpersonatorHeader)}
+		}
+		c.Locals(actorKey, actor)
+		return c.Next()
+	}
+}
+
+// as returns the service acting for the caller identifyActor found
+func (h *Handler) as(c *fiber.Ctx) *service.IdentityService {
+	actor, _ := c.Locals(actorKey).(service.Actor)
+	return h.svc.As(actor)
+}
+
+// ListActivity returns a page of the activity log, filtered by actor_id,
+// entity_type and entity_id, and by created_at from (inclusive) and to
+// (exclusive), both RFC 3339. Only system admins may read it.
+func (h *Handler) ListActivity(c *fiber.Ctx) error {
+	if jwtauth.ClaimsFrom(c).Role != string(core.UserTypeSystemAdmin) {
+		return apierror.Forbidden("only system admins may read the activity log")
+	}
+
+	page, err := pagination.Parse(c.Query("cursor"), c.Query("offset"), c.Query("limit"), 50, 200)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
+	}
+	filter := repository.ActivityFilter{
+		ActorID:    c.Query("actor_id"),
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+	}
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if raw := c.Query(name); raw != "" {
+			if *t, err = time.Parse(time.RFC3339, raw); err != nil {
+				return apierror.BadRequest(name + " must be an RFC 3339 time")
+			}
+		}
+	}
+
+	entries, err := h.svc.ListActivity(filter, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		return apierror.BadRequest(err.Error())
+	}
+	if err != nil {
+		return apiError(err, "activity")
+	}
+	return c.JSON(entries)
+}
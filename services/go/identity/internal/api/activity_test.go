@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newActivityTestApp is newTestApp with the activity log running. The
+// returned func stops it, writing what was recorded.
+func newActivityTestApp(t *testing.T) (*fiber.App, *gorm.DB, func()) {
+	t.Helper()
+	t.Setenv("INTERNAL_SECRET", "internal")
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.User{}, &core.StudentProfile{}, &core.InstructorProfile{}, &core.InstituteAdminProfile{}, &core.Institute{}, &core.OutboxEvent{}, &core.ActivityEntry{}); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := signingKey(t)
+		_ = json.NewEncoder(w).Encode(jwtauth.JWKS{Keys: []jwtauth.JWK{jwtauth.PublicJWK(jwtauth.Thumbprint(&key.PublicKey), &key.PublicKey)}})
+	}))
+	t.Cleanup(jwks.Close)
+
+	svc := service.NewIdentityService(repository.NewRepository(db), &config.Config{ActivityBufferSize: 100, ActivityBatchSize: 100, ActivityFlushInterval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.RunActivityLog(ctx)
+	}()
+	t.Cleanup(cancel)
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler})
+	SetupRoutes(app, NewHandler(svc, jwtauth.NewVerifier(jwtauth.Config{JWKSURL: jwks.URL}), nil))
+	return app, db, func() {
+		cancel()
+		<-done
+	}
+}
+
+// roleBearer is bearer for a user with a role
+func roleBearer(t *testing.T, userID, role string) string {
+	t.Helper()
+	key := signingKey(t)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtauth.Claims{
+		UserID:    userID,
+		SessionID: "session-" + userID,
+		Role:      role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			Issuer:    jwtauth.Issuer,
+			Audience:  []string{jwtauth.Audience},
+		},
+	})
+	token.Header["kid"] = jwtauth.Thumbprint(&key.PublicKey)
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func TestActivityIsAttributedToTheForwardedUser(t *testing.T) {
+	app, db, flush := newActivityTestApp(t)
+
+	send := func(method, path, body string, headers map[string]string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// The gateway forwards the user it acts for, and the admin impersonating
+	// them, with its internal token
+	resp := send("POST", "/internal/identity/users", `{"email":"ada@example.edu","name":"Ada","user_type":"INSTRUCTOR","employee_id":"T1"}`, map[string]string{
+		"X-Internal-Token":  "internal",
+		"X-User-Id":         "admin-1",
+		"X-Impersonator-Id": "sysadmin-1",
+	})
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("create user = %d", resp.StatusCode)
+	}
+	var user struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+
+	// A bearer token names the caller over any forwarded user
+	resp = send("PATCH", "/internal/identity/users/"+user.ID, `{"name":"Ada Lovelace"}`, map[string]string{
+		"X-Internal-Token": "internal",
+		"X-User-Id":        "admin-1",
+		"Authorization":    bearer(t, "admin-2"),
+	})
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("update user = %d", resp.StatusCode)
+	}
+
+	// Outside the internal routes nobody vouches for the header
+	resp = send("POST", "/orgs/institutes", `{"name":"Uni","code":"UNI","domain":"uni.example.edu","contact_email":"admin@uni.example.edu"}`, map[string]string{
+		"X-User-Id": "admin-1",
+	})
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("create institute = %d", resp.StatusCode)
+	}
+	flush()
+
+	var entries []core.ActivityEntry
+	if err := db.Order("created_at").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []core.ActivityEntry{
+		{ActorID: "admin-1", ImpersonatorID: "sysadmin-1", Action: "user.create"},
+		{ActorID: "admin-2", Action: "user.update"},
+		{Action: "institute.create"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("logged %+v, want %+v", entries, want)
+	}
+	for i, w := range want {
+		if got := entries[i]; got.ActorID != w.ActorID || got.ImpersonatorID != w.ImpersonatorID || got.Action != w.Action {
+			t.Errorf("entry %d = %s by %q as %q, want %s by %q as %q", i, got.Action, got.ActorID, got.ImpersonatorID, w.Action, w.ActorID, w.ImpersonatorID)
+		}
+	}
+
+	// Only system admins read the log
+	list := func(token string) int {
+		return send("GET", "/internal/identity/activity?actor_id=admin-1", "", map[string]string{
+			"X-Internal-Token": "internal",
+			"Authorization":    token,
+		}).StatusCode
+	}
+	if got := list(roleBearer(t, "admin-2", string(core.UserTypeInstituteAdmin))); got != fiber.StatusForbidden {
+		t.Errorf("institute admin reading the log = %d, want 403", got)
+	}
+	resp = send("GET", "/internal/identity/activity?actor_id=admin-1", "", map[string]string{
+		"X-Internal-Token": "internal",
+		"Authorization":    roleBearer(t, "sysadmin-1", string(core.UserTypeSystemAdmin)),
+	})
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("system admin reading the log = %d", resp.StatusCode)
+	}
+	var page struct {
+		Items []struct {
+			Action  string                    `json:"action"`
+			Changes map[string]map[string]any `json:"changes"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Action != "user.create" || page.Items[0].Changes["email"]["to"] != "ada@example.edu" {
+		t.Errorf("admin-1's activity = %+v, want the user they created", page.Items)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// nullableTime is nullableInt for times
+type nullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (n *nullableTime) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	return json.Unmarshal(data, &n.Value)
+}
+
+func (h *Handler) CreateAnnouncement(c *fiber.Ctx, req *service.AnnouncementRequest) error {
+	if err := h.authorizeAnnouncement(c, "create", req.Scope, req.ScopeID); err != nil {
+		return err
+	}
+	announcement, err := h.svc.CreateAnnouncement(jwtauth.ClaimsFrom(c).UserID, *req)
+	if err != nil {
+		return apiError(err, "announcement")
+	}
+	return c.Status(fiber.StatusCreated).JSON(announcement)
+}
+
+func (h *Handler) GetAnnouncement(c *fiber.Ctx) error {
+	announcement, err := h.svc.GetAnnouncement(c.Params("id"))
+	if err != nil {
+		return apiError(err, "announcement")
+	}
+	return c.JSON(announcement)
+}
+
+type updateAnnouncementRequest struct {
+	Title           string       `json:"title"`
+	Body            string       `json:"body"`
+	PublishAt       *time.Time   `json:"publish_at"`
+	ExpiresAt       nullableTime `json:"expires_at"`
+	Notify          *bool        `json:"notify"`
+	ExpectedVersion *int         `json:"expected_version"`
+}
+
+func (h *Handler) UpdateAnnouncement(c *fiber.Ctx, req *updateAnnouncementRequest) error {
+	version, err := expectedVersion(c, req.ExpectedVersion)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
+	}
+
+	current, err := h.svc.GetAnnouncement(c.Params("id"))
+	if err != nil {
+		return apiError(err, "announcement")
+	}
+	if err := h.authorizeAnnouncement(c, "update", current.Scope, current.ScopeID.String()); err != nil {
+		return err
+	}
+
+	announcement, err := h.svc.UpdateAnnouncement(c.Params("id"), service.AnnouncementUpdate{
+		Title:        req.Title,
+		Body:         req.Body,
+		PublishAt:    req.PublishAt,
+		ExpiresAt:    req.ExpiresAt.Value,
+		SetExpiresAt: req.ExpiresAt.Set,
+		Notify:       req.Notify,
+	}, version)
+	if err != nil {
+		return apiError(err, "announcement")
+	}
+	return c.JSON(announcement)
+}
+
+func (h *Handler) DeleteAnnouncement(c *fiber.Ctx) error {
+	current, err := h.svc.GetAnnouncement(c.Params("id"))
+	if err != nil {
+		return apiError(err, "announcement")
+	}
+	if err := h.authorizeAnnouncement(c, "delete", current.Scope, current.ScopeID.String()); err != nil {
+		return err
+	}
+	if err := h.svc.DeleteAnnouncement(c.Params("id")); err != nil {
+		return apiError(err, "announcement")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetUserAnnouncements returns the announcements shown to the user now
+func (h *Handler) GetUserAnnouncements(c *fiber.Ctx) error {
+	announcements, err := h.svc.GetUserAnnouncements(c.Params("id"))
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(announcements)
+}
+
+// authorizeAnnouncement needs the announcement permission for action scoped
+// to the org unit addressed, e.g. class:<id>. It must run after
+// jwtauth.Middleware.
+func (h *Handler) authorizeAnnouncement(c *fiber.Ctx, action string, scope core.AnnouncementScope, scopeID string) error {
+	claims := jwtauth.ClaimsFrom(c)
+	allowed, err := h.authz.Check(c.UserContext(), claims.UserID, claims.Role, "announcement", action, string(scope)+":"+scopeID)
+	if err != nil {
+		return apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "authorization check failed")
+	}
+	if !allowed {
+		return apierror.Forbidden("not allowed to " + action + " announcements for this " + string(scope))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"errors"
+	"io"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetInstituteBranding returns the institute's colors, email footer and
+// logo URL, for the portal and the email service
+func (h *Handler) GetInstituteBranding(c *fiber.Ctx) error {
+	branding, err := h.svc.GetInstituteBranding(c.Params("id"))
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(branding)
+}
+
+func (h *Handler) UpdateInstituteBranding(c *fiber.Ctx, req *service.BrandingRequest) error {
+	branding, err := h.as(c).UpdateInstituteBranding(c.Params("id"), *req)
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(branding)
+}
+
+// UploadInstituteLogo takes the logo as the multipart file "logo"
+func (h *Handler) UploadInstituteLogo(c *fiber.Ctx) error {
+	file, err := c.FormFile("logo")
+	if err != nil {
+		return apierror.Validation(apierror.FieldError{Field: "logo", Message: "is required"})
+	}
+	if file.Size > service.MaxLogoSize {
+		return apierror.PayloadTooLarge(service.MaxLogoSize)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return apierror.Internal(err)
+	}
+	defer f.Close()
+	// One byte over the limit is enough to tell the file is too large
+	content, err := io.ReadAll(io.LimitReader(f, service.MaxLogoSize+1))
+	if err != nil {
+		return apierror.Internal(err)
+	}
+
+	branding, err := h.as(c).UploadInstituteLogo(c.UserContext(), c.Params("id"), content)
+	if errors.Is(err, service.ErrStorageUnavailable) {
+		return apierror.New(fiber.StatusServiceUnavailable, apierror.CodeUnavailable, "logo uploads are unavailable")
+	}
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(branding)
+}
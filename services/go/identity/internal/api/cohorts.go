@@ -0,0 +1,36 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetInstituteCohorts lists the institute's cohorts with their student counts
+func (h *Handler) GetInstituteCohorts(c *fiber.Ctx) error {
+	cohorts, err := h.svc.GetInstituteCohorts(c.Params("id"))
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(cohorts)
+}
+
+// ListCohortStudents lists the students of one of the institute's cohorts,
+// a page at a time
+func (h *Handler) ListCohortStudents(c *fiber.Ctx) error {
+	page, err := pagination.Parse(c.Query("cursor"), c.Query("offset"), c.Query("limit"), 50, 500)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
+	}
+
+	students, err := h.svc.ListCohortStudents(c.Params("id"), c.Params("label"), page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		return apierror.BadRequest(err.Error())
+	}
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(students)
+}
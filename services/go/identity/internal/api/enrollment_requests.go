@@ -0,0 +1,50 @@
+package api
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/gofiber/fiber/v2"
+)
+
+type enrollmentRequestRequest struct {
+	// SectionID defaults to the class's default section
+	SectionID string `json:"section_id"`
+}
+
+// RequestEnrollment asks for the caller, a student, to join the class. A new
+// request is 201 and a repeated one returns the existing request with 200.
+func (h *Handler) RequestEnrollment(c *fiber.Ctx, req *enrollmentRequestRequest) error {
+	request, created, err := h.as(c).RequestEnrollment(jwtauth.ClaimsFrom(c).UserID, c.Params("id"), req.SectionID)
+	if err != nil {
+		return apiError(err, "class")
+	}
+	if created {
+		c.Status(fiber.StatusCreated)
+	}
+	return c.JSON(request)
+}
+
+// GetEnrollmentRequests lists the pending requests to join the class, for an
+// instructor of it
+func (h *Handler) GetEnrollmentRequests(c *fiber.Ctx) error {
+	requests, err := h.svc.GetEnrollmentRequests(jwtauth.ClaimsFrom(c).UserID, c.Params("id"))
+	if err != nil {
+		return apiError(err, "class")
+	}
+	return c.JSON(requests)
+}
+
+func (h *Handler) ApproveEnrollmentRequest(c *fiber.Ctx) error {
+	enrollment, err := h.as(c).ApproveEnrollmentRequest(jwtauth.ClaimsFrom(c).UserID, c.Params("id"), c.Params("student_id"))
+	if err != nil {
+		return apiError(err, "enrollment request")
+	}
+	return c.JSON(enrollment)
+}
+
+func (h *Handler) RejectEnrollmentRequest(c *fiber.Ctx) error {
+	enrollment, err := h.as(c).RejectEnrollmentRequest(jwtauth.ClaimsFrom(c).UserID, c.Params("id"), c.Params("student_id"))
+	if err != nil {
+		return apiError(err, "enrollment request")
+	}
+	return c.JSON(enrollment)
+}
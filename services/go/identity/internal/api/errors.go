@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+)
+
+// Identity-specific error codes, on top of the shared catalogue
+const (
+	codeClassFull          apierror.Code = "class_full"
+	codeSectionFull        apierror.Code = "section_full"
+	codeAlreadyEnrolled    apierror.Code = "already_enrolled"
+	codeAdminAlreadyActive apierror.Code = "admin_already_active"
+	codeLastInstituteOwner apierror.Code = "last_institute_owner"
+	codeTermOverlap        apierror.Code = "term_overlap"
+	codeTermEnded          apierror.Code = "term_ended"
+	codeDeletionBlocked    apierror.Code = "deletion_blocked"
+	codeRegistrationClosed apierror.Code = "registration_closed"
+	codeSlotOverlap        apierror.Code = "slot_overlap"
+	codeSlotFull           apierror.Code = "slot_full"
+	codeAlreadyBooked      apierror.Code = "already_booked"
+	codeSlotCancelled      apierror.Code = "slot_cancelled"
+	codeSlotStarted        apierror.Code = "slot_started"
+	codeEmailTaken         apierror.Code = "email_taken"
+)
+
+// apiError maps service and repository errors to the shared error envelope.
+// resource names what the request was about and is used for generic database
+// errors (e.g. "user not found", "class already exists").
+func apiError(err error, resource string) error {
+	if err == nil {
+		return nil
+	}
+
+	var conflict *service.VersionConflictError
+	if errors.As(err, &conflict) {
+		return apierror.New(http.StatusConflict, apierror.CodeVersionConflict, "resource was modified by another request").
+			WithDetail("current_version", conflict.CurrentVersion)
+	}
+	var blocked *repository.DeletionBlockedError
+	if errors.As(err, &blocked) {
+		return apierror.Conflict(err.Error()).WithCode(codeDeletionBlocked).
+			WithDetail("report", blocked.Report)
+	}
+	var verr *service.ValidationError
+	if errors.As(err, &verr) {
+		fields := make([]apierror.FieldError, 0, len(verr.Errors))
+		for _, fe := range verr.Errors {
+			fields = append(fields, apierror.FieldError{Field: fe.Field, Message: fe.Message})
+		}
+		if verr.Conflict {
+			return apierror.Conflict("request conflicts with existing data").WithDetail("fields", fields)
+		}
+		return apierror.Validation(fields...)
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound),
+		errors.Is(err, repository.ErrInstituteNotFound),
+		errors.Is(err, repository.ErrFacultyNotFound),
+		errors.Is(err, repository.ErrDepartmentNotFound),
+		errors.Is(err, repository.ErrClassNotFound),
+		errors.Is(err, repository.ErrSectionNotFound),
+		errors.Is(err, repository.ErrNotEnrolled),
+		errors.Is(err, repository.ErrExportJobNotFound),
+		errors.Is(err, repository.ErrAnnouncementNotFound),
+		errors.Is(err, repository.ErrTermNotFound),
+		errors.Is(err, repository.ErrNoCurrentTerm),
+		errors.Is(err, repository.ErrInstituteAdminNotFound),
+		errors.Is(err, repository.ErrFeatureFlagNotFound),
+		errors.Is(err, repository.ErrOverrideNotFound),
+		errors.Is(err, repository.ErrSlotNotFound),
+		errors.Is(err, repository.ErrBookingNotFound),
+		errors.Is(err, repository.ErrPolicyDocumentNotFound),
+		errors.Is(err, repository.ErrTwoFactorNotFound),
+		errors.Is(err, repository.ErrRecoveryCodeNotFound),
+		errors.Is(err, repository.ErrEnrollmentRequestNotFound),
+		errors.Is(err, repository.ErrGuardianLinkNotFound):
+		return apierror.NotFound(err.Error())
+	case errors.Is(err, repository.ErrEmailTaken):
+		return apierror.Conflict(err.Error()).WithCode(codeEmailTaken)
+	case errors.Is(err, repository.ErrClassFull):
+		return apierror.Conflict(err.Error()).WithCode(codeClassFull)
+	case errors.Is(err, repository.ErrSectionFull):
+		return apierror.Conflict(err.Error()).WithCode(codeSectionFull)
+	case errors.Is(err, repository.ErrDefaultSection),
+		errors.Is(err, repository.ErrSectionNotEmpty),
+		errors.Is(err, repository.ErrSectionOverfilled):
+		return apierror.Conflict(err.Error())
+	case errors.Is(err, repository.ErrAlreadyEnrolled):
+		return apierror.Conflict(err.Error()).WithCode(codeAlreadyEnrolled)
+	case errors.Is(err, repository.ErrTermOverlap):
+		return apierror.Conflict(err.Error()).WithCode(codeTermOverlap)
+	case errors.Is(err, repository.ErrTermEnded):
+		return apierror.Conflict(err.Error()).WithCode(codeTermEnded)
+	case errors.Is(err, repository.ErrTermHasClasses):
+		return apierror.Conflict(err.Error())
+	case errors.Is(err, repository.ErrLastInstituteOwner):
+		return apierror.Conflict(err.Error()).WithCode(codeLastInstituteOwner)
+	case errors.Is(err, repository.ErrAlreadyInstituteAdmin),
+		errors.Is(err, repository.ErrGuardianLinkExists):
+		return apierror.Conflict(err.Error())
+	case errors.Is(err, service.ErrAdminAlreadyActive):
+		return apierror.Conflict(err.Error()).WithCode(codeAdminAlreadyActive)
+	case errors.Is(err, service.ErrSelfRegistrationClosed):
+		return apierror.Forbidden(err.Error()).WithCode(codeRegistrationClosed)
+	case errors.Is(err, repository.ErrSlotOverlap):
+		return apierror.Conflict(err.Error()).WithCode(codeSlotOverlap)
+	case errors.Is(err, repository.ErrSlotFull):
+		return apierror.Conflict(err.Error()).WithCode(codeSlotFull)
+	case errors.Is(err, repository.ErrAlreadyBooked):
+		return apierror.Conflict(err.Error()).WithCode(codeAlreadyBooked)
+	case errors.Is(err, repository.ErrSlotCancelled):
+		return apierror.Conflict(err.Error()).WithCode(codeSlotCancelled)
+	case errors.Is(err, repository.ErrSlotStarted):
+		return apierror.Conflict(err.Error()).WithCode(codeSlotStarted)
+	case errors.Is(err, repository.ErrSlotOverbooked):
+		return apierror.Conflict(err.Error())
+	case errors.Is(err, repository.ErrPolicyInEffect),
+		errors.Is(err, repository.ErrTwoFactorEnabled):
+		return apierror.Conflict(err.Error())
+	case errors.Is(err, service.ErrNotInstructor),
+		errors.Is(err, service.ErrNotSlotInstructor),
+		errors.Is(err, service.ErrNotStudent),
+		errors.Is(err, service.ErrNotEnrolledInClass),
+		errors.Is(err, service.ErrNotBookingParty),
+		errors.Is(err, service.ErrNotRequestingStudent),
+		errors.Is(err, service.ErrOutsideInstitute),
+		errors.Is(err, service.ErrNotClassInstructor),
+		errors.Is(err, service.ErrNotStudentAdmin),
+		errors.Is(err, service.ErrNotGuardianParty):
+		return apierror.Forbidden(err.Error())
+	case errors.Is(err, service.ErrInvalidHeadUser):
+		return apierror.Validation(apierror.FieldError{Field: "user_id", Message: err.Error()})
+	}
+	return apierror.FromRepository(err, resource)
+}
+
+// headError is apiError for head assignments, where a missing user is a bad
+// user_id rather than a missing resource
+func headError(err error, resource string) error {
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return apierror.Validation(apierror.FieldError{Field: "user_id", Message: err.Error()})
+	}
+	return apiError(err, resource)
+}
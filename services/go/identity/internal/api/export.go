@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExportUser queues an export of everything held about the user. The export
+// is built in the background; poll the returned job's location for it.
+func (h *Handler) ExportUser(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if err := h.authorizeExport(c, userID); err != nil {
+		return err
+	}
+
+	job, err := h.svc.RequestUserExport(userID, jwtauth.ClaimsFrom(c).UserID)
+	if err != nil {
+		return apiError(err, "user")
+	}
+	c.Location("/internal/identity/exports/" + job.ID.String())
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// GetExport returns the job's status while it is pending, running or failed,
+// and the export document as a download once it is done
+func (h *Handler) GetExport(c *fiber.Ctx) error {
+	job, err := h.svc.GetExportJob(c.Params("job_id"))
+	if err != nil {
+		return apiError(err, "export")
+	}
+	if err := h.authorizeExport(c, job.UserID.String()); err != nil {
+		return err
+	}
+
+	switch job.Status {
+	case core.ExportDone:
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		c.Attachment("user-" + job.UserID.String() + "-export.json")
+		return c.SendString(job.Document)
+	case core.ExportFailed:
+		return c.JSON(job)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// authorizeExport lets users export their own data; exporting anyone else's
+// needs the user_data.export permission. It must run after jwtauth.Middleware.
+func (h *Handler) authorizeExport(c *fiber.Ctx, userID string) error {
+	claims := jwtauth.ClaimsFrom(c)
+	if claims.UserID == userID {
+		return nil
+	}
+
+	allowed, err := h.authz.Check(c.UserContext(), claims.UserID, claims.Role, "user_data", "export", "")
+	if err != nil {
+		return apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "authorization check failed")
+	}
+	if !allowed {
+		return apierror.Forbidden("not allowed to export this user's data")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) CreateFeatureFlag(c *fiber.Ctx, req *service.FeatureFlagRequest) error {
+	flag, err := h.svc.CreateFeatureFlag(*req)
+	if err != nil {
+		return apiError(err, "feature flag")
+	}
+	return c.Status(fiber.StatusCreated).JSON(flag)
+}
+
+func (h *Handler) ListFeatureFlags(c *fiber.Ctx) error {
+	flags, err := h.svc.ListFeatureFlags()
+	if err != nil {
+		return apiError(err, "feature flag")
+	}
+	return c.JSON(flags)
+}
+
+func (h *Handler) GetFeatureFlag(c *fiber.Ctx) error {
+	flag, err := h.svc.GetFeatureFlag(c.Params("key"))
+	if err != nil {
+		return apiError(err, "feature flag")
+	}
+	return c.JSON(flag)
+}
+
+func (h *Handler) UpdateFeatureFlag(c *fiber.Ctx, req *service.FeatureFlagRequest) error {
+	flag, err := h.svc.UpdateFeatureFlag(c.Params("key"), *req)
+	if err != nil {
+		return apiError(err, "feature flag")
+	}
+	return c.JSON(flag)
+}
+
+func (h *Handler) DeleteFeatureFlag(c *fiber.Ctx) error {
+	if err := h.svc.DeleteFeatureFlag(c.Params("key")); err != nil {
+		return apiError(err, "feature flag")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetInstituteFeatures lists every flag with the institute's override, for
+// admins managing them
+func (h *Handler) GetInstituteFeatures(c *fiber.Ctx) error {
+	features, err := h.svc.GetInstituteFeatures(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(features)
+}
+
+type setFeatureOverrideRequest struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+func (h *Handler) SetFeatureOverride(c *fiber.Ctx, req *setFeatureOverrideRequest) error {
+	override, err := h.svc.SetFeatureOverride(c.Params("id"), c.Params("key"), *req.Enabled)
+	if err != nil {
+		return apiError(err, "feature flag")
+	}
+	return c.JSON(override)
+}
+
+func (h *Handler) DeleteFeatureOverride(c *fiber.Ctx) error {
+	if err := h.svc.DeleteFeatureOverride(c.Params("id"), c.Params("key")); err != nil {
+		return apiError(err, "feature flag")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetEffectiveFeatures returns {key: enabled} for every flag as it applies to
+// the institute, for other services to gate behaviour on
+func (h *Handler) GetEffectiveFeatures(c *fiber.Ctx) error {
+	features, err := h.svc.GetEffectiveFeatures(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(features)
+}
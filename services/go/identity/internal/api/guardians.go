@@ -0,0 +1,44 @@
+package api
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateGuardianLink links a guardian to the student and invites them, for
+// an admin of the student's institute
+func (h *Handler) CreateGuardianLink(c *fiber.Ctx, req *service.CreateGuardianLinkRequest) error {
+	link, err := h.as(c).CreateGuardianLink(jwtauth.ClaimsFrom(c).UserID, c.Params("id"), *req)
+	if err != nil {
+		return apiError(err, "student")
+	}
+	return c.Status(fiber.StatusCreated).JSON(link)
+}
+
+// GetStudentGuardianLinks lists the student's guardian links, for the
+// student or an admin of their institute
+func (h *Handler) GetStudentGuardianLinks(c *fiber.Ctx) error {
+	links, err := h.svc.GetStudentGuardianLinks(jwtauth.ClaimsFrom(c).UserID, c.Params("id"))
+	if err != nil {
+		return apiError(err, "student")
+	}
+	return c.JSON(links)
+}
+
+func (h *Handler) RevokeGuardianLink(c *fiber.Ctx) error {
+	link, err := h.as(c).RevokeGuardianLink(jwtauth.ClaimsFrom(c).UserID, c.Params("id"))
+	if err != nil {
+		return apiError(err, "guardian link")
+	}
+	return c.JSON(link)
+}
+
+// GetGuardianStudents lists the students the guardian has an active link to
+func (h *Handler) GetGuardianStudents(c *fiber.Ctx) error {
+	students, err := h.svc.GetGuardianStudents(c.Params("id"))
+	if err != nil {
+		return apiError(err, "guardian")
+	}
+	return c.JSON(students)
+}
@@ -1,112 +1,277 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/authz"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
 	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type Handler struct {
-	svc *service.IdentityService
+	svc      *service.IdentityService
+	verifier *jwtauth.Verifier
+	authz    authz.Client
 }
 
-func NewHandler(svc *service.IdentityService) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc *service.IdentityService, verifier *jwtauth.Verifier, authzClient authz.Client) *Handler {
+	return &Handler{svc: svc, verifier: verifier, authz: authzClient}
 }
 
-func (h *Handler) ConfirmUserEmail(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if err := h.svc.ConfirmUserEmail(id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+// nullableInt tells an omitted JSON field (Set false) apart from an explicit
+// null (Set true, Value nil)
+type nullableInt struct {
+	Set   bool
+	Value *int
+}
+
+func (n *nullableInt) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	return json.Unmarshal(data, &n.Value)
+}
+
+// nullableString is nullableInt for strings
+type nullableString struct {
+	Set   bool
+	Value *string
+}
+
+func (n *nullableString) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	return json.Unmarshal(data, &n.Value)
+}
+
+// expectedVersion returns the version the client based its update on, taken
+// from the If-Match header (e.g. "3" or W/"3") or the expected_version field
+func expectedVersion(c *fiber.Ctx, fromBody *int) (*int, error) {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return fromBody, nil
+	}
+	header = strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.Atoi(header)
+	if err != nil {
+		return nil, errors.New("If-Match must be a version number")
+	}
+	return &version, nil
+}
+
+// uuidParams answers 400 unless each named path param is a UUID, so a
+// malformed ID never reaches the repository
+func uuidParams(names ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, name := range names {
+			if _, err := uuid.Parse(c.Params(name)); err != nil {
+				return apierror.BadRequest(name + " must be a valid UUID")
+			}
+		}
+		return c.Next()
 	}
-	return c.SendStatus(fiber.StatusOK)
 }
 
-func (h *Handler) RegisterUser(c *fiber.Ctx) error {
-	var req service.CreateUserRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+func (h *Handler) ConfirmUserEmail(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := h.as(c).ConfirmUserEmail(id); err != nil {
+		return apiError(err, "user")
 	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
 
-	user, err := h.svc.RegisterUser(req)
+func (h *Handler) RegisterUser(c *fiber.Ctx, req *service.CreateUserRequest) error {
+	user, err := h.as(c).RegisterUser(*req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "user")
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(user)
 }
 
+type resolveSelfRegistrationRequest struct {
+	Email string `json:"email"`
+}
+
+// ResolveSelfRegistration tells authn which institute a student signing up
+// with the email joins, or 403 registration_closed if none lets them
+func (h *Handler) ResolveSelfRegistration(c *fiber.Ctx, req *resolveSelfRegistrationRequest) error {
+	reg, err := h.svc.ResolveSelfRegistration(req.Email)
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(reg)
+}
+
 func (h *Handler) GetUser(c *fiber.Ctx) error {
 	id := c.Params("id")
 	user, err := h.svc.GetUser(id)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		return apiError(err, "user")
 	}
-	return c.Status(fiber.StatusOK).JSON(user)
+	return c.JSON(user)
 }
 
-func (h *Handler) UpdateUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-	type Req struct {
-		FullName string `json:"full_name"`
+func (h *Handler) RecordLoginEvent(c *fiber.Ctx, req *service.LoginEventRequest) error {
+	if err := h.svc.RecordLogin(c.Params("id"), *req); err != nil {
+		return apiError(err, "user")
 	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) GetLoginHistory(c *fiber.Ctx) error {
+	events, err := h.svc.GetLoginHistory(c.Params("id"))
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(events)
+}
+
+type updateUserRequest struct {
+	service.UserUpdate
+	ExpectedVersion *int `json:"expected_version"`
+}
+
+func (h *Handler) UpdateUser(c *fiber.Ctx, req *updateUserRequest) error {
+	id := c.Params("id")
+	version, err := expectedVersion(c, req.ExpectedVersion)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
 	}
-	user, err := h.svc.UpdateUser(id, req.FullName)
+	user, err := h.as(c).UpdateUser(id, req.UserUpdate, version)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "user")
 	}
 	return c.JSON(user)
 }
 
 func (h *Handler) DeleteUser(c *fiber.Ctx) error {
 	id := c.Params("id")
-	if err := h.svc.DeleteUser(id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := h.as(c).DeleteUser(id); err != nil {
+		return apiError(err, "user")
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 func (h *Handler) ListUsers(c *fiber.Ctx) error {
-	// Simple pagination
-	offset := 0
-	limit := 10
-	users, err := h.svc.ListUsers(offset, limit)
+	page, err := pagination.Parse(c.Query("cursor"), c.Query("offset"), c.Query("limit"), 10, 100)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apierror.BadRequest(err.Error())
+	}
+
+	users, err := h.svc.ListUsers(page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		return apierror.BadRequest(err.Error())
+	}
+	if err != nil {
+		return apiError(err, "user")
 	}
 	return c.JSON(users)
 }
 
-func (h *Handler) LookupUser(c *fiber.Ctx) error {
-	type Req struct {
-		Email string `json:"email"`
+// ListUsersWithProfiles serves admin tools that show every user with their
+// type-specific record, filtered by ?user_type= and with the orphaned
+// profile rows when ?include_orphans=true
+func (h *Handler) ListUsersWithProfiles(c *fiber.Ctx) error {
+	page, err := pagination.Parse(c.Query("cursor"), c.Query("offset"), c.Query("limit"), 50, 500)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
 	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+
+	users, err := h.svc.ListUsersWithProfiles(page, c.Query("user_type"), c.QueryBool("include_orphans"))
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		return apierror.BadRequest(err.Error())
 	}
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(users)
+}
 
+type lookupUserRequest struct {
+	Email string `json:"email" validate:"required"`
+}
+
+func (h *Handler) LookupUser(c *fiber.Ctx, req *lookupUserRequest) error {
 	user, err := h.svc.LookupUser(req.Email)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		return apiError(err, "user")
 	}
 	return c.JSON(user)
 }
 
+type getUsersRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// GetUsers returns several users at once, e.g. to put names to the IDs in a
+// list
+func (h *Handler) GetUsers(c *fiber.Ctx, req *getUsersRequest) error {
+	users, err := h.svc.GetUsers(req.IDs)
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(users)
+}
+
+func (h *Handler) SearchInstituteUsers(c *fiber.Ctx) error {
+	users, err := h.svc.SearchInstituteUsers(c.Params("id"), c.Query("q"), c.Query("type"), c.Query("cohort"), c.QueryInt("limit", 20))
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(users)
+}
+
+func (h *Handler) GetInstituteStats(c *fiber.Ctx) error {
+	stats, err := h.svc.GetInstituteStats(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(stats)
+}
+
+func (h *Handler) GetDepartmentStats(c *fiber.Ctx) error {
+	stats, err := h.svc.GetDepartmentStats(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return apiError(err, "department")
+	}
+	return c.JSON(stats)
+}
+
+func (h *Handler) MergeUsers(c *fiber.Ctx, req *service.MergeUsersRequest) error {
+	merge, err := h.as(c).MergeUsers(*req)
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(merge)
+}
+
+func (h *Handler) GetEmailConflicts(c *fiber.Ctx) error {
+	conflicts, err := h.svc.GetEmailConflicts()
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(conflicts)
+}
+
 func (h *Handler) GetUserEnrollments(c *fiber.Ctx) error {
 	userID := c.Params("user_id")
 	enrollments, err := h.svc.GetUserEnrollments(userID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "user")
 	}
 	return c.JSON(enrollments)
 }
 
 func (h *Handler) ValidateCredentials(c *fiber.Ctx) error {
-	// Passwordless auth - this endpoint returns 401/invalid always
-	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"valid": false, "error": "password authentication disabled"})
+	// Passwordless auth - this endpoint returns 401 always
+	return apierror.Unauthorized("password authentication disabled")
 }
 
 // UpdateCredentials handler removed
@@ -115,185 +280,227 @@ func (h *Handler) GetUserRole(c *fiber.Ctx) error {
 	id := c.Params("id")
 	role, err := h.svc.GetUserRole(id)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		return apiError(err, "user")
 	}
 	return c.JSON(fiber.Map{"role": role})
 }
 
 // -- Organization Handlers --
 
-func (h *Handler) CreateInstitute(c *fiber.Ctx) error {
-	var req service.CreateInstituteRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-	inst, err := h.svc.CreateInstitute(req)
+func (h *Handler) CreateInstitute(c *fiber.Ctx, req *service.CreateInstituteRequest) error {
+	inst, err := h.as(c).CreateInstitute(*req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "institute")
 	}
 	return c.Status(fiber.StatusCreated).JSON(inst)
 }
 
+// ValidateInstitute reports what creating the institute would do, for the
+// creation wizard to show problems before it is submitted
+func (h *Handler) ValidateInstitute(c *fiber.Ctx, req *service.CreateInstituteRequest) error {
+	validation, err := h.svc.ValidateInstitute(*req)
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(validation)
+}
+
 func (h *Handler) GetInstitutes(c *fiber.Ctx) error {
 	query := c.Query("q")
 	list, err := h.svc.GetInstitutesWithAdminCount(query)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "institute")
 	}
 	return c.JSON(list)
 }
 
+// GetInstitute returns an institute with its admins. Like GetFaculty,
+// GetDepartment and GetClass it finds deleted units too for a system admin
+// who asks with ?include_deleted=true; see orgUnitReader.
 func (h *Handler) GetInstitute(c *fiber.Ctx) error {
 	id := c.Params("id")
-	inst, err := h.svc.GetInstitute(id)
+	svc, includeDeleted, err := h.orgUnitReader(c)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
-	return c.JSON(inst)
+	inst, err := svc.GetInstitute(id)
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return orgUnitJSON(c, svc, includeDeleted, core.AnnouncementScopeInstitute, id, inst)
 }
 
 func (h *Handler) ActivateInstitute(c *fiber.Ctx) error {
 	id := c.Params("id")
-	inst, err := h.svc.ActivateInstitute(id)
+	version, err := expectedVersion(c, nil)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
+	}
+	inst, err := h.as(c).ActivateInstitute(id, version)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "institute")
 	}
 	return c.JSON(inst)
 }
 
 func (h *Handler) DeactivateInstitute(c *fiber.Ctx) error {
 	id := c.Params("id")
-	inst, err := h.svc.DeactivateInstitute(id)
+	version, err := expectedVersion(c, nil)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apierror.BadRequest(err.Error())
+	}
+	inst, err := h.as(c).DeactivateInstitute(id, version)
+	if err != nil {
+		return apiError(err, "institute")
 	}
 	return c.JSON(inst)
 }
 
-func (h *Handler) CreateFaculty(c *fiber.Ctx) error {
-	type Req struct {
-		InstituteID string `json:"institute_id"`
-		Name        string `json:"name"`
-	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-	fac, err := h.svc.CreateFaculty(req.InstituteID, req.Name)
+type createFacultyRequest struct {
+	InstituteID string `json:"institute_id"`
+	Name        string `json:"name"`
+}
+
+func (h *Handler) CreateFaculty(c *fiber.Ctx, req *createFacultyRequest) error {
+	fac, err := h.as(c).CreateFaculty(req.InstituteID, req.Name)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "faculty")
 	}
 	return c.Status(fiber.StatusCreated).JSON(fac)
 }
 
-func (h *Handler) CreateDepartment(c *fiber.Ctx) error {
-	type Req struct {
-		FacultyID string `json:"faculty_id"`
-		Name      string `json:"name"`
-	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-	dept, err := h.svc.CreateDepartment(req.FacultyID, req.Name)
+type createDepartmentRequest struct {
+	FacultyID string `json:"faculty_id"`
+	Name      string `json:"name"`
+}
+
+func (h *Handler) CreateDepartment(c *fiber.Ctx, req *createDepartmentRequest) error {
+	dept, err := h.as(c).CreateDepartment(req.FacultyID, req.Name)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "department")
 	}
 	return c.Status(fiber.StatusCreated).JSON(dept)
 }
 
-func (h *Handler) CreateClass(c *fiber.Ctx) error {
-	type Req struct {
-		DepartmentID string `json:"department_id"`
-		Name         string `json:"name"`
-	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-	class, err := h.svc.CreateClass(req.DepartmentID, req.Name)
+type createClassRequest struct {
+	DepartmentID string `json:"department_id"`
+	Name         string `json:"name"`
+	Capacity     *int   `json:"capacity"`
+	TermID       string `json:"term_id"`
+}
+
+func (h *Handler) CreateClass(c *fiber.Ctx, req *createClassRequest) error {
+	class, err := h.as(c).CreateClass(req.DepartmentID, req.Name, req.Capacity, req.TermID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "class")
 	}
 	return c.Status(fiber.StatusCreated).JSON(class)
 }
 
-func (h *Handler) EnrollStudent(c *fiber.Ctx) error {
+type enrollStudentRequest struct {
+	StudentID string `json:"student_id"`
+	// SectionID defaults to the class's default section
+	SectionID string `json:"section_id"`
+}
+
+func (h *Handler) EnrollStudent(c *fiber.Ctx, req *enrollStudentRequest) error {
 	classID := c.Params("class_id")
-	type Req struct {
-		StudentID string `json:"student_id"`
+	overrideTerm := c.QueryBool("override_term")
+	if overrideTerm {
+		if err := h.authorizeTermOverride(c); err != nil {
+			return err
+		}
 	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	result, err := h.as(c).EnrollStudent(classID, req.SectionID, req.StudentID, c.QueryBool("waitlist"), overrideTerm)
+	if err != nil {
+		return apiError(err, "class")
 	}
-	if err := h.svc.EnrollStudent(classID, req.StudentID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if !result.Enrolled {
+		return c.Status(fiber.StatusAccepted).JSON(result)
 	}
-	return c.SendStatus(fiber.StatusCreated)
+	return c.Status(fiber.StatusCreated).JSON(result)
 }
 
 func (h *Handler) GetClassEnrollments(c *fiber.Ctx) error {
 	classID := c.Params("class_id")
-	enrollments, err := h.svc.GetClassEnrollments(classID)
+	roster, err := h.svc.GetClassEnrollments(classID, c.Query("section_id"))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "class")
 	}
-	return c.JSON(enrollments)
+	return c.JSON(roster)
+}
+
+func (h *Handler) GetClassWaitlist(c *fiber.Ctx) error {
+	classID := c.Params("class_id")
+	waitlist, err := h.svc.GetClassWaitlist(classID)
+	if err != nil {
+		return apiError(err, "class")
+	}
+	return c.JSON(waitlist)
 }
 
 func (h *Handler) UnenrollStudent(c *fiber.Ctx) error {
 	classID := c.Params("class_id")
 	studentID := c.Params("student_id")
-	if err := h.svc.UnenrollStudent(classID, studentID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := h.as(c).UnenrollStudent(classID, studentID); err != nil {
+		return apiError(err, "class")
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 // -- Org Update/Delete Handlers --
 
-func (h *Handler) UpdateInstitute(c *fiber.Ctx) error {
+type updateInstituteRequest struct {
+	service.InstituteUpdate
+	ExpectedVersion *int `json:"expected_version"`
+}
+
+func (h *Handler) UpdateInstitute(c *fiber.Ctx, req *updateInstituteRequest) error {
 	id := c.Params("id")
-	type Req struct {
-		Name string `json:"name"`
-		Code string `json:"code"`
-	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	version, err := expectedVersion(c, req.ExpectedVersion)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
 	}
-	inst, err := h.svc.UpdateInstitute(id, req.Name, req.Code)
+	inst, err := h.as(c).UpdateInstitute(id, req.InstituteUpdate, version)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "institute")
 	}
 	return c.JSON(inst)
 }
 
+// DeleteInstitute soft deletes an institute and returns what went with it.
+// One that still has anything below it is refused with a 409 carrying the
+// same report unless ?cascade=true; ?dry_run=true only returns the report.
+// DeleteFaculty and DeleteDepartment work the same way.
 func (h *Handler) DeleteInstitute(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if err := h.svc.DeleteInstitute(id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	report, err := h.as(c).DeleteInstitute(c.Params("id"), deleteOptions(c))
+	if err != nil {
+		return apiError(err, "institute")
 	}
-	return c.SendStatus(fiber.StatusNoContent)
+	return c.JSON(report)
 }
 
-func (h *Handler) AddInstituteAdmin(c *fiber.Ctx) error {
-	instituteId := c.Params("id")
-
-	type AddAdminRequest struct {
-		Name  string `json:"name" validate:"required"`
-		Email string `json:"email" validate:"required,email"`
-		Role  string `json:"role" validate:"required,oneof=OWNER ADMIN"`
+// deleteOptions reads ?cascade and ?dry_run, and records the caller as the
+// one who asked for the deletion
+func deleteOptions(c *fiber.Ctx) repository.DeleteOptions {
+	return repository.DeleteOptions{
+		Cascade:     c.QueryBool("cascade"),
+		DryRun:      c.QueryBool("dry_run"),
+		RequestedBy: jwtauth.ClaimsFrom(c).UserID,
 	}
+}
 
-	var req AddAdminRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
+type addInstituteAdminRequest struct {
+	Name  string `json:"name" validate:"required"`
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role"` // OWNER or ADMIN (default)
+}
+
+func (h *Handler) AddInstituteAdmin(c *fiber.Ctx, req *addInstituteAdminRequest) error {
+	instituteId := c.Params("id")
 
-	if err := h.svc.AddInstituteAdmin(instituteId, req.Name, req.Email, req.Role); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := h.as(c).AddInstituteAdmin(instituteId, req.Name, req.Email, req.Role); err != nil {
+		return apiError(err, "institute")
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Admin added successfully"})
@@ -303,11 +510,49 @@ func (h *Handler) RemoveInstituteAdmin(c *fiber.Ctx) error {
 	instituteId := c.Params("id")
 	adminId := c.Params("adminId")
 
-	if err := h.svc.RemoveInstituteAdmin(instituteId, adminId); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := h.as(c).RemoveInstituteAdmin(instituteId, adminId); err != nil {
+		return apiError(err, "institute")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+type updateInstituteAdminRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (h *Handler) UpdateInstituteAdminRole(c *fiber.Ctx, req *updateInstituteAdminRoleRequest) error {
+	binding, err := h.as(c).UpdateInstituteAdminRole(c.Params("id"), c.Params("adminId"), req.Role)
+	if err != nil {
+		return apiError(err, "institute admin")
+	}
+	return c.JSON(binding)
+}
+
+func (h *Handler) GetUserInstitutes(c *fiber.Ctx) error {
+	bindings, err := h.svc.GetInstituteBindings(c.Params("id"))
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(bindings)
+}
+
+// GetTokenContext returns the institutes and classes authn puts in the
+// user's access tokens
+func (h *Handler) GetTokenContext(c *fiber.Ctx) error {
+	tc, err := h.svc.GetTokenContext(c.Params("id"))
+	if err != nil {
+		return apiError(err, "user")
 	}
+	return c.JSON(tc)
+}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Admin removed successfully"})
+func (h *Handler) GetLoginPolicy(c *fiber.Ctx) error {
+	policy, err := h.svc.GetLoginPolicy(c.Params("id"))
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(policy)
 }
 
 func (h *Handler) ResendAdminInvite(c *fiber.Ctx) error {
@@ -315,112 +560,217 @@ func (h *Handler) ResendAdminInvite(c *fiber.Ctx) error {
 	adminId := c.Params("adminId")
 
 	if err := h.svc.ResendAdminInvite(instituteId, adminId); err != nil {
-		// Check if it's a business logic error that should return 400
-		if err.Error() == "admin has already activated their account" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "institute")
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Invitation resent successfully"})
 }
 
 // Similar for Faculty, Dept, Class...
-func (h *Handler) UpdateFaculty(c *fiber.Ctx) error {
+type updateFacultyRequest struct {
+	Name            string `json:"name"`
+	ExpectedVersion *int   `json:"expected_version"`
+}
+
+func (h *Handler) UpdateFaculty(c *fiber.Ctx, req *updateFacultyRequest) error {
 	id := c.Params("id")
-	type Req struct {
-		Name string `json:"name"`
-	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	version, err := expectedVersion(c, req.ExpectedVersion)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
 	}
-	fac, err := h.svc.UpdateFaculty(id, req.Name)
+	fac, err := h.as(c).UpdateFaculty(id, req.Name, version)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "faculty")
 	}
 	return c.JSON(fac)
 }
 
 func (h *Handler) DeleteFaculty(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if err := h.svc.DeleteFaculty(id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	report, err := h.as(c).DeleteFaculty(c.Params("id"), deleteOptions(c))
+	if err != nil {
+		return apiError(err, "faculty")
 	}
-	return c.SendStatus(fiber.StatusNoContent)
+	return c.JSON(report)
 }
 
-func (h *Handler) UpdateDepartment(c *fiber.Ctx) error {
+type updateDepartmentRequest struct {
+	Name            string `json:"name"`
+	ExpectedVersion *int   `json:"expected_version"`
+}
+
+func (h *Handler) UpdateDepartment(c *fiber.Ctx, req *updateDepartmentRequest) error {
 	id := c.Params("id")
-	type Req struct {
-		Name string `json:"name"`
-	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	version, err := expectedVersion(c, req.ExpectedVersion)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
 	}
-	dept, err := h.svc.UpdateDepartment(id, req.Name)
+	dept, err := h.as(c).UpdateDepartment(id, req.Name, version)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "department")
 	}
 	return c.JSON(dept)
 }
 
 func (h *Handler) DeleteDepartment(c *fiber.Ctx) error {
-	id := c.Params("id")
-	if err := h.svc.DeleteDepartment(id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	report, err := h.as(c).DeleteDepartment(c.Params("id"), deleteOptions(c))
+	if err != nil {
+		return apiError(err, "department")
 	}
-	return c.SendStatus(fiber.StatusNoContent)
+	return c.JSON(report)
+}
+
+type updateClassRequest struct {
+	Name            string         `json:"name"`
+	Capacity        nullableInt    `json:"capacity"`
+	TermID          nullableString `json:"term_id"`
+	ExpectedVersion *int           `json:"expected_version"`
 }
 
-func (h *Handler) UpdateClass(c *fiber.Ctx) error {
+func (h *Handler) UpdateClass(c *fiber.Ctx, req *updateClassRequest) error {
 	id := c.Params("id")
-	type Req struct {
-		Name string `json:"name"`
-	}
-	var req Req
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid JSON"})
+	version, err := expectedVersion(c, req.ExpectedVersion)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
 	}
-	class, err := h.svc.UpdateClass(id, req.Name)
+	class, err := h.as(c).UpdateClass(id, req.Name, req.Capacity.Value, req.Capacity.Set, req.TermID.Value, req.TermID.Set, version)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err, "class")
 	}
 	return c.JSON(class)
 }
 
 func (h *Handler) DeleteClass(c *fiber.Ctx) error {
 	id := c.Params("id")
-	if err := h.svc.DeleteClass(id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := h.as(c).DeleteClass(id); err != nil {
+		return apiError(err, "class")
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 func (h *Handler) GetFaculty(c *fiber.Ctx) error {
 	id := c.Params("id")
-	fac, err := h.svc.GetFaculty(id)
+	svc, includeDeleted, err := h.orgUnitReader(c)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
-	return c.JSON(fac)
+	fac, err := svc.GetFaculty(id)
+	if err != nil {
+		return apiError(err, "faculty")
+	}
+	return orgUnitJSON(c, svc, includeDeleted, core.AnnouncementScopeFaculty, id, fac)
 }
 
 func (h *Handler) GetDepartment(c *fiber.Ctx) error {
 	id := c.Params("id")
-	dept, err := h.svc.GetDepartment(id)
+	svc, includeDeleted, err := h.orgUnitReader(c)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
-	return c.JSON(dept)
+	dept, err := svc.GetDepartment(id)
+	if err != nil {
+		return apiError(err, "department")
+	}
+	return orgUnitJSON(c, svc, includeDeleted, core.AnnouncementScopeDepartment, id, dept)
 }
 
 func (h *Handler) GetClass(c *fiber.Ctx) error {
 	id := c.Params("id")
-	class, err := h.svc.GetClass(id)
+	svc, includeDeleted, err := h.orgUnitReader(c)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
-	return c.JSON(class)
+	class, err := svc.GetClass(id)
+	if err != nil {
+		return apiError(err, "class")
+	}
+	return orgUnitJSON(c, svc, includeDeleted, core.AnnouncementScopeClass, id, class)
+}
+
+// orgUnitReader returns the service org unit lookups go through. With
+// ?include_deleted=true it also finds deleted units, and units under deleted
+// ones, but only for a system admin's bearer token.
+func (h *Handler) orgUnitReader(c *fiber.Ctx) (*service.IdentityService, bool, error) {
+	if !c.QueryBool("include_deleted") {
+		return h.svc, false, nil
+	}
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		return nil, false, apierror.Unauthorized("a bearer token is required to include deleted org units")
+	}
+	claims, err := h.verifier.Verify(c.UserContext(), token)
+	if errors.Is(err, jwtauth.ErrAcceptanceRequired) {
+		return nil, false, apierror.Forbidden(err.Error())
+	}
+	if err != nil {
+		return nil, false, apierror.Unauthorized("invalid or expired token")
+	}
+	if claims.Role != string(core.UserTypeSystemAdmin) {
+		return nil, false, apierror.Forbidden("only system admins may include deleted org units")
+	}
+	return h.svc.IncludingDeleted(), true, nil
+}
+
+// orgUnitJSON writes the unit, marked with whether it, or a unit above it,
+// is deleted when deleted units were asked for
+func orgUnitJSON(c *fiber.Ctx, svc *service.IdentityService, includeDeleted bool, unit core.AnnouncementScope, id string, entity any) error {
+	if !includeDeleted {
+		return c.JSON(entity)
+	}
+	deletedAt, err := svc.OrgUnitDeletedAt(unit, id)
+	if err != nil {
+		return apiError(err, string(unit))
+	}
+	raw, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+	var body map[string]any
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return err
+	}
+	body["deleted"] = deletedAt != nil
+	body["deleted_at"] = deletedAt
+	return c.JSON(body)
+}
+
+// -- Org Unit Head Handlers --
+
+type setHeadRequest struct {
+	UserID string `json:"user_id" validate:"required"`
+}
+
+func (h *Handler) SetFacultyHead(c *fiber.Ctx, req *setHeadRequest) error {
+	id := c.Params("id")
+	fac, err := h.as(c).SetFacultyHead(id, req.UserID)
+	if err != nil {
+		return headError(err, "faculty")
+	}
+	return c.JSON(fac)
+}
+
+func (h *Handler) ClearFacultyHead(c *fiber.Ctx) error {
+	id := c.Params("id")
+	fac, err := h.as(c).ClearFacultyHead(id)
+	if err != nil {
+		return headError(err, "faculty")
+	}
+	return c.JSON(fac)
+}
+
+func (h *Handler) SetDepartmentHead(c *fiber.Ctx, req *setHeadRequest) error {
+	id := c.Params("id")
+	dept, err := h.as(c).SetDepartmentHead(id, req.UserID)
+	if err != nil {
+		return headError(err, "department")
+	}
+	return c.JSON(dept)
+}
+
+func (h *Handler) ClearDepartmentHead(c *fiber.Ctx) error {
+	id := c.Params("id")
+	dept, err := h.as(c).ClearDepartmentHead(id)
+	if err != nil {
+		return headError(err, "department")
+	}
+	return c.JSON(dept)
 }
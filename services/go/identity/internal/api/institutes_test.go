@@ -0,0 +1,182 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.User{}, &core.StudentProfile{}, &core.InstructorProfile{}, &core.InstituteAdminProfile{}, &core.Institute{}, &core.Faculty{}, &core.Department{}, &core.Class{}, &core.ClassEnrollment{}, &core.DeletionTombstone{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Routes behind jwtauth accept tokens from bearer
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := signingKey(t)
+		_ = json.NewEncoder(w).Encode(jwtauth.JWKS{Keys: []jwtauth.JWK{jwtauth.PublicJWK(jwtauth.Thumbprint(&key.PublicKey), &key.PublicKey)}})
+	}))
+	t.Cleanup(jwks.Close)
+	verifier := jwtauth.NewVerifier(jwtauth.Config{JWKSURL: jwks.URL})
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler})
+	SetupRoutes(app, NewHandler(service.NewIdentityService(repository.NewRepository(db), &config.Config{}), verifier, nil))
+	return app
+}
+
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+)
+
+// signingKey is the key the test apps' verifiers trust, generated once
+func signingKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	testKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testKey = key
+	})
+	return testKey
+}
+
+// bearer returns an Authorization header value with an access token for
+// userID, signed the way authn signs them
+func bearer(t *testing.T, userID string) string {
+	t.Helper()
+	return bearerWithRole(t, userID, "")
+}
+
+// bearerWithRole is bearer for a user of the role
+func bearerWithRole(t *testing.T, userID, role string) string {
+	t.Helper()
+	key := signingKey(t)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwtauth.Claims{
+		UserID:    userID,
+		Role:      role,
+		SessionID: "session-" + userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			Issuer:    jwtauth.Issuer,
+			Audience:  []string{jwtauth.Audience},
+		},
+	})
+	token.Header["kid"] = jwtauth.Thumbprint(&key.PublicKey)
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+// fieldErrors returns the details.fields of an error envelope
+func fieldErrors(body map[string]interface{}) []interface{} {
+	details, _ := body["details"].(map[string]interface{})
+	fields, _ := details["fields"].([]interface{})
+	return fields
+}
+
+func TestCreateInstituteWithDuplicateCodeIsConflict(t *testing.T) {
+	app := newTestApp(t)
+
+	post := func(body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/orgs/institutes", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if status, body := post(`{"name":"Uni","code":"UNI","domain":"uni.example.edu","contact_email":"admin@uni.example.edu"}`); status != fiber.StatusCreated {
+		t.Fatalf("first institute: got %d %v", status, body)
+	}
+
+	status, body := post(`{"name":"Other","code":"UNI","domain":"other.example.edu","contact_email":"admin@other.example.edu"}`)
+	if status != fiber.StatusConflict {
+		t.Fatalf("duplicate code: got %d %v, want 409", status, body)
+	}
+	errs := fieldErrors(body)
+	if body["code"] != string(apierror.CodeConflict) || len(errs) != 1 || errs[0].(map[string]interface{})["field"] != "code" {
+		t.Fatalf("duplicate code: got body %v, want one code field error", body)
+	}
+
+	status, body = post(`{"name":"Bad","code":"bad code","domain":"bad","contact_email":"admin@bad"}`)
+	if status != fiber.StatusUnprocessableEntity {
+		t.Fatalf("malformed code and domain: got %d %v, want 422", status, body)
+	}
+	if errs := fieldErrors(body); body["code"] != string(apierror.CodeValidation) || len(errs) != 2 {
+		t.Fatalf("malformed code and domain: got body %v, want two field errors", body)
+	}
+}
+
+func TestUpdateInstituteWithStaleIfMatchIsConflict(t *testing.T) {
+	app := newTestApp(t)
+
+	send := func(method, path, ifMatch, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	status, created := send("POST", "/orgs/institutes", "", `{"name":"Uni","code":"UNI","domain":"uni.example.edu","contact_email":"admin@uni.example.edu"}`)
+	if status != fiber.StatusCreated {
+		t.Fatalf("create institute: got %d %v", status, created)
+	}
+	path := "/orgs/institutes/" + created["id"].(string)
+
+	if status, body := send("PATCH", path, `W/"1"`, `{"name":"Renamed","code":"UNI"}`); status != fiber.StatusOK {
+		t.Fatalf("update at the current version: got %d %v", status, body)
+	}
+	status, body := send("PATCH", path, `"1"`, `{"name":"Again","code":"UNI"}`)
+	details, _ := body["details"].(map[string]interface{})
+	if status != fiber.StatusConflict || body["code"] != string(apierror.CodeVersionConflict) || details["current_version"] != float64(2) {
+		t.Fatalf("update at a stale version: got %d %v, want 409 with current_version 2", status, body)
+	}
+	if status, _ := send("PATCH", path, "abc", `{"name":"Again","code":"UNI"}`); status != fiber.StatusBadRequest {
+		t.Errorf("non-numeric If-Match: got %d, want 400", status)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestDeletedOrgUnitsOnlyForSystemAdmins(t *testing.T) {
+	app := newTestApp(t)
+
+	create := func(path, body string) string {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil || resp.StatusCode != fiber.StatusCreated {
+			t.Fatalf("POST %s: %v, %v", path, resp, err)
+		}
+		var created struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		return created.ID
+	}
+	institute := create("/orgs/institutes", `{"name":"Uni","code":"UNI","domain":"uni.example.edu","contact_email":"admin@uni.example.edu"}`)
+	faculty := create("/orgs/faculties", `{"institute_id":"`+institute+`","name":"Science"}`)
+
+	get := func(path, authorization string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	req := httptest.NewRequest("DELETE", "/orgs/institutes/"+institute+"?cascade=true", nil)
+	req.Header.Set("Authorization", bearer(t, "admin-1"))
+	if resp, err := app.Test(req, -1); err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("delete institute: %v, %v", resp, err)
+	}
+
+	path := "/orgs/faculties/" + faculty
+	if status, _ := get(path, ""); status != fiber.StatusNotFound {
+		t.Errorf("faculty of a deleted institute = %d, want 404", status)
+	}
+	for _, tc := range []struct {
+		authorization string
+		want          int
+	}{
+		{"", fiber.StatusUnauthorized},
+		{bearerWithRole(t, "admin-2", "INSTITUTE_ADMIN"), fiber.StatusForbidden},
+		{bearerWithRole(t, "admin-3", "SYSTEM_ADMIN"), fiber.StatusOK},
+	} {
+		status, body := get(path+"?include_deleted=true", tc.authorization)
+		if status != tc.want {
+			t.Errorf("including deleted with %q = %d, want %d", tc.authorization, status, tc.want)
+		}
+		if status == fiber.StatusOK && (body["deleted"] != true || body["deleted_at"] == nil) {
+			t.Errorf("deleted faculty = %v, want it flagged as deleted", body)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) CreatePolicyDocument(c *fiber.Ctx, req *service.PolicyDocumentRequest) error {
+	doc, err := h.svc.CreatePolicyDocument(*req)
+	if err != nil {
+		return apiError(err, "policy document")
+	}
+	return c.Status(fiber.StatusCreated).JSON(doc)
+}
+
+func (h *Handler) ListPolicyDocuments(c *fiber.Ctx) error {
+	docs, err := h.svc.ListPolicyDocuments(c.Query("type"))
+	if err != nil {
+		return apiError(err, "policy document")
+	}
+	return c.JSON(docs)
+}
+
+// GetCurrentPolicyDocuments returns the document of each type in effect, for
+// showing users what they accept
+func (h *Handler) GetCurrentPolicyDocuments(c *fiber.Ctx) error {
+	docs, err := h.svc.CurrentPolicyDocuments()
+	if err != nil {
+		return apiError(err, "policy document")
+	}
+	return c.JSON(docs)
+}
+
+func (h *Handler) GetPolicyDocument(c *fiber.Ctx) error {
+	doc, err := h.svc.GetPolicyDocument(c.Params("id"))
+	if err != nil {
+		return apiError(err, "policy document")
+	}
+	return c.JSON(doc)
+}
+
+func (h *Handler) UpdatePolicyDocument(c *fiber.Ctx, req *service.PolicyDocumentUpdate) error {
+	doc, err := h.svc.UpdatePolicyDocument(c.Params("id"), *req)
+	if err != nil {
+		return apiError(err, "policy document")
+	}
+	return c.JSON(doc)
+}
+
+func (h *Handler) DeletePolicyDocument(c *fiber.Ctx) error {
+	if err := h.svc.DeletePolicyDocument(c.Params("id")); err != nil {
+		return apiError(err, "policy document")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetPolicyStatus lists the current documents the user has not accepted, for
+// AuthN to decide whether their tokens are restricted
+func (h *Handler) GetPolicyStatus(c *fiber.Ctx) error {
+	status, err := h.svc.GetPolicyStatus(c.Params("id"))
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(status)
+}
+
+// AcceptPolicies records acceptances AuthN received from the user
+func (h *Handler) AcceptPolicies(c *fiber.Ctx, req *service.PolicyAcceptanceRequest) error {
+	status, err := h.svc.AcceptPolicies(c.Params("id"), *req)
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(status)
+}
@@ -1,13 +1,21 @@
 package api
 
 import (
+	"github.com/4yrg/gradeloop-core/libs/request"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
 	"github.com/4yrg/gradeloop-core/services/go/identity/internal/middleware"
 	"github.com/gofiber/fiber/v2"
 )
 
 func SetupRoutes(app *fiber.App, h *Handler) {
-	// Everything is internal/identity per spec - apply internal auth middleware
-	identity := app.Group("/internal/identity", middleware.InternalAuth())
+	// Everything is internal/identity per spec - apply internal auth middleware.
+	// Callers are noted for the activity log, trusting the user a service
+	// forwards once its internal token is checked.
+	identity := app.Group("/internal/identity", middleware.InternalAuth(), identifyActor(h.verifier, true))
+
+	// Path IDs are checked up front so a malformed one is a 400, and bodies
+	// are bound and validated by request.Bind before the handler runs
+	id := uuidParams("id")
 
 	// Credentials
 	identity.Post("/credentials/verify", h.ValidateCredentials)
@@ -15,56 +23,172 @@ func SetupRoutes(app *fiber.App, h *Handler) {
 	identity.Post("/credentials/verify", h.ValidateCredentials)
 
 	// Users
-	identity.Post("/users", h.RegisterUser)
-	identity.Post("/users/:id/confirm-email", h.ConfirmUserEmail)
-	identity.Get("/users/:id", h.GetUser)
-	identity.Patch("/users/:id", h.UpdateUser) // Using PATCH as requested
-	identity.Delete("/users/:id", h.DeleteUser)
-	identity.Get("/users/:id/role", h.GetUserRole)
+	identity.Post("/users", request.Bind(h.RegisterUser))
+	identity.Post("/users/:id/confirm-email", id, h.ConfirmUserEmail)
+	identity.Get("/users/email-conflicts", h.GetEmailConflicts) // before /users/:id so it is not taken as an ID
+	identity.Get("/users/:id", id, h.GetUser)
+	identity.Patch("/users/:id", id, request.Bind(h.UpdateUser)) // Using PATCH as requested
+	identity.Delete("/users/:id", id, h.DeleteUser)
+	identity.Get("/users/:id/role", id, h.GetUserRole)
+	identity.Get("/users/:id/institutes", id, h.GetUserInstitutes)
+	identity.Get("/users/:id/token-context", id, h.GetTokenContext)
+	identity.Get("/users/:id/login-policy", id, h.GetLoginPolicy)
+	identity.Post("/users/:id/login-event", id, request.Bind(h.RecordLoginEvent))
+	identity.Get("/users/:id/login-history", id, h.GetLoginHistory)
+	identity.Get("/users/:id/policy-status", id, h.GetPolicyStatus)
+	identity.Post("/users/:id/policy-acceptances", id, request.Bind(h.AcceptPolicies))
+	identity.Get("/users/:id/two-factor", id, h.GetTwoFactor)
+	identity.Put("/users/:id/two-factor", id, request.Bind(h.SetUpTwoFactor))
+	identity.Post("/users/:id/two-factor/enable", id, h.EnableTwoFactor)
+	identity.Delete("/users/:id/two-factor", id, h.DisableTwoFactor)
+	identity.Post("/users/:id/two-factor/recovery-codes/use", id, request.Bind(h.UseRecoveryCode))
 	identity.Get("/users", h.ListUsers) // Added for completeness/debugging
-	identity.Post("/users/lookup", h.LookupUser)
+	identity.Get("/admin/users-with-profiles", h.ListUsersWithProfiles)
+	identity.Post("/users/lookup", request.Bind(h.LookupUser))
+	identity.Post("/users/batch", request.Bind(h.GetUsers))
+	identity.Post("/classes/batch", request.Bind(h.GetClasses))
+	identity.Post("/users/merge", request.Bind(h.MergeUsers))
+	identity.Post("/self-registrations/resolve", request.Bind(h.ResolveSelfRegistration))
+	identity.Post("/institutes/validate", request.Bind(h.ValidateInstitute)) // dry run of POST /orgs/institutes
+	identity.Get("/institutes/:id/users", id, h.SearchInstituteUsers)
+	identity.Get("/institutes/:id/stats", id, h.GetInstituteStats)
+	identity.Get("/departments/:id/stats", id, h.GetDepartmentStats)
+	identity.Get("/institutes/:id/terms/current", id, h.GetCurrentTerm)
+	identity.Get("/institutes/:id/cohorts", id, h.GetInstituteCohorts)
+	identity.Get("/institutes/:id/cohorts/:label/students", id, h.ListCohortStudents)
+	identity.Get("/institutes/:id/features", id, h.GetEffectiveFeatures)
+	identity.Get("/institutes/:id/branding", id, h.GetInstituteBranding)
+	identity.Put("/institutes/:id/branding", id, request.Bind(h.UpdateInstituteBranding))
+	identity.Put("/institutes/:id/branding/logo", id, h.UploadInstituteLogo)
+
+	// Data exports; the caller's access token decides whose data they may export
+	auth := jwtauth.Middleware(h.verifier)
+	identity.Get("/users/:id/export", auth, id, h.ExportUser)
+	identity.Get("/exports/:job_id", auth, uuidParams("job_id"), h.GetExport)
+
+	// Activity log of changes to users, enrollments and org units; system admins only
+	identity.Get("/activity", auth, h.ListActivity)
+
+	// Announcements; writing one needs a permission scoped to the unit addressed
+	identity.Post("/announcements", auth, request.Bind(h.CreateAnnouncement))
+	identity.Get("/announcements/:id", id, h.GetAnnouncement)
+	identity.Patch("/announcements/:id", auth, id, request.Bind(h.UpdateAnnouncement))
+	identity.Delete("/announcements/:id", auth, id, h.DeleteAnnouncement)
+	identity.Get("/users/:id/announcements", id, h.GetUserAnnouncements)
+
+	// Office hours; instructors hold slots and students book seats in them,
+	// both as the caller of the access token
+	identity.Post("/slots", auth, request.Bind(h.CreateSlot))
+	identity.Get("/slots/:id", id, h.GetSlot)
+	identity.Patch("/slots/:id", auth, id, request.Bind(h.UpdateSlot))
+	identity.Delete("/slots/:id", auth, id, h.CancelSlot)
+	identity.Get("/classes/:id/slots", id, h.GetClassSlots)
+	identity.Get("/users/:id/slots", id, h.GetInstructorSlots)
+	identity.Post("/slots/:id/bookings", auth, id, h.BookSlot)
+	identity.Get("/slots/:id/bookings", auth, id, h.GetSlotBookings)
+	identity.Delete("/slots/:id/bookings/:student_id", auth, uuidParams("id", "student_id"), h.CancelBooking)
+
+	// Requests students make to join a class, decided by its instructors, both
+	// as the caller of the access token
+	identity.Post("/classes/:id/enrollment-requests", auth, id, request.Bind(h.RequestEnrollment))
+	identity.Get("/classes/:id/enrollment-requests", auth, id, h.GetEnrollmentRequests)
+	identity.Post("/classes/:id/enrollment-requests/:student_id/approve", auth, uuidParams("id", "student_id"), h.ApproveEnrollmentRequest)
+	identity.Post("/classes/:id/enrollment-requests/:student_id/reject", auth, uuidParams("id", "student_id"), h.RejectEnrollmentRequest)
+
+	// Guardian links, created by an admin of the student's institute and
+	// revoked by them or the student, as the caller of the access token
+	identity.Post("/students/:id/guardians", auth, id, request.Bind(h.CreateGuardianLink))
+	identity.Get("/students/:id/guardians", auth, id, h.GetStudentGuardianLinks)
+	identity.Delete("/guardian-links/:id", auth, id, h.RevokeGuardianLink)
+	// The students a guardian may see, which other services check access against
+	identity.Get("/guardians/:id/students", id, h.GetGuardianStudents)
 
 	// User Enrollments (keeping this accessible internally if needed, or maybe it belongs to Org?)
-	identity.Get("/users/:user_id/enrollments", h.GetUserEnrollments)
+	identity.Get("/users/:user_id/enrollments", uuidParams("user_id"), h.GetUserEnrollments)
+
+	// The user resource as Kong serves it under /api/v1 and /api/v2
+	setupVersionedRoutes(app, h, middleware.InternalAuth())
 
 	// Organizations (Assuming these should also be under internal/identity or similar)
 	// Spec didn't explicitly list Org paths under 1 Identity Service in the summary block,
 	// but clearly Identity Service owns org structure.
 	// I'll keep them under /orgs for gateway access.
-	orgs := app.Group("/orgs")
+	orgs := app.Group("/orgs", identifyActor(h.verifier, false))
 
 	// Institutes
-	orgs.Post("/institutes", h.CreateInstitute)
+	orgs.Post("/institutes", request.Bind(h.CreateInstitute))
 	orgs.Get("/institutes", h.GetInstitutes)
-	orgs.Get("/institutes/:id", h.GetInstitute)
-	orgs.Patch("/institutes/:id", h.UpdateInstitute) // Changed PUT to PATCH for consistency
-	orgs.Patch("/institutes/:id/activate", h.ActivateInstitute)
-	orgs.Patch("/institutes/:id/deactivate", h.DeactivateInstitute)
-	orgs.Delete("/institutes/:id", h.DeleteInstitute)
-	orgs.Post("/institutes/:id/admins", h.AddInstituteAdmin)
-	orgs.Delete("/institutes/:id/admins/:adminId", h.RemoveInstituteAdmin)
-	orgs.Post("/institutes/:id/admins/:adminId/resend-invite", h.ResendAdminInvite)
+	orgs.Get("/institutes/:id", id, h.GetInstitute)
+	orgs.Patch("/institutes/:id", id, request.Bind(h.UpdateInstitute)) // Changed PUT to PATCH for consistency
+	orgs.Patch("/institutes/:id/activate", id, h.ActivateInstitute)
+	orgs.Patch("/institutes/:id/deactivate", id, h.DeactivateInstitute)
+	orgs.Delete("/institutes/:id", auth, id, h.DeleteInstitute)
+	orgs.Post("/institutes/:id/admins", id, request.Bind(h.AddInstituteAdmin))
+	orgs.Patch("/institutes/:id/admins/:adminId", uuidParams("id", "adminId"), request.Bind(h.UpdateInstituteAdminRole))
+	orgs.Delete("/institutes/:id/admins/:adminId", uuidParams("id", "adminId"), h.RemoveInstituteAdmin)
+	orgs.Post("/institutes/:id/admins/:adminId/resend-invite", uuidParams("id", "adminId"), h.ResendAdminInvite)
+
+	// Terms
+	orgs.Post("/institutes/:id/terms", id, request.Bind(h.CreateTerm))
+	orgs.Get("/institutes/:id/terms", id, h.GetTerms)
+	orgs.Get("/institutes/:id/terms/current", id, h.GetCurrentTerm)
+	orgs.Get("/institutes/:id/terms/:termId", uuidParams("id", "termId"), h.GetTerm)
+	orgs.Patch("/institutes/:id/terms/:termId", uuidParams("id", "termId"), request.Bind(h.UpdateTerm))
+	orgs.Delete("/institutes/:id/terms/:termId", uuidParams("id", "termId"), h.DeleteTerm)
+
+	// Feature flags, and institutes' overrides of them
+	orgs.Post("/features", request.Bind(h.CreateFeatureFlag))
+	orgs.Get("/features", h.ListFeatureFlags)
+	orgs.Get("/features/:key", h.GetFeatureFlag)
+	orgs.Patch("/features/:key", request.Bind(h.UpdateFeatureFlag))
+	orgs.Delete("/features/:key", h.DeleteFeatureFlag)
+	orgs.Get("/institutes/:id/features", id, h.GetInstituteFeatures)
+	orgs.Put("/institutes/:id/features/:key", id, request.Bind(h.SetFeatureOverride))
+	orgs.Delete("/institutes/:id/features/:key", id, h.DeleteFeatureOverride)
+
+	// Policy documents users have to accept; a published version is fixed
+	// once it takes effect
+	orgs.Post("/policies", request.Bind(h.CreatePolicyDocument))
+	orgs.Get("/policies", h.ListPolicyDocuments)
+	orgs.Get("/policies/current", h.GetCurrentPolicyDocuments) // before /policies/:id so it is not taken as an ID
+	orgs.Get("/policies/:id", id, h.GetPolicyDocument)
+	orgs.Patch("/policies/:id", id, request.Bind(h.UpdatePolicyDocument))
+	orgs.Delete("/policies/:id", id, h.DeletePolicyDocument)
 
 	// Faculties
-	orgs.Post("/faculties", h.CreateFaculty)
-	orgs.Get("/faculties/:id", h.GetFaculty)
-	orgs.Patch("/faculties/:id", h.UpdateFaculty)
-	orgs.Delete("/faculties/:id", h.DeleteFaculty)
+	orgs.Post("/faculties", request.Bind(h.CreateFaculty))
+	orgs.Get("/faculties/:id", id, h.GetFaculty)
+	orgs.Patch("/faculties/:id", id, request.Bind(h.UpdateFaculty))
+	orgs.Delete("/faculties/:id", auth, id, h.DeleteFaculty)
+	orgs.Put("/faculties/:id/head", id, request.Bind(h.SetFacultyHead))
+	orgs.Delete("/faculties/:id/head", id, h.ClearFacultyHead)
 
 	// Departments
-	orgs.Post("/departments", h.CreateDepartment)
-	orgs.Get("/departments/:id", h.GetDepartment)
-	orgs.Patch("/departments/:id", h.UpdateDepartment)
-	orgs.Delete("/departments/:id", h.DeleteDepartment)
+	orgs.Post("/departments", request.Bind(h.CreateDepartment))
+	orgs.Get("/departments/:id", id, h.GetDepartment)
+	orgs.Patch("/departments/:id", id, request.Bind(h.UpdateDepartment))
+	orgs.Delete("/departments/:id", auth, id, h.DeleteDepartment)
+	orgs.Put("/departments/:id/head", id, request.Bind(h.SetDepartmentHead))
+	orgs.Delete("/departments/:id/head", id, h.ClearDepartmentHead)
 
 	// Classes
-	orgs.Post("/classes", h.CreateClass)
-	orgs.Get("/classes/:id", h.GetClass)
-	orgs.Patch("/classes/:id", h.UpdateClass)
-	orgs.Delete("/classes/:id", h.DeleteClass)
+	orgs.Post("/classes", request.Bind(h.CreateClass))
+	orgs.Get("/classes", h.ListClasses)
+	orgs.Get("/classes/:id", id, h.GetClass)
+	orgs.Patch("/classes/:id", id, request.Bind(h.UpdateClass))
+	orgs.Delete("/classes/:id", id, h.DeleteClass)
+
+	// Sections
+	orgs.Get("/classes/:class_id/sections", uuidParams("class_id"), h.ListSections)
+	orgs.Post("/classes/:class_id/sections", uuidParams("class_id"), request.Bind(h.CreateSection))
+	orgs.Get("/classes/:class_id/sections/:section_id", uuidParams("class_id", "section_id"), h.GetSection)
+	orgs.Patch("/classes/:class_id/sections/:section_id", uuidParams("class_id", "section_id"), request.Bind(h.UpdateSection))
+	orgs.Delete("/classes/:class_id/sections/:section_id", uuidParams("class_id", "section_id"), h.DeleteSection)
 
 	// Memberships
-	orgs.Post("/classes/:class_id/enrollments", h.EnrollStudent)
-	orgs.Get("/classes/:class_id/enrollments", h.GetClassEnrollments)
-	orgs.Delete("/classes/:class_id/enrollments/:student_id", h.UnenrollStudent)
+	orgs.Post("/classes/:class_id/enrollments", uuidParams("class_id"), request.Bind(h.EnrollStudent))
+	orgs.Get("/classes/:class_id/enrollments", uuidParams("class_id"), h.GetClassEnrollments)
+	orgs.Patch("/classes/:class_id/enrollments/:student_id", uuidParams("class_id", "student_id"), request.Bind(h.MoveEnrollment))
+	orgs.Delete("/classes/:class_id/enrollments/:student_id", uuidParams("class_id", "student_id"), h.UnenrollStudent)
+	orgs.Get("/classes/:class_id/waitlist", uuidParams("class_id"), h.GetClassWaitlist)
 }
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) ListSections(c *fiber.Ctx) error {
+	sections, err := h.svc.ListSections(c.Params("class_id"))
+	if err != nil {
+		return apiError(err, "class")
+	}
+	return c.JSON(sections)
+}
+
+func (h *Handler) CreateSection(c *fiber.Ctx, req *service.SectionRequest) error {
+	section, err := h.as(c).CreateSection(c.Params("class_id"), *req)
+	if err != nil {
+		return apiError(err, "section")
+	}
+	return c.Status(fiber.StatusCreated).JSON(section)
+}
+
+func (h *Handler) GetSection(c *fiber.Ctx) error {
+	section, err := h.svc.GetSection(c.Params("class_id"), c.Params("section_id"))
+	if err != nil {
+		return apiError(err, "section")
+	}
+	return c.JSON(section)
+}
+
+type updateSectionRequest struct {
+	Name            *string        `json:"name"`
+	Capacity        nullableInt    `json:"capacity"`
+	Schedule        *string        `json:"schedule"`
+	InstructorID    nullableString `json:"instructor_id"`
+	ExpectedVersion *int           `json:"expected_version"`
+}
+
+// UpdateSection edits a section; a null instructor_id unassigns its
+// instructor and a null capacity removes its own limit
+func (h *Handler) UpdateSection(c *fiber.Ctx, req *updateSectionRequest) error {
+	version, err := expectedVersion(c, req.ExpectedVersion)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
+	}
+	update := service.SectionUpdate{
+		Name:        req.Name,
+		Capacity:    req.Capacity.Value,
+		SetCapacity: req.Capacity.Set,
+		Schedule:    req.Schedule,
+	}
+	if req.InstructorID.Set {
+		instructorID := ""
+		if req.InstructorID.Value != nil {
+			instructorID = *req.InstructorID.Value
+		}
+		update.InstructorID = &instructorID
+	}
+	section, err := h.as(c).UpdateSection(c.Params("class_id"), c.Params("section_id"), update, version)
+	if err != nil {
+		return apiError(err, "section")
+	}
+	return c.JSON(section)
+}
+
+func (h *Handler) DeleteSection(c *fiber.Ctx) error {
+	if err := h.as(c).DeleteSection(c.Params("class_id"), c.Params("section_id")); err != nil {
+		return apiError(err, "section")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+type moveEnrollmentRequest struct {
+	SectionID string `json:"section_id" validate:"required"`
+}
+
+// MoveEnrollment moves an enrolled student to another section of the class
+func (h *Handler) MoveEnrollment(c *fiber.Ctx, req *moveEnrollmentRequest) error {
+	enrollment, err := h.as(c).MoveEnrollment(c.Params("class_id"), c.Params("student_id"), req.SectionID)
+	if err != nil {
+		return apiError(err, "class")
+	}
+	return c.JSON(enrollment)
+}
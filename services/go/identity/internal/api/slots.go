@@ -0,0 +1,86 @@
+package api
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateSlot opens an office-hours slot held by the caller
+func (h *Handler) CreateSlot(c *fiber.Ctx, req *service.SlotRequest) error {
+	slot, err := h.svc.CreateSlot(jwtauth.ClaimsFrom(c).UserID, *req)
+	if err != nil {
+		return apiError(err, "slot")
+	}
+	return c.Status(fiber.StatusCreated).JSON(slot)
+}
+
+func (h *Handler) GetSlot(c *fiber.Ctx) error {
+	slot, err := h.svc.GetSlot(c.Params("id"))
+	if err != nil {
+		return apiError(err, "slot")
+	}
+	return c.JSON(slot)
+}
+
+func (h *Handler) UpdateSlot(c *fiber.Ctx, req *service.SlotUpdate) error {
+	slot, err := h.svc.UpdateSlot(jwtauth.ClaimsFrom(c).UserID, c.Params("id"), *req)
+	if err != nil {
+		return apiError(err, "slot")
+	}
+	return c.JSON(slot)
+}
+
+// CancelSlot calls a slot off; its students are emailed in the background
+func (h *Handler) CancelSlot(c *fiber.Ctx) error {
+	if err := h.svc.CancelSlot(jwtauth.ClaimsFrom(c).UserID, c.Params("id")); err != nil {
+		return apiError(err, "slot")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) GetClassSlots(c *fiber.Ctx) error {
+	slots, err := h.svc.GetClassSlots(c.Params("id"))
+	if err != nil {
+		return apiError(err, "class")
+	}
+	return c.JSON(slots)
+}
+
+func (h *Handler) GetInstructorSlots(c *fiber.Ctx) error {
+	slots, err := h.svc.GetInstructorSlots(c.Params("id"))
+	if err != nil {
+		return apiError(err, "user")
+	}
+	return c.JSON(slots)
+}
+
+type slotBookingResponse struct {
+	*core.SlotBooking
+	Slot *core.AvailabilitySlot `json:"slot"`
+}
+
+// BookSlot books the caller a seat in the slot
+func (h *Handler) BookSlot(c *fiber.Ctx) error {
+	booking, slot, err := h.svc.BookSlot(jwtauth.ClaimsFrom(c).UserID, c.Params("id"))
+	if err != nil {
+		return apiError(err, "slot")
+	}
+	return c.Status(fiber.StatusCreated).JSON(slotBookingResponse{SlotBooking: booking, Slot: slot})
+}
+
+func (h *Handler) GetSlotBookings(c *fiber.Ctx) error {
+	bookings, err := h.svc.GetSlotBookings(jwtauth.ClaimsFrom(c).UserID, c.Params("id"))
+	if err != nil {
+		return apiError(err, "slot")
+	}
+	return c.JSON(bookings)
+}
+
+func (h *Handler) CancelBooking(c *fiber.Ctx) error {
+	if err := h.svc.CancelBooking(jwtauth.ClaimsFrom(c).UserID, c.Params("id"), c.Params("student_id")); err != nil {
+		return apiError(err, "booking")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
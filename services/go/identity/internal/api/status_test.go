@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestPathIDsAndStatusCodes(t *testing.T) {
+	app := newTestApp(t)
+
+	send := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", bearer(t, "admin-1"))
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	missing := uuid.NewString()
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/orgs/institutes/not-a-uuid", fiber.StatusBadRequest},
+		{"DELETE", "/orgs/faculties/123", fiber.StatusBadRequest},
+		{"GET", "/orgs/classes/abc/waitlist", fiber.StatusBadRequest},
+		{"DELETE", "/orgs/classes/" + missing + "/enrollments/nope", fiber.StatusBadRequest},
+		{"GET", "/orgs/institutes/" + missing, fiber.StatusNotFound},
+		{"DELETE", "/orgs/institutes/" + missing, fiber.StatusNotFound},
+		{"DELETE", "/orgs/departments/" + missing, fiber.StatusNotFound},
+		{"DELETE", "/orgs/classes/" + missing, fiber.StatusNotFound},
+	} {
+		if got := send(tc.method, tc.path, ""); got != tc.want {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, got, tc.want)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/orgs/institutes", strings.NewReader(`{"name":"Uni","code":"UNI","domain":"uni.example.edu","contact_email":"admin@uni.example.edu"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil || resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("create institute: %v, %v", resp, err)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if got := send("DELETE", "/orgs/institutes/"+created.ID, ""); got != fiber.StatusOK {
+		t.Errorf("delete institute = %d, want 200", got)
+	}
+	if got := send("DELETE", "/orgs/institutes/"+created.ID, ""); got != fiber.StatusNotFound {
+		t.Errorf("delete institute again = %d, want 404", got)
+	}
+}
+
+func TestDeleteOrgUnitNeedsTokenAndReportsBlockers(t *testing.T) {
+	app := newTestApp(t)
+
+	create := func(path, body string) string {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil || resp.StatusCode != fiber.StatusCreated {
+			t.Fatalf("POST %s: %v, %v", path, resp, err)
+		}
+		var created struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		return created.ID
+	}
+	institute := create("/orgs/institutes", `{"name":"Uni","code":"UNI","domain":"uni.example.edu","contact_email":"admin@uni.example.edu"}`)
+	create("/orgs/faculties", `{"institute_id":"`+institute+`","name":"Science"}`)
+
+	req := httptest.NewRequest("DELETE", "/orgs/institutes/"+institute, nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("delete without a token = %d, want 401", resp.StatusCode)
+	}
+
+	req = httptest.NewRequest("DELETE", "/orgs/institutes/"+institute, nil)
+	req.Header.Set("Authorization", bearer(t, "admin-1"))
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Code    string `json:"code"`
+		Details struct {
+			Report struct {
+				Faculties int64 `json:"faculties"`
+			} `json:"report"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusConflict || body.Details.Report.Faculties != 1 {
+		t.Errorf("delete institute with a faculty = %d %+v, want 409 with the report", resp.StatusCode, body)
+	}
+
+	req = httptest.NewRequest("DELETE", "/orgs/institutes/"+institute+"?cascade=true", nil)
+	req.Header.Set("Authorization", bearer(t, "admin-1"))
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("cascading delete = %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+func (h *Handler) CreateTerm(c *fiber.Ctx, req *service.TermRequest) error {
+	term, err := h.svc.CreateTerm(c.Params("id"), *req)
+	if err != nil {
+		return apiError(err, "term")
+	}
+	return c.Status(fiber.StatusCreated).JSON(term)
+}
+
+func (h *Handler) GetTerms(c *fiber.Ctx) error {
+	terms, err := h.svc.GetTerms(c.Params("id"))
+	if err != nil {
+		return apiError(err, "institute")
+	}
+	return c.JSON(terms)
+}
+
+func (h *Handler) GetTerm(c *fiber.Ctx) error {
+	term, err := h.svc.GetTerm(c.Params("id"), c.Params("termId"))
+	if err != nil {
+		return apiError(err, "term")
+	}
+	return c.JSON(term)
+}
+
+func (h *Handler) GetCurrentTerm(c *fiber.Ctx) error {
+	term, err := h.svc.GetCurrentTerm(c.Params("id"))
+	if err != nil {
+		return apiError(err, "term")
+	}
+	return c.JSON(term)
+}
+
+type updateTermRequest struct {
+	service.TermRequest
+	ExpectedVersion *int `json:"expected_version"`
+}
+
+func (h *Handler) UpdateTerm(c *fiber.Ctx, req *updateTermRequest) error {
+	version, err := expectedVersion(c, req.ExpectedVersion)
+	if err != nil {
+		return apierror.BadRequest(err.Error())
+	}
+	term, err := h.svc.UpdateTerm(c.Params("id"), c.Params("termId"), req.TermRequest, version)
+	if err != nil {
+		return apiError(err, "term")
+	}
+	return c.JSON(term)
+}
+
+func (h *Handler) DeleteTerm(c *fiber.Ctx) error {
+	if err := h.svc.DeleteTerm(c.Params("id"), c.Params("termId")); err != nil {
+		return apiError(err, "term")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) ListClasses(c *fiber.Ctx) error {
+	classes, err := h.svc.ListClasses(c.Query("department_id"), c.Query("term_id"))
+	if err != nil {
+		return apiError(err, "class")
+	}
+	return c.JSON(classes)
+}
+
+type getClassesRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// GetClasses returns several classes at once with their terms and
+// instructors, e.g. to group a student's classes by term
+func (h *Handler) GetClasses(c *fiber.Ctx, req *getClassesRequest) error {
+	classes, err := h.svc.GetClassSummaries(req.IDs)
+	if err != nil {
+		return apiError(err, "class")
+	}
+	return c.JSON(classes)
+}
+
+// authorizeTermOverride lets enrollments past the end of a class's term
+// through only for callers whose bearer token holds the
+// enrollment.override_term permission
+func (h *Handler) authorizeTermOverride(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		return apierror.Unauthorized("a bearer token is required to override the term end")
+	}
+	claims, err := h.verifier.Verify(c.UserContext(), token)
+	if errors.Is(err, jwtauth.ErrAcceptanceRequired) {
+		return apierror.Forbidden(err.Error())
+	}
+	if err != nil {
+		return apierror.Unauthorized("invalid or expired token")
+	}
+
+	allowed, err := h.authz.Check(c.UserContext(), claims.UserID, claims.Role, "enrollment", "override_term", "")
+	if err != nil {
+		return apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "authorization check failed")
+	}
+	if !allowed {
+		return apierror.Forbidden("not allowed to enroll after the term has ended")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTwoFactor returns the user's TOTP enrollment, with its secret still
+// encrypted, for AuthN to check codes against
+func (h *Handler) GetTwoFactor(c *fiber.Ctx) error {
+	status, err := h.svc.GetTwoFactor(c.Params("id"))
+	if err != nil {
+		return apiError(err, "two-factor enrollment")
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(status)
+}
+
+// SetUpTwoFactor stores an enrollment AuthN started; it is not enforced
+// until confirmed
+func (h *Handler) SetUpTwoFactor(c *fiber.Ctx, req *service.TwoFactorSetupRequest) error {
+	if err := h.as(c).SetUpTwoFactor(c.Params("id"), *req); err != nil {
+		return apiError(err, "two-factor enrollment")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// EnableTwoFactor confirms the user's enrollment once AuthN checked a code
+func (h *Handler) EnableTwoFactor(c *fiber.Ctx) error {
+	if err := h.as(c).EnableTwoFactor(c.Params("id")); err != nil {
+		return apiError(err, "two-factor enrollment")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) DisableTwoFactor(c *fiber.Ctx) error {
+	if err := h.as(c).DisableTwoFactor(c.Params("id")); err != nil {
+		return apiError(err, "two-factor enrollment")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UseRecoveryCode spends a recovery code; 404 if the user has no unused code
+// with that hash
+func (h *Handler) UseRecoveryCode(c *fiber.Ctx, req *service.RecoveryCodeRequest) error {
+	if err := h.svc.UseRecoveryCode(c.Params("id"), *req); err != nil {
+		return apiError(err, "recovery code")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/request"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/apiversion"
+	"github.com/gofiber/fiber/v2"
+)
+
+// V1 is the user API the mobile app is pinned to. It names a user's name
+// full_name and their role user_type, as identity did before /api/v2.
+var V1 = apiversion.Version{
+	Object: apiversion.Object{
+		Renames: []apiversion.Rename{
+			{Canonical: "name", Legacy: "full_name"},
+			{Canonical: "role", Legacy: "user_type"},
+		},
+		ListFields: []string{"items"},
+	},
+	Deprecated: time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC),
+	Sunset:     time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC),
+	Successor:  "/api/v2/users",
+}
+
+// setupVersionedRoutes serves the user resource under each API version.
+// Both share the internal handlers; v1 renames bodies on the way through.
+func setupVersionedRoutes(app *fiber.App, h *Handler, auth fiber.Handler) {
+	userRoutes(app.Group("/api/v2", auth), h)
+	userRoutes(app.Group("/api/v1", auth, V1.Handler()), h)
+}
+
+func userRoutes(r fiber.Router, h *Handler) {
+	id := uuidParams("id")
+	r.Post("/users", request.Bind(h.RegisterUser))
+	r.Get("/users", h.ListUsers)
+	r.Post("/users/lookup", request.Bind(h.LookupUser))
+	r.Post("/users/batch", request.Bind(h.GetUsers))
+	r.Get("/users/:id", id, h.GetUser)
+	r.Patch("/users/:id", id, request.Bind(h.UpdateUser))
+	r.Delete("/users/:id", id, h.DeleteUser)
+}
@@ -0,0 +1,162 @@
+// Package apiversion serves an older version of the API from the handlers of
+// the current one. The handlers read and write the canonical field names;
+// a Version renames the fields of JSON bodies to and from the names its
+// clients were built against, and marks its responses deprecated.
+package apiversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Rename is a field a version names differently from the canonical API
+type Rename struct {
+	// Canonical is the name the handlers use
+	Canonical string
+	// Legacy is the name the version's clients use
+	Legacy string
+}
+
+// Object is how one kind of object differs in a version. Only the object's
+// own fields are renamed; objects nested in it keep their names, so an
+// institute's name stays name inside a user whose name is full_name.
+type Object struct {
+	Renames []Rename
+	// ListFields are fields of a response that hold a list of the objects
+	// rather than being one, as a page's items do
+	ListFields []string
+}
+
+// Version is an older version of the API
+type Version struct {
+	// Object is the kind of object the version's routes read and write
+	Object Object
+	// Deprecated is when the version was deprecated, and Sunset when it stops
+	// being served
+	Deprecated time.Time
+	Sunset     time.Time
+	// Successor is the path of the version replacing it
+	Successor string
+}
+
+// Handler serves the routes after it in the version: JSON request bodies
+// are renamed to the canonical names before the handler reads them, and
+// JSON responses back to the version's names. Other bodies pass untouched.
+func (v Version) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Set first, so error responses are marked as well
+		c.Set("Deprecation", "@"+strconv.FormatInt(v.Deprecated.Unix(), 10))
+		c.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+		if v.Successor != "" {
+			c.Set(fiber.HeaderLink, "<"+v.Successor+">; rel=\"successor-version\"")
+		}
+
+		if isJSON(string(c.Request().Header.ContentType())) && len(c.Body()) > 0 {
+			body, err := v.Object.ToCanonical(c.Body())
+			if err != nil {
+				return apierror.BadRequest("Invalid JSON body")
+			}
+			c.Request().SetBody(body)
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if isJSON(string(c.Response().Header.ContentType())) && len(c.Response().Body()) > 0 {
+			body, err := v.Object.ToLegacy(c.Response().Body())
+			if err != nil {
+				// Not a body the version knows; better sent as it is than lost
+				return nil
+			}
+			c.Response().SetBody(body)
+		}
+		return nil
+	}
+}
+
+// ToCanonical renames the legacy fields of a request body: one object, or
+// an array of them
+func (o Object) ToCanonical(body []byte) ([]byte, error) {
+	return o.mapBody(body, func(r Rename) (string, string) { return r.Legacy, r.Canonical }, false)
+}
+
+// ToLegacy renames the canonical fields of a response body: one object, an
+// array of them, or an object holding them in one of ListFields
+func (o Object) ToLegacy(body []byte) ([]byte, error) {
+	return o.mapBody(body, func(r Rename) (string, string) { return r.Canonical, r.Legacy }, true)
+}
+
+func (o Object) mapBody(body []byte, names func(Rename) (from, to string), lists bool) ([]byte, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return o.mapArray(trimmed, names)
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &obj); err != nil {
+		return nil, err
+	}
+	if lists {
+		for _, field := range o.ListFields {
+			list, ok := obj[field]
+			if !ok || len(bytes.TrimSpace(list)) == 0 || bytes.TrimSpace(list)[0] != '[' {
+				continue
+			}
+			mapped, err := o.mapArray(list, names)
+			if err != nil {
+				return nil, err
+			}
+			obj[field] = mapped
+			return json.Marshal(obj)
+		}
+	}
+	o.rename(obj, names)
+	return json.Marshal(obj)
+}
+
+func (o Object) mapArray(body []byte, names func(Rename) (from, to string)) ([]byte, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(item, &obj); err != nil {
+			// Not an object, e.g. a list of IDs: nothing to rename
+			continue
+		}
+		o.rename(obj, names)
+		mapped, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = mapped
+	}
+	return json.Marshal(items)
+}
+
+// rename moves each field to its other name, unless the object already has
+// a field by that name
+func (o Object) rename(obj map[string]json.RawMessage, names func(Rename) (from, to string)) {
+	for _, r := range o.Renames {
+		from, to := names(r)
+		value, ok := obj[from]
+		if _, taken := obj[to]; !ok || taken {
+			continue
+		}
+		obj[to] = value
+		delete(obj, from)
+	}
+}
+
+func isJSON(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), fiber.MIMEApplicationJSON)
+}
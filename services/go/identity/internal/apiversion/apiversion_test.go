@@ -0,0 +1,148 @@
+package apiversion
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var user = Object{
+	Renames: []Rename{
+		{Canonical: "name", Legacy: "full_name"},
+		{Canonical: "role", Legacy: "user_type"},
+	},
+	ListFields: []string{"items"},
+}
+
+func decode(t *testing.T, body []byte) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("%s: %v", body, err)
+	}
+	return v
+}
+
+func TestToLegacy(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "object",
+			body: `{"id":"u1","name":"Ada","role":"ADMIN"}`,
+			want: `{"id":"u1","full_name":"Ada","user_type":"ADMIN"}`,
+		},
+		{
+			name: "nested objects keep their names",
+			body: `{"name":"Ada","role":"INSTITUTE_ADMIN","institutes":[{"name":"Uni","role":"OWNER"}],"student_profile":{"name":"x"}}`,
+			want: `{"full_name":"Ada","user_type":"INSTITUTE_ADMIN","institutes":[{"name":"Uni","role":"OWNER"}],"student_profile":{"name":"x"}}`,
+		},
+		{
+			name: "array",
+			body: `[{"name":"Ada","role":"ADMIN"},{"name":"Alan","role":"STUDENT"}]`,
+			want: `[{"full_name":"Ada","user_type":"ADMIN"},{"full_name":"Alan","user_type":"STUDENT"}]`,
+		},
+		{
+			name: "page",
+			body: `{"items":[{"name":"Ada","role":"ADMIN"}],"next_cursor":null}`,
+			want: `{"items":[{"full_name":"Ada","user_type":"ADMIN"}],"next_cursor":null}`,
+		},
+		{
+			name: "array of non-objects",
+			body: `["u1","u2"]`,
+			want: `["u1","u2"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := user.ToLegacy([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decode(t, got), decode(t, []byte(tt.want))) {
+				t.Errorf("ToLegacy(%s) = %s, want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToCanonical(t *testing.T) {
+	got, err := user.ToCanonical([]byte(`{"email":"ada@example.com","full_name":"Ada","user_type":"ADMIN"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"email":"ada@example.com","name":"Ada","role":"ADMIN"}`
+	if !reflect.DeepEqual(decode(t, got), decode(t, []byte(want))) {
+		t.Errorf("ToCanonical = %s, want %s", got, want)
+	}
+
+	// A client already sending the canonical name keeps it
+	got, err = user.ToCanonical([]byte(`{"name":"Ada","full_name":"Ignored"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := decode(t, got).(map[string]any); v["name"] != "Ada" {
+		t.Errorf("ToCanonical overwrote name: %s", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	v := Version{
+		Object:     user,
+		Deprecated: time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC),
+		Sunset:     time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC),
+		Successor:  "/api/v2/users",
+	}
+	app := fiber.New()
+	app.Post("/users", v.Handler(), func(c *fiber.Ctx) error {
+		var req map[string]any
+		if err := c.BodyParser(&req); err != nil {
+			return err
+		}
+		// The handler sees the canonical names only
+		if req["name"] != "Ada" || req["full_name"] != nil {
+			t.Errorf("handler got %v", req)
+		}
+		return c.JSON(req)
+	})
+	app.Get("/plain", v.Handler(), func(c *fiber.Ctx) error {
+		return c.SendString(`{"name":"not JSON by content type"}`)
+	})
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"full_name":"Ada"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if got := decode(t, body).(map[string]any); got["full_name"] != "Ada" || got["name"] != nil {
+		t.Errorf("response = %s, want full_name", body)
+	}
+	if got := resp.Header.Get("Deprecation"); got != "@1792108800" {
+		t.Errorf("Deprecation = %q", got)
+	}
+	if got := resp.Header.Get("Sunset"); got != "Wed, 30 Jun 2027 00:00:00 GMT" {
+		t.Errorf("Sunset = %q", got)
+	}
+	if got := resp.Header.Get("Link"); got != `</api/v2/users>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/plain", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	if string(body) != `{"name":"not JSON by content type"}` {
+		t.Errorf("non-JSON response was changed: %s", body)
+	}
+}
@@ -0,0 +1,77 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client defines the calls the identity service makes to the authz service
+type Client interface {
+	// Check asks whether the user may perform action on resource. A scope
+	// such as "class:<id>" names the resource instance, so grants limited to
+	// it count too; pass "" for unscoped checks.
+	Check(ctx context.Context, userID, role, resource, action, scope string) (bool, error)
+}
+
+type httpClient struct {
+	baseURL       string
+	internalToken string
+	httpClient    *http.Client
+}
+
+// NewClient creates an authz service client
+func NewClient(baseURL, internalToken string) Client {
+	return &httpClient{
+		baseURL:       baseURL,
+		internalToken: internalToken,
+		httpClient:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (c *httpClient) Check(ctx context.Context, userID, role, resource, action, scope string) (bool, error) {
+	// Tokens carry the identity user type (e.g. SYSTEM_ADMIN) while authz
+	// role names are lower case
+	request := map[string]string{
+		"subject":  userID,
+		"role":     strings.ToLower(role),
+		"resource": resource,
+		"action":   action,
+	}
+	if scope != "" {
+		request["scope"] = scope
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/internal/authz/check", bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", c.internalToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to reach authz service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("authz service returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Allowed bool `json:"allowed"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode authz response: %w", err)
+	}
+	return result.Allowed, nil
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const featureFlagsKey = "identity:features:flags"
+
+// FeatureCache holds the feature flags and each institute's overrides of
+// them, which are merged on every read. The two are cached apart so a flag
+// change drops one key instead of an entry per institute.
+type FeatureCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewFeatureCache(client *redis.Client, ttl time.Duration) *FeatureCache {
+	return &FeatureCache{client: client, ttl: ttl}
+}
+
+func featureOverridesKey(instituteID uuid.UUID) string {
+	return "identity:features:institute:" + instituteID.String()
+}
+
+// GetFlags returns the cached flags, or nil on a miss
+func (c *FeatureCache) GetFlags(ctx context.Context) ([]core.FeatureFlag, error) {
+	var flags []core.FeatureFlag
+	if ok, err := c.get(ctx, featureFlagsKey, &flags); !ok {
+		return nil, err
+	}
+	return flags, nil
+}
+
+func (c *FeatureCache) SetFlags(ctx context.Context, flags []core.FeatureFlag) error {
+	return c.set(ctx, featureFlagsKey, flags)
+}
+
+// InvalidateFlags drops the cached flags after one was added, changed or
+// deleted
+func (c *FeatureCache) InvalidateFlags(ctx context.Context) error {
+	return c.client.Del(ctx, featureFlagsKey).Err()
+}
+
+// GetOverrides returns the cached overrides of an institute, or nil on a
+// miss. An institute without overrides is cached as an empty list.
+func (c *FeatureCache) GetOverrides(ctx context.Context, instituteID uuid.UUID) ([]core.InstituteFeatureOverride, error) {
+	overrides := []core.InstituteFeatureOverride{}
+	if ok, err := c.get(ctx, featureOverridesKey(instituteID), &overrides); !ok {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+func (c *FeatureCache) SetOverrides(ctx context.Context, instituteID uuid.UUID, overrides []core.InstituteFeatureOverride) error {
+	return c.set(ctx, featureOverridesKey(instituteID), overrides)
+}
+
+// InvalidateOverrides drops the cached overrides of an institute
+func (c *FeatureCache) InvalidateOverrides(ctx context.Context, instituteID uuid.UUID) error {
+	return c.client.Del(ctx, featureOverridesKey(instituteID)).Err()
+}
+
+// get decodes the value at key into v, reporting false on a miss or error
+func (c *FeatureCache) get(ctx context.Context, key string, v interface{}) (bool, error) {
+	val, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(val, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *FeatureCache) set(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, key, data, c.ttl).Err()
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Stats scopes, used in cache keys
+const (
+	ScopeInstitute  = "institute"
+	ScopeDepartment = "department"
+)
+
+// StatsCache holds dashboard stats for a short while so dashboards polling
+// them do not rerun the aggregate queries. Entries are dropped when
+// enrollments in their scope change.
+type StatsCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewStatsCache(client *redis.Client, ttl time.Duration) *StatsCache {
+	return &StatsCache{client: client, ttl: ttl}
+}
+
+func statsKey(scope string, id uuid.UUID) string {
+	return "identity:stats:" + scope + ":" + id.String()
+}
+
+// Get returns the cached stats, or nil on a miss
+func (c *StatsCache) Get(ctx context.Context, scope string, id uuid.UUID) (*repository.OrgStats, error) {
+	val, err := c.client.Get(ctx, statsKey(scope, id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stats repository.OrgStats
+	if err := json.Unmarshal(val, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *StatsCache) Set(ctx context.Context, scope string, id uuid.UUID, stats *repository.OrgStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, statsKey(scope, id), data, c.ttl).Err()
+}
+
+// Invalidate drops the cached stats of a department and its institute
+func (c *StatsCache) Invalidate(ctx context.Context, departmentID, instituteID uuid.UUID) error {
+	return c.client.Del(ctx, statsKey(ScopeDepartment, departmentID), statsKey(ScopeInstitute, instituteID)).Err()
+}
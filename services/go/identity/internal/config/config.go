@@ -3,26 +3,124 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/storage"
 )
 
 type Config struct {
 	Port            string
+	GRPCPort        string
 	DatabaseURL     string
 	EmailServiceURL string
 	InternalToken   string
 	WebURL          string
+
+	// ReplicaDatabaseURL is a read replica for list, search, stats and export
+	// queries; empty reads everything from DatabaseURL. The replica is
+	// pinged every ReplicaCheckInterval to notice it coming back.
+	ReplicaDatabaseURL   string
+	ReplicaCheckInterval time.Duration
+
+	// RunMigrations is auto to apply pending migrations at startup, or off
+	// to refuse to start while any are pending
+	RunMigrations string
+
+	// Domain events
+	RabbitMQAPIURL     string
+	RabbitMQVHost      string
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+
+	// Data exports
+	SessionServiceURL    string
+	SubmissionServiceURL string
+	AuthZServiceURL      string
+	AuthNJWKSURL         string
+	ExportPollInterval   time.Duration
+	ExportRetention      time.Duration
+
+	// AnnouncementPollInterval is how often published announcements are
+	// checked for ones still to be emailed
+	AnnouncementPollInterval time.Duration
+	// SlotNotifyPollInterval is how often cancelled office-hours slots are
+	// checked for students still to be emailed
+	SlotNotifyPollInterval time.Duration
+
+	// Activity log; entries are buffered and written in batches of
+	// ActivityBatchSize, at least every ActivityFlushInterval
+	ActivityBufferSize    int
+	ActivityBatchSize     int
+	ActivityFlushInterval time.Duration
+
+	// Storage holds institute logos, in a public bucket of their own; uploads
+	// fail while it is not configured
+	Storage storage.Config
+
+	// Dashboard stats and feature flag caches and access token deny list;
+	// all disabled when RedisAddr is empty
+	RedisAddr        string
+	RedisUsername    string
+	RedisPassword    string
+	RedisDB          int
+	StatsCacheTTL    time.Duration
+	FeatureCacheTTL  time.Duration
+	DenyListCacheTTL time.Duration
 }
 
 func Load() *Config {
 	return &Config{
 		Port:            getEnv("PORT", "8001"),
+		GRPCPort:        getEnv("GRPC_PORT", "9001"),
 		DatabaseURL:     getEnv("IDENTITY_DATABASE_URL", getEnv("DATABASE_URL", "")),
 		EmailServiceURL: getEnv("EMAIL_SERVICE_URL", "http://localhost:5005"),
 		InternalToken:   getEnv("INTERNAL_SECRET", "insecure-secret-for-dev"),
 		WebURL:          getEnv("WEB_URL", "http://localhost:3000"),
+		RunMigrations:   getEnv("RUN_MIGRATIONS", "auto"),
+
+		ReplicaDatabaseURL:   getEnv("IDENTITY_REPLICA_DATABASE_URL", ""),
+		ReplicaCheckInterval: getEnvDuration("REPLICA_CHECK_INTERVAL", 5*time.Second),
+
+		RabbitMQAPIURL:     getEnv("RABBITMQ_API_URL", ""),
+		RabbitMQVHost:      getEnv("RABBITMQ_VHOST", "/"),
+		OutboxPollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", 2*time.Second),
+		OutboxBatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 100),
+
+		SessionServiceURL:    getEnv("SESSION_SERVICE_URL", "http://localhost:8002"),
+		SubmissionServiceURL: getEnv("SUBMISSION_SERVICE_URL", "http://localhost:8006"),
+		AuthZServiceURL:      getEnv("AUTHZ_SERVICE_URL", "http://localhost:8004"),
+		AuthNJWKSURL:         getEnv("AUTHN_JWKS_URL", "http://localhost:8003/.well-known/jwks.json"),
+		ExportPollInterval:   getEnvDuration("EXPORT_POLL_INTERVAL", 5*time.Second),
+		ExportRetention:      getEnvDuration("EXPORT_RETENTION", 7*24*time.Hour),
+
+		AnnouncementPollInterval: getEnvDuration("ANNOUNCEMENT_POLL_INTERVAL", 30*time.Second),
+		SlotNotifyPollInterval:   getEnvDuration("SLOT_NOTIFY_POLL_INTERVAL", 30*time.Second),
+
+		ActivityBufferSize:    getEnvInt("ACTIVITY_BUFFER_SIZE", 1000),
+		ActivityBatchSize:     getEnvInt("ACTIVITY_BATCH_SIZE", 100),
+		ActivityFlushInterval: getEnvDuration("ACTIVITY_FLUSH_INTERVAL", time.Second),
+
+		Storage: brandingStorage(),
+
+		RedisAddr:        getEnv("REDIS_ADDR", ""),
+		RedisUsername:    getEnv("REDIS_USERNAME", "default"),
+		RedisPassword:    getEnv("REDIS_PASSWORD", ""),
+		RedisDB:          getEnvInt("REDIS_DB", 0),
+		StatsCacheTTL:    getEnvDuration("STATS_CACHE_TTL", 5*time.Minute),
+		FeatureCacheTTL:  getEnvDuration("FEATURE_CACHE_TTL", 10*time.Minute),
+		DenyListCacheTTL: getEnvDuration("TOKEN_DENYLIST_CACHE_TTL", 5*time.Second),
 	}
 }
 
+// brandingStorage is the Supabase project of SUPABASE_URL and
+// SUPABASE_SERVICE_KEY with the bucket BRANDING_STORAGE_BUCKET. It is not
+// SUPABASE_STORAGE_BUCKET, which holds submissions and must stay private.
+func brandingStorage() storage.Config {
+	cfg := storage.ConfigFromEnv()
+	cfg.Bucket = getEnv("BRANDING_STORAGE_BUCKET", "branding")
+	return cfg
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -37,4 +135,12 @@ func getEnvInt(key string, fallback int) int {
 		}
 	}
 	return fallback
-}
\ No newline at end of file
+}
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntakeSeason is the part of the year a cohort of students started in
+type IntakeSeason string
+
+const (
+	IntakeSpring IntakeSeason = "SPRING" // January to May
+	IntakeSummer IntakeSeason = "SUMMER" // June and July
+	IntakeFall   IntakeSeason = "FALL"   // August to December
+)
+
+// MinEnrollmentYear is the earliest enrollment year a student can have; the
+// latest is the year after the current one, for early registrations
+const MinEnrollmentYear = 1950
+
+// MaxEnrollmentYear is the latest enrollment year a student can have as of
+// now
+func MaxEnrollmentYear(now time.Time) int {
+	return now.Year() + 1
+}
+
+// SeasonOf returns the intake season of a student who started on day.
+// Migration 0020_student_cohorts applies the same months in SQL.
+func SeasonOf(day time.Time) IntakeSeason {
+	switch {
+	case day.Month() <= time.May:
+		return IntakeSpring
+	case day.Month() <= time.July:
+		return IntakeSummer
+	}
+	return IntakeFall
+}
+
+// Cohort is the students who started in the same season of a year
+type Cohort struct {
+	EnrollmentYear int
+	IntakeSeason   IntakeSeason
+}
+
+// Label is the CohortLabel of the cohort
+func (c Cohort) Label() string {
+	return CohortLabel(c.EnrollmentYear, c.IntakeSeason)
+}
+
+// CohortLabel names the cohort of the year and season, such as 2023-FALL. A
+// student with no enrollment year has no cohort; one with a year but no
+// season, the year alone.
+func CohortLabel(year int, season IntakeSeason) string {
+	if year == 0 {
+		return ""
+	}
+	if season == "" {
+		return strconv.Itoa(year)
+	}
+	return fmt.Sprintf("%d-%s", year, season)
+}
+
+// ParseCohort reads a label made by CohortLabel, in any case, and reports
+// whether it is one
+func ParseCohort(label string) (Cohort, bool) {
+	yearPart, seasonPart, hasSeason := strings.Cut(strings.ToUpper(strings.TrimSpace(label)), "-")
+	year, err := strconv.Atoi(yearPart)
+	if err != nil || year <= 0 {
+		return Cohort{}, false
+	}
+	season := IntakeSeason(seasonPart)
+	switch {
+	case !hasSeason:
+		return Cohort{EnrollmentYear: year}, true
+	case season == IntakeSpring, season == IntakeSummer, season == IntakeFall:
+		return Cohort{EnrollmentYear: year, IntakeSeason: season}, true
+	}
+	return Cohort{}, false
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +16,9 @@ const (
 	UserTypeInstructor     UserType = "INSTRUCTOR"
 	UserTypeInstituteAdmin UserType = "INSTITUTE_ADMIN"
 	UserTypeSystemAdmin    UserType = "SYSTEM_ADMIN"
+	// UserTypeGuardian is a parent or guardian, who sees the released grades
+	// and deadlines of the students linked to them and nothing else
+	UserTypeGuardian UserType = "GUARDIAN"
 )
 
 // User Entity
@@ -22,48 +26,87 @@ type User struct {
 	ID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
 	Email string    `gorm:"uniqueIndex;not null" json:"email"`
 	// Password related fields removed for passwordless auth
-	FullName      string         `gorm:"not null" json:"full_name"`
-	UserType      UserType       `gorm:"type:text;not null" json:"user_type"` // Explicit type for SQLite compatibility
-	IsActive      bool           `gorm:"default:true" json:"is_active"`       // Deprecated, use Status
-	Status        string         `gorm:"default:'pending'" json:"status"`     // pending, active, disabled
-	EmailVerified bool           `gorm:"default:false" json:"email_verified"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	FullName      string   `gorm:"not null" json:"name"`
+	UserType      UserType `gorm:"type:text;not null" json:"role"`  // Explicit type for SQLite compatibility
+	IsActive      bool     `gorm:"default:true" json:"is_active"`   // Deprecated, use Status
+	Status        string   `gorm:"default:'pending'" json:"status"` // pending, active, disabled
+	EmailVerified bool     `gorm:"default:false" json:"email_verified"`
+	// EmailVerifiedAt is when the user first proved they own Email, by
+	// confirming it or logging in with a magic link; null while unverified
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Version         int        `gorm:"not null;default:1" json:"version"` // Bumped on every update, for optimistic locking
+	LastLoginAt     *time.Time `json:"last_login_at"`                     // Set by AuthN; null if the user has never logged in
+	// PreferredLocale is the language the user is emailed in, e.g. fr-CA;
+	// null falls back to their institute's DefaultLocale
+	PreferredLocale *string `json:"preferred_locale"`
+	// ProfileMissing is set on students and instructors loaded without the
+	// profile row their type needs, which some legacy accounts lack
+	ProfileMissing bool           `gorm:"-" json:"profile_missing,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Associations - Pointers to allow nil (0 or 1 relationship)
-	StudentProfile        *StudentProfile        `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"student_profile,omitempty"`
-	InstructorProfile     *InstructorProfile     `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"instructor_profile,omitempty"`
-	InstituteAdminProfile *InstituteAdminProfile `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"institute_admin_profile,omitempty"`
+	StudentProfile    *StudentProfile    `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"student_profile,omitempty"`
+	InstructorProfile *InstructorProfile `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"instructor_profile,omitempty"`
+	// InstituteAdminProfiles are the institutes an admin manages, one binding each
+	InstituteAdminProfiles []InstituteAdminProfile `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"institutes,omitempty"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
 	}
+	if u.Version == 0 {
+		u.Version = 1
+	}
 	return
 }
 
 // -- Profiles --
 
 type StudentProfile struct {
-	UserID           uuid.UUID `gorm:"type:uuid;primaryKey"`
-	EnrollmentNumber string    `gorm:"uniqueIndex"`
-	EnrollmentYear   int
+	UserID           uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	InstituteID      *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_student_institute_enrollment;index:idx_student_cohort"`
+	EnrollmentNumber string     `gorm:"not null;uniqueIndex:idx_student_institute_enrollment"` // Unique per institute, not globally
+	EnrollmentYear   int        `gorm:"index:idx_student_cohort"`
+	// IntakeSeason is the part of EnrollmentYear the student started in,
+	// empty if it is not known
+	IntakeSeason IntakeSeason `gorm:"type:text;not null;default:'';index:idx_student_cohort"`
+	// Cohort is the CohortLabel of the two, set when the profile is loaded
+	Cohort string `gorm:"-"`
 
 	// Relationships
 	ClassEnrollments []ClassEnrollment `gorm:"foreignKey:StudentID"`
 }
 
+func (p *StudentProfile) AfterFind(tx *gorm.DB) (err error) {
+	p.Cohort = CohortLabel(p.EnrollmentYear, p.IntakeSeason)
+	return
+}
+
 type InstructorProfile struct {
 	UserID         uuid.UUID `gorm:"type:uuid;primaryKey"`
 	EmployeeID     string    `gorm:"uniqueIndex"`
 	Specialization string
 }
 
+// InstituteRole is an admin's role within one institute. Every institute
+// keeps at least one OWNER.
+type InstituteRole string
+
+const (
+	InstituteRoleOwner InstituteRole = "OWNER"
+	InstituteRoleAdmin InstituteRole = "ADMIN"
+)
+
+// InstituteAdminProfile binds an admin to one institute with a role there
 type InstituteAdminProfile struct {
-	UserID      uuid.UUID `gorm:"type:uuid;primaryKey"`
-	InstituteID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID     `gorm:"type:uuid;primaryKey" json:"-"`
+	InstituteID uuid.UUID     `gorm:"type:uuid;primaryKey" json:"institute_id"`
+	Role        InstituteRole `gorm:"type:text;not null;default:'ADMIN'" json:"role"`
+	// InstituteName is filled by queries that join institutes
+	InstituteName string `gorm:"->;-:migration" json:"institute_name"`
 }
 
 // -- Organizational Structure --
@@ -71,12 +114,35 @@ type InstituteAdminProfile struct {
 type Institute struct {
 	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
 	Name         string    `gorm:"not null" json:"name"`
-	Code         string    `gorm:"uniqueIndex;not null" json:"code"`
-	Domain       string    `gorm:"uniqueIndex;not null" json:"domain"`
+	Code         string    `gorm:"uniqueIndex:idx_institutes_code,where:deleted_at IS NULL;not null" json:"code"`
+	Domain       string    `gorm:"uniqueIndex:idx_institutes_domain,where:deleted_at IS NULL;not null" json:"domain"`
 	ContactEmail string    `gorm:"not null" json:"contact_email"`
 	IsActive     bool      `gorm:"default:true" json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	// AllowSelfRegistration lets students whose email domain is in
+	// AllowedEmailDomains sign themselves up; otherwise students are invited
+	AllowSelfRegistration bool `gorm:"not null;default:false" json:"allow_self_registration"`
+	// AllowedEmailDomains starts out as Domain. An entry "*.university.edu"
+	// admits every subdomain of university.edu but not university.edu itself.
+	AllowedEmailDomains []string `gorm:"type:text;serializer:json" json:"allowed_email_domains"`
+	// RequireVerifiedEmailForLogin stops members who have not verified their
+	// email from logging in with a magic link; they are sent a confirmation
+	// email instead
+	RequireVerifiedEmailForLogin bool `gorm:"not null;default:false" json:"require_verified_email_for_login"`
+	// DefaultClassID is the class self-registered students join once they
+	// confirm their email
+	DefaultClassID *uuid.UUID `gorm:"type:uuid" json:"default_class_id"`
+	// DefaultLocale is the language members without a preferred locale are
+	// emailed in
+	DefaultLocale string `gorm:"not null;default:'en'" json:"default_locale"`
+	// Timezone is the IANA time zone, e.g. Europe/Paris, the institute's
+	// members see dates and times in
+	Timezone  string    `gorm:"not null;default:'UTC'" json:"timezone"`
+	Version   int       `gorm:"not null;default:1" json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is set when the institute is deleted; its code and domain
+	// are free for reuse from then on
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Faculties []Faculty `gorm:"foreignKey:InstituteID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"faculties,omitempty"`
 }
@@ -85,15 +151,23 @@ func (i *Institute) BeforeCreate(tx *gorm.DB) (err error) {
 	if i.ID == uuid.Nil {
 		i.ID = uuid.New()
 	}
+	if i.Version == 0 {
+		i.Version = 1
+	}
 	return
 }
 
 type Faculty struct {
-	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	InstituteID uuid.UUID `gorm:"type:uuid;not null" json:"institute_id"`
-	Name        string    `gorm:"not null" json:"name"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	InstituteID uuid.UUID      `gorm:"type:uuid;not null" json:"institute_id"`
+	Name        string         `gorm:"not null" json:"name"`
+	HeadUserID  *uuid.UUID     `gorm:"type:uuid;index" json:"head_user_id"` // Dean of faculty
+	Version     int            `gorm:"not null;default:1" json:"version"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 
+	HeadUser    *User        `gorm:"foreignKey:HeadUserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	Head        *OrgUnitHead `gorm:"-" json:"head,omitempty"`
 	Departments []Department `gorm:"foreignKey:FacultyID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"departments,omitempty"`
 }
 
@@ -101,31 +175,58 @@ func (f *Faculty) BeforeCreate(tx *gorm.DB) (err error) {
 	if f.ID == uuid.Nil {
 		f.ID = uuid.New()
 	}
+	if f.Version == 0 {
+		f.Version = 1
+	}
 	return
 }
 
 type Department struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
-	FacultyID uuid.UUID `gorm:"type:uuid;not null" json:"faculty_id"`
-	Name      string    `gorm:"not null" json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	FacultyID  uuid.UUID      `gorm:"type:uuid;not null" json:"faculty_id"`
+	Name       string         `gorm:"not null" json:"name"`
+	HeadUserID *uuid.UUID     `gorm:"type:uuid;index" json:"head_user_id"` // Head of department
+	Version    int            `gorm:"not null;default:1" json:"version"`
+	CreatedAt  time.Time      `json:"created_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Classes []Class `gorm:"foreignKey:DepartmentID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"classes,omitempty"`
+	HeadUser *User        `gorm:"foreignKey:HeadUserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	Head     *OrgUnitHead `gorm:"-" json:"head,omitempty"`
+	Classes  []Class      `gorm:"foreignKey:DepartmentID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"classes,omitempty"`
 }
 
 func (d *Department) BeforeCreate(tx *gorm.DB) (err error) {
 	if d.ID == uuid.Nil {
 		d.ID = uuid.New()
 	}
+	if d.Version == 0 {
+		d.Version = 1
+	}
 	return
 }
 
+// OrgUnitHead is the resolved head (dean / head of department) of an org unit
+type OrgUnitHead struct {
+	ID       uuid.UUID `json:"id"`
+	FullName string    `json:"full_name"`
+	Email    string    `json:"email"`
+}
+
 type Class struct {
 	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
 	DepartmentID uuid.UUID `gorm:"type:uuid;not null" json:"department_id"`
 	Name         string    `gorm:"not null" json:"name"`
-	CreatedAt    time.Time `json:"created_at"`
+	// Capacity caps the number of enrolled students; nil means unlimited
+	Capacity *int `json:"capacity"`
+	// TermID is the term the class runs in; nil for classes created before
+	// terms existed, which are never closed to enrollment
+	TermID    *uuid.UUID     `gorm:"type:uuid;index" json:"term_id"`
+	Version   int            `gorm:"not null;default:1" json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
+	Term        *Term             `gorm:"foreignKey:TermID;constraint:OnUpdate:CASCADE;" json:"-"`
+	Sections    []ClassSection    `gorm:"foreignKey:ClassID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"sections,omitempty"`
 	Enrollments []ClassEnrollment `gorm:"foreignKey:ClassID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"enrollments,omitempty"`
 }
 
@@ -133,6 +234,70 @@ func (c *Class) BeforeCreate(tx *gorm.DB) (err error) {
 	if c.ID == uuid.Nil {
 		c.ID = uuid.New()
 	}
+	if c.Version == 0 {
+		c.Version = 1
+	}
+	return
+}
+
+// ClassSection is a part of a class with its own instructor and capacity,
+// e.g. lecture section A or a lab group. Every class has one default
+// section, which takes the enrollments that name no section, so a class
+// that is never split keeps all its students there.
+type ClassSection struct {
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ClassID uuid.UUID `gorm:"type:uuid;not null;index" json:"class_id"`
+	Name    string    `gorm:"not null" json:"name"`
+	// Capacity caps the students enrolled in the section; nil means only the
+	// class's capacity applies
+	Capacity *int `json:"capacity"`
+	// Schedule says when and where the section meets, as free text
+	Schedule     string     `gorm:"not null;default:''" json:"schedule"`
+	InstructorID *uuid.UUID `gorm:"type:uuid;index" json:"instructor_id"`
+	IsDefault    bool       `gorm:"not null;default:false" json:"is_default"`
+	Version      int        `gorm:"not null;default:1" json:"version"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	// Enrolled counts the section's students; it is filled in when a class
+	// is read
+	Enrolled int64 `gorm:"-" json:"enrolled"`
+
+	Instructor *User `gorm:"foreignKey:InstructorID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+}
+
+func (s *ClassSection) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	if s.Version == 0 {
+		s.Version = 1
+	}
+	return
+}
+
+// Term is an academic term of an institute. StartsOn and EndsOn are dates,
+// both inclusive; the terms of an institute never overlap. At most one term
+// per institute is marked IsCurrent.
+type Term struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	InstituteID uuid.UUID `gorm:"type:uuid;not null;index" json:"institute_id"`
+	Name        string    `gorm:"not null" json:"name"`
+	StartsOn    time.Time `gorm:"type:date;not null" json:"starts_on"`
+	EndsOn      time.Time `gorm:"type:date;not null" json:"ends_on"`
+	IsCurrent   bool      `gorm:"not null;default:false" json:"is_current"`
+	Version     int       `gorm:"not null;default:1" json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	Institute *Institute `gorm:"foreignKey:InstituteID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+func (t *Term) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	if t.Version == 0 {
+		t.Version = 1
+	}
 	return
 }
 
@@ -141,7 +306,484 @@ func (c *Class) BeforeCreate(tx *gorm.DB) (err error) {
 type ClassEnrollment struct {
 	StudentID  uuid.UUID `gorm:"type:uuid;primaryKey" json:"student_id"` // Composite PK part 1
 	ClassID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"class_id"`   // Composite PK part 2
+	SectionID  uuid.UUID `gorm:"type:uuid;not null;index" json:"section_id"`
 	EnrolledAt time.Time `json:"enrolled_at"`
+	// Status is enrolled for students holding a seat. A request a student
+	// makes is pending, with EnrolledAt the time of the request, until an
+	// instructor approves or rejects it; only enrolled students are on the
+	// roster or take a seat.
+	Status    EnrollmentStatus `gorm:"type:text;not null;default:'enrolled'" json:"status"`
+	DecidedBy *uuid.UUID       `gorm:"type:uuid" json:"decided_by,omitempty"`
+	DecidedAt *time.Time       `json:"decided_at,omitempty"`
+
+	Student *User         `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+	Section *ClassSection `gorm:"foreignKey:SectionID;constraint:OnUpdate:CASCADE;" json:"-"`
+}
 
-	Student *User `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+// EnrollmentStatus is whether a class enrollment holds a seat
+type EnrollmentStatus string
+
+const (
+	EnrollmentEnrolled EnrollmentStatus = "enrolled"
+	EnrollmentPending  EnrollmentStatus = "pending"
+	EnrollmentRejected EnrollmentStatus = "rejected"
+)
+
+// ClassWaitlistEntry holds a student's place in line for a full class or
+// section. Entries are promoted to enrollments in Position order as seats
+// free up in the class and in their section.
+type ClassWaitlistEntry struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ClassID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_waitlist_class_student;uniqueIndex:idx_waitlist_class_position" json:"class_id"`
+	StudentID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_waitlist_class_student" json:"student_id"`
+	// SectionID is the section the student is waiting for a seat in
+	SectionID uuid.UUID `gorm:"type:uuid;not null;index" json:"section_id"`
+	Position  int       `gorm:"not null;uniqueIndex:idx_waitlist_class_position" json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Class   *Class        `gorm:"foreignKey:ClassID;constraint:OnDelete:CASCADE;" json:"-"`
+	Section *ClassSection `gorm:"foreignKey:SectionID;constraint:OnDelete:CASCADE;" json:"-"`
+	Student *User         `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+}
+
+func (w *ClassWaitlistEntry) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return
+}
+
+// -- Announcements --
+
+// AnnouncementScope is the kind of org unit an announcement is addressed to
+type AnnouncementScope string
+
+const (
+	AnnouncementScopeInstitute  AnnouncementScope = "institute"
+	AnnouncementScopeFaculty    AnnouncementScope = "faculty"
+	AnnouncementScopeDepartment AnnouncementScope = "department"
+	AnnouncementScopeClass      AnnouncementScope = "class"
+)
+
+func (s AnnouncementScope) Valid() bool {
+	switch s {
+	case AnnouncementScopeInstitute, AnnouncementScopeFaculty, AnnouncementScopeDepartment, AnnouncementScopeClass:
+		return true
+	}
+	return false
+}
+
+// Announcement is a message to everyone in an org unit and the units below
+// it. It is shown from PublishAt until ExpiresAt, or indefinitely when that
+// is nil. With Notify set, the unit's members are also emailed once it is
+// published; NotifiedAt records when that happened.
+type Announcement struct {
+	ID           uuid.UUID         `gorm:"type:uuid;primaryKey" json:"id"`
+	Scope        AnnouncementScope `gorm:"type:text;not null;index:idx_announcements_scope,priority:1" json:"scope"`
+	ScopeID      uuid.UUID         `gorm:"type:uuid;not null;index:idx_announcements_scope,priority:2" json:"scope_id"`
+	Title        string            `gorm:"not null" json:"title"`
+	Body         string            `gorm:"not null" json:"body"`
+	AuthorUserID uuid.UUID         `gorm:"type:uuid;not null;index" json:"author_user_id"`
+	PublishAt    time.Time         `gorm:"not null;index" json:"publish_at"`
+	ExpiresAt    *time.Time        `json:"expires_at"`
+	Notify       bool              `gorm:"not null;default:false" json:"notify"`
+	NotifiedAt   *time.Time        `json:"notified_at,omitempty"`
+	Version      int               `gorm:"not null;default:1" json:"version"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+func (a *Announcement) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	if a.Version == 0 {
+		a.Version = 1
+	}
+	return
+}
+
+// ActiveAt reports whether the announcement is shown at t
+func (a *Announcement) ActiveAt(t time.Time) bool {
+	return !a.PublishAt.After(t) && (a.ExpiresAt == nil || a.ExpiresAt.After(t))
+}
+
+// -- Audit --
+
+// UserMerge records a duplicate account being folded into a primary one.
+// Summary is a JSON object counting the rows moved or dropped per table.
+type UserMerge struct {
+	ID              uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	PrimaryUserID   uuid.UUID `gorm:"type:uuid;not null;index" json:"primary_user_id"`
+	DuplicateUserID uuid.UUID `gorm:"type:uuid;not null;index" json:"duplicate_user_id"`
+	DuplicateEmail  string    `gorm:"not null" json:"duplicate_email"`
+	Summary         string    `gorm:"type:jsonb;not null" json:"summary"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (m *UserMerge) BeforeCreate(tx *gorm.DB) (err error) {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return
+}
+
+// -- Login History --
+
+// LoginEvent is one successful login reported by AuthN. Only the latest
+// repository.MaxLoginEvents are kept per user.
+type LoginEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index:idx_login_events_user_time,priority:1" json:"user_id"`
+	LoggedInAt time.Time `gorm:"not null;index:idx_login_events_user_time,priority:2" json:"logged_in_at"`
+	ClientIP   string    `json:"client_ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// -- Outbox --
+
+// OutboxEvent is a domain event written in the same transaction as the change
+// it describes and published to the message broker by a background relay
+type OutboxEvent struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Seq         int64      `gorm:"autoIncrement;uniqueIndex" json:"seq"` // Publish order
+	EventType   string     `gorm:"not null" json:"event_type"`
+	EntityID    string     `gorm:"not null" json:"entity_id"`
+	Payload     string     `gorm:"type:jsonb;not null" json:"payload"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PublishedAt *time.Time `gorm:"index" json:"published_at,omitempty"`
+	Attempts    int        `gorm:"default:0" json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+func (e *OutboxEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
+
+// -- Data Export --
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportDone    ExportStatus = "done"
+	ExportFailed  ExportStatus = "failed"
+)
+
+// ExportJob is a request to export everything held about a user. A background
+// worker builds Document; it is only served once Status is done.
+type ExportJob struct {
+	ID          uuid.UUID    `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID    `gorm:"type:uuid;not null;index" json:"user_id"`
+	RequestedBy string       `gorm:"not null" json:"requested_by"` // sub of the caller's access token
+	Status      ExportStatus `gorm:"type:text;not null;default:'pending';index" json:"status"`
+	Error       string       `json:"error,omitempty"`
+	Document    string       `gorm:"type:jsonb" json:"-"`
+	CreatedAt   time.Time    `json:"created_at"`
+	StartedAt   *time.Time   `json:"started_at,omitempty"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+}
+
+func (j *ExportJob) BeforeCreate(tx *gorm.DB) (err error) {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return
+}
+
+// -- Deletions --
+
+// DeletionTombstone records the deletion of an institute, faculty or
+// department: who asked for it and how much was deleted with it. The unit
+// and everything below it are soft deleted, so the counts say what a restore
+// would bring back.
+type DeletionTombstone struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Unit        string    `gorm:"type:text;not null;index:idx_deletion_tombstones_unit,priority:1" json:"unit"` // institute, faculty or department
+	UnitID      uuid.UUID `gorm:"type:uuid;not null;index:idx_deletion_tombstones_unit,priority:2" json:"unit_id"`
+	UnitName    string    `gorm:"not null" json:"unit_name"`
+	RequestedBy string    `gorm:"not null" json:"requested_by"` // sub of the caller's access token
+	Cascaded    bool      `gorm:"not null;default:false" json:"cascaded"`
+	Faculties   int64     `gorm:"not null;default:0" json:"faculties"`
+	Departments int64     `gorm:"not null;default:0" json:"departments"`
+	Classes     int64     `gorm:"not null;default:0" json:"classes"`
+	Enrollments int64     `gorm:"not null;default:0" json:"enrollments"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (t *DeletionTombstone) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return
+}
+
+// -- Feature flags --
+
+// FeatureFlag is a feature that can be switched on for some institutes only,
+// e.g. while it is piloted. Institutes without an override get DefaultOn.
+type FeatureFlag struct {
+	Key         string    `gorm:"primaryKey" json:"key"`
+	Description string    `gorm:"not null;default:''" json:"description"`
+	DefaultOn   bool      `gorm:"not null;default:false" json:"default_on"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Overrides []InstituteFeatureOverride `gorm:"foreignKey:Key;references:Key;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// InstituteFeatureOverride switches a feature flag on or off for one
+// institute, whatever the flag's default
+type InstituteFeatureOverride struct {
+	InstituteID uuid.UUID `gorm:"type:uuid;primaryKey" json:"institute_id"`
+	Key         string    `gorm:"primaryKey;index" json:"key"`
+	Enabled     bool      `gorm:"not null" json:"enabled"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Institute *Institute `gorm:"foreignKey:InstituteID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// -- Office hours --
+
+// AvailabilitySlot is a window in which an instructor holds office hours,
+// for the students of one class or, with ClassID nil, for any student. Times
+// are stored in UTC and read back in Timezone, an IANA zone name. Slots of
+// the same instructor never overlap. A cancelled slot is kept so its
+// bookings can be emailed; NotifiedAt records when that happened.
+type AvailabilitySlot struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	InstructorID uuid.UUID  `gorm:"type:uuid;not null;index:idx_availability_slots_instructor,priority:1" json:"instructor_id"`
+	ClassID      *uuid.UUID `gorm:"type:uuid;index" json:"class_id"`
+	StartsAt     time.Time  `gorm:"not null;index:idx_availability_slots_instructor,priority:2" json:"starts_at"`
+	EndsAt       time.Time  `gorm:"not null" json:"ends_at"`
+	Timezone     string     `gorm:"not null;default:'UTC'" json:"timezone"`
+	Capacity     int        `gorm:"not null" json:"capacity"`
+	Location     string     `gorm:"not null;default:''" json:"location"` // a room or a meeting link
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	NotifiedAt   *time.Time `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// SeatsTaken is filled in by the repository when the slot is read
+	SeatsTaken int64 `gorm:"-" json:"seats_taken"`
+
+	Instructor *User         `gorm:"foreignKey:InstructorID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Class      *Class        `gorm:"foreignKey:ClassID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	Bookings   []SlotBooking `gorm:"foreignKey:SlotID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+func (s *AvailabilitySlot) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return
+}
+
+func (s *AvailabilitySlot) AfterFind(tx *gorm.DB) (err error) {
+	s.Localize()
+	return
+}
+
+// Localize expresses the slot's times in its timezone, or leaves them as
+// they are if the zone is unknown
+func (s *AvailabilitySlot) Localize() {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return
+	}
+	s.StartsAt = s.StartsAt.In(loc)
+	s.EndsAt = s.EndsAt.In(loc)
+	if s.CancelledAt != nil {
+		cancelledAt := s.CancelledAt.In(loc)
+		s.CancelledAt = &cancelledAt
+	}
+}
+
+// Cancelled reports whether the instructor called the slot off
+func (s *AvailabilitySlot) Cancelled() bool {
+	return s.CancelledAt != nil
+}
+
+// SlotBooking is a student's seat in an availability slot
+type SlotBooking struct {
+	SlotID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"slot_id"`
+	StudentID uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"student_id"`
+	BookedAt  time.Time `gorm:"not null" json:"booked_at"`
+
+	Student *User `gorm:"foreignKey:StudentID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"student,omitempty"`
+}
+
+// -- Policy documents --
+
+// PolicyType is the kind of legal document users accept
+type PolicyType string
+
+const (
+	PolicyTypeTOS     PolicyType = "tos"
+	PolicyTypePrivacy PolicyType = "privacy"
+)
+
+func (t PolicyType) Valid() bool {
+	switch t {
+	case PolicyTypeTOS, PolicyTypePrivacy:
+		return true
+	}
+	return false
+}
+
+// PolicyDocument is one version of a policy users must accept, with its text
+// in Body or behind URL. Of each type, the version with the latest
+// EffectiveAt that has passed is current; publishing a new version makes
+// every user accept again once it takes effect. Documents in effect are not
+// changed, so acceptances keep pointing at what was accepted.
+type PolicyDocument struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Type        PolicyType `gorm:"not null;uniqueIndex:idx_policy_documents_type_version,priority:1;index:idx_policy_documents_type_effective,priority:1" json:"type"`
+	Version     string     `gorm:"not null;uniqueIndex:idx_policy_documents_type_version,priority:2" json:"version"`
+	Body        string     `gorm:"not null;default:''" json:"body,omitempty"`
+	URL         string     `gorm:"not null;default:''" json:"url,omitempty"`
+	EffectiveAt time.Time  `gorm:"not null;index:idx_policy_documents_type_effective,priority:2" json:"effective_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (d *PolicyDocument) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return
+}
+
+// InEffect reports whether the document had taken effect at t
+func (d *PolicyDocument) InEffect(t time.Time) bool {
+	return !d.EffectiveAt.After(t)
+}
+
+// UserPolicyAcceptance records a user accepting one policy document, from
+// ClientIP. It is kept after newer versions are published.
+type UserPolicyAcceptance struct {
+	UserID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	DocumentID uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"document_id"`
+	AcceptedAt time.Time `gorm:"not null" json:"accepted_at"`
+	ClientIP   string    `gorm:"not null;default:''" json:"client_ip"`
+
+	User     *User           `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Document *PolicyDocument `gorm:"foreignKey:DocumentID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// -- Activity Log --
+
+// ActivityEntry records an admin changing identity data: who did it, what
+// they did to which entity, and the fields that changed. Changes maps each
+// field to {"from": ..., "to": ...}, from being null on a create and to on a
+// delete.
+type ActivityEntry struct {
+	ID             uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ActorID        string    `gorm:"not null;default:'';index:idx_activity_entries_actor,priority:1" json:"actor_id"` // Empty for changes made by the system
+	ImpersonatorID string    `gorm:"not null;default:''" json:"impersonator_id,omitempty"`
+	Action         string    `gorm:"not null" json:"action"` // e.g. user.update
+	EntityType     string    `gorm:"not null;index:idx_activity_entries_entity,priority:1" json:"entity_type"`
+	EntityID       string    `gorm:"not null;index:idx_activity_entries_entity,priority:2" json:"entity_id"`
+	Changes        string    `gorm:"type:jsonb;not null" json:"-"`
+	CreatedAt      time.Time `gorm:"index:idx_activity_entries_actor,priority:2;index" json:"created_at"`
+}
+
+func (e *ActivityEntry) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return
+}
+
+// MarshalJSON writes Changes as an object rather than a string
+func (e ActivityEntry) MarshalJSON() ([]byte, error) {
+	type entry ActivityEntry
+	return json.Marshal(struct {
+		entry
+		Changes json.RawMessage `json:"changes"`
+	}{entry(e), json.RawMessage(e.Changes)})
+}
+
+// -- Two-Factor Authentication --
+
+// UserTwoFactor is a user's TOTP enrollment. AuthN encrypts Secret before
+// handing it over, so identity never holds it in the clear. Logins only ask
+// for a code once the enrollment is confirmed and EnabledAt is set.
+type UserTwoFactor struct {
+	UserID    uuid.UUID  `gorm:"type:uuid;primaryKey" json:"user_id"`
+	Secret    string     `gorm:"not null" json:"secret"`
+	EnabledAt *time.Time `json:"enabled_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	User *User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// UserRecoveryCode is the hash of one of a user's single-use recovery codes,
+// which stand in for a TOTP code when the user has lost their device
+type UserRecoveryCode struct {
+	UserID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	CodeHash string    `gorm:"primaryKey" json:"-"`
+
+	User *User `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// -- Branding --
+
+// InstituteBranding is how an institute's pages and emails look. LogoKey is
+// the storage object key of the logo, empty when there is none; it is served
+// as a URL instead. EmailFooterHTML is sanitized before it is stored.
+type InstituteBranding struct {
+	InstituteID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"institute_id"`
+	LogoKey         string    `gorm:"not null;default:''" json:"-"`
+	PrimaryColor    string    `gorm:"not null;default:''" json:"primary_color"`
+	SecondaryColor  string    `gorm:"not null;default:''" json:"secondary_color"`
+	EmailFooterHTML string    `gorm:"type:text;not null;default:''" json:"email_footer_html"`
+	SupportEmail    string    `gorm:"not null;default:''" json:"support_email"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	Institute *Institute `gorm:"foreignKey:InstituteID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// -- Guardians --
+
+// GuardianLinkStatus is where a guardian link is in its lifecycle
+type GuardianLinkStatus string
+
+const (
+	// GuardianLinkInvited links wait for the guardian to confirm their email
+	GuardianLinkInvited GuardianLinkStatus = "invited"
+	GuardianLinkActive  GuardianLinkStatus = "active"
+	// GuardianLinkRevoked links are kept for the record and grant nothing
+	GuardianLinkRevoked GuardianLinkStatus = "revoked"
+)
+
+// GuardianLink lets a guardian see a student's released grades and
+// deadlines while it is active. An institute admin creates it; the student
+// or an admin can revoke it. A revoked link is not reused: linking the two
+// again creates a new one.
+type GuardianLink struct {
+	ID             uuid.UUID          `gorm:"type:uuid;primaryKey" json:"id"`
+	GuardianUserID uuid.UUID          `gorm:"type:uuid;not null;index" json:"guardian_user_id"`
+	StudentUserID  uuid.UUID          `gorm:"type:uuid;not null;index" json:"student_user_id"`
+	Status         GuardianLinkStatus `gorm:"type:text;not null" json:"status"`
+	CreatedBy      uuid.UUID          `gorm:"type:uuid;not null" json:"created_by"`
+	RevokedBy      *uuid.UUID         `gorm:"type:uuid" json:"revoked_by,omitempty"`
+	RevokedAt      *time.Time         `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+
+	Guardian *User `gorm:"foreignKey:GuardianUserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"guardian,omitempty"`
+	Student  *User `gorm:"foreignKey:StudentUserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"student,omitempty"`
+}
+
+func (l *GuardianLink) BeforeCreate(tx *gorm.DB) (err error) {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return
 }
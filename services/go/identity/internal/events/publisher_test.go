@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeManagementAPI answers exchange declarations and publishes like the
+// RabbitMQ management API, reporting routed for each publish
+func fakeManagementAPI(t *testing.T, routed bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.EscapedPath() == "/api/exchanges/%2F/identity.events":
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPost && r.URL.EscapedPath() == "/api/exchanges/%2F/identity.events/publish":
+			var msg struct {
+				RoutingKey string `json:"routing_key"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.RoutingKey == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]bool{"routed": routed})
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.EscapedPath())
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPublishRouted(t *testing.T) {
+	srv := fakeManagementAPI(t, true)
+	p := NewRabbitMQPublisher(srv.URL, "/")
+	if err := p.Publish(context.Background(), "identity.events", "user.created", "1", []byte(`{}`)); err != nil {
+		t.Fatalf("Publish = %v, want nil", err)
+	}
+}
+
+func TestPublishUnroutedFails(t *testing.T) {
+	srv := fakeManagementAPI(t, false)
+	p := NewRabbitMQPublisher(srv.URL, "/")
+	err := p.Publish(context.Background(), "identity.events", "user.created", "1", []byte(`{}`))
+	if !errors.Is(err, ErrUnrouted) {
+		t.Fatalf("Publish with no bound queue = %v, want ErrUnrouted", err)
+	}
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/pkg/events"
+)
+
+// Relay moves events from the outbox table to the message broker. Events
+// stay in the outbox while the broker is down and go out once it is back.
+type Relay struct {
+	repo      *repository.Repository
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRelay(repo *repository.Repository, publisher Publisher, interval time.Duration, batchSize int) *Relay {
+	return &Relay{
+		repo:      repo,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		// Drain full batches straight away, then wait for the next tick
+		for {
+			n, err := r.repo.RelayOutbox(r.batchSize, func(e core.OutboxEvent) error {
+				if err := r.publish(ctx, e); err != nil {
+					log.Printf("Failed to publish event %s (%s): %v", e.ID, e.EventType, err)
+					return err
+				}
+				return nil
+			})
+			if err != nil {
+				log.Printf("Outbox relay failed: %v", err)
+			}
+			if err != nil || n < r.batchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, e core.OutboxEvent) error {
+	body, err := json.Marshal(events.Envelope{
+		ID:         e.ID.String(),
+		Type:       e.EventType,
+		EntityID:   e.EntityID,
+		OccurredAt: e.CreatedAt,
+		Payload:    json.RawMessage(e.Payload),
+	})
+	if err != nil {
+		return err
+	}
+	return r.publisher.Publish(ctx, events.Exchange, e.EventType, e.ID.String(), body)
+}
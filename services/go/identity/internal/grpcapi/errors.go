@@ -0,0 +1,70 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// statusError maps identity errors to gRPC status codes as the HTTP API's
+// apiError maps them to statuses. A call whose deadline passed or which the
+// caller cancelled reports that rather than what it was interrupted by.
+func statusError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	var verr *service.ValidationError
+	if errors.As(err, &verr) {
+		if verr.Conflict {
+			return status.Error(codes.AlreadyExists, verr.Error())
+		}
+		return status.Error(codes.InvalidArgument, verr.Error())
+	}
+	var conflict *service.VersionConflictError
+	if errors.As(err, &conflict) {
+		return status.Errorf(codes.Aborted, "user was modified by another request; current version is %d", conflict.CurrentVersion)
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, repository.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, repository.ErrInstituteNotFound):
+		return status.Error(codes.NotFound, "institute not found")
+	case errors.Is(err, repository.ErrEmailTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrUserAlreadyInactive), errors.Is(err, service.ErrUserNotDeactivated):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrSessionsNotRevoked):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	log.Printf("gRPC identity call failed: %v", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// Metadata keys of the user a calling service acts for, the gRPC
+// counterparts of the X-User-Id and X-Impersonator-Id headers
+const (
+	userIDKey       = "x-user-id"
+	impersonatorKey = "x-impersonator-id"
+)
+
+// actorFrom is who changes made by the call are recorded in the activity log
+// as. The internal token has been checked by then, so the metadata is
+// trusted as the headers are on /internal/identity.
+func actorFrom(ctx context.Context) service.Actor {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	return service.Actor{UserID: first(userIDKey), ImpersonatorID: first(impersonatorKey)}
+}
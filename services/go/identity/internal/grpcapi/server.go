@@ -0,0 +1,222 @@
+// Package grpcapi serves the identity service's gRPC API. It calls the same
+// service.IdentityService as the /internal/identity HTTP endpoints, so a
+// user changed over either looks the same.
+package grpcapi
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	identityv1 "github.com/4yrg/gradeloop-core/libs/rpc/identity/v1"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// exportedUsersKey is the trailer key of how many records ExportUsers sent
+const exportedUsersKey = "x-exported-users"
+
+type Server struct {
+	identityv1.UnimplementedUserServiceServer
+	svc *service.IdentityService
+}
+
+func NewServer(svc *service.IdentityService) *Server {
+	return &Server{svc: svc}
+}
+
+// UpdateProfile applies the fields in the update mask. A change of is_active
+// is made after the other fields, as DeactivateUser or ReactivateUser.
+func (s *Server) UpdateProfile(ctx context.Context, req *identityv1.UpdateProfileRequest) (*identityv1.UpdateProfileResponse, error) {
+	id, err := parseUserID(req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "update_mask must name at least one field")
+	}
+
+	values := req.GetUser()
+	var update service.UserUpdate
+	var activate *bool
+	for _, path := range paths {
+		switch path {
+		case "full_name":
+			update.FullName = ptr(values.GetFullName())
+		case "preferred_locale":
+			update.PreferredLocale = ptr(values.GetPreferredLocale())
+		case "is_active":
+			activate = ptr(values.GetIsActive())
+		case "student_profile.enrollment_number":
+			update.EnrollmentNumber = ptr(values.GetStudentProfile().GetEnrollmentNumber())
+		case "student_profile.enrollment_year":
+			update.EnrollmentYear = ptr(int(values.GetStudentProfile().GetEnrollmentYear()))
+		case "instructor_profile.employee_id":
+			update.EmployeeID = ptr(values.GetInstructorProfile().GetEmployeeId())
+		case "instructor_profile.specialization":
+			update.Specialization = ptr(values.GetInstructorProfile().GetSpecialization())
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "update_mask path %q cannot be updated", path)
+		}
+	}
+	var expectedVersion *int
+	if v := req.GetExpectedVersion(); v != 0 {
+		expectedVersion = ptr(int(v))
+	}
+
+	svc := s.svc.As(actorFrom(ctx))
+	var user *core.User
+	if hasFieldUpdate(update) {
+		if user, err = svc.UpdateUser(id, update, expectedVersion); err != nil {
+			return nil, statusError(ctx, err)
+		}
+		expectedVersion = nil
+	} else if user, err = svc.GetUser(id); err != nil {
+		return nil, statusError(ctx, err)
+	}
+	if expectedVersion != nil && *expectedVersion != user.Version {
+		return nil, statusError(ctx, &service.VersionConflictError{CurrentVersion: user.Version})
+	}
+
+	if activate != nil && *activate != (user.Status != "disabled") {
+		if *activate {
+			user, err = svc.ReactivateUser(id)
+		} else {
+			user, err = svc.DeactivateUser(ctx, id)
+		}
+		if err != nil {
+			return nil, statusError(ctx, err)
+		}
+	}
+
+	return &identityv1.UpdateProfileResponse{User: toProto(user)}, nil
+}
+
+func (s *Server) DeactivateUser(ctx context.Context, req *identityv1.DeactivateUserRequest) (*identityv1.DeactivateUserResponse, error) {
+	id, err := parseUserID(req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.svc.As(actorFrom(ctx)).DeactivateUser(ctx, id)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return &identityv1.DeactivateUserResponse{User: toProto(user)}, nil
+}
+
+func (s *Server) ReactivateUser(ctx context.Context, req *identityv1.ReactivateUserRequest) (*identityv1.ReactivateUserResponse, error) {
+	id, err := parseUserID(req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.svc.As(actorFrom(ctx)).ReactivateUser(id)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return &identityv1.ReactivateUserResponse{User: toProto(user)}, nil
+}
+
+// ExportUsers streams the institute's users a batch read at a time. The
+// count of records sent goes in the trailer even when the stream fails or
+// the caller cancels it, so a sync knows how far it got.
+func (s *Server) ExportUsers(req *identityv1.ExportUsersRequest, stream grpc.ServerStreamingServer[identityv1.UserRecord]) error {
+	ctx := stream.Context()
+	if _, err := uuid.Parse(req.GetInstituteId()); err != nil {
+		return status.Error(codes.InvalidArgument, "institute_id must be a valid UUID")
+	}
+	var modifiedSince *time.Time
+	if req.ModifiedSince != nil {
+		modifiedSince = ptr(req.GetModifiedSince().AsTime())
+	}
+
+	sent, err := s.svc.ExportInstituteUsers(ctx, req.GetInstituteId(), req.GetUserType(), modifiedSince, func(u *repository.ExportedUser) error {
+		return stream.Send(toRecord(u))
+	})
+	stream.SetTrailer(metadata.Pairs(exportedUsersKey, strconv.Itoa(sent)))
+	if err != nil {
+		return statusError(ctx, err)
+	}
+	return nil
+}
+
+func parseUserID(raw string) (string, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, "user_id must be a valid UUID")
+	}
+	return id.String(), nil
+}
+
+func hasFieldUpdate(u service.UserUpdate) bool {
+	return u != service.UserUpdate{}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// toProto is the gRPC form of the user the HTTP API returns
+func toProto(user *core.User) *identityv1.User {
+	pb := &identityv1.User{
+		Id:            user.ID.String(),
+		Email:         user.Email,
+		FullName:      user.FullName,
+		UserType:      string(user.UserType),
+		Status:        user.Status,
+		IsActive:      user.Status != "disabled",
+		EmailVerified: user.EmailVerified,
+		Version:       int32(user.Version),
+	}
+	if user.PreferredLocale != nil {
+		pb.PreferredLocale = *user.PreferredLocale
+	}
+	if p := user.StudentProfile; p != nil {
+		pb.StudentProfile = &identityv1.StudentProfile{
+			EnrollmentNumber: p.EnrollmentNumber,
+			EnrollmentYear:   int32(p.EnrollmentYear),
+		}
+		if p.InstituteID != nil {
+			pb.StudentProfile.InstituteId = p.InstituteID.String()
+		}
+	}
+	if p := user.InstructorProfile; p != nil {
+		pb.InstructorProfile = &identityv1.InstructorProfile{
+			EmployeeId:     p.EmployeeID,
+			Specialization: p.Specialization,
+		}
+	}
+	return pb
+}
+
+// toRecord is the export record of a user of the exported institute
+func toRecord(u *repository.ExportedUser) *identityv1.UserRecord {
+	record := &identityv1.UserRecord{
+		User:          toProto(&u.User),
+		CreatedAt:     timestamppb.New(u.CreatedAt),
+		UpdatedAt:     timestamppb.New(u.UpdatedAt),
+		Enrollments:   make([]*identityv1.EnrollmentSummary, len(u.Enrollments)),
+		InstituteRole: string(u.InstituteRole),
+	}
+	for i, e := range u.Enrollments {
+		record.Enrollments[i] = &identityv1.EnrollmentSummary{
+			ClassId:    e.ClassID.String(),
+			ClassName:  e.ClassName,
+			SectionId:  e.SectionID.String(),
+			Status:     string(e.Status),
+			EnrolledAt: timestamppb.New(e.EnrolledAt),
+		}
+	}
+	return record
+}
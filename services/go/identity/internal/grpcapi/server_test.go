@@ -0,0 +1,179 @@
+package grpcapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	identityv1 "github.com/4yrg/gradeloop-core/libs/rpc/identity/v1"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestServer returns a Server over an in-memory database whose session
+// service answers revocations with sessionStatus, counting them in revoked
+func newTestServer(t *testing.T, sessionStatus int) (*Server, *gorm.DB, *atomic.Int32) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.User{}, &core.StudentProfile{}, &core.InstructorProfile{}, &core.Institute{}, &core.Faculty{}, &core.Department{}, &core.ActivityEntry{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var revoked atomic.Int32
+	sessions := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		revoked.Add(1)
+		w.WriteHeader(sessionStatus)
+	}))
+	t.Cleanup(sessions.Close)
+
+	svc := service.NewIdentityService(repository.NewRepository(db), &config.Config{InternalToken: "test", SessionServiceURL: sessions.URL})
+	return NewServer(svc), db, &revoked
+}
+
+func createStudent(t *testing.T, db *gorm.DB) *core.User {
+	t.Helper()
+	id := uuid.New()
+	user := &core.User{
+		ID:             id,
+		Email:          id.String() + "@example.com",
+		FullName:       "Ada Lovelace",
+		UserType:       core.UserTypeStudent,
+		Status:         "active",
+		IsActive:       true,
+		EmailVerified:  true,
+		StudentProfile: &core.StudentProfile{UserID: id, EnrollmentNumber: "S-1", EnrollmentYear: 2024},
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestUpdateProfileAppliesOnlyMaskedFields(t *testing.T) {
+	srv, db, _ := newTestServer(t, http.StatusNoContent)
+	student := createStudent(t, db)
+	ctx := context.Background()
+
+	// Only the year is in the mask; the other values sent are ignored
+	resp, err := srv.UpdateProfile(ctx, &identityv1.UpdateProfileRequest{
+		UserId: student.ID.String(),
+		User: &identityv1.User{
+			FullName:       "Ignored",
+			StudentProfile: &identityv1.StudentProfile{EnrollmentNumber: "IGNORED", EnrollmentYear: 2025},
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"student_profile.enrollment_year"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := resp.GetUser()
+	if got.GetFullName() != "Ada Lovelace" || got.GetStudentProfile().GetEnrollmentNumber() != "S-1" || got.GetStudentProfile().GetEnrollmentYear() != 2025 {
+		t.Errorf("after updating the year: %+v", got)
+	}
+
+	resp, err = srv.UpdateProfile(ctx, &identityv1.UpdateProfileRequest{
+		UserId:     student.ID.String(),
+		User:       &identityv1.User{FullName: "Ada King"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"full_name"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.GetUser(); got.GetFullName() != "Ada King" || got.GetStudentProfile().GetEnrollmentYear() != 2025 {
+		t.Errorf("after updating the name: %+v", got)
+	}
+}
+
+func TestErrorsMapToStatusCodes(t *testing.T) {
+	srv, db, revoked := newTestServer(t, http.StatusNoContent)
+	student := createStudent(t, db)
+	ctx := context.Background()
+	update := func(paths []string, user *identityv1.User, version int32) error {
+		_, err := srv.UpdateProfile(ctx, &identityv1.UpdateProfileRequest{
+			UserId:          student.ID.String(),
+			User:            user,
+			UpdateMask:      &fieldmaskpb.FieldMask{Paths: paths},
+			ExpectedVersion: version,
+		})
+		return err
+	}
+
+	for name, tc := range map[string]struct {
+		err  error
+		want codes.Code
+	}{
+		"empty mask":             {update(nil, nil, 0), codes.InvalidArgument},
+		"unknown path":           {update([]string{"email"}, nil, 0), codes.InvalidArgument},
+		"another type's profile": {update([]string{"instructor_profile.employee_id"}, &identityv1.User{InstructorProfile: &identityv1.InstructorProfile{EmployeeId: "E-1"}}, 0), codes.InvalidArgument},
+		"stale version":          {update([]string{"full_name"}, &identityv1.User{FullName: "Ada"}, 99), codes.Aborted},
+		"bad user ID": {func() error {
+			_, err := srv.DeactivateUser(ctx, &identityv1.DeactivateUserRequest{UserId: "nope"})
+			return err
+		}(), codes.InvalidArgument},
+		"unknown user": {func() error {
+			_, err := srv.DeactivateUser(ctx, &identityv1.DeactivateUserRequest{UserId: uuid.NewString()})
+			return err
+		}(), codes.NotFound},
+		"reactivating an active user": {func() error {
+			_, err := srv.ReactivateUser(ctx, &identityv1.ReactivateUserRequest{UserId: student.ID.String()})
+			return err
+		}(), codes.FailedPrecondition},
+	} {
+		if got := status.Code(tc.err); got != tc.want {
+			t.Errorf("%s: got %v (%v), want %v", name, got, tc.err, tc.want)
+		}
+	}
+
+	// Deactivating through the mask logs the user out; again is a
+	// precondition failure
+	if err := update([]string{"is_active"}, &identityv1.User{IsActive: false}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if revoked.Load() != 1 {
+		t.Errorf("sessions revoked %d times, want once", revoked.Load())
+	}
+	_, err := srv.DeactivateUser(ctx, &identityv1.DeactivateUserRequest{UserId: student.ID.String()})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("deactivating twice: got %v, want FailedPrecondition", err)
+	}
+}
+
+func TestDeactivateIsUnavailableWithoutSessionService(t *testing.T) {
+	srv, db, revoked := newTestServer(t, http.StatusInternalServerError)
+	student := createStudent(t, db)
+
+	_, err := srv.DeactivateUser(context.Background(), &identityv1.DeactivateUserRequest{UserId: student.ID.String()})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("got %v, want Unavailable", err)
+	}
+	if revoked.Load() == 0 {
+		t.Error("session service was not asked to revoke")
+	}
+	var user core.User
+	if err := db.First(&user, "id = ?", student.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Status != "active" {
+		t.Errorf("user left %s, want active", user.Status)
+	}
+}
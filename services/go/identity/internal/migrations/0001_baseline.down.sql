@@ -0,0 +1,17 @@
+-- Drops the whole identity schema and its data
+DROP TABLE IF EXISTS
+    login_events,
+    export_jobs,
+    user_merges,
+    outbox_events,
+    class_waitlist_entries,
+    class_enrollments,
+    classes,
+    terms,
+    departments,
+    faculties,
+    institutes,
+    institute_admin_profiles,
+    instructor_profiles,
+    student_profiles,
+    users;
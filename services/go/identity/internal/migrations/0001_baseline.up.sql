@@ -0,0 +1,226 @@
+-- Identity schema as of the switch from AutoMigrate to versioned migrations
+
+CREATE TABLE IF NOT EXISTS users (
+    id uuid PRIMARY KEY,
+    email text NOT NULL,
+    full_name text NOT NULL,
+    user_type text NOT NULL,
+    is_active boolean DEFAULT true,
+    status text DEFAULT 'pending',
+    email_verified boolean DEFAULT false,
+    version bigint NOT NULL DEFAULT 1,
+    last_login_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS student_profiles (
+    user_id uuid PRIMARY KEY,
+    institute_id uuid,
+    enrollment_number text NOT NULL,
+    enrollment_year bigint,
+    CONSTRAINT fk_users_student_profile FOREIGN KEY (user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- Enrollment numbers are unique per institute, not globally
+CREATE UNIQUE INDEX IF NOT EXISTS idx_student_institute_enrollment ON student_profiles (institute_id, enrollment_number);
+
+CREATE TABLE IF NOT EXISTS instructor_profiles (
+    user_id uuid PRIMARY KEY,
+    employee_id text,
+    specialization text,
+    CONSTRAINT fk_users_instructor_profile FOREIGN KEY (user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_instructor_profiles_employee_id ON instructor_profiles (employee_id);
+
+CREATE TABLE IF NOT EXISTS institute_admin_profiles (
+    user_id uuid,
+    institute_id uuid,
+    role text NOT NULL DEFAULT 'ADMIN',
+    PRIMARY KEY (user_id, institute_id),
+    CONSTRAINT fk_users_institute_admin_profiles FOREIGN KEY (user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS institutes (
+    id uuid PRIMARY KEY,
+    name text NOT NULL,
+    code text NOT NULL,
+    domain text NOT NULL,
+    contact_email text NOT NULL,
+    is_active boolean DEFAULT true,
+    version bigint NOT NULL DEFAULT 1,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_institutes_code ON institutes (code);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_institutes_domain ON institutes (domain);
+
+CREATE TABLE IF NOT EXISTS faculties (
+    id uuid PRIMARY KEY,
+    institute_id uuid NOT NULL,
+    name text NOT NULL,
+    head_user_id uuid,
+    version bigint NOT NULL DEFAULT 1,
+    created_at timestamptz,
+    CONSTRAINT fk_institutes_faculties FOREIGN KEY (institute_id)
+        REFERENCES institutes (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_faculties_head_user FOREIGN KEY (head_user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_faculties_head_user_id ON faculties (head_user_id);
+
+CREATE TABLE IF NOT EXISTS departments (
+    id uuid PRIMARY KEY,
+    faculty_id uuid NOT NULL,
+    name text NOT NULL,
+    head_user_id uuid,
+    version bigint NOT NULL DEFAULT 1,
+    created_at timestamptz,
+    CONSTRAINT fk_faculties_departments FOREIGN KEY (faculty_id)
+        REFERENCES faculties (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_departments_head_user FOREIGN KEY (head_user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_departments_head_user_id ON departments (head_user_id);
+
+CREATE TABLE IF NOT EXISTS terms (
+    id uuid PRIMARY KEY,
+    institute_id uuid NOT NULL,
+    name text NOT NULL,
+    starts_on date NOT NULL,
+    ends_on date NOT NULL,
+    is_current boolean NOT NULL DEFAULT false,
+    version bigint NOT NULL DEFAULT 1,
+    created_at timestamptz,
+    CONSTRAINT fk_terms_institute FOREIGN KEY (institute_id)
+        REFERENCES institutes (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_terms_institute_id ON terms (institute_id);
+
+CREATE TABLE IF NOT EXISTS classes (
+    id uuid PRIMARY KEY,
+    department_id uuid NOT NULL,
+    name text NOT NULL,
+    capacity bigint,
+    term_id uuid,
+    version bigint NOT NULL DEFAULT 1,
+    created_at timestamptz,
+    CONSTRAINT fk_departments_classes FOREIGN KEY (department_id)
+        REFERENCES departments (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_classes_term FOREIGN KEY (term_id)
+        REFERENCES terms (id) ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_classes_term_id ON classes (term_id);
+
+CREATE TABLE IF NOT EXISTS class_enrollments (
+    student_id uuid,
+    class_id uuid,
+    enrolled_at timestamptz,
+    PRIMARY KEY (student_id, class_id),
+    CONSTRAINT fk_classes_enrollments FOREIGN KEY (class_id)
+        REFERENCES classes (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_student_profiles_class_enrollments FOREIGN KEY (student_id)
+        REFERENCES student_profiles (user_id),
+    CONSTRAINT fk_class_enrollments_student FOREIGN KEY (student_id)
+        REFERENCES users (id)
+);
+
+CREATE TABLE IF NOT EXISTS class_waitlist_entries (
+    id uuid PRIMARY KEY,
+    class_id uuid NOT NULL,
+    student_id uuid NOT NULL,
+    position bigint NOT NULL,
+    created_at timestamptz,
+    CONSTRAINT fk_class_waitlist_entries_class FOREIGN KEY (class_id)
+        REFERENCES classes (id) ON DELETE CASCADE,
+    CONSTRAINT fk_class_waitlist_entries_student FOREIGN KEY (student_id)
+        REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_class_student ON class_waitlist_entries (class_id, student_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_class_position ON class_waitlist_entries (class_id, position);
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id uuid PRIMARY KEY,
+    seq bigserial,
+    event_type text NOT NULL,
+    entity_id text NOT NULL,
+    payload jsonb NOT NULL,
+    created_at timestamptz,
+    published_at timestamptz,
+    attempts bigint DEFAULT 0,
+    last_error text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_events_seq ON outbox_events (seq);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_published_at ON outbox_events (published_at);
+
+CREATE TABLE IF NOT EXISTS user_merges (
+    id uuid PRIMARY KEY,
+    primary_user_id uuid NOT NULL,
+    duplicate_user_id uuid NOT NULL,
+    duplicate_email text NOT NULL,
+    summary jsonb NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_user_merges_primary_user_id ON user_merges (primary_user_id);
+CREATE INDEX IF NOT EXISTS idx_user_merges_duplicate_user_id ON user_merges (duplicate_user_id);
+
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL,
+    requested_by text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    error text,
+    document jsonb,
+    created_at timestamptz,
+    started_at timestamptz,
+    completed_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_status ON export_jobs (status);
+
+CREATE TABLE IF NOT EXISTS login_events (
+    id bigserial PRIMARY KEY,
+    user_id uuid NOT NULL,
+    logged_in_at timestamptz NOT NULL,
+    client_ip text,
+    user_agent text
+);
+CREATE INDEX IF NOT EXISTS idx_login_events_user_time ON login_events (user_id, logged_in_at);
+
+-- Query indexes, previously added at startup
+CREATE INDEX IF NOT EXISTS idx_users_email_active ON users (email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_users_user_type ON users (user_type);
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status);
+CREATE INDEX IF NOT EXISTS idx_users_email_deleted ON users (email, deleted_at);
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_student_profiles_user_id ON student_profiles (user_id);
+CREATE INDEX IF NOT EXISTS idx_instructor_profiles_user_id ON instructor_profiles (user_id);
+CREATE INDEX IF NOT EXISTS idx_institute_admin_profiles_user_id ON institute_admin_profiles (user_id);
+CREATE INDEX IF NOT EXISTS idx_institute_admin_profiles_institute_id ON institute_admin_profiles (institute_id);
+
+-- Institute user search: prefix on email, substring on name
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email) text_pattern_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_users_full_name_trgm ON users USING gin (lower(full_name) gin_trgm_ops) WHERE deleted_at IS NULL;
+
+-- Upgrades AutoMigrate used to apply on every start; no-ops on current databases
+
+-- Rows created before optimistic locking start at version 1
+UPDATE users SET version = 1 WHERE version IS NULL OR version < 1;
+UPDATE institutes SET version = 1 WHERE version IS NULL OR version < 1;
+UPDATE faculties SET version = 1 WHERE version IS NULL OR version < 1;
+UPDATE departments SET version = 1 WHERE version IS NULL OR version < 1;
+UPDATE classes SET version = 1 WHERE version IS NULL OR version < 1;
+
+-- Every institute keeps an owner; institutes without one make all their admins owners
+UPDATE institute_admin_profiles p SET role = 'OWNER'
+    WHERE NOT EXISTS (
+        SELECT 1 FROM institute_admin_profiles o WHERE o.institute_id = p.institute_id AND o.role = 'OWNER');
+
+-- Enrollment numbers used to be globally unique
+DROP INDEX IF EXISTS idx_student_profiles_enrollment_number;
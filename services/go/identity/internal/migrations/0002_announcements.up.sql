@@ -0,0 +1,20 @@
+CREATE TABLE announcements (
+    id uuid PRIMARY KEY,
+    scope text NOT NULL,
+    scope_id uuid NOT NULL,
+    title text NOT NULL,
+    body text NOT NULL,
+    author_user_id uuid NOT NULL,
+    publish_at timestamptz NOT NULL,
+    expires_at timestamptz,
+    notify boolean NOT NULL DEFAULT false,
+    notified_at timestamptz,
+    version bigint NOT NULL DEFAULT 1,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX idx_announcements_scope ON announcements (scope, scope_id);
+CREATE INDEX idx_announcements_author_user_id ON announcements (author_user_id);
+CREATE INDEX idx_announcements_publish_at ON announcements (publish_at);
+-- Published announcements whose email has not gone out yet
+CREATE INDEX idx_announcements_pending_notify ON announcements (publish_at) WHERE notify AND notified_at IS NULL;
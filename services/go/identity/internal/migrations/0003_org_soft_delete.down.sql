@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS deletion_tombstones;
+
+-- Soft-deleted rows would break the unique indexes and show up again once
+-- the column is gone, so they are removed for good
+DELETE FROM classes WHERE deleted_at IS NOT NULL;
+DELETE FROM departments WHERE deleted_at IS NOT NULL;
+DELETE FROM faculties WHERE deleted_at IS NOT NULL;
+DELETE FROM institutes WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_institutes_code;
+DROP INDEX IF EXISTS idx_institutes_domain;
+CREATE UNIQUE INDEX idx_institutes_code ON institutes (code);
+CREATE UNIQUE INDEX idx_institutes_domain ON institutes (domain);
+
+ALTER TABLE classes DROP COLUMN deleted_at;
+ALTER TABLE departments DROP COLUMN deleted_at;
+ALTER TABLE faculties DROP COLUMN deleted_at;
+ALTER TABLE institutes DROP COLUMN deleted_at;
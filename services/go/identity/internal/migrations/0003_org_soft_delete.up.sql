@@ -0,0 +1,32 @@
+-- Institutes, faculties, departments and classes are soft deleted, and
+-- each deletion leaves a tombstone naming who asked for it
+
+ALTER TABLE institutes ADD COLUMN deleted_at timestamptz;
+ALTER TABLE faculties ADD COLUMN deleted_at timestamptz;
+ALTER TABLE departments ADD COLUMN deleted_at timestamptz;
+ALTER TABLE classes ADD COLUMN deleted_at timestamptz;
+CREATE INDEX idx_institutes_deleted_at ON institutes (deleted_at);
+CREATE INDEX idx_faculties_deleted_at ON faculties (deleted_at);
+CREATE INDEX idx_departments_deleted_at ON departments (deleted_at);
+CREATE INDEX idx_classes_deleted_at ON classes (deleted_at);
+
+-- A deleted institute's code and domain may be used again
+DROP INDEX IF EXISTS idx_institutes_code;
+DROP INDEX IF EXISTS idx_institutes_domain;
+CREATE UNIQUE INDEX idx_institutes_code ON institutes (code) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_institutes_domain ON institutes (domain) WHERE deleted_at IS NULL;
+
+CREATE TABLE deletion_tombstones (
+    id uuid PRIMARY KEY,
+    unit text NOT NULL,
+    unit_id uuid NOT NULL,
+    unit_name text NOT NULL,
+    requested_by text NOT NULL,
+    cascaded boolean NOT NULL DEFAULT false,
+    faculties bigint NOT NULL DEFAULT 0,
+    departments bigint NOT NULL DEFAULT 0,
+    classes bigint NOT NULL DEFAULT 0,
+    enrollments bigint NOT NULL DEFAULT 0,
+    created_at timestamptz
+);
+CREATE INDEX idx_deletion_tombstones_unit ON deletion_tombstones (unit, unit_id);
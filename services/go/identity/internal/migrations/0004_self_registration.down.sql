@@ -0,0 +1,3 @@
+ALTER TABLE institutes DROP COLUMN IF EXISTS default_class_id;
+ALTER TABLE institutes DROP COLUMN IF EXISTS allowed_email_domains;
+ALTER TABLE institutes DROP COLUMN IF EXISTS allow_self_registration;
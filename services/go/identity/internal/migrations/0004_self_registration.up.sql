@@ -0,0 +1,8 @@
+-- Institutes may let students with a matching email domain sign themselves
+-- up; the allowed domains start out as the institute's own domain
+
+ALTER TABLE institutes ADD COLUMN allow_self_registration boolean NOT NULL DEFAULT false;
+ALTER TABLE institutes ADD COLUMN allowed_email_domains text;
+ALTER TABLE institutes ADD COLUMN default_class_id uuid;
+
+UPDATE institutes SET allowed_email_domains = json_build_array(domain)::text;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS institute_feature_overrides;
+DROP TABLE IF EXISTS feature_flags;
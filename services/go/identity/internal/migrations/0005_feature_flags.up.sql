@@ -0,0 +1,22 @@
+-- Feature flags with a default, which institutes can override either way
+
+CREATE TABLE feature_flags (
+    key text PRIMARY KEY,
+    description text NOT NULL DEFAULT '',
+    default_on boolean NOT NULL DEFAULT false,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE institute_feature_overrides (
+    institute_id uuid,
+    key text,
+    enabled boolean NOT NULL,
+    updated_at timestamptz,
+    PRIMARY KEY (institute_id, key),
+    CONSTRAINT fk_institute_feature_overrides_institute FOREIGN KEY (institute_id)
+        REFERENCES institutes (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_feature_flags_overrides FOREIGN KEY (key)
+        REFERENCES feature_flags (key) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_institute_feature_overrides_key ON institute_feature_overrides (key);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS slot_bookings;
+DROP TABLE IF EXISTS availability_slots;
@@ -0,0 +1,37 @@
+-- Instructors' office-hours slots and the students booked into them
+
+CREATE TABLE availability_slots (
+    id uuid PRIMARY KEY,
+    instructor_id uuid NOT NULL,
+    class_id uuid,
+    starts_at timestamptz NOT NULL,
+    ends_at timestamptz NOT NULL,
+    timezone text NOT NULL DEFAULT 'UTC',
+    capacity bigint NOT NULL,
+    location text NOT NULL DEFAULT '',
+    cancelled_at timestamptz,
+    notified_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_availability_slots_instructor FOREIGN KEY (instructor_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_availability_slots_class FOREIGN KEY (class_id)
+        REFERENCES classes (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+CREATE INDEX idx_availability_slots_instructor ON availability_slots (instructor_id, starts_at);
+CREATE INDEX idx_availability_slots_class_id ON availability_slots (class_id);
+-- Cancelled slots whose bookings have not been emailed yet
+CREATE INDEX idx_availability_slots_pending_notify ON availability_slots (cancelled_at)
+    WHERE cancelled_at IS NOT NULL AND notified_at IS NULL;
+
+CREATE TABLE slot_bookings (
+    slot_id uuid,
+    student_id uuid,
+    booked_at timestamptz NOT NULL,
+    PRIMARY KEY (slot_id, student_id),
+    CONSTRAINT fk_availability_slots_bookings FOREIGN KEY (slot_id)
+        REFERENCES availability_slots (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_slot_bookings_student FOREIGN KEY (student_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_slot_bookings_student_id ON slot_bookings (student_id);
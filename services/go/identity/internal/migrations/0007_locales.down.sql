@@ -0,0 +1,2 @@
+ALTER TABLE institutes DROP COLUMN IF EXISTS default_locale;
+ALTER TABLE users DROP COLUMN IF EXISTS preferred_locale;
@@ -0,0 +1,5 @@
+-- Users may choose the language they are emailed in; institutes set the
+-- language for everyone who has not
+
+ALTER TABLE users ADD COLUMN preferred_locale text;
+ALTER TABLE institutes ADD COLUMN default_locale text NOT NULL DEFAULT 'en';
@@ -0,0 +1,3 @@
+ALTER TABLE class_waitlist_entries DROP COLUMN IF EXISTS section_id;
+ALTER TABLE class_enrollments DROP COLUMN IF EXISTS section_id;
+DROP TABLE IF EXISTS class_sections;
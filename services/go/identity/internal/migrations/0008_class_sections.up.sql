@@ -0,0 +1,40 @@
+-- Classes split into sections with their own capacity and instructor. Every
+-- class gets a default section holding the students it already has.
+
+CREATE TABLE class_sections (
+    id uuid PRIMARY KEY,
+    class_id uuid NOT NULL,
+    name text NOT NULL,
+    capacity bigint,
+    schedule text NOT NULL DEFAULT '',
+    instructor_id uuid,
+    is_default boolean NOT NULL DEFAULT false,
+    version bigint NOT NULL DEFAULT 1,
+    created_at timestamptz,
+    CONSTRAINT fk_classes_sections FOREIGN KEY (class_id)
+        REFERENCES classes (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_class_sections_instructor FOREIGN KEY (instructor_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+CREATE INDEX idx_class_sections_class_id ON class_sections (class_id);
+CREATE INDEX idx_class_sections_instructor_id ON class_sections (instructor_id);
+CREATE UNIQUE INDEX idx_class_sections_default ON class_sections (class_id) WHERE is_default;
+
+INSERT INTO class_sections (id, class_id, name, is_default, created_at)
+SELECT gen_random_uuid(), id, 'Default', true, now() FROM classes;
+
+ALTER TABLE class_enrollments ADD COLUMN section_id uuid;
+UPDATE class_enrollments e SET section_id = s.id
+    FROM class_sections s WHERE s.class_id = e.class_id AND s.is_default;
+ALTER TABLE class_enrollments ALTER COLUMN section_id SET NOT NULL;
+ALTER TABLE class_enrollments ADD CONSTRAINT fk_class_enrollments_section FOREIGN KEY (section_id)
+    REFERENCES class_sections (id) ON UPDATE CASCADE;
+CREATE INDEX idx_class_enrollments_section_id ON class_enrollments (section_id);
+
+ALTER TABLE class_waitlist_entries ADD COLUMN section_id uuid;
+UPDATE class_waitlist_entries w SET section_id = s.id
+    FROM class_sections s WHERE s.class_id = w.class_id AND s.is_default;
+ALTER TABLE class_waitlist_entries ALTER COLUMN section_id SET NOT NULL;
+ALTER TABLE class_waitlist_entries ADD CONSTRAINT fk_class_waitlist_entries_section FOREIGN KEY (section_id)
+    REFERENCES class_sections (id) ON DELETE CASCADE;
+CREATE INDEX idx_class_waitlist_entries_section_id ON class_waitlist_entries (section_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_policy_acceptances;
+DROP TABLE IF EXISTS policy_documents;
@@ -0,0 +1,28 @@
+-- Versions of the terms of service and privacy policy, and which of them
+-- each user accepted
+
+CREATE TABLE policy_documents (
+    id uuid PRIMARY KEY,
+    type text NOT NULL,
+    version text NOT NULL,
+    body text NOT NULL DEFAULT '',
+    url text NOT NULL DEFAULT '',
+    effective_at timestamptz NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX idx_policy_documents_type_version ON policy_documents (type, version);
+CREATE INDEX idx_policy_documents_type_effective ON policy_documents (type, effective_at);
+
+CREATE TABLE user_policy_acceptances (
+    user_id uuid,
+    document_id uuid,
+    accepted_at timestamptz NOT NULL,
+    client_ip text NOT NULL DEFAULT '',
+    PRIMARY KEY (user_id, document_id),
+    CONSTRAINT fk_user_policy_acceptances_user FOREIGN KEY (user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_user_policy_acceptances_document FOREIGN KEY (document_id)
+        REFERENCES policy_documents (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_user_policy_acceptances_document_id ON user_policy_acceptances (document_id);
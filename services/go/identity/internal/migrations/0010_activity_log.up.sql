@@ -0,0 +1,15 @@
+-- Who changed which users, enrollments and org units, and how
+
+CREATE TABLE activity_entries (
+    id uuid PRIMARY KEY,
+    actor_id text NOT NULL DEFAULT '',
+    impersonator_id text NOT NULL DEFAULT '',
+    action text NOT NULL,
+    entity_type text NOT NULL,
+    entity_id text NOT NULL,
+    changes jsonb NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX idx_activity_entries_actor ON activity_entries (actor_id, created_at);
+CREATE INDEX idx_activity_entries_entity ON activity_entries (entity_type, entity_id);
+CREATE INDEX idx_activity_entries_created_at ON activity_entries (created_at);
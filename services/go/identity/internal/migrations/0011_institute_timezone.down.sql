@@ -0,0 +1 @@
+ALTER TABLE institutes DROP COLUMN IF EXISTS timezone;
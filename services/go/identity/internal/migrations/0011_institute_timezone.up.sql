@@ -0,0 +1,4 @@
+-- Institutes set the time zone dates are shown to their members in, e.g. in
+-- students' deadline calendars
+
+ALTER TABLE institutes ADD COLUMN timezone text NOT NULL DEFAULT 'UTC';
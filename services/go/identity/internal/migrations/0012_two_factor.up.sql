@@ -0,0 +1,20 @@
+-- TOTP two-factor enrollments, with their secrets encrypted by AuthN, and
+-- the hashes of each user's unused recovery codes
+
+CREATE TABLE user_two_factors (
+    user_id uuid PRIMARY KEY,
+    secret text NOT NULL,
+    enabled_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_user_two_factors_user FOREIGN KEY (user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE user_recovery_codes (
+    user_id uuid,
+    code_hash text,
+    PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT fk_user_recovery_codes_user FOREIGN KEY (user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Nothing to undo: which units the up migration deleted is not recorded, and
+-- they were already out of every listing under their deleted parent
@@ -0,0 +1,15 @@
+-- Units left live under a deleted unit, from before deletions cascaded or
+-- from a child created while its parent was being deleted, are deleted along
+-- with it, top down so each level sees the one above already done
+
+UPDATE faculties f SET deleted_at = i.deleted_at
+FROM institutes i
+WHERE i.id = f.institute_id AND f.deleted_at IS NULL AND i.deleted_at IS NOT NULL;
+
+UPDATE departments d SET deleted_at = f.deleted_at
+FROM faculties f
+WHERE f.id = d.faculty_id AND d.deleted_at IS NULL AND f.deleted_at IS NOT NULL;
+
+UPDATE classes c SET deleted_at = d.deleted_at
+FROM departments d
+WHERE d.id = c.department_id AND c.deleted_at IS NULL AND d.deleted_at IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Institutes' logos, colors and email footers, for the portal and for the
+-- emails sent to their members
+
+CREATE TABLE institute_brandings (
+    institute_id uuid PRIMARY KEY,
+    logo_key text NOT NULL DEFAULT '',
+    primary_color text NOT NULL DEFAULT '',
+    secondary_color text NOT NULL DEFAULT '',
+    email_footer_html text NOT NULL DEFAULT '',
+    support_email text NOT NULL DEFAULT '',
+    updated_at timestamptz,
+    CONSTRAINT fk_institute_brandings_institute FOREIGN KEY (institute_id)
+        REFERENCES institutes (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Lower-cased emails are left as they are
+DROP INDEX IF EXISTS idx_users_email_lower_unique;
@@ -0,0 +1,21 @@
+-- Emails are unique in any case among active users, so that of concurrent
+-- creations of one email only one succeeds. Stored emails are lower-cased
+-- where that clashes with no one. Users whose emails still differ only by
+-- case have to be merged first; until then the index is left out and the
+-- server adds it at startup once they are.
+
+UPDATE users u SET email = lower(u.email)
+WHERE u.email <> lower(u.email) AND NOT EXISTS (
+    SELECT 1 FROM users o WHERE o.id <> u.id AND lower(o.email) = lower(u.email));
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM users WHERE deleted_at IS NULL
+        GROUP BY lower(email) HAVING COUNT(*) > 1
+    ) THEN
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower_unique ON users (lower(email)) WHERE deleted_at IS NULL;
+    ELSE
+        RAISE NOTICE 'users share emails that differ only by case; merge them to add idx_users_email_lower_unique';
+    END IF;
+END $$;
@@ -0,0 +1,6 @@
+-- Requests would otherwise become enrollments
+DELETE FROM class_enrollments WHERE status <> 'enrolled';
+DROP INDEX IF EXISTS idx_class_enrollments_pending;
+ALTER TABLE class_enrollments DROP COLUMN IF EXISTS decided_at;
+ALTER TABLE class_enrollments DROP COLUMN IF EXISTS decided_by;
+ALTER TABLE class_enrollments DROP COLUMN IF EXISTS status;
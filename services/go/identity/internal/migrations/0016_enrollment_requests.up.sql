@@ -0,0 +1,7 @@
+-- Requests students make to join a class. They are kept in
+-- class_enrollments with a status and hold no seat until approved.
+
+ALTER TABLE class_enrollments ADD COLUMN status text NOT NULL DEFAULT 'enrolled';
+ALTER TABLE class_enrollments ADD COLUMN decided_by uuid;
+ALTER TABLE class_enrollments ADD COLUMN decided_at timestamptz;
+CREATE INDEX idx_class_enrollments_pending ON class_enrollments (class_id) WHERE status = 'pending';
@@ -0,0 +1,2 @@
+ALTER TABLE institutes DROP COLUMN IF EXISTS require_verified_email_for_login;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
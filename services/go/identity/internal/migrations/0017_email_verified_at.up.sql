@@ -0,0 +1,8 @@
+-- When a user first verified their email, and the institutes that only let
+-- verified users log in. Users verified before this was tracked are taken
+-- to have verified when they were created.
+
+ALTER TABLE users ADD COLUMN email_verified_at timestamptz;
+UPDATE users SET email_verified_at = created_at WHERE email_verified AND email_verified_at IS NULL;
+
+ALTER TABLE institutes ADD COLUMN require_verified_email_for_login boolean NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- For exports of the users changed since a given time, read in
+-- (updated_at, id) order
+CREATE INDEX IF NOT EXISTS idx_users_updated_at ON users (updated_at, id);
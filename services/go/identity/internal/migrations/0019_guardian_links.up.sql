@@ -0,0 +1,23 @@
+-- Links letting a guardian see a student's released grades and deadlines.
+-- A student has at most one link with a guardian that is not revoked.
+
+CREATE TABLE guardian_links (
+    id uuid PRIMARY KEY,
+    guardian_user_id uuid NOT NULL,
+    student_user_id uuid NOT NULL,
+    status text NOT NULL,
+    created_by uuid NOT NULL,
+    revoked_by uuid,
+    revoked_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_guardian_links_guardian FOREIGN KEY (guardian_user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT fk_guardian_links_student FOREIGN KEY (student_user_id)
+        REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX idx_guardian_links_guardian_user_id ON guardian_links (guardian_user_id);
+CREATE INDEX idx_guardian_links_student_user_id ON guardian_links (student_user_id);
+CREATE UNIQUE INDEX idx_guardian_links_open ON guardian_links (guardian_user_id, student_user_id)
+    WHERE status <> 'revoked';
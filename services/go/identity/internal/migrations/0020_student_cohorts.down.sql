@@ -0,0 +1,3 @@
+-- Backfilled enrollment years are kept; they were valid before too
+DROP INDEX IF EXISTS idx_student_cohort;
+ALTER TABLE student_profiles DROP COLUMN IF EXISTS intake_season;
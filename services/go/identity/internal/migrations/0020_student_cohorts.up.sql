@@ -0,0 +1,30 @@
+-- The season of the year a student started in, which with enrollment_year
+-- makes their cohort (core.CohortLabel), and the index cohort listings use.
+--
+-- Students registered before either was set are backfilled from their
+-- earliest class enrollment, with the months of core.SeasonOf. A student
+-- whose year was already set only gets a season if that enrollment fell in
+-- the same year. Students with no enrollment are left without a cohort;
+-- `cleanup report` lists them as missing_cohort.
+
+ALTER TABLE student_profiles ADD COLUMN intake_season text NOT NULL DEFAULT '';
+
+CREATE INDEX idx_student_cohort ON student_profiles (institute_id, enrollment_year, intake_season);
+
+WITH first_enrollments AS (
+    SELECT student_id, min(enrolled_at) AS started_at
+    FROM class_enrollments
+    WHERE status = 'enrolled'
+    GROUP BY student_id
+)
+UPDATE student_profiles AS sp SET
+    enrollment_year = date_part('year', fe.started_at),
+    intake_season = CASE
+        WHEN date_part('month', fe.started_at) <= 5 THEN 'SPRING'
+        WHEN date_part('month', fe.started_at) <= 7 THEN 'SUMMER'
+        ELSE 'FALL'
+    END
+FROM first_enrollments fe
+WHERE fe.student_id = sp.user_id
+    AND sp.intake_season = ''
+    AND (coalesce(sp.enrollment_year, 0) = 0 OR sp.enrollment_year = date_part('year', fe.started_at));
@@ -0,0 +1,26 @@
+// Package migrations holds the identity schema as versioned SQL files,
+// applied by the server at startup (RUN_MIGRATIONS=auto) or by cmd/migrate.
+//
+// 0001_baseline matches the schema AutoMigrate produced, and only creates
+// what is missing, so databases created before migrations existed are
+// stamped at version 1 without changes.
+package migrations
+
+import (
+	"embed"
+
+	"github.com/4yrg/gradeloop-core/libs/database/migrate"
+	"gorm.io/gorm"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// NewRunner returns a runner for the migrations on db's connection pool
+func NewRunner(db *gorm.DB) (*migrate.Runner, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(sqlDB, FS)
+}
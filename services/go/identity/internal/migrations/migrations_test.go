@@ -0,0 +1,168 @@
+package migrations
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Postgres' date_part, for the year and month of a time as SQLite stores it
+func init() {
+	gosqlite.MustRegisterDeterministicScalarFunction("date_part", 2, func(_ *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		field, _ := args[0].(string)
+		stored, _ := args[1].(string)
+		at, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", stored)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(field) {
+		case "year":
+			return int64(at.Year()), nil
+		case "month":
+			return int64(at.Month()), nil
+		}
+		return nil, fmt.Errorf("date_part: unsupported field %q", field)
+	})
+}
+
+// newTestDB returns an empty in-memory SQLite database
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// applyMigration runs the up migration named name
+func applyMigration(t *testing.T, db *gorm.DB, name string) {
+	t.Helper()
+	up, err := FS.ReadFile(name + ".up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(string(up)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmailVerifiedAtBackfill(t *testing.T) {
+	db := newTestDB(t)
+	err := db.Exec(`
+		CREATE TABLE users (id text PRIMARY KEY, email_verified boolean NOT NULL, created_at timestamptz);
+		CREATE TABLE institutes (id text PRIMARY KEY)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+	for id, verified := range map[string]bool{"verified": true, "unverified": false} {
+		if err := db.Exec(`INSERT INTO users (id, email_verified, created_at) VALUES (?, ?, ?)`, id, verified, created).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applyMigration(t, db, "0017_email_verified_at")
+
+	// SQLite does not know timestamptz as a time, so the times are compared
+	// as stored
+	var users []struct {
+		ID         string
+		Backfilled bool
+		Unset      bool
+	}
+	err = db.Raw(`SELECT id, email_verified_at = created_at AS backfilled, email_verified_at IS NULL AS unset FROM users`).
+		Scan(&users).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range users {
+		switch {
+		case u.ID == "verified" && !u.Backfilled:
+			t.Error("verified user's email_verified_at is not their created_at")
+		case u.ID == "unverified" && !u.Unset:
+			t.Error("unverified user's email_verified_at is set")
+		}
+	}
+
+	if err := db.Exec(`INSERT INTO institutes (id) VALUES ('inst-1')`).Error; err != nil {
+		t.Fatal(err)
+	}
+	var required bool
+	if err := db.Raw(`SELECT require_verified_email_for_login FROM institutes`).Scan(&required).Error; err != nil {
+		t.Fatal(err)
+	}
+	if required {
+		t.Error("institutes require verified emails by default")
+	}
+}
+
+func TestCohortBackfillFromFirstEnrollment(t *testing.T) {
+	db := newTestDB(t)
+	err := db.Exec(`
+		CREATE TABLE student_profiles (user_id text PRIMARY KEY, institute_id text, enrollment_year integer);
+		CREATE TABLE class_enrollments (student_id text, status text, enrolled_at datetime)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	students := map[string]int{"spring": 0, "fall": 0, "summer": 2024, "other-year": 2020, "none": 0}
+	for id, year := range students {
+		if err := db.Exec(`INSERT INTO student_profiles (user_id, enrollment_year) VALUES (?, ?)`, id, year).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 9, 0, 0, 0, time.UTC)
+	}
+	for _, e := range []struct {
+		student, status string
+		at              time.Time
+	}{
+		{"spring", "enrolled", day(2024, time.September, 1)},
+		{"spring", "enrolled", day(2023, time.March, 10)}, // the earliest counts
+		{"fall", "enrolled", day(2022, time.September, 5)},
+		{"fall", "dropped", day(2021, time.January, 4)}, // only enrollments that took
+		{"summer", "enrolled", day(2024, time.June, 15)},
+		{"other-year", "enrolled", day(2021, time.October, 1)},
+	} {
+		if err := db.Exec(`INSERT INTO class_enrollments (student_id, status, enrolled_at) VALUES (?, ?, ?)`, e.student, e.status, e.at).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applyMigration(t, db, "0020_student_cohorts")
+
+	var rows []struct {
+		UserID         string
+		EnrollmentYear int
+		IntakeSeason   string
+	}
+	if err := db.Raw(`SELECT user_id, enrollment_year, intake_season FROM student_profiles`).Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"spring": "2023 SPRING",
+		"fall":   "2022 FALL",
+		"summer": "2024 SUMMER",
+		// An explicit year is kept, and the season of another year is not
+		// added to it
+		"other-year": "2020 ",
+		// Nothing to infer from; cleanup report lists them
+		"none": "0 ",
+	}
+	for _, row := range rows {
+		if got := fmt.Sprintf("%d %s", row.EnrollmentYear, row.IntakeSeason); got != want[row.UserID] {
+			t.Errorf("%s: cohort %q, want %q", row.UserID, got, want[row.UserID])
+		}
+	}
+	if len(rows) != len(students) {
+		t.Errorf("%d profiles after the migration, want %d", len(rows), len(students))
+	}
+}
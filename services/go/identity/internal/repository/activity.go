@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// ActivityFilter narrows the activity log; zero fields match everything
+type ActivityFilter struct {
+	ActorID    string
+	EntityType string
+	EntityID   string
+	From       time.Time // inclusive
+	To         time.Time // exclusive
+}
+
+// InsertActivity stores a batch of activity entries
+func (r *Repository) InsertActivity(entries []core.ActivityEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(entries, 100).Error
+}
+
+// ListActivity returns a page of activity entries matching filter, newest
+// first
+func (r *Repository) ListActivity(filter ActivityFilter, page pagination.Request) ([]core.ActivityEntry, error) {
+	return readOnly(r, func(r *Repository) ([]core.ActivityEntry, error) {
+		return r.listActivity(filter, page)
+	})
+}
+
+func (r *Repository) listActivity(filter ActivityFilter, page pagination.Request) ([]core.ActivityEntry, error) {
+	query := r.db.Model(&core.ActivityEntry{}).Order("created_at DESC, id DESC").Limit(page.Fetch())
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if page.After != nil {
+		query = query.Where("(created_at, id) < (?, ?)", page.After.CreatedAt, page.After.ID)
+	} else {
+		query = query.Offset(page.Offset)
+	}
+
+	var entries []core.ActivityEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
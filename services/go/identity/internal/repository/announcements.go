@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrAnnouncementNotFound = errors.New("announcement not found")
+
+// OrgUnits are the org units a user belongs to, each level including the
+// parents of the units below it
+type OrgUnits struct {
+	Institutes  []uuid.UUID
+	Faculties   []uuid.UUID
+	Departments []uuid.UUID
+	Classes     []uuid.UUID
+}
+
+// announcementAudienceSQL selects, per scope, the IDs of the users an
+// announcement to @unit reaches: students enrolled in the unit's classes and
+// the heads of the unit and the units below it. Institute announcements reach
+// every member of the institute, as listed by instituteMembersSQL, which
+// names the unit @institute.
+var announcementAudienceSQL = map[core.AnnouncementScope]string{
+	core.AnnouncementScopeClass: `
+	SELECT ce.student_id FROM class_enrollments ce WHERE ce.class_id = @unit AND ce.status = 'enrolled'`,
+	core.AnnouncementScopeDepartment: `
+	SELECT ce.student_id FROM class_enrollments ce
+		JOIN classes c ON c.id = ce.class_id
+		WHERE c.department_id = @unit AND c.deleted_at IS NULL AND ce.status = 'enrolled'
+	UNION
+	SELECT d.head_user_id FROM departments d WHERE d.id = @unit AND d.head_user_id IS NOT NULL`,
+	core.AnnouncementScopeFaculty: `
+	SELECT ce.student_id FROM class_enrollments ce
+		JOIN classes c ON c.id = ce.class_id
+		JOIN departments d ON d.id = c.department_id
+		WHERE d.faculty_id = @unit AND c.deleted_at IS NULL AND ce.status = 'enrolled'
+	UNION
+	SELECT f.head_user_id FROM faculties f WHERE f.id = @unit AND f.head_user_id IS NOT NULL
+	UNION
+	SELECT d.head_user_id FROM departments d
+		WHERE d.faculty_id = @unit AND d.deleted_at IS NULL AND d.head_user_id IS NOT NULL`,
+	core.AnnouncementScopeInstitute: instituteMembersSQL,
+}
+
+func (r *Repository) CreateAnnouncement(announcement *core.Announcement) error {
+	return r.db.Create(announcement).Error
+}
+
+func (r *Repository) GetAnnouncement(id uuid.UUID) (*core.Announcement, error) {
+	var announcement core.Announcement
+	err := r.db.First(&announcement, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAnnouncementNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &announcement, nil
+}
+
+// UpdateAnnouncement leaves notified_at alone, since the notifier sets it
+// independently of edits
+func (r *Repository) UpdateAnnouncement(announcement *core.Announcement) error {
+	return updateVersioned(r.db, announcement, &announcement.Version, "notified_at")
+}
+
+func (r *Repository) DeleteAnnouncement(id uuid.UUID) error {
+	return deleted(r.db.Delete(&core.Announcement{}, "id = ?", id), ErrAnnouncementNotFound)
+}
+
+// OrgUnitName returns the name of the institute, faculty, department or
+// class, or the not-found error of its kind
+func (r *Repository) OrgUnitName(scope core.AnnouncementScope, id uuid.UUID) (string, error) {
+	var model interface{}
+	var notFound error
+	switch scope {
+	case core.AnnouncementScopeInstitute:
+		model, notFound = &core.Institute{}, ErrInstituteNotFound
+	case core.AnnouncementScopeFaculty:
+		model, notFound = &core.Faculty{}, ErrFacultyNotFound
+	case core.AnnouncementScopeDepartment:
+		model, notFound = &core.Department{}, ErrDepartmentNotFound
+	case core.AnnouncementScopeClass:
+		model, notFound = &core.Class{}, ErrClassNotFound
+	default:
+		return "", errors.New("unknown org unit scope " + string(scope))
+	}
+
+	var names []string
+	if err := r.db.Model(model).Where("id = ?", id).Limit(1).Pluck("name", &names).Error; err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", notFound
+	}
+	return names[0], nil
+}
+
+// OrgUnitInstituteID returns the institute an org unit belongs to, which is
+// the unit itself for an institute
+func (r *Repository) OrgUnitInstituteID(scope core.AnnouncementScope, id uuid.UUID) (uuid.UUID, error) {
+	switch scope {
+	case core.AnnouncementScopeInstitute:
+		return id, nil
+	case core.AnnouncementScopeFaculty:
+		var ids []uuid.UUID
+		if err := r.db.Model(&core.Faculty{}).Where("id = ?", id).Limit(1).Pluck("institute_id", &ids).Error; err != nil {
+			return uuid.Nil, err
+		}
+		if len(ids) == 0 {
+			return uuid.Nil, ErrFacultyNotFound
+		}
+		return ids[0], nil
+	case core.AnnouncementScopeDepartment:
+		return r.DepartmentInstituteID(id)
+	case core.AnnouncementScopeClass:
+		_, instituteID, err := r.ClassScope(id)
+		return instituteID, err
+	}
+	return uuid.Nil, errors.New("unknown org unit scope " + string(scope))
+}
+
+// UserOrgUnits finds the org units a user belongs to: the classes they are
+// enrolled in, the departments and faculties they head, the institutes they
+// study at or administer, and every unit above those
+func (r *Repository) UserOrgUnits(userID uuid.UUID) (*OrgUnits, error) {
+	units := &OrgUnits{}
+	err := r.db.Model(&core.ClassEnrollment{}).Scopes(seated).
+		Where("student_id = ? AND class_id IN (?)", userID, r.db.Model(&core.Class{}).Select("id")).
+		Pluck("class_id", &units.Classes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Model(&core.Department{}).
+		Where("id IN (?) OR head_user_id = ?",
+			r.db.Model(&core.Class{}).Select("department_id").Where("id IN ?", units.Classes),
+			userID).
+		Pluck("id", &units.Departments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Model(&core.Faculty{}).
+		Where("id IN (?) OR head_user_id = ?",
+			r.db.Model(&core.Department{}).Select("faculty_id").Where("id IN ?", units.Departments),
+			userID).
+		Pluck("id", &units.Faculties).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Model(&core.Institute{}).
+		Where("id IN (?) OR id IN (?) OR id IN (?)",
+			r.db.Model(&core.Faculty{}).Select("institute_id").Where("id IN ?", units.Faculties),
+			r.db.Model(&core.StudentProfile{}).Select("institute_id").Where("user_id = ? AND institute_id IS NOT NULL", userID),
+			r.db.Model(&core.InstituteAdminProfile{}).Select("institute_id").Where("user_id = ?", userID)).
+		Pluck("id", &units.Institutes).Error
+	if err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+// ListActiveAnnouncements returns the announcements addressed to any of the
+// units that are shown at now, most recently published first
+func (r *Repository) ListActiveAnnouncements(units *OrgUnits, now time.Time) ([]core.Announcement, error) {
+	announcements := make([]core.Announcement, 0)
+	err := r.db.
+		Where("publish_at <= ? AND (expires_at IS NULL OR expires_at > ?)", now, now).
+		Where(r.db.
+			Where("scope = ? AND scope_id IN ?", core.AnnouncementScopeInstitute, units.Institutes).
+			Or("scope = ? AND scope_id IN ?", core.AnnouncementScopeFaculty, units.Faculties).
+			Or("scope = ? AND scope_id IN ?", core.AnnouncementScopeDepartment, units.Departments).
+			Or("scope = ? AND scope_id IN ?", core.AnnouncementScopeClass, units.Classes)).
+		Order("publish_at DESC, id").
+		Find(&announcements).Error
+	return announcements, err
+}
+
+// AnnouncementAudience returns the users an announcement to the unit reaches.
+// Disabled and deleted users are left out.
+func (r *Repository) AnnouncementAudience(scope core.AnnouncementScope, unitID uuid.UUID) ([]core.User, error) {
+	audienceSQL, ok := announcementAudienceSQL[scope]
+	if !ok {
+		return nil, errors.New("unknown org unit scope " + string(scope))
+	}
+	var users []core.User
+	err := r.db.
+		Where("users.id IN ("+audienceSQL+")", map[string]interface{}{"unit": unitID, "institute": unitID}).
+		Where("users.status <> ?", "disabled").
+		Order("users.id").
+		Find(&users).Error
+	return users, err
+}
+
+// ClaimAnnouncementNotification marks the earliest published announcement
+// still to be emailed as notified and returns it, or nil if there is none.
+// Marking it first means a failed send is not retried, so nobody is emailed
+// twice. SKIP LOCKED keeps several notifiers from claiming the same one.
+func (r *Repository) ClaimAnnouncementNotification(now time.Time) (*core.Announcement, error) {
+	var claimed *core.Announcement
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var candidate core.Announcement
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("notify AND notified_at IS NULL AND publish_at <= ?", now).
+			Where("expires_at IS NULL OR expires_at > ?", now).
+			Order("publish_at ASC").
+			First(&candidate).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&core.Announcement{}).Where("id = ?", candidate.ID).Update("notified_at", now).Error; err != nil {
+			return err
+		}
+		candidate.NotifiedAt = &now
+		claimed = &candidate
+		return nil
+	})
+	return claimed, err
+}
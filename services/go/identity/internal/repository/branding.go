@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetInstituteBranding returns the institute's branding, or an empty one if
+// it has not set any
+func (r *Repository) GetInstituteBranding(instituteID uuid.UUID) (*core.InstituteBranding, error) {
+	branding := core.InstituteBranding{InstituteID: instituteID}
+	err := r.db.First(&branding, "institute_id = ?", instituteID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &core.InstituteBranding{InstituteID: instituteID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &branding, nil
+}
+
+// SaveInstituteBranding creates or replaces the institute's branding
+func (r *Repository) SaveInstituteBranding(branding *core.InstituteBranding) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "institute_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"logo_key", "primary_color", "secondary_color", "email_footer_html", "support_email", "updated_at",
+		}),
+	}).Create(branding).Error
+}
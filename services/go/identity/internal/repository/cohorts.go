@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CohortCount is how many of an institute's students are in one cohort
+type CohortCount struct {
+	core.Cohort
+	Students int64
+}
+
+// cohortMembersSQL selects the IDs of an institute's students in the cohort
+// of @year and @season
+const cohortMembersSQL = `SELECT sp.user_id FROM student_profiles sp
+	WHERE sp.institute_id = @institute AND sp.enrollment_year = @year AND sp.intake_season = @season`
+
+// cohortParams are the named parameters of cohortMembersSQL
+func cohortParams(instituteID interface{}, cohort core.Cohort) map[string]interface{} {
+	return map[string]interface{}{
+		"institute": instituteID,
+		"year":      cohort.EnrollmentYear,
+		"season":    cohort.IntakeSeason,
+	}
+}
+
+// CohortCounts are an institute's students per cohort, newest first, and
+// how many have no enrollment year
+type CohortCounts struct {
+	Cohorts       []CohortCount
+	WithoutCohort int64
+}
+
+// CountInstituteCohorts counts the institute's students per cohort
+func (r *Repository) CountInstituteCohorts(instituteID uuid.UUID) (*CohortCounts, error) {
+	return readOnly(r, func(r *Repository) (*CohortCounts, error) {
+		counts := &CohortCounts{Cohorts: []CohortCount{}}
+		students := func() *gorm.DB {
+			return r.db.Table("student_profiles sp").
+				Joins("JOIN users u ON u.id = sp.user_id AND u.deleted_at IS NULL").
+				Where("sp.institute_id = ?", instituteID)
+		}
+		err := students().
+			Select("sp.enrollment_year, sp.intake_season, count(*) AS students").
+			Where("coalesce(sp.enrollment_year, 0) > 0").
+			Group("sp.enrollment_year, sp.intake_season").
+			Order("sp.enrollment_year DESC, sp.intake_season").
+			Scan(&counts.Cohorts).Error
+		if err != nil {
+			return nil, err
+		}
+		err = students().Where("coalesce(sp.enrollment_year, 0) = 0").Count(&counts.WithoutCohort).Error
+		return counts, err
+	})
+}
+
+// ListCohortStudents returns a page of the institute's students in the
+// cohort, with their profiles, newest first
+func (r *Repository) ListCohortStudents(instituteID uuid.UUID, cohort core.Cohort, page pagination.Request) ([]core.User, error) {
+	return readOnly(r, func(r *Repository) ([]core.User, error) {
+		query := r.db.Model(&core.User{}).
+			Preload("StudentProfile").
+			Where("users.id IN ("+cohortMembersSQL+")", cohortParams(instituteID, cohort)).
+			Order("users.created_at DESC, users.id DESC").
+			Limit(page.Fetch())
+		if page.After != nil {
+			query = query.Where("(users.created_at, users.id) < (?, ?)", page.After.CreatedAt, page.After.ID)
+		} else {
+			query = query.Offset(page.Offset)
+		}
+		var users []core.User
+		err := query.Find(&users).Error
+		return users, err
+	})
+}
@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeletionBlocker is something below an org unit that keeps it from being
+// deleted without cascade
+type DeletionBlocker struct {
+	Reason string `json:"reason"` // faculties, departments, classes, enrolled_classes or active_admins
+	Count  int64  `json:"count"`
+}
+
+// DeletionReport is what deleting an institute, faculty or department takes
+// with it. The counts cover the units below it, not the unit itself.
+type DeletionReport struct {
+	Unit            core.AnnouncementScope `json:"unit"`
+	ID              uuid.UUID              `json:"id"`
+	Name            string                 `json:"name"`
+	InstituteID     uuid.UUID              `json:"institute_id"`
+	Faculties       int64                  `json:"faculties"`
+	Departments     int64                  `json:"departments"`
+	Classes         int64                  `json:"classes"`
+	EnrolledClasses int64                  `json:"enrolled_classes"` // classes with at least one enrollment
+	Enrollments     int64                  `json:"enrollments"`
+	ActiveAdmins    int64                  `json:"active_admins"`
+	Blockers        []DeletionBlocker      `json:"blockers"`
+	// Tombstone is the record left by the deletion; nil on a dry run
+	Tombstone *core.DeletionTombstone `json:"tombstone,omitempty"`
+
+	// DepartmentIDs are the departments deleted, the unit included
+	DepartmentIDs []uuid.UUID `json:"-"`
+}
+
+// DeletionBlockedError is returned when a unit that still has something
+// below it is deleted without cascade. Nothing is deleted.
+type DeletionBlockedError struct {
+	Report *DeletionReport
+}
+
+func (e *DeletionBlockedError) Error() string {
+	reasons := make([]string, 0, len(e.Report.Blockers))
+	for _, b := range e.Report.Blockers {
+		reasons = append(reasons, fmt.Sprintf("%d %s", b.Count, strings.ReplaceAll(b.Reason, "_", " ")))
+	}
+	return fmt.Sprintf("%s still has %s", e.Report.Unit, strings.Join(reasons, ", "))
+}
+
+// DeleteOptions are the choices a caller makes when deleting an org unit
+type DeleteOptions struct {
+	// Cascade deletes everything below the unit along with it
+	Cascade bool
+	// DryRun only reports what the deletion would take with it
+	DryRun bool
+	// RequestedBy is recorded on the tombstone
+	RequestedBy string
+}
+
+// DeleteOrgUnit soft deletes an institute, faculty or department, together
+// with the faculties, departments and classes below it, and leaves a
+// tombstone. Unless opts.Cascade is set, a unit with anything blocking its
+// deletion is kept and a *DeletionBlockedError returned. Enrollments and
+// admin bindings are kept with the classes and institute they belong to.
+func (r *Repository) DeleteOrgUnit(unit core.AnnouncementScope, id string, opts DeleteOptions) (*DeletionReport, error) {
+	if opts.DryRun {
+		return deletionReport(r.db, unit, id, false)
+	}
+
+	var report *DeletionReport
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// The unit stays locked until commit, so nothing is added directly
+		// below it in the meantime
+		rep, err := deletionReport(tx, unit, id, true)
+		if err != nil {
+			return err
+		}
+		report = rep
+		if len(rep.Blockers) > 0 && !opts.Cascade {
+			return &DeletionBlockedError{Report: rep}
+		}
+
+		tree := unitTree{db: tx, unit: unit, id: rep.ID}
+		if err := tx.Model(&core.Department{}).Where("id IN (?)", tree.departments()).Pluck("id", &rep.DepartmentIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("department_id IN (?)", tree.departments()).Delete(&core.Class{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN (?)", tree.departments()).Delete(&core.Department{}).Error; err != nil {
+			return err
+		}
+		if unit != core.AnnouncementScopeDepartment {
+			if err := tx.Where("id IN (?)", tree.faculties()).Delete(&core.Faculty{}).Error; err != nil {
+				return err
+			}
+		}
+		if unit == core.AnnouncementScopeInstitute {
+			if err := tx.Delete(&core.Institute{}, "id = ?", rep.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		rep.Tombstone = &core.DeletionTombstone{
+			Unit:        string(unit),
+			UnitID:      rep.ID,
+			UnitName:    rep.Name,
+			RequestedBy: opts.RequestedBy,
+			Cascaded:    opts.Cascade,
+			Faculties:   rep.Faculties,
+			Departments: rep.Departments,
+			Classes:     rep.Classes,
+			Enrollments: rep.Enrollments,
+		}
+		return tx.Create(rep.Tombstone).Error
+	})
+	var blocked *DeletionBlockedError
+	if errors.As(err, &blocked) {
+		return report, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// deletionReport counts what lies below the unit and works out what blocks
+// deleting it, locking the unit's row if lock is set
+func deletionReport(db *gorm.DB, unit core.AnnouncementScope, id string, lock bool) (*DeletionReport, error) {
+	report := &DeletionReport{Unit: unit, Blockers: []DeletionBlocker{}}
+	if err := loadDeletionUnit(db, report, id, lock); err != nil {
+		return nil, err
+	}
+	tree := unitTree{db: db, unit: unit, id: report.ID}
+
+	if unit == core.AnnouncementScopeInstitute {
+		if err := db.Model(&core.Faculty{}).Where("id IN (?)", tree.faculties()).Count(&report.Faculties).Error; err != nil {
+			return nil, err
+		}
+		err := db.Table("institute_admin_profiles iap").
+			Joins("JOIN users u ON u.id = iap.user_id").
+			Where("iap.institute_id = ? AND u.deleted_at IS NULL AND u.status = ?", report.ID, "active").
+			Count(&report.ActiveAdmins).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	if unit != core.AnnouncementScopeDepartment {
+		if err := db.Model(&core.Department{}).Where("id IN (?)", tree.departments()).Count(&report.Departments).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := db.Model(&core.Class{}).Where("id IN (?)", tree.classes()).Count(&report.Classes).Error; err != nil {
+		return nil, err
+	}
+	enrollments := func() *gorm.DB {
+		return db.Model(&core.ClassEnrollment{}).Scopes(seated).Where("class_id IN (?)", tree.classes())
+	}
+	if err := enrollments().Count(&report.Enrollments).Error; err != nil {
+		return nil, err
+	}
+	if err := enrollments().Distinct("class_id").Count(&report.EnrolledClasses).Error; err != nil {
+		return nil, err
+	}
+
+	// A unit is blocked by the units directly below it, and by enrolled
+	// students and active admins anywhere below it
+	block := func(reason string, count int64) {
+		if count > 0 {
+			report.Blockers = append(report.Blockers, DeletionBlocker{Reason: reason, Count: count})
+		}
+	}
+	switch unit {
+	case core.AnnouncementScopeInstitute:
+		block("faculties", report.Faculties)
+	case core.AnnouncementScopeFaculty:
+		block("departments", report.Departments)
+	case core.AnnouncementScopeDepartment:
+		block("classes", report.Classes)
+	}
+	block("enrolled_classes", report.EnrolledClasses)
+	block("active_admins", report.ActiveAdmins)
+	return report, nil
+}
+
+// loadDeletionUnit fills in the report's unit ID, name and institute
+func loadDeletionUnit(db *gorm.DB, report *DeletionReport, id string, lock bool) error {
+	q := db
+	if lock {
+		q = db.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var err error
+	switch report.Unit {
+	case core.AnnouncementScopeInstitute:
+		var institute core.Institute
+		if err = q.Select("id, name").First(&institute, "id = ?", id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInstituteNotFound
+		}
+		report.ID, report.Name, report.InstituteID = institute.ID, institute.Name, institute.ID
+	case core.AnnouncementScopeFaculty:
+		var faculty core.Faculty
+		if err = q.Select("id, name, institute_id").First(&faculty, "id = ?", id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFacultyNotFound
+		}
+		report.ID, report.Name, report.InstituteID = faculty.ID, faculty.Name, faculty.InstituteID
+	case core.AnnouncementScopeDepartment:
+		var dept core.Department
+		if err = q.Select("id, name, faculty_id").First(&dept, "id = ?", id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDepartmentNotFound
+		}
+		if err == nil {
+			var institutes []uuid.UUID
+			err = db.Model(&core.Faculty{}).Where("id = ?", dept.FacultyID).Limit(1).Pluck("institute_id", &institutes).Error
+			if len(institutes) > 0 {
+				report.InstituteID = institutes[0]
+			}
+		}
+		report.ID, report.Name = dept.ID, dept.Name
+	default:
+		return errors.New("org unit " + string(report.Unit) + " cannot be deleted this way")
+	}
+	return err
+}
+
+// unitTree selects the IDs of the live faculties, departments and classes at
+// or below an org unit. Each call returns a fresh query, for use as a
+// subquery.
+type unitTree struct {
+	db   *gorm.DB
+	unit core.AnnouncementScope
+	id   uuid.UUID
+}
+
+func (t unitTree) faculties() *gorm.DB {
+	q := t.db.Model(&core.Faculty{}).Select("id")
+	if t.unit == core.AnnouncementScopeInstitute {
+		return q.Where("institute_id = ?", t.id)
+	}
+	return q.Where("id = ?", t.id)
+}
+
+func (t unitTree) departments() *gorm.DB {
+	q := t.db.Model(&core.Department{}).Select("id")
+	if t.unit == core.AnnouncementScopeDepartment {
+		return q.Where("id = ?", t.id)
+	}
+	return q.Where("faculty_id IN (?)", t.faculties())
+}
+
+func (t unitTree) classes() *gorm.DB {
+	return t.db.Model(&core.Class{}).Select("id").Where("department_id IN (?)", t.departments())
+}
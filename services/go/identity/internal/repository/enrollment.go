@@ -0,0 +1,389 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/pkg/events"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EnrollmentResult says whether the student got a seat or was put on the
+// waitlist, and how full the class and their section are afterwards
+type EnrollmentResult struct {
+	Enrolled          bool                     `json:"enrolled"`
+	WaitlistEntry     *core.ClassWaitlistEntry `json:"waitlist_entry,omitempty"`
+	SeatsTaken        int64                    `json:"seats_taken"`
+	Capacity          *int                     `json:"capacity"`
+	SectionID         uuid.UUID                `json:"section_id"`
+	SectionSeatsTaken int64                    `json:"section_seats_taken"`
+	SectionCapacity   *int                     `json:"section_capacity"`
+}
+
+// EnrollOptions are the choices a caller makes when enrolling a student
+type EnrollOptions struct {
+	// Waitlist adds the student to the waitlist of a full class
+	Waitlist bool
+	// Today is the date checked against the end of the class's term
+	Today time.Time
+	// IgnoreTermEnd allows enrolling after the class's term has ended
+	IgnoreTermEnd bool
+}
+
+// EnrollStudent enrolls a student into enrollment.SectionID, or the class's
+// default section if that is unset, if both the class and the section have a
+// free seat. A full class returns ErrClassFull and a full section
+// ErrSectionFull, or either adds the student to the end of the waitlist when
+// opts.Waitlist is set. A class whose term ended before opts.Today returns
+// ErrTermEnded unless opts.IgnoreTermEnd is set.
+func (r *Repository) EnrollStudent(enrollment *core.ClassEnrollment, opts EnrollOptions) (*EnrollmentResult, error) {
+	var result *EnrollmentResult
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		class, err := lockClass(tx, enrollment.ClassID)
+		if err != nil {
+			return err
+		}
+		// A class under a deleted department, faculty or institute takes no
+		// one, even if its own row was left live
+		if err := lockLiveUnit(liveDepartments(tx), class.DepartmentID, ErrClassNotFound); err != nil {
+			return err
+		}
+
+		if class.TermID != nil && !opts.IgnoreTermEnd {
+			ended, err := termEnded(tx, *class.TermID, opts.Today)
+			if err != nil {
+				return err
+			}
+			if ended {
+				return ErrTermEnded
+			}
+		}
+
+		section, err := enrollmentSection(tx, class.ID, enrollment.SectionID)
+		if err != nil {
+			return err
+		}
+		enrollment.SectionID = section.ID
+
+		var enrolled int64
+		err = tx.Model(&core.ClassEnrollment{}).Scopes(seated).
+			Where("class_id = ? AND student_id = ?", enrollment.ClassID, enrollment.StudentID).
+			Count(&enrolled).Error
+		if err != nil {
+			return err
+		}
+		if enrolled > 0 {
+			return ErrAlreadyEnrolled
+		}
+
+		taken, err := countSeats(tx, class.ID)
+		if err != nil {
+			return err
+		}
+		sectionTaken, err := countSectionSeats(tx, section.ID)
+		if err != nil {
+			return err
+		}
+		result = &EnrollmentResult{
+			SeatsTaken:        taken,
+			Capacity:          class.Capacity,
+			SectionID:         section.ID,
+			SectionSeatsTaken: sectionTaken,
+			SectionCapacity:   section.Capacity,
+		}
+
+		var full error
+		if class.Capacity != nil && taken >= int64(*class.Capacity) {
+			full = ErrClassFull
+		} else if section.Capacity != nil && sectionTaken >= int64(*section.Capacity) {
+			full = ErrSectionFull
+		}
+		if full != nil {
+			if !opts.Waitlist {
+				return full
+			}
+			result.WaitlistEntry, err = addToWaitlist(tx, class.ID, section.ID, enrollment.StudentID)
+			return err
+		}
+
+		if err := createEnrollment(tx, enrollment); err != nil {
+			return err
+		}
+		// Getting a seat directly gives up any place on the waitlist
+		err = tx.Where("class_id = ? AND student_id = ?", class.ID, enrollment.StudentID).
+			Delete(&core.ClassWaitlistEntry{}).Error
+		if err != nil {
+			return err
+		}
+		result.Enrolled = true
+		result.SeatsTaken++
+		result.SectionSeatsTaken++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UnenrollStudent removes a student from a class, or from its waitlist if
+// they were only waiting, along with any request they made to join it. A
+// freed seat goes to the head of the waitlist.
+func (r *Repository) UnenrollStudent(classID, studentID string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		cID, err := uuid.Parse(classID)
+		if err != nil {
+			return ErrClassNotFound
+		}
+		class, err := lockClass(tx, cID)
+		if err != nil {
+			return err
+		}
+
+		res := tx.Where("class_id = ? AND student_id = ?", classID, studentID).Delete(&core.ClassEnrollment{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return tx.Where("class_id = ? AND student_id = ?", classID, studentID).
+				Delete(&core.ClassWaitlistEntry{}).Error
+		}
+		_, err = promoteWaitlist(tx, class)
+		return err
+	})
+}
+
+// ClassSeats returns how many students are enrolled in a class and its
+// capacity (nil for unlimited)
+func (r *Repository) ClassSeats(classID string) (int64, *int, error) {
+	var class core.Class
+	err := r.db.Select("id", "capacity").First(&class, "id = ?", classID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil, ErrClassNotFound
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	taken, err := countSeats(r.db, class.ID)
+	return taken, class.Capacity, err
+}
+
+// IsEnrolled reports whether the student holds a seat in the class
+func (r *Repository) IsEnrolled(classID, studentID uuid.UUID) (bool, error) {
+	var enrolled int64
+	err := r.db.Model(&core.ClassEnrollment{}).Scopes(seated).
+		Where("class_id = ? AND student_id = ?", classID, studentID).
+		Count(&enrolled).Error
+	return enrolled > 0, err
+}
+
+// GetEnrollment returns the student's seat in the class
+func (r *Repository) GetEnrollment(classID, studentID uuid.UUID) (*core.ClassEnrollment, error) {
+	var enrollment core.ClassEnrollment
+	err := r.db.Scopes(seated).Where("class_id = ? AND student_id = ?", classID, studentID).First(&enrollment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// GetClassWaitlist returns a class's waitlist in promotion order
+func (r *Repository) GetClassWaitlist(classID string) ([]core.ClassWaitlistEntry, error) {
+	var entries []core.ClassWaitlistEntry
+	err := r.db.Preload("Student").Where("class_id = ?", classID).Order("position").Find(&entries).Error
+	return entries, err
+}
+
+// lockClass reads a class FOR UPDATE. Every change to a class's enrollments
+// or waitlist takes this lock first, so concurrent enrollments are counted
+// one at a time and cannot oversubscribe it.
+func lockClass(tx *gorm.DB, classID uuid.UUID) (*core.Class, error) {
+	var class core.Class
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&class, "id = ?", classID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrClassNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &class, nil
+}
+
+// seated limits a query of class_enrollments to the students holding a seat,
+// leaving out pending and rejected requests to join
+func seated(db *gorm.DB) *gorm.DB {
+	return db.Where("class_enrollments.status = ?", core.EnrollmentEnrolled)
+}
+
+func countSeats(tx *gorm.DB, classID uuid.UUID) (int64, error) {
+	var taken int64
+	err := tx.Model(&core.ClassEnrollment{}).Scopes(seated).Where("class_id = ?", classID).Count(&taken).Error
+	return taken, err
+}
+
+func countSectionSeats(tx *gorm.DB, sectionID uuid.UUID) (int64, error) {
+	var taken int64
+	err := tx.Model(&core.ClassEnrollment{}).Scopes(seated).Where("section_id = ?", sectionID).Count(&taken).Error
+	return taken, err
+}
+
+// sectionSeats counts the students in each section of a class
+func sectionSeats(tx *gorm.DB, classID uuid.UUID) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		SectionID uuid.UUID
+		Taken     int64
+	}
+	err := tx.Model(&core.ClassEnrollment{}).Scopes(seated).
+		Select("section_id, COUNT(*) AS taken").
+		Where("class_id = ?", classID).
+		Group("section_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	seats := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		seats[row.SectionID] = row.Taken
+	}
+	return seats, nil
+}
+
+// createEnrollment gives the student a seat, taking over any request they
+// made to join the class. The caller must have checked they are not already
+// enrolled.
+func createEnrollment(tx *gorm.DB, enrollment *core.ClassEnrollment) error {
+	if enrollment.EnrolledAt.IsZero() {
+		enrollment.EnrolledAt = time.Now()
+	}
+	enrollment.Status = core.EnrollmentEnrolled
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "student_id"}, {Name: "class_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"section_id", "enrolled_at", "status", "decided_by", "decided_at"}),
+	}).Create(enrollment).Error
+	if err != nil {
+		return err
+	}
+	return enrollmentCreated(tx, enrollment)
+}
+
+// enrollmentCreated records in the outbox that the student got a seat
+func enrollmentCreated(tx *gorm.DB, enrollment *core.ClassEnrollment) error {
+	return enqueueEvent(tx, events.TypeEnrollmentCreated, enrollment.ClassID.String()+":"+enrollment.StudentID.String(), events.EnrollmentCreated{
+		ClassID:   enrollment.ClassID.String(),
+		SectionID: enrollment.SectionID.String(),
+		StudentID: enrollment.StudentID.String(),
+	})
+}
+
+// addToWaitlist appends a student to the waitlist for a section, or returns
+// their existing entry if they are already on it, keeping their place but
+// switching it to sectionID. The caller must hold the class lock.
+func addToWaitlist(tx *gorm.DB, classID, sectionID, studentID uuid.UUID) (*core.ClassWaitlistEntry, error) {
+	var entry core.ClassWaitlistEntry
+	err := tx.Where("class_id = ? AND student_id = ?", classID, studentID).First(&entry).Error
+	if err == nil {
+		if entry.SectionID != sectionID {
+			entry.SectionID = sectionID
+			if err := tx.Model(&entry).Update("section_id", sectionID).Error; err != nil {
+				return nil, err
+			}
+		}
+		return &entry, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var last int
+	err = tx.Model(&core.ClassWaitlistEntry{}).Where("class_id = ?", classID).
+		Select("COALESCE(MAX(position), 0)").Scan(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	entry = core.ClassWaitlistEntry{ClassID: classID, SectionID: sectionID, StudentID: studentID, Position: last + 1}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// promoteWaitlist enrolls students from the head of the waitlist into any
+// free seats and returns how many were promoted. A student whose section is
+// full keeps their place while those behind them waiting for other sections
+// move up. The caller must hold the class lock.
+func promoteWaitlist(tx *gorm.DB, class *core.Class) (int, error) {
+	free := int64(-1) // unlimited
+	if class.Capacity != nil {
+		taken, err := countSeats(tx, class.ID)
+		if err != nil {
+			return 0, err
+		}
+		free = int64(*class.Capacity) - taken
+		if free <= 0 {
+			return 0, nil
+		}
+	}
+
+	var entries []core.ClassWaitlistEntry
+	if err := tx.Where("class_id = ?", class.ID).Order("position").Find(&entries).Error; err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	sectionFree, err := sectionFreeSeats(tx, class.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for _, entry := range entries {
+		if free == 0 {
+			break
+		}
+		left, limited := sectionFree[entry.SectionID]
+		if limited && left <= 0 {
+			continue
+		}
+		enrollment := &core.ClassEnrollment{ClassID: entry.ClassID, SectionID: entry.SectionID, StudentID: entry.StudentID}
+		if err := createEnrollment(tx, enrollment); err != nil {
+			return 0, err
+		}
+		if err := tx.Delete(&entry).Error; err != nil {
+			return 0, err
+		}
+		promoted++
+		if free > 0 {
+			free--
+		}
+		if limited {
+			sectionFree[entry.SectionID] = left - 1
+		}
+	}
+	return promoted, nil
+}
+
+// sectionFreeSeats returns the free seats of each section of a class that
+// has a capacity; sections without one are left out
+func sectionFreeSeats(tx *gorm.DB, classID uuid.UUID) (map[uuid.UUID]int64, error) {
+	var sections []core.ClassSection
+	err := tx.Select("id", "capacity").Where("class_id = ? AND capacity IS NOT NULL", classID).Find(&sections).Error
+	if err != nil {
+		return nil, err
+	}
+	seats, err := sectionSeats(tx, classID)
+	if err != nil {
+		return nil, err
+	}
+	free := make(map[uuid.UUID]int64, len(sections))
+	for _, section := range sections {
+		free[section.ID] = int64(*section.Capacity) - seats[section.ID]
+	}
+	return free, nil
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrEnrollmentRequestNotFound = errors.New("student has no pending request to join this class")
+
+// RequestEnrollment records a student's request to join a class, in
+// request.SectionID or the class's default section if that is unset. It
+// holds no seat, so a full class still takes requests; capacity is checked
+// when one is approved. A student who already asked gets their existing
+// request back, pending or rejected, and created is false. A student who
+// holds a seat gets ErrAlreadyEnrolled, and a class whose term ended before
+// today ErrTermEnded.
+func (r *Repository) RequestEnrollment(request *core.ClassEnrollment, today time.Time) (created bool, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		class, err := lockClass(tx, request.ClassID)
+		if err != nil {
+			return err
+		}
+		if err := lockLiveUnit(liveDepartments(tx), class.DepartmentID, ErrClassNotFound); err != nil {
+			return err
+		}
+
+		var existing core.ClassEnrollment
+		err = tx.Where("class_id = ? AND student_id = ?", request.ClassID, request.StudentID).First(&existing).Error
+		if err == nil {
+			if existing.Status == core.EnrollmentEnrolled {
+				return ErrAlreadyEnrolled
+			}
+			*request = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if class.TermID != nil {
+			ended, err := termEnded(tx, *class.TermID, today)
+			if err != nil {
+				return err
+			}
+			if ended {
+				return ErrTermEnded
+			}
+		}
+		section, err := enrollmentSection(tx, class.ID, request.SectionID)
+		if err != nil {
+			return err
+		}
+		request.SectionID = section.ID
+		request.Status = core.EnrollmentPending
+		request.EnrolledAt = time.Now()
+		created = true
+		return tx.Create(request).Error
+	})
+	return created, err
+}
+
+// GetEnrollmentRequests returns the pending requests to join a class, oldest
+// first
+func (r *Repository) GetEnrollmentRequests(classID uuid.UUID) ([]core.ClassEnrollment, error) {
+	requests := []core.ClassEnrollment{}
+	err := r.db.Preload("Student").
+		Where("class_id = ? AND status = ?", classID, core.EnrollmentPending).
+		Order("enrolled_at").
+		Find(&requests).Error
+	return requests, err
+}
+
+// ApproveEnrollmentRequest gives the student of a pending request a seat in
+// the section they asked for, if both it and the class have one free. A full
+// class returns ErrClassFull and a full section ErrSectionFull, leaving the
+// request pending, and so does a class whose term ended before today, with
+// ErrTermEnded.
+func (r *Repository) ApproveEnrollmentRequest(classID, studentID, deciderID uuid.UUID, today time.Time) (*core.ClassEnrollment, error) {
+	var enrollment core.ClassEnrollment
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		class, err := lockClass(tx, classID)
+		if err != nil {
+			return err
+		}
+		if err := lockLiveUnit(liveDepartments(tx), class.DepartmentID, ErrClassNotFound); err != nil {
+			return err
+		}
+		if err := pendingRequest(tx, classID, studentID, &enrollment); err != nil {
+			return err
+		}
+
+		if class.TermID != nil {
+			ended, err := termEnded(tx, *class.TermID, today)
+			if err != nil {
+				return err
+			}
+			if ended {
+				return ErrTermEnded
+			}
+		}
+		section, err := enrollmentSection(tx, classID, enrollment.SectionID)
+		if err != nil {
+			return err
+		}
+		if class.Capacity != nil {
+			taken, err := countSeats(tx, classID)
+			if err != nil {
+				return err
+			}
+			if taken >= int64(*class.Capacity) {
+				return ErrClassFull
+			}
+		}
+		if section.Capacity != nil {
+			taken, err := countSectionSeats(tx, section.ID)
+			if err != nil {
+				return err
+			}
+			if taken >= int64(*section.Capacity) {
+				return ErrSectionFull
+			}
+		}
+
+		now := time.Now()
+		enrollment.EnrolledAt = now
+		enrollment.DecidedBy = &deciderID
+		enrollment.DecidedAt = &now
+		if err := createEnrollment(tx, &enrollment); err != nil {
+			return err
+		}
+		// As when enrolled directly, the seat replaces a place on the waitlist
+		return tx.Where("class_id = ? AND student_id = ?", classID, studentID).
+			Delete(&core.ClassWaitlistEntry{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// RejectEnrollmentRequest turns down a pending request. The rejected request
+// is kept, so asking again returns it rather than making a new one.
+func (r *Repository) RejectEnrollmentRequest(classID, studentID, deciderID uuid.UUID) (*core.ClassEnrollment, error) {
+	var enrollment core.ClassEnrollment
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockClass(tx, classID); err != nil {
+			return err
+		}
+		if err := pendingRequest(tx, classID, studentID, &enrollment); err != nil {
+			return err
+		}
+		now := time.Now()
+		enrollment.Status = core.EnrollmentRejected
+		enrollment.DecidedBy = &deciderID
+		enrollment.DecidedAt = &now
+		return tx.Model(&core.ClassEnrollment{}).
+			Where("class_id = ? AND student_id = ?", classID, studentID).
+			Updates(map[string]interface{}{"status": enrollment.Status, "decided_by": deciderID, "decided_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// pendingRequest loads the student's pending request to join the class into
+// dst. The caller must hold the class lock.
+func pendingRequest(tx *gorm.DB, classID, studentID uuid.UUID, dst *core.ClassEnrollment) error {
+	err := tx.Where("class_id = ? AND student_id = ? AND status = ?", classID, studentID, core.EnrollmentPending).
+		First(dst).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrEnrollmentRequestNotFound
+	}
+	return err
+}
+
+// TeachesClass reports whether the user is the instructor of any section of
+// the class
+func (r *Repository) TeachesClass(classID, userID uuid.UUID) (bool, error) {
+	var sections int64
+	err := r.db.Model(&core.ClassSection{}).
+		Where("class_id = ? AND instructor_id = ?", classID, userID).
+		Count(&sections).Error
+	return sections > 0, err
+}
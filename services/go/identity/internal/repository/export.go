@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/pkg/events"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrExportJobNotFound = errors.New("export job not found")
+
+// UserRecords is everything the identity database holds about one user
+type UserRecords struct {
+	User              *core.User                  `json:"user"`
+	InstituteAdminOf  []AdminMembership           `json:"institute_admin_of"`
+	Enrollments       []EnrollmentRecord          `json:"enrollments"`
+	Waitlist          []WaitlistRecord            `json:"waitlist"`
+	HeadOf            []HeadRecord                `json:"head_of"`
+	MembershipHistory []MembershipEvent           `json:"membership_history"`
+	Merges            []core.UserMerge            `json:"merges"`
+	LoginHistory      []core.LoginEvent           `json:"login_history"`
+	PolicyAcceptances []core.UserPolicyAcceptance `json:"policy_acceptances"`
+}
+
+type AdminMembership struct {
+	InstituteID   uuid.UUID          `json:"institute_id"`
+	InstituteName string             `json:"institute_name"`
+	Role          core.InstituteRole `json:"role"`
+}
+
+// EnrollmentRecord is a class enrollment with the names of the org units
+// above the class
+type EnrollmentRecord struct {
+	ClassID        uuid.UUID `json:"class_id"`
+	ClassName      string    `json:"class_name"`
+	DepartmentID   uuid.UUID `json:"department_id"`
+	DepartmentName string    `json:"department_name"`
+	FacultyID      uuid.UUID `json:"faculty_id"`
+	FacultyName    string    `json:"faculty_name"`
+	InstituteID    uuid.UUID `json:"institute_id"`
+	InstituteName  string    `json:"institute_name"`
+	EnrolledAt     time.Time `json:"enrolled_at"`
+	// Status is enrolled, or pending or rejected for a request to join
+	Status core.EnrollmentStatus `json:"status"`
+}
+
+type WaitlistRecord struct {
+	ClassID   uuid.UUID `json:"class_id"`
+	ClassName string    `json:"class_name"`
+	Position  int       `json:"position"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+// HeadRecord is a faculty or department the user is head of
+type HeadRecord struct {
+	Unit string    `json:"unit"` // faculty or department
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// MembershipEvent is an enrollment, admin appointment or merge recorded in
+// the outbox. Unlike the current memberships above, it still lists
+// memberships that have since ended.
+type MembershipEvent struct {
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Details    json.RawMessage `json:"details"`
+}
+
+// GetUserRecords collects the user's identity data for an export. Only rows
+// that reference the user are read, so other users' data (including
+// soft-deleted accounts) never ends up in the export.
+func (r *Repository) GetUserRecords(userID string) (*UserRecords, error) {
+	return readOnly(r, func(r *Repository) (*UserRecords, error) {
+		return r.getUserRecords(userID)
+	})
+}
+
+func (r *Repository) getUserRecords(userID string) (*UserRecords, error) {
+	var user core.User
+	err := r.db.
+		Preload("StudentProfile").
+		Preload("InstructorProfile").
+		Scopes(preloadInstitutes).
+		Where("id = ?", userID).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := &UserRecords{
+		User:              &user,
+		InstituteAdminOf:  []AdminMembership{},
+		Enrollments:       []EnrollmentRecord{},
+		Waitlist:          []WaitlistRecord{},
+		HeadOf:            []HeadRecord{},
+		MembershipHistory: []MembershipEvent{},
+		Merges:            []core.UserMerge{},
+	}
+
+	err = r.db.Raw(`SELECT i.id AS institute_id, i.name AS institute_name, iap.role
+		FROM institute_admin_profiles iap JOIN institutes i ON i.id = iap.institute_id
+		WHERE iap.user_id = ? ORDER BY i.name`, userID).Scan(&records.InstituteAdminOf).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Raw(`SELECT c.id AS class_id, c.name AS class_name,
+			d.id AS department_id, d.name AS department_name,
+			f.id AS faculty_id, f.name AS faculty_name,
+			i.id AS institute_id, i.name AS institute_name,
+			ce.enrolled_at, ce.status
+		FROM class_enrollments ce
+			JOIN classes c ON c.id = ce.class_id
+			JOIN departments d ON d.id = c.department_id
+			JOIN faculties f ON f.id = d.faculty_id
+			JOIN institutes i ON i.id = f.institute_id
+		WHERE ce.student_id = ? ORDER BY ce.enrolled_at`, userID).Scan(&records.Enrollments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Raw(`SELECT c.id AS class_id, c.name AS class_name, w.position, w.created_at AS joined_at
+		FROM class_waitlist_entries w JOIN classes c ON c.id = w.class_id
+		WHERE w.student_id = ? ORDER BY w.created_at`, userID).Scan(&records.Waitlist).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Raw(`SELECT 'faculty' AS unit, id, name FROM faculties WHERE head_user_id = @user
+		UNION ALL
+		SELECT 'department' AS unit, id, name FROM departments WHERE head_user_id = @user`,
+		map[string]interface{}{"user": userID}).Scan(&records.HeadOf).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var history []struct {
+		EventType string
+		CreatedAt time.Time
+		Payload   string
+	}
+	err = r.db.Model(&core.OutboxEvent{}).
+		Select("event_type, created_at, payload").
+		Where("event_type IN ?", []string{events.TypeEnrollmentCreated, events.TypeInstituteAdminAdded, events.TypeUserMerged}).
+		Where(`payload->>'student_id' = @user OR payload->>'user_id' = @user
+			OR payload->>'primary_user_id' = @user OR payload->>'duplicate_user_id' = @user`,
+			map[string]interface{}{"user": userID}).
+		Order("seq ASC").
+		Scan(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range history {
+		records.MembershipHistory = append(records.MembershipHistory, MembershipEvent{
+			Type:       e.EventType,
+			OccurredAt: e.CreatedAt,
+			Details:    json.RawMessage(e.Payload),
+		})
+	}
+
+	err = r.db.Where("primary_user_id = ? OR duplicate_user_id = ?", userID, userID).
+		Order("created_at ASC").
+		Find(&records.Merges).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if records.LoginHistory, err = r.GetLoginHistory(userID); err != nil {
+		return nil, err
+	}
+	if records.PolicyAcceptances, err = r.GetPolicyAcceptances(user.ID); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// CreateExportJob queues an export of the user's data, or returns the export
+// already pending or running for them
+func (r *Repository) CreateExportJob(userID uuid.UUID, requestedBy string) (*core.ExportJob, error) {
+	var job *core.ExportJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user so parallel requests queue a single job
+		var user core.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", userID).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var existing core.ExportJob
+		err = tx.Omit("document").
+			Where("user_id = ? AND status IN ?", userID, []core.ExportStatus{core.ExportPending, core.ExportRunning}).
+			Order("created_at DESC").
+			First(&existing).Error
+		if err == nil {
+			job = &existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		job = &core.ExportJob{UserID: userID, RequestedBy: requestedBy, Status: core.ExportPending}
+		return tx.Create(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetExportJob returns a job including its document
+func (r *Repository) GetExportJob(id uuid.UUID) (*core.ExportJob, error) {
+	var job core.ExportJob
+	err := r.db.Where("id = ?", id).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExportJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimExportJob marks the oldest pending job as running and returns it, or
+// nil if there is none. Jobs left running for longer than staleAfter, e.g. by
+// a worker that crashed, are claimed again. SKIP LOCKED keeps several workers
+// from claiming the same job.
+func (r *Repository) ClaimExportJob(staleAfter time.Duration) (*core.ExportJob, error) {
+	var job *core.ExportJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var candidate core.ExportJob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Omit("document").
+			Where("status = ? OR (status = ? AND started_at < ?)", core.ExportPending, core.ExportRunning, time.Now().Add(-staleAfter)).
+			Order("created_at ASC").
+			First(&candidate).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		candidate.Status = core.ExportRunning
+		candidate.StartedAt = &now
+		if err := tx.Model(&core.ExportJob{}).Where("id = ?", candidate.ID).Updates(map[string]interface{}{
+			"status":     core.ExportRunning,
+			"started_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		job = &candidate
+		return nil
+	})
+	return job, err
+}
+
+// CompleteExportJob stores the finished document
+func (r *Repository) CompleteExportJob(id uuid.UUID, document []byte) error {
+	return r.db.Model(&core.ExportJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       core.ExportDone,
+		"document":     string(document),
+		"error":        "",
+		"completed_at": time.Now(),
+	}).Error
+}
+
+// FailExportJob records why a job could not be completed
+func (r *Repository) FailExportJob(id uuid.UUID, reason string) error {
+	return r.db.Model(&core.ExportJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       core.ExportFailed,
+		"error":        reason,
+		"completed_at": time.Now(),
+	}).Error
+}
+
+// PurgeExportJobs deletes finished jobs, and with them the exported
+// personal data, completed before cutoff
+func (r *Repository) PurgeExportJobs(cutoff time.Time) (int64, error) {
+	res := r.db.Where("status IN ? AND completed_at < ?", []core.ExportStatus{core.ExportDone, core.ExportFailed}, cutoff).
+		Delete(&core.ExportJob{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrFeatureFlagNotFound = errors.New("feature flag not found")
+	ErrFeatureFlagExists   = errors.New("feature flag already exists")
+	ErrOverrideNotFound    = errors.New("institute has no override for this feature flag")
+)
+
+// CreateFeatureFlag adds a flag; a key already in use returns
+// ErrFeatureFlagExists
+func (r *Repository) CreateFeatureFlag(flag *core.FeatureFlag) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(flag)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeatureFlagExists
+	}
+	return nil
+}
+
+// UpdateFeatureFlag saves the description and default of a flag
+func (r *Repository) UpdateFeatureFlag(flag *core.FeatureFlag) error {
+	result := r.db.Model(flag).Select("description", "default_on", "updated_at").Updates(flag)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeatureFlagNotFound
+	}
+	return nil
+}
+
+// DeleteFeatureFlag deletes a flag together with every institute's override
+// of it
+func (r *Repository) DeleteFeatureFlag(key string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key = ?", key).Delete(&core.InstituteFeatureOverride{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("key = ?", key).Delete(&core.FeatureFlag{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrFeatureFlagNotFound
+		}
+		return nil
+	})
+}
+
+func (r *Repository) GetFeatureFlag(key string) (*core.FeatureFlag, error) {
+	var flag core.FeatureFlag
+	err := r.db.First(&flag, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFeatureFlagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// ListFeatureFlags returns every flag by key
+func (r *Repository) ListFeatureFlags() ([]core.FeatureFlag, error) {
+	flags := []core.FeatureFlag{}
+	err := r.db.Order("key").Find(&flags).Error
+	return flags, err
+}
+
+// SetFeatureOverride switches a flag on or off for an institute, replacing
+// any override it had
+func (r *Repository) SetFeatureOverride(override *core.InstituteFeatureOverride) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "institute_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(override).Error
+}
+
+// DeleteFeatureOverride puts an institute back on the flag's default
+func (r *Repository) DeleteFeatureOverride(instituteID uuid.UUID, key string) error {
+	result := r.db.Where("institute_id = ? AND key = ?", instituteID, key).Delete(&core.InstituteFeatureOverride{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOverrideNotFound
+	}
+	return nil
+}
+
+// GetFeatureOverrides returns the overrides of an institute by key
+func (r *Repository) GetFeatureOverrides(instituteID uuid.UUID) ([]core.InstituteFeatureOverride, error) {
+	overrides := []core.InstituteFeatureOverride{}
+	err := r.db.Where("institute_id = ?", instituteID).Order("key").Find(&overrides).Error
+	return overrides, err
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrGuardianLinkNotFound = errors.New("guardian link not found")
+	ErrGuardianLinkExists   = errors.New("guardian is already linked to this student")
+)
+
+// CreateGuardianLink stores a new link. A guardian and student who already
+// have a link that is not revoked get ErrGuardianLinkExists.
+func (r *Repository) CreateGuardianLink(link *core.GuardianLink) error {
+	err := r.db.Create(link).Error
+	if isUniqueViolation(err, "idx_guardian_links_open") {
+		return ErrGuardianLinkExists
+	}
+	return err
+}
+
+// GetGuardianLink returns a link, revoked or not
+func (r *Repository) GetGuardianLink(id uuid.UUID) (*core.GuardianLink, error) {
+	var link core.GuardianLink
+	err := r.db.First(&link, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGuardianLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetStudentGuardianLinks returns every link of the student, revoked ones
+// included, oldest first, each with its guardian
+func (r *Repository) GetStudentGuardianLinks(studentID uuid.UUID) ([]core.GuardianLink, error) {
+	links := []core.GuardianLink{}
+	err := r.db.Preload("Guardian").
+		Where("student_user_id = ?", studentID).
+		Order("created_at").
+		Find(&links).Error
+	return links, err
+}
+
+// RevokeGuardianLink revokes a link, which then grants nothing. Revoking a
+// revoked link returns it unchanged.
+func (r *Repository) RevokeGuardianLink(id, revokedBy uuid.UUID) (*core.GuardianLink, error) {
+	now := time.Now()
+	err := r.db.Model(&core.GuardianLink{}).
+		Where("id = ? AND status <> ?", id, core.GuardianLinkRevoked).
+		Updates(map[string]interface{}{
+			"status":     core.GuardianLinkRevoked,
+			"revoked_by": revokedBy,
+			"revoked_at": now,
+			"updated_at": now,
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.GetGuardianLink(id)
+}
+
+// ActivateGuardianLinks makes the guardian's invited links active, once they
+// have confirmed their email, and returns how many there were
+func (r *Repository) ActivateGuardianLinks(guardianID uuid.UUID) (int64, error) {
+	res := r.db.Model(&core.GuardianLink{}).
+		Where("guardian_user_id = ? AND status = ?", guardianID, core.GuardianLinkInvited).
+		Updates(map[string]interface{}{"status": core.GuardianLinkActive, "updated_at": time.Now()})
+	return res.RowsAffected, res.Error
+}
+
+// GetGuardianStudents returns the students the guardian has an active link
+// to, by name. It reads the primary, never the replica, so a revoked link
+// stops counting as soon as the revocation returns.
+func (r *Repository) GetGuardianStudents(guardianID uuid.UUID) ([]core.User, error) {
+	students := []core.User{}
+	err := r.db.Preload("StudentProfile").
+		Joins("JOIN guardian_links gl ON gl.student_user_id = users.id").
+		Where("gl.guardian_user_id = ? AND gl.status = ?", guardianID, core.GuardianLinkActive).
+		Order("users.full_name, users.id").
+		Find(&students).Error
+	return students, err
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInstituteAdminNotFound = errors.New("user is not an admin of this institute")
+	ErrAlreadyInstituteAdmin  = errors.New("user is already an admin of this institute")
+	// ErrLastInstituteOwner blocks removing or demoting an institute's only owner
+	ErrLastInstituteOwner = errors.New("institute must keep at least one owner")
+)
+
+// instituteBindings selects admin profiles together with their institute's
+// name, leaving out those of deleted institutes
+func instituteBindings(db *gorm.DB) *gorm.DB {
+	return db.Select("institute_admin_profiles.*, institutes.name AS institute_name").
+		Joins("JOIN institutes ON institutes.id = institute_admin_profiles.institute_id AND institutes.deleted_at IS NULL").
+		Order("institutes.name")
+}
+
+// preloadInstitutes loads a user's institute bindings with institute names
+func preloadInstitutes(db *gorm.DB) *gorm.DB {
+	return db.Preload("InstituteAdminProfiles", instituteBindings)
+}
+
+// GetInstituteBindings returns the institutes a user administers and their
+// role in each, ordered by institute name
+func (r *Repository) GetInstituteBindings(userID string) ([]core.InstituteAdminProfile, error) {
+	bindings := []core.InstituteAdminProfile{}
+	err := instituteBindings(r.db).Where("institute_admin_profiles.user_id = ?", userID).Find(&bindings).Error
+	return bindings, err
+}
+
+// UpdateInstituteAdminRole changes an admin's role in one institute. Demoting
+// the last owner returns ErrLastInstituteOwner.
+func (r *Repository) UpdateInstituteAdminRole(instituteID, userID uuid.UUID, role core.InstituteRole) (*core.InstituteAdminProfile, error) {
+	var profile *core.InstituteAdminProfile
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		profile, err = lockInstituteAdmin(tx, instituteID, userID)
+		if err != nil {
+			return err
+		}
+		if profile.Role == role {
+			return nil
+		}
+		if profile.Role == core.InstituteRoleOwner {
+			if err := requireAnotherOwner(tx, instituteID, userID); err != nil {
+				return err
+			}
+		}
+		profile.Role = role
+		return tx.Model(&core.InstituteAdminProfile{}).
+			Where("user_id = ? AND institute_id = ?", userID, instituteID).
+			Update("role", role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// lockInstituteAdmin locks the institute, so owner changes to it run one at
+// a time, and returns the user's binding to it
+func lockInstituteAdmin(tx *gorm.DB, instituteID, userID uuid.UUID) (*core.InstituteAdminProfile, error) {
+	var institute core.Institute
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", instituteID).First(&institute).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInstituteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var profile core.InstituteAdminProfile
+	err = tx.Where("user_id = ? AND institute_id = ?", userID, instituteID).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInstituteAdminNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// requireAnotherOwner returns ErrLastInstituteOwner unless the institute has
+// an owner other than userID
+func requireAnotherOwner(tx *gorm.DB, instituteID, userID uuid.UUID) error {
+	var owners int64
+	err := tx.Model(&core.InstituteAdminProfile{}).
+		Where("institute_id = ? AND role = ? AND user_id <> ?", instituteID, core.InstituteRoleOwner, userID).
+		Count(&owners).Error
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastInstituteOwner
+	}
+	return nil
+}
+
+// backfillInstituteOwners makes every admin of an institute without an owner
+// an owner. Admins added before roles existed all had the same rights, so
+// none of them is demoted by this.
+func backfillInstituteOwners(db *gorm.DB) error {
+	return db.Exec(`UPDATE institute_admin_profiles p SET role = ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM institute_admin_profiles o WHERE o.institute_id = p.institute_id AND o.role = ?)`,
+		core.InstituteRoleOwner, core.InstituteRoleOwner).Error
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// exportMembersSQL selects the IDs of the users an institute's export
+// covers: its members as search finds them, and the instructors teaching a
+// section of one of its classes
+const exportMembersSQL = instituteMembersSQL + `
+	UNION
+	SELECT cs.instructor_id FROM class_sections cs
+		JOIN classes c ON c.id = cs.class_id
+		JOIN departments d ON d.id = c.department_id
+		JOIN faculties f ON f.id = d.faculty_id
+		WHERE f.institute_id = @institute AND c.deleted_at IS NULL AND cs.instructor_id IS NOT NULL`
+
+// UserExportFilter picks the users of an institute an export covers
+type UserExportFilter struct {
+	InstituteID uuid.UUID
+	// UserType is empty for users of every type
+	UserType core.UserType
+	// ModifiedSince, if set, leaves out users last updated before it
+	ModifiedSince *time.Time
+}
+
+// UserExportCursor is the last user of a batch, after which the next batch
+// starts
+type UserExportCursor struct {
+	UpdatedAt time.Time
+	ID        uuid.UUID
+}
+
+// ExportedUser is a user with their profile and what they hold in the
+// exported institute
+type ExportedUser struct {
+	core.User
+	// Enrollments are in the institute's classes, requests to join included
+	Enrollments []EnrollmentSummary
+	// InstituteRole is empty unless they are an admin of the institute
+	InstituteRole core.InstituteRole
+}
+
+type EnrollmentSummary struct {
+	StudentID  uuid.UUID
+	ClassID    uuid.UUID
+	ClassName  string
+	SectionID  uuid.UUID
+	Status     core.EnrollmentStatus
+	EnrolledAt time.Time
+}
+
+// ExportUsersBatch returns up to limit of the filter's users after cursor,
+// or from the start if cursor is nil, ordered by (updated_at, id). Each
+// batch is one keyset query on the users plus one each for their profiles
+// and enrollments, so the cost of a batch does not grow with how far into
+// the export it is. The queries are cancelled with ctx.
+func (r *Repository) ExportUsersBatch(ctx context.Context, filter UserExportFilter, after *UserExportCursor, limit int) ([]ExportedUser, error) {
+	return readOnly(r, func(r *Repository) ([]ExportedUser, error) {
+		return r.exportUsersBatch(r.db.WithContext(ctx), filter, after, limit)
+	})
+}
+
+func (r *Repository) exportUsersBatch(db *gorm.DB, filter UserExportFilter, after *UserExportCursor, limit int) ([]ExportedUser, error) {
+	query := db.Model(&core.User{}).
+		Preload("StudentProfile").
+		Preload("InstructorProfile").
+		Where("users.id IN ("+exportMembersSQL+")", map[string]interface{}{"institute": filter.InstituteID}).
+		Order("users.updated_at, users.id").
+		Limit(limit)
+	if filter.UserType != "" {
+		query = query.Where("users.user_type = ?", filter.UserType)
+	}
+	if filter.ModifiedSince != nil {
+		query = query.Where("users.updated_at >= ?", *filter.ModifiedSince)
+	}
+	if after != nil {
+		query = query.Where("(users.updated_at, users.id) > (?, ?)", after.UpdatedAt, after.ID)
+	}
+	var users []core.User
+	if err := query.Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uuid.UUID, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	var enrollments []EnrollmentSummary
+	err := db.Raw(`SELECT ce.student_id, ce.class_id, c.name AS class_name, ce.section_id, ce.status, ce.enrolled_at
+		FROM class_enrollments ce
+			JOIN classes c ON c.id = ce.class_id
+			JOIN departments d ON d.id = c.department_id
+			JOIN faculties f ON f.id = d.faculty_id
+		WHERE ce.student_id IN ? AND f.institute_id = ? AND c.deleted_at IS NULL
+		ORDER BY ce.enrolled_at`, ids, filter.InstituteID).Scan(&enrollments).Error
+	if err != nil {
+		return nil, err
+	}
+	var roles []core.InstituteAdminProfile
+	err = db.Where("user_id IN ? AND institute_id = ?", ids, filter.InstituteID).Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	exported := make([]ExportedUser, len(users))
+	index := make(map[uuid.UUID]int, len(users))
+	for i, u := range users {
+		if (u.UserType == core.UserTypeStudent && u.StudentProfile == nil) ||
+			(u.UserType == core.UserTypeInstructor && u.InstructorProfile == nil) {
+			markProfileMissing(&u)
+		}
+		exported[i] = ExportedUser{User: u, Enrollments: []EnrollmentSummary{}}
+		index[u.ID] = i
+	}
+	for _, e := range enrollments {
+		i := index[e.StudentID]
+		exported[i].Enrollments = append(exported[i].Enrollments, e)
+	}
+	for _, role := range roles {
+		exported[index[role.UserID]].InstituteRole = role.Role
+	}
+	return exported, nil
+}
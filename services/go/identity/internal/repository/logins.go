@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"gorm.io/gorm"
+)
+
+// MaxLoginEvents is how many logins are kept per user
+const MaxLoginEvents = 50
+
+// RecordLogin moves the user's last_login_at forward to the event and adds
+// it to their history, dropping all but the latest MaxLoginEvents in the same
+// transaction. Updating the user row first locks it, so concurrent logins of
+// one user are recorded one after another and the history never overshoots.
+func (r *Repository) RecordLogin(event *core.LoginEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Events can arrive out of order; an older one never moves it back.
+		// UpdateColumn keeps updated_at, which tracks edits to the user.
+		res := tx.Model(&core.User{}).Where("id = ?", event.UserID).
+			UpdateColumn("last_login_at", gorm.Expr("GREATEST(COALESCE(last_login_at, ?), ?)", event.LoggedInAt, event.LoggedInAt))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`DELETE FROM login_events WHERE user_id = ? AND id NOT IN (
+				SELECT id FROM login_events WHERE user_id = ?
+				ORDER BY logged_in_at DESC, id DESC LIMIT ?)`,
+			event.UserID, event.UserID, MaxLoginEvents).Error
+	})
+}
+
+// GetLoginHistory returns the user's kept logins, newest first
+func (r *Repository) GetLoginHistory(userID string) ([]core.LoginEvent, error) {
+	var events []core.LoginEvent
+	err := r.db.Where("user_id = ?", userID).
+		Order("logged_in_at DESC, id DESC").
+		Find(&events).Error
+	return events, err
+}
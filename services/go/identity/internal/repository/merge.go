@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/pkg/events"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MergeSummary counts what a merge did per table. Moved rows now belong to
+// the primary user; dropped rows duplicated something the primary already had.
+type MergeSummary struct {
+	EnrollmentsMoved     int64    `json:"enrollments_moved"`
+	EnrollmentsDropped   int64    `json:"enrollments_dropped"`
+	AdminProfilesMoved   int64    `json:"admin_profiles_moved"`
+	AdminProfilesDropped int64    `json:"admin_profiles_dropped"`
+	FacultyHeadsMoved    int64    `json:"faculty_heads_moved"`
+	DepartmentHeadsMoved int64    `json:"department_heads_moved"`
+	ProfileMoved         bool     `json:"profile_moved"`
+	FieldsCopied         []string `json:"fields_copied"`
+}
+
+// MergeUsers folds duplicate into primary in one transaction: references are
+// re-pointed, fields empty on the primary are filled from the duplicate, the
+// duplicate is soft-deleted and a UserMerge audit row is written. Where both
+// users have the same row (e.g. an enrollment in the same class) the
+// primary's is kept and the duplicate's dropped.
+func (r *Repository) MergeUsers(primaryID, duplicateID uuid.UUID) (*core.UserMerge, error) {
+	var merge *core.UserMerge
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock both users so nothing is attached to the duplicate mid-merge
+		var users []core.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", []uuid.UUID{primaryID, duplicateID}).
+			Find(&users).Error
+		if err != nil {
+			return err
+		}
+		if len(users) != 2 {
+			return ErrUserNotFound
+		}
+		primary, duplicate := users[0], users[1]
+		if primary.ID != primaryID {
+			primary, duplicate = duplicate, primary
+		}
+
+		summary := MergeSummary{FieldsCopied: []string{}}
+
+		// Class enrollments, keyed by (student_id, class_id). A seat the
+		// duplicate holds wins over a request to join the primary made.
+		res := tx.Exec(`DELETE FROM class_enrollments WHERE student_id = ? AND status <> 'enrolled' AND class_id IN (
+			SELECT class_id FROM class_enrollments WHERE student_id = ? AND status = 'enrolled')`,
+			primaryID, duplicateID)
+		if res.Error != nil {
+			return res.Error
+		}
+		summary.EnrollmentsDropped = res.RowsAffected
+		res = tx.Exec(`DELETE FROM class_enrollments WHERE student_id = ? AND class_id IN (
+			SELECT class_id FROM class_enrollments WHERE student_id = ?)`,
+			duplicateID, primaryID)
+		if res.Error != nil {
+			return res.Error
+		}
+		summary.EnrollmentsDropped += res.RowsAffected
+		res = tx.Model(&core.ClassEnrollment{}).Where("student_id = ?", duplicateID).Update("student_id", primaryID)
+		if res.Error != nil {
+			return res.Error
+		}
+		summary.EnrollmentsMoved = res.RowsAffected
+
+		// Institute admin memberships, keyed by (user_id, institute_id). The
+		// primary takes the higher of the two roles so no institute loses an owner.
+		res = tx.Exec(`UPDATE institute_admin_profiles SET role = ? WHERE user_id = ? AND institute_id IN (
+			SELECT institute_id FROM institute_admin_profiles WHERE user_id = ? AND role = ?)`,
+			core.InstituteRoleOwner, primaryID, duplicateID, core.InstituteRoleOwner)
+		if res.Error != nil {
+			return res.Error
+		}
+		res = tx.Exec(`DELETE FROM institute_admin_profiles WHERE user_id = ? AND institute_id IN (
+			SELECT institute_id FROM institute_admin_profiles WHERE user_id = ?)`,
+			duplicateID, primaryID)
+		if res.Error != nil {
+			return res.Error
+		}
+		summary.AdminProfilesDropped = res.RowsAffected
+		res = tx.Model(&core.InstituteAdminProfile{}).Where("user_id = ?", duplicateID).Update("user_id", primaryID)
+		if res.Error != nil {
+			return res.Error
+		}
+		summary.AdminProfilesMoved = res.RowsAffected
+
+		// Org unit heads
+		res = tx.Model(&core.Faculty{}).Where("head_user_id = ?", duplicateID).Updates(map[string]interface{}{
+			"head_user_id": primaryID,
+			"version":      gorm.Expr("version + 1"),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		summary.FacultyHeadsMoved = res.RowsAffected
+		res = tx.Model(&core.Department{}).Where("head_user_id = ?", duplicateID).Updates(map[string]interface{}{
+			"head_user_id": primaryID,
+			"version":      gorm.Expr("version + 1"),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		summary.DepartmentHeadsMoved = res.RowsAffected
+
+		if err := mergeStudentProfiles(tx, primaryID, duplicateID, &summary); err != nil {
+			return err
+		}
+		if err := mergeInstructorProfiles(tx, primaryID, duplicateID, &summary); err != nil {
+			return err
+		}
+
+		// User fields
+		updates := map[string]interface{}{}
+		if strings.TrimSpace(primary.FullName) == "" && duplicate.FullName != "" {
+			updates["full_name"] = duplicate.FullName
+			summary.FieldsCopied = append(summary.FieldsCopied, "users.full_name")
+		}
+		if !primary.EmailVerified && duplicate.EmailVerified {
+			updates["email_verified"] = true
+			updates["email_verified_at"] = duplicate.EmailVerifiedAt
+			summary.FieldsCopied = append(summary.FieldsCopied, "users.email_verified")
+		}
+		if primary.PreferredLocale == nil && duplicate.PreferredLocale != nil {
+			updates["preferred_locale"] = *duplicate.PreferredLocale
+			summary.FieldsCopied = append(summary.FieldsCopied, "users.preferred_locale")
+		}
+		if len(updates) > 0 {
+			updates["version"] = gorm.Expr("version + 1")
+			if err := tx.Model(&core.User{}).Where("id = ?", primaryID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Delete(&core.User{}, "id = ?", duplicateID).Error; err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+		merge = &core.UserMerge{
+			PrimaryUserID:   primaryID,
+			DuplicateUserID: duplicateID,
+			DuplicateEmail:  duplicate.Email,
+			Summary:         string(data),
+		}
+		if err := tx.Create(merge).Error; err != nil {
+			return err
+		}
+
+		return enqueueEvent(tx, events.TypeUserMerged, primaryID.String(), events.UserMerged{
+			PrimaryUserID:   primaryID.String(),
+			DuplicateUserID: duplicateID.String(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merge, nil
+}
+
+// mergeStudentProfiles moves the duplicate's profile if the primary has none,
+// otherwise fills the primary's empty fields and drops the duplicate's
+func mergeStudentProfiles(tx *gorm.DB, primaryID, duplicateID uuid.UUID, summary *MergeSummary) error {
+	var dup core.StudentProfile
+	err := tx.Where("user_id = ?", duplicateID).First(&dup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var primary core.StudentProfile
+	err = tx.Where("user_id = ?", primaryID).First(&primary).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		summary.ProfileMoved = true
+		return tx.Model(&core.StudentProfile{}).Where("user_id = ?", duplicateID).Update("user_id", primaryID).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	// Drop the duplicate first so copying its values cannot trip the
+	// (institute_id, enrollment_number) unique index
+	if err := tx.Delete(&core.StudentProfile{}, "user_id = ?", duplicateID).Error; err != nil {
+		return err
+	}
+	updates := map[string]interface{}{}
+	if primary.InstituteID == nil && dup.InstituteID != nil {
+		updates["institute_id"] = dup.InstituteID
+		summary.FieldsCopied = append(summary.FieldsCopied, "student_profiles.institute_id")
+	}
+	if primary.EnrollmentNumber == "" && dup.EnrollmentNumber != "" {
+		updates["enrollment_number"] = dup.EnrollmentNumber
+		summary.FieldsCopied = append(summary.FieldsCopied, "student_profiles.enrollment_number")
+	}
+	if primary.EnrollmentYear == 0 && dup.EnrollmentYear != 0 {
+		updates["enrollment_year"] = dup.EnrollmentYear
+		summary.FieldsCopied = append(summary.FieldsCopied, "student_profiles.enrollment_year")
+		// The season belongs to the year, so it comes along
+		updates["intake_season"] = dup.IntakeSeason
+		summary.FieldsCopied = append(summary.FieldsCopied, "student_profiles.intake_season")
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(&core.StudentProfile{}).Where("user_id = ?", primaryID).Updates(updates).Error
+}
+
+// mergeInstructorProfiles works like mergeStudentProfiles
+func mergeInstructorProfiles(tx *gorm.DB, primaryID, duplicateID uuid.UUID, summary *MergeSummary) error {
+	var dup core.InstructorProfile
+	err := tx.Where("user_id = ?", duplicateID).First(&dup).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var primary core.InstructorProfile
+	err = tx.Where("user_id = ?", primaryID).First(&primary).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		summary.ProfileMoved = true
+		return tx.Model(&core.InstructorProfile{}).Where("user_id = ?", duplicateID).Update("user_id", primaryID).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	// employee_id is unique, so the duplicate goes before its value is copied
+	if err := tx.Delete(&core.InstructorProfile{}, "user_id = ?", duplicateID).Error; err != nil {
+		return err
+	}
+	updates := map[string]interface{}{}
+	if primary.EmployeeID == "" && dup.EmployeeID != "" {
+		updates["employee_id"] = dup.EmployeeID
+		summary.FieldsCopied = append(summary.FieldsCopied, "instructor_profiles.employee_id")
+	}
+	if primary.Specialization == "" && dup.Specialization != "" {
+		updates["specialization"] = dup.Specialization
+		summary.FieldsCopied = append(summary.FieldsCopied, "instructor_profiles.specialization")
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(&core.InstructorProfile{}).Where("user_id = ?", primaryID).Updates(updates).Error
+}
+
+// EmailConflict is a set of active users whose emails differ only by case
+type EmailConflict struct {
+	Email   string      `json:"email"`
+	UserIDs []uuid.UUID `json:"user_ids"`
+}
+
+// FindEmailConflicts lists active users sharing an email case-insensitively.
+// These need a merge before emails can be unique case-insensitively.
+func (r *Repository) FindEmailConflicts() ([]EmailConflict, error) {
+	var rows []struct {
+		Email  string
+		UserID uuid.UUID
+	}
+	err := r.db.Raw(`SELECT lower(email) AS email, id AS user_id FROM users
+		WHERE deleted_at IS NULL AND lower(email) IN (
+			SELECT lower(email) FROM users WHERE deleted_at IS NULL
+			GROUP BY lower(email) HAVING COUNT(*) > 1)
+		ORDER BY lower(email), created_at`).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := make([]EmailConflict, 0)
+	for _, row := range rows {
+		if n := len(conflicts); n > 0 && conflicts[n-1].Email == row.Email {
+			conflicts[n-1].UserIDs = append(conflicts[n-1].UserIDs, row.UserID)
+			continue
+		}
+		conflicts = append(conflicts, EmailConflict{Email: row.Email, UserIDs: []uuid.UUID{row.UserID}})
+	}
+	return conflicts, nil
+}
+
+// NormalizeEmails lower-cases stored emails that can be lower-cased without
+// clashing with another row, and adds a case-insensitive unique index once no
+// conflicts remain. Conflicting users are returned for an admin to merge
+// rather than merged automatically.
+func (r *Repository) NormalizeEmails() ([]EmailConflict, error) {
+	err := r.db.Exec(`UPDATE users SET email = lower(email)
+		WHERE email <> lower(email) AND NOT EXISTS (
+			SELECT 1 FROM users o WHERE o.id <> users.id AND lower(o.email) = lower(users.email))`).Error
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := r.FindEmailConflicts()
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) == 0 {
+		err = r.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower_unique ON users(lower(email)) WHERE deleted_at IS NULL").Error
+	}
+	return conflicts, err
+}
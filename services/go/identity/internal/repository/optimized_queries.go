@@ -12,8 +12,8 @@ import (
 // GetUserByEmailLean - Get user without any profiles for authentication checks
 func (r *Repository) GetUserByEmailLean(email string) (*core.User, error) {
 	var user core.User
-	err := r.db.Select("id, email, user_type, status, email_verified, is_active, created_at, updated_at").
-		Where("email = ? AND deleted_at IS NULL", email).
+	err := r.db.Select("id, email, user_type, status, email_verified, email_verified_at, is_active, created_at, updated_at").
+		Where("lower(email) = lower(?) AND deleted_at IS NULL", email).
 		First(&user).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -33,15 +33,29 @@ func (r *Repository) GetUsersByTypeWithProfiles(userType core.UserType, offset,
 	case core.UserTypeInstructor:
 		query = query.Preload("InstructorProfile")  
 	case core.UserTypeInstituteAdmin:
-		query = query.Preload("InstituteAdminProfile")
+		query = preloadInstitutes(query)
 	}
 	
-	err := query.Offset(offset).Limit(limit).Find(&users).Error
-	return users, err
+	if err := query.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if (userType == core.UserTypeStudent && users[i].StudentProfile == nil) ||
+			(userType == core.UserTypeInstructor && users[i].InstructorProfile == nil) {
+			markProfileMissing(&users[i])
+		}
+	}
+	return users, nil
 }
 
 // CountUsersByType - Fast count query without loading data
 func (r *Repository) CountUsersByType(userType core.UserType) (int64, error) {
+	return readOnly(r, func(r *Repository) (int64, error) {
+		return r.countUsersByType(userType)
+	})
+}
+
+func (r *Repository) countUsersByType(userType core.UserType) (int64, error) {
 	var count int64
 	err := r.db.Model(&core.User{}).
 		Where("user_type = ? AND deleted_at IS NULL", userType).
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// An org unit under a deleted one counts as deleted too, even if its own row
+// was left live. These select the IDs of the units whose whole chain up to
+// the institute is live. Each call returns a fresh query, for use as a
+// subquery.
+
+func liveInstitutes(db *gorm.DB) *gorm.DB {
+	return db.Model(&core.Institute{}).Select("id")
+}
+
+func liveFaculties(db *gorm.DB) *gorm.DB {
+	return db.Model(&core.Faculty{}).Select("id").Where("institute_id IN (?)", liveInstitutes(db))
+}
+
+func liveDepartments(db *gorm.DB) *gorm.DB {
+	return db.Model(&core.Department{}).Select("id").Where("faculty_id IN (?)", liveFaculties(db))
+}
+
+func liveClasses(db *gorm.DB) *gorm.DB {
+	return db.Model(&core.Class{}).Select("id").Where("department_id IN (?)", liveDepartments(db))
+}
+
+// lockLiveUnit takes a share lock on the unit with id among live, so it
+// cannot be deleted until tx ends, or returns notFound if it or a unit above
+// it is deleted. A deletion already under way is waited for.
+func lockLiveUnit(live *gorm.DB, id uuid.UUID, notFound error) error {
+	var ids []uuid.UUID
+	err := live.Clauses(clause.Locking{Strength: "SHARE"}).Where("id = ?", id).Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// OrgUnitDeletedAt returns when the unit, or the nearest unit above it, was
+// deleted, or nil while its whole chain is live. Deleted units are found too.
+func (r *Repository) OrgUnitDeletedAt(unit core.AnnouncementScope, id uuid.UUID) (*time.Time, error) {
+	var query string
+	var notFound error
+	switch unit {
+	case core.AnnouncementScopeInstitute:
+		query = `SELECT i.deleted_at AS institute FROM institutes i WHERE i.id = ?`
+		notFound = ErrInstituteNotFound
+	case core.AnnouncementScopeFaculty:
+		query = `SELECT f.deleted_at AS faculty, i.deleted_at AS institute FROM faculties f
+			JOIN institutes i ON i.id = f.institute_id
+			WHERE f.id = ?`
+		notFound = ErrFacultyNotFound
+	case core.AnnouncementScopeDepartment:
+		query = `SELECT d.deleted_at AS department, f.deleted_at AS faculty, i.deleted_at AS institute FROM departments d
+			JOIN faculties f ON f.id = d.faculty_id
+			JOIN institutes i ON i.id = f.institute_id
+			WHERE d.id = ?`
+		notFound = ErrDepartmentNotFound
+	case core.AnnouncementScopeClass:
+		query = `SELECT c.deleted_at AS class, d.deleted_at AS department, f.deleted_at AS faculty, i.deleted_at AS institute FROM classes c
+			JOIN departments d ON d.id = c.department_id
+			JOIN faculties f ON f.id = d.faculty_id
+			JOIN institutes i ON i.id = f.institute_id
+			WHERE c.id = ?`
+		notFound = ErrClassNotFound
+	default:
+		return nil, errors.New("unknown org unit " + string(unit))
+	}
+
+	// Each level is read on its own, not COALESCEd in SQL, so the driver
+	// still knows the columns are timestamps
+	var chains []struct{ Class, Department, Faculty, Institute *time.Time }
+	if err := r.db.Raw(query, id).Scan(&chains).Error; err != nil {
+		return nil, err
+	}
+	if len(chains) == 0 {
+		return nil, notFound
+	}
+	for _, deletedAt := range []*time.Time{chains[0].Class, chains[0].Department, chains[0].Faculty, chains[0].Institute} {
+		if deletedAt != nil {
+			return deletedAt, nil
+		}
+	}
+	return nil, nil
+}
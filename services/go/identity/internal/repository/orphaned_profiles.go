@@ -0,0 +1,35 @@
+package repository
+
+import "github.com/google/uuid"
+
+// OrphanedProfile is a type-specific profile row whose user is missing or
+// deleted
+type OrphanedProfile struct {
+	Table  string    `gorm:"column:table_name" json:"table"`
+	UserID uuid.UUID `json:"user_id"`
+	// UserDeleted is set when the user was soft-deleted rather than removed
+	UserDeleted bool `json:"user_deleted"`
+}
+
+// ListOrphanedProfiles returns the profile rows of every type whose user is
+// missing or deleted, in one query, by table and user. An admin bound to
+// several institutes is listed once.
+func (r *Repository) ListOrphanedProfiles() ([]OrphanedProfile, error) {
+	return readOnly(r, func(r *Repository) ([]OrphanedProfile, error) {
+		orphans := []OrphanedProfile{}
+		err := r.db.Raw(`
+			SELECT DISTINCT 'student_profiles' AS table_name, p.user_id, u.id IS NOT NULL AS user_deleted
+				FROM student_profiles p LEFT JOIN users u ON u.id = p.user_id
+				WHERE u.id IS NULL OR u.deleted_at IS NOT NULL
+			UNION ALL
+			SELECT DISTINCT 'instructor_profiles', p.user_id, u.id IS NOT NULL
+				FROM instructor_profiles p LEFT JOIN users u ON u.id = p.user_id
+				WHERE u.id IS NULL OR u.deleted_at IS NOT NULL
+			UNION ALL
+			SELECT DISTINCT 'institute_admin_profiles', p.user_id, u.id IS NOT NULL
+				FROM institute_admin_profiles p LEFT JOIN users u ON u.id = p.user_id
+				WHERE u.id IS NULL OR u.deleted_at IS NOT NULL
+			ORDER BY table_name, user_id`).Scan(&orphans).Error
+		return orphans, err
+	})
+}
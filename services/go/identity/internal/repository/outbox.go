@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/pkg/events"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// enqueueEvent writes an event to the outbox inside tx, so it is only
+// published if the surrounding change commits
+func enqueueEvent(tx *gorm.DB, eventType, entityID string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&core.OutboxEvent{
+		EventType: eventType,
+		EntityID:  entityID,
+		Payload:   string(data),
+	}).Error
+}
+
+func enqueueUserCreated(tx *gorm.DB, user *core.User) error {
+	return enqueueEvent(tx, events.TypeUserCreated, user.ID.String(), events.UserCreated{
+		UserID:   user.ID.String(),
+		Email:    user.Email,
+		FullName: user.FullName,
+		UserType: string(user.UserType),
+	})
+}
+
+func enqueueInstituteAdminAdded(tx *gorm.DB, profile core.InstituteAdminProfile) error {
+	return enqueueEvent(tx, events.TypeInstituteAdminAdded, profile.InstituteID.String(), events.InstituteAdminAdded{
+		InstituteID: profile.InstituteID.String(),
+		UserID:      profile.UserID.String(),
+	})
+}
+
+// RelayOutbox hands up to limit unpublished events, oldest first, to publish
+// and marks the ones that succeed. Rows are locked with SKIP LOCKED so several
+// relays never publish the same event. The batch stops at the first failure to
+// keep events in order; the failed event is retried on the next call.
+func (r *Repository) RelayOutbox(limit int, publish func(core.OutboxEvent) error) (int, error) {
+	published := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var pending []core.OutboxEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL").
+			Order("seq ASC").
+			Limit(limit).
+			Find(&pending).Error
+		if err != nil {
+			return err
+		}
+
+		for _, event := range pending {
+			if err := publish(event); err != nil {
+				return tx.Model(&core.OutboxEvent{}).Where("id = ?", event.ID).Updates(map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": err.Error(),
+				}).Error
+			}
+
+			now := time.Now()
+			if err := tx.Model(&core.OutboxEvent{}).Where("id = ?", event.ID).Update("published_at", now).Error; err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+	return published, err
+}
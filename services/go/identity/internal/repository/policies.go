@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPolicyDocumentNotFound = errors.New("policy document not found")
+	ErrPolicyDocumentExists   = errors.New("policy document version already exists")
+	// ErrPolicyInEffect rejects changing or deleting a document users may
+	// have accepted
+	ErrPolicyInEffect = errors.New("policy document is already in effect")
+)
+
+// CreatePolicyDocument adds a document; a version already used for its type
+// returns ErrPolicyDocumentExists
+func (r *Repository) CreatePolicyDocument(doc *core.PolicyDocument) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(doc)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPolicyDocumentExists
+	}
+	return nil
+}
+
+func (r *Repository) GetPolicyDocument(id uuid.UUID) (*core.PolicyDocument, error) {
+	var doc core.PolicyDocument
+	err := r.db.First(&doc, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPolicyDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ListPolicyDocuments returns every version, of one type if policyType is
+// set, latest to take effect first
+func (r *Repository) ListPolicyDocuments(policyType core.PolicyType) ([]core.PolicyDocument, error) {
+	query := r.db.Order("effective_at DESC, version DESC")
+	if policyType != "" {
+		query = query.Where("type = ?", policyType)
+	}
+	docs := []core.PolicyDocument{}
+	err := query.Find(&docs).Error
+	return docs, err
+}
+
+// UpdatePolicyDocument saves a document's text and effective date, as long
+// as it was not in effect at now
+func (r *Repository) UpdatePolicyDocument(doc *core.PolicyDocument, now time.Time) error {
+	result := r.db.Model(doc).
+		Where("effective_at > ?", now).
+		Select("body", "url", "effective_at", "updated_at").
+		Updates(doc)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return r.policyDocumentUnchanged(doc.ID)
+	}
+	return nil
+}
+
+// DeletePolicyDocument deletes a document that was not in effect at now
+func (r *Repository) DeletePolicyDocument(id uuid.UUID, now time.Time) error {
+	result := r.db.Where("id = ? AND effective_at > ?", id, now).Delete(&core.PolicyDocument{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return r.policyDocumentUnchanged(id)
+	}
+	return nil
+}
+
+// policyDocumentUnchanged tells why a document was not updated or deleted
+func (r *Repository) policyDocumentUnchanged(id uuid.UUID) error {
+	if _, err := r.GetPolicyDocument(id); err != nil {
+		return err
+	}
+	return ErrPolicyInEffect
+}
+
+// CurrentPolicyDocuments returns the document in effect at now of each type
+// that has one
+func (r *Repository) CurrentPolicyDocuments(now time.Time) ([]core.PolicyDocument, error) {
+	docs := []core.PolicyDocument{}
+	ranked := r.db.Model(&core.PolicyDocument{}).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY type ORDER BY effective_at DESC, created_at DESC) AS position").
+		Where("effective_at <= ?", now)
+	err := r.db.Table("(?) AS ranked", ranked).
+		Where("position = 1").
+		Order("type").
+		Find(&docs).Error
+	return docs, err
+}
+
+// AcceptedPolicyDocuments returns which of documentIDs the user accepted
+func (r *Repository) AcceptedPolicyDocuments(userID uuid.UUID, documentIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	accepted := map[uuid.UUID]bool{}
+	if len(documentIDs) == 0 {
+		return accepted, nil
+	}
+	var ids []uuid.UUID
+	err := r.db.Model(&core.UserPolicyAcceptance{}).
+		Where("user_id = ? AND document_id IN ?", userID, documentIDs).
+		Pluck("document_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		accepted[id] = true
+	}
+	return accepted, nil
+}
+
+// AcceptPolicyDocuments records the acceptances. A document the user already
+// accepted keeps its first acceptance.
+func (r *Repository) AcceptPolicyDocuments(acceptances []core.UserPolicyAcceptance) error {
+	if len(acceptances) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&acceptances).Error
+}
+
+// GetPolicyAcceptances returns every acceptance of the user, newest first
+func (r *Repository) GetPolicyAcceptances(userID uuid.UUID) ([]core.UserPolicyAcceptance, error) {
+	acceptances := []core.UserPolicyAcceptance{}
+	err := r.db.Where("user_id = ?", userID).Order("accepted_at DESC").Find(&acceptances).Error
+	return acceptances, err
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Replica is a read replica of the primary database. The heavy read-only
+// queries (user lists and searches, the org tree, stats and exports) run on
+// it so they do not compete with writes; while it is down they run on the
+// primary.
+type Replica struct {
+	db   *gorm.DB
+	down atomic.Bool
+}
+
+func NewReplica(db *gorm.DB) *Replica {
+	return &Replica{db: db}
+}
+
+// WithReplica returns a repository whose read-only queries go to replica
+func (r *Repository) WithReplica(replica *Replica) *Repository {
+	return &Repository{db: r.db, replica: replica}
+}
+
+// Primary returns a repository that reads everything from the primary, for
+// reads right after a write that must see it despite replication lag
+func (r *Repository) Primary() *Repository {
+	return &Repository{db: r.db}
+}
+
+// Watch pings the replica every interval until ctx is done, so reads go
+// back to it once it is up again after being marked down
+func (rp *Replica) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rp.check(ctx, interval)
+		}
+	}
+}
+
+func (rp *Replica) check(ctx context.Context, timeout time.Duration) {
+	sqlDB, err := rp.db.DB()
+	if err == nil {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = sqlDB.PingContext(pingCtx)
+		cancel()
+	}
+	if err != nil {
+		rp.markDown(err)
+		return
+	}
+	if rp.down.CompareAndSwap(true, false) {
+		log.Printf("Read replica is back up, routing read-only queries to it again")
+	}
+}
+
+func (rp *Replica) markDown(err error) {
+	if rp.down.CompareAndSwap(false, true) {
+		log.Printf("Warning: read replica is down, reading from the primary until it is back: %v", err)
+	}
+}
+
+// readOnly runs query against the replica, or against r itself when there
+// is no replica, it is down, or r is bound to a transaction. A query that
+// cannot reach the replica marks it down and is run again on the primary.
+func readOnly[T any](r *Repository, query func(r *Repository) (T, error)) (T, error) {
+	if r.replica == nil || r.replica.down.Load() || inTransaction(r.db) {
+		return query(r)
+	}
+
+	db := r.replica.db
+	if r.db.Statement.Unscoped {
+		db = db.Unscoped().Session(&gorm.Session{})
+	}
+	result, err := query(&Repository{db: db})
+	if err != nil && unreachable(err) {
+		r.replica.markDown(err)
+		return query(r)
+	}
+	return result, err
+}
+
+func inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// unreachable reports whether err means the database could not be reached
+// or is not accepting queries, as opposed to it rejecting the query or the
+// caller giving up on it
+func unreachable(err error) bool {
+	// A query cancelled by its caller says nothing about the database
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// connection_exception, or operator_intervention such as the
+		// server shutting down or still starting up
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openSQLiteFile opens a database file with the institute table, standing in for
+// the primary or the replica, and stores one institute named name in it so
+// reads show which of the two answered
+func openSQLiteFile(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name+".db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.Institute{}); err != nil {
+		t.Fatal(err)
+	}
+	institute := &core.Institute{ID: uuid.New(), Name: name, Code: name, Domain: name + ".example.com", ContactEmail: "admin@" + name + ".example.com"}
+	if err := db.Create(institute).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// failWhile makes every query on db fail as if the server could not be
+// reached while down is set
+func failWhile(t *testing.T, db *gorm.DB, down *atomic.Bool) {
+	t.Helper()
+	fail := func(tx *gorm.DB) {
+		if down.Load() {
+			_ = tx.AddError(driver.ErrBadConn)
+		}
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("test:down", fail); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("test:down", fail); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// answeredBy returns the name of the only institute GetInstitutes found
+func answeredBy(t *testing.T, r *Repository) string {
+	t.Helper()
+	institutes, err := r.GetInstitutes("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(institutes) != 1 {
+		t.Fatalf("listed %d institutes, want the one of either database", len(institutes))
+	}
+	return institutes[0].Name
+}
+
+func TestReadOnlyQueriesGoToTheReplica(t *testing.T) {
+	primary, replicaDB := openSQLiteFile(t, "primary"), openSQLiteFile(t, "replica")
+	repo := NewRepository(primary)
+	if got := answeredBy(t, repo); got != "primary" {
+		t.Errorf("without a replica the list was read from the %s", got)
+	}
+
+	repo = repo.WithReplica(NewReplica(replicaDB))
+	if got := answeredBy(t, repo); got != "replica" {
+		t.Errorf("the list was read from the %s, want the replica", got)
+	}
+	if got := answeredBy(t, repo.Primary()); got != "primary" {
+		t.Errorf("a read right after a write was read from the %s, want the primary", got)
+	}
+
+	// Lookups that are not heavy reads stay on the primary
+	if exists, err := repo.InstituteCodeExists("primary", ""); err != nil || !exists {
+		t.Errorf("looking up the primary's institute = %t, %v", exists, err)
+	}
+
+	// So does anything in a transaction
+	err := primary.Transaction(func(tx *gorm.DB) error {
+		if got := answeredBy(t, &Repository{db: tx, replica: repo.replica}); got != "primary" {
+			t.Errorf("the list was read from the %s in a transaction, want the primary", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted rows are found on the replica by lookups that include them
+	if err := replicaDB.Where("name = ?", "replica").Delete(&core.Institute{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := answeredBy(t, repo.IncludingDeleted()); got != "replica" {
+		t.Errorf("the list including deleted users was read from the %s, want the replica", got)
+	}
+}
+
+func TestReadsFallBackToThePrimaryWhileTheReplicaIsDown(t *testing.T) {
+	primary, replicaDB := openSQLiteFile(t, "primary"), openSQLiteFile(t, "replica")
+	var down atomic.Bool
+	failWhile(t, replicaDB, &down)
+	replica := NewReplica(replicaDB)
+	repo := NewRepository(primary).WithReplica(replica)
+
+	var logged bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logged)
+
+	down.Store(true)
+	if got := answeredBy(t, repo); got != "primary" {
+		t.Fatalf("with the replica down the list was read from the %s, want the primary", got)
+	}
+	if !replica.down.Load() {
+		t.Fatal("the replica was not marked down")
+	}
+	if !strings.Contains(logged.String(), "read replica is down") {
+		t.Errorf("falling back was not logged: %q", logged.String())
+	}
+	// Marked down, it is not tried again until it is back
+	down.Store(false)
+	if got := answeredBy(t, repo); got != "primary" {
+		t.Errorf("with the replica marked down the list was read from the %s", got)
+	}
+
+	replica.check(context.Background(), time.Second)
+	if replica.down.Load() {
+		t.Fatal("the replica is still marked down after a successful ping")
+	}
+	if !strings.Contains(logged.String(), "back up") {
+		t.Errorf("the replica coming back was not logged: %q", logged.String())
+	}
+	if got := answeredBy(t, repo); got != "replica" {
+		t.Errorf("once the replica was back the list was read from the %s", got)
+	}
+}
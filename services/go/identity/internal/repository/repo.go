@@ -2,8 +2,11 @@ package repository
 
 import (
 	"errors"
+	"log"
 
+	"github.com/4yrg/gradeloop-core/libs/pagination"
 	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/pkg/events"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -11,19 +14,41 @@ import (
 
 var (
 	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailTaken means another user has the email, in any case
+	ErrEmailTaken = errors.New("email is already in use")
+	// ErrConflict means the row changed since it was loaded; reload and retry
+	ErrConflict = errors.New("resource was modified by another request")
+
+	ErrInstituteNotFound  = errors.New("institute not found")
+	ErrFacultyNotFound    = errors.New("faculty not found")
+	ErrDepartmentNotFound = errors.New("department not found")
+	ErrClassNotFound      = errors.New("class not found")
+	ErrClassFull          = errors.New("class is full")
+	ErrAlreadyEnrolled    = errors.New("student is already enrolled in this class")
 )
 
 type Repository struct {
 	db *gorm.DB
+	// replica serves the heavy read-only queries; nil reads everything
+	// from db
+	replica *Replica
 }
 
 func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
 
-// AutoMigrate applies schema changes
+// IncludingDeleted returns a repository whose lookups also find deleted
+// rows, and org units under deleted ones, for admins looking into them
+func (r *Repository) IncludingDeleted() *Repository {
+	return &Repository{db: r.db.Unscoped().Session(&gorm.Session{}), replica: r.replica}
+}
+
+// AutoMigrate creates the schema from the models, for tests against
+// throwaway databases. Servers apply the versioned SQL in internal/migrations;
+// a model change needs a migration there too.
 func (r *Repository) AutoMigrate() error {
-	return r.db.AutoMigrate(
+	if err := r.db.AutoMigrate(
 		&core.User{},
 		&core.StudentProfile{},
 		&core.InstructorProfile{},
@@ -31,28 +56,85 @@ func (r *Repository) AutoMigrate() error {
 		&core.Institute{},
 		&core.Faculty{},
 		&core.Department{},
+		&core.Term{},
 		&core.Class{},
+		&core.ClassSection{},
 		&core.ClassEnrollment{},
-	)
+		&core.ClassWaitlistEntry{},
+		&core.OutboxEvent{},
+		&core.UserMerge{},
+		&core.ExportJob{},
+		&core.LoginEvent{},
+		&core.Announcement{},
+		&core.DeletionTombstone{},
+		&core.FeatureFlag{},
+		&core.InstituteFeatureOverride{},
+		&core.AvailabilitySlot{},
+		&core.SlotBooking{},
+		&core.PolicyDocument{},
+		&core.UserPolicyAcceptance{},
+		&core.ActivityEntry{},
+		&core.UserTwoFactor{},
+		&core.UserRecoveryCode{},
+		&core.InstituteBranding{},
+		&core.GuardianLink{},
+	); err != nil {
+		return err
+	}
+
+	// Rows created before optimistic locking start at version 1
+	for _, table := range []string{"users", "institutes", "faculties", "departments", "classes"} {
+		if err := r.db.Exec("UPDATE " + table + " SET version = 1 WHERE version IS NULL OR version < 1").Error; err != nil {
+			return err
+		}
+	}
+
+	if err := backfillInstituteOwners(r.db); err != nil {
+		return err
+	}
+
+	if err := r.BackfillDefaultSections(); err != nil {
+		return err
+	}
+
+	// A student has one open link with each guardian
+	if err := r.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_guardian_links_open ON guardian_links (guardian_user_id, student_user_id) WHERE status <> 'revoked'").Error; err != nil {
+		return err
+	}
+
+	// Enrollment numbers used to be globally unique; they are now scoped per institute
+	if r.db.Migrator().HasIndex(&core.StudentProfile{}, "idx_student_profiles_enrollment_number") {
+		if err := r.db.Migrator().DropIndex(&core.StudentProfile{}, "idx_student_profiles_enrollment_number"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // -- User Management --
 
+// CreateUser creates the user with its profile. The unique indexes on email
+// decide between concurrent creations of one email: all but one return
+// ErrEmailTaken, with no need to look the email up first.
 func (r *Repository) CreateUser(user *core.User) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
 		// GORM handles association creation if the struct fields are populated
 		if err := tx.Create(user).Error; err != nil {
 			return err
 		}
-		return nil
+		return enqueueUserCreated(tx, user)
 	})
+	if isUniqueViolation(err, userEmailIndexes...) {
+		return ErrEmailTaken
+	}
+	return err
 }
 
 func (r *Repository) GetUserByEmail(email string) (*core.User, error) {
 	var user core.User
 	// Optimized: Only preload profiles as needed rather than all at once
 	err := r.db.
-		Where("email = ?", email).
+		Where("lower(email) = lower(?)", email).
 		First(&user).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -62,16 +144,9 @@ func (r *Repository) GetUserByEmail(email string) (*core.User, error) {
 		return nil, err
 	}
 	
-	// Load the appropriate profile based on user type
-	switch user.UserType {
-	case core.UserTypeStudent:
-		r.db.Preload("StudentProfile").Find(&user)
-	case core.UserTypeInstructor:
-		r.db.Preload("InstructorProfile").Find(&user)
-	case core.UserTypeInstituteAdmin:
-		r.db.Preload("InstituteAdminProfile").Find(&user)
+	if err := loadProfile(r.db, &user); err != nil {
+		return nil, err
 	}
-	
 	return &user, nil
 }
 
@@ -88,7 +163,7 @@ func (r *Repository) GetUserByEmailWithProfile(email string) (*core.User, error)
 		Joins("LEFT JOIN student_profiles sp ON users.id = sp.user_id AND users.user_type = ?", core.UserTypeStudent).
 		Joins("LEFT JOIN instructor_profiles ip ON users.id = ip.user_id AND users.user_type = ?", core.UserTypeInstructor).
 		Joins("LEFT JOIN institute_admin_profiles iap ON users.id = iap.user_id AND users.user_type = ?", core.UserTypeInstituteAdmin).
-		Where("users.email = ? AND users.deleted_at IS NULL", email)
+		Where("lower(users.email) = lower(?) AND users.deleted_at IS NULL", email)
 	
 	err := subQuery.Scan(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -114,32 +189,170 @@ func (r *Repository) GetUserByID(id string) (*core.User, error) {
 		return nil, err
 	}
 	
-	// Load the appropriate profile based on user type
+	if err := loadProfile(r.db, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// loadProfile loads the profile the user's type calls for. A student or
+// instructor without a profile row is returned with ProfileMissing set, so
+// only a failed query is an error. Admins without institutes are normal.
+func loadProfile(db *gorm.DB, user *core.User) error {
+	var err error
 	switch user.UserType {
 	case core.UserTypeStudent:
-		r.db.Preload("StudentProfile").Find(&user)
+		var profile core.StudentProfile
+		if err = db.Take(&profile, "user_id = ?", user.ID).Error; err == nil {
+			user.StudentProfile = &profile
+		}
 	case core.UserTypeInstructor:
-		r.db.Preload("InstructorProfile").Find(&user)
+		var profile core.InstructorProfile
+		if err = db.Take(&profile, "user_id = ?", user.ID).Error; err == nil {
+			user.InstructorProfile = &profile
+		}
 	case core.UserTypeInstituteAdmin:
-		r.db.Preload("InstituteAdminProfile").Find(&user)
+		return instituteBindings(db).Where("institute_admin_profiles.user_id = ?", user.ID).Find(&user.InstituteAdminProfiles).Error
 	}
-	
-	return &user, nil
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		markProfileMissing(user)
+		return nil
+	}
+	return err
 }
 
+// markProfileMissing flags a typed user whose profile row does not exist
+func markProfileMissing(user *core.User) {
+	user.ProfileMissing = true
+	log.Printf("Warning: %s user %s has no profile row", user.UserType, user.ID)
+}
+
+// GetUsersByIDs returns the users that exist among ids, with the student
+// profiles of students and no other profiles
+func (r *Repository) GetUsersByIDs(ids []uuid.UUID) ([]core.User, error) {
+	var users []core.User
+	err := r.db.Preload("StudentProfile").Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
+// deleted returns notFound if a delete matched no row
+func deleted(result *gorm.DB, notFound error) error {
+	if result.Error == nil && result.RowsAffected == 0 {
+		return notFound
+	}
+	return result.Error
+}
+
+// updateVersioned writes all columns of model, except those in omit, only if
+// its row is still at the version it was loaded with, and bumps the version.
+// It returns ErrConflict when another update got there first.
+func updateVersioned(db *gorm.DB, model interface{}, version *int, omit ...string) error {
+	expected := *version
+	*version = expected + 1
+	result := db.Model(model).
+		Where("version = ?", expected).
+		Select("*").Omit(append([]string{clause.Associations}, omit...)...).
+		Updates(model)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrConflict
+	}
+	if result.Error != nil {
+		*version = expected
+		return result.Error
+	}
+	return nil
+}
+
+// UpdateUser leaves last_login_at alone: logins are recorded concurrently
+// with edits and do not bump the version
 func (r *Repository) UpdateUser(user *core.User) error {
-	return r.db.Save(user).Error
+	return updateVersioned(r.db, user, &user.Version, "last_login_at")
+}
+
+// UpdateUserWithProfile is UpdateUser that also saves the user's student or
+// instructor profile, in the same transaction
+func (r *Repository) UpdateUserWithProfile(user *core.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, user, &user.Version, "last_login_at"); err != nil {
+			return err
+		}
+		switch {
+		case user.StudentProfile != nil:
+			return tx.Omit(clause.Associations).Save(user.StudentProfile).Error
+		case user.InstructorProfile != nil:
+			return tx.Save(user.InstructorProfile).Error
+		}
+		return nil
+	})
+}
+
+// DeactivateUser saves the user, whose status the caller set to disabled,
+// and removes them as head of any faculty or department
+func (r *Repository) DeactivateUser(user *core.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, user, &user.Version, "last_login_at"); err != nil {
+			return err
+		}
+		return clearOrgUnitHeads(tx, user.ID.String())
+	})
 }
 
 func (r *Repository) DeleteUser(id string) error {
-	return r.db.Delete(&core.User{}, "id = ?", id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Users are soft-deleted, so the FK's ON DELETE SET NULL never fires
+		if err := clearOrgUnitHeads(tx, id); err != nil {
+			return err
+		}
+		result := tx.Delete(&core.User{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return enqueueEvent(tx, events.TypeUserDeleted, id, events.UserDeleted{UserID: id})
+	})
+}
+
+// clearOrgUnitHeads removes the user as head of any faculty or department
+func clearOrgUnitHeads(tx *gorm.DB, userID string) error {
+	cleared := map[string]interface{}{"head_user_id": nil, "version": gorm.Expr("version + 1")}
+	if err := tx.Model(&core.Faculty{}).Where("head_user_id = ?", userID).Updates(cleared).Error; err != nil {
+		return err
+	}
+	return tx.Model(&core.Department{}).Where("head_user_id = ?", userID).Updates(cleared).Error
 }
 
-func (r *Repository) ListUsers(offset, limit int) ([]core.User, error) {
+// ListUsers returns users newest first, ordered by (created_at, id) so a
+// cursor keeps its place when users are added between pages
+func (r *Repository) ListUsers(page pagination.Request) ([]core.User, error) {
+	return readOnly(r, func(r *Repository) ([]core.User, error) {
+		return r.listUsers(page, "")
+	})
+}
+
+// ListUsersWithProfiles is ListUsers for users of userType only, or of every
+// type if it is empty. Profiles are loaded with one query per type, however
+// many users the page holds.
+func (r *Repository) ListUsersWithProfiles(page pagination.Request, userType core.UserType) ([]core.User, error) {
+	return readOnly(r, func(r *Repository) ([]core.User, error) {
+		return r.listUsers(page, userType)
+	})
+}
+
+func (r *Repository) listUsers(page pagination.Request, userType core.UserType) ([]core.User, error) {
 	var users []core.User
+	query := r.db.Model(&core.User{}).Order("created_at DESC, id DESC").Limit(page.Fetch())
+	if userType != "" {
+		query = query.Where("user_type = ?", userType)
+	}
+	if page.After != nil {
+		query = query.Where("(created_at, id) < (?, ?)", page.After.CreatedAt, page.After.ID)
+	} else {
+		query = query.Offset(page.Offset)
+	}
 	// Optimized: Get users first, then load profiles based on user type
-	err := r.db.Model(&core.User{}).
-		Offset(offset).Limit(limit).Find(&users).Error
+	err := query.Find(&users).Error
 		
 	if err != nil {
 		return nil, err
@@ -163,7 +376,9 @@ func (r *Repository) ListUsers(offset, limit int) ([]core.User, error) {
 	// Batch load profiles
 	if len(studentIDs) > 0 {
 		var profiles []core.StudentProfile
-		r.db.Where("user_id IN ?", studentIDs).Find(&profiles)
+		if err := r.db.Where("user_id IN ?", studentIDs).Find(&profiles).Error; err != nil {
+			return nil, err
+		}
 		profileMap := make(map[string]*core.StudentProfile)
 		for i := range profiles {
 			profileMap[profiles[i].UserID.String()] = &profiles[i]
@@ -171,13 +386,18 @@ func (r *Repository) ListUsers(offset, limit int) ([]core.User, error) {
 		for i := range users {
 			if users[i].UserType == core.UserTypeStudent {
 				users[i].StudentProfile = profileMap[users[i].ID.String()]
+				if users[i].StudentProfile == nil {
+					markProfileMissing(&users[i])
+				}
 			}
 		}
 	}
 	
 	if len(instructorIDs) > 0 {
 		var profiles []core.InstructorProfile
-		r.db.Where("user_id IN ?", instructorIDs).Find(&profiles)
+		if err := r.db.Where("user_id IN ?", instructorIDs).Find(&profiles).Error; err != nil {
+			return nil, err
+		}
 		profileMap := make(map[string]*core.InstructorProfile)
 		for i := range profiles {
 			profileMap[profiles[i].UserID.String()] = &profiles[i]
@@ -185,20 +405,25 @@ func (r *Repository) ListUsers(offset, limit int) ([]core.User, error) {
 		for i := range users {
 			if users[i].UserType == core.UserTypeInstructor {
 				users[i].InstructorProfile = profileMap[users[i].ID.String()]
+				if users[i].InstructorProfile == nil {
+					markProfileMissing(&users[i])
+				}
 			}
 		}
 	}
 	
 	if len(adminIDs) > 0 {
 		var profiles []core.InstituteAdminProfile
-		r.db.Where("user_id IN ?", adminIDs).Find(&profiles)
-		profileMap := make(map[string]*core.InstituteAdminProfile)
-		for i := range profiles {
-			profileMap[profiles[i].UserID.String()] = &profiles[i]
+		if err := instituteBindings(r.db).Where("institute_admin_profiles.user_id IN ?", adminIDs).Find(&profiles).Error; err != nil {
+			return nil, err
+		}
+		profileMap := make(map[string][]core.InstituteAdminProfile)
+		for _, profile := range profiles {
+			profileMap[profile.UserID.String()] = append(profileMap[profile.UserID.String()], profile)
 		}
 		for i := range users {
 			if users[i].UserType == core.UserTypeInstituteAdmin {
-				users[i].InstituteAdminProfile = profileMap[users[i].ID.String()]
+				users[i].InstituteAdminProfiles = profileMap[users[i].ID.String()]
 			}
 		}
 	}
@@ -213,14 +438,16 @@ func (r *Repository) CreateInstitute(institute *core.Institute) error {
 }
 
 func (r *Repository) UpdateInstitute(institute *core.Institute) error {
-	return r.db.Save(institute).Error
+	return updateVersioned(r.db, institute, &institute.Version)
 }
 
-func (r *Repository) DeleteInstitute(id string) error {
-	return r.db.Delete(&core.Institute{}, "id = ?", id).Error
+func (r *Repository) GetInstitutes(query string) ([]core.Institute, error) {
+	return readOnly(r, func(r *Repository) ([]core.Institute, error) {
+		return r.getInstitutes(query)
+	})
 }
 
-func (r *Repository) GetInstitutes(query string) ([]core.Institute, error) {
+func (r *Repository) getInstitutes(query string) ([]core.Institute, error) {
 	var institutes []core.Institute
 	db := r.db
 	if query != "" {
@@ -231,6 +458,48 @@ func (r *Repository) GetInstitutes(query string) ([]core.Institute, error) {
 	return institutes, err
 }
 
+// InstituteCodeExists reports whether another institute already uses code
+func (r *Repository) InstituteCodeExists(code string, excludeID string) (bool, error) {
+	var count int64
+	db := r.db.Model(&core.Institute{}).Where("code = ?", code)
+	if excludeID != "" {
+		db = db.Where("id <> ?", excludeID)
+	}
+	err := db.Count(&count).Error
+	return count > 0, err
+}
+
+// InstituteDomainExists reports whether another institute already uses domain (case-insensitive)
+func (r *Repository) InstituteDomainExists(domain string, excludeID string) (bool, error) {
+	var count int64
+	db := r.db.Model(&core.Institute{}).Where("LOWER(domain) = LOWER(?)", domain)
+	if excludeID != "" {
+		db = db.Where("id <> ?", excludeID)
+	}
+	err := db.Count(&count).Error
+	return count > 0, err
+}
+
+// EnrollmentNumberExists reports whether a student in the institute already has the enrollment number
+func (r *Repository) EnrollmentNumberExists(instituteID *uuid.UUID, enrollmentNumber string) (bool, error) {
+	var count int64
+	db := r.db.Model(&core.StudentProfile{}).Where("enrollment_number = ?", enrollmentNumber)
+	if instituteID != nil {
+		db = db.Where("institute_id = ?", *instituteID)
+	} else {
+		db = db.Where("institute_id IS NULL")
+	}
+	err := db.Count(&count).Error
+	return count > 0, err
+}
+
+// EmployeeIDExists reports whether an instructor already has the employee ID
+func (r *Repository) EmployeeIDExists(employeeID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&core.InstructorProfile{}).Where("employee_id = ?", employeeID).Count(&count).Error
+	return count > 0, err
+}
+
 func (r *Repository) CreateInstituteWithAdmins(institute *core.Institute, admins []*core.User) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(institute).Error; err != nil {
@@ -238,28 +507,47 @@ func (r *Repository) CreateInstituteWithAdmins(institute *core.Institute, admins
 		}
 
 		for _, admin := range admins {
-			// Find or create admin
+			// Find or create admin. A user created with the email since
+			// the lookup is found by the second one; the insert does nothing
+			// rather than fail, which would abort the transaction.
 			var existingUser core.User
-			err := tx.Where("email = ?", admin.Email).First(&existingUser).Error
-			if err != nil {
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					// Create new user
-					if err := tx.Create(admin).Error; err != nil {
+			err := tx.Where("lower(email) = lower(?)", admin.Email).First(&existingUser).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(admin)
+				if res.Error != nil {
+					return res.Error
+				}
+				if res.RowsAffected > 0 {
+					if err := enqueueUserCreated(tx, admin); err != nil {
 						return err
 					}
-					existingUser = *admin
+					existingUser, err = *admin, nil
 				} else {
-					return err
+					err = tx.Where("lower(email) = lower(?)", admin.Email).First(&existingUser).Error
 				}
 			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Taken by a deleted user, whose email the exact index still holds
+				return ErrEmailTaken
+			}
+			if err != nil {
+				return err
+			}
 
-			// Create InstituteAdminProfile
+			// The admins an institute is created with own it
 			profile := core.InstituteAdminProfile{
 				UserID:      existingUser.ID,
 				InstituteID: institute.ID,
+				Role:        core.InstituteRoleOwner,
 			}
-			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&profile).Error; err != nil {
-				return err
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&profile)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				if err := enqueueInstituteAdminAdded(tx, profile); err != nil {
+					return err
+				}
 			}
 		}
 		return nil
@@ -270,7 +558,37 @@ func (r *Repository) GetInstituteByID(id string) (*core.Institute, error) {
 	var institute core.Institute
 	err := r.db.Preload("Faculties").First(&institute, "id = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, errors.New("institute not found")
+		return nil, ErrInstituteNotFound
+	}
+	return &institute, err
+}
+
+// GetSelfRegistrationInstitutes returns the active institutes that let
+// students sign themselves up
+func (r *Repository) GetSelfRegistrationInstitutes() ([]core.Institute, error) {
+	var institutes []core.Institute
+	err := r.db.Where("allow_self_registration AND is_active").Find(&institutes).Error
+	return institutes, err
+}
+
+// RequiresVerifiedEmail reports whether any of the institutes only lets
+// members with a verified email log in
+func (r *Repository) RequiresVerifiedEmail(instituteIDs []uuid.UUID) (bool, error) {
+	if len(instituteIDs) == 0 {
+		return false, nil
+	}
+	var count int64
+	err := r.db.Model(&core.Institute{}).
+		Where("id IN ? AND require_verified_email_for_login", instituteIDs).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *Repository) GetInstituteByCode(code string) (*core.Institute, error) {
+	var institute core.Institute
+	err := r.db.First(&institute, "code = ?", code).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInstituteNotFound
 	}
 	return &institute, err
 }
@@ -286,7 +604,7 @@ func (r *Repository) GetInstituteAdmins(instituteID string) ([]core.User, error)
 	return users, err
 }
 
-func (r *Repository) AddInstituteAdmin(instituteID string, userID string, role string) error {
+func (r *Repository) AddInstituteAdmin(instituteID string, userID string, role core.InstituteRole) error {
 	// Parse UUIDs
 	instituteUUID, err := uuid.Parse(instituteID)
 	if err != nil {
@@ -302,9 +620,32 @@ func (r *Repository) AddInstituteAdmin(instituteID string, userID string, role s
 	adminProfile := &core.InstituteAdminProfile{
 		UserID:      userUUID,
 		InstituteID: instituteUUID,
+		Role:        role,
 	}
 	
-	return r.db.Create(adminProfile).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// The first admin of an institute without an owner becomes its owner
+		if role != core.InstituteRoleOwner {
+			var institute core.Institute
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", instituteUUID).First(&institute).Error; err != nil {
+				return err
+			}
+			if err := requireAnotherOwner(tx, instituteUUID, userUUID); errors.Is(err, ErrLastInstituteOwner) {
+				adminProfile.Role = core.InstituteRoleOwner
+			} else if err != nil {
+				return err
+			}
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(adminProfile)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyInstituteAdmin
+		}
+		return enqueueInstituteAdminAdded(tx, *adminProfile)
+	})
 }
 
 func (r *Repository) RemoveInstituteAdmin(instituteID string, userID string) error {
@@ -319,111 +660,223 @@ func (r *Repository) RemoveInstituteAdmin(instituteID string, userID string) err
 		return err
 	}
 	
-	// Remove the institute admin profile
-	return r.db.Where("user_id = ? AND institute_id = ?", userUUID, instituteUUID).
-		Delete(&core.InstituteAdminProfile{}).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		profile, err := lockInstituteAdmin(tx, instituteUUID, userUUID)
+		if err != nil {
+			return err
+		}
+		if profile.Role == core.InstituteRoleOwner {
+			if err := requireAnotherOwner(tx, instituteUUID, userUUID); err != nil {
+				return err
+			}
+		}
+		return tx.Where("user_id = ? AND institute_id = ?", userUUID, instituteUUID).
+			Delete(&core.InstituteAdminProfile{}).Error
+	})
 }
 
+// CreateFaculty adds a faculty to a live institute
 func (r *Repository) CreateFaculty(faculty *core.Faculty) error {
-	return r.db.Create(faculty).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockLiveUnit(liveInstitutes(tx), faculty.InstituteID, ErrInstituteNotFound); err != nil {
+			return err
+		}
+		return tx.Create(faculty).Error
+	})
 }
 
 func (r *Repository) UpdateFaculty(faculty *core.Faculty) error {
-	return r.db.Save(faculty).Error
-}
-
-func (r *Repository) DeleteFaculty(id string) error {
-	return r.db.Delete(&core.Faculty{}, "id = ?", id).Error
+	return updateVersioned(r.db, faculty, &faculty.Version)
 }
 
 func (r *Repository) GetFacultyByID(id string) (*core.Faculty, error) {
 	var faculty core.Faculty
-	err := r.db.Preload("Departments").First(&faculty, "id = ?", id).Error
+	err := r.db.Preload("Departments").
+		Where("institute_id IN (?)", liveInstitutes(r.db)).
+		First(&faculty, "id = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, errors.New("faculty not found")
+		return nil, ErrFacultyNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
-	return &faculty, err
+	if faculty.Head, err = r.getOrgUnitHead(faculty.HeadUserID); err != nil {
+		return nil, err
+	}
+	return &faculty, nil
+}
+
+// SetFacultyHead sets (or clears, when userID is nil) the dean of a faculty
+func (r *Repository) SetFacultyHead(id string, userID *uuid.UUID) error {
+	var head interface{}
+	if userID != nil {
+		head = *userID
+	}
+	result := r.db.Model(&core.Faculty{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"head_user_id": head,
+		"version":      gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFacultyNotFound
+	}
+	return nil
 }
 
 func (r *Repository) GetFacultiesByInstitute(instituteID string) ([]core.Faculty, error) {
+	return readOnly(r, func(r *Repository) ([]core.Faculty, error) {
+		return r.getFacultiesByInstitute(instituteID)
+	})
+}
+
+func (r *Repository) getFacultiesByInstitute(instituteID string) ([]core.Faculty, error) {
 	var faculties []core.Faculty
-	err := r.db.Where("institute_id = ?", instituteID).Find(&faculties).Error
+	err := r.db.Where("institute_id = ? AND institute_id IN (?)", instituteID, liveInstitutes(r.db)).
+		Find(&faculties).Error
 	return faculties, err
 }
 
+// CreateDepartment adds a department to a live faculty
 func (r *Repository) CreateDepartment(dept *core.Department) error {
-	return r.db.Create(dept).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockLiveUnit(liveFaculties(tx), dept.FacultyID, ErrFacultyNotFound); err != nil {
+			return err
+		}
+		return tx.Create(dept).Error
+	})
 }
 
 func (r *Repository) UpdateDepartment(dept *core.Department) error {
-	return r.db.Save(dept).Error
-}
-
-func (r *Repository) DeleteDepartment(id string) error {
-	return r.db.Delete(&core.Department{}, "id = ?", id).Error
+	return updateVersioned(r.db, dept, &dept.Version)
 }
 
 func (r *Repository) GetDepartmentByID(id string) (*core.Department, error) {
 	var dept core.Department
-	err := r.db.Preload("Classes").First(&dept, "id = ?", id).Error
+	err := r.db.Preload("Classes").
+		Where("faculty_id IN (?)", liveFaculties(r.db)).
+		First(&dept, "id = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, errors.New("department not found")
+		return nil, ErrDepartmentNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
-	return &dept, err
+	if dept.Head, err = r.getOrgUnitHead(dept.HeadUserID); err != nil {
+		return nil, err
+	}
+	return &dept, nil
+}
+
+// SetDepartmentHead sets (or clears, when userID is nil) the head of a department
+func (r *Repository) SetDepartmentHead(id string, userID *uuid.UUID) error {
+	var head interface{}
+	if userID != nil {
+		head = *userID
+	}
+	result := r.db.Model(&core.Department{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"head_user_id": head,
+		"version":      gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDepartmentNotFound
+	}
+	return nil
+}
+
+func (r *Repository) getOrgUnitHead(userID *uuid.UUID) (*core.OrgUnitHead, error) {
+	if userID == nil {
+		return nil, nil
+	}
+	var head core.OrgUnitHead
+	result := r.db.Model(&core.User{}).
+		Select("id, full_name, email").
+		Where("id = ?", *userID).
+		Limit(1).
+		Scan(&head)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &head, nil
 }
 
 func (r *Repository) GetDepartmentsByFaculty(facultyID string) ([]core.Department, error) {
-	var depts []core.Department
-	err := r.db.Where("faculty_id = ?", facultyID).Find(&depts).Error
-	return depts, err
+	return readOnly(r, func(r *Repository) ([]core.Department, error) {
+		return r.getDepartmentsByFaculty(facultyID)
+	})
 }
 
-func (r *Repository) CreateClass(class *core.Class) error {
-	return r.db.Create(class).Error
+func (r *Repository) getDepartmentsByFaculty(facultyID string) ([]core.Department, error) {
+	var depts []core.Department
+	err := r.db.Where("faculty_id = ? AND faculty_id IN (?)", facultyID, liveFaculties(r.db)).
+		Find(&depts).Error
+	return depts, err
 }
 
+// UpdateClass saves class and, if its capacity went up or was removed, fills
+// the new seats from the waitlist
 func (r *Repository) UpdateClass(class *core.Class) error {
-	return r.db.Save(class).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, class, &class.Version); err != nil {
+			return err
+		}
+		_, err := promoteWaitlist(tx, class)
+		return err
+	})
 }
 
 func (r *Repository) DeleteClass(id string) error {
-	return r.db.Delete(&core.Class{}, "id = ?", id).Error
+	return deleted(r.db.Delete(&core.Class{}, "id = ?", id), ErrClassNotFound)
 }
 
+// GetClassByID returns a class with its enrollments and its sections, each
+// with its enrolled count
 func (r *Repository) GetClassByID(id string) (*core.Class, error) {
 	var class core.Class
-	err := r.db.Preload("Enrollments").First(&class, "id = ?", id).Error
+	err := r.db.Preload("Enrollments", seated).
+		Where("department_id IN (?)", liveDepartments(r.db)).
+		First(&class, "id = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, errors.New("class not found")
+		return nil, ErrClassNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
+	class.Sections, err = r.ListSections(class.ID)
 	return &class, err
 }
 
 func (r *Repository) GetClassesByDepartment(deptID string) ([]core.Class, error) {
 	var classes []core.Class
-	err := r.db.Where("department_id = ?", deptID).Find(&classes).Error
+	err := r.db.Where("department_id = ? AND department_id IN (?)", deptID, liveDepartments(r.db)).
+		Find(&classes).Error
 	return classes, err
 }
 
 // -- Memberships --
 
-func (r *Repository) EnrollStudent(enrollment *core.ClassEnrollment) error {
-	return r.db.Create(enrollment).Error
-}
-
-func (r *Repository) UnenrollStudent(classID, studentID string) error {
-	return r.db.Where("class_id = ? AND student_id = ?", classID, studentID).Delete(&core.ClassEnrollment{}).Error
-}
-
-func (r *Repository) GetClassEnrollments(classID string) ([]core.ClassEnrollment, error) {
+// GetClassEnrollments returns a class's enrollments, only those in sectionID
+// if that is set
+func (r *Repository) GetClassEnrollments(classID string, sectionID *uuid.UUID) ([]core.ClassEnrollment, error) {
 	var enrollments []core.ClassEnrollment
-	// Maybe preload Student?
-	err := r.db.Preload("Student").Where("class_id = ?", classID).Find(&enrollments).Error
+	query := r.db.Preload("Student").Scopes(seated).Where("class_id = ?", classID)
+	if sectionID != nil {
+		query = query.Where("section_id = ?", *sectionID)
+	}
+	err := query.Find(&enrollments).Error
 	return enrollments, err
 }
 
 func (r *Repository) GetUserEnrollments(studentID string) ([]core.ClassEnrollment, error) {
 	var enrollments []core.ClassEnrollment
-	err := r.db.Preload("Class").Where("student_id = ?", studentID).Find(&enrollments).Error
+	err := r.db.Scopes(seated).Where("student_id = ? AND class_id IN (?)", studentID, liveClasses(r.db)).
+		Find(&enrollments).Error
 	return enrollments, err
 }
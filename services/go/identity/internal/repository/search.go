@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"gorm.io/gorm/clause"
+)
+
+// instituteMembersSQL selects the IDs of every user tied to an institute:
+// students by profile or class enrollment, institute admins, and the heads
+// of its faculties and departments.
+const instituteMembersSQL = `
+	SELECT sp.user_id FROM student_profiles sp WHERE sp.institute_id = @institute
+	UNION
+	SELECT ce.student_id FROM class_enrollments ce
+		JOIN classes c ON c.id = ce.class_id
+		JOIN departments d ON d.id = c.department_id
+		JOIN faculties f ON f.id = d.faculty_id
+		WHERE f.institute_id = @institute AND c.deleted_at IS NULL AND ce.status = 'enrolled'
+	UNION
+	SELECT iap.user_id FROM institute_admin_profiles iap WHERE iap.institute_id = @institute
+	UNION
+	SELECT f.head_user_id FROM faculties f
+		WHERE f.institute_id = @institute AND f.deleted_at IS NULL AND f.head_user_id IS NOT NULL
+	UNION
+	SELECT d.head_user_id FROM departments d
+		JOIN faculties f ON f.id = d.faculty_id
+		WHERE f.institute_id = @institute AND d.deleted_at IS NULL AND d.head_user_id IS NOT NULL`
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchInstituteUsers finds users of an institute whose email starts with q
+// or whose name contains q (case-insensitive), only the students of cohort
+// if it is set. Prefix matches come first.
+func (r *Repository) SearchInstituteUsers(instituteID, q string, userType core.UserType, cohort *core.Cohort, limit int) ([]core.User, error) {
+	return readOnly(r, func(r *Repository) ([]core.User, error) {
+		return r.searchInstituteUsers(instituteID, q, userType, cohort, limit)
+	})
+}
+
+func (r *Repository) searchInstituteUsers(instituteID, q string, userType core.UserType, cohort *core.Cohort, limit int) ([]core.User, error) {
+	q = escapeLike(strings.ToLower(strings.TrimSpace(q)))
+	params := map[string]interface{}{
+		"institute": instituteID,
+		"prefix":    q + "%",
+		"substr":    "%" + q + "%",
+	}
+
+	query := r.db.Model(&core.User{}).
+		Where("users.id IN ("+instituteMembersSQL+")", params).
+		Where("(lower(users.email) LIKE @prefix OR lower(users.full_name) LIKE @substr)", params)
+	if userType != "" {
+		query = query.Where("users.user_type = ?", userType)
+	}
+	if cohort != nil {
+		query = query.Where("users.id IN ("+cohortMembersSQL+")", cohortParams(instituteID, *cohort))
+	}
+
+	var users []core.User
+	err := query.
+		Clauses(clause.OrderBy{Expression: clause.NamedExpr{
+			SQL:  "CASE WHEN lower(users.email) LIKE @prefix OR lower(users.full_name) LIKE @prefix THEN 0 ELSE 1 END, users.full_name ASC",
+			Vars: []interface{}{params},
+		}}).
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultSectionName names the section every class is created with
+const DefaultSectionName = "Default"
+
+var (
+	ErrSectionNotFound = errors.New("section not found")
+	ErrSectionFull     = errors.New("section is full")
+	ErrDefaultSection  = errors.New("the default section of a class cannot be deleted")
+	ErrSectionNotEmpty = errors.New("section still has enrolled students")
+	ErrNotEnrolled     = errors.New("student is not enrolled in this class")
+	// ErrSectionOverfilled blocks lowering a section's capacity below its
+	// enrolled students
+	ErrSectionOverfilled = errors.New("capacity is below the students already enrolled in the section")
+)
+
+// CreateClass adds a class to a live department, along with its default
+// section
+func (r *Repository) CreateClass(class *core.Class) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockLiveUnit(liveDepartments(tx), class.DepartmentID, ErrDepartmentNotFound); err != nil {
+			return err
+		}
+		if err := tx.Create(class).Error; err != nil {
+			return err
+		}
+		section := core.ClassSection{ClassID: class.ID, Name: DefaultSectionName, IsDefault: true}
+		if err := tx.Create(&section).Error; err != nil {
+			return err
+		}
+		class.Sections = []core.ClassSection{section}
+		return nil
+	})
+}
+
+// BackfillDefaultSections gives every class without a default section one,
+// moving its enrollments and waitlist entries that name no section into it.
+// AutoMigrate runs it for databases set up before sections existed.
+func (r *Repository) BackfillDefaultSections() error {
+	var classIDs []uuid.UUID
+	err := r.db.Unscoped().Model(&core.Class{}).
+		Where("NOT EXISTS (SELECT 1 FROM class_sections s WHERE s.class_id = classes.id AND s.is_default)").
+		Pluck("id", &classIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, classID := range classIDs {
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			section := core.ClassSection{ClassID: classID, Name: DefaultSectionName, IsDefault: true}
+			if err := tx.Create(&section).Error; err != nil {
+				return err
+			}
+			unset := "class_id = ? AND (section_id IS NULL OR section_id = ?)"
+			err := tx.Model(&core.ClassEnrollment{}).Where(unset, classID, uuid.Nil).
+				Update("section_id", section.ID).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&core.ClassWaitlistEntry{}).Where(unset, classID, uuid.Nil).
+				Update("section_id", section.ID).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSections returns a class's sections, the default one first, each with
+// its enrolled count
+func (r *Repository) ListSections(classID uuid.UUID) ([]core.ClassSection, error) {
+	var sections []core.ClassSection
+	err := r.db.Where("class_id = ?", classID).Order("is_default DESC, name").Find(&sections).Error
+	if err != nil {
+		return nil, err
+	}
+	seats, err := sectionSeats(r.db, classID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sections {
+		sections[i].Enrolled = seats[sections[i].ID]
+	}
+	return sections, nil
+}
+
+func (r *Repository) GetSection(classID, sectionID uuid.UUID) (*core.ClassSection, error) {
+	var section core.ClassSection
+	err := r.db.First(&section, "id = ? AND class_id = ?", sectionID, classID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSectionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	section.Enrolled, err = countSectionSeats(r.db, section.ID)
+	return &section, err
+}
+
+// CreateSection adds a section to an existing class
+func (r *Repository) CreateSection(section *core.ClassSection) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockClass(tx, section.ClassID); err != nil {
+			return err
+		}
+		section.IsDefault = false
+		return tx.Create(section).Error
+	})
+}
+
+// UpdateSection saves a section's name, capacity, schedule and instructor.
+// The capacity cannot drop below the students enrolled; seats it adds are
+// filled from the waitlist.
+func (r *Repository) UpdateSection(section *core.ClassSection) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		class, err := lockClass(tx, section.ClassID)
+		if err != nil {
+			return err
+		}
+		taken, err := countSectionSeats(tx, section.ID)
+		if err != nil {
+			return err
+		}
+		if section.Capacity != nil && int64(*section.Capacity) < taken {
+			return ErrSectionOverfilled
+		}
+		if err := updateVersioned(tx, section, &section.Version, "class_id", "is_default", "created_at"); err != nil {
+			return err
+		}
+		if _, err := promoteWaitlist(tx, class); err != nil {
+			return err
+		}
+		section.Enrolled, err = countSectionSeats(tx, section.ID)
+		return err
+	})
+}
+
+// DeleteSection removes a section nobody is enrolled in. Students waiting for
+// it move to the default section's waitlist, keeping their places. The
+// default section cannot be deleted.
+func (r *Repository) DeleteSection(classID, sectionID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		class, err := lockClass(tx, classID)
+		if err != nil {
+			return err
+		}
+		var section core.ClassSection
+		err = tx.First(&section, "id = ? AND class_id = ?", sectionID, classID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSectionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if section.IsDefault {
+			return ErrDefaultSection
+		}
+		taken, err := countSectionSeats(tx, section.ID)
+		if err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrSectionNotEmpty
+		}
+
+		fallback, err := enrollmentSection(tx, classID, uuid.Nil)
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&core.ClassWaitlistEntry{}).Where("section_id = ?", section.ID).
+			Update("section_id", fallback.ID).Error
+		if err != nil {
+			return err
+		}
+		// Requests to join still name the section
+		err = tx.Model(&core.ClassEnrollment{}).Where("section_id = ?", section.ID).
+			Update("section_id", fallback.ID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&section).Error; err != nil {
+			return err
+		}
+		_, err = promoteWaitlist(tx, class)
+		return err
+	})
+}
+
+// MoveEnrollment moves an enrolled student to another section of the class
+// if it has a free seat. The seat they leave goes to the waitlist.
+func (r *Repository) MoveEnrollment(classID, studentID, sectionID uuid.UUID) (*core.ClassEnrollment, error) {
+	var enrollment core.ClassEnrollment
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		class, err := lockClass(tx, classID)
+		if err != nil {
+			return err
+		}
+		err = tx.Scopes(seated).First(&enrollment, "class_id = ? AND student_id = ?", classID, studentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotEnrolled
+		}
+		if err != nil {
+			return err
+		}
+		section, err := enrollmentSection(tx, classID, sectionID)
+		if err != nil {
+			return err
+		}
+		if enrollment.SectionID == section.ID {
+			return nil
+		}
+		if section.Capacity != nil {
+			taken, err := countSectionSeats(tx, section.ID)
+			if err != nil {
+				return err
+			}
+			if taken >= int64(*section.Capacity) {
+				return ErrSectionFull
+			}
+		}
+
+		enrollment.SectionID = section.ID
+		err = tx.Model(&core.ClassEnrollment{}).
+			Where("class_id = ? AND student_id = ?", classID, studentID).
+			Update("section_id", section.ID).Error
+		if err != nil {
+			return err
+		}
+		_, err = promoteWaitlist(tx, class)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// enrollmentSection returns the section of the class an enrollment goes to:
+// sectionID, or the default section when that is uuid.Nil
+func enrollmentSection(tx *gorm.DB, classID, sectionID uuid.UUID) (*core.ClassSection, error) {
+	query := tx.Where("class_id = ?", classID)
+	if sectionID == uuid.Nil {
+		query = query.Where("is_default")
+	} else {
+		query = query.Where("id = ?", sectionID)
+	}
+	var section core.ClassSection
+	err := query.First(&section).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSectionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &section, nil
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSlotNotFound    = errors.New("availability slot not found")
+	ErrBookingNotFound = errors.New("student has not booked this slot")
+	ErrSlotOverlap     = errors.New("slot overlaps another slot of the instructor")
+	ErrSlotFull        = errors.New("slot is fully booked")
+	ErrAlreadyBooked   = errors.New("student has already booked this slot")
+	ErrSlotCancelled   = errors.New("slot has been cancelled")
+	ErrSlotStarted     = errors.New("slot has already started")
+	// ErrSlotOverbooked blocks lowering a slot's capacity below its bookings
+	ErrSlotOverbooked = errors.New("capacity is below the seats already booked")
+)
+
+// CreateSlot adds a slot; one overlapping another slot of the instructor
+// returns ErrSlotOverlap
+func (r *Repository) CreateSlot(slot *core.AvailabilitySlot) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockInstructorCalendar(tx, slot); err != nil {
+			return err
+		}
+		return tx.Create(slot).Error
+	})
+}
+
+// UpdateSlot saves the times, capacity and location of a slot with the same
+// overlap check as CreateSlot. A cancelled slot cannot change, and capacity
+// cannot drop below the seats taken.
+func (r *Repository) UpdateSlot(slot *core.AvailabilitySlot) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockSlot(tx, slot.ID)
+		if err != nil {
+			return err
+		}
+		if current.Cancelled() {
+			return ErrSlotCancelled
+		}
+		if err := lockInstructorCalendar(tx, slot); err != nil {
+			return err
+		}
+		taken, err := countBookings(tx, slot.ID)
+		if err != nil {
+			return err
+		}
+		if int64(slot.Capacity) < taken {
+			return ErrSlotOverbooked
+		}
+		slot.SeatsTaken = taken
+		return tx.Model(slot).
+			Select("starts_at", "ends_at", "timezone", "capacity", "location", "updated_at").
+			Updates(slot).Error
+	})
+}
+
+// CancelSlot marks a slot cancelled at now. Its bookings stay so the
+// students can be told; ClaimSlotCancellation hands them out.
+func (r *Repository) CancelSlot(id uuid.UUID, now time.Time) error {
+	result := r.db.Model(&core.AvailabilitySlot{}).
+		Where("id = ? AND cancelled_at IS NULL", id).
+		Updates(map[string]interface{}{"cancelled_at": now, "updated_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	if _, err := r.GetSlot(id); err != nil {
+		return err
+	}
+	return ErrSlotCancelled
+}
+
+func (r *Repository) GetSlot(id uuid.UUID) (*core.AvailabilitySlot, error) {
+	var slot core.AvailabilitySlot
+	err := r.db.First(&slot, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSlotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	slot.SeatsTaken, err = countBookings(r.db, slot.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// ListClassSlots returns the slots of a class that have not ended by now and
+// are not cancelled, soonest first
+func (r *Repository) ListClassSlots(classID uuid.UUID, now time.Time) ([]core.AvailabilitySlot, error) {
+	return r.listSlots(r.db.Where("class_id = ?", classID), now)
+}
+
+// ListInstructorSlots is ListClassSlots for the slots an instructor holds
+func (r *Repository) ListInstructorSlots(instructorID uuid.UUID, now time.Time) ([]core.AvailabilitySlot, error) {
+	return r.listSlots(r.db.Where("instructor_id = ?", instructorID), now)
+}
+
+func (r *Repository) listSlots(query *gorm.DB, now time.Time) ([]core.AvailabilitySlot, error) {
+	slots := make([]core.AvailabilitySlot, 0)
+	err := query.
+		Where("cancelled_at IS NULL AND ends_at > ?", now.UTC()).
+		Order("starts_at, id").
+		Find(&slots).Error
+	if err != nil || len(slots) == 0 {
+		return slots, err
+	}
+
+	ids := make([]uuid.UUID, len(slots))
+	for i, slot := range slots {
+		ids[i] = slot.ID
+	}
+	var counts []struct {
+		SlotID uuid.UUID
+		Taken  int64
+	}
+	err = r.db.Model(&core.SlotBooking{}).
+		Select("slot_id, COUNT(*) AS taken").
+		Where("slot_id IN ?", ids).
+		Group("slot_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[uuid.UUID]int64, len(counts))
+	for _, c := range counts {
+		taken[c.SlotID] = c.Taken
+	}
+	for i := range slots {
+		slots[i].SeatsTaken = taken[slots[i].ID]
+	}
+	return slots, nil
+}
+
+// BookSlot gives the student a seat in the slot if one is free. The slot is
+// locked first, so concurrent bookings are counted one at a time and cannot
+// overbook it. A student holds at most one seat per slot.
+func (r *Repository) BookSlot(booking *core.SlotBooking, now time.Time) (*core.AvailabilitySlot, error) {
+	var booked *core.AvailabilitySlot
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		slot, err := lockSlot(tx, booking.SlotID)
+		if err != nil {
+			return err
+		}
+		if slot.Cancelled() {
+			return ErrSlotCancelled
+		}
+		if !slot.StartsAt.After(now) {
+			return ErrSlotStarted
+		}
+
+		var existing int64
+		err = tx.Model(&core.SlotBooking{}).
+			Where("slot_id = ? AND student_id = ?", booking.SlotID, booking.StudentID).
+			Count(&existing).Error
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAlreadyBooked
+		}
+
+		taken, err := countBookings(tx, slot.ID)
+		if err != nil {
+			return err
+		}
+		if taken >= int64(slot.Capacity) {
+			return ErrSlotFull
+		}
+
+		booking.BookedAt = now.UTC()
+		if err := tx.Create(booking).Error; err != nil {
+			return err
+		}
+		slot.SeatsTaken = taken + 1
+		booked = slot
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return booked, nil
+}
+
+// CancelBooking gives up a student's seat in a slot
+func (r *Repository) CancelBooking(slotID, studentID uuid.UUID) error {
+	return deleted(r.db.Delete(&core.SlotBooking{}, "slot_id = ? AND student_id = ?", slotID, studentID), ErrBookingNotFound)
+}
+
+// GetSlotBookings returns the bookings of a slot in the order they were made
+func (r *Repository) GetSlotBookings(slotID uuid.UUID) ([]core.SlotBooking, error) {
+	bookings := make([]core.SlotBooking, 0)
+	err := r.db.Preload("Student").Where("slot_id = ?", slotID).Order("booked_at, student_id").Find(&bookings).Error
+	return bookings, err
+}
+
+// SlotBookedStudents returns the students booked into a slot, leaving out
+// disabled and deleted users
+func (r *Repository) SlotBookedStudents(slotID uuid.UUID) ([]core.User, error) {
+	var users []core.User
+	err := r.db.
+		Where("users.id IN (?)", r.db.Model(&core.SlotBooking{}).Select("student_id").Where("slot_id = ?", slotID)).
+		Where("users.status <> ?", "disabled").
+		Order("users.id").
+		Find(&users).Error
+	return users, err
+}
+
+// ClaimSlotCancellation marks the earliest cancelled slot whose students
+// have not been told yet as notified and returns it, or nil if there is none.
+// As with announcements, a failed send is not retried and SKIP LOCKED keeps
+// several notifiers from claiming the same slot.
+func (r *Repository) ClaimSlotCancellation(now time.Time) (*core.AvailabilitySlot, error) {
+	var claimed *core.AvailabilitySlot
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var candidate core.AvailabilitySlot
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("cancelled_at IS NOT NULL AND notified_at IS NULL").
+			Order("cancelled_at ASC").
+			First(&candidate).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&core.AvailabilitySlot{}).Where("id = ?", candidate.ID).Update("notified_at", now).Error; err != nil {
+			return err
+		}
+		candidate.NotifiedAt = &now
+		claimed = &candidate
+		return nil
+	})
+	return claimed, err
+}
+
+// lockSlot reads a slot FOR UPDATE. Bookings and edits of a slot take this
+// lock first.
+func lockSlot(tx *gorm.DB, id uuid.UUID) (*core.AvailabilitySlot, error) {
+	var slot core.AvailabilitySlot
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&slot, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSlotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// lockInstructorCalendar locks the slot's instructor, so their slots are
+// checked for overlaps one at a time, then looks for a live slot of theirs
+// that overlaps this one. Slots that only touch, one ending as the next
+// starts, do not overlap.
+func lockInstructorCalendar(tx *gorm.DB, slot *core.AvailabilitySlot) error {
+	var instructor core.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&instructor, "id = ?", slot.InstructorID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var clash core.AvailabilitySlot
+	result := tx.Where("instructor_id = ? AND id <> ? AND cancelled_at IS NULL AND starts_at < ? AND ends_at > ?",
+		slot.InstructorID, slot.ID, slot.EndsAt.UTC(), slot.StartsAt.UTC()).Limit(1).Find(&clash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return fmt.Errorf("%w (%s to %s)", ErrSlotOverlap,
+			clash.StartsAt.Format(time.RFC3339), clash.EndsAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func countBookings(tx *gorm.DB, slotID uuid.UUID) (int64, error) {
+	var taken int64
+	err := tx.Model(&core.SlotBooking{}).Where("slot_id = ?", slotID).Count(&taken).Error
+	return taken, err
+}
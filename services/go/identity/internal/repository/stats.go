@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrgStats are dashboard counts for an institute or a department. Units
+// breaks them down per department of an institute or per class of a
+// department. Deleted users are not counted.
+type OrgStats struct {
+	OrgUnitStats
+	// Instructors counts the instructors heading the unit, or for an
+	// institute its faculties and departments
+	Instructors int64          `json:"instructors"`
+	Units       []OrgUnitStats `json:"units"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+type OrgUnitStats struct {
+	ID   *uuid.UUID `json:"id,omitempty"`
+	Name string     `json:"name,omitempty"`
+	// Students counts distinct enrolled students; for an institute it also
+	// includes students registered there without any enrollment
+	Students          int64 `json:"students"`
+	Classes           int64 `json:"classes"`
+	ActiveClasses     int64 `json:"active_classes"` // classes with at least one enrollment
+	Enrollments       int64 `json:"enrollments"`
+	NewEnrollments7d  int64 `json:"new_enrollments_7d"`
+	NewEnrollments30d int64 `json:"new_enrollments_30d"`
+}
+
+// statsSQL counts enrollments per unit and, through the empty grouping set,
+// for the whole scope, in one query. Units without classes still get a row.
+// It is filled in with a query selecting (unit_id, unit_name, class_id) for
+// the scope, then the scalar subqueries, which are the same on every row.
+const statsSQL = `
+	WITH units AS (%s),
+	live_enrollments AS (
+		SELECT ce.class_id, ce.student_id, ce.enrolled_at
+		FROM class_enrollments ce
+		JOIN users u ON u.id = ce.student_id AND u.deleted_at IS NULL
+		WHERE ce.status = 'enrolled'
+	)
+	SELECT
+		s.unit_id,
+		s.unit_name,
+		COUNT(DISTINCT s.class_id) AS classes,
+		COUNT(DISTINCT e.class_id) AS active_classes,
+		COUNT(DISTINCT e.student_id) AS students,
+		COUNT(e.student_id) AS enrollments,
+		COUNT(e.student_id) FILTER (WHERE e.enrolled_at >= @week) AS new_enrollments_7d,
+		COUNT(e.student_id) FILTER (WHERE e.enrolled_at >= @month) AS new_enrollments_30d,
+		(%s) AS scope_found,
+		(%s) AS scope_students,
+		(%s) AS instructors
+	FROM units s
+	LEFT JOIN live_enrollments e ON e.class_id = s.class_id
+	GROUP BY GROUPING SETS ((s.unit_id, s.unit_name), ())`
+
+const (
+	instituteUnitsSQL = `
+		SELECT d.id AS unit_id, d.name AS unit_name, c.id AS class_id
+		FROM departments d
+		JOIN faculties f ON f.id = d.faculty_id
+		LEFT JOIN classes c ON c.department_id = d.id AND c.deleted_at IS NULL
+		WHERE f.institute_id = @scope AND d.deleted_at IS NULL`
+
+	instituteFoundSQL = `SELECT COUNT(*) FROM institutes WHERE id = @scope AND deleted_at IS NULL`
+
+	// Students registered at the institute or enrolled in one of its classes
+	instituteStudentsSQL = `
+		SELECT COUNT(*) FROM users u
+		WHERE u.deleted_at IS NULL AND u.user_type = 'STUDENT' AND u.id IN (
+			SELECT sp.user_id FROM student_profiles sp WHERE sp.institute_id = @scope
+			UNION
+			SELECT ce.student_id FROM class_enrollments ce
+				JOIN classes c ON c.id = ce.class_id
+				JOIN departments d ON d.id = c.department_id
+				JOIN faculties f ON f.id = d.faculty_id
+				WHERE f.institute_id = @scope AND c.deleted_at IS NULL AND ce.status = 'enrolled'
+		)`
+
+	instituteInstructorsSQL = `
+		SELECT COUNT(*) FROM users u
+		WHERE u.deleted_at IS NULL AND u.user_type = 'INSTRUCTOR' AND u.id IN (
+			SELECT f.head_user_id FROM faculties f WHERE f.institute_id = @scope AND f.deleted_at IS NULL
+			UNION
+			SELECT d.head_user_id FROM departments d
+				JOIN faculties f ON f.id = d.faculty_id
+				WHERE f.institute_id = @scope AND d.deleted_at IS NULL
+		)`
+
+	departmentUnitsSQL = `
+		SELECT c.id AS unit_id, c.name AS unit_name, c.id AS class_id
+		FROM classes c
+		WHERE c.department_id = @scope AND c.deleted_at IS NULL`
+
+	departmentFoundSQL = `SELECT COUNT(*) FROM departments WHERE id = @scope AND deleted_at IS NULL`
+
+	// Every department student is enrolled, so the grouped count is used
+	departmentStudentsSQL = `SELECT NULL::bigint`
+
+	departmentInstructorsSQL = `
+		SELECT COUNT(*) FROM users u
+		JOIN departments d ON d.head_user_id = u.id
+		WHERE d.id = @scope AND d.deleted_at IS NULL AND u.deleted_at IS NULL AND u.user_type = 'INSTRUCTOR'`
+)
+
+type statsRow struct {
+	UnitID            *uuid.UUID
+	UnitName          *string
+	Classes           int64
+	ActiveClasses     int64
+	Students          int64
+	Enrollments       int64
+	NewEnrollments7d  int64 `gorm:"column:new_enrollments_7d"`
+	NewEnrollments30d int64 `gorm:"column:new_enrollments_30d"`
+	ScopeFound        int64
+	ScopeStudents     *int64
+	Instructors       int64
+}
+
+// InstituteStats returns the counts for an institute as of now
+func (r *Repository) InstituteStats(instituteID uuid.UUID, now time.Time) (*OrgStats, error) {
+	stats, err := readOnly(r, func(r *Repository) (*OrgStats, error) {
+		return r.orgStats(instituteID, now, instituteUnitsSQL, instituteFoundSQL, instituteStudentsSQL, instituteInstructorsSQL)
+	})
+	if stats == nil && err == nil {
+		return nil, ErrInstituteNotFound
+	}
+	return stats, err
+}
+
+// DepartmentStats returns the counts for a department as of now
+func (r *Repository) DepartmentStats(departmentID uuid.UUID, now time.Time) (*OrgStats, error) {
+	stats, err := readOnly(r, func(r *Repository) (*OrgStats, error) {
+		return r.orgStats(departmentID, now, departmentUnitsSQL, departmentFoundSQL, departmentStudentsSQL, departmentInstructorsSQL)
+	})
+	if stats == nil && err == nil {
+		return nil, ErrDepartmentNotFound
+	}
+	return stats, err
+}
+
+// orgStats runs statsSQL for one scope; it returns nil if the scope does not
+// exist
+func (r *Repository) orgStats(scope uuid.UUID, now time.Time, unitsSQL, foundSQL, studentsSQL, instructorsSQL string) (*OrgStats, error) {
+	var rows []statsRow
+	query := fmt.Sprintf(statsSQL, unitsSQL, foundSQL, studentsSQL, instructorsSQL)
+	err := r.db.Raw(query, map[string]interface{}{
+		"scope": scope,
+		"week":  now.AddDate(0, 0, -7),
+		"month": now.AddDate(0, 0, -30),
+	}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &OrgStats{Units: make([]OrgUnitStats, 0), GeneratedAt: now}
+	for _, row := range rows {
+		if row.ScopeFound == 0 {
+			return nil, nil
+		}
+		unit := OrgUnitStats{
+			ID:                row.UnitID,
+			Students:          row.Students,
+			Classes:           row.Classes,
+			ActiveClasses:     row.ActiveClasses,
+			Enrollments:       row.Enrollments,
+			NewEnrollments7d:  row.NewEnrollments7d,
+			NewEnrollments30d: row.NewEnrollments30d,
+		}
+		if row.UnitID != nil {
+			if row.UnitName != nil {
+				unit.Name = *row.UnitName
+			}
+			stats.Units = append(stats.Units, unit)
+			continue
+		}
+
+		// The empty grouping set: totals for the whole scope
+		stats.OrgUnitStats = unit
+		stats.Instructors = row.Instructors
+		if row.ScopeStudents != nil {
+			stats.Students = *row.ScopeStudents
+		}
+	}
+	sort.Slice(stats.Units, func(i, j int) bool { return stats.Units[i].Name < stats.Units[j].Name })
+	return stats, nil
+}
+
+// ClassScope returns the department and institute a class belongs to
+func (r *Repository) ClassScope(classID uuid.UUID) (departmentID, instituteID uuid.UUID, err error) {
+	var scope struct {
+		DepartmentID uuid.UUID
+		InstituteID  uuid.UUID
+	}
+	err = r.db.Raw(`
+		SELECT d.id AS department_id, f.institute_id
+		FROM classes c
+		JOIN departments d ON d.id = c.department_id
+		JOIN faculties f ON f.id = d.faculty_id
+		WHERE c.id = ? AND c.deleted_at IS NULL`, classID).Scan(&scope).Error
+	if err == nil && scope.DepartmentID == uuid.Nil {
+		err = ErrClassNotFound
+	}
+	return scope.DepartmentID, scope.InstituteID, err
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTermNotFound   = errors.New("term not found")
+	ErrNoCurrentTerm  = errors.New("institute has no current term")
+	ErrTermOverlap    = errors.New("term overlaps another term of the institute")
+	ErrTermHasClasses = errors.New("term still has classes")
+	// ErrTermEnded blocks enrolling into a class whose term is over
+	ErrTermEnded = errors.New("the class's term has ended")
+)
+
+// ClassFilter narrows ListClasses; unset fields match every class
+type ClassFilter struct {
+	DepartmentID *uuid.UUID
+	TermID       *uuid.UUID
+}
+
+// CreateTerm adds a term to its institute. A term overlapping another one
+// returns ErrTermOverlap; marking it current unmarks the others.
+func (r *Repository) CreateTerm(term *core.Term) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTermCalendar(tx, term); err != nil {
+			return err
+		}
+		return tx.Create(term).Error
+	})
+}
+
+// UpdateTerm saves term with the same checks as CreateTerm
+func (r *Repository) UpdateTerm(term *core.Term) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTermCalendar(tx, term); err != nil {
+			return err
+		}
+		return updateVersioned(tx, term, &term.Version)
+	})
+}
+
+// DeleteTerm deletes a term of the institute. A term classes still run in
+// is kept and ErrTermHasClasses returned.
+func (r *Repository) DeleteTerm(instituteID, id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var term core.Term
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&term, "id = ? AND institute_id = ?", id, instituteID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTermNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var classes int64
+		if err := tx.Model(&core.Class{}).Where("term_id = ?", term.ID).Count(&classes).Error; err != nil {
+			return err
+		}
+		if classes > 0 {
+			return ErrTermHasClasses
+		}
+		// Deleted classes may still name the term
+		err = tx.Unscoped().Model(&core.Class{}).Where("term_id = ?", term.ID).Update("term_id", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&term).Error
+	})
+}
+
+// GetTermByID returns a term, which must belong to instituteID unless that
+// is empty
+func (r *Repository) GetTermByID(instituteID, id string) (*core.Term, error) {
+	var term core.Term
+	db := r.db.Where("id = ?", id)
+	if instituteID != "" {
+		db = db.Where("institute_id = ?", instituteID)
+	}
+	err := db.First(&term).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTermNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+// GetTermsByInstitute returns an institute's terms in calendar order
+func (r *Repository) GetTermsByInstitute(instituteID string) ([]core.Term, error) {
+	terms := []core.Term{}
+	err := r.db.Where("institute_id = ?", instituteID).Order("starts_on").Find(&terms).Error
+	return terms, err
+}
+
+// GetCurrentTerm returns the term of the institute running on today, the
+// one marked current first should several be. Between terms it falls back
+// to the term marked current.
+func (r *Repository) GetCurrentTerm(instituteID string, today time.Time) (*core.Term, error) {
+	var term core.Term
+	err := r.db.Where("institute_id = ? AND starts_on <= ? AND ends_on >= ?", instituteID, today, today).
+		Order("is_current DESC, starts_on DESC").
+		First(&term).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = r.db.Where("institute_id = ? AND is_current", instituteID).First(&term).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoCurrentTerm
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+// ListClasses returns the classes matching filter by name
+func (r *Repository) ListClasses(filter ClassFilter) ([]core.Class, error) {
+	return readOnly(r, func(r *Repository) ([]core.Class, error) {
+		return r.listClasses(filter)
+	})
+}
+
+func (r *Repository) listClasses(filter ClassFilter) ([]core.Class, error) {
+	classes := []core.Class{}
+	db := r.db.Order("name").Where("department_id IN (?)", liveDepartments(r.db))
+	if filter.DepartmentID != nil {
+		db = db.Where("department_id = ?", *filter.DepartmentID)
+	}
+	if filter.TermID != nil {
+		db = db.Where("term_id = ?", *filter.TermID)
+	}
+	err := db.Find(&classes).Error
+	return classes, err
+}
+
+// GetClassesByIDs returns the classes with their terms and sections,
+// including deleted classes so records of past classes keep their names
+func (r *Repository) GetClassesByIDs(ids []uuid.UUID) ([]core.Class, error) {
+	classes := []core.Class{}
+	err := r.db.Unscoped().Preload("Term").Preload("Sections").Where("id IN ?", ids).Find(&classes).Error
+	return classes, err
+}
+
+// DepartmentInstituteID returns the institute a department belongs to
+func (r *Repository) DepartmentInstituteID(departmentID uuid.UUID) (uuid.UUID, error) {
+	// Scanned through a struct: gorm would fill a bare uuid.UUID byte by byte
+	var row struct{ InstituteID uuid.UUID }
+	result := r.db.Raw(`
+		SELECT f.institute_id
+		FROM departments d
+		JOIN faculties f ON f.id = d.faculty_id
+		WHERE d.id = ? AND d.deleted_at IS NULL`, departmentID).Scan(&row)
+	if result.Error != nil {
+		return uuid.Nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return uuid.Nil, ErrDepartmentNotFound
+	}
+	return row.InstituteID, nil
+}
+
+// lockTermCalendar locks the term's institute, so terms are checked for
+// overlaps one at a time, then runs those checks. If term is to be current
+// the institute's other terms stop being so.
+func lockTermCalendar(tx *gorm.DB, term *core.Term) error {
+	var institute core.Institute
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&institute, "id = ?", term.InstituteID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInstituteNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var clash core.Term
+	result := tx.Where("institute_id = ? AND id <> ? AND starts_on <= ? AND ends_on >= ?",
+		term.InstituteID, term.ID, term.EndsOn, term.StartsOn).Limit(1).Find(&clash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return fmt.Errorf("%w (%s)", ErrTermOverlap, clash.Name)
+	}
+
+	if !term.IsCurrent {
+		return nil
+	}
+	return tx.Model(&core.Term{}).
+		Where("institute_id = ? AND id <> ? AND is_current", term.InstituteID, term.ID).
+		Updates(map[string]interface{}{"is_current": false, "version": gorm.Expr("version + 1")}).Error
+}
+
+// termEnded reports whether the term ended before today
+func termEnded(tx *gorm.DB, termID uuid.UUID, today time.Time) (bool, error) {
+	var ended int64
+	err := tx.Model(&core.Term{}).Where("id = ? AND ends_on < ?", termID, today).Count(&ended).Error
+	return ended > 0, err
+}
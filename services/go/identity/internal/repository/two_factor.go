@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTwoFactorNotFound    = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrRecoveryCodeNotFound = errors.New("recovery code not found")
+)
+
+// GetTwoFactor returns the user's TOTP enrollment
+func (r *Repository) GetTwoFactor(userID uuid.UUID) (*core.UserTwoFactor, error) {
+	var tf core.UserTwoFactor
+	err := r.db.First(&tf, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTwoFactorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has
+func (r *Repository) CountRecoveryCodes(userID uuid.UUID) (int64, error) {
+	var n int64
+	err := r.db.Model(&core.UserRecoveryCode{}).Where("user_id = ?", userID).Count(&n).Error
+	return n, err
+}
+
+// SaveTwoFactorSetup replaces an unconfirmed enrollment, and its recovery
+// codes, with a new one. An enabled enrollment is left alone and returns
+// ErrTwoFactorEnabled; it has to be disabled first.
+func (r *Repository) SaveTwoFactorSetup(tf *core.UserTwoFactor, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"secret", "updated_at"}),
+			Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_two_factors.enabled_at IS NULL"}}},
+		}).Create(tf)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrTwoFactorEnabled
+		}
+
+		if err := tx.Where("user_id = ?", tf.UserID).Delete(&core.UserRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]core.UserRecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = core.UserRecoveryCode{UserID: tf.UserID, CodeHash: hash}
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&codes).Error
+	})
+}
+
+// EnableTwoFactor marks the user's enrollment confirmed at now
+func (r *Repository) EnableTwoFactor(userID uuid.UUID, now time.Time) error {
+	res := r.db.Model(&core.UserTwoFactor{}).
+		Where("user_id = ? AND enabled_at IS NULL", userID).
+		Updates(map[string]any{"enabled_at": now, "updated_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := r.GetTwoFactor(userID); err != nil {
+			return err
+		}
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// DeleteTwoFactor removes the user's enrollment and recovery codes
+func (r *Repository) DeleteTwoFactor(userID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("user_id = ?", userID).Delete(&core.UserTwoFactor{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrTwoFactorNotFound
+		}
+		return tx.Where("user_id = ?", userID).Delete(&core.UserRecoveryCode{}).Error
+	})
+}
+
+// UseRecoveryCode deletes one of the user's recovery codes by its hash. Of
+// concurrent uses of the same code only one deletes it; the others get
+// ErrRecoveryCodeNotFound.
+func (r *Repository) UseRecoveryCode(userID uuid.UUID, codeHash string) error {
+	res := r.db.Where("user_id = ? AND code_hash = ?", userID, codeHash).Delete(&core.UserRecoveryCode{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// sqlStateUniqueViolation is Postgres' SQLSTATE for a unique index violation
+const sqlStateUniqueViolation = "23505"
+
+// userEmailIndexes are the unique indexes on users' emails: the exact one of
+// the baseline, over deleted users too, and the case-insensitive one over
+// active users
+var userEmailIndexes = []string{"idx_users_email", "idx_users_email_lower_unique"}
+
+// isUniqueViolation reports whether err is a violation of one of the unique
+// indexes named
+func isUniqueViolation(err error, indexes ...string) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != sqlStateUniqueViolation {
+		return false
+	}
+	for _, index := range indexes {
+		if pgErr.ConstraintName == index {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newPostgresRepository returns a repository on the throwaway database in
+// IDENTITY_TEST_DATABASE_URL, set up the way a server starts: the schema,
+// then NormalizeEmails for the case-insensitive email index. The unique
+// indexes and the errors they raise are Postgres', so there is no stand-in.
+func newPostgresRepository(t *testing.T) *Repository {
+	t.Helper()
+	dsn := os.Getenv("IDENTITY_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("IDENTITY_TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	repo := NewRepository(db)
+	if err := repo.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err := repo.NormalizeEmails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) > 0 {
+		t.Fatalf("test database has users sharing emails by case: %v", conflicts)
+	}
+	return repo
+}
+
+func TestConcurrentSignupsWithOneEmail(t *testing.T) {
+	repo := newPostgresRepository(t)
+	email := "race-" + uuid.NewString() + "@example.com"
+	t.Cleanup(func() {
+		repo.db.Unscoped().Where("lower(email) = ?", email).Delete(&core.User{})
+	})
+
+	const signups = 10
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+		taken   int
+	)
+	start := make(chan struct{})
+	for i := 0; i < signups; i++ {
+		// Half of them differ from the rest by case only
+		variant := email
+		if i%2 == 1 {
+			variant = strings.ToUpper(email)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			err := repo.CreateUser(&core.User{ID: uuid.New(), Email: variant, FullName: "Race", UserType: core.UserTypeStudent})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, ErrEmailTaken):
+				taken++
+			default:
+				t.Errorf("CreateUser = %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if created != 1 || taken != signups-1 {
+		t.Fatalf("%d signups created a user and %d got ErrEmailTaken, want 1 and %d", created, taken, signups-1)
+	}
+	var users int64
+	if err := repo.db.Model(&core.User{}).Where("lower(email) = ?", email).Count(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 {
+		t.Fatalf("%d users with the email, want 1", users)
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Actor is who a change is made by: a user, and the admin impersonating them
+// if there is one. The zero Actor is the system itself.
+type Actor struct {
+	UserID         string
+	ImpersonatorID string
+}
+
+// As returns the service acting for actor, whose changes are recorded in the
+// activity log as theirs
+func (s *IdentityService) As(actor Actor) *IdentityService {
+	acting := *s
+	acting.actor = actor
+	return &acting
+}
+
+// RunActivityLog writes recorded activity until ctx is cancelled
+func (s *IdentityService) RunActivityLog(ctx context.Context) {
+	s.activity.Run(ctx)
+}
+
+// Fields never written to the activity log, at any depth
+var sensitiveActivityFields = map[string]bool{
+	"password":      true,
+	"password_hash": true,
+	"temp_password": true,
+	"token":         true,
+	"secret":        true,
+}
+
+// Bookkeeping fields every change touches; they would only add noise
+var ignoredActivityFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+	"version":    true,
+}
+
+// ActivityChange is one field's value before and after a change; From is
+// null on a create and To on a delete
+type ActivityChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// recordActivity logs the actor changing an entity from before to after,
+// either of which is nil for a create or delete. An update that changed no
+// field is not logged.
+func (s *IdentityService) recordActivity(action, entityType, entityID string, before, after any) {
+	if s.activity == nil {
+		return
+	}
+	from, to := activitySnapshot(before), activitySnapshot(after)
+	changes := activityDiff(from, to)
+	if from != nil && to != nil && len(changes) == 0 {
+		return
+	}
+	body, err := json.Marshal(changes)
+	if err != nil {
+		log.Printf("Failed to record %s of %s %s: %v", action, entityType, entityID, err)
+		return
+	}
+	s.activity.Record(core.ActivityEntry{
+		ActorID:        s.actor.UserID,
+		ImpersonatorID: s.actor.ImpersonatorID,
+		Action:         action,
+		EntityType:     entityType,
+		EntityID:       entityID,
+		Changes:        string(body),
+		CreatedAt:      time.Now().UTC(),
+	})
+}
+
+// activitySnapshot returns v as its JSON object, without sensitive fields, or
+// nil if v is nil or not an object. Taking one before an update keeps the
+// old values, as updates change the fetched entity in place.
+func activitySnapshot(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil
+	}
+	scrubActivityFields(fields)
+	return fields
+}
+
+func scrubActivityFields(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if sensitiveActivityFields[key] {
+				delete(v, key)
+				continue
+			}
+			scrubActivityFields(value)
+		}
+	case []any:
+		for _, value := range v {
+			scrubActivityFields(value)
+		}
+	}
+}
+
+// activityDiff returns the fields whose values differ between two snapshots
+func activityDiff(before, after map[string]any) map[string]ActivityChange {
+	changes := map[string]ActivityChange{}
+	for key, from := range before {
+		if ignoredActivityFields[key] {
+			continue
+		}
+		if to, ok := after[key]; !ok || !reflect.DeepEqual(from, to) {
+			changes[key] = ActivityChange{From: from, To: to}
+		}
+	}
+	for key, to := range after {
+		if _, ok := before[key]; !ok && !ignoredActivityFields[key] && to != nil {
+			changes[key] = ActivityChange{To: to}
+		}
+	}
+	return changes
+}
+
+// ListActivity returns a page of the activity log, newest first
+func (s *IdentityService) ListActivity(filter repository.ActivityFilter, page pagination.Request) (pagination.Page[core.ActivityEntry], error) {
+	if page.After != nil {
+		if _, err := uuid.Parse(page.After.ID); err != nil {
+			return pagination.Page[core.ActivityEntry]{}, pagination.ErrInvalidCursor
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		ve := &ValidationError{}
+		ve.add("to", "must be after from")
+		return pagination.Page[core.ActivityEntry]{}, ve
+	}
+	entries, err := s.repo.ListActivity(filter, page)
+	if err != nil {
+		return pagination.Page[core.ActivityEntry]{}, err
+	}
+	return pagination.NewPage(entries, page.Limit, func(e core.ActivityEntry) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID.String()}
+	}), nil
+}
+
+// ActivityLog writes activity entries in the background, so recording one
+// never holds up the change it describes. Entries wait in a buffer and are
+// written in batches; while the buffer is full new ones are dropped, with a
+// log line, rather than blocking.
+type ActivityLog struct {
+	repo      *repository.Repository
+	entries   chan core.ActivityEntry
+	batchSize int
+	interval  time.Duration
+}
+
+func NewActivityLog(repo *repository.Repository, bufferSize, batchSize int, interval time.Duration) *ActivityLog {
+	return &ActivityLog{
+		repo:      repo,
+		entries:   make(chan core.ActivityEntry, bufferSize),
+		batchSize: batchSize,
+		interval:  interval,
+	}
+}
+
+// Record queues an entry to be written
+func (l *ActivityLog) Record(entry core.ActivityEntry) {
+	select {
+	case l.entries <- entry:
+	default:
+		log.Printf("Activity log buffer full, dropped %s of %s %s by %q", entry.Action, entry.EntityType, entry.EntityID, entry.ActorID)
+	}
+}
+
+// Run writes queued entries until ctx is cancelled, then writes what is left
+func (l *ActivityLog) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	batch := make([]core.ActivityEntry, 0, l.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := l.repo.InsertActivity(batch); err != nil {
+			log.Printf("Failed to write %d activity entries: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-l.entries:
+			batch = append(batch, entry)
+			if len(batch) >= l.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case entry := <-l.entries:
+					batch = append(batch, entry)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
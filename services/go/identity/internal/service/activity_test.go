@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+// runActivityLog runs the service's activity log, with a buffer the test
+// will not fill, until the returned func is called. That func flushes what
+// was recorded.
+func runActivityLog(t *testing.T, svc *IdentityService) (flush func()) {
+	t.Helper()
+	svc.activity = NewActivityLog(svc.repo, 100, 100, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		svc.RunActivityLog(ctx)
+	}()
+	t.Cleanup(cancel)
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// activityChanges returns the fields an entry changed
+func activityChanges(t *testing.T, entry core.ActivityEntry) map[string]ActivityChange {
+	t.Helper()
+	var changes map[string]ActivityChange
+	if err := json.Unmarshal([]byte(entry.Changes), &changes); err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func TestActivityRecordsWhatAnUpdateChanged(t *testing.T) {
+	svc, db := newTestService(t, &core.ActivityEntry{})
+	flush := runActivityLog(t, svc)
+	user := createUser(t, db, core.UserTypeStudent)
+	admin := svc.As(Actor{UserID: "admin-1", ImpersonatorID: "sysadmin-1"})
+
+	name, locale := "Ada Lovelace", "fr"
+	if _, err := admin.UpdateUser(user.ID.String(), UserUpdate{FullName: &name, PreferredLocale: &locale}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Saving the same values again changes nothing, so is not logged
+	if _, err := admin.UpdateUser(user.ID.String(), UserUpdate{FullName: &name}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Sensitive fields are dropped however deep they are
+	svc.recordActivity("user.update", "user", user.ID.String(),
+		map[string]any{"password_hash": "old", "profile": map[string]any{"token": "a", "year": 1}},
+		map[string]any{"password_hash": "new", "profile": map[string]any{"token": "b", "year": 2}})
+	flush()
+
+	var entries []core.ActivityEntry
+	if err := db.Order("created_at").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("logged %d entries, want the update and the recorded change", len(entries))
+	}
+	update := entries[0]
+	if update.Action != "user.update" || update.EntityType != "user" || update.EntityID != user.ID.String() || update.ActorID != "admin-1" || update.ImpersonatorID != "sysadmin-1" {
+		t.Errorf("entry = %+v, want admin-1 as sysadmin-1 updating user %s", update, user.ID)
+	}
+	changes := activityChanges(t, update)
+	want := map[string]ActivityChange{
+		"name":             {From: user.FullName, To: name},
+		"preferred_locale": {From: nil, To: locale},
+	}
+	if len(changes) != len(want) {
+		t.Errorf("changes = %+v, want only %+v", changes, want)
+	}
+	for field, change := range want {
+		if changes[field] != change {
+			t.Errorf("%s changed %+v, want %+v", field, changes[field], change)
+		}
+	}
+
+	scrubbed := activityChanges(t, entries[1])
+	profile, _ := json.Marshal(scrubbed["profile"])
+	if _, ok := scrubbed["password_hash"]; ok || string(profile) != `{"from":{"year":1},"to":{"year":2}}` {
+		t.Errorf("changes = %+v, want only the profile year", scrubbed)
+	}
+}
+
+func TestActivityOfCreatesAndDeletes(t *testing.T) {
+	svc, db := newTestService(t, &core.ActivityEntry{})
+	flush := runActivityLog(t, svc)
+	admin := svc.As(Actor{UserID: "admin-1"})
+
+	user, err := admin.RegisterUser(CreateUserRequest{Email: "ada@example.edu", FullName: "Ada", UserType: core.UserTypeInstructor, EmployeeID: "T1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.DeleteUser(user.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	// Changes made without an actor are the system's
+	if _, err := svc.CreateInstitute(CreateInstituteRequest{Name: "Uni", Code: "UNI", Domain: "uni.example.edu", ContactEmail: "admin@uni.example.edu"}); err != nil {
+		t.Fatal(err)
+	}
+	flush()
+
+	var entries []core.ActivityEntry
+	if err := db.Order("created_at").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.ActorID+" "+e.Action)
+	}
+	if want := []string{"admin-1 user.create", "admin-1 user.delete", " institute.create"}; !slices.Equal(actions, want) {
+		t.Fatalf("logged %q, want %q", actions, want)
+	}
+	if created := activityChanges(t, entries[0]); created["email"] != (ActivityChange{To: "ada@example.edu"}) {
+		t.Errorf("create changed email %+v, want it set from nothing", created["email"])
+	}
+	if deleted := activityChanges(t, entries[1]); deleted["email"] != (ActivityChange{From: "ada@example.edu"}) {
+		t.Errorf("delete changed email %+v, want it cleared", deleted["email"])
+	}
+}
+
+func TestListActivityFilters(t *testing.T) {
+	svc, db := newTestService(t, &core.ActivityEntry{})
+	monday := time.Date(2026, 10, 12, 9, 0, 0, 0, time.UTC)
+	seed := func(actor, entityType, entityID string, at time.Time) core.ActivityEntry {
+		entry := core.ActivityEntry{ActorID: actor, Action: entityType + ".update", EntityType: entityType, EntityID: entityID, Changes: "{}", CreatedAt: at}
+		if err := db.Create(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+	e1 := seed("admin-1", "user", "u-1", monday)
+	e2 := seed("admin-2", "user", "u-1", monday.Add(time.Hour))
+	e3 := seed("admin-1", "class", "c-1", monday.Add(24*time.Hour))
+	e4 := seed("admin-1", "user", "u-2", monday.Add(48*time.Hour))
+
+	list := func(filter repository.ActivityFilter, page pagination.Request) pagination.Page[core.ActivityEntry] {
+		t.Helper()
+		got, err := svc.ListActivity(filter, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	ids := func(entries ...core.ActivityEntry) []string {
+		out := []string{}
+		for _, e := range entries {
+			out = append(out, e.ID.String())
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter repository.ActivityFilter
+		want   []core.ActivityEntry
+	}{
+		{"everything, newest first", repository.ActivityFilter{}, []core.ActivityEntry{e4, e3, e2, e1}},
+		{"by actor", repository.ActivityFilter{ActorID: "admin-1"}, []core.ActivityEntry{e4, e3, e1}},
+		{"by entity", repository.ActivityFilter{EntityType: "user", EntityID: "u-1"}, []core.ActivityEntry{e2, e1}},
+		{"by entity type", repository.ActivityFilter{EntityType: "class"}, []core.ActivityEntry{e3}},
+		{"on monday", repository.ActivityFilter{From: monday, To: monday.Add(24 * time.Hour)}, []core.ActivityEntry{e2, e1}},
+		{"by actor since tuesday", repository.ActivityFilter{ActorID: "admin-1", From: monday.Add(24 * time.Hour)}, []core.ActivityEntry{e4, e3}},
+		{"nobody", repository.ActivityFilter{ActorID: "admin-3"}, nil},
+	} {
+		if got := ids(list(tc.filter, pagination.Request{Limit: 50}).Items...); !slices.Equal(got, ids(tc.want...)) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, ids(tc.want...))
+		}
+	}
+
+	// A page at a time
+	first := list(repository.ActivityFilter{ActorID: "admin-1"}, pagination.Request{Limit: 2})
+	if first.NextCursor == nil {
+		t.Fatal("no cursor after the first of two pages")
+	}
+	after, err := pagination.Decode(*first.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := list(repository.ActivityFilter{ActorID: "admin-1"}, pagination.Request{Limit: 2, After: &after})
+	if got := ids(append(first.Items, second.Items...)...); !slices.Equal(got, ids(e4, e3, e1)) || second.NextCursor != nil {
+		t.Errorf("paged through %v, want %v", got, ids(e4, e3, e1))
+	}
+
+	var verr *ValidationError
+	if _, err := svc.ListActivity(repository.ActivityFilter{From: monday, To: monday}, pagination.Request{Limit: 50}); !errors.As(err, &verr) {
+		t.Errorf("empty time range: got %v, want a validation error", err)
+	}
+}
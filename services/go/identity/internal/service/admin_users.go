@@ -0,0 +1,52 @@
+package service
+
+import (
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// UsersWithProfiles is a page of users with their type-specific profiles,
+// for admin tools
+type UsersWithProfiles struct {
+	pagination.Page[core.User]
+	// Orphans are the profile rows without a live user, across every page;
+	// nil unless asked for
+	Orphans []repository.OrphanedProfile `json:"orphans"`
+}
+
+// ListUsersWithProfiles returns a page of the users of userType, or of every
+// type if it is empty, newest first, each with its profile or institute
+// bindings. With includeOrphans it also reports the profile rows whose user
+// is missing or deleted.
+func (s *IdentityService) ListUsersWithProfiles(page pagination.Request, userType string, includeOrphans bool) (*UsersWithProfiles, error) {
+	switch core.UserType(userType) {
+	case "", core.UserTypeStudent, core.UserTypeInstructor, core.UserTypeInstituteAdmin, core.UserTypeSystemAdmin, core.UserTypeGuardian:
+	default:
+		verr := &ValidationError{}
+		verr.add("user_type", "must be STUDENT, INSTRUCTOR, INSTITUTE_ADMIN, SYSTEM_ADMIN or GUARDIAN")
+		return nil, verr
+	}
+	if page.After != nil {
+		if _, err := uuid.Parse(page.After.ID); err != nil {
+			return nil, pagination.ErrInvalidCursor
+		}
+	}
+
+	users, err := s.repo.ListUsersWithProfiles(page, core.UserType(userType))
+	if err != nil {
+		return nil, err
+	}
+	result := &UsersWithProfiles{
+		Page: pagination.NewPage(users, page.Limit, func(u core.User) pagination.Cursor {
+			return pagination.Cursor{CreatedAt: u.CreatedAt, ID: u.ID.String()}
+		}),
+	}
+	if includeOrphans {
+		if result.Orphans, err = s.repo.ListOrphanedProfiles(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// countQueries counts the SELECTs run on db from now on
+func countQueries(t *testing.T, db *gorm.DB) *int {
+	t.Helper()
+	queries := 0
+	count := func(*gorm.DB) { queries++ }
+	if err := db.Callback().Query().Before("gorm:query").Register("test:count_queries", count); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Raw().Before("gorm:raw").Register("test:count_raw", count); err != nil {
+		t.Fatal(err)
+	}
+	return &queries
+}
+
+func TestUsersWithProfilesLoadsEachTypeInOneQuery(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	other := createOrgTree(t, db)
+	createInstituteStudents(t, db, tree.Institute.ID, 200, time.Now().UTC())
+	for i := 0; i < 60; i++ {
+		user := createUser(t, db, core.UserTypeInstructor)
+		if err := db.Create(&core.InstructorProfile{UserID: user.ID, EmployeeID: "E-" + user.ID.String()}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 40; i++ {
+		user := createUser(t, db, core.UserTypeInstituteAdmin)
+		bindings := []core.InstituteAdminProfile{{UserID: user.ID, InstituteID: tree.Institute.ID}, {UserID: user.ID, InstituteID: other.Institute.ID}}
+		if err := db.Create(&bindings).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queries := countQueries(t, db)
+	page, err := svc.ListUsersWithProfiles(pagination.Request{Limit: 500}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The users, then the student, instructor and admin profiles
+	if *queries != 4 {
+		t.Errorf("listing 300 users took %d queries, want 4", *queries)
+	}
+	if len(page.Items) != 300 {
+		t.Fatalf("listed %d users, want 300", len(page.Items))
+	}
+	for _, u := range page.Items {
+		switch {
+		case u.ProfileMissing:
+			t.Errorf("%s %s was listed without their profile", u.UserType, u.ID)
+		case u.UserType == core.UserTypeStudent && (u.StudentProfile == nil || u.StudentProfile.EnrollmentNumber != "S-"+u.ID.String()):
+			t.Errorf("student %s has profile %+v", u.ID, u.StudentProfile)
+		case u.UserType == core.UserTypeInstructor && (u.InstructorProfile == nil || u.InstructorProfile.EmployeeID != "E-"+u.ID.String()):
+			t.Errorf("instructor %s has profile %+v", u.ID, u.InstructorProfile)
+		case u.UserType == core.UserTypeInstituteAdmin && len(u.InstituteAdminProfiles) != 2:
+			t.Errorf("admin %s has bindings %+v, want both institutes", u.ID, u.InstituteAdminProfiles)
+		}
+	}
+	if page.Orphans != nil {
+		t.Errorf("orphans were reported without include_orphans: %+v", page.Orphans)
+	}
+}
+
+func TestUsersWithProfilesReportsOrphans(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	other := createOrgTree(t, db)
+	live := createInstituteStudents(t, db, tree.Institute.ID, 3, time.Now().UTC())
+	deleted := createInstituteStudents(t, db, tree.Institute.ID, 1, time.Now().UTC())[0]
+	if err := db.Delete(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Profile rows whose user was removed outright
+	missingInstructor := uuid.New()
+	missingAdmin := uuid.New()
+	rows := []interface{}{
+		&core.InstructorProfile{UserID: missingInstructor, EmployeeID: "E-missing"},
+		&[]core.InstituteAdminProfile{{UserID: missingAdmin, InstituteID: tree.Institute.ID}, {UserID: missingAdmin, InstituteID: other.Institute.ID}},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := svc.ListUsersWithProfiles(pagination.Request{Limit: 50}, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[repository.OrphanedProfile]bool{
+		{Table: "student_profiles", UserID: deleted.ID, UserDeleted: true}:            true,
+		{Table: "instructor_profiles", UserID: missingInstructor, UserDeleted: false}: true,
+		{Table: "institute_admin_profiles", UserID: missingAdmin, UserDeleted: false}: true,
+	}
+	if len(page.Orphans) != len(want) {
+		t.Fatalf("orphans = %+v, want %d: the admin bound to two institutes once", page.Orphans, len(want))
+	}
+	for _, orphan := range page.Orphans {
+		if !want[orphan] {
+			t.Errorf("unexpected orphan %+v", orphan)
+		}
+	}
+	if len(page.Items) != len(live) {
+		t.Errorf("listed %d users, want the %d live ones", len(page.Items), len(live))
+	}
+}
+
+func TestUsersWithProfilesPagesStably(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	// All created at once, so pages only move on through the ID tiebreak
+	students := createInstituteStudents(t, db, tree.Institute.ID, 20, time.Now().UTC())
+	if err := db.Model(&core.User{}).Where("user_type = ?", core.UserTypeStudent).Update("created_at", time.Now().Add(-time.Hour).UTC()).Error; err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, db, core.UserTypeInstructor)
+
+	seen := map[uuid.UUID]bool{}
+	page, err := svc.ListUsersWithProfiles(pagination.Request{Limit: 7}, string(core.UserTypeStudent), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		for _, u := range page.Items {
+			if u.UserType != core.UserTypeStudent {
+				t.Fatalf("%s %s listed under the STUDENT filter", u.UserType, u.ID)
+			}
+			if seen[u.ID] {
+				t.Fatalf("student %s listed twice", u.ID)
+			}
+			seen[u.ID] = true
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		// Students added between page requests land before the cursor
+		createInstituteStudents(t, db, tree.Institute.ID, 2, time.Now().UTC())
+
+		after, err := pagination.Decode(*page.NextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page, err = svc.ListUsersWithProfiles(pagination.Request{Limit: 7, After: &after}, string(core.UserTypeStudent), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seen) != len(students) {
+		t.Errorf("paged through %d students, want the %d that existed at the start", len(seen), len(students))
+	}
+
+	if _, err := svc.ListUsersWithProfiles(pagination.Request{Limit: 7}, "GUEST", false); err == nil {
+		t.Error("listing an unknown user_type succeeded")
+	}
+}
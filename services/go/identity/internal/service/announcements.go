@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// announcementTemplate is the email service template announcements use
+	announcementTemplate = "announcement"
+	// emailBatchSize is the most recipients the email service takes
+	// in one send-template request
+	emailBatchSize = 100
+	// maxAnnouncementTitle bounds titles, which become email subjects
+	maxAnnouncementTitle = 200
+)
+
+// AnnouncementRequest creates an announcement. PublishAt defaults to now.
+type AnnouncementRequest struct {
+	Scope     core.AnnouncementScope `json:"scope"`
+	ScopeID   string                 `json:"scope_id"`
+	Title     string                 `json:"title"`
+	Body      string                 `json:"body"`
+	PublishAt *time.Time             `json:"publish_at"`
+	ExpiresAt *time.Time             `json:"expires_at"`
+	Notify    bool                   `json:"notify"`
+}
+
+// AnnouncementUpdate changes an announcement; empty and nil fields are left
+// unchanged. The scope is fixed once created. SetExpiresAt with a nil
+// ExpiresAt removes the expiry.
+type AnnouncementUpdate struct {
+	Title        string
+	Body         string
+	PublishAt    *time.Time
+	ExpiresAt    *time.Time
+	SetExpiresAt bool
+	Notify       *bool
+}
+
+// CreateAnnouncement addresses an announcement to an existing org unit on
+// behalf of authorID
+func (s *IdentityService) CreateAnnouncement(authorID string, req AnnouncementRequest) (*core.Announcement, error) {
+	verr := &ValidationError{}
+	if !req.Scope.Valid() {
+		verr.add("scope", "must be institute, faculty, department or class")
+	}
+	scopeID, err := uuid.Parse(req.ScopeID)
+	if err != nil {
+		verr.add("scope_id", "must be a valid UUID")
+	}
+	if err := verr.errOrNil(); err != nil {
+		return nil, err
+	}
+	author, err := uuid.Parse(authorID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid author ID %q", authorID)
+	}
+
+	if _, err := s.repo.OrgUnitName(req.Scope, scopeID); err != nil {
+		if isOrgUnitNotFound(err) {
+			ve := &ValidationError{}
+			ve.add("scope_id", "does not exist")
+			return nil, ve
+		}
+		return nil, err
+	}
+
+	announcement := &core.Announcement{
+		Scope:        req.Scope,
+		ScopeID:      scopeID,
+		AuthorUserID: author,
+		PublishAt:    time.Now().UTC(),
+		Notify:       req.Notify,
+	}
+	update := AnnouncementUpdate{
+		Title:        req.Title,
+		Body:         req.Body,
+		PublishAt:    req.PublishAt,
+		ExpiresAt:    req.ExpiresAt,
+		SetExpiresAt: true,
+	}
+	if err := applyAnnouncementUpdate(announcement, update, true); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateAnnouncement(announcement); err != nil {
+		return nil, err
+	}
+	return announcement, nil
+}
+
+func (s *IdentityService) GetAnnouncement(id string) (*core.Announcement, error) {
+	announcementID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, repository.ErrAnnouncementNotFound
+	}
+	return s.repo.GetAnnouncement(announcementID)
+}
+
+func (s *IdentityService) announcementVersion(id uuid.UUID) func() (int, error) {
+	return func() (int, error) {
+		announcement, err := s.repo.GetAnnouncement(id)
+		if err != nil {
+			return 0, err
+		}
+		return announcement.Version, nil
+	}
+}
+
+// UpdateAnnouncement edits an announcement. Turning notify on for one already
+// emailed does not email it again.
+func (s *IdentityService) UpdateAnnouncement(id string, update AnnouncementUpdate, expectedVersion *int) (*core.Announcement, error) {
+	announcement, err := s.GetAnnouncement(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(announcement.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+	if err := applyAnnouncementUpdate(announcement, update, false); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateAnnouncement(announcement); err != nil {
+		return nil, versionConflict(err, s.announcementVersion(announcement.ID))
+	}
+	return announcement, nil
+}
+
+func (s *IdentityService) DeleteAnnouncement(id string) error {
+	announcementID, err := uuid.Parse(id)
+	if err != nil {
+		return repository.ErrAnnouncementNotFound
+	}
+	return s.repo.DeleteAnnouncement(announcementID)
+}
+
+// GetUserAnnouncements returns the announcements shown to the user now: those
+// addressed to any class, department, faculty or institute they belong to,
+// most recently published first
+func (s *IdentityService) GetUserAnnouncements(userID string) ([]core.Announcement, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, repository.ErrUserNotFound
+	}
+	if _, err := s.repo.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	units, err := s.repo.UserOrgUnits(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListActiveAnnouncements(units, time.Now())
+}
+
+// NotifyAnnouncement emails the announcement to everyone it reaches, in
+// batches the email service accepts. A failed batch does not stop the rest;
+// the error then counts the recipients who were not emailed.
+func (s *IdentityService) NotifyAnnouncement(announcement *core.Announcement) error {
+	unitName, err := s.repo.OrgUnitName(announcement.Scope, announcement.ScopeID)
+	if err != nil {
+		return err
+	}
+	users, err := s.repo.AnnouncementAudience(announcement.Scope, announcement.ScopeID)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{
+		"title":     announcement.Title,
+		"body":      announcement.Body,
+		"unit_name": unitName,
+		"url":       fmt.Sprintf("%s/announcements", s.cfg.WebURL),
+	}
+	defaultLocale := s.orgUnitDefaultLocale(announcement.Scope, announcement.ScopeID)
+	var notSent int
+	for start := 0; start < len(users); start += emailBatchSize {
+		batch := users[start:min(start+emailBatchSize, len(users))]
+		recipients := make([]map[string]interface{}, 0, len(batch))
+		for _, user := range batch {
+			recipients = append(recipients, map[string]interface{}{
+				"email":  user.Email,
+				"locale": userLocale(&user),
+				"data":   map[string]string{"name": user.FullName},
+			})
+		}
+
+		failed, err := s.sendTemplateEmails(map[string]interface{}{
+			"template_name":  announcementTemplate,
+			"recipients":     recipients,
+			"data":           data,
+			"category":       "notification",
+			"default_locale": defaultLocale,
+		})
+		if err != nil {
+			log.Printf("Announcement %s: batch of %d not sent: %v", announcement.ID, len(batch), err)
+			notSent += len(batch)
+			continue
+		}
+		if len(failed) > 0 {
+			log.Printf("Announcement %s: not sent to %s", announcement.ID, strings.Join(failed, ", "))
+			notSent += len(failed)
+		}
+	}
+
+	if notSent > 0 {
+		return fmt.Errorf("announcement not emailed to %d of %d recipients", notSent, len(users))
+	}
+	return nil
+}
+
+// applyAnnouncementUpdate copies update onto announcement. Creating needs a
+// title and body; an update only changes the fields sent.
+func applyAnnouncementUpdate(announcement *core.Announcement, update AnnouncementUpdate, create bool) error {
+	verr := &ValidationError{}
+	if title := strings.TrimSpace(update.Title); title != "" {
+		if len(title) > maxAnnouncementTitle {
+			verr.add("title", fmt.Sprintf("must be at most %d characters", maxAnnouncementTitle))
+		}
+		announcement.Title = title
+	} else if create {
+		verr.add("title", "is required")
+	}
+	if body := strings.TrimSpace(update.Body); body != "" {
+		announcement.Body = body
+	} else if create {
+		verr.add("body", "is required")
+	}
+	if update.PublishAt != nil {
+		announcement.PublishAt = update.PublishAt.UTC()
+	}
+	if update.SetExpiresAt {
+		announcement.ExpiresAt = nil
+		if update.ExpiresAt != nil {
+			expiresAt := update.ExpiresAt.UTC()
+			announcement.ExpiresAt = &expiresAt
+		}
+	}
+	if update.Notify != nil {
+		announcement.Notify = *update.Notify
+	}
+	if announcement.ExpiresAt != nil && !announcement.ExpiresAt.After(announcement.PublishAt) {
+		verr.add("expires_at", "must be after publish_at")
+	}
+	return verr.errOrNil()
+}
+
+func isOrgUnitNotFound(err error) bool {
+	return errors.Is(err, repository.ErrInstituteNotFound) ||
+		errors.Is(err, repository.ErrFacultyNotFound) ||
+		errors.Is(err, repository.ErrDepartmentNotFound) ||
+		errors.Is(err, repository.ErrClassNotFound)
+}
+
+// AnnouncementNotifier emails announcements that asked for it once they are
+// published
+type AnnouncementNotifier struct {
+	svc      *IdentityService
+	interval time.Duration
+}
+
+func NewAnnouncementNotifier(svc *IdentityService, interval time.Duration) *AnnouncementNotifier {
+	return &AnnouncementNotifier{svc: svc, interval: interval}
+}
+
+// Run polls for announcements to email until ctx is cancelled
+func (n *AnnouncementNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		// Work through the published announcements, then wait for the next tick
+		for ctx.Err() == nil {
+			announcement, err := n.svc.repo.ClaimAnnouncementNotification(time.Now())
+			if err != nil {
+				log.Printf("Failed to claim announcement to email: %v", err)
+				break
+			}
+			if announcement == nil {
+				break
+			}
+			if err := n.svc.NotifyAnnouncement(announcement); err != nil {
+				log.Printf("Failed to email announcement %s: %v", announcement.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+func TestUserSeesAnnouncementsOfTheirUnits(t *testing.T) {
+	svc, db := newTestService(t, &core.Announcement{})
+	tree := createOrgTree(t, db)
+	otherClass := &core.Class{DepartmentID: tree.Department.ID, Name: "PHY102"}
+	if err := svc.repo.CreateClass(otherClass); err != nil {
+		t.Fatal(err)
+	}
+	student := createUser(t, db, core.UserTypeStudent)
+	if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", student.ID.String(), false, false); err != nil {
+		t.Fatal(err)
+	}
+	author := createUser(t, db, core.UserTypeInstructor).ID.String()
+
+	past := time.Now().Add(-2 * time.Hour)
+	expired := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	create := func(scope core.AnnouncementScope, scopeID, title string, publishAt, expiresAt *time.Time) {
+		t.Helper()
+		_, err := svc.CreateAnnouncement(author, AnnouncementRequest{Scope: scope, ScopeID: scopeID, Title: title, Body: "body", PublishAt: publishAt, ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	create(core.AnnouncementScopeClass, tree.Class.ID.String(), "class", nil, nil)
+	create(core.AnnouncementScopeFaculty, tree.Faculty.ID.String(), "faculty", &past, nil)
+	create(core.AnnouncementScopeClass, otherClass.ID.String(), "other class", nil, nil)
+	create(core.AnnouncementScopeInstitute, tree.Institute.ID.String(), "expired", &past, &expired)
+	create(core.AnnouncementScopeDepartment, tree.Department.ID.String(), "scheduled", &future, nil)
+
+	got, err := svc.GetUserAnnouncements(student.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Title != "class" || got[1].Title != "faculty" {
+		titles := make([]string, len(got))
+		for i, a := range got {
+			titles[i] = a.Title
+		}
+		t.Errorf("announcements = %v, want class then faculty", titles)
+	}
+}
+
+func TestCreateAnnouncementValidates(t *testing.T) {
+	svc, db := newTestService(t, &core.Announcement{})
+	tree := createOrgTree(t, db)
+	author := createUser(t, db, core.UserTypeInstructor).ID.String()
+	publishAt := time.Now()
+
+	_, err := svc.CreateAnnouncement(author, AnnouncementRequest{Scope: "campus", ScopeID: "x"})
+	if verr := validationErrorOf(t, err); !hasFieldError(verr, "scope") || !hasFieldError(verr, "scope_id") {
+		t.Errorf("bad scope: got %v", verr)
+	}
+	_, err = svc.CreateAnnouncement(author, AnnouncementRequest{Scope: core.AnnouncementScopeClass, ScopeID: tree.Department.ID.String(), Title: "t", Body: "b"})
+	if verr := validationErrorOf(t, err); !hasFieldError(verr, "scope_id") {
+		t.Errorf("department ID as class: got %v", verr)
+	}
+	_, err = svc.CreateAnnouncement(author, AnnouncementRequest{Scope: core.AnnouncementScopeClass, ScopeID: tree.Class.ID.String(), PublishAt: &publishAt, ExpiresAt: &publishAt})
+	if verr := validationErrorOf(t, err); !hasFieldError(verr, "title") || !hasFieldError(verr, "body") || !hasFieldError(verr, "expires_at") {
+		t.Errorf("missing title and body, empty window: got %v", verr)
+	}
+}
+
+func TestNotifyAnnouncementEmailsAudienceInBatches(t *testing.T) {
+	svc, db := newTestService(t, &core.Announcement{})
+	tree := createOrgTree(t, db)
+
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Recipients []struct {
+				Email string `json:"email"`
+			} `json:"recipients"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		var emails []string
+		results := []map[string]string{}
+		for _, rcpt := range payload.Recipients {
+			emails = append(emails, rcpt.Email)
+			results = append(results, map[string]string{"recipient": rcpt.Email, "status": "queued"})
+		}
+		batches = append(batches, emails)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	t.Cleanup(server.Close)
+	svc.cfg.EmailServiceURL = server.URL
+
+	students := createStudents(t, db, emailBatchSize+1)
+	for _, s := range students {
+		if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", s.ID.String(), false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	disabled := students[0]
+	if err := db.Model(disabled).Update("status", "disabled").Error; err != nil {
+		t.Fatal(err)
+	}
+	head := createUser(t, db, core.UserTypeInstructor)
+	if err := db.Model(tree.Department).Update("head_user_id", head.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	announcement, err := svc.CreateAnnouncement(head.ID.String(), AnnouncementRequest{
+		Scope: core.AnnouncementScopeDepartment, ScopeID: tree.Department.ID.String(), Title: "Lab closed", Body: "All week", Notify: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := svc.repo.ClaimAnnouncementNotification(time.Now().Add(time.Second))
+	if err != nil || claimed == nil || claimed.ID != announcement.ID {
+		t.Fatalf("claimed %v, %v; want the new announcement", claimed, err)
+	}
+	if again, err := svc.repo.ClaimAnnouncementNotification(time.Now().Add(time.Second)); err != nil || again != nil {
+		t.Errorf("claimed a notified announcement again: %v, %v", again, err)
+	}
+	if err := svc.NotifyAnnouncement(claimed); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every enrolled student but the disabled one, plus the head
+	if len(batches) != 2 || len(batches[0]) != emailBatchSize || len(batches[1]) != 1 {
+		t.Fatalf("sent batches of %d", batchSizes(batches))
+	}
+	for _, batch := range batches {
+		for _, email := range batch {
+			if email == disabled.Email {
+				t.Error("disabled user was emailed")
+			}
+		}
+	}
+}
+
+func batchSizes(batches [][]string) []int {
+	sizes := make([]int, len(batches))
+	for i, b := range batches {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// ErrStorageUnavailable is returned for logo uploads while no storage is
+// configured
+var ErrStorageUnavailable = errors.New("file storage is not configured")
+
+const (
+	// MaxLogoSize is the largest logo an institute may upload
+	MaxLogoSize = 1 << 20
+	// maxEmailFooterLength caps the footer HTML as sent, before sanitizing
+	maxEmailFooterLength = 4000
+)
+
+// colorPattern is a hex color, #rgb or #rrggbb
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// BrandingRequest changes an institute's branding; a missing field is left
+// unchanged and an empty one cleared. The logo is uploaded on its own.
+type BrandingRequest struct {
+	PrimaryColor    *string `json:"primary_color"`
+	SecondaryColor  *string `json:"secondary_color"`
+	EmailFooterHTML *string `json:"email_footer_html"`
+	SupportEmail    *string `json:"support_email"`
+}
+
+// InstituteBranding is an institute's branding with the URL its logo is
+// served from, empty when it has none
+type InstituteBranding struct {
+	*core.InstituteBranding
+	LogoURL string `json:"logo_url"`
+}
+
+// GetInstituteBranding returns the institute's branding; an institute that
+// never set any gets an empty one
+func (s *IdentityService) GetInstituteBranding(instituteID string) (*InstituteBranding, error) {
+	institute, err := s.repo.GetInstituteByID(instituteID)
+	if err != nil {
+		return nil, err
+	}
+	branding, err := s.repo.GetInstituteBranding(institute.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.brandingWithURL(branding), nil
+}
+
+func (s *IdentityService) UpdateInstituteBranding(instituteID string, req BrandingRequest) (*InstituteBranding, error) {
+	institute, err := s.repo.GetInstituteByID(instituteID)
+	if err != nil {
+		return nil, err
+	}
+	branding, err := s.repo.GetInstituteBranding(institute.ID)
+	if err != nil {
+		return nil, err
+	}
+	before := activitySnapshot(branding)
+
+	verr := &ValidationError{}
+	if req.PrimaryColor != nil {
+		branding.PrimaryColor = normalizeColor("primary_color", *req.PrimaryColor, verr)
+	}
+	if req.SecondaryColor != nil {
+		branding.SecondaryColor = normalizeColor("secondary_color", *req.SecondaryColor, verr)
+	}
+	if req.EmailFooterHTML != nil {
+		if len(*req.EmailFooterHTML) > maxEmailFooterLength {
+			verr.add("email_footer_html", fmt.Sprintf("must be at most %d characters", maxEmailFooterLength))
+		} else {
+			branding.EmailFooterHTML = sanitizeFooterHTML(*req.EmailFooterHTML)
+		}
+	}
+	if req.SupportEmail != nil {
+		email := normalizeEmail(*req.SupportEmail)
+		if email != "" {
+			if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+				verr.add("support_email", "must be an email address")
+			}
+		}
+		branding.SupportEmail = email
+	}
+	if err := verr.errOrNil(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveInstituteBranding(branding); err != nil {
+		return nil, err
+	}
+	s.recordActivity("institute.update_branding", "institute", institute.ID.String(), before, branding)
+	return s.brandingWithURL(branding), nil
+}
+
+// UploadInstituteLogo stores content as the institute's logo, replacing the
+// one it had. Its type is told from the content, whatever the file was
+// called: PNG, JPEG, or SVG without scripts or links to other documents.
+func (s *IdentityService) UploadInstituteLogo(ctx context.Context, instituteID string, content []byte) (*InstituteBranding, error) {
+	institute, err := s.repo.GetInstituteByID(instituteID)
+	if err != nil {
+		return nil, err
+	}
+	verr := &ValidationError{}
+	contentType, ext := "", ""
+	if len(content) > MaxLogoSize {
+		verr.add("logo", "must be at most 1 MB")
+	} else if contentType, ext = sniffLogo(content); contentType == "" {
+		verr.add("logo", "must be a PNG, JPEG or SVG image")
+	}
+	if err := verr.errOrNil(); err != nil {
+		return nil, err
+	}
+	if s.files == nil {
+		return nil, ErrStorageUnavailable
+	}
+
+	branding, err := s.repo.GetInstituteBranding(institute.ID)
+	if err != nil {
+		return nil, err
+	}
+	before := activitySnapshot(branding)
+	oldKey := branding.LogoKey
+
+	// Named after the content, so a new logo gets a new URL and caches of
+	// the old one do not linger
+	sum := sha256.Sum256(content)
+	branding.LogoKey = fmt.Sprintf("branding/%s/logo-%x.%s", institute.ID, sum[:8], ext)
+	if branding.LogoKey == oldKey {
+		return s.brandingWithURL(branding), nil
+	}
+	if err := s.files.UploadFileWithType(ctx, branding.LogoKey, contentType, content); err != nil {
+		return nil, fmt.Errorf("failed to store logo: %w", err)
+	}
+	if err := s.repo.SaveInstituteBranding(branding); err != nil {
+		return nil, err
+	}
+	if oldKey != "" {
+		if err := s.files.DeleteFile(ctx, oldKey); err != nil {
+			log.Printf("[Identity] Failed to delete old logo %s: %v", oldKey, err)
+		}
+	}
+	s.recordActivity("institute.update_branding", "institute", institute.ID.String(), before, branding)
+	return s.brandingWithURL(branding), nil
+}
+
+func (s *IdentityService) brandingWithURL(branding *core.InstituteBranding) *InstituteBranding {
+	withURL := &InstituteBranding{InstituteBranding: branding}
+	if branding.LogoKey != "" && s.files != nil {
+		withURL.LogoURL = s.files.GetFileURL(branding.LogoKey)
+	}
+	return withURL
+}
+
+// normalizeColor returns a hex color as lower-case #rrggbb; empty clears it
+func normalizeColor(field, color string, verr *ValidationError) string {
+	color = strings.TrimSpace(color)
+	if color == "" {
+		return ""
+	}
+	if !colorPattern.MatchString(color) {
+		verr.add(field, "must be a hex color like #1a73e8")
+		return ""
+	}
+	color = strings.ToLower(color)
+	if len(color) == 4 {
+		color = string([]byte{'#', color[1], color[1], color[2], color[2], color[3], color[3]})
+	}
+	return color
+}
+
+// sniffLogo returns the content type and file extension of a logo, or empty
+// strings if it is not an image logos may be
+func sniffLogo(content []byte) (contentType, ext string) {
+	detected := http.DetectContentType(content)
+	switch {
+	case detected == "image/png":
+		return detected, "png"
+	case detected == "image/jpeg":
+		return detected, "jpg"
+	case strings.HasPrefix(detected, "text/xml"), strings.HasPrefix(detected, "text/plain"):
+		// SVG has no signature of its own
+		if isSafeSVG(content) {
+			return "image/svg+xml", "svg"
+		}
+	}
+	return "", ""
+}
+
+// isSafeSVG reports whether content is an SVG document that runs no script
+// and loads nothing from elsewhere when opened on its own
+func isSafeSVG(content []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	sawRoot := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return sawRoot
+		}
+		if err != nil {
+			return false
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if !sawRoot && name != "svg" {
+				return false
+			}
+			sawRoot = true
+			if name == "script" || name == "foreignobject" {
+				return false
+			}
+			for _, attr := range t.Attr {
+				attrName := strings.ToLower(attr.Name.Local)
+				if strings.HasPrefix(attrName, "on") {
+					return false
+				}
+				// Only references within the document, e.g. to a gradient
+				if attrName == "href" && !strings.HasPrefix(strings.TrimSpace(attr.Value), "#") {
+					return false
+				}
+			}
+		case xml.Directive:
+			// A DOCTYPE could declare entities that pull in other files
+			return false
+		case xml.ProcInst:
+			if t.Target != "xml" {
+				return false
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/storage"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// memoryFiles is storage holding files in memory
+type memoryFiles struct {
+	storage.Client
+	files map[string]string // content type by path
+}
+
+func (m *memoryFiles) UploadFileWithType(_ context.Context, path, contentType string, _ []byte) error {
+	m.files[path] = contentType
+	return nil
+}
+
+func (m *memoryFiles) GetFileURL(path string) string {
+	return "https://files.example.com/" + path
+}
+
+func (m *memoryFiles) DeleteFile(_ context.Context, path string) error {
+	delete(m.files, path)
+	return nil
+}
+
+func newBrandingService(t *testing.T) (*IdentityService, *memoryFiles, string) {
+	t.Helper()
+	svc, db := newTestService(t, &core.InstituteBranding{})
+	files := &memoryFiles{files: map[string]string{}}
+	svc.files = files
+	return svc, files, createOrgTree(t, db).Institute.ID.String()
+}
+
+var pngLogo = append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), make([]byte, 32)...)
+
+func TestLogoTypeIsSniffedFromContent(t *testing.T) {
+	svc, files, instituteID := newBrandingService(t)
+	ctx := context.Background()
+
+	// A Windows executable renamed logo.png is still an executable
+	exe := append([]byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff"), make([]byte, 64)...)
+	for name, content := range map[string][]byte{
+		"executable":           exe,
+		"SVG with a script":    []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`),
+		"SVG loading an image": []byte(`<svg xmlns="http://www.w3.org/2000/svg"><image href="https://evil.example/x.png"/></svg>`),
+		"HTML":                 []byte(`<html><body>hi</body></html>`),
+		"image over 1 MB":      append(append([]byte{}, pngLogo...), make([]byte, MaxLogoSize)...),
+	} {
+		_, err := svc.UploadInstituteLogo(ctx, instituteID, content)
+		if verr := validationErrorOf(t, err); !hasFieldError(verr, "logo") {
+			t.Errorf("%s: got %v, want a logo error", name, verr)
+		}
+	}
+	if len(files.files) != 0 {
+		t.Fatalf("rejected logos were stored: %v", files.files)
+	}
+
+	branding, err := svc.UploadInstituteLogo(ctx, instituteID, pngLogo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(branding.LogoKey, ".png") || files.files[branding.LogoKey] != "image/png" {
+		t.Errorf("PNG stored as %q with type %q", branding.LogoKey, files.files[branding.LogoKey])
+	}
+	if branding.LogoURL != "https://files.example.com/"+branding.LogoKey {
+		t.Errorf("logo URL = %q", branding.LogoURL)
+	}
+
+	// A new logo replaces the old one
+	svg := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><defs><linearGradient id="g"/></defs><rect fill="url(#g)" width="10" height="10"/><use href="#g"/></svg>`)
+	replaced, err := svc.UploadInstituteLogo(ctx, instituteID, svg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files.files[replaced.LogoKey] != "image/svg+xml" || len(files.files) != 1 {
+		t.Errorf("stored files after replacing the logo = %v, want only the SVG", files.files)
+	}
+}
+
+func TestBrandingIsValidated(t *testing.T) {
+	svc, _, instituteID := newBrandingService(t)
+	str := func(s string) *string { return &s }
+
+	_, err := svc.UpdateInstituteBranding(instituteID, BrandingRequest{
+		PrimaryColor:    str("red"),
+		SecondaryColor:  str("#12345"),
+		SupportEmail:    str("help desk"),
+		EmailFooterHTML: str(strings.Repeat("x", maxEmailFooterLength+1)),
+	})
+	verr := validationErrorOf(t, err)
+	for _, field := range []string{"primary_color", "secondary_color", "support_email", "email_footer_html"} {
+		if !hasFieldError(verr, field) {
+			t.Errorf("no error for %s in %v", field, verr)
+		}
+	}
+
+	branding, err := svc.UpdateInstituteBranding(instituteID, BrandingRequest{
+		PrimaryColor:    str("#1A73E8"),
+		SecondaryColor:  str("#AbC"),
+		SupportEmail:    str(" Help@Example.edu "),
+		EmailFooterHTML: str(`<p onclick="x()">Visit <a href="javascript:alert(1)">us</a> <a href="https://example.edu">here</a><script>steal()</script>`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branding.PrimaryColor != "#1a73e8" || branding.SecondaryColor != "#aabbcc" || branding.SupportEmail != "help@example.edu" {
+		t.Errorf("branding = %+v, want normalized colors and email", branding.InstituteBranding)
+	}
+	footer := branding.EmailFooterHTML
+	if strings.Contains(footer, "onclick") || strings.Contains(footer, "javascript:") || strings.Contains(footer, "steal") || !strings.Contains(footer, `href="https://example.edu"`) || !strings.HasSuffix(footer, "</p>") {
+		t.Errorf("footer = %q, want it without script and closed", footer)
+	}
+
+	// Unset fields are kept; an empty one is cleared
+	branding, err = svc.UpdateInstituteBranding(instituteID, BrandingRequest{SecondaryColor: str("")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branding.PrimaryColor != "#1a73e8" || branding.SecondaryColor != "" {
+		t.Errorf("colors after clearing the secondary = %q, %q", branding.PrimaryColor, branding.SecondaryColor)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// InstituteCohorts are an institute's cohorts, newest first, with how many
+// students each has
+type InstituteCohorts struct {
+	Cohorts []CohortSummary `json:"cohorts"`
+	// WithoutCohort counts the students with no enrollment year
+	WithoutCohort int64 `json:"without_cohort"`
+}
+
+type CohortSummary struct {
+	Label          string            `json:"label"`
+	EnrollmentYear int               `json:"enrollment_year"`
+	IntakeSeason   core.IntakeSeason `json:"intake_season,omitempty"`
+	Students       int64             `json:"students"`
+}
+
+// GetInstituteCohorts counts the institute's students per cohort
+func (s *IdentityService) GetInstituteCohorts(instituteID string) (*InstituteCohorts, error) {
+	institute, err := s.repo.GetInstituteByID(instituteID)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.repo.CountInstituteCohorts(institute.ID)
+	if err != nil {
+		return nil, err
+	}
+	cohorts := &InstituteCohorts{
+		Cohorts:       make([]CohortSummary, len(counts.Cohorts)),
+		WithoutCohort: counts.WithoutCohort,
+	}
+	for i, c := range counts.Cohorts {
+		cohorts.Cohorts[i] = CohortSummary{
+			Label:          c.Label(),
+			EnrollmentYear: c.EnrollmentYear,
+			IntakeSeason:   c.IntakeSeason,
+			Students:       c.Students,
+		}
+	}
+	return cohorts, nil
+}
+
+// ListCohortStudents returns a page of the institute's students in the
+// cohort labelled label, newest first
+func (s *IdentityService) ListCohortStudents(instituteID, label string, page pagination.Request) (pagination.Page[core.User], error) {
+	verr := &ValidationError{}
+	cohort := parseCohort("label", label, verr)
+	if err := verr.errOrNil(); err != nil {
+		return pagination.Page[core.User]{}, err
+	}
+	if page.After != nil {
+		if _, err := uuid.Parse(page.After.ID); err != nil {
+			return pagination.Page[core.User]{}, pagination.ErrInvalidCursor
+		}
+	}
+	institute, err := s.repo.GetInstituteByID(instituteID)
+	if err != nil {
+		return pagination.Page[core.User]{}, err
+	}
+	users, err := s.repo.ListCohortStudents(institute.ID, *cohort, page)
+	if err != nil {
+		return pagination.Page[core.User]{}, err
+	}
+	return pagination.NewPage(users, page.Limit, func(u core.User) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: u.CreatedAt, ID: u.ID.String()}
+	}), nil
+}
+
+// studentCohort is the cohort a student registering now starts in: year if
+// it is set, or else the year of the institute's current term, or of today
+// between terms. The season is that of the term, or of today, unless an
+// explicit year is another one, when it is left unknown.
+func (s *IdentityService) studentCohort(instituteID *uuid.UUID, year *int) (core.Cohort, error) {
+	intake := time.Now()
+	if instituteID != nil {
+		term, err := s.repo.GetCurrentTerm(instituteID.String(), intake)
+		switch {
+		case err == nil:
+			intake = term.StartsOn
+		case !errors.Is(err, repository.ErrNoCurrentTerm):
+			return core.Cohort{}, err
+		}
+	}
+
+	cohort := core.Cohort{EnrollmentYear: intake.Year(), IntakeSeason: core.SeasonOf(intake)}
+	if year != nil && *year != cohort.EnrollmentYear {
+		cohort = core.Cohort{EnrollmentYear: *year}
+	}
+	return cohort, nil
+}
+
+// checkEnrollmentYear adds a field error unless year is one a student can
+// have
+func checkEnrollmentYear(field string, year int, verr *ValidationError) {
+	if latest := core.MaxEnrollmentYear(time.Now()); year < core.MinEnrollmentYear || year > latest {
+		verr.add(field, fmt.Sprintf("must be between %d and %d", core.MinEnrollmentYear, latest))
+	}
+}
+
+// checkIntakeSeason adds a field error unless season is one of the intake
+// seasons; empty means not known
+func checkIntakeSeason(field string, season core.IntakeSeason, verr *ValidationError) {
+	switch season {
+	case "", core.IntakeSpring, core.IntakeSummer, core.IntakeFall:
+	default:
+		verr.add(field, "must be SPRING, SUMMER or FALL")
+	}
+}
+
+// parseCohort reads a cohort label, adding a field error and returning nil
+// if it is not one
+func parseCohort(field, label string, verr *ValidationError) *core.Cohort {
+	cohort, ok := core.ParseCohort(label)
+	if !ok {
+		verr.add(field, "must be a cohort such as 2023 or 2023-FALL")
+		return nil
+	}
+	return &cohort
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+)
+
+// registerStudent registers a student of the institute, with year as their
+// enrollment year if it is set
+func registerStudent(t *testing.T, svc *IdentityService, instituteID uuid.UUID, year *int) *core.User {
+	t.Helper()
+	id := uuid.NewString()
+	user, err := svc.RegisterUser(CreateUserRequest{
+		FullName:         "Student " + id[:8],
+		Email:            id + "@example.com",
+		UserType:         core.UserTypeStudent,
+		EnrollmentNumber: "S-" + id,
+		EnrollmentYear:   year,
+		InstituteID:      instituteID.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestCohortIsTheSameOnEveryPath(t *testing.T) {
+	svc, db := newTestService(t, &core.Term{}, &core.ActivityEntry{})
+	withTerm := createOrgTree(t, db)
+	withoutTerm := createOrgTree(t, db)
+	// Not under way today, but the current term all the same
+	if _, err := svc.CreateTerm(withTerm.Institute.ID.String(), TermRequest{Name: "Fall 2025", StartsOn: "2025-09-01", EndsOn: "2026-01-31", IsCurrent: boolPtr(true)}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name      string
+		institute uuid.UUID
+		year      *int
+		want      string
+	}{
+		{"from the current term", withTerm.Institute.ID, nil, "2025-FALL"},
+		{"the current term's year", withTerm.Institute.ID, intPtr(2025), "2025-FALL"},
+		{"another year", withTerm.Institute.ID, intPtr(2023), "2023"},
+		{"from today", withoutTerm.Institute.ID, nil, core.CohortLabel(now.Year(), core.SeasonOf(now))},
+	} {
+		student := registerStudent(t, svc, tc.institute, tc.year)
+		if got := student.StudentProfile.Cohort; got != tc.want {
+			t.Errorf("registered %s: cohort %q, want %q", tc.name, got, tc.want)
+		}
+		reloaded, err := svc.GetUser(student.ID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reloaded.StudentProfile.Cohort; got != tc.want {
+			t.Errorf("registered %s: cohort %q once loaded, want %q", tc.name, got, tc.want)
+		}
+		found, err := svc.SearchInstituteUsers(tc.institute.String(), "", string(core.UserTypeStudent), tc.want, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listed := false
+		for _, u := range found {
+			listed = listed || u.ID == student.ID
+		}
+		if !listed {
+			t.Errorf("registered %s: searching cohort %s did not find the student", tc.name, tc.want)
+		}
+	}
+
+	for _, year := range []int{core.MinEnrollmentYear - 1, core.MaxEnrollmentYear(now) + 1} {
+		_, err := svc.RegisterUser(CreateUserRequest{
+			FullName: "Too far", Email: uuid.NewString() + "@example.com", UserType: core.UserTypeStudent,
+			EnrollmentNumber: uuid.NewString(), EnrollmentYear: intPtr(year), InstituteID: withTerm.Institute.ID.String(),
+		})
+		if !hasFieldError(validationErrorOf(t, err), "enrollment_year") {
+			t.Errorf("registering with enrollment year %d: got %v", year, err)
+		}
+	}
+
+	// Updating a student relabels them the same way
+	student := registerStudent(t, svc, withTerm.Institute.ID, nil)
+	spring := core.IntakeSpring
+	updated, err := svc.UpdateUser(student.ID.String(), UserUpdate{EnrollmentYear: intPtr(2024), IntakeSeason: &spring}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := svc.GetUser(student.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.StudentProfile.Cohort != "2024-SPRING" || reloaded.StudentProfile.Cohort != "2024-SPRING" {
+		t.Errorf("updated cohort %q, %q once loaded; want 2024-SPRING", updated.StudentProfile.Cohort, reloaded.StudentProfile.Cohort)
+	}
+	winter := core.IntakeSeason("WINTER")
+	for field, update := range map[string]UserUpdate{
+		"enrollment_year": {EnrollmentYear: intPtr(core.MaxEnrollmentYear(now) + 1)},
+		"intake_season":   {IntakeSeason: &winter},
+	} {
+		if _, err := svc.UpdateUser(student.ID.String(), update, nil); !hasFieldError(validationErrorOf(t, err), field) {
+			t.Errorf("updating %s out of range: got %v", field, err)
+		}
+	}
+}
+
+func TestInstituteCohortCounts(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	other := createOrgTree(t, db)
+	students := createInstituteStudents(t, db, tree.Institute.ID, 9, time.Now().UTC())
+	outside := createInstituteStudents(t, db, other.Institute.ID, 1, time.Now().UTC())
+	cohorts := []struct {
+		year   int
+		season core.IntakeSeason
+	}{
+		{2024, core.IntakeFall}, {2024, core.IntakeFall}, {2024, core.IntakeFall},
+		{2024, core.IntakeSpring}, {2024, core.IntakeSpring},
+		{2023, ""},
+		{2024, core.IntakeFall}, // deleted below
+	}
+	for i, c := range cohorts {
+		err := db.Model(&core.StudentProfile{}).Where("user_id = ?", students[i].ID).
+			Updates(map[string]interface{}{"enrollment_year": c.year, "intake_season": c.season}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Model(&core.StudentProfile{}).Where("user_id = ?", outside[0].ID).
+		Updates(map[string]interface{}{"enrollment_year": 2024, "intake_season": core.IntakeFall}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&students[6]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := svc.GetInstituteCohorts(tree.Institute.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range counts.Cohorts {
+		got = append(got, c.Label+"="+strconv.FormatInt(c.Students, 10))
+	}
+	want := []string{"2024-FALL=3", "2024-SPRING=2", "2023=1"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("cohorts = %v, want %v", got, want)
+	}
+	if counts.WithoutCohort != 2 {
+		t.Errorf("%d students without a cohort, want 2", counts.WithoutCohort)
+	}
+
+	// The students of a cohort, a page at a time
+	seen := map[uuid.UUID]bool{}
+	page, err := svc.ListCohortStudents(tree.Institute.ID.String(), "2024-fall", pagination.Request{Limit: 2})
+	for {
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range page.Items {
+			if u.StudentProfile == nil || u.StudentProfile.Cohort != "2024-FALL" || seen[u.ID] {
+				t.Fatalf("listed %s with profile %+v", u.ID, u.StudentProfile)
+			}
+			seen[u.ID] = true
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		after, decodeErr := pagination.Decode(*page.NextCursor)
+		if decodeErr != nil {
+			t.Fatal(decodeErr)
+		}
+		page, err = svc.ListCohortStudents(tree.Institute.ID.String(), "2024-FALL", pagination.Request{Limit: 2, After: &after})
+	}
+	if len(seen) != 3 {
+		t.Errorf("listed %d students of 2024-FALL, want 3", len(seen))
+	}
+
+	if _, err := svc.ListCohortStudents(tree.Institute.ID.String(), "fall-2024", pagination.Request{Limit: 2}); !hasFieldError(validationErrorOf(t, err), "label") {
+		t.Errorf("listing a malformed cohort: got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+func TestDeleteDepartmentWithClassesIsBlocked(t *testing.T) {
+	svc, db := newTestService(t, &core.DeletionTombstone{})
+	tree := createOrgTree(t, db)
+
+	report, err := svc.DeleteDepartment(tree.Department.ID.String(), repository.DeleteOptions{RequestedBy: "admin-1"})
+	var blocked *repository.DeletionBlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("err = %v, want a DeletionBlockedError", err)
+	}
+	if report == nil || len(report.Blockers) != 1 || report.Blockers[0].Reason != "classes" || report.Blockers[0].Count != 1 {
+		t.Errorf("report = %+v, want the one class as the only blocker", report)
+	}
+	if _, err := svc.repo.GetDepartmentByID(tree.Department.ID.String()); err != nil {
+		t.Errorf("blocked department was deleted: %v", err)
+	}
+	var tombstones int64
+	db.Model(&core.DeletionTombstone{}).Count(&tombstones)
+	if tombstones != 0 {
+		t.Errorf("blocked deletion left %d tombstones", tombstones)
+	}
+}
+
+func TestDeleteInstituteDryRunChangesNothing(t *testing.T) {
+	svc, db := newTestService(t, &core.DeletionTombstone{})
+	tree := createOrgTree(t, db)
+	student := createUser(t, db, core.UserTypeStudent)
+	if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", student.ID.String(), false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := svc.DeleteInstitute(tree.Institute.ID.String(), repository.DeleteOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Faculties != 1 || report.Departments != 1 || report.Classes != 1 || report.Enrollments != 1 || report.EnrolledClasses != 1 {
+		t.Errorf("report = %+v, want one of each below the institute", report)
+	}
+	if len(report.Blockers) != 2 || report.Tombstone != nil {
+		t.Errorf("blockers = %+v, tombstone = %v; want faculties and enrolled classes, and no tombstone", report.Blockers, report.Tombstone)
+	}
+	if _, err := svc.repo.GetInstituteByID(tree.Institute.ID.String()); err != nil {
+		t.Errorf("dry run deleted the institute: %v", err)
+	}
+	if _, err := svc.repo.GetClassByID(tree.Class.ID.String()); err != nil {
+		t.Errorf("dry run deleted the class: %v", err)
+	}
+}
+
+func TestCascadeDeleteLeavesTombstone(t *testing.T) {
+	svc, db := newTestService(t, &core.DeletionTombstone{})
+	tree := createOrgTree(t, db)
+	other := createOrgTree(t, db)
+
+	report, err := svc.DeleteFaculty(tree.Faculty.ID.String(), repository.DeleteOptions{Cascade: true, RequestedBy: "admin-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Tombstone == nil || report.Tombstone.UnitID != tree.Faculty.ID || !report.Tombstone.Cascaded || report.Tombstone.RequestedBy != "admin-1" {
+		t.Fatalf("tombstone = %+v", report.Tombstone)
+	}
+	var stored core.DeletionTombstone
+	if err := db.First(&stored, "unit_id = ?", tree.Faculty.ID).Error; err != nil || stored.Departments != 1 || stored.Classes != 1 {
+		t.Errorf("stored tombstone = %+v, %v; want one department and class", stored, err)
+	}
+
+	for name, lookup := range map[string]func() error{
+		"faculty":    func() error { _, err := svc.repo.GetFacultyByID(tree.Faculty.ID.String()); return err },
+		"department": func() error { _, err := svc.repo.GetDepartmentByID(tree.Department.ID.String()); return err },
+		"class":      func() error { _, err := svc.repo.GetClassByID(tree.Class.ID.String()); return err },
+	} {
+		if lookup() == nil {
+			t.Errorf("%s below the deleted faculty can still be fetched", name)
+		}
+	}
+	if _, err := svc.repo.GetInstituteByID(tree.Institute.ID.String()); err != nil {
+		t.Errorf("institute above the faculty was deleted: %v", err)
+	}
+	if _, err := svc.repo.GetClassByID(other.Class.ID.String()); err != nil {
+		t.Errorf("class of another institute was deleted: %v", err)
+	}
+}
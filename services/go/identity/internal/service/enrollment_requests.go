@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// enrollmentApprovedTemplate and enrollmentRejectedTemplate are the email
+	// service templates students get when their request to join a class is
+	// decided
+	enrollmentApprovedTemplate = "enrollment_request_approved"
+	enrollmentRejectedTemplate = "enrollment_request_rejected"
+)
+
+var (
+	ErrNotRequestingStudent = errors.New("only students can ask to join a class")
+	ErrOutsideInstitute     = errors.New("class is not in the student's institute")
+	ErrNotClassInstructor   = errors.New("only an instructor of the class can do this")
+)
+
+// RequestEnrollment asks for studentID to join a class, in sectionID or the
+// class's default section if that is empty. The request waits for one of the
+// class's instructors and takes no seat until approved. Asking again returns
+// the existing request, pending or rejected, with created false.
+func (s *IdentityService) RequestEnrollment(studentID, classID, sectionID string) (*core.ClassEnrollment, bool, error) {
+	student, err := s.repo.GetUserByID(studentID)
+	if err != nil {
+		return nil, false, err
+	}
+	if student.UserType != core.UserTypeStudent {
+		return nil, false, ErrNotRequestingStudent
+	}
+	cID, err := parseID("class_id", classID)
+	if err != nil {
+		return nil, false, err
+	}
+	var sectionUUID uuid.UUID
+	if sectionID != "" {
+		if sectionUUID, err = parseID("section_id", sectionID); err != nil {
+			return nil, false, err
+		}
+	}
+	_, instituteID, err := s.repo.ClassScope(cID)
+	if err != nil {
+		return nil, false, err
+	}
+	if profile := student.StudentProfile; profile != nil && profile.InstituteID != nil && *profile.InstituteID != instituteID {
+		return nil, false, ErrOutsideInstitute
+	}
+
+	request := &core.ClassEnrollment{ClassID: cID, SectionID: sectionUUID, StudentID: student.ID}
+	created, err := s.repo.RequestEnrollment(request, today())
+	if err != nil {
+		return nil, false, err
+	}
+	if created {
+		s.recordActivity("enrollment.request", "enrollment", studentID, nil, map[string]any{
+			"class_id":   cID,
+			"section_id": request.SectionID,
+		})
+	}
+	return request, created, nil
+}
+
+// GetEnrollmentRequests returns the pending requests to join a class, for
+// one of its instructors
+func (s *IdentityService) GetEnrollmentRequests(callerID, classID string) ([]core.ClassEnrollment, error) {
+	id, err := s.taughtClass(callerID, classID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetEnrollmentRequests(id)
+}
+
+// ApproveEnrollmentRequest gives the student a seat, if the class and the
+// section they asked for have one free, and emails them. A full class or
+// section fails with repository.ErrClassFull or repository.ErrSectionFull
+// and the request stays pending.
+func (s *IdentityService) ApproveEnrollmentRequest(callerID, classID, studentID string) (*core.ClassEnrollment, error) {
+	id, err := s.taughtClass(callerID, classID)
+	if err != nil {
+		return nil, err
+	}
+	sID, err := uuid.Parse(studentID)
+	if err != nil {
+		return nil, repository.ErrEnrollmentRequestNotFound
+	}
+	decider, _ := uuid.Parse(callerID)
+
+	enrollment, err := s.repo.ApproveEnrollmentRequest(id, sID, decider, today())
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateClassStats(classID)
+	s.recordActivity("enrollment.approve", "enrollment", studentID, nil, map[string]any{
+		"class_id":   id,
+		"section_id": enrollment.SectionID,
+	})
+	s.notifyEnrollmentDecision(enrollment)
+	return enrollment, nil
+}
+
+// RejectEnrollmentRequest turns down the student's request and emails them
+func (s *IdentityService) RejectEnrollmentRequest(callerID, classID, studentID string) (*core.ClassEnrollment, error) {
+	id, err := s.taughtClass(callerID, classID)
+	if err != nil {
+		return nil, err
+	}
+	sID, err := uuid.Parse(studentID)
+	if err != nil {
+		return nil, repository.ErrEnrollmentRequestNotFound
+	}
+	decider, _ := uuid.Parse(callerID)
+
+	enrollment, err := s.repo.RejectEnrollmentRequest(id, sID, decider)
+	if err != nil {
+		return nil, err
+	}
+	s.recordActivity("enrollment.reject", "enrollment", studentID, nil, map[string]any{"class_id": id})
+	s.notifyEnrollmentDecision(enrollment)
+	return enrollment, nil
+}
+
+// taughtClass parses classID, checking the class exists and the caller
+// teaches one of its sections
+func (s *IdentityService) taughtClass(callerID, classID string) (uuid.UUID, error) {
+	id, err := uuid.Parse(classID)
+	if err != nil {
+		return uuid.Nil, repository.ErrClassNotFound
+	}
+	if _, _, err := s.repo.ClassScope(id); err != nil {
+		return uuid.Nil, err
+	}
+	caller, err := uuid.Parse(callerID)
+	if err != nil {
+		return uuid.Nil, ErrNotClassInstructor
+	}
+	teaches, err := s.repo.TeachesClass(id, caller)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !teaches {
+		return uuid.Nil, ErrNotClassInstructor
+	}
+	return id, nil
+}
+
+// notifyEnrollmentDecision emails the student whether their request was
+// approved. A failure is logged; the decision stands either way.
+func (s *IdentityService) notifyEnrollmentDecision(enrollment *core.ClassEnrollment) {
+	student, err := s.repo.GetUserByID(enrollment.StudentID.String())
+	if err != nil {
+		log.Printf("Enrollment request of %s to class %s: student not found to email: %v", enrollment.StudentID, enrollment.ClassID, err)
+		return
+	}
+	template := enrollmentRejectedTemplate
+	if enrollment.Status == core.EnrollmentEnrolled {
+		template = enrollmentApprovedTemplate
+	}
+	className, _ := s.repo.OrgUnitName(core.AnnouncementScopeClass, enrollment.ClassID)
+
+	payload := map[string]interface{}{
+		"template_name": template,
+		"recipients": []map[string]interface{}{{
+			"email":  student.Email,
+			"locale": userLocale(student),
+			"data":   map[string]string{"name": student.FullName},
+		}},
+		"data":           map[string]string{"class_name": className},
+		"category":       "notification",
+		"default_locale": s.orgUnitDefaultLocale(core.AnnouncementScopeClass, enrollment.ClassID),
+	}
+	if _, instituteID, err := s.repo.ClassScope(enrollment.ClassID); err == nil {
+		payload["institute_id"] = instituteID.String() // for the institute's branding
+	}
+
+	failed, err := s.sendTemplateEmails(payload)
+	if err != nil {
+		log.Printf("Enrollment request of %s to class %s: decision not emailed: %v", enrollment.StudentID, enrollment.ClassID, err)
+		return
+	}
+	if len(failed) > 0 {
+		log.Printf("Enrollment request of %s to class %s: decision not emailed to %s", enrollment.StudentID, enrollment.ClassID, strings.Join(failed, ", "))
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"gorm.io/gorm"
+)
+
+// emailTemplates records the template of every email sent through svc
+func emailTemplates(t *testing.T, svc *IdentityService) func() []string {
+	t.Helper()
+	var (
+		mu        sync.Mutex
+		templates []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			TemplateName string `json:"template_name"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		templates = append(templates, payload.TemplateName)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": []map[string]string{}})
+	}))
+	t.Cleanup(server.Close)
+	svc.cfg.EmailServiceURL = server.URL
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), templates...)
+	}
+}
+
+// createTaughtClass adds a class of the given capacity to a new org tree,
+// with an instructor teaching its default section
+func createTaughtClass(t *testing.T, svc *IdentityService, db *gorm.DB, capacity int) (*core.Class, *core.User) {
+	t.Helper()
+	class := createClassWithCapacity(t, svc, createOrgTree(t, db), capacity)
+	instructor := createUser(t, db, core.UserTypeInstructor)
+	err := db.Model(&core.ClassSection{}).Where("class_id = ?", class.ID).Update("instructor_id", instructor.ID).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return class, instructor
+}
+
+func TestEnrollmentRequestTransitions(t *testing.T) {
+	svc, db := newTestService(t)
+	sent := emailTemplates(t, svc)
+	class, instructor := createTaughtClass(t, svc, db, 5)
+	students := createStudents(t, db, 2)
+	classID, instructorID := class.ID.String(), instructor.ID.String()
+
+	if _, _, err := svc.RequestEnrollment(instructorID, classID, ""); !errors.Is(err, ErrNotRequestingStudent) {
+		t.Errorf("instructor asking to join = %v, want ErrNotRequestingStudent", err)
+	}
+
+	request, created, err := svc.RequestEnrollment(students[0].ID.String(), classID, "")
+	if err != nil || !created || request.Status != core.EnrollmentPending {
+		t.Fatalf("request = %+v, %t, %v; want a new pending request", request, created, err)
+	}
+	again, created, err := svc.RequestEnrollment(students[0].ID.String(), classID, "")
+	if err != nil || created || again.Status != core.EnrollmentPending || !again.EnrolledAt.Equal(request.EnrolledAt) {
+		t.Errorf("asking again = %+v, %t, %v; want the pending request back", again, created, err)
+	}
+	if _, _, err := svc.RequestEnrollment(students[1].ID.String(), classID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.GetEnrollmentRequests(students[1].ID.String(), classID); !errors.Is(err, ErrNotClassInstructor) {
+		t.Errorf("a student listing requests = %v, want ErrNotClassInstructor", err)
+	}
+	if _, err := svc.ApproveEnrollmentRequest(students[1].ID.String(), classID, students[1].ID.String()); !errors.Is(err, ErrNotClassInstructor) {
+		t.Errorf("a student approving their own request = %v, want ErrNotClassInstructor", err)
+	}
+	pending, err := svc.GetEnrollmentRequests(instructorID, classID)
+	if err != nil || len(pending) != 2 || pending[0].StudentID != students[0].ID {
+		t.Fatalf("pending requests = %+v, %v; want both, oldest first", pending, err)
+	}
+
+	approved, err := svc.ApproveEnrollmentRequest(instructorID, classID, students[0].ID.String())
+	if err != nil || approved.Status != core.EnrollmentEnrolled || approved.DecidedBy == nil || *approved.DecidedBy != instructor.ID {
+		t.Fatalf("approve = %+v, %v; want enrolled, decided by the instructor", approved, err)
+	}
+	rejected, err := svc.RejectEnrollmentRequest(instructorID, classID, students[1].ID.String())
+	if err != nil || rejected.Status != core.EnrollmentRejected {
+		t.Fatalf("reject = %+v, %v", rejected, err)
+	}
+
+	// Decided requests cannot be decided again
+	if _, err := svc.RejectEnrollmentRequest(instructorID, classID, students[0].ID.String()); !errors.Is(err, repository.ErrEnrollmentRequestNotFound) {
+		t.Errorf("rejecting an approved request = %v, want ErrEnrollmentRequestNotFound", err)
+	}
+	if _, err := svc.ApproveEnrollmentRequest(instructorID, classID, students[1].ID.String()); !errors.Is(err, repository.ErrEnrollmentRequestNotFound) {
+		t.Errorf("approving a rejected request = %v, want ErrEnrollmentRequestNotFound", err)
+	}
+	// Asking again after a rejection returns it, and an enrolled student
+	// cannot ask at all
+	if again, created, err := svc.RequestEnrollment(students[1].ID.String(), classID, ""); err != nil || created || again.Status != core.EnrollmentRejected {
+		t.Errorf("asking again after a rejection = %+v, %t, %v; want the rejected request", again, created, err)
+	}
+	if _, _, err := svc.RequestEnrollment(students[0].ID.String(), classID, ""); !errors.Is(err, repository.ErrAlreadyEnrolled) {
+		t.Errorf("an enrolled student asking = %v, want ErrAlreadyEnrolled", err)
+	}
+	if pending, err := svc.GetEnrollmentRequests(instructorID, classID); err != nil || len(pending) != 0 {
+		t.Errorf("pending requests after deciding = %+v, %v; want none", pending, err)
+	}
+
+	got := sent()
+	if len(got) != 2 || got[0] != enrollmentApprovedTemplate || got[1] != enrollmentRejectedTemplate {
+		t.Errorf("emails sent with templates %v, want one approval and one rejection", got)
+	}
+}
+
+func TestPendingRequestsAreNotEnrolled(t *testing.T) {
+	svc, db := newTestService(t)
+	class, instructor := createTaughtClass(t, svc, db, 5)
+	student := createStudents(t, db, 1)[0]
+
+	if _, _, err := svc.RequestEnrollment(student.ID.String(), class.ID.String(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if enrolledIDs(t, svc, class.ID)[student.ID] {
+		t.Error("a pending student is on the roster")
+	}
+	if enrollments, err := svc.GetUserEnrollments(student.ID.String()); err != nil || len(enrollments) != 0 {
+		t.Errorf("a pending student's enrollments = %+v, %v; want none, so they get no assignments", enrollments, err)
+	}
+	if tc, err := svc.GetTokenContext(student.ID.String()); err != nil || len(tc.ClassIDs) != 0 {
+		t.Errorf("a pending student's token context = %+v, %v; want no classes", tc, err)
+	}
+	if seats, _, err := svc.repo.ClassSeats(class.ID.String()); err != nil || seats != 0 {
+		t.Errorf("seats taken = %d, %v; want a pending request to take none", seats, err)
+	}
+
+	if _, err := svc.ApproveEnrollmentRequest(instructor.ID.String(), class.ID.String(), student.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if !enrolledIDs(t, svc, class.ID)[student.ID] {
+		t.Error("an approved student is not on the roster")
+	}
+	if enrollments, err := svc.GetUserEnrollments(student.ID.String()); err != nil || len(enrollments) != 1 {
+		t.Errorf("an approved student's enrollments = %+v, %v; want the class", enrollments, err)
+	}
+}
+
+func TestCapacityIsCheckedWhenARequestIsApproved(t *testing.T) {
+	svc, db := newTestService(t)
+	class, instructor := createTaughtClass(t, svc, db, 1)
+	students := createStudents(t, db, 2)
+	classID, instructorID := class.ID.String(), instructor.ID.String()
+
+	if _, err := svc.EnrollStudent(classID, "", students[0].ID.String(), false, false); err != nil {
+		t.Fatal(err)
+	}
+	// A full class still takes requests
+	if _, created, err := svc.RequestEnrollment(students[1].ID.String(), classID, ""); err != nil || !created {
+		t.Fatalf("asking to join a full class = %t, %v; want a pending request", created, err)
+	}
+	if _, err := svc.ApproveEnrollmentRequest(instructorID, classID, students[1].ID.String()); !errors.Is(err, repository.ErrClassFull) {
+		t.Fatalf("approving into a full class = %v, want ErrClassFull", err)
+	}
+	if pending, err := svc.GetEnrollmentRequests(instructorID, classID); err != nil || len(pending) != 1 {
+		t.Fatalf("pending requests = %+v, %v; want the request left pending", pending, err)
+	}
+
+	if err := svc.UnenrollStudent(classID, students[0].ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ApproveEnrollmentRequest(instructorID, classID, students[1].ID.String()); err != nil {
+		t.Fatalf("approving once a seat freed up = %v", err)
+	}
+	if ids := enrolledIDs(t, svc, class.ID); len(ids) != 1 || !ids[students[1].ID] {
+		t.Errorf("roster = %v, want only the approved student", ids)
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createClassWithCapacity adds a class of the given capacity to tree's
+// department
+func createClassWithCapacity(t *testing.T, svc *IdentityService, tree *orgTree, capacity int) *core.Class {
+	t.Helper()
+	class, err := svc.CreateClass(tree.Department.ID.String(), "Limited", &capacity, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return class
+}
+
+func createStudents(t *testing.T, db *gorm.DB, n int) []*core.User {
+	t.Helper()
+	students := make([]*core.User, n)
+	for i := range students {
+		students[i] = createUser(t, db, core.UserTypeStudent)
+	}
+	return students
+}
+
+func enrolledIDs(t *testing.T, svc *IdentityService, classID uuid.UUID) map[uuid.UUID]bool {
+	t.Helper()
+	roster, err := svc.GetClassEnrollments(classID.String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[uuid.UUID]bool{}
+	for _, e := range roster.Enrollments {
+		ids[e.StudentID] = true
+	}
+	return ids
+}
+
+func TestParallelEnrollmentsCannotOversubscribe(t *testing.T) {
+	svc, db := newTestService(t)
+	class := createClassWithCapacity(t, svc, createOrgTree(t, db), 3)
+	students := createStudents(t, db, 10)
+
+	var wg sync.WaitGroup
+	results := make([]*repository.EnrollmentResult, len(students))
+	errs := make([]error, len(students))
+	for i, student := range students {
+		wg.Add(1)
+		go func(i int, student *core.User) {
+			defer wg.Done()
+			results[i], errs[i] = svc.EnrollStudent(class.ID.String(), "", student.ID.String(), false, false)
+		}(i, student)
+	}
+	wg.Wait()
+
+	enrolled, full := 0, 0
+	for i, err := range errs {
+		switch {
+		case err == nil && results[i].Enrolled:
+			enrolled++
+		case errors.Is(err, repository.ErrClassFull):
+			full++
+		default:
+			t.Errorf("enrollment %d: %+v, %v", i, results[i], err)
+		}
+	}
+	if enrolled != 3 || full != 7 {
+		t.Errorf("%d enrolled and %d turned away, want 3 and 7", enrolled, full)
+	}
+	roster, err := svc.GetClassEnrollments(class.ID.String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roster.SeatsTaken != 3 || len(roster.Enrollments) != 3 {
+		t.Errorf("roster has %d seats taken and %d enrollments, want 3", roster.SeatsTaken, len(roster.Enrollments))
+	}
+}
+
+func TestWaitlistIsPromotedInOrder(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	class := createClassWithCapacity(t, svc, tree, 1)
+	s := createStudents(t, db, 4)
+
+	if res, err := svc.EnrollStudent(class.ID.String(), "", s[0].ID.String(), true, false); err != nil || !res.Enrolled {
+		t.Fatalf("first student: %+v, %v", res, err)
+	}
+	for i, student := range s[1:] {
+		res, err := svc.EnrollStudent(class.ID.String(), "", student.ID.String(), true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Enrolled || res.WaitlistEntry == nil || res.WaitlistEntry.Position != i+1 {
+			t.Fatalf("student %d on a full class: %+v, want waitlist position %d", i+1, res, i+1)
+		}
+	}
+	// Asking again keeps the student's place instead of queueing them twice
+	if res, err := svc.EnrollStudent(class.ID.String(), "", s[2].ID.String(), true, false); err != nil || res.WaitlistEntry.Position != 2 {
+		t.Fatalf("re-queueing: %+v, %v", res, err)
+	}
+	if _, err := svc.EnrollStudent(class.ID.String(), "", s[0].ID.String(), true, false); !errors.Is(err, repository.ErrAlreadyEnrolled) {
+		t.Errorf("enrolling twice: got %v, want ErrAlreadyEnrolled", err)
+	}
+
+	// A freed seat goes to the head of the line
+	if err := svc.UnenrollStudent(class.ID.String(), s[0].ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if ids := enrolledIDs(t, svc, class.ID); len(ids) != 1 || !ids[s[1].ID] {
+		t.Fatalf("after a seat freed up, enrolled = %v, want the first waitlisted student", ids)
+	}
+
+	// Leaving the waitlist gives up the place without touching enrollments
+	if err := svc.UnenrollStudent(class.ID.String(), s[2].ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	waitlist, err := svc.GetClassWaitlist(class.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waitlist) != 1 || waitlist[0].StudentID != s[3].ID {
+		t.Fatalf("waitlist = %+v, want only the last student", waitlist)
+	}
+
+	// Raising the capacity fills the new seats from the waitlist
+	capacity := 5
+	if _, err := svc.UpdateClass(class.ID.String(), "", &capacity, true, nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ids := enrolledIDs(t, svc, class.ID); len(ids) != 2 || !ids[s[3].ID] {
+		t.Errorf("after raising the capacity, enrolled = %v, want the waitlisted student too", ids)
+	}
+	if waitlist, _ := svc.GetClassWaitlist(class.ID.String()); len(waitlist) != 0 {
+		t.Errorf("waitlist after raising the capacity = %+v, want empty", waitlist)
+	}
+}
+
+func TestClassCapacityMustNotBeNegative(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	capacity := -1
+	_, err := svc.CreateClass(tree.Department.ID.String(), "Bad", &capacity, "")
+	if !hasFieldError(validationErrorOf(t, err), "capacity") {
+		t.Errorf("negative capacity: got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// exportStaleAfter is how long a job may stay running before it is
+	// assumed abandoned and claimed again
+	exportStaleAfter = 10 * time.Minute
+	// exportTimeout bounds the calls to other services for one export
+	exportTimeout = 30 * time.Second
+)
+
+// UserExport is the document a user (or an admin on their behalf) receives
+// when exporting the data held about them. Sessions and SubmissionIDs point
+// to data held by the session and submission services.
+type UserExport struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	*repository.UserRecords
+	Sessions      json.RawMessage `json:"sessions"`
+	SubmissionIDs []string        `json:"submission_ids"`
+}
+
+// RequestUserExport queues an export of the user's data on behalf of
+// requestedBy. If an export for the user is already pending or running, that
+// job is returned instead.
+func (s *IdentityService) RequestUserExport(userID, requestedBy string) (*core.ExportJob, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, repository.ErrUserNotFound
+	}
+	return s.repo.CreateExportJob(id, requestedBy)
+}
+
+// GetExportJob returns an export job; its Document is set once it is done
+func (s *IdentityService) GetExportJob(jobID string) (*core.ExportJob, error) {
+	id, err := uuid.Parse(jobID)
+	if err != nil {
+		return nil, repository.ErrExportJobNotFound
+	}
+	return s.repo.GetExportJob(id)
+}
+
+// BuildUserExport assembles the export document. It fails if another service
+// cannot be reached, since a partial export would look complete to the user.
+func (s *IdentityService) BuildUserExport(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	records, err := s.repo.GetUserRecords(userID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	doc := UserExport{
+		GeneratedAt:   time.Now().UTC(),
+		UserRecords:   records,
+		SubmissionIDs: []string{},
+	}
+
+	if err := s.getJSON(ctx, s.cfg.SessionServiceURL+"/internal/users/"+userID.String()+"/sessions", &doc.Sessions); err != nil {
+		return nil, fmt.Errorf("session service: %w", err)
+	}
+
+	var submissions []struct {
+		ID string `json:"id"`
+	}
+	if err := s.getJSON(ctx, s.cfg.SubmissionServiceURL+"/api/v1/submissions?studentId="+url.QueryEscape(userID.String()), &submissions); err != nil {
+		return nil, fmt.Errorf("submission service: %w", err)
+	}
+	for _, submission := range submissions {
+		doc.SubmissionIDs = append(doc.SubmissionIDs, submission.ID)
+	}
+
+	return json.Marshal(doc)
+}
+
+// getJSON calls another service with the internal token and decodes a 200
+// response into out
+func (s *IdentityService) getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Internal-Token", s.cfg.InternalToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ExportWorker builds queued exports in the background and deletes finished
+// ones once they are older than the retention period
+type ExportWorker struct {
+	svc       *IdentityService
+	interval  time.Duration
+	retention time.Duration
+}
+
+func NewExportWorker(svc *IdentityService, interval, retention time.Duration) *ExportWorker {
+	return &ExportWorker{
+		svc:       svc,
+		interval:  interval,
+		retention: retention,
+	}
+}
+
+// Run polls for export jobs until ctx is cancelled
+func (w *ExportWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := w.svc.repo.PurgeExportJobs(time.Now().Add(-w.retention)); err != nil {
+			log.Printf("Failed to purge old exports: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d expired exports", n)
+		}
+
+		// Work through the queue, then wait for the next tick
+		for ctx.Err() == nil {
+			job, err := w.svc.repo.ClaimExportJob(exportStaleAfter)
+			if err != nil {
+				log.Printf("Failed to claim export job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			w.process(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ExportWorker) process(ctx context.Context, job *core.ExportJob) {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	doc, err := w.svc.BuildUserExport(ctx, job.UserID)
+	if err != nil {
+		log.Printf("Export %s for user %s failed: %v", job.ID, job.UserID, err)
+		// Keep internal URLs out of the stored reason
+		reason := "failed to build export"
+		if errors.Is(err, repository.ErrUserNotFound) {
+			reason = err.Error()
+		}
+		if err := w.svc.repo.FailExportJob(job.ID, reason); err != nil {
+			log.Printf("Failed to mark export %s as failed: %v", job.ID, err)
+		}
+		return
+	}
+
+	if err := w.svc.repo.CompleteExportJob(job.ID, doc); err != nil {
+		log.Printf("Failed to store export %s: %v", job.ID, err)
+	}
+}
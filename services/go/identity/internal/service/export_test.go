@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"gorm.io/gorm"
+)
+
+// newExportService returns a service whose session and submission services
+// are served by a test server, which records the internal tokens it was
+// called with.
+func newExportService(t *testing.T) (*IdentityService, *gorm.DB, *exportBackends) {
+	t.Helper()
+	svc, db := newTestService(t, &core.UserMerge{}, &core.ExportJob{}, &core.LoginEvent{}, &core.PolicyDocument{}, &core.UserPolicyAcceptance{})
+	backends := &exportBackends{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/internal/users/", func(w http.ResponseWriter, r *http.Request) {
+		backends.tokens = append(backends.tokens, r.Header.Get("X-Internal-Token"))
+		_, _ = w.Write([]byte(`[{"id":"session-1"}]`))
+	})
+	mux.HandleFunc("/api/v1/submissions", func(w http.ResponseWriter, r *http.Request) {
+		backends.tokens = append(backends.tokens, r.Header.Get("X-Internal-Token"))
+		if backends.submissionsDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id":"submission-1"},{"id":"submission-2"}]`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	svc.cfg.SessionServiceURL = server.URL
+	svc.cfg.SubmissionServiceURL = server.URL
+	return svc, db, backends
+}
+
+type exportBackends struct {
+	tokens          []string
+	submissionsDown bool
+}
+
+func TestBuildUserExportCollectsUserData(t *testing.T) {
+	svc, db, backends := newExportService(t)
+	tree := createOrgTree(t, db)
+	student := createUser(t, db, core.UserTypeStudent)
+	other := createUser(t, db, core.UserTypeStudent)
+	for _, u := range []*core.User{student, other} {
+		if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", u.ID.String(), false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.RecordLogin(student.ID.String(), LoginEventRequest{ClientIP: "203.0.113.9"}); err != nil {
+		t.Fatal(err)
+	}
+	tos := publishPolicy(t, svc, core.PolicyTypeTOS, "1", time.Now().Add(-time.Hour))
+	if _, err := svc.AcceptPolicies(student.ID.String(), PolicyAcceptanceRequest{DocumentIDs: []string{tos.ID.String()}, ClientIP: "203.0.113.9"}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := svc.BuildUserExport(context.Background(), student.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		User        core.User `json:"user"`
+		Enrollments []struct {
+			ClassID       string `json:"class_id"`
+			InstituteName string `json:"institute_name"`
+		} `json:"enrollments"`
+		MembershipHistory []json.RawMessage   `json:"membership_history"`
+		Sessions          []map[string]string `json:"sessions"`
+		SubmissionIDs     []string            `json:"submission_ids"`
+		LoginHistory      []core.LoginEvent   `json:"login_history"`
+		PolicyAcceptances []struct {
+			DocumentID string `json:"document_id"`
+		} `json:"policy_acceptances"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.User.ID != student.ID {
+		t.Errorf("export is for user %s, want %s", doc.User.ID, student.ID)
+	}
+	if len(doc.Enrollments) != 1 || doc.Enrollments[0].ClassID != tree.Class.ID.String() || doc.Enrollments[0].InstituteName != tree.Institute.Name {
+		t.Errorf("enrollments = %+v, want only the student's own class", doc.Enrollments)
+	}
+	if len(doc.MembershipHistory) != 1 {
+		t.Errorf("membership history has %d events, want the student's one enrollment", len(doc.MembershipHistory))
+	}
+	if len(doc.Sessions) != 1 || len(doc.SubmissionIDs) != 2 {
+		t.Errorf("sessions = %v, submission ids = %v", doc.Sessions, doc.SubmissionIDs)
+	}
+	if len(doc.LoginHistory) != 1 || doc.LoginHistory[0].ClientIP != "203.0.113.9" {
+		t.Errorf("login history = %+v, want the student's one login", doc.LoginHistory)
+	}
+	if len(doc.PolicyAcceptances) != 1 || doc.PolicyAcceptances[0].DocumentID != tos.ID.String() {
+		t.Errorf("policy acceptances = %+v, want the accepted terms", doc.PolicyAcceptances)
+	}
+	for _, token := range backends.tokens {
+		if token != "test" {
+			t.Errorf("service called with internal token %q", token)
+		}
+	}
+}
+
+func TestExportFailsWhenServiceIsDown(t *testing.T) {
+	svc, db, backends := newExportService(t)
+	backends.submissionsDown = true
+	user := createUser(t, db, core.UserTypeStudent)
+
+	job, err := svc.RequestUserExport(user.ID.String(), user.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker := NewExportWorker(svc, time.Minute, time.Hour)
+	claimed, err := svc.repo.ClaimExportJob(exportStaleAfter)
+	if err != nil || claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("claimed %v, %v; want job %s", claimed, err, job.ID)
+	}
+	worker.process(context.Background(), claimed)
+
+	got, err := svc.GetExportJob(job.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != core.ExportFailed || got.Document != "" {
+		t.Errorf("status = %s with %d byte document, want a failed job without a partial export", got.Status, len(got.Document))
+	}
+	if got.Error != "failed to build export" {
+		t.Errorf("error = %q, internal details must not be stored", got.Error)
+	}
+}
+
+func TestExportJobLifecycle(t *testing.T) {
+	svc, db, _ := newExportService(t)
+	user := createUser(t, db, core.UserTypeStudent)
+
+	job, err := svc.RequestUserExport(user.ID.String(), "admin-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := svc.RequestUserExport(user.ID.String(), "admin-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != job.ID {
+		t.Errorf("second request queued job %s, want the pending job %s", again.ID, job.ID)
+	}
+
+	worker := NewExportWorker(svc, time.Minute, time.Hour)
+	claimed, err := svc.repo.ClaimExportJob(exportStaleAfter)
+	if err != nil || claimed == nil {
+		t.Fatalf("claimed %v, %v", claimed, err)
+	}
+	if next, err := svc.repo.ClaimExportJob(exportStaleAfter); err != nil || next != nil {
+		t.Errorf("claimed a running job again: %v, %v", next, err)
+	}
+	worker.process(context.Background(), claimed)
+
+	got, err := svc.GetExportJob(job.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != core.ExportDone || got.Document == "" || got.CompletedAt == nil {
+		t.Fatalf("job = %+v, want a done job with a document", got)
+	}
+
+	// A finished job no longer blocks a new request
+	next, err := svc.RequestUserExport(user.ID.String(), "admin-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID == job.ID {
+		t.Error("request after completion returned the finished job")
+	}
+
+	n, err := svc.repo.PurgeExportJobs(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("purged %d jobs, want only the finished one", n)
+	}
+	if _, err := svc.GetExportJob(job.ID.String()); err == nil {
+		t.Error("purged export can still be fetched")
+	}
+}
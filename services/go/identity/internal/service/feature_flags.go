@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// featureKeyPattern is what flag keys look like, e.g. group_submissions
+var featureKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,63}$`)
+
+// FeatureFlagRequest creates or updates a flag. The key cannot be changed;
+// on update, a missing description or default_on is left unchanged.
+type FeatureFlagRequest struct {
+	Key         string  `json:"key"`
+	Description *string `json:"description"`
+	DefaultOn   *bool   `json:"default_on"`
+}
+
+// InstituteFeature is a flag as it applies to one institute. Override is
+// nil when the institute follows the flag's default.
+type InstituteFeature struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	DefaultOn   bool   `json:"default_on"`
+	Override    *bool  `json:"override"`
+	Enabled     bool   `json:"enabled"`
+}
+
+func (s *IdentityService) CreateFeatureFlag(req FeatureFlagRequest) (*core.FeatureFlag, error) {
+	key := strings.TrimSpace(req.Key)
+	if !featureKeyPattern.MatchString(key) {
+		ve := &ValidationError{}
+		ve.add("key", "must be 2-64 lower-case letters, digits or underscores, starting with a letter")
+		return nil, ve
+	}
+	flag := &core.FeatureFlag{Key: key}
+	applyFeatureFlagRequest(flag, req)
+	if err := s.repo.CreateFeatureFlag(flag); err != nil {
+		if errors.Is(err, repository.ErrFeatureFlagExists) {
+			return nil, newConflictError("key", "is already in use")
+		}
+		return nil, err
+	}
+	s.invalidateFeatureFlags()
+	return flag, nil
+}
+
+func (s *IdentityService) UpdateFeatureFlag(key string, req FeatureFlagRequest) (*core.FeatureFlag, error) {
+	flag, err := s.repo.GetFeatureFlag(key)
+	if err != nil {
+		return nil, err
+	}
+	applyFeatureFlagRequest(flag, req)
+	if err := s.repo.UpdateFeatureFlag(flag); err != nil {
+		return nil, err
+	}
+	s.invalidateFeatureFlags()
+	return flag, nil
+}
+
+// DeleteFeatureFlag deletes a flag and every institute's override of it
+func (s *IdentityService) DeleteFeatureFlag(key string) error {
+	if err := s.repo.DeleteFeatureFlag(key); err != nil {
+		return err
+	}
+	// Overrides of other flags are still right, so only the flags are dropped
+	s.invalidateFeatureFlags()
+	return nil
+}
+
+func (s *IdentityService) GetFeatureFlag(key string) (*core.FeatureFlag, error) {
+	return s.repo.GetFeatureFlag(key)
+}
+
+func (s *IdentityService) ListFeatureFlags() ([]core.FeatureFlag, error) {
+	return s.repo.ListFeatureFlags()
+}
+
+// SetFeatureOverride switches a flag on or off for an institute whatever the
+// flag's default
+func (s *IdentityService) SetFeatureOverride(instituteID, key string, enabled bool) (*core.InstituteFeatureOverride, error) {
+	institute, err := s.repo.GetInstituteByID(instituteID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetFeatureFlag(key); err != nil {
+		return nil, err
+	}
+	override := &core.InstituteFeatureOverride{
+		InstituteID: institute.ID,
+		Key:         key,
+		Enabled:     enabled,
+	}
+	if err := s.repo.SetFeatureOverride(override); err != nil {
+		return nil, err
+	}
+	s.invalidateFeatureOverrides(institute.ID)
+	return override, nil
+}
+
+// DeleteFeatureOverride puts an institute back on the flag's default
+func (s *IdentityService) DeleteFeatureOverride(instituteID, key string) error {
+	id, err := uuid.Parse(instituteID)
+	if err != nil {
+		return repository.ErrInstituteNotFound
+	}
+	if err := s.repo.DeleteFeatureOverride(id, key); err != nil {
+		return err
+	}
+	s.invalidateFeatureOverrides(id)
+	return nil
+}
+
+// GetInstituteFeatures lists every flag with the institute's override of it
+// and whether it is on for the institute
+func (s *IdentityService) GetInstituteFeatures(ctx context.Context, instituteID string) ([]InstituteFeature, error) {
+	flags, overrides, err := s.instituteFeatures(ctx, instituteID)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]bool, len(overrides))
+	for _, o := range overrides {
+		byKey[o.Key] = o.Enabled
+	}
+	features := make([]InstituteFeature, 0, len(flags))
+	for _, flag := range flags {
+		feature := InstituteFeature{
+			Key:         flag.Key,
+			Description: flag.Description,
+			DefaultOn:   flag.DefaultOn,
+			Enabled:     flag.DefaultOn,
+		}
+		if enabled, ok := byKey[flag.Key]; ok {
+			feature.Override = &enabled
+			feature.Enabled = enabled
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+// GetEffectiveFeatures returns whether each flag is on for the institute.
+// This is what other services gate on, so it is served from the cache when
+// Redis is configured.
+func (s *IdentityService) GetEffectiveFeatures(ctx context.Context, instituteID string) (map[string]bool, error) {
+	flags, overrides, err := s.instituteFeatures(ctx, instituteID)
+	if err != nil {
+		return nil, err
+	}
+	return effectiveFeatures(flags, overrides), nil
+}
+
+// effectiveFeatures gives each flag the institute's override of it, or its
+// default. Overrides of flags that no longer exist are ignored.
+func effectiveFeatures(flags []core.FeatureFlag, overrides []core.InstituteFeatureOverride) map[string]bool {
+	features := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		features[flag.Key] = flag.DefaultOn
+	}
+	for _, o := range overrides {
+		if _, ok := features[o.Key]; ok {
+			features[o.Key] = o.Enabled
+		}
+	}
+	return features
+}
+
+// instituteFeatures loads the flags and the institute's overrides, from the
+// cache when it can. Cache failures are logged and the database read
+// instead.
+func (s *IdentityService) instituteFeatures(ctx context.Context, instituteID string) ([]core.FeatureFlag, []core.InstituteFeatureOverride, error) {
+	id, err := uuid.Parse(instituteID)
+	if err != nil {
+		return nil, nil, repository.ErrInstituteNotFound
+	}
+	flags, err := s.featureFlags(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	overrides, err := s.featureOverrides(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return flags, overrides, nil
+}
+
+func (s *IdentityService) featureFlags(ctx context.Context) ([]core.FeatureFlag, error) {
+	if s.features != nil {
+		flags, err := s.features.GetFlags(ctx)
+		if err != nil {
+			log.Printf("Failed to read cached feature flags: %v", err)
+		} else if flags != nil {
+			return flags, nil
+		}
+	}
+
+	flags, err := s.repo.ListFeatureFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.features != nil {
+		if err := s.features.SetFlags(ctx, flags); err != nil {
+			log.Printf("Failed to cache feature flags: %v", err)
+		}
+	}
+	return flags, nil
+}
+
+// featureOverrides returns the overrides of an institute, which must exist.
+// Only institutes found are cached, so a cached entry also vouches for the
+// institute.
+func (s *IdentityService) featureOverrides(ctx context.Context, instituteID uuid.UUID) ([]core.InstituteFeatureOverride, error) {
+	if s.features != nil {
+		overrides, err := s.features.GetOverrides(ctx, instituteID)
+		if err != nil {
+			log.Printf("Failed to read cached feature overrides of institute %s: %v", instituteID, err)
+		} else if overrides != nil {
+			return overrides, nil
+		}
+	}
+
+	if _, err := s.repo.GetInstituteByID(instituteID.String()); err != nil {
+		return nil, err
+	}
+	overrides, err := s.repo.GetFeatureOverrides(instituteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.features != nil {
+		if err := s.features.SetOverrides(ctx, instituteID, overrides); err != nil {
+			log.Printf("Failed to cache feature overrides of institute %s: %v", instituteID, err)
+		}
+	}
+	return overrides, nil
+}
+
+func (s *IdentityService) invalidateFeatureFlags() {
+	if s.features == nil {
+		return
+	}
+	if err := s.features.InvalidateFlags(context.Background()); err != nil {
+		log.Printf("Failed to invalidate cached feature flags: %v", err)
+	}
+}
+
+func (s *IdentityService) invalidateFeatureOverrides(instituteID uuid.UUID) {
+	if s.features == nil {
+		return
+	}
+	if err := s.features.InvalidateOverrides(context.Background(), instituteID); err != nil {
+		log.Printf("Failed to invalidate cached feature overrides of institute %s: %v", instituteID, err)
+	}
+}
+
+// applyFeatureFlagRequest copies the fields req sets onto flag
+func applyFeatureFlagRequest(flag *core.FeatureFlag, req FeatureFlagRequest) {
+	if req.Description != nil {
+		flag.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.DefaultOn != nil {
+		flag.DefaultOn = *req.DefaultOn
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+func TestEffectiveFeaturesFollowDefaultsAndOverrides(t *testing.T) {
+	ctx := context.Background()
+	svc, db := newTestService(t, &core.FeatureFlag{}, &core.InstituteFeatureOverride{})
+	pilot := createOrgTree(t, db).Institute
+	other := createOrgTree(t, db).Institute
+
+	if _, err := svc.CreateFeatureFlag(FeatureFlagRequest{Key: "group_submissions"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreateFeatureFlag(FeatureFlagRequest{Key: "plagiarism_check", DefaultOn: boolPtr(true)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetFeatureOverride(pilot.ID.String(), "group_submissions", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetFeatureOverride(pilot.ID.String(), "plagiarism_check", false); err != nil {
+		t.Fatal(err)
+	}
+
+	features, err := svc.GetEffectiveFeatures(ctx, pilot.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !features["group_submissions"] || features["plagiarism_check"] {
+		t.Errorf("pilot institute features = %v, want its overrides", features)
+	}
+	features, err = svc.GetEffectiveFeatures(ctx, other.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if features["group_submissions"] || !features["plagiarism_check"] {
+		t.Errorf("other institute features = %v, want the defaults", features)
+	}
+
+	if err := svc.DeleteFeatureOverride(pilot.ID.String(), "plagiarism_check"); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := svc.GetInstituteFeatures(ctx, pilot.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range listed {
+		if f.Key == "plagiarism_check" && (f.Override != nil || !f.Enabled) {
+			t.Errorf("plagiarism_check after removing the override = %+v, want the default", f)
+		}
+		if f.Key == "group_submissions" && (f.Override == nil || !*f.Override) {
+			t.Errorf("group_submissions = %+v, want the override kept", f)
+		}
+	}
+}
+
+func TestFeatureFlagErrors(t *testing.T) {
+	ctx := context.Background()
+	svc, db := newTestService(t, &core.FeatureFlag{}, &core.InstituteFeatureOverride{})
+	institute := createOrgTree(t, db).Institute
+
+	_, err := svc.CreateFeatureFlag(FeatureFlagRequest{Key: "Group Submissions"})
+	if verr := validationErrorOf(t, err); !hasFieldError(verr, "key") {
+		t.Errorf("flag key with spaces and capitals: got %+v, want a key error", verr)
+	}
+	if _, err := svc.CreateFeatureFlag(FeatureFlagRequest{Key: "group_submissions"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.CreateFeatureFlag(FeatureFlagRequest{Key: "group_submissions"})
+	if verr := validationErrorOf(t, err); !verr.Conflict {
+		t.Errorf("duplicate key: got %+v, want a conflict", verr)
+	}
+
+	if _, err := svc.SetFeatureOverride(institute.ID.String(), "no_such_flag", true); !errors.Is(err, repository.ErrFeatureFlagNotFound) {
+		t.Errorf("override of an unknown flag: err = %v", err)
+	}
+	if _, err := svc.GetEffectiveFeatures(ctx, "not-a-uuid"); !errors.Is(err, repository.ErrInstituteNotFound) {
+		t.Errorf("features of a malformed institute ID: err = %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// footerTags are the tags email footers may use; any other tag is dropped
+// and its text kept
+var footerTags = map[string]bool{
+	"a": true, "b": true, "br": true, "em": true, "i": true, "p": true,
+	"small": true, "span": true, "strong": true, "u": true,
+}
+
+// footerDroppedTags are dropped together with their content
+var footerDroppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "noscript": true,
+	"noembed": true, "noframes": true, "textarea": true, "title": true, "xmp": true,
+}
+
+// sanitizeFooterHTML keeps the formatting and links of an email footer and
+// nothing that could run script, restyle the email or load content. Links
+// keep only an http, https or mailto href and a title. Tags left open are
+// closed, so the footer cannot swallow the email after it.
+func sanitizeFooterHTML(footer string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(footer))
+	var out strings.Builder
+	var open []string
+	dropping := ""
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			// The end of the footer, or input the tokenizer gave up on
+			for i := len(open) - 1; i >= 0; i-- {
+				out.WriteString("</" + open[i] + ">")
+			}
+			return out.String()
+		case html.TextToken:
+			if dropping == "" {
+				out.WriteString(html.EscapeString(string(tokenizer.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if dropping != "" {
+				continue
+			}
+			if footerDroppedTags[token.Data] {
+				if token.Type == html.StartTagToken {
+					dropping = token.Data
+				}
+				continue
+			}
+			if !footerTags[token.Data] {
+				continue
+			}
+			out.WriteString("<" + token.Data)
+			if token.Data == "a" {
+				writeLinkAttrs(&out, token.Attr)
+			}
+			out.WriteString(">")
+			if token.Data != "br" && token.Type == html.StartTagToken {
+				open = append(open, token.Data)
+			}
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if dropping != "" {
+				if token.Data == dropping {
+					dropping = ""
+				}
+				continue
+			}
+			// Closes the innermost open tag of that name and any opened
+			// inside it; a stray end tag is dropped
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == token.Data {
+					for j := len(open) - 1; j >= i; j-- {
+						out.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+}
+
+func writeLinkAttrs(out *strings.Builder, attrs []html.Attribute) {
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "href":
+			link, err := url.Parse(strings.TrimSpace(attr.Val))
+			if err != nil {
+				continue
+			}
+			switch strings.ToLower(link.Scheme) {
+			case "http", "https", "mailto":
+				out.WriteString(` href="` + html.EscapeString(link.String()) + `"`)
+			}
+		case "title":
+			out.WriteString(` title="` + html.EscapeString(attr.Val) + `"`)
+		}
+	}
+}
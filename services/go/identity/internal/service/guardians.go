@@ -0,0 +1,234 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"slices"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// guardianInvitationTemplate is the email service template guardians get
+// when they are linked to a student
+const guardianInvitationTemplate = "guardian_invitation"
+
+var (
+	ErrNotStudentAdmin  = errors.New("only an admin of the student's institute can do this")
+	ErrNotGuardianParty = errors.New("only the student or an admin of their institute can do this")
+)
+
+// CreateGuardianLinkRequest links a guardian, by email, to a student. A
+// guardian without an account gets a pending one named FullName.
+type CreateGuardianLinkRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	FullName string `json:"full_name" validate:"required"`
+}
+
+// CreateGuardianLink links a guardian to a student on behalf of callerID,
+// who must be an admin of the student's institute or a system admin. The
+// guardian is invited by email; the link stays invited until they confirm
+// their email, and is active at once if they already have.
+func (s *IdentityService) CreateGuardianLink(callerID, studentID string, req CreateGuardianLinkRequest) (*core.GuardianLink, error) {
+	student, err := s.repo.GetUserByID(studentID)
+	if err != nil {
+		return nil, err
+	}
+	if student.UserType != core.UserTypeStudent {
+		verr := &ValidationError{}
+		verr.add("id", "must be a student")
+		return nil, verr
+	}
+	caller, err := s.studentAdmin(callerID, student)
+	if err != nil {
+		return nil, err
+	}
+
+	email := normalizeEmail(req.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		verr := &ValidationError{}
+		verr.add("email", "must be an email address")
+		return nil, verr
+	}
+	guardian, err := s.guardianAccount(email, strings.TrimSpace(req.FullName))
+	if err != nil {
+		return nil, err
+	}
+
+	link := &core.GuardianLink{
+		GuardianUserID: guardian.ID,
+		StudentUserID:  student.ID,
+		Status:         core.GuardianLinkInvited,
+		CreatedBy:      caller,
+	}
+	if guardian.EmailVerified && guardian.Status == "active" {
+		link.Status = core.GuardianLinkActive
+	}
+	if err := s.repo.CreateGuardianLink(link); err != nil {
+		return nil, err
+	}
+	link.Guardian = guardian
+	s.recordActivity("guardian_link.create", "guardian_link", link.ID.String(), nil, link)
+	s.sendGuardianInvitation(guardian, student)
+	return link, nil
+}
+
+// GetStudentGuardianLinks lists the student's guardian links, revoked ones
+// included, for the student or an admin of their institute
+func (s *IdentityService) GetStudentGuardianLinks(callerID, studentID string) ([]core.GuardianLink, error) {
+	student, err := s.repo.GetUserByID(studentID)
+	if err != nil {
+		return nil, err
+	}
+	if callerID != student.ID.String() {
+		if _, err := s.studentAdmin(callerID, student); err != nil {
+			return nil, ErrNotGuardianParty
+		}
+	}
+	return s.repo.GetStudentGuardianLinks(student.ID)
+}
+
+// RevokeGuardianLink revokes a link on behalf of its student or an admin of
+// their institute. The guardian loses access to the student's data as soon
+// as it returns.
+func (s *IdentityService) RevokeGuardianLink(callerID, linkID string) (*core.GuardianLink, error) {
+	id, err := uuid.Parse(linkID)
+	if err != nil {
+		return nil, repository.ErrGuardianLinkNotFound
+	}
+	before, err := s.repo.GetGuardianLink(id)
+	if err != nil {
+		return nil, err
+	}
+	if callerID != before.StudentUserID.String() {
+		student, err := s.repo.GetUserByID(before.StudentUserID.String())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.studentAdmin(callerID, student); err != nil {
+			return nil, ErrNotGuardianParty
+		}
+	}
+	revokedBy, _ := uuid.Parse(callerID)
+
+	link, err := s.repo.RevokeGuardianLink(id, revokedBy)
+	if err != nil {
+		return nil, err
+	}
+	if before.Status != core.GuardianLinkRevoked {
+		s.recordActivity("guardian_link.revoke", "guardian_link", linkID, before, link)
+	}
+	return link, nil
+}
+
+// GetGuardianStudents returns the students the guardian may currently see,
+// those of their active links. It is what other services check a guardian's
+// access against, so it is never cached.
+func (s *IdentityService) GetGuardianStudents(guardianID string) ([]core.User, error) {
+	guardian, err := s.repo.GetUserByID(guardianID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetGuardianStudents(guardian.ID)
+}
+
+// studentAdmin returns the caller's ID if they are an admin of the student's
+// institute or a system admin, and ErrNotStudentAdmin otherwise
+func (s *IdentityService) studentAdmin(callerID string, student *core.User) (uuid.UUID, error) {
+	caller, err := s.repo.GetUserByID(callerID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return uuid.Nil, ErrNotStudentAdmin
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if caller.UserType == core.UserTypeSystemAdmin {
+		return caller.ID, nil
+	}
+	if caller.UserType != core.UserTypeInstituteAdmin || student.StudentProfile == nil || student.StudentProfile.InstituteID == nil {
+		return uuid.Nil, ErrNotStudentAdmin
+	}
+	bindings, err := s.repo.GetInstituteBindings(callerID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	instituteID := *student.StudentProfile.InstituteID
+	if !slices.ContainsFunc(bindings, func(b core.InstituteAdminProfile) bool { return b.InstituteID == instituteID }) {
+		return uuid.Nil, ErrNotStudentAdmin
+	}
+	return caller.ID, nil
+}
+
+// guardianAccount returns the guardian holding email, creating a pending
+// account named name if there is none. An account of another type cannot be
+// a guardian's.
+func (s *IdentityService) guardianAccount(email, name string) (*core.User, error) {
+	guardian, err := s.repo.GetUserByEmail(email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		guardian, err = s.RegisterUser(CreateUserRequest{
+			FullName: name,
+			Email:    email,
+			UserType: core.UserTypeGuardian,
+			Status:   "pending",
+		})
+		if errors.Is(err, repository.ErrEmailTaken) {
+			// Created by a concurrent request since the lookup
+			guardian, err = s.repo.GetUserByEmail(email)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if guardian.UserType != core.UserTypeGuardian {
+		verr := &ValidationError{Conflict: true}
+		verr.add("email", fmt.Sprintf("belongs to a user of type %s; only guardians can be linked to a student", guardian.UserType))
+		return nil, verr
+	}
+	return guardian, nil
+}
+
+// activateGuardianLinks makes a guardian's invited links active once they
+// confirm their email. A failure is logged; the links stay invited and are
+// activated the next time the email is confirmed.
+func (s *IdentityService) activateGuardianLinks(guardian *core.User) {
+	if _, err := s.repo.ActivateGuardianLinks(guardian.ID); err != nil {
+		log.Printf("Guardian links of %s not activated: %v", guardian.ID, err)
+	}
+}
+
+// sendGuardianInvitation emails the guardian that they were linked to the
+// student. A failure is logged; the link stands either way.
+func (s *IdentityService) sendGuardianInvitation(guardian, student *core.User) {
+	payload := map[string]interface{}{
+		"template_name": guardianInvitationTemplate,
+		"recipients": []map[string]interface{}{{
+			"email":  guardian.Email,
+			"locale": userLocale(guardian),
+			"data":   map[string]string{"guardian_name": guardian.FullName},
+		}},
+		"data": map[string]string{
+			"student_name": student.FullName,
+			"login_url":    fmt.Sprintf("%s/login", s.cfg.WebURL),
+		},
+	}
+	if profile := student.StudentProfile; profile != nil && profile.InstituteID != nil {
+		if institute, err := s.repo.GetInstituteByID(profile.InstituteID.String()); err == nil {
+			payload["default_locale"] = institute.DefaultLocale
+			payload["institute_id"] = institute.ID.String() // for the institute's branding
+			payload["data"].(map[string]string)["institute_name"] = institute.Name
+		}
+	}
+
+	failed, err := s.sendTemplateEmails(payload)
+	if err != nil {
+		log.Printf("Guardian %s of student %s: invitation not emailed: %v", guardian.ID, student.ID, err)
+		return
+	}
+	if len(failed) > 0 {
+		log.Printf("Guardian %s of student %s: invitation not emailed to %s", guardian.ID, student.ID, strings.Join(failed, ", "))
+	}
+}
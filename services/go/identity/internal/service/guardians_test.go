@@ -0,0 +1,162 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createInstituteAdmin stores an admin of the institute
+func createInstituteAdmin(t *testing.T, db *gorm.DB, instituteID uuid.UUID) *core.User {
+	t.Helper()
+	admin := createUser(t, db, core.UserTypeInstituteAdmin)
+	if err := db.Create(&core.InstituteAdminProfile{UserID: admin.ID, InstituteID: instituteID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return admin
+}
+
+// guardianStudents returns the IDs of the students the guardian may see
+func guardianStudents(t *testing.T, svc *IdentityService, guardianID uuid.UUID) []uuid.UUID {
+	t.Helper()
+	students, err := svc.GetGuardianStudents(guardianID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]uuid.UUID, len(students))
+	for i, s := range students {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+func TestGuardianLinkLifecycle(t *testing.T) {
+	svc, db := newTestService(t, &core.GuardianLink{}, &core.ActivityEntry{})
+	tree := createOrgTree(t, db)
+	admin := createInstituteAdmin(t, db, tree.Institute.ID)
+	students := createInstituteStudents(t, db, tree.Institute.ID, 2, time.Now().UTC())
+	student, sibling := students[0], students[1]
+
+	var invited []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			TemplateName string `json:"template_name"`
+			Recipients   []struct {
+				Email string `json:"email"`
+			} `json:"recipients"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		results := []map[string]string{}
+		for _, rcpt := range payload.Recipients {
+			invited = append(invited, payload.TemplateName+" "+rcpt.Email)
+			results = append(results, map[string]string{"recipient": rcpt.Email, "status": "queued"})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	t.Cleanup(server.Close)
+	svc.cfg.EmailServiceURL = server.URL
+
+	// A new guardian gets a pending account and an invitation; the link
+	// grants nothing until they confirm their email
+	link, err := svc.CreateGuardianLink(admin.ID.String(), student.ID.String(), CreateGuardianLinkRequest{Email: " Parent@Example.com", FullName: "Pat Parent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardian := link.Guardian
+	if link.Status != core.GuardianLinkInvited || guardian.UserType != core.UserTypeGuardian || guardian.Status != "pending" {
+		t.Fatalf("link %s to %s %s guardian, want an invited link to a pending GUARDIAN", link.Status, guardian.Status, guardian.UserType)
+	}
+	if len(invited) != 1 || invited[0] != guardianInvitationTemplate+" parent@example.com" {
+		t.Errorf("emails sent = %v, want one invitation to parent@example.com", invited)
+	}
+	if got := guardianStudents(t, svc, guardian.ID); len(got) != 0 {
+		t.Errorf("guardian of an invited link sees %v", got)
+	}
+
+	if err := svc.ConfirmUserEmail(guardian.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if got := guardianStudents(t, svc, guardian.ID); len(got) != 1 || got[0] != student.ID {
+		t.Fatalf("guardian sees %v after confirming, want the student", got)
+	}
+
+	// A confirmed guardian's next link is active at once
+	siblingLink, err := svc.CreateGuardianLink(admin.ID.String(), sibling.ID.String(), CreateGuardianLinkRequest{Email: "parent@example.com", FullName: "Pat Parent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if siblingLink.Status != core.GuardianLinkActive || siblingLink.GuardianUserID != guardian.ID {
+		t.Errorf("second link is %s to %s, want active to the same guardian", siblingLink.Status, siblingLink.GuardianUserID)
+	}
+
+	// The student revokes their link, and the guardian loses them at once
+	revoked, err := svc.RevokeGuardianLink(student.ID.String(), link.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.Status != core.GuardianLinkRevoked || revoked.RevokedBy == nil || *revoked.RevokedBy != student.ID || revoked.RevokedAt == nil {
+		t.Errorf("revoked link = %+v", revoked)
+	}
+	if got := guardianStudents(t, svc, guardian.ID); len(got) != 1 || got[0] != sibling.ID {
+		t.Errorf("guardian sees %v after the revocation, want only the sibling", got)
+	}
+	again, err := svc.RevokeGuardianLink(admin.ID.String(), link.ID.String())
+	if err != nil || !again.RevokedAt.Equal(*revoked.RevokedAt) || *again.RevokedBy != student.ID {
+		t.Errorf("revoking twice = %+v, %v; want the link unchanged", again, err)
+	}
+
+	links, err := svc.GetStudentGuardianLinks(student.ID.String(), student.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Status != core.GuardianLinkRevoked || links[0].Guardian == nil {
+		t.Errorf("student's links = %+v, want the revoked one with its guardian", links)
+	}
+}
+
+func TestGuardianLinksAreForTheStudentsInstitute(t *testing.T) {
+	svc, db := newTestService(t, &core.GuardianLink{}, &core.ActivityEntry{})
+	tree := createOrgTree(t, db)
+	other := createOrgTree(t, db)
+	admin := createInstituteAdmin(t, db, tree.Institute.ID)
+	students := createInstituteStudents(t, db, tree.Institute.ID, 2, time.Now().UTC())
+	student, classmate := students[0], students[1]
+	req := CreateGuardianLinkRequest{Email: "parent@example.com", FullName: "Pat Parent"}
+
+	for name, caller := range map[string]*core.User{
+		"admin of another institute": createInstituteAdmin(t, db, other.Institute.ID),
+		"instructor":                 createUser(t, db, core.UserTypeInstructor),
+		"the student":                &student,
+	} {
+		if _, err := svc.CreateGuardianLink(caller.ID.String(), student.ID.String(), req); !errors.Is(err, ErrNotStudentAdmin) {
+			t.Errorf("link created by %s: got %v, want ErrNotStudentAdmin", name, err)
+		}
+	}
+
+	instructor := createUser(t, db, core.UserTypeInstructor)
+	_, err := svc.CreateGuardianLink(admin.ID.String(), student.ID.String(), CreateGuardianLinkRequest{Email: instructor.Email, FullName: "Someone"})
+	if verr := validationErrorOf(t, err); !verr.Conflict || !hasFieldError(verr, "email") {
+		t.Errorf("linking an instructor's email: got %v, want an email conflict", verr)
+	}
+
+	link, err := svc.CreateGuardianLink(admin.ID.String(), student.ID.String(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RevokeGuardianLink(classmate.ID.String(), link.ID.String()); !errors.Is(err, ErrNotGuardianParty) {
+		t.Errorf("another student revoking: got %v, want ErrNotGuardianParty", err)
+	}
+	if _, err := svc.RevokeGuardianLink(link.GuardianUserID.String(), link.ID.String()); !errors.Is(err, ErrNotGuardianParty) {
+		t.Errorf("the guardian revoking: got %v, want ErrNotGuardianParty", err)
+	}
+	if _, err := svc.GetStudentGuardianLinks(classmate.ID.String(), student.ID.String()); !errors.Is(err, ErrNotGuardianParty) {
+		t.Errorf("another student listing the links: got %v, want ErrNotGuardianParty", err)
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService returns an IdentityService over an in-memory SQLite
+// database holding the user and org tables, plus any extra models a test
+// needs. The one connection keeps the database shared and serialises
+// writes, standing in for Postgres' row locks.
+func newTestService(t *testing.T, models ...interface{}) (*IdentityService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	tables := []interface{}{
+		&core.User{},
+		&core.StudentProfile{},
+		&core.InstructorProfile{},
+		&core.InstituteAdminProfile{},
+		&core.Institute{},
+		&core.Faculty{},
+		&core.Department{},
+		&core.Class{},
+		&core.ClassSection{},
+		&core.ClassEnrollment{},
+		&core.ClassWaitlistEntry{},
+		&core.OutboxEvent{},
+	}
+	if err := db.AutoMigrate(append(tables, models...)...); err != nil {
+		t.Fatal(err)
+	}
+	return NewIdentityService(repository.NewRepository(db), &config.Config{InternalToken: "test"}), db
+}
+
+// createUser stores an active user of the given type
+func createUser(t *testing.T, db *gorm.DB, userType core.UserType) *core.User {
+	t.Helper()
+	id := uuid.New()
+	user := &core.User{
+		ID:       id,
+		Email:    id.String() + "@example.com",
+		FullName: "User " + id.String()[:8],
+		UserType: userType,
+		Status:   "active",
+		IsActive: true,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// orgTree is an institute with one faculty, department and class
+type orgTree struct {
+	Institute  *core.Institute
+	Faculty    *core.Faculty
+	Department *core.Department
+	Class      *core.Class
+}
+
+// createOrgTree stores an institute with one faculty, department and class
+// under it
+func createOrgTree(t *testing.T, db *gorm.DB) *orgTree {
+	t.Helper()
+	code := strings.ToUpper(uuid.NewString()[:8])
+	tree := &orgTree{
+		Institute: &core.Institute{Name: "Institute " + code, Code: code, Domain: strings.ToLower(code) + ".example.edu", ContactEmail: "admin@" + strings.ToLower(code) + ".example.edu", IsActive: true},
+	}
+	if err := db.Create(tree.Institute).Error; err != nil {
+		t.Fatal(err)
+	}
+	tree.Faculty = &core.Faculty{InstituteID: tree.Institute.ID, Name: "Science"}
+	if err := db.Create(tree.Faculty).Error; err != nil {
+		t.Fatal(err)
+	}
+	tree.Department = &core.Department{FacultyID: tree.Faculty.ID, Name: "Physics"}
+	if err := db.Create(tree.Department).Error; err != nil {
+		t.Fatal(err)
+	}
+	tree.Class = &core.Class{DepartmentID: tree.Department.ID, Name: "PHY101"}
+	if err := repository.NewRepository(db).CreateClass(tree.Class); err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+func TestInstituteKeepsAnOwner(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	other := createOrgTree(t, db)
+	first := createUser(t, db, core.UserTypeInstituteAdmin)
+	second := createUser(t, db, core.UserTypeInstituteAdmin)
+	repo := repository.NewRepository(db)
+	institute := tree.Institute.ID.String()
+
+	// The first admin becomes the owner even when added as an admin
+	for _, u := range []*core.User{first, second} {
+		if err := repo.AddInstituteAdmin(institute, u.ID.String(), core.InstituteRoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.AddInstituteAdmin(other.Institute.ID.String(), second.ID.String(), core.InstituteRoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	bindings, err := svc.GetInstituteBindings(second.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bindings) != 2 {
+		t.Fatalf("second admin has %d institutes, want 2", len(bindings))
+	}
+
+	if _, err := svc.UpdateInstituteAdminRole(institute, first.ID.String(), "admin"); !errors.Is(err, repository.ErrLastInstituteOwner) {
+		t.Errorf("demoting the only owner: got %v, want ErrLastInstituteOwner", err)
+	}
+	if err := svc.RemoveInstituteAdmin(institute, first.ID.String()); !errors.Is(err, repository.ErrLastInstituteOwner) {
+		t.Errorf("removing the only owner: got %v, want ErrLastInstituteOwner", err)
+	}
+
+	// With a second owner the first can step down
+	if _, err := svc.UpdateInstituteAdminRole(institute, second.ID.String(), "OWNER"); err != nil {
+		t.Fatal(err)
+	}
+	if binding, err := svc.UpdateInstituteAdminRole(institute, first.ID.String(), "ADMIN"); err != nil || binding.Role != core.InstituteRoleAdmin {
+		t.Fatalf("demoting one of two owners = %+v, %v", binding, err)
+	}
+
+	_, err = svc.UpdateInstituteAdminRole(institute, first.ID.String(), "superuser")
+	if verr := validationErrorOf(t, err); !hasFieldError(verr, "role") {
+		t.Errorf("unknown role: got %v, want a role error", verr)
+	}
+}
+
+func TestCreateInstituteWithNewAndExistingAdmins(t *testing.T) {
+	svc, db := newTestService(t)
+	existing := createUser(t, db, core.UserTypeInstituteAdmin)
+
+	inst, err := svc.CreateInstitute(CreateInstituteRequest{
+		Name: "Uni", Code: "UNI", Domain: "uni.example.edu", ContactEmail: "admin@uni.example.edu",
+		Admins: []CreateInstituteAdminRequest{
+			{Name: "Ada", Email: "Ada@Uni.example.edu"},
+			{Name: existing.FullName, Email: existing.Email},
+		},
+	})
+	if err != nil {
+		t.Fatalf("creating with a new and an existing admin: %v", err)
+	}
+
+	var admins []core.InstituteAdminProfile
+	if err := db.Where("institute_id = ?", inst.ID).Find(&admins).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(admins) != 2 {
+		t.Fatalf("institute has %d admins, want 2", len(admins))
+	}
+	var created core.User
+	if err := db.Where("email = ?", "ada@uni.example.edu").First(&created).Error; err != nil {
+		t.Fatalf("new admin was not created: %v", err)
+	}
+	var users int64
+	if err := db.Model(&core.User{}).Where("lower(email) = ?", existing.Email).Count(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 {
+		t.Errorf("%d users with the existing admin's email, want 1", users)
+	}
+}
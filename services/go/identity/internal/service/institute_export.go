@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+// exportBatchSize is how many users an export reads from the database at a
+// time, and so about how many it holds in memory
+const exportBatchSize = 500
+
+// ExportInstituteUsers calls send with each of the institute's users of
+// userType, or of every type if it is empty, changed at or after
+// modifiedSince if that is set, in order of last change. It stops at the
+// first error send returns or once ctx is done, and returns how many users
+// were sent either way.
+func (s *IdentityService) ExportInstituteUsers(ctx context.Context, instituteID, userType string, modifiedSince *time.Time, send func(*repository.ExportedUser) error) (int, error) {
+	id, err := parseID("institute_id", instituteID)
+	if err != nil {
+		return 0, err
+	}
+	switch core.UserType(userType) {
+	case "", core.UserTypeStudent, core.UserTypeInstructor, core.UserTypeInstituteAdmin:
+	default:
+		verr := &ValidationError{}
+		verr.add("user_type", "must be STUDENT, INSTRUCTOR or INSTITUTE_ADMIN")
+		return 0, verr
+	}
+	if _, err := s.repo.GetInstituteByID(instituteID); err != nil {
+		return 0, err
+	}
+
+	filter := repository.UserExportFilter{InstituteID: id, UserType: core.UserType(userType), ModifiedSince: modifiedSince}
+	var after *repository.UserExportCursor
+	sent := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		batch, err := s.repo.ExportUsersBatch(ctx, filter, after, exportBatchSize)
+		if err != nil {
+			return sent, err
+		}
+		for i := range batch {
+			if err := send(&batch[i]); err != nil {
+				return sent, err
+			}
+			sent++
+		}
+		if len(batch) < exportBatchSize {
+			return sent, nil
+		}
+		last := batch[len(batch)-1]
+		after = &repository.UserExportCursor{UpdatedAt: last.UpdatedAt, ID: last.ID}
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createInstituteStudents stores n students of the institute, all last
+// updated at updatedAt
+func createInstituteStudents(t *testing.T, db *gorm.DB, instituteID uuid.UUID, n int, updatedAt time.Time) []core.User {
+	t.Helper()
+	students := make([]core.User, n)
+	for i := range students {
+		id := uuid.New()
+		students[i] = core.User{
+			ID:             id,
+			Email:          id.String() + "@example.com",
+			FullName:       "Student " + id.String()[:8],
+			UserType:       core.UserTypeStudent,
+			Status:         "active",
+			IsActive:       true,
+			UpdatedAt:      updatedAt,
+			StudentProfile: &core.StudentProfile{UserID: id, InstituteID: &instituteID, EnrollmentNumber: "S-" + id.String()},
+		}
+	}
+	if err := db.CreateInBatches(students, 200).Error; err != nil {
+		t.Fatal(err)
+	}
+	return students
+}
+
+// exportAll exports the institute's users, returning them in the order sent
+func exportAll(t *testing.T, svc *IdentityService, instituteID, userType string, modifiedSince *time.Time) []repository.ExportedUser {
+	t.Helper()
+	var exported []repository.ExportedUser
+	sent, err := svc.ExportInstituteUsers(context.Background(), instituteID, userType, modifiedSince, func(u *repository.ExportedUser) error {
+		exported = append(exported, *u)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != len(exported) {
+		t.Errorf("export reported %d sent, sent %d", sent, len(exported))
+	}
+	return exported
+}
+
+func TestExportCoversEveryUserOnceInOrder(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	other := createOrgTree(t, db)
+	// More than two batches, all updated at once, so batches only move on
+	// through the ID tiebreak
+	students := createInstituteStudents(t, db, tree.Institute.ID, 2*exportBatchSize+100, time.Now().Add(-time.Hour).UTC())
+	createInstituteStudents(t, db, other.Institute.ID, 10, time.Now().UTC())
+	enrolled := students[0].ID.String()
+	if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", enrolled, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := exportAll(t, svc, tree.Institute.ID.String(), "", nil)
+	if len(exported) != len(students) {
+		t.Fatalf("exported %d users, want the institute's %d", len(exported), len(students))
+	}
+	seen := make(map[uuid.UUID]bool, len(exported))
+	for i, u := range exported {
+		if seen[u.ID] {
+			t.Fatalf("%s was exported twice", u.ID)
+		}
+		seen[u.ID] = true
+		if u.StudentProfile == nil || *u.StudentProfile.InstituteID != tree.Institute.ID {
+			t.Fatalf("%s was exported without their profile", u.ID)
+		}
+		if i > 0 {
+			prev := exported[i-1]
+			if u.UpdatedAt.Before(prev.UpdatedAt) || (u.UpdatedAt.Equal(prev.UpdatedAt) && strings.Compare(u.ID.String(), prev.ID.String()) < 0) {
+				t.Fatalf("record %d (%s, %s) is out of order after (%s, %s)", i, u.UpdatedAt, u.ID, prev.UpdatedAt, prev.ID)
+			}
+		}
+		if u.ID.String() == enrolled {
+			if len(u.Enrollments) != 1 || u.Enrollments[0].ClassID != tree.Class.ID || u.Enrollments[0].Status != core.EnrollmentEnrolled {
+				t.Errorf("enrolled student's enrollments = %+v", u.Enrollments)
+			}
+		} else if len(u.Enrollments) != 0 {
+			t.Errorf("%s has enrollments %+v", u.ID, u.Enrollments)
+		}
+	}
+}
+
+func TestExportModifiedSince(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	since := time.Now().Add(-time.Hour).UTC()
+	createInstituteStudents(t, db, tree.Institute.ID, 3, since.Add(-time.Minute))
+	changed := createInstituteStudents(t, db, tree.Institute.ID, 2, since.Add(time.Minute))
+	atSince := createInstituteStudents(t, db, tree.Institute.ID, 1, since)
+	instructor := createUser(t, db, core.UserTypeInstructor)
+	if err := db.Model(&core.Faculty{}).Where("id = ?", tree.Faculty.ID).Update("head_user_id", instructor.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	exported := exportAll(t, svc, tree.Institute.ID.String(), string(core.UserTypeStudent), &since)
+	want := map[uuid.UUID]bool{changed[0].ID: true, changed[1].ID: true, atSince[0].ID: true}
+	if len(exported) != len(want) {
+		t.Fatalf("exported %d students changed since, want %d", len(exported), len(want))
+	}
+	for _, u := range exported {
+		if !want[u.ID] {
+			t.Errorf("exported %s, last updated %s, before %s", u.ID, u.UpdatedAt, since)
+		}
+	}
+
+	// The instructor changed after since too, and only shows up without the
+	// type filter
+	if got := exportAll(t, svc, tree.Institute.ID.String(), "", &since); len(got) != len(want)+1 {
+		t.Errorf("exported %d users changed since, want %d", len(got), len(want)+1)
+	}
+}
+
+func TestExportStopsReadingWhenCancelled(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	createInstituteStudents(t, db, tree.Institute.ID, 2*exportBatchSize+100, time.Now().UTC())
+	batches := 0
+	err := db.Callback().Query().Before("gorm:query").Register("test:count_batches", func(tx *gorm.DB) {
+		if tx.Statement.Table == "users" {
+			batches++
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sent, err := svc.ExportInstituteUsers(ctx, tree.Institute.ID.String(), "", nil, func(*repository.ExportedUser) error {
+		cancel() // the client goes away during the first batch
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("export = %v, want context.Canceled", err)
+	}
+	if batches != 1 || sent != exportBatchSize {
+		t.Errorf("read %d batches and sent %d users after the cancel, want only the batch under way", batches, sent)
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// What creating an institute does with each admin listed
+const (
+	// AdminInvite is for an email without an account, which is created
+	// pending and invited
+	AdminInvite = "invite"
+	// AdminAdd is for an existing institute admin, who is made an owner of
+	// the new institute too
+	AdminAdd = "add"
+	// AdminReject is for an email that cannot be made an admin, such as one
+	// of a student's account
+	AdminReject = "reject"
+)
+
+// InstituteValidation reports what creating an institute from a request
+// would do, without doing it. Creating fails with the Invalid fields if
+// there are any, as a ValidationError, or else with the Conflicts, as a
+// conflicting one; Warnings never stop it.
+type InstituteValidation struct {
+	Valid     bool              `json:"valid"`
+	Invalid   []FieldError      `json:"invalid"`
+	Conflicts []FieldError      `json:"conflicts"`
+	Warnings  []FieldError      `json:"warnings"`
+	Admins    []AdminValidation `json:"admins"`
+}
+
+// AdminValidation is what would happen to one of the admins listed
+type AdminValidation struct {
+	Email   string `json:"email"`
+	Outcome string `json:"outcome"`
+	// UserID and UserType are those of the account already holding the email
+	UserID   *uuid.UUID    `json:"user_id,omitempty"`
+	UserType core.UserType `json:"user_type,omitempty"`
+	// InstitutesAdministered counts the institutes the account already
+	// administers
+	InstitutesAdministered int `json:"institutes_administered"`
+}
+
+// ValidateInstitute checks a request to create an institute as
+// CreateInstitute does and reports every problem at once
+func (s *IdentityService) ValidateInstitute(req CreateInstituteRequest) (*InstituteValidation, error) {
+	return s.validateCreateInstitute(&req)
+}
+
+// err is the error CreateInstitute fails with, nil if it would succeed
+func (v *InstituteValidation) err() error {
+	if len(v.Invalid) > 0 {
+		return &ValidationError{Errors: v.Invalid}
+	}
+	if len(v.Conflicts) > 0 {
+		return &ValidationError{Errors: v.Conflicts, Conflict: true}
+	}
+	return nil
+}
+
+// validateCreateInstitute normalizes the request in place and checks it:
+// the code and domain, their uniqueness, and each admin's email and the
+// account that holds it. It is the only validation CreateInstitute does, so
+// ValidateInstitute reports exactly what creating would.
+func (s *IdentityService) validateCreateInstitute(req *CreateInstituteRequest) (*InstituteValidation, error) {
+	req.Domain = normalizeDomain(req.Domain)
+
+	invalid := &ValidationError{}
+	s.checkInstituteCodeFormat(req.Code, invalid)
+	s.checkInstituteDomainFormat(req.Domain, invalid)
+	conflict := &ValidationError{Conflict: true}
+	if err := s.checkInstituteCodeUnique(req.Code, "", conflict); err != nil {
+		return nil, err
+	}
+	if err := s.checkInstituteDomainUnique(req.Domain, "", conflict); err != nil {
+		return nil, err
+	}
+	warnings := &ValidationError{}
+
+	admins := make([]AdminValidation, len(req.Admins))
+	seen := make(map[string]bool, len(req.Admins))
+	for i := range req.Admins {
+		field := fmt.Sprintf("admins[%d].email", i)
+		email := normalizeEmail(req.Admins[i].Email)
+		req.Admins[i].Email = email
+		admins[i] = AdminValidation{Email: email, Outcome: AdminInvite}
+
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			invalid.add(field, "must be an email address")
+			admins[i].Outcome = AdminReject
+			continue
+		}
+		if seen[email] {
+			invalid.add(field, "is listed more than once")
+			admins[i].Outcome = AdminReject
+			continue
+		}
+		seen[email] = true
+		if !strings.HasSuffix(email, "@"+req.Domain) {
+			warnings.add(field, "is not at the institute's domain")
+		}
+
+		if err := s.checkInstituteAdminAccount(&admins[i], field, conflict, warnings); err != nil {
+			return nil, err
+		}
+	}
+
+	v := &InstituteValidation{
+		Invalid:   invalid.Errors,
+		Conflicts: conflict.Errors,
+		Warnings:  warnings.Errors,
+		Admins:    admins,
+	}
+	for _, list := range []*[]FieldError{&v.Invalid, &v.Conflicts, &v.Warnings} {
+		if *list == nil {
+			*list = []FieldError{}
+		}
+	}
+	v.Valid = v.err() == nil
+	return v, nil
+}
+
+// checkInstituteAdminAccount looks up the account already holding the
+// admin's email, or else a deleted one still holding it. Only an institute
+// admin's can be made an owner of another institute.
+func (s *IdentityService) checkInstituteAdminAccount(admin *AdminValidation, field string, conflict, warnings *ValidationError) error {
+	user, err := s.repo.GetUserByEmail(admin.Email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		user, err = s.repo.IncludingDeleted().GetUserByEmail(admin.Email)
+	}
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	admin.UserID = &user.ID
+	admin.UserType = user.UserType
+
+	switch {
+	case user.DeletedAt.Valid:
+		conflict.add(field, "belongs to a deleted account")
+		admin.Outcome = AdminReject
+		return nil
+	case user.UserType != core.UserTypeInstituteAdmin:
+		conflict.add(field, fmt.Sprintf("belongs to a user of type %s; only institute admins can administer an institute", user.UserType))
+		admin.Outcome = AdminReject
+		return nil
+	}
+
+	admin.Outcome = AdminAdd
+	bindings, err := s.repo.GetInstituteBindings(user.ID.String())
+	if err != nil {
+		return err
+	}
+	admin.InstitutesAdministered = len(bindings)
+	if n := len(bindings); n > 0 {
+		warnings.add(field, fmt.Sprintf("already administers %d other institute(s)", n))
+	}
+	if user.Status == "disabled" {
+		warnings.add(field, "belongs to a deactivated account, which stays deactivated")
+	}
+	return nil
+}
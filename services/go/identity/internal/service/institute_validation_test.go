@@ -0,0 +1,125 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// countInstitutes returns how many institutes are stored
+func countInstitutes(t *testing.T, svc *IdentityService) int {
+	t.Helper()
+	institutes, err := svc.GetInstitutes("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(institutes)
+}
+
+func TestInstituteValidationFailsAsCreationDoes(t *testing.T) {
+	svc, db := newTestService(t)
+	_, err := svc.CreateInstitute(CreateInstituteRequest{
+		Name: "Uni", Code: "UNI", Domain: "uni.example.edu", ContactEmail: "admin@uni.example.edu",
+		Admins: []CreateInstituteAdminRequest{{Name: "Owner", Email: "owner@uni.example.edu"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	student := createUser(t, db, core.UserTypeStudent)
+	deleted := createUser(t, db, core.UserTypeInstituteAdmin)
+	if err := db.Delete(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(code, domain string, adminEmails ...string) CreateInstituteRequest {
+		req := CreateInstituteRequest{Name: "New", Code: code, Domain: domain, ContactEmail: "admin@" + domain}
+		for _, email := range adminEmails {
+			req.Admins = append(req.Admins, CreateInstituteAdminRequest{Name: "Admin", Email: email})
+		}
+		return req
+	}
+	for _, tc := range []struct {
+		name     string
+		req      CreateInstituteRequest
+		conflict bool
+		field    string
+	}{
+		{"bad code", request("new", "new.example.edu"), false, "code"},
+		{"bad domain", request("NEW", "new..edu"), false, "domain"},
+		{"bad admin email", request("NEW", "new.example.edu", "not an email"), false, "admins[0].email"},
+		{"admin listed twice", request("NEW", "new.example.edu", "a@new.example.edu", "A@new.example.edu"), false, "admins[1].email"},
+		{"code taken", request("UNI", "new.example.edu"), true, "code"},
+		{"domain taken", request("NEW", "UNI.example.edu"), true, "domain"},
+		{"student as admin", request("NEW", "new.example.edu", student.Email), true, "admins[0].email"},
+		{"deleted account as admin", request("NEW", "new.example.edu", deleted.Email), true, "admins[0].email"},
+	} {
+		before := countInstitutes(t, svc)
+		validation, err := svc.ValidateInstitute(tc.req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if validation.Valid {
+			t.Errorf("%s: validation passed", tc.name)
+			continue
+		}
+		reported := validation.Invalid
+		if tc.conflict {
+			reported = validation.Conflicts
+		}
+		if len(reported) != 1 || reported[0].Field != tc.field {
+			t.Errorf("%s: validation reported %+v, want a problem with %s", tc.name, validation, tc.field)
+		}
+
+		_, err = svc.CreateInstitute(tc.req)
+		verr := validationErrorOf(t, err)
+		if verr.Conflict != tc.conflict || !reflect.DeepEqual(verr.Errors, reported) {
+			t.Errorf("%s: creating failed with %+v (conflict %v), validation reported %+v", tc.name, verr.Errors, verr.Conflict, reported)
+		}
+		if after := countInstitutes(t, svc); after != before {
+			t.Errorf("%s: %d institutes created", tc.name, after-before)
+		}
+	}
+}
+
+func TestInstituteValidationWarnsWithoutFailing(t *testing.T) {
+	svc, _ := newTestService(t)
+	_, err := svc.CreateInstitute(CreateInstituteRequest{
+		Name: "Uni", Code: "UNI", Domain: "uni.example.edu", ContactEmail: "admin@uni.example.edu",
+		Admins: []CreateInstituteAdminRequest{{Name: "Owner", Email: "owner@uni.example.edu"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := CreateInstituteRequest{
+		Name: "New", Code: "NEW", Domain: "new.example.edu", ContactEmail: "admin@new.example.edu",
+		Admins: []CreateInstituteAdminRequest{
+			{Name: "Owner", Email: "Owner@uni.example.edu"},
+			{Name: "Someone", Email: "someone@new.example.edu"},
+		},
+	}
+	validation, err := svc.ValidateInstitute(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countInstitutes(t, svc) != 1 {
+		t.Fatal("validating created the institute")
+	}
+	wantWarnings := []FieldError{
+		{Field: "admins[0].email", Message: "is not at the institute's domain"},
+		{Field: "admins[0].email", Message: "already administers 1 other institute(s)"},
+	}
+	if !validation.Valid || !reflect.DeepEqual(validation.Warnings, wantWarnings) {
+		t.Errorf("validation = %+v, want valid with warnings %+v", validation, wantWarnings)
+	}
+	if len(validation.Admins) != 2 ||
+		validation.Admins[0].Outcome != AdminAdd || validation.Admins[0].Email != "owner@uni.example.edu" || validation.Admins[0].InstitutesAdministered != 1 ||
+		validation.Admins[1].Outcome != AdminInvite || validation.Admins[1].UserID != nil {
+		t.Errorf("admins = %+v, want the owner added and someone invited", validation.Admins)
+	}
+
+	if _, err := svc.CreateInstitute(req); err != nil {
+		t.Fatalf("creating despite warnings: %v", err)
+	}
+}
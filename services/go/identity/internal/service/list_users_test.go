@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+func TestListUsersCursorSurvivesInserts(t *testing.T) {
+	svc, db := newTestService(t)
+	base := time.Now().Add(-time.Hour)
+	seen := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		user := createUser(t, db, core.UserTypeStudent)
+		db.Model(user).Update("created_at", base.Add(time.Duration(i)*time.Minute))
+	}
+
+	page, err := svc.ListUsers(pagination.Request{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		for _, u := range page.Items {
+			if seen[u.ID.String()] {
+				t.Fatalf("user %s listed twice", u.ID)
+			}
+			seen[u.ID.String()] = true
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		// A user created between page requests lands before the cursor
+		createUser(t, db, core.UserTypeStudent)
+
+		after, err := pagination.Decode(*page.NextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page, err = svc.ListUsers(pagination.Request{Limit: 2, After: &after}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("paged through %d users, want the 5 that existed at the start", len(seen))
+	}
+
+	bad := pagination.Cursor{CreatedAt: time.Now(), ID: "not-a-uuid"}
+	if _, err := svc.ListUsers(pagination.Request{Limit: 2, After: &bad}); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Errorf("cursor with a bad id: got %v, want ErrInvalidCursor", err)
+	}
+}
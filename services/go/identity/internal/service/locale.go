@@ -0,0 +1,51 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+)
+
+// localePattern accepts a language with an optional region, e.g. fr or fr-CA
+var localePattern = regexp.MustCompile(`^([A-Za-z]{2,3})(?:[-_]([A-Za-z]{2}|[0-9]{3}))?$`)
+
+// normalizeLocale writes a locale as a lower-case language and upper-case
+// region (fr_ca becomes fr-CA), adding an error for field if it is not one
+func normalizeLocale(field, locale string, verr *ValidationError) *string {
+	m := localePattern.FindStringSubmatch(strings.TrimSpace(locale))
+	if m == nil {
+		verr.add(field, "must be a language like fr, optionally with a region like fr-CA")
+		return nil
+	}
+	normalized := strings.ToLower(m[1])
+	if m[2] != "" {
+		normalized += "-" + strings.ToUpper(m[2])
+	}
+	return &normalized
+}
+
+// userLocale is the locale to email the user in, or "" to let the email
+// service fall back to the institute's
+func userLocale(user *core.User) string {
+	if user.PreferredLocale == nil {
+		return ""
+	}
+	return *user.PreferredLocale
+}
+
+// orgUnitDefaultLocale is the default locale of the institute the unit
+// belongs to, or "" if it cannot be found; mail is then sent in the email
+// service's base locale
+func (s *IdentityService) orgUnitDefaultLocale(scope core.AnnouncementScope, id uuid.UUID) string {
+	instituteID, err := s.repo.OrgUnitInstituteID(scope, id)
+	if err != nil {
+		return ""
+	}
+	institute, err := s.repo.GetInstituteByID(instituteID.String())
+	if err != nil {
+		return ""
+	}
+	return institute.DefaultLocale
+}
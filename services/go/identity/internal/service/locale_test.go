@@ -0,0 +1,100 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+func TestPreferredLocaleIsNormalized(t *testing.T) {
+	svc, db := newTestService(t)
+	user := createUser(t, db, core.UserTypeStudent)
+
+	updated, err := svc.UpdateUser(user.ID.String(), UserUpdate{PreferredLocale: strPtr("fr_ca")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.PreferredLocale == nil || *updated.PreferredLocale != "fr-CA" {
+		t.Fatalf("preferred locale = %v, want fr-CA", updated.PreferredLocale)
+	}
+
+	_, err = svc.UpdateUser(user.ID.String(), UserUpdate{PreferredLocale: strPtr("French")}, nil)
+	if verr := validationErrorOf(t, err); !hasFieldError(verr, "preferred_locale") {
+		t.Errorf("malformed locale: got %v", verr)
+	}
+
+	cleared, err := svc.UpdateUser(user.ID.String(), UserUpdate{PreferredLocale: strPtr("")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared.PreferredLocale != nil {
+		t.Errorf("preferred locale = %q after clearing it", *cleared.PreferredLocale)
+	}
+}
+
+func TestSlotCancellationIsSentInEachStudentsLocale(t *testing.T) {
+	svc, db, tree, instructor := newSlotService(t)
+	var payload struct {
+		DefaultLocale string `json:"default_locale"`
+		Recipients    []struct {
+			Email  string `json:"email"`
+			Locale string `json:"locale"`
+		} `json:"recipients"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		results := []map[string]string{}
+		for _, rcpt := range payload.Recipients {
+			results = append(results, map[string]string{"recipient": rcpt.Email, "status": "queued"})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	t.Cleanup(server.Close)
+	svc.cfg.EmailServiceURL = server.URL
+
+	if _, err := svc.UpdateInstitute(tree.Institute.ID.String(), InstituteUpdate{DefaultLocale: strPtr("de")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	slot, err := svc.CreateSlot(instructor.ID.String(), slotAt(tree.Class.ID.String(), 24, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	french := createUser(t, db, core.UserTypeStudent)
+	if _, err := svc.UpdateUser(french.ID.String(), UserUpdate{PreferredLocale: strPtr("fr")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	other := createUser(t, db, core.UserTypeStudent)
+	for _, s := range []*core.User{french, other} {
+		if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", s.ID.String(), false, false); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := svc.BookSlot(s.ID.String(), slot.ID.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.CancelSlot(instructor.ID.String(), slot.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := svc.repo.ClaimSlotCancellation(time.Now())
+	if err != nil || claimed == nil {
+		t.Fatalf("claimed %v, %v; want the cancelled slot", claimed, err)
+	}
+	if err := svc.NotifySlotCancelled(claimed); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.DefaultLocale != "de" {
+		t.Errorf("default locale = %q, want the institute's", payload.DefaultLocale)
+	}
+	locales := map[string]string{}
+	for _, rcpt := range payload.Recipients {
+		locales[rcpt.Email] = rcpt.Locale
+	}
+	if len(locales) != 2 || locales[french.Email] != "fr" || locales[other.Email] != "" {
+		t.Errorf("recipient locales = %v, want fr for %s only", locales, french.Email)
+	}
+}
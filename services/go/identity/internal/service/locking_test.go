@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+func intPtr(v int) *int { return &v }
+
+func strPtr(v string) *string { return &v }
+
+func TestUpdateWithStaleVersionConflicts(t *testing.T) {
+	svc, db := newTestService(t)
+	user := createUser(t, db, core.UserTypeStudent)
+
+	updated, err := svc.UpdateUser(user.ID.String(), UserUpdate{FullName: strPtr("First Rename")}, intPtr(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != 2 {
+		t.Fatalf("version after an update = %d, want 2", updated.Version)
+	}
+
+	// A client still holding version 1 loses and learns the current version
+	_, err = svc.UpdateUser(user.ID.String(), UserUpdate{FullName: strPtr("Second Rename")}, intPtr(1))
+	var conflict *VersionConflictError
+	if !errors.As(err, &conflict) || conflict.CurrentVersion != 2 {
+		t.Fatalf("update at a stale version = %v, want a conflict at version 2", err)
+	}
+	if !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("version conflict does not wrap repository.ErrConflict")
+	}
+	stored, err := svc.GetUser(user.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FullName != "First Rename" {
+		t.Errorf("stale update was written: full name %q", stored.FullName)
+	}
+
+	// No expected version means last write wins, still bumping the version
+	updated, err = svc.UpdateUser(user.ID.String(), UserUpdate{FullName: strPtr("Third Rename")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != 3 {
+		t.Errorf("version after an unversioned update = %d, want 3", updated.Version)
+	}
+}
+
+func TestConcurrentOrgUnitUpdatesConflict(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	repo := repository.NewRepository(db)
+
+	// Two requests load the class before either writes
+	first, err := repo.GetClassByID(tree.Class.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := repo.GetClassByID(tree.Class.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Name = "First"
+	if err := repo.UpdateClass(first); err != nil {
+		t.Fatal(err)
+	}
+	second.Name = "Second"
+	if err := repo.UpdateClass(second); !errors.Is(err, repository.ErrConflict) {
+		t.Fatalf("second concurrent update = %v, want ErrConflict", err)
+	}
+	if second.Version != 1 {
+		t.Errorf("losing update left its version at %d, want it unchanged at 1", second.Version)
+	}
+
+	for name, update := range map[string]func() error{
+		"institute": func() error {
+			_, err := svc.UpdateInstitute(tree.Institute.ID.String(), InstituteUpdate{Name: strPtr("Renamed")}, intPtr(5))
+			return err
+		},
+		"faculty": func() error {
+			_, err := svc.UpdateFaculty(tree.Faculty.ID.String(), "Renamed", intPtr(5))
+			return err
+		},
+		"department": func() error {
+			_, err := svc.UpdateDepartment(tree.Department.ID.String(), "Renamed", intPtr(5))
+			return err
+		},
+		"class": func() error {
+			_, err := svc.UpdateClass(tree.Class.ID.String(), "Renamed", nil, false, nil, false, intPtr(1))
+			return err
+		},
+	} {
+		var conflict *VersionConflictError
+		if err := update(); !errors.As(err, &conflict) {
+			t.Errorf("%s update at a stale version = %v, want a version conflict", name, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"net"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// maxUserAgentLength bounds the user agent kept with a login
+const maxUserAgentLength = 512
+
+// LoginEventRequest reports a successful login. LoggedInAt defaults to now.
+type LoginEventRequest struct {
+	LoggedInAt time.Time `json:"logged_in_at"`
+	ClientIP   string    `json:"client_ip"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+// RecordLogin stores a login reported by AuthN as the user's last login and
+// in their history
+func (s *IdentityService) RecordLogin(userID string, req LoginEventRequest) error {
+	id, err := parseID("id", userID)
+	if err != nil {
+		return err
+	}
+	if req.ClientIP != "" && net.ParseIP(req.ClientIP) == nil {
+		ve := &ValidationError{}
+		ve.add("client_ip", "must be an IP address")
+		return ve
+	}
+
+	event := &core.LoginEvent{
+		UserID:     id,
+		LoggedInAt: req.LoggedInAt.UTC(),
+		ClientIP:   req.ClientIP,
+		UserAgent:  req.UserAgent,
+	}
+	if req.LoggedInAt.IsZero() {
+		event.LoggedInAt = time.Now().UTC()
+	}
+	if len(event.UserAgent) > maxUserAgentLength {
+		event.UserAgent = event.UserAgent[:maxUserAgentLength]
+	}
+	return s.repo.RecordLogin(event)
+}
+
+// GetLoginHistory returns the user's latest logins, newest first
+func (s *IdentityService) GetLoginHistory(userID string) ([]core.LoginEvent, error) {
+	if _, err := parseID("id", userID); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetLoginHistory(userID)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	gosqlite "github.com/glebarez/go-sqlite"
+)
+
+// SQLite has no GREATEST. Timestamps are stored as sortable text, so the
+// later of two is the larger string.
+func init() {
+	gosqlite.MustRegisterScalarFunction("greatest", 2, func(_ *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if fmt.Sprint(args[0]) > fmt.Sprint(args[1]) {
+			return args[0], nil
+		}
+		return args[1], nil
+	})
+}
+
+func TestRecordLoginKeepsLatest(t *testing.T) {
+	svc, db := newTestService(t, &core.LoginEvent{})
+	user := createUser(t, db, core.UserTypeStudent)
+	start := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+
+	for i := 0; i < repository.MaxLoginEvents+5; i++ {
+		err := svc.RecordLogin(user.ID.String(), LoginEventRequest{LoggedInAt: start.Add(time.Duration(i) * time.Minute), ClientIP: "203.0.113.9"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Reported late, older than the last login
+	if err := svc.RecordLogin(user.ID.String(), LoginEventRequest{LoggedInAt: start.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := svc.GetLoginHistory(user.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != repository.MaxLoginEvents {
+		t.Fatalf("kept %d logins, want %d", len(history), repository.MaxLoginEvents)
+	}
+	latest := start.Add(time.Duration(repository.MaxLoginEvents+4) * time.Minute)
+	if !history[0].LoggedInAt.Equal(latest) {
+		t.Errorf("newest login = %v, want %v", history[0].LoggedInAt, latest)
+	}
+
+	got, err := svc.GetUser(user.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LastLoginAt == nil || !got.LastLoginAt.Equal(latest) {
+		t.Errorf("last login = %v, want %v; a late report must not move it back", got.LastLoginAt, latest)
+	}
+	if got.Version != user.Version {
+		t.Errorf("version = %d, logins must not bump it", got.Version)
+	}
+}
+
+func TestRecordLoginValidation(t *testing.T) {
+	svc, db := newTestService(t, &core.LoginEvent{})
+	user := createUser(t, db, core.UserTypeStudent)
+
+	err := svc.RecordLogin(user.ID.String(), LoginEventRequest{ClientIP: "not-an-ip"})
+	if !hasFieldError(validationErrorOf(t, err), "client_ip") {
+		t.Errorf("bad client ip = %v", err)
+	}
+
+	if err := svc.RecordLogin(user.ID.String(), LoginEventRequest{UserAgent: strings.Repeat("a", 2000)}); err != nil {
+		t.Fatal(err)
+	}
+	history, _ := svc.GetLoginHistory(user.ID.String())
+	if len(history) != 1 || len(history[0].UserAgent) != maxUserAgentLength || history[0].LoggedInAt.IsZero() {
+		t.Errorf("history = %+v, want one login now with the user agent cut short", history)
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestMergeUsersRepointsEnrollments(t *testing.T) {
+	svc, db := newTestService(t, &core.UserMerge{})
+	tree := createOrgTree(t, db)
+	other := &core.Class{DepartmentID: tree.Department.ID, Name: "PHY102"}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	primary := createUser(t, db, core.UserTypeStudent)
+	duplicate := createUser(t, db, core.UserTypeStudent)
+	primary.FullName = ""
+	if err := db.Model(primary).Update("full_name", "").Error; err != nil {
+		t.Fatal(err)
+	}
+	profiles := []core.StudentProfile{
+		{UserID: primary.ID, EnrollmentNumber: ""},
+		{UserID: duplicate.ID, InstituteID: &tree.Institute.ID, EnrollmentNumber: "E1001", EnrollmentYear: 2024, IntakeSeason: core.IntakeFall},
+	}
+	if err := db.Create(&profiles).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Both are in PHY101, which the primary joined first; only the duplicate
+	// is in PHY102
+	primaryJoined := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	enrollments := []core.ClassEnrollment{
+		{StudentID: primary.ID, ClassID: tree.Class.ID, EnrolledAt: primaryJoined},
+		{StudentID: duplicate.ID, ClassID: tree.Class.ID, EnrolledAt: primaryJoined.AddDate(0, 1, 0)},
+		{StudentID: duplicate.ID, ClassID: other.ID, EnrolledAt: primaryJoined.AddDate(0, 1, 0)},
+	}
+	if err := db.Create(&enrollments).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	merge, err := svc.MergeUsers(MergeUsersRequest{PrimaryID: primary.ID.String(), DuplicateID: duplicate.ID.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []core.ClassEnrollment
+	if err := db.Order("enrolled_at").Find(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("enrollments after merge = %+v, want the primary in both classes", got)
+	}
+	for _, e := range got {
+		if e.StudentID != primary.ID {
+			t.Errorf("enrollment in %s still belongs to %s", e.ClassID, e.StudentID)
+		}
+	}
+	if got[0].ClassID != tree.Class.ID || !got[0].EnrolledAt.Equal(primaryJoined) {
+		t.Errorf("PHY101 enrollment = %+v, want the primary's own, from %s", got[0], primaryJoined)
+	}
+	if got[1].ClassID != other.ID {
+		t.Errorf("second enrollment is in %s, want PHY102 moved over", got[1].ClassID)
+	}
+
+	// Empty fields come from the duplicate, which is soft-deleted
+	var profile core.StudentProfile
+	if err := db.First(&profile, "user_id = ?", primary.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if profile.EnrollmentNumber != "E1001" || profile.EnrollmentYear != 2024 || profile.IntakeSeason != core.IntakeFall || profile.InstituteID == nil || *profile.InstituteID != tree.Institute.ID {
+		t.Errorf("primary profile = %+v, want the duplicate's enrollment number, year, intake and institute", profile)
+	}
+	var merged core.User
+	if err := db.First(&merged, "id = ?", primary.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if merged.FullName != duplicate.FullName {
+		t.Errorf("primary name = %q, want %q", merged.FullName, duplicate.FullName)
+	}
+	if err := db.First(&core.User{}, "id = ?", duplicate.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("duplicate still active: %v", err)
+	}
+	var n int64
+	db.Model(&core.StudentProfile{}).Where("user_id = ?", duplicate.ID).Count(&n)
+	if n != 0 {
+		t.Errorf("duplicate still has a student profile")
+	}
+
+	// The audit row says what moved and what was dropped
+	var audit core.UserMerge
+	if err := db.First(&audit, "id = ?", merge.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var summary repository.MergeSummary
+	if err := json.Unmarshal([]byte(audit.Summary), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if audit.PrimaryUserID != primary.ID || audit.DuplicateUserID != duplicate.ID || audit.DuplicateEmail != duplicate.Email {
+		t.Errorf("audit = %+v, want %s merged into %s", audit, duplicate.ID, primary.ID)
+	}
+	if summary.EnrollmentsMoved != 1 || summary.EnrollmentsDropped != 1 || summary.ProfileMoved || len(summary.FieldsCopied) != 5 {
+		t.Errorf("summary = %+v, want 1 enrollment moved, 1 dropped and 5 fields copied", summary)
+	}
+}
+
+func TestMergeUsersNeedsTwoUsersOfOneType(t *testing.T) {
+	svc, db := newTestService(t, &core.UserMerge{})
+	student := createUser(t, db, core.UserTypeStudent)
+	instructor := createUser(t, db, core.UserTypeInstructor)
+
+	var verr *ValidationError
+	if _, err := svc.MergeUsers(MergeUsersRequest{PrimaryID: student.ID.String(), DuplicateID: student.ID.String()}); !errors.As(err, &verr) {
+		t.Errorf("merging a user into itself: got %v, want a validation error", err)
+	}
+	if _, err := svc.MergeUsers(MergeUsersRequest{PrimaryID: student.ID.String(), DuplicateID: instructor.ID.String()}); !errors.As(err, &verr) || !verr.Conflict {
+		t.Errorf("merging an instructor into a student: got %v, want a conflict", err)
+	}
+	if err := db.First(&core.User{}, "id = ?", instructor.ID).Error; err != nil {
+		t.Errorf("refused merge deleted the duplicate: %v", err)
+	}
+}
+
+func TestEmailsAreCaseInsensitive(t *testing.T) {
+	svc, db := newTestService(t)
+
+	user, err := svc.RegisterUser(CreateUserRequest{Email: " Ada@Example.EDU", FullName: "Ada", UserType: core.UserTypeInstructor, EmployeeID: "T1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "ada@example.edu" {
+		t.Errorf("stored email %q, want it lower-cased", user.Email)
+	}
+	found, err := svc.LookupUser("ADA@example.edu")
+	if err != nil || found.ID != user.ID {
+		t.Errorf("lookup by another case = %v, %v; want %s", found, err, user.ID)
+	}
+
+	// Case variants registered before are reported, not merged
+	legacy := []core.User{
+		{Email: "Foo@x.edu", FullName: "Foo", UserType: core.UserTypeStudent, Status: "active", IsActive: true},
+		{Email: "foo@x.edu", FullName: "Foo", UserType: core.UserTypeStudent, Status: "active", IsActive: true},
+		{Email: "Bar@x.edu", FullName: "Bar", UserType: core.UserTypeStudent, Status: "active", IsActive: true},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewRepository(db)
+	conflicts, err := repo.NormalizeEmails()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Email != "foo@x.edu" || len(conflicts[0].UserIDs) != 2 {
+		t.Fatalf("conflicts = %+v, want the two foo@x.edu users", conflicts)
+	}
+	var emails []string
+	db.Model(&core.User{}).Order("email").Pluck("email", &emails)
+	want := []string{"Foo@x.edu", "ada@example.edu", "bar@x.edu", "foo@x.edu"}
+	if len(emails) != len(want) {
+		t.Fatalf("emails = %v, want %v", emails, want)
+	}
+	for i := range want {
+		if emails[i] != want[i] {
+			t.Errorf("emails = %v, want %v", emails, want)
+			break
+		}
+	}
+}
+
+func TestMergeUsersKeepsInstituteOwners(t *testing.T) {
+	svc, db := newTestService(t, &core.UserMerge{})
+	shared, other := createOrgTree(t, db).Institute, createOrgTree(t, db).Institute
+	primary := createUser(t, db, core.UserTypeInstituteAdmin)
+	duplicate := createUser(t, db, core.UserTypeInstituteAdmin)
+	memberships := []core.InstituteAdminProfile{
+		{UserID: primary.ID, InstituteID: shared.ID, Role: core.InstituteRoleAdmin},
+		{UserID: duplicate.ID, InstituteID: shared.ID, Role: core.InstituteRoleOwner},
+		{UserID: duplicate.ID, InstituteID: other.ID, Role: core.InstituteRoleAdmin},
+	}
+	if err := db.Create(&memberships).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.MergeUsers(MergeUsersRequest{PrimaryID: primary.ID.String(), DuplicateID: duplicate.ID.String()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []core.InstituteAdminProfile
+	if err := db.Find(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	roles := map[uuid.UUID]core.InstituteRole{}
+	for _, m := range got {
+		if m.UserID != primary.ID {
+			t.Errorf("membership of %s still belongs to %s", m.InstituteID, m.UserID)
+		}
+		roles[m.InstituteID] = m.Role
+	}
+	if len(got) != 2 || roles[shared.ID] != core.InstituteRoleOwner || roles[other.ID] != core.InstituteRoleAdmin {
+		t.Errorf("memberships = %+v, want the primary owning the shared institute and admin of the other", got)
+	}
+}
+
+func TestMergeUsersKeepsTheDuplicatesSeatOverAPendingRequest(t *testing.T) {
+	svc, db := newTestService(t, &core.UserMerge{})
+	tree := createOrgTree(t, db)
+	primary := createUser(t, db, core.UserTypeStudent)
+	duplicate := createUser(t, db, core.UserTypeStudent)
+	enrollments := []core.ClassEnrollment{
+		{StudentID: primary.ID, ClassID: tree.Class.ID, Status: core.EnrollmentPending, EnrolledAt: time.Now()},
+		{StudentID: duplicate.ID, ClassID: tree.Class.ID, Status: core.EnrollmentEnrolled, EnrolledAt: time.Now()},
+	}
+	if err := db.Create(&enrollments).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	merge, err := svc.MergeUsers(MergeUsersRequest{PrimaryID: primary.ID.String(), DuplicateID: duplicate.ID.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []core.ClassEnrollment
+	if err := db.Find(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].StudentID != primary.ID || got[0].Status != core.EnrollmentEnrolled {
+		t.Fatalf("enrollments after merge = %+v, want the primary holding the seat", got)
+	}
+	var summary repository.MergeSummary
+	if err := json.Unmarshal([]byte(merge.Summary), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.EnrollmentsDropped != 1 || summary.EnrollmentsMoved != 1 {
+		t.Errorf("summary = %+v, want the request dropped and the seat moved", summary)
+	}
+}
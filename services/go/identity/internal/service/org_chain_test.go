@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+func TestUnitsUnderADeletedUnitCountAsDeleted(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	student := createUser(t, db, core.UserTypeStudent)
+
+	// Deleting only the faculty's row leaves its department and class live,
+	// as deletions did before they cascaded
+	if err := db.Delete(tree.Faculty).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", student.ID.String(), false, false); !errors.Is(err, repository.ErrClassNotFound) {
+		t.Errorf("enrolling in a class under a deleted faculty: got %v, want ErrClassNotFound", err)
+	}
+	if err := svc.repo.CreateClass(&core.Class{DepartmentID: tree.Department.ID, Name: "PHY102"}); !errors.Is(err, repository.ErrDepartmentNotFound) {
+		t.Errorf("creating a class under a deleted faculty: got %v, want ErrDepartmentNotFound", err)
+	}
+	if _, err := svc.GetClass(tree.Class.ID.String()); !errors.Is(err, repository.ErrClassNotFound) {
+		t.Errorf("getting the class: got %v, want ErrClassNotFound", err)
+	}
+	if departments, err := svc.repo.GetDepartmentsByFaculty(tree.Faculty.ID.String()); err != nil || len(departments) != 0 {
+		t.Errorf("departments of the deleted faculty = %v, %v; want none", departments, err)
+	}
+	if classes, err := svc.repo.GetClassesByDepartment(tree.Department.ID.String()); err != nil || len(classes) != 0 {
+		t.Errorf("classes under the deleted faculty = %v, %v; want none", classes, err)
+	}
+
+	// Admins looking into the deletion still find the class, and when the
+	// unit above it went
+	if _, err := svc.IncludingDeleted().GetClass(tree.Class.ID.String()); err != nil {
+		t.Errorf("getting the class including deleted units: %v", err)
+	}
+	deletedAt, err := svc.OrgUnitDeletedAt(core.AnnouncementScopeClass, tree.Class.ID.String())
+	if err != nil || deletedAt == nil {
+		t.Errorf("class deleted at %v, %v; want when its faculty was", deletedAt, err)
+	}
+	if deletedAt, err := svc.OrgUnitDeletedAt(core.AnnouncementScopeInstitute, tree.Institute.ID.String()); err != nil || deletedAt != nil {
+		t.Errorf("institute deleted at %v, %v; want live", deletedAt, err)
+	}
+}
+
+func TestDeletingAUnitDeletesTheUnitsUnderIt(t *testing.T) {
+	svc, db := newTestService(t, &core.DeletionTombstone{})
+	tree := createOrgTree(t, db)
+
+	if _, err := svc.DeleteInstitute(tree.Institute.ID.String(), repository.DeleteOptions{Cascade: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, unit := range []interface{}{&core.Faculty{}, &core.Department{}, &core.Class{}} {
+		var live int64
+		if err := db.Model(unit).Count(&live).Error; err != nil {
+			t.Fatal(err)
+		}
+		if live != 0 {
+			t.Errorf("%d %T rows left live under the deleted institute", live, unit)
+		}
+	}
+}
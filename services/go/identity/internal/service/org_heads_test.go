@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+func TestOrgUnitHeadMustBeInstructorOrInstituteAdmin(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+
+	for _, userType := range []core.UserType{core.UserTypeInstructor, core.UserTypeInstituteAdmin} {
+		head := createUser(t, db, userType)
+		faculty, err := svc.SetFacultyHead(tree.Faculty.ID.String(), head.ID.String())
+		if err != nil {
+			t.Fatalf("%s as dean: %v", userType, err)
+		}
+		if faculty.Head == nil || faculty.Head.ID != head.ID || faculty.Head.Email != head.Email {
+			t.Fatalf("%s as dean: resolved head %+v", userType, faculty.Head)
+		}
+		dept, err := svc.SetDepartmentHead(tree.Department.ID.String(), head.ID.String())
+		if err != nil {
+			t.Fatalf("%s as head of department: %v", userType, err)
+		}
+		if dept.Head == nil || dept.Head.ID != head.ID {
+			t.Fatalf("%s as head of department: resolved head %+v", userType, dept.Head)
+		}
+	}
+
+	for _, userType := range []core.UserType{core.UserTypeStudent, core.UserTypeSystemAdmin} {
+		user := createUser(t, db, userType)
+		if _, err := svc.SetFacultyHead(tree.Faculty.ID.String(), user.ID.String()); !errors.Is(err, ErrInvalidHeadUser) {
+			t.Errorf("%s as dean: got %v, want ErrInvalidHeadUser", userType, err)
+		}
+		if _, err := svc.SetDepartmentHead(tree.Department.ID.String(), user.ID.String()); !errors.Is(err, ErrInvalidHeadUser) {
+			t.Errorf("%s as head of department: got %v, want ErrInvalidHeadUser", userType, err)
+		}
+	}
+
+	if _, err := svc.SetFacultyHead(tree.Faculty.ID.String(), uuid.NewString()); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("unknown user as dean: got %v, want ErrUserNotFound", err)
+	}
+
+	faculty, err := svc.ClearFacultyHead(tree.Faculty.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if faculty.HeadUserID != nil || faculty.Head != nil {
+		t.Fatalf("cleared faculty still has head %v", faculty.HeadUserID)
+	}
+}
+
+func TestDeletingHeadClearsOrgUnits(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	head := createUser(t, db, core.UserTypeInstructor)
+
+	if _, err := svc.SetFacultyHead(tree.Faculty.ID.String(), head.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetDepartmentHead(tree.Department.ID.String(), head.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.DeleteUser(head.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	faculty, err := svc.GetFaculty(tree.Faculty.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if faculty.HeadUserID != nil || faculty.Head != nil {
+		t.Errorf("faculty still headed by deleted user: %v", faculty.HeadUserID)
+	}
+	dept, err := svc.GetDepartment(tree.Department.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dept.HeadUserID != nil || dept.Head != nil {
+		t.Errorf("department still headed by deleted user: %v", dept.HeadUserID)
+	}
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// maxPolicyVersion bounds version labels, e.g. "2026-10" or "v3"
+const maxPolicyVersion = 64
+
+// PolicyDocumentRequest publishes a version of a policy. EffectiveAt
+// defaults to now, making it current straight away.
+type PolicyDocumentRequest struct {
+	Type        core.PolicyType `json:"type"`
+	Version     string          `json:"version"`
+	Body        string          `json:"body"`
+	URL         string          `json:"url"`
+	EffectiveAt *time.Time      `json:"effective_at"`
+}
+
+// PolicyDocumentUpdate changes a document before it takes effect; nil fields
+// are left unchanged. The type and version are fixed once created.
+type PolicyDocumentUpdate struct {
+	Body        *string    `json:"body"`
+	URL         *string    `json:"url"`
+	EffectiveAt *time.Time `json:"effective_at"`
+}
+
+// PolicyStatus lists the current documents the user has not accepted. Until
+// it is empty, their access tokens only work for accepting them.
+type PolicyStatus struct {
+	NeedsAcceptance []core.PolicyDocument `json:"needs_acceptance"`
+}
+
+// PolicyAcceptanceRequest records a user accepting current documents, from
+// the client IP AuthN saw
+type PolicyAcceptanceRequest struct {
+	DocumentIDs []string `json:"document_ids"`
+	ClientIP    string   `json:"client_ip"`
+}
+
+func (s *IdentityService) CreatePolicyDocument(req PolicyDocumentRequest) (*core.PolicyDocument, error) {
+	verr := &ValidationError{}
+	if !req.Type.Valid() {
+		verr.add("type", "must be tos or privacy")
+	}
+	version := strings.TrimSpace(req.Version)
+	if version == "" {
+		verr.add("version", "is required")
+	} else if len(version) > maxPolicyVersion {
+		verr.add("version", "must be at most 64 characters")
+	}
+	if err := verr.errOrNil(); err != nil {
+		return nil, err
+	}
+
+	doc := &core.PolicyDocument{
+		Type:        req.Type,
+		Version:     version,
+		EffectiveAt: time.Now().UTC(),
+	}
+	update := PolicyDocumentUpdate{Body: &req.Body, URL: &req.URL, EffectiveAt: req.EffectiveAt}
+	if err := applyPolicyDocumentUpdate(doc, update); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreatePolicyDocument(doc); err != nil {
+		if errors.Is(err, repository.ErrPolicyDocumentExists) {
+			return nil, newConflictError("version", "is already published for this type")
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *IdentityService) GetPolicyDocument(id string) (*core.PolicyDocument, error) {
+	docID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, repository.ErrPolicyDocumentNotFound
+	}
+	return s.repo.GetPolicyDocument(docID)
+}
+
+// ListPolicyDocuments returns every version, optionally of one type
+func (s *IdentityService) ListPolicyDocuments(policyType string) ([]core.PolicyDocument, error) {
+	t := core.PolicyType(policyType)
+	if t != "" && !t.Valid() {
+		ve := &ValidationError{}
+		ve.add("type", "must be tos or privacy")
+		return nil, ve
+	}
+	return s.repo.ListPolicyDocuments(t)
+}
+
+// UpdatePolicyDocument edits a document that has not taken effect yet
+func (s *IdentityService) UpdatePolicyDocument(id string, update PolicyDocumentUpdate) (*core.PolicyDocument, error) {
+	doc, err := s.GetPolicyDocument(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if doc.InEffect(now) {
+		return nil, repository.ErrPolicyInEffect
+	}
+	if err := applyPolicyDocumentUpdate(doc, update); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdatePolicyDocument(doc, now); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// DeletePolicyDocument withdraws a document that has not taken effect yet
+func (s *IdentityService) DeletePolicyDocument(id string) error {
+	docID, err := uuid.Parse(id)
+	if err != nil {
+		return repository.ErrPolicyDocumentNotFound
+	}
+	return s.repo.DeletePolicyDocument(docID, time.Now())
+}
+
+// CurrentPolicyDocuments returns the document of each type in effect now
+func (s *IdentityService) CurrentPolicyDocuments() ([]core.PolicyDocument, error) {
+	return s.repo.CurrentPolicyDocuments(time.Now())
+}
+
+// GetPolicyStatus returns the current documents the user still has to
+// accept. Accepting an earlier version does not count.
+func (s *IdentityService) GetPolicyStatus(userID string) (*PolicyStatus, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, repository.ErrUserNotFound
+	}
+	if _, err := s.repo.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	return s.policyStatus(id)
+}
+
+func (s *IdentityService) policyStatus(userID uuid.UUID) (*PolicyStatus, error) {
+	current, err := s.repo.CurrentPolicyDocuments(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(current))
+	for i, doc := range current {
+		ids[i] = doc.ID
+	}
+	accepted, err := s.repo.AcceptedPolicyDocuments(userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PolicyStatus{NeedsAcceptance: []core.PolicyDocument{}}
+	for _, doc := range current {
+		if !accepted[doc.ID] {
+			status.NeedsAcceptance = append(status.NeedsAcceptance, doc)
+		}
+	}
+	return status, nil
+}
+
+// AcceptPolicies records the user accepting current documents and returns
+// what they still have to accept
+func (s *IdentityService) AcceptPolicies(userID string, req PolicyAcceptanceRequest) (*PolicyStatus, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, repository.ErrUserNotFound
+	}
+	if _, err := s.repo.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+	if len(req.DocumentIDs) == 0 {
+		verr.add("document_ids", "is required")
+	}
+	if req.ClientIP != "" && net.ParseIP(req.ClientIP) == nil {
+		verr.add("client_ip", "must be an IP address")
+	}
+	if err := verr.errOrNil(); err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.CurrentPolicyDocuments(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	isCurrent := make(map[uuid.UUID]bool, len(current))
+	for _, doc := range current {
+		isCurrent[doc.ID] = true
+	}
+
+	now := time.Now().UTC()
+	acceptances := make([]core.UserPolicyAcceptance, 0, len(req.DocumentIDs))
+	for _, raw := range req.DocumentIDs {
+		docID, err := uuid.Parse(raw)
+		if err != nil || !isCurrent[docID] {
+			ve := &ValidationError{}
+			ve.add("document_ids", "must be documents currently in effect")
+			return nil, ve
+		}
+		acceptances = append(acceptances, core.UserPolicyAcceptance{
+			UserID:     id,
+			DocumentID: docID,
+			AcceptedAt: now,
+			ClientIP:   req.ClientIP,
+		})
+	}
+	if err := s.repo.AcceptPolicyDocuments(acceptances); err != nil {
+		return nil, err
+	}
+	return s.policyStatus(id)
+}
+
+// applyPolicyDocumentUpdate copies update onto doc, which then needs a body
+// or a URL
+func applyPolicyDocumentUpdate(doc *core.PolicyDocument, update PolicyDocumentUpdate) error {
+	verr := &ValidationError{}
+	if update.Body != nil {
+		doc.Body = strings.TrimSpace(*update.Body)
+	}
+	if update.URL != nil {
+		doc.URL = strings.TrimSpace(*update.URL)
+		if doc.URL != "" {
+			u, err := url.Parse(doc.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				verr.add("url", "must be an http or https URL")
+			}
+		}
+	}
+	if doc.Body == "" && doc.URL == "" {
+		verr.add("body", "is required unless url is set")
+	}
+	if update.EffectiveAt != nil {
+		doc.EffectiveAt = update.EffectiveAt.UTC()
+	}
+	return verr.errOrNil()
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+func publishPolicy(t *testing.T, svc *IdentityService, policyType core.PolicyType, version string, effectiveAt time.Time) *core.PolicyDocument {
+	t.Helper()
+	doc, err := svc.CreatePolicyDocument(PolicyDocumentRequest{Type: policyType, Version: version, Body: "Terms " + version, EffectiveAt: &effectiveAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// pendingIDs lists the IDs of the documents the user still has to accept
+func pendingIDs(t *testing.T, svc *IdentityService, userID string) []string {
+	t.Helper()
+	status, err := svc.GetPolicyStatus(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, doc := range status.NeedsAcceptance {
+		ids = append(ids, doc.ID.String())
+	}
+	return ids
+}
+
+func TestPolicyAcceptanceIsRecorded(t *testing.T) {
+	svc, db := newTestService(t, &core.PolicyDocument{}, &core.UserPolicyAcceptance{})
+	user := createUser(t, db, core.UserTypeStudent)
+	tos := publishPolicy(t, svc, core.PolicyTypeTOS, "1", time.Now().Add(-time.Hour))
+	privacy := publishPolicy(t, svc, core.PolicyTypePrivacy, "1", time.Now().Add(-time.Hour))
+
+	if pending := pendingIDs(t, svc, user.ID.String()); len(pending) != 2 {
+		t.Fatalf("a new user needs to accept %v, want both documents", pending)
+	}
+	if _, err := svc.AcceptPolicies(user.ID.String(), PolicyAcceptanceRequest{DocumentIDs: []string{tos.ID.String()}, ClientIP: "not-an-ip"}); !hasFieldError(validationErrorOf(t, err), "client_ip") {
+		t.Errorf("accepting from a bad IP: got %v", err)
+	}
+
+	status, err := svc.AcceptPolicies(user.ID.String(), PolicyAcceptanceRequest{DocumentIDs: []string{tos.ID.String()}, ClientIP: "203.0.113.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.NeedsAcceptance) != 1 || status.NeedsAcceptance[0].ID != privacy.ID {
+		t.Fatalf("after accepting the terms, still needs %v; want the privacy policy", status.NeedsAcceptance)
+	}
+	acceptances, err := svc.repo.GetPolicyAcceptances(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acceptances) != 1 || acceptances[0].DocumentID != tos.ID || acceptances[0].ClientIP != "203.0.113.7" {
+		t.Errorf("acceptances = %+v, want the terms from the client IP", acceptances)
+	}
+}
+
+func TestNewPolicyVersionNeedsAcceptingAgain(t *testing.T) {
+	svc, db := newTestService(t, &core.PolicyDocument{}, &core.UserPolicyAcceptance{})
+	user := createUser(t, db, core.UserTypeStudent)
+	v1 := publishPolicy(t, svc, core.PolicyTypeTOS, "1", time.Now().Add(-time.Hour))
+	if _, err := svc.AcceptPolicies(user.ID.String(), PolicyAcceptanceRequest{DocumentIDs: []string{v1.ID.String()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A version that takes effect later changes nothing until it does
+	future := publishPolicy(t, svc, core.PolicyTypeTOS, "3", time.Now().Add(24*time.Hour))
+	if pending := pendingIDs(t, svc, user.ID.String()); len(pending) != 0 {
+		t.Errorf("a version not yet in effect needs accepting: %v", pending)
+	}
+	if err := svc.DeletePolicyDocument(future.ID.String()); err != nil {
+		t.Errorf("withdrawing a version not yet in effect: %v", err)
+	}
+
+	v2 := publishPolicy(t, svc, core.PolicyTypeTOS, "2", time.Now().Add(-time.Minute))
+	if pending := pendingIDs(t, svc, user.ID.String()); len(pending) != 1 || pending[0] != v2.ID.String() {
+		t.Fatalf("after publishing v2 the user needs %v, want v2", pending)
+	}
+	if _, err := svc.AcceptPolicies(user.ID.String(), PolicyAcceptanceRequest{DocumentIDs: []string{v1.ID.String()}}); !hasFieldError(validationErrorOf(t, err), "document_ids") {
+		t.Errorf("accepting the superseded version: got %v", err)
+	}
+	body := "changed"
+	if _, err := svc.UpdatePolicyDocument(v1.ID.String(), PolicyDocumentUpdate{Body: &body}); !errors.Is(err, repository.ErrPolicyInEffect) {
+		t.Errorf("editing a version that took effect: got %v, want ErrPolicyInEffect", err)
+	}
+
+	// The earlier acceptance is kept
+	acceptances, err := svc.repo.GetPolicyAcceptances(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acceptances) != 1 || acceptances[0].DocumentID != v1.ID {
+		t.Errorf("acceptances = %+v, want v1's kept", acceptances)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// checkProfileUpdate validates the profile fields of an update, trimming
+// them in place, and reports whether it changes any. Each field only applies
+// to users of the type with that profile.
+func (s *IdentityService) checkProfileUpdate(user *core.User, update *UserUpdate, verr *ValidationError) bool {
+	student := user.UserType == core.UserTypeStudent && user.StudentProfile != nil
+	instructor := user.UserType == core.UserTypeInstructor && user.InstructorProfile != nil
+
+	if update.EnrollmentNumber != nil {
+		trimmed := strings.TrimSpace(*update.EnrollmentNumber)
+		update.EnrollmentNumber = &trimmed
+		switch {
+		case !student:
+			verr.add("enrollment_number", "only applies to students")
+		case trimmed == "":
+			verr.add("enrollment_number", "must not be empty")
+		}
+	}
+	if update.EnrollmentYear != nil {
+		if !student {
+			verr.add("enrollment_year", "only applies to students")
+		} else {
+			checkEnrollmentYear("enrollment_year", *update.EnrollmentYear, verr)
+		}
+	}
+	if update.IntakeSeason != nil {
+		if !student {
+			verr.add("intake_season", "only applies to students")
+		} else {
+			checkIntakeSeason("intake_season", *update.IntakeSeason, verr)
+		}
+	}
+	if update.EmployeeID != nil {
+		trimmed := strings.TrimSpace(*update.EmployeeID)
+		update.EmployeeID = &trimmed
+		switch {
+		case !instructor:
+			verr.add("employee_id", "only applies to instructors")
+		case trimmed == "":
+			verr.add("employee_id", "must not be empty")
+		}
+	}
+	if update.Specialization != nil && !instructor {
+		verr.add("specialization", "only applies to instructors")
+	}
+	return update.EnrollmentNumber != nil || update.EnrollmentYear != nil || update.IntakeSeason != nil ||
+		update.EmployeeID != nil || update.Specialization != nil
+}
+
+// checkProfileUnique returns a conflict if the update gives the user an
+// enrollment number or employee ID someone else already has
+func (s *IdentityService) checkProfileUnique(user *core.User, update UserUpdate) error {
+	if update.EnrollmentNumber != nil && *update.EnrollmentNumber != user.StudentProfile.EnrollmentNumber {
+		taken, err := s.repo.EnrollmentNumberExists(user.StudentProfile.InstituteID, *update.EnrollmentNumber)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return newConflictError("enrollment_number", "is already used by another student in this institute")
+		}
+	}
+	if update.EmployeeID != nil && *update.EmployeeID != user.InstructorProfile.EmployeeID {
+		taken, err := s.repo.EmployeeIDExists(*update.EmployeeID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return newConflictError("employee_id", "is already used by another instructor")
+		}
+	}
+	return nil
+}
+
+func applyProfileUpdate(user *core.User, update UserUpdate) {
+	if update.EnrollmentNumber != nil {
+		user.StudentProfile.EnrollmentNumber = *update.EnrollmentNumber
+	}
+	if update.EnrollmentYear != nil {
+		user.StudentProfile.EnrollmentYear = *update.EnrollmentYear
+	}
+	if update.IntakeSeason != nil {
+		user.StudentProfile.IntakeSeason = *update.IntakeSeason
+	}
+	if user.StudentProfile != nil {
+		user.StudentProfile.Cohort = core.CohortLabel(user.StudentProfile.EnrollmentYear, user.StudentProfile.IntakeSeason)
+	}
+	if update.EmployeeID != nil {
+		user.InstructorProfile.EmployeeID = *update.EmployeeID
+	}
+	if update.Specialization != nil {
+		user.InstructorProfile.Specialization = *update.Specialization
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/pagination"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+func TestUsersWithoutProfileAreFlagged(t *testing.T) {
+	svc, db := newTestService(t)
+	legacy := createUser(t, db, core.UserTypeStudent)
+	student := createUser(t, db, core.UserTypeStudent)
+	if err := db.Create(&core.StudentProfile{UserID: student.ID, EnrollmentNumber: "E-1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := svc.GetUser(legacy.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ProfileMissing || got.StudentProfile != nil {
+		t.Errorf("legacy student: profile_missing = %v, profile = %v", got.ProfileMissing, got.StudentProfile)
+	}
+	got, err = svc.GetUser(student.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ProfileMissing || got.StudentProfile == nil || got.StudentProfile.EnrollmentNumber != "E-1" {
+		t.Errorf("student: profile_missing = %v, profile = %+v", got.ProfileMissing, got.StudentProfile)
+	}
+
+	page, err := svc.ListUsers(pagination.Request{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range page.Items {
+		if u.ProfileMissing != (u.ID == legacy.ID) {
+			t.Errorf("listed user %s has profile_missing = %v", u.ID, u.ProfileMissing)
+		}
+	}
+}
+
+func TestProfileQueryErrorFailsTheRead(t *testing.T) {
+	svc, db := newTestService(t)
+	student := createUser(t, db, core.UserTypeStudent)
+	if err := db.Migrator().DropTable(&core.StudentProfile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := svc.GetUser(student.ID.String()); err == nil {
+		t.Errorf("GetUser = %+v, want the profile query's error", got)
+	}
+	if _, err := svc.ListUsers(pagination.Request{Limit: 10}); err == nil {
+		t.Error("ListUsers succeeded without a profile table")
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createNamedUser stores an active user with the given name and email
+func createNamedUser(t *testing.T, db *gorm.DB, userType core.UserType, name, email string) *core.User {
+	t.Helper()
+	user := &core.User{Email: email, FullName: name, UserType: userType, Status: "active", IsActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func userIDs(users []core.User) []uuid.UUID {
+	ids := make([]uuid.UUID, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func TestSearchInstituteUsersStaysInInstitute(t *testing.T) {
+	svc, db := newTestService(t)
+	a := createOrgTree(t, db)
+	b := createOrgTree(t, db)
+
+	// Students of A: one by profile, one only through a class enrollment
+	profiled := createNamedUser(t, db, core.UserTypeStudent, "Ada Lovelace", "ada@a.example.edu")
+	if err := db.Create(&core.StudentProfile{UserID: profiled.ID, InstituteID: &a.Institute.ID, EnrollmentNumber: "A/1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	enrolled := createNamedUser(t, db, core.UserTypeStudent, "Adam Smith", "adam@a.example.edu")
+	if err := db.Create(&core.ClassEnrollment{StudentID: enrolled.ID, ClassID: a.Class.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	admin := createNamedUser(t, db, core.UserTypeInstituteAdmin, "Grace Adams", "grace@a.example.edu")
+	if err := db.Create(&core.InstituteAdminProfile{UserID: admin.ID, InstituteID: a.Institute.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// A student of B matching the same query, and a user of no institute
+	other := createNamedUser(t, db, core.UserTypeStudent, "Ada Byron", "ada@b.example.edu")
+	if err := db.Create(&core.StudentProfile{UserID: other.ID, InstituteID: &b.Institute.ID, EnrollmentNumber: "B/1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	createNamedUser(t, db, core.UserTypeStudent, "Ada Nobody", "ada@nowhere.example.com")
+
+	users, err := svc.SearchInstituteUsers(a.Institute.ID.String(), "ADA", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("institute A search found %d users, want 3: %+v", len(users), users)
+	}
+	for _, u := range users {
+		if u.ID == other.ID {
+			t.Fatalf("a student of institute B appeared in institute A's results")
+		}
+	}
+	// Prefix matches (ada@, Adam) come before the substring match (Grace Adams)
+	if last := users[len(users)-1]; last.ID != admin.ID {
+		t.Errorf("substring match is not last: %v", userIDs(users))
+	}
+
+	users, err = svc.SearchInstituteUsers(b.Institute.ID.String(), "ada", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != other.ID {
+		t.Fatalf("institute B search = %v, want only its own student", userIDs(users))
+	}
+
+	users, err = svc.SearchInstituteUsers(a.Institute.ID.String(), "ada", string(core.UserTypeInstituteAdmin), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != admin.ID {
+		t.Fatalf("institute A admin search = %v, want the admin only", userIDs(users))
+	}
+
+	users, err = svc.SearchInstituteUsers(a.Institute.ID.String(), "ada", "", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("search limited to 1 returned %d users", len(users))
+	}
+}
+
+func TestSearchInstituteUsersValidatesInput(t *testing.T) {
+	svc, db := newTestService(t)
+	a := createOrgTree(t, db)
+
+	if _, err := svc.SearchInstituteUsers("not-a-uuid", "ada", "", "", 0); !hasFieldError(validationErrorOf(t, err), "id") {
+		t.Errorf("bad institute id: got %v", err)
+	}
+	if _, err := svc.SearchInstituteUsers(a.Institute.ID.String(), "ada", "SYSTEM_ADMIN", "", 0); !hasFieldError(validationErrorOf(t, err), "type") {
+		t.Errorf("bad type: got %v", err)
+	}
+}
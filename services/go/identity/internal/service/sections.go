@@ -0,0 +1,218 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// SectionRequest creates a section of a class
+type SectionRequest struct {
+	Name         string `json:"name"`
+	Capacity     *int   `json:"capacity"`
+	Schedule     string `json:"schedule"`
+	InstructorID string `json:"instructor_id"`
+}
+
+// SectionUpdate changes a section; nil fields are left unchanged. Set
+// SetCapacity with a nil Capacity to remove the section's own limit, and an
+// empty InstructorID to unassign its instructor.
+type SectionUpdate struct {
+	Name         *string
+	Capacity     *int
+	SetCapacity  bool
+	Schedule     *string
+	InstructorID *string
+}
+
+// ListSections returns a class's sections with how many students each has
+func (s *IdentityService) ListSections(classID string) ([]core.ClassSection, error) {
+	id, err := uuid.Parse(classID)
+	if err != nil {
+		return nil, repository.ErrClassNotFound
+	}
+	if _, err := s.repo.OrgUnitName(core.AnnouncementScopeClass, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSections(id)
+}
+
+func (s *IdentityService) GetSection(classID, sectionID string) (*core.ClassSection, error) {
+	cID, sID, err := parseSectionIDs(classID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetSection(cID, sID)
+}
+
+// CreateSection adds a section to a class. Its instructor, if any, must be
+// an instructor.
+func (s *IdentityService) CreateSection(classID string, req SectionRequest) (*core.ClassSection, error) {
+	id, err := uuid.Parse(classID)
+	if err != nil {
+		return nil, repository.ErrClassNotFound
+	}
+	section := &core.ClassSection{ClassID: id}
+	update := SectionUpdate{
+		Name:        &req.Name,
+		Capacity:    req.Capacity,
+		SetCapacity: true,
+		Schedule:    &req.Schedule,
+	}
+	if req.InstructorID != "" {
+		update.InstructorID = &req.InstructorID
+	}
+	if err := s.applySectionUpdate(section, update); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateSection(section); err != nil {
+		return nil, err
+	}
+	s.recordActivity("section.create", "section", section.ID.String(), nil, section)
+	return section, nil
+}
+
+func (s *IdentityService) sectionVersion(classID, sectionID uuid.UUID) func() (int, error) {
+	return func() (int, error) {
+		section, err := s.repo.GetSection(classID, sectionID)
+		if err != nil {
+			return 0, err
+		}
+		return section.Version, nil
+	}
+}
+
+// UpdateSection edits a section. Seats added by raising its capacity are
+// filled from the waitlist.
+func (s *IdentityService) UpdateSection(classID, sectionID string, update SectionUpdate, expectedVersion *int) (*core.ClassSection, error) {
+	section, err := s.GetSection(classID, sectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(section.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+	before := activitySnapshot(section)
+	if err := s.applySectionUpdate(section, update); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateSection(section); err != nil {
+		return nil, versionConflict(err, s.sectionVersion(section.ClassID, section.ID))
+	}
+	s.recordActivity("section.update", "section", sectionID, before, section)
+	if update.SetCapacity {
+		s.invalidateClassStats(classID)
+	}
+	return section, nil
+}
+
+// DeleteSection removes a section nobody is enrolled in; its waitlist moves
+// to the class's default section
+func (s *IdentityService) DeleteSection(classID, sectionID string) error {
+	cID, sID, err := parseSectionIDs(classID, sectionID)
+	if err != nil {
+		return err
+	}
+	section, _ := s.repo.GetSection(cID, sID) // for the activity log
+	if err := s.repo.DeleteSection(cID, sID); err != nil {
+		return err
+	}
+	s.recordActivity("section.delete", "section", sectionID, section, nil)
+	s.invalidateClassStats(classID)
+	return nil
+}
+
+// MoveEnrollment moves an enrolled student to another section of the class
+func (s *IdentityService) MoveEnrollment(classID, studentID, sectionID string) (*core.ClassEnrollment, error) {
+	cID, err := uuid.Parse(classID)
+	if err != nil {
+		return nil, repository.ErrClassNotFound
+	}
+	sID, err := uuid.Parse(studentID)
+	if err != nil {
+		return nil, repository.ErrNotEnrolled
+	}
+	sectionUUID, err := parseID("section_id", sectionID)
+	if err != nil {
+		return nil, err
+	}
+	before, _ := s.repo.GetEnrollment(cID, sID) // for the activity log
+	enrollment, err := s.repo.MoveEnrollment(cID, sID, sectionUUID)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateClassStats(classID)
+	s.recordActivity("enrollment.move", "enrollment", studentID, before, enrollment)
+	return enrollment, nil
+}
+
+// applySectionUpdate validates update and copies it onto section
+func (s *IdentityService) applySectionUpdate(section *core.ClassSection, update SectionUpdate) error {
+	verr := &ValidationError{}
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			verr.add("name", "is required")
+		}
+		section.Name = name
+	}
+	if update.SetCapacity {
+		if update.Capacity != nil && *update.Capacity < 0 {
+			verr.add("capacity", "must not be negative")
+		}
+		section.Capacity = update.Capacity
+	}
+	if update.Schedule != nil {
+		section.Schedule = strings.TrimSpace(*update.Schedule)
+	}
+	if update.InstructorID != nil {
+		section.InstructorID = nil
+		if *update.InstructorID != "" {
+			instructorID, err := s.sectionInstructor(*update.InstructorID, verr)
+			if err != nil {
+				return err
+			}
+			if instructorID != uuid.Nil {
+				section.InstructorID = &instructorID
+			}
+		}
+	}
+	return verr.errOrNil()
+}
+
+// sectionInstructor checks that userID is an instructor, adding to verr if
+// not
+func (s *IdentityService) sectionInstructor(userID string, verr *ValidationError) (uuid.UUID, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		verr.add("instructor_id", "must be a valid UUID")
+		return uuid.Nil, nil
+	}
+	user, err := s.repo.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		verr.add("instructor_id", "does not exist")
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if user.UserType != core.UserTypeInstructor {
+		verr.add("instructor_id", "must be an instructor")
+		return uuid.Nil, nil
+	}
+	return user.ID, nil
+}
+
+func parseSectionIDs(classID, sectionID string) (uuid.UUID, uuid.UUID, error) {
+	cID, err := uuid.Parse(classID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, repository.ErrClassNotFound
+	}
+	sID, err := uuid.Parse(sectionID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, repository.ErrSectionNotFound
+	}
+	return cID, sID, nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// createSection adds a section of the given capacity to class
+func createSection(t *testing.T, svc *IdentityService, class *core.Class, name string, capacity int) *core.ClassSection {
+	t.Helper()
+	section, err := svc.CreateSection(class.ID.String(), SectionRequest{Name: name, Capacity: &capacity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return section
+}
+
+func TestDefaultSectionsAreBackfilled(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	students := createStudents(t, db, 2)
+
+	// A class, enrollment and waitlist entry as they were before sections
+	legacy := &core.Class{DepartmentID: tree.Department.ID, Name: "Legacy"}
+	if err := db.Create(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&core.ClassEnrollment{ClassID: legacy.ID, StudentID: students[0].ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&core.ClassWaitlistEntry{ClassID: legacy.ID, StudentID: students[1].ID, Position: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for run := 0; run < 2; run++ {
+		if err := svc.repo.BackfillDefaultSections(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sections, err := svc.ListSections(legacy.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 1 || !sections[0].IsDefault || sections[0].Enrolled != 1 {
+		t.Fatalf("legacy class sections = %+v, want one default section holding its student", sections)
+	}
+	waitlist, err := svc.GetClassWaitlist(legacy.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waitlist) != 1 || waitlist[0].SectionID != sections[0].ID {
+		t.Errorf("waitlist = %+v, want the entry moved to the default section", waitlist)
+	}
+	if sections, _ := svc.ListSections(tree.Class.ID.String()); len(sections) != 1 {
+		t.Errorf("class that already had a default section has %d sections", len(sections))
+	}
+}
+
+func TestSectionCapacity(t *testing.T) {
+	svc, db := newTestService(t)
+	class := createOrgTree(t, db).Class
+	lab := createSection(t, svc, class, "Lab", 1)
+	s := createStudents(t, db, 3)
+
+	res, err := svc.EnrollStudent(class.ID.String(), lab.ID.String(), s[0].ID.String(), false, false)
+	if err != nil || !res.Enrolled || res.SectionID != lab.ID || res.SectionSeatsTaken != 1 {
+		t.Fatalf("first student into the lab: %+v, %v", res, err)
+	}
+	if _, err := svc.EnrollStudent(class.ID.String(), lab.ID.String(), s[1].ID.String(), false, false); !errors.Is(err, repository.ErrSectionFull) {
+		t.Errorf("second student into the full lab: got %v, want ErrSectionFull", err)
+	}
+	res, err = svc.EnrollStudent(class.ID.String(), lab.ID.String(), s[1].ID.String(), true, false)
+	if err != nil || res.Enrolled || res.WaitlistEntry == nil || res.WaitlistEntry.SectionID != lab.ID {
+		t.Fatalf("waitlisting for the full lab: %+v, %v", res, err)
+	}
+
+	// The class itself has no limit, so the default section still has room
+	res, err = svc.EnrollStudent(class.ID.String(), "", s[2].ID.String(), false, false)
+	if err != nil || !res.Enrolled || res.SectionID == lab.ID {
+		t.Fatalf("student into the default section: %+v, %v", res, err)
+	}
+	if _, err := svc.MoveEnrollment(class.ID.String(), s[2].ID.String(), lab.ID.String()); !errors.Is(err, repository.ErrSectionFull) {
+		t.Errorf("moving into the full lab: got %v, want ErrSectionFull", err)
+	}
+
+	none := 0
+	if _, err := svc.UpdateSection(class.ID.String(), lab.ID.String(), SectionUpdate{Capacity: &none, SetCapacity: true}, nil); !errors.Is(err, repository.ErrSectionOverfilled) {
+		t.Errorf("lowering the capacity below the enrolled students: got %v, want ErrSectionOverfilled", err)
+	}
+	more := 2
+	updated, err := svc.UpdateSection(class.ID.String(), lab.ID.String(), SectionUpdate{Capacity: &more, SetCapacity: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Enrolled != 2 {
+		t.Errorf("lab has %d students after adding a seat, want the waitlisted one too", updated.Enrolled)
+	}
+}
+
+func TestWaitlistSkipsFullSectionWhileClassHasSeats(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	class := createClassWithCapacity(t, svc, tree, 3)
+	lab := createSection(t, svc, class, "Lab", 1)
+	s := createStudents(t, db, 5)
+
+	enroll := func(student *core.User, sectionID uuid.UUID) *repository.EnrollmentResult {
+		t.Helper()
+		section := ""
+		if sectionID != uuid.Nil {
+			section = sectionID.String()
+		}
+		res, err := svc.EnrollStudent(class.ID.String(), section, student.ID.String(), true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	enroll(s[0], lab.ID)
+	enroll(s[1], uuid.Nil)
+	enroll(s[2], uuid.Nil)
+	// The class is full: the first in line wants the lab, the second any seat
+	if res := enroll(s[3], lab.ID); res.Enrolled || res.WaitlistEntry.Position != 1 {
+		t.Fatalf("waitlisting for the lab: %+v", res)
+	}
+	if res := enroll(s[4], uuid.Nil); res.Enrolled || res.WaitlistEntry.Position != 2 {
+		t.Fatalf("waitlisting for the default section: %+v", res)
+	}
+
+	// A seat frees up in the default section; the lab is still full, so the
+	// student waiting for it is passed over but keeps their place
+	if err := svc.UnenrollStudent(class.ID.String(), s[1].ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if ids := enrolledIDs(t, svc, class.ID); len(ids) != 3 || !ids[s[4].ID] || ids[s[3].ID] {
+		t.Fatalf("enrolled = %v, want the second in line promoted instead of the first", ids)
+	}
+	waitlist, err := svc.GetClassWaitlist(class.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waitlist) != 1 || waitlist[0].StudentID != s[3].ID || waitlist[0].Position != 1 {
+		t.Fatalf("waitlist = %+v, want the lab student still first in line", waitlist)
+	}
+
+	// Once the lab's seat is free they get it
+	if err := svc.UnenrollStudent(class.ID.String(), s[0].ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if ids := enrolledIDs(t, svc, class.ID); !ids[s[3].ID] {
+		t.Errorf("enrolled = %v, want the lab student promoted into the freed lab seat", ids)
+	}
+}
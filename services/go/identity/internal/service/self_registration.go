@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// ErrSelfRegistrationClosed is returned for an email no institute lets sign
+// up by itself. It deliberately does not say whether the domain belongs to
+// an institute at all.
+var ErrSelfRegistrationClosed = errors.New("self-registration is not open for this email address")
+
+// SelfRegistration is where a student signing themselves up lands
+type SelfRegistration struct {
+	InstituteID    uuid.UUID  `json:"institute_id"`
+	DefaultClassID *uuid.UUID `json:"default_class_id,omitempty"`
+}
+
+// ResolveSelfRegistration finds the institute that lets the owner of email
+// sign up as a student. The most specific entry wins: an exact domain over a
+// wildcard, and a longer wildcard over a shorter one. Should two institutes
+// tie, neither is picked and ErrSelfRegistrationClosed returned, as it is
+// when nothing matches.
+func (s *IdentityService) ResolveSelfRegistration(email string) (*SelfRegistration, error) {
+	email = normalizeEmail(email)
+	at := strings.LastIndex(email, "@")
+	if at < 0 || !isValidHostname(email[at+1:]) {
+		return nil, ErrSelfRegistrationClosed
+	}
+	domain := email[at+1:]
+
+	institutes, err := s.repo.GetSelfRegistrationInstitutes()
+	if err != nil {
+		return nil, err
+	}
+	var match *core.Institute
+	best, tied := 0, false
+	for i := range institutes {
+		for _, entry := range institutes[i].AllowedEmailDomains {
+			score := emailDomainMatch(entry, domain)
+			if score == 0 || score < best {
+				continue
+			}
+			if score == best && match.ID != institutes[i].ID {
+				tied = true
+				continue
+			}
+			match, best, tied = &institutes[i], score, false
+		}
+	}
+	if match == nil || tied {
+		return nil, ErrSelfRegistrationClosed
+	}
+	return &SelfRegistration{InstituteID: match.ID, DefaultClassID: match.DefaultClassID}, nil
+}
+
+// emailDomainMatch scores how closely an allowed-domain entry matches
+// domain: 0 for no match, otherwise higher for more specific entries
+func emailDomainMatch(entry, domain string) int {
+	if suffix, ok := strings.CutPrefix(entry, "*"); ok {
+		if strings.HasSuffix(domain, suffix) && len(domain) > len(suffix) {
+			return len(suffix)
+		}
+		return 0
+	}
+	if entry == domain {
+		// Beats any wildcard, whose suffix is shorter than domain
+		return len(domain) + 1
+	}
+	return 0
+}
+
+// normalizeEmailDomains lower-cases and dedupes allowed email domains,
+// adding an error for any that is neither a hostname nor "*." and one
+func normalizeEmailDomains(domains []string, verr *ValidationError) []string {
+	normalized := make([]string, 0, len(domains))
+	seen := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		d = normalizeDomain(d)
+		if !isValidHostname(strings.TrimPrefix(d, "*.")) {
+			verr.add("allowed_email_domains", "must be hostnames like university.edu or wildcards like *.university.edu")
+			return nil
+		}
+		if !seen[d] {
+			seen[d] = true
+			normalized = append(normalized, d)
+		}
+	}
+	return normalized
+}
+
+// checkDefaultClass parses a default class ID, which must name a class of
+// the institute
+func (s *IdentityService) checkDefaultClass(instituteID uuid.UUID, classID string, verr *ValidationError) (*uuid.UUID, error) {
+	id, err := uuid.Parse(classID)
+	if err != nil {
+		verr.add("default_class_id", "must be a valid UUID")
+		return nil, nil
+	}
+	_, classInstitute, err := s.repo.ClassScope(id)
+	if errors.Is(err, repository.ErrClassNotFound) || (err == nil && classInstitute != instituteID) {
+		verr.add("default_class_id", "must be a class of the institute")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// joinDefaultClass enrolls a student who just confirmed their email in the
+// default class of the institute they self-registered with, waitlisting
+// them if it is full. Failing to only costs them the seat, so it is logged.
+func (s *IdentityService) joinDefaultClass(user *core.User) {
+	if user.StudentProfile == nil || user.StudentProfile.InstituteID == nil {
+		return
+	}
+	reg, err := s.ResolveSelfRegistration(user.Email)
+	if err != nil || reg.InstituteID != *user.StudentProfile.InstituteID || reg.DefaultClassID == nil {
+		return
+	}
+	_, err = s.EnrollStudent(reg.DefaultClassID.String(), "", user.ID.String(), true, false)
+	if err != nil && !errors.Is(err, repository.ErrAlreadyEnrolled) {
+		log.Printf("Failed to enroll %s in default class %s: %v", user.ID, reg.DefaultClassID, err)
+	}
+}
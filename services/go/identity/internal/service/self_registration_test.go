@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// openSelfRegistration lets the tree's institute admit the given email
+// domains, with its class as the default one
+func openSelfRegistration(t *testing.T, svc *IdentityService, tree *orgTree, domains ...string) {
+	t.Helper()
+	open, classID := true, tree.Class.ID.String()
+	_, err := svc.UpdateInstitute(tree.Institute.ID.String(), InstituteUpdate{
+		AllowSelfRegistration: &open,
+		AllowedEmailDomains:   &domains,
+		DefaultClassID:        &classID,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveSelfRegistrationPicksMostSpecificDomain(t *testing.T) {
+	svc, db := newTestService(t)
+	university := createOrgTree(t, db)
+	medicine := createOrgTree(t, db)
+	rival := createOrgTree(t, db)
+	openSelfRegistration(t, svc, university, "*.uni.example.edu", "uni.example.edu")
+	openSelfRegistration(t, svc, medicine, "*.med.uni.example.edu")
+	openSelfRegistration(t, svc, rival, "other.example.edu")
+
+	for _, tc := range []struct {
+		email string
+		want  *orgTree
+	}{
+		{"student@uni.example.edu", university},
+		{"Student@CS.Uni.Example.edu", university},
+		{"student@lab.med.uni.example.edu", medicine},
+		{"student@other.example.edu", rival},
+		{"student@example.edu", nil},
+		{"student@notuni.example.edu", nil},
+		{"not-an-email", nil},
+	} {
+		reg, err := svc.ResolveSelfRegistration(tc.email)
+		if tc.want == nil {
+			if !errors.Is(err, ErrSelfRegistrationClosed) {
+				t.Errorf("%s: got %+v, %v; want registration closed", tc.email, reg, err)
+			}
+			continue
+		}
+		if err != nil || reg.InstituteID != tc.want.Institute.ID {
+			t.Errorf("%s: got %+v, %v; want institute %s", tc.email, reg, err, tc.want.Institute.Name)
+		}
+	}
+}
+
+func TestResolveSelfRegistrationClosedOnTieOrWhenOff(t *testing.T) {
+	svc, db := newTestService(t)
+	first := createOrgTree(t, db)
+	second := createOrgTree(t, db)
+	openSelfRegistration(t, svc, first, "shared.example.edu")
+	openSelfRegistration(t, svc, second, "shared.example.edu")
+	if _, err := svc.ResolveSelfRegistration("student@shared.example.edu"); !errors.Is(err, ErrSelfRegistrationClosed) {
+		t.Errorf("domain two institutes allow: err = %v, want registration closed", err)
+	}
+
+	closed := createOrgTree(t, db)
+	if _, err := svc.ResolveSelfRegistration("student@" + closed.Institute.Domain); !errors.Is(err, ErrSelfRegistrationClosed) {
+		t.Errorf("institute that never opened registration: err = %v, want registration closed", err)
+	}
+}
+
+func TestConfirmingSelfRegisteredStudentJoinsDefaultClass(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	openSelfRegistration(t, svc, tree, "uni.example.edu")
+
+	user, err := svc.RegisterUser(CreateUserRequest{
+		Email:            "new.student@uni.example.edu",
+		FullName:         "New Student",
+		EnrollmentNumber: "S-0001",
+		UserType:         core.UserTypeStudent,
+		InstituteID:      tree.Institute.ID.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ConfirmUserEmail(user.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	var enrollments []core.ClassEnrollment
+	if err := db.Where("student_id = ?", user.ID).Find(&enrollments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(enrollments) != 1 || enrollments[0].ClassID != tree.Class.ID {
+		t.Errorf("enrollments = %+v, want the default class", enrollments)
+	}
+}
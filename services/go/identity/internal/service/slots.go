@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// slotCancelledTemplate is the email service template students get when
+	// a slot they booked is cancelled
+	slotCancelledTemplate = "office_hours_cancelled"
+	// maxSlotLength bounds a single slot; longer availability is several slots
+	maxSlotLength = 12 * time.Hour
+	// maxSlotLocation bounds locations, which are rooms or meeting links
+	maxSlotLocation = 500
+	// slotTimeLayout is how slot times are written in emails
+	slotTimeLayout = "Mon 2 Jan 2006, 15:04 MST"
+)
+
+var (
+	ErrNotInstructor      = errors.New("only instructors can hold office hours")
+	ErrNotSlotInstructor  = errors.New("only the slot's instructor can do this")
+	ErrNotStudent         = errors.New("only students can book office hours")
+	ErrNotEnrolledInClass = errors.New("student is not enrolled in the slot's class")
+	ErrNotBookingParty    = errors.New("only the student or the slot's instructor can cancel a booking")
+)
+
+// SlotRequest creates a slot. Times are RFC 3339 with an offset; timezone
+// is the IANA zone they are shown in afterwards and defaults to UTC.
+type SlotRequest struct {
+	ClassID  string     `json:"class_id"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+	Timezone string     `json:"timezone"`
+	Capacity *int       `json:"capacity"`
+	Location string     `json:"location"`
+}
+
+// SlotUpdate changes a slot; nil fields are left unchanged. The class is
+// fixed once created.
+type SlotUpdate struct {
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+	Timezone *string    `json:"timezone"`
+	Capacity *int       `json:"capacity"`
+	Location *string    `json:"location"`
+}
+
+// CreateSlot opens a slot held by instructorID, who must be an instructor
+func (s *IdentityService) CreateSlot(instructorID string, req SlotRequest) (*core.AvailabilitySlot, error) {
+	instructor, err := s.repo.GetUserByID(instructorID)
+	if err != nil {
+		return nil, err
+	}
+	if instructor.UserType != core.UserTypeInstructor {
+		return nil, ErrNotInstructor
+	}
+
+	slot := &core.AvailabilitySlot{InstructorID: instructor.ID, Timezone: "UTC"}
+	if req.ClassID != "" {
+		classID, err := parseID("class_id", req.ClassID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.repo.OrgUnitName(core.AnnouncementScopeClass, classID); err != nil {
+			if errors.Is(err, repository.ErrClassNotFound) {
+				ve := &ValidationError{}
+				ve.add("class_id", "does not exist")
+				return nil, ve
+			}
+			return nil, err
+		}
+		slot.ClassID = &classID
+	}
+
+	update := SlotUpdate{StartsAt: req.StartsAt, EndsAt: req.EndsAt, Capacity: req.Capacity, Location: &req.Location}
+	if req.Timezone != "" {
+		update.Timezone = &req.Timezone
+	}
+	if err := applySlotUpdate(slot, update, true); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateSlot(slot); err != nil {
+		return nil, err
+	}
+	slot.Localize()
+	return slot, nil
+}
+
+func (s *IdentityService) GetSlot(id string) (*core.AvailabilitySlot, error) {
+	slotID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, repository.ErrSlotNotFound
+	}
+	return s.repo.GetSlot(slotID)
+}
+
+// UpdateSlot lets the slot's instructor move it, resize it or change its
+// location. Students already booked keep their seats.
+func (s *IdentityService) UpdateSlot(callerID, id string, update SlotUpdate) (*core.AvailabilitySlot, error) {
+	slot, err := s.ownSlot(callerID, id)
+	if err != nil {
+		return nil, err
+	}
+	if slot.Cancelled() {
+		return nil, repository.ErrSlotCancelled
+	}
+	if err := applySlotUpdate(slot, update, false); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateSlot(slot); err != nil {
+		return nil, err
+	}
+	slot.Localize()
+	return slot, nil
+}
+
+// CancelSlot calls a slot off. The students booked into it are emailed in
+// the background by SlotCancellationNotifier.
+func (s *IdentityService) CancelSlot(callerID, id string) error {
+	slot, err := s.ownSlot(callerID, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.CancelSlot(slot.ID, time.Now().UTC())
+}
+
+// GetClassSlots returns the open slots of a class that have not ended yet
+func (s *IdentityService) GetClassSlots(classID string) ([]core.AvailabilitySlot, error) {
+	id, err := uuid.Parse(classID)
+	if err != nil {
+		return nil, repository.ErrClassNotFound
+	}
+	if _, err := s.repo.OrgUnitName(core.AnnouncementScopeClass, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListClassSlots(id, time.Now())
+}
+
+// GetInstructorSlots returns the open slots an instructor holds that have
+// not ended yet
+func (s *IdentityService) GetInstructorSlots(userID string) ([]core.AvailabilitySlot, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListInstructorSlots(user.ID, time.Now())
+}
+
+// BookSlot gives studentID a seat in the slot. A slot for a class can only
+// be booked by students enrolled in it.
+func (s *IdentityService) BookSlot(studentID, slotID string) (*core.SlotBooking, *core.AvailabilitySlot, error) {
+	slot, err := s.GetSlot(slotID)
+	if err != nil {
+		return nil, nil, err
+	}
+	student, err := s.repo.GetUserByID(studentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if student.UserType != core.UserTypeStudent {
+		return nil, nil, ErrNotStudent
+	}
+	if slot.ClassID != nil {
+		enrolled, err := s.repo.IsEnrolled(*slot.ClassID, student.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !enrolled {
+			return nil, nil, ErrNotEnrolledInClass
+		}
+	}
+
+	booking := &core.SlotBooking{SlotID: slot.ID, StudentID: student.ID}
+	booked, err := s.repo.BookSlot(booking, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	return booking, booked, nil
+}
+
+// CancelBooking frees a student's seat in a slot. The student and the
+// slot's instructor may do this.
+func (s *IdentityService) CancelBooking(callerID, slotID, studentID string) error {
+	slot, err := s.GetSlot(slotID)
+	if err != nil {
+		return err
+	}
+	student, err := uuid.Parse(studentID)
+	if err != nil {
+		return repository.ErrBookingNotFound
+	}
+	if callerID != student.String() && callerID != slot.InstructorID.String() {
+		return ErrNotBookingParty
+	}
+	return s.repo.CancelBooking(slot.ID, student)
+}
+
+// GetSlotBookings lists who booked a slot, for its instructor
+func (s *IdentityService) GetSlotBookings(callerID, slotID string) ([]core.SlotBooking, error) {
+	slot, err := s.ownSlot(callerID, slotID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetSlotBookings(slot.ID)
+}
+
+// ownSlot loads a slot the caller holds
+func (s *IdentityService) ownSlot(callerID, id string) (*core.AvailabilitySlot, error) {
+	slot, err := s.GetSlot(id)
+	if err != nil {
+		return nil, err
+	}
+	if slot.InstructorID.String() != callerID {
+		return nil, ErrNotSlotInstructor
+	}
+	return slot, nil
+}
+
+// NotifySlotCancelled emails the students booked into a cancelled slot, in
+// batches the email service accepts. A failed batch does not stop the rest.
+func (s *IdentityService) NotifySlotCancelled(slot *core.AvailabilitySlot) error {
+	students, err := s.repo.SlotBookedStudents(slot.ID)
+	if err != nil {
+		return err
+	}
+	if len(students) == 0 {
+		return nil
+	}
+
+	instructorName := ""
+	if instructor, err := s.repo.GetUserByID(slot.InstructorID.String()); err == nil {
+		instructorName = instructor.FullName
+	}
+	className, defaultLocale := "", ""
+	if slot.ClassID != nil {
+		if name, err := s.repo.OrgUnitName(core.AnnouncementScopeClass, *slot.ClassID); err == nil {
+			className = name
+		}
+		defaultLocale = s.orgUnitDefaultLocale(core.AnnouncementScopeClass, *slot.ClassID)
+	}
+	slot.Localize()
+	data := map[string]string{
+		"instructor_name": instructorName,
+		"class_name":      className,
+		"starts_at":       slot.StartsAt.Format(slotTimeLayout),
+		"ends_at":         slot.EndsAt.Format(slotTimeLayout),
+		"location":        slot.Location,
+	}
+
+	var notSent int
+	for start := 0; start < len(students); start += emailBatchSize {
+		batch := students[start:min(start+emailBatchSize, len(students))]
+		recipients := make([]map[string]interface{}, 0, len(batch))
+		for _, student := range batch {
+			recipients = append(recipients, map[string]interface{}{
+				"email":  student.Email,
+				"locale": userLocale(&student),
+				"data":   map[string]string{"name": student.FullName},
+			})
+		}
+
+		failed, err := s.sendTemplateEmails(map[string]interface{}{
+			"template_name":  slotCancelledTemplate,
+			"recipients":     recipients,
+			"data":           data,
+			"category":       "notification",
+			"default_locale": defaultLocale,
+		})
+		if err != nil {
+			log.Printf("Slot %s: cancellation batch of %d not sent: %v", slot.ID, len(batch), err)
+			notSent += len(batch)
+			continue
+		}
+		if len(failed) > 0 {
+			log.Printf("Slot %s: cancellation not sent to %s", slot.ID, strings.Join(failed, ", "))
+			notSent += len(failed)
+		}
+	}
+
+	if notSent > 0 {
+		return fmt.Errorf("slot cancellation not emailed to %d of %d students", notSent, len(students))
+	}
+	return nil
+}
+
+// applySlotUpdate copies update onto slot, in UTC. Creating needs both times
+// and a capacity, and a slot cannot be created in the past.
+func applySlotUpdate(slot *core.AvailabilitySlot, update SlotUpdate, create bool) error {
+	verr := &ValidationError{}
+	if update.StartsAt != nil {
+		if create && !update.StartsAt.After(time.Now()) {
+			verr.add("starts_at", "must be in the future")
+		}
+		slot.StartsAt = update.StartsAt.UTC()
+	} else if create {
+		verr.add("starts_at", "is required")
+	}
+	if update.EndsAt != nil {
+		slot.EndsAt = update.EndsAt.UTC()
+	} else if create {
+		verr.add("ends_at", "is required")
+	}
+	if update.Timezone != nil {
+		tz := strings.TrimSpace(*update.Timezone)
+		if _, err := time.LoadLocation(tz); err != nil || tz == "" || tz == "Local" {
+			verr.add("timezone", "must be an IANA time zone such as Europe/London")
+		} else {
+			slot.Timezone = tz
+		}
+	}
+	if update.Capacity != nil {
+		if *update.Capacity < 1 {
+			verr.add("capacity", "must be at least 1")
+		}
+		slot.Capacity = *update.Capacity
+	} else if create {
+		verr.add("capacity", "is required")
+	}
+	if update.Location != nil {
+		location := strings.TrimSpace(*update.Location)
+		if len(location) > maxSlotLocation {
+			verr.add("location", fmt.Sprintf("must be at most %d characters", maxSlotLocation))
+		}
+		slot.Location = location
+	}
+	if !slot.StartsAt.IsZero() && !slot.EndsAt.IsZero() {
+		if !slot.EndsAt.After(slot.StartsAt) {
+			verr.add("ends_at", "must be after starts_at")
+		} else if slot.EndsAt.Sub(slot.StartsAt) > maxSlotLength {
+			verr.add("ends_at", fmt.Sprintf("must be at most %s after starts_at", maxSlotLength))
+		}
+	}
+	return verr.errOrNil()
+}
+
+// SlotCancellationNotifier emails the students of cancelled slots
+type SlotCancellationNotifier struct {
+	svc      *IdentityService
+	interval time.Duration
+}
+
+func NewSlotCancellationNotifier(svc *IdentityService, interval time.Duration) *SlotCancellationNotifier {
+	return &SlotCancellationNotifier{svc: svc, interval: interval}
+}
+
+// Run polls for cancelled slots to email until ctx is cancelled
+func (n *SlotCancellationNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			slot, err := n.svc.repo.ClaimSlotCancellation(time.Now())
+			if err != nil {
+				log.Printf("Failed to claim cancelled slot to email: %v", err)
+				break
+			}
+			if slot == nil {
+				break
+			}
+			if err := n.svc.NotifySlotCancelled(slot); err != nil {
+				log.Printf("Failed to email cancellation of slot %s: %v", slot.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
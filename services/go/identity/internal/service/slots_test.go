@@ -0,0 +1,181 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"gorm.io/gorm"
+)
+
+func newSlotService(t *testing.T) (*IdentityService, *gorm.DB, *orgTree, *core.User) {
+	t.Helper()
+	svc, db := newTestService(t, &core.AvailabilitySlot{}, &core.SlotBooking{})
+	return svc, db, createOrgTree(t, db), createUser(t, db, core.UserTypeInstructor)
+}
+
+// slotAt returns a slot request for the hour starting hours from now
+func slotAt(classID string, hours, capacity int) SlotRequest {
+	start := time.Now().Truncate(time.Hour).Add(time.Duration(hours) * time.Hour)
+	end := start.Add(time.Hour)
+	return SlotRequest{ClassID: classID, StartsAt: &start, EndsAt: &end, Capacity: &capacity, Timezone: "Europe/London", Location: "Room 4"}
+}
+
+func TestSlotsOfAnInstructorDoNotOverlap(t *testing.T) {
+	svc, _, tree, instructor := newSlotService(t)
+
+	slot, err := svc.CreateSlot(instructor.ID.String(), slotAt(tree.Class.ID.String(), 24, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.StartsAt.Location().String() != "Europe/London" {
+		t.Errorf("slot times are in %s, want its timezone", slot.StartsAt.Location())
+	}
+
+	overlapping := slotAt("", 24, 1)
+	later := overlapping.StartsAt.Add(30 * time.Minute)
+	overlapping.StartsAt = &later
+	if _, err := svc.CreateSlot(instructor.ID.String(), overlapping); !errors.Is(err, repository.ErrSlotOverlap) {
+		t.Errorf("overlapping slot: got %v, want ErrSlotOverlap", err)
+	}
+	if _, err := svc.CreateSlot(instructor.ID.String(), slotAt("", 25, 1)); err != nil {
+		t.Errorf("slot right after the first: %v", err)
+	}
+}
+
+func TestCreateSlotValidates(t *testing.T) {
+	svc, db, tree, instructor := newSlotService(t)
+
+	past := slotAt(tree.Class.ID.String(), -2, 0)
+	past.Timezone = "Mars/Olympus"
+	_, err := svc.CreateSlot(instructor.ID.String(), past)
+	if verr := validationErrorOf(t, err); !hasFieldError(verr, "starts_at") || !hasFieldError(verr, "capacity") || !hasFieldError(verr, "timezone") {
+		t.Errorf("past slot without seats: got %v", verr)
+	}
+
+	long := slotAt(tree.Class.ID.String(), 24, 1)
+	end := long.StartsAt.Add(maxSlotLength + time.Hour)
+	long.EndsAt = &end
+	if verr := validationErrorOf(t, func() error { _, err := svc.CreateSlot(instructor.ID.String(), long); return err }()); !hasFieldError(verr, "ends_at") {
+		t.Errorf("slot longer than %s: got %v", maxSlotLength, verr)
+	}
+
+	student := createUser(t, db, core.UserTypeStudent)
+	if _, err := svc.CreateSlot(student.ID.String(), slotAt("", 24, 1)); !errors.Is(err, ErrNotInstructor) {
+		t.Errorf("student holding office hours: got %v, want ErrNotInstructor", err)
+	}
+}
+
+func TestBookSlotRespectsEnrollmentAndCapacity(t *testing.T) {
+	svc, db, tree, instructor := newSlotService(t)
+	slot, err := svc.CreateSlot(instructor.ID.String(), slotAt(tree.Class.ID.String(), 24, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := createUser(t, db, core.UserTypeStudent)
+	second := createUser(t, db, core.UserTypeStudent)
+
+	if _, _, err := svc.BookSlot(first.ID.String(), slot.ID.String()); !errors.Is(err, ErrNotEnrolledInClass) {
+		t.Fatalf("booking another class's slot: got %v, want ErrNotEnrolledInClass", err)
+	}
+	for _, s := range []*core.User{first, second} {
+		if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", s.ID.String(), false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, booked, err := svc.BookSlot(first.ID.String(), slot.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if booked.SeatsTaken != 1 {
+		t.Errorf("seats taken = %d, want 1", booked.SeatsTaken)
+	}
+	if _, _, err := svc.BookSlot(first.ID.String(), slot.ID.String()); !errors.Is(err, repository.ErrAlreadyBooked) {
+		t.Errorf("booking twice: got %v, want ErrAlreadyBooked", err)
+	}
+	if _, _, err := svc.BookSlot(second.ID.String(), slot.ID.String()); !errors.Is(err, repository.ErrSlotFull) {
+		t.Errorf("booking a full slot: got %v, want ErrSlotFull", err)
+	}
+
+	// Only the student or the instructor may free the seat
+	if err := svc.CancelBooking(second.ID.String(), slot.ID.String(), first.ID.String()); !errors.Is(err, ErrNotBookingParty) {
+		t.Errorf("another student cancelling: got %v, want ErrNotBookingParty", err)
+	}
+	if err := svc.CancelBooking(instructor.ID.String(), slot.ID.String(), first.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.BookSlot(second.ID.String(), slot.ID.String()); err != nil {
+		t.Errorf("booking the freed seat: %v", err)
+	}
+
+	smaller := 0
+	if _, err := svc.UpdateSlot(instructor.ID.String(), slot.ID.String(), SlotUpdate{Capacity: &smaller}); err == nil {
+		t.Error("capacity lowered to 0 with a seat booked")
+	}
+}
+
+func TestCancelledSlotEmailsBookedStudents(t *testing.T) {
+	svc, db, tree, instructor := newSlotService(t)
+	var sent []string
+	var template string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			TemplateName string `json:"template_name"`
+			Recipients   []struct {
+				Email string `json:"email"`
+			} `json:"recipients"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		template = payload.TemplateName
+		results := []map[string]string{}
+		for _, rcpt := range payload.Recipients {
+			sent = append(sent, rcpt.Email)
+			results = append(results, map[string]string{"recipient": rcpt.Email, "status": "queued"})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	t.Cleanup(server.Close)
+	svc.cfg.EmailServiceURL = server.URL
+
+	slot, err := svc.CreateSlot(instructor.ID.String(), slotAt(tree.Class.ID.String(), 24, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	student := createUser(t, db, core.UserTypeStudent)
+	if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", student.ID.String(), false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.BookSlot(student.ID.String(), slot.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.CancelSlot(student.ID.String(), slot.ID.String()); !errors.Is(err, ErrNotSlotInstructor) {
+		t.Errorf("student cancelling the slot: got %v, want ErrNotSlotInstructor", err)
+	}
+	if err := svc.CancelSlot(instructor.ID.String(), slot.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.BookSlot(student.ID.String(), slot.ID.String()); !errors.Is(err, repository.ErrSlotCancelled) {
+		t.Errorf("booking a cancelled slot: got %v, want ErrSlotCancelled", err)
+	}
+
+	claimed, err := svc.repo.ClaimSlotCancellation(time.Now())
+	if err != nil || claimed == nil || claimed.ID != slot.ID {
+		t.Fatalf("claimed %v, %v; want the cancelled slot", claimed, err)
+	}
+	if again, err := svc.repo.ClaimSlotCancellation(time.Now()); err != nil || again != nil {
+		t.Errorf("claimed a notified slot again: %v, %v", again, err)
+	}
+	if err := svc.NotifySlotCancelled(claimed); err != nil {
+		t.Fatal(err)
+	}
+	if template != slotCancelledTemplate || len(sent) != 1 || sent[0] != student.Email {
+		t.Errorf("sent %s to %v, want the cancellation to the booked student", template, sent)
+	}
+}
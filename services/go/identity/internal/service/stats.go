@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/cache"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// GetInstituteStats returns the dashboard counts of an institute
+func (s *IdentityService) GetInstituteStats(ctx context.Context, instituteID string) (*repository.OrgStats, error) {
+	id, err := uuid.Parse(instituteID)
+	if err != nil {
+		return nil, repository.ErrInstituteNotFound
+	}
+	return s.orgStats(ctx, cache.ScopeInstitute, id, s.repo.InstituteStats)
+}
+
+// GetDepartmentStats returns the dashboard counts of a department
+func (s *IdentityService) GetDepartmentStats(ctx context.Context, departmentID string) (*repository.OrgStats, error) {
+	id, err := uuid.Parse(departmentID)
+	if err != nil {
+		return nil, repository.ErrDepartmentNotFound
+	}
+	return s.orgStats(ctx, cache.ScopeDepartment, id, s.repo.DepartmentStats)
+}
+
+// orgStats serves stats from the cache when it can. Cache failures are
+// logged and the counts computed instead.
+func (s *IdentityService) orgStats(ctx context.Context, scope string, id uuid.UUID, compute func(uuid.UUID, time.Time) (*repository.OrgStats, error)) (*repository.OrgStats, error) {
+	if s.stats != nil {
+		stats, err := s.stats.Get(ctx, scope, id)
+		if err != nil {
+			log.Printf("Failed to read cached %s stats for %s: %v", scope, id, err)
+		} else if stats != nil {
+			return stats, nil
+		}
+	}
+
+	stats, err := compute(id, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	if s.stats != nil {
+		if err := s.stats.Set(ctx, scope, id, stats); err != nil {
+			log.Printf("Failed to cache %s stats for %s: %v", scope, id, err)
+		}
+	}
+	return stats, nil
+}
+
+// classScope returns the department and institute of a class
+func (s *IdentityService) classScope(classID string) (uuid.UUID, uuid.UUID, error) {
+	id, err := uuid.Parse(classID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, repository.ErrClassNotFound
+	}
+	return s.repo.ClassScope(id)
+}
+
+// invalidateClassStats drops the cached stats covering a class after its
+// enrollments changed
+func (s *IdentityService) invalidateClassStats(classID string) {
+	if s.stats == nil {
+		return
+	}
+	departmentID, instituteID, err := s.classScope(classID)
+	if err != nil {
+		log.Printf("Failed to find the department of class %s to invalidate its stats: %v", classID, err)
+		return
+	}
+	s.invalidateStats(departmentID, instituteID)
+}
+
+func (s *IdentityService) invalidateStats(departmentID, instituteID uuid.UUID) {
+	if s.stats == nil {
+		return
+	}
+	if err := s.stats.Invalidate(context.Background(), departmentID, instituteID); err != nil {
+		log.Printf("Failed to invalidate stats of department %s: %v", departmentID, err)
+	}
+}
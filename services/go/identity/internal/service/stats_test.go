@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/cache"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// countingStats stands in for the aggregate queries, which need Postgres
+type countingStats struct {
+	calls int
+}
+
+func (c *countingStats) compute(id uuid.UUID, now time.Time) (*repository.OrgStats, error) {
+	c.calls++
+	return &repository.OrgStats{OrgUnitStats: repository.OrgUnitStats{Enrollments: int64(c.calls)}, GeneratedAt: now}, nil
+}
+
+func TestStatsCachedUntilEnrollmentsChange(t *testing.T) {
+	svc, db := newTestService(t)
+	mr := miniredis.RunT(t)
+	svc.stats = cache.NewStatsCache(redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1}), time.Minute)
+	tree := createOrgTree(t, db)
+	student := createUser(t, db, core.UserTypeStudent)
+	ctx := context.Background()
+
+	department, institute := &countingStats{}, &countingStats{}
+	get := func() {
+		t.Helper()
+		if _, err := svc.orgStats(ctx, cache.ScopeDepartment, tree.Department.ID, department.compute); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.orgStats(ctx, cache.ScopeInstitute, tree.Institute.ID, institute.compute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get()
+	get()
+	if department.calls != 1 || institute.calls != 1 {
+		t.Fatalf("computed department stats %d and institute stats %d times, want once each", department.calls, institute.calls)
+	}
+
+	if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", student.ID.String(), false, false); err != nil {
+		t.Fatal(err)
+	}
+	get()
+	if department.calls != 2 || institute.calls != 2 {
+		t.Errorf("after an enrollment: computed %d and %d times, want the cached stats dropped", department.calls, institute.calls)
+	}
+
+	// Without Redis the stats are still served
+	mr.Close()
+	stats, err := svc.orgStats(ctx, cache.ScopeDepartment, tree.Department.ID, department.compute)
+	if err != nil || stats == nil {
+		t.Errorf("with Redis down: got %v, %v", stats, err)
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+// dateLayout is how term dates are written in requests
+const dateLayout = "2006-01-02"
+
+// TermRequest creates or updates a term. Dates are YYYY-MM-DD and inclusive.
+// On update, empty fields and a missing is_current are left unchanged.
+type TermRequest struct {
+	Name      string `json:"name"`
+	StartsOn  string `json:"starts_on"`
+	EndsOn    string `json:"ends_on"`
+	IsCurrent *bool  `json:"is_current"`
+}
+
+// today is the current date in UTC, which term dates are compared against
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+func (s *IdentityService) CreateTerm(instituteID string, req TermRequest) (*core.Term, error) {
+	id, err := parseID("institute_id", instituteID)
+	if err != nil {
+		return nil, err
+	}
+	term := &core.Term{InstituteID: id}
+	if err := applyTermRequest(term, req, true); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateTerm(term); err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+func (s *IdentityService) termVersion(instituteID, id string) func() (int, error) {
+	return func() (int, error) {
+		term, err := s.repo.GetTermByID(instituteID, id)
+		if err != nil {
+			return 0, err
+		}
+		return term.Version, nil
+	}
+}
+
+func (s *IdentityService) UpdateTerm(instituteID, id string, req TermRequest, expectedVersion *int) (*core.Term, error) {
+	term, err := s.repo.GetTermByID(instituteID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(term.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+	if err := applyTermRequest(term, req, false); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateTerm(term); err != nil {
+		return nil, versionConflict(err, s.termVersion(instituteID, id))
+	}
+	return term, nil
+}
+
+func (s *IdentityService) DeleteTerm(instituteID, id string) error {
+	return s.repo.DeleteTerm(instituteID, id)
+}
+
+func (s *IdentityService) GetTerm(instituteID, id string) (*core.Term, error) {
+	return s.repo.GetTermByID(instituteID, id)
+}
+
+func (s *IdentityService) GetTerms(instituteID string) ([]core.Term, error) {
+	if _, err := s.repo.GetInstituteByID(instituteID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTermsByInstitute(instituteID)
+}
+
+// GetCurrentTerm returns the institute's term running today, or the one
+// marked current between terms
+func (s *IdentityService) GetCurrentTerm(instituteID string) (*core.Term, error) {
+	term, err := s.repo.GetCurrentTerm(instituteID, today())
+	if errors.Is(err, repository.ErrNoCurrentTerm) {
+		// Tell a missing institute apart from one without terms
+		if _, instErr := s.repo.GetInstituteByID(instituteID); instErr != nil {
+			return nil, instErr
+		}
+	}
+	return term, err
+}
+
+// ListClasses returns the classes of a department, of a term, or of both
+func (s *IdentityService) ListClasses(departmentID, termID string) ([]core.Class, error) {
+	var filter repository.ClassFilter
+	if departmentID != "" {
+		id, err := parseID("department_id", departmentID)
+		if err != nil {
+			return nil, err
+		}
+		filter.DepartmentID = &id
+	}
+	if termID != "" {
+		id, err := parseID("term_id", termID)
+		if err != nil {
+			return nil, err
+		}
+		filter.TermID = &id
+	}
+	if filter.DepartmentID == nil && filter.TermID == nil {
+		ve := &ValidationError{}
+		ve.add("department_id", "department_id or term_id is required")
+		return nil, ve
+	}
+	return s.repo.ListClasses(filter)
+}
+
+// ClassSummary is a class with its term, nil for classes without one, and
+// the instructors of its sections
+type ClassSummary struct {
+	ID            uuid.UUID   `json:"id"`
+	Name          string      `json:"name"`
+	Term          *core.Term  `json:"term"`
+	InstructorIDs []uuid.UUID `json:"instructor_ids"`
+}
+
+// MaxBatchClasses bounds how many classes can be fetched in one call
+const MaxBatchClasses = 200
+
+// GetClassSummaries returns the classes with the given IDs, deleted ones
+// included. Unknown IDs are left out rather than failing the batch.
+func (s *IdentityService) GetClassSummaries(ids []string) ([]ClassSummary, error) {
+	if len(ids) > MaxBatchClasses {
+		ve := &ValidationError{}
+		ve.add("ids", fmt.Sprintf("must have at most %d entries", MaxBatchClasses))
+		return nil, ve
+	}
+	parsed := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		uid, err := parseID("ids", id)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, uid)
+	}
+	summaries := []ClassSummary{}
+	if len(parsed) == 0 {
+		return summaries, nil
+	}
+
+	classes, err := s.repo.GetClassesByIDs(parsed)
+	if err != nil {
+		return nil, err
+	}
+	for _, class := range classes {
+		summary := ClassSummary{ID: class.ID, Name: class.Name, Term: class.Term, InstructorIDs: []uuid.UUID{}}
+		for _, section := range class.Sections {
+			if section.InstructorID != nil && !slices.Contains(summary.InstructorIDs, *section.InstructorID) {
+				summary.InstructorIDs = append(summary.InstructorIDs, *section.InstructorID)
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// classTerm parses the term a class is given and checks it belongs to the
+// institute of the class's department
+func (s *IdentityService) classTerm(departmentID uuid.UUID, termID string) (*uuid.UUID, error) {
+	id, err := parseID("term_id", termID)
+	if err != nil {
+		return nil, err
+	}
+	term, err := s.repo.GetTermByID("", termID)
+	if errors.Is(err, repository.ErrTermNotFound) {
+		ve := &ValidationError{}
+		ve.add("term_id", "does not exist")
+		return nil, ve
+	}
+	if err != nil {
+		return nil, err
+	}
+	instituteID, err := s.repo.DepartmentInstituteID(departmentID)
+	if err != nil {
+		return nil, err
+	}
+	if term.InstituteID != instituteID {
+		ve := &ValidationError{}
+		ve.add("term_id", "must be a term of the class's institute")
+		return nil, ve
+	}
+	return &id, nil
+}
+
+// applyTermRequest copies req onto term. Creating needs every field; an
+// update only changes the ones sent.
+func applyTermRequest(term *core.Term, req TermRequest, create bool) error {
+	verr := &ValidationError{}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		term.Name = name
+	} else if create {
+		verr.add("name", "is required")
+	}
+	setDate(&term.StartsOn, "starts_on", req.StartsOn, create, verr)
+	setDate(&term.EndsOn, "ends_on", req.EndsOn, create, verr)
+	if req.IsCurrent != nil {
+		term.IsCurrent = *req.IsCurrent
+	}
+	if len(verr.Errors) == 0 && term.EndsOn.Before(term.StartsOn) {
+		verr.add("ends_on", "must not be before starts_on")
+	}
+	return verr.errOrNil()
+}
+
+func setDate(dst *time.Time, field, value string, required bool, verr *ValidationError) {
+	if value == "" {
+		if required {
+			verr.add(field, "is required")
+		}
+		return
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		verr.add(field, "must be a date as YYYY-MM-DD")
+		return
+	}
+	*dst = date
+}
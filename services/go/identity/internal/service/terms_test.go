@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+// day formats the date offset days from today as a term request wants it
+func day(offset int) string {
+	return today().AddDate(0, 0, offset).Format(dateLayout)
+}
+
+func TestTermsDoNotOverlap(t *testing.T) {
+	svc, db := newTestService(t, &core.Term{})
+	tree := createOrgTree(t, db)
+	inst := tree.Institute.ID.String()
+
+	spring, err := svc.CreateTerm(inst, TermRequest{Name: "Spring", StartsOn: day(-30), EndsOn: day(30), IsCurrent: boolPtr(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreateTerm(inst, TermRequest{Name: "Overlap", StartsOn: day(30), EndsOn: day(60)}); !errors.Is(err, repository.ErrTermOverlap) {
+		t.Fatalf("creating a term starting on the last day of another = %v, want ErrTermOverlap", err)
+	}
+	if _, err := svc.CreateTerm(inst, TermRequest{Name: "Backwards", StartsOn: day(90), EndsOn: day(80)}); !hasFieldError(validationErrorOf(t, err), "ends_on") {
+		t.Fatalf("term ending before it starts = %v", err)
+	}
+
+	// Another institute's calendar is its own
+	other := createOrgTree(t, db)
+	if _, err := svc.CreateTerm(other.Institute.ID.String(), TermRequest{Name: "Spring", StartsOn: day(-30), EndsOn: day(30), IsCurrent: boolPtr(true)}); err != nil {
+		t.Fatalf("same dates in another institute: %v", err)
+	}
+
+	// Marking the next term current unmarks spring
+	summer, err := svc.CreateTerm(inst, TermRequest{Name: "Summer", StartsOn: day(31), EndsOn: day(90), IsCurrent: boolPtr(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := svc.GetTerm(inst, spring.ID.String()); got.IsCurrent {
+		t.Error("spring is still marked current")
+	}
+
+	// The term running today wins over the one marked current
+	current, err := svc.GetCurrentTerm(inst)
+	if err != nil || current.ID != spring.ID {
+		t.Errorf("current term = %v, %v; want spring, which runs today", current, err)
+	}
+	if err := svc.DeleteTerm(inst, spring.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := svc.GetCurrentTerm(inst); err != nil || current.ID != summer.ID {
+		t.Errorf("current term between terms = %v, %v; want the one marked current", current, err)
+	}
+}
+
+func TestEnrollmentClosesWhenTermEnds(t *testing.T) {
+	svc, db := newTestService(t, &core.Term{})
+	tree := createOrgTree(t, db)
+	inst := tree.Institute.ID.String()
+	past, err := svc.CreateTerm(inst, TermRequest{Name: "Autumn", StartsOn: day(-120), EndsOn: day(-1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, err := svc.CreateTerm(inst, TermRequest{Name: "Spring", StartsOn: day(0), EndsOn: day(90)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ended, err := svc.CreateClass(tree.Department.ID.String(), "Old", nil, past.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, err := svc.CreateClass(tree.Department.ID.String(), "New", nil, running.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	student := createUser(t, db, core.UserTypeStudent)
+
+	if _, err := svc.EnrollStudent(ended.ID.String(), "", student.ID.String(), false, false); !errors.Is(err, repository.ErrTermEnded) {
+		t.Fatalf("enrolling after the term ended = %v, want ErrTermEnded", err)
+	}
+	if res, err := svc.EnrollStudent(ended.ID.String(), "", student.ID.String(), false, true); err != nil || !res.Enrolled {
+		t.Fatalf("overriding the term end = %+v, %v", res, err)
+	}
+	if res, err := svc.EnrollStudent(open.ID.String(), "", student.ID.String(), false, false); err != nil || !res.Enrolled {
+		t.Fatalf("enrolling on the term's first day = %+v, %v", res, err)
+	}
+
+	if err := svc.DeleteTerm(inst, past.ID.String()); !errors.Is(err, repository.ErrTermHasClasses) {
+		t.Errorf("deleting a term with classes = %v, want ErrTermHasClasses", err)
+	}
+	classes, err := svc.ListClasses("", running.ID.String())
+	if err != nil || len(classes) != 1 || classes[0].ID != open.ID {
+		t.Errorf("classes of the running term = %v, %v", classes, err)
+	}
+}
+
+func TestClassTermMustBeOfItsInstitute(t *testing.T) {
+	svc, db := newTestService(t, &core.Term{})
+	tree := createOrgTree(t, db)
+	other := createOrgTree(t, db)
+	term, err := svc.CreateTerm(other.Institute.ID.String(), TermRequest{Name: "Spring", StartsOn: day(0), EndsOn: day(90)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = svc.CreateClass(tree.Department.ID.String(), "Mixed", nil, term.ID.String())
+	if !hasFieldError(validationErrorOf(t, err), "term_id") {
+		t.Errorf("class in another institute's term = %v", err)
+	}
+	termID := term.ID.String()
+	_, err = svc.UpdateClass(tree.Class.ID.String(), "", nil, false, &termID, true, nil)
+	if !hasFieldError(validationErrorOf(t, err), "term_id") {
+		t.Errorf("moving a class into another institute's term = %v", err)
+	}
+}
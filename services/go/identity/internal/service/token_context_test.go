@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+func TestGetTokenContext(t *testing.T) {
+	svc, db := newTestService(t)
+	tree := createOrgTree(t, db)
+	student := createUser(t, db, core.UserTypeStudent)
+	if _, err := svc.EnrollStudent(tree.Class.ID.String(), "", student.ID.String(), false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tc, err := svc.GetTokenContext(student.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tc.ClassIDs) != 1 || tc.ClassIDs[0] != tree.Class.ID {
+		t.Errorf("classes = %v, want the enrolled class", tc.ClassIDs)
+	}
+	if len(tc.InstituteIDs) != 1 || tc.InstituteIDs[0] != tree.Institute.ID {
+		t.Errorf("institutes = %v, want the class's institute", tc.InstituteIDs)
+	}
+
+	loner := createUser(t, db, core.UserTypeInstructor)
+	tc, err = svc.GetTokenContext(loner.ID.String())
+	if err != nil || tc.ClassIDs == nil || tc.InstituteIDs == nil || len(tc.ClassIDs)+len(tc.InstituteIDs) != 0 {
+		t.Errorf("context of a user in no unit = %+v, %v; want empty lists", tc, err)
+	}
+
+	if _, err := svc.GetTokenContext(uuid.NewString()); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+}
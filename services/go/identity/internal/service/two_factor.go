@@ -0,0 +1,135 @@
+package service
+
+import (
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// maxRecoveryCodes bounds how many recovery code hashes one setup may store
+const maxRecoveryCodes = 20
+
+// TwoFactorStatus is a user's TOTP enrollment as AuthN needs it to check
+// codes. Secret is still encrypted with AuthN's key.
+type TwoFactorStatus struct {
+	Secret            string     `json:"secret"`
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+// TwoFactorSetupRequest starts a TOTP enrollment with the secret and
+// recovery code hashes AuthN generated
+type TwoFactorSetupRequest struct {
+	Secret             string   `json:"secret"`
+	RecoveryCodeHashes []string `json:"recovery_code_hashes"`
+}
+
+// RecoveryCodeRequest names a recovery code by its hash
+type RecoveryCodeRequest struct {
+	CodeHash string `json:"code_hash"`
+}
+
+// GetTwoFactor returns the user's TOTP enrollment, confirmed or not
+func (s *IdentityService) GetTwoFactor(userID string) (*TwoFactorStatus, error) {
+	id, err := parseID("id", userID)
+	if err != nil {
+		return nil, err
+	}
+	tf, err := s.repo.GetTwoFactor(id)
+	if err != nil {
+		return nil, err
+	}
+	left, err := s.repo.CountRecoveryCodes(id)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorStatus{
+		Secret:            tf.Secret,
+		Enabled:           tf.EnabledAt != nil,
+		EnabledAt:         tf.EnabledAt,
+		RecoveryCodesLeft: left,
+	}, nil
+}
+
+// SetUpTwoFactor stores a new, unconfirmed enrollment for the user, replacing
+// an earlier unconfirmed one. Logins do not ask for codes until it is
+// confirmed with EnableTwoFactor.
+func (s *IdentityService) SetUpTwoFactor(userID string, req TwoFactorSetupRequest) error {
+	id, err := parseID("id", userID)
+	if err != nil {
+		return err
+	}
+	ve := &ValidationError{}
+	if req.Secret == "" {
+		ve.add("secret", "is required")
+	}
+	if len(req.RecoveryCodeHashes) == 0 {
+		ve.add("recovery_code_hashes", "is required")
+	} else if len(req.RecoveryCodeHashes) > maxRecoveryCodes {
+		ve.add("recovery_code_hashes", "must hold at most 20 hashes")
+	}
+	for _, hash := range req.RecoveryCodeHashes {
+		if hash == "" {
+			ve.add("recovery_code_hashes", "must not hold empty hashes")
+			break
+		}
+	}
+	if err := ve.errOrNil(); err != nil {
+		return err
+	}
+	if _, err := s.repo.GetUserByID(userID); err != nil {
+		return err
+	}
+
+	return s.repo.SaveTwoFactorSetup(&core.UserTwoFactor{UserID: id, Secret: req.Secret}, req.RecoveryCodeHashes)
+}
+
+// EnableTwoFactor confirms the user's enrollment, after AuthN checked a code
+// generated from it. From then on their logins ask for a code.
+func (s *IdentityService) EnableTwoFactor(userID string) error {
+	id, err := parseID("id", userID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.EnableTwoFactor(id, time.Now().UTC()); err != nil {
+		return err
+	}
+	s.recordActivity("user.enable_two_factor", "user", userID,
+		map[string]any{"two_factor_enabled": false}, map[string]any{"two_factor_enabled": true})
+	return nil
+}
+
+// DisableTwoFactor removes the user's enrollment and recovery codes
+func (s *IdentityService) DisableTwoFactor(userID string) error {
+	id, err := parseID("id", userID)
+	if err != nil {
+		return err
+	}
+	tf, err := s.repo.GetTwoFactor(id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteTwoFactor(id); err != nil {
+		return err
+	}
+	if tf.EnabledAt != nil {
+		s.recordActivity("user.disable_two_factor", "user", userID,
+			map[string]any{"two_factor_enabled": true}, map[string]any{"two_factor_enabled": false})
+	}
+	return nil
+}
+
+// UseRecoveryCode spends one of the user's recovery codes; each works once
+func (s *IdentityService) UseRecoveryCode(userID string, req RecoveryCodeRequest) error {
+	id, err := parseID("id", userID)
+	if err != nil {
+		return err
+	}
+	if req.CodeHash == "" {
+		ve := &ValidationError{}
+		ve.add("code_hash", "is required")
+		return ve
+	}
+	return s.repo.UseRecoveryCode(id, req.CodeHash)
+}
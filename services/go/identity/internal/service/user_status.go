@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+var (
+	ErrUserAlreadyInactive = errors.New("user is already deactivated")
+	ErrUserNotDeactivated  = errors.New("user is not deactivated")
+	// ErrSessionsNotRevoked means the session service could not be reached to
+	// log a user out; the user is left active so the call can be retried
+	ErrSessionsNotRevoked = errors.New("could not revoke the user's sessions")
+)
+
+// DeactivateUser disables the user, so they can no longer log in, removes
+// them as head of any faculty or department, and revokes their sessions,
+// logging them out everywhere once access token deny lists catch up. If the
+// sessions cannot be revoked the user is put back as they were, though not
+// as head.
+func (s *IdentityService) DeactivateUser(ctx context.Context, id string) (*core.User, error) {
+	user, err := s.repo.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == "disabled" {
+		return nil, ErrUserAlreadyInactive
+	}
+	before := activitySnapshot(user)
+	previous := user.Status
+
+	user.Status = "disabled"
+	user.IsActive = false
+	if err := s.repo.DeactivateUser(user); err != nil {
+		return nil, versionConflict(err, s.userVersion(id))
+	}
+
+	if err := s.sessions.RevokeUserSessions(ctx, id); err != nil {
+		user.Status = previous
+		user.IsActive = true
+		if restoreErr := s.repo.UpdateUser(user); restoreErr != nil {
+			log.Printf("Failed to reactivate user %s after their sessions could not be revoked: %v", id, restoreErr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrSessionsNotRevoked, err)
+	}
+	s.recordActivity("user.deactivate", "user", id, before, user)
+	return user, nil
+}
+
+// ReactivateUser lets a deactivated user log in again. They are active once
+// more, or pending if they never confirmed their email.
+func (s *IdentityService) ReactivateUser(id string) (*core.User, error) {
+	user, err := s.repo.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != "disabled" {
+		return nil, ErrUserNotDeactivated
+	}
+	before := activitySnapshot(user)
+
+	user.Status = "active"
+	if !user.EmailVerified {
+		user.Status = "pending"
+	}
+	user.IsActive = true
+	if err := s.repo.UpdateUser(user); err != nil {
+		return nil, versionConflict(err, s.userVersion(id))
+	}
+	s.recordActivity("user.reactivate", "user", id, before, user)
+	return user, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"gorm.io/gorm"
+)
+
+// fakeSessionService records the users whose sessions were revoked, or
+// fails every call while down
+type fakeSessionService struct {
+	mu      sync.Mutex
+	revoked []string
+	down    bool
+}
+
+func (f *fakeSessionService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	f.revoked = append(f.revoked, r.URL.Path)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newUserStatusService(t *testing.T) (*IdentityService, *gorm.DB, *fakeSessionService) {
+	t.Helper()
+	svc, db := newTestService(t)
+	sessions := &fakeSessionService{}
+	server := httptest.NewServer(sessions)
+	t.Cleanup(server.Close)
+	svc.sessions = clients.NewSession(clients.Config{BaseURL: server.URL, MaxRetries: -1})
+	return svc, db, sessions
+}
+
+func TestDeactivatingUserRevokesTheirSessions(t *testing.T) {
+	svc, db, sessions := newUserStatusService(t)
+	user := createUser(t, db, core.UserTypeStudent)
+
+	sessions.down = true
+	if _, err := svc.DeactivateUser(context.Background(), user.ID.String()); !errors.Is(err, ErrSessionsNotRevoked) {
+		t.Fatalf("deactivating with the session service down: got %v, want ErrSessionsNotRevoked", err)
+	}
+	if restored, _ := svc.GetUser(user.ID.String()); restored.Status != "active" {
+		t.Fatalf("user left %s after the revocation failed, want active", restored.Status)
+	}
+
+	sessions.down = false
+	deactivated, err := svc.DeactivateUser(context.Background(), user.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deactivated.Status != "disabled" || deactivated.IsActive {
+		t.Errorf("deactivated user is %s", deactivated.Status)
+	}
+	if want := "/internal/users/" + user.ID.String() + "/sessions/revoke"; len(sessions.revoked) != 1 || sessions.revoked[0] != want {
+		t.Errorf("revoked %v, want %s", sessions.revoked, want)
+	}
+	if _, err := svc.DeactivateUser(context.Background(), user.ID.String()); !errors.Is(err, ErrUserAlreadyInactive) {
+		t.Errorf("deactivating twice: got %v, want ErrUserAlreadyInactive", err)
+	}
+
+	reactivated, err := svc.ReactivateUser(user.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reactivated.Status != "pending" {
+		t.Errorf("reactivated user with an unconfirmed email is %s, want pending", reactivated.Status)
+	}
+	if _, err := svc.ReactivateUser(user.ID.String()); !errors.Is(err, ErrUserNotDeactivated) {
+		t.Errorf("reactivating an active user: got %v, want ErrUserNotDeactivated", err)
+	}
+}
+
+func TestDeactivatingHeadClearsOrgUnits(t *testing.T) {
+	svc, db, _ := newUserStatusService(t)
+	tree := createOrgTree(t, db)
+	head := createUser(t, db, core.UserTypeInstructor)
+	if _, err := svc.SetFacultyHead(tree.Faculty.ID.String(), head.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetDepartmentHead(tree.Department.ID.String(), head.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.DeactivateUser(context.Background(), head.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	faculty, err := svc.GetFaculty(tree.Faculty.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if faculty.HeadUserID != nil || faculty.Head != nil {
+		t.Errorf("faculty still headed by deactivated user: %v", faculty.HeadUserID)
+	}
+	dept, err := svc.GetDepartment(tree.Department.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dept.HeadUserID != nil || dept.Head != nil {
+		t.Errorf("department still headed by deactivated user: %v", dept.HeadUserID)
+	}
+}
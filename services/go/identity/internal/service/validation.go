@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	instituteCodePattern = regexp.MustCompile(`^[A-Z0-9-]{2,16}$`)
+	hostnameLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+)
+
+// FieldError describes a problem with a single request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects field-level problems with a request. Conflict is
+// set when a value is well-formed but clashes with existing data.
+type ValidationError struct {
+	Errors   []FieldError
+	Conflict bool
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message})
+}
+
+// errOrNil returns nil when no field errors were collected
+func (e *ValidationError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func newConflictError(field, message string) *ValidationError {
+	return &ValidationError{
+		Errors:   []FieldError{{Field: field, Message: message}},
+		Conflict: true,
+	}
+}
+
+// VersionConflictError is returned when an update was based on a version
+// that is no longer current. It wraps repository.ErrConflict.
+type VersionConflictError struct {
+	CurrentVersion int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("resource was modified by another request (current version %d)", e.CurrentVersion)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return repository.ErrConflict
+}
+
+// checkVersion fails fast when the client's expected version is already stale
+func checkVersion(current int, expected *int) error {
+	if expected != nil && *expected != current {
+		return &VersionConflictError{CurrentVersion: current}
+	}
+	return nil
+}
+
+// versionConflict turns repository.ErrConflict into a VersionConflictError
+// carrying the version now stored, so the client can reload and retry
+func versionConflict(err error, reload func() (int, error)) error {
+	if !errors.Is(err, repository.ErrConflict) {
+		return err
+	}
+	current, reloadErr := reload()
+	if reloadErr != nil {
+		return err
+	}
+	return &VersionConflictError{CurrentVersion: current}
+}
+
+// isValidHostname reports whether domain is a valid DNS hostname with at least two labels
+func isValidHostname(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if !hostnameLabelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeDomain lower-cases and trims a domain so uniqueness is case-insensitive
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSpace(domain))
+}
+
+// normalizeEmail lower-cases and trims an email so Foo@x.edu and foo@x.edu
+// are the same account
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateCapacity allows no capacity (unlimited) or any non-negative one;
+// zero closes a class to new enrollments
+func validateCapacity(capacity *int) error {
+	if capacity != nil && *capacity < 0 {
+		ve := &ValidationError{}
+		ve.add("capacity", "must not be negative")
+		return ve
+	}
+	return nil
+}
+
+// parseID parses a UUID taken from the request, reporting a bad one as a
+// validation error on field
+func parseID(field, value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		ve := &ValidationError{}
+		ve.add(field, "must be a valid UUID")
+		return uuid.Nil, ve
+	}
+	return id, nil
+}
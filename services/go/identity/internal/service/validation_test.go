@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+)
+
+// validationErrorOf returns err as a ValidationError, failing the test if
+// it is not one
+func validationErrorOf(t *testing.T, err error) *ValidationError {
+	t.Helper()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, want a ValidationError", err)
+	}
+	return verr
+}
+
+func hasFieldError(verr *ValidationError, field string) bool {
+	for _, fe := range verr.Errors {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInstituteCodeFormat(t *testing.T) {
+	svc, _ := newTestService(t)
+
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		{"UOM", true},
+		{"NSBM-2", true},
+		{"AB", true},
+		{"ABCDEFGHIJKLMNOP", true},
+		{"A", false},
+		{"ABCDEFGHIJKLMNOPQ", false},
+		{"uom", false},
+		{"U O M", false},
+		{"UOM_1", false},
+		{"", false},
+	}
+	for i, tt := range tests {
+		domain := "u" + string(rune('a'+i)) + ".example.edu"
+		_, err := svc.CreateInstitute(CreateInstituteRequest{Name: "Uni", Code: tt.code, Domain: domain, ContactEmail: "admin@" + domain})
+		if tt.valid && err != nil {
+			t.Errorf("code %q: %v", tt.code, err)
+		}
+		if !tt.valid {
+			verr := validationErrorOf(t, err)
+			if verr.Conflict || !hasFieldError(verr, "code") {
+				t.Errorf("code %q: got %+v, want a code field error", tt.code, verr)
+			}
+		}
+	}
+}
+
+func TestInstituteDomainFormat(t *testing.T) {
+	svc, _ := newTestService(t)
+
+	for i, domain := range []string{"localhost", "uni..edu", "-uni.edu", "uni.edu/", "http://uni.edu", "uni edu.lk", ""} {
+		code := "BAD" + string(rune('A'+i))
+		_, err := svc.CreateInstitute(CreateInstituteRequest{Name: "Uni", Code: code, Domain: domain, ContactEmail: "admin@uni.edu"})
+		if verr := validationErrorOf(t, err); verr.Conflict || !hasFieldError(verr, "domain") {
+			t.Errorf("domain %q: got %+v, want a domain field error", domain, verr)
+		}
+	}
+
+	inst, err := svc.CreateInstitute(CreateInstituteRequest{Name: "Uni", Code: "UNI", Domain: "  Uni.Example.EDU ", ContactEmail: "admin@uni.example.edu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Domain != "uni.example.edu" {
+		t.Errorf("domain stored as %q, want it trimmed and lower-cased", inst.Domain)
+	}
+}
+
+func TestInstituteCodeAndDomainUnique(t *testing.T) {
+	svc, _ := newTestService(t)
+	first, err := svc.CreateInstitute(CreateInstituteRequest{Name: "Uni", Code: "UNI", Domain: "uni.example.edu", ContactEmail: "admin@uni.example.edu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = svc.CreateInstitute(CreateInstituteRequest{Name: "Other", Code: "UNI", Domain: "other.example.edu", ContactEmail: "admin@other.example.edu"})
+	if verr := validationErrorOf(t, err); !verr.Conflict || !hasFieldError(verr, "code") {
+		t.Errorf("duplicate code: got %+v, want a code conflict", verr)
+	}
+
+	_, err = svc.CreateInstitute(CreateInstituteRequest{Name: "Other", Code: "OTHER", Domain: "UNI.example.edu", ContactEmail: "admin@other.example.edu"})
+	if verr := validationErrorOf(t, err); !verr.Conflict || !hasFieldError(verr, "domain") {
+		t.Errorf("domain differing by case: got %+v, want a domain conflict", verr)
+	}
+
+	second, err := svc.CreateInstitute(CreateInstituteRequest{Name: "Other", Code: "OTHER", Domain: "other.example.edu", ContactEmail: "admin@other.example.edu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.UpdateInstitute(second.ID.String(), InstituteUpdate{Code: strPtr("UNI")}, nil)
+	if verr := validationErrorOf(t, err); !verr.Conflict || !hasFieldError(verr, "code") {
+		t.Errorf("renaming to a used code: got %+v, want a code conflict", verr)
+	}
+	// Keeping its own code is not a clash with itself
+	if _, err := svc.UpdateInstitute(first.ID.String(), InstituteUpdate{Name: strPtr("Renamed"), Code: strPtr("UNI")}, nil); err != nil {
+		t.Errorf("updating with the institute's own code: %v", err)
+	}
+}
+
+func TestEnrollmentNumberUniquePerInstitute(t *testing.T) {
+	svc, db := newTestService(t)
+	a := createOrgTree(t, db).Institute
+	b := createOrgTree(t, db).Institute
+
+	register := func(email, enrollment, instituteID string) error {
+		_, err := svc.RegisterUser(CreateUserRequest{
+			Email:            email,
+			FullName:         "Student",
+			UserType:         core.UserTypeStudent,
+			EnrollmentNumber: enrollment,
+			InstituteID:      instituteID,
+		})
+		return err
+	}
+
+	if err := register("blank@example.com", "   ", a.ID.String()); !hasFieldError(validationErrorOf(t, err), "enrollment_number") {
+		t.Errorf("blank enrollment number: got %v", err)
+	}
+	if err := register("first@example.com", "E/2024/001", a.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+	err := register("second@example.com", "E/2024/001", a.ID.String())
+	if verr := validationErrorOf(t, err); !verr.Conflict || !hasFieldError(verr, "enrollment_number") {
+		t.Errorf("enrollment number reused in an institute: got %+v, want a conflict", verr)
+	}
+	// Another institute may use the same numbering
+	if err := register("third@example.com", "E/2024/001", b.ID.String()); err != nil {
+		t.Errorf("enrollment number reused in another institute: %v", err)
+	}
+}
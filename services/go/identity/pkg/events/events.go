@@ -0,0 +1,60 @@
+// Package events defines the domain events the identity service publishes to
+// the "identity.events" topic exchange. Consumers unmarshal the Envelope and
+// then its Payload into the struct matching Envelope.Type.
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Exchange is the RabbitMQ topic exchange identity events are published to
+const Exchange = "identity.events"
+
+// Event types, also used as routing keys
+const (
+	TypeUserCreated         = "user.created"
+	TypeUserDeleted         = "user.deleted"
+	TypeInstituteAdminAdded = "institute_admin.added"
+	TypeEnrollmentCreated   = "enrollment.created"
+	TypeUserMerged          = "user.merged"
+)
+
+// Envelope wraps every event. ID is unique per event; a relay retry can
+// deliver the same event twice, so consumers should de-duplicate on it.
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	EntityID   string          `json:"entity_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+type UserCreated struct {
+	UserID   string `json:"user_id"`
+	Email    string `json:"email"`
+	FullName string `json:"full_name"`
+	UserType string `json:"user_type"`
+}
+
+type UserDeleted struct {
+	UserID string `json:"user_id"`
+}
+
+type InstituteAdminAdded struct {
+	InstituteID string `json:"institute_id"`
+	UserID      string `json:"user_id"`
+}
+
+type EnrollmentCreated struct {
+	ClassID   string `json:"class_id"`
+	SectionID string `json:"section_id"`
+	StudentID string `json:"student_id"`
+}
+
+// UserMerged is published when a duplicate account is folded into a primary
+// one. Services holding DuplicateUserID should re-point it to PrimaryUserID.
+type UserMerged struct {
+	PrimaryUserID   string `json:"primary_user_id"`
+	DuplicateUserID string `json:"duplicate_user_id"`
+}
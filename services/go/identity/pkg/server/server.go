@@ -0,0 +1,163 @@
+// Package server builds the identity service the way cmd/server runs it,
+// short of opening its databases or listening, so that tests can serve it
+// in-process on stand-ins.
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/request"
+	"github.com/4yrg/gradeloop-core/libs/rpc"
+	identityv1 "github.com/4yrg/gradeloop-core/libs/rpc/identity/v1"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/api"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/authz"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/events"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/grpcapi"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/identity/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+)
+
+// Config is the service's configuration, named here so that callers outside
+// the module can adjust one
+type Config = config.Config
+
+// LoadConfig reads the configuration from the environment, as main does
+func LoadConfig() *Config {
+	return config.Load()
+}
+
+// Models are the service's tables. The versioned migrations are written for
+// Postgres; a test database such as SQLite is migrated from these instead.
+func Models() []interface{} {
+	return []interface{}{
+		&core.User{},
+		&core.StudentProfile{},
+		&core.InstructorProfile{},
+		&core.InstituteAdminProfile{},
+		&core.Institute{},
+		&core.Faculty{},
+		&core.Department{},
+		&core.Term{},
+		&core.Class{},
+		&core.ClassSection{},
+		&core.ClassEnrollment{},
+		&core.ClassWaitlistEntry{},
+		&core.OutboxEvent{},
+		&core.UserMerge{},
+		&core.ExportJob{},
+		&core.LoginEvent{},
+		&core.Announcement{},
+		&core.DeletionTombstone{},
+		&core.FeatureFlag{},
+		&core.InstituteFeatureOverride{},
+		&core.AvailabilitySlot{},
+		&core.SlotBooking{},
+		&core.PolicyDocument{},
+		&core.UserPolicyAcceptance{},
+		&core.ActivityEntry{},
+		&core.UserTwoFactor{},
+		&core.UserRecoveryCode{},
+		&core.InstituteBranding{},
+		&core.GuardianLink{},
+	}
+}
+
+// Server is the HTTP and gRPC APIs and the service they share
+type Server struct {
+	// App serves every HTTP route
+	App *fiber.App
+	// GRPC serves the gRPC API, checking the internal token
+	GRPC *grpc.Server
+	// Service is what both APIs call
+	Service *service.IdentityService
+
+	cfg     *Config
+	repo    *repository.Repository
+	replica *repository.Replica
+}
+
+// New builds the server on db, whose schema is expected to be migrated.
+// Heavy read-only queries go to replicaDB unless it is nil.
+func New(cfg *Config, db, replicaDB *gorm.DB) *Server {
+	s := &Server{cfg: cfg, repo: repository.NewRepository(db)}
+	if replicaDB != nil {
+		s.replica = repository.NewReplica(replicaDB)
+		s.repo = s.repo.WithReplica(s.replica)
+	}
+	s.Service = service.NewIdentityService(s.repo, cfg)
+
+	verifierCfg := jwtauth.Config{JWKSURL: cfg.AuthNJWKSURL}
+	if cfg.RedisAddr != "" {
+		// Reject access tokens of sessions revoked before the tokens expire
+		verifierCfg.DenyList = jwtauth.NewDenyList(redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Username: cfg.RedisUsername,
+			Password: cfg.RedisPassword,
+			DB:       cfg.RedisDB,
+		}), cfg.DenyListCacheTTL)
+	}
+	handler := api.NewHandler(s.Service, jwtauth.NewVerifier(verifierCfg), authz.NewClient(cfg.AuthZServiceURL, cfg.InternalToken))
+
+	s.App = fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler, BodyLimit: request.DefaultBodyLimit})
+	s.App.Use(logger.New())
+	s.App.Use(recover.New())
+	api.SetupRoutes(s.App, handler)
+	s.App.Get("/debug/db", database.StatsHandler(db))
+
+	s.GRPC = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(rpc.RequireInternalToken(cfg.InternalToken)),
+		grpc.ChainStreamInterceptor(rpc.RequireInternalTokenStream(cfg.InternalToken)),
+	)
+	identityv1.RegisterUserServiceServer(s.GRPC, grpcapi.NewServer(s.Service))
+	return s
+}
+
+// Start lower-cases stored emails, then starts the work that runs next to
+// the APIs until ctx is done: relaying outbox events, the activity log,
+// exports, notifications and watching the replica
+func (s *Server) Start(ctx context.Context) {
+	// Case-variant duplicates are reported, not merged
+	conflicts, err := s.repo.NormalizeEmails()
+	if err != nil {
+		log.Printf("Warning: Failed to normalize emails: %v", err)
+	}
+	for _, conflict := range conflicts {
+		log.Printf("Warning: users %v share email %s; merge them via POST /internal/identity/users/merge", conflict.UserIDs, conflict.Email)
+	}
+
+	if s.replica != nil {
+		go s.replica.Watch(ctx, s.cfg.ReplicaCheckInterval)
+	}
+
+	// Relay outbox events to RabbitMQ; without a broker they wait in the outbox
+	if s.cfg.RabbitMQAPIURL != "" {
+		publisher := events.NewRabbitMQPublisher(s.cfg.RabbitMQAPIURL, s.cfg.RabbitMQVHost)
+		go events.NewRelay(s.repo, publisher, s.cfg.OutboxPollInterval, s.cfg.OutboxBatchSize).Run(ctx)
+	} else {
+		log.Printf("Warning: RABBITMQ_API_URL not set, identity events will stay in the outbox")
+	}
+
+	// Write the activity log of admin changes in the background
+	go s.Service.RunActivityLog(ctx)
+
+	// Build queued data exports in the background
+	go service.NewExportWorker(s.Service, s.cfg.ExportPollInterval, s.cfg.ExportRetention).Run(ctx)
+
+	// Email announcements sent with notify once they are published
+	go service.NewAnnouncementNotifier(s.Service, s.cfg.AnnouncementPollInterval).Run(ctx)
+
+	// Tell students when office hours they booked are cancelled
+	go service.NewSlotCancellationNotifier(s.Service, s.cfg.SlotNotifyPollInterval).Run(ctx)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestServerServesWithoutMain(t *testing.T) {
+	t.Setenv("INTERNAL_SECRET", "insecure-secret-for-dev")
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(Models()...); err != nil {
+		t.Fatal(err)
+	}
+	srv := New(LoadConfig(), db, nil)
+
+	req := httptest.NewRequest("POST", "/internal/identity/users", strings.NewReader(`{"email":"ada@example.com","name":"Ada Lovelace","role":"ADMIN"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", "insecure-secret-for-dev")
+	resp, err := srv.App.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	if resp.StatusCode != 201 {
+		t.Fatalf("POST /internal/identity/users = %d %v", resp.StatusCode, created)
+	}
+
+	req = httptest.NewRequest("GET", "/internal/identity/users/"+created["id"].(string), nil)
+	req.Header.Set("X-Internal-Token", "insecure-secret-for-dev")
+	resp, err = srv.App.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&user)
+	if resp.StatusCode != 200 || user["email"] != "ada@example.com" {
+		t.Fatalf("GET the registered user = %d %v", resp.StatusCode, user)
+	}
+}
+
+func TestUserAPIVersions(t *testing.T) {
+	t.Setenv("INTERNAL_SECRET", "insecure-secret-for-dev")
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(Models()...); err != nil {
+		t.Fatal(err)
+	}
+	srv := New(LoadConfig(), db, nil)
+
+	call := func(method, path, body string) (*http.Response, map[string]any) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Internal-Token", "insecure-secret-for-dev")
+		resp, err := srv.App.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp, out
+	}
+
+	// v1 speaks the legacy names both ways...
+	resp, v1 := call("POST", "/api/v1/users", `{"email":"ada@example.com","full_name":"Ada Lovelace","user_type":"ADMIN"}`)
+	if resp.StatusCode != 201 || v1["full_name"] != "Ada Lovelace" || v1["user_type"] != "ADMIN" || v1["name"] != nil {
+		t.Fatalf("POST /api/v1/users = %d %v", resp.StatusCode, v1)
+	}
+	if resp.Header.Get("Deprecation") == "" || resp.Header.Get("Sunset") == "" {
+		t.Errorf("v1 response lacks Deprecation or Sunset: %v", resp.Header)
+	}
+
+	// ...but identity stored and serves the canonical ones
+	id := v1["id"].(string)
+	resp, internal := call("GET", "/internal/identity/users/"+id, "")
+	if resp.StatusCode != 200 || internal["name"] != "Ada Lovelace" || internal["role"] != "ADMIN" {
+		t.Fatalf("GET the user registered on v1 = %d %v", resp.StatusCode, internal)
+	}
+
+	resp, v1 = call("PATCH", "/api/v1/users/"+id, `{"full_name":"Ada King"}`)
+	if resp.StatusCode != 200 || v1["full_name"] != "Ada King" {
+		t.Fatalf("PATCH /api/v1/users/:id = %d %v", resp.StatusCode, v1)
+	}
+
+	// v2 passes the canonical names through untouched, and is not deprecated
+	resp, v2 := call("GET", "/api/v2/users/"+id, "")
+	if resp.StatusCode != 200 || v2["name"] != "Ada King" || v2["role"] != "ADMIN" || v2["full_name"] != nil {
+		t.Fatalf("GET /api/v2/users/:id = %d %v", resp.StatusCode, v2)
+	}
+	if resp.Header.Get("Deprecation") != "" {
+		t.Errorf("v2 response is marked deprecated")
+	}
+	resp, v2 = call("POST", "/api/v2/users", `{"email":"alan@example.com","name":"Alan Turing","role":"ADMIN"}`)
+	if resp.StatusCode != 201 || v2["name"] != "Alan Turing" {
+		t.Fatalf("POST /api/v2/users = %d %v", resp.StatusCode, v2)
+	}
+
+	// Lists are mapped item by item
+	resp, page := call("GET", "/api/v1/users", "")
+	items, _ := page["items"].([]any)
+	if resp.StatusCode != 200 || len(items) != 2 {
+		t.Fatalf("GET /api/v1/users = %d %v", resp.StatusCode, page)
+	}
+	for _, item := range items {
+		if u := item.(map[string]any); u["full_name"] == nil || u["name"] != nil {
+			t.Errorf("v1 list item %v is not in legacy names", u)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	libconfig "github.com/4yrg/gradeloop-core/libs/config"
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+	"github.com/4yrg/gradeloop-core/libs/request"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/notification/internal/api"
+	"github.com/4yrg/gradeloop-core/services/go/notification/internal/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, line := range libconfig.Dump(cfg) {
+		log.Printf("config: %s", line)
+	}
+
+	// Events arrive through Redis, so there is nothing to serve without it
+	rdb, err := redisfactory.Connect(context.Background(), cfg.Redis)
+	if err != nil {
+		log.Fatalf("failed to connect to redis: %v", err)
+	}
+
+	// Reject access tokens of sessions revoked before the tokens expire
+	verifier := jwtauth.NewVerifier(jwtauth.Config{
+		JWKSURL:  cfg.AuthNJWKSURL,
+		DenyList: jwtauth.NewDenyList(rdb, cfg.DenyListCacheTTL),
+	})
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler, BodyLimit: request.DefaultBodyLimit})
+	app.Use(logger.New())
+	api.SetupRoutes(app, api.NewHandler(rdb, cfg.Heartbeat), verifier)
+
+	log.Printf("Notification Service starting on port %s", cfg.Port)
+	log.Fatal(app.Listen(":" + cfg.Port))
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/userevents"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type Handler struct {
+	rdb       redis.UniversalClient
+	heartbeat time.Duration
+}
+
+func NewHandler(rdb redis.UniversalClient, heartbeat time.Duration) *Handler {
+	return &Handler{rdb: rdb, heartbeat: heartbeat}
+}
+
+func SetupRoutes(app *fiber.App, h *Handler, verifier *jwtauth.Verifier) {
+	notifications := app.Group("/api/v1/notifications")
+	notifications.Get("/stream", tokenFromQuery, jwtauth.Middleware(verifier), h.Stream)
+}
+
+// tokenFromQuery accepts the access token as ?access_token=, since the
+// browser's EventSource cannot set an Authorization header
+func tokenFromQuery(c *fiber.Ctx) error {
+	if c.Get(fiber.HeaderAuthorization) == "" {
+		if token := c.Query("access_token"); token != "" {
+			c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
+	}
+	return c.Next()
+}
+
+// Stream sends the caller's events as Server-Sent Events until they
+// disconnect. A client reconnecting with Last-Event-ID (or ?last_event_id=)
+// first gets the buffered events it missed.
+func (h *Handler) Stream(c *fiber.Ctx) error {
+	userID := jwtauth.ClaimsFrom(c).UserID
+	lastID := c.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+	if lastID != "" && !userevents.ValidID(lastID) {
+		return apierror.BadRequest("Last-Event-ID is not an event ID")
+	}
+
+	// Subscribe before reading the buffer, so an event published in between
+	// is not lost; stream drops the copy that arrives twice
+	sub := h.rdb.Subscribe(context.Background(), userevents.Channel(userID))
+	if _, err := sub.Receive(c.UserContext()); err != nil {
+		sub.Close()
+		log.Printf("Failed to subscribe to events of user %s: %v", userID, err)
+		return apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "notifications are unavailable")
+	}
+	var missed []userevents.Event
+	if lastID != "" {
+		var err error
+		missed, err = userevents.Since(c.UserContext(), h.rdb, userID, lastID)
+		if err != nil {
+			sub.Close()
+			log.Printf("Failed to replay events of user %s: %v", userID, err)
+			return apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "notifications are unavailable")
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	// Keep nginx-style proxies from buffering the stream
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		ticker := time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+		stream(w, lastID, missed, sub.Channel(), ticker.C)
+	})
+	return nil
+}
+
+// stream writes the missed events, then every event from messages newer than
+// the last one written, and a comment line on each heartbeat. It returns once
+// a write fails because the client went away, or messages is closed.
+func stream(w *bufio.Writer, lastID string, missed []userevents.Event, messages <-chan *redis.Message, heartbeat <-chan time.Time) {
+	for _, event := range missed {
+		writeEvent(w, event)
+		lastID = event.ID
+	}
+	if err := w.Flush(); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			event, err := userevents.Decode(msg.Payload)
+			if err != nil {
+				log.Printf("Dropped malformed event on %s: %v", msg.Channel, err)
+				continue
+			}
+			if !userevents.Newer(event.ID, lastID) {
+				continue
+			}
+			writeEvent(w, event)
+			lastID = event.ID
+		case <-heartbeat:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes the event as one SSE message whose data is the event as
+// JSON, so EventSource.onmessage sees every type
+func writeEvent(w *bufio.Writer, event userevents.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %s\ndata: %s\n\n", event.ID, data)
+}
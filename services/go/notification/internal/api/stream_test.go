@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/userevents"
+	"github.com/redis/go-redis/v9"
+)
+
+func message(t *testing.T, id string) *redis.Message {
+	t.Helper()
+	payload, err := json.Marshal(userevents.Event{ID: id, Type: userevents.TypeGradeReleased, Data: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &redis.Message{Channel: userevents.Channel("user-1"), Payload: string(payload)}
+}
+
+func TestStreamSkipsEventsAlreadySent(t *testing.T) {
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	missed := []userevents.Event{
+		{ID: "100-0", Type: userevents.TypeGradeReleased, Data: json.RawMessage(`{}`)},
+		{ID: "101-0", Type: userevents.TypeGradeReleased, Data: json.RawMessage(`{}`)},
+	}
+	messages := make(chan *redis.Message, 4)
+	// 101-0 was published between subscribing and replaying the buffer, so
+	// it arrives on the channel as well
+	messages <- message(t, "101-0")
+	messages <- &redis.Message{Payload: "not json"}
+	messages <- message(t, "102-0")
+	close(messages)
+
+	stream(w, "99-0", missed, messages, make(chan time.Time))
+
+	var ids []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	if strings.Join(ids, ",") != "100-0,101-0,102-0" {
+		t.Errorf("streamed %v, want each event once in order", ids)
+	}
+}
+
+func TestStreamSendsHeartbeats(t *testing.T) {
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	messages := make(chan *redis.Message)
+	heartbeat := make(chan time.Time)
+	done := make(chan struct{})
+	go func() {
+		stream(w, "", nil, messages, heartbeat)
+		close(done)
+	}()
+
+	heartbeat <- time.Now()
+	close(messages)
+	<-done
+	if !strings.Contains(out.String(), ": heartbeat\n\n") {
+		t.Errorf("stream wrote %q, want a heartbeat comment", out.String())
+	}
+}
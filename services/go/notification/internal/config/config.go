@@ -0,0 +1,37 @@
+package config
+
+import (
+	"time"
+
+	libconfig "github.com/4yrg/gradeloop-core/libs/config"
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+)
+
+type Config struct {
+	Port         string `env:"PORT" default:"8007"`
+	AuthNJWKSURL string `env:"AUTHN_JWKS_URL" default:"http://localhost:8003/.well-known/jwks.json"`
+
+	// Carries the events and the access token deny list; see
+	// libs/redisfactory for Sentinel, Cluster and TLS
+	Redis redisfactory.Config
+
+	// Heartbeat is how often an idle stream sends a comment line, so proxies
+	// do not close it
+	Heartbeat        time.Duration `env:"NOTIFICATION_HEARTBEAT" default:"25s" min:"1s"`
+	DenyListCacheTTL time.Duration `env:"TOKEN_DENYLIST_CACHE_TTL" default:"5s" min:"0s"`
+}
+
+// Load reads the config from the environment, reporting every missing or
+// invalid variable at once
+func Load() (*Config, error) {
+	cfg := &Config{}
+	if err := libconfig.Load(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the Redis settings the chosen mode needs
+func (c *Config) Validate(p *libconfig.Problems) {
+	c.Redis.Validate(p)
+}
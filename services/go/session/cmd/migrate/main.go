@@ -0,0 +1,37 @@
+// Command migrate applies, reverts or lists the session schema migrations:
+//
+//	go run ./cmd/migrate up
+//	go run ./cmd/migrate down [n|all]
+//	go run ./cmd/migrate status
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/database/migrate"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/migrations"
+	"gorm.io/driver/postgres"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.Open(postgres.Open(cfg.DatabaseURL), database.DefaultPoolConfig)
+	if err != nil {
+		log.Fatalf("failed to connect database: %v", err)
+	}
+
+	migrator, err := migrations.NewRunner(db)
+	if err != nil {
+		log.Fatalf("failed to load migrations: %v", err)
+	}
+	if err := migrate.Command(context.Background(), migrator, os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
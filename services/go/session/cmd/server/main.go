@@ -1,92 +1,77 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
-	"os"
-	"time"
+	"net"
 
-	"github.com/4yrg/gradeloop-core/services/go/session/internal/api"
-	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
-	"github.com/4yrg/gradeloop-core/services/go/session/internal/repository/redis"
-	sqliteRepo "github.com/4yrg/gradeloop-core/services/go/session/internal/repository/sqlite"
-	"github.com/4yrg/gradeloop-core/services/go/session/internal/service"
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	goredis "github.com/redis/go-redis/v9"
+	libconfig "github.com/4yrg/gradeloop-core/libs/config"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/database/migrate"
+	"github.com/4yrg/gradeloop-core/libs/debugserver"
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/migrations"
+	"github.com/4yrg/gradeloop-core/services/go/session/pkg/server"
 	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 func main() {
 	// Configuration
-	sessionTTL := 24 * time.Hour          // Default session TTL
-	refreshTokenTTL := 7 * 24 * time.Hour // Default refresh token TTL
-	sqlitePath := os.Getenv("SQLITE_PATH")
-	if sqlitePath == "" {
-		sqlitePath = "session.db"
-	}
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379"
-	}
-	redisUsername := os.Getenv("REDIS_USERNAME")
-	if redisUsername == "" {
-		redisUsername = "default"
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
-	redisDB := 0
-	if dbStr := os.Getenv("REDIS_DB"); dbStr != "" {
-		var i int
-		if _, err := fmt.Sscanf(dbStr, "%d", &i); err == nil {
-			redisDB = i
-		}
+	for _, line := range libconfig.Dump(cfg) {
+		log.Printf("config: %s", line)
 	}
 
 	// 1. Initialize DB
-	dsn := os.Getenv("SESSION_DATABASE_URL")
-	if dsn == "" {
-		dsn = os.Getenv("DATABASE_URL")
-	}
-	if dsn == "" {
-		log.Fatal("SESSION_DATABASE_URL or DATABASE_URL must be set")
+	poolCfg, err := database.LoadPoolConfig("SESSION")
+	if err != nil {
+		log.Fatal(err)
 	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := database.Open(postgres.Open(cfg.DatabaseURL), poolCfg)
 	if err != nil {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	// Auto-migrate the schema
-	if err := db.AutoMigrate(&core.Session{}); err != nil {
+	// Apply pending schema migrations, or refuse to start while any are pending
+	migrator, err := migrations.NewRunner(db)
+	if err != nil {
+		log.Fatalf("failed to load migrations: %v", err)
+	}
+	if err := migrator.Boot(context.Background(), migrate.Mode(cfg.RunMigrations), log.Printf); err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
 
 	// 2. Initialize Redis
-	rdb := goredis.NewClient(&goredis.Options{
-		Addr:     redisAddr,
-		Username: redisUsername,
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       redisDB,
-	})
-
-	// 3. Initialize Repositories
-	sessionRepo := sqliteRepo.NewSessionRepository(db)
-	sessionCache := redis.NewSessionCache(rdb)
-
-	// 4. Initialize Service
-	sessionService := service.NewSessionService(sessionRepo, sessionCache, sessionTTL, refreshTokenTTL)
+	rdb, err := redisfactory.Connect(context.Background(), cfg.Redis)
+	if err != nil {
+		log.Fatalf("failed to connect to redis: %v", err)
+	}
 
-	// 5. Initialize Fiber
-	app := fiber.New()
-	app.Use(logger.New())
+	// 3. Initialize the service and both APIs
+	srv := server.New(cfg, db, rdb)
 
-	handler := api.NewHandler(sessionService)
-	api.RegisterRoutes(app, handler)
+	// Profiling and runtime stats on DEBUG_ADDR, off unless it is set
+	if err := debugserver.Start(
+		debugserver.Var{Name: "db_pool", Value: database.StatsFunc(db)},
+		debugserver.Var{Name: "anomalous_refreshes", Value: func() any { return srv.Service.AnomalousRefreshes() }},
+	); err != nil {
+		log.Fatal(err)
+	}
 
-	// 6. Start Server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8002"
+	// 4. Start the gRPC API, which shares the service with the HTTP one
+	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		log.Fatalf("failed to listen for gRPC: %v", err)
 	}
-	log.Printf("Session Service starting on port %s", port)
-	log.Fatal(app.Listen(":" + port))
+	go func() {
+		log.Printf("Session Service gRPC API starting on port %s", cfg.GRPCPort)
+		log.Fatal(srv.GRPC.Serve(lis))
+	}()
+
+	// 5. Start Server
+	log.Printf("Session Service starting on port %s", cfg.Port)
+	log.Fatal(srv.App.Listen(":" + cfg.Port))
 }
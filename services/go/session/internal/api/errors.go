@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/service"
+	"gorm.io/gorm"
+)
+
+// Session-specific error codes, on top of the shared catalogue
+const (
+	codeSessionLimitReached apierror.Code = "session_limit_reached"
+	codeSessionInvalid      apierror.Code = "session_invalid"
+)
+
+// apiError maps session errors to the shared error envelope
+func apiError(err error) error {
+	switch {
+	case errors.Is(err, core.ErrSessionLimitReached):
+		return apierror.Conflict(err.Error()).WithCode(codeSessionLimitReached)
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return apierror.NotFound("session not found")
+	case errors.Is(err, service.ErrInvalidSession):
+		return apierror.BadRequest(err.Error())
+	}
+	return apierror.FromRepository(err, "session")
+}
+
+// authError is apiError for validating and refreshing, where a session that
+// is missing, expired, revoked or presented with the wrong refresh token
+// means the caller is not authenticated
+func authError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrSessionExpired),
+		errors.Is(err, service.ErrSessionRevoked),
+		errors.Is(err, service.ErrInvalidToken),
+		errors.Is(err, service.ErrNotRefreshable):
+		return apierror.Unauthorized(err.Error()).WithCode(codeSessionInvalid)
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return apierror.Unauthorized("session not found").WithCode(codeSessionInvalid)
+	}
+	return apiError(err)
+}
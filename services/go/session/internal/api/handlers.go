@@ -3,6 +3,7 @@ package api
 import (
 	"time"
 
+	"github.com/4yrg/gradeloop-core/libs/apierror"
 	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -17,31 +18,62 @@ func NewHandler(useCase core.SessionUseCase) *Handler {
 }
 
 type CreateSessionRequest struct {
-	UserID    string `json:"user_id"`
+	UserID    string `json:"user_id" validate:"required"`
 	UserRole  string `json:"user_role"`
 	UserAgent string `json:"user_agent"`
 	ClientIP  string `json:"client_ip"`
 }
 
 type CreateSessionResponse struct {
-	SessionID    string `json:"session_id"`
-	RefreshToken string `json:"refresh_token"`
+	SessionID         string    `json:"session_id"`
+	RefreshToken      string    `json:"refresh_token"`
+	ExpiresAt         time.Time `json:"expires_at"`                    // When the session (refresh token) expires
+	AccessExpiresAt   time.Time `json:"access_expires_at"`             // exp to use for the access token
+	EvictedSessionIDs []string  `json:"evicted_session_ids,omitempty"` // Sessions revoked to stay within the per-user cap
 }
 
-func (h *Handler) CreateSession(c *fiber.Ctx) error {
-	var req CreateSessionRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+func (h *Handler) CreateSession(c *fiber.Ctx, req *CreateSessionRequest) error {
+	session, rawToken, evicted, err := h.useCase.CreateSession(c.Context(), req.UserID, req.UserRole, req.ClientIP, req.UserAgent)
+	if err != nil {
+		return apiError(err)
+	}
+
+	resp := CreateSessionResponse{
+		SessionID:       session.ID.String(),
+		RefreshToken:    rawToken,
+		ExpiresAt:       session.ExpiresAt,
+		AccessExpiresAt: session.AccessExpiresAt,
 	}
+	for _, id := range evicted {
+		resp.EvictedSessionIDs = append(resp.EvictedSessionIDs, id.String())
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+type CreateImpersonationSessionRequest struct {
+	CreateSessionRequest
+	ImpersonatorID string `json:"impersonator_id"`
+}
 
-	session, rawToken, err := h.useCase.CreateSession(c.Context(), req.UserID, req.UserRole, req.ClientIP, req.UserAgent)
+type CreateImpersonationSessionResponse struct {
+	SessionID       string    `json:"session_id"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+}
+
+// CreateImpersonationSession opens a support session for an admin acting as
+// the user. No refresh token is issued.
+func (h *Handler) CreateImpersonationSession(c *fiber.Ctx, req *CreateImpersonationSessionRequest) error {
+	session, err := h.useCase.CreateImpersonationSession(c.Context(), req.UserID, req.UserRole, req.ImpersonatorID, req.ClientIP, req.UserAgent)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err)
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(CreateSessionResponse{
-		SessionID:    session.ID.String(),
-		RefreshToken: rawToken,
+	return c.Status(fiber.StatusCreated).JSON(CreateImpersonationSessionResponse{
+		SessionID:       session.ID.String(),
+		ExpiresAt:       session.ExpiresAt,
+		AccessExpiresAt: session.AccessExpiresAt,
 	})
 }
 
@@ -58,89 +90,93 @@ type SessionResponse struct {
 	RotationCounter int        `json:"rotation_counter"`
 	CreatedAt       time.Time  `json:"created_at"`
 	ExpiresAt       time.Time  `json:"expires_at"`
+	AccessExpiresAt time.Time  `json:"access_expires_at"` // when the latest access token expires
 	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	// IsImpersonated marks support access by an admin acting as the user
+	IsImpersonated bool   `json:"is_impersonated"`
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
+	// The client of the latest refresh, left out until the first one
+	LastRefreshedAt      *time.Time `json:"last_refreshed_at,omitempty"`
+	LastRefreshIP        string     `json:"last_refresh_ip,omitempty"`
+	LastRefreshUserAgent string     `json:"last_refresh_user_agent,omitempty"`
 }
 
-func (h *Handler) ValidateSession(c *fiber.Ctx) error {
-	var req ValidateSessionRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+func toSessionResponse(session *core.Session) SessionResponse {
+	return SessionResponse{
+		ID:              session.ID.String(),
+		UserID:          session.UserID,
+		UserRole:        session.UserRole,
+		UserAgent:       session.UserAgent,
+		ClientIP:        session.ClientIP,
+		RotationCounter: session.RotationCounter,
+		CreatedAt:       session.CreatedAt,
+		ExpiresAt:       session.ExpiresAt,
+		AccessExpiresAt: session.LastAccessExpiry(),
+		RevokedAt:       session.RevokedAt,
+		IsImpersonated:  session.IsImpersonated(),
+		ImpersonatorID:  session.ImpersonatorID,
+
+		LastRefreshedAt:      session.LastRefreshedAt,
+		LastRefreshIP:        session.LastRefreshIP,
+		LastRefreshUserAgent: session.LastRefreshUserAgent,
 	}
+}
 
+func (h *Handler) ValidateSession(c *fiber.Ctx, req *ValidateSessionRequest) error {
 	id, err := uuid.Parse(req.SessionID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+		return apierror.Validation(apierror.FieldError{Field: "session_id", Message: "must be a valid UUID"})
 	}
 
 	session, err := h.useCase.ValidateSession(c.Context(), id)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		return authError(err)
 	}
 
-	return c.JSON(SessionResponse{
-		ID:              session.ID.String(),
-		UserID:          session.UserID,
-		UserRole:        session.UserRole,
-		UserAgent:       session.UserAgent,
-		ClientIP:        session.ClientIP,
-		RotationCounter: session.RotationCounter,
-		CreatedAt:       session.CreatedAt,
-		ExpiresAt:       session.ExpiresAt,
-		RevokedAt:       session.RevokedAt,
-	})
+	return c.JSON(toSessionResponse(session))
 }
 
 func (h *Handler) GetSession(c *fiber.Ctx) error {
 	idStr := c.Params("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+		return apierror.Validation(apierror.FieldError{Field: "session_id", Message: "must be a valid UUID"})
 	}
 
 	session, err := h.useCase.GetSession(c.Context(), id)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+		return apiError(err)
 	}
 
-	return c.JSON(SessionResponse{
-		ID:              session.ID.String(),
-		UserID:          session.UserID,
-		UserRole:        session.UserRole,
-		UserAgent:       session.UserAgent,
-		ClientIP:        session.ClientIP,
-		RotationCounter: session.RotationCounter,
-		CreatedAt:       session.CreatedAt,
-		ExpiresAt:       session.ExpiresAt,
-		RevokedAt:       session.RevokedAt,
-	})
+	return c.JSON(toSessionResponse(session))
 }
 
 type RefreshSessionRequest struct {
 	SessionID    string `json:"session_id"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
+	// The client refreshing, recorded in the session's refresh history
+	UserAgent string `json:"user_agent"`
+	ClientIP  string `json:"client_ip"`
 }
 
 type RefreshSessionResponse struct {
-	SessionID       string `json:"session_id"`
-	NewRefreshToken string `json:"new_refresh_token"`
-	UserID          string `json:"user_id"`
-	UserRole        string `json:"user_role"`
+	SessionID       string    `json:"session_id"`
+	NewRefreshToken string    `json:"new_refresh_token"`
+	UserID          string    `json:"user_id"`
+	UserRole        string    `json:"user_role"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	AccessExpiresAt time.Time `json:"access_expires_at"`
 }
 
-func (h *Handler) RefreshSession(c *fiber.Ctx) error {
-	var req RefreshSessionRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
-	}
-
+func (h *Handler) RefreshSession(c *fiber.Ctx, req *RefreshSessionRequest) error {
 	id, err := uuid.Parse(req.SessionID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+		return apierror.Validation(apierror.FieldError{Field: "session_id", Message: "must be a valid UUID"})
 	}
 
-	session, newRawToken, err := h.useCase.RefreshSession(c.Context(), id, req.RefreshToken)
+	session, newRawToken, err := h.useCase.RefreshSession(c.Context(), id, req.RefreshToken, req.ClientIP, req.UserAgent)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		return authError(err)
 	}
 
 	return c.JSON(RefreshSessionResponse{
@@ -148,6 +184,34 @@ func (h *Handler) RefreshSession(c *fiber.Ctx) error {
 		NewRefreshToken: newRawToken,
 		UserID:          session.UserID,
 		UserRole:        session.UserRole,
+		ExpiresAt:       session.ExpiresAt,
+		AccessExpiresAt: session.AccessExpiresAt,
+	})
+}
+
+type RefreshHistoryResponse struct {
+	SessionID       string              `json:"session_id"`
+	RotationCounter int                 `json:"rotation_counter"`
+	Events          []core.RefreshEvent `json:"events"`
+}
+
+// GetRefreshHistory returns the session's latest refreshes, newest first,
+// for admins investigating a possibly hijacked session
+func (h *Handler) GetRefreshHistory(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return apierror.Validation(apierror.FieldError{Field: "session_id", Message: "must be a valid UUID"})
+	}
+
+	session, events, err := h.useCase.GetRefreshHistory(c.Context(), id)
+	if err != nil {
+		return apiError(err)
+	}
+
+	return c.JSON(RefreshHistoryResponse{
+		SessionID:       session.ID.String(),
+		RotationCounter: session.RotationCounter,
+		Events:          events,
 	})
 }
 
@@ -155,11 +219,11 @@ func (h *Handler) RevokeSession(c *fiber.Ctx) error {
 	idStr := c.Params("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session id"})
+		return apierror.Validation(apierror.FieldError{Field: "session_id", Message: "must be a valid UUID"})
 	}
 
 	if err := h.useCase.RevokeSession(c.Context(), id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err)
 	}
 
 	return c.SendStatus(fiber.StatusOK)
@@ -168,12 +232,61 @@ func (h *Handler) RevokeSession(c *fiber.Ctx) error {
 func (h *Handler) RevokeUserSessions(c *fiber.Ctx) error {
 	userID := c.Params("userId")
 	if userID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user id required"})
+		return apierror.Validation(apierror.FieldError{Field: "user_id", Message: "is required"})
 	}
 
 	if err := h.useCase.RevokeAllUserSessions(c.Context(), userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return apiError(err)
 	}
 
 	return c.SendStatus(fiber.StatusOK)
 }
+
+// ListUserSessions returns session metadata only; refresh token hashes are
+// never included
+func (h *Handler) ListUserSessions(c *fiber.Ctx) error {
+	userID := c.Params("userId")
+	if userID == "" {
+		return apierror.Validation(apierror.FieldError{Field: "user_id", Message: "is required"})
+	}
+
+	sessions, err := h.useCase.ListUserSessions(c.Context(), userID)
+	if err != nil {
+		return apiError(err)
+	}
+
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, toSessionResponse(session))
+	}
+	return c.JSON(resp)
+}
+
+// GetUserPresence returns whether the user is online, when they were last
+// active and how many active sessions they hold
+func (h *Handler) GetUserPresence(c *fiber.Ctx) error {
+	userID := c.Params("userId")
+	if userID == "" {
+		return apierror.Validation(apierror.FieldError{Field: "user_id", Message: "is required"})
+	}
+
+	presence, err := h.useCase.GetPresence(c.Context(), []string{userID})
+	if err != nil {
+		return apiError(err)
+	}
+	return c.JSON(presence[0])
+}
+
+type PresenceRequest struct {
+	UserIDs []string `json:"user_ids" validate:"required,min=1,max=200"`
+}
+
+// GetPresence is GetUserPresence for up to 200 users at once, e.g. a class
+// roster. Every ID asked for gets an entry, in order.
+func (h *Handler) GetPresence(c *fiber.Ctx, req *PresenceRequest) error {
+	presence, err := h.useCase.GetPresence(c.Context(), req.UserIDs)
+	if err != nil {
+		return apiError(err)
+	}
+	return c.JSON(presence)
+}
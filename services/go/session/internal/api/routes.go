@@ -1,6 +1,7 @@
 package api
 
 import (
+	"github.com/4yrg/gradeloop-core/libs/request"
 	"github.com/4yrg/gradeloop-core/services/go/session/internal/middleware"
 	"github.com/gofiber/fiber/v2"
 )
@@ -10,12 +11,17 @@ func RegisterRoutes(app *fiber.App, handler *Handler) {
 	internal := app.Group("/internal", middleware.InternalAuth())
 
 	sessions := internal.Group("/sessions")
-	sessions.Post("/", handler.CreateSession)
-	sessions.Post("/validate", handler.ValidateSession)
-	sessions.Post("/refresh", handler.RefreshSession)
+	sessions.Post("/", request.Bind(handler.CreateSession))
+	sessions.Post("/impersonation", request.Bind(handler.CreateImpersonationSession))
+	sessions.Post("/validate", request.Bind(handler.ValidateSession))
+	sessions.Post("/refresh", request.Bind(handler.RefreshSession))
+	sessions.Post("/presence", request.Bind(handler.GetPresence))
+	sessions.Get("/user/:userId/presence", handler.GetUserPresence)
 	sessions.Post("/:id/revoke", handler.RevokeSession)
+	sessions.Get("/:id/refresh-history", handler.GetRefreshHistory)
 	sessions.Get("/:id", handler.GetSession)
 
 	users := internal.Group("/users")
+	users.Get("/:userId/sessions", handler.ListUserSessions)
 	users.Post("/:userId/sessions/revoke", handler.RevokeUserSessions)
 }
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	libconfig "github.com/4yrg/gradeloop-core/libs/config"
+	"github.com/4yrg/gradeloop-core/libs/redisfactory"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+)
+
+type Config struct {
+	Port        string `env:"PORT" default:"8002"`
+	GRPCPort    string `env:"GRPC_PORT" default:"9002"`
+	DatabaseURL string `env:"SESSION_DATABASE_URL,DATABASE_URL" required:"true"`
+	// auto applies pending migrations at startup; off refuses to start while any are pending
+	RunMigrations string `env:"RUN_MIGRATIONS" default:"auto" oneof:"auto,off"`
+
+	// REDIS_ADDR alone still describes a single node; see libs/redisfactory
+	// for Sentinel, Cluster and TLS
+	Redis redisfactory.Config
+
+	// Checked on gRPC calls; the HTTP routes read it in middleware.InternalAuth
+	InternalSecret string `env:"INTERNAL_SECRET" default:"insecure-secret-for-dev" secret:"true"`
+
+	AccessTokenTTL time.Duration `env:"ACCESS_TOKEN_TTL" default:"15m" min:"0s"`
+	SessionTTL     time.Duration `env:"SESSION_TTL" default:"168h" min:"0s"`
+	MaxLifetime    time.Duration `env:"SESSION_MAX_LIFETIME" default:"720h" min:"0s"`
+	InvalidTTL     time.Duration `env:"SESSION_INVALID_CACHE_TTL" default:"30s" min:"0s"`
+	// How long a rotated refresh token still gets its successor, for clients
+	// that refresh from two tabs at once; 0 disables
+	RefreshGrace time.Duration `env:"REFRESH_REUSE_GRACE" default:"10s" min:"0s"`
+
+	// A session's last use is written at most once per LastSeenGranularity;
+	// users who used an active session within PresenceOnlineWindow are online
+	LastSeenGranularity  time.Duration `env:"LAST_SEEN_GRANULARITY" default:"60s" min:"1s"`
+	PresenceOnlineWindow time.Duration `env:"PRESENCE_ONLINE_WINDOW" default:"5m" min:"1s"`
+
+	// How many of each session's latest refreshes are kept for investigations
+	RefreshHistoryLimit int `env:"REFRESH_HISTORY_LIMIT" default:"50" min:"1"`
+
+	// 0 means unlimited
+	MaxSessionsPerUser int    `env:"MAX_SESSIONS_PER_USER" default:"0" min:"0"`
+	SessionLimitPolicy string `env:"SESSION_LIMIT_POLICY" default:"reject" oneof:"reject,evict_oldest"`
+
+	// Filled from SESSION_TTL_<ROLE> and ACCESS_TOKEN_TTL_<ROLE>, e.g.
+	// SESSION_TTL_SYSTEM_ADMIN=1h
+	RoleOverrides map[string]core.RoleTTL
+}
+
+// Load reads the config from the environment, reporting every missing or
+// invalid variable at once
+func Load() (*Config, error) {
+	cfg := &Config{}
+	if err := libconfig.Load(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the Redis settings the chosen mode needs and collects the
+// per-role TTL overrides, which the field tags cannot describe since their
+// names are not known up front
+func (c *Config) Validate(p *libconfig.Problems) {
+	c.Redis.Validate(p)
+
+	c.RoleOverrides = make(map[string]core.RoleTTL)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		var role string
+		var target func(*core.RoleTTL, time.Duration)
+		switch {
+		case strings.HasPrefix(key, "SESSION_TTL_"):
+			role = strings.TrimPrefix(key, "SESSION_TTL_")
+			target = func(o *core.RoleTTL, d time.Duration) { o.SessionTTL = d }
+		case strings.HasPrefix(key, "ACCESS_TOKEN_TTL_"):
+			role = strings.TrimPrefix(key, "ACCESS_TOKEN_TTL_")
+			target = func(o *core.RoleTTL, d time.Duration) { o.AccessTokenTTL = d }
+		default:
+			continue
+		}
+		if value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			p.Add(key, "must be a non-negative duration such as 1h (got %q)", value)
+			continue
+		}
+		o := c.RoleOverrides[role]
+		target(&o, d)
+		c.RoleOverrides[role] = o
+	}
+}
+
+// TTL returns the session lifetimes for the service layer
+func (c *Config) TTL() core.TTLConfig {
+	return core.TTLConfig{
+		AccessTokenTTL: c.AccessTokenTTL,
+		SessionTTL:     c.SessionTTL,
+		MaxLifetime:    c.MaxLifetime,
+		InvalidTTL:     c.InvalidTTL,
+		RefreshGrace:   c.RefreshGrace,
+		RoleOverrides:  c.RoleOverrides,
+	}
+}
+
+// Presence returns how session use is recorded and read as presence
+func (c *Config) Presence() core.PresenceConfig {
+	return core.PresenceConfig{
+		SeenGranularity: c.LastSeenGranularity,
+		OnlineWindow:    c.PresenceOnlineWindow,
+	}
+}
+
+// RefreshHistory returns how refreshes are recorded. No GeoIP database is
+// configured, so refreshes are never flagged as anomalous.
+func (c *Config) RefreshHistory() core.RefreshHistoryConfig {
+	return core.RefreshHistoryConfig{Limit: c.RefreshHistoryLimit}
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshEvent is one refresh of a session and the client that made it,
+// kept so a hijacked session can be traced. Only the newest
+// RefreshHistoryConfig.Limit events of a session are kept.
+type RefreshEvent struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	SessionID uuid.UUID `gorm:"type:uuid;index" json:"session_id"`
+	// Rotation is the session's RotationCounter after the refresh
+	Rotation  int    `json:"rotation"`
+	ClientIP  string `json:"client_ip"`
+	UserAgent string `json:"user_agent"`
+	// Country and ASN are where the GeoLocator placed ClientIP, empty and
+	// zero when it could not
+	Country string `json:"country,omitempty"`
+	ASN     uint32 `gorm:"column:asn" json:"asn,omitempty"`
+	// Anomalous marks a refresh from another country or network than the
+	// previous one, for AnomalyReason. It is only recorded, never refused.
+	Anomalous     bool      `json:"anomalous"`
+	AnomalyReason string    `json:"anomaly_reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (RefreshEvent) TableName() string {
+	return "session_refresh_events"
+}
+
+// GeoLocation is where an IP address is, as far as a GeoLocator knows
+type GeoLocation struct {
+	Country string // ISO 3166-1 alpha-2 code
+	ASN     uint32 // Autonomous system the address is announced from
+}
+
+// GeoLocator places client IPs for the refresh history. It returns nil for
+// an address it knows nothing about.
+type GeoLocator interface {
+	Locate(ctx context.Context, ip string) (*GeoLocation, error)
+}
+
+// NoGeoLocator knows nothing about any address, so no refresh is ever
+// flagged as anomalous. It is the default.
+type NoGeoLocator struct{}
+
+func (NoGeoLocator) Locate(context.Context, string) (*GeoLocation, error) {
+	return nil, nil
+}
+
+// RefreshHistoryConfig sets how refreshes are recorded
+type RefreshHistoryConfig struct {
+	// Limit is how many of a session's latest refreshes are kept
+	Limit int
+	// Geo places refreshing clients; nil means NoGeoLocator
+	Geo GeoLocator
+}
@@ -2,11 +2,57 @@ package core
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// SessionLimitPolicy decides what happens when a user hits the session cap.
+type SessionLimitPolicy string
+
+const (
+	SessionLimitPolicyReject      SessionLimitPolicy = "reject"       // Refuse the new session
+	SessionLimitPolicyEvictOldest SessionLimitPolicy = "evict_oldest" // Revoke the oldest session to make room
+)
+
+var ErrSessionLimitReached = errors.New("maximum number of active sessions reached")
+
+// MaxImpersonationTTL is how long an impersonated session lasts. It cannot
+// be refreshed, so this is also the longest it can be used for.
+const MaxImpersonationTTL = 30 * time.Minute
+
+// TTLConfig holds session lifetimes. RoleOverrides replaces the access token
+// and session TTLs for specific user roles (e.g. shorter for SYSTEM_ADMIN).
+type TTLConfig struct {
+	AccessTokenTTL time.Duration // Lifetime of the JWT issued by authn
+	SessionTTL     time.Duration // Refresh token validity, extended on every refresh
+	MaxLifetime    time.Duration // Absolute cap measured from creation; 0 means none
+	InvalidTTL     time.Duration // How long a missing, revoked or expired session ID is remembered; 0 disables
+	RefreshGrace   time.Duration // How long a rotated refresh token still gets its successor; 0 disables
+	RoleOverrides  map[string]RoleTTL
+}
+
+// RoleTTL overrides TTLConfig for one role; zero values keep the default.
+type RoleTTL struct {
+	AccessTokenTTL time.Duration
+	SessionTTL     time.Duration
+}
+
+// ForRole returns the access token and session TTLs that apply to role.
+func (c TTLConfig) ForRole(role string) (accessTTL, sessionTTL time.Duration) {
+	accessTTL, sessionTTL = c.AccessTokenTTL, c.SessionTTL
+	if o, ok := c.RoleOverrides[role]; ok {
+		if o.AccessTokenTTL > 0 {
+			accessTTL = o.AccessTokenTTL
+		}
+		if o.SessionTTL > 0 {
+			sessionTTL = o.SessionTTL
+		}
+	}
+	return accessTTL, sessionTTL
+}
+
 // Session represents a user session.
 type Session struct {
 	ID               uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
@@ -19,6 +65,32 @@ type Session struct {
 	CreatedAt        time.Time  `json:"created_at"`
 	ExpiresAt        time.Time  `json:"expires_at"`
 	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	// ImpersonatorID is the admin acting as the user in a support session
+	ImpersonatorID string `gorm:"index" json:"impersonator_id,omitempty"`
+
+	// AccessExpiresAt is when the latest access token issued for the session
+	// expires; it is set on create and refresh. Sessions created before it
+	// was stored have the zero time.
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+	// LastSeenAt is when the session was last used, to within
+	// PresenceConfig.SeenGranularity. Only the database copy is kept current;
+	// the cached one may lag.
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	// LastRefreshedAt, LastRefreshIP and LastRefreshUserAgent describe the
+	// client of the latest refresh; unset until the session is first
+	// refreshed
+	LastRefreshedAt      *time.Time `json:"last_refreshed_at,omitempty"`
+	LastRefreshIP        string     `json:"last_refresh_ip,omitempty"`
+	LastRefreshUserAgent string     `json:"last_refresh_user_agent,omitempty"`
+}
+
+// LastAccessExpiry is when every access token issued for the session will
+// have expired
+func (s *Session) LastAccessExpiry() time.Time {
+	if s.AccessExpiresAt.IsZero() {
+		return s.ExpiresAt
+	}
+	return s.AccessExpiresAt
 }
 
 // IsExpired checks if the session is expired.
@@ -31,14 +103,80 @@ func (s *Session) IsRevoked() bool {
 	return s.RevokedAt != nil
 }
 
+// IsImpersonated reports whether an admin opened the session as the user
+func (s *Session) IsImpersonated() bool {
+	return s.ImpersonatorID != ""
+}
+
+// PresenceConfig sets how session use is recorded and read as presence
+type PresenceConfig struct {
+	// SeenGranularity is how stale LastSeenAt may get before a validation
+	// writes it again, so busy sessions are not written on every request
+	SeenGranularity time.Duration
+	// OnlineWindow is how recently a user must have used an active session
+	// to count as online
+	OnlineWindow time.Duration
+}
+
+// UserActivity sums up a user's sessions for presence
+type UserActivity struct {
+	UserID string
+	// LastSeenAt is the latest use of any of the user's sessions, and
+	// LastActiveSeenAt that of the ones still active
+	LastSeenAt       *time.Time
+	LastActiveSeenAt *time.Time
+	ActiveSessions   int
+}
+
+// Presence is whether a user is online and when they were last active
+type Presence struct {
+	UserID         string     `json:"user_id"`
+	Online         bool       `json:"online"`
+	LastSeenAt     *time.Time `json:"last_seen_at"`
+	ActiveSessions int        `json:"active_sessions"`
+}
+
+// PresenceAt is the user's presence as of now: online if an active session
+// was used within window
+func (a UserActivity) PresenceAt(now time.Time, window time.Duration) Presence {
+	return Presence{
+		UserID:         a.UserID,
+		Online:         a.LastActiveSeenAt != nil && now.Sub(*a.LastActiveSeenAt) <= window,
+		LastSeenAt:     a.LastSeenAt,
+		ActiveSessions: a.ActiveSessions,
+	}
+}
+
 // SessionRepository defines the interface for persistent session storage (SQLite).
 type SessionRepository interface {
 	Create(ctx context.Context, session *Session) error
+	// CreateWithLimit creates the session only if the user holds fewer than limit
+	// active sessions, evicting the oldest ones first when evictOldest is set.
+	// Returns the sessions that were evicted.
+	CreateWithLimit(ctx context.Context, session *Session, limit int, evictOldest bool) ([]*Session, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*Session, error)
 	GetActiveByUserID(ctx context.Context, userID string) ([]*Session, error)
-	Update(ctx context.Context, session *Session) error
+	// ListByUserID returns every session of the user, including revoked and
+	// expired ones, newest first
+	ListByUserID(ctx context.Context, userID string) ([]*Session, error)
+	// Rotate saves the refreshed session if its refresh token hash is still
+	// previousHash and it is not revoked, and reports whether it was saved
+	Rotate(ctx context.Context, session *Session, previousHash string) (bool, error)
 	Revoke(ctx context.Context, id uuid.UUID) error
+	// RevokeAllForUser revokes the user's own sessions; impersonated ones
+	// are left to expire
 	RevokeAllForUser(ctx context.Context, userID string) error
+	// TouchLastSeen records that the session was used at seenAt
+	TouchLastSeen(ctx context.Context, id uuid.UUID, seenAt time.Time) error
+	// GetActivity sums up the sessions of each user as of now, leaving out
+	// users without any and impersonated sessions
+	GetActivity(ctx context.Context, userIDs []string, now time.Time) ([]UserActivity, error)
+	// RecordRefresh saves the event and prunes the session's oldest events
+	// beyond the newest keep
+	RecordRefresh(ctx context.Context, event *RefreshEvent, keep int) error
+	// ListRefreshEvents returns the session's recorded refreshes, newest
+	// first
+	ListRefreshEvents(ctx context.Context, sessionID uuid.UUID) ([]RefreshEvent, error)
 }
 
 // SessionCache defines the interface for fast session access (Redis).
@@ -47,14 +185,52 @@ type SessionCache interface {
 	Get(ctx context.Context, id uuid.UUID) (*Session, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 	DeleteAllForUser(ctx context.Context, userID string) error
+	// SetInvalid remembers why a session ID failed validation for ttl, so
+	// repeated lookups of it skip the database
+	SetInvalid(ctx context.Context, id uuid.UUID, reason string, ttl time.Duration) error
+	// GetInvalid returns the remembered reason, or "" if there is none
+	GetInvalid(ctx context.Context, id uuid.UUID) (string, error)
+	// MarkSeen reports whether the session's use should be written, which
+	// is true for at most one caller per session every ttl
+	MarkSeen(ctx context.Context, id uuid.UUID, ttl time.Duration) (bool, error)
+	// ClaimRotation records for ttl what the refresh token with fingerprint
+	// was rotated into. It reports false, recording nothing, if a concurrent
+	// refresh with the same token claimed it first.
+	ClaimRotation(ctx context.Context, id uuid.UUID, fingerprint string, rotation RefreshRotation, ttl time.Duration) (bool, error)
+	// GetRotation returns what the refresh token with fingerprint was
+	// rotated into, or nil once the claim has expired
+	GetRotation(ctx context.Context, id uuid.UUID, fingerprint string) (*RefreshRotation, error)
+	// ReleaseRotation drops a claim whose rotation was not saved
+	ReleaseRotation(ctx context.Context, id uuid.UUID, fingerprint string) error
+}
+
+// RefreshRotation is the refresh token a session's previous one was rotated
+// into, and the RotationCounter it was rotated to. Within
+// TTLConfig.RefreshGrace a client refreshing with the previous token gets
+// the same token back, so two tabs refreshing at once end up with the same
+// credentials. SealedToken is the token encrypted under a key derived from
+// the previous one, so the cache never holds a usable refresh token.
+type RefreshRotation struct {
+	SealedToken string `json:"sealed_token"`
+	Rotation    int    `json:"rotation"`
+}
+
+// TokenDenyList rejects the access tokens of a revoked session until until,
+// when the last of them expires anyway
+type TokenDenyList interface {
+	Revoke(ctx context.Context, sessionID string, until time.Time) error
 }
 
 // SessionUseCase defines the business logic for session management.
 type SessionUseCase interface {
-	CreateSession(ctx context.Context, userID, role, ip, userAgent string) (*Session, string, error) // Returns session and raw refresh token
+	CreateSession(ctx context.Context, userID, role, ip, userAgent string) (*Session, string, []uuid.UUID, error) // Returns session, raw refresh token and evicted session IDs
+	CreateImpersonationSession(ctx context.Context, userID, role, impersonatorID, ip, userAgent string) (*Session, error)
 	ValidateSession(ctx context.Context, sessionID uuid.UUID) (*Session, error)
-	GetSession(ctx context.Context, sessionID uuid.UUID) (*Session, error)                                  // Introspection
-	RefreshSession(ctx context.Context, sessionID uuid.UUID, refreshToken string) (*Session, string, error) // Rotates token
+	GetSession(ctx context.Context, sessionID uuid.UUID) (*Session, error)                                                 // Introspection
+	RefreshSession(ctx context.Context, sessionID uuid.UUID, refreshToken, ip, userAgent string) (*Session, string, error) // Rotates token
 	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
 	RevokeAllUserSessions(ctx context.Context, userID string) error
+	ListUserSessions(ctx context.Context, userID string) ([]*Session, error)
+	GetPresence(ctx context.Context, userIDs []string) ([]Presence, error) // One entry per user ID, in order
+	GetRefreshHistory(ctx context.Context, sessionID uuid.UUID) (*Session, []RefreshEvent, error)
 }
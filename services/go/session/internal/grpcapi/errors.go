@@ -0,0 +1,46 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// statusError maps session errors to gRPC status codes as the HTTP API's
+// apiError maps them to statuses. A call whose deadline passed or which the
+// caller cancelled reports that rather than what it was interrupted by.
+func statusError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, core.ErrSessionLimitReached):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "session not found")
+	case errors.Is(err, service.ErrInvalidSession):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Printf("gRPC session call failed: %v", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// authStatus is statusError for validation, where a session that is
+// missing, expired or revoked means the caller is not authenticated
+func authStatus(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrSessionExpired), errors.Is(err, service.ErrSessionRevoked):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrSessionNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.Unauthenticated, "session not found")
+	}
+	return statusError(ctx, err)
+}
@@ -0,0 +1,100 @@
+// Package grpcapi serves the session service's gRPC API, the low-latency
+// counterpart of the /internal/sessions HTTP endpoints. Both call the same
+// core.SessionUseCase, so a session looks the same over either.
+package grpcapi
+
+import (
+	"context"
+
+	sessionv1 "github.com/4yrg/gradeloop-core/libs/rpc/session/v1"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Server struct {
+	sessionv1.UnimplementedSessionServiceServer
+	useCase core.SessionUseCase
+}
+
+func NewServer(useCase core.SessionUseCase) *Server {
+	return &Server{useCase: useCase}
+}
+
+func (s *Server) ValidateSession(ctx context.Context, req *sessionv1.ValidateSessionRequest) (*sessionv1.ValidateSessionResponse, error) {
+	id, err := parseSessionID(req.GetSessionId())
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.useCase.ValidateSession(ctx, id)
+	if err != nil {
+		return nil, authStatus(ctx, err)
+	}
+
+	return &sessionv1.ValidateSessionResponse{Session: toProto(session)}, nil
+}
+
+func (s *Server) GetSession(ctx context.Context, req *sessionv1.GetSessionRequest) (*sessionv1.GetSessionResponse, error) {
+	id, err := parseSessionID(req.GetSessionId())
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.useCase.GetSession(ctx, id)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return &sessionv1.GetSessionResponse{Session: toProto(session)}, nil
+}
+
+func (s *Server) RevokeSession(ctx context.Context, req *sessionv1.RevokeSessionRequest) (*sessionv1.RevokeSessionResponse, error) {
+	id, err := parseSessionID(req.GetSessionId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.useCase.RevokeSession(ctx, id); err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return &sessionv1.RevokeSessionResponse{}, nil
+}
+
+func parseSessionID(raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "session_id must be a valid UUID")
+	}
+	return id, nil
+}
+
+// toProto is the gRPC form of the HTTP API's SessionResponse
+func toProto(session *core.Session) *sessionv1.Session {
+	pb := &sessionv1.Session{
+		Id:              session.ID.String(),
+		UserId:          session.UserID,
+		UserRole:        session.UserRole,
+		UserAgent:       session.UserAgent,
+		ClientIp:        session.ClientIP,
+		RotationCounter: int32(session.RotationCounter),
+		CreatedAt:       timestamppb.New(session.CreatedAt),
+		ExpiresAt:       timestamppb.New(session.ExpiresAt),
+		AccessExpiresAt: timestamppb.New(session.LastAccessExpiry()),
+		IsImpersonated:  session.IsImpersonated(),
+		ImpersonatorId:  session.ImpersonatorID,
+
+		LastRefreshIp:        session.LastRefreshIP,
+		LastRefreshUserAgent: session.LastRefreshUserAgent,
+	}
+	if session.RevokedAt != nil {
+		pb.RevokedAt = timestamppb.New(*session.RevokedAt)
+	}
+	if session.LastRefreshedAt != nil {
+		pb.LastRefreshedAt = timestamppb.New(*session.LastRefreshedAt)
+	}
+	return pb
+}
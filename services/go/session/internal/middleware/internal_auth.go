@@ -4,6 +4,7 @@ import (
 	"crypto/subtle"
 	"os"
 
+	"github.com/4yrg/gradeloop-core/libs/apierror"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/log"
 )
@@ -20,11 +21,11 @@ func InternalAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		token := c.Get("X-Internal-Token")
 		if token == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing internal token"})
+			return apierror.Unauthorized("missing internal token")
 		}
 
 		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid internal token"})
+			return apierror.Unauthorized("invalid internal token")
 		}
 
 		return c.Next()
@@ -0,0 +1,2 @@
+-- Drops the session table and every session in it
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,18 @@
+-- Session schema as of the switch from AutoMigrate to versioned migrations
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id uuid PRIMARY KEY,
+    user_id text,
+    user_role text,
+    refresh_token_hash text,
+    user_agent text,
+    client_ip text,
+    rotation_counter bigint,
+    created_at timestamptz,
+    expires_at timestamptz,
+    revoked_at timestamptz,
+    impersonator_id text,
+    access_expires_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_impersonator_id ON sessions (impersonator_id);
@@ -0,0 +1,4 @@
+-- When each session was last used, for presence; written at most once per
+-- LAST_SEEN_GRANULARITY
+
+ALTER TABLE sessions ADD COLUMN last_seen_at timestamptz;
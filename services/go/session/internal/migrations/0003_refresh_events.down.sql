@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS session_refresh_events;
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_refresh_user_agent;
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_refresh_ip;
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_refreshed_at;
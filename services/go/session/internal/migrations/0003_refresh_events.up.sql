@@ -0,0 +1,21 @@
+-- Who refreshed each session: the client of the latest refresh on the
+-- session itself, and the latest REFRESH_HISTORY_LIMIT refreshes per session
+-- in session_refresh_events
+
+ALTER TABLE sessions ADD COLUMN last_refreshed_at timestamptz;
+ALTER TABLE sessions ADD COLUMN last_refresh_ip text;
+ALTER TABLE sessions ADD COLUMN last_refresh_user_agent text;
+
+CREATE TABLE session_refresh_events (
+    id bigserial PRIMARY KEY,
+    session_id uuid NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    rotation bigint NOT NULL,
+    client_ip text,
+    user_agent text,
+    country text,
+    asn bigint,
+    anomalous boolean NOT NULL DEFAULT false,
+    anomaly_reason text,
+    created_at timestamptz NOT NULL
+);
+CREATE INDEX idx_session_refresh_events_session_id ON session_refresh_events (session_id, id);
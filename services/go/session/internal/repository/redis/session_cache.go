@@ -11,11 +11,15 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// SessionCache keeps sessions and, per user, the set of their session IDs.
+// The session keys and a user's set may live on different Cluster nodes: the
+// pipelines below only send single-key commands, which the cluster client
+// routes to each key's node, so no two keys need to share a slot.
 type SessionCache struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
-func NewSessionCache(client *redis.Client) *SessionCache {
+func NewSessionCache(client redis.UniversalClient) *SessionCache {
 	return &SessionCache{client: client}
 }
 
@@ -23,6 +27,18 @@ func (c *SessionCache) sessionKey(id uuid.UUID) string {
 	return fmt.Sprintf("session:%s", id.String())
 }
 
+func (c *SessionCache) invalidKey(id uuid.UUID) string {
+	return fmt.Sprintf("session_invalid:%s", id.String())
+}
+
+func (c *SessionCache) seenKey(id uuid.UUID) string {
+	return fmt.Sprintf("session_seen:%s", id.String())
+}
+
+func (c *SessionCache) rotationKey(id uuid.UUID, fingerprint string) string {
+	return fmt.Sprintf("session_rotation:%s:%s", id.String(), fingerprint)
+}
+
 func (c *SessionCache) userSessionsKey(userID string) string {
 	return fmt.Sprintf("user_sessions:%s", userID)
 }
@@ -94,3 +110,50 @@ func (c *SessionCache) DeleteAllForUser(ctx context.Context, userID string) erro
 	_, err = pipeline.Exec(ctx)
 	return err
 }
+
+func (c *SessionCache) SetInvalid(ctx context.Context, id uuid.UUID, reason string, ttl time.Duration) error {
+	return c.client.Set(ctx, c.invalidKey(id), reason, ttl).Err()
+}
+
+func (c *SessionCache) GetInvalid(ctx context.Context, id uuid.UUID) (string, error) {
+	reason, err := c.client.Get(ctx, c.invalidKey(id)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return reason, err
+}
+
+// MarkSeen claims the session's next last-seen write. The claim expires after
+// ttl, so only the first validation in each window writes.
+func (c *SessionCache) MarkSeen(ctx context.Context, id uuid.UUID, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, c.seenKey(id), 1, ttl).Result()
+}
+
+// ClaimRotation claims the rotation of a refresh token with SETNX, so it
+// holds across instances
+func (c *SessionCache) ClaimRotation(ctx context.Context, id uuid.UUID, fingerprint string, rotation core.RefreshRotation, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(rotation)
+	if err != nil {
+		return false, err
+	}
+	return c.client.SetNX(ctx, c.rotationKey(id, fingerprint), data, ttl).Result()
+}
+
+func (c *SessionCache) GetRotation(ctx context.Context, id uuid.UUID, fingerprint string) (*core.RefreshRotation, error) {
+	data, err := c.client.Get(ctx, c.rotationKey(id, fingerprint)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rotation core.RefreshRotation
+	if err := json.Unmarshal(data, &rotation); err != nil {
+		return nil, err
+	}
+	return &rotation, nil
+}
+
+func (c *SessionCache) ReleaseRotation(ctx context.Context, id uuid.UUID, fingerprint string) error {
+	return c.client.Del(ctx, c.rotationKey(id, fingerprint)).Err()
+}
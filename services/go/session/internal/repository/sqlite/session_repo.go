@@ -21,6 +21,52 @@ func (r *SessionRepository) Create(ctx context.Context, session *core.Session) e
 	return r.db.WithContext(ctx).Create(session).Error
 }
 
+func (r *SessionRepository) CreateWithLimit(ctx context.Context, session *core.Session, limit int, evictOldest bool) ([]*core.Session, error) {
+	var evicted []*core.Session
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Serialise session creation per user so parallel logins can't both
+		// pass the count check. The lock is released when the transaction ends.
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "session_limit:"+session.UserID).Error; err != nil {
+			return err
+		}
+
+		var active []*core.Session
+		// Support sessions an admin opened as the user are not the user's own
+		if err := tx.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ? AND (impersonator_id IS NULL OR impersonator_id = '')", session.UserID, time.Now()).
+			Order("created_at ASC").
+			Find(&active).Error; err != nil {
+			return err
+		}
+
+		if excess := len(active) - limit + 1; excess > 0 {
+			if !evictOldest {
+				return core.ErrSessionLimitReached
+			}
+
+			evicted = active[:excess]
+			ids := make([]uuid.UUID, 0, len(evicted))
+			for _, s := range evicted {
+				ids = append(ids, s.ID)
+			}
+
+			now := time.Now()
+			if err := tx.Model(&core.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+			for _, s := range evicted {
+				s.RevokedAt = &now
+			}
+		}
+
+		return tx.Create(session).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return evicted, nil
+}
+
 func (r *SessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*core.Session, error) {
 	var session core.Session
 	if err := r.db.WithContext(ctx).First(&session, "id = ?", id).Error; err != nil {
@@ -38,8 +84,21 @@ func (r *SessionRepository) GetActiveByUserID(ctx context.Context, userID string
 	return sessions, nil
 }
 
-func (r *SessionRepository) Update(ctx context.Context, session *core.Session) error {
-	return r.db.WithContext(ctx).Save(session).Error
+func (r *SessionRepository) ListByUserID(ctx context.Context, userID string) ([]*core.Session, error) {
+	var sessions []*core.Session
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *SessionRepository) Rotate(ctx context.Context, session *core.Session, previousHash string) (bool, error) {
+	// Conditional, so of two refreshes with the same token only one rotates,
+	// and a refresh cannot bring back a session revoked while it ran
+	res := r.db.WithContext(ctx).Model(session).
+		Where("refresh_token_hash = ? AND revoked_at IS NULL", previousHash).
+		Select("*").Updates(session)
+	return res.RowsAffected > 0, res.Error
 }
 
 func (r *SessionRepository) Revoke(ctx context.Context, id uuid.UUID) error {
@@ -50,5 +109,74 @@ func (r *SessionRepository) Revoke(ctx context.Context, id uuid.UUID) error {
 
 func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID string) error {
 	now := time.Now()
-	return r.db.WithContext(ctx).Model(&core.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error
+	return r.db.WithContext(ctx).Model(&core.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (impersonator_id IS NULL OR impersonator_id = '')", userID).
+		Update("revoked_at", now).Error
+}
+
+func (r *SessionRepository) TouchLastSeen(ctx context.Context, id uuid.UUID, seenAt time.Time) error {
+	// Never move it back, should an older write arrive late
+	return r.db.WithContext(ctx).Model(&core.Session{}).
+		Where("id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)", id, seenAt).
+		Update("last_seen_at", seenAt).Error
+}
+
+func (r *SessionRepository) GetActivity(ctx context.Context, userIDs []string, now time.Time) ([]core.UserActivity, error) {
+	// Summed up here rather than with MAX() in SQL, which SQLite returns as
+	// text; a user has few sessions, so the rows are cheap to load
+	var sessions []core.Session
+	err := r.db.WithContext(ctx).
+		Select("user_id", "last_seen_at", "revoked_at", "expires_at").
+		Where("user_id IN ? AND (impersonator_id IS NULL OR impersonator_id = '')", userIDs).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var activity []core.UserActivity
+	byUser := make(map[string]int, len(userIDs))
+	for _, s := range sessions {
+		i, ok := byUser[s.UserID]
+		if !ok {
+			i = len(activity)
+			byUser[s.UserID] = i
+			activity = append(activity, core.UserActivity{UserID: s.UserID})
+		}
+		a := &activity[i]
+		a.LastSeenAt = later(a.LastSeenAt, s.LastSeenAt)
+		if s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			a.ActiveSessions++
+			a.LastActiveSeenAt = later(a.LastActiveSeenAt, s.LastSeenAt)
+		}
+	}
+	return activity, nil
+}
+
+// later returns whichever of a and b is later, ignoring nils
+func later(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
+
+func (r *SessionRepository) RecordRefresh(ctx context.Context, event *core.RefreshEvent, keep int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			DELETE FROM session_refresh_events
+			WHERE session_id = ? AND id NOT IN (
+				SELECT id FROM session_refresh_events WHERE session_id = ? ORDER BY id DESC LIMIT ?
+			)`, event.SessionID, event.SessionID, keep).Error
+	})
+}
+
+func (r *SessionRepository) ListRefreshEvents(ctx context.Context, sessionID uuid.UUID) ([]core.RefreshEvent, error) {
+	events := []core.RefreshEvent{}
+	if err := r.db.WithContext(ctx).Where("session_id = ?", sessionID).Order("id DESC").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
 }
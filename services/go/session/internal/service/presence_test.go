@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/repository/sqlite"
+	"github.com/google/uuid"
+)
+
+// touchCountingRepo counts the last-seen writes that reach the database
+type touchCountingRepo struct {
+	*sqlite.SessionRepository
+	touches atomic.Int64
+}
+
+func (r *touchCountingRepo) TouchLastSeen(ctx context.Context, id uuid.UUID, seenAt time.Time) error {
+	r.touches.Add(1)
+	return r.SessionRepository.TouchLastSeen(ctx, id, seenAt)
+}
+
+func newPresenceEnv(t *testing.T) (*testEnv, *touchCountingRepo) {
+	t.Helper()
+	var repo *touchCountingRepo
+	env := newTestEnv(t, func(r *sqlite.SessionRepository) core.SessionRepository {
+		repo = &touchCountingRepo{SessionRepository: r}
+		return repo
+	})
+	env.svc.presence = core.PresenceConfig{SeenGranularity: time.Minute, OnlineWindow: 5 * time.Minute}
+	return env, repo
+}
+
+// backdateLastSeen moves the session's last use back by ago, in the
+// database only, and drops the cached copy
+func backdateLastSeen(t *testing.T, env *testEnv, id uuid.UUID, ago time.Duration) {
+	t.Helper()
+	if err := env.db.Model(&core.Session{}).Where("id = ?", id).Update("last_seen_at", time.Now().Add(-ago)).Error; err != nil {
+		t.Fatal(err)
+	}
+	env.mr.FlushAll()
+}
+
+func TestValidationWritesLastSeenOncePerWindow(t *testing.T) {
+	ctx := context.Background()
+	env, repo := newPresenceEnv(t)
+	session, _, _, err := env.svc.CreateSession(ctx, "user-1", "STUDENT", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Just created, so it was seen within the window already
+	if _, err := env.svc.ValidateSession(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.touches.Load(); got != 0 {
+		t.Errorf("fresh session written %d times, want none", got)
+	}
+
+	backdateLastSeen(t, env, session.ID, 10*time.Minute)
+	for range 5 {
+		if _, err := env.svc.ValidateSession(ctx, session.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := repo.touches.Load(); got != 1 {
+		t.Errorf("stale session written %d times over 5 validations, want once", got)
+	}
+	stored, err := env.repo.GetByID(ctx, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastSeenAt == nil || time.Since(*stored.LastSeenAt) > time.Minute {
+		t.Errorf("last seen = %v, want just now", stored.LastSeenAt)
+	}
+}
+
+func TestGetPresence(t *testing.T) {
+	ctx := context.Background()
+	env, _ := newPresenceEnv(t)
+	if _, _, _, err := env.svc.CreateSession(ctx, "online", "STUDENT", "203.0.113.9", "test"); err != nil {
+		t.Fatal(err)
+	}
+	idle, _, _, err := env.svc.CreateSession(ctx, "idle", "STUDENT", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backdateLastSeen(t, env, idle.ID, time.Hour)
+	gone, _, _, err := env.svc.CreateSession(ctx, "gone", "STUDENT", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.svc.RevokeSession(ctx, gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	presence, err := env.svc.GetPresence(ctx, []string{"never", "gone", "idle", "online"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(presence) != 4 {
+		t.Fatalf("got %d entries, want one per user asked for", len(presence))
+	}
+	for i, want := range []struct {
+		user     string
+		online   bool
+		seen     bool
+		sessions int
+	}{
+		{"never", false, false, 0},
+		{"gone", false, true, 0},
+		{"idle", false, true, 1},
+		{"online", true, true, 1},
+	} {
+		p := presence[i]
+		if p.UserID != want.user || p.Online != want.online || (p.LastSeenAt != nil) != want.seen || p.ActiveSessions != want.sessions {
+			t.Errorf("presence[%d] = %+v, want %+v", i, p, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+	"github.com/google/uuid"
+)
+
+// recordRefresh adds the session's latest refresh to its history, flagging
+// it if the client is in another country or network than at previousIP.
+// The refresh has already succeeded, so failures are only logged.
+func (s *SessionService) recordRefresh(ctx context.Context, session *core.Session, previousIP string) {
+	event := &core.RefreshEvent{
+		SessionID: session.ID,
+		Rotation:  session.RotationCounter,
+		ClientIP:  session.LastRefreshIP,
+		UserAgent: session.LastRefreshUserAgent,
+		CreatedAt: *session.LastRefreshedAt,
+	}
+	location := s.locate(ctx, event.ClientIP)
+	if location != nil {
+		event.Country, event.ASN = location.Country, location.ASN
+	}
+	if location != nil && previousIP != "" && previousIP != event.ClientIP {
+		if previous := s.locate(ctx, previousIP); previous != nil {
+			event.AnomalyReason = anomalyReason(previous, location)
+			event.Anomalous = event.AnomalyReason != ""
+		}
+	}
+	if event.Anomalous {
+		s.anomalies.Add(1)
+		log.Printf("Anomalous refresh of session %s (user %s) from %s: %s", session.ID, session.UserID, event.ClientIP, event.AnomalyReason)
+	}
+
+	if err := s.repo.RecordRefresh(ctx, event, s.history.Limit); err != nil {
+		log.Printf("Failed to record refresh of session %s: %v", session.ID, err)
+	}
+}
+
+// locate places ip, or returns nil if the GeoLocator cannot
+func (s *SessionService) locate(ctx context.Context, ip string) *core.GeoLocation {
+	if ip == "" {
+		return nil
+	}
+	location, err := s.history.Geo.Locate(ctx, ip)
+	if err != nil {
+		log.Printf("Failed to locate %s: %v", ip, err)
+		return nil
+	}
+	return location
+}
+
+// anomalyReason says how the client moved between two refreshes, or is
+// empty if it stayed in the same country and network. Either side missing
+// a field says nothing about it.
+func anomalyReason(previous, current *core.GeoLocation) string {
+	switch {
+	case previous.Country != "" && current.Country != "" && previous.Country != current.Country:
+		return fmt.Sprintf("country changed from %s to %s", previous.Country, current.Country)
+	case previous.ASN != 0 && current.ASN != 0 && previous.ASN != current.ASN:
+		return fmt.Sprintf("network changed from AS%d to AS%d", previous.ASN, current.ASN)
+	}
+	return ""
+}
+
+// AnomalousRefreshes counts the refreshes flagged as anomalous since startup
+func (s *SessionService) AnomalousRefreshes() int64 {
+	return s.anomalies.Load()
+}
+
+// GetRefreshHistory returns the session and its latest refreshes, newest
+// first, whatever state the session is in
+func (s *SessionService) GetRefreshHistory(ctx context.Context, sessionID uuid.UUID) (*core.Session, []core.RefreshEvent, error) {
+	session, err := s.repo.GetByID(ctx, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, err := s.repo.ListRefreshEvents(ctx, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, events, nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+)
+
+// fakeGeo places the IPs it has an entry for
+type fakeGeo map[string]core.GeoLocation
+
+func (g fakeGeo) Locate(_ context.Context, ip string) (*core.GeoLocation, error) {
+	location, ok := g[ip]
+	if !ok {
+		return nil, nil
+	}
+	return &location, nil
+}
+
+// refreshFrom refreshes the session from ip, returning the next token
+func (e *testEnv) refreshFrom(t *testing.T, session *core.Session, token, ip string) (*core.Session, string) {
+	t.Helper()
+	refreshed, next, err := e.svc.RefreshSession(context.Background(), session.ID, token, ip, "agent "+ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refreshed, next
+}
+
+func TestRefreshCountsRotations(t *testing.T) {
+	env := newTestEnv(t, nil)
+	session, token := env.login(t, "user-1")
+
+	// The login's token is the first rotation
+	var refreshed *core.Session
+	for _, ip := range []string{"203.0.113.10", "203.0.113.11", "203.0.113.12"} {
+		refreshed, token = env.refreshFrom(t, session, token, ip)
+	}
+	if refreshed.RotationCounter != 4 || refreshed.LastRefreshIP != "203.0.113.12" || refreshed.LastRefreshUserAgent != "agent 203.0.113.12" {
+		t.Errorf("refreshed session: rotation %d, last refresh from %q with %q", refreshed.RotationCounter, refreshed.LastRefreshIP, refreshed.LastRefreshUserAgent)
+	}
+
+	saved, events, err := env.svc.GetRefreshHistory(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.RotationCounter != 4 || saved.LastRefreshedAt == nil {
+		t.Errorf("stored session: rotation %d, last refreshed %v", saved.RotationCounter, saved.LastRefreshedAt)
+	}
+	if len(events) != 3 {
+		t.Fatalf("%d refreshes recorded, want 3", len(events))
+	}
+	for i, event := range events {
+		if want := 4 - i; event.Rotation != want || event.ClientIP != "203.0.113.1"+string(rune('0'+want-2)) {
+			t.Errorf("event %d: rotation %d from %s, want rotation %d newest first", i, event.Rotation, event.ClientIP, want)
+		}
+	}
+}
+
+func TestRefreshHistoryIsCapped(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.svc.history.Limit = 3
+	session, token := env.login(t, "user-1")
+	other, otherToken := env.login(t, "user-2")
+	env.refreshFrom(t, other, otherToken, "198.51.100.1")
+
+	for i := 0; i < 5; i++ {
+		_, token = env.refreshFrom(t, session, token, "203.0.113.10")
+	}
+
+	_, events, err := env.svc.GetRefreshHistory(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0].Rotation != 6 || events[2].Rotation != 4 {
+		rotations := make([]int, len(events))
+		for i, event := range events {
+			rotations[i] = event.Rotation
+		}
+		t.Errorf("kept rotations %v, want the newest 3: [6 5 4]", rotations)
+	}
+	if _, events, _ := env.svc.GetRefreshHistory(context.Background(), other.ID); len(events) != 1 {
+		t.Errorf("pruning another session left it %d refreshes, want 1", len(events))
+	}
+}
+
+func TestRefreshFromElsewhereIsFlagged(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.svc.history.Geo = fakeGeo{
+		"203.0.113.9":  {Country: "LK", ASN: 100}, // where the session logged in
+		"203.0.113.10": {Country: "LK", ASN: 100},
+		"198.51.100.7": {Country: "US", ASN: 200},
+		"198.51.100.8": {Country: "US", ASN: 300},
+	}
+	session, token := env.login(t, "user-1")
+
+	for _, ip := range []string{"203.0.113.10", "198.51.100.7", "198.51.100.8", "192.0.2.1"} {
+		_, token = env.refreshFrom(t, session, token, ip)
+	}
+
+	_, events, err := env.svc.GetRefreshHistory(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		country string
+		reason  string
+	}{
+		{"", ""}, // an address the locator knows nothing about
+		{"US", "network changed from AS200 to AS300"},
+		{"US", "country changed from LK to US"},
+		{"LK", ""},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("%d refreshes recorded, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		event := events[i]
+		if event.Country != w.country || event.AnomalyReason != w.reason || event.Anomalous != (w.reason != "") {
+			t.Errorf("refresh from %s: country %q, anomalous %v (%q); want %q, %q", event.ClientIP, event.Country, event.Anomalous, event.AnomalyReason, w.country, w.reason)
+		}
+	}
+	if n := env.svc.AnomalousRefreshes(); n != 2 {
+		t.Errorf("AnomalousRefreshes = %d, want 2", n)
+	}
+}
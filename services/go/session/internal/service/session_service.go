@@ -2,14 +2,24 @@ package service
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
 )
 
 var (
@@ -17,32 +27,87 @@ var (
 	ErrSessionExpired  = errors.New("session expired")
 	ErrSessionRevoked  = errors.New("session revoked")
 	ErrInvalidToken    = errors.New("invalid refresh token")
+	ErrNotRefreshable  = errors.New("impersonated sessions cannot be refreshed")
+	ErrInvalidSession  = errors.New("invalid session")
 )
 
+// Reasons a session ID is remembered as invalid, mapped back to their errors
+const (
+	invalidNotFound = "not_found"
+	invalidRevoked  = "revoked"
+	invalidExpired  = "expired"
+)
+
+var invalidErrors = map[string]error{
+	invalidNotFound: ErrSessionNotFound,
+	invalidRevoked:  ErrSessionRevoked,
+	invalidExpired:  ErrSessionExpired,
+}
+
 type SessionService struct {
-	repo            core.SessionRepository
-	cache           core.SessionCache
-	sessionTTL      time.Duration
-	refreshTokenTTL time.Duration
+	repo        core.SessionRepository
+	cache       core.SessionCache
+	ttl         core.TTLConfig
+	maxSessions int // 0 means unlimited
+	limitPolicy core.SessionLimitPolicy
+	// denyList is told about every revoked session, so its access tokens
+	// stop working before they expire; nil disables it
+	denyList core.TokenDenyList
+	presence core.PresenceConfig
+	history  core.RefreshHistoryConfig
+
+	// anomalies counts refreshes flagged as anomalous since startup
+	anomalies atomic.Int64
+
+	// Collapses concurrent database lookups of the same session on a cache miss
+	lookups singleflight.Group
 }
 
-func NewSessionService(repo core.SessionRepository, cache core.SessionCache, sessionTTL, refreshTokenTTL time.Duration) *SessionService {
+func NewSessionService(repo core.SessionRepository, cache core.SessionCache, ttl core.TTLConfig, maxSessions int, limitPolicy core.SessionLimitPolicy, denyList core.TokenDenyList, presence core.PresenceConfig, history core.RefreshHistoryConfig) *SessionService {
+	if history.Geo == nil {
+		history.Geo = core.NoGeoLocator{}
+	}
 	return &SessionService{
-		repo:            repo,
-		cache:           cache,
-		sessionTTL:      sessionTTL,
-		refreshTokenTTL: refreshTokenTTL,
+		repo:        repo,
+		cache:       cache,
+		ttl:         ttl,
+		maxSessions: maxSessions,
+		limitPolicy: limitPolicy,
+		denyList:    denyList,
+		presence:    presence,
+		history:     history,
 	}
 }
 
-func (s *SessionService) CreateSession(ctx context.Context, userID, role, ip, userAgent string) (*core.Session, string, error) {
+// expiries works out the session and access token expiry for a session of
+// role created at createdAt, as seen at now. The session never outlives the
+// absolute max lifetime and the access token never outlives the session.
+func (s *SessionService) expiries(role string, createdAt, now time.Time) (sessionExpiry, accessExpiry time.Time) {
+	accessTTL, sessionTTL := s.ttl.ForRole(role)
+
+	sessionExpiry = now.Add(sessionTTL)
+	if s.ttl.MaxLifetime > 0 {
+		if limit := createdAt.Add(s.ttl.MaxLifetime); sessionExpiry.After(limit) {
+			sessionExpiry = limit
+		}
+	}
+
+	accessExpiry = now.Add(accessTTL)
+	if accessExpiry.After(sessionExpiry) {
+		accessExpiry = sessionExpiry
+	}
+	return sessionExpiry, accessExpiry
+}
+
+func (s *SessionService) CreateSession(ctx context.Context, userID, role, ip, userAgent string) (*core.Session, string, []uuid.UUID, error) {
 	sessionID := uuid.New()
 	rawToken, hash, err := s.generateRefreshToken()
 	if err != nil {
-		return nil, "", err
+		return nil, "", nil, err
 	}
 
 	now := time.Now()
+	expiresAt, accessExpiresAt := s.expiries(role, now, now)
 	session := &core.Session{
 		ID:               sessionID,
 		UserID:           userID,
@@ -52,41 +117,155 @@ func (s *SessionService) CreateSession(ctx context.Context, userID, role, ip, us
 		ClientIP:         ip,
 		RotationCounter:  1,
 		CreatedAt:        now,
-		ExpiresAt:        now.Add(s.refreshTokenTTL),
+		ExpiresAt:        expiresAt,
+		AccessExpiresAt:  accessExpiresAt,
+		LastSeenAt:       &now,
 	}
 
-	// Persist to DB
-	if err := s.repo.Create(ctx, session); err != nil {
-		return nil, "", err
+	// Persist to DB, enforcing the per-user session cap if configured
+	var evictedIDs []uuid.UUID
+	if s.maxSessions > 0 {
+		evicted, err := s.repo.CreateWithLimit(ctx, session, s.maxSessions, s.limitPolicy == core.SessionLimitPolicyEvictOldest)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		for _, e := range evicted {
+			evictedIDs = append(evictedIDs, e.ID)
+			_ = s.cache.Delete(ctx, e.ID)
+		}
+		s.denyTokens(ctx, evicted)
+	} else if err := s.repo.Create(ctx, session); err != nil {
+		return nil, "", nil, err
 	}
 
-	// Cache (use sessionTTL or refreshTokenTTL, usually session validity is shorter if using JWTs,
-	// but here the session IS the refresh token validity essentially.
-	// Let's use refreshTokenTTL for the session object in cache for now)
+	// Cache for the lifetime of the session (the session IS the refresh token validity)
 	if err := s.cache.Set(ctx, session); err != nil {
 		// Log error but don't fail, cache is optional
 	}
 
-	return session, rawToken, nil
+	return session, rawToken, evictedIDs, nil
+}
+
+// CreateImpersonationSession opens a support session in which
+// impersonatorID acts as the user. It has no refresh token, lasts
+// MaxImpersonationTTL at most and does not count towards the user's
+// session cap, so it cannot evict any of the user's own sessions.
+func (s *SessionService) CreateImpersonationSession(ctx context.Context, userID, role, impersonatorID, ip, userAgent string) (*core.Session, error) {
+	if impersonatorID == "" {
+		return nil, fmt.Errorf("%w: impersonator_id is required", ErrInvalidSession)
+	}
+	if impersonatorID == userID {
+		return nil, fmt.Errorf("%w: users cannot impersonate themselves", ErrInvalidSession)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(core.MaxImpersonationTTL)
+	if _, sessionExpiry := s.expiries(role, now, now); sessionExpiry.Before(expiresAt) {
+		expiresAt = sessionExpiry
+	}
+	session := &core.Session{
+		ID:              uuid.New(),
+		UserID:          userID,
+		UserRole:        role,
+		UserAgent:       userAgent,
+		ClientIP:        ip,
+		ImpersonatorID:  impersonatorID,
+		CreatedAt:       now,
+		ExpiresAt:       expiresAt,
+		AccessExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	_ = s.cache.Set(ctx, session)
+
+	return session, nil
 }
 
 func (s *SessionService) ValidateSession(ctx context.Context, sessionID uuid.UUID) (*core.Session, error) {
 	// Try cache first
 	session, err := s.cache.Get(ctx, sessionID)
 	if err == nil && session != nil {
+		s.touch(ctx, session)
 		return session, nil
 	}
+	if reason, err := s.cache.GetInvalid(ctx, sessionID); err == nil && reason != "" {
+		if invalidErr, ok := invalidErrors[reason]; ok {
+			return nil, invalidErr
+		}
+	}
 
-	// Fallback to DB
-	session, err = s.repo.GetByID(ctx, sessionID)
+	// Fallback to DB. When a popular session drops out of the cache, only one
+	// of the concurrent validations queries the database and the rest share
+	// its result.
+	lookup := s.lookups.DoChan(sessionID.String(), func() (interface{}, error) {
+		// Not tied to the first caller, whose cancellation would otherwise
+		// fail every waiter
+		ctx := context.WithoutCancel(ctx)
+		// A validation that missed the cache just before the previous lookup
+		// filled it finds the session there
+		if session, err := s.cache.Get(ctx, sessionID); err == nil && session != nil {
+			return session, nil
+		}
+		return s.loadSession(ctx, sessionID)
+	})
+	// A caller whose deadline passes stops waiting; the lookup carries on
+	// for the others and still caches its outcome
+	var result singleflight.Result
+	select {
+	case result = <-lookup:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	// Callers may modify the session (e.g. on refresh), so each gets its own
+	shared := *result.Val.(*core.Session)
+	s.touch(ctx, &shared)
+	return &shared, nil
+}
+
+// touch records that the session was used, writing last_seen_at at most once
+// per SeenGranularity across all instances. Impersonated sessions are an
+// admin's support access, not the user's own activity, so they are left out.
+func (s *SessionService) touch(ctx context.Context, session *core.Session) {
+	if session.IsImpersonated() || s.presence.SeenGranularity <= 0 {
+		return
+	}
+	now := time.Now()
+	if session.LastSeenAt != nil && now.Sub(*session.LastSeenAt) < s.presence.SeenGranularity {
+		return
+	}
+	if claimed, err := s.cache.MarkSeen(ctx, session.ID, s.presence.SeenGranularity); err != nil || !claimed {
+		return
+	}
+	if err := s.repo.TouchLastSeen(ctx, session.ID, now); err != nil {
+		log.Printf("Failed to record last use of session %s: %v", session.ID, err)
+		return
+	}
+	session.LastSeenAt = &now
+}
+
+// loadSession reads a session from the database and caches the outcome:
+// valid sessions until they expire, invalid IDs for InvalidTTL
+func (s *SessionService) loadSession(ctx context.Context, sessionID uuid.UUID) (*core.Session, error) {
+	session, err := s.repo.GetByID(ctx, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		s.rememberInvalid(ctx, sessionID, invalidNotFound)
+		return nil, err
+	}
 	if err != nil {
-		return nil, err // Could be not found
+		return nil, err
 	}
 
 	if session.IsRevoked() {
+		s.rememberInvalid(ctx, sessionID, invalidRevoked)
 		return nil, ErrSessionRevoked
 	}
 	if session.IsExpired() {
+		s.rememberInvalid(ctx, sessionID, invalidExpired)
 		return nil, ErrSessionExpired
 	}
 
@@ -96,6 +275,12 @@ func (s *SessionService) ValidateSession(ctx context.Context, sessionID uuid.UUI
 	return session, nil
 }
 
+func (s *SessionService) rememberInvalid(ctx context.Context, sessionID uuid.UUID, reason string) {
+	if s.ttl.InvalidTTL > 0 {
+		_ = s.cache.SetInvalid(ctx, sessionID, reason, s.ttl.InvalidTTL)
+	}
+}
+
 func (s *SessionService) GetSession(ctx context.Context, sessionID uuid.UUID) (*core.Session, error) {
 	// Try cache first
 	session, err := s.cache.Get(ctx, sessionID)
@@ -107,15 +292,26 @@ func (s *SessionService) GetSession(ctx context.Context, sessionID uuid.UUID) (*
 	return s.repo.GetByID(ctx, sessionID)
 }
 
-func (s *SessionService) RefreshSession(ctx context.Context, sessionID uuid.UUID, refreshToken string) (*core.Session, string, error) {
+// RefreshSession rotates the session's refresh token for the client at ip
+// with userAgent, and records the refresh in the session's history
+func (s *SessionService) RefreshSession(ctx context.Context, sessionID uuid.UUID, refreshToken, ip, userAgent string) (*core.Session, string, error) {
 	// Get session
 	session, err := s.ValidateSession(ctx, sessionID)
 	if err != nil {
 		return nil, "", err
 	}
+	if session.IsImpersonated() {
+		return nil, "", ErrNotRefreshable
+	}
 
 	// Validate Token
+	fingerprint := tokenFingerprint(refreshToken)
 	if err := bcrypt.CompareHashAndPassword([]byte(session.RefreshTokenHash), []byte(refreshToken)); err != nil {
+		// The previous token, from a client that refreshed with it moments
+		// after another, gets the same outcome as the refresh that rotated it
+		if rotated, token, ok := s.graceRotation(ctx, sessionID, refreshToken); ok {
+			return rotated, token, nil
+		}
 		// Possible token theft / replay!
 		// Revoke session immediately
 		_ = s.RevokeSession(ctx, sessionID)
@@ -128,41 +324,228 @@ func (s *SessionService) RefreshSession(ctx context.Context, sessionID uuid.UUID
 		return nil, "", err
 	}
 
+	now := time.Now()
+	previousHash := session.RefreshTokenHash
+	previousIP := session.LastRefreshIP
+	if previousIP == "" {
+		previousIP = session.ClientIP
+	}
 	session.RefreshTokenHash = hash
 	session.RotationCounter++
-	session.ExpiresAt = time.Now().Add(s.refreshTokenTTL) // Extension? Or keeping absolute expiry? Requirements say "Refresh Token Rotation", usually extends life.
+	// Sliding expiry, capped at the session's absolute max lifetime
+	session.ExpiresAt, session.AccessExpiresAt = s.expiries(session.UserRole, session.CreatedAt, now)
+	// Refreshing counts as use; it also keeps the save below from writing
+	// back the older value of a cached copy
+	session.LastSeenAt = &now
+	session.LastRefreshedAt = &now
+	session.LastRefreshIP = ip
+	session.LastRefreshUserAgent = userAgent
 
-	// Update DB
-	if err := s.repo.Update(ctx, session); err != nil {
-		return nil, "", err
+	// Of concurrent refreshes with the same token, the one that claims the
+	// rotation saves it and the others get its token
+	claimed := false
+	if s.ttl.RefreshGrace > 0 {
+		sealed, err := sealRotation(refreshToken, rawToken)
+		if err != nil {
+			return nil, "", err
+		}
+		won, err := s.cache.ClaimRotation(ctx, sessionID, fingerprint, core.RefreshRotation{SealedToken: sealed, Rotation: session.RotationCounter}, s.ttl.RefreshGrace)
+		switch {
+		case err != nil:
+			// Without the claim the refresh still works, only without a
+			// grace window for the token it replaces
+			log.Printf("Failed to record rotation of session %s: %v", sessionID, err)
+		case !won:
+			if rotated, token, ok := s.graceRotation(ctx, sessionID, refreshToken); ok {
+				return rotated, token, nil
+			}
+			return nil, "", ErrInvalidToken
+		default:
+			claimed = true
+		}
+	}
+
+	// Update DB. If the rotation is not saved its claim goes too, so the
+	// refreshes waiting on it are not handed a token that never took effect.
+	saved, err := s.repo.Rotate(ctx, session, previousHash)
+	if err != nil || !saved {
+		if claimed {
+			_ = s.cache.ReleaseRotation(ctx, sessionID, fingerprint)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		// Rotated or revoked since it was read
+		return nil, "", ErrInvalidToken
 	}
 
 	// Update Cache
 	_ = s.cache.Set(ctx, session)
 
+	s.recordRefresh(ctx, session, previousIP)
+
 	return session, rawToken, nil
 }
 
+// graceRotation returns the session and the token refreshToken rotated to,
+// if that was the session's latest rotation and happened within
+// RefreshGrace. A token older than one generation is never let through,
+// however recent.
+func (s *SessionService) graceRotation(ctx context.Context, sessionID uuid.UUID, refreshToken string) (*core.Session, string, bool) {
+	if s.ttl.RefreshGrace <= 0 {
+		return nil, "", false
+	}
+	rotation, err := s.cache.GetRotation(ctx, sessionID, tokenFingerprint(refreshToken))
+	if err != nil || rotation == nil {
+		return nil, "", false
+	}
+	session, err := s.repo.GetByID(ctx, sessionID)
+	if err != nil || session.IsRevoked() || session.IsExpired() {
+		return nil, "", false
+	}
+	// The counter may still be one behind while the rotation is being saved
+	if rotation.Rotation < session.RotationCounter {
+		return nil, "", false
+	}
+	token, err := openRotation(refreshToken, rotation.SealedToken)
+	if err != nil {
+		return nil, "", false
+	}
+	return session, token, true
+}
+
+// tokenFingerprint identifies a refresh token in the cache without storing it
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// rotationCipher is AES-GCM under a key derived from the refresh token that
+// was rotated. The cache only knows its fingerprint, a different hash of it,
+// so only a client holding that token can open what it was rotated into.
+func rotationCipher(previous string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(previous))
+	mac.Write([]byte("session refresh rotation"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealRotation encrypts token, which previous was rotated into, for the cache
+func sealRotation(previous, token string) (string, error) {
+	aead, err := rotationCipher(previous)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(token), nil)), nil
+}
+
+// openRotation decrypts what sealRotation sealed for previous
+func openRotation(previous, sealed string) (string, error) {
+	aead, err := rotationCipher(previous)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("sealed rotation is too short")
+	}
+	token, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
 func (s *SessionService) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	session, err := s.repo.GetByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
 	// Update DB
 	if err := s.repo.Revoke(ctx, sessionID); err != nil {
 		return err
 	}
+	s.denyTokens(ctx, []*core.Session{session})
 
 	// Invalidate Cache
 	return s.cache.Delete(ctx, sessionID)
 }
 
 func (s *SessionService) RevokeAllUserSessions(ctx context.Context, userID string) error {
+	active, err := s.repo.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
 	// Update DB
 	if err := s.repo.RevokeAllForUser(ctx, userID); err != nil {
 		return err
 	}
+	own := make([]*core.Session, 0, len(active))
+	for _, session := range active {
+		if !session.IsImpersonated() {
+			own = append(own, session)
+		}
+	}
+	s.denyTokens(ctx, own)
 
 	// Invalidate Cache
 	return s.cache.DeleteAllForUser(ctx, userID)
 }
 
+// denyTokens puts revoked sessions on the deny list until their last access
+// token expires. Failures are only logged: the sessions are revoked either
+// way and their tokens expire within the access token TTL.
+func (s *SessionService) denyTokens(ctx context.Context, sessions []*core.Session) {
+	if s.denyList == nil {
+		return
+	}
+	for _, session := range sessions {
+		if err := s.denyList.Revoke(ctx, session.ID.String(), session.LastAccessExpiry()); err != nil {
+			log.Printf("Failed to deny-list access tokens of session %s: %v", session.ID, err)
+		}
+	}
+}
+
+// ListUserSessions returns the user's whole session history, for data exports
+func (s *SessionService) ListUserSessions(ctx context.Context, userID string) ([]*core.Session, error) {
+	return s.repo.ListByUserID(ctx, userID)
+}
+
+// GetPresence returns whether each user is online and when they were last
+// active, in the order asked. Users without sessions are offline and have
+// never been seen.
+func (s *SessionService) GetPresence(ctx context.Context, userIDs []string) ([]core.Presence, error) {
+	now := time.Now()
+	activity, err := s.repo.GetActivity(ctx, userIDs, now)
+	if err != nil {
+		return nil, err
+	}
+	byUser := make(map[string]core.UserActivity, len(activity))
+	for _, a := range activity {
+		byUser[a.UserID] = a
+	}
+
+	presence := make([]core.Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		a := byUser[userID]
+		a.UserID = userID
+		presence = append(presence, a.PresenceAt(now, s.presence.OnlineWindow))
+	}
+	return presence, nil
+}
+
 func (s *SessionService) generateRefreshToken() (string, string, error) {
 	// Generate random 32 bytes
 	b := make([]byte, 32)
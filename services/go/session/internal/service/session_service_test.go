@@ -0,0 +1,677 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+	rediscache "github.com/4yrg/gradeloop-core/services/go/session/internal/repository/redis"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/repository/sqlite"
+	"github.com/alicebob/miniredis/v2"
+	gosqlite "github.com/glebarez/go-sqlite"
+	sqlitedriver "github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// CreateWithLimit serialises each user's logins with a Postgres advisory
+// lock. SQLite has neither function; the one test connection already
+// serialises the transactions, so they do nothing here.
+func init() {
+	gosqlite.MustRegisterScalarFunction("hashtext", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return int64(0), nil
+	})
+	gosqlite.MustRegisterScalarFunction("pg_advisory_xact_lock", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return nil, nil
+	})
+}
+
+var testTTL = core.TTLConfig{
+	AccessTokenTTL: 15 * time.Minute,
+	SessionTTL:     24 * time.Hour,
+	InvalidTTL:     time.Minute,
+	RefreshGrace:   10 * time.Second,
+}
+
+// testEnv is a SessionService over an in-memory database and a miniredis
+// cache. SQLite has no row locks, so the one connection serialises writes
+// instead.
+type testEnv struct {
+	svc  *SessionService
+	repo core.SessionRepository
+	db   *gorm.DB
+	mr   *miniredis.Miniredis
+}
+
+func newTestRepo(t *testing.T) (*sqlite.SessionRepository, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlitedriver.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(&core.Session{}, &core.RefreshEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	return sqlite.NewSessionRepository(db), db
+}
+
+func newTestEnv(t *testing.T, repo func(*sqlite.SessionRepository) core.SessionRepository) *testEnv {
+	return newLimitedTestEnv(t, repo, 0, core.SessionLimitPolicyReject)
+}
+
+func newLimitedTestEnv(t *testing.T, repo func(*sqlite.SessionRepository) core.SessionRepository, maxSessions int, policy core.SessionLimitPolicy) *testEnv {
+	return newTTLTestEnv(t, repo, testTTL, maxSessions, policy)
+}
+
+func newTTLTestEnv(t *testing.T, repo func(*sqlite.SessionRepository) core.SessionRepository, ttl core.TTLConfig, maxSessions int, policy core.SessionLimitPolicy) *testEnv {
+	t.Helper()
+	base, db := newTestRepo(t)
+	var sessions core.SessionRepository = base
+	if repo != nil {
+		sessions = repo(base)
+	}
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+
+	svc := NewSessionService(sessions, rediscache.NewSessionCache(rdb), ttl, maxSessions, policy, nil,
+		core.PresenceConfig{}, core.RefreshHistoryConfig{Limit: 10})
+	return &testEnv{svc: svc, repo: sessions, db: db, mr: mr}
+}
+
+func (e *testEnv) login(t *testing.T, userID string) (*core.Session, string) {
+	t.Helper()
+	session, token, _, err := e.svc.CreateSession(context.Background(), userID, "STUDENT", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session, token
+}
+
+func TestConcurrentLoginsRespectSessionCap(t *testing.T) {
+	const limit, logins = 3, 10
+	env := newLimitedTestEnv(t, nil, limit, core.SessionLimitPolicyReject)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		created  int
+		rejected int
+	)
+	start := make(chan struct{})
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, _, _, err := env.svc.CreateSession(context.Background(), "user-1", "STUDENT", "203.0.113.9", "test")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				created++
+			case errors.Is(err, core.ErrSessionLimitReached):
+				rejected++
+			default:
+				t.Errorf("login = %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if created != limit || rejected != logins-limit {
+		t.Fatalf("%d logins created a session and %d were rejected, want %d and %d", created, rejected, limit, logins-limit)
+	}
+	active, err := env.repo.GetActiveByUserID(context.Background(), "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != limit {
+		t.Fatalf("user has %d active sessions, want the cap of %d", len(active), limit)
+	}
+}
+
+func TestConcurrentLoginsEvictOldest(t *testing.T) {
+	const limit, logins = 3, 10
+	env := newLimitedTestEnv(t, nil, limit, core.SessionLimitPolicyEvictOldest)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		evicted = make(map[string]int)
+	)
+	start := make(chan struct{})
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, _, ids, err := env.svc.CreateSession(context.Background(), "user-1", "STUDENT", "203.0.113.9", "test")
+			if err != nil {
+				t.Errorf("login = %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				evicted[id.String()]++
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	active, err := env.repo.GetActiveByUserID(context.Background(), "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != limit {
+		t.Fatalf("user has %d active sessions, want the cap of %d", len(active), limit)
+	}
+	if len(evicted) != logins-limit {
+		t.Fatalf("%d sessions were evicted, want %d", len(evicted), logins-limit)
+	}
+	for id, n := range evicted {
+		if n != 1 {
+			t.Errorf("session %s evicted by %d logins, want 1", id, n)
+		}
+	}
+}
+
+func TestSessionCapEvictsOldestFirst(t *testing.T) {
+	env := newLimitedTestEnv(t, nil, 2, core.SessionLimitPolicyEvictOldest)
+	ctx := context.Background()
+
+	// Created at distinct times, newest last
+	now := time.Now()
+	var sessions []*core.Session
+	for i := 0; i < 3; i++ {
+		session := &core.Session{
+			ID: uuidFor(i), UserID: "user-1", UserRole: "STUDENT",
+			CreatedAt: now.Add(time.Duration(i-3) * time.Minute), ExpiresAt: now.Add(time.Hour),
+		}
+		if err := env.repo.Create(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	// Two over the cap of 2, counting the new one
+	_, _, evicted, err := env.svc.CreateSession(ctx, "user-1", "STUDENT", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 2 || evicted[0] != sessions[0].ID || evicted[1] != sessions[1].ID {
+		t.Fatalf("evicted %v, want the two oldest %v and %v", evicted, sessions[0].ID, sessions[1].ID)
+	}
+	active, err := env.repo.GetActiveByUserID(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := make(map[uuid.UUID]bool)
+	for _, s := range active {
+		kept[s.ID] = true
+	}
+	if len(kept) != 2 || !kept[sessions[2].ID] {
+		t.Fatalf("active sessions %v, want the newest existing one and the new one", kept)
+	}
+}
+
+func TestImpersonationSessionsDoNotCountTowardsCap(t *testing.T) {
+	ctx := context.Background()
+	for _, policy := range []core.SessionLimitPolicy{core.SessionLimitPolicyReject, core.SessionLimitPolicyEvictOldest} {
+		t.Run(string(policy), func(t *testing.T) {
+			env := newLimitedTestEnv(t, nil, 1, policy)
+			support, err := env.svc.CreateImpersonationSession(ctx, "user-1", "STUDENT", "admin-1", "203.0.113.9", "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The user's own login is the first of their cap of 1
+			_, _, evicted, err := env.svc.CreateSession(ctx, "user-1", "STUDENT", "203.0.113.9", "test")
+			if err != nil {
+				t.Fatalf("login with an admin's support session open = %v", err)
+			}
+			if len(evicted) != 0 {
+				t.Fatalf("evicted %v, want nothing", evicted)
+			}
+			got, err := env.repo.GetByID(ctx, support.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.IsRevoked() {
+				t.Fatal("support session was revoked by the user's login")
+			}
+		})
+	}
+}
+
+func uuidFor(i int) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte{byte(i)})
+}
+
+// countingRepo counts session lookups, holding each until release is closed
+type countingRepo struct {
+	*sqlite.SessionRepository
+	lookups atomic.Int64
+	release chan struct{}
+}
+
+func (r *countingRepo) GetByID(ctx context.Context, id uuid.UUID) (*core.Session, error) {
+	r.lookups.Add(1)
+	<-r.release
+	return r.SessionRepository.GetByID(ctx, id)
+}
+
+// countingCache counts the negative cache lookups, which a validation makes
+// right before it falls back to the database
+type countingCache struct {
+	*rediscache.SessionCache
+	misses atomic.Int64
+}
+
+func (c *countingCache) GetInvalid(ctx context.Context, id uuid.UUID) (string, error) {
+	c.misses.Add(1)
+	return c.SessionCache.GetInvalid(ctx, id)
+}
+
+func newCountingEnv(t *testing.T) (*testEnv, *countingRepo) {
+	t.Helper()
+	var repo *countingRepo
+	env := newTestEnv(t, func(r *sqlite.SessionRepository) core.SessionRepository {
+		repo = &countingRepo{SessionRepository: r, release: make(chan struct{})}
+		return repo
+	})
+	return env, repo
+}
+
+// storeSession saves a session to the database only, as if its cache entry
+// had expired
+func storeSession(t *testing.T, env *testEnv, revoked bool) *core.Session {
+	t.Helper()
+	now := time.Now()
+	session := &core.Session{ID: uuid.New(), UserID: "user-1", UserRole: "STUDENT", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	if revoked {
+		session.RevokedAt = &now
+	}
+	if err := env.db.Create(session).Error; err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestConcurrentValidationsShareOneLookup(t *testing.T) {
+	env, repo := newCountingEnv(t)
+	cache := &countingCache{SessionCache: env.svc.cache.(*rediscache.SessionCache)}
+	env.svc.cache = cache
+	session := storeSession(t, env, false)
+
+	const validations = 1000
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Int64
+	)
+	for i := 0; i < validations; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := env.svc.ValidateSession(context.Background(), session.ID); err != nil {
+				failed.Add(1)
+			}
+		}()
+	}
+	// Hold the lookup until every validation has missed the cache,
+	deadline := time.Now().Add(10 * time.Second)
+	for cache.misses.Load() < validations {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d validations missed the cache", cache.misses.Load(), validations)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// and has had a moment to join the lookup
+	time.Sleep(20 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+
+	if n := failed.Load(); n != 0 {
+		t.Fatalf("%d validations failed", n)
+	}
+	if n := repo.lookups.Load(); n != 1 {
+		t.Fatalf("%d validations queried the database %d times, want once", validations, n)
+	}
+	if !env.mr.Exists("session:" + session.ID.String()) {
+		t.Fatal("session was not cached again after the lookup")
+	}
+}
+
+func TestInvalidSessionsServedFromNegativeCache(t *testing.T) {
+	env, repo := newCountingEnv(t)
+	close(repo.release)
+	ctx := context.Background()
+	revoked := storeSession(t, env, true)
+	missing := uuid.New()
+
+	for i := 0; i < 5; i++ {
+		if _, err := env.svc.ValidateSession(ctx, revoked.ID); !errors.Is(err, ErrSessionRevoked) {
+			t.Fatalf("validating a revoked session = %v, want ErrSessionRevoked", err)
+		}
+		if _, err := env.svc.ValidateSession(ctx, missing); err == nil {
+			t.Fatal("validating an unknown session succeeded")
+		}
+	}
+	if _, err := env.svc.ValidateSession(ctx, missing); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("validating an unknown session again = %v, want ErrSessionNotFound", err)
+	}
+	if n := repo.lookups.Load(); n != 2 {
+		t.Fatalf("invalid sessions were looked up %d times, want once each", n)
+	}
+
+	// Only remembered for InvalidTTL
+	env.mr.FastForward(testTTL.InvalidTTL)
+	if _, err := env.svc.ValidateSession(ctx, revoked.ID); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("validating a revoked session = %v, want ErrSessionRevoked", err)
+	}
+	if n := repo.lookups.Load(); n != 3 {
+		t.Fatalf("revoked session was not looked up again after InvalidTTL")
+	}
+}
+
+func TestListUserSessionsIncludesRevoked(t *testing.T) {
+	env := newTestEnv(t, nil)
+	active := storeSession(t, env, false)
+	revoked := storeSession(t, env, true)
+	other := &core.Session{ID: uuid.New(), UserID: "user-2", UserRole: "STUDENT", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := env.db.Create(other).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := env.svc.ListUserSessions(context.Background(), "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[uuid.UUID]bool{}
+	for _, s := range sessions {
+		got[s.ID] = true
+	}
+	if len(sessions) != 2 || !got[active.ID] || !got[revoked.ID] {
+		t.Fatalf("listed %d sessions, want the user's active and revoked ones", len(sessions))
+	}
+}
+
+// recordingDenyList records which sessions were deny-listed and until when
+type recordingDenyList struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func (d *recordingDenyList) Revoke(_ context.Context, sessionID string, until time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.until[sessionID] = until
+	return nil
+}
+
+func withDenyList(env *testEnv) *recordingDenyList {
+	deny := &recordingDenyList{until: make(map[string]time.Time)}
+	env.svc.denyList = deny
+	return deny
+}
+
+func TestRevokeDenyListsAccessTokens(t *testing.T) {
+	env := newTestEnv(t, nil)
+	deny := withDenyList(env)
+	ctx := context.Background()
+	session, _ := env.login(t, "user-1")
+
+	if err := env.svc.RevokeSession(ctx, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	until, ok := deny.until[session.ID.String()]
+	if !ok || !until.Equal(session.AccessExpiresAt) {
+		t.Fatalf("deny-listed until %v (listed %v), want the access token expiry %v", until, ok, session.AccessExpiresAt)
+	}
+	if _, err := env.svc.ValidateSession(ctx, session.ID); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("validating the revoked session = %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestRevokeAllLeavesImpersonatedSessionsOffDenyList(t *testing.T) {
+	env := newTestEnv(t, nil)
+	deny := withDenyList(env)
+	ctx := context.Background()
+	own, _ := env.login(t, "user-1")
+	support, err := env.svc.CreateImpersonationSession(ctx, "user-1", "STUDENT", "admin-1", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.svc.RevokeAllUserSessions(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := deny.until[own.ID.String()]; !ok {
+		t.Error("the user's own session was not deny-listed")
+	}
+	if _, ok := deny.until[support.ID.String()]; ok {
+		t.Error("the impersonated session was deny-listed")
+	}
+}
+
+func TestEvictedSessionsAreDenyListed(t *testing.T) {
+	env := newLimitedTestEnv(t, nil, 1, core.SessionLimitPolicyEvictOldest)
+	deny := withDenyList(env)
+	first, _ := env.login(t, "user-1")
+
+	env.login(t, "user-1")
+	if _, ok := deny.until[first.ID.String()]; !ok {
+		t.Fatal("evicted session was not deny-listed")
+	}
+}
+
+func TestCancelledValidationDoesNotFailOthers(t *testing.T) {
+	env, repo := newCountingEnv(t)
+	session := storeSession(t, env, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := env.svc.ValidateSession(ctx, session.ID)
+		first <- err
+	}()
+	for repo.lookups.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan error, 1)
+	go func() {
+		_, err := env.svc.ValidateSession(context.Background(), session.ID)
+		second <- err
+	}()
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled validation = %v, want context.Canceled", err)
+	}
+	close(repo.release)
+	if err := <-second; err != nil {
+		t.Fatalf("validation sharing the cancelled one's lookup = %v", err)
+	}
+	if n := repo.lookups.Load(); n != 1 {
+		t.Fatalf("database queried %d times, want once", n)
+	}
+}
+
+func (e *testEnv) rotationKeys() []string {
+	var keys []string
+	for _, key := range e.mr.Keys() {
+		if strings.HasPrefix(key, "session_rotation:") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestConcurrentRefreshesConvergeOnOneToken(t *testing.T) {
+	env := newTestEnv(t, nil)
+	session, token := env.login(t, "user-1")
+
+	const refreshes = 8
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		tokens = make(map[string]int)
+	)
+	start := make(chan struct{})
+	for i := 0; i < refreshes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, next, err := env.svc.RefreshSession(context.Background(), session.ID, token, "203.0.113.9", "test")
+			if err != nil {
+				t.Errorf("refresh = %v", err)
+				return
+			}
+			mu.Lock()
+			tokens[next]++
+			mu.Unlock()
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if len(tokens) != 1 {
+		t.Fatalf("refreshes got %d different tokens, want them all to get the same one", len(tokens))
+	}
+	saved, err := env.repo.GetByID(context.Background(), session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.RotationCounter != 2 || saved.IsRevoked() {
+		t.Fatalf("session is at rotation %d, revoked %v; want one rotation and still active", saved.RotationCounter, saved.IsRevoked())
+	}
+	for next := range tokens {
+		if _, _, err := env.svc.RefreshSession(context.Background(), session.ID, next, "203.0.113.9", "test"); err != nil {
+			t.Fatalf("refresh with the shared token = %v", err)
+		}
+	}
+}
+
+func TestRotationClaimDoesNotHoldToken(t *testing.T) {
+	env := newTestEnv(t, nil)
+	session, token := env.login(t, "user-1")
+
+	_, next, err := env.svc.RefreshSession(context.Background(), session.ID, token, "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := env.rotationKeys()
+	if len(keys) != 1 {
+		t.Fatalf("%d rotation claims in Redis, want 1", len(keys))
+	}
+	claim, err := env.mr.Get(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(claim, next) || strings.Contains(keys[0], next) {
+		t.Fatal("rotation claim holds the new refresh token in the clear")
+	}
+	if strings.Contains(claim, token) || strings.Contains(keys[0], token) {
+		t.Fatal("rotation claim holds the old refresh token in the clear")
+	}
+
+	// The client with the old token still gets the new one within the grace
+	_, again, err := env.svc.RefreshSession(context.Background(), session.ID, token, "203.0.113.9", "test")
+	if err != nil || again != next {
+		t.Fatalf("refresh with the rotated token = %v, same token %v; want the new token", err, again == next)
+	}
+}
+
+func TestRotatedTokenRejectedAfterGrace(t *testing.T) {
+	env := newTestEnv(t, nil)
+	session, token := env.login(t, "user-1")
+
+	if _, _, err := env.svc.RefreshSession(context.Background(), session.ID, token, "203.0.113.9", "test"); err != nil {
+		t.Fatal(err)
+	}
+	env.mr.FastForward(testTTL.RefreshGrace)
+	if _, _, err := env.svc.RefreshSession(context.Background(), session.ID, token, "203.0.113.9", "test"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("refresh with the rotated token after the grace = %v, want ErrInvalidToken", err)
+	}
+	if saved, err := env.repo.GetByID(context.Background(), session.ID); err != nil || !saved.IsRevoked() {
+		t.Fatalf("session after a replayed token: %v, %v; want it revoked", saved, err)
+	}
+}
+
+func TestRotationTwoGenerationsBackRejected(t *testing.T) {
+	env := newTestEnv(t, nil)
+	session, first := env.login(t, "user-1")
+
+	_, second, err := env.svc.RefreshSession(context.Background(), session.ID, first, "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := env.svc.RefreshSession(context.Background(), session.ID, second, "203.0.113.9", "test"); err != nil {
+		t.Fatal(err)
+	}
+	// Still within the grace, but the first token's successor was itself
+	// rotated away
+	if _, _, err := env.svc.RefreshSession(context.Background(), session.ID, first, "203.0.113.9", "test"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("refresh two rotations back = %v, want ErrInvalidToken", err)
+	}
+}
+
+// failingRotateRepo fails every rotation, as if the database went away
+// between the claim and the save
+type failingRotateRepo struct {
+	*sqlite.SessionRepository
+}
+
+var errRotateFailed = errors.New("database unavailable")
+
+func (failingRotateRepo) Rotate(context.Context, *core.Session, string) (bool, error) {
+	return false, errRotateFailed
+}
+
+func TestFailedRotationDropsItsClaim(t *testing.T) {
+	env := newTestEnv(t, func(r *sqlite.SessionRepository) core.SessionRepository { return failingRotateRepo{r} })
+	session, token := env.login(t, "user-1")
+
+	if _, _, err := env.svc.RefreshSession(context.Background(), session.ID, token, "203.0.113.9", "test"); !errors.Is(err, errRotateFailed) {
+		t.Fatalf("refresh = %v, want the rotation's error", err)
+	}
+	if keys := env.rotationKeys(); len(keys) != 0 {
+		t.Fatalf("rotation claims %v left after the rotation failed, want none", keys)
+	}
+	// The next refresh with the same token claims it afresh instead of
+	// being handed a token that was never saved
+	if _, _, err := env.svc.RefreshSession(context.Background(), session.ID, token, "203.0.113.9", "test"); !errors.Is(err, errRotateFailed) {
+		t.Fatalf("retried refresh = %v, want the rotation's error", err)
+	}
+}
+
+func TestSealedRotationOpensOnlyWithPreviousToken(t *testing.T) {
+	sealed, err := sealRotation("previous", "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := openRotation("previous", sealed); err != nil || token != "next" {
+		t.Fatalf("openRotation = %q, %v; want %q", token, err, "next")
+	}
+	if _, err := openRotation("other", sealed); err == nil {
+		t.Fatal("sealed rotation opened with another token")
+	}
+}
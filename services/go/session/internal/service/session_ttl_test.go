@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+)
+
+// near reports whether got is within a second of want
+func near(got, want time.Time) bool {
+	d := got.Sub(want)
+	return d > -time.Second && d < time.Second
+}
+
+func TestSessionTTLByRole(t *testing.T) {
+	ttl := testTTL
+	ttl.RoleOverrides = map[string]core.RoleTTL{
+		"SYSTEM_ADMIN": {AccessTokenTTL: 5 * time.Minute, SessionTTL: time.Hour},
+	}
+	env := newTTLTestEnv(t, nil, ttl, 0, core.SessionLimitPolicyReject)
+	ctx := context.Background()
+
+	now := time.Now()
+	admin, _, _, err := env.svc.CreateSession(ctx, "admin-1", "SYSTEM_ADMIN", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(admin.ExpiresAt, now.Add(time.Hour)) || !near(admin.AccessExpiresAt, now.Add(5*time.Minute)) {
+		t.Errorf("SYSTEM_ADMIN session expires at %v with access until %v, want in 1h and 5m", admin.ExpiresAt, admin.AccessExpiresAt)
+	}
+
+	student, _, _, err := env.svc.CreateSession(ctx, "student-1", "STUDENT", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(student.ExpiresAt, now.Add(24*time.Hour)) || !near(student.AccessExpiresAt, now.Add(15*time.Minute)) {
+		t.Errorf("STUDENT session expires at %v with access until %v, want the defaults of 24h and 15m", student.ExpiresAt, student.AccessExpiresAt)
+	}
+}
+
+func TestRefreshStopsAtMaxLifetime(t *testing.T) {
+	ttl := testTTL
+	ttl.MaxLifetime = 2 * time.Hour
+	env := newTTLTestEnv(t, nil, ttl, 0, core.SessionLimitPolicyReject)
+	ctx := context.Background()
+
+	session, token, _, err := env.svc.CreateSession(ctx, "user-1", "STUDENT", "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := session.CreatedAt.Add(2 * time.Hour)
+	if !near(session.ExpiresAt, limit) {
+		t.Fatalf("new session expires at %v, want the max lifetime %v", session.ExpiresAt, limit)
+	}
+
+	refreshed, _, err := env.svc.RefreshSession(ctx, session.ID, token, "203.0.113.9", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Refreshing slides the expiry, but never past the max lifetime
+	if !near(refreshed.ExpiresAt, limit) {
+		t.Fatalf("refreshed session expires at %v, want it held at %v", refreshed.ExpiresAt, limit)
+	}
+	if refreshed.AccessExpiresAt.After(refreshed.ExpiresAt) {
+		t.Fatalf("access token outlives the session: %v after %v", refreshed.AccessExpiresAt, refreshed.ExpiresAt)
+	}
+}
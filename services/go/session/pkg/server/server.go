@@ -0,0 +1,72 @@
+// Package server builds the session service the way cmd/server runs it,
+// short of opening its database and Redis or listening, so that tests can
+// serve it in-process on stand-ins.
+package server
+
+import (
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/request"
+	"github.com/4yrg/gradeloop-core/libs/rpc"
+	sessionv1 "github.com/4yrg/gradeloop-core/libs/rpc/session/v1"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/api"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/config"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/grpcapi"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/repository/redis"
+	sqliteRepo "github.com/4yrg/gradeloop-core/services/go/session/internal/repository/sqlite"
+	"github.com/4yrg/gradeloop-core/services/go/session/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	goredis "github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+)
+
+// Config is the service's configuration, named here so that callers outside
+// the module can adjust one
+type Config = config.Config
+
+// LoadConfig reads the configuration from the environment, as main does
+func LoadConfig() (*Config, error) {
+	return config.Load()
+}
+
+// Models are the service's tables. The versioned migrations are written for
+// Postgres; a test database such as SQLite is migrated from these instead.
+func Models() []interface{} {
+	return []interface{}{&core.Session{}, &core.RefreshEvent{}}
+}
+
+// Server is the HTTP and gRPC APIs and the service they share
+type Server struct {
+	// App serves every HTTP route
+	App *fiber.App
+	// GRPC serves the gRPC API, checking the internal token
+	GRPC *grpc.Server
+	// Service is what both APIs call
+	Service *service.SessionService
+}
+
+// New builds the server on db, whose schema is expected to be migrated, and
+// rdb
+func New(cfg *Config, db *gorm.DB, rdb goredis.UniversalClient) *Server {
+	sessionRepo := sqliteRepo.NewSessionRepository(db)
+	sessionCache := redis.NewSessionCache(rdb)
+
+	// Revoked sessions are deny-listed so their access tokens stop working
+	// wherever they are verified with the same Redis
+	denyList := jwtauth.NewDenyList(rdb, 0)
+	sessionService := service.NewSessionService(sessionRepo, sessionCache, cfg.TTL(), cfg.MaxSessionsPerUser, core.SessionLimitPolicy(cfg.SessionLimitPolicy), denyList, cfg.Presence(), cfg.RefreshHistory())
+
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler, BodyLimit: request.DefaultBodyLimit})
+	app.Use(logger.New())
+	api.RegisterRoutes(app, api.NewHandler(sessionService))
+	app.Get("/debug/db", database.StatsHandler(db))
+
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(rpc.RequireInternalToken(cfg.InternalSecret)))
+	sessionv1.RegisterSessionServiceServer(grpcServer, grpcapi.NewServer(sessionService))
+
+	return &Server{App: app, GRPC: grpcServer, Service: sessionService}
+}
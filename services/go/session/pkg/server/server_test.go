@@ -0,0 +1,87 @@
+package server
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	gosqlite "github.com/glebarez/go-sqlite"
+	sqlitedriver "github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Logins take a Postgres advisory lock, which SQLite has no functions for;
+// the one test connection serialises them instead
+func init() {
+	gosqlite.MustRegisterScalarFunction("hashtext", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return int64(0), nil
+	})
+	gosqlite.MustRegisterScalarFunction("pg_advisory_xact_lock", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return nil, nil
+	})
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	t.Setenv("SESSION_DATABASE_URL", "file::memory:")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open(sqlitedriver.Open(cfg.DatabaseURL), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(Models()...); err != nil {
+		t.Fatal(err)
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return New(cfg, db, rdb)
+}
+
+func post(t *testing.T, srv *Server, path, body string) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", "insecure-secret-for-dev")
+	resp, err := srv.App.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode >= 300 {
+		t.Fatalf("POST %s = %d %v", path, resp.StatusCode, out)
+	}
+	return out
+}
+
+func TestServerServesWithoutMain(t *testing.T) {
+	srv := newTestServer(t)
+
+	created := post(t, srv, "/internal/sessions/", `{"user_id":"6f1c2b9e-8f44-4d2a-9c1e-0b7a3e5d2c11","user_role":"STUDENT"}`)
+	id, _ := created["session_id"].(string)
+	if id == "" {
+		t.Fatalf("created session %v has no session_id", created)
+	}
+	session := post(t, srv, "/internal/sessions/validate", `{"session_id":"`+id+`"}`)
+	if session["id"] != id {
+		t.Fatalf("validated session %v, want %s", session, id)
+	}
+}
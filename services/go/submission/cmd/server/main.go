@@ -1,18 +1,31 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/4yrg/gradeloop-core/libs/apierror"
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/libs/database"
+	"github.com/4yrg/gradeloop-core/libs/userevents"
+	"github.com/4yrg/gradeloop-core/services/go/authn/pkg/jwtauth"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/api"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/assignment"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/notify"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/scanner"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/service"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/similarity"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/storage"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 func main() {
@@ -24,7 +37,11 @@ func main() {
 	if dsn == "" {
 		log.Fatal("SUBMISSION_DATABASE_URL or DATABASE_URL must be set")
 	}
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	poolCfg, err := database.LoadPoolConfig("SUBMISSION")
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := database.Open(postgres.Open(dsn), poolCfg)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -45,15 +62,191 @@ func main() {
 		// In production, you might want to fatal error
 	}
 
-	svc := service.NewSubmissionService(repo, storageClient)
-	handler := api.NewHandler(svc)
+	gracePeriod := 30 * time.Second
+	if v := os.Getenv("SUBMISSION_GRACE_PERIOD"); v != "" {
+		gracePeriod, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid SUBMISSION_GRACE_PERIOD:", err)
+		}
+	}
+
+	commentNotifyDelay := 5 * time.Minute
+	if v := os.Getenv("COMMENT_NOTIFY_DELAY"); v != "" {
+		commentNotifyDelay, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid COMMENT_NOTIFY_DELAY:", err)
+		}
+	}
+	commentDeleteWindow := 15 * time.Minute
+	if v := os.Getenv("COMMENT_DELETE_WINDOW"); v != "" {
+		commentDeleteWindow, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid COMMENT_DELETE_WINDOW:", err)
+		}
+	}
+	statsCacheTTL := 30 * time.Second
+	if v := os.Getenv("STATS_CACHE_TTL"); v != "" {
+		statsCacheTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid STATS_CACHE_TTL:", err)
+		}
+	}
+	emailSender := notify.NewEmailSender()
+	notifier := notify.NewCommentNotifier(emailSender, commentNotifyDelay)
+
+	scanCfg := scanner.Config{
+		Kind:       os.Getenv("SCANNER"),
+		ClamAVAddr: os.Getenv("CLAMAV_ADDR"),
+		Timeout:    60 * time.Second,
+	}
+	if scanCfg.ClamAVAddr == "" {
+		scanCfg.ClamAVAddr = "localhost:3310"
+	}
+	if v := os.Getenv("SCAN_TIMEOUT"); v != "" {
+		scanCfg.Timeout, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid SCAN_TIMEOUT:", err)
+		}
+	}
+	fileScanner, err := scanner.New(scanCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scanInterval := 5 * time.Second
+	if v := os.Getenv("SCAN_POLL_INTERVAL"); v != "" {
+		scanInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid SCAN_POLL_INTERVAL:", err)
+		}
+	}
+
+	similarityCfg := similarity.Config{
+		URL:     os.Getenv("SIMILARITY_CHECKER_URL"),
+		Token:   os.Getenv("SIMILARITY_CHECKER_TOKEN"),
+		Timeout: 30 * time.Minute,
+	}
+	if v := os.Getenv("SIMILARITY_CHECKER_TIMEOUT"); v != "" {
+		similarityCfg.Timeout, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid SIMILARITY_CHECKER_TIMEOUT:", err)
+		}
+	}
+	checker, err := similarity.New(similarityCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	similarityInterval := 30 * time.Second
+	if v := os.Getenv("SIMILARITY_POLL_INTERVAL"); v != "" {
+		similarityInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid SIMILARITY_POLL_INTERVAL:", err)
+		}
+	}
+	archiveLease := 10 * time.Minute
+	if v := os.Getenv("ARCHIVE_JOB_LEASE"); v != "" {
+		archiveLease, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid ARCHIVE_JOB_LEASE:", err)
+		}
+	}
+	archiveInterval := 5 * time.Second
+	if v := os.Getenv("ARCHIVE_POLL_INTERVAL"); v != "" {
+		archiveInterval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid ARCHIVE_POLL_INTERVAL:", err)
+		}
+	}
+
+	jwksURL := os.Getenv("AUTHN_JWKS_URL")
+	if jwksURL == "" {
+		jwksURL = "http://localhost:8003/.well-known/jwks.json"
+	}
+	verifierCfg := jwtauth.Config{JWKSURL: jwksURL}
+	var events service.EventPublisher
+	if redisAddr := os.Getenv("REDIS_ADDR"); redisAddr != "" {
+		redisDB := 0
+		if v := os.Getenv("REDIS_DB"); v != "" {
+			redisDB, err = strconv.Atoi(v)
+			if err != nil {
+				log.Fatal("Invalid REDIS_DB:", err)
+			}
+		}
+		denyListCacheTTL := 5 * time.Second
+		if v := os.Getenv("TOKEN_DENYLIST_CACHE_TTL"); v != "" {
+			denyListCacheTTL, err = time.ParseDuration(v)
+			if err != nil {
+				log.Fatal("Invalid TOKEN_DENYLIST_CACHE_TTL:", err)
+			}
+		}
+		rdb := redis.NewClient(&redis.Options{
+			Addr:     redisAddr,
+			Username: os.Getenv("REDIS_USERNAME"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       redisDB,
+		})
+		// Reject access tokens of sessions revoked before the tokens expire
+		verifierCfg.DenyList = jwtauth.NewDenyList(rdb, denyListCacheTTL)
+		// Tell students through the notification service when grades are released
+		events = userevents.NewPublisher(rdb)
+	}
+	verifier := jwtauth.NewVerifier(verifierCfg)
+
+	authzCacheTTL := 30 * time.Second
+	if v := os.Getenv("AUTHZ_CACHE_TTL"); v != "" {
+		authzCacheTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid AUTHZ_CACHE_TTL:", err)
+		}
+	}
+	internalSecret := os.Getenv("INTERNAL_SECRET")
+	if internalSecret == "" {
+		internalSecret = "insecure-secret-for-dev"
+	}
+	identityURL := os.Getenv("IDENTITY_SERVICE_URL")
+	if identityURL == "" {
+		identityURL = "http://localhost:8001"
+	}
+	identity := clients.NewIdentity(clients.Config{BaseURL: identityURL, InternalToken: internalSecret})
+
+	svc := service.NewSubmissionService(repo, storageClient, assignment.NewClient(), identity, gracePeriod, notifier, commentDeleteWindow, events, statsCacheTTL)
+	authorizer := authorize.NewAuthorizer(verifier, authorize.NewCachedClient(authorize.NewClient(), authzCacheTTL), internalSecret)
+
+	handler := api.NewHandler(svc, authorizer)
+
+	// Uploads stay quarantined, and cannot be downloaded, until scanned
+	if storageClient != nil {
+		go service.NewScanWorker(repo, storageClient, fileScanner, emailSender, scanInterval).Run(context.Background())
+	}
+	// Without a checker similarity jobs stay queued. A job is taken over by
+	// another instance if it runs past the checker's timeout.
+	if storageClient != nil && checker != nil {
+		lease := similarityCfg.Timeout + 5*time.Minute
+		go service.NewSimilarityWorker(repo, storageClient, checker, lease, similarityInterval).Run(context.Background())
+	}
+	// A running archive job keeps its claim while it makes progress, and is
+	// taken over by another instance if it stalls for archiveLease
+	if storageClient != nil {
+		go service.NewArchiveWorker(repo, storageClient, identity, archiveLease, archiveInterval).Run(context.Background())
+	}
+
+	// Submissions carry their files in the body, so the server takes bodies
+	// this large; every other route is held to request.DefaultBodyLimit
+	uploadLimit := 25
+	if v := os.Getenv("SUBMISSION_BODY_LIMIT_MB"); v != "" {
+		uploadLimit, err = strconv.Atoi(v)
+		if err != nil || uploadLimit <= 0 {
+			log.Fatal("Invalid SUBMISSION_BODY_LIMIT_MB:", v)
+		}
+	}
+	uploadLimit <<= 20
 
 	// 3. Setup Fiber
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: apierror.FiberErrorHandler, BodyLimit: uploadLimit})
 	app.Use(logger.New())
 	app.Use(recover.New())
 
-	api.SetupRoutes(app, handler)
+	api.SetupRoutes(app, handler, uploadLimit)
+	app.Get("/debug/db", database.StatsHandler(db))
 
 	// 4. Start
 	port := os.Getenv("PORT")
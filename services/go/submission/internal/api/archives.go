@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/assignment"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StartArchiveJob queues building a zip of the assignment's submissions for
+// download. Only instructors of the assignment's class and holders of
+// submission.archive_all, such as admins, may ask for one. The archive is
+// built in the background; poll the job for its progress and, once it has
+// completed, its download link.
+func (h *Handler) StartArchiveJob(c *fiber.Ctx) error {
+	assignmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment ID"})
+	}
+
+	var req struct {
+		Attempt int `json:"attempt"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+		}
+	}
+
+	requester, err := h.archiveRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+	}
+	job, err := h.svc.StartArchiveJob(c.UserContext(), assignmentID, req.Attempt, requester)
+	if err != nil {
+		return archiveError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+func (h *Handler) GetArchiveJob(c *fiber.Ctx) error {
+	assignmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment ID"})
+	}
+	jobID, err := uuid.Parse(c.Params("jobId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job ID format"})
+	}
+
+	requester, err := h.archiveRequester(c)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+	}
+	job, err := h.svc.GetArchiveJob(c.UserContext(), assignmentID, jobID, requester)
+	if err != nil {
+		return archiveError(c, err)
+	}
+
+	return c.JSON(job)
+}
+
+// archiveRequester is the caller as an archive requester; services may
+// archive any assignment
+func (h *Handler) archiveRequester(c *fiber.Ctx) (service.ArchiveRequester, error) {
+	caller := authorize.CallerFrom(c)
+	if caller == nil {
+		return service.ArchiveRequester{All: true}, nil
+	}
+	all, err := h.auth.Allows(c, "submission.archive_all")
+	if err != nil {
+		return service.ArchiveRequester{}, err
+	}
+	return service.ArchiveRequester{UserID: caller.UserID, All: all}, nil
+}
+
+func archiveError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidArchiveJob):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrArchiveJobActive):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrArchiveForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, assignment.ErrAssignmentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Assignment not found"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Archive job not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
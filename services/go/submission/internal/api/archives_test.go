@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// archiveService answers the archive calls and nothing else, refusing
+// anyone but instructor-1 who cannot archive every assignment
+type archiveService struct {
+	service.SubmissionService
+	requesters []service.ArchiveRequester
+}
+
+func (s *archiveService) StartArchiveJob(_ context.Context, assignmentID uuid.UUID, attempt int, requester service.ArchiveRequester) (*core.ArchiveJob, error) {
+	// Fiber reuses the request's memory once the handler returns
+	requester.UserID = strings.Clone(requester.UserID)
+	s.requesters = append(s.requesters, requester)
+	if !requester.All && requester.UserID != "instructor-1" {
+		return nil, service.ErrArchiveForbidden
+	}
+	return &core.ArchiveJob{ID: uuid.New(), AssignmentID: assignmentID, Attempt: attempt, Status: core.ArchiveJobQueued}, nil
+}
+
+func TestArchiveRoutesAreForInstructorsAndAdmins(t *testing.T) {
+	svc := &archiveService{}
+	authz := roleAuthz{
+		"instructor":      {"submission.archive"},
+		"institute_admin": {"submission.archive", "submission.archive_all"},
+		"student":         {"submission.read", "submission.create"},
+	}
+	app := fiber.New()
+	SetupRoutes(app, NewHandler(svc, authorize.NewAuthorizer(nil, authz, testInternalToken)), 1<<20)
+
+	path := "/api/v1/submissions/assignments/" + uuid.NewString() + "/archives"
+	for _, tc := range []struct {
+		userID, role string
+		want         int
+	}{
+		{"student-1", "student", fiber.StatusForbidden},
+		{"instructor-2", "instructor", fiber.StatusForbidden},
+		{"instructor-1", "instructor", fiber.StatusAccepted},
+		{"admin-1", "institute_admin", fiber.StatusAccepted},
+	} {
+		req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(`{"attempt":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Internal-Token", testInternalToken)
+		req.Header.Set("X-User-Id", tc.userID)
+		req.Header.Set("X-User-Role", tc.role)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s as %s: status %d, want %d", tc.userID, tc.role, resp.StatusCode, tc.want)
+		}
+	}
+
+	// The student is refused before the service is asked; only admins may
+	// archive assignments they do not teach
+	want := []service.ArchiveRequester{{UserID: "instructor-2"}, {UserID: "instructor-1"}, {UserID: "admin-1", All: true}}
+	if len(svc.requesters) != len(want) {
+		t.Fatalf("service asked by %+v, want %+v", svc.requesters, want)
+	}
+	for i := range want {
+		if svc.requesters[i] != want[i] {
+			t.Errorf("request %d by %+v, want %+v", i, svc.requesters[i], want[i])
+		}
+	}
+}
@@ -1,27 +1,91 @@
 package api
 
 import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/libs/request"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/assignment"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/service"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
-	svc service.SubmissionService
+	svc  service.SubmissionService
+	auth *authorize.Authorizer
+}
+
+func NewHandler(svc service.SubmissionService, auth *authorize.Authorizer) *Handler {
+	return &Handler{svc: svc, auth: auth}
+}
+
+// route is an endpoint and the permission a caller needs to use it
+type route struct {
+	method     string
+	path       string
+	permission string
+	handler    fiber.Handler
+}
+
+// routes lists every endpoint with its required permission, so who may call
+// what can be reviewed in one place. There are no unprotected routes.
+func (h *Handler) routes() []route {
+	return []route{
+		{fiber.MethodPost, "/", "submission.create", h.Submit},
+		{fiber.MethodGet, "/", "submission.read", h.ListSubmissions},
+		{fiber.MethodGet, "/grading", "submission.grade", h.GradingList}, // before /:id so it is not taken as an ID
+		{fiber.MethodGet, "/attempts", "submission.read", h.AttemptHistory},
+		{fiber.MethodPost, "/attempts/grant", "attempt.grant", h.GrantAttempts},
+		{fiber.MethodPost, "/assignments/:id/similarity-jobs", "similarity.run", h.StartSimilarityJob},
+		{fiber.MethodGet, "/assignments/:id/similarity-jobs", "similarity.read", h.ListSimilarityJobs},
+		{fiber.MethodGet, "/assignments/:id/similarity-jobs/:jobId", "similarity.read", h.GetSimilarityJob},
+		{fiber.MethodGet, "/assignments/:id/similar-pairs", "similarity.read", h.SimilarPairs},
+		{fiber.MethodPost, "/assignments/:id/archives", "submission.archive", h.StartArchiveJob},
+		{fiber.MethodGet, "/assignments/:id/archives/:jobId", "submission.archive", h.GetArchiveJob},
+		{fiber.MethodGet, "/assignments/:id/stats", "grade.stats", h.AssignmentStats},
+		{fiber.MethodGet, "/classes/:id/assignment-stats", "grade.stats", h.ClassAssignmentStats},
+		{fiber.MethodGet, "/:id", "submission.read", h.GetSubmission},
+		{fiber.MethodPatch, "/:id/status", "submission.update", h.UpdateStatus},
+		{fiber.MethodGet, "/:id/files/:fileId", "submission.read", h.DownloadFile},
+		{fiber.MethodPost, "/:id/rescan", "submission.rescan", h.Rescan},
+		{fiber.MethodGet, "/:id/grade", "grade.read", h.GetGrade},
+		{fiber.MethodPut, "/:id/grade", "submission.grade", h.GradeSubmission},
+		{fiber.MethodPost, "/:id/grade/release", "grade.release", h.ReleaseGrade},
+		{fiber.MethodPut, "/:id/grade/late-penalty", "submission.grade", h.OverrideLatePenalty},
+		{fiber.MethodGet, "/:id/grade-history", "grade.history", h.GetGradeHistory},
+		{fiber.MethodPost, "/:id/comments", "comment.create", h.AddComment},
+		{fiber.MethodGet, "/:id/comments", "comment.read", h.ListComments},
+		{fiber.MethodDelete, "/:id/comments/:commentId", "comment.create", h.DeleteComment},
+	}
 }
 
-func NewHandler(svc service.SubmissionService) *Handler {
-	return &Handler{svc: svc}
+// studentRoutes are the endpoints under /api/v1/students
+func (h *Handler) studentRoutes() []route {
+	return []route{
+		{fiber.MethodGet, "/:id/transcript", "transcript.read", h.Transcript},
+	}
 }
 
-func SetupRoutes(app *fiber.App, h *Handler) {
+// SetupRoutes registers every route. Submitting, which carries the files,
+// takes bodies up to uploadLimit bytes, which the server's BodyLimit has to
+// allow; every other route takes up to request.DefaultBodyLimit.
+func SetupRoutes(app *fiber.App, h *Handler, uploadLimit int) {
 	api := app.Group("/api/v1/submissions")
+	for _, r := range h.routes() {
+		limit := request.DefaultBodyLimit
+		if r.method == fiber.MethodPost && r.path == "/" {
+			limit = uploadLimit
+		}
+		api.Add(r.method, r.path, request.Limit(limit), h.auth.Require(r.permission), r.handler)
+	}
 
-	api.Post("/", h.Submit)
-	api.Get("/", h.ListSubmissions)
-	api.Get("/:id", h.GetSubmission)
-	api.Patch("/:id/status", h.UpdateStatus)
+	students := app.Group("/api/v1/students")
+	for _, r := range h.studentRoutes() {
+		students.Add(r.method, r.path, request.Limit(request.DefaultBodyLimit), h.auth.Require(r.permission), r.handler)
+	}
 }
 
 func (h *Handler) Submit(c *fiber.Ctx) error {
@@ -76,6 +140,20 @@ func (h *Handler) Submit(c *fiber.Ctx) error {
 
 	// Submit with file contents
 	if err := h.svc.Submit(c.Context(), submission, fileContents); err != nil {
+		if errors.Is(err, service.ErrAttemptNotStarted) || errors.Is(err, service.ErrSubmissionWindowOver) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrGroupRequired) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		var limitErr *service.AttemptLimitError
+		if errors.As(err, &limitErr) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":           err.Error(),
+				"attemptsUsed":    limitErr.Used,
+				"attemptsAllowed": limitErr.Allowed,
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -117,6 +195,87 @@ func (h *Handler) ListSubmissions(c *fiber.Ctx) error {
 	return c.JSON(submissions)
 }
 
+func (h *Handler) GradingList(c *fiber.Ctx) error {
+	assignmentID, err := uuid.Parse(c.Query("assignmentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "assignmentId is required"})
+	}
+
+	// 0 is the latest attempt
+	attempt := c.QueryInt("attempt", 0)
+	if attempt < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "attempt must be a positive number"})
+	}
+
+	rows, err := h.svc.GradingList(c.Context(), assignmentID, attempt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rows)
+}
+
+func (h *Handler) AttemptHistory(c *fiber.Ctx) error {
+	assignmentID, err := uuid.Parse(c.Query("assignmentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "assignmentId is required"})
+	}
+	studentID := c.Query("studentId")
+	if studentID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId is required"})
+	}
+
+	history, err := h.svc.AttemptHistory(c.Context(), assignmentID, studentID)
+	if err != nil {
+		return attemptError(c, err)
+	}
+
+	return c.JSON(history)
+}
+
+func (h *Handler) GrantAttempts(c *fiber.Ctx) error {
+	var body struct {
+		AssignmentID  string `json:"assignmentId"`
+		StudentID     string `json:"studentId"`
+		ExtraAttempts int    `json:"extraAttempts"`
+		Reason        string `json:"reason"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	assignmentID, err := uuid.Parse(body.AssignmentID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment ID"})
+	}
+
+	grantor := authorize.CallerFrom(c)
+	if grantor == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Attempts can only be granted on behalf of a user"})
+	}
+	history, err := h.svc.GrantAttempts(c.Context(), &core.AttemptGrant{
+		AssignmentID:  assignmentID,
+		StudentID:     body.StudentID,
+		ExtraAttempts: body.ExtraAttempts,
+		GrantedBy:     grantor.UserID,
+		Reason:        body.Reason,
+	})
+	if err != nil {
+		return attemptError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(history)
+}
+
+func attemptError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidGrant):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, assignment.ErrAssignmentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Assignment not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
 func (h *Handler) UpdateStatus(c *fiber.Ctx) error {
 	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
@@ -132,8 +291,348 @@ func (h *Handler) UpdateStatus(c *fiber.Ctx) error {
 	}
 
 	if err := h.svc.UpdateStatus(id, body.Status, body.Score); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return fileError(c, err, "Submission not found")
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+// DownloadFile redirects to a file of the submission. Files are only
+// available once the virus scan has found them clean.
+func (h *Handler) DownloadFile(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+	fileID, err := uuid.Parse(c.Params("fileId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid file ID format"})
+	}
+
+	url, err := h.svc.FileURL(id, fileID)
+	if err != nil {
+		return fileError(c, err, "File not found")
+	}
+
+	return c.Redirect(url, fiber.StatusFound)
+}
+
+func (h *Handler) Rescan(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	if err := h.svc.Rescan(id); err != nil {
+		return fileError(c, err, "Submission not found")
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+func fileError(c *fiber.Ctx, err error, notFound string) error {
+	switch {
+	case errors.Is(err, service.ErrFilesNotScanned):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrFilesRejected):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": notFound})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+func (h *Handler) GradeSubmission(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		Scores []core.CriterionScore `json:"scores"`
+		Reason string                `json:"reason"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	grader := authorize.CallerFrom(c)
+	if grader == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Grades can only be changed on behalf of a user"})
+	}
+	grade, err := h.svc.GradeSubmission(c.Context(), id, grader.UserID, body.Reason, body.Scores)
+	if err != nil {
+		return gradeError(c, err)
+	}
+
+	return c.JSON(grade)
+}
+
+// OverrideLatePenalty sets the late penalty of a submission by hand, or
+// with a null penalty goes back to the computed one
+func (h *Handler) OverrideLatePenalty(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		Penalty *int   `json:"penalty"`
+		Reason  string `json:"reason"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	grader := authorize.CallerFrom(c)
+	if grader == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Grades can only be changed on behalf of a user"})
+	}
+	grade, err := h.svc.OverrideLatePenalty(c.Context(), id, grader.UserID, body.Penalty, body.Reason)
+	if err != nil {
+		return gradeError(c, err)
+	}
+
+	return c.JSON(grade)
+}
+
+func (h *Handler) GetGrade(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	grade, err := h.svc.GetGrade(c.Context(), id)
+	if err != nil {
+		return gradeError(c, err)
+	}
+
+	return c.JSON(grade)
+}
+
+func (h *Handler) ReleaseGrade(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	grade, err := h.svc.ReleaseGrade(c.Context(), id)
+	if err != nil {
+		return gradeError(c, err)
+	}
+
+	return c.JSON(grade)
+}
+
+func (h *Handler) GetGradeHistory(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	events, err := h.svc.GetGradeHistory(id)
+	if err != nil {
+		return gradeError(c, err)
+	}
+
+	return c.JSON(events)
+}
+
+func gradeError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrReasonRequired):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Submission not found"})
+	case errors.Is(err, assignment.ErrRubricNotFound):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidScore), errors.Is(err, service.ErrInvalidPenalty):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, assignment.ErrAssignmentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+func (h *Handler) AddComment(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	var body struct {
+		Body       string                 `json:"body"`
+		Visibility core.CommentVisibility `json:"visibility"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	author := authorize.CallerFrom(c)
+	if author == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Comments can only be posted on behalf of a user"})
+	}
+	private, err := h.auth.Allows(c, "comment.private")
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+	}
+
+	comment, err := h.svc.AddComment(id, author.UserID, private, body.Body, body.Visibility)
+	if err != nil {
+		return commentError(c, err, "Submission not found")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(comment)
+}
+
+func (h *Handler) ListComments(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	private, err := h.auth.Allows(c, "comment.private")
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+	}
+
+	comments, err := h.svc.ListComments(id, private)
+	if err != nil {
+		return commentError(c, err, "Submission not found")
+	}
+
+	return c.JSON(comments)
+}
+
+func (h *Handler) DeleteComment(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+	commentID, err := uuid.Parse(c.Params("commentId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid comment ID format"})
+	}
+
+	var userID string
+	if caller := authorize.CallerFrom(c); caller != nil {
+		userID = caller.UserID
+	}
+	moderator, err := h.auth.Allows(c, "comment.delete")
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+	}
+
+	if err := h.svc.DeleteComment(id, commentID, userID, moderator); err != nil {
+		return commentError(c, err, "Comment not found")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func commentError(c *fiber.Ctx, err error, notFound string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidComment):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrCommentForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": notFound})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// StartSimilarityJob queues a similarity check of the assignment's latest
+// submissions. The job runs in the background; poll it for its status.
+func (h *Handler) StartSimilarityJob(c *fiber.Ctx) error {
+	assignmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment ID"})
+	}
+
+	params := core.SimilarityParameters{MinScore: service.DefaultSimilarityMinScore}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&params); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+		}
+	}
+
+	var triggeredBy string
+	if caller := authorize.CallerFrom(c); caller != nil {
+		triggeredBy = caller.UserID
+	}
+	job, err := h.svc.StartSimilarityJob(c.Context(), assignmentID, triggeredBy, params)
+	if err != nil {
+		return similarityError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+func (h *Handler) ListSimilarityJobs(c *fiber.Ctx) error {
+	assignmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment ID"})
+	}
+
+	jobs, err := h.svc.ListSimilarityJobs(assignmentID)
+	if err != nil {
+		return similarityError(c, err)
+	}
+
+	return c.JSON(jobs)
+}
+
+func (h *Handler) GetSimilarityJob(c *fiber.Ctx) error {
+	assignmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment ID"})
+	}
+	jobID, err := uuid.Parse(c.Params("jobId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job ID format"})
+	}
+
+	job, err := h.svc.GetSimilarityJob(assignmentID, jobID)
+	if err != nil {
+		return similarityError(c, err)
+	}
+
+	return c.JSON(job)
+}
+
+// SimilarPairs lists the most similar pairs of submissions the assignment's
+// latest completed job found
+func (h *Handler) SimilarPairs(c *fiber.Ctx) error {
+	assignmentID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid assignment ID"})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 500 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+
+	job, pairs, err := h.svc.SimilarPairs(assignmentID, limit)
+	if err != nil {
+		return similarityError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"job": job, "pairs": pairs})
+}
+
+func similarityError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidSimilarityJob):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrSimilarityJobActive):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrNoSimilarityResults):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, assignment.ErrAssignmentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Assignment not found"})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Similarity job not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const testInternalToken = "test-internal-token"
+
+// roleAuthz allows the permissions listed for each role
+type roleAuthz map[string][]string
+
+func (a roleAuthz) Check(_ context.Context, _, role, resource, action string) (bool, error) {
+	for _, permission := range a[role] {
+		if permission == resource+"."+action {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// similarityService answers the similarity calls and nothing else
+type similarityService struct {
+	service.SubmissionService
+	started int
+}
+
+func (s *similarityService) StartSimilarityJob(_ context.Context, assignmentID uuid.UUID, triggeredBy string, params core.SimilarityParameters) (*core.SimilarityJob, error) {
+	s.started++
+	return &core.SimilarityJob{ID: uuid.New(), AssignmentID: assignmentID, TriggeredBy: triggeredBy, Parameters: params, Status: core.SimilarityJobQueued}, nil
+}
+
+func (s *similarityService) SimilarPairs(assignmentID uuid.UUID, _ int) (*core.SimilarityJob, []core.SimilarPair, error) {
+	return &core.SimilarityJob{AssignmentID: assignmentID}, nil, nil
+}
+
+func TestSimilarityRoutesAreForInstructors(t *testing.T) {
+	svc := &similarityService{}
+	authz := roleAuthz{
+		"instructor": {"similarity.run", "similarity.read"},
+		"student":    {"submission.read", "submission.create"},
+	}
+	app := fiber.New()
+	SetupRoutes(app, NewHandler(svc, authorize.NewAuthorizer(nil, authz, testInternalToken)), 1<<20)
+
+	base := "/api/v1/submissions/assignments/" + uuid.NewString()
+	for _, tc := range []struct {
+		role, method, path string
+		want               int
+	}{
+		{"student", fiber.MethodPost, "/similarity-jobs", fiber.StatusForbidden},
+		{"student", fiber.MethodGet, "/similar-pairs", fiber.StatusForbidden},
+		{"student", fiber.MethodGet, "/similarity-jobs/" + uuid.NewString(), fiber.StatusForbidden},
+		{"instructor", fiber.MethodPost, "/similarity-jobs", fiber.StatusAccepted},
+		{"instructor", fiber.MethodGet, "/similar-pairs", fiber.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, base+tc.path, nil)
+		req.Header.Set("X-Internal-Token", testInternalToken)
+		req.Header.Set("X-User-Id", tc.role+"-1")
+		req.Header.Set("X-User-Role", tc.role)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s as %s: status %d, want %d", tc.method, tc.path, tc.role, resp.StatusCode, tc.want)
+		}
+	}
+	if svc.started != 1 {
+		t.Errorf("%d jobs started, want only the instructor's", svc.started)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/assignment"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// AssignmentStats returns how the students did on an assignment. Callers
+// allowed submission.grade, such as instructors, see every grade; anyone
+// else only released ones.
+func (h *Handler) AssignmentStats(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+	full, err := h.auth.Allows(c, "submission.grade")
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+	}
+
+	stats, err := h.svc.AssignmentStats(c.UserContext(), id, full)
+	if err != nil {
+		if errors.Is(err, assignment.ErrAssignmentNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Assignment not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(stats)
+}
+
+// ClassAssignmentStats returns the stats of each of a class's assignments,
+// for the gradebook, with grades seen as by AssignmentStats
+func (h *Handler) ClassAssignmentStats(c *fiber.Ctx) error {
+	full, err := h.auth.Allows(c, "submission.grade")
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+	}
+
+	stats, err := h.svc.ClassAssignmentStats(c.UserContext(), c.Params("id"), full)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(stats)
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Transcript returns a student's grade summary. Students see their own and
+// holders of transcript.read_all, such as admins, anyone's; guardians see
+// those of the students linked to them, and other callers only the classes
+// they are an instructor of.
+func (h *Handler) Transcript(c *fiber.Ctx) error {
+	studentID := c.Params("id")
+	if _, err := uuid.Parse(studentID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID format"})
+	}
+
+	viewer := service.TranscriptViewer{All: true}
+	if caller := authorize.CallerFrom(c); caller != nil && caller.UserID != studentID {
+		all, err := h.auth.Allows(c, "transcript.read_all")
+		if err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Authorization check failed"})
+		}
+		viewer = service.TranscriptViewer{UserID: caller.UserID, All: all, Guardian: caller.Role == "GUARDIAN"}
+	}
+
+	transcript, err := h.svc.Transcript(c.UserContext(), studentID, viewer)
+	if err != nil {
+		if errors.Is(err, service.ErrTranscriptForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(transcript)
+}
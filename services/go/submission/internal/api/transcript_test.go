@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/authorize"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// transcriptService records who each transcript was built for; it forbids
+// instructors other than instructor-1
+type transcriptService struct {
+	service.SubmissionService
+	viewers []service.TranscriptViewer
+}
+
+func (s *transcriptService) Transcript(_ context.Context, studentID string, viewer service.TranscriptViewer) (*core.Transcript, error) {
+	s.viewers = append(s.viewers, viewer)
+	if !viewer.All && viewer.UserID != "instructor-1" {
+		return nil, service.ErrTranscriptForbidden
+	}
+	return &core.Transcript{StudentID: studentID}, nil
+}
+
+func TestTranscriptViewerFollowsTheCaller(t *testing.T) {
+	svc := &transcriptService{}
+	authz := roleAuthz{
+		"admin":      {"transcript.read", "transcript.read_all"},
+		"instructor": {"transcript.read"},
+		"student":    {"transcript.read"},
+	}
+	app := fiber.New()
+	SetupRoutes(app, NewHandler(svc, authorize.NewAuthorizer(nil, authz, testInternalToken)), 1<<20)
+
+	student, classmate := uuid.NewString(), uuid.NewString()
+	for _, tc := range []struct {
+		userID, role string
+		want         int
+		viewer       service.TranscriptViewer
+	}{
+		{student, "student", fiber.StatusOK, service.TranscriptViewer{All: true}},
+		{"admin-1", "admin", fiber.StatusOK, service.TranscriptViewer{UserID: "admin-1", All: true}},
+		{"instructor-1", "instructor", fiber.StatusOK, service.TranscriptViewer{UserID: "instructor-1"}},
+		{"instructor-2", "instructor", fiber.StatusForbidden, service.TranscriptViewer{UserID: "instructor-2"}},
+		{classmate, "student", fiber.StatusForbidden, service.TranscriptViewer{UserID: classmate}},
+	} {
+		svc.viewers = nil
+		req := httptest.NewRequest(fiber.MethodGet, "/api/v1/students/"+student+"/transcript", nil)
+		req.Header.Set("X-Internal-Token", testInternalToken)
+		req.Header.Set("X-User-Id", tc.userID)
+		req.Header.Set("X-User-Role", tc.role)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s as %s: status %d, want %d", tc.userID, tc.role, resp.StatusCode, tc.want)
+		}
+		if len(svc.viewers) != 1 || svc.viewers[0] != tc.viewer {
+			t.Errorf("%s as %s: built for %+v, want %+v", tc.userID, tc.role, svc.viewers, tc.viewer)
+		}
+	}
+}
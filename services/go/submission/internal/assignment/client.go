@@ -0,0 +1,190 @@
+package assignment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrRubricNotFound     = errors.New("assignment has no rubric")
+	ErrAssignmentNotFound = errors.New("assignment not found")
+	ErrAttemptNotFound    = errors.New("assignment attempt not found")
+	ErrGroupNotFound      = errors.New("student is not in a group for this assignment")
+)
+
+// Client defines the calls the submission service makes to the assignment service
+type Client interface {
+	GetRubric(ctx context.Context, assignmentID uuid.UUID) (*core.Rubric, error)
+	GetSettings(ctx context.Context, assignmentID uuid.UUID) (*core.AssignmentSettings, error)
+	GetAttempt(ctx context.Context, assignmentID uuid.UUID, studentID string) (*core.Attempt, error)
+	GetStudentDeadline(ctx context.Context, assignmentID uuid.UUID, studentID string) (*core.StudentDeadline, error)
+	GetGroup(ctx context.Context, assignmentID uuid.UUID, studentID string) (*core.Group, error)
+	LockGroup(ctx context.Context, assignmentID, groupID uuid.UUID) (*core.Group, error)
+	StudentGradeWeights(ctx context.Context, studentID string, classIDs []string, assignmentIDs []uuid.UUID) ([]core.ClassGradeWeights, error)
+	ListClassAssignments(ctx context.Context, classID string) ([]core.ClassAssignment, error)
+}
+
+type httpClient struct {
+	baseURL       string
+	internalToken string
+	httpClient    *http.Client
+}
+
+// NewClient creates an assignment service client from ASSIGNMENT_SERVICE_URL
+// and INTERNAL_SECRET
+func NewClient() Client {
+	baseURL := os.Getenv("ASSIGNMENT_SERVICE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8005"
+	}
+	token := os.Getenv("INTERNAL_SECRET")
+	if token == "" {
+		token = "insecure-secret-for-dev"
+	}
+	return &httpClient{
+		baseURL:       baseURL,
+		internalToken: token,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// GetRubric fetches the rubric of an assignment
+func (c *httpClient) GetRubric(ctx context.Context, assignmentID uuid.UUID) (*core.Rubric, error) {
+	var rubric core.Rubric
+	url := fmt.Sprintf("%s/api/v1/assignments/%s/rubric", c.baseURL, assignmentID)
+	if err := c.get(ctx, url, ErrRubricNotFound, &rubric); err != nil {
+		return nil, err
+	}
+	return &rubric, nil
+}
+
+// GetSettings fetches whether an assignment is timed, how many submissions
+// it takes and whether it takes group submissions
+func (c *httpClient) GetSettings(ctx context.Context, assignmentID uuid.UUID) (*core.AssignmentSettings, error) {
+	var settings core.AssignmentSettings
+	url := fmt.Sprintf("%s/api/v1/assignments/%s", c.baseURL, assignmentID)
+	if err := c.get(ctx, url, ErrAssignmentNotFound, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// GetAttempt fetches the student's active attempt at a timed assignment
+func (c *httpClient) GetAttempt(ctx context.Context, assignmentID uuid.UUID, studentID string) (*core.Attempt, error) {
+	var attempt core.Attempt
+	endpoint := fmt.Sprintf("%s/api/v1/assignments/%s/attempt?studentId=%s", c.baseURL, assignmentID, url.QueryEscape(studentID))
+	if err := c.get(ctx, endpoint, ErrAttemptNotFound, &attempt); err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// GetStudentDeadline fetches when the assignment is due for the student,
+// taking their extension into account, and its late penalty
+func (c *httpClient) GetStudentDeadline(ctx context.Context, assignmentID uuid.UUID, studentID string) (*core.StudentDeadline, error) {
+	var deadline core.StudentDeadline
+	endpoint := fmt.Sprintf("%s/api/v1/assignments/%s/deadline?studentId=%s", c.baseURL, assignmentID, url.QueryEscape(studentID))
+	if err := c.get(ctx, endpoint, ErrAssignmentNotFound, &deadline); err != nil {
+		return nil, err
+	}
+	return &deadline, nil
+}
+
+// GetGroup fetches the group the student belongs to for a group assignment
+func (c *httpClient) GetGroup(ctx context.Context, assignmentID uuid.UUID, studentID string) (*core.Group, error) {
+	var group core.Group
+	endpoint := fmt.Sprintf("%s/api/v1/assignments/%s/group?studentId=%s", c.baseURL, assignmentID, url.QueryEscape(studentID))
+	if err := c.get(ctx, endpoint, ErrGroupNotFound, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// LockGroup marks the group as submitted, which stops members joining or
+// leaving, and returns its final members
+func (c *httpClient) LockGroup(ctx context.Context, assignmentID, groupID uuid.UUID) (*core.Group, error) {
+	var group core.Group
+	url := fmt.Sprintf("%s/api/v1/assignments/%s/groups/%s/lock", c.baseURL, assignmentID, groupID)
+	if err := c.do(ctx, http.MethodPost, url, nil, ErrGroupNotFound, &group); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// StudentGradeWeights fetches the released assignments of the classes, and
+// of the classes the assignments belong to, with their weights and when
+// they close for the student
+func (c *httpClient) StudentGradeWeights(ctx context.Context, studentID string, classIDs []string, assignmentIDs []uuid.UUID) ([]core.ClassGradeWeights, error) {
+	var classes []core.ClassGradeWeights
+	url := c.baseURL + "/api/v1/assignments/classes/grade-weights"
+	body := map[string]interface{}{"studentId": studentID, "courseIds": classIDs, "assignmentIds": assignmentIDs}
+	if err := c.do(ctx, http.MethodPost, url, body, ErrAssignmentNotFound, &classes); err != nil {
+		return nil, err
+	}
+	return classes, nil
+}
+
+// ListClassAssignments fetches every assignment of the class, those of its
+// sections included
+func (c *httpClient) ListClassAssignments(ctx context.Context, classID string) ([]core.ClassAssignment, error) {
+	var assignments []core.ClassAssignment
+	endpoint := fmt.Sprintf("%s/api/v1/assignments?courseId=%s", c.baseURL, url.QueryEscape(classID))
+	if err := c.get(ctx, endpoint, ErrAssignmentNotFound, &assignments); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// get decodes a 200 response into out, returning notFound on a 404
+func (c *httpClient) get(ctx context.Context, url string, notFound error, out interface{}) error {
+	return c.do(ctx, http.MethodGet, url, nil, notFound, out)
+}
+
+// do sends in, if not nil, as the JSON body
+func (c *httpClient) do(ctx context.Context, method, url string, in interface{}, notFound error, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Internal-Token", c.internalToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach assignment service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return notFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("assignment service returned status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode assignment service response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatePenaltyAtBoundaries(t *testing.T) {
+	const day = 24 * 60
+	percent := LatePenaltyPolicy{Type: LatePenaltyPercentPerDay, GraceMinutes: 60, PercentPerDay: 10, MaxPercent: 50}
+	fixed := LatePenaltyPolicy{Type: LatePenaltyFixedPerInterval, GraceMinutes: 15, PointsPerInterval: 5, IntervalMinutes: 60, MaxPoints: 20}
+	cutoff := LatePenaltyPolicy{Type: LatePenaltyCutoff, CutoffMinutes: 3 * day}
+
+	for _, tc := range []struct {
+		name        string
+		policy      LatePenaltyPolicy
+		raw, late   int
+		wantPenalty int
+	}{
+		{"on time", percent, 80, 0, 0},
+		{"percent: at the end of the grace period", percent, 80, 60, 0},
+		{"percent: a minute into the first day", percent, 80, 61, 10},
+		{"percent: at the end of the first day", percent, 80, 60 + day, 10},
+		{"percent: a minute into the second day", percent, 80, 61 + day, 20},
+		{"percent: at the cap", percent, 80, 60 + 5*day, 50},
+		{"percent: past the cap", percent, 80, 60 + 9*day, 50},
+		{"percent: no more than the raw score", percent, 15, 60 + 3*day, 15},
+		{"percent: uncapped", LatePenaltyPolicy{Type: LatePenaltyPercentPerDay, PercentPerDay: 30}, 100, 5 * day, 100},
+		{"fixed: at the end of the grace period", fixed, 80, 15, 0},
+		{"fixed: a minute into the first interval", fixed, 80, 16, 5},
+		{"fixed: at the end of the first interval", fixed, 80, 75, 5},
+		{"fixed: a minute into the second interval", fixed, 80, 76, 10},
+		{"fixed: at the cap", fixed, 80, 15 + 4*60, 20},
+		{"fixed: past the cap", fixed, 80, 15 + 2*day, 20},
+		{"cutoff: at the cutoff", cutoff, 80, 3 * day, 0},
+		{"cutoff: past the cutoff", cutoff, 80, 3*day + 1, 80},
+		{"none", LatePenaltyPolicy{Type: LatePenaltyNone}, 80, 10 * day, 0},
+	} {
+		if got := tc.policy.Penalty(tc.raw, 100, tc.late); got != tc.wantPenalty {
+			t.Errorf("%s: penalty on %d at %d minutes late = %d, want %d", tc.name, tc.raw, tc.late, got, tc.wantPenalty)
+		}
+	}
+}
+
+func TestLateMinutesCountsStartedMinutes(t *testing.T) {
+	due := time.Date(2026, 3, 1, 23, 59, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		after time.Duration
+		want  int
+	}{
+		{-time.Hour, 0},
+		{0, 0},
+		{time.Second, 1},
+		{time.Minute, 1},
+		{time.Minute + time.Second, 2},
+		{25 * time.Hour, 25 * 60},
+	} {
+		if got := LateMinutes(due.Add(tc.after), due); got != tc.want {
+			t.Errorf("submitted %s after the due date: %d minutes late, want %d", tc.after, got, tc.want)
+		}
+	}
+}
@@ -17,6 +17,13 @@ const (
 	SubmissionStatusRuntimeError        SubmissionStatus = "runtime_error"
 	SubmissionStatusCompilationError    SubmissionStatus = "compilation_error"
 	SubmissionStatusPending             SubmissionStatus = "pending"
+
+	// A submission's files are quarantined and scanned for malware before
+	// anyone can download them. It is scanning until then, and rejected if a
+	// file was infected; a clean submission can be judged as usual.
+	SubmissionStatusScanning SubmissionStatus = "scanning"
+	SubmissionStatusClean    SubmissionStatus = "clean"
+	SubmissionStatusRejected SubmissionStatus = "rejected"
 )
 
 type Submission struct {
@@ -40,20 +47,379 @@ type Submission struct {
 	CloneSimilarity    float64          `json:"cloneSimilarity"`
 	AuthFingerprint    string           `json:"authFingerprint"`
 	KeystrokeAnalytics string           `gorm:"type:text" json:"keystrokeAnalytics"` // Store as JSON string for now
+	RubricScore        *int             `json:"rubricScore"`                         // nil until every rubric criterion is graded
+	GradeReleasedAt    *time.Time       `json:"gradeReleasedAt"`                     // changing a released grade needs a reason
 	CreatedAt          time.Time        `json:"createdAt"`
 	UpdatedAt          time.Time        `json:"updatedAt"`
 	DeletedAt          gorm.DeletedAt   `gorm:"index" json:"-"`
 
+	// RubricScore is the raw score. Once it is set, LateMinutes is how late
+	// the submission was for the student's due date when it was graded,
+	// PenaltyApplied the points the late penalty took off and FinalScore
+	// what is left. An instructor's PenaltyOverride, with a reason, replaces
+	// the computed penalty.
+	LateMinutes           int    `gorm:"not null;default:0" json:"lateMinutes"`
+	PenaltyApplied        *int   `json:"penaltyApplied"`
+	FinalScore            *int   `json:"finalScore"`
+	PenaltyOverride       *int   `json:"penaltyOverride,omitempty"`
+	PenaltyOverrideReason string `gorm:"type:text" json:"penaltyOverrideReason,omitempty"`
+	PenaltyOverriddenBy   string `json:"penaltyOverriddenBy,omitempty"`
+
+	// GroupID is set for submissions to group assignments. Members are the
+	// group's students when it submitted; the grade applies to each of them.
+	GroupID *uuid.UUID         `gorm:"type:uuid;index" json:"groupId,omitempty"`
+	Members []SubmissionMember `gorm:"foreignKey:SubmissionID" json:"members,omitempty"`
+
+	// AttemptNumber counts the submissions of the student, or of the group,
+	// to the assignment, starting at 1. Submissions made before attempts were
+	// counted have 0.
+	AttemptNumber int `gorm:"not null;default:0" json:"attemptNumber"`
+
+	// ScanSignature names the malware found in a rejected submission, e.g.
+	// "main.py: Eicar-Test-Signature". RescanFrom is the status to go back
+	// to when a re-scan of a judged submission finds it clean.
+	ScanSignature    string           `json:"scanSignature,omitempty"`
+	ScannedAt        *time.Time       `json:"scannedAt,omitempty"`
+	ScanClaimedUntil *time.Time       `json:"-"`
+	RescanFrom       SubmissionStatus `json:"-"`
+
 	Files     []SubmissionFile     `gorm:"foreignKey:SubmissionID" json:"files"`
 	VivaTurns []VivaTranscriptTurn `gorm:"foreignKey:SubmissionID" json:"vivaTranscript"`
 	Integrity []IntegritySignal    `gorm:"foreignKey:SubmissionID" json:"integritySignals"`
 }
 
+// StudentIDs are the students the submission belongs to: every member of
+// the group that made it, or the student who made it
+func (s *Submission) StudentIDs() []string {
+	if len(s.Members) == 0 {
+		return []string{s.StudentID}
+	}
+	ids := make([]string, 0, len(s.Members))
+	for _, m := range s.Members {
+		ids = append(ids, m.StudentID)
+	}
+	return ids
+}
+
+// GradingRow is one line of an assignment's grading list: a student who
+// submitted alone, or a group, with their latest submission or the attempt
+// asked for
+type GradingRow struct {
+	GroupID         *uuid.UUID       `json:"groupId,omitempty"`
+	Members         []GradingMember  `json:"members"`
+	SubmissionID    uuid.UUID        `json:"submissionId"`
+	AttemptNumber   int              `json:"attemptNumber"`
+	SubmittedBy     string           `json:"submittedBy"`
+	SubmittedAt     time.Time        `json:"submittedAt"`
+	SubmissionCount int              `json:"submissionCount"`
+	Status          SubmissionStatus `json:"status"`
+	Score           int              `json:"score"`
+	RubricScore     *int             `json:"rubricScore"`
+	FinalScore      *int             `json:"finalScore"`
+	GradeReleasedAt *time.Time       `json:"gradeReleasedAt"`
+}
+
+// GradingMember is a student on a grading row. The name and email come from
+// the identity service and are empty if it could not be reached.
+type GradingMember struct {
+	StudentID string `json:"studentId"`
+	FullName  string `json:"fullName"`
+	Email     string `json:"email"`
+}
+
+// SubmissionMember is a student a group submission belongs to. Group
+// membership is locked once a group submits, so the members of every
+// submission of a group are the same.
+type SubmissionMember struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"-"`
+	SubmissionID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_submission_member" json:"-"`
+	StudentID    string    `gorm:"not null;uniqueIndex:idx_submission_member;index" json:"studentId"`
+}
+
+// CriterionScore is the points awarded to a submission for one rubric criterion
+type CriterionScore struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	SubmissionID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_submission_criterion" json:"submissionId"`
+	CriterionID  uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_submission_criterion" json:"criterionId"`
+	Points       int       `json:"points"`
+	Comment      string    `gorm:"type:text" json:"comment"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Rubric mirrors the assignment service's rubric for grading
+type Rubric struct {
+	ID           uuid.UUID         `json:"id"`
+	AssignmentID uuid.UUID         `json:"assignmentId"`
+	Criteria     []RubricCriterion `json:"criteria"`
+}
+
+// AssignmentSettings is the part of an assignment needed to accept
+// submissions: its time limits, how many submissions it takes and whether
+// students submit as groups
+type AssignmentSettings struct {
+	ID                     uuid.UUID `json:"id"`
+	Timed                  bool      `json:"timed"`
+	DurationMinutes        int       `json:"durationMinutes"`
+	TotalAttempts          int       `json:"totalAttempts"` // 0 means unlimited
+	EnableGroupSubmissions bool      `json:"enableGroupSubmissions"`
+	TotalScore             int       `json:"totalScore"`
+	// CourseID is the class the assignment belongs to
+	CourseID string `json:"courseId"`
+}
+
+type LatePenaltyType string
+
+const (
+	LatePenaltyNone             LatePenaltyType = "none"
+	LatePenaltyPercentPerDay    LatePenaltyType = "percent_per_day"
+	LatePenaltyFixedPerInterval LatePenaltyType = "fixed_per_interval"
+	LatePenaltyCutoff           LatePenaltyType = "cutoff"
+)
+
+// LatePenaltyPolicy mirrors the assignment service's late penalty of an
+// assignment
+type LatePenaltyPolicy struct {
+	Type              LatePenaltyType `json:"type"`
+	GraceMinutes      int             `json:"graceMinutes"`
+	PercentPerDay     int             `json:"percentPerDay,omitempty"`
+	MaxPercent        int             `json:"maxPercent,omitempty"`
+	PointsPerInterval int             `json:"pointsPerInterval,omitempty"`
+	IntervalMinutes   int             `json:"intervalMinutes,omitempty"`
+	MaxPoints         int             `json:"maxPoints,omitempty"`
+	CutoffMinutes     int             `json:"cutoffMinutes,omitempty"`
+}
+
+// Penalty is the points taken off raw, out of maxScore, for a submission
+// lateMinutes late. Lateness only counts past the grace period, and a
+// penalty never takes more than raw.
+func (p LatePenaltyPolicy) Penalty(raw, maxScore, lateMinutes int) int {
+	late := lateMinutes - p.GraceMinutes
+	if lateMinutes <= 0 || late <= 0 {
+		return 0
+	}
+
+	var points int
+	switch p.Type {
+	case LatePenaltyPercentPerDay:
+		days := (late + minutesPerDay - 1) / minutesPerDay
+		percent := days * p.PercentPerDay
+		if p.MaxPercent > 0 {
+			percent = min(percent, p.MaxPercent)
+		}
+		percent = min(percent, 100)
+		points = (maxScore*percent + 50) / 100
+	case LatePenaltyFixedPerInterval:
+		if p.IntervalMinutes <= 0 {
+			return 0
+		}
+		intervals := (late + p.IntervalMinutes - 1) / p.IntervalMinutes
+		points = intervals * p.PointsPerInterval
+		if p.MaxPoints > 0 {
+			points = min(points, p.MaxPoints)
+		}
+	case LatePenaltyCutoff:
+		if late > p.CutoffMinutes {
+			points = raw
+		}
+	}
+	return max(min(points, raw), 0)
+}
+
+const minutesPerDay = 24 * 60
+
+// LateMinutes is how many minutes after dueDate a submission made at
+// submittedAt was, counting a started minute as a whole one
+func LateMinutes(submittedAt, dueDate time.Time) int {
+	late := submittedAt.Sub(dueDate)
+	if late <= 0 {
+		return 0
+	}
+	return int((late + time.Minute - 1) / time.Minute)
+}
+
+// StudentDeadline mirrors the assignment service's due date of an
+// assignment for one student, moved by their extension if they have one
+type StudentDeadline struct {
+	AssignmentID uuid.UUID         `json:"assignmentId"`
+	StudentID    string            `json:"studentId"`
+	DueDate      time.Time         `json:"dueDate"`
+	Extended     bool              `json:"extended"`
+	LatePenalty  LatePenaltyPolicy `json:"latePenalty"`
+}
+
+// Lateness is what the late penalty of a grade is worked out from
+type Lateness struct {
+	Minutes int
+	Policy  LatePenaltyPolicy
+}
+
+// AttemptGrant gives a student submission attempts on top of the
+// assignment's limit. Grants add up; for a group assignment the grants of
+// every member count towards the group.
+type AttemptGrant struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssignmentID  uuid.UUID `gorm:"type:uuid;index:idx_attempt_grants_student,priority:1;not null" json:"assignmentId"`
+	StudentID     string    `gorm:"index:idx_attempt_grants_student,priority:2;not null" json:"studentId"`
+	ExtraAttempts int       `gorm:"not null" json:"extraAttempts"`
+	GrantedBy     string    `gorm:"not null" json:"grantedBy"`
+	Reason        string    `gorm:"type:text" json:"reason,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// AttemptHistory is every submission of a student, or of their group, to an
+// assignment, newest first, with how many they may make. AttemptsAllowed is
+// nil when the assignment has no limit.
+type AttemptHistory struct {
+	AttemptsUsed    int          `json:"attemptsUsed"`
+	AttemptsAllowed *int         `json:"attemptsAllowed"`
+	ExtraAttempts   int          `json:"extraAttempts"`
+	Attempts        []Submission `json:"attempts"`
+}
+
+// Group mirrors the assignment service's submission group
+type Group struct {
+	ID           uuid.UUID     `json:"id"`
+	AssignmentID uuid.UUID     `json:"assignmentId"`
+	Name         string        `json:"name"`
+	Members      []GroupMember `json:"members"`
+}
+
+type GroupMember struct {
+	StudentID string `json:"studentId"`
+}
+
+// Attempt mirrors the assignment service's record of a student starting a
+// timed assignment
+type Attempt struct {
+	ID           uuid.UUID `json:"id"`
+	AssignmentID uuid.UUID `json:"assignmentId"`
+	StudentID    string    `json:"studentId"`
+	StartedAt    time.Time `json:"startedAt"`
+	EndsAt       time.Time `json:"endsAt"`
+}
+
+type RubricCriterion struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	MaxPoints   int       `json:"maxPoints"`
+	Order       int       `json:"order"`
+}
+
+// Grade is the rubric breakdown of a submission. ChangedBy and ChangedAt
+// describe the latest grade write; the full history is only available to
+// staff.
+type Grade struct {
+	SubmissionID uuid.UUID        `json:"submissionId"`
+	Total        *int             `json:"total"`
+	MaxTotal     int              `json:"maxTotal"`
+	Complete     bool             `json:"complete"`
+	Criteria     []CriterionGrade `json:"criteria"`
+	ReleasedAt   *time.Time       `json:"releasedAt"`
+	ChangedBy    string           `json:"changedBy,omitempty"`
+	ChangedAt    *time.Time       `json:"changedAt,omitempty"`
+	// LateMinutes, Penalty and FinalTotal break down the late penalty once
+	// Total is set: the final total is Total less Penalty. PenaltyReason
+	// says why an instructor overrode the computed penalty.
+	LateMinutes       int    `json:"lateMinutes"`
+	Penalty           *int   `json:"penalty"`
+	PenaltyOverridden bool   `json:"penaltyOverridden"`
+	PenaltyReason     string `json:"penaltyReason,omitempty"`
+	FinalTotal        *int   `json:"finalTotal"`
+	// StudentIDs are the students the grade counts for: the submitter, or
+	// every member of the group that submitted
+	StudentIDs []string `json:"studentIds"`
+}
+
+// BuildGrade lays the scores of a submission out against its rubric. The
+// total is only set once every criterion has a score.
+func BuildGrade(submissionID uuid.UUID, rubric *Rubric, scores []CriterionScore) *Grade {
+	byCriterion := make(map[uuid.UUID]CriterionScore, len(scores))
+	for _, score := range scores {
+		byCriterion[score.CriterionID] = score
+	}
+
+	grade := &Grade{
+		SubmissionID: submissionID,
+		Criteria:     make([]CriterionGrade, 0, len(rubric.Criteria)),
+	}
+	sum, graded := 0, 0
+	for _, c := range rubric.Criteria {
+		entry := CriterionGrade{
+			CriterionID: c.ID,
+			Name:        c.Name,
+			Description: c.Description,
+			MaxPoints:   c.MaxPoints,
+		}
+		if score, ok := byCriterion[c.ID]; ok {
+			points := score.Points
+			entry.Points = &points
+			entry.Comment = score.Comment
+			sum += points
+			graded++
+		}
+		grade.MaxTotal += c.MaxPoints
+		grade.Criteria = append(grade.Criteria, entry)
+	}
+
+	grade.Complete = graded == len(rubric.Criteria)
+	if grade.Complete {
+		grade.Total = &sum
+	}
+	return grade
+}
+
+// GradeEvent records one write of a submission's grade. RubricSnapshot is the
+// JSON breakdown of the grade right after the write.
+type GradeEvent struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	SubmissionID   uuid.UUID `gorm:"type:uuid;index:idx_grade_events_submission,priority:1;not null" json:"submissionId"`
+	GraderUserID   string    `gorm:"not null" json:"graderUserId"`
+	OldScore       *int      `json:"oldScore"`
+	NewScore       *int      `json:"newScore"`
+	Penalty        *int      `json:"penalty,omitempty"` // late penalty on NewScore after the write
+	RubricSnapshot string    `gorm:"type:text" json:"rubricSnapshot,omitempty"`
+	Reason         string    `gorm:"type:text" json:"reason,omitempty"`
+	CreatedAt      time.Time `gorm:"index:idx_grade_events_submission,priority:2" json:"createdAt"`
+}
+
+// CommentVisibility is who can see a submission comment
+type CommentVisibility string
+
+const (
+	CommentVisibilityEveryone        CommentVisibility = "everyone"
+	CommentVisibilityInstructorsOnly CommentVisibility = "instructors_only"
+)
+
+// SubmissionComment is a message in the thread between a student and the
+// staff grading their submission. Body is raw Markdown; the frontend
+// sanitizes it when rendering.
+type SubmissionComment struct {
+	ID           uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	SubmissionID uuid.UUID         `gorm:"type:uuid;index:idx_submission_comments_submission,priority:1;not null" json:"submissionId"`
+	AuthorUserID string            `gorm:"not null" json:"authorUserId"`
+	Body         string            `gorm:"type:text;not null" json:"body"`
+	Visibility   CommentVisibility `gorm:"not null;default:everyone" json:"visibility"`
+	CreatedAt    time.Time         `gorm:"index:idx_submission_comments_submission,priority:2" json:"createdAt"`
+	DeletedAt    gorm.DeletedAt    `gorm:"index" json:"-"`
+}
+
+type CriterionGrade struct {
+	CriterionID uuid.UUID `json:"criterionId"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	MaxPoints   int       `json:"maxPoints"`
+	Points      *int      `json:"points"`
+	Comment     string    `json:"comment,omitempty"`
+}
+
 type SubmissionFile struct {
 	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	SubmissionID uuid.UUID `gorm:"index" json:"submissionId"`
 	Filename     string    `json:"filename"`
-	StorageURL   string    `json:"storageUrl"` // S3/Supabase storage URL
+	StorageURL   string    `json:"storageUrl"` // S3/Supabase storage URL; empty until the file is found clean
+	StoragePath  string    `json:"-"`          // Where the file is in the bucket, under the quarantine prefix until found clean
 	Size         int64     `json:"size"`       // File size in bytes
 }
 
@@ -73,3 +439,214 @@ type IntegritySignal struct {
 	Status       string    `json:"status"` // Clean, Flagged
 	Detail       string    `json:"detail"`
 }
+
+// SimilarityJobStatus is where a similarity job is in its run
+type SimilarityJobStatus string
+
+const (
+	SimilarityJobQueued    SimilarityJobStatus = "queued"
+	SimilarityJobRunning   SimilarityJobStatus = "running"
+	SimilarityJobCompleted SimilarityJobStatus = "completed"
+	SimilarityJobFailed    SimilarityJobStatus = "failed"
+)
+
+// SimilarityParameters tune a similarity check. Pairs scoring below
+// MinScore, between 0 and 1, are not reported.
+type SimilarityParameters struct {
+	Language string  `json:"language,omitempty"`
+	MinScore float64 `json:"minScore"`
+}
+
+// SimilarityJob is a run of the external similarity checker over the latest
+// submission of every student and group of an assignment. The results of
+// its latest completed job are the assignment's results.
+type SimilarityJob struct {
+	ID           uuid.UUID            `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssignmentID uuid.UUID            `gorm:"type:uuid;index:idx_similarity_jobs_assignment,priority:1;not null" json:"assignmentId"`
+	Status       SimilarityJobStatus  `gorm:"not null;index" json:"status"`
+	TriggeredBy  string               `gorm:"not null" json:"triggeredBy"`
+	Parameters   SimilarityParameters `gorm:"type:text;serializer:json" json:"parameters"`
+	// SubmissionCount and PairCount are how many submissions were sent to
+	// the checker and how many pairs it reported, once the job has run
+	SubmissionCount int        `json:"submissionCount"`
+	PairCount       int        `json:"pairCount"`
+	Error           string     `gorm:"type:text" json:"error,omitempty"`
+	ClaimedUntil    *time.Time `json:"-"`
+	StartedAt       *time.Time `json:"startedAt"`
+	FinishedAt      *time.Time `json:"finishedAt"`
+	CreatedAt       time.Time  `gorm:"index:idx_similarity_jobs_assignment,priority:2" json:"createdAt"`
+}
+
+// SimilarityResult is how alike two submissions to an assignment were found
+// by a job, from 0 to 1. SubmissionA sorts before SubmissionB.
+type SimilarityResult struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"-"`
+	JobID        uuid.UUID `gorm:"type:uuid;index:idx_similarity_results_job,priority:1;uniqueIndex:idx_similarity_results_pair,priority:1;not null" json:"-"`
+	AssignmentID uuid.UUID `gorm:"type:uuid;index;not null" json:"-"`
+	SubmissionA  uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_similarity_results_pair,priority:2;not null" json:"submissionA"`
+	SubmissionB  uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_similarity_results_pair,priority:3;not null" json:"submissionB"`
+	Score        float64   `gorm:"index:idx_similarity_results_job,priority:2,sort:desc" json:"score"`
+}
+
+// SimilarPair is a result as returned by the API, with links to both
+// submissions
+type SimilarPair struct {
+	SimilarityResult
+	SubmissionAURL string `json:"submissionAUrl"`
+	SubmissionBURL string `json:"submissionBUrl"`
+}
+
+// ArchiveJobStatus is where an archive job is in its run
+type ArchiveJobStatus string
+
+const (
+	ArchiveJobQueued    ArchiveJobStatus = "queued"
+	ArchiveJobRunning   ArchiveJobStatus = "running"
+	ArchiveJobCompleted ArchiveJobStatus = "completed"
+	ArchiveJobFailed    ArchiveJobStatus = "failed"
+)
+
+// ArchiveJob builds a zip of an assignment's submissions for an instructor
+// to grade offline: the latest submission of every student and group, or
+// their attempt numbered Attempt when that is not 0. FilesDone of
+// FileCount files have been written so far.
+type ArchiveJob struct {
+	ID           uuid.UUID        `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssignmentID uuid.UUID        `gorm:"type:uuid;index:idx_archive_jobs_assignment,priority:1;not null" json:"assignmentId"`
+	Attempt      int              `gorm:"not null;default:0" json:"attempt"`
+	Status       ArchiveJobStatus `gorm:"not null;index" json:"status"`
+	RequestedBy  string           `gorm:"not null" json:"requestedBy"`
+	// SubmissionCount is how many submissions went in and SkippedCount how
+	// many were left out as still being scanned or rejected
+	SubmissionCount int    `json:"submissionCount"`
+	SkippedCount    int    `json:"skippedCount"`
+	FileCount       int    `json:"fileCount"`
+	FilesDone       int    `json:"filesDone"`
+	StoragePath     string `json:"-"`
+	Error           string `gorm:"type:text" json:"error,omitempty"`
+	// DownloadURL is a signed link to the archive, set on completed jobs
+	// when they are fetched
+	DownloadURL          string     `gorm:"-" json:"downloadUrl,omitempty"`
+	DownloadURLExpiresAt *time.Time `gorm:"-" json:"downloadUrlExpiresAt,omitempty"`
+	ClaimedUntil         *time.Time `json:"-"`
+	StartedAt            *time.Time `json:"startedAt"`
+	FinishedAt           *time.Time `json:"finishedAt"`
+	CreatedAt            time.Time  `gorm:"index:idx_archive_jobs_assignment,priority:2" json:"createdAt"`
+}
+
+// ClassGradeWeights mirrors the assignment service's weighted assignments of
+// a class as they count towards one student's grade
+type ClassGradeWeights struct {
+	CourseID      string             `json:"courseId"`
+	MissingAsZero bool               `json:"missingAsZero"`
+	Assignments   []GradedAssignment `json:"assignments"`
+}
+
+type GradedAssignment struct {
+	ID         uuid.UUID  `json:"id"`
+	SectionID  *uuid.UUID `json:"sectionId,omitempty"`
+	Title      string     `json:"title"`
+	Weight     int        `json:"weight"`
+	TotalScore int        `json:"totalScore"`
+	DueDate    time.Time  `json:"dueDate"`
+	ClosesAt   time.Time  `json:"closesAt"`
+}
+
+// StudentGrade is the grade that counts for a student on an assignment: the
+// one of their latest submission whose grade was released, or of their
+// latest submission if none was
+type StudentGrade struct {
+	AssignmentID uuid.UUID
+	Score        int
+	Released     bool
+}
+
+// TranscriptStatus is where an assignment stands on a transcript
+type TranscriptStatus string
+
+const (
+	TranscriptGraded  TranscriptStatus = "graded"  // the grade is released
+	TranscriptPending TranscriptStatus = "pending" // submitted, grade not released yet
+	TranscriptMissing TranscriptStatus = "missing" // closed without a submission
+	TranscriptOpen    TranscriptStatus = "open"    // not submitted, still open
+)
+
+// Transcript is a student's weighted grades in every class they are or
+// were in, grouped by term
+type Transcript struct {
+	StudentID string           `json:"studentId"`
+	Terms     []TranscriptTerm `json:"terms"`
+}
+
+// TranscriptTerm is the classes of one term, earliest term first. Classes
+// without a term come last, in a group with no termId.
+type TranscriptTerm struct {
+	TermID   string            `json:"termId,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	StartsOn *time.Time        `json:"startsOn,omitempty"`
+	EndsOn   *time.Time        `json:"endsOn,omitempty"`
+	Classes  []TranscriptClass `json:"classes"`
+}
+
+// TranscriptClass is the student's grade in a class: the weighted average
+// of the percentages of the assignments that count. Percentage is nil
+// until one does, and CountedWeight is the weight it is taken over.
+type TranscriptClass struct {
+	ClassID       string                 `json:"classId"`
+	Name          string                 `json:"name"`
+	Enrolled      bool                   `json:"enrolled"` // false for a class the student has left
+	MissingAsZero bool                   `json:"missingAsZero"`
+	Percentage    *float64               `json:"percentage"`
+	CountedWeight int                    `json:"countedWeight"`
+	TotalWeight   int                    `json:"totalWeight"`
+	Pending       int                    `json:"pending"`
+	Assignments   []TranscriptAssignment `json:"assignments"`
+}
+
+// TranscriptAssignment is one assignment of a class on a transcript. Score
+// is only shown once the grade is released.
+type TranscriptAssignment struct {
+	AssignmentID uuid.UUID        `json:"assignmentId"`
+	Title        string           `json:"title"`
+	Weight       int              `json:"weight"`
+	TotalScore   int              `json:"totalScore"`
+	DueDate      time.Time        `json:"dueDate"`
+	Status       TranscriptStatus `json:"status"`
+	Score        *int             `json:"score"`
+	Percentage   *float64         `json:"percentage"`
+	Counted      bool             `json:"counted"`
+}
+
+// AssignmentStats is how a class is doing on an assignment. Each student
+// who submitted, alone or in a group, counts once with the grade that
+// counts for them: that of their latest submission with a released grade,
+// or of their latest submission if none was released. Submitted is how
+// many students that is and Graded how many of those grades are in, with
+// the mean, median and standard deviation of the scores, after late
+// penalties. They are nil until a grade is in.
+type AssignmentStats struct {
+	AssignmentID uuid.UUID         `json:"assignmentId"`
+	Title        string            `json:"title,omitempty"`
+	TotalScore   int               `json:"totalScore"`
+	Submitted    int               `json:"submitted"`
+	Graded       int               `json:"graded"`
+	Mean         *float64          `json:"mean"`
+	Median       *float64          `json:"median"`
+	StdDev       *float64          `json:"stdDev"`
+	Histogram    []HistogramBucket `json:"histogram,omitempty"`
+}
+
+// HistogramBucket counts the scores from From up to To percent of the
+// assignment's total. The last bucket includes 100% and anything above.
+type HistogramBucket struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Count int `json:"count"`
+}
+
+// ClassAssignment mirrors an assignment of a class in the assignment service
+type ClassAssignment struct {
+	ID         uuid.UUID `json:"id"`
+	Title      string    `json:"title"`
+	TotalScore int       `json:"totalScore"`
+}
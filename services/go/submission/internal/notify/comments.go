@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sender emails users about their submissions: SendCommentDigest tells a
+// user about count new comments on a submission, and SendSubmissionRejected
+// tells a student the virus scan rejected their submission
+type Sender interface {
+	SendCommentDigest(ctx context.Context, recipientID string, submissionID uuid.UUID, count int) error
+	SendSubmissionRejected(ctx context.Context, recipientID string, submissionID uuid.UUID, signature string) error
+}
+
+type batchKey struct {
+	submissionID uuid.UUID
+	recipientID  string
+}
+
+// CommentNotifier batches comment notifications per submission and
+// recipient. The first comment starts a batch that is sent once delay has
+// passed, covering every comment added to the thread in the meantime, so a
+// quick back-and-forth results in a single email. Batches are kept in
+// memory and lost when the service stops.
+type CommentNotifier struct {
+	sender  Sender
+	delay   time.Duration
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[batchKey]int
+}
+
+func NewCommentNotifier(sender Sender, delay time.Duration) *CommentNotifier {
+	return &CommentNotifier{
+		sender:  sender,
+		delay:   delay,
+		timeout: 30 * time.Second,
+		pending: make(map[batchKey]int),
+	}
+}
+
+// CommentAdded queues a notification of a new comment for recipientID
+func (n *CommentNotifier) CommentAdded(submissionID uuid.UUID, recipientID string) {
+	key := batchKey{submissionID: submissionID, recipientID: recipientID}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pending[key]++
+	if n.pending[key] == 1 {
+		time.AfterFunc(n.delay, func() { n.flush(key) })
+	}
+}
+
+func (n *CommentNotifier) flush(key batchKey) {
+	n.mu.Lock()
+	count := n.pending[key]
+	delete(n.pending, key)
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+	if err := n.sender.SendCommentDigest(ctx, key.recipientID, key.submissionID, count); err != nil {
+		log.Printf("Failed to notify %s of %d new comments on submission %s: %v", key.recipientID, count, key.submissionID, err)
+	}
+}
@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// emailSender looks up the recipient's address in the identity service and
+// sends the email through the email service
+type emailSender struct {
+	identityURL   string
+	emailURL      string
+	internalToken string
+	httpClient    *http.Client
+}
+
+// NewEmailSender creates a Sender from IDENTITY_SERVICE_URL,
+// EMAIL_SERVICE_URL and INTERNAL_SECRET
+func NewEmailSender() Sender {
+	return &emailSender{
+		identityURL:   getenv("IDENTITY_SERVICE_URL", "http://localhost:8001"),
+		emailURL:      getenv("EMAIL_SERVICE_URL", "http://localhost:5005"),
+		internalToken: getenv("INTERNAL_SECRET", "insecure-secret-for-dev"),
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *emailSender) SendCommentDigest(ctx context.Context, recipientID string, submissionID uuid.UUID, count int) error {
+	user, err := s.lookup(ctx, recipientID)
+	if err != nil {
+		return err
+	}
+
+	subject := "New comment on a submission"
+	intro := "There is a new comment"
+	if count > 1 {
+		subject = "New comments on a submission"
+		intro = fmt.Sprintf("There are %d new comments", count)
+	}
+	body := fmt.Sprintf("Hi %s,\n\n%s on submission %s. Sign in to GradeLoop to read and reply.",
+		user.FullName, intro, submissionID)
+
+	return s.send(ctx, user.Email, subject, body)
+}
+
+func (s *emailSender) SendSubmissionRejected(ctx context.Context, recipientID string, submissionID uuid.UUID, signature string) error {
+	user, err := s.lookup(ctx, recipientID)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nThe virus scan found malware in submission %s (%s), so it was rejected and will not be graded. "+
+		"Check your files and submit again, or contact your instructor if you think this is a mistake.",
+		user.FullName, submissionID, signature)
+	return s.send(ctx, user.Email, "Your submission was rejected", body)
+}
+
+type recipient struct {
+	Email    string `json:"email"`
+	FullName string `json:"name"`
+}
+
+// lookup fetches the user's address and name from the identity service
+func (s *emailSender) lookup(ctx context.Context, userID string) (*recipient, error) {
+	var user recipient
+	if err := s.do(ctx, http.MethodGet, s.identityURL+"/internal/identity/users/"+userID, nil, &user); err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	return &user, nil
+}
+
+func (s *emailSender) send(ctx context.Context, to, subject, body string) error {
+	payload := map[string]string{"to": to, "subject": subject, "body": body}
+	if err := s.do(ctx, http.MethodPost, s.emailURL+"/internal/email/send", payload, nil); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// do sends body as JSON and decodes a 200 response into out when it is set
+func (s *emailSender) do(ctx context.Context, method, url string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", s.internalToken)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned status %d", method, url, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrArchiveJobActive = errors.New("an archive of this attempt of the assignment is already queued or being built")
+
+// CreateArchiveJob queues the job unless one for the same assignment and
+// attempt is already queued or running, under an advisory lock as for
+// similarity jobs
+func (r *repository) CreateArchiveJob(job *core.ArchiveJob) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "archive_jobs:"+job.AssignmentID.String()).Error; err != nil {
+			return err
+		}
+		var active int64
+		err := tx.Model(&core.ArchiveJob{}).
+			Where("assignment_id = ? AND attempt = ? AND status IN ?", job.AssignmentID, job.Attempt,
+				[]core.ArchiveJobStatus{core.ArchiveJobQueued, core.ArchiveJobRunning}).
+			Count(&active).Error
+		if err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrArchiveJobActive
+		}
+		job.Status = core.ArchiveJobQueued
+		return tx.Create(job).Error
+	})
+}
+
+func (r *repository) GetArchiveJob(assignmentID, id uuid.UUID) (*core.ArchiveJob, error) {
+	var job core.ArchiveJob
+	if err := r.db.First(&job, "id = ? AND assignment_id = ?", id, assignmentID).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimArchiveJob takes the oldest queued job, or a running one whose claim
+// has run out, for lease and returns it, or nil if there is none. The job
+// starts over from no files done.
+func (r *repository) ClaimArchiveJob(now time.Time, lease time.Duration) (*core.ArchiveJob, error) {
+	var claimed *core.ArchiveJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var job core.ArchiveJob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND claimed_until < ?)", core.ArchiveJobQueued, core.ArchiveJobRunning, now).
+			Order("created_at ASC").
+			First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		until := now.Add(lease)
+		job.Status = core.ArchiveJobRunning
+		job.ClaimedUntil = &until
+		job.StartedAt = &now
+		job.FilesDone = 0
+		err = tx.Model(&job).Updates(map[string]interface{}{
+			"status":        job.Status,
+			"claimed_until": until,
+			"started_at":    now,
+			"files_done":    0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		claimed = &job
+		return nil
+	})
+	return claimed, err
+}
+
+// ListArchiveSubmissions returns every submission to the assignment with
+// its files and members, newest first. Only IDs, names and paths are
+// loaded, never file contents.
+func (r *repository) ListArchiveSubmissions(assignmentID uuid.UUID) ([]core.Submission, error) {
+	var submissions []core.Submission
+	err := r.db.Preload("Files").Preload("Members").
+		Where("assignment_id = ?", assignmentID).
+		Order("timestamp DESC").
+		Find(&submissions).Error
+	return submissions, err
+}
+
+// UpdateArchiveProgress saves how far a running job has got and extends
+// its claim to claimedUntil, so a job keeps its worker while it progresses
+func (r *repository) UpdateArchiveProgress(job *core.ArchiveJob, claimedUntil time.Time) error {
+	job.ClaimedUntil = &claimedUntil
+	return r.db.Model(job).Updates(map[string]interface{}{
+		"submission_count": job.SubmissionCount,
+		"skipped_count":    job.SkippedCount,
+		"file_count":       job.FileCount,
+		"files_done":       job.FilesDone,
+		"claimed_until":    claimedUntil,
+	}).Error
+}
+
+// CompleteArchiveJob marks the job completed with its archive at
+// job.StoragePath
+func (r *repository) CompleteArchiveJob(job *core.ArchiveJob, now time.Time) error {
+	job.Status = core.ArchiveJobCompleted
+	job.FinishedAt = &now
+	job.ClaimedUntil = nil
+	return r.db.Model(job).Updates(map[string]interface{}{
+		"status":           job.Status,
+		"submission_count": job.SubmissionCount,
+		"skipped_count":    job.SkippedCount,
+		"file_count":       job.FileCount,
+		"files_done":       job.FilesDone,
+		"storage_path":     job.StoragePath,
+		"finished_at":      now,
+		"claimed_until":    nil,
+	}).Error
+}
+
+// FailArchiveJob marks the job failed
+func (r *repository) FailArchiveJob(job *core.ArchiveJob, reason string, now time.Time) error {
+	job.Status = core.ArchiveJobFailed
+	job.Error = reason
+	job.FinishedAt = &now
+	job.ClaimedUntil = nil
+	return r.db.Model(job).Updates(map[string]interface{}{
+		"status":        job.Status,
+		"error":         reason,
+		"finished_at":   now,
+		"claimed_until": nil,
+	}).Error
+}
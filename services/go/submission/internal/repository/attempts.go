@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AttemptLimitError means the student, or their group, has used every
+// submission attempt they are allowed
+type AttemptLimitError struct {
+	Used    int
+	Allowed int
+}
+
+func (e *AttemptLimitError) Error() string {
+	return fmt.Sprintf("all %d submission attempts for this assignment have been used", e.Allowed)
+}
+
+// CreateSubmissionAttempt stores the submission as the next attempt of its
+// group, or of its student when it has none, unless allowed attempts have
+// been used already; allowed 0 means no limit. Attempts of the same student
+// or group are counted under an advisory lock, so concurrent submissions at
+// the limit cannot both get in and no two get the same number.
+func (r *repository) CreateSubmissionAttempt(submission *core.Submission, allowed int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		key := "submission_attempts:" + submission.AssignmentID.String() + ":" + attemptOwner(submission.StudentID, submission.GroupID)
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+			return err
+		}
+
+		var used int64
+		if err := attemptsOf(tx, submission.AssignmentID, submission.StudentID, submission.GroupID).Count(&used).Error; err != nil {
+			return err
+		}
+		if allowed > 0 && int(used) >= allowed {
+			return &AttemptLimitError{Used: int(used), Allowed: allowed}
+		}
+
+		submission.AttemptNumber = int(used) + 1
+		return tx.Create(submission).Error
+	})
+}
+
+// CountAttempts is how many submissions the group, or the student when
+// groupID is nil, has made to the assignment
+func (r *repository) CountAttempts(assignmentID uuid.UUID, studentID string, groupID *uuid.UUID) (int, error) {
+	var used int64
+	err := attemptsOf(r.db, assignmentID, studentID, groupID).Count(&used).Error
+	return int(used), err
+}
+
+// ListAttempts returns the submissions of the group, or of the student when
+// groupID is nil, to the assignment, newest first
+func (r *repository) ListAttempts(assignmentID uuid.UUID, studentID string, groupID *uuid.UUID) ([]core.Submission, error) {
+	var submissions []core.Submission
+	err := attemptsOf(r.db.Preload("Files").Preload("Members"), assignmentID, studentID, groupID).
+		Order("timestamp DESC").
+		Find(&submissions).Error
+	return submissions, err
+}
+
+func (r *repository) CreateAttemptGrant(grant *core.AttemptGrant) error {
+	return r.db.Create(grant).Error
+}
+
+// ExtraAttempts adds up the attempts granted to the students on the assignment
+func (r *repository) ExtraAttempts(assignmentID uuid.UUID, studentIDs []string) (int, error) {
+	var extra int
+	err := r.db.Model(&core.AttemptGrant{}).
+		Select("COALESCE(SUM(extra_attempts), 0)").
+		Where("assignment_id = ? AND student_id IN ?", assignmentID, studentIDs).
+		Scan(&extra).Error
+	return extra, err
+}
+
+// attemptsOf scopes db to the submissions counted as attempts of the group,
+// or of the student's own submissions when groupID is nil
+func attemptsOf(db *gorm.DB, assignmentID uuid.UUID, studentID string, groupID *uuid.UUID) *gorm.DB {
+	query := db.Model(&core.Submission{}).Where("assignment_id = ?", assignmentID)
+	if groupID != nil {
+		return query.Where("group_id = ?", *groupID)
+	}
+	return query.Where("student_id = ? AND group_id IS NULL", studentID)
+}
+
+func attemptOwner(studentID string, groupID *uuid.UUID) string {
+	if groupID != nil {
+		return "group:" + groupID.String()
+	}
+	return "student:" + studentID
+}
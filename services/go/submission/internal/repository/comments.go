@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+func (r *repository) CreateComment(comment *core.SubmissionComment) error {
+	return r.db.Create(comment).Error
+}
+
+// GetComment returns a comment of the submission, or gorm.ErrRecordNotFound
+func (r *repository) GetComment(submissionID, commentID uuid.UUID) (*core.SubmissionComment, error) {
+	var comment core.SubmissionComment
+	err := r.db.First(&comment, "id = ? AND submission_id = ?", commentID, submissionID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// ListComments returns the submission's comments with one of the given
+// visibilities, oldest first
+func (r *repository) ListComments(submissionID uuid.UUID, visibilities []core.CommentVisibility) ([]core.SubmissionComment, error) {
+	comments := make([]core.SubmissionComment, 0)
+	err := r.db.Where("submission_id = ? AND visibility IN ?", submissionID, visibilities).
+		Order("created_at ASC").
+		Find(&comments).Error
+	return comments, err
+}
+
+func (r *repository) DeleteComment(commentID uuid.UUID) error {
+	return r.db.Delete(&core.SubmissionComment{}, "id = ?", commentID).Error
+}
+
+// ListParticipants returns everyone who has graded or commented on the
+// submission
+func (r *repository) ListParticipants(submissionID uuid.UUID) ([]string, error) {
+	var userIDs []string
+	err := r.db.Raw(`
+		SELECT grader_user_id FROM grade_events WHERE submission_id = @id
+		UNION
+		SELECT author_user_id FROM submission_comments WHERE submission_id = @id AND deleted_at IS NULL`,
+		map[string]interface{}{"id": submissionID}).
+		Scan(&userIDs).Error
+	return userIDs, err
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrReasonRequired means a released grade was changed without saying why
+var ErrReasonRequired = errors.New("a reason is required to change a released grade")
+
+// SaveCriterionScores upserts the given scores, recomputes the submission's
+// rubric score and its late penalty, and records event, all in one
+// transaction so the grade and its history cannot diverge. The score is the
+// sum over the rubric's criteria once every one of them has been graded and
+// nil until then. event gets the old and new score, the penalty and a
+// snapshot of the resulting breakdown.
+func (r *repository) SaveCriterionScores(submissionID uuid.UUID, scores []core.CriterionScore, rubric *core.Rubric, lateness core.Lateness, event *core.GradeEvent) error {
+	criterionIDs := make([]uuid.UUID, 0, len(rubric.Criteria))
+	maxScore := 0
+	for _, c := range rubric.Criteria {
+		criterionIDs = append(criterionIDs, c.ID)
+		maxScore += c.MaxPoints
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the submission so concurrent graders and a release cannot
+		// interleave with the reason check
+		var submission core.Submission
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "rubric_score", "grade_released_at", "penalty_override").
+			First(&submission, "id = ?", submissionID).Error
+		if err != nil {
+			return err
+		}
+		if submission.GradeReleasedAt != nil && event.Reason == "" {
+			return ErrReasonRequired
+		}
+
+		for i := range scores {
+			scores[i].SubmissionID = submissionID
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "submission_id"}, {Name: "criterion_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"points", "comment", "updated_at"}),
+			}).Create(&scores[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var agg struct {
+			Graded int
+			Sum    int
+		}
+		err = tx.Model(&core.CriterionScore{}).
+			Select("COUNT(*) AS graded, COALESCE(SUM(points), 0) AS sum").
+			Where("submission_id = ? AND criterion_id IN ?", submissionID, criterionIDs).
+			Scan(&agg).Error
+		if err != nil {
+			return err
+		}
+		var total *int
+		if agg.Graded == len(criterionIDs) {
+			total = &agg.Sum
+		}
+
+		penalty, final := latePenalty(total, maxScore, lateness, submission.PenaltyOverride)
+		err = tx.Model(&core.Submission{}).Where("id = ?", submissionID).Updates(map[string]interface{}{
+			"rubric_score":    total,
+			"late_minutes":    lateness.Minutes,
+			"penalty_applied": penalty,
+			"final_score":     final,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		var stored []core.CriterionScore
+		if err := tx.Where("submission_id = ?", submissionID).Find(&stored).Error; err != nil {
+			return err
+		}
+		snapshot, err := json.Marshal(core.BuildGrade(submissionID, rubric, stored).Criteria)
+		if err != nil {
+			return err
+		}
+
+		event.ID = uuid.Nil
+		event.SubmissionID = submissionID
+		event.OldScore = submission.RubricScore
+		event.NewScore = total
+		event.Penalty = penalty
+		event.RubricSnapshot = string(snapshot)
+		return tx.Create(event).Error
+	})
+}
+
+// SetPenaltyOverride replaces the computed late penalty of the submission
+// with override, or goes back to the computed one if override is nil, and
+// records event with the reason. The final score is recomputed from the
+// rubric score, out of maxScore, and lateness.
+func (r *repository) SetPenaltyOverride(submissionID uuid.UUID, override *int, maxScore int, lateness core.Lateness, event *core.GradeEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var submission core.Submission
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "rubric_score").
+			First(&submission, "id = ?", submissionID).Error
+		if err != nil {
+			return err
+		}
+
+		penalty, final := latePenalty(submission.RubricScore, maxScore, lateness, override)
+		var overriddenBy, reason string
+		if override != nil {
+			overriddenBy, reason = event.GraderUserID, event.Reason
+		}
+		err = tx.Model(&core.Submission{}).Where("id = ?", submissionID).Updates(map[string]interface{}{
+			"penalty_override":        override,
+			"penalty_override_reason": reason,
+			"penalty_overridden_by":   overriddenBy,
+			"late_minutes":            lateness.Minutes,
+			"penalty_applied":         penalty,
+			"final_score":             final,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		event.ID = uuid.Nil
+		event.SubmissionID = submissionID
+		event.OldScore = submission.RubricScore
+		event.NewScore = submission.RubricScore
+		event.Penalty = penalty
+		return tx.Create(event).Error
+	})
+}
+
+// latePenalty returns the penalty on raw and the final score, both nil
+// while raw is. An override wins over the policy, but like it never takes
+// more than raw.
+func latePenalty(raw *int, maxScore int, lateness core.Lateness, override *int) (*int, *int) {
+	if raw == nil {
+		return nil, nil
+	}
+	penalty := lateness.Policy.Penalty(*raw, maxScore, lateness.Minutes)
+	if override != nil {
+		penalty = min(*override, *raw)
+	}
+	final := *raw - penalty
+	return &penalty, &final
+}
+
+// ReleaseGrade marks the submission's grade as released, keeping the first
+// release time if it already was. It reports whether this call released it.
+func (r *repository) ReleaseGrade(submissionID uuid.UUID) (bool, error) {
+	result := r.db.Model(&core.Submission{}).
+		Where("id = ? AND grade_released_at IS NULL", submissionID).
+		Update("grade_released_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Either already released or missing; only the latter is an error
+		var count int64
+		if err := r.db.Model(&core.Submission{}).Where("id = ?", submissionID).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count == 0 {
+			return false, gorm.ErrRecordNotFound
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func (r *repository) ListGradeEvents(submissionID uuid.UUID) ([]core.GradeEvent, error) {
+	var events []core.GradeEvent
+	err := r.db.Where("submission_id = ?", submissionID).Order("created_at DESC").Find(&events).Error
+	return events, err
+}
+
+// GetLatestGradeEvent returns the most recent grade write, or nil if the
+// submission has never been graded
+func (r *repository) GetLatestGradeEvent(submissionID uuid.UUID) (*core.GradeEvent, error) {
+	var event core.GradeEvent
+	result := r.db.Where("submission_id = ?", submissionID).Order("created_at DESC").Limit(1).Find(&event)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &event, nil
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -8,10 +10,48 @@ import (
 
 type Repository interface {
 	AutoMigrate() error
-	CreateSubmission(submission *core.Submission) error
+	CreateSubmissionAttempt(submission *core.Submission, allowed int) error
+	CountAttempts(assignmentID uuid.UUID, studentID string, groupID *uuid.UUID) (int, error)
+	ListAttempts(assignmentID uuid.UUID, studentID string, groupID *uuid.UUID) ([]core.Submission, error)
+	CreateAttemptGrant(grant *core.AttemptGrant) error
+	ExtraAttempts(assignmentID uuid.UUID, studentIDs []string) (int, error)
 	GetSubmissionByID(id uuid.UUID) (*core.Submission, error)
 	ListSubmissions(assignmentID uuid.UUID, studentID string) ([]core.Submission, error)
+	ListSubmissionsForGrading(assignmentID uuid.UUID) ([]core.Submission, error)
 	UpdateSubmissionStatus(id uuid.UUID, status core.SubmissionStatus, score int) error
+	ListCriterionScores(submissionID uuid.UUID) ([]core.CriterionScore, error)
+	SaveCriterionScores(submissionID uuid.UUID, scores []core.CriterionScore, rubric *core.Rubric, lateness core.Lateness, event *core.GradeEvent) error
+	SetPenaltyOverride(submissionID uuid.UUID, override *int, maxScore int, lateness core.Lateness, event *core.GradeEvent) error
+	ReleaseGrade(submissionID uuid.UUID) (bool, error)
+	ListGradeEvents(submissionID uuid.UUID) ([]core.GradeEvent, error)
+	GetLatestGradeEvent(submissionID uuid.UUID) (*core.GradeEvent, error)
+	CreateComment(comment *core.SubmissionComment) error
+	GetComment(submissionID, commentID uuid.UUID) (*core.SubmissionComment, error)
+	ListComments(submissionID uuid.UUID, visibilities []core.CommentVisibility) ([]core.SubmissionComment, error)
+	DeleteComment(commentID uuid.UUID) error
+	ListParticipants(submissionID uuid.UUID) ([]string, error)
+	ClaimScan(now time.Time, lease time.Duration) (*core.Submission, error)
+	FinishScan(submission *core.Submission, rejected bool, signature string, now time.Time) error
+	RequestRescan(id uuid.UUID) error
+	CreateSimilarityJob(job *core.SimilarityJob) error
+	GetSimilarityJob(assignmentID, id uuid.UUID) (*core.SimilarityJob, error)
+	ListSimilarityJobs(assignmentID uuid.UUID) ([]core.SimilarityJob, error)
+	ClaimSimilarityJob(now time.Time, lease time.Duration) (*core.SimilarityJob, error)
+	ListSimilaritySubmissions(assignmentID, after uuid.UUID, limit int) ([]core.Submission, error)
+	SaveSimilarityResults(results []core.SimilarityResult) error
+	CompleteSimilarityJob(job *core.SimilarityJob, now time.Time) error
+	FailSimilarityJob(job *core.SimilarityJob, reason string, now time.Time) error
+	ListSimilarityResults(assignmentID uuid.UUID, limit int) (*core.SimilarityJob, []core.SimilarityResult, error)
+	CreateArchiveJob(job *core.ArchiveJob) error
+	GetArchiveJob(assignmentID, id uuid.UUID) (*core.ArchiveJob, error)
+	ClaimArchiveJob(now time.Time, lease time.Duration) (*core.ArchiveJob, error)
+	ListArchiveSubmissions(assignmentID uuid.UUID) ([]core.Submission, error)
+	UpdateArchiveProgress(job *core.ArchiveJob, claimedUntil time.Time) error
+	CompleteArchiveJob(job *core.ArchiveJob, now time.Time) error
+	FailArchiveJob(job *core.ArchiveJob, reason string, now time.Time) error
+	ListStudentGrades(studentID string) ([]core.StudentGrade, error)
+	AssignmentStats(assignmentIDs []uuid.UUID, releasedOnly bool) ([]core.AssignmentStats, error)
+	AssignmentScoreCounts(assignmentID uuid.UUID, releasedOnly bool) (map[int]int, error)
 }
 
 type repository struct {
@@ -26,18 +66,22 @@ func (r *repository) AutoMigrate() error {
 	return r.db.AutoMigrate(
 		&core.Submission{},
 		&core.SubmissionFile{},
+		&core.SubmissionMember{},
 		&core.VivaTranscriptTurn{},
 		&core.IntegritySignal{},
+		&core.CriterionScore{},
+		&core.GradeEvent{},
+		&core.SubmissionComment{},
+		&core.AttemptGrant{},
+		&core.SimilarityJob{},
+		&core.SimilarityResult{},
+		&core.ArchiveJob{},
 	)
 }
 
-func (r *repository) CreateSubmission(submission *core.Submission) error {
-	return r.db.Create(submission).Error
-}
-
 func (r *repository) GetSubmissionByID(id uuid.UUID) (*core.Submission, error) {
 	var submission core.Submission
-	err := r.db.Preload("Files").Preload("VivaTurns").Preload("Integrity").First(&submission, "id = ?", id).Error
+	err := r.db.Preload("Files").Preload("Members").Preload("VivaTurns").Preload("Integrity").First(&submission, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -46,20 +90,39 @@ func (r *repository) GetSubmissionByID(id uuid.UUID) (*core.Submission, error) {
 
 func (r *repository) ListSubmissions(assignmentID uuid.UUID, studentID string) ([]core.Submission, error) {
 	var submissions []core.Submission
-	query := r.db.Preload("Files")
+	query := r.db.Preload("Files").Preload("Members")
 	if assignmentID != uuid.Nil {
 		query = query.Where("assignment_id = ?", assignmentID)
 	}
 	if studentID != "" {
-		query = query.Where("student_id = ?", studentID)
+		// A student sees their own submissions and those of their groups
+		query = query.Where("student_id = ? OR id IN (?)", studentID,
+			r.db.Model(&core.SubmissionMember{}).Select("submission_id").Where("student_id = ?", studentID))
 	}
 	err := query.Find(&submissions).Error
 	return submissions, err
 }
 
+// ListSubmissionsForGrading returns every submission to the assignment with
+// its members, newest first
+func (r *repository) ListSubmissionsForGrading(assignmentID uuid.UUID) ([]core.Submission, error) {
+	var submissions []core.Submission
+	err := r.db.Preload("Members").
+		Where("assignment_id = ?", assignmentID).
+		Order("timestamp DESC").
+		Find(&submissions).Error
+	return submissions, err
+}
+
 func (r *repository) UpdateSubmissionStatus(id uuid.UUID, status core.SubmissionStatus, score int) error {
 	return r.db.Model(&core.Submission{}).Where("id = ?", id).Updates(map[string]interface{}{
 		"status": status,
 		"score":  score,
 	}).Error
 }
+
+func (r *repository) ListCriterionScores(submissionID uuid.UUID) ([]core.CriterionScore, error) {
+	var scores []core.CriterionScore
+	err := r.db.Where("submission_id = ?", submissionID).Find(&scores).Error
+	return scores, err
+}
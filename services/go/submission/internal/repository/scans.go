@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ClaimScan takes the oldest submission waiting for its files to be scanned
+// for lease and returns it with its files and members, or nil if there is
+// none. A claim that runs out, because the scan failed or the worker died,
+// lets another worker take the submission again. SKIP LOCKED keeps several
+// workers from claiming the same one.
+func (r *repository) ClaimScan(now time.Time, lease time.Duration) (*core.Submission, error) {
+	var claimed *uuid.UUID
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var candidate core.Submission
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Select("id").
+			Where("status = ?", core.SubmissionStatusScanning).
+			Where("scan_claimed_until IS NULL OR scan_claimed_until < ?", now).
+			Order("timestamp ASC").
+			First(&candidate).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		until := now.Add(lease)
+		if err := tx.Model(&core.Submission{}).Where("id = ?", candidate.ID).Update("scan_claimed_until", until).Error; err != nil {
+			return err
+		}
+		claimed = &candidate.ID
+		return nil
+	})
+	if err != nil || claimed == nil {
+		return nil, err
+	}
+	return r.GetSubmissionByID(*claimed)
+}
+
+// FinishScan stores where the submission's files ended up and the outcome
+// of the scan: rejected with the signature found, or clean. A clean
+// submission that was re-scanned goes back to the status it had. Nothing
+// changes if the submission is no longer being scanned.
+func (r *repository) FinishScan(submission *core.Submission, rejected bool, signature string, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&core.Submission{}).
+			Where("id = ? AND status = ?", submission.ID, core.SubmissionStatusScanning).
+			Updates(map[string]interface{}{
+				"status":             scanOutcome(rejected),
+				"scan_signature":     signature,
+				"scanned_at":         now,
+				"scan_claimed_until": nil,
+				"rescan_from":        "",
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		for _, file := range submission.Files {
+			err := tx.Model(&core.SubmissionFile{}).Where("id = ?", file.ID).Updates(map[string]interface{}{
+				"storage_path": file.StoragePath,
+				"storage_url":  file.StorageURL,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func scanOutcome(rejected bool) interface{} {
+	if rejected {
+		return core.SubmissionStatusRejected
+	}
+	return gorm.Expr("COALESCE(NULLIF(rescan_from, ''), ?)", core.SubmissionStatusClean)
+}
+
+// RequestRescan queues the submission's files to be scanned again and hides
+// their download links until then. A submission already waiting is left as
+// it is.
+func (r *repository) RequestRescan(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var submission core.Submission
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status").
+			First(&submission, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		if submission.Status == core.SubmissionStatusScanning {
+			return nil
+		}
+
+		// Judged submissions get their verdict back once found clean
+		rescanFrom := submission.Status
+		if rescanFrom == core.SubmissionStatusClean || rescanFrom == core.SubmissionStatusRejected {
+			rescanFrom = ""
+		}
+		err = tx.Model(&core.Submission{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"status":             core.SubmissionStatusScanning,
+			"rescan_from":        rescanFrom,
+			"scan_claimed_until": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&core.SubmissionFile{}).Where("submission_id = ?", id).Update("storage_url", "").Error
+	})
+}
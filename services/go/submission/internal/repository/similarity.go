@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSimilarityJobActive = errors.New("a similarity job for this assignment is already queued or running")
+	ErrNoSimilarityResults = errors.New("no similarity job has completed for this assignment")
+)
+
+// CreateSimilarityJob queues the job unless its assignment already has one
+// queued or running. Jobs of the same assignment are created under an
+// advisory lock, so two requests cannot both queue one.
+func (r *repository) CreateSimilarityJob(job *core.SimilarityJob) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "similarity_jobs:"+job.AssignmentID.String()).Error; err != nil {
+			return err
+		}
+		var active int64
+		err := tx.Model(&core.SimilarityJob{}).
+			Where("assignment_id = ? AND status IN ?", job.AssignmentID, []core.SimilarityJobStatus{core.SimilarityJobQueued, core.SimilarityJobRunning}).
+			Count(&active).Error
+		if err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrSimilarityJobActive
+		}
+		job.Status = core.SimilarityJobQueued
+		return tx.Create(job).Error
+	})
+}
+
+func (r *repository) GetSimilarityJob(assignmentID, id uuid.UUID) (*core.SimilarityJob, error) {
+	var job core.SimilarityJob
+	if err := r.db.First(&job, "id = ? AND assignment_id = ?", id, assignmentID).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListSimilarityJobs returns the assignment's jobs, newest first
+func (r *repository) ListSimilarityJobs(assignmentID uuid.UUID) ([]core.SimilarityJob, error) {
+	var jobs []core.SimilarityJob
+	err := r.db.Where("assignment_id = ?", assignmentID).Order("created_at DESC").Find(&jobs).Error
+	return jobs, err
+}
+
+// ClaimSimilarityJob takes the oldest queued job, or a running one whose
+// claim has run out because its worker died, for lease and returns it, or
+// nil if there is none. Results left by an earlier run of the job are
+// dropped. SKIP LOCKED keeps several workers from claiming the same one.
+func (r *repository) ClaimSimilarityJob(now time.Time, lease time.Duration) (*core.SimilarityJob, error) {
+	var claimed *core.SimilarityJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var job core.SimilarityJob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND claimed_until < ?)", core.SimilarityJobQueued, core.SimilarityJobRunning, now).
+			Order("created_at ASC").
+			First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("job_id = ?", job.ID).Delete(&core.SimilarityResult{}).Error; err != nil {
+			return err
+		}
+		until := now.Add(lease)
+		job.Status = core.SimilarityJobRunning
+		job.ClaimedUntil = &until
+		job.StartedAt = &now
+		err = tx.Model(&job).Updates(map[string]interface{}{
+			"status":        job.Status,
+			"claimed_until": until,
+			"started_at":    now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		claimed = &job
+		return nil
+	})
+	return claimed, err
+}
+
+// ListSimilaritySubmissions returns up to limit submissions to compare for
+// the assignment with IDs after after, in ID order, with their files: the
+// latest submission of each student or group whose files were found clean
+func (r *repository) ListSimilaritySubmissions(assignmentID, after uuid.UUID, limit int) ([]core.Submission, error) {
+	ranked := r.db.Model(&core.Submission{}).
+		Select("id, ROW_NUMBER() OVER (PARTITION BY COALESCE(CAST(group_id AS TEXT), student_id) ORDER BY timestamp DESC) AS position").
+		Where("assignment_id = ? AND status NOT IN ?", assignmentID,
+			[]core.SubmissionStatus{core.SubmissionStatusScanning, core.SubmissionStatusRejected})
+	latest := r.db.Table("(?) AS ranked", ranked).Select("id").Where("position = 1")
+
+	var submissions []core.Submission
+	err := r.db.Preload("Files").
+		Where("id IN (?) AND id > ?", latest, after).
+		Order("id").
+		Limit(limit).
+		Find(&submissions).Error
+	return submissions, err
+}
+
+// SaveSimilarityResults stores results of a running job. A pair already
+// stored for the job is kept as it is.
+func (r *repository) SaveSimilarityResults(results []core.SimilarityResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&results).Error
+}
+
+// CompleteSimilarityJob marks the job completed and, in the same
+// transaction, drops the results of the assignment's earlier jobs, so its
+// results are replaced all at once
+func (r *repository) CompleteSimilarityJob(job *core.SimilarityJob, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("assignment_id = ? AND job_id <> ?", job.AssignmentID, job.ID).
+			Delete(&core.SimilarityResult{}).Error
+		if err != nil {
+			return err
+		}
+		job.Status = core.SimilarityJobCompleted
+		job.FinishedAt = &now
+		job.ClaimedUntil = nil
+		return tx.Model(job).Updates(map[string]interface{}{
+			"status":           job.Status,
+			"submission_count": job.SubmissionCount,
+			"pair_count":       job.PairCount,
+			"finished_at":      now,
+			"claimed_until":    nil,
+		}).Error
+	})
+}
+
+// FailSimilarityJob marks the job failed and drops the results it stored,
+// leaving those of the assignment's last completed job in place
+func (r *repository) FailSimilarityJob(job *core.SimilarityJob, reason string, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("job_id = ?", job.ID).Delete(&core.SimilarityResult{}).Error; err != nil {
+			return err
+		}
+		job.Status = core.SimilarityJobFailed
+		job.Error = reason
+		job.FinishedAt = &now
+		job.ClaimedUntil = nil
+		return tx.Model(job).Updates(map[string]interface{}{
+			"status":        job.Status,
+			"error":         reason,
+			"finished_at":   now,
+			"claimed_until": nil,
+		}).Error
+	})
+}
+
+// ListSimilarityResults returns the assignment's latest completed job and up
+// to limit of its results, highest score first
+func (r *repository) ListSimilarityResults(assignmentID uuid.UUID, limit int) (*core.SimilarityJob, []core.SimilarityResult, error) {
+	var job core.SimilarityJob
+	result := r.db.Where("assignment_id = ? AND status = ?", assignmentID, core.SimilarityJobCompleted).
+		Order("finished_at DESC").
+		Limit(1).
+		Find(&job)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrNoSimilarityResults
+	}
+
+	var results []core.SimilarityResult
+	err := r.db.Where("job_id = ?", job.ID).Order("score DESC").Limit(limit).Find(&results).Error
+	return &job, results, err
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"math"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+// countedGradesSQL selects, for each assignment and each student who
+// submitted to it alone or in a group, the grade that counts: that of their
+// latest submission with a released grade, or of their latest submission if
+// none was released. The score is null until the rubric is fully graded,
+// and also while the grade is unreleased if the first parameter is true.
+// Deleted submissions and those rejected by the virus scan do not count.
+const countedGradesSQL = `
+	SELECT assignment_id, score FROM (
+		SELECT
+			s.assignment_id,
+			CASE WHEN s.grade_released_at IS NOT NULL OR NOT ? THEN COALESCE(s.final_score, s.rubric_score) END AS score,
+			ROW_NUMBER() OVER (
+				PARTITION BY s.assignment_id, COALESCE(sm.student_id, s.student_id)
+				ORDER BY s.grade_released_at IS NOT NULL DESC, s.timestamp DESC
+			) AS position
+		FROM submissions s
+		LEFT JOIN submission_members sm ON sm.submission_id = s.id
+		WHERE s.deleted_at IS NULL
+			AND s.status <> 'rejected'
+			AND s.assignment_id IN ?
+	) AS ranked
+	WHERE position = 1`
+
+// AssignmentStats aggregates the grades that count on each of the
+// assignments in one grouped query. Assignments nobody submitted to are
+// left out. With releasedOnly, grades not released yet are not counted as
+// graded. Databases without percentile_cont, like the SQLite of the tests,
+// get the counted grades back and aggregate them here instead.
+func (r *repository) AssignmentStats(assignmentIDs []uuid.UUID, releasedOnly bool) ([]core.AssignmentStats, error) {
+	if r.db.Dialector.Name() != "postgres" {
+		return r.aggregateAssignmentStats(assignmentIDs, releasedOnly)
+	}
+
+	var rows []struct {
+		AssignmentID uuid.UUID
+		Submitted    int
+		Graded       int
+		Mean         *float64
+		Median       *float64
+		StdDev       *float64
+	}
+	err := r.db.Raw(`
+		SELECT
+			assignment_id,
+			COUNT(*) AS submitted,
+			COUNT(score) AS graded,
+			ROUND(AVG(score), 2)::float8 AS mean,
+			ROUND(percentile_cont(0.5) WITHIN GROUP (ORDER BY score)::numeric, 2)::float8 AS median,
+			ROUND(stddev_pop(score), 2)::float8 AS std_dev
+		FROM (`+countedGradesSQL+`) counted
+		GROUP BY assignment_id`, releasedOnly, assignmentIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]core.AssignmentStats, len(rows))
+	for i, row := range rows {
+		stats[i] = core.AssignmentStats{
+			AssignmentID: row.AssignmentID,
+			Submitted:    row.Submitted,
+			Graded:       row.Graded,
+			Mean:         row.Mean,
+			Median:       row.Median,
+			StdDev:       row.StdDev,
+		}
+	}
+	return stats, nil
+}
+
+// aggregateAssignmentStats is AssignmentStats for databases without
+// percentile_cont, rounding the same way Postgres does
+func (r *repository) aggregateAssignmentStats(assignmentIDs []uuid.UUID, releasedOnly bool) ([]core.AssignmentStats, error) {
+	var rows []struct {
+		AssignmentID uuid.UUID
+		Score        *int
+	}
+	err := r.db.Raw(countedGradesSQL+` ORDER BY assignment_id, score`, releasedOnly, assignmentIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []core.AssignmentStats
+	scores := make(map[uuid.UUID][]float64)
+	for _, row := range rows {
+		if len(stats) == 0 || stats[len(stats)-1].AssignmentID != row.AssignmentID {
+			stats = append(stats, core.AssignmentStats{AssignmentID: row.AssignmentID})
+		}
+		stats[len(stats)-1].Submitted++
+		if row.Score != nil {
+			stats[len(stats)-1].Graded++
+			scores[row.AssignmentID] = append(scores[row.AssignmentID], float64(*row.Score))
+		}
+	}
+	for i := range stats {
+		graded := scores[stats[i].AssignmentID] // sorted by the query
+		if len(graded) == 0 {
+			continue
+		}
+		var sum float64
+		for _, score := range graded {
+			sum += score
+		}
+		mean := sum / float64(len(graded))
+		var squares float64
+		for _, score := range graded {
+			squares += (score - mean) * (score - mean)
+		}
+		middle := len(graded) / 2
+		median := graded[middle]
+		if len(graded)%2 == 0 {
+			median = (graded[middle-1] + graded[middle]) / 2
+		}
+		stdDev := math.Sqrt(squares / float64(len(graded)))
+		stats[i].Mean, stats[i].Median, stats[i].StdDev = round2(mean), round2(median), round2(stdDev)
+	}
+	return stats, nil
+}
+
+// round2 rounds to 2 decimal places, halves away from zero
+func round2(x float64) *float64 {
+	rounded := math.Round(x*100) / 100
+	return &rounded
+}
+
+// AssignmentScoreCounts returns how many of the grades that count on the
+// assignment have each score, leaving out those not released yet if
+// releasedOnly is set
+func (r *repository) AssignmentScoreCounts(assignmentID uuid.UUID, releasedOnly bool) (map[int]int, error) {
+	var rows []struct {
+		Score int
+		Count int
+	}
+	err := r.db.Raw(`
+		SELECT score, COUNT(*) AS count
+		FROM (`+countedGradesSQL+`) counted
+		WHERE score IS NOT NULL
+		GROUP BY score`, releasedOnly, []uuid.UUID{assignmentID}).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int, len(rows))
+	for _, row := range rows {
+		counts[row.Score] = row.Count
+	}
+	return counts, nil
+}
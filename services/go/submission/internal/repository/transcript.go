@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+)
+
+// ListStudentGrades returns, for every assignment the student submitted to
+// alone or with a group, the grade that counts: that of their latest
+// submission with a released grade, or of their latest one if none has been
+// released. Scores are after any late penalty.
+func (r *repository) ListStudentGrades(studentID string) ([]core.StudentGrade, error) {
+	var grades []core.StudentGrade
+	err := r.db.Raw(`
+		SELECT assignment_id, score, released FROM (
+			SELECT
+				s.assignment_id,
+				COALESCE(s.final_score, s.rubric_score, s.score) AS score,
+				s.grade_released_at IS NOT NULL AS released,
+				ROW_NUMBER() OVER (PARTITION BY s.assignment_id ORDER BY s.grade_released_at IS NOT NULL DESC, s.timestamp DESC) AS position
+			FROM submissions s
+			WHERE s.deleted_at IS NULL
+				AND (s.student_id = ? OR s.id IN (SELECT submission_id FROM submission_members WHERE student_id = ?))
+		) AS ranked
+		WHERE position = 1`, studentID, studentID).
+		Scan(&grades).Error
+	return grades, err
+}
@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize is how much of the file goes into each INSTREAM chunk
+const chunkSize = 64 * 1024
+
+// ClamAV scans files with clamd over TCP using the INSTREAM command
+type ClamAV struct {
+	addr    string
+	timeout time.Duration
+}
+
+func NewClamAV(addr string, timeout time.Duration) *ClamAV {
+	return &ClamAV{addr: addr, timeout: timeout}
+}
+
+// Scan streams r to clamd in chunks, ends the stream with a zero-length
+// chunk and reads back one reply: "stream: OK" for a clean file,
+// "stream: <signature> FOUND" for an infected one.
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Verdict, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", "", fmt.Errorf("failed to start clamd stream: %w", err)
+	}
+	// Each chunk is its length as a 4-byte big-endian number, then the data
+	chunk := make([]byte, 4+chunkSize)
+	for {
+		n, err := r.Read(chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk, uint32(n))
+			if _, werr := conn.Write(chunk[:4+n]); werr != nil {
+				// clamd closes the connection once the stream exceeds
+				// StreamMaxLength; its reply says so
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+	_, _ = conn.Write([]byte{0, 0, 0, 0})
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseReply turns a clamd INSTREAM reply into a verdict
+func parseReply(reply string) (Verdict, string, error) {
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return VerdictClean, "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return VerdictInfected, strings.TrimSuffix(result, " FOUND"), nil
+	}
+	return "", "", fmt.Errorf("clamd: %s", result)
+}
@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd serves INSTREAM sessions, finding a virus in any stream that
+// contains the EICAR marker. It returns the address to dial.
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveClamd(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	var stream bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&stream, r, int64(size)); err != nil {
+			return
+		}
+	}
+	if strings.Contains(stream.String(), "EICAR") {
+		_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	_, _ = conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamAVScan(t *testing.T) {
+	scanner := NewClamAV(fakeClamd(t), 5*time.Second)
+
+	// Larger than one chunk, so the stream is split
+	clean := strings.Repeat("print('hello')\n", chunkSize/8)
+	verdict, details, err := scanner.Scan(context.Background(), strings.NewReader(clean))
+	if err != nil || verdict != VerdictClean || details != "" {
+		t.Errorf("clean file = %q %q %v", verdict, details, err)
+	}
+
+	verdict, details, err = scanner.Scan(context.Background(), strings.NewReader(clean+"EICAR"))
+	if err != nil || verdict != VerdictInfected || details != "Eicar-Test-Signature" {
+		t.Errorf("infected file = %q %q %v", verdict, details, err)
+	}
+}
+
+func TestClamAVUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if _, _, err := NewClamAV(addr, time.Second).Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Error("scan without clamd succeeded")
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	if _, _, err := parseReply("INSTREAM size limit exceeded. ERROR"); err == nil {
+		t.Error("clamd error reply parsed as a verdict")
+	}
+}
@@ -0,0 +1,50 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Verdict is the outcome of scanning a file
+type Verdict string
+
+const (
+	VerdictClean    Verdict = "clean"
+	VerdictInfected Verdict = "infected"
+)
+
+// Scanner checks file contents for malware. For an infected file, details
+// names what was found, e.g. the virus signature.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Verdict, string, error)
+}
+
+// Config selects and configures a Scanner
+type Config struct {
+	// Kind is "clamav" or "none"
+	Kind string
+	// ClamAVAddr is the host:port of clamd's TCP socket
+	ClamAVAddr string
+	// Timeout bounds a single scan, including connecting
+	Timeout time.Duration
+}
+
+// New returns the scanner cfg selects
+func New(cfg Config) (Scanner, error) {
+	switch cfg.Kind {
+	case "", "none":
+		return Noop{}, nil
+	case "clamav":
+		return NewClamAV(cfg.ClamAVAddr, cfg.Timeout), nil
+	}
+	return nil, fmt.Errorf("unknown scanner %q, expected clamav or none", cfg.Kind)
+}
+
+// Noop passes every file as clean, for development without a scanner
+type Noop struct{}
+
+func (Noop) Scan(ctx context.Context, r io.Reader) (Verdict, string, error) {
+	return VerdictClean, "", nil
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	// archiveURLTTL is how long the download link of a completed archive
+	// works; fetching the job again gives a new one
+	archiveURLTTL = time.Hour
+	// archiveProgressInterval is how often a running job saves how far it
+	// has got, which also keeps its claim
+	archiveProgressInterval = 2 * time.Second
+)
+
+var (
+	ErrInvalidArchiveJob = errors.New("invalid archive job")
+	ErrArchiveJobActive  = repository.ErrArchiveJobActive
+	ErrArchiveForbidden  = errors.New("only the class's instructors and admins may download its submissions")
+)
+
+// ArchiveRequester is who asks for an archive of an assignment's
+// submissions. Unless All is set, as for admins, they must be an
+// instructor of the assignment's class.
+type ArchiveRequester struct {
+	UserID string
+	All    bool
+}
+
+// StartArchiveJob queues building a zip of the assignment's submissions:
+// the latest of each student and group, or their attempt numbered attempt
+// when that is not 0
+func (s *submissionService) StartArchiveJob(ctx context.Context, assignmentID uuid.UUID, attempt int, requester ArchiveRequester) (*core.ArchiveJob, error) {
+	if attempt < 0 {
+		return nil, fmt.Errorf("%w: attempt must be a positive number", ErrInvalidArchiveJob)
+	}
+	if err := s.checkTeaches(ctx, assignmentID, requester); err != nil {
+		return nil, err
+	}
+
+	job := &core.ArchiveJob{
+		AssignmentID: assignmentID,
+		Attempt:      attempt,
+		RequestedBy:  requester.UserID,
+	}
+	if err := s.repo.CreateArchiveJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetArchiveJob returns the job with its progress and, once it has
+// completed, a signed link to download the archive
+func (s *submissionService) GetArchiveJob(ctx context.Context, assignmentID, jobID uuid.UUID, requester ArchiveRequester) (*core.ArchiveJob, error) {
+	if err := s.checkTeaches(ctx, assignmentID, requester); err != nil {
+		return nil, err
+	}
+	job, err := s.repo.GetArchiveJob(assignmentID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == core.ArchiveJobCompleted && s.storage != nil {
+		expiresAt := time.Now().Add(archiveURLTTL)
+		job.DownloadURL, err = s.storage.SignedURL(ctx, job.StoragePath, archiveURLTTL)
+		if err != nil {
+			return nil, fmt.Errorf("signing the archive's download link: %w", err)
+		}
+		job.DownloadURLExpiresAt = &expiresAt
+	}
+	return job, nil
+}
+
+// checkTeaches returns ErrArchiveForbidden unless requester may archive the
+// assignment's submissions
+func (s *submissionService) checkTeaches(ctx context.Context, assignmentID uuid.UUID, requester ArchiveRequester) error {
+	settings, err := s.assignments.GetSettings(ctx, assignmentID)
+	if err != nil {
+		return err
+	}
+	if requester.All {
+		return nil
+	}
+	if settings.CourseID == "" {
+		return ErrArchiveForbidden
+	}
+	classes, err := s.users.GetClasses(ctx, []string{settings.CourseID})
+	if err != nil {
+		return fmt.Errorf("instructors of class %s: %w", settings.CourseID, err)
+	}
+	for _, class := range classes {
+		if class.ID == settings.CourseID && slices.Contains(class.InstructorIDs, requester.UserID) {
+			return nil
+		}
+	}
+	return ErrArchiveForbidden
+}
+
+// archiveSubmissions picks from submissions, newest first, the one of each
+// student and group an archive of attempt holds, as GradingList does.
+// Students and groups without that attempt are left out.
+func archiveSubmissions(submissions []core.Submission, attempt int) []*core.Submission {
+	var picked []*core.Submission
+	seen := make(map[string]bool)
+	for i := range submissions {
+		submission := &submissions[i]
+		key := "student:" + submission.StudentID
+		if submission.GroupID != nil {
+			key = "group:" + submission.GroupID.String()
+		}
+		if seen[key] || (attempt != 0 && submission.AttemptNumber != attempt) {
+			continue
+		}
+		seen[key] = true
+		picked = append(picked, submission)
+	}
+	return picked
+}
+
+// ArchiveWorker builds queued archives. Each file is streamed from storage
+// through the zip writer into the archive's upload, so neither a file nor
+// the archive is ever held in memory whole.
+type ArchiveWorker struct {
+	repo     repository.Repository
+	storage  storage.StorageClient
+	users    UserDirectory
+	lease    time.Duration
+	interval time.Duration
+}
+
+// NewArchiveWorker creates the worker. A job whose worker has not reported
+// progress for lease may be taken over by another.
+func NewArchiveWorker(repo repository.Repository, storageClient storage.StorageClient, users UserDirectory, lease, interval time.Duration) *ArchiveWorker {
+	return &ArchiveWorker{
+		repo:     repo,
+		storage:  storageClient,
+		users:    users,
+		lease:    lease,
+		interval: interval,
+	}
+}
+
+// Run polls for queued jobs until ctx is cancelled
+func (w *ArchiveWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := w.repo.ClaimArchiveJob(time.Now(), w.lease)
+			if err != nil {
+				log.Printf("Failed to claim archive job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			w.Process(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process builds a claimed job's archive and records how it ended
+func (w *ArchiveWorker) Process(ctx context.Context, job *core.ArchiveJob) {
+	err := w.run(ctx, job)
+	if err == nil {
+		err = w.repo.CompleteArchiveJob(job, time.Now())
+		if err == nil {
+			log.Printf("Archive job %s wrote %d files of %d submissions", job.ID, job.FilesDone, job.SubmissionCount)
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the job is taken up again once its claim runs out
+		return
+	}
+	log.Printf("Archive job %s failed: %v", job.ID, err)
+	if err := w.repo.FailArchiveJob(job, err.Error(), time.Now()); err != nil {
+		log.Printf("Failed to record that archive job %s failed: %v", job.ID, err)
+	}
+}
+
+func (w *ArchiveWorker) run(ctx context.Context, job *core.ArchiveJob) error {
+	submissions, err := w.repo.ListArchiveSubmissions(job.AssignmentID)
+	if err != nil {
+		return err
+	}
+	// A job taken over from a worker that stopped starts over
+	job.SubmissionCount, job.SkippedCount, job.FileCount, job.FilesDone = 0, 0, 0, 0
+	var included []*core.Submission
+	for _, submission := range archiveSubmissions(submissions, job.Attempt) {
+		if filesAvailable(submission) != nil {
+			job.SkippedCount++
+			continue
+		}
+		included = append(included, submission)
+		job.FileCount += len(submission.Files)
+	}
+	job.SubmissionCount = len(included)
+
+	folders, err := w.folders(ctx, included)
+	if err != nil {
+		return err
+	}
+	if err := w.repo.UpdateArchiveProgress(job, time.Now().Add(w.lease)); err != nil {
+		return err
+	}
+
+	// The zip is written into one end of the pipe while the upload reads
+	// the other. If the upload stops, closing the reader stops the writer.
+	job.StoragePath = storage.ArchivePath(job.AssignmentID, job.ID)
+	_ = w.storage.DeleteFile(ctx, job.StoragePath) // left by an earlier run, if any
+	reader, writer := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := w.write(ctx, job, included, folders, writer)
+		writer.CloseWithError(err)
+		written <- err
+	}()
+	err = w.storage.UploadStream(ctx, job.StoragePath, "application/zip", reader)
+	reader.CloseWithError(errors.New("upload stopped"))
+	if writeErr := <-written; writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// write writes the zip of the submissions to out, each submission's files
+// in its folder, saving the job's progress as it goes
+func (w *ArchiveWorker) write(ctx context.Context, job *core.ArchiveJob, submissions []*core.Submission, folders map[uuid.UUID]string, out io.Writer) error {
+	archive := zip.NewWriter(out)
+	names := newArchiveNames()
+	saved := time.Now()
+	for _, submission := range submissions {
+		for i := range submission.Files {
+			file := &submission.Files[i]
+			name := names.file(folders[submission.ID], file.Filename)
+			if err := w.copyFile(ctx, archive, submission, file, name); err != nil {
+				return fmt.Errorf("submission %s, %s: %w", submission.ID, file.Filename, err)
+			}
+			job.FilesDone++
+			if time.Since(saved) >= archiveProgressInterval {
+				saved = time.Now()
+				if err := w.repo.UpdateArchiveProgress(job, saved.Add(w.lease)); err != nil {
+					log.Printf("Failed to save the progress of archive job %s: %v", job.ID, err)
+				}
+			}
+		}
+	}
+	return archive.Close()
+}
+
+// copyFile streams a stored file into the archive as name
+func (w *ArchiveWorker) copyFile(ctx context.Context, archive *zip.Writer, submission *core.Submission, file *core.SubmissionFile, name string) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: submission.Timestamp})
+	if err != nil {
+		return err
+	}
+	content, err := w.storage.DownloadFile(ctx, storedPath(w.storage, submission, file))
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	_, err = io.Copy(entry, content)
+	return err
+}
+
+// folders names the folder of each submission after the student who made
+// it, as <enrollment number>_<full name> from the identity service, sorted
+// so the folders come out in that order. Names two submissions share are
+// told apart by newArchiveNames.
+func (w *ArchiveWorker) folders(ctx context.Context, submissions []*core.Submission) (map[uuid.UUID]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, submission := range submissions {
+		if !seen[submission.StudentID] {
+			seen[submission.StudentID] = true
+			ids = append(ids, submission.StudentID)
+		}
+	}
+	users := make(map[string]*clients.User, len(ids))
+	for start := 0; start < len(ids); start += maxUserBatch {
+		batch, err := w.users.GetUsers(ctx, ids[start:min(start+maxUserBatch, len(ids))])
+		if err != nil {
+			return nil, fmt.Errorf("looking up the students' names: %w", err)
+		}
+		for i := range batch {
+			users[batch[i].ID] = &batch[i]
+		}
+	}
+
+	base := make(map[uuid.UUID]string, len(submissions))
+	for _, submission := range submissions {
+		base[submission.ID] = archiveFolder(users[submission.StudentID], submission.StudentID)
+	}
+	sort.SliceStable(submissions, func(i, j int) bool {
+		return base[submissions[i].ID] < base[submissions[j].ID]
+	})
+
+	names := newArchiveNames()
+	folders := make(map[uuid.UUID]string, len(submissions))
+	for _, submission := range submissions {
+		folders[submission.ID] = names.folder(base[submission.ID])
+	}
+	return folders, nil
+}
+
+// archiveFolder is <enrollment number>_<full name> of the student, leaving
+// out what identity does not have, or the student ID if it has neither
+func archiveFolder(user *clients.User, studentID string) string {
+	var parts []string
+	if user != nil {
+		if user.StudentProfile != nil {
+			parts = append(parts, archiveSegment(user.StudentProfile.EnrollmentNumber))
+		}
+		parts = append(parts, archiveSegment(user.FullName))
+	}
+	parts = slices.DeleteFunc(parts, func(part string) bool { return part == "" })
+	if len(parts) == 0 {
+		return archiveSegment(studentID)
+	}
+	return strings.Join(parts, "_")
+}
+
+// archiveSegment makes s safe as one part of an entry name: no slashes,
+// colons or control characters, nor leading or trailing spaces
+func archiveSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// archiveNames hands out entry names no other entry has, comparing without
+// case as unzipping on some systems would. A taken name gets " (2)",
+// " (3)" and so on, before a file's extension.
+type archiveNames struct {
+	taken map[string]bool
+}
+
+func newArchiveNames() *archiveNames {
+	return &archiveNames{taken: make(map[string]bool)}
+}
+
+// folder returns a folder name based on name
+func (n *archiveNames) folder(name string) string {
+	return n.unique(name, "")
+}
+
+// file returns the entry name of a file a student uploaded as filename,
+// inside folder. Directories in filename are kept, but cannot lead out of
+// the folder.
+func (n *archiveNames) file(folder, filename string) string {
+	segments := strings.Split(path.Clean("/"+strings.ReplaceAll(filename, "\\", "/")), "/")
+	kept := segments[:0]
+	for _, segment := range segments {
+		if segment = archiveSegment(segment); segment != "" {
+			kept = append(kept, segment)
+		}
+	}
+	name := strings.Join(kept, "/")
+	if name == "" {
+		name = "file"
+	}
+	ext := path.Ext(name)
+	return n.unique(folder+"/"+strings.TrimSuffix(name, ext), ext)
+}
+
+func (n *archiveNames) unique(base, ext string) string {
+	name := base + ext
+	for i := 2; n.taken[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	n.taken[strings.ToLower(name)] = true
+	return name
+}
+
+// storedPath is where a clean submission file is in the bucket
+func storedPath(files storage.StorageClient, submission *core.Submission, file *core.SubmissionFile) string {
+	if file.StoragePath != "" {
+		return file.StoragePath
+	}
+	// Files stored before scanning existed are where they were uploaded
+	return files.SubmissionPath(submission.AssignmentID, uuid.MustParse(submission.StudentID), submission.ID, file.Filename)
+}
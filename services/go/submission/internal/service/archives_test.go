@@ -0,0 +1,271 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/storage"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// classDirectory is a directory that also knows the classes
+type classDirectory struct {
+	directory
+	classes []clients.Class
+}
+
+func (d classDirectory) GetClasses(context.Context, []string) ([]clients.Class, error) {
+	return d.classes, nil
+}
+
+// generatedStorage serves every file as size bytes of random data, and
+// counts the bytes uploaded to it without keeping them
+type generatedStorage struct {
+	*memoryStorage
+	size     int64
+	uploaded int64
+}
+
+func (g *generatedStorage) DownloadFile(_ context.Context, path string) (io.ReadCloser, error) {
+	return io.NopCloser(io.LimitReader(rand.New(rand.NewSource(int64(len(path)))), g.size)), nil
+}
+
+func (g *generatedStorage) UploadStream(_ context.Context, _, _ string, body io.Reader) error {
+	n, err := io.Copy(io.Discard, body)
+	g.uploaded += n
+	return err
+}
+
+// archiveFixture is an assignment of class-1, which instructor-1 teaches,
+// with an archive worker over its submissions
+type archiveFixture struct {
+	svc          SubmissionService
+	db           *gorm.DB
+	repo         repository.Repository
+	worker       *ArchiveWorker
+	assignmentID uuid.UUID
+}
+
+func newArchiveFixture(t *testing.T, users directory, files storage.StorageClient) *archiveFixture {
+	t.Helper()
+	assignmentID := uuid.New()
+	assignments := &fakeAssignments{settings: map[uuid.UUID]*core.AssignmentSettings{
+		assignmentID: {ID: assignmentID, CourseID: "class-1"},
+	}}
+	dir := classDirectory{directory: users, classes: []clients.Class{{ID: "class-1", InstructorIDs: []string{"instructor-1"}}}}
+	db := newTestDB(t, &core.Submission{}, &core.SubmissionFile{}, &core.SubmissionMember{}, &core.ArchiveJob{})
+	repo := repository.NewRepository(db)
+	return &archiveFixture{
+		svc:          NewSubmissionService(repo, files, assignments, dir, testGracePeriod, nil, time.Hour, nil, time.Minute),
+		db:           db,
+		repo:         repo,
+		worker:       NewArchiveWorker(repo, files, dir, time.Minute, time.Second),
+		assignmentID: assignmentID,
+	}
+}
+
+// submit stores a submission by studentID made at, with files of the given
+// names and contents stored under their own paths
+func (f *archiveFixture) submit(t *testing.T, files storage.StorageClient, studentID string, status core.SubmissionStatus, at time.Time, contents ...[2]string) {
+	t.Helper()
+	submission := &core.Submission{AssignmentID: f.assignmentID, StudentID: studentID, Status: status, Timestamp: at}
+	if err := f.db.Create(submission).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range contents {
+		path := "clean/" + submission.ID.String() + "/" + string(rune('a'+i))
+		if err := f.db.Create(&core.SubmissionFile{SubmissionID: submission.ID, Filename: c[0], StoragePath: path}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := files.UploadFile(context.Background(), path, []byte(c[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// run has instructor-1 queue an archive and the worker build it, returning
+// the job as they would fetch it
+func (f *archiveFixture) run(t *testing.T) *core.ArchiveJob {
+	t.Helper()
+	instructor := ArchiveRequester{UserID: "instructor-1"}
+	job, err := f.svc.StartArchiveJob(context.Background(), f.assignmentID, 0, instructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := f.repo.ClaimArchiveJob(time.Now(), time.Minute)
+	if err != nil || claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("claimed %v, %v; want job %s", claimed, err, job.ID)
+	}
+	f.worker.Process(context.Background(), claimed)
+	stored, err := f.svc.GetArchiveJob(context.Background(), f.assignmentID, job.ID, instructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+// archiveEntries returns the names of the entries of the job's archive in
+// order, and their contents by name
+func archiveEntries(t *testing.T, files storage.StorageClient, job *core.ArchiveJob) ([]string, map[string]string) {
+	t.Helper()
+	stored, err := files.DownloadFile(context.Background(), storage.ArchivePath(job.AssignmentID, job.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(archive.File))
+	contents := make(map[string]string, len(archive.File))
+	for _, entry := range archive.File {
+		r, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, entry.Name)
+		contents[entry.Name] = string(content)
+	}
+	return names, contents
+}
+
+func TestArchiveTellsApartStudentsWhoShareAName(t *testing.T) {
+	files := newMemoryStorage()
+	users := directory{
+		"s1": {ID: "s1", FullName: "Ada Lovelace", StudentProfile: &clients.StudentProfile{EnrollmentNumber: "E1001"}},
+		"s2": {ID: "s2", FullName: "Ada Lovelace", StudentProfile: &clients.StudentProfile{EnrollmentNumber: "E1002"}},
+		"s3": {ID: "s3", FullName: "Ada Lovelace"},
+		"s4": {ID: "s4", FullName: "Ada Lovelace"},
+		"s6": {ID: "s6", FullName: "Ben Okri", StudentProfile: &clients.StudentProfile{EnrollmentNumber: "E2001"}},
+		"s7": {ID: "s7", FullName: "ben okri", StudentProfile: &clients.StudentProfile{EnrollmentNumber: "e2001"}},
+	}
+	f := newArchiveFixture(t, users, files)
+	t0 := time.Now().Add(-time.Hour)
+	f.submit(t, files, "s1", core.SubmissionStatusPending, t0, [2]string{"Main.py", "s1 old"})
+	f.submit(t, files, "s1", core.SubmissionStatusPending, t0.Add(6*time.Minute),
+		[2]string{"Main.py", "s1 upper"}, [2]string{"main.py", "s1 lower"}, [2]string{"../../etc/passwd", "s1 escaped"})
+	f.submit(t, files, "s2", core.SubmissionStatusPending, t0.Add(5*time.Minute), [2]string{"main.py", "s2"})
+	f.submit(t, files, "s3", core.SubmissionStatusAccepted, t0.Add(4*time.Minute), [2]string{"main.py", "s3"})
+	f.submit(t, files, "s4", core.SubmissionStatusPending, t0.Add(3*time.Minute), [2]string{"main.py", "s4"})
+	f.submit(t, files, "s5", core.SubmissionStatusScanning, t0.Add(7*time.Minute), [2]string{"main.py", "s5"})
+	f.submit(t, files, "s6", core.SubmissionStatusPending, t0.Add(2*time.Minute), [2]string{"main.py", "s6"})
+	f.submit(t, files, "s7", core.SubmissionStatusPending, t0.Add(time.Minute), [2]string{"main.py", "s7"})
+
+	job := f.run(t)
+	if job.Status != core.ArchiveJobCompleted {
+		t.Fatalf("job %s: %s", job.Status, job.Error)
+	}
+	if job.SubmissionCount != 6 || job.SkippedCount != 1 || job.FileCount != 8 || job.FilesDone != 8 {
+		t.Errorf("job counted %d submissions, %d skipped, %d of %d files; want 6, 1, 8 of 8",
+			job.SubmissionCount, job.SkippedCount, job.FilesDone, job.FileCount)
+	}
+	if job.DownloadURL == "" || job.DownloadURLExpiresAt == nil {
+		t.Errorf("completed job has no download link")
+	}
+
+	// Students without an enrollment number to tell them apart get a number,
+	// as do names that differ only in case, which unzip to one folder on
+	// some systems; so does a file of the same name, and no file leaves its
+	// student's folder
+	names, contents := archiveEntries(t, files, job)
+	want := []struct{ name, content string }{
+		{"Ada Lovelace/main.py", "s3"},
+		{"Ada Lovelace (2)/main.py", "s4"},
+		{"E1001_Ada Lovelace/Main.py", "s1 upper"},
+		{"E1001_Ada Lovelace/main (2).py", "s1 lower"},
+		{"E1001_Ada Lovelace/etc/passwd", "s1 escaped"},
+		{"E1002_Ada Lovelace/main.py", "s2"},
+		{"E2001_Ben Okri/main.py", "s6"},
+		{"e2001_ben okri (2)/main.py", "s7"},
+	}
+	if len(names) != len(want) {
+		t.Fatalf("archive holds %v, want %d entries", names, len(want))
+	}
+	for i, w := range want {
+		if names[i] != w.name || contents[w.name] != w.content {
+			t.Errorf("entry %d is %s holding %q, want %s holding %q", i, names[i], contents[names[i]], w.name, w.content)
+		}
+	}
+}
+
+func TestArchiveStreamsFilesWithoutHoldingThem(t *testing.T) {
+	const size = 8 << 20
+	files := &generatedStorage{memoryStorage: newMemoryStorage(), size: size}
+	f := newArchiveFixture(t, directory{}, files)
+	for i := 0; i < 4; i++ {
+		f.submit(t, files, uuid.NewString(), core.SubmissionStatusPending, time.Now().Add(-time.Duration(i)*time.Minute), [2]string{"big.bin", ""})
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	job := f.run(t)
+	runtime.ReadMemStats(&after)
+
+	if job.Status != core.ArchiveJobCompleted || job.FilesDone != 4 {
+		t.Fatalf("job %s with %d files done: %s", job.Status, job.FilesDone, job.Error)
+	}
+	// Random data does not compress, so the whole of each file went through
+	if files.uploaded < 4*size {
+		t.Errorf("uploaded %d bytes, want at least the %d of the files", files.uploaded, 4*size)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size {
+		t.Errorf("archiving four %d byte files allocated %d bytes, more than one file", size, allocated)
+	}
+}
+
+func TestArchiveIsForTheClassesInstructorsAndAdmins(t *testing.T) {
+	f := newArchiveFixture(t, directory{}, newMemoryStorage())
+	ctx := context.Background()
+	instructor := ArchiveRequester{UserID: "instructor-1"}
+	admin := ArchiveRequester{UserID: "admin-1", All: true}
+
+	if _, err := f.svc.StartArchiveJob(ctx, f.assignmentID, 0, ArchiveRequester{UserID: "instructor-2"}); !errors.Is(err, ErrArchiveForbidden) {
+		t.Errorf("another class's instructor = %v, want ErrArchiveForbidden", err)
+	}
+	if _, err := f.svc.StartArchiveJob(ctx, f.assignmentID, -1, instructor); !errors.Is(err, ErrInvalidArchiveJob) {
+		t.Errorf("attempt -1 = %v, want ErrInvalidArchiveJob", err)
+	}
+
+	job, err := f.svc.StartArchiveJob(ctx, f.assignmentID, 0, admin)
+	if err != nil {
+		t.Fatalf("admin = %v", err)
+	}
+	if _, err := f.svc.StartArchiveJob(ctx, f.assignmentID, 0, instructor); !errors.Is(err, ErrArchiveJobActive) {
+		t.Errorf("the same archive again while queued = %v, want ErrArchiveJobActive", err)
+	}
+	if _, err := f.svc.StartArchiveJob(ctx, f.assignmentID, 2, instructor); err != nil {
+		t.Errorf("the class's instructor archiving attempt 2 = %v", err)
+	}
+
+	if _, err := f.svc.GetArchiveJob(ctx, f.assignmentID, job.ID, ArchiveRequester{UserID: "student-1"}); !errors.Is(err, ErrArchiveForbidden) {
+		t.Errorf("a student fetching the job = %v, want ErrArchiveForbidden", err)
+	}
+	fetched, err := f.svc.GetArchiveJob(ctx, f.assignmentID, job.ID, instructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.Status != core.ArchiveJobQueued || fetched.DownloadURL != "" {
+		t.Errorf("queued job fetched as %s with link %q", fetched.Status, fetched.DownloadURL)
+	}
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/assignment"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidGrant = errors.New("invalid attempt grant")
+
+// AttemptLimitError means the student or group has no submission attempts left
+type AttemptLimitError = repository.AttemptLimitError
+
+// attemptsAllowed is how many submissions the students may make to the
+// assignment between them: its limit plus every attempt granted to any of
+// them, or 0 when it has no limit
+func (s *submissionService) attemptsAllowed(settings *core.AssignmentSettings, studentIDs []string) (allowed, extra int, err error) {
+	extra, err = s.repo.ExtraAttempts(settings.ID, studentIDs)
+	if err != nil {
+		return 0, 0, err
+	}
+	if settings.TotalAttempts <= 0 {
+		return 0, extra, nil
+	}
+	return settings.TotalAttempts + extra, extra, nil
+}
+
+// checkAttempts rejects a submission once its student or group has used up
+// its attempts, before any files are uploaded for it. The limit is enforced
+// again when the submission is stored. It returns the number allowed, 0
+// meaning unlimited.
+func (s *submissionService) checkAttempts(settings *core.AssignmentSettings, submission *core.Submission) (int, error) {
+	allowed, _, err := s.attemptsAllowed(settings, submission.StudentIDs())
+	if err != nil || allowed == 0 {
+		return allowed, err
+	}
+	used, err := s.repo.CountAttempts(submission.AssignmentID, submission.StudentID, submission.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	if used >= allowed {
+		return 0, &AttemptLimitError{Used: used, Allowed: allowed}
+	}
+	return allowed, nil
+}
+
+// AttemptHistory lists every submission of the student, or of their group
+// on a group assignment, with their grades and how many attempts are left
+func (s *submissionService) AttemptHistory(ctx context.Context, assignmentID uuid.UUID, studentID string) (*core.AttemptHistory, error) {
+	settings, err := s.assignments.GetSettings(ctx, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	studentIDs := []string{studentID}
+	var groupID *uuid.UUID
+	if settings.EnableGroupSubmissions {
+		group, err := s.assignments.GetGroup(ctx, assignmentID, studentID)
+		if err != nil && !errors.Is(err, assignment.ErrGroupNotFound) {
+			return nil, err
+		}
+		if group != nil {
+			groupID = &group.ID
+			studentIDs = studentIDs[:0]
+			for _, m := range group.Members {
+				studentIDs = append(studentIDs, m.StudentID)
+			}
+		}
+	}
+
+	attempts, err := s.repo.ListAttempts(assignmentID, studentID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	allowed, extra, err := s.attemptsAllowed(settings, studentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &core.AttemptHistory{
+		AttemptsUsed:  len(attempts),
+		ExtraAttempts: extra,
+		Attempts:      attempts,
+	}
+	if allowed > 0 {
+		history.AttemptsAllowed = &allowed
+	}
+	return history, nil
+}
+
+// GrantAttempts gives the student extra submission attempts on the
+// assignment. Grants add up and are kept with who made them.
+func (s *submissionService) GrantAttempts(ctx context.Context, grant *core.AttemptGrant) (*core.AttemptHistory, error) {
+	grant.StudentID = strings.TrimSpace(grant.StudentID)
+	grant.Reason = strings.TrimSpace(grant.Reason)
+	if grant.StudentID == "" {
+		return nil, fmt.Errorf("%w: studentId is required", ErrInvalidGrant)
+	}
+	if grant.ExtraAttempts <= 0 {
+		return nil, fmt.Errorf("%w: extraAttempts must be greater than 0", ErrInvalidGrant)
+	}
+	if _, err := s.assignments.GetSettings(ctx, grant.AssignmentID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateAttemptGrant(grant); err != nil {
+		return nil, err
+	}
+	return s.AttemptHistory(ctx, grant.AssignmentID, grant.StudentID)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/google/uuid"
+)
+
+// Attempts are numbered under a Postgres advisory lock. The one test
+// connection already serialises them, so the functions do nothing here.
+func init() {
+	gosqlite.MustRegisterScalarFunction("hashtext", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return int64(0), nil
+	})
+	gosqlite.MustRegisterScalarFunction("pg_advisory_xact_lock", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return nil, nil
+	})
+}
+
+func TestAttemptLimit(t *testing.T) {
+	assignmentID := uuid.New()
+	assignments := &fakeAssignments{settings: map[uuid.UUID]*core.AssignmentSettings{
+		assignmentID: {ID: assignmentID, TotalAttempts: 2},
+	}}
+	svc, _ := newTestService(t, assignments)
+	ctx := context.Background()
+	submit := func(student string) (*core.Submission, error) {
+		submission := &core.Submission{AssignmentID: assignmentID, StudentID: student}
+		return submission, svc.Submit(ctx, submission, nil)
+	}
+
+	for want := 1; want <= 2; want++ {
+		submission, err := submit("ada")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if submission.AttemptNumber != want {
+			t.Errorf("attempt number = %d, want %d", submission.AttemptNumber, want)
+		}
+	}
+	var limitErr *AttemptLimitError
+	if _, err := submit("ada"); !errors.As(err, &limitErr) || limitErr.Allowed != 2 {
+		t.Fatalf("third submission = %v, want an AttemptLimitError", err)
+	}
+	// Another student's attempts are their own
+	if submission, err := submit("bob"); err != nil || submission.AttemptNumber != 1 {
+		t.Fatalf("bob's first submission = %+v, %v", submission, err)
+	}
+
+	history, err := svc.GrantAttempts(ctx, &core.AttemptGrant{AssignmentID: assignmentID, StudentID: " ada ", ExtraAttempts: 1, GrantedBy: "teacher-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.AttemptsUsed != 2 || history.AttemptsAllowed == nil || *history.AttemptsAllowed != 3 || history.ExtraAttempts != 1 {
+		t.Errorf("history after the grant = %+v", history)
+	}
+	if submission, err := submit("ada"); err != nil || submission.AttemptNumber != 3 {
+		t.Fatalf("submission with a granted attempt = %+v, %v", submission, err)
+	}
+
+	// Grading one attempt leaves out those who never made it
+	rows, err := svc.GradingList(ctx, assignmentID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].SubmittedBy != "ada" || rows[0].AttemptNumber != 3 {
+		t.Errorf("grading list of attempt 3 = %+v, want only ada's", rows)
+	}
+
+	if _, err := svc.GrantAttempts(ctx, &core.AttemptGrant{AssignmentID: assignmentID, StudentID: "ada", ExtraAttempts: 0}); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("granting no attempts = %v, want ErrInvalidGrant", err)
+	}
+}
+
+func TestGroupSharesAttempts(t *testing.T) {
+	assignmentID, _, assignments := newGroupAssignment()
+	assignments.settings[assignmentID].TotalAttempts = 1
+	svc, _ := newTestService(t, assignments)
+	ctx := context.Background()
+
+	if err := svc.Submit(ctx, &core.Submission{AssignmentID: assignmentID, StudentID: "ada"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var limitErr *AttemptLimitError
+	if err := svc.Submit(ctx, &core.Submission{AssignmentID: assignmentID, StudentID: "bob"}, nil); !errors.As(err, &limitErr) {
+		t.Fatalf("second member's submission = %v, want the group's one attempt used", err)
+	}
+
+	// A grant to either member counts for the group
+	if _, err := svc.GrantAttempts(ctx, &core.AttemptGrant{AssignmentID: assignmentID, StudentID: "bob", ExtraAttempts: 1, GrantedBy: "teacher-1"}); err != nil {
+		t.Fatal(err)
+	}
+	history, err := svc.AttemptHistory(ctx, assignmentID, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.AttemptsUsed != 1 || *history.AttemptsAllowed != 2 {
+		t.Errorf("ada's history = %+v, want 1 of 2 attempts used", history)
+	}
+	if err := svc.Submit(ctx, &core.Submission{AssignmentID: assignmentID, StudentID: "ada"}, nil); err != nil {
+		t.Errorf("submission with bob's grant = %v", err)
+	}
+}
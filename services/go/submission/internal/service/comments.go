@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+// MaxCommentLength is the longest comment body accepted, in characters
+const MaxCommentLength = 10000
+
+// AddComment posts a comment on a submission. Only private callers, the
+// staff allowed to see instructors_only comments, may post them. Everyone
+// else in the thread who can see the comment is notified.
+func (s *submissionService) AddComment(id uuid.UUID, authorID string, private bool, body string, visibility core.CommentVisibility) (*core.SubmissionComment, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("%w: body is required", ErrInvalidComment)
+	}
+	if utf8.RuneCountInString(body) > MaxCommentLength {
+		return nil, fmt.Errorf("%w: body must be at most %d characters", ErrInvalidComment, MaxCommentLength)
+	}
+	switch visibility {
+	case "":
+		visibility = core.CommentVisibilityEveryone
+	case core.CommentVisibilityEveryone:
+	case core.CommentVisibilityInstructorsOnly:
+		if !private {
+			return nil, fmt.Errorf("%w: only staff can post %s comments", ErrCommentForbidden, visibility)
+		}
+	default:
+		return nil, fmt.Errorf("%w: visibility must be %s or %s", ErrInvalidComment, core.CommentVisibilityEveryone, core.CommentVisibilityInstructorsOnly)
+	}
+
+	submission, err := s.repo.GetSubmissionByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &core.SubmissionComment{
+		SubmissionID: id,
+		AuthorUserID: authorID,
+		Body:         body,
+		Visibility:   visibility,
+	}
+	if err := s.repo.CreateComment(comment); err != nil {
+		return nil, err
+	}
+
+	s.notifyComment(submission, comment)
+	return comment, nil
+}
+
+// notifyComment tells the student and everyone who graded or commented on the
+// submission about a new comment, except its author and, for instructors_only
+// comments, the student
+func (s *submissionService) notifyComment(submission *core.Submission, comment *core.SubmissionComment) {
+	if s.notifier == nil {
+		return
+	}
+	participants, err := s.repo.ListParticipants(submission.ID)
+	if err != nil {
+		log.Printf("Failed to list participants of submission %s for comment notifications: %v", submission.ID, err)
+		return
+	}
+
+	recipients := append(participants, submission.StudentID)
+	slices.Sort(recipients)
+	for _, recipient := range slices.Compact(recipients) {
+		if recipient == "" || recipient == comment.AuthorUserID {
+			continue
+		}
+		if recipient == submission.StudentID && comment.Visibility == core.CommentVisibilityInstructorsOnly {
+			continue
+		}
+		s.notifier.CommentAdded(submission.ID, recipient)
+	}
+}
+
+// ListComments returns the thread of a submission, oldest first.
+// instructors_only comments are only included for private callers.
+func (s *submissionService) ListComments(id uuid.UUID, private bool) ([]core.SubmissionComment, error) {
+	if _, err := s.repo.GetSubmissionByID(id); err != nil {
+		return nil, err
+	}
+	visibilities := []core.CommentVisibility{core.CommentVisibilityEveryone}
+	if private {
+		visibilities = append(visibilities, core.CommentVisibilityInstructorsOnly)
+	}
+	return s.repo.ListComments(id, visibilities)
+}
+
+// DeleteComment removes a comment. Its author can do so within the delete
+// window, moderators at any time.
+func (s *submissionService) DeleteComment(id, commentID uuid.UUID, userID string, moderator bool) error {
+	comment, err := s.repo.GetComment(id, commentID)
+	if err != nil {
+		return err
+	}
+	if !moderator {
+		if comment.AuthorUserID != userID {
+			return fmt.Errorf("%w: only the author can delete this comment", ErrCommentForbidden)
+		}
+		if time.Since(comment.CreatedAt) > s.commentDeleteWindow {
+			return fmt.Errorf("%w: comments can only be deleted within %s of posting", ErrCommentForbidden, s.commentDeleteWindow)
+		}
+	}
+	return s.repo.DeleteComment(commentID)
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/notify"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/google/uuid"
+)
+
+// digestRecorder records the comment digests a notifier sends
+type digestRecorder struct {
+	mu      sync.Mutex
+	digests map[string]int // comment count by recipient
+	sent    chan struct{}
+}
+
+func (r *digestRecorder) SendCommentDigest(_ context.Context, recipientID string, _ uuid.UUID, count int) error {
+	r.mu.Lock()
+	r.digests[recipientID] += count
+	r.mu.Unlock()
+	r.sent <- struct{}{}
+	return nil
+}
+
+func (r *digestRecorder) SendSubmissionRejected(context.Context, string, uuid.UUID, string) error {
+	return nil
+}
+
+func TestCommentVisibility(t *testing.T) {
+	svc, db := newTestService(t, &fakeAssignments{})
+	submission := createSubmission(t, db, uuid.New(), "student-1")
+
+	if _, err := svc.AddComment(submission.ID, "student-1", false, "Why did I lose marks?", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AddComment(submission.ID, "grader-1", true, "Check with the TA", core.CommentVisibilityInstructorsOnly); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.AddComment(submission.ID, "student-1", false, "Hidden?", core.CommentVisibilityInstructorsOnly); !errors.Is(err, ErrCommentForbidden) {
+		t.Errorf("student posting an instructors_only comment: got %v, want ErrCommentForbidden", err)
+	}
+	for _, body := range []string{"   ", strings.Repeat("a", MaxCommentLength+1)} {
+		if _, err := svc.AddComment(submission.ID, "student-1", false, body, ""); !errors.Is(err, ErrInvalidComment) {
+			t.Errorf("comment of %d characters: got %v, want ErrInvalidComment", len(body), err)
+		}
+	}
+
+	student, err := svc.ListComments(submission.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staff, err := svc.ListComments(submission.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(student) != 1 || len(staff) != 2 {
+		t.Errorf("student sees %d comments and staff %d, want 1 and 2", len(student), len(staff))
+	}
+}
+
+func TestDeleteCommentWindow(t *testing.T) {
+	svc, db := newTestService(t, &fakeAssignments{})
+	submission := createSubmission(t, db, uuid.New(), "student-1")
+	recent, err := svc.AddComment(submission.ID, "student-1", false, "Typo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := svc.AddComment(submission.ID, "student-1", false, "Old", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(old).Update("created_at", time.Now().Add(-2*time.Hour))
+
+	if err := svc.DeleteComment(submission.ID, recent.ID, "student-2", false); !errors.Is(err, ErrCommentForbidden) {
+		t.Errorf("deleting someone else's comment: got %v, want ErrCommentForbidden", err)
+	}
+	if err := svc.DeleteComment(submission.ID, old.ID, "student-1", false); !errors.Is(err, ErrCommentForbidden) {
+		t.Errorf("deleting after the window: got %v, want ErrCommentForbidden", err)
+	}
+	if err := svc.DeleteComment(submission.ID, recent.ID, "student-1", false); err != nil {
+		t.Errorf("author deleting within the window: %v", err)
+	}
+	if err := svc.DeleteComment(submission.ID, old.ID, "moderator-1", true); err != nil {
+		t.Errorf("moderator deleting an old comment: %v", err)
+	}
+	if left, _ := svc.ListComments(submission.ID, true); len(left) != 0 {
+		t.Errorf("%d comments left, want none", len(left))
+	}
+}
+
+func TestCommentNotificationsAreBatched(t *testing.T) {
+	_, db := newTestService(t, &fakeAssignments{})
+	recorder := &digestRecorder{digests: map[string]int{}, sent: make(chan struct{}, 10)}
+	svc := NewSubmissionService(repository.NewRepository(db), nil, &fakeAssignments{}, nil, testGracePeriod,
+		notify.NewCommentNotifier(recorder, 50*time.Millisecond), time.Hour, nil, 0)
+	submission := createSubmission(t, db, uuid.New(), "student-1")
+	if err := db.Create(&core.GradeEvent{SubmissionID: submission.ID, GraderUserID: "grader-1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		author     string
+		private    bool
+		visibility core.CommentVisibility
+	}{
+		{"student-1", false, ""},
+		{"grader-1", true, ""},
+		{"student-1", false, ""},
+		{"ta-1", true, core.CommentVisibilityInstructorsOnly},
+	} {
+		if _, err := svc.AddComment(submission.ID, c.author, c.private, "comment", c.visibility); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One digest per recipient once the batch delay has passed
+	want := map[string]int{"student-1": 1, "grader-1": 3}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-recorder.sent:
+		case <-time.After(5 * time.Second):
+			t.Fatal("digests were not sent")
+		}
+	}
+	select {
+	case <-recorder.sent:
+		t.Error("more than one digest per recipient")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	var recipients []string
+	for recipient, count := range recorder.digests {
+		recipients = append(recipients, recipient)
+		if count != want[recipient] {
+			t.Errorf("%s was told about %d comments, want %d", recipient, count, want[recipient])
+		}
+	}
+	sort.Strings(recipients)
+	if strings.Join(recipients, ",") != "grader-1,student-1" {
+		t.Errorf("digests went to %v, want the grader and the student", recipients)
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/userevents"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/google/uuid"
+)
+
+func TestReleasedGradeChangesNeedAReason(t *testing.T) {
+	assignmentID := uuid.New()
+	criterion := core.RubricCriterion{ID: uuid.New(), Name: "Correctness", MaxPoints: 10}
+	svc, db := newTestService(t, &fakeAssignments{rubrics: map[uuid.UUID]*core.Rubric{
+		assignmentID: {AssignmentID: assignmentID, Criteria: []core.RubricCriterion{criterion}},
+	}})
+	submission := createSubmission(t, db, assignmentID, "student-1")
+	ctx := context.Background()
+	score := func(points int) []core.CriterionScore {
+		return []core.CriterionScore{{CriterionID: criterion.ID, Points: points}}
+	}
+
+	// Before the release the grade can be changed freely
+	if _, err := svc.GradeSubmission(ctx, submission.ID, "grader-1", "", score(6)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GradeSubmission(ctx, submission.ID, "grader-1", "", score(7)); err != nil {
+		t.Fatal(err)
+	}
+	released, err := svc.ReleaseGrade(ctx, submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released.ReleasedAt == nil {
+		t.Fatal("released grade has no release time")
+	}
+
+	if _, err := svc.GradeSubmission(ctx, submission.ID, "grader-2", "  ", score(9)); !errors.Is(err, ErrReasonRequired) {
+		t.Fatalf("changing a released grade without a reason: got %v, want ErrReasonRequired", err)
+	}
+	grade, err := svc.GradeSubmission(ctx, submission.ID, "grader-2", "Regrade request upheld", score(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grade.Total == nil || *grade.Total != 9 || grade.ChangedBy != "grader-2" {
+		t.Fatalf("after the regrade: got %+v", grade)
+	}
+	if again, err := svc.ReleaseGrade(ctx, submission.ID); err != nil || !again.ReleasedAt.Equal(*released.ReleasedAt) {
+		t.Errorf("releasing again moved the release time: %v, %v", again.ReleasedAt, err)
+	}
+
+	history, err := svc.GetGradeHistory(submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("history has %d events, want one per accepted write", len(history))
+	}
+	latest := history[0]
+	if latest.GraderUserID != "grader-2" || latest.Reason != "Regrade request upheld" ||
+		latest.OldScore == nil || *latest.OldScore != 7 || latest.NewScore == nil || *latest.NewScore != 9 {
+		t.Errorf("latest event = %+v, want grader-2 moving 7 to 9 with the reason", latest)
+	}
+	var snapshot []core.CriterionGrade
+	if err := json.Unmarshal([]byte(latest.RubricSnapshot), &snapshot); err != nil || len(snapshot) != 1 || *snapshot[0].Points != 9 {
+		t.Errorf("latest snapshot = %s, %v", latest.RubricSnapshot, err)
+	}
+	if first := history[2]; first.OldScore != nil || *first.NewScore != 6 {
+		t.Errorf("first event = %+v, want no old score and 6", first)
+	}
+}
+
+// publishedEvents is an EventPublisher that keeps the events, failing for
+// the users in fail
+type publishedEvents struct {
+	users []string
+	types []string
+	fail  map[string]bool
+}
+
+func (p *publishedEvents) Publish(_ context.Context, userID, eventType string, _ interface{}) error {
+	if p.fail[userID] {
+		return errors.New("redis unavailable")
+	}
+	p.users = append(p.users, userID)
+	p.types = append(p.types, eventType)
+	return nil
+}
+
+func TestReleaseGradeNotifiesStudentOnce(t *testing.T) {
+	assignmentID := uuid.New()
+	criterion := core.RubricCriterion{ID: uuid.New(), Name: "Correctness", MaxPoints: 10}
+	assignments := &fakeAssignments{rubrics: map[uuid.UUID]*core.Rubric{
+		assignmentID: {AssignmentID: assignmentID, Criteria: []core.RubricCriterion{criterion}},
+	}}
+	_, db := newTestService(t, assignments)
+	events := &publishedEvents{}
+	svc := NewSubmissionService(repository.NewRepository(db), nil, assignments, nil, testGracePeriod, nil, 0, events, 0)
+	ctx := context.Background()
+
+	submission := createSubmission(t, db, assignmentID, "student-1")
+	if _, err := svc.GradeSubmission(ctx, submission.ID, "grader-1", "", []core.CriterionScore{{CriterionID: criterion.ID, Points: 8}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.ReleaseGrade(ctx, submission.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(events.users) != 1 || events.users[0] != "student-1" || events.types[0] != userevents.TypeGradeReleased {
+		t.Errorf("published to %v (%v), want one grade.released to student-1", events.users, events.types)
+	}
+
+	// A failed publish does not fail the release
+	other := createSubmission(t, db, assignmentID, "student-2")
+	events.fail = map[string]bool{"student-2": true}
+	if grade, err := svc.ReleaseGrade(ctx, other.ID); err != nil || grade.ReleasedAt == nil {
+		t.Errorf("release with the publisher down = %+v, %v", grade, err)
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+// maxUserBatch is how many users the identity service returns per lookup
+const maxUserBatch = 200
+
+// UserDirectory looks up users, and the classes students are in, in the
+// identity service. *clients.Identity is one.
+type UserDirectory interface {
+	GetUsers(ctx context.Context, ids []string) ([]clients.User, error)
+	GetUserEnrollments(ctx context.Context, id string) ([]clients.Enrollment, error)
+	GetClasses(ctx context.Context, ids []string) ([]clients.Class, error)
+	IsGuardianOf(ctx context.Context, guardianID, studentID string) (bool, error)
+}
+
+// GradingList returns one row per student who submitted alone and one per
+// group, each with its latest submission, or with its attempt numbered
+// attempt when that is not 0. Students and groups without that attempt are
+// left out. Group rows list every member, all of whom the grade of that
+// submission applies to.
+func (s *submissionService) GradingList(ctx context.Context, assignmentID uuid.UUID, attempt int) ([]core.GradingRow, error) {
+	submissions, err := s.repo.ListSubmissionsForGrading(assignmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]core.GradingRow, 0)
+	picked := make([]bool, 0)
+	byGroup := make(map[uuid.UUID]int)
+	byStudent := make(map[string]int)
+	// Submissions are newest first, so the first of each group or student
+	// is its latest
+	for i := range submissions {
+		submission := &submissions[i]
+		index, seen := byStudent[submission.StudentID]
+		if submission.GroupID != nil {
+			index, seen = byGroup[*submission.GroupID]
+		}
+		if !seen {
+			index = len(rows)
+			if submission.GroupID != nil {
+				byGroup[*submission.GroupID] = index
+			} else {
+				byStudent[submission.StudentID] = index
+			}
+			rows = append(rows, core.GradingRow{GroupID: submission.GroupID})
+			picked = append(picked, false)
+			for _, studentID := range submission.StudentIDs() {
+				rows[index].Members = append(rows[index].Members, core.GradingMember{StudentID: studentID})
+			}
+		}
+
+		row := &rows[index]
+		row.SubmissionCount++
+		if !picked[index] && (attempt == 0 || submission.AttemptNumber == attempt) {
+			picked[index] = true
+			row.SubmissionID = submission.ID
+			row.AttemptNumber = submission.AttemptNumber
+			row.SubmittedBy = submission.StudentID
+			row.SubmittedAt = submission.Timestamp
+			row.Status = submission.Status
+			row.Score = submission.Score
+			row.RubricScore = submission.RubricScore
+			row.FinalScore = submission.FinalScore
+			row.GradeReleasedAt = submission.GradeReleasedAt
+		}
+	}
+
+	kept := rows[:0]
+	for i, row := range rows {
+		if picked[i] {
+			kept = append(kept, row)
+		}
+	}
+
+	s.addMemberNames(ctx, kept)
+	return kept, nil
+}
+
+// addMemberNames fills in the names and emails of the students on the rows.
+// The list is still useful without them, so a failed lookup is only logged.
+func (s *submissionService) addMemberNames(ctx context.Context, rows []core.GradingRow) {
+	if s.users == nil {
+		return
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		for _, m := range row.Members {
+			if !seen[m.StudentID] {
+				seen[m.StudentID] = true
+				ids = append(ids, m.StudentID)
+			}
+		}
+	}
+
+	users := make(map[string]clients.User, len(ids))
+	for start := 0; start < len(ids); start += maxUserBatch {
+		batch, err := s.users.GetUsers(ctx, ids[start:min(start+maxUserBatch, len(ids))])
+		if err != nil {
+			log.Printf("Failed to look up the names of students on the grading list: %v", err)
+			return
+		}
+		for _, user := range batch {
+			users[user.ID] = user
+		}
+	}
+
+	for i := range rows {
+		for j := range rows[i].Members {
+			if user, ok := users[rows[i].Members[j].StudentID]; ok {
+				rows[i].Members[j].FullName = user.FullName
+				rows[i].Members[j].Email = user.Email
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+func TestPartialRubricGrading(t *testing.T) {
+	assignmentID := uuid.New()
+	correctness := core.RubricCriterion{ID: uuid.New(), Name: "Correctness", MaxPoints: 70, Order: 1}
+	style := core.RubricCriterion{ID: uuid.New(), Name: "Style", MaxPoints: 30, Order: 2}
+	assignments := &fakeAssignments{rubrics: map[uuid.UUID]*core.Rubric{
+		assignmentID: {AssignmentID: assignmentID, Criteria: []core.RubricCriterion{correctness, style}},
+	}}
+	svc, db := newTestService(t, assignments)
+	submission := createSubmission(t, db, assignmentID, "student-1")
+	ctx := context.Background()
+
+	grade, err := svc.GradeSubmission(ctx, submission.ID, "grader-1", "", []core.CriterionScore{{CriterionID: correctness.ID, Points: 60, Comment: "Misses an edge case"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grade.Complete || grade.Total != nil || grade.MaxTotal != 100 {
+		t.Fatalf("partly graded: got %+v, want no total until every criterion is graded", grade)
+	}
+	if p := grade.Criteria[0].Points; p == nil || *p != 60 || grade.Criteria[0].Comment != "Misses an edge case" {
+		t.Fatalf("partly graded: correctness %+v", grade.Criteria[0])
+	}
+	if grade.Criteria[1].Points != nil {
+		t.Fatalf("partly graded: style %+v, want no points yet", grade.Criteria[1])
+	}
+	var stored core.Submission
+	if err := db.First(&stored, "id = ?", submission.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.RubricScore != nil {
+		t.Fatalf("partly graded submission has rubric score %d", *stored.RubricScore)
+	}
+
+	if _, err := svc.GradeSubmission(ctx, submission.ID, "grader-1", "", []core.CriterionScore{{CriterionID: style.ID, Points: 25}}); err != nil {
+		t.Fatal(err)
+	}
+	grade, err = svc.GetGrade(ctx, submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !grade.Complete || grade.Total == nil || *grade.Total != 85 {
+		t.Fatalf("fully graded: got %+v, want a total of 85", grade)
+	}
+	if err := db.First(&stored, "id = ?", submission.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.RubricScore == nil || *stored.RubricScore != 85 {
+		t.Fatalf("fully graded submission has rubric score %v, want 85", stored.RubricScore)
+	}
+
+	// Regrading a criterion updates the total in place
+	if _, err := svc.GradeSubmission(ctx, submission.ID, "grader-1", "", []core.CriterionScore{{CriterionID: style.ID, Points: 30}}); err != nil {
+		t.Fatal(err)
+	}
+	if grade, err = svc.GetGrade(ctx, submission.ID); err != nil || *grade.Total != 90 {
+		t.Fatalf("regraded: got %+v, %v, want a total of 90", grade, err)
+	}
+}
+
+func TestRubricGradingRejectsInvalidScores(t *testing.T) {
+	assignmentID := uuid.New()
+	criterion := core.RubricCriterion{ID: uuid.New(), Name: "Correctness", MaxPoints: 10}
+	svc, db := newTestService(t, &fakeAssignments{rubrics: map[uuid.UUID]*core.Rubric{
+		assignmentID: {AssignmentID: assignmentID, Criteria: []core.RubricCriterion{criterion}},
+	}})
+	submission := createSubmission(t, db, assignmentID, "student-1")
+
+	for name, scores := range map[string][]core.CriterionScore{
+		"over the criterion's max": {{CriterionID: criterion.ID, Points: 11}},
+		"negative":                 {{CriterionID: criterion.ID, Points: -1}},
+		"unknown criterion":        {{CriterionID: uuid.New(), Points: 1}},
+		"scored twice":             {{CriterionID: criterion.ID, Points: 1}, {CriterionID: criterion.ID, Points: 2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := svc.GradeSubmission(context.Background(), submission.ID, "grader-1", "", scores); !errors.Is(err, ErrInvalidScore) {
+				t.Fatalf("got %v, want ErrInvalidScore", err)
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&core.CriterionScore{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("rejected scores were stored: %d", count)
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/google/uuid"
+)
+
+// directory is a UserDirectory holding fixed users
+type directory map[string]clients.User
+
+func (d directory) GetUsers(_ context.Context, ids []string) ([]clients.User, error) {
+	var users []clients.User
+	for _, id := range ids {
+		if user, ok := d[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (d directory) GetUserEnrollments(context.Context, string) ([]clients.Enrollment, error) {
+	return nil, nil
+}
+
+func (d directory) GetClasses(context.Context, []string) ([]clients.Class, error) {
+	return nil, nil
+}
+
+func (d directory) IsGuardianOf(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func newGroupAssignment() (uuid.UUID, *core.Group, *fakeAssignments) {
+	assignmentID := uuid.New()
+	group := &core.Group{ID: uuid.New(), AssignmentID: assignmentID, Name: "Team A", Members: []core.GroupMember{{StudentID: "ada"}, {StudentID: "bob"}}}
+	return assignmentID, group, &fakeAssignments{
+		settings: map[uuid.UUID]*core.AssignmentSettings{assignmentID: {ID: assignmentID, EnableGroupSubmissions: true}},
+		groups:   []*core.Group{group},
+	}
+}
+
+func TestGroupSubmission(t *testing.T) {
+	assignmentID, group, assignments := newGroupAssignment()
+	svc, _ := newTestService(t, assignments)
+	ctx := context.Background()
+
+	if err := svc.Submit(ctx, &core.Submission{AssignmentID: assignmentID, StudentID: "cy"}, nil); !errors.Is(err, ErrGroupRequired) {
+		t.Fatalf("submitting without a group = %v, want ErrGroupRequired", err)
+	}
+
+	submission := &core.Submission{AssignmentID: assignmentID, StudentID: "ada"}
+	if err := svc.Submit(ctx, submission, nil); err != nil {
+		t.Fatal(err)
+	}
+	if submission.GroupID == nil || *submission.GroupID != group.ID || !assignments.locked[group.ID] {
+		t.Errorf("submission group = %v, locked %v; want the submitter's group, locked", submission.GroupID, assignments.locked[group.ID])
+	}
+
+	// The other member sees the group's submission as theirs
+	listed, err := svc.ListSubmissions(assignmentID, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ID != submission.ID {
+		t.Fatalf("bob's submissions = %+v, want the group's", listed)
+	}
+	if ids := listed[0].StudentIDs(); len(ids) != 2 {
+		t.Errorf("members = %v, want both", ids)
+	}
+}
+
+func TestGradingListRowPerGroup(t *testing.T) {
+	assignmentID, _, assignments := newGroupAssignment()
+	db := newTestDB(t, &core.Submission{}, &core.SubmissionFile{}, &core.SubmissionMember{}, &core.CriterionScore{}, &core.GradeEvent{}, &core.AttemptGrant{})
+	users := directory{
+		"ada": {ID: "ada", FullName: "Ada Lovelace", Email: "ada@example.com"},
+		"bob": {ID: "bob", FullName: "Bob Babbage", Email: "bob@example.com"},
+	}
+	svc := NewSubmissionService(repository.NewRepository(db), nil, assignments, users, testGracePeriod, nil, 0, nil, 0)
+	ctx := context.Background()
+
+	for _, student := range []string{"ada", "bob"} {
+		if err := svc.Submit(ctx, &core.Submission{AssignmentID: assignmentID, StudentID: student}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Ungrouped, e.g. submitted before groups were turned on
+	createSubmission(t, db, assignmentID, "cy")
+
+	rows, err := svc.GradingList(ctx, assignmentID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("grading list has %d rows, want one for the group and one for cy", len(rows))
+	}
+	var groupRow *core.GradingRow
+	for i := range rows {
+		if rows[i].GroupID != nil {
+			groupRow = &rows[i]
+		}
+	}
+	if groupRow == nil || groupRow.SubmissionCount != 2 || groupRow.SubmittedBy != "bob" {
+		t.Fatalf("group row = %+v, want bob's latest of the group's 2 submissions", groupRow)
+	}
+	if len(groupRow.Members) != 2 || groupRow.Members[0].FullName != "Ada Lovelace" || groupRow.Members[1].Email != "bob@example.com" {
+		t.Errorf("group members = %+v, want both with names", groupRow.Members)
+	}
+}
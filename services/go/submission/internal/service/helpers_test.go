@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/assignment"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an in-memory SQLite database with the tables of models.
+// The models default their IDs to Postgres' gen_random_uuid(), which SQLite
+// lacks, so the default is left out of the tables and IDs are filled in
+// before each create instead.
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if strings.Contains(field.DefaultValue, "gen_random_uuid") {
+				field.HasDefaultValue, field.DefaultValue = false, ""
+			}
+		}
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Callback().Create().Before("gorm:create").Register("test:uuid", func(tx *gorm.DB) {
+		if tx.Statement.Schema == nil || tx.Statement.Schema.PrioritizedPrimaryField == nil {
+			return
+		}
+		field := tx.Statement.Schema.PrioritizedPrimaryField
+		if field.FieldType != reflect.TypeOf(uuid.UUID{}) {
+			return
+		}
+		fill := func(rv reflect.Value) {
+			if _, zero := field.ValueOf(tx.Statement.Context, rv); zero {
+				_ = field.Set(tx.Statement.Context, rv, uuid.New())
+			}
+		}
+		switch rv := tx.Statement.ReflectValue; rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				fill(reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			fill(rv)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// fakeAssignments stands in for the assignment service
+type fakeAssignments struct {
+	assignment.Client
+	rubrics  map[uuid.UUID]*core.Rubric
+	settings map[uuid.UUID]*core.AssignmentSettings
+	attempts map[string]*core.Attempt // by assignment ID and student ID
+	groups   []*core.Group
+	locked   map[uuid.UUID]bool
+	// deadlines are by assignment ID and student ID; without one a student
+	// has no late penalty
+	deadlines map[string]*core.StudentDeadline
+	classes   map[string][]core.ClassAssignment // by class ID
+}
+
+func (f *fakeAssignments) GetRubric(_ context.Context, assignmentID uuid.UUID) (*core.Rubric, error) {
+	rubric, ok := f.rubrics[assignmentID]
+	if !ok {
+		return nil, assignment.ErrRubricNotFound
+	}
+	return rubric, nil
+}
+
+func (f *fakeAssignments) GetSettings(_ context.Context, assignmentID uuid.UUID) (*core.AssignmentSettings, error) {
+	settings, ok := f.settings[assignmentID]
+	if !ok {
+		return nil, assignment.ErrAssignmentNotFound
+	}
+	return settings, nil
+}
+
+func (f *fakeAssignments) GetAttempt(_ context.Context, assignmentID uuid.UUID, studentID string) (*core.Attempt, error) {
+	attempt, ok := f.attempts[assignmentID.String()+"/"+studentID]
+	if !ok {
+		return nil, assignment.ErrAttemptNotFound
+	}
+	return attempt, nil
+}
+
+func (f *fakeAssignments) GetStudentDeadline(_ context.Context, assignmentID uuid.UUID, studentID string) (*core.StudentDeadline, error) {
+	deadline, ok := f.deadlines[assignmentID.String()+"/"+studentID]
+	if !ok {
+		return &core.StudentDeadline{AssignmentID: assignmentID, StudentID: studentID, LatePenalty: core.LatePenaltyPolicy{Type: core.LatePenaltyNone}}, nil
+	}
+	return deadline, nil
+}
+
+func (f *fakeAssignments) ListClassAssignments(_ context.Context, classID string) ([]core.ClassAssignment, error) {
+	return f.classes[classID], nil
+}
+
+func (f *fakeAssignments) GetGroup(_ context.Context, assignmentID uuid.UUID, studentID string) (*core.Group, error) {
+	for _, group := range f.groups {
+		for _, m := range group.Members {
+			if group.AssignmentID == assignmentID && m.StudentID == studentID {
+				return group, nil
+			}
+		}
+	}
+	return nil, assignment.ErrGroupNotFound
+}
+
+func (f *fakeAssignments) LockGroup(_ context.Context, assignmentID, groupID uuid.UUID) (*core.Group, error) {
+	for _, group := range f.groups {
+		if group.AssignmentID == assignmentID && group.ID == groupID {
+			if f.locked == nil {
+				f.locked = make(map[uuid.UUID]bool)
+			}
+			f.locked[groupID] = true
+			return group, nil
+		}
+	}
+	return nil, assignment.ErrGroupNotFound
+}
+
+// testGracePeriod is how long after an attempt ends test services still
+// accept its submission
+const testGracePeriod = 30 * time.Second
+
+// newTestService returns a SubmissionService over an in-memory database,
+// with assignments standing in for the assignment service
+func newTestService(t *testing.T, assignments *fakeAssignments) (SubmissionService, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t,
+		&core.Submission{},
+		&core.SubmissionFile{},
+		&core.SubmissionMember{},
+		&core.VivaTranscriptTurn{},
+		&core.IntegritySignal{},
+		&core.CriterionScore{},
+		&core.GradeEvent{},
+		&core.SubmissionComment{},
+		&core.AttemptGrant{},
+		&core.SimilarityJob{},
+		&core.SimilarityResult{},
+	)
+	return NewSubmissionService(repository.NewRepository(db), nil, assignments, nil, testGracePeriod, nil, time.Hour, nil, time.Minute), db
+}
+
+// createSubmission stores a pending submission by studentID
+func createSubmission(t *testing.T, db *gorm.DB, assignmentID uuid.UUID, studentID string) *core.Submission {
+	t.Helper()
+	submission := &core.Submission{AssignmentID: assignmentID, StudentID: studentID, Status: core.SubmissionStatusPending}
+	if err := db.Create(submission).Error; err != nil {
+		t.Fatal(err)
+	}
+	return submission
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidPenalty = errors.New("invalid late penalty override")
+
+// OverrideLatePenalty replaces the late penalty computed for the submission
+// with penalty points, or goes back to the computed penalty if penalty is
+// nil. Either way needs a reason, which the student sees with the grade.
+func (s *submissionService) OverrideLatePenalty(ctx context.Context, id uuid.UUID, graderID string, penalty *int, reason string) (*core.Grade, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("%w: a reason is required", ErrInvalidPenalty)
+	}
+
+	submission, err := s.repo.GetSubmissionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	rubric, err := s.assignments.GetRubric(ctx, submission.AssignmentID)
+	if err != nil {
+		return nil, err
+	}
+	maxScore := 0
+	for _, c := range rubric.Criteria {
+		maxScore += c.MaxPoints
+	}
+	if penalty != nil && (*penalty < 0 || *penalty > maxScore) {
+		return nil, fmt.Errorf("%w: penalty must be between 0 and %d points", ErrInvalidPenalty, maxScore)
+	}
+
+	lateness, err := s.lateness(ctx, submission)
+	if err != nil {
+		return nil, err
+	}
+	event := &core.GradeEvent{GraderUserID: graderID, Reason: reason}
+	if err := s.repo.SetPenaltyOverride(id, penalty, maxScore, lateness, event); err != nil {
+		return nil, err
+	}
+	s.stats.invalidate(submission.AssignmentID)
+	if submission, err = s.repo.GetSubmissionByID(id); err != nil {
+		return nil, err
+	}
+	return s.buildGrade(submission, rubric)
+}
+
+// lateness is how late the submission was for its submitter's due date, as
+// moved by any extension they have now, with the assignment's late penalty
+func (s *submissionService) lateness(ctx context.Context, submission *core.Submission) (core.Lateness, error) {
+	deadline, err := s.assignments.GetStudentDeadline(ctx, submission.AssignmentID, submission.StudentID)
+	if err != nil {
+		return core.Lateness{}, err
+	}
+	return core.Lateness{
+		Minutes: core.LateMinutes(submission.Timestamp, deadline.DueDate),
+		Policy:  deadline.LatePenalty,
+	}, nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newLatePenaltyFixture is an assignment with a 100 point rubric due dueDate
+// with a 10% per day penalty, and student-2 extended by three days
+func newLatePenaltyFixture(t *testing.T, dueDate time.Time) (SubmissionService, *gorm.DB, uuid.UUID, core.RubricCriterion) {
+	t.Helper()
+	assignmentID := uuid.New()
+	criterion := core.RubricCriterion{ID: uuid.New(), Name: "Correctness", MaxPoints: 100}
+	policy := core.LatePenaltyPolicy{Type: core.LatePenaltyPercentPerDay, PercentPerDay: 10, MaxPercent: 50}
+	svc, db := newTestService(t, &fakeAssignments{
+		rubrics: map[uuid.UUID]*core.Rubric{
+			assignmentID: {AssignmentID: assignmentID, Criteria: []core.RubricCriterion{criterion}},
+		},
+		deadlines: map[string]*core.StudentDeadline{
+			assignmentID.String() + "/student-1": {DueDate: dueDate, LatePenalty: policy},
+			assignmentID.String() + "/student-2": {DueDate: dueDate.Add(72 * time.Hour), Extended: true, LatePenalty: policy},
+		},
+	})
+	return svc, db, assignmentID, criterion
+}
+
+// submitAt stores a submission by studentID made at timestamp
+func submitAt(t *testing.T, db *gorm.DB, assignmentID uuid.UUID, studentID string, timestamp time.Time) *core.Submission {
+	t.Helper()
+	submission := createSubmission(t, db, assignmentID, studentID)
+	if err := db.Model(submission).Update("timestamp", timestamp).Error; err != nil {
+		t.Fatal(err)
+	}
+	return submission
+}
+
+func TestLatePenaltyIsAppliedWhenGrading(t *testing.T) {
+	due := time.Now().Add(-7 * 24 * time.Hour).Truncate(time.Minute)
+	svc, db, assignmentID, criterion := newLatePenaltyFixture(t, due)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name, studentID string
+		submittedAt     time.Time
+		wantLate        int
+		wantPenalty     int
+	}{
+		{"on time", "student-1", due, 0, 0},
+		{"a day and a minute late", "student-1", due.Add(25 * time.Hour), 25 * 60, 20},
+		{"late, but within the extension", "student-2", due.Add(48 * time.Hour), 0, 0},
+		{"a minute past the extension", "student-2", due.Add(72*time.Hour + time.Minute), 1, 10},
+	} {
+		submission := submitAt(t, db, assignmentID, tc.studentID, tc.submittedAt)
+		grade, err := svc.GradeSubmission(ctx, submission.ID, "grader-1", "", []core.CriterionScore{{CriterionID: criterion.ID, Points: 80}})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if *grade.Total != 80 || grade.LateMinutes != tc.wantLate || *grade.Penalty != tc.wantPenalty || *grade.FinalTotal != 80-tc.wantPenalty {
+			t.Errorf("%s: graded %d, %d minutes late, penalty %d, final %d; want 80, %d, %d, %d",
+				tc.name, *grade.Total, grade.LateMinutes, *grade.Penalty, *grade.FinalTotal, tc.wantLate, tc.wantPenalty, 80-tc.wantPenalty)
+		}
+
+		var stored core.Submission
+		if err := db.First(&stored, "id = ?", submission.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if *stored.RubricScore != 80 || *stored.PenaltyApplied != tc.wantPenalty || *stored.FinalScore != 80-tc.wantPenalty {
+			t.Errorf("%s: stored raw %d, penalty %d, final %d", tc.name, *stored.RubricScore, *stored.PenaltyApplied, *stored.FinalScore)
+		}
+	}
+}
+
+func TestLatePenaltyOverride(t *testing.T) {
+	due := time.Now().Add(-7 * 24 * time.Hour).Truncate(time.Minute)
+	svc, db, assignmentID, criterion := newLatePenaltyFixture(t, due)
+	ctx := context.Background()
+	submission := submitAt(t, db, assignmentID, "student-1", due.Add(25*time.Hour))
+	if _, err := svc.GradeSubmission(ctx, submission.ID, "grader-1", "", []core.CriterionScore{{CriterionID: criterion.ID, Points: 80}}); err != nil {
+		t.Fatal(err)
+	}
+
+	five, tooMuch, negative := 5, 101, -1
+	for name, call := range map[string]struct {
+		penalty *int
+		reason  string
+	}{
+		"without a reason": {&five, " "},
+		"over the maximum": {&tooMuch, "network outage"},
+		"negative":         {&negative, "network outage"},
+	} {
+		if _, err := svc.OverrideLatePenalty(ctx, submission.ID, "instructor-1", call.penalty, call.reason); !errors.Is(err, ErrInvalidPenalty) {
+			t.Errorf("override %s = %v, want ErrInvalidPenalty", name, err)
+		}
+	}
+
+	grade, err := svc.OverrideLatePenalty(ctx, submission.ID, "instructor-1", &five, "network outage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *grade.Penalty != 5 || *grade.FinalTotal != 75 || !grade.PenaltyOverridden || grade.PenaltyReason != "network outage" {
+		t.Fatalf("overridden grade = %+v, want a penalty of 5 for the reason given", grade)
+	}
+	history, err := svc.GetGradeHistory(submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest := history[0]; latest.GraderUserID != "instructor-1" || latest.Reason != "network outage" || latest.Penalty == nil || *latest.Penalty != 5 {
+		t.Errorf("latest grade event = %+v, want the override", latest)
+	}
+
+	// Regrading keeps the override
+	grade, err = svc.GradeSubmission(ctx, submission.ID, "grader-1", "", []core.CriterionScore{{CriterionID: criterion.ID, Points: 90}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *grade.Penalty != 5 || *grade.FinalTotal != 85 {
+		t.Errorf("regraded with an override: penalty %d, final %d, want 5 and 85", *grade.Penalty, *grade.FinalTotal)
+	}
+
+	// Clearing it goes back to the computed two days
+	grade, err = svc.OverrideLatePenalty(ctx, submission.ID, "instructor-1", nil, "outage was not the cause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *grade.Penalty != 20 || *grade.FinalTotal != 70 || grade.PenaltyOverridden || grade.PenaltyReason != "" {
+		t.Errorf("cleared override = %+v, want the computed penalty of 20", grade)
+	}
+}
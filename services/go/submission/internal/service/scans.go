@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/notify"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/scanner"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/storage"
+	"github.com/google/uuid"
+)
+
+// scanLease is how long a worker has to scan a submission before another
+// worker may take it over
+const scanLease = 15 * time.Minute
+
+// ScanWorker scans the files of new and re-scanned submissions for malware.
+// Clean files are moved out of quarantine and get a download URL; if any
+// file is infected the submission is rejected, its files stay in
+// quarantine and its students are emailed.
+type ScanWorker struct {
+	repo     repository.Repository
+	storage  storage.StorageClient
+	scanner  scanner.Scanner
+	sender   notify.Sender
+	interval time.Duration
+}
+
+func NewScanWorker(repo repository.Repository, storageClient storage.StorageClient, s scanner.Scanner, sender notify.Sender, interval time.Duration) *ScanWorker {
+	return &ScanWorker{
+		repo:     repo,
+		storage:  storageClient,
+		scanner:  s,
+		sender:   sender,
+		interval: interval,
+	}
+}
+
+// Run polls for submissions to scan until ctx is cancelled
+func (w *ScanWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		// Work through the waiting submissions, then wait for the next tick
+		for ctx.Err() == nil {
+			submission, err := w.repo.ClaimScan(time.Now(), scanLease)
+			if err != nil {
+				log.Printf("Failed to claim submission to scan: %v", err)
+				break
+			}
+			if submission == nil {
+				break
+			}
+			// A failed scan is retried once the claim runs out
+			if err := w.Scan(ctx, submission); err != nil {
+				log.Printf("Failed to scan submission %s: %v", submission.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan scans every file of the submission and records the outcome
+func (w *ScanWorker) Scan(ctx context.Context, submission *core.Submission) error {
+	var found []string
+	for i := range submission.Files {
+		file := &submission.Files[i]
+		if file.StoragePath == "" {
+			// Files stored before scanning existed are where they were uploaded
+			file.StoragePath = w.storage.SubmissionPath(submission.AssignmentID, uuid.MustParse(submission.StudentID), submission.ID, file.Filename)
+		}
+		verdict, details, err := w.scanFile(ctx, file.StoragePath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Filename, err)
+		}
+		if verdict == scanner.VerdictInfected {
+			found = append(found, file.Filename+": "+details)
+		}
+	}
+	rejected := len(found) > 0
+
+	// Infected submissions keep every file in quarantine, clean ones move
+	// them all out
+	for i := range submission.Files {
+		file := &submission.Files[i]
+		final := strings.TrimPrefix(file.StoragePath, storage.QuarantinePrefix+"/")
+		target := final
+		if rejected {
+			target = storage.QuarantinePath(final)
+		}
+		if file.StoragePath != target {
+			if err := w.storage.MoveFile(ctx, file.StoragePath, target); err != nil {
+				return fmt.Errorf("%s: %w", file.Filename, err)
+			}
+			file.StoragePath = target
+		}
+		file.StorageURL = ""
+		if !rejected {
+			file.StorageURL = w.storage.GetFileURL(target)
+		}
+	}
+
+	signature := strings.Join(found, ", ")
+	if err := w.repo.FinishScan(submission, rejected, signature, time.Now()); err != nil {
+		return err
+	}
+	if rejected {
+		log.Printf("Submission %s rejected by the virus scan: %s", submission.ID, signature)
+		w.notifyRejected(ctx, submission, signature)
+	}
+	return nil
+}
+
+func (w *ScanWorker) scanFile(ctx context.Context, path string) (scanner.Verdict, string, error) {
+	content, err := w.storage.DownloadFile(ctx, path)
+	if err != nil {
+		return "", "", err
+	}
+	defer content.Close()
+	return w.scanner.Scan(ctx, content)
+}
+
+// notifyRejected emails each student the submission belongs to. The
+// submission is rejected either way, so failures are only logged.
+func (w *ScanWorker) notifyRejected(ctx context.Context, submission *core.Submission, signature string) {
+	for _, studentID := range submission.StudentIDs() {
+		if err := w.sender.SendSubmissionRejected(ctx, studentID, submission.ID, signature); err != nil {
+			log.Printf("Failed to tell %s that submission %s was rejected: %v", studentID, submission.ID, err)
+		}
+	}
+}
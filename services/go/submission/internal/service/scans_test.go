@@ -0,0 +1,262 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/scanner"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/storage"
+	"github.com/google/uuid"
+)
+
+// memoryStorage is a StorageClient keeping files in a map by path
+type memoryStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{files: make(map[string][]byte)}
+}
+
+func (m *memoryStorage) SubmissionPath(assignmentID, studentID, submissionID uuid.UUID, filename string) string {
+	return filepath.Join("submissions", assignmentID.String(), studentID.String(), submissionID.String(), filename)
+}
+
+func (m *memoryStorage) UploadFile(_ context.Context, path string, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[path] = content
+	return nil
+}
+
+func (m *memoryStorage) UploadStream(ctx context.Context, path, _ string, body io.Reader) error {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return m.UploadFile(ctx, path, content)
+}
+
+func (m *memoryStorage) DownloadFile(_ context.Context, path string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content, ok := m.files[path]
+	if !ok {
+		return nil, errors.New("not found: " + path)
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (m *memoryStorage) MoveFile(_ context.Context, from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content, ok := m.files[from]
+	if !ok {
+		return errors.New("not found: " + from)
+	}
+	delete(m.files, from)
+	m.files[to] = content
+	return nil
+}
+
+func (m *memoryStorage) GetFileURL(path string) string {
+	return "https://storage.test/" + path
+}
+
+func (m *memoryStorage) SignedURL(_ context.Context, path string, expiresIn time.Duration) (string, error) {
+	return fmt.Sprintf("https://storage.test/sign/%s?expires_in=%d", path, int(expiresIn.Seconds())), nil
+}
+
+func (m *memoryStorage) DeleteFile(_ context.Context, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, path)
+	return nil
+}
+
+func (m *memoryStorage) DeleteSubmissionFiles(context.Context, uuid.UUID, uuid.UUID, uuid.UUID) error {
+	return nil
+}
+
+// markerScanner finds a virus in any file containing "EICAR"
+type markerScanner struct{}
+
+func (markerScanner) Scan(_ context.Context, r io.Reader) (scanner.Verdict, string, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", "", err
+	}
+	if bytes.Contains(content, []byte("EICAR")) {
+		return scanner.VerdictInfected, "Eicar-Test-Signature", nil
+	}
+	return scanner.VerdictClean, "", nil
+}
+
+// rejectionRecorder is a notify.Sender keeping the rejections it sends
+type rejectionRecorder struct {
+	rejected []string
+}
+
+func (r *rejectionRecorder) SendCommentDigest(context.Context, string, uuid.UUID, int) error {
+	return nil
+}
+
+func (r *rejectionRecorder) SendSubmissionRejected(_ context.Context, recipientID string, _ uuid.UUID, signature string) error {
+	r.rejected = append(r.rejected, recipientID+": "+signature)
+	return nil
+}
+
+type scanFixture struct {
+	svc     SubmissionService
+	repo    repository.Repository
+	store   *memoryStorage
+	worker  *ScanWorker
+	senders *rejectionRecorder
+}
+
+func newScanFixture(t *testing.T) *scanFixture {
+	t.Helper()
+	_, db := newTestService(t, &fakeAssignments{})
+	repo := repository.NewRepository(db)
+	store := newMemoryStorage()
+	sender := &rejectionRecorder{}
+	return &scanFixture{
+		svc:     NewSubmissionService(repo, store, &fakeAssignments{}, nil, testGracePeriod, nil, time.Hour, nil, time.Minute),
+		repo:    repo,
+		store:   store,
+		worker:  NewScanWorker(repo, store, markerScanner{}, sender, time.Minute),
+		senders: sender,
+	}
+}
+
+// submit submits files by a new student and returns the stored submission
+func (f *scanFixture) submit(t *testing.T, files map[string]string) *core.Submission {
+	t.Helper()
+	submission := &core.Submission{ID: uuid.New(), AssignmentID: uuid.New(), StudentID: uuid.NewString()}
+	contents := make(map[string][]byte, len(files))
+	for name, content := range files {
+		submission.Files = append(submission.Files, core.SubmissionFile{Filename: name})
+		contents[name] = []byte(content)
+	}
+	if err := f.svc.Submit(context.Background(), submission, contents); err != nil {
+		t.Fatal(err)
+	}
+	return submission
+}
+
+// scanNext claims the next submission waiting for a scan and scans it
+func (f *scanFixture) scanNext(t *testing.T) {
+	t.Helper()
+	claimed, err := f.repo.ClaimScan(time.Now(), scanLease)
+	if err != nil || claimed == nil {
+		t.Fatalf("claimed %v, %v", claimed, err)
+	}
+	if err := f.worker.Scan(context.Background(), claimed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanSubmissionLeavesQuarantine(t *testing.T) {
+	f := newScanFixture(t)
+	submission := f.submit(t, map[string]string{"main.py": "print('hi')"})
+	fileID := submission.Files[0].ID
+
+	if _, err := f.svc.FileURL(submission.ID, fileID); !errors.Is(err, ErrFilesNotScanned) {
+		t.Errorf("file URL before the scan: err = %v, want ErrFilesNotScanned", err)
+	}
+	if err := f.svc.UpdateStatus(submission.ID, core.SubmissionStatusAccepted, 10); !errors.Is(err, ErrFilesNotScanned) {
+		t.Errorf("judging before the scan: err = %v, want ErrFilesNotScanned", err)
+	}
+	for path := range f.store.files {
+		if !strings.HasPrefix(path, storage.QuarantinePrefix+"/") {
+			t.Errorf("uploaded to %s, outside quarantine", path)
+		}
+	}
+
+	f.scanNext(t)
+	if next, err := f.repo.ClaimScan(time.Now(), scanLease); err != nil || next != nil {
+		t.Errorf("claimed a scanned submission again: %v, %v", next, err)
+	}
+
+	got, err := f.svc.GetSubmission(submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != core.SubmissionStatusClean || got.ScannedAt == nil {
+		t.Errorf("status = %s, want clean", got.Status)
+	}
+	url, err := f.svc.FileURL(submission.ID, fileID)
+	if err != nil || strings.Contains(url, storage.QuarantinePrefix) {
+		t.Errorf("file URL = %q, %v; want one outside quarantine", url, err)
+	}
+	if len(f.senders.rejected) != 0 {
+		t.Errorf("clean submission sent rejections %v", f.senders.rejected)
+	}
+}
+
+func TestInfectedSubmissionIsRejected(t *testing.T) {
+	f := newScanFixture(t)
+	submission := f.submit(t, map[string]string{"main.py": "print('hi')", "evil.bin": "X5O!P%@AP EICAR"})
+
+	f.scanNext(t)
+
+	got, err := f.svc.GetSubmission(submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != core.SubmissionStatusRejected || got.ScanSignature != "evil.bin: Eicar-Test-Signature" {
+		t.Errorf("status = %s, signature = %q", got.Status, got.ScanSignature)
+	}
+	// Every file stays quarantined, the clean one included
+	for path := range f.store.files {
+		if !strings.HasPrefix(path, storage.QuarantinePrefix+"/") {
+			t.Errorf("%s left quarantine", path)
+		}
+	}
+	if _, err := f.svc.FileURL(submission.ID, got.Files[0].ID); !errors.Is(err, ErrFilesRejected) {
+		t.Errorf("file URL of a rejected submission: err = %v", err)
+	}
+	if len(f.senders.rejected) != 1 || !strings.HasPrefix(f.senders.rejected[0], submission.StudentID) {
+		t.Errorf("rejections sent = %v, want one to the student", f.senders.rejected)
+	}
+}
+
+func TestRescanRestoresVerdict(t *testing.T) {
+	f := newScanFixture(t)
+	submission := f.submit(t, map[string]string{"main.py": "print('hi')"})
+	f.scanNext(t)
+	if err := f.svc.UpdateStatus(submission.ID, core.SubmissionStatusAccepted, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.svc.Rescan(submission.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.svc.GetSubmission(submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != core.SubmissionStatusScanning || got.Files[0].StorageURL != "" {
+		t.Errorf("after requesting a re-scan: status = %s, url = %q", got.Status, got.Files[0].StorageURL)
+	}
+
+	f.scanNext(t)
+	got, err = f.svc.GetSubmission(submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != core.SubmissionStatusAccepted || got.Files[0].StorageURL == "" {
+		t.Errorf("after the re-scan: status = %s, url = %q; want the judge's verdict back", got.Status, got.Files[0].StorageURL)
+	}
+}
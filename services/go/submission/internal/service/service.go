@@ -2,12 +2,20 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/4yrg/gradeloop-core/libs/userevents"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/assignment"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/notify"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
 	"github.com/4yrg/gradeloop-core/services/go/submission/internal/storage"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type SubmissionService interface {
@@ -15,49 +23,187 @@ type SubmissionService interface {
 	GetSubmission(id uuid.UUID) (*core.Submission, error)
 	ListSubmissions(assignmentID uuid.UUID, studentID string) ([]core.Submission, error)
 	UpdateStatus(id uuid.UUID, status core.SubmissionStatus, score int) error
+	AttemptHistory(ctx context.Context, assignmentID uuid.UUID, studentID string) (*core.AttemptHistory, error)
+	GrantAttempts(ctx context.Context, grant *core.AttemptGrant) (*core.AttemptHistory, error)
+	GradingList(ctx context.Context, assignmentID uuid.UUID, attempt int) ([]core.GradingRow, error)
+	GradeSubmission(ctx context.Context, id uuid.UUID, graderID, reason string, scores []core.CriterionScore) (*core.Grade, error)
+	GetGrade(ctx context.Context, id uuid.UUID) (*core.Grade, error)
+	ReleaseGrade(ctx context.Context, id uuid.UUID) (*core.Grade, error)
+	GetGradeHistory(id uuid.UUID) ([]core.GradeEvent, error)
+	OverrideLatePenalty(ctx context.Context, id uuid.UUID, graderID string, penalty *int, reason string) (*core.Grade, error)
+	AddComment(id uuid.UUID, authorID string, private bool, body string, visibility core.CommentVisibility) (*core.SubmissionComment, error)
+	ListComments(id uuid.UUID, private bool) ([]core.SubmissionComment, error)
+	DeleteComment(id, commentID uuid.UUID, userID string, moderator bool) error
+	FileURL(id, fileID uuid.UUID) (string, error)
+	Rescan(id uuid.UUID) error
+	StartSimilarityJob(ctx context.Context, assignmentID uuid.UUID, triggeredBy string, params core.SimilarityParameters) (*core.SimilarityJob, error)
+	GetSimilarityJob(assignmentID, jobID uuid.UUID) (*core.SimilarityJob, error)
+	ListSimilarityJobs(assignmentID uuid.UUID) ([]core.SimilarityJob, error)
+	SimilarPairs(assignmentID uuid.UUID, limit int) (*core.SimilarityJob, []core.SimilarPair, error)
+	StartArchiveJob(ctx context.Context, assignmentID uuid.UUID, attempt int, requester ArchiveRequester) (*core.ArchiveJob, error)
+	GetArchiveJob(ctx context.Context, assignmentID, jobID uuid.UUID, requester ArchiveRequester) (*core.ArchiveJob, error)
+	Transcript(ctx context.Context, studentID string, viewer TranscriptViewer) (*core.Transcript, error)
+	AssignmentStats(ctx context.Context, assignmentID uuid.UUID, full bool) (*core.AssignmentStats, error)
+	ClassAssignmentStats(ctx context.Context, classID string, full bool) ([]core.AssignmentStats, error)
 }
 
+var (
+	ErrInvalidScore         = errors.New("invalid score")
+	ErrReasonRequired       = repository.ErrReasonRequired
+	ErrAttemptNotStarted    = errors.New("timed assignment has not been started")
+	ErrSubmissionWindowOver = errors.New("time for this attempt is up")
+	ErrGroupRequired        = errors.New("join or create a group for this assignment before submitting")
+	ErrInvalidComment       = errors.New("invalid comment")
+	ErrCommentForbidden     = errors.New("not allowed")
+	ErrFilesNotScanned      = errors.New("the submission's files are still being scanned")
+	ErrFilesRejected        = errors.New("the submission was rejected by the virus scan")
+)
+
 type submissionService struct {
-	repo    repository.Repository
-	storage storage.StorageClient
+	repo        repository.Repository
+	storage     storage.StorageClient
+	assignments assignment.Client
+	users       UserDirectory
+	gracePeriod time.Duration
+
+	notifier            *notify.CommentNotifier
+	commentDeleteWindow time.Duration
+	events              EventPublisher
+	stats               *statsCache
 }
 
-func NewSubmissionService(repo repository.Repository, storageClient storage.StorageClient) SubmissionService {
+// EventPublisher pushes events to the notification streams of users.
+// *userevents.Publisher is one.
+type EventPublisher interface {
+	Publish(ctx context.Context, userID, eventType string, data interface{}) error
+}
+
+// NewSubmissionService creates the service. Submissions to a timed assignment
+// are accepted until gracePeriod after the student's attempt ends, to allow
+// for network latency on the final submit. Authors can delete their comments
+// for commentDeleteWindow after posting them. users puts names to the
+// students on the grading list and finds the classes of students for their
+// transcripts. events, if not nil, tells students when
+// their grades are released. Assignment stats are cached for statsCacheTTL.
+func NewSubmissionService(repo repository.Repository, storageClient storage.StorageClient, assignmentClient assignment.Client, users UserDirectory, gracePeriod time.Duration, notifier *notify.CommentNotifier, commentDeleteWindow time.Duration, events EventPublisher, statsCacheTTL time.Duration) SubmissionService {
 	return &submissionService{
-		repo:    repo,
-		storage: storageClient,
+		repo:                repo,
+		storage:             storageClient,
+		assignments:         assignmentClient,
+		users:               users,
+		gracePeriod:         gracePeriod,
+		notifier:            notifier,
+		commentDeleteWindow: commentDeleteWindow,
+		events:              events,
+		stats:               newStatsCache(statsCacheTTL),
 	}
 }
 
 func (s *submissionService) Submit(ctx context.Context, submission *core.Submission, fileContents map[string][]byte) error {
 	submission.Timestamp = time.Now()
-	submission.Status = core.SubmissionStatusPending
+	submission.Status = core.SubmissionStatusScanning
 
-	// Upload files to storage and populate file metadata
-	for _, file := range submission.Files {
+	settings, err := s.assignments.GetSettings(ctx, submission.AssignmentID)
+	if err != nil && !errors.Is(err, assignment.ErrAssignmentNotFound) {
+		return err
+	}
+	// Submissions to assignments the assignment service does not know are
+	// not checked
+	allowed := 0
+	if settings != nil {
+		if err := s.checkWindow(ctx, settings, submission); err != nil {
+			return err
+		}
+		if settings.EnableGroupSubmissions {
+			if err := s.attachGroup(ctx, submission); err != nil {
+				return err
+			}
+		}
+		if allowed, err = s.checkAttempts(settings, submission); err != nil {
+			return err
+		}
+	}
+
+	// Upload files to quarantine and populate file metadata. The scan worker
+	// moves them to their final path, and gives them a URL, once clean.
+	for i := range submission.Files {
+		file := &submission.Files[i]
 		content, exists := fileContents[file.Filename]
 		if !exists {
 			continue
 		}
 
-		// Upload to Supabase storage
-		storageURL, err := s.storage.UploadFile(
-			ctx,
+		path := storage.QuarantinePath(s.storage.SubmissionPath(
 			submission.AssignmentID,
 			uuid.MustParse(submission.StudentID),
 			submission.ID,
 			file.Filename,
-			content,
-		)
-		if err != nil {
+		))
+		if err := s.storage.UploadFile(ctx, path, content); err != nil {
 			return err
 		}
 
-		file.StorageURL = storageURL
+		file.StoragePath = path
 		file.Size = int64(len(content))
 	}
 
-	return s.repo.CreateSubmission(submission)
+	if err := s.repo.CreateSubmissionAttempt(submission, allowed); err != nil {
+		return err
+	}
+	s.stats.invalidate(submission.AssignmentID)
+	return nil
+}
+
+// checkWindow rejects a submission to a timed assignment that the student has
+// not started or whose time, plus the grace period, has run out
+func (s *submissionService) checkWindow(ctx context.Context, settings *core.AssignmentSettings, submission *core.Submission) error {
+	if !settings.Timed {
+		return nil
+	}
+
+	attempt, err := s.assignments.GetAttempt(ctx, submission.AssignmentID, submission.StudentID)
+	if errors.Is(err, assignment.ErrAttemptNotFound) {
+		return ErrAttemptNotStarted
+	}
+	if err != nil {
+		return err
+	}
+	if submission.Timestamp.After(attempt.EndsAt.Add(s.gracePeriod)) {
+		return ErrSubmissionWindowOver
+	}
+	return nil
+}
+
+// attachGroup makes a submission to a group assignment the submitter's
+// group's and locks the group, so nobody can join or leave it and the grade
+// applies to exactly the members recorded. The group stays locked if storing
+// the submission fails afterwards; it can simply submit again.
+func (s *submissionService) attachGroup(ctx context.Context, submission *core.Submission) error {
+	group, err := s.assignments.GetGroup(ctx, submission.AssignmentID, submission.StudentID)
+	if errors.Is(err, assignment.ErrGroupNotFound) {
+		return ErrGroupRequired
+	}
+	if err != nil {
+		return err
+	}
+	group, err = s.assignments.LockGroup(ctx, submission.AssignmentID, group.ID)
+	if err != nil {
+		return err
+	}
+
+	members := make([]core.SubmissionMember, 0, len(group.Members))
+	inGroup := false
+	for _, m := range group.Members {
+		members = append(members, core.SubmissionMember{StudentID: m.StudentID})
+		inGroup = inGroup || m.StudentID == submission.StudentID
+	}
+	// The submitter may have left between the lookup and the lock
+	if !inGroup {
+		return ErrGroupRequired
+	}
+	submission.GroupID = &group.ID
+	submission.Members = members
+	return nil
 }
 
 func (s *submissionService) GetSubmission(id uuid.UUID) (*core.Submission, error) {
@@ -68,6 +214,204 @@ func (s *submissionService) ListSubmissions(assignmentID uuid.UUID, studentID st
 	return s.repo.ListSubmissions(assignmentID, studentID)
 }
 
+// UpdateStatus records the judge's verdict. Submissions whose files have not
+// been found clean cannot be judged.
 func (s *submissionService) UpdateStatus(id uuid.UUID, status core.SubmissionStatus, score int) error {
+	submission, err := s.repo.GetSubmissionByID(id)
+	if err != nil {
+		return err
+	}
+	if err := filesAvailable(submission); err != nil {
+		return err
+	}
 	return s.repo.UpdateSubmissionStatus(id, status, score)
 }
+
+// FileURL returns the download URL of one of the submission's files, once
+// the virus scan has found them clean
+func (s *submissionService) FileURL(id, fileID uuid.UUID) (string, error) {
+	submission, err := s.repo.GetSubmissionByID(id)
+	if err != nil {
+		return "", err
+	}
+	if err := filesAvailable(submission); err != nil {
+		return "", err
+	}
+	for _, file := range submission.Files {
+		if file.ID != fileID {
+			continue
+		}
+		if file.StorageURL == "" {
+			return "", ErrFilesNotScanned
+		}
+		return file.StorageURL, nil
+	}
+	return "", gorm.ErrRecordNotFound
+}
+
+// Rescan has the submission's files scanned again, e.g. after the virus
+// definitions are updated. Their download links are hidden until the scan
+// is done.
+func (s *submissionService) Rescan(id uuid.UUID) error {
+	return s.repo.RequestRescan(id)
+}
+
+func filesAvailable(submission *core.Submission) error {
+	switch submission.Status {
+	case core.SubmissionStatusScanning:
+		return ErrFilesNotScanned
+	case core.SubmissionStatusRejected:
+		return ErrFilesRejected
+	}
+	return nil
+}
+
+// GradeSubmission records per-criterion scores against the assignment's
+// rubric. Grading may be partial; the total is only set once every criterion
+// has a score. Every write is recorded as a GradeEvent, and changing a grade
+// that has been released needs a reason.
+func (s *submissionService) GradeSubmission(ctx context.Context, id uuid.UUID, graderID, reason string, scores []core.CriterionScore) (*core.Grade, error) {
+	submission, err := s.repo.GetSubmissionByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rubric, err := s.assignments.GetRubric(ctx, submission.AssignmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	criteria := make(map[uuid.UUID]core.RubricCriterion, len(rubric.Criteria))
+	for _, c := range rubric.Criteria {
+		criteria[c.ID] = c
+	}
+
+	seen := make(map[uuid.UUID]bool, len(scores))
+	for _, score := range scores {
+		criterion, ok := criteria[score.CriterionID]
+		if !ok {
+			return nil, fmt.Errorf("%w: criterion %s is not part of the rubric", ErrInvalidScore, score.CriterionID)
+		}
+		if seen[score.CriterionID] {
+			return nil, fmt.Errorf("%w: criterion %q is scored more than once", ErrInvalidScore, criterion.Name)
+		}
+		seen[score.CriterionID] = true
+		if score.Points < 0 || score.Points > criterion.MaxPoints {
+			return nil, fmt.Errorf("%w: %q must be between 0 and %d points", ErrInvalidScore, criterion.Name, criterion.MaxPoints)
+		}
+	}
+
+	lateness, err := s.lateness(ctx, submission)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &core.GradeEvent{GraderUserID: graderID, Reason: strings.TrimSpace(reason)}
+	if err := s.repo.SaveCriterionScores(id, scores, rubric, lateness, event); err != nil {
+		return nil, err
+	}
+	s.stats.invalidate(submission.AssignmentID)
+	if submission, err = s.repo.GetSubmissionByID(id); err != nil {
+		return nil, err
+	}
+	return s.buildGrade(submission, rubric)
+}
+
+// GetGrade returns the rubric breakdown of a submission alongside its total
+func (s *submissionService) GetGrade(ctx context.Context, id uuid.UUID) (*core.Grade, error) {
+	submission, err := s.repo.GetSubmissionByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	rubric, err := s.assignments.GetRubric(ctx, submission.AssignmentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildGrade(submission, rubric)
+}
+
+// ReleaseGrade makes the grade final for the student. Releasing again keeps
+// the original release time. The students the grade counts for are told
+// through their notification streams the first time.
+func (s *submissionService) ReleaseGrade(ctx context.Context, id uuid.UUID) (*core.Grade, error) {
+	released, err := s.repo.ReleaseGrade(id)
+	if err != nil {
+		return nil, err
+	}
+	submission, err := s.repo.GetSubmissionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	s.stats.invalidate(submission.AssignmentID)
+	rubric, err := s.assignments.GetRubric(ctx, submission.AssignmentID)
+	if err != nil {
+		return nil, err
+	}
+	grade, err := s.buildGrade(submission, rubric)
+	if err != nil {
+		return nil, err
+	}
+	if released {
+		s.publishGradeReleased(ctx, submission, grade)
+	}
+	return grade, nil
+}
+
+// publishGradeReleased pushes a grade.released event to each student the
+// grade counts for. The grade is released either way, so failures are only
+// logged.
+func (s *submissionService) publishGradeReleased(ctx context.Context, submission *core.Submission, grade *core.Grade) {
+	if s.events == nil {
+		return
+	}
+	payload := map[string]interface{}{
+		"submissionId": submission.ID,
+		"assignmentId": submission.AssignmentID,
+		"total":        grade.Total,
+		"penalty":      grade.Penalty,
+		"finalTotal":   grade.FinalTotal,
+		"maxTotal":     grade.MaxTotal,
+		"releasedAt":   grade.ReleasedAt,
+	}
+	for _, studentID := range grade.StudentIDs {
+		if err := s.events.Publish(ctx, studentID, userevents.TypeGradeReleased, payload); err != nil {
+			log.Printf("Failed to notify %s of the released grade of submission %s: %v", studentID, submission.ID, err)
+		}
+	}
+}
+
+// GetGradeHistory lists every write of a submission's grade, newest first
+func (s *submissionService) GetGradeHistory(id uuid.UUID) ([]core.GradeEvent, error) {
+	if _, err := s.repo.GetSubmissionByID(id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListGradeEvents(id)
+}
+
+func (s *submissionService) buildGrade(submission *core.Submission, rubric *core.Rubric) (*core.Grade, error) {
+	scores, err := s.repo.ListCriterionScores(submission.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	grade := core.BuildGrade(submission.ID, rubric, scores)
+	grade.ReleasedAt = submission.GradeReleasedAt
+	grade.StudentIDs = submission.StudentIDs()
+	if grade.Total != nil {
+		grade.LateMinutes = submission.LateMinutes
+		grade.Penalty = submission.PenaltyApplied
+		grade.FinalTotal = submission.FinalScore
+		grade.PenaltyOverridden = submission.PenaltyOverride != nil
+		grade.PenaltyReason = submission.PenaltyOverrideReason
+	}
+	latest, err := s.repo.GetLatestGradeEvent(submission.ID)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		grade.ChangedBy = latest.GraderUserID
+		grade.ChangedAt = &latest.CreatedAt
+	}
+	return grade, nil
+}
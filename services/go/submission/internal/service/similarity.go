@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/similarity"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultSimilarityMinScore is the lowest score reported when a job
+	// does not set one
+	DefaultSimilarityMinScore = 0.5
+	// similarityBatchSize is how many submissions are loaded at a time, and
+	// how many results are stored at a time, while a job runs
+	similarityBatchSize = 100
+)
+
+var (
+	ErrInvalidSimilarityJob = errors.New("invalid similarity job")
+	ErrSimilarityJobActive  = repository.ErrSimilarityJobActive
+	ErrNoSimilarityResults  = repository.ErrNoSimilarityResults
+)
+
+// StartSimilarityJob queues a similarity check of the assignment's latest
+// submissions
+func (s *submissionService) StartSimilarityJob(ctx context.Context, assignmentID uuid.UUID, triggeredBy string, params core.SimilarityParameters) (*core.SimilarityJob, error) {
+	if params.MinScore < 0 || params.MinScore > 1 {
+		return nil, fmt.Errorf("%w: minScore must be between 0 and 1", ErrInvalidSimilarityJob)
+	}
+	if _, err := s.assignments.GetSettings(ctx, assignmentID); err != nil {
+		return nil, err
+	}
+
+	job := &core.SimilarityJob{
+		AssignmentID: assignmentID,
+		TriggeredBy:  triggeredBy,
+		Parameters:   params,
+	}
+	if err := s.repo.CreateSimilarityJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *submissionService) GetSimilarityJob(assignmentID, jobID uuid.UUID) (*core.SimilarityJob, error) {
+	return s.repo.GetSimilarityJob(assignmentID, jobID)
+}
+
+func (s *submissionService) ListSimilarityJobs(assignmentID uuid.UUID) ([]core.SimilarityJob, error) {
+	return s.repo.ListSimilarityJobs(assignmentID)
+}
+
+// SimilarPairs returns the assignment's latest completed job and up to limit
+// of the pairs it found, most similar first
+func (s *submissionService) SimilarPairs(assignmentID uuid.UUID, limit int) (*core.SimilarityJob, []core.SimilarPair, error) {
+	job, results, err := s.repo.ListSimilarityResults(assignmentID, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	pairs := make([]core.SimilarPair, 0, len(results))
+	for _, result := range results {
+		pairs = append(pairs, core.SimilarPair{
+			SimilarityResult: result,
+			SubmissionAURL:   submissionURL(result.SubmissionA),
+			SubmissionBURL:   submissionURL(result.SubmissionB),
+		})
+	}
+	return job, pairs, nil
+}
+
+func submissionURL(id uuid.UUID) string {
+	return "/api/v1/submissions/" + id.String()
+}
+
+// SimilarityWorker runs queued similarity jobs through the external
+// checker. Submissions are streamed to it a batch at a time and the pairs it
+// reports stored as they arrive, so large assignments are never held in
+// memory at once.
+type SimilarityWorker struct {
+	repo     repository.Repository
+	storage  storage.StorageClient
+	checker  similarity.Checker
+	lease    time.Duration
+	interval time.Duration
+}
+
+// NewSimilarityWorker creates the worker. A job must finish within lease,
+// after which another worker may take it over.
+func NewSimilarityWorker(repo repository.Repository, storageClient storage.StorageClient, checker similarity.Checker, lease, interval time.Duration) *SimilarityWorker {
+	return &SimilarityWorker{
+		repo:     repo,
+		storage:  storageClient,
+		checker:  checker,
+		lease:    lease,
+		interval: interval,
+	}
+}
+
+// Run polls for queued jobs until ctx is cancelled
+func (w *SimilarityWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, err := w.repo.ClaimSimilarityJob(time.Now(), w.lease)
+			if err != nil {
+				log.Printf("Failed to claim similarity job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			w.Process(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Process runs a claimed job and records how it ended. A job that fails
+// keeps the assignment's previous results.
+func (w *SimilarityWorker) Process(ctx context.Context, job *core.SimilarityJob) {
+	err := w.run(ctx, job)
+	if err == nil {
+		err = w.repo.CompleteSimilarityJob(job, time.Now())
+		if err == nil {
+			log.Printf("Similarity job %s compared %d submissions and found %d pairs", job.ID, job.SubmissionCount, job.PairCount)
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the job is taken up again once its claim runs out
+		return
+	}
+	log.Printf("Similarity job %s failed: %v", job.ID, err)
+	if err := w.repo.FailSimilarityJob(job, err.Error(), time.Now()); err != nil {
+		log.Printf("Failed to record that similarity job %s failed: %v", job.ID, err)
+	}
+}
+
+func (w *SimilarityWorker) run(ctx context.Context, job *core.SimilarityJob) error {
+	run := &similarityRun{worker: w, job: job, sent: make(map[uuid.UUID]bool)}
+	if err := w.checker.Check(ctx, job.Parameters, run.next, run.emit); err != nil {
+		return err
+	}
+	if err := run.flush(); err != nil {
+		return err
+	}
+	job.SubmissionCount = len(run.sent)
+	return nil
+}
+
+// similarityRun is the state of one job while the checker runs. next is
+// called from the goroutine sending submissions and emit from the one
+// reading results, so sent is shared under mu.
+type similarityRun struct {
+	worker *SimilarityWorker
+	job    *core.SimilarityJob
+
+	// batch and after page through the submissions, for next only
+	batch []core.Submission
+	after uuid.UUID
+	done  bool
+
+	mu      sync.Mutex
+	sent    map[uuid.UUID]bool
+	pending []core.SimilarityResult
+}
+
+// next downloads the files of the next submission to compare
+func (r *similarityRun) next(ctx context.Context) (*similarity.Submission, error) {
+	if len(r.batch) == 0 && !r.done {
+		batch, err := r.worker.repo.ListSimilaritySubmissions(r.job.AssignmentID, r.after, similarityBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		r.batch = batch
+		r.done = len(batch) < similarityBatchSize
+		if len(batch) > 0 {
+			r.after = batch[len(batch)-1].ID
+		}
+	}
+	if len(r.batch) == 0 {
+		return nil, similarity.Done
+	}
+	submission := r.batch[0]
+	r.batch = r.batch[1:]
+
+	out := &similarity.Submission{ID: submission.ID, Files: make([]similarity.File, 0, len(submission.Files))}
+	for _, file := range submission.Files {
+		content, err := r.download(ctx, &submission, &file)
+		if err != nil {
+			return nil, fmt.Errorf("submission %s, %s: %w", submission.ID, file.Filename, err)
+		}
+		out.Files = append(out.Files, similarity.File{Name: file.Filename, Content: content})
+	}
+
+	r.mu.Lock()
+	r.sent[submission.ID] = true
+	r.mu.Unlock()
+	return out, nil
+}
+
+func (r *similarityRun) download(ctx context.Context, submission *core.Submission, file *core.SubmissionFile) ([]byte, error) {
+	content, err := r.worker.storage.DownloadFile(ctx, storedPath(r.worker.storage, submission, file))
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return io.ReadAll(content)
+}
+
+// emit stores a pair the checker reported, in batches. Pairs below the
+// job's minimum score, of a submission with itself or naming a submission
+// that was not sent are dropped.
+func (r *similarityRun) emit(pair similarity.Pair) error {
+	if pair.Score < r.job.Parameters.MinScore || pair.A == pair.B {
+		return nil
+	}
+	a, b := pair.A, pair.B
+	if b.String() < a.String() {
+		a, b = b, a
+	}
+
+	r.mu.Lock()
+	known := r.sent[a] && r.sent[b]
+	if known {
+		r.pending = append(r.pending, core.SimilarityResult{
+			JobID:        r.job.ID,
+			AssignmentID: r.job.AssignmentID,
+			SubmissionA:  a,
+			SubmissionB:  b,
+			Score:        pair.Score,
+		})
+	}
+	full := len(r.pending) >= similarityBatchSize
+	r.mu.Unlock()
+
+	if !known {
+		log.Printf("Similarity job %s: checker reported a pair with a submission it was not sent (%s, %s)", r.job.ID, pair.A, pair.B)
+		return nil
+	}
+	if full {
+		return r.flush()
+	}
+	return nil
+}
+
+// flush stores the pairs waiting to be stored
+func (r *similarityRun) flush() error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	if err := r.worker.repo.SaveSimilarityResults(pending); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.job.PairCount += len(pending)
+	r.mu.Unlock()
+	return nil
+}
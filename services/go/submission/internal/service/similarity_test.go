@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/assignment"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/similarity"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeChecker reads every submission it is sent, then reports pairs, and
+// fails with err if it is set
+type fakeChecker struct {
+	pairs    []similarity.Pair
+	err      error
+	received map[uuid.UUID]string // file contents by submission ID
+}
+
+func (f *fakeChecker) Check(ctx context.Context, _ core.SimilarityParameters, next similarity.Source, emit func(similarity.Pair) error) error {
+	f.received = make(map[uuid.UUID]string)
+	for {
+		submission, err := next(ctx)
+		if errors.Is(err, similarity.Done) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for _, file := range submission.Files {
+			f.received[submission.ID] += string(file.Content)
+		}
+	}
+	for _, pair := range f.pairs {
+		if err := emit(pair); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+// similarityFixture is an assignment with a similarity worker over its
+// submissions
+type similarityFixture struct {
+	svc          SubmissionService
+	db           *gorm.DB
+	repo         repository.Repository
+	storage      *memoryStorage
+	checker      *fakeChecker
+	worker       *SimilarityWorker
+	assignmentID uuid.UUID
+}
+
+func newSimilarityFixture(t *testing.T) *similarityFixture {
+	t.Helper()
+	assignmentID := uuid.New()
+	svc, db := newTestService(t, &fakeAssignments{settings: map[uuid.UUID]*core.AssignmentSettings{
+		assignmentID: {ID: assignmentID},
+	}})
+	f := &similarityFixture{
+		svc:          svc,
+		db:           db,
+		repo:         repository.NewRepository(db),
+		storage:      newMemoryStorage(),
+		checker:      &fakeChecker{},
+		assignmentID: assignmentID,
+	}
+	f.worker = NewSimilarityWorker(f.repo, f.storage, f.checker, time.Minute, time.Second)
+	return f
+}
+
+// submit stores a submission of one file by studentID, made at
+func (f *similarityFixture) submit(t *testing.T, studentID, content string, status core.SubmissionStatus, at time.Time) uuid.UUID {
+	t.Helper()
+	submission := &core.Submission{AssignmentID: f.assignmentID, StudentID: studentID, Status: status, Timestamp: at}
+	if err := f.db.Create(submission).Error; err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("clean/%s/main.py", submission.ID)
+	file := &core.SubmissionFile{SubmissionID: submission.ID, Filename: "main.py", StoragePath: path}
+	if err := f.db.Create(file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := f.storage.UploadFile(context.Background(), path, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	return submission.ID
+}
+
+// run queues a job and has the worker run it, returning it as stored
+func (f *similarityFixture) run(t *testing.T) *core.SimilarityJob {
+	t.Helper()
+	job, err := f.svc.StartSimilarityJob(context.Background(), f.assignmentID, "instructor-1", core.SimilarityParameters{MinScore: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := f.repo.ClaimSimilarityJob(time.Now(), time.Minute)
+	if err != nil || claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("claimed %v, %v; want job %s", claimed, err, job.ID)
+	}
+	f.worker.Process(context.Background(), claimed)
+	stored, err := f.svc.GetSimilarityJob(f.assignmentID, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+func TestSimilarityJobLifecycle(t *testing.T) {
+	f := newSimilarityFixture(t)
+	ctx := context.Background()
+	now := time.Now()
+	f.submit(t, "ada", "print('draft')", core.SubmissionStatusClean, now.Add(-time.Hour))
+	ada := f.submit(t, "ada", "print('final')", core.SubmissionStatusClean, now)
+	bob := f.submit(t, "bob", "print('bob')", core.SubmissionStatusAccepted, now)
+	cyd := f.submit(t, "cyd", "print('cyd')", core.SubmissionStatusClean, now)
+	f.submit(t, "dan", "print('dan')", core.SubmissionStatusScanning, now)
+
+	if _, err := f.svc.StartSimilarityJob(ctx, f.assignmentID, "instructor-1", core.SimilarityParameters{MinScore: 1.5}); !errors.Is(err, ErrInvalidSimilarityJob) {
+		t.Errorf("min score above 1: got %v, want ErrInvalidSimilarityJob", err)
+	}
+	if _, err := f.svc.StartSimilarityJob(ctx, uuid.New(), "instructor-1", core.SimilarityParameters{}); !errors.Is(err, assignment.ErrAssignmentNotFound) {
+		t.Errorf("unknown assignment: got %v, want ErrAssignmentNotFound", err)
+	}
+	if _, _, err := f.svc.SimilarPairs(f.assignmentID, 10); !errors.Is(err, ErrNoSimilarityResults) {
+		t.Errorf("pairs before any job: got %v, want ErrNoSimilarityResults", err)
+	}
+
+	queued, err := f.svc.StartSimilarityJob(ctx, f.assignmentID, "instructor-1", core.SimilarityParameters{MinScore: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued.Status != core.SimilarityJobQueued {
+		t.Errorf("new job is %s, want queued", queued.Status)
+	}
+	if _, err := f.svc.StartSimilarityJob(ctx, f.assignmentID, "instructor-2", core.SimilarityParameters{}); !errors.Is(err, ErrSimilarityJobActive) {
+		t.Errorf("second job while one is queued: got %v, want ErrSimilarityJobActive", err)
+	}
+
+	f.checker.pairs = []similarity.Pair{
+		{A: ada, B: bob, Score: 0.7},
+		{A: cyd, B: bob, Score: 0.9},
+		{A: ada, B: cyd, Score: 0.3},      // below the minimum score
+		{A: ada, B: ada, Score: 1},        // a submission with itself
+		{A: ada, B: uuid.New(), Score: 1}, // a submission that was not sent
+	}
+	claimed, err := f.repo.ClaimSimilarityJob(time.Now(), time.Minute)
+	if err != nil || claimed == nil || claimed.ID != queued.ID {
+		t.Fatalf("claimed %v, %v; want the queued job", claimed, err)
+	}
+	f.worker.Process(ctx, claimed)
+
+	// Only the latest clean submission of each student is compared
+	want := map[uuid.UUID]string{ada: "print('final')", bob: "print('bob')", cyd: "print('cyd')"}
+	if len(f.checker.received) != len(want) {
+		t.Errorf("checker was sent %d submissions, want %d", len(f.checker.received), len(want))
+	}
+	for id, content := range want {
+		if f.checker.received[id] != content {
+			t.Errorf("checker got %q for submission %s, want %q", f.checker.received[id], id, content)
+		}
+	}
+
+	job, err := f.svc.GetSimilarityJob(f.assignmentID, queued.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != core.SimilarityJobCompleted || job.SubmissionCount != 3 || job.PairCount != 2 || job.FinishedAt == nil {
+		t.Errorf("finished job = %+v, want completed with 3 submissions and 2 pairs", job)
+	}
+	_, pairs, err := f.svc.SimilarPairs(f.assignmentID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 2 || pairs[0].Score != 0.9 || pairs[1].Score != 0.7 {
+		t.Fatalf("pairs = %+v, want bob and cyd, then ada and bob", pairs)
+	}
+	if first := pairs[0]; first.SubmissionAURL != submissionURL(first.SubmissionA) || first.SubmissionA.String() > first.SubmissionB.String() {
+		t.Errorf("pair %+v is not ordered or linked to its submissions", first)
+	}
+	if _, top, _ := f.svc.SimilarPairs(f.assignmentID, 1); len(top) != 1 || top[0].Score != 0.9 {
+		t.Errorf("top pair = %+v, want the most similar one", top)
+	}
+
+	if _, err := f.svc.StartSimilarityJob(ctx, f.assignmentID, "instructor-2", core.SimilarityParameters{}); err != nil {
+		t.Errorf("job after the first finished: %v", err)
+	}
+}
+
+func TestSimilarityRerunReplacesResults(t *testing.T) {
+	f := newSimilarityFixture(t)
+	now := time.Now()
+	ada := f.submit(t, "ada", "a", core.SubmissionStatusClean, now)
+	bob := f.submit(t, "bob", "b", core.SubmissionStatusClean, now)
+	cyd := f.submit(t, "cyd", "c", core.SubmissionStatusClean, now)
+
+	f.checker.pairs = []similarity.Pair{{A: ada, B: bob, Score: 0.8}}
+	f.run(t)
+	f.checker.pairs = []similarity.Pair{{A: bob, B: cyd, Score: 0.6}}
+	second := f.run(t)
+
+	latest, pairs, err := f.svc.SimilarPairs(f.assignmentID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ID != second.ID || len(pairs) != 1 || pairs[0].Score != 0.6 {
+		t.Fatalf("pairs after a rerun = %+v from job %s, want only the rerun's", pairs, latest.ID)
+	}
+
+	// A job failing part way keeps the last completed job's results
+	f.checker.pairs = []similarity.Pair{{A: ada, B: cyd, Score: 0.99}}
+	f.checker.err = errors.New("checker crashed")
+	failed := f.run(t)
+	if failed.Status != core.SimilarityJobFailed || failed.Error != "checker crashed" {
+		t.Errorf("failed job = %+v, want failed with the checker's error", failed)
+	}
+	latest, pairs, err = f.svc.SimilarPairs(f.assignmentID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ID != second.ID || len(pairs) != 1 || pairs[0].Score != 0.6 {
+		t.Errorf("pairs after a failed job = %+v from job %s, want the previous job's", pairs, latest.ID)
+	}
+	var stored int64
+	f.db.Model(&core.SimilarityResult{}).Count(&stored)
+	if stored != 1 {
+		t.Errorf("%d results stored, want only the completed job's", stored)
+	}
+}
+
+func TestSimilarityJobPagesThroughLargeAssignments(t *testing.T) {
+	f := newSimilarityFixture(t)
+	count := similarityBatchSize*2 + 1
+	for i := 0; i < count; i++ {
+		f.submit(t, fmt.Sprintf("student-%d", i), fmt.Sprint(i), core.SubmissionStatusClean, time.Now())
+	}
+
+	job := f.run(t)
+	if job.Status != core.SimilarityJobCompleted || job.SubmissionCount != count || len(f.checker.received) != count {
+		t.Errorf("job = %+v after sending %d submissions, want all %d", job, len(f.checker.received), count)
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+// histogramBuckets is how many equal buckets, by percentage of the total,
+// an assignment's score histogram has
+const histogramBuckets = 10
+
+// AssignmentStats returns how the students did on an assignment, with a
+// histogram of their scores. With full, as for instructors, every grade
+// counts; otherwise only released ones do.
+func (s *submissionService) AssignmentStats(ctx context.Context, assignmentID uuid.UUID, full bool) (*core.AssignmentStats, error) {
+	key := statsKey("assignment", assignmentID.String(), full)
+	if cached, ok := s.stats.get(key); ok {
+		return &cached[0], nil
+	}
+
+	settings, err := s.assignments.GetSettings(ctx, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.repo.AssignmentStats([]uuid.UUID{assignmentID}, !full)
+	if err != nil {
+		return nil, err
+	}
+	stats := core.AssignmentStats{AssignmentID: assignmentID}
+	if len(rows) > 0 {
+		stats = rows[0]
+	}
+	stats.TotalScore = settings.TotalScore
+
+	counts, err := s.repo.AssignmentScoreCounts(assignmentID, !full)
+	if err != nil {
+		return nil, err
+	}
+	stats.Histogram = histogram(counts, settings.TotalScore)
+
+	s.stats.put(key, []core.AssignmentStats{stats})
+	return &stats, nil
+}
+
+// ClassAssignmentStats returns the stats of every assignment of the class,
+// without histograms, for the gradebook. They come from one grouped query
+// whatever the number of assignments.
+func (s *submissionService) ClassAssignmentStats(ctx context.Context, classID string, full bool) ([]core.AssignmentStats, error) {
+	key := statsKey("class", classID, full)
+	if cached, ok := s.stats.get(key); ok {
+		return cached, nil
+	}
+
+	assignments, err := s.assignments.ListClassAssignments(ctx, classID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(assignments))
+	for i, a := range assignments {
+		ids[i] = a.ID
+	}
+	byAssignment := make(map[uuid.UUID]core.AssignmentStats, len(ids))
+	if len(ids) > 0 {
+		rows, err := s.repo.AssignmentStats(ids, !full)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			byAssignment[row.AssignmentID] = row
+		}
+	}
+
+	stats := make([]core.AssignmentStats, len(assignments))
+	for i, a := range assignments {
+		row, ok := byAssignment[a.ID]
+		if !ok {
+			row = core.AssignmentStats{AssignmentID: a.ID}
+		}
+		row.Title = a.Title
+		row.TotalScore = a.TotalScore
+		stats[i] = row
+	}
+
+	s.stats.put(key, stats)
+	return stats, nil
+}
+
+// histogram buckets the scores by percentage of total. It is nil if the
+// assignment has no total to take percentages of.
+func histogram(counts map[int]int, total int) []core.HistogramBucket {
+	if total <= 0 {
+		return nil
+	}
+	buckets := make([]core.HistogramBucket, histogramBuckets)
+	width := 100 / histogramBuckets
+	for i := range buckets {
+		buckets[i].From = i * width
+		buckets[i].To = (i + 1) * width
+	}
+	for score, count := range counts {
+		i := score * histogramBuckets / total
+		buckets[max(0, min(i, histogramBuckets-1))].Count += count
+	}
+	return buckets
+}
+
+func statsKey(kind, id string, full bool) string {
+	if full {
+		return kind + ":" + id + ":full"
+	}
+	return kind + ":" + id + ":released"
+}
+
+// statsCache holds assignment and class stats for ttl, as the gradebook
+// asks for them on every refresh. A new submission or grade drops every
+// entry covering its assignment on this instance; other instances catch up
+// when their entries expire.
+type statsCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]statsEntry
+	nextSweep time.Time
+}
+
+type statsEntry struct {
+	stats   []core.AssignmentStats
+	expires time.Time
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{ttl: ttl, entries: make(map[string]statsEntry)}
+}
+
+func (c *statsCache) get(key string) ([]core.AssignmentStats, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.stats, true
+}
+
+func (c *statsCache) put(key string, stats []core.AssignmentStats) {
+	if c.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Drop expired entries now and then so the map only holds busy classes
+	if now.After(c.nextSweep) {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[key] = statsEntry{stats: stats, expires: now.Add(c.ttl)}
+}
+
+// invalidate drops every entry with stats of the assignment
+func (c *statsCache) invalidate(assignmentID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		if slices.ContainsFunc(entry.stats, func(st core.AssignmentStats) bool { return st.AssignmentID == assignmentID }) {
+			delete(c.entries, k)
+		}
+	}
+}
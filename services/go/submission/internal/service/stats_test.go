@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// gradedAt stores a submission by studentID made at timestamp with a final
+// score, released if released is set
+func gradedAt(t *testing.T, db *gorm.DB, assignmentID uuid.UUID, studentID string, timestamp time.Time, score int, released bool) *core.Submission {
+	t.Helper()
+	submission := submitAt(t, db, assignmentID, studentID, timestamp)
+	updates := map[string]interface{}{"rubric_score": score, "final_score": score}
+	if released {
+		updates["grade_released_at"] = timestamp
+	}
+	if err := db.Model(submission).Updates(updates).Error; err != nil {
+		t.Fatal(err)
+	}
+	return submission
+}
+
+func float(f float64) *float64 { return &f }
+
+func TestAssignmentStatsOfAKnownDataset(t *testing.T) {
+	assignmentID := uuid.New()
+	svc, db := newTestService(t, &fakeAssignments{
+		settings: map[uuid.UUID]*core.AssignmentSettings{assignmentID: {TotalScore: 10}},
+	})
+	now := time.Now()
+	// Mean 5, median 4.5 and population standard deviation 2. The last
+	// three are not released.
+	for i, score := range []int{2, 4, 4, 4, 5, 5, 7, 9} {
+		gradedAt(t, db, assignmentID, "student-"+string(rune('a'+i)), now, score, i < 5)
+	}
+	submitAt(t, db, assignmentID, "student-ungraded", now)
+
+	stats, err := svc.AssignmentStats(context.Background(), assignmentID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &core.AssignmentStats{
+		AssignmentID: assignmentID,
+		TotalScore:   10,
+		Submitted:    9,
+		Graded:       8,
+		Mean:         float(5),
+		Median:       float(4.5),
+		StdDev:       float(2),
+		Histogram: []core.HistogramBucket{
+			{From: 0, To: 10}, {From: 10, To: 20}, {From: 20, To: 30, Count: 1}, {From: 30, To: 40},
+			{From: 40, To: 50, Count: 3}, {From: 50, To: 60, Count: 2}, {From: 60, To: 70},
+			{From: 70, To: 80, Count: 1}, {From: 80, To: 90}, {From: 90, To: 100, Count: 1},
+		},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("instructor stats = %+v, want %+v", stats, want)
+	}
+
+	// Students only see the 5 released grades: 2, 4, 4, 4 and 5
+	stats, err = svc.AssignmentStats(context.Background(), assignmentID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Submitted != 9 || stats.Graded != 5 || *stats.Mean != 3.8 || *stats.Median != 4 || *stats.StdDev != 0.98 {
+		t.Errorf("student stats: %d submitted, %d graded, mean %v, median %v, std dev %v; want 9, 5, 3.8, 4, 0.98",
+			stats.Submitted, stats.Graded, *stats.Mean, *stats.Median, *stats.StdDev)
+	}
+	if stats.Histogram[7].Count != 0 || stats.Histogram[4].Count != 3 {
+		t.Errorf("student histogram counts unreleased grades: %+v", stats.Histogram)
+	}
+}
+
+func TestAssignmentStatsCountTheGradeThatCounts(t *testing.T) {
+	assignmentID := uuid.New()
+	svc, db := newTestService(t, &fakeAssignments{
+		settings: map[uuid.UUID]*core.AssignmentSettings{assignmentID: {TotalScore: 10}},
+	})
+	earlier, later := time.Now().Add(-time.Hour), time.Now()
+
+	// A released grade counts over a later attempt graded but not released
+	gradedAt(t, db, assignmentID, "student-1", earlier, 8, true)
+	gradedAt(t, db, assignmentID, "student-1", later, 2, false)
+	// Without a released grade the latest attempt counts
+	gradedAt(t, db, assignmentID, "student-2", earlier, 2, false)
+	gradedAt(t, db, assignmentID, "student-2", later, 6, false)
+	// Deleted and rejected attempts do not count at all
+	deleted := gradedAt(t, db, assignmentID, "student-3", later, 10, true)
+	if err := db.Delete(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	rejected := gradedAt(t, db, assignmentID, "student-4", later, 10, true)
+	if err := db.Model(rejected).Update("status", core.SubmissionStatusRejected).Error; err != nil {
+		t.Fatal(err)
+	}
+	// A group submission counts once for each of its members
+	group := gradedAt(t, db, assignmentID, "student-5", later, 4, true)
+	for _, studentID := range []string{"student-5", "student-6"} {
+		if err := db.Create(&core.SubmissionMember{SubmissionID: group.ID, StudentID: studentID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := svc.AssignmentStats(context.Background(), assignmentID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8, 6, 4 and 4
+	if stats.Submitted != 4 || stats.Graded != 4 || *stats.Mean != 5.5 || *stats.Median != 5 {
+		t.Errorf("%d submitted, %d graded, mean %v, median %v; want 4, 4, 5.5, 5",
+			stats.Submitted, stats.Graded, *stats.Mean, *stats.Median)
+	}
+}
+
+func TestClassAssignmentStatsHasARowPerAssignment(t *testing.T) {
+	graded, unsubmitted := uuid.New(), uuid.New()
+	svc, db := newTestService(t, &fakeAssignments{
+		classes: map[string][]core.ClassAssignment{"class-1": {
+			{ID: graded, Title: "Lab 1", TotalScore: 10},
+			{ID: unsubmitted, Title: "Lab 2", TotalScore: 20},
+		}},
+	})
+	gradedAt(t, db, graded, "student-1", time.Now(), 6, true)
+	gradedAt(t, db, graded, "student-2", time.Now(), 9, true)
+	gradedAt(t, db, uuid.New(), "student-1", time.Now(), 1, true) // of another class
+
+	stats, err := svc.ClassAssignmentStats(context.Background(), "class-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []core.AssignmentStats{
+		{AssignmentID: graded, Title: "Lab 1", TotalScore: 10, Submitted: 2, Graded: 2, Mean: float(7.5), Median: float(7.5), StdDev: float(1.5)},
+		{AssignmentID: unsubmitted, Title: "Lab 2", TotalScore: 20},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("class stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestAssignmentStatsAreRecomputedWhenAGradeLands(t *testing.T) {
+	assignmentID, classID := uuid.New(), "class-1"
+	criterion := core.RubricCriterion{ID: uuid.New(), Name: "Correctness", MaxPoints: 10}
+	svc, db := newTestService(t, &fakeAssignments{
+		rubrics: map[uuid.UUID]*core.Rubric{
+			assignmentID: {AssignmentID: assignmentID, Criteria: []core.RubricCriterion{criterion}},
+		},
+		settings: map[uuid.UUID]*core.AssignmentSettings{assignmentID: {TotalScore: 10}},
+		classes:  map[string][]core.ClassAssignment{classID: {{ID: assignmentID, TotalScore: 10}}},
+	})
+	ctx := context.Background()
+	gradedAt(t, db, assignmentID, "student-1", time.Now(), 4, false)
+	ungraded := submitAt(t, db, assignmentID, "student-2", time.Now())
+
+	stats, err := svc.AssignmentStats(ctx, assignmentID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ClassAssignmentStats(ctx, classID, true); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Graded != 1 {
+		t.Fatalf("graded = %d, want 1", stats.Graded)
+	}
+
+	// Writes behind the service's back are not seen until the entry expires
+	if err := db.Model(ungraded).Updates(map[string]interface{}{"rubric_score": 10, "final_score": 10}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := svc.AssignmentStats(ctx, assignmentID, true); stats.Graded != 1 {
+		t.Fatalf("graded = %d, want the cached 1", stats.Graded)
+	}
+
+	if _, err := svc.GradeSubmission(ctx, ungraded.ID, "grader-1", "", []core.CriterionScore{{CriterionID: criterion.ID, Points: 8}}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = svc.AssignmentStats(ctx, assignmentID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Graded != 2 || *stats.Mean != 6 {
+		t.Errorf("after grading: %d graded, mean %v; want 2, 6", stats.Graded, *stats.Mean)
+	}
+	class, err := svc.ClassAssignmentStats(ctx, classID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class[0].Graded != 2 || *class[0].Mean != 6 {
+		t.Errorf("class stats after grading: %d graded, mean %v; want 2, 6", class[0].Graded, *class[0].Mean)
+	}
+}
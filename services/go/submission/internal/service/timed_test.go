@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+func TestTimedSubmissionWindow(t *testing.T) {
+	timed, untimed := uuid.New(), uuid.New()
+	assignments := &fakeAssignments{
+		settings: map[uuid.UUID]*core.AssignmentSettings{
+			timed:   {ID: timed, Timed: true, DurationMinutes: 60},
+			untimed: {ID: untimed},
+		},
+		attempts: map[string]*core.Attempt{},
+	}
+	svc, _ := newTestService(t, assignments)
+	startAttempt := func(student string, endsAt time.Time) {
+		assignments.attempts[timed.String()+"/"+student] = &core.Attempt{AssignmentID: timed, StudentID: student, EndsAt: endsAt}
+	}
+	startAttempt("running", time.Now().Add(10*time.Minute))
+	startAttempt("in-grace", time.Now().Add(-testGracePeriod/2))
+	startAttempt("late", time.Now().Add(-testGracePeriod-time.Second))
+
+	for _, c := range []struct {
+		assignmentID uuid.UUID
+		student      string
+		want         error
+	}{
+		{timed, "running", nil},
+		{timed, "in-grace", nil},
+		{timed, "late", ErrSubmissionWindowOver},
+		{timed, "never-started", ErrAttemptNotStarted},
+		{untimed, "never-started", nil},
+		// Unknown to the assignment service: nothing to enforce
+		{uuid.New(), "never-started", nil},
+	} {
+		submission := &core.Submission{AssignmentID: c.assignmentID, StudentID: c.student}
+		err := svc.Submit(context.Background(), submission, nil)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s submitting: got %v, want %v", c.student, err, c.want)
+		}
+		if err == nil && submission.ID == uuid.Nil {
+			t.Errorf("%s: accepted submission was not stored", c.student)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+var ErrTranscriptForbidden = errors.New("not allowed to see this student's transcript")
+
+// TranscriptViewer is who a transcript is built for. Unless All is set they
+// are an instructor and see only the classes they teach a section of, or a
+// guardian, who sees the whole transcript of a student linked to them and
+// nothing of anyone else's.
+type TranscriptViewer struct {
+	UserID   string
+	All      bool
+	Guardian bool
+}
+
+// Transcript returns the student's grade in each class they are enrolled
+// in or have submitted to, which covers classes they have since left,
+// grouped by the classes' terms. A class's grade is the weighted average of
+// its released grades; see transcriptClass for what counts.
+func (s *submissionService) Transcript(ctx context.Context, studentID string, viewer TranscriptViewer) (*core.Transcript, error) {
+	if viewer.Guardian && !viewer.All {
+		// Checked on every request, so a revoked link cuts access at once
+		linked, err := s.users.IsGuardianOf(ctx, viewer.UserID, studentID)
+		if err != nil {
+			return nil, fmt.Errorf("students of guardian %s: %w", viewer.UserID, err)
+		}
+		if !linked {
+			return nil, ErrTranscriptForbidden
+		}
+		viewer.All = true
+	}
+
+	enrollments, err := s.users.GetUserEnrollments(ctx, studentID)
+	if err != nil {
+		return nil, fmt.Errorf("enrollments of %s: %w", studentID, err)
+	}
+	sections := make(map[string]string, len(enrollments))
+	classIDs := make([]string, len(enrollments))
+	for i, e := range enrollments {
+		sections[e.ClassID] = e.SectionID
+		classIDs[i] = e.ClassID
+	}
+
+	grades, err := s.repo.ListStudentGrades(studentID)
+	if err != nil {
+		return nil, err
+	}
+	graded := make(map[uuid.UUID]core.StudentGrade, len(grades))
+	assignmentIDs := make([]uuid.UUID, len(grades))
+	for i, g := range grades {
+		graded[g.AssignmentID] = g
+		assignmentIDs[i] = g.AssignmentID
+	}
+
+	weights, err := s.assignments.StudentGradeWeights(ctx, studentID, classIDs, assignmentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("assignment weights of %s: %w", studentID, err)
+	}
+	classes, err := s.lookUpClasses(ctx, weights)
+	if err != nil {
+		return nil, fmt.Errorf("classes of %s: %w", studentID, err)
+	}
+
+	now := time.Now()
+	terms := make(map[string]*core.TranscriptTerm)
+	for _, w := range weights {
+		class, known := classes[w.CourseID]
+		if !viewer.All && !(known && slices.Contains(class.InstructorIDs, viewer.UserID)) {
+			continue
+		}
+		section, enrolled := sections[w.CourseID]
+		entry := transcriptClass(w, section, enrolled, graded, now)
+		entry.Name = class.Name
+
+		key := ""
+		if class.Term != nil {
+			key = class.Term.ID
+		}
+		term, ok := terms[key]
+		if !ok {
+			term = &core.TranscriptTerm{Classes: []core.TranscriptClass{}}
+			if class.Term != nil {
+				term.TermID = class.Term.ID
+				term.Name = class.Term.Name
+				term.StartsOn = &class.Term.StartsOn
+				term.EndsOn = &class.Term.EndsOn
+			}
+			terms[key] = term
+		}
+		term.Classes = append(term.Classes, entry)
+	}
+	if !viewer.All && len(terms) == 0 {
+		return nil, ErrTranscriptForbidden
+	}
+
+	transcript := &core.Transcript{StudentID: studentID, Terms: make([]core.TranscriptTerm, 0, len(terms))}
+	for _, term := range terms {
+		sort.Slice(term.Classes, func(i, j int) bool { return term.Classes[i].Name < term.Classes[j].Name })
+		transcript.Terms = append(transcript.Terms, *term)
+	}
+	sort.Slice(transcript.Terms, func(i, j int) bool {
+		a, b := transcript.Terms[i], transcript.Terms[j]
+		if a.StartsOn == nil || b.StartsOn == nil {
+			return b.StartsOn == nil && a.StartsOn != nil
+		}
+		return a.StartsOn.Before(*b.StartsOn)
+	})
+	return transcript, nil
+}
+
+// lookUpClasses fetches the names, terms and instructors of the classes,
+// by ID. Classes identity does not know are left out.
+func (s *submissionService) lookUpClasses(ctx context.Context, weights []core.ClassGradeWeights) (map[string]clients.Class, error) {
+	var ids []string
+	for _, w := range weights {
+		// Course IDs are free text in the assignment service; only UUIDs
+		// can be identity classes
+		if _, err := uuid.Parse(w.CourseID); err == nil {
+			ids = append(ids, w.CourseID)
+		}
+	}
+
+	classes := make(map[string]clients.Class, len(ids))
+	for start := 0; start < len(ids); start += maxUserBatch {
+		batch, err := s.users.GetClasses(ctx, ids[start:min(start+maxUserBatch, len(ids))])
+		if err != nil {
+			return nil, err
+		}
+		for _, class := range batch {
+			classes[class.ID] = class
+		}
+	}
+	return classes, nil
+}
+
+// transcriptClass works out the student's grade in a class. A released
+// grade counts at its percentage of the assignment's points. A grade not
+// released yet is pending and does not count, nor does an assignment still
+// open. One that closed without a submission counts as zero if the class's
+// policy says so and is left out otherwise. Assignments for a section the
+// student is not in are only listed if they submitted to them.
+func transcriptClass(w core.ClassGradeWeights, sectionID string, enrolled bool, grades map[uuid.UUID]core.StudentGrade, now time.Time) core.TranscriptClass {
+	class := core.TranscriptClass{
+		ClassID:       w.CourseID,
+		Enrolled:      enrolled,
+		MissingAsZero: w.MissingAsZero,
+		Assignments:   []core.TranscriptAssignment{},
+	}
+
+	var weighted float64
+	for _, a := range w.Assignments {
+		grade, submitted := grades[a.ID]
+		if a.SectionID != nil && a.SectionID.String() != sectionID && !submitted {
+			continue
+		}
+
+		entry := core.TranscriptAssignment{
+			AssignmentID: a.ID,
+			Title:        a.Title,
+			Weight:       a.Weight,
+			TotalScore:   a.TotalScore,
+			DueDate:      a.DueDate,
+		}
+		var percentage float64
+		switch {
+		case submitted && grade.Released:
+			entry.Status = core.TranscriptGraded
+			entry.Score = &grade.Score
+			if a.TotalScore > 0 {
+				percentage = 100 * float64(grade.Score) / float64(a.TotalScore)
+				entry.Counted = true
+			}
+		case submitted:
+			entry.Status = core.TranscriptPending
+			class.Pending++
+		case now.After(a.ClosesAt):
+			entry.Status = core.TranscriptMissing
+			entry.Counted = w.MissingAsZero
+		default:
+			entry.Status = core.TranscriptOpen
+		}
+		if entry.Counted {
+			entry.Percentage = roundPercentage(percentage)
+			class.CountedWeight += a.Weight
+			weighted += float64(a.Weight) * percentage
+		}
+		class.TotalWeight += a.Weight
+		class.Assignments = append(class.Assignments, entry)
+	}
+
+	if class.CountedWeight > 0 {
+		class.Percentage = roundPercentage(weighted / float64(class.CountedWeight))
+	}
+	return class
+}
+
+// roundPercentage rounds to two decimal places
+func roundPercentage(p float64) *float64 {
+	rounded := math.Round(p*100) / 100
+	return &rounded
+}
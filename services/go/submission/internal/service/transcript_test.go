@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/libs/clients"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/repository"
+	"github.com/google/uuid"
+)
+
+func TestTranscriptWeighting(t *testing.T) {
+	now := time.Now()
+	graded, pending, missing, open := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	weights := core.ClassGradeWeights{
+		CourseID: "algo101",
+		Assignments: []core.GradedAssignment{
+			{ID: graded, Title: "Sorting", Weight: 40, TotalScore: 50, ClosesAt: now.Add(-48 * time.Hour)},
+			{ID: pending, Title: "Graphs", Weight: 20, TotalScore: 10, ClosesAt: now.Add(-24 * time.Hour)},
+			{ID: missing, Title: "Heaps", Weight: 30, TotalScore: 20, ClosesAt: now.Add(-time.Hour)},
+			{ID: open, Title: "Tries", Weight: 10, TotalScore: 20, ClosesAt: now.Add(time.Hour)},
+		},
+	}
+	grades := map[uuid.UUID]core.StudentGrade{
+		graded:  {AssignmentID: graded, Score: 40, Released: true},
+		pending: {AssignmentID: pending, Score: 10},
+	}
+
+	for _, tc := range []struct {
+		missingAsZero bool
+		percentage    float64
+		counted       int
+	}{
+		// Only the graded assignment counts: 40/50
+		{missingAsZero: false, percentage: 80, counted: 40},
+		// The missing one counts as 0: (40*80 + 30*0) / 70
+		{missingAsZero: true, percentage: 45.71, counted: 70},
+	} {
+		weights.MissingAsZero = tc.missingAsZero
+		class := transcriptClass(weights, "", true, grades, now)
+		if class.Percentage == nil || *class.Percentage != tc.percentage || class.CountedWeight != tc.counted {
+			t.Errorf("missing as zero %v: %v%% over weight %d, want %v%% over %d", tc.missingAsZero, class.Percentage, class.CountedWeight, tc.percentage, tc.counted)
+		}
+		if class.TotalWeight != 100 || class.Pending != 1 {
+			t.Errorf("missing as zero %v: total weight %d, %d pending", tc.missingAsZero, class.TotalWeight, class.Pending)
+		}
+		statuses := map[uuid.UUID]core.TranscriptStatus{}
+		for _, a := range class.Assignments {
+			statuses[a.AssignmentID] = a.Status
+			if a.AssignmentID == pending && a.Score != nil {
+				t.Errorf("unreleased grade shown: %d", *a.Score)
+			}
+		}
+		if statuses[graded] != core.TranscriptGraded || statuses[pending] != core.TranscriptPending || statuses[missing] != core.TranscriptMissing || statuses[open] != core.TranscriptOpen {
+			t.Errorf("statuses = %v", statuses)
+		}
+	}
+
+	// An assignment for another section is only listed if submitted to
+	section := uuid.New()
+	weights.Assignments = append(weights.Assignments, core.GradedAssignment{ID: uuid.New(), SectionID: &section, Weight: 50, TotalScore: 10, ClosesAt: now.Add(-time.Hour)})
+	if class := transcriptClass(weights, uuid.NewString(), true, grades, now); len(class.Assignments) != 4 {
+		t.Errorf("listed %d assignments, want the other section's left out", len(class.Assignments))
+	}
+}
+
+// transcriptAssignments serves the weights of the classes' assignments
+type transcriptAssignments struct {
+	fakeAssignments
+	weights []core.ClassGradeWeights
+}
+
+func (f *transcriptAssignments) StudentGradeWeights(context.Context, string, []string, []uuid.UUID) ([]core.ClassGradeWeights, error) {
+	return f.weights, nil
+}
+
+// transcriptUsers is identity for one student enrolled in some classes
+type transcriptUsers struct {
+	directory
+	enrollments []clients.Enrollment
+	classes     []clients.Class
+	// guardians maps each guardian to the student they have an active link to
+	guardians map[string]string
+}
+
+func (u *transcriptUsers) GetUserEnrollments(context.Context, string) ([]clients.Enrollment, error) {
+	return u.enrollments, nil
+}
+
+func (u *transcriptUsers) GetClasses(context.Context, []string) ([]clients.Class, error) {
+	return u.classes, nil
+}
+
+func (u *transcriptUsers) IsGuardianOf(_ context.Context, guardianID, studentID string) (bool, error) {
+	return u.guardians[guardianID] == studentID, nil
+}
+
+func TestTranscriptIsLimitedToTheViewersClasses(t *testing.T) {
+	current, left := uuid.NewString(), uuid.NewString()
+	currentLab, leftLab := uuid.New(), uuid.New()
+	closed := time.Now().Add(-time.Hour)
+	assignments := &transcriptAssignments{weights: []core.ClassGradeWeights{
+		{CourseID: current, Assignments: []core.GradedAssignment{{ID: currentLab, Weight: 100, TotalScore: 10, ClosesAt: closed}}},
+		{CourseID: left, Assignments: []core.GradedAssignment{{ID: leftLab, Weight: 100, TotalScore: 10, ClosesAt: closed}}},
+	}}
+	users := &transcriptUsers{
+		enrollments: []clients.Enrollment{{ClassID: current}},
+		classes: []clients.Class{
+			{ID: current, Name: "Algorithms", InstructorIDs: []string{"instructor-1"}, Term: &clients.Term{ID: "term-2", Name: "Spring", StartsOn: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)}},
+			{ID: left, Name: "Databases", InstructorIDs: []string{"instructor-2"}, Term: &clients.Term{ID: "term-1", Name: "Autumn", StartsOn: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)}},
+		},
+	}
+	_, db := newTestService(t, &assignments.fakeAssignments)
+	svc := NewSubmissionService(repository.NewRepository(db), nil, assignments, users, testGracePeriod, nil, time.Hour, nil, time.Minute)
+
+	released := time.Now()
+	for id, score := range map[uuid.UUID]int{currentLab: 9, leftLab: 6} {
+		s := createSubmission(t, db, id, "student-1")
+		if err := db.Model(s).Updates(map[string]interface{}{"score": score, "grade_released_at": released}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Everything, earliest term first, including the class the student left
+	transcript, err := svc.Transcript(context.Background(), "student-1", TranscriptViewer{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcript.Terms) != 2 || transcript.Terms[0].TermID != "term-1" || transcript.Terms[1].TermID != "term-2" {
+		t.Fatalf("terms = %+v, want autumn then spring", transcript.Terms)
+	}
+	leftClass := transcript.Terms[0].Classes[0]
+	if leftClass.Enrolled || leftClass.Percentage == nil || *leftClass.Percentage != 60 {
+		t.Errorf("class the student left = %+v, want it at 60%% and not enrolled", leftClass)
+	}
+
+	// An instructor only sees the class they teach
+	transcript, err = svc.Transcript(context.Background(), "student-1", TranscriptViewer{UserID: "instructor-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcript.Terms) != 1 || len(transcript.Terms[0].Classes) != 1 || transcript.Terms[0].Classes[0].ClassID != current {
+		t.Errorf("instructor-1 sees %+v, want only Algorithms", transcript.Terms)
+	}
+	if _, err := svc.Transcript(context.Background(), "student-1", TranscriptViewer{UserID: "instructor-3"}); !errors.Is(err, ErrTranscriptForbidden) {
+		t.Errorf("instructor of none of the classes: got %v, want ErrTranscriptForbidden", err)
+	}
+}
+
+func TestGuardianSeesOnlyALinkedStudentsReleasedGrades(t *testing.T) {
+	algorithms, databases := uuid.NewString(), uuid.NewString()
+	released, unreleased := uuid.New(), uuid.New()
+	closed := time.Now().Add(-time.Hour)
+	assignments := &transcriptAssignments{weights: []core.ClassGradeWeights{
+		{CourseID: algorithms, Assignments: []core.GradedAssignment{{ID: released, Weight: 100, TotalScore: 10, ClosesAt: closed}}},
+		{CourseID: databases, Assignments: []core.GradedAssignment{{ID: unreleased, Weight: 100, TotalScore: 10, ClosesAt: closed}}},
+	}}
+	users := &transcriptUsers{
+		enrollments: []clients.Enrollment{{ClassID: algorithms}, {ClassID: databases}},
+		classes: []clients.Class{
+			{ID: algorithms, Name: "Algorithms", InstructorIDs: []string{"instructor-1"}},
+			{ID: databases, Name: "Databases", InstructorIDs: []string{"instructor-2"}},
+		},
+		guardians: map[string]string{"guardian-1": "student-1"},
+	}
+	_, db := newTestService(t, &assignments.fakeAssignments)
+	svc := NewSubmissionService(repository.NewRepository(db), nil, assignments, users, testGracePeriod, nil, time.Hour, nil, time.Minute)
+
+	graded := createSubmission(t, db, released, "student-1")
+	if err := db.Model(graded).Updates(map[string]interface{}{"score": 8, "grade_released_at": time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	draft := createSubmission(t, db, unreleased, "student-1")
+	if err := db.Model(draft).Update("score", 3).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	guardian := TranscriptViewer{UserID: "guardian-1", Guardian: true}
+
+	// Every class of the linked student, but only the grade that was released
+	transcript, err := svc.Transcript(ctx, "student-1", guardian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := map[uuid.UUID]*int{}
+	for _, term := range transcript.Terms {
+		for _, class := range term.Classes {
+			for _, a := range class.Assignments {
+				scores[a.AssignmentID] = a.Score
+			}
+		}
+	}
+	if len(scores) != 2 || scores[released] == nil || *scores[released] != 8 {
+		t.Fatalf("guardian sees scores %v, want both classes with the released 8", scores)
+	}
+	if scores[unreleased] != nil {
+		t.Errorf("guardian sees the unreleased grade %d", *scores[unreleased])
+	}
+
+	if _, err := svc.Transcript(ctx, "student-2", guardian); !errors.Is(err, ErrTranscriptForbidden) {
+		t.Errorf("another student's transcript: got %v, want ErrTranscriptForbidden", err)
+	}
+
+	// Revoking the link cuts access on the next request
+	delete(users.guardians, "guardian-1")
+	if _, err := svc.Transcript(ctx, "student-1", guardian); !errors.Is(err, ErrTranscriptForbidden) {
+		t.Errorf("after the link was revoked: got %v, want ErrTranscriptForbidden", err)
+	}
+}
@@ -0,0 +1,65 @@
+package similarity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+	"github.com/google/uuid"
+)
+
+// Submission is one submission sent to the checker, with the contents of
+// its files
+type Submission struct {
+	ID    uuid.UUID `json:"id"`
+	Files []File    `json:"files"`
+}
+
+type File struct {
+	Name    string `json:"name"`
+	Content []byte `json:"content"`
+}
+
+// Pair is two submissions the checker found alike, with a score from 0 to 1
+type Pair struct {
+	A     uuid.UUID `json:"a"`
+	B     uuid.UUID `json:"b"`
+	Score float64   `json:"score"`
+}
+
+// Done is returned by a Source once every submission has been handed out
+var Done = errors.New("no more submissions")
+
+// Source hands out the submissions to compare one at a time, so they never
+// have to be held in memory together. It returns Done after the last one.
+type Source func(ctx context.Context) (*Submission, error)
+
+// Checker compares every submission of an assignment with every other one.
+// It reads the submissions from next and calls emit for each pair scoring
+// at least params.MinScore, in any order.
+type Checker interface {
+	Check(ctx context.Context, params core.SimilarityParameters, next Source, emit func(Pair) error) error
+}
+
+// Config selects and configures a Checker
+type Config struct {
+	// URL is the endpoint of the external checker; no checker runs without it
+	URL string
+	// Token, if set, is sent as a bearer token
+	Token string
+	// Timeout bounds a whole check, including sending every submission
+	Timeout time.Duration
+}
+
+// New returns the checker cfg configures, or nil if none is
+func New(cfg Config) (Checker, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("similarity checker timeout must be positive, got %s", cfg.Timeout)
+	}
+	return NewHTTP(cfg.URL, cfg.Token, cfg.Timeout), nil
+}
@@ -0,0 +1,104 @@
+package similarity
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/4yrg/gradeloop-core/services/go/submission/internal/core"
+)
+
+// HTTP talks to a checker over a single streamed POST. The request body is
+// newline-delimited JSON: a first line {"parameters": {...}}, then one
+// Submission per line, file contents base64-encoded. The response is one
+// Pair per line, and may start before the request has been sent in full.
+type HTTP struct {
+	url        string
+	token      string
+	timeout    time.Duration
+	httpClient *http.Client
+}
+
+func NewHTTP(url, token string, timeout time.Duration) *HTTP {
+	return &HTTP{url: url, token: token, timeout: timeout, httpClient: &http.Client{}}
+}
+
+func (h *HTTP) Check(ctx context.Context, params core.SimilarityParameters, next Source, emit func(Pair) error) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	body, writer := io.Pipe()
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		writer.CloseWithError(writeSubmissions(ctx, writer, params, next))
+	}()
+	// Closing the body unblocks the writer if the request ends before it
+	// was read; next is not called once Check has returned
+	defer func() {
+		body.Close()
+		cancel()
+		<-written
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Accept", "application/x-ndjson")
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach similarity checker: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("similarity checker returned status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var pair Pair
+		if err := json.Unmarshal(scanner.Bytes(), &pair); err != nil {
+			return fmt.Errorf("failed to decode similarity checker response: %w", err)
+		}
+		if err := emit(pair); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read similarity checker response: %w", err)
+	}
+	return nil
+}
+
+// writeSubmissions encodes the request body as next hands out submissions
+func writeSubmissions(ctx context.Context, w io.Writer, params core.SimilarityParameters, next Source) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(map[string]interface{}{"parameters": params}); err != nil {
+		return err
+	}
+	for {
+		submission, err := next(ctx)
+		if errors.Is(err, Done) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(submission); err != nil {
+			return err
+		}
+	}
+}
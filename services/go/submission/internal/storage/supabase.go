@@ -1,112 +1,63 @@
 package storage
 
 import (
-	"bytes"
 	"context"
-	"fmt"
 	"io"
-	"net/http"
-	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/4yrg/gradeloop-core/libs/storage"
 	"github.com/google/uuid"
 )
 
+// QuarantinePrefix is where uploads are kept until they have been scanned
+const QuarantinePrefix = "quarantine"
+
+// QuarantinePath is where the file at path is kept while it is quarantined
+func QuarantinePath(path string) string {
+	return filepath.Join(QuarantinePrefix, path)
+}
+
 // StorageClient defines the interface for file storage operations
 type StorageClient interface {
-	UploadFile(ctx context.Context, assignmentID, studentID, submissionID uuid.UUID, filename string, content []byte) (string, error)
+	// SubmissionPath is where a submitted file is kept once it is found clean
+	SubmissionPath(assignmentID, studentID, submissionID uuid.UUID, filename string) string
+	UploadFile(ctx context.Context, path string, content []byte) error
+	// UploadStream stores what body yields without holding it in memory
+	UploadStream(ctx context.Context, path, contentType string, body io.Reader) error
+	DownloadFile(ctx context.Context, path string) (io.ReadCloser, error)
+	MoveFile(ctx context.Context, from, to string) error
 	GetFileURL(path string) string
+	// SignedURL returns a download link for the file that lasts expiresIn
+	SignedURL(ctx context.Context, path string, expiresIn time.Duration) (string, error)
 	DeleteFile(ctx context.Context, path string) error
 	DeleteSubmissionFiles(ctx context.Context, assignmentID, studentID, submissionID uuid.UUID) error
 }
 
+// supabaseStorage is the shared libs/storage client with the paths of
+// submitted files on top
 type supabaseStorage struct {
-	url        string
-	serviceKey string
-	bucket     string
-	httpClient *http.Client
+	*storage.Supabase
 }
 
 // NewSupabaseStorage creates a new Supabase storage client
 func NewSupabaseStorage() (StorageClient, error) {
-	url := os.Getenv("SUPABASE_URL")
-	serviceKey := os.Getenv("SUPABASE_SERVICE_KEY")
-	bucket := os.Getenv("SUPABASE_STORAGE_BUCKET")
-
-	if url == "" || serviceKey == "" || bucket == "" {
-		return nil, fmt.Errorf("missing Supabase configuration: SUPABASE_URL, SUPABASE_SERVICE_KEY, or SUPABASE_STORAGE_BUCKET")
-	}
-
-	return &supabaseStorage{
-		url:        url,
-		serviceKey: serviceKey,
-		bucket:     bucket,
-		httpClient: &http.Client{},
-	}, nil
-}
-
-// buildPath creates the storage path: submissions/{assignmentId}/{studentId}/{submissionId}/filename
-func (s *supabaseStorage) buildPath(assignmentID, studentID, submissionID uuid.UUID, filename string) string {
-	return filepath.Join("submissions", assignmentID.String(), studentID.String(), submissionID.String(), filename)
-}
-
-// UploadFile uploads a file to Supabase storage
-func (s *supabaseStorage) UploadFile(ctx context.Context, assignmentID, studentID, submissionID uuid.UUID, filename string, content []byte) (string, error) {
-	path := s.buildPath(assignmentID, studentID, submissionID, filename)
-
-	// Supabase Storage API endpoint
-	uploadURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.url, s.bucket, path)
-
-	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, bytes.NewReader(content))
-	if err != nil {
-		return "", fmt.Errorf("failed to create upload request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
-	req.Header.Set("Content-Type", "application/octet-stream")
-
-	resp, err := s.httpClient.Do(req)
+	files, err := storage.NewSupabase(storage.ConfigFromEnv())
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, err
 	}
-
-	return s.GetFileURL(path), nil
+	return &supabaseStorage{Supabase: files}, nil
 }
 
-// GetFileURL returns the public URL for a file
-func (s *supabaseStorage) GetFileURL(path string) string {
-	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.url, s.bucket, path)
+// ArchivePath is where the zip an archive job builds is kept:
+// archives/{assignmentId}/{jobId}.zip
+func ArchivePath(assignmentID, jobID uuid.UUID) string {
+	return filepath.Join("archives", assignmentID.String(), jobID.String()+".zip")
 }
 
-// DeleteFile deletes a single file from storage
-func (s *supabaseStorage) DeleteFile(ctx context.Context, path string) error {
-	deleteURL := fmt.Sprintf("%s/storage/v1/object/%s/%s", s.url, s.bucket, path)
-
-	req, err := http.NewRequestWithContext(ctx, "DELETE", deleteURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create delete request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
-
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to delete file: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	return nil
+// SubmissionPath creates the storage path: submissions/{assignmentId}/{studentId}/{submissionId}/filename
+func (s *supabaseStorage) SubmissionPath(assignmentID, studentID, submissionID uuid.UUID, filename string) string {
+	return filepath.Join("submissions", assignmentID.String(), studentID.String(), submissionID.String(), filename)
 }
 
 // DeleteSubmissionFiles deletes all files for a submission
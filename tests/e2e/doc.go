@@ -0,0 +1,10 @@
+// Package e2e runs the login flows across authn, identity, session and authz.
+// Each service is built the way its main builds it, through its pkg/server,
+// and served in-process over HTTP on SQLite and miniredis; the email service
+// is a stand-in that logs what it was asked to send.
+//
+// The gateway tests run against the Kong of the dev stack instead, and are
+// skipped unless E2E_KONG_URL points at it.
+//
+// The scenarios are tests: go test ./... in this directory runs them.
+package e2e
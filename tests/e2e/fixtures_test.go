@@ -0,0 +1,172 @@
+package e2e
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// institute is an institute created through identity's API
+type institute struct {
+	ID     string
+	Domain string
+}
+
+// createInstitute creates an institute whose users have emails at domain
+func (s *stack) createInstitute(name, domain string) institute {
+	s.t.Helper()
+	code := strings.ToUpper(strings.SplitN(domain, ".", 2)[0])
+	resp := s.mustCall(http.StatusCreated, s.identity, "POST", "/orgs/institutes", map[string]interface{}{
+		"name":          name,
+		"code":          code,
+		"domain":        domain,
+		"contact_email": "office@" + domain,
+	})
+	var created struct {
+		ID string `json:"id"`
+	}
+	resp.decode(s.t, &created)
+	return institute{ID: created.ID, Domain: domain}
+}
+
+// createClass creates a class in a new faculty and department of inst
+func (s *stack) createClass(inst institute, name string) string {
+	s.t.Helper()
+	var faculty, department, class struct {
+		ID string `json:"id"`
+	}
+	s.mustCall(http.StatusCreated, s.identity, "POST", "/orgs/faculties", map[string]string{
+		"institute_id": inst.ID,
+		"name":         "Faculty of " + name,
+	}).decode(s.t, &faculty)
+	s.mustCall(http.StatusCreated, s.identity, "POST", "/orgs/departments", map[string]string{
+		"faculty_id": faculty.ID,
+		"name":       "Department of " + name,
+	}).decode(s.t, &department)
+	s.mustCall(http.StatusCreated, s.identity, "POST", "/orgs/classes", map[string]interface{}{
+		"department_id": department.ID,
+		"name":          name,
+	}).decode(s.t, &class)
+	return class.ID
+}
+
+// openSelfRegistration lets students with an email at the institute's domain
+// sign up, joining defaultClassID unless it is ""
+func (s *stack) openSelfRegistration(inst institute, defaultClassID string) {
+	s.t.Helper()
+	update := map[string]interface{}{
+		"allow_self_registration": true,
+		"allowed_email_domains":   []string{inst.Domain},
+	}
+	if defaultClassID != "" {
+		update["default_class_id"] = defaultClassID
+	}
+	s.mustCall(http.StatusOK, s.identity, "PATCH", "/orgs/institutes/"+inst.ID, update)
+}
+
+// tokens is what authn answers a login with
+type tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Role         string `json:"role"`
+	Email        string `json:"email"`
+	UserID       string `json:"user_id"`
+	Institutes   []struct {
+		InstituteID string `json:"institute_id"`
+		Role        string `json:"role"`
+	} `json:"institutes"`
+}
+
+// createStudent signs a student up at an institute open to self-registration
+// and confirms their email, which logs them in
+func (s *stack) createStudent(email, name, enrollmentNumber string) tokens {
+	s.t.Helper()
+	s.mustCall(http.StatusCreated, s.authn, "POST", "/auth/register", map[string]string{
+		"email":             email,
+		"full_name":         name,
+		"enrollment_number": enrollmentNumber,
+	})
+	var confirmed tokens
+	s.mustCall(http.StatusOK, s.authn, "POST", "/auth/verify-email", map[string]string{
+		"token": s.linkToken(email, "confirm"),
+	}).decode(s.t, &confirmed)
+	return confirmed
+}
+
+// login logs in with a magic link, as the user would from their inbox
+func (s *stack) login(email string) tokens {
+	s.t.Helper()
+	s.mustCall(http.StatusOK, s.authn, "POST", "/auth/login", map[string]string{"email": email})
+	var loggedIn tokens
+	s.mustCall(http.StatusOK, s.authn, "POST", "/auth/magic-link/consume", map[string]string{
+		"token": s.linkToken(email, "login"),
+	}).decode(s.t, &loggedIn)
+	return loggedIn
+}
+
+// linkToken returns the token of the latest link of kind (confirm or login)
+// mailed to recipient
+func (s *stack) linkToken(recipient, kind string) string {
+	s.t.Helper()
+	rows := s.emails.to(recipient)
+	for i := len(rows) - 1; i >= 0; i-- {
+		for _, field := range strings.Fields(rows[i].Body) {
+			link, err := url.Parse(field)
+			if err != nil || link.Query().Get("type") != kind {
+				continue
+			}
+			if token := link.Query().Get("token"); token != "" {
+				return token
+			}
+		}
+	}
+	s.t.Fatalf("no %s link was mailed to %s", kind, recipient)
+	return ""
+}
+
+// bearer is the header pair for calling with an access token
+func bearer(accessToken string) []string {
+	return []string{"Authorization", "Bearer " + accessToken}
+}
+
+// internal is the header pair for calling an internal route
+func internal() []string {
+	return []string{"X-Internal-Token", internalToken}
+}
+
+// sessionRow is a row of the session service's sessions table
+type sessionRow struct {
+	ID              string
+	UserID          string
+	RotationCounter int
+	RevokedAt       *time.Time
+}
+
+// sessions returns the user's session rows
+func (s *stack) sessions(userID string) []sessionRow {
+	s.t.Helper()
+	var rows []sessionRow
+	if err := s.sessionDB.Table("sessions").Where("user_id = ?", userID).Order("created_at").Find(&rows).Error; err != nil {
+		s.t.Fatal(err)
+	}
+	return rows
+}
+
+// auditRow is a row of authz's audit_logs table
+type auditRow struct {
+	Subject  string
+	Resource string
+	Action   string
+	Decision string
+}
+
+// audits returns the audit rows of the subject's permission checks
+func (s *stack) audits(subject string) []auditRow {
+	s.t.Helper()
+	var rows []auditRow
+	if err := s.authzDB.Table("audit_logs").Where("subject = ?", subject).Order("timestamp").Find(&rows).Error; err != nil {
+		s.t.Fatal(err)
+	}
+	return rows
+}
@@ -0,0 +1,139 @@
+package e2e
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStudentSignsUpAndLogsIn(t *testing.T) {
+	s := startStack(t)
+	inst := s.createInstitute("Northfield University", "northfield.test")
+	classID := s.createClass(inst, "Algorithms")
+	s.openSelfRegistration(inst, classID)
+
+	// Register, then confirm the email from the link mailed
+	const email = "ada@northfield.test"
+	s.mustCall(http.StatusCreated, s.authn, "POST", "/auth/register", map[string]string{
+		"email":             email,
+		"full_name":         "Ada Lovelace",
+		"enrollment_number": "NF-0001",
+	})
+	mails := s.emails.to(email)
+	if len(mails) != 1 || !strings.Contains(mails[0].Subject, "Confirm") {
+		t.Fatalf("emails to %s = %+v, want the confirmation", email, mails)
+	}
+	var confirmed tokens
+	s.mustCall(http.StatusOK, s.authn, "POST", "/auth/verify-email", map[string]string{
+		"token": s.linkToken(email, "confirm"),
+	}).decode(t, &confirmed)
+	if confirmed.UserID == "" || confirmed.Role != "STUDENT" || confirmed.AccessToken == "" {
+		t.Fatalf("confirming logged in as %+v, want a student with tokens", confirmed)
+	}
+	userID := confirmed.UserID
+
+	var user struct {
+		Status string `json:"status"`
+	}
+	s.mustCall(http.StatusOK, s.identity, "GET", "/internal/identity/users/"+userID, nil, internal()...).decode(t, &user)
+	if user.Status != "active" {
+		t.Errorf("user status after confirming = %q, want active", user.Status)
+	}
+	var enrolled int64
+	if err := s.identityDB.Table("class_enrollments").Where("student_id = ? AND class_id = ?", userID, classID).Count(&enrolled).Error; err != nil {
+		t.Fatal(err)
+	}
+	if enrolled != 1 {
+		t.Errorf("student is not enrolled in the institute's default class")
+	}
+
+	// Log in again with a magic link
+	loggedIn := s.login(email)
+	if loggedIn.UserID != userID {
+		t.Fatalf("magic link logged in user %s, want %s", loggedIn.UserID, userID)
+	}
+	if rows := s.sessions(userID); len(rows) != 2 || rows[1].RevokedAt != nil {
+		t.Fatalf("sessions = %+v, want one for the confirmation and one for the login", rows)
+	}
+
+	// The access token is accepted by authn and by identity, which verifies
+	// it against authn's keys
+	var claims struct {
+		UserID    string `json:"sub"`
+		SessionID string `json:"session_id"`
+	}
+	s.mustCall(http.StatusOK, s.authn, "GET", "/auth/validate", nil, bearer(loggedIn.AccessToken)...).decode(t, &claims)
+	if claims.UserID != userID {
+		t.Errorf("validated token is for %s, want %s", claims.UserID, userID)
+	}
+	s.mustCall(http.StatusAccepted, s.identity, "GET", "/internal/identity/users/"+userID+"/export", nil, append(internal(), bearer(loggedIn.AccessToken)...)...)
+
+	// Refresh rotates the session's refresh token. Refreshing again with the
+	// old one right away, as a second tab would, gets the same successor.
+	var refreshed, again tokens
+	s.mustCall(http.StatusOK, s.authn, "POST", "/auth/refresh", map[string]string{"refresh_token": loggedIn.RefreshToken}).decode(t, &refreshed)
+	if refreshed.AccessToken == "" || refreshed.RefreshToken == loggedIn.RefreshToken {
+		t.Fatalf("refresh returned %+v, want new tokens", refreshed)
+	}
+	s.mustCall(http.StatusOK, s.authn, "POST", "/auth/refresh", map[string]string{"refresh_token": loggedIn.RefreshToken}).decode(t, &again)
+	if again.RefreshToken != refreshed.RefreshToken {
+		t.Fatalf("second refresh with the rotated token got %q, want the first's %q", again.RefreshToken, refreshed.RefreshToken)
+	}
+	s.mustCall(http.StatusOK, s.authn, "GET", "/auth/validate", nil, bearer(refreshed.AccessToken)...)
+
+	// Logging out revokes the session; its tokens stop working everywhere
+	s.mustCall(http.StatusOK, s.authn, "POST", "/auth/logout", nil, bearer(refreshed.AccessToken)...)
+	for _, row := range s.sessions(userID) {
+		if row.ID == claims.SessionID && row.RevokedAt == nil {
+			t.Errorf("session %s is not revoked after logout", row.ID)
+		}
+	}
+	s.mustCall(http.StatusUnauthorized, s.authn, "GET", "/auth/validate", nil, bearer(refreshed.AccessToken)...)
+	s.mustCall(http.StatusUnauthorized, s.identity, "GET", "/internal/identity/users/"+userID+"/export", nil, append(internal(), bearer(refreshed.AccessToken)...)...)
+	s.mustCall(http.StatusUnauthorized, s.authn, "POST", "/auth/refresh", map[string]string{"refresh_token": refreshed.RefreshToken})
+}
+
+func TestInstituteAdminInvite(t *testing.T) {
+	s := startStack(t)
+	inst := s.createInstitute("Southbank College", "southbank.test")
+	s.openSelfRegistration(inst, s.createClass(inst, "Databases"))
+	student := s.createStudent("alan@southbank.test", "Alan Turing", "SB-0001")
+
+	// Inviting an admin creates their account and mails them the invitation
+	const email = "grace@southbank.test"
+	s.mustCall(http.StatusCreated, s.identity, "POST", "/orgs/institutes/"+inst.ID+"/admins", map[string]string{
+		"name":  "Grace Hopper",
+		"email": email,
+	})
+	mails := s.emails.to(email)
+	if len(mails) != 1 || mails[0].Template != "institute_admin_invitation" {
+		t.Fatalf("emails to %s = %+v, want the invitation", email, mails)
+	}
+	if mails[0].Data["institute_name"] != "Southbank College" || mails[0].Data["login_url"] == "" {
+		t.Errorf("invitation data = %v, want the institute and where to log in", mails[0].Data)
+	}
+
+	// The admin logs in with a magic link and is bound to the institute
+	admin := s.login(email)
+	if admin.Role != "INSTITUTE_ADMIN" {
+		t.Errorf("admin logged in with role %q", admin.Role)
+	}
+	if len(admin.Institutes) != 1 || admin.Institutes[0].InstituteID != inst.ID || admin.Institutes[0].Role != "OWNER" {
+		t.Errorf("admin's institutes = %+v, want ownership of %s", admin.Institutes, inst.ID)
+	}
+	if rows := s.sessions(admin.UserID); len(rows) != 1 {
+		t.Errorf("admin has %d sessions, want 1", len(rows))
+	}
+
+	// Exporting a student's data is for system admins; authz denies the
+	// institute admin, and the decision is audited
+	s.mustCall(http.StatusForbidden, s.identity, "GET", "/internal/identity/users/"+student.UserID+"/export", nil, append(internal(), bearer(admin.AccessToken)...)...)
+	s.eventually("the denied export to be audited", func() bool {
+		for _, row := range s.audits(admin.UserID) {
+			if row.Resource == "user_data" && row.Action == "export" && row.Decision == "DENY" {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,304 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The gateway tests check the upstream circuit breakers and timeout budgets
+// of infra/docker/kong/kong.yml against the Kong of the running dev stack
+// (infra/docker/compose.dev.yaml). They are skipped unless E2E_KONG_URL is
+// set. Rather than stopping a real service, each test serves a fake one and
+// points authn.upstream at it through the Admin API; kong.yml is loaded
+// back when the test ends. Breakers cool down for 10 seconds, so the tests
+// take about a minute.
+const (
+	gatewayUpstream = "authn.upstream"
+	gatewayTarget   = "authn-service:8003"
+	// An authn route without a token check at the gateway
+	gatewayRoute = "/api/v1/me/bootstrap"
+	// authn.upstream's active health check
+	gatewayProbePath = "/health/live"
+	// The passive checks' http_failures
+	gatewayFailures = 5
+	// The active checks' unhealthy interval, the breaker's cool-down
+	gatewayCoolDown = 10 * time.Second
+)
+
+// fakeUpstream answers every path the way its mode says: ok, fail (500) or
+// slow (after 5 seconds, past the 3 second budget). It counts the requests
+// to each path.
+type fakeUpstream struct {
+	mu       sync.Mutex
+	mode     string
+	requests map[string]int
+}
+
+func (f *fakeUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests[r.URL.Path]++
+	mode := f.mode
+	f.mu.Unlock()
+
+	switch mode {
+	case "slow":
+		time.Sleep(5 * time.Second)
+	case "fail":
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"code": "fake_failure"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func (f *fakeUpstream) setMode(mode string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mode = mode
+}
+
+// count is how many requests for path reached the fake
+func (f *fakeUpstream) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+// gateway is Kong with authn.upstream pointed at a fake
+type gateway struct {
+	t               *testing.T
+	proxyURL, admin string
+	upstream        *fakeUpstream
+}
+
+// startGateway serves a fake upstream where Kong can reach it, at
+// E2E_UPSTREAM_HOST (host.docker.internal unless set), and loads kong.yml
+// into Kong with authn.upstream's target swapped for it
+func startGateway(t *testing.T) *gateway {
+	t.Helper()
+	proxyURL := os.Getenv("E2E_KONG_URL")
+	if proxyURL == "" {
+		t.Skip("E2E_KONG_URL is not set")
+	}
+	g := &gateway{
+		t:        t,
+		proxyURL: proxyURL,
+		admin:    envOr("E2E_KONG_ADMIN_URL", "http://localhost:8445"),
+		upstream: &fakeUpstream{mode: "ok", requests: map[string]int{}},
+	}
+
+	l, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: g.upstream}
+	go func() { _ = server.Serve(l) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	config, err := os.ReadFile(envOr("E2E_KONG_CONFIG", "../../infra/docker/kong/kong.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	swapped := strings.Replace(string(config), "- target: "+gatewayTarget+"\n", "- target: "+envOr("E2E_UPSTREAM_HOST", "host.docker.internal")+":"+port+"\n", 1)
+	if swapped == string(config) {
+		t.Fatalf("%s is not a target in kong.yml", gatewayTarget)
+	}
+	g.loadConfig(swapped)
+	t.Cleanup(func() { g.loadConfig(string(config)) })
+
+	// Kong takes the config a moment after answering
+	deadline := time.Now().Add(20 * time.Second)
+	for g.call().status != http.StatusOK || g.upstream.count(gatewayRoute) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("requests to %s do not reach the fake upstream", gatewayRoute)
+		}
+		time.Sleep(time.Second)
+	}
+	return g
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// loadConfig replaces Kong's declarative config
+func (g *gateway) loadConfig(config string) {
+	g.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("config", "kong.yml")
+	if err != nil {
+		g.t.Fatal(err)
+	}
+	_, _ = io.WriteString(part, config)
+	_ = form.Close()
+	resp, err := http.Post(g.admin+"/config", form.FormDataContentType(), &body)
+	if err != nil {
+		g.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(resp.Body)
+		g.t.Fatalf("Kong did not take the config: %d %s", resp.StatusCode, clip(msg))
+	}
+}
+
+type gatewayResponse struct {
+	status     int
+	retryAfter string
+	code       string
+	took       time.Duration
+}
+
+// call makes one request to the route
+func (g *gateway) call() gatewayResponse {
+	g.t.Helper()
+	start := time.Now()
+	resp, err := http.Get(g.proxyURL + gatewayRoute)
+	if err != nil {
+		g.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		Code string `json:"code"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&envelope)
+	return gatewayResponse{
+		status:     resp.StatusCode,
+		retryAfter: resp.Header.Get("Retry-After"),
+		code:       envelope.Code,
+		took:       time.Since(start),
+	}
+}
+
+// health is the breaker state of the upstream's target, HEALTHY or UNHEALTHY
+func (g *gateway) health() string {
+	g.t.Helper()
+	resp, err := http.Get(g.admin + "/upstreams/" + gatewayUpstream + "/health")
+	if err != nil {
+		g.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var health struct {
+		Data []struct {
+			Health string `json:"health"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil || len(health.Data) == 0 {
+		g.t.Fatalf("reading %s's health: %v", gatewayUpstream, err)
+	}
+	return health.Data[0].Health
+}
+
+// waitFor waits up to within for the breaker to be in state
+func (g *gateway) waitFor(state string, within time.Duration) bool {
+	g.t.Helper()
+	for deadline := time.Now().Add(within); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		if g.health() == state {
+			return true
+		}
+	}
+	return false
+}
+
+// open fails requests until the breaker opens
+func (g *gateway) open() {
+	g.t.Helper()
+	g.upstream.setMode("fail")
+	for i := 1; i <= gatewayFailures; i++ {
+		resp := g.call()
+		if resp.status != http.StatusInternalServerError || resp.code != "fake_failure" {
+			g.t.Fatalf("failing request %d got %d %q, want the upstream's own 500", i, resp.status, resp.code)
+		}
+	}
+	if !g.waitFor("UNHEALTHY", 3*time.Second) {
+		g.t.Fatalf("the breaker did not open after %d failures in a row", gatewayFailures)
+	}
+}
+
+func TestGatewayTimesOutSlowUpstreams(t *testing.T) {
+	g := startGateway(t)
+
+	g.upstream.setMode("slow")
+	resp := g.call()
+	if resp.status != http.StatusGatewayTimeout || resp.code != "gateway_timeout" {
+		t.Errorf("a request past its budget got %d %q, want 504 gateway_timeout", resp.status, resp.code)
+	}
+	if resp.took >= 5*time.Second {
+		t.Errorf("a request past its 3s budget took %s", resp.took)
+	}
+
+	g.upstream.setMode("ok")
+	if resp := g.call(); resp.status != http.StatusOK {
+		t.Errorf("after the timeout got %d, want the upstream back", resp.status)
+	}
+}
+
+func TestGatewayBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	g := startGateway(t)
+	g.open()
+
+	forwarded := g.upstream.count(gatewayRoute)
+	resp := g.call()
+	if resp.status != http.StatusServiceUnavailable || resp.code != "service_unavailable" {
+		t.Errorf("a request with the breaker open got %d %q, want 503 service_unavailable", resp.status, resp.code)
+	}
+	if resp.retryAfter == "" {
+		t.Error("the 503 of an open breaker has no Retry-After")
+	}
+	for i := 0; i < 5; i++ {
+		g.call()
+	}
+	if got := g.upstream.count(gatewayRoute); got != forwarded {
+		t.Errorf("%d requests were forwarded with the breaker open", got-forwarded)
+	}
+}
+
+func TestGatewayBreakerProbesOncePerCoolDown(t *testing.T) {
+	g := startGateway(t)
+
+	// Healthy upstreams are not probed, so probes never open a breaker
+	probes := g.upstream.count(gatewayProbePath)
+	time.Sleep(gatewayCoolDown + 5*time.Second)
+	if got := g.upstream.count(gatewayProbePath); got != probes {
+		t.Errorf("a healthy upstream was probed %d times", got-probes)
+	}
+
+	// While open, one probe goes through per cool-down, and failing ones
+	// keep it open
+	g.open()
+	probes = g.upstream.count(gatewayProbePath)
+	time.Sleep(2*gatewayCoolDown + time.Second)
+	if failed := g.upstream.count(gatewayProbePath) - probes; failed < 1 || failed > 3 {
+		t.Errorf("%d probes in %s with the breaker open, want one per cool-down", failed, 2*gatewayCoolDown+time.Second)
+	}
+	if g.health() != "UNHEALTHY" {
+		t.Fatal("the breaker closed on failing probes")
+	}
+
+	// The first probe that succeeds closes it
+	g.upstream.setMode("ok")
+	probes = g.upstream.count(gatewayProbePath)
+	if !g.waitFor("HEALTHY", gatewayCoolDown+5*time.Second) {
+		t.Fatal("the breaker did not close once the upstream was back")
+	}
+	if got := g.upstream.count(gatewayProbePath) - probes; got != 1 {
+		t.Errorf("closing the breaker took %d probes, want 1", got)
+	}
+	if resp := g.call(); resp.status != http.StatusOK {
+		t.Errorf("after the breaker closed got %d, want requests forwarded", resp.status)
+	}
+}
@@ -0,0 +1,437 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	authnserver "github.com/4yrg/gradeloop-core/services/go/authn/pkg/server"
+	authzserver "github.com/4yrg/gradeloop-core/services/go/authz/pkg/server"
+	identityserver "github.com/4yrg/gradeloop-core/services/go/identity/pkg/server"
+	sessionserver "github.com/4yrg/gradeloop-core/services/go/session/pkg/server"
+	"github.com/alicebob/miniredis/v2"
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// internalToken is the shared secret the services call each other with
+const internalToken = "e2e-internal-token"
+
+// Postgres functions the services call, which SQLite lacks. The advisory
+// locks are no-ops: each database has one connection, which serialises the
+// transactions they would.
+func init() {
+	gosqlite.MustRegisterScalarFunction("hashtext", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return int64(0), nil
+	})
+	gosqlite.MustRegisterScalarFunction("pg_advisory_xact_lock", 1, func(*gosqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return nil, nil
+	})
+	// Timestamps are stored as sortable text, so the later is the larger
+	gosqlite.MustRegisterScalarFunction("greatest", 2, func(_ *gosqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if fmt.Sprint(args[0]) > fmt.Sprint(args[1]) {
+			return args[0], nil
+		}
+		return args[1], nil
+	})
+}
+
+// stack is the four services, wired to each other, and what is needed to
+// look behind their APIs
+type stack struct {
+	t *testing.T
+
+	authn, identity, session, authz, email *service
+
+	// The services' databases
+	identityDB, sessionDB, authzDB *gorm.DB
+	// Emails the services asked to send
+	emails *emailLog
+}
+
+// startStack serves the services until the test ends. If the test fails,
+// every request each service handled is logged.
+func startStack(t *testing.T) *stack {
+	t.Helper()
+	s := &stack{
+		t:        t,
+		authn:    newService(t, "authn"),
+		identity: newService(t, "identity"),
+		session:  newService(t, "session"),
+		authz:    newService(t, "authz"),
+		email:    newService(t, "email"),
+		emails:   &emailLog{},
+	}
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		for _, svc := range []*service{s.authn, s.identity, s.session, s.authz, s.email} {
+			t.Logf("%s log:\n%s", svc.name, svc.log.String())
+		}
+	})
+
+	rdb := miniredis.RunT(t)
+	t.Setenv("INTERNAL_SECRET", internalToken)
+	t.Setenv("REDIS_ADDR", rdb.Addr())
+
+	// authz
+	s.authzDB = openDB(t)
+	authz, err := authzserver.New(authzserver.Config{}, s.authzDB)
+	if err != nil {
+		t.Fatalf("authz: %v", err)
+	}
+	if err := authz.Service.Init(); err != nil {
+		t.Fatalf("authz: %v", err)
+	}
+	s.authz.serve(authz.App)
+
+	// session, over HTTP and gRPC
+	t.Setenv("SESSION_DATABASE_URL", "file::memory:")
+	sessionCfg, err := sessionserver.LoadConfig()
+	if err != nil {
+		t.Fatalf("session: %v", err)
+	}
+	s.sessionDB = openDB(t, sessionserver.Models()...)
+	sessionRedis := redis.NewClient(&redis.Options{Addr: rdb.Addr()})
+	t.Cleanup(func() { _ = sessionRedis.Close() })
+	session := sessionserver.New(sessionCfg, s.sessionDB, sessionRedis)
+	s.session.serve(session.App)
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = session.GRPC.Serve(grpcListener) }()
+	t.Cleanup(session.GRPC.Stop)
+
+	// identity, verifying access tokens against authn's keys
+	identityCfg := identityserver.LoadConfig()
+	identityCfg.AuthNJWKSURL = s.authn.url() + "/.well-known/jwks.json"
+	identityCfg.AuthZServiceURL = s.authz.url()
+	identityCfg.SessionServiceURL = s.session.url()
+	identityCfg.EmailServiceURL = s.email.url()
+	identityCfg.RedisAddr = rdb.Addr()
+	// Ask Redis every time, so a logout is seen at once
+	identityCfg.DenyListCacheTTL = 0
+	s.identityDB = openDB(t, identityserver.Models()...)
+	s.identity.serve(identityserver.New(identityCfg, s.identityDB, nil).App)
+
+	// authn
+	authnCfg := authnserver.LoadConfig()
+	authnCfg.IdentityServiceURL = s.identity.url()
+	authnCfg.SessionServiceURL = s.session.url()
+	authnCfg.SessionGRPCAddr = grpcListener.Addr().String()
+	authnCfg.AuthZServiceURL = s.authz.url()
+	authnCfg.EmailServiceURL = s.email.url()
+	authnCfg.WebURL = "http://web.test"
+	authn, err := authnserver.New(authnCfg)
+	if err != nil {
+		t.Fatalf("authn: %v", err)
+	}
+	s.authn.serve(authn.App)
+
+	s.email.handle(s.emails)
+	return s
+}
+
+// openDB opens a private in-memory database with models migrated
+func openDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each connection would get its own in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// service is an HTTP server for one service. It listens from the start, so
+// the services can be given each other's URLs before they are built.
+type service struct {
+	name   string
+	server *httptest.Server
+	log    *requestLog
+
+	mu      sync.RWMutex
+	handler http.Handler
+}
+
+func newService(t *testing.T, name string) *service {
+	svc := &service{name: name, log: &requestLog{}}
+	svc.server = httptest.NewServer(http.HandlerFunc(svc.serveHTTP))
+	t.Cleanup(svc.server.Close)
+	return svc
+}
+
+func (svc *service) url() string {
+	return svc.server.URL
+}
+
+// serve routes requests to app
+func (svc *service) serve(app *fiber.App) {
+	svc.handle(adaptor.FiberApp(app))
+}
+
+func (svc *service) handle(h http.Handler) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.handler = h
+}
+
+// serveHTTP logs each request and the response to it
+func (svc *service) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	svc.mu.RLock()
+	h := svc.handler
+	svc.mu.RUnlock()
+	if h == nil {
+		http.Error(w, svc.name+" is not serving yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	h.ServeHTTP(rec, r)
+	svc.log.add("%s %s -> %d (%s)\n  request:  %s\n  response: %s", r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Millisecond), clip(body), clip(rec.body.Bytes()))
+}
+
+// recorder keeps the status and body of a response as it is written
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// requestLog is what a service was asked and answered, in order
+type requestLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *requestLog) add(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, fmt.Sprintf(format, args...))
+}
+
+func (l *requestLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) == 0 {
+		return "  (no requests)"
+	}
+	return strings.Join(l.entries, "\n")
+}
+
+func clip(b []byte) string {
+	const max = 2048
+	if len(b) > max {
+		return string(b[:max]) + "..."
+	}
+	return string(b)
+}
+
+// emailLog stands in for the email service and its request log: each email
+// it is asked to send is a row, whether plain or templated
+type emailLog struct {
+	mu   sync.Mutex
+	rows []emailRow
+}
+
+type emailRow struct {
+	Recipient string
+	// Subject and Body of a plain email
+	Subject string
+	Body    string
+	// Template and Data of a templated one
+	Template string
+	Data     map[string]interface{}
+}
+
+func (l *emailLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Internal-Token") != internalToken {
+		http.Error(w, `{"error":"invalid internal token"}`, http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/internal/email/send":
+		var req struct {
+			To      string `json:"to"`
+			Subject string `json:"subject"`
+			Body    string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		l.add(emailRow{Recipient: req.To, Subject: req.Subject, Body: req.Body})
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Email sent"})
+
+	case "/internal/email/send-template":
+		var req struct {
+			TemplateName string `json:"template_name"`
+			Recipient    string `json:"recipient"`
+			Recipients   []struct {
+				Email string                 `json:"email"`
+				Data  map[string]interface{} `json:"data"`
+			} `json:"recipients"`
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+			return
+		}
+		if req.Recipient != "" {
+			l.add(emailRow{Recipient: req.Recipient, Template: req.TemplateName, Data: req.Data})
+			writeJSON(w, http.StatusAccepted, map[string]string{"message": "Email queued"})
+			return
+		}
+		var results []map[string]string
+		for _, recipient := range req.Recipients {
+			data := map[string]interface{}{}
+			for k, v := range req.Data {
+				data[k] = v
+			}
+			for k, v := range recipient.Data {
+				data[k] = v
+			}
+			l.add(emailRow{Recipient: recipient.Email, Template: req.TemplateName, Data: data})
+			results = append(results, map[string]string{"recipient": recipient.Email, "status": "queued"})
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"results": results})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (l *emailLog) add(row emailRow) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rows = append(l.rows, row)
+}
+
+// to returns the rows for recipient, oldest first
+func (l *emailLog) to(recipient string) []emailRow {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var rows []emailRow
+	for _, row := range l.rows {
+		if row.Recipient == recipient {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// response is a finished call to a service
+type response struct {
+	Status int
+	Body   []byte
+}
+
+// decode unmarshals the body into v, failing the test if it is not JSON
+func (r response) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("response %d is not JSON: %v: %s", r.Status, err, r.Body)
+	}
+}
+
+// call sends a request to svc. body is marshalled to JSON unless nil;
+// headers are name, value pairs.
+func (s *stack) call(svc *service, method, path string, body interface{}, headers ...string) response {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, svc.url()+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s %s: %v", svc.name, method, path, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return response{Status: resp.StatusCode, Body: raw}
+}
+
+// mustCall is call, failing the test unless the status is want
+func (s *stack) mustCall(want int, svc *service, method, path string, body interface{}, headers ...string) response {
+	s.t.Helper()
+	resp := s.call(svc, method, path, body, headers...)
+	if resp.Status != want {
+		s.t.Fatalf("%s %s %s = %d, want %d: %s", svc.name, method, path, resp.Status, want, resp.Body)
+	}
+	return resp
+}
+
+// eventually polls cond until it holds, for side effects written in the
+// background
+func (s *stack) eventually(what string, cond func() bool) {
+	s.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
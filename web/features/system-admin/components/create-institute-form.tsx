@@ -68,40 +68,37 @@ export function CreateInstituteForm() {
         const axiosError = error as {
           response?: {
             status?: number;
-            data?: { error?: string; message?: string };
+            data?: {
+              code?: string;
+              message?: string;
+              details?: { fields?: { field: string; message: string }[] };
+            };
           };
           message?: string;
         };
         console.error("Error response:", axiosError?.response);
         console.error("Error data:", axiosError?.response?.data);
 
-        // Handle different types of errors
-        if (axiosError?.response?.status === 500) {
-          const errorMessage =
-            axiosError?.response?.data?.error || axiosError?.message || "";
-          console.log("500 Error message:", errorMessage);
-          // Check if it's a duplicate code error
-          if (
-            errorMessage.includes("duplicate") &&
-            errorMessage.includes("idx_institutes_code")
-          ) {
-            form.setError("code", {
-              type: "manual",
-              message:
-                "This institute code already exists. Please choose a different code.",
-            });
-          } else {
-            form.setError("root", {
-              type: "manual",
-              message: "Failed to create institute. Please try again.",
-            });
-          }
+        // Field errors (422 invalid, 409 clashing with another institute)
+        const fields = axiosError?.response?.data?.details?.fields ?? [];
+        const codeError = fields.find((f) => f.field === "code");
+        if (axiosError?.response?.status === 409 && codeError) {
+          form.setError("code", {
+            type: "manual",
+            message:
+              "This institute code already exists. Please choose a different code.",
+          });
+        } else if (axiosError?.response?.status === 500) {
+          form.setError("root", {
+            type: "manual",
+            message: "Failed to create institute. Please try again.",
+          });
         } else {
           form.setError("root", {
             type: "manual",
             message:
+              fields.map((f) => `${f.field} ${f.message}`).join(", ") ||
               axiosError?.response?.data?.message ||
-              axiosError?.response?.data?.error ||
               "An error occurred while creating the institute.",
           });
         }
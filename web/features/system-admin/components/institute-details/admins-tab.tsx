@@ -75,11 +75,10 @@ export function AdminsTab({ admins, instituteId, onRefresh }: AdminsTabProps) {
     } catch (error: unknown) {
       console.error("Failed to resend invitation:", error);
 
-      // Check for specific error messages
-      const errorMessage = (
-        error as { response?: { data?: { error?: string } } }
-      )?.response?.data?.error;
-      if (errorMessage === "admin has already activated their account") {
+      const errorCode = (
+        error as { response?: { data?: { code?: string } } }
+      )?.response?.data?.code;
+      if (errorCode === "admin_already_active") {
         toast.error(`${admin.name} has already activated their account`);
       } else {
         toast.error("Failed to resend invitation");